@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// APITokenPrefix marks personal access tokens so they can be told apart from JWTs.
+const APITokenPrefix = "crush_pat_"
+
+// Scopes that can be granted to a personal access token.
+const (
+	ScopeReadSessions = "read:sessions"
+	ScopeWritePrompts = "write:prompts"
+	ScopeAdminProject = "admin:project"
+)
+
+// AllScopes lists every scope a personal access token may carry.
+var AllScopes = []string{ScopeReadSessions, ScopeWritePrompts, ScopeAdminProject}
+
+// scopeAliases maps the short scope names accepted when creating a token to
+// the scopes they stand for.
+var scopeAliases = map[string]string{
+	"read":  ScopeReadSessions,
+	"write": ScopeWritePrompts,
+	"admin": ScopeAdminProject,
+}
+
+var ErrInsufficientScope = errors.New("token is missing the required scope")
+
+// APITokenValidator resolves a personal access token to the claims of its owner.
+type APITokenValidator interface {
+	ValidateAPIToken(ctx context.Context, token string) (*Claims, error)
+}
+
+var (
+	apiTokenValidator   APITokenValidator
+	apiTokenValidatorMu sync.RWMutex
+)
+
+// SetAPITokenValidator registers the validator used for personal access tokens.
+// Without one, personal access tokens are rejected.
+func SetAPITokenValidator(v APITokenValidator) {
+	apiTokenValidatorMu.Lock()
+	defer apiTokenValidatorMu.Unlock()
+	apiTokenValidator = v
+}
+
+// IsAPIToken reports whether the bearer token is a personal access token.
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// ValidScope reports whether scope is a known scope.
+func ValidScope(scope string) bool {
+	return slices.Contains(AllScopes, scope)
+}
+
+// NormalizeScope resolves a scope or its short name (read, write or admin)
+// to the scope, and reports whether it is known.
+func NormalizeScope(scope string) (string, bool) {
+	if full, ok := scopeAliases[scope]; ok {
+		return full, true
+	}
+	return scope, ValidScope(scope)
+}
+
+// Authenticate validates a bearer token, either a login JWT or a personal
+// access token, and returns the claims of the user it acts for.
+func Authenticate(ctx context.Context, token string) (*Claims, error) {
+	if !IsAPIToken(token) {
+		return ValidateToken(token)
+	}
+	apiTokenValidatorMu.RLock()
+	v := apiTokenValidator
+	apiTokenValidatorMu.RUnlock()
+	if v == nil {
+		return nil, ErrInvalidToken
+	}
+	return v.ValidateAPIToken(ctx, token)
+}
+
+// HasScope reports whether the claims allow the given scope. Login sessions
+// carry no token ID and are allowed everything their user is.
+func (c *Claims) HasScope(scope string) bool {
+	if c.TokenID == "" {
+		return true
+	}
+	return slices.Contains(c.Scopes, scope)
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubValidator struct {
+	claims *Claims
+}
+
+func (v stubValidator) ValidateAPIToken(ctx context.Context, token string) (*Claims, error) {
+	if token != APITokenPrefix+"valid" {
+		return nil, ErrInvalidToken
+	}
+	return v.claims, nil
+}
+
+func TestAuthenticateAPIToken(t *testing.T) {
+	SetAPITokenValidator(nil)
+	_, err := Authenticate(context.Background(), APITokenPrefix+"valid")
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens are rejected without a validator")
+
+	SetAPITokenValidator(stubValidator{claims: &Claims{
+		UserID:  "user-1",
+		TokenID: "token-1",
+		Scopes:  []string{ScopeReadSessions},
+	}})
+	t.Cleanup(func() { SetAPITokenValidator(nil) })
+
+	claims, err := Authenticate(context.Background(), APITokenPrefix+"valid")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+	assert.True(t, claims.HasScope(ScopeReadSessions))
+	assert.False(t, claims.HasScope(ScopeWritePrompts))
+
+	_, err = Authenticate(context.Background(), APITokenPrefix+"other")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestLoginClaimsHaveAllScopes(t *testing.T) {
+	token, err := GenerateToken("user-1", "alice")
+	require.NoError(t, err)
+
+	claims, err := Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	for _, scope := range AllScopes {
+		assert.True(t, claims.HasScope(scope), scope)
+	}
+}
+
+func TestNormalizeScope(t *testing.T) {
+	for alias, scope := range map[string]string{"read": ScopeReadSessions, "write": ScopeWritePrompts, "admin": ScopeAdminProject} {
+		got, ok := NormalizeScope(alias)
+		assert.True(t, ok)
+		assert.Equal(t, scope, got)
+	}
+	got, ok := NormalizeScope(ScopeWritePrompts)
+	assert.True(t, ok)
+	assert.Equal(t, ScopeWritePrompts, got)
+	_, ok = NormalizeScope("delete:everything")
+	assert.False(t, ok)
+}
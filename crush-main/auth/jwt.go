@@ -27,6 +27,9 @@ var (
 type Claims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	// TokenID and Scopes are set when the request uses a personal access token
+	TokenID string   `json:"token_id,omitempty"`
+	Scopes  []string `json:"scopes,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -25,7 +25,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 		
 		token := parts[1]
-		claims, err := ValidateToken(token)
+		claims, err := Authenticate(r.Context(), token)
 		if err != nil {
 			slog.Error("Token validation failed", "error", err)
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
@@ -62,7 +62,7 @@ func GinAuthMiddleware() gin.HandlerFunc {
 		}
 		
 		token := parts[1]
-		claims, err := ValidateToken(token)
+		claims, err := Authenticate(c.Request.Context(), token)
 		if err != nil {
 			slog.Error("Token validation failed", "error", err)
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -72,14 +72,63 @@ func GinAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		
-		slog.Info("User authenticated", "user_id", claims.UserID, "username", claims.Username)
+		slog.Info("User authenticated", "user_id", claims.UserID, "username", claims.Username, "token_id", claims.TokenID)
 		
 		// Store user info in context for use in handlers
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("claims", claims)
 		
 		// Token is valid, proceed to the next handler
 		c.Next()
 	}
 }
 
+// GinRequireScope is a Gin middleware that rejects personal access tokens
+// lacking the given scope. It must run after GinAuthMiddleware.
+func GinRequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.MustGet("claims").(*Claims)
+		if !ok || !claims.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Token is missing the required scope: " + scope,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// GinRequireOperator is a Gin middleware that only lets the operators of
+// the instance through, for the instance-wide admin routes. It must run after
+// GinAuthMiddleware.
+func GinRequireOperator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.MustGet("claims").(*Claims)
+		if !ok || !IsOperator(claims) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This endpoint requires an operator of the instance",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// GinRequireLogin is a Gin middleware that rejects personal access tokens,
+// for routes that must only be used from an interactive login.
+func GinRequireLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.MustGet("claims").(*Claims)
+		if !ok || claims.TokenID != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This endpoint requires a login session",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// IsOperator reports whether the claims belong to an operator of the
+// instance, a user listed by ID or username in auth.admins. Without the list
+// nobody is an operator.
+func IsOperator(claims *Claims) bool {
+	if claims == nil {
+		return false
+	}
+	appCfg := config.GetGlobalAppConfig()
+	if appCfg == nil {
+		return false
+	}
+	admins := appCfg.Auth.Admins
+	return (claims.UserID != "" && slices.Contains(admins, claims.UserID)) ||
+		(claims.Username != "" && slices.Contains(admins, claims.Username))
+}
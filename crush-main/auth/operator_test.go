@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withAdmins(t *testing.T, admins ...string) {
+	previous := config.GetGlobalAppConfig()
+	appCfg := *previous
+	appCfg.Auth.Admins = admins
+	config.SetGlobalAppConfig(&appCfg)
+	t.Cleanup(func() { config.SetGlobalAppConfig(previous) })
+}
+
+func TestGinRequireOperator(t *testing.T) {
+	withAdmins(t, "root", "user-2")
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/admin", GinAuthMiddleware(), GinRequireScope(ScopeAdminProject), GinRequireOperator(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for name, tc := range map[string]struct {
+		userID, username string
+		status           int
+	}{
+		"normal login":        {"user-1", "alice", http.StatusForbidden},
+		"operator by name":    {"user-3", "root", http.StatusOK},
+		"operator by user ID": {"user-2", "bob", http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			token, err := GenerateToken(tc.userID, tc.username)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
+
+func TestIsOperatorWithoutAdmins(t *testing.T) {
+	withAdmins(t)
+	assert.False(t, IsOperator(&Claims{UserID: "user-1", Username: "alice"}))
+	assert.False(t, IsOperator(nil))
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultShareTTL is how long a share link is valid when no expiry is asked.
+	DefaultShareTTL = 24 * time.Hour
+	// MaxShareTTL bounds the validity of a share link.
+	MaxShareTTL = 30 * 24 * time.Hour
+
+	shareIssuer = "crush-server:share"
+)
+
+// ShareClaims are the claims of a read-only share link of a session.
+type ShareClaims struct {
+	SessionID string `json:"session_id"`
+	// SharedBy is the user who created the link
+	SharedBy string `json:"shared_by"`
+	jwt.RegisteredClaims
+}
+
+// shareSecret derives the key of the share tokens from the JWT secret, so
+// that a share token is never accepted as a login token and the other way
+// around.
+func shareSecret() []byte {
+	mac := hmac.New(sha256.New, getJWTSecret())
+	mac.Write([]byte("session-share"))
+	return mac.Sum(nil)
+}
+
+// GenerateShareToken generates a signed token granting read-only access to a
+// session until it expires, ttl being bounded by MaxShareTTL.
+func GenerateShareToken(sessionID, userID string, ttl time.Duration) (string, *ShareClaims, error) {
+	if sessionID == "" {
+		return "", nil, errors.New("session ID is required")
+	}
+	if ttl <= 0 {
+		ttl = DefaultShareTTL
+	}
+	ttl = min(ttl, MaxShareTTL)
+
+	now := time.Now()
+	claims := &ShareClaims{
+		SessionID: sessionID,
+		SharedBy:  userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    shareIssuer,
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(shareSecret())
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// ValidateShareToken validates a share token and returns its claims.
+func ValidateShareToken(tokenString string) (*ShareClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ShareClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidSignature
+		}
+		return shareSecret(), nil
+	}, jwt.WithIssuer(shareIssuer), jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*ShareClaims)
+	if !ok || !token.Valid || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
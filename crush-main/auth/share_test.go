@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareToken(t *testing.T) {
+	token, claims, err := GenerateShareToken("s1", "u1", time.Hour)
+	require.NoError(t, err)
+
+	got, err := ValidateShareToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "s1", got.SessionID)
+	assert.Equal(t, "u1", got.SharedBy)
+	assert.Equal(t, claims.ID, got.ID)
+
+	_, err = ValidateToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "share tokens are not login tokens")
+
+	login, err := GenerateToken("u1", "alice")
+	require.NoError(t, err)
+	_, err = ValidateShareToken(login)
+	assert.ErrorIs(t, err, ErrInvalidToken, "login tokens are not share tokens")
+
+	_, err = ValidateShareToken(token + "x")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestShareTokenExpiry(t *testing.T) {
+	_, claims, err := GenerateShareToken("s1", "u1", 365*24*time.Hour)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(MaxShareTTL), claims.ExpiresAt.Time, time.Minute)
+
+	_, claims, err = GenerateShareToken("s1", "u1", 0)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(DefaultShareTTL), claims.ExpiresAt.Time, time.Minute)
+
+	_, _, err = GenerateShareToken("", "u1", time.Hour)
+	require.Error(t, err)
+}
@@ -2,22 +2,43 @@
 package app
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"log/slog"
+	"time"
 
+	"github.com/rolling1314/rolling-crush/auth"
 	"github.com/rolling1314/rolling-crush/cmd/http-server/handler"
+	"github.com/rolling1314/rolling-crush/domain/account"
+	"github.com/rolling1314/rolling-crush/domain/analytics"
+	"github.com/rolling1314/rolling-crush/domain/budget"
+	"github.com/rolling1314/rolling-crush/domain/history"
 	"github.com/rolling1314/rolling-crush/domain/message"
 	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/domain/secret"
 	"github.com/rolling1314/rolling-crush/domain/session"
+	"github.com/rolling1314/rolling-crush/domain/snapshot"
 	"github.com/rolling1314/rolling-crush/domain/toolcall"
+	"github.com/rolling1314/rolling-crush/domain/upload"
 	"github.com/rolling1314/rolling-crush/domain/user"
 	"github.com/rolling1314/rolling-crush/infra/postgres"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
 	"github.com/rolling1314/rolling-crush/infra/sandbox"
 	"github.com/rolling1314/rolling-crush/infra/storage"
 	"github.com/rolling1314/rolling-crush/pkg/config"
 )
 
+// Default upload limits, in MiB, when the storage config sets none.
+const (
+	defaultUploadMaxFileSizeMB = 50
+	defaultUploadUserQuotaMB   = 1024
+)
+
+// defaultRetentionGraceDays is how long soft-deleted sessions are kept when
+// the retention config sets no grace period.
+const defaultRetentionGraceDays = 7
+
 // HTTPApp represents the HTTP-only application instance.
 // It contains only the services required for HTTP API operations.
 type HTTPApp struct {
@@ -29,13 +50,21 @@ type HTTPApp struct {
 
 	HTTPServer *handler.Server
 
-	config *config.Config
-	db     *sql.DB
+	config  *config.Config
+	db      *sql.DB
+	replica *sql.DB
 }
 
-// NewHTTPApp creates a new HTTP-only application instance.
-func NewHTTPApp(ctx context.Context, conn *sql.DB, cfg *config.Config, port string) (*HTTPApp, error) {
-	q := postgres.New(conn)
+// NewHTTPApp creates a new HTTP-only application instance. When replica is
+// not nil, the reads marked with postgres.WithReplica are served by it.
+// secrets is the encrypted secrets store, nil when disabled.
+func NewHTTPApp(ctx context.Context, conn, replica *sql.DB, cfg *config.Config, secrets secret.Service, port string) (*HTTPApp, error) {
+	var q *postgres.Queries
+	if replica != nil {
+		q = postgres.New(postgres.WithTracing(postgres.NewReplicaRouter(conn, replica)))
+	} else {
+		q = postgres.New(postgres.WithTracing(conn))
+	}
 
 	users := user.NewService(q)
 	projects := project.NewService(q)
@@ -43,6 +72,9 @@ func NewHTTPApp(ctx context.Context, conn *sql.DB, cfg *config.Config, port stri
 	messages := message.NewService(q)
 	toolCalls := toolcall.NewService(q)
 
+	// Personal access tokens are resolved by the user service
+	auth.SetAPITokenValidator(users)
+
 	// Initialize storage client from app config (must be before creating HTTPServer)
 	appCfg := config.GetGlobalAppConfig()
 	if err := storage.InitGlobalClientFromConfig(appCfg); err != nil {
@@ -59,6 +91,93 @@ func NewHTTPApp(ctx context.Context, conn *sql.DB, cfg *config.Config, port stri
 		slog.Info("Sandbox client configured", "base_url", appCfg.Sandbox.BaseURL)
 	}
 
+	// Initialize Redis for session status lookups and commands to the WS service
+	if err := storeredis.InitGlobalClient(); err != nil {
+		slog.Warn("Failed to initialize Redis client, session status and project pause notifications will be unavailable", "error", err)
+	}
+
+	// Account exports and deletions reach into storage and Redis when available
+	var objects account.ObjectStore
+	if client := storage.GetMinIOClient(); client != nil {
+		objects = client
+	}
+	var keys account.KeyPurger
+	if client := storeredis.GetClient(); client != nil {
+		keys = storeredis.NewStreamService(client)
+	}
+	// Sessions past their retention are soft-deleted, then purged after the grace period
+	var retention account.RetentionPolicy
+	if appCfg != nil {
+		retention = account.RetentionPolicy{
+			SessionDays: appCfg.Retention.SessionDays,
+			Grace:       time.Duration(cmp.Or(appCfg.Retention.GraceDays, defaultRetentionGraceDays)) * 24 * time.Hour,
+			BatchSize:   appCfg.Retention.BatchSize,
+		}
+	}
+	accounts := account.NewService(q, messages, objects, keys, retention)
+	if appCfg != nil {
+		go account.RunRetention(ctx, accounts, time.Duration(appCfg.Retention.Interval)*time.Second)
+	}
+
+	// Resumable attachment uploads, images only as the agent fetches them as such
+	var uploadObjects upload.ObjectStore
+	if client := storage.GetMinIOClient(); client != nil {
+		uploadObjects = client
+	}
+	uploadLimits := upload.Limits{
+		MaxFileSize:  defaultUploadMaxFileSizeMB << 20,
+		UserQuota:    defaultUploadUserQuotaMB << 20,
+		AllowedTypes: storage.ValidImageTypes(),
+	}
+	if appCfg != nil {
+		uploadLimits.MaxFileSize = int64(cmp.Or(appCfg.Storage.Uploads.MaxFileSizeMB, defaultUploadMaxFileSizeMB)) << 20
+		uploadLimits.UserQuota = int64(cmp.Or(appCfg.Storage.Uploads.UserQuotaMB, defaultUploadUserQuotaMB)) << 20
+	}
+	uploads := upload.NewService(q, uploadObjects, uploadLimits)
+
+	// Spending limits of the agent, the configured ones apply until set through the API
+	var budgetDefaults budget.Defaults
+	if appCfg != nil {
+		budgetDefaults = budget.Defaults{
+			Session: budget.Limit(appCfg.Budgets.Session),
+			Project: budget.Limit(appCfg.Budgets.Project),
+			User:    budget.Limit(appCfg.Budgets.User),
+		}
+	}
+	budgets := budget.NewService(q, budgetDefaults)
+
+	// Workspace snapshots are archived by the sandbox and kept in storage
+	var snapshotObjects snapshot.ObjectStore
+	if client := storage.GetMinIOClient(); client != nil {
+		snapshotObjects = client
+	}
+	var snapshotOpts snapshot.Options
+	if appCfg != nil {
+		snapshotOpts = snapshot.Options{
+			MaxSize:   int64(appCfg.Sandbox.SnapshotMaxSize) << 20,
+			Retention: appCfg.Sandbox.SnapshotRetention,
+		}
+	}
+	snapshots := snapshot.NewService(q, snapshotObjects, sandbox.GetDefaultClient(), snapshotOpts)
+
+	// Flag sandbox containers and projects that lost each other
+	reconcilerOpts := project.ReconcilerOptions{}
+	if appCfg != nil {
+		reconcilerOpts = project.ReconcilerOptions{
+			Interval:   time.Duration(appCfg.Sandbox.ReconcileInterval) * time.Second,
+			AutoClean:  appCfg.Sandbox.OrphanAutoClean,
+			CleanAfter: time.Duration(appCfg.Sandbox.OrphanCleanAfter) * time.Second,
+		}
+	}
+	reconciler := project.NewReconciler(projects, sandbox.GetDefaultClient(), reconcilerOpts)
+	go reconciler.Run(ctx)
+
+	// Daily rollups of the usage read by the analytics endpoints
+	analyticsService := analytics.NewService(q)
+	if appCfg != nil {
+		go analytics.RunRollups(ctx, analyticsService, time.Duration(appCfg.Analytics.RollupInterval)*time.Second)
+	}
+
 	app := &HTTPApp{
 		Users:     users,
 		Projects:  projects,
@@ -66,10 +185,11 @@ func NewHTTPApp(ctx context.Context, conn *sql.DB, cfg *config.Config, port stri
 		Messages:  messages,
 		ToolCalls: toolCalls,
 
-		config: cfg,
-		db:     conn,
+		config:  cfg,
+		db:      conn,
+		replica: replica,
 
-		HTTPServer: handler.New(port, users, projects, sessions, messages, toolCalls, q, cfg),
+		HTTPServer: handler.New(port, users, projects, sessions, messages, toolCalls, accounts, uploads, budgets, analyticsService, snapshots, history.NewService(q, conn), secrets, reconciler, q, cfg),
 	}
 
 	return app, nil
@@ -89,6 +209,11 @@ func (app *HTTPApp) Shutdown() {
 			slog.Error("Failed to close database connection", "error", err)
 		}
 	}
+	if app.replica != nil {
+		if err := app.replica.Close(); err != nil {
+			slog.Error("Failed to close replica database connection", "error", err)
+		}
+	}
 }
 
 // Config returns the application configuration.
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/account"
+)
+
+// handleCreateAccountExport starts exporting all data of the current user
+func (s *Server) handleCreateAccountExport(c *gin.Context) {
+	userID := c.GetString("user_id")
+	job, err := s.accountService.StartExport(c.Request.Context(), userID)
+	if errors.Is(err, account.ErrStorageUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	slog.Info("Account export requested", "user_id", userID, "job_id", job.ID)
+	c.JSON(http.StatusAccepted, exportJobToResponse(job))
+}
+
+// handleListAccountExports lists the export jobs of the current user
+func (s *Server) handleListAccountExports(c *gin.Context) {
+	jobs, err := s.accountService.ListExports(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	response := make([]AccountExportResponse, len(jobs))
+	for i, job := range jobs {
+		response[i] = exportJobToResponse(job)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleGetAccountExport returns an export job of the current user
+func (s *Server) handleGetAccountExport(c *gin.Context) {
+	job, err := s.accountService.GetExport(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if errors.Is(err, account.ErrExportNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, exportJobToResponse(job))
+}
+
+// handleDownloadAccountExport streams the archive of a completed export job
+func (s *Server) handleDownloadAccountExport(c *gin.Context) {
+	jobID := c.Param("id")
+	reader, size, err := s.accountService.OpenExport(c.Request.Context(), c.GetString("user_id"), jobID)
+	switch {
+	case errors.Is(err, account.ErrExportNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, account.ErrExportNotReady):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, account.ErrStorageUnavailable):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Disposition", `attachment; filename="crush-export-`+jobID+`.zip"`)
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		slog.Warn("Failed to stream account export", "job_id", jobID, "error", err)
+	}
+}
+
+// handleDeleteAccount permanently deletes the current user and all their data
+func (s *Server) handleDeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := c.GetString("user_id")
+	u, err := s.userService.GetByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return
+	}
+	if req.Confirm != u.Username {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Confirm must be the username of the account"})
+		return
+	}
+
+	report, err := s.accountService.DeleteAccount(ctx, userID)
+	if err != nil {
+		slog.Error("Account deletion failed", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// handleRetentionReport reports the sessions the next retention run would
+// soft-delete and purge, without removing anything
+func (s *Server) handleRetentionReport(c *gin.Context) {
+	report, err := s.accountService.ApplyRetention(c.Request.Context(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// exportJobToResponse converts an export job to its API response
+func exportJobToResponse(job account.ExportJob) AccountExportResponse {
+	resp := AccountExportResponse{
+		ID:          job.ID,
+		Status:      job.Status,
+		Size:        job.Size,
+		Error:       job.Error,
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+	}
+	if job.Status == account.ExportStatusCompleted {
+		resp.DownloadURL = "/api/account/exports/" + job.ID + "/download"
+	}
+	return resp
+}
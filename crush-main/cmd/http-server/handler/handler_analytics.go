@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/analytics"
+)
+
+// handleAnalyticsUsage returns the tokens and cost of the model requests in
+// the projects of the user, grouped by day, project or model.
+func (s *Server) handleAnalyticsUsage(c *gin.Context) {
+	serveAnalytics(c, c.GetString("user_id"), s.analyticsService.Usage)
+}
+
+// handleAnalyticsTools returns the tool calls in the projects of the user,
+// grouped by day, project or tool.
+func (s *Server) handleAnalyticsTools(c *gin.Context) {
+	serveAnalytics(c, c.GetString("user_id"), s.analyticsService.Tools)
+}
+
+// handleAnalyticsRuns returns the durations of the agent turns in the projects
+// of the user, grouped by day or project.
+func (s *Server) handleAnalyticsRuns(c *gin.Context) {
+	serveAnalytics(c, c.GetString("user_id"), s.analyticsService.Runs)
+}
+
+// handleAnalyticsFeedback returns the ratings of the answers in the projects of
+// the user, grouped by day, project, model or category.
+func (s *Server) handleAnalyticsFeedback(c *gin.Context) {
+	serveAnalytics(c, c.GetString("user_id"), s.analyticsService.Feedback)
+}
+
+// handleAdminAnalyticsUsage returns the model usage of the instance, or of the
+// user_id query parameter.
+func (s *Server) handleAdminAnalyticsUsage(c *gin.Context) {
+	serveAnalytics(c, c.Query("user_id"), s.analyticsService.Usage)
+}
+
+// handleAdminAnalyticsTools returns the tool calls of the instance, or of the
+// user_id query parameter.
+func (s *Server) handleAdminAnalyticsTools(c *gin.Context) {
+	serveAnalytics(c, c.Query("user_id"), s.analyticsService.Tools)
+}
+
+// handleAdminAnalyticsRuns returns the agent turns of the instance, or of the
+// user_id query parameter.
+func (s *Server) handleAdminAnalyticsRuns(c *gin.Context) {
+	serveAnalytics(c, c.Query("user_id"), s.analyticsService.Runs)
+}
+
+// handleAdminAnalyticsFeedback returns the ratings of the answers of the
+// instance, or of the user_id query parameter.
+func (s *Server) handleAdminAnalyticsFeedback(c *gin.Context) {
+	serveAnalytics(c, c.Query("user_id"), s.analyticsService.Feedback)
+}
+
+// serveAnalytics answers an analytics query read from the group_by (default:
+// day), project_id, since and until query parameters. since and until are
+// RFC 3339 times or Unix milliseconds, the last 30 days by default.
+func serveAnalytics[T any](c *gin.Context, userID string, list func(context.Context, analytics.Query) ([]T, error)) {
+	query := analytics.Query{
+		UserID:    userID,
+		ProjectID: c.Query("project_id"),
+		GroupBy:   analytics.GroupBy(c.DefaultQuery("group_by", string(analytics.GroupByDay))),
+	}
+	var err error
+	if query.Since, err = parseAuditTime(c.Query("since")); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "since must be an RFC 3339 time or Unix milliseconds"})
+		return
+	}
+	if query.Until, err = parseAuditTime(c.Query("until")); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "until must be an RFC 3339 time or Unix milliseconds"})
+		return
+	}
+
+	rows, err := list(c.Request.Context(), query)
+	if errors.Is(err, analytics.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "unsupported group_by or until before since"})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to query analytics", "user_id", userID, "path", c.FullPath(), "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to query analytics"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
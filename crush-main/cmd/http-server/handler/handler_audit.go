@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/audit"
+)
+
+// handleGetSessionAuditEvents returns the audit log entries of a session
+func (s *Server) handleGetSessionAuditEvents(c *gin.Context) {
+	sessionID := c.Param("id")
+	events, err := s.db.ListAuditEventsBySession(c.Request.Context(), sql.NullString{String: sessionID, Valid: true})
+	if err != nil {
+		slog.Error("Failed to list audit events", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list audit events"})
+		return
+	}
+
+	responses := make([]AuditEventResponse, len(events))
+	for i, event := range events {
+		detail := json.RawMessage(event.Detail)
+		if !json.Valid(detail) {
+			detail = json.RawMessage("{}")
+		}
+		responses[i] = AuditEventResponse{
+			ID:        event.ID,
+			SessionID: event.SessionID.String,
+			MessageID: event.MessageID.String,
+			Category:  event.Category,
+			Action:    event.Action,
+			Detail:    detail,
+			CreatedAt: event.CreatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// handleListToolAuditEntries returns the tool calls run by the agent in the
+// projects of the user, filtered by session, project, tool and time range.
+// since and until are RFC 3339 times or Unix milliseconds.
+func (s *Server) handleListToolAuditEntries(c *gin.Context) {
+	filter := audit.Filter{
+		UserID:    c.GetString("user_id"),
+		SessionID: c.Query("session_id"),
+		ProjectID: c.Query("project_id"),
+		ToolName:  c.Query("tool"),
+	}
+	var err error
+	if filter.Since, err = parseAuditTime(c.Query("since")); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "since must be an RFC 3339 time or Unix milliseconds"})
+		return
+	}
+	if filter.Until, err = parseAuditTime(c.Query("until")); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "until must be an RFC 3339 time or Unix milliseconds"})
+		return
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil || filter.Offset < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "offset must be a non-negative integer"})
+			return
+		}
+	}
+
+	entries, err := s.auditService.List(c.Request.Context(), filter)
+	if errors.Is(err, audit.ErrInvalidFilter) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "until must be after since"})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to list tool audit entries", "user_id", filter.UserID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list tool audit entries"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// parseAuditTime parses a time bound of the audit log, 0 when empty.
+func parseAuditTime(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
@@ -138,9 +138,6 @@ func (s *Server) handleGitHubLogin(c *gin.Context) {
 func (s *Server) handleGitHubCallback(c *gin.Context) {
 	code := c.Query("code")
 	state := c.Query("state")
-	fmt.Println("------------------github auth code")
-	fmt.Println(code)
-	fmt.Println("------------------github auth code")
 
 	if code == "" {
 		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"?error=missing_code")
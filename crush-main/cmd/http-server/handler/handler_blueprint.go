@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/project"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// handleListBlueprints returns the session blueprints of a project
+func (s *Server) handleListBlueprints(c *gin.Context) {
+	blueprints, err := s.projectService.ListBlueprints(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	resp := make([]BlueprintResponse, len(blueprints))
+	for i, blueprint := range blueprints {
+		resp[i] = blueprintToResponse(blueprint)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleCreateBlueprint adds a session blueprint to a project
+func (s *Server) handleCreateBlueprint(c *gin.Context) {
+	projectID := c.Param("id")
+	var req BlueprintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := s.validateBlueprintAgent(req.Agent); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	blueprint, err := s.projectService.CreateBlueprint(ctx, projectID, req.params())
+	if errors.Is(err, project.ErrBlueprintExists) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	slog.Info("Session blueprint created", "project_id", projectID, "blueprint_id", blueprint.ID, "name", blueprint.Name)
+	c.JSON(http.StatusCreated, blueprintToResponse(blueprint))
+}
+
+// handleUpdateBlueprint replaces a session blueprint
+func (s *Server) handleUpdateBlueprint(c *gin.Context) {
+	var req BlueprintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := s.validateBlueprintAgent(req.Agent); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	blueprint, err := s.projectService.UpdateBlueprint(c.Request.Context(), c.Param("id"), c.Param("blueprintId"), req.params())
+	if errors.Is(err, project.ErrBlueprintNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, project.ErrBlueprintExists) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, blueprintToResponse(blueprint))
+}
+
+// handleDeleteBlueprint removes a session blueprint from a project
+func (s *Server) handleDeleteBlueprint(c *gin.Context) {
+	if err := s.projectService.DeleteBlueprint(c.Request.Context(), c.Param("id"), c.Param("blueprintId")); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session blueprint deleted"})
+}
+
+// handleCreateBlueprintSession creates a session of a project from the
+// blueprint named by the blueprint query parameter. The session gets the model
+// and pinned context of the blueprint, may use its tools without asking, and
+// its opening prompts are handed to a WS instance to run in order.
+func (s *Server) handleCreateBlueprintSession(c *gin.Context) {
+	projectID := c.Param("id")
+	name := c.Query("blueprint")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "blueprint query parameter is required"})
+		return
+	}
+	var req CreateBlueprintSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+	blueprint, err := s.projectService.GetBlueprintByName(ctx, projectID, name)
+	if errors.Is(err, project.ErrBlueprintNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Opening prompts are run by a WS instance, check it can be reached before
+	// creating a session that would never start
+	redisCmd := storeredis.GetGlobalCommandService()
+	if len(blueprint.Prompts) > 0 && redisCmd == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Agent service unavailable"})
+		return
+	}
+
+	sess, err := s.sessionService.Create(ctx, projectID, cmp.Or(req.Title, blueprint.Name))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// The model and the pinned context go through one session config so that
+	// neither write replaces the other
+	modelConfig := autoSessionModelConfig()
+	if blueprint.Model != nil {
+		modelConfig = &SessionModelConfig{
+			Provider:        blueprint.Model.Provider,
+			Model:           blueprint.Model.Model,
+			ReasoningEffort: blueprint.Model.ReasoningEffort,
+		}
+		if blueprint.Model.MaxTokens > 0 {
+			modelConfig.MaxTokens = &blueprint.Model.MaxTokens
+		}
+	}
+	sessionConfig := s.newSessionConfig(sess.ID)
+	s.writeSessionModelConfig(sessionConfig, sess.ID, modelConfig)
+	if blueprint.PinnedContext != "" {
+		if err := sessionConfig.SetConfigField("options.pinned_context", blueprint.PinnedContext); err != nil {
+			slog.Error("Failed to set pinned context", "session_id", sess.ID, "error", err)
+		}
+	}
+
+	if len(blueprint.AllowedTools) > 0 {
+		if redisStream := storeredis.GetGlobalStreamService(); redisStream != nil {
+			for _, tool := range blueprint.AllowedTools {
+				if err := redisStream.AddToSessionAllowlist(ctx, sess.ID, storeredis.ToolAllowlistEntry{ToolName: tool}); err != nil {
+					slog.Error("Failed to allow blueprint tool", "session_id", sess.ID, "tool", tool, "error", err)
+				}
+			}
+		} else {
+			slog.Warn("Redis unavailable, blueprint tools will ask for permission", "session_id", sess.ID)
+		}
+	}
+
+	if len(blueprint.Prompts) > 0 {
+		run := storeredis.BlueprintRunPayload{
+			SessionID: sess.ID,
+			ProjectID: projectID,
+			Blueprint: blueprint.Name,
+			Agent:     blueprint.Agent,
+			Prompts:   blueprint.Prompts,
+		}
+		if err := redisCmd.PublishBlueprintRun(ctx, run); err != nil {
+			slog.Error("Failed to publish blueprint run", "project_id", projectID, "session_id", sess.ID, "error", err)
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Agent service unavailable"})
+			return
+		}
+	}
+
+	slog.Info("Session created from blueprint",
+		"project_id", projectID,
+		"session_id", sess.ID,
+		"blueprint", blueprint.Name,
+		"prompts", len(blueprint.Prompts),
+	)
+	c.JSON(http.StatusCreated, BlueprintSessionResponse{
+		SessionResponse: SessionResponse{
+			ID:               sess.ID,
+			ProjectID:        sess.ProjectID,
+			Title:            sess.Title,
+			MessageCount:     sess.MessageCount,
+			PromptTokens:     sess.PromptTokens,
+			CompletionTokens: sess.CompletionTokens,
+			Cost:             sess.Cost,
+			ContextWindow:    s.getSessionContextWindow(ctx, sess.ID),
+			CreatedAt:        sess.CreatedAt,
+			UpdatedAt:        sess.UpdatedAt,
+		},
+		Blueprint: blueprint.Name,
+		Prompts:   len(blueprint.Prompts),
+	})
+}
+
+// validateBlueprintAgent checks that the opening prompts of a blueprint are
+// routed to an agent the coordinator knows
+func (s *Server) validateBlueprintAgent(name string) error {
+	if name == "" || s.config == nil {
+		return nil
+	}
+	if _, ok := s.config.Agents[name]; !ok || name == config.AgentTask {
+		return fmt.Errorf("unknown agent %q", name)
+	}
+	return nil
+}
+
+// params converts the request to session blueprint parameters
+func (req BlueprintRequest) params() project.BlueprintParams {
+	params := project.BlueprintParams{
+		Name:          req.Name,
+		Description:   req.Description,
+		PinnedContext: req.PinnedContext,
+		AllowedTools:  req.AllowedTools,
+		Prompts:       req.Prompts,
+		Agent:         req.Agent,
+	}
+	if req.ModelConfig != nil {
+		params.Model = &project.BlueprintModel{
+			Provider:        req.ModelConfig.Provider,
+			Model:           req.ModelConfig.Model,
+			ReasoningEffort: req.ModelConfig.ReasoningEffort,
+			MaxTokens:       req.ModelConfig.MaxTokens,
+		}
+	}
+	return params
+}
+
+// blueprintToResponse converts a session blueprint to its API response
+func blueprintToResponse(blueprint project.Blueprint) BlueprintResponse {
+	resp := BlueprintResponse{
+		ID:            blueprint.ID,
+		ProjectID:     blueprint.ProjectID,
+		Name:          blueprint.Name,
+		Description:   blueprint.Description,
+		PinnedContext: blueprint.PinnedContext,
+		AllowedTools:  blueprint.AllowedTools,
+		Prompts:       blueprint.Prompts,
+		Agent:         blueprint.Agent,
+		CreatedAt:     blueprint.CreatedAt,
+		UpdatedAt:     blueprint.UpdatedAt,
+	}
+	if blueprint.Model != nil {
+		resp.ModelConfig = &BlueprintModelConfig{
+			Provider:        blueprint.Model.Provider,
+			Model:           blueprint.Model.Model,
+			ReasoningEffort: blueprint.Model.ReasoningEffort,
+			MaxTokens:       blueprint.Model.MaxTokens,
+		}
+	}
+	return resp
+}
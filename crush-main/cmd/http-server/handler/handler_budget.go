@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/budget"
+)
+
+// handleGetSessionBudget returns the session, project and user budgets of a
+// session with their usage
+func (s *Server) handleGetSessionBudget(c *gin.Context) {
+	sessionID := c.Param("id")
+	statuses, err := s.budgetService.Check(c.Request.Context(), sessionID)
+	if errors.Is(err, budget.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to check session budgets", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to check budgets"})
+		return
+	}
+
+	resp := SessionBudgetResponse{SessionID: sessionID, Budgets: statuses}
+	for _, st := range statuses {
+		resp.Exceeded = resp.Exceeded || st.Exceeded()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleSetSessionBudget sets the limits of a session
+func (s *Server) handleSetSessionBudget(c *gin.Context) {
+	if _, err := s.sessionService.Get(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+	s.setBudget(c, budget.ScopeSession, c.Param("id"))
+}
+
+// handleDeleteSessionBudget puts a session back on the default limits
+func (s *Server) handleDeleteSessionBudget(c *gin.Context) {
+	s.deleteBudget(c, budget.ScopeSession, c.Param("id"))
+}
+
+// handleGetProjectBudget returns the limits of a project
+func (s *Server) handleGetProjectBudget(c *gin.Context) {
+	s.getBudget(c, budget.ScopeProject, c.Param("id"))
+}
+
+// handleSetProjectBudget sets the limits of a project
+func (s *Server) handleSetProjectBudget(c *gin.Context) {
+	if _, err := s.projectService.GetByID(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+	s.setBudget(c, budget.ScopeProject, c.Param("id"))
+}
+
+// handleDeleteProjectBudget puts a project back on the default limits
+func (s *Server) handleDeleteProjectBudget(c *gin.Context) {
+	s.deleteBudget(c, budget.ScopeProject, c.Param("id"))
+}
+
+// handleGetAccountBudget returns the limits of the current user
+func (s *Server) handleGetAccountBudget(c *gin.Context) {
+	s.getBudget(c, budget.ScopeUser, c.GetString("user_id"))
+}
+
+// handleSetAccountBudget sets the limits of the current user
+func (s *Server) handleSetAccountBudget(c *gin.Context) {
+	s.setBudget(c, budget.ScopeUser, c.GetString("user_id"))
+}
+
+// handleDeleteAccountBudget puts the current user back on the default limits
+func (s *Server) handleDeleteAccountBudget(c *gin.Context) {
+	s.deleteBudget(c, budget.ScopeUser, c.GetString("user_id"))
+}
+
+func (s *Server) getBudget(c *gin.Context, scope budget.Scope, scopeID string) {
+	b, err := s.budgetService.Get(c.Request.Context(), scope, scopeID)
+	if err != nil {
+		slog.Error("Failed to get budget", "scope", scope, "scope_id", scopeID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get budget"})
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+func (s *Server) setBudget(c *gin.Context, scope budget.Scope, scopeID string) {
+	var req BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	b, err := s.budgetService.Set(c.Request.Context(), scope, scopeID, budget.Limit{MaxCost: req.MaxCost, MaxTokens: req.MaxTokens})
+	if errors.Is(err, budget.ErrInvalidLimit) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to set budget", "scope", scope, "scope_id", scopeID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to set budget"})
+		return
+	}
+	slog.Info("Budget updated", "scope", scope, "scope_id", scopeID, "max_cost", b.MaxCost, "max_tokens", b.MaxTokens)
+	c.JSON(http.StatusOK, b)
+}
+
+// deleteBudget removes the limits of a scope and returns the default ones
+func (s *Server) deleteBudget(c *gin.Context, scope budget.Scope, scopeID string) {
+	if err := s.budgetService.Delete(c.Request.Context(), scope, scopeID); err != nil {
+		slog.Error("Failed to delete budget", "scope", scope, "scope_id", scopeID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete budget"})
+		return
+	}
+	slog.Info("Budget removed", "scope", scope, "scope_id", scopeID)
+	s.getBudget(c, scope, scopeID)
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/account"
+)
+
+// handleCreateBulkSessionJob starts archiving, deleting or tagging sessions
+// of the current user, the job progress is polled with handleGetBulkSessionJob
+func (s *Server) handleCreateBulkSessionJob(c *gin.Context) {
+	var req BulkSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	bulk := account.BulkSessionRequest{
+		Action:     req.Action,
+		SessionIDs: req.SessionIDs,
+		Tags:       req.Tags,
+	}
+	if f := req.Filter; f != nil {
+		bulk.Filter = &account.SessionFilter{
+			ProjectID:     f.ProjectID,
+			Archived:      f.Archived,
+			Tag:           f.Tag,
+			Query:         f.Query,
+			CreatedAfter:  f.CreatedAfter,
+			CreatedBefore: f.CreatedBefore,
+		}
+	}
+
+	userID := c.GetString("user_id")
+	job, err := s.accountService.StartBulkSessions(c.Request.Context(), userID, bulk)
+	switch {
+	case errors.Is(err, account.ErrInvalidBulkRequest), errors.Is(err, account.ErrTooManySessions):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	slog.Info("Bulk session job requested", "user_id", userID, "job_id", job.ID, "action", job.Action, "sessions", job.Total)
+	c.JSON(http.StatusAccepted, bulkJobToResponse(job))
+}
+
+// handleListBulkSessionJobs lists the bulk session jobs of the current user
+func (s *Server) handleListBulkSessionJobs(c *gin.Context) {
+	jobs, err := s.accountService.ListBulkSessions(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	response := make([]BulkSessionJobResponse, len(jobs))
+	for i, job := range jobs {
+		response[i] = bulkJobToResponse(job)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleGetBulkSessionJob returns a bulk session job of the current user with
+// its progress
+func (s *Server) handleGetBulkSessionJob(c *gin.Context) {
+	job, err := s.accountService.GetBulkSessions(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if errors.Is(err, account.ErrBulkJobNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, bulkJobToResponse(job))
+}
+
+// bulkJobToResponse converts a bulk session job to its API response
+func bulkJobToResponse(job account.BulkSessionJob) BulkSessionJobResponse {
+	return BulkSessionJobResponse{
+		ID:          job.ID,
+		Action:      job.Action,
+		Status:      job.Status,
+		Total:       job.Total,
+		Processed:   job.Processed,
+		Failed:      job.Failed,
+		Failures:    job.Failures,
+		Error:       job.Error,
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+	}
+}
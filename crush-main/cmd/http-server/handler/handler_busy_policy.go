@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"cmp"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/tidwall/sjson"
+)
+
+// handleGetSessionBusyPolicy returns what a prompt sent while a session is
+// busy does
+func (s *Server) handleGetSessionBusyPolicy(c *gin.Context) {
+	sessionID := c.Param("id")
+	policy, _, ok := s.loadSessionBusyPolicy(c, sessionID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, BusyPolicyResponse{SessionID: sessionID, Policy: string(cmp.Or(policy, config.BusyPolicyQueue))})
+}
+
+// handleSetSessionBusyPolicy sets whether a prompt sent while a session is
+// busy is queued, rejected or interrupts the running one
+func (s *Server) handleSetSessionBusyPolicy(c *gin.Context) {
+	sessionID := c.Param("id")
+	var req BusyPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	_, configJSON, ok := s.loadSessionBusyPolicy(c, sessionID)
+	if !ok {
+		return
+	}
+
+	// Only the busy policy key is replaced, the model selection is kept
+	configJSON, err := sjson.Set(configJSON, "options.busy_policy", req.Policy)
+	if err == nil {
+		err = s.db.SaveConfigJSON(c.Request.Context(), sessionID, configJSON)
+	}
+	if err != nil {
+		slog.Error("Failed to save busy policy", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save busy policy"})
+		return
+	}
+	c.JSON(http.StatusOK, BusyPolicyResponse{SessionID: sessionID, Policy: req.Policy})
+}
+
+// loadSessionBusyPolicy reads the busy policy from the session config and
+// returns it with the config, writing the error response when it fails
+func (s *Server) loadSessionBusyPolicy(c *gin.Context, sessionID string) (config.BusyPolicy, string, bool) {
+	ctx := c.Request.Context()
+	if _, err := s.sessionService.Get(ctx, sessionID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return "", "", false
+	}
+	configJSON, err := s.db.GetSessionConfigJSON(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to read session config", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read session config"})
+		return "", "", false
+	}
+	if configJSON == "" {
+		configJSON = "{}"
+	}
+	var sessionConfig struct {
+		Options struct {
+			BusyPolicy config.BusyPolicy `json:"busy_policy"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal([]byte(configJSON), &sessionConfig); err != nil {
+		slog.Warn("Ignoring invalid session config", "session_id", sessionID, "error", err)
+	}
+	return sessionConfig.Options.BusyPolicy, configJSON, true
+}
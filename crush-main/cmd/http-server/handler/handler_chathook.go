@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/infra/chat"
+)
+
+// handleListChatHooks returns the Slack and Discord hooks of a project
+func (s *Server) handleListChatHooks(c *gin.Context) {
+	hooks, err := s.projectService.ListChatHooks(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	resp := make([]ChatHookResponse, len(hooks))
+	for i, hook := range hooks {
+		resp[i] = chatHookToResponse(hook)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleCreateChatHook adds a Slack or Discord hook to a project
+func (s *Server) handleCreateChatHook(c *gin.Context) {
+	projectID := c.Param("id")
+	var req ChatHookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	hook, err := s.projectService.CreateChatHook(ctx, projectID, req.params())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	slog.Info("Chat hook created", "project_id", projectID, "hook_id", hook.ID, "platform", hook.Platform)
+	c.JSON(http.StatusCreated, chatHookToResponse(hook))
+}
+
+// handleUpdateChatHook replaces the configuration of a chat hook
+func (s *Server) handleUpdateChatHook(c *gin.Context) {
+	var req ChatHookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	hook, err := s.projectService.UpdateChatHook(c.Request.Context(), c.Param("id"), c.Param("hookId"), req.params())
+	if errors.Is(err, project.ErrChatHookNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, chatHookToResponse(hook))
+}
+
+// handleDeleteChatHook removes a chat hook from a project
+func (s *Server) handleDeleteChatHook(c *gin.Context) {
+	if err := s.projectService.DeleteChatHook(c.Request.Context(), c.Param("id"), c.Param("hookId")); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Chat hook deleted"})
+}
+
+// handleTestChatHook sends a sample turn summary through a chat hook
+func (s *Server) handleTestChatHook(c *gin.Context) {
+	ctx := c.Request.Context()
+	projectID := c.Param("id")
+	hook, err := s.projectService.GetChatHook(ctx, projectID, c.Param("hookId"))
+	if errors.Is(err, project.ErrChatHookNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	summary := project.TurnSummary{
+		Event:        project.ChatHookEventCompleted,
+		ProjectID:    projectID,
+		Title:        "Test notification",
+		FilesChanged: []string{"README.md"},
+		FileCount:    1,
+	}
+	if proj, err := s.projectService.GetByID(ctx, projectID); err == nil {
+		summary.ProjectName = proj.Name
+	}
+	text, err := hook.RenderMessage(summary)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := chat.NewClient().Send(ctx, chat.Platform(hook.Platform), hook.WebhookURL, text); err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Test message sent"})
+}
+
+// params converts the request to chat hook parameters
+func (req ChatHookRequest) params() project.ChatHookParams {
+	return project.ChatHookParams{
+		Platform:   project.ChatPlatform(req.Platform),
+		WebhookURL: req.WebhookURL,
+		Template:   req.Template,
+		Events:     req.Events,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+	}
+}
+
+// chatHookToResponse converts a chat hook to its API response
+func chatHookToResponse(hook project.ChatHook) ChatHookResponse {
+	return ChatHookResponse{
+		ID:         hook.ID,
+		ProjectID:  hook.ProjectID,
+		Platform:   string(hook.Platform),
+		WebhookURL: hook.WebhookURL,
+		Template:   hook.Template,
+		Events:     hook.Events,
+		Enabled:    hook.Enabled,
+		CreatedAt:  hook.CreatedAt,
+		UpdatedAt:  hook.UpdatedAt,
+	}
+}
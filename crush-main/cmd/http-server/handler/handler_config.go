@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// configImportMu serializes config imports so a diff is applied to the
+// configuration it was computed against.
+var configImportMu sync.Mutex
+
+// handleExportConfig returns the effective configuration with secrets redacted
+func (s *Server) handleExportConfig(c *gin.Context) {
+	if s.config == nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Config not available"})
+		return
+	}
+
+	export, err := config.ExportConfig(s.config, config.GetGlobalAppConfig())
+	if err != nil {
+		slog.Error("Failed to export config", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export config"})
+		return
+	}
+	slog.Info("Config exported", "user_id", c.GetString("user_id"))
+	c.JSON(http.StatusOK, export)
+}
+
+// handleImportConfig validates a config bundle and applies it unless dry_run is set
+func (s *Server) handleImportConfig(c *gin.Context) {
+	if s.config == nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Config not available"})
+		return
+	}
+
+	var bundle config.ConfigBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	configImportMu.Lock()
+	defer configImportMu.Unlock()
+
+	prepared, err := s.config.PrepareBundle(bundle)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+		return
+	}
+	appCfg := config.GetGlobalAppConfig()
+	changes, err := s.config.DiffBundle(appCfg, prepared)
+	if err != nil {
+		slog.Error("Failed to diff config bundle", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to diff config bundle"})
+		return
+	}
+	if changes == nil {
+		changes = []config.ConfigChange{}
+	}
+
+	resp := ConfigImportResponse{
+		DryRun:          dryRun,
+		Changes:         changes,
+		RestartRequired: restartRequiredPaths(changes),
+	}
+	if dryRun || len(changes) == 0 {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	s.config.ApplyBundle(prepared)
+	if prepared.Sandbox != nil && prepared.Sandbox.BaseURL != "" && prepared.Sandbox.BaseURL != appCfg.Sandbox.BaseURL {
+		sandbox.SetDefaultClient(prepared.Sandbox.BaseURL)
+	}
+	resp.Applied = true
+	slog.Info("Config bundle imported", "user_id", c.GetString("user_id"), "changes", len(changes))
+	c.JSON(http.StatusOK, resp)
+}
+
+// startupOnlySettings are read once when the agent worker pools start.
+var startupOnlySettings = []string{
+	"agent.max_workers",
+	"agent.task_queue_size",
+	"agent.max_background_workers",
+	"agent.background_queue_size",
+}
+
+// restartRequiredPaths returns the changed settings that need a restart.
+func restartRequiredPaths(changes []config.ConfigChange) []string {
+	var paths []string
+	for _, change := range changes {
+		if slices.Contains(startupOnlySettings, change.Path) {
+			paths = append(paths, change.Path)
+		}
+	}
+	return paths
+}
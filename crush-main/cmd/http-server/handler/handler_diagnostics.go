@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"cmp"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/internal/diagnostics"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/tidwall/sjson"
+)
+
+// handleGetSessionDiagnostics returns the current LSP diagnostics of the files
+// the agent edited in a session
+func (s *Server) handleGetSessionDiagnostics(c *gin.Context) {
+	sessionID := c.Param("id")
+	ctx := c.Request.Context()
+	if _, err := s.sessionService.Get(ctx, sessionID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+
+	files, err := s.db.ListLatestSessionFiles(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to list session files", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list session files"})
+		return
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+
+	summary, err := diagnostics.Summarize(ctx, s.sandboxClient, sessionID, paths)
+	if err != nil {
+		slog.Error("Failed to get sandbox diagnostics", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to get diagnostics from the sandbox"})
+		return
+	}
+	c.JSON(http.StatusOK, SessionDiagnosticsResponse{SessionID: sessionID, Summary: summary})
+}
+
+// handleGetSessionAutoFix returns the auto-fix settings of a session
+func (s *Server) handleGetSessionAutoFix(c *gin.Context) {
+	sessionID := c.Param("id")
+	autoFix, _, ok := s.loadSessionAutoFix(c, sessionID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, autoFixResponse(sessionID, cmp.Or(autoFix, &config.AutoFix{})))
+}
+
+// handleSetSessionAutoFix enables or disables the follow-up prompts fixing
+// the errors introduced by the agent in a session
+func (s *Server) handleSetSessionAutoFix(c *gin.Context) {
+	sessionID := c.Param("id")
+	var req AutoFixRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	_, configJSON, ok := s.loadSessionAutoFix(c, sessionID)
+	if !ok {
+		return
+	}
+
+	// Only the auto-fix key is replaced, the model selection is kept
+	autoFix := config.AutoFix{Enabled: req.Enabled, MaxIterations: req.MaxIterations}
+	configJSON, err := sjson.Set(configJSON, "options.auto_fix", autoFix)
+	if err == nil {
+		err = s.db.SaveConfigJSON(c.Request.Context(), sessionID, configJSON)
+	}
+	if err != nil {
+		slog.Error("Failed to save auto-fix settings", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save auto-fix settings"})
+		return
+	}
+	c.JSON(http.StatusOK, autoFixResponse(sessionID, &autoFix))
+}
+
+func autoFixResponse(sessionID string, autoFix *config.AutoFix) AutoFixResponse {
+	return AutoFixResponse{
+		SessionID:     sessionID,
+		Enabled:       autoFix.Enabled,
+		MaxIterations: cmp.Or(autoFix.MaxIterations, config.DefaultAutoFixIterations),
+	}
+}
+
+// loadSessionAutoFix reads the auto-fix settings from the session config and
+// returns them with the config, writing the error response when it fails
+func (s *Server) loadSessionAutoFix(c *gin.Context, sessionID string) (*config.AutoFix, string, bool) {
+	ctx := c.Request.Context()
+	if _, err := s.sessionService.Get(ctx, sessionID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return nil, "", false
+	}
+	configJSON, err := s.db.GetSessionConfigJSON(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to read session config", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read session config"})
+		return nil, "", false
+	}
+	if configJSON == "" {
+		configJSON = "{}"
+	}
+	var sessionConfig struct {
+		Options struct {
+			AutoFix *config.AutoFix `json:"auto_fix"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal([]byte(configJSON), &sessionConfig); err != nil {
+		slog.Warn("Ignoring invalid session config", "session_id", sessionID, "error", err)
+	}
+	return sessionConfig.Options.AutoFix, configJSON, true
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// handleExportSession renders the conversation of a session as markdown, JSON
+// or HTML for archiving or sharing outside the app.
+// Query: format=markdown|json|html, reasoning=true to include the assistant reasoning.
+func (s *Server) handleExportSession(c *gin.Context) {
+	s.exportSession(c, c.Param("id"))
+}
+
+// exportSession writes the export of a session, see handleExportSession.
+func (s *Server) exportSession(c *gin.Context, sessionID string) {
+	format, err := message.ParseExportFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	includeReasoning, _ := strconv.ParseBool(c.Query("reasoning"))
+
+	ctx := c.Request.Context()
+	sess, err := s.sessionService.Get(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+	msgs, err := s.messageService.List(postgres.WithReplica(ctx), sessionID)
+	if err != nil {
+		slog.Error("Failed to list session messages for export", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list session messages"})
+		return
+	}
+
+	transcript := message.NewTranscript(msgs, includeReasoning)
+	transcript.SessionID = sess.ID
+	transcript.Title = sess.Title
+	transcript.PromptTokens = sess.PromptTokens
+	transcript.CompletionTokens = sess.CompletionTokens
+	transcript.Cost = sess.Cost
+	transcript.CreatedAt = sess.CreatedAt
+	transcript.ExportedAt = time.Now().UnixMilli()
+
+	var buf bytes.Buffer
+	if err := transcript.Render(&buf, format); err != nil {
+		slog.Error("Failed to render session export", "session_id", sessionID, "format", format, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to render export"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="session-`+sess.ID+"."+format.Extension()+`"`)
+	c.Data(http.StatusOK, format.ContentType(), buf.Bytes())
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/feedback"
+)
+
+// handleSubmitMessageFeedback rates an answer of the agent up or down, with a
+// reason and a comment. Rating the message again replaces the rating of the
+// user
+func (s *Server) handleSubmitMessageFeedback(c *gin.Context) {
+	messageID := c.Param("id")
+	var req MessageFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	f, err := s.feedbackService.Submit(c.Request.Context(), feedback.Submission{
+		MessageID: messageID,
+		UserID:    c.GetString("user_id"),
+		Rating:    feedback.Rating(req.Rating),
+		Category:  req.Category,
+		Comment:   req.Comment,
+	})
+	switch {
+	case errors.Is(err, feedback.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, feedback.ErrNotAssistant),
+		errors.Is(err, feedback.ErrInvalidRating),
+		errors.Is(err, feedback.ErrInvalidCategory),
+		errors.Is(err, feedback.ErrInvalidComment):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		slog.Error("Failed to save message feedback", "message_id", messageID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save feedback"})
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
@@ -1,12 +1,51 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
 )
 
 // handleHealth handles health check requests
 func (s *Server) handleHealth(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 }
+
+// handleRedisHealth reports the health of the Redis deployment and of each of
+// its nodes. It answers 503 when Redis is down, a degraded deployment (e.g. a
+// replica or sentinel down) still answers 200.
+func (s *Server) handleRedisHealth(c *gin.Context) {
+	client := storeredis.GetClient()
+	if client == nil {
+		c.JSON(http.StatusOK, RedisHealthResponse{Status: "disabled", Nodes: []RedisNodeHealth{}})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), overviewProbeTimeout)
+	defer cancel()
+	health := client.Health(ctx)
+
+	resp := RedisHealthResponse{
+		Mode:      health.Mode,
+		Status:    health.Status,
+		LatencyMs: health.LatencyMs,
+		Error:     health.Error,
+		Nodes:     make([]RedisNodeHealth, len(health.Nodes)),
+	}
+	for i, node := range health.Nodes {
+		resp.Nodes[i] = RedisNodeHealth{
+			Addr:      node.Addr,
+			Role:      node.Role,
+			Status:    node.Status,
+			LatencyMs: node.LatencyMs,
+			Error:     node.Error,
+			Master:    node.Master,
+		}
+	}
+	status := http.StatusOK
+	if health.Status == storeredis.HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
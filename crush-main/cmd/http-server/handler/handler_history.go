@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/domain/history"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+// handleGetSessionFileHistory lists the files edited in a session with their
+// recorded versions. With path only that file is returned.
+func (s *Server) handleGetSessionFileHistory(c *gin.Context) {
+	grouped, ok := s.sessionFileVersions(c)
+	if !ok {
+		return
+	}
+	if path := c.Query("path"); path != "" {
+		grouped = slices.DeleteFunc(grouped, func(v history.FileVersions) bool { return v.Path != path })
+	}
+
+	response := make([]FileHistoryResponse, len(grouped))
+	for i, v := range grouped {
+		response[i] = FileHistoryResponse{Path: v.Path, Versions: make([]FileVersionResponse, len(v.Versions))}
+		for j, f := range v.Versions {
+			response[i].Versions[j] = FileVersionResponse{
+				ID:        f.ID,
+				Version:   f.Version,
+				Size:      len(f.Content),
+				CreatedAt: f.CreatedAt,
+			}
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleGetSessionFileDiff returns the unified diff between two versions of a
+// file of a session. Query: path, to (default the latest version) and from
+// (default the version before to, an empty file for the first one).
+func (s *Server) handleGetSessionFileDiff(c *gin.Context) {
+	versions, ok := s.sessionFileVersionsOf(c, c.Query("path"))
+	if !ok {
+		return
+	}
+
+	to := versions.Latest()
+	if v := c.Query("to"); v != "" {
+		if to, ok = findFileVersion(c, versions, v); !ok {
+			return
+		}
+	}
+	from, hasFrom := versions.Previous(to)
+	if v := c.Query("from"); v != "" {
+		if from, ok = findFileVersion(c, versions, v); !ok {
+			return
+		}
+		hasFrom = true
+	}
+
+	unified, additions, removals := history.Diff(from, to)
+	response := FileDiffResponse{
+		Path:      versions.Path,
+		From:      -1,
+		To:        to.Version,
+		Diff:      unified,
+		Additions: additions,
+		Removals:  removals,
+	}
+	if hasFrom {
+		response.From = from.Version
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleRevertSessionFile reverts a file of a session to one of its versions.
+// The WS instance running the session asks its clients for permission before
+// writing the file through the sandbox, the outcome is sent to them as a
+// file_revert event.
+func (s *Server) handleRevertSessionFile(c *gin.Context) {
+	var req RevertFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	versions, ok := s.sessionFileVersionsOf(c, req.Path)
+	if !ok {
+		return
+	}
+	if _, ok := versions.Find(*req.Version); !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Version not found"})
+		return
+	}
+
+	redisCmd := storeredis.GetGlobalCommandService()
+	if redisCmd == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Agent service unavailable"})
+		return
+	}
+	revert := storeredis.FileRevertPayload{
+		ID:          uuid.New().String(),
+		SessionID:   c.Param("id"),
+		Path:        req.Path,
+		Version:     *req.Version,
+		RequestedBy: c.GetString("user_id"),
+	}
+	if err := redisCmd.PublishFileRevert(c.Request.Context(), revert); err != nil {
+		slog.Error("Failed to publish file revert", "session_id", revert.SessionID, "path", revert.Path, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revert file"})
+		return
+	}
+	slog.Info("File revert requested", "session_id", revert.SessionID, "path", revert.Path, "version", revert.Version, "revert_id", revert.ID)
+	c.JSON(http.StatusAccepted, RevertFileResponse{
+		ID:      revert.ID,
+		Path:    revert.Path,
+		Version: revert.Version,
+		Status:  "pending",
+	})
+}
+
+// sessionFileVersions returns the files of a session grouped by path,
+// writing the error response when they cannot be listed.
+func (s *Server) sessionFileVersions(c *gin.Context) ([]history.FileVersions, bool) {
+	sessionID := c.Param("id")
+	if _, err := s.sessionService.Get(c.Request.Context(), sessionID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return nil, false
+	}
+	files, err := s.historyService.ListBySession(c.Request.Context(), sessionID)
+	if err != nil {
+		slog.Error("Failed to list session file history", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list file history"})
+		return nil, false
+	}
+	return history.GroupVersions(files), true
+}
+
+// sessionFileVersionsOf returns the versions of a file of a session, writing
+// the error response when it has none.
+func (s *Server) sessionFileVersionsOf(c *gin.Context, path string) (history.FileVersions, bool) {
+	if path == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path is required"})
+		return history.FileVersions{}, false
+	}
+	grouped, ok := s.sessionFileVersions(c)
+	if !ok {
+		return history.FileVersions{}, false
+	}
+	i := slices.IndexFunc(grouped, func(v history.FileVersions) bool { return v.Path == path })
+	if i < 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "File has no history in this session"})
+		return history.FileVersions{}, false
+	}
+	return grouped[i], true
+}
+
+// findFileVersion parses a version number and returns that version of the
+// file, writing the error response when it is invalid or not recorded.
+func findFileVersion(c *gin.Context, versions history.FileVersions, raw string) (history.File, bool) {
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "version must be an integer"})
+		return history.File{}, false
+	}
+	f, ok := versions.Find(n)
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Version " + raw + " not found"})
+		return history.File{}, false
+	}
+	return f, true
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/internal/pkg/log"
+)
+
+// adminLogsDefaultLimit is how many records are returned without a limit.
+const adminLogsDefaultLimit = 200
+
+// handleAdminLogs returns the recent logs of the HTTP service, filtered by
+// level, module, session or request. The WebSocket service serves its own
+// logs at /debug/logs.
+func (s *Server) handleAdminLogs(c *gin.Context) {
+	filter, err := log.ParseFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = adminLogsDefaultLimit
+	}
+
+	entries := log.Recent(filter)
+	if entries == nil {
+		entries = []log.Entry{}
+	}
+	c.JSON(http.StatusOK, AdminLogsResponse{Entries: entries})
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/memory"
+)
+
+// handleListProjectMemory returns the notes of the project memory, most
+// recent first, or those matching q
+func (s *Server) handleListProjectMemory(c *gin.Context) {
+	ctx := c.Request.Context()
+	projectID := c.Param("id")
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	var memories []memory.Memory
+	var err error
+	if q := c.Query("q"); q != "" {
+		memories, err = s.memoryService.Search(ctx, projectID, q, limit)
+	} else {
+		memories, err = s.memoryService.List(ctx, projectID, limit, offset)
+	}
+	if err != nil {
+		slog.Error("Failed to list project memory", "project_id", projectID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list project memory"})
+		return
+	}
+	c.JSON(http.StatusOK, memories)
+}
+
+// handleAddProjectMemory adds a note to the project memory, e.g. a fact the
+// agent should know in every session of the project
+func (s *Server) handleAddProjectMemory(c *gin.Context) {
+	ctx := c.Request.Context()
+	projectID := c.Param("id")
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+	var req ProjectMemoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	m, err := s.memoryService.Append(ctx, projectID, req.Content, "", c.GetString("user_id"))
+	if errors.Is(err, memory.ErrInvalidContent) || errors.Is(err, memory.ErrFull) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to add project memory", "project_id", projectID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to add project memory"})
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+// handleDeleteProjectMemory removes a note from the project memory, e.g. an
+// outdated one
+func (s *Server) handleDeleteProjectMemory(c *gin.Context) {
+	projectID := c.Param("id")
+	err := s.memoryService.Delete(c.Request.Context(), projectID, c.Param("memoryId"))
+	if errors.Is(err, memory.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to delete project memory", "project_id", projectID, "memory_id", c.Param("memoryId"), "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete project memory"})
+		return
+	}
+
+	slog.Info("Project memory deleted", "project_id", projectID, "memory_id", c.Param("memoryId"), "user_id", c.GetString("user_id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Memory deleted"})
+}
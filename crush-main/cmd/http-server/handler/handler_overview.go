@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/infra/storage"
+)
+
+const (
+	// overviewProbeTimeout bounds each health probe of the admin overview.
+	overviewProbeTimeout = 3 * time.Second
+	// overviewTopSessions is how many of the most expensive sessions are listed.
+	overviewTopSessions = 10
+)
+
+// handleAdminOverview returns the instance-wide activity and health an
+// operator needs on one screen: active runs, connected sessions, the health
+// of Postgres, Redis, MinIO and the sandbox, and the turns, errors and cost
+// recorded in the metrics rollups.
+func (s *Server) handleAdminOverview(c *gin.Context) {
+	ctx := c.Request.Context()
+	now := time.Now()
+	resp := AdminOverviewResponse{
+		GeneratedAt: now.UnixMilli(),
+		Health:      s.probeHealth(ctx),
+		TopSessions: []TopSessionUsage{},
+	}
+	fail := func(part string, err error) {
+		slog.Warn("Failed to compute admin overview", "part", part, "error", err)
+		resp.Errors = append(resp.Errors, part+": "+err.Error())
+	}
+
+	if stream := storeredis.GetGlobalStreamService(); stream != nil {
+		if running, err := stream.CountRunningSessions(ctx); err != nil {
+			fail("active_runs", err)
+		} else {
+			resp.ActiveRuns = &running
+		}
+		if connected, err := stream.CountConnectedSessions(ctx); err != nil {
+			fail("connected_sessions", err)
+		} else {
+			resp.ConnectedSessions = &connected
+		}
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour).UnixMilli()
+	if totals, err := s.db.GetMetricsTotals(ctx, today); err != nil {
+		fail("today", err)
+	} else {
+		resp.Today = usageSummary(totals)
+	}
+	lastHour := now.Add(-time.Hour).Truncate(5 * time.Minute).UnixMilli()
+	if totals, err := s.db.GetMetricsTotals(ctx, lastHour); err != nil {
+		fail("last_hour", err)
+	} else {
+		resp.LastHour = usageSummary(totals)
+	}
+	top, err := s.db.ListTopSessionsByCost(ctx, postgres.ListTopSessionsByCostParams{
+		Bucket: today,
+		Limit:  overviewTopSessions,
+	})
+	if err != nil {
+		fail("top_sessions", err)
+	}
+	for _, row := range top {
+		resp.TopSessions = append(resp.TopSessions, TopSessionUsage{
+			SessionID: row.SessionID,
+			Title:     row.Title,
+			ProjectID: row.ProjectID.String,
+			Turns:     row.Turns,
+			Cost:      row.Cost,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// probeHealth checks the dependencies of the deployment concurrently.
+func (s *Server) probeHealth(ctx context.Context) map[string]ComponentHealth {
+	probes := map[string]func(ctx context.Context) error{
+		"postgres": s.db.PingDatabase,
+	}
+	if client := storeredis.GetClient(); client != nil {
+		probes["redis"] = client.Ping
+	}
+	if client := storage.GetMinIOClient(); client != nil {
+		probes["minio"] = client.Ping
+	}
+	if s.sandboxClient != nil {
+		probes["sandbox"] = func(ctx context.Context) error {
+			_, err := s.sandboxClient.ListProjects(ctx)
+			return err
+		}
+	}
+
+	health := map[string]ComponentHealth{
+		"redis":   {Status: "disabled"},
+		"minio":   {Status: "disabled"},
+		"sandbox": {Status: "disabled"},
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, probe := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, overviewProbeTimeout)
+			defer cancel()
+			start := time.Now()
+			err := probe(probeCtx)
+			result := ComponentHealth{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+			}
+			mu.Lock()
+			health[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return health
+}
+
+func usageSummary(totals postgres.GetMetricsTotalsRow) UsageSummary {
+	summary := UsageSummary{
+		Turns:        totals.Turns,
+		Errors:       totals.Errors,
+		Cost:         totals.Cost,
+		FeedbackUp:   totals.FeedbackUp,
+		FeedbackDown: totals.FeedbackDown,
+	}
+	if totals.Turns > 0 {
+		summary.ErrorRate = float64(totals.Errors) / float64(totals.Turns)
+	}
+	return summary
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+// handleCreatePlan runs a prompt of a session in plan mode: the agent gets
+// read-only tools and answers with the changes it would make. The run is
+// non-interactive, poll handleGetPlan with the returned ID for the plan.
+func (s *Server) handleCreatePlan(c *gin.Context) {
+	sessionID := c.Param("id")
+	var req CreatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if _, err := s.sessionService.Get(c.Request.Context(), sessionID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+
+	redisCmd := storeredis.GetGlobalCommandService()
+	redisStream := storeredis.GetGlobalStreamService()
+	if redisCmd == nil || redisStream == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Agent service unavailable"})
+		return
+	}
+
+	run := storeredis.PlanRun{
+		ID:          uuid.New().String(),
+		SessionID:   sessionID,
+		Status:      storeredis.PlanStatusPending,
+		RequestedAt: time.Now().UnixMilli(),
+	}
+	if err := redisStream.SetPlanRun(c.Request.Context(), run); err != nil {
+		slog.Error("Failed to store plan run", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start plan"})
+		return
+	}
+	if err := redisCmd.PublishPlanRun(c.Request.Context(), storeredis.PlanRunPayload{
+		ID:          run.ID,
+		SessionID:   sessionID,
+		Agent:       req.Agent,
+		Prompt:      req.Prompt,
+		RequestedAt: run.RequestedAt,
+	}); err != nil {
+		slog.Error("Failed to publish plan run", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start plan"})
+		return
+	}
+	slog.Info("Plan run requested", "session_id", sessionID, "plan_id", run.ID)
+	c.JSON(http.StatusAccepted, planRunToResponse(run))
+}
+
+// handleGetPlan returns a plan run of a session, with the plan once done.
+func (s *Server) handleGetPlan(c *gin.Context) {
+	redisStream := storeredis.GetGlobalStreamService()
+	if redisStream == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Agent service unavailable"})
+		return
+	}
+	run, err := redisStream.GetPlanRun(c.Request.Context(), c.Param("id"), c.Param("planId"))
+	if err != nil {
+		slog.Error("Failed to get plan run", "session_id", c.Param("id"), "plan_id", c.Param("planId"), "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get plan"})
+		return
+	}
+	if run == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Plan not found"})
+		return
+	}
+	c.JSON(http.StatusOK, planRunToResponse(*run))
+}
+
+func planRunToResponse(run storeredis.PlanRun) PlanRunResponse {
+	return PlanRunResponse{
+		ID:          run.ID,
+		SessionID:   run.SessionID,
+		Status:      run.Status,
+		Plan:        run.Plan,
+		Error:       run.Error,
+		RequestedAt: run.RequestedAt,
+		FinishedAt:  run.FinishedAt,
+	}
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/domain/project"
+)
+
+// handleGetPermissionPolicy returns the permission policy rules of a project
+func (s *Server) handleGetPermissionPolicy(c *gin.Context) {
+	rules, err := s.projectService.GetPermissionPolicy(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, PermissionPolicyResponse{Rules: rules})
+}
+
+// handleSetPermissionPolicy replaces the permission policy rules of a project
+func (s *Server) handleSetPermissionPolicy(c *gin.Context) {
+	projectID := c.Param("id")
+	var req PermissionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	rules, err := s.projectService.SetPermissionPolicy(ctx, projectID, req.Rules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	slog.Info("Permission policy updated", "project_id", projectID, "rules", len(rules))
+	c.JSON(http.StatusOK, PermissionPolicyResponse{Rules: rules})
+}
+
+// handleImportPermissionPolicy converts the permissions of a Claude Code or
+// Cursor settings file to policy rules. With dry_run it only returns the
+// resulting policy, so it can be reviewed before it is applied.
+func (s *Server) handleImportPermissionPolicy(c *gin.Context) {
+	projectID := c.Param("id")
+	var req PermissionPolicyImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	imported, err := permission.ImportPolicy(req.Format, []byte(req.Settings))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	current, err := s.projectService.GetPermissionPolicy(ctx, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	base := current
+	if req.Replace {
+		base = nil
+	}
+	rules, _ := permission.MergePolicyRules(base, imported.Rules)
+	resp := PermissionPolicyImportResponse{
+		Imported: imported.Rules,
+		Added:    policyRulesMissing(rules, current),
+		Removed:  policyRulesMissing(current, rules),
+		Warnings: imported.Warnings,
+		Rules:    rules,
+	}
+
+	if !req.DryRun {
+		if resp.Rules, err = s.projectService.SetPermissionPolicy(ctx, projectID, resp.Rules); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp.Applied = true
+		slog.Info("Permission policy imported",
+			"project_id", projectID,
+			"format", req.Format,
+			"added", len(resp.Added),
+			"removed", len(resp.Removed),
+		)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// policyRulesMissing returns the rules of a that are not in b.
+func policyRulesMissing(a, b []permission.PolicyRule) []permission.PolicyRule {
+	_, missing := permission.MergePolicyRules(b, a)
+	if missing == nil {
+		missing = []permission.PolicyRule{}
+	}
+	return missing
+}
+
+// handleGetShadowPolicy returns the candidate policy trialed in shadow mode
+func (s *Server) handleGetShadowPolicy(c *gin.Context) {
+	shadow, err := s.projectService.GetShadowPolicy(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if shadow == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No shadow policy"})
+		return
+	}
+	c.JSON(http.StatusOK, shadowPolicyToResponse(shadow))
+}
+
+// handleStartShadowPolicy trials candidate policy rules in shadow mode: their
+// decisions are recorded next to the ones of the enforced policy, which keeps
+// deciding, until the trial period ends
+func (s *Server) handleStartShadowPolicy(c *gin.Context) {
+	projectID := c.Param("id")
+	var req ShadowPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	var period time.Duration
+	if req.Duration != "" {
+		var err error
+		if period, err = time.ParseDuration(req.Duration); err != nil || period <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "duration must be a positive duration, e.g. 72h"})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	shadow, err := s.projectService.StartShadowPolicy(ctx, projectID, req.Rules, period)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	slog.Info("Shadow permission policy started", "project_id", projectID, "rules", len(shadow.Rules), "until", shadow.Until)
+	c.JSON(http.StatusOK, shadowPolicyToResponse(&shadow))
+}
+
+// handleStopShadowPolicy ends the shadow policy trial of a project
+func (s *Server) handleStopShadowPolicy(c *gin.Context) {
+	if err := s.projectService.StopShadowPolicy(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Shadow policy stopped"})
+}
+
+// handlePromoteShadowPolicy enforces the rules of the shadow policy and ends the trial
+func (s *Server) handlePromoteShadowPolicy(c *gin.Context) {
+	projectID := c.Param("id")
+	ctx := c.Request.Context()
+	shadow, err := s.projectService.GetShadowPolicy(ctx, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if shadow == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No shadow policy"})
+		return
+	}
+
+	rules, err := s.projectService.SetPermissionPolicy(ctx, projectID, shadow.Rules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := s.projectService.StopShadowPolicy(ctx, projectID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	slog.Info("Shadow permission policy promoted", "project_id", projectID, "rules", len(rules))
+	c.JSON(http.StatusOK, PermissionPolicyResponse{Rules: rules})
+}
+
+// handleGetShadowReport compares the decisions of the enforced and shadow
+// policies since the trial started
+func (s *Server) handleGetShadowReport(c *gin.Context) {
+	report, err := s.projectService.GetShadowReport(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := ShadowReportResponse{
+		Total:      report.Total,
+		Agreed:     report.Agreed,
+		WouldDeny:  report.WouldDeny,
+		WouldAllow: report.WouldAllow,
+		WouldAsk:   report.WouldAsk,
+		Counts:     make([]ShadowDecisionCountResponse, len(report.Counts)),
+		Mismatches: make([]ShadowMismatchResponse, len(report.Mismatches)),
+	}
+	if report.Policy != nil {
+		resp.Policy = shadowPolicyToResponse(report.Policy)
+	}
+	for i, count := range report.Counts {
+		resp.Counts[i] = ShadowDecisionCountResponse{
+			Actual: string(count.Actual),
+			Shadow: string(count.Shadow),
+			Count:  count.Count,
+		}
+	}
+	for i, item := range report.Mismatches {
+		resp.Mismatches[i] = ShadowMismatchResponse{
+			SessionID:  item.SessionID,
+			ToolName:   item.ToolName,
+			Subject:    item.Subject,
+			Actual:     string(item.Actual),
+			Shadow:     string(item.Shadow),
+			ActualRule: item.ActualRule,
+			ShadowRule: item.ShadowRule,
+			CreatedAt:  item.CreatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// shadowPolicyToResponse converts a shadow policy to its API response
+func shadowPolicyToResponse(shadow *project.ShadowPolicy) *ShadowPolicyResponse {
+	return &ShadowPolicyResponse{
+		Rules:     shadow.Rules,
+		StartedAt: shadow.StartedAt,
+		Until:     shadow.Until,
+		Active:    shadow.Active(time.Now()),
+	}
+}
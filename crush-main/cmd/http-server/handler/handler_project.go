@@ -1,15 +1,20 @@
 package handler
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
 	"net/http"
+	"slices"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/domain/session"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
 	"github.com/rolling1314/rolling-crush/infra/sandbox"
 	"github.com/rolling1314/rolling-crush/pkg/config"
 )
@@ -38,14 +43,52 @@ func (s *Server) handleCreateProject(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if req.SystemPrompt != nil && len(*req.SystemPrompt) > project.MaxSystemPrompt {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: project.ErrSystemPromptTooLong.Error()})
+		return
+	}
+	if req.PermissionTimeout != nil && (*req.PermissionTimeout < 0 || *req.PermissionTimeout > project.MaxPermissionTimeout) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: project.ErrInvalidPermissionTimeout.Error()})
+		return
+	}
+	if req.RetentionDays != nil && (*req.RetentionDays < -1 || *req.RetentionDays > project.MaxRetentionDays) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: project.ErrInvalidRetentionDays.Error()})
+		return
+	}
+	if l := req.Limits; l != nil && (l.CPUs < 0 || l.MemoryMB < 0 || l.DiskMB < 0) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: project.ErrInvalidResourceLimits.Error()})
+		return
+	}
+
+	// The template fills the stack the request leaves out and scaffolds the workspace
+	var template *project.Template
+	var scaffold *sandbox.Scaffold
+	if req.TemplateID != "" {
+		t, err := s.projectService.GetTemplate(c.Request.Context(), req.TemplateID)
+		if errors.Is(err, project.ErrTemplateNotFound) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		template = &t
+		scaffold = applyTemplate(&req, t)
+	}
+
+	appCfg := config.GetGlobalAppConfig()
+	limits := newProjectLimits(req.Limits, appCfg.Sandbox)
 
-	slog.Info("Creating project", "name", req.Name, "backend_language", req.BackendLanguage, "need_database", req.NeedDatabase)
+	slog.Info("Creating project", "name", req.Name, "backend_language", req.BackendLanguage, "need_database", req.NeedDatabase, "limits", limits, "template_id", req.TemplateID)
 
 	// Call sandbox service to create container
 	sandboxResp, err := s.sandboxClient.CreateProject(c.Request.Context(), sandbox.CreateProjectRequest{
 		ProjectName:     req.Name,
 		BackendLanguage: stringPtrToValue(req.BackendLanguage),
 		NeedDatabase:    req.NeedDatabase,
+		Limits:          sandboxLimits(limits),
+		Scaffold:        scaffold,
 	})
 	if err != nil {
 		slog.Error("Failed to create project container", "error", err)
@@ -61,7 +104,6 @@ func (s *Server) handleCreateProject(c *gin.Context) {
 		"workdir", sandboxResp.Workdir)
 
 	// Set default values - use config's external_ip if not provided in request
-	appCfg := config.GetGlobalAppConfig()
 	externalIP := req.ExternalIP
 	if externalIP == "" {
 		externalIP = appCfg.Sandbox.ExternalIP
@@ -101,25 +143,17 @@ func (s *Server) handleCreateProject(c *gin.Context) {
 	}
 
 	// Add DNS record to Cloudflare
-	fmt.Printf("🔍 Checking Cloudflare: client_nil=%v, api_token_empty=%v, domain=%s\n",
-		s.cloudflareClient == nil,
-		appCfg.Cloudflare.APIToken == "",
-		appCfg.Cloudflare.Domain)
 
 	if s.cloudflareClient != nil && appCfg.Cloudflare.APIToken != "" {
-		fmt.Printf("📤 Calling Cloudflare API: subdomain=%s, ip=%s\n", subdomain, externalIP)
+		slog.DebugContext(c.Request.Context(), "Adding DNS record to Cloudflare", "subdomain", fullSubdomain, "ip", externalIP)
 		err := s.cloudflareClient.AddOrUpdateDNSRecord(c.Request.Context(), subdomain, externalIP)
 		if err != nil {
-			fmt.Printf("❌ Cloudflare DNS failed: %v\n", err)
 			slog.Error("Failed to add DNS record to Cloudflare", "error", err, "subdomain", fullSubdomain, "ip", externalIP)
 		} else {
-			fmt.Printf("✅ Cloudflare DNS added: %s -> %s\n", fullSubdomain, externalIP)
 			slog.Info("DNS record added to Cloudflare successfully", "subdomain", fullSubdomain, "ip", externalIP)
 		}
 	} else {
-		fmt.Printf("⚠️ Skipping Cloudflare: client_nil=%v, api_token_empty=%v\n",
-			s.cloudflareClient == nil, appCfg.Cloudflare.APIToken == "")
-		slog.Warn("Skipping Cloudflare DNS configuration", "subdomain", fullSubdomain)
+		slog.Warn("Skipping Cloudflare DNS configuration", "subdomain", fullSubdomain, "client", s.cloudflareClient != nil, "api_token", appCfg.Cloudflare.APIToken != "")
 	}
 
 	// Create project record
@@ -153,6 +187,19 @@ func (s *Server) handleCreateProject(c *gin.Context) {
 		}
 	}
 	proj.FrontendLanguage = sql.NullString{String: "vite", Valid: true}
+	if template != nil {
+		applyTemplateCommands(&proj, *template)
+	}
+	if req.SystemPrompt != nil {
+		proj.SystemPrompt = *req.SystemPrompt
+	}
+	if req.PermissionTimeout != nil {
+		proj.PermissionTimeout = *req.PermissionTimeout
+	}
+	if req.RetentionDays != nil {
+		proj.RetentionDays = *req.RetentionDays
+	}
+	proj.CPULimit, proj.MemoryLimitMB, proj.DiskLimitMB = limits.CPUs, limits.MemoryMB, limits.DiskMB
 
 	slog.Info("Updating project with container info",
 		"container_id", sandboxResp.ContainerID,
@@ -209,7 +256,9 @@ func (s *Server) handleGetProject(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, projectToResponse(proj))
+	resp := projectToResponse(proj)
+	resp.Usage = s.projectUsage(c.Request.Context(), proj)
+	c.JSON(http.StatusOK, resp)
 }
 
 // handleUpdateProject handles updating a project
@@ -221,6 +270,25 @@ func (s *Server) handleUpdateProject(c *gin.Context) {
 		return
 	}
 
+	// The system prompt, permission timeout and retention are kept when the
+	// request leaves them out, the resource limits are those the container
+	// was created with
+	current, err := s.projectService.GetByID(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+	systemPrompt, permissionTimeout, retentionDays := current.SystemPrompt, current.PermissionTimeout, current.RetentionDays
+	if req.SystemPrompt != nil {
+		systemPrompt = *req.SystemPrompt
+	}
+	if req.PermissionTimeout != nil {
+		permissionTimeout = *req.PermissionTimeout
+	}
+	if req.RetentionDays != nil {
+		retentionDays = *req.RetentionDays
+	}
+
 	proj, err := s.projectService.Update(c.Request.Context(), project.Project{
 		ID:               projectID,
 		Name:             req.Name,
@@ -241,7 +309,17 @@ func (s *Server) handleUpdateProject(c *gin.Context) {
 		BackendCommand:   ptrToNullString(req.BackendCommand),
 		BackendLanguage:  ptrToNullString(req.BackendLanguage),
 		Subdomain:        ptrToNullString(req.Subdomain),
+		SystemPrompt:     systemPrompt,
+		PermissionTimeout: permissionTimeout,
+		RetentionDays: retentionDays,
+		CPULimit: current.CPULimit,
+		MemoryLimitMB: current.MemoryLimitMB,
+		DiskLimitMB: current.DiskLimitMB,
 	})
+	if errors.Is(err, project.ErrSystemPromptTooLong) || errors.Is(err, project.ErrInvalidPermissionTimeout) || errors.Is(err, project.ErrInvalidRetentionDays) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
@@ -279,18 +357,39 @@ func (s *Server) handleDeleteProject(c *gin.Context) {
 		}
 	}
 
+	// Snapshot rows cascade from the project, their archives do not
+	if err := s.snapshotService.DeleteAll(c.Request.Context(), projectID); err != nil {
+		slog.Warn("Failed to delete workspace snapshots", "error", err, "project_id", projectID)
+	}
+
+	if s.secretService != nil {
+		if err := s.secretService.DeleteProject(c.Request.Context(), projectID); err != nil {
+			slog.Warn("Failed to delete project secrets", "error", err, "project_id", projectID)
+		}
+	}
+
+	// Sessions cascade from the project, their Redis keys do not
+	sessions, err := s.sessionService.List(c.Request.Context(), projectID)
+	if err != nil {
+		slog.Warn("Failed to list project sessions", "error", err, "project_id", projectID)
+	}
+
 	// Delete the project from database
 	if err := s.projectService.Delete(c.Request.Context(), projectID); err != nil {
 		slog.Error("Failed to delete project from database", "error", err, "project_id", projectID)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
+	for _, sess := range sessions {
+		purgeSessionKeys(c.Request.Context(), sess.ID)
+	}
 
 	slog.Info("Project deleted successfully", "project_id", projectID)
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-// handleGetProjectSessions handles getting sessions for a project
+// handleGetProjectSessions handles getting sessions for a project, archived
+// sessions are included with ?archived=true
 func (s *Server) handleGetProjectSessions(c *gin.Context) {
 	projectID := c.Param("id")
 	sessions, err := s.sessionService.List(c.Request.Context(), projectID)
@@ -298,6 +397,9 @@ func (s *Server) handleGetProjectSessions(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
+	if c.Query("archived") != "true" {
+		sessions = slices.DeleteFunc(sessions, func(sess session.Session) bool { return sess.ArchivedAt != 0 })
+	}
 
 	response := make([]SessionResponse, len(sessions))
 	for i, sess := range sessions {
@@ -326,6 +428,8 @@ func (s *Server) handleGetProjectSessions(c *gin.Context) {
 			Cost:             sess.Cost,
 			ContextWindow:    contextWindow,
 			Todos:            todos,
+			ArchivedAt:       sess.ArchivedAt,
+			Tags:             sess.Tags,
 			CreatedAt:        sess.CreatedAt,
 			UpdatedAt:        sess.UpdatedAt,
 		}
@@ -356,7 +460,132 @@ func projectToResponse(proj project.Project) ProjectResponse {
 		BackendCommand:   nullStringToPtr(proj.BackendCommand),
 		BackendLanguage:  nullStringToPtr(proj.BackendLanguage),
 		Subdomain:        nullStringToPtr(proj.Subdomain),
+		SystemPrompt:     proj.SystemPrompt,
+		PermissionTimeout: proj.PermissionTimeout,
+		RetentionDays: proj.RetentionDays,
+		Limits: projectLimits(proj),
 		CreatedAt:        proj.CreatedAt,
 		UpdatedAt:        proj.UpdatedAt,
 	}
 }
+
+// handleGetProjectPause returns the maintenance window state of a project
+func (s *Server) handleGetProjectPause(c *gin.Context) {
+	projectID := c.Param("id")
+	pause, err := s.projectService.GetPause(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := pauseToResponse(projectID, pause)
+	response.RunningSessions = s.runningProjectSessions(c.Request.Context(), projectID)
+	c.JSON(http.StatusOK, response)
+}
+
+// handlePauseProject starts a maintenance window: new prompts are rejected or
+// queued, in-flight runs are optionally cancelled and scheduled jobs are skipped
+func (s *Server) handlePauseProject(c *gin.Context) {
+	projectID := c.Param("id")
+	var req ProjectPauseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	pause, err := s.projectService.Pause(ctx, projectID, project.PauseParams{
+		Reason:   req.Reason,
+		Mode:     project.PauseMode(req.Mode),
+		Drain:    req.Drain,
+		PausedBy: c.GetString("user_id"),
+		ResumeAt: req.ResumeAt,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	running := s.runningProjectSessions(ctx, projectID)
+
+	// Notify the WS service so in-flight runs can be drained
+	if redisCmd := storeredis.GetGlobalCommandService(); redisCmd != nil {
+		if err := redisCmd.PublishProjectPause(ctx, storeredis.ProjectPausePayload{
+			ProjectID:  projectID,
+			SessionIDs: running,
+			Reason:     pause.Reason,
+			Drain:      pause.Drain,
+		}); err != nil {
+			slog.Warn("Failed to publish project pause", "project_id", projectID, "error", err)
+		}
+	} else if pause.Drain {
+		slog.Warn("Redis not available, in-flight runs will not be drained", "project_id", projectID)
+	}
+
+	slog.Info("Project paused", "project_id", projectID, "mode", pause.Mode, "drain", pause.Drain, "running_sessions", len(running))
+	response := pauseToResponse(projectID, &pause)
+	response.RunningSessions = running
+	c.JSON(http.StatusOK, response)
+}
+
+// handleResumeProject ends the maintenance window of a project
+func (s *Server) handleResumeProject(c *gin.Context) {
+	projectID := c.Param("id")
+	ctx := c.Request.Context()
+	if err := s.projectService.Resume(ctx, projectID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Notify the WS service so queued prompts are submitted
+	if redisCmd := storeredis.GetGlobalCommandService(); redisCmd != nil {
+		if err := redisCmd.PublishProjectResume(ctx, projectID); err != nil {
+			slog.Warn("Failed to publish project resume", "project_id", projectID, "error", err)
+		}
+	}
+
+	slog.Info("Project resumed", "project_id", projectID)
+	c.JSON(http.StatusOK, pauseToResponse(projectID, nil))
+}
+
+// runningProjectSessions returns the sessions of a project with an agent run in flight
+func (s *Server) runningProjectSessions(ctx context.Context, projectID string) []string {
+	redisStream := storeredis.GetGlobalStreamService()
+	if redisStream == nil {
+		return nil
+	}
+	sessions, err := s.sessionService.List(ctx, projectID)
+	if err != nil {
+		slog.Warn("Failed to list project sessions", "project_id", projectID, "error", err)
+		return nil
+	}
+	var running []string
+	for _, sess := range sessions {
+		if isRunning, err := redisStream.IsSessionRunning(ctx, sess.ID); err == nil && isRunning {
+			running = append(running, sess.ID)
+		}
+	}
+	return running
+}
+
+// pauseToResponse converts a project pause to ProjectPauseResponse
+func pauseToResponse(projectID string, pause *project.Pause) ProjectPauseResponse {
+	if pause == nil {
+		return ProjectPauseResponse{ProjectID: projectID}
+	}
+	return ProjectPauseResponse{
+		ProjectID: projectID,
+		Paused:    true,
+		Reason:    pause.Reason,
+		Mode:      string(pause.Mode),
+		Drain:     pause.Drain,
+		PausedBy:  pause.PausedBy,
+		PausedAt:  pause.PausedAt,
+		ResumeAt:  pause.ResumeAt,
+	}
+}
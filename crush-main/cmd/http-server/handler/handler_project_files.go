@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+)
+
+const (
+	// projectFilesMaxDepth bounds the folders expanded by one listing
+	projectFilesMaxDepth = 5
+	// projectFilesMaxEntries bounds the entries of one listing
+	projectFilesMaxEntries = 2000
+	// projectFileMaxSize is the largest file whose content is served
+	projectFileMaxSize = 1024 * 1024
+)
+
+// handleListProjectFiles lists a directory of the sandbox of a project. Only
+// names and metadata are returned, folders deeper than depth are loaded by
+// listing them in turn. Files ignored by .gitignore are left out.
+func (s *Server) handleListProjectFiles(c *gin.Context) {
+	projectID := c.Param("id")
+	if _, err := s.projectService.GetByID(c.Request.Context(), projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	depth := 1
+	if v := c.Query("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "depth must be a positive integer"})
+			return
+		}
+		depth = min(n, projectFilesMaxDepth)
+	}
+
+	resp, err := s.sandboxClient.ListEntries(c.Request.Context(), sandbox.FileEntriesRequest{
+		ProjectID:   projectID,
+		Path:        c.DefaultQuery("path", "/"),
+		Depth:       depth,
+		MaxEntries:  projectFilesMaxEntries,
+		MaxFileSize: projectFileMaxSize,
+	})
+	if err != nil {
+		slog.Error("Failed to list project files", "project_id", projectID, "path", c.Query("path"), "error", err)
+		sandboxErrorResponse(c, err, "Failed to list files")
+		return
+	}
+
+	entries := resp.Entries
+	if entries == nil {
+		entries = []sandbox.FileEntry{}
+	}
+	c.JSON(http.StatusOK, ProjectFilesResponse{Path: resp.Path, Entries: entries, Truncated: resp.Truncated})
+}
+
+// handleGetProjectFile returns the content of a file of the sandbox of a
+// project with its MIME type. With raw=true the content is served as is, as
+// an attachment the browser does not render, see rawContentType.
+func (s *Server) handleGetProjectFile(c *gin.Context) {
+	projectID := c.Param("id")
+	filePath := c.Query("path")
+	if filePath == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path is required"})
+		return
+	}
+	if _, err := s.projectService.GetByID(c.Request.Context(), projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	resp, err := s.sandboxClient.ReadContent(c.Request.Context(), sandbox.FileContentRequest{
+		ProjectID: projectID,
+		Path:      filePath,
+		MaxSize:   projectFileMaxSize,
+	})
+	if err != nil {
+		slog.Error("Failed to read project file", "project_id", projectID, "path", filePath, "error", err)
+		sandboxErrorResponse(c, err, "Failed to read file")
+		return
+	}
+
+	mimeType := detectMimeType(filePath, resp.Content)
+	if c.Query("raw") == "true" {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(filePath)}))
+		c.Data(http.StatusOK, rawContentType(mimeType), resp.Content)
+		return
+	}
+
+	response := ProjectFileResponse{Path: resp.Path, Size: resp.Size, MimeType: mimeType}
+	if isText(resp.Content) {
+		response.Encoding = "utf-8"
+		response.Content = string(resp.Content)
+	} else {
+		response.Encoding = "base64"
+		response.Content = base64.StdEncoding.EncodeToString(resp.Content)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// detectMimeType returns the MIME type of a file from its extension, or
+// sniffed from its content when the extension is unknown.
+func detectMimeType(filePath string, content []byte) string {
+	if t := mime.TypeByExtension(path.Ext(filePath)); t != "" {
+		return t
+	}
+	t := http.DetectContentType(content)
+	// Source files without a registered extension sniff as plain text
+	if strings.HasPrefix(t, "text/plain") || isText(content) {
+		return "text/plain; charset=utf-8"
+	}
+	return t
+}
+
+// activeMimeTypes are the types a browser runs scripts from when it renders
+// them, the files of a sandbox are written by the agent and its commands.
+var activeMimeTypes = []string{
+	"text/html",
+	"text/xml",
+	"text/javascript",
+	"application/javascript",
+	"application/ecmascript",
+	"application/xhtml+xml",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// rawContentType returns the type a raw file is served with: active types,
+// which would run scripts on the origin of the API, are served as text.
+func rawContentType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil || slices.Contains(activeMimeTypes, mediaType) || strings.HasSuffix(mediaType, "+xml") {
+		return "text/plain; charset=utf-8"
+	}
+	return mimeType
+}
+
+// isText reports whether content is UTF-8 text rather than binary data.
+func isText(content []byte) bool {
+	return utf8.Valid(content) && !bytes.Contains(content, []byte{0})
+}
+
+// sandboxErrorResponse writes the error of a sandbox request, passing on the
+// client errors of the sandbox such as a missing file. Other errors are
+// classified, an unreachable sandbox is answered with 503 Service Unavailable.
+func sandboxErrorResponse(c *gin.Context, err error, message string) {
+	var statusErr *sandbox.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge:
+			var body ErrorResponse
+			if json.Unmarshal([]byte(statusErr.Body), &body) != nil || body.Error == "" {
+				body.Error = message
+			}
+			c.JSON(statusErr.StatusCode, body)
+			return
+		}
+	}
+	info := apierr.Classify(err)
+	status := http.StatusInternalServerError
+	if info.Category == apierr.CategorySandbox {
+		status = info.Code.Status()
+	}
+	c.JSON(status, newErrorResponse(message, info))
+}
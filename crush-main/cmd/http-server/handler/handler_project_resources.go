@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// projectUsageTimeout bounds the live usage read of a project read, a slow
+// sandbox leaves the usage out instead of holding the project
+const projectUsageTimeout = 3 * time.Second
+
+// handleGetProjectResources returns the resource limits and the live usage of
+// the project container
+func (s *Server) handleGetProjectResources(c *gin.Context) {
+	projectID := c.Param("id")
+	proj, err := s.projectService.GetByID(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	resp := ProjectResourcesResponse{ProjectID: proj.ID, Limits: projectLimits(proj)}
+	if proj.ContainerName.Valid && proj.ContainerName.String != "" {
+		usage, err := s.containerUsage(c.Request.Context(), proj.ContainerName.String)
+		if err != nil {
+			slog.Error("Failed to read container usage", "error", err, "project_id", projectID, "container_id", proj.ContainerName.String)
+			c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp.Usage = usage
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// projectUsage returns the live usage of the project container, nil when the
+// project has no container or the sandbox does not answer in time
+func (s *Server) projectUsage(ctx context.Context, proj project.Project) *ResourceUsage {
+	if !proj.ContainerName.Valid || proj.ContainerName.String == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, projectUsageTimeout)
+	defer cancel()
+	usage, err := s.containerUsage(ctx, proj.ContainerName.String)
+	if err != nil {
+		slog.Warn("Failed to read container usage", "error", err, "project_id", proj.ID, "container_id", proj.ContainerName.String)
+		return nil
+	}
+	return usage
+}
+
+func (s *Server) containerUsage(ctx context.Context, containerID string) (*ResourceUsage, error) {
+	if s.sandboxClient == nil {
+		return nil, errors.New("sandbox client not configured")
+	}
+	stats, err := s.sandboxClient.ContainerStats(ctx, sandbox.ContainerStatsRequest{ContainerID: containerID})
+	if err != nil {
+		return nil, err
+	}
+	return &ResourceUsage{
+		CPUPercent:    stats.CPUPercent,
+		MemoryUsageMB: stats.MemoryUsageMB,
+		MemoryLimitMB: stats.MemoryLimitMB,
+		MemoryPercent: usagePercent(stats.MemoryUsageMB, stats.MemoryLimitMB),
+		DiskUsageMB:   stats.DiskUsageMB,
+		DiskLimitMB:   stats.DiskLimitMB,
+		DiskPercent:   usagePercent(stats.DiskUsageMB, stats.DiskLimitMB),
+	}, nil
+}
+
+// usagePercent returns used as a percent of limit with one decimal, 0 for
+// an unlimited resource
+func usagePercent(used, limit int64) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return math.Round(float64(used)*1000/float64(limit)) / 10
+}
+
+// newProjectLimits returns the resources of a new project container, those of
+// the request or else the defaults of the sandbox config
+func newProjectLimits(req *ResourceLimits, cfg config.SandboxConfig) ResourceLimits {
+	if req != nil {
+		return *req
+	}
+	return ResourceLimits{
+		CPUs:     cfg.CPULimit,
+		MemoryMB: int32(cfg.MemoryLimit),
+		DiskMB:   int32(cfg.DiskLimit),
+	}
+}
+
+// sandboxLimits converts limits to the sandbox request, nil when every
+// resource is unlimited
+func sandboxLimits(limits ResourceLimits) *sandbox.ResourceLimits {
+	if limits == (ResourceLimits{}) {
+		return nil
+	}
+	return &sandbox.ResourceLimits{
+		CPUs:     limits.CPUs,
+		MemoryMB: int64(limits.MemoryMB),
+		DiskMB:   int64(limits.DiskMB),
+	}
+}
+
+func projectLimits(proj project.Project) ResourceLimits {
+	return ResourceLimits{
+		CPUs:     proj.CPULimit,
+		MemoryMB: proj.MemoryLimitMB,
+		DiskMB:   proj.DiskLimitMB,
+	}
+}
@@ -1,7 +1,7 @@
 package handler
 
 import (
-	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
@@ -97,13 +97,12 @@ func (s *Server) handleTestProviderConnection(c *gin.Context) {
 		return
 	}
 
-	// 打印请求参数（API Key 只显示后4位）
+	// 记录请求参数（API Key 只显示后4位）
 	maskedKey := req.APIKey
 	if len(maskedKey) > 4 {
 		maskedKey = "****" + maskedKey[len(maskedKey)-4:]
 	}
-	fmt.Printf("[TestProviderConnection] provider=%s, model=%s, api_key=%s, base_url=%s\n",
-		req.Provider, req.Model, maskedKey, req.BaseURL)
+	slog.InfoContext(c.Request.Context(), "Testing provider connection", "provider", req.Provider, "model", req.Model, "api_key", maskedKey, "base_url", req.BaseURL)
 
 	if s.config == nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Config not available"})
@@ -165,13 +164,12 @@ func (s *Server) handleConfigureProvider(c *gin.Context) {
 		return
 	}
 
-	// 打印请求参数（API Key 只显示后4位）
+	// 记录请求参数（API Key 只显示后4位）
 	maskedKey := req.APIKey
 	if len(maskedKey) > 4 {
 		maskedKey = "****" + maskedKey[len(maskedKey)-4:]
 	}
-	fmt.Printf("[ConfigureProvider] provider=%s, model=%s, api_key=%s, base_url=%s\n",
-		req.Provider, req.Model, maskedKey, req.BaseURL)
+	slog.InfoContext(c.Request.Context(), "Configuring provider", "provider", req.Provider, "model", req.Model, "api_key", maskedKey, "base_url", req.BaseURL)
 
 	if s.config == nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Config not available"})
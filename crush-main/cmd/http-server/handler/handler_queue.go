@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+// handleGetSessionQueue lists the prompts queued behind the running turn of a session
+func (s *Server) handleGetSessionQueue(c *gin.Context) {
+	sessionID := c.Param("id")
+	redisStream := storeredis.GetGlobalStreamService()
+	if redisStream == nil {
+		c.JSON(http.StatusOK, SessionQueueResponse{SessionID: sessionID, Prompts: []storeredis.QueuedPrompt{}})
+		return
+	}
+
+	prompts, err := redisStream.GetSessionQueue(c.Request.Context(), sessionID)
+	if err != nil {
+		slog.Error("Failed to get session queue", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get session queue"})
+		return
+	}
+	c.JSON(http.StatusOK, SessionQueueResponse{SessionID: sessionID, Prompts: prompts, Count: len(prompts)})
+}
+
+// handleDeleteQueuedPrompt drops a queued prompt before it runs. The change is
+// applied by the WS instance running the session and announced with a
+// queue_updated event.
+func (s *Server) handleDeleteQueuedPrompt(c *gin.Context) {
+	sessionID := c.Param("id")
+	promptID := c.Param("promptId")
+	prompts, ok := s.sessionQueue(c, sessionID)
+	if !ok {
+		return
+	}
+	if !slices.ContainsFunc(prompts, func(p storeredis.QueuedPrompt) bool { return p.ID == promptID }) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Queued prompt not found"})
+		return
+	}
+
+	s.publishQueueCommand(c, storeredis.CmdQueueRemove, storeredis.QueueCommandPayload{SessionID: sessionID, PromptID: promptID})
+}
+
+// handleReorderSessionQueue changes the order of the queued prompts of a session
+func (s *Server) handleReorderSessionQueue(c *gin.Context) {
+	sessionID := c.Param("id")
+	var req ReorderQueueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	prompts, ok := s.sessionQueue(c, sessionID)
+	if !ok {
+		return
+	}
+	for _, id := range req.PromptIDs {
+		if !slices.ContainsFunc(prompts, func(p storeredis.QueuedPrompt) bool { return p.ID == id }) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Queued prompt not found: " + id})
+			return
+		}
+	}
+
+	s.publishQueueCommand(c, storeredis.CmdQueueReorder, storeredis.QueueCommandPayload{SessionID: sessionID, PromptIDs: req.PromptIDs})
+}
+
+// sessionQueue returns the queued prompts of a session, writing the error
+// response when the queue cannot be read.
+func (s *Server) sessionQueue(c *gin.Context, sessionID string) ([]storeredis.QueuedPrompt, bool) {
+	redisStream := storeredis.GetGlobalStreamService()
+	if redisStream == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Prompt queues require Redis"})
+		return nil, false
+	}
+	prompts, err := redisStream.GetSessionQueue(c.Request.Context(), sessionID)
+	if err != nil {
+		slog.Error("Failed to get session queue", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get session queue"})
+		return nil, false
+	}
+	return prompts, true
+}
+
+func (s *Server) publishQueueCommand(c *gin.Context, cmdType storeredis.CommandType, payload storeredis.QueueCommandPayload) {
+	redisCmd := storeredis.GetGlobalCommandService()
+	if redisCmd == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Prompt queues require Redis"})
+		return
+	}
+	if err := redisCmd.PublishQueueCommand(c.Request.Context(), cmdType, payload); err != nil {
+		slog.Error("Failed to publish queue command", "type", cmdType, "session_id", payload.SessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update session queue"})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+// handleListRedisOrphans scans the Redis keys named after a session and
+// reports those whose session no longer exists
+func (s *Server) handleListRedisOrphans(c *gin.Context) {
+	redisStream := storeredis.GetGlobalStreamService()
+	if redisStream == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Redis is not configured"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	counts, err := redisStream.CountKeysBySession(ctx)
+	if err != nil {
+		slog.Error("Failed to scan Redis session keys", "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to scan Redis keys"})
+		return
+	}
+
+	resp := RedisOrphansResponse{Sessions: len(counts), Orphans: []RedisOrphan{}}
+	for sessionID, keys := range counts {
+		_, err := s.db.GetSessionByID(ctx, sessionID)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("Failed to look up session", "session_id", sessionID, "error", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to look up sessions"})
+			return
+		}
+		resp.Orphans = append(resp.Orphans, RedisOrphan{SessionID: sessionID, Keys: keys})
+		resp.OrphanedKeys += keys
+	}
+	slices.SortFunc(resp.Orphans, func(a, b RedisOrphan) int { return b.Keys - a.Keys })
+	c.JSON(http.StatusOK, resp)
+}
+
+// purgeSessionKeys deletes the Redis keys of a deleted session instead of
+// leaving them to their TTLs
+func purgeSessionKeys(ctx context.Context, sessionID string) {
+	redisStream := storeredis.GetGlobalStreamService()
+	if redisStream == nil {
+		return
+	}
+	if _, err := redisStream.PurgeSessionKeys(ctx, sessionID); err != nil {
+		slog.Warn("Failed to purge session Redis keys", "session_id", sessionID, "error", err)
+	}
+}
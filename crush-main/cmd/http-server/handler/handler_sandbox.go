@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/project"
+)
+
+// handleListSandboxOrphans returns the sandbox containers without project and
+// the projects whose container vanished, as flagged by the last reconciliation.
+// With refresh=true the containers are reconciled first.
+func (s *Server) handleListSandboxOrphans(c *gin.Context) {
+	if c.Query("refresh") == "true" {
+		if _, err := s.reconciler.Reconcile(c.Request.Context()); err != nil {
+			slog.Error("Failed to reconcile sandbox containers", "error", err)
+			c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, s.reconciler.Report())
+}
+
+// handleCleanSandboxOrphans deletes sandbox containers flagged as orphans
+func (s *Server) handleCleanSandboxOrphans(c *gin.Context) {
+	var req CleanSandboxOrphansRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	cleaned, err := s.reconciler.Clean(c.Request.Context(), req.ContainerIDs)
+	if errors.Is(err, project.ErrNotOrphan) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	resp := CleanSandboxOrphansResponse{Cleaned: cleaned}
+	if err != nil {
+		slog.Error("Failed to clean orphaned sandbox containers", "error", err)
+		resp.Error = err.Error()
+	}
+	slog.Info("Orphaned sandbox containers cleaned", "user_id", c.GetString("user_id"), "cleaned", len(cleaned))
+	c.JSON(http.StatusOK, resp)
+}
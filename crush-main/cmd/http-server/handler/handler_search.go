@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/search"
+)
+
+// handleSearch searches the text, tool calls and tool results of the messages
+// of the user, optionally in a single project. Hits are ranked best first and
+// point at the session, message and part they were found in.
+func (s *Server) handleSearch(c *gin.Context) {
+	query := search.Query{
+		UserID:    c.GetString("user_id"),
+		Text:      c.Query("q"),
+		ProjectID: c.Query("project_id"),
+	}
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil || query.Offset < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "offset must be a non-negative integer"})
+			return
+		}
+	}
+
+	hits, err := s.searchService.Search(c.Request.Context(), query)
+	if errors.Is(err, search.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "q is required and at most 256 characters"})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to search messages", "user_id", query.UserID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to search messages"})
+		return
+	}
+	c.JSON(http.StatusOK, hits)
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/secret"
+)
+
+// handleListSecrets returns the global secrets, without their values
+func (s *Server) handleListSecrets(c *gin.Context) {
+	s.listSecrets(c, "")
+}
+
+// handleSetSecret stores a global secret, e.g. the API key of a provider
+// referenced as secret://NAME in the config
+func (s *Server) handleSetSecret(c *gin.Context) {
+	s.setSecret(c, "")
+}
+
+// handleDeleteSecret removes a global secret
+func (s *Server) handleDeleteSecret(c *gin.Context) {
+	s.deleteSecret(c, "")
+}
+
+// handleListProjectSecrets returns the secrets of a project, without their
+// values
+func (s *Server) handleListProjectSecrets(c *gin.Context) {
+	if _, err := s.projectService.GetByID(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+	s.listSecrets(c, c.Param("id"))
+}
+
+// handleSetProjectSecret stores a secret of a project, set as an environment
+// variable of the commands run in its sandbox
+func (s *Server) handleSetProjectSecret(c *gin.Context) {
+	if _, err := s.projectService.GetByID(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+	s.setSecret(c, c.Param("id"))
+}
+
+// handleDeleteProjectSecret removes a secret of a project
+func (s *Server) handleDeleteProjectSecret(c *gin.Context) {
+	s.deleteSecret(c, c.Param("id"))
+}
+
+func (s *Server) listSecrets(c *gin.Context, projectID string) {
+	if !s.secretsEnabled(c) {
+		return
+	}
+	secrets, err := s.secretService.List(c.Request.Context(), projectID)
+	if err != nil {
+		slog.Error("Failed to list secrets", "project_id", projectID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list secrets"})
+		return
+	}
+	c.JSON(http.StatusOK, secrets)
+}
+
+func (s *Server) setSecret(c *gin.Context, projectID string) {
+	if !s.secretsEnabled(c) {
+		return
+	}
+	var req SecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	stored, err := s.secretService.Set(c.Request.Context(), projectID, c.Param("name"), req.Value, c.GetString("user_id"))
+	if errors.Is(err, secret.ErrInvalidName) || errors.Is(err, secret.ErrInvalidValue) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to store secret", "project_id", projectID, "name", c.Param("name"), "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to store secret"})
+		return
+	}
+
+	slog.Info("Secret stored", "project_id", projectID, "name", stored.Name, "user_id", c.GetString("user_id"))
+	c.JSON(http.StatusOK, stored)
+}
+
+func (s *Server) deleteSecret(c *gin.Context, projectID string) {
+	if !s.secretsEnabled(c) {
+		return
+	}
+	err := s.secretService.Delete(c.Request.Context(), projectID, c.Param("name"))
+	if errors.Is(err, secret.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to delete secret", "project_id", projectID, "name", c.Param("name"), "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete secret"})
+		return
+	}
+
+	slog.Info("Secret deleted", "project_id", projectID, "name", c.Param("name"), "user_id", c.GetString("user_id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Secret deleted"})
+}
+
+// secretsEnabled answers 503 when no master key is configured
+func (s *Server) secretsEnabled(c *gin.Context) bool {
+	if s.secretService == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Secrets store is not configured, set secrets.master_key"})
+		return false
+	}
+	return true
+}
@@ -2,16 +2,26 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
 	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
 	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
 	"github.com/rolling1314/rolling-crush/pkg/config"
 )
 
+const (
+	// messagesDefaultLimit and messagesMaxLimit bound the messages of a page
+	messagesDefaultLimit = 50
+	messagesMaxLimit     = 200
+)
+
 // handleCreateSession handles session creation
 func (s *Server) handleCreateSession(c *gin.Context) {
 	var req CreateSessionRequest
@@ -44,14 +54,7 @@ func (s *Server) handleCreateSession(c *gin.Context) {
 	// If is_auto is explicitly true, OR no model config provided, use auto model from config
 	// This allows the frontend to send is_auto: false with a specific model config
 	if req.IsAuto || modelConfig == nil {
-		appCfg := config.GetGlobalAppConfig()
-		if appCfg.AutoModel.Provider != "" && appCfg.AutoModel.Model != "" {
-			modelConfig = &SessionModelConfig{
-				Provider: appCfg.AutoModel.Provider,
-				Model:    appCfg.AutoModel.Model,
-				APIKey:   appCfg.AutoModel.APIKey,
-				BaseURL:  appCfg.AutoModel.BaseURL,
-			}
+		if modelConfig = autoSessionModelConfig(); modelConfig != nil {
 			slog.Info("Using auto model config", "provider", modelConfig.Provider, "model", modelConfig.Model, "session_id", sess.ID)
 		} else {
 			slog.Warn("Auto model requested but not configured in global config", "session_id", sess.ID)
@@ -61,37 +64,79 @@ func (s *Server) handleCreateSession(c *gin.Context) {
 	}
 
 	// Save model config using TUI's exact logic, writing to database instead of file
-	fmt.Println("=== handleCreateSession: About to save model config ===")
-	fmt.Println("req.ModelConfig:", modelConfig)
+	s.saveSessionModelConfig(sess.ID, modelConfig)
 
-	if modelConfig != nil {
-		fmt.Println("ModelConfig is not nil, proceeding with config save")
-		fmt.Println("Provider:", modelConfig.Provider, "Model:", modelConfig.Model)
+	// Get context window for the newly created session
+	contextWindow := s.getSessionContextWindow(c.Request.Context(), sess.ID)
 
-		// 1. Create a temporary Config instance with DB storage enabled
-		tempConfig := *s.config // Shallow copy of base config
-		tempConfig.EnableDBStorage(sess.ID, s.db)
-		fmt.Println("Enabled DB storage for session:", sess.ID)
+	c.JSON(http.StatusOK, SessionResponse{
+		ID:               sess.ID,
+		ProjectID:        sess.ProjectID,
+		Title:            sess.Title,
+		MessageCount:     sess.MessageCount,
+		PromptTokens:     sess.PromptTokens,
+		CompletionTokens: sess.CompletionTokens,
+		Cost:             sess.Cost,
+		ContextWindow:    contextWindow,
+		CreatedAt:        sess.CreatedAt,
+		UpdatedAt:        sess.UpdatedAt,
+	})
+}
 
-		// 2. Set API Key and Base URL following TUI logic (writes to database automatically)
+// autoSessionModelConfig returns the auto model from the global config, or nil if none is configured
+func autoSessionModelConfig() *SessionModelConfig {
+	appCfg := config.GetGlobalAppConfig()
+	if appCfg.AutoModel.Provider == "" || appCfg.AutoModel.Model == "" {
+		return nil
+	}
+	return &SessionModelConfig{
+		Provider: appCfg.AutoModel.Provider,
+		Model:    appCfg.AutoModel.Model,
+		APIKey:   appCfg.AutoModel.APIKey,
+		BaseURL:  appCfg.AutoModel.BaseURL,
+	}
+}
+
+// saveSessionModelConfig stores the model selection of a new session in the
+// database, deriving the small model the same way the TUI does
+func (s *Server) saveSessionModelConfig(sessionID string, modelConfig *SessionModelConfig) {
+	s.writeSessionModelConfig(s.newSessionConfig(sessionID), sessionID, modelConfig)
+}
+
+// newSessionConfig returns a copy of the base config that writes its changes to
+// the session config in the database. Every write stores all the changes made
+// through the copy, so the settings of a new session go through a single copy.
+func (s *Server) newSessionConfig(sessionID string) *config.Config {
+	tempConfig := *s.config // Shallow copy of base config
+	tempConfig.EnableDBStorage(sessionID, s.db)
+	return &tempConfig
+}
+
+// writeSessionModelConfig stores a model selection through a session config
+// created by newSessionConfig.
+func (s *Server) writeSessionModelConfig(tempConfig *config.Config, sessionID string, modelConfig *SessionModelConfig) {
+	if modelConfig != nil {
+		slog.Debug("Saving session model config", "session_id", sessionID, "provider", modelConfig.Provider, "model", modelConfig.Model)
+
+		// 1. Set API Key and Base URL following TUI logic (writes to database automatically)
 		if modelConfig.APIKey != "" {
 			if err := tempConfig.SetProviderAPIKey(modelConfig.Provider, modelConfig.APIKey); err != nil {
-				slog.Error("Failed to set provider API key", "error", err, "session_id", sess.ID)
+				slog.Error("Failed to set provider API key", "error", err, "session_id", sessionID)
 			} else {
-				slog.Info("Saved API key to database", "provider", modelConfig.Provider, "session_id", sess.ID)
+				slog.Info("Saved API key to database", "provider", modelConfig.Provider, "session_id", sessionID)
 			}
 		}
 
 		// Set custom base_url if provided (important for providers like zhipu)
 		if modelConfig.BaseURL != "" {
 			if err := tempConfig.SetConfigField(fmt.Sprintf("providers.%s.base_url", modelConfig.Provider), modelConfig.BaseURL); err != nil {
-				slog.Error("Failed to set provider base_url", "error", err, "session_id", sess.ID)
+				slog.Error("Failed to set provider base_url", "error", err, "session_id", sessionID)
 			} else {
-				slog.Info("Saved base_url to database", "provider", modelConfig.Provider, "base_url", modelConfig.BaseURL, "session_id", sess.ID)
+				slog.Info("Saved base_url to database", "provider", modelConfig.Provider, "base_url", modelConfig.BaseURL, "session_id", sessionID)
 			}
 		}
 
-		// 3. Update preferred large model following TUI logic (writes to database automatically)
+		// 2. Update preferred large model following TUI logic (writes to database automatically)
 		largeModel := config.SelectedModel{
 			Model:           modelConfig.Model,
 			Provider:        modelConfig.Provider,
@@ -101,32 +146,25 @@ func (s *Server) handleCreateSession(c *gin.Context) {
 			largeModel.MaxTokens = *modelConfig.MaxTokens
 		}
 		if err := tempConfig.UpdatePreferredModel(config.SelectedModelTypeLarge, largeModel); err != nil {
-			slog.Error("Failed to update preferred large model", "error", err, "session_id", sess.ID)
+			slog.Error("Failed to update preferred large model", "error", err, "session_id", sessionID)
 		} else {
-			slog.Info("Saved large model to database", "model", modelConfig.Model, "session_id", sess.ID)
+			slog.Info("Saved large model to database", "model", modelConfig.Model, "session_id", sessionID)
 		}
 
-		// 4. Auto-set small model following TUI logic (writes to database automatically)
+		// 3. Auto-set small model following TUI logic (writes to database automatically)
 		smallModelSet := false
-		knownProviders, err := config.Providers(&tempConfig)
-		fmt.Println("=== Setting small model ===")
-		fmt.Println("config.Providers error:", err)
-
-		if err == nil {
+		knownProviders, err := config.Providers(tempConfig)
+		if err != nil {
+			slog.Warn("Failed to load providers for the small model", "error", err, "session_id", sessionID)
+		} else {
 			var providerInfo *catwalk.Provider
 			for _, p := range knownProviders {
-				fmt.Printf("Checking provider: %s vs %s\n", string(p.ID), modelConfig.Provider)
 				if string(p.ID) == modelConfig.Provider {
 					providerInfo = &p
 					break
 				}
 			}
 
-			fmt.Println("providerInfo found:", providerInfo != nil)
-			if providerInfo != nil {
-				fmt.Println("DefaultSmallModelID:", providerInfo.DefaultSmallModelID)
-			}
-
 			if providerInfo != nil && providerInfo.DefaultSmallModelID != "" {
 				smallModelInfo := tempConfig.GetModel(modelConfig.Provider, providerInfo.DefaultSmallModelID)
 				if smallModelInfo != nil {
@@ -137,9 +175,9 @@ func (s *Server) handleCreateSession(c *gin.Context) {
 						MaxTokens:       smallModelInfo.DefaultMaxTokens,
 					}
 					if err := tempConfig.UpdatePreferredModel(config.SelectedModelTypeSmall, smallModel); err != nil {
-						slog.Error("Failed to update preferred small model", "error", err, "session_id", sess.ID)
+						slog.Error("Failed to update preferred small model", "error", err, "session_id", sessionID)
 					} else {
-						slog.Info("Saved small model to database", "model", smallModelInfo.ID, "session_id", sess.ID)
+						slog.Info("Saved small model to database", "model", smallModelInfo.ID, "session_id", sessionID)
 						smallModelSet = true
 					}
 				}
@@ -148,9 +186,7 @@ func (s *Server) handleCreateSession(c *gin.Context) {
 
 		// If no default small model found, use the same model as large model for small model
 		// This ensures the agent coordinator can run properly
-		fmt.Println("smallModelSet:", smallModelSet)
 		if !smallModelSet {
-			fmt.Println("Setting fallback small model (same as large)")
 			smallModel := config.SelectedModel{
 				Model:           modelConfig.Model,
 				Provider:        modelConfig.Provider,
@@ -159,13 +195,10 @@ func (s *Server) handleCreateSession(c *gin.Context) {
 			if modelConfig.MaxTokens != nil {
 				smallModel.MaxTokens = *modelConfig.MaxTokens
 			}
-			fmt.Printf("Small model to save: %+v\n", smallModel)
 			if err := tempConfig.UpdatePreferredModel(config.SelectedModelTypeSmall, smallModel); err != nil {
-				slog.Error("Failed to set fallback small model", "error", err, "session_id", sess.ID)
-				fmt.Println("Error setting fallback small model:", err)
+				slog.Error("Failed to set fallback small model", "error", err, "session_id", sessionID)
 			} else {
-				slog.Info("Using large model as fallback small model", "model", modelConfig.Model, "session_id", sess.ID)
-				fmt.Println("Fallback small model saved successfully")
+				slog.Info("Using large model as fallback small model", "model", modelConfig.Model, "session_id", sessionID)
 			}
 		}
 
@@ -173,25 +206,13 @@ func (s *Server) handleCreateSession(c *gin.Context) {
 		// because it would create an incomplete model definition that interferes with
 		// the config loading logic. context_window can be retrieved from knownProviders when needed.
 	}
-
-	// Get context window for the newly created session
-	contextWindow := s.getSessionContextWindow(c.Request.Context(), sess.ID)
-
-	c.JSON(http.StatusOK, SessionResponse{
-		ID:               sess.ID,
-		ProjectID:        sess.ProjectID,
-		Title:            sess.Title,
-		MessageCount:     sess.MessageCount,
-		PromptTokens:     sess.PromptTokens,
-		CompletionTokens: sess.CompletionTokens,
-		Cost:             sess.Cost,
-		ContextWindow:    contextWindow,
-		CreatedAt:        sess.CreatedAt,
-		UpdatedAt:        sess.UpdatedAt,
-	})
 }
 
-// handleGetSessionMessages handles getting messages for a session
+// handleGetSessionMessages handles getting messages for a session. With
+// limit, before or after it returns a page of the history, oldest first: the
+// latest messages, the ones preceding the before message ID or the ones
+// following the after message ID. The parts of paged messages are typed so
+// text, reasoning, tool calls and tool results can be told apart.
 func (s *Server) handleGetSessionMessages(c *gin.Context) {
 	sessionID := c.Param("id")
 	if sessionID == "" {
@@ -199,13 +220,76 @@ func (s *Server) handleGetSessionMessages(c *gin.Context) {
 		return
 	}
 
-	messages, err := s.messageService.List(c.Request.Context(), sessionID)
+	// Message history is read from the replica, when one is configured
+	ctx := postgres.WithReplica(c.Request.Context())
+
+	// Without paging parameters the whole history is returned, as before
+	if c.Query("limit") == "" && c.Query("before") == "" && c.Query("after") == "" {
+		messages, err := s.messageService.List(ctx, sessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, messages)
+		return
+	}
+
+	params := message.PageParams{
+		Limit:  messagesDefaultLimit,
+		Before: c.Query("before"),
+		After:  c.Query("after"),
+	}
+	if params.Before != "" && params.After != "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "before and after cannot be combined"})
+		return
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+		params.Limit = min(n, messagesMaxLimit)
+	}
+
+	page, err := s.messageService.ListPage(ctx, sessionID, params)
+	if errors.Is(err, message.ErrCursorNotFound) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	response := SessionMessagesPageResponse{
+		Messages: make([]MessageResponse, 0, len(page.Messages)),
+		HasMore:  page.HasMore,
+	}
+	for _, msg := range page.Messages {
+		parts, err := message.MarshalParts(msg.Parts)
+		if err != nil {
+			slog.Error("Failed to encode message parts", "message_id", msg.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to encode messages"})
+			return
+		}
+		response.Messages = append(response.Messages, MessageResponse{
+			ID:               msg.ID,
+			SessionID:        msg.SessionID,
+			Role:             string(msg.Role),
+			Parts:            parts,
+			Model:            msg.Model,
+			Provider:         msg.Provider,
+			IsSummaryMessage: msg.IsSummaryMessage,
+			CreatedAt:        msg.CreatedAt,
+			UpdatedAt:        msg.UpdatedAt,
+		})
+	}
+	if n := len(response.Messages); n > 0 {
+		response.FirstID = response.Messages[0].ID
+		response.LastID = response.Messages[n-1].ID
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // handleGetSessionConfig returns the model configuration for a session
@@ -418,6 +502,7 @@ func (s *Server) handleDeleteSession(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete session"})
 		return
 	}
+	purgeSessionKeys(ctx, sessionID)
 
 	slog.Info("Session deleted successfully", "session_id", sessionID)
 	c.JSON(http.StatusOK, gin.H{"message": "Session deleted successfully"})
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/tidwall/sjson"
+)
+
+// handleGetSessionEnv returns the environment variables set for the tools of
+// a session
+func (s *Server) handleGetSessionEnv(c *gin.Context) {
+	sessionID := c.Param("id")
+	env, _, ok := s.loadSessionEnv(c, sessionID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, SessionEnvResponse{SessionID: sessionID, Env: env})
+}
+
+// handleSetSessionEnv replaces the environment variables set for the commands
+// and fetched URLs of the tools of a session, from its next turn
+func (s *Server) handleSetSessionEnv(c *gin.Context) {
+	sessionID := c.Param("id")
+	var req SessionEnvRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := config.SessionEnv(req.Env).Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	_, configJSON, ok := s.loadSessionEnv(c, sessionID)
+	if !ok {
+		return
+	}
+
+	// Only the env key is replaced, the other keys are kept
+	var err error
+	if len(req.Env) == 0 {
+		configJSON, err = sjson.Delete(configJSON, "options.env")
+	} else {
+		configJSON, err = sjson.Set(configJSON, "options.env", req.Env)
+	}
+	if err == nil {
+		err = s.db.SaveConfigJSON(c.Request.Context(), sessionID, configJSON)
+	}
+	if err != nil {
+		slog.Error("Failed to save session env", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save session env"})
+		return
+	}
+	slog.Info("Session env updated", "session_id", sessionID, "count", len(req.Env), "user_id", c.GetString("user_id"))
+	if req.Env == nil {
+		req.Env = map[string]string{}
+	}
+	c.JSON(http.StatusOK, SessionEnvResponse{SessionID: sessionID, Env: req.Env})
+}
+
+// loadSessionEnv reads the environment variables from the session config and
+// returns them with the config, writing the error response when it fails
+func (s *Server) loadSessionEnv(c *gin.Context, sessionID string) (config.SessionEnv, string, bool) {
+	ctx := c.Request.Context()
+	if _, err := s.sessionService.Get(ctx, sessionID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return nil, "", false
+	}
+	configJSON, err := s.db.GetSessionConfigJSON(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to read session config", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read session config"})
+		return nil, "", false
+	}
+	if configJSON == "" {
+		configJSON = "{}"
+	}
+	var sessionConfig struct {
+		Options struct {
+			Env config.SessionEnv `json:"env"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal([]byte(configJSON), &sessionConfig); err != nil {
+		slog.Warn("Ignoring invalid session config", "session_id", sessionID, "error", err)
+	}
+	if sessionConfig.Options.Env == nil {
+		sessionConfig.Options.Env = config.SessionEnv{}
+	}
+	return sessionConfig.Options.Env, configJSON, true
+}
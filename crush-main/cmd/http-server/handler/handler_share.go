@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/auth"
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+// sharedStreamBlock is how long a read of the session stream blocks, a
+// keepalive comment is sent when nothing arrived meanwhile.
+const sharedStreamBlock = 15 * time.Second
+
+// sharedHiddenEvents are left out of the live view of a share link: its
+// viewers cannot answer permission requests and do not see their parameters.
+var sharedHiddenEvents = map[string]bool{
+	protocol.TypePermissionRequest:      true,
+	protocol.TypePermissionNotification: true,
+	protocol.TypePermissionBlocking:     true,
+}
+
+// handleShareSession creates a read-only share link of a session: a signed
+// token, valid until it expires, opening the session to anyone without an
+// account. Only the owner of the project of the session can share it.
+func (s *Server) handleShareSession(c *gin.Context) {
+	sessionID := c.Param("id")
+	var req ShareSessionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if req.ExpiresIn < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "expires_in cannot be negative"})
+		return
+	}
+	// The sessions of the projects of other users are reported as missing
+	userID := c.GetString("user_id")
+	sess, err := s.sessionService.Get(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+	proj, err := s.projectService.GetByID(c.Request.Context(), sess.ProjectID)
+	if err != nil || proj.UserID != userID {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+
+	ttl := time.Duration(min(req.ExpiresIn, int64(auth.MaxShareTTL/time.Second))) * time.Second
+	token, claims, err := auth.GenerateShareToken(sessionID, userID, ttl)
+	if err != nil {
+		slog.Error("Failed to create share link", "session_id", sessionID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create share link"})
+		return
+	}
+
+	slog.Info("Session share link created", "session_id", sessionID, "share_id", claims.ID, "user_id", userID, "expires_at", claims.ExpiresAt.Time)
+	c.JSON(http.StatusOK, ShareSessionResponse{
+		Token:     token,
+		Path:      "/api/shared/" + token,
+		ExpiresAt: claims.ExpiresAt.UnixMilli(),
+	})
+}
+
+// handleGetSharedSession describes the session of a share link
+func (s *Server) handleGetSharedSession(c *gin.Context) {
+	claims := sharedClaims(c)
+	ctx := c.Request.Context()
+	sess, err := s.sessionService.Get(ctx, claims.SessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+		return
+	}
+
+	resp := SharedSessionResponse{
+		SessionID:    sess.ID,
+		Title:        sess.Title,
+		MessageCount: sess.MessageCount,
+		CreatedAt:    sess.CreatedAt,
+		UpdatedAt:    sess.UpdatedAt,
+		ExpiresAt:    claims.ExpiresAt.UnixMilli(),
+	}
+	if redisStream := storeredis.GetGlobalStreamService(); redisStream != nil {
+		status, err := redisStream.GetSessionRunningStatus(ctx, claims.SessionID)
+		if err != nil {
+			slog.Warn("Failed to get session running status", "session_id", claims.SessionID, "error", err)
+		}
+		resp.Status = string(status)
+		resp.IsRunning = status == storeredis.SessionStatusRunning
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleExportSharedSession exports the conversation of the session of a
+// share link, as handleExportSession.
+func (s *Server) handleExportSharedSession(c *gin.Context) {
+	s.exportSession(c, sharedClaims(c).SessionID)
+}
+
+// handleSharedSessionEvents streams the events of the session of a share link
+// as server-sent events, until the link expires. Each event carries the ID of
+// its stream entry; a client reconnecting with Last-Event-ID (or the
+// last_event_id query parameter) resumes after it, others start with the next
+// event.
+func (s *Server) handleSharedSessionEvents(c *gin.Context) {
+	claims := sharedClaims(c)
+	redisStream := storeredis.GetGlobalStreamService()
+	if redisStream == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Live view is not available"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	lastID := cmp.Or(c.GetHeader("Last-Event-ID"), c.Query("last_event_id"))
+	if lastID == "" {
+		id, err := redisStream.GetLastStreamID(ctx, claims.SessionID)
+		if err != nil {
+			slog.Error("Failed to read session stream", "session_id", claims.SessionID, "error", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read session events"})
+			return
+		}
+		lastID = id
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	slog.Info("Shared session live view opened", "session_id", claims.SessionID, "share_id", claims.ID)
+	for {
+		if time.Now().After(claims.ExpiresAt.Time) {
+			io.WriteString(c.Writer, "event: expired\ndata: {}\n\n")
+			c.Writer.Flush()
+			return
+		}
+
+		messages, newLastID, err := redisStream.ReadNewMessages(ctx, claims.SessionID, lastID, sharedStreamBlock)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Warn("Failed to read session stream for live view", "session_id", claims.SessionID, "error", err)
+			return
+		}
+		lastID = newLastID
+
+		if len(messages) == 0 {
+			io.WriteString(c.Writer, ": keepalive\n\n")
+		}
+		for _, msg := range messages {
+			if sharedHiddenEvents[msg.Type] {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, msg.Payload)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// sharedClaims returns the claims of the share link of a request, set by
+// shareTokenMiddleware
+func sharedClaims(c *gin.Context) *auth.ShareClaims {
+	return c.MustGet("share_claims").(*auth.ShareClaims)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/snapshot"
+)
+
+// handleCreateWorkspaceSnapshot archives the sandbox workspace of a project
+func (s *Server) handleCreateWorkspaceSnapshot(c *gin.Context) {
+	projectID := c.Param("id")
+	if _, err := s.projectService.GetByID(c.Request.Context(), projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	snap, err := s.snapshotService.Create(c.Request.Context(), projectID, "", snapshot.ReasonManual, c.GetString("user_id"))
+	if err != nil {
+		slog.Error("Failed to snapshot project workspace", "project_id", projectID, "error", err)
+		snapshotErrorResponse(c, err, "Failed to snapshot workspace")
+		return
+	}
+	c.JSON(http.StatusCreated, snapshotToResponse(snap))
+}
+
+// handleListWorkspaceSnapshots lists the workspace snapshots of a project,
+// newest first
+func (s *Server) handleListWorkspaceSnapshots(c *gin.Context) {
+	snapshots, err := s.snapshotService.List(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	response := make([]WorkspaceSnapshotResponse, len(snapshots))
+	for i, snap := range snapshots {
+		response[i] = snapshotToResponse(snap)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleRestoreWorkspaceSnapshot replaces the sandbox workspace of a project
+// with a snapshot. The workspace is snapshotted first so that the restore can
+// be undone by restoring that snapshot.
+func (s *Server) handleRestoreWorkspaceSnapshot(c *gin.Context) {
+	projectID, snapshotID := c.Param("id"), c.Param("snapshotId")
+	ctx := c.Request.Context()
+	restored, err := s.snapshotService.Get(ctx, projectID, snapshotID)
+	if err != nil {
+		snapshotErrorResponse(c, err, "Failed to get snapshot")
+		return
+	}
+
+	previous, err := s.snapshotService.Restore(ctx, projectID, snapshotID, c.GetString("user_id"))
+	if err != nil {
+		slog.Error("Failed to restore workspace snapshot", "project_id", projectID, "snapshot_id", snapshotID, "error", err)
+		snapshotErrorResponse(c, err, "Failed to restore snapshot")
+		return
+	}
+	c.JSON(http.StatusOK, RestoreWorkspaceSnapshotResponse{
+		Restored: snapshotToResponse(restored),
+		Previous: snapshotToResponse(previous),
+	})
+}
+
+// handleDeleteWorkspaceSnapshot deletes a workspace snapshot of a project
+func (s *Server) handleDeleteWorkspaceSnapshot(c *gin.Context) {
+	if err := s.snapshotService.Delete(c.Request.Context(), c.Param("id"), c.Param("snapshotId")); err != nil {
+		snapshotErrorResponse(c, err, "Failed to delete snapshot")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// snapshotErrorResponse answers a failed snapshot operation, forwarding the
+// client errors of the sandbox such as a workspace too large to archive
+func snapshotErrorResponse(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, snapshot.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, snapshot.ErrStorageUnavailable):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+	default:
+		sandboxErrorResponse(c, err, message)
+	}
+}
+
+// snapshotToResponse converts a snapshot to its API response
+func snapshotToResponse(snap snapshot.Snapshot) WorkspaceSnapshotResponse {
+	return WorkspaceSnapshotResponse{
+		ID:        snap.ID,
+		ProjectID: snap.ProjectID,
+		SessionID: snap.SessionID,
+		Reason:    snap.Reason,
+		Size:      snap.Size,
+		CreatedBy: snap.CreatedBy,
+		CreatedAt: snap.CreatedAt,
+	}
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+const (
+	// syncDefaultLimit and syncMaxLimit bound the changes of a sync page
+	syncDefaultLimit = 100
+	syncMaxLimit     = 500
+	// syncMaxWait bounds the long poll of the change feed
+	syncMaxWait = 60 * time.Second
+	// syncPollInterval is how often a long poll checks for new changes
+	syncPollInterval = time.Second
+)
+
+// handleGetProjectSyncChanges returns the agent edits of a project after a
+// cursor. With wait it long polls until an edit is made or wait seconds pass,
+// the companion CLI uses it to follow the sandbox from a local checkout.
+func (s *Server) handleGetProjectSyncChanges(c *gin.Context) {
+	projectID := c.Param("id")
+	ctx := c.Request.Context()
+
+	workdir, ok := s.syncWorkdir(c, projectID)
+	if !ok {
+		return
+	}
+	cursor, ok := s.syncCursor(c, projectID)
+	if !ok {
+		return
+	}
+
+	limit := syncDefaultLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+		limit = min(n, syncMaxLimit)
+	}
+	var wait time.Duration
+	if v := c.Query("wait"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "wait must be a number of seconds"})
+			return
+		}
+		wait = min(time.Duration(n)*time.Second, syncMaxWait)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		rows, err := s.listSyncRows(ctx, projectID, cursor, limit+1)
+		if err != nil {
+			slog.Error("Failed to list project file changes", "project_id", projectID, "error", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list file changes"})
+			return
+		}
+		if len(rows) > 0 || !time.Now().Before(deadline) {
+			hasMore := len(rows) > limit
+			rows = rows[:min(len(rows), limit)]
+			response := SyncChangesResponse{Changes: []history.SyncChange{}, HasMore: hasMore}
+			for _, row := range rows {
+				// Edits outside of the working directory still move the cursor
+				cursor = history.SyncCursor{CreatedAt: row.CreatedAt, ID: row.ID}
+				if change, ok := history.NewSyncChange(workdir, row); ok {
+					response.Changes = append(response.Changes, change)
+				}
+			}
+			response.Cursor = cursor.String()
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(min(syncPollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+// handleGetProjectSyncPatch returns the agent edits of a project after a
+// cursor as a single patch bundle, for git apply. The cursor after the edits
+// is returned in the X-Sync-Cursor header.
+func (s *Server) handleGetProjectSyncPatch(c *gin.Context) {
+	projectID := c.Param("id")
+
+	workdir, ok := s.syncWorkdir(c, projectID)
+	if !ok {
+		return
+	}
+	cursor, ok := s.syncCursor(c, projectID)
+	if !ok {
+		return
+	}
+
+	rows, err := s.listSyncRows(c.Request.Context(), projectID, cursor, syncMaxLimit+1)
+	if err != nil {
+		slog.Error("Failed to list project file changes", "project_id", projectID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list file changes"})
+		return
+	}
+	hasMore := len(rows) > syncMaxLimit
+	rows = rows[:min(len(rows), syncMaxLimit)]
+	if len(rows) > 0 {
+		last := rows[len(rows)-1]
+		cursor = history.SyncCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	c.Header("X-Sync-Cursor", cursor.String())
+	c.Header("X-Sync-Has-More", strconv.FormatBool(hasMore))
+	c.String(http.StatusOK, history.SyncPatch(workdir, rows))
+}
+
+// syncWorkdir returns the working directory the synced paths are relative to,
+// writing the error response when the project does not exist.
+func (s *Server) syncWorkdir(c *gin.Context, projectID string) (string, bool) {
+	proj, err := s.projectService.GetByID(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return "", false
+	}
+	return cmp.Or(proj.WorkdirPath.String, proj.WorkspacePath), true
+}
+
+// syncCursor parses the cursor query parameter, resolving "latest" to the
+// last change of the project.
+func (s *Server) syncCursor(c *gin.Context, projectID string) (history.SyncCursor, bool) {
+	raw := c.Query("cursor")
+	if raw != history.SyncCursorLatest {
+		cursor, err := history.ParseSyncCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return history.SyncCursor{}, false
+		}
+		return cursor, true
+	}
+
+	latest, err := s.db.GetLatestProjectFileChange(c.Request.Context(), sql.NullString{String: projectID, Valid: true})
+	if errors.Is(err, sql.ErrNoRows) {
+		return history.SyncCursor{}, true
+	}
+	if err != nil {
+		slog.Error("Failed to get latest project file change", "project_id", projectID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get sync cursor"})
+		return history.SyncCursor{}, false
+	}
+	return history.SyncCursor{CreatedAt: latest.CreatedAt, ID: latest.ID}, true
+}
+
+func (s *Server) listSyncRows(ctx context.Context, projectID string, cursor history.SyncCursor, limit int) ([]postgres.ListProjectFileChangesRow, error) {
+	return s.db.ListProjectFileChanges(ctx, postgres.ListProjectFileChangesParams{
+		ProjectID: sql.NullString{String: projectID, Valid: true},
+		CreatedAt: cursor.CreatedAt,
+		ID:        cursor.ID,
+		Limit:     int32(limit),
+	})
+}
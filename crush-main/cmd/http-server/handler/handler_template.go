@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+)
+
+// handleListTemplates returns the gallery of project templates
+func (s *Server) handleListTemplates(c *gin.Context) {
+	templates, err := s.projectService.ListTemplates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	resp := make([]TemplateResponse, len(templates))
+	for i, template := range templates {
+		resp[i] = templateToResponse(template)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleCreateTemplate adds a project template to the gallery
+func (s *Server) handleCreateTemplate(c *gin.Context) {
+	var req TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	template, err := s.projectService.CreateTemplate(c.Request.Context(), req.params())
+	if errors.Is(err, project.ErrTemplateExists) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	slog.Info("Project template created", "template_id", template.ID, "name", template.Name, "user_id", c.GetString("user_id"))
+	c.JSON(http.StatusCreated, templateToResponse(template))
+}
+
+// handleUpdateTemplate replaces a project template, the projects created
+// from it are not changed
+func (s *Server) handleUpdateTemplate(c *gin.Context) {
+	var req TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	template, err := s.projectService.UpdateTemplate(c.Request.Context(), c.Param("id"), req.params())
+	if errors.Is(err, project.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, project.ErrTemplateExists) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, templateToResponse(template))
+}
+
+// handleDeleteTemplate removes a project template from the gallery
+func (s *Server) handleDeleteTemplate(c *gin.Context) {
+	if err := s.projectService.DeleteTemplate(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Project template deleted"})
+}
+
+// applyTemplate fills the stack of a project request from its template, the
+// backend language and database of the request win, and returns how the
+// sandbox scaffolds the workspace
+func applyTemplate(req *ProjectRequest, template project.Template) *sandbox.Scaffold {
+	if stringPtrToValue(req.BackendLanguage) == "" && template.BackendLanguage != "" {
+		req.BackendLanguage = &template.BackendLanguage
+	}
+	req.NeedDatabase = req.NeedDatabase || template.NeedDatabase
+	if template.StarterRepo == "" && len(template.Scripts) == 0 {
+		return nil
+	}
+	return &sandbox.Scaffold{
+		StarterRepo: template.StarterRepo,
+		StarterRef:  template.StarterRef,
+		Scripts:     template.Scripts,
+	}
+}
+
+// applyTemplateCommands sets the server commands of a project created from a
+// template
+func applyTemplateCommands(proj *project.Project, template project.Template) {
+	if template.FrontendCommand != "" {
+		proj.FrontendCommand = sql.NullString{String: template.FrontendCommand, Valid: true}
+	}
+	if template.BackendCommand != "" {
+		proj.BackendCommand = sql.NullString{String: template.BackendCommand, Valid: true}
+	}
+}
+
+// params converts a template request to the domain parameters
+func (req TemplateRequest) params() project.TemplateParams {
+	return project.TemplateParams{
+		Name:            req.Name,
+		Description:     req.Description,
+		BackendLanguage: req.BackendLanguage,
+		NeedDatabase:    req.NeedDatabase,
+		FrontendCommand: req.FrontendCommand,
+		BackendCommand:  req.BackendCommand,
+		StarterRepo:     req.StarterRepo,
+		StarterRef:      req.StarterRef,
+		Scripts:         req.Scripts,
+	}
+}
+
+// templateToResponse converts a project template to its API response
+func templateToResponse(template project.Template) TemplateResponse {
+	return TemplateResponse{
+		ID:              template.ID,
+		Name:            template.Name,
+		Description:     template.Description,
+		BackendLanguage: template.BackendLanguage,
+		NeedDatabase:    template.NeedDatabase,
+		FrontendCommand: template.FrontendCommand,
+		BackendCommand:  template.BackendCommand,
+		StarterRepo:     template.StarterRepo,
+		StarterRef:      template.StarterRef,
+		Scripts:         template.Scripts,
+		CreatedAt:       template.CreatedAt,
+		UpdatedAt:       template.UpdatedAt,
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGetMessageTimeline returns the timing breakdown of the turn a message belongs to
+func (s *Server) handleGetMessageTimeline(c *gin.Context) {
+	messageID := c.Param("id")
+	timeline, err := s.db.GetTurnTimelineByMessage(c.Request.Context(), messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No timeline recorded for this message"})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get turn timeline", "message_id", messageID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get turn timeline"})
+		return
+	}
+
+	steps := json.RawMessage(timeline.Steps)
+	if !json.Valid(steps) {
+		steps = json.RawMessage("[]")
+	}
+	c.JSON(http.StatusOK, TurnTimelineResponse{
+		ID:            timeline.ID,
+		SessionID:     timeline.SessionID,
+		StartedAt:     timeline.StartedAt,
+		TotalMs:       timeline.TotalMs,
+		ModelMs:       timeline.ModelMs,
+		ToolMs:        timeline.ToolMs,
+		DBMs:          timeline.DbMs,
+		OtherMs:       max(timeline.TotalMs-timeline.ModelMs-timeline.ToolMs-timeline.DbMs, 0),
+		StepCount:     int(timeline.StepCount),
+		ToolCallCount: int(timeline.ToolCallCount),
+		Steps:         steps,
+	})
+}
+
+// handleGetMessageSteps returns the steps of the turn a message belongs to, in
+// order: the preparation, model call, tool runs and usage of each
+func (s *Server) handleGetMessageSteps(c *gin.Context) {
+	messageID := c.Param("id")
+	rows, err := s.db.ListTurnStepsByMessage(c.Request.Context(), messageID)
+	if err != nil {
+		slog.Error("Failed to list turn steps", "message_id", messageID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list turn steps"})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No steps recorded for this message"})
+		return
+	}
+
+	steps := make([]TurnStepResponse, len(rows))
+	for i, row := range rows {
+		toolCalls := json.RawMessage(row.ToolCalls)
+		if !json.Valid(toolCalls) {
+			toolCalls = json.RawMessage("[]")
+		}
+		steps[i] = TurnStepResponse{
+			MessageID:  row.MessageID,
+			TimelineID: row.TimelineID,
+			SessionID:  row.SessionID,
+			Index:      int(row.StepIndex),
+			StartedAt:  row.StartedAt,
+			Prepare: TurnStepPrepare{
+				DurationMs:       row.PrepareMs,
+				Messages:         int(row.MessageCount),
+				QueuedPrompts:    int(row.QueuedPrompts),
+				CompactedResults: int(row.CompactedResults),
+				LoopNudge:        row.LoopNudge,
+			},
+			ModelCall: TurnStepModelCall{
+				Provider:     row.Provider,
+				Model:        row.Model,
+				FirstTokenMs: row.FirstTokenMs,
+				DurationMs:   row.ModelMs,
+				FinishReason: row.FinishReason,
+			},
+			ToolCalls: toolCalls,
+			Usage: TurnStepUsage{
+				InputTokens:         row.InputTokens,
+				OutputTokens:        row.OutputTokens,
+				CacheCreationTokens: row.CacheCreationTokens,
+				CacheReadTokens:     row.CacheReadTokens,
+				Cost:                row.Cost,
+			},
+		}
+	}
+	c.JSON(http.StatusOK, steps)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/user"
+)
+
+// handleCreateAPIToken creates a personal access token for the current user
+func (s *Server) handleCreateAPIToken(c *gin.Context) {
+	userID := c.GetString("user_id")
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	apiToken, token, err := s.userService.CreateToken(c.Request.Context(), userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	slog.Info("API token created", "user_id", userID, "token_id", apiToken.ID, "scopes", apiToken.Scopes)
+	c.JSON(http.StatusCreated, CreateAPITokenResponse{
+		APITokenResponse: apiTokenToResponse(apiToken),
+		Token:            token,
+	})
+}
+
+// handleListAPITokens lists the personal access tokens of the current user
+func (s *Server) handleListAPITokens(c *gin.Context) {
+	userID := c.GetString("user_id")
+	tokens, err := s.userService.ListTokens(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := make([]APITokenResponse, len(tokens))
+	for i, t := range tokens {
+		response[i] = apiTokenToResponse(t)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleRevokeAPIToken revokes a personal access token of the current user
+func (s *Server) handleRevokeAPIToken(c *gin.Context) {
+	userID := c.GetString("user_id")
+	tokenID := c.Param("id")
+	if err := s.userService.RevokeToken(c.Request.Context(), userID, tokenID); err != nil {
+		if errors.Is(err, user.ErrTokenNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	slog.Info("API token revoked", "user_id", userID, "token_id", tokenID)
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+func apiTokenToResponse(t user.APIToken) APITokenResponse {
+	return APITokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		LastUsedAt: t.LastUsedAt,
+		ExpiresAt:  t.ExpiresAt,
+		RevokedAt:  t.RevokedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
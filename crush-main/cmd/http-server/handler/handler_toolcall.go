@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"encoding/json"
+	"log/slog"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
 )
 
 // ToolCallResponse represents a tool call state response
@@ -23,6 +26,14 @@ type ToolCallResponse struct {
 	FinishedAt   *int64 `json:"finished_at,omitempty"`
 }
 
+// PermissionParamsResponse holds the full parameters of a permission request,
+// sent truncated or masked to clients.
+type PermissionParamsResponse struct {
+	ToolCallID string          `json:"tool_call_id"`
+	SessionID  string          `json:"session_id"`
+	Params     json.RawMessage `json:"params"`
+}
+
 // handleGetSessionToolCalls gets all tool calls for a session
 func (s *Server) handleGetSessionToolCalls(c *gin.Context) {
 	sessionID := c.Param("id")
@@ -129,3 +140,33 @@ func (s *Server) handleGetToolCall(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// handleGetPermissionParams returns the full parameters of the permission
+// request of a tool call, e.g. the contents of an edit that were truncated or
+// had secrets masked in the permission_request event. The parameters of the
+// requests resumed from a previous run are the tool call input.
+func (s *Server) handleGetPermissionParams(c *gin.Context) {
+	sessionID := c.Param("id")
+	toolCallID := c.Param("toolCallId")
+	ctx := c.Request.Context()
+
+	if redisStream := storeredis.GetGlobalStreamService(); redisStream != nil {
+		params, err := redisStream.GetPermissionParams(ctx, sessionID, toolCallID)
+		if err != nil {
+			slog.Error("Failed to get permission params", "session_id", sessionID, "tool_call_id", toolCallID, "error", err)
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get permission params"})
+			return
+		}
+		if params != nil {
+			c.JSON(http.StatusOK, PermissionParamsResponse{ToolCallID: toolCallID, SessionID: sessionID, Params: params})
+			return
+		}
+	}
+
+	tc, err := s.toolCallService.Get(ctx, toolCallID)
+	if err != nil || tc.SessionID != sessionID || !json.Valid([]byte(tc.Input)) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Permission params not found"})
+		return
+	}
+	c.JSON(http.StatusOK, PermissionParamsResponse{ToolCallID: toolCallID, SessionID: sessionID, Params: json.RawMessage(tc.Input)})
+}
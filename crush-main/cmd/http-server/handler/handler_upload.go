@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/upload"
+)
+
+// handleCreateUpload starts a resumable upload. The file is then sent in
+// chunks of chunk_size bytes with PUT /api/uploads/:id?offset=<n>.
+func (s *Server) handleCreateUpload(c *gin.Context) {
+	var req CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	u, err := s.uploadService.Create(c.Request.Context(), userID, req.Filename, req.MimeType, req.Size)
+	if err != nil {
+		writeUploadError(c, u, err)
+		return
+	}
+	slog.Info("Upload started", "user_id", userID, "upload_id", u.ID, "size", u.Size, "mime_type", u.MimeType)
+	c.JSON(http.StatusCreated, uploadToResponse(u))
+}
+
+// handleGetUpload returns an upload of the current user, its received offset
+// is where an interrupted upload resumes.
+func (s *Server) handleGetUpload(c *gin.Context) {
+	u, err := s.uploadService.Get(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		writeUploadError(c, u, err)
+		return
+	}
+	c.JSON(http.StatusOK, uploadToResponse(u))
+}
+
+// handleUploadChunk stores the chunk starting at the offset query parameter.
+// The chunk is the raw request body, or the "chunk" field of a multipart form.
+func (s *Server) handleUploadChunk(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "offset must be a non-negative integer"})
+		return
+	}
+
+	// Leave room for the multipart framing, larger chunks fail validation
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, upload.ChunkSize+1<<20)
+	body := io.Reader(c.Request.Body)
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		file, _, err := c.Request.FormFile("chunk")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No chunk provided"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+	data, err := io.ReadAll(io.LimitReader(body, upload.ChunkSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read chunk"})
+		return
+	}
+
+	u, err := s.uploadService.WriteChunk(c.Request.Context(), c.GetString("user_id"), c.Param("id"), offset, data)
+	if err != nil {
+		writeUploadError(c, u, err)
+		return
+	}
+	c.JSON(http.StatusOK, uploadToResponse(u))
+}
+
+// writeUploadError maps upload errors to responses. Offset conflicts include
+// the upload so the client can resume from its received offset.
+func writeUploadError(c *gin.Context, u upload.Upload, err error) {
+	var offsetErr *upload.OffsetError
+	switch {
+	case errors.As(err, &offsetErr), errors.Is(err, upload.ErrAlreadyCompleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "upload": uploadToResponse(u)})
+	case errors.Is(err, upload.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, upload.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, upload.ErrQuotaExceeded):
+		c.JSON(http.StatusInsufficientStorage, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, upload.ErrInvalidType), errors.Is(err, upload.ErrContentMismatch):
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, upload.ErrInvalidChunk):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, upload.ErrStorageUnavailable):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error()})
+	default:
+		slog.Error("Upload failed", "upload_id", u.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
+
+func uploadToResponse(u upload.Upload) UploadResponse {
+	resp := UploadResponse{
+		ID:          u.ID,
+		Filename:    u.Filename,
+		MimeType:    u.MimeType,
+		Size:        u.Size,
+		ChunkSize:   u.ChunkSize,
+		Received:    u.Received,
+		Status:      u.Status,
+		CreatedAt:   u.CreatedAt,
+		CompletedAt: u.CompletedAt,
+	}
+	if u.Completed() {
+		resp.URL = u.URL()
+	}
+	return resp
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rolling1314/rolling-crush/domain/project"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+// maxWebhookBodySize bounds the size of accepted webhook deliveries.
+const maxWebhookBodySize = 5 << 20
+
+// handleGetProjectWebhook returns the inbound webhook configuration of a project
+func (s *Server) handleGetProjectWebhook(c *gin.Context) {
+	projectID := c.Param("id")
+	webhook, err := s.projectService.GetWebhook(c.Request.Context(), projectID)
+	if errors.Is(err, project.ErrWebhookNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, webhookToResponse(webhook))
+}
+
+// handleSetProjectWebhook creates or replaces the inbound webhook of a project
+func (s *Server) handleSetProjectWebhook(c *gin.Context) {
+	projectID := c.Param("id")
+	var req ProjectWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := s.projectService.GetByID(ctx, projectID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Project not found"})
+		return
+	}
+
+	enabled := req.Enabled == nil || *req.Enabled
+	webhook, err := s.projectService.SetWebhook(ctx, projectID, project.WebhookParams{
+		Secret:         req.Secret,
+		Events:         req.Events,
+		PromptTemplate: req.PromptTemplate,
+		PostComment:    req.PostComment,
+		SCMToken:       req.SCMToken,
+		Enabled:        enabled,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	slog.Info("Project webhook configured", "project_id", projectID, "events", webhook.Events, "enabled", webhook.Enabled)
+	c.JSON(http.StatusOK, webhookToResponse(&webhook))
+}
+
+// handleDeleteProjectWebhook removes the inbound webhook of a project
+func (s *Server) handleDeleteProjectWebhook(c *gin.Context) {
+	projectID := c.Param("id")
+	if err := s.projectService.DeleteWebhook(c.Request.Context(), projectID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// handleWebhookDelivery receives GitHub and GitLab deliveries for a project.
+// Verified push and pull request events start the configured prompt in a
+// fresh session on the WS service
+func (s *Server) handleWebhookDelivery(c *gin.Context) {
+	projectID := c.Param("id")
+	ctx := c.Request.Context()
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: "Failed to read webhook body"})
+		return
+	}
+
+	webhook, err := s.projectService.GetWebhook(ctx, projectID)
+	if errors.Is(err, project.ErrWebhookNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// The provider is told apart by its event header
+	var provider project.WebhookProvider
+	var eventName string
+	switch {
+	case c.GetHeader("X-GitHub-Event") != "":
+		provider = project.WebhookProviderGitHub
+		eventName = c.GetHeader("X-GitHub-Event")
+		err = project.VerifyGitHubSignature(webhook.Secret, body, c.GetHeader("X-Hub-Signature-256"))
+	case c.GetHeader("X-Gitlab-Event") != "":
+		provider = project.WebhookProviderGitLab
+		eventName = c.GetHeader("X-Gitlab-Event")
+		err = project.VerifyGitLabToken(webhook.Secret, c.GetHeader("X-Gitlab-Token"))
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unsupported webhook provider"})
+		return
+	}
+	if err != nil {
+		slog.Warn("Rejected webhook delivery", "project_id", projectID, "provider", provider, "error", err)
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	event, err := project.ParseWebhookEvent(provider, eventName, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if event == nil || !webhook.Handles(event.Kind) {
+		slog.Debug("Ignored webhook delivery", "project_id", projectID, "provider", provider, "event", eventName)
+		c.JSON(http.StatusAccepted, WebhookDeliveryResponse{Status: "ignored", Reason: "event not handled"})
+		return
+	}
+
+	prompt, err := webhook.RenderPrompt(event)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	redisCmd := storeredis.GetGlobalCommandService()
+	if redisCmd == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Agent service unavailable"})
+		return
+	}
+
+	sess, err := s.sessionService.Create(ctx, projectID, webhookSessionTitle(event))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	s.saveSessionModelConfig(sess.ID, autoSessionModelConfig())
+
+	run := storeredis.WebhookRunPayload{
+		SessionID: sess.ID,
+		ProjectID: projectID,
+		Prompt:    prompt,
+		Provider:  string(provider),
+		EventKind: event.Kind,
+	}
+	if webhook.PostComment && event.Kind == project.WebhookEventPullRequest {
+		run.CommentURL = event.CommentURL
+	}
+	if err := redisCmd.PublishWebhookRun(ctx, run); err != nil {
+		slog.Error("Failed to publish webhook run", "project_id", projectID, "session_id", sess.ID, "error", err)
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Agent service unavailable"})
+		return
+	}
+
+	slog.Info("Webhook run accepted",
+		"project_id", projectID,
+		"session_id", sess.ID,
+		"provider", provider,
+		"event", event.Kind,
+		"repository", event.Repository,
+	)
+	c.JSON(http.StatusAccepted, WebhookDeliveryResponse{Status: "accepted", SessionID: sess.ID})
+}
+
+// webhookSessionTitle names the session created for a webhook run
+func webhookSessionTitle(event *project.WebhookEvent) string {
+	if event.Kind == project.WebhookEventPullRequest {
+		return fmt.Sprintf("Webhook: %s #%d %s", event.Repository, event.Number, event.Title)
+	}
+	return fmt.Sprintf("Webhook: push to %s/%s", event.Repository, event.Branch)
+}
+
+// webhookToResponse converts a webhook configuration to its API response
+func webhookToResponse(webhook *project.Webhook) ProjectWebhookResponse {
+	return ProjectWebhookResponse{
+		ProjectID:      webhook.ProjectID,
+		URL:            "/api/webhooks/projects/" + webhook.ProjectID,
+		Secret:         webhook.Secret,
+		Events:         webhook.Events,
+		PromptTemplate: webhook.PromptTemplate,
+		PostComment:    webhook.PostComment,
+		HasSCMToken:    webhook.SCMToken != "",
+		Enabled:        webhook.Enabled,
+		CreatedAt:      webhook.CreatedAt,
+		UpdatedAt:      webhook.UpdatedAt,
+	}
+}
@@ -1,9 +1,41 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/auth"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/internal/pkg/log"
+	"github.com/rolling1314/rolling-crush/internal/ratelimit"
+)
+
+// requestIDHeader carries the ID correlating the logs of a request.
+const requestIDHeader = "X-Request-ID"
+
+const (
+	// idempotencyKeyHeader carries the key deduplicating the retries of a
+	// POST request, also accepted as the idempotency_key query parameter.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayHeader marks the responses replayed to a retry.
+	idempotentReplayHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize bounds the request bodies fingerprinted and the
+	// responses kept for replay, larger responses are not replayed.
+	maxIdempotentBodySize = 1 << 20
 )
 
 // corsMiddleware returns a middleware that handles CORS
@@ -11,7 +43,7 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, Idempotency-Key")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusOK)
@@ -21,3 +53,277 @@ func corsMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// requestLogMiddleware tags the logs of a request with its ID, taken from
+// the X-Request-ID header of the caller or generated, echoes the ID back and
+// logs the request once it is handled.
+func requestLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		c.Writer.Header().Set(requestIDHeader, id)
+		c.Request = c.Request.WithContext(log.WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+
+		level := slog.LevelInfo
+		switch status := c.Writer.Status(); {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case c.FullPath() == "/health":
+			level = slog.LevelDebug
+		}
+		// The token of a share link is left out of the logs
+		path := c.Request.URL.Path
+		if strings.HasPrefix(c.FullPath(), "/api/shared/") {
+			path = c.FullPath()
+		}
+		slog.Log(c.Request.Context(), level, "HTTP request",
+			"method", c.Request.Method,
+			"path", path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// errorCodeMiddleware returns a middleware classifying the JSON error
+// responses, see package apierr: the error_code set by the handler, or else
+// the one of the status, is completed with its category and whether the
+// request may be retried. Bodies without a string "error" field are left as
+// they are.
+func errorCodeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &errorCodeWriter{ResponseWriter: c.Writer}
+		c.Next()
+	}
+}
+
+// errorCodeWriter rewrites the first write of an error response, gin renders
+// JSON in a single write.
+type errorCodeWriter struct {
+	gin.ResponseWriter
+	written bool
+}
+
+func (w *errorCodeWriter) Write(b []byte) (int, error) {
+	if w.written || w.Status() < http.StatusBadRequest ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.written = true
+		return w.ResponseWriter.Write(b)
+	}
+	w.written = true
+	body, ok := withErrorCode(b, w.Status())
+	if !ok {
+		return w.ResponseWriter.Write(b)
+	}
+	if _, err := w.ResponseWriter.Write(body); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *errorCodeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// withErrorCode adds the classification of an error to its JSON body.
+func withErrorCode(body []byte, status int) ([]byte, bool) {
+	var fields map[string]any
+	if json.Unmarshal(body, &fields) != nil {
+		return nil, false
+	}
+	if _, ok := fields["error"].(string); !ok {
+		return nil, false
+	}
+	code := apierr.FromStatus(status)
+	if set, ok := fields["error_code"].(string); ok && set != "" {
+		code = apierr.Code(set)
+	}
+	info := apierr.New(code, "")
+	fields["error_code"] = info.Code
+	fields["category"] = info.Category
+	fields["retryable"] = info.Retryable
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// shareTokenMiddleware returns a middleware admitting the requests of a share
+// link, whose token in the path grants read-only access to one session. The
+// claims of the token are stored as "share_claims".
+func shareTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := auth.ValidateShareToken(c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired share link"})
+			c.Abort()
+			return
+		}
+		c.Set("share_claims", claims)
+		c.Next()
+	}
+}
+
+// rateLimitMiddleware returns a middleware that rejects the requests over the
+// limit of the user with 429 Too Many Requests. Routes without authentication
+// are limited per client IP. It must run after auth.GinAuthMiddleware.
+func rateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if userID := c.GetString("user_id"); userID != "" {
+			key = "user:" + userID
+		}
+		ok, retryAfter := limiter.Allow(c.Request.Context(), key)
+		if !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Writer.Header().Set("Retry-After", strconv.Itoa(max(1, seconds)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many requests, retry later",
+				"retry_after": max(1, seconds),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// idempotencyMiddleware returns a middleware deduplicating the POST requests
+// sent with an idempotency key, e.g. retried after a network error: the first
+// request is handled and its response is replayed to the retries for
+// storeredis.IdempotencyTTL. Keys are per user, a retry still being handled is
+// rejected with 409 Conflict and a key reused for another request with 422
+// Unprocessable Entity. Responses with a 5xx status are not kept, so that the
+// request can be retried. It must run after auth.GinAuthMiddleware.
+func idempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			key = c.Query("idempotency_key")
+		}
+		stream := storeredis.GetGlobalStreamService()
+		if c.Request.Method != http.MethodPost || key == "" || stream == nil {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		ctx := c.Request.Context()
+		scope := "http:" + c.GetString("user_id")
+		fingerprint, err := requestFingerprint(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		result, err := stream.ReserveIdempotencyKey(ctx, scope, key, fingerprint)
+		if err != nil {
+			// Without Redis the request is handled, as without a key
+			slog.Warn("Failed to reserve idempotency key", "error", err)
+			c.Next()
+			return
+		}
+		if result != nil {
+			switch {
+			case result.Fingerprint != fingerprint:
+				c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: "Idempotency-Key was used for a different request"})
+			case result.Pending:
+				c.Writer.Header().Set("Retry-After", "1")
+				c.JSON(http.StatusConflict, ErrorResponse{Error: "A request with this Idempotency-Key is in progress"})
+			default:
+				c.Writer.Header().Set(idempotentReplayHeader, "true")
+				c.Data(result.StatusCode, result.ContentType, result.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		recorder := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The request may be canceled once its response is written
+		ctx = context.WithoutCancel(ctx)
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError || recorder.truncated {
+			if err := stream.ReleaseIdempotencyKey(ctx, scope, key); err != nil {
+				slog.Warn("Failed to release idempotency key", "error", err)
+			}
+			return
+		}
+		err = stream.CompleteIdempotencyKey(ctx, scope, key, storeredis.IdempotentResult{
+			Fingerprint: fingerprint,
+			StatusCode:  status,
+			ContentType: c.Writer.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+			CreatedAt:   time.Now().UnixMilli(),
+		})
+		if err != nil {
+			slog.Warn("Failed to store idempotent result", "error", err)
+		}
+	}
+}
+
+// requestFingerprint identifies a request by its method, path and body. The
+// body is left readable by the handler. Bodies over maxIdempotentBodySize,
+// e.g. uploads, are identified by their length.
+func requestFingerprint(c *gin.Context) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, c.Request.Method+" "+c.Request.URL.Path+"\n")
+	if c.Request.ContentLength > maxIdempotentBodySize {
+		io.WriteString(h, strconv.FormatInt(c.Request.ContentLength, 10))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	if c.Request.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentBodySize+1))
+		if err != nil {
+			return "", err
+		}
+		// A body of unknown length is put back in front of its unread rest
+		c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(body), c.Request.Body), c.Request.Body}
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// recordingWriter keeps a copy of the response body, up to
+// maxIdempotentBodySize.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *recordingWriter) record(b []byte) {
+	if w.truncated || w.body.Len()+len(b) > maxIdempotentBodySize {
+		w.truncated = true
+		return
+	}
+	w.body.Write(b)
+}
@@ -3,20 +3,32 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log/slog"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rolling1314/rolling-crush/auth"
+	"github.com/rolling1314/rolling-crush/domain/account"
+	"github.com/rolling1314/rolling-crush/domain/analytics"
+	"github.com/rolling1314/rolling-crush/domain/audit"
+	"github.com/rolling1314/rolling-crush/domain/budget"
+	"github.com/rolling1314/rolling-crush/domain/feedback"
+	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/rolling1314/rolling-crush/domain/memory"
 	"github.com/rolling1314/rolling-crush/domain/message"
 	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/domain/search"
+	"github.com/rolling1314/rolling-crush/domain/secret"
 	"github.com/rolling1314/rolling-crush/domain/session"
+	"github.com/rolling1314/rolling-crush/domain/snapshot"
 	"github.com/rolling1314/rolling-crush/domain/toolcall"
+	"github.com/rolling1314/rolling-crush/domain/upload"
 	"github.com/rolling1314/rolling-crush/domain/user"
 	"github.com/rolling1314/rolling-crush/infra/cloudflare"
 	"github.com/rolling1314/rolling-crush/infra/email"
 	"github.com/rolling1314/rolling-crush/infra/postgres"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
 	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/ratelimit"
 	"github.com/rolling1314/rolling-crush/pkg/config"
 )
 
@@ -29,6 +41,19 @@ type Server struct {
 	sessionService   session.Service
 	messageService   message.Service
 	toolCallService  toolcall.Service
+	accountService   account.Service
+	uploadService    upload.Service
+	budgetService    budget.Service
+	auditService     audit.Service
+	analyticsService analytics.Service
+	searchService    search.Service
+	memoryService    memory.Service
+	feedbackService  feedback.Service
+	snapshotService  snapshot.Service
+	historyService   history.Service
+	secretService    secret.Service // nil when the secrets store is disabled
+	reconciler       *project.Reconciler
+	limiter          *ratelimit.Limiter
 	db               *postgres.Queries
 	config           *config.Config
 	sandboxClient    *sandbox.Client
@@ -37,9 +62,11 @@ type Server struct {
 }
 
 // New creates a new HTTP server instance
-func New(port string, userService user.Service, projectService project.Service, sessionService session.Service, messageService message.Service, toolCallService toolcall.Service, queries *postgres.Queries, cfg *config.Config) *Server {
+func New(port string, userService user.Service, projectService project.Service, sessionService session.Service, messageService message.Service, toolCallService toolcall.Service, accountService account.Service, uploadService upload.Service, budgetService budget.Service, analyticsService analytics.Service, snapshotService snapshot.Service, historyService history.Service, secretService secret.Service, reconciler *project.Reconciler, queries *postgres.Queries, cfg *config.Config) *Server {
 	gin.SetMode(gin.DebugMode)
-	engine := gin.Default()
+	// Requests are logged by requestLogMiddleware
+	engine := gin.New()
+	engine.Use(gin.Recovery())
 
 	// Initialize email service
 	appCfg := config.GetGlobalAppConfig()
@@ -47,16 +74,20 @@ func New(port string, userService user.Service, projectService project.Service,
 
 	// Initialize Cloudflare client
 	var cloudflareClient *cloudflare.Client
-	fmt.Printf("🔧 Cloudflare config: api_token=%q, domain=%q\n", appCfg.Cloudflare.APIToken, appCfg.Cloudflare.Domain)
 	if appCfg.Cloudflare.APIToken != "" && appCfg.Cloudflare.Domain != "" {
 		cloudflareClient = cloudflare.NewClient(appCfg.Cloudflare.APIToken, appCfg.Cloudflare.Domain)
-		fmt.Printf("✅ Cloudflare client initialized for domain: %s\n", appCfg.Cloudflare.Domain)
 		slog.Info("Cloudflare client initialized", "domain", appCfg.Cloudflare.Domain)
 	} else {
-		fmt.Println("❌ Cloudflare client NOT initialized: missing api_token or domain")
 		slog.Warn("Cloudflare client not initialized: missing api_token or domain in config")
 	}
 
+	// Per user request limits, shared by the instances through Redis when available
+	var limitStore ratelimit.Store
+	if client := storeredis.GetClient(); client != nil {
+		limitStore = storeredis.NewRateLimitStore(client)
+	}
+	limiter := ratelimit.New(limitStore, "http:", ratelimit.Limit(appCfg.RateLimit.HTTP))
+
 	return &Server{
 		port:             port,
 		engine:           engine,
@@ -65,6 +96,19 @@ func New(port string, userService user.Service, projectService project.Service,
 		sessionService:   sessionService,
 		messageService:   messageService,
 		toolCallService:  toolCallService,
+		accountService:   accountService,
+		uploadService:    uploadService,
+		budgetService:    budgetService,
+		auditService:     audit.NewService(queries),
+		analyticsService: analyticsService,
+		searchService:    search.NewService(queries),
+		memoryService:    memory.NewService(queries),
+		feedbackService:  feedback.NewService(queries),
+		snapshotService:  snapshotService,
+		historyService:   historyService,
+		secretService:    secretService,
+		reconciler:       reconciler,
+		limiter:          limiter,
 		db:               queries,
 		config:           cfg,
 		sandboxClient:    sandbox.GetDefaultClient(),
@@ -75,19 +119,26 @@ func New(port string, userService user.Service, projectService project.Service,
 
 // Start initializes routes and starts the HTTP server
 func (s *Server) Start() error {
-	s.engine.Use(corsMiddleware())
+	s.engine.Use(corsMiddleware(), requestLogMiddleware(), errorCodeMiddleware())
 
 	// Health check
 	s.engine.GET("/health", s.handleHealth)
+	s.engine.GET("/health/redis", s.handleRedisHealth)
 
 	// GitHub OAuth callback (must be at root level to match GitHub OAuth app configuration)
 	s.engine.GET("/auth/github/callback", s.handleGitHubCallback)
 
+	// Requests over the limit of the user are rejected, see rateLimitMiddleware
+	limitRequests := rateLimitMiddleware(s.limiter)
+	// Retried POST requests with an Idempotency-Key replay the first response, see idempotencyMiddleware
+	dedupeRequests := idempotencyMiddleware()
+
 	// API routes
 	apiGroup := s.engine.Group("/api")
 	{
 		// Auth routes
 		authGroup := apiGroup.Group("/auth")
+		authGroup.Use(limitRequests)
 		{
 			authGroup.POST("/register", s.handleRegister)
 			authGroup.POST("/login", s.handleLogin)
@@ -103,49 +154,253 @@ func (s *Server) Start() error {
 			authGroup.POST("/reset-password", s.handleResetPassword)
 		}
 
+		// Personal access token routes, only usable from a login session
+		tokenGroup := apiGroup.Group("/tokens")
+		tokenGroup.Use(auth.GinAuthMiddleware(), limitRequests, auth.GinRequireLogin(), dedupeRequests)
+		{
+			tokenGroup.POST("", s.handleCreateAPIToken)
+			tokenGroup.GET("", s.handleListAPITokens)
+			tokenGroup.DELETE("/:id", s.handleRevokeAPIToken)
+		}
+
+		// Account data lifecycle routes, only usable from a login session
+		accountGroup := apiGroup.Group("/account")
+		accountGroup.Use(auth.GinAuthMiddleware(), limitRequests, auth.GinRequireLogin(), dedupeRequests)
+		{
+			accountGroup.POST("/exports", s.handleCreateAccountExport)
+			accountGroup.GET("/exports", s.handleListAccountExports)
+			accountGroup.GET("/exports/:id", s.handleGetAccountExport)
+			accountGroup.GET("/exports/:id/download", s.handleDownloadAccountExport)
+			accountGroup.DELETE("", s.handleDeleteAccount)
+			// Spending limits of the user across all projects
+			accountGroup.GET("/budget", s.handleGetAccountBudget)
+			accountGroup.PUT("/budget", s.handleSetAccountBudget)
+			accountGroup.DELETE("/budget", s.handleDeleteAccountBudget)
+		}
+
+		readSessions := auth.GinRequireScope(auth.ScopeReadSessions)
+		writePrompts := auth.GinRequireScope(auth.ScopeWritePrompts)
+		adminProject := auth.GinRequireScope(auth.ScopeAdminProject)
+
+		// SCM webhook deliveries, authenticated by their HMAC signature or token
+		apiGroup.POST("/webhooks/projects/:id", s.handleWebhookDelivery)
+
 		// Project routes
 		projectGroup := apiGroup.Group("/projects")
-		projectGroup.Use(auth.GinAuthMiddleware())
+		projectGroup.Use(auth.GinAuthMiddleware(), limitRequests, dedupeRequests)
 		{
-			projectGroup.POST("", s.handleCreateProject)
-			projectGroup.GET("", s.handleListProjects)
-			projectGroup.GET("/:id", s.handleGetProject)
-			projectGroup.PUT("/:id", s.handleUpdateProject)
-			projectGroup.DELETE("/:id", s.handleDeleteProject)
-			projectGroup.GET("/:id/sessions", s.handleGetProjectSessions)
+			projectGroup.POST("", adminProject, s.handleCreateProject)
+			projectGroup.GET("", readSessions, s.handleListProjects)
+			projectGroup.GET("/:id", readSessions, s.handleGetProject)
+			projectGroup.PUT("/:id", adminProject, s.handleUpdateProject)
+			projectGroup.DELETE("/:id", adminProject, s.handleDeleteProject)
+			projectGroup.GET("/:id/sessions", readSessions, s.handleGetProjectSessions)
+			// Resource limits and live usage of the project container
+			projectGroup.GET("/:id/resources", readSessions, s.handleGetProjectResources)
+			// Maintenance window routes
+			projectGroup.GET("/:id/pause", readSessions, s.handleGetProjectPause)
+			projectGroup.POST("/:id/pause", adminProject, s.handlePauseProject)
+			projectGroup.DELETE("/:id/pause", adminProject, s.handleResumeProject)
+			// Spending limits of the project sessions
+			projectGroup.GET("/:id/budget", readSessions, s.handleGetProjectBudget)
+			projectGroup.PUT("/:id/budget", adminProject, s.handleSetProjectBudget)
+			projectGroup.DELETE("/:id/budget", adminProject, s.handleDeleteProjectBudget)
+			// Notes the agent keeps about the project, shared by its sessions
+			projectGroup.GET("/:id/memory", readSessions, s.handleListProjectMemory)
+			projectGroup.POST("/:id/memory", writePrompts, s.handleAddProjectMemory)
+			projectGroup.DELETE("/:id/memory/:memoryId", writePrompts, s.handleDeleteProjectMemory)
+			// Secrets set as environment variables of the sandbox commands
+			projectGroup.GET("/:id/secrets", adminProject, s.handleListProjectSecrets)
+			projectGroup.PUT("/:id/secrets/:name", adminProject, s.handleSetProjectSecret)
+			projectGroup.DELETE("/:id/secrets/:name", adminProject, s.handleDeleteProjectSecret)
+			// Inbound webhook configuration
+			projectGroup.GET("/:id/webhook", adminProject, s.handleGetProjectWebhook)
+			projectGroup.PUT("/:id/webhook", adminProject, s.handleSetProjectWebhook)
+			projectGroup.DELETE("/:id/webhook", adminProject, s.handleDeleteProjectWebhook)
+			// Slack/Discord notifications of finished turns
+			projectGroup.GET("/:id/chat-hooks", adminProject, s.handleListChatHooks)
+			projectGroup.POST("/:id/chat-hooks", adminProject, s.handleCreateChatHook)
+			projectGroup.PUT("/:id/chat-hooks/:hookId", adminProject, s.handleUpdateChatHook)
+			projectGroup.DELETE("/:id/chat-hooks/:hookId", adminProject, s.handleDeleteChatHook)
+			projectGroup.POST("/:id/chat-hooks/:hookId/test", adminProject, s.handleTestChatHook)
+			// Permission policy rules, importable from Claude Code or Cursor settings
+			projectGroup.GET("/:id/permission-policy", adminProject, s.handleGetPermissionPolicy)
+			projectGroup.PUT("/:id/permission-policy", adminProject, s.handleSetPermissionPolicy)
+			projectGroup.POST("/:id/permission-policy/import", adminProject, s.handleImportPermissionPolicy)
+			// Shadow mode trials of candidate policies, compared with the enforced one
+			projectGroup.GET("/:id/permission-policy/shadow", adminProject, s.handleGetShadowPolicy)
+			projectGroup.PUT("/:id/permission-policy/shadow", adminProject, s.handleStartShadowPolicy)
+			projectGroup.DELETE("/:id/permission-policy/shadow", adminProject, s.handleStopShadowPolicy)
+			projectGroup.POST("/:id/permission-policy/shadow/promote", adminProject, s.handlePromoteShadowPolicy)
+			projectGroup.GET("/:id/permission-policy/shadow/report", adminProject, s.handleGetShadowReport)
+			// Session blueprints, instantiated with POST /:id/sessions?blueprint=<name>
+			projectGroup.GET("/:id/blueprints", readSessions, s.handleListBlueprints)
+			projectGroup.POST("/:id/blueprints", adminProject, s.handleCreateBlueprint)
+			projectGroup.PUT("/:id/blueprints/:blueprintId", adminProject, s.handleUpdateBlueprint)
+			projectGroup.DELETE("/:id/blueprints/:blueprintId", adminProject, s.handleDeleteBlueprint)
+			projectGroup.POST("/:id/sessions", writePrompts, s.handleCreateBlueprintSession)
+			// File change feed of the companion CLI syncing edits to a local checkout
+			projectGroup.GET("/:id/sync/changes", readSessions, s.handleGetProjectSyncChanges)
+			projectGroup.GET("/:id/sync/patch", readSessions, s.handleGetProjectSyncPatch)
+			// Lazy file tree of the project sandbox and file contents
+			projectGroup.GET("/:id/files", readSessions, s.handleListProjectFiles)
+			projectGroup.GET("/:id/file", readSessions, s.handleGetProjectFile)
+			// Archives of the project sandbox workspace, restoring one rolls back the agent edits
+			projectGroup.GET("/:id/snapshots", readSessions, s.handleListWorkspaceSnapshots)
+			projectGroup.POST("/:id/snapshots", adminProject, s.handleCreateWorkspaceSnapshot)
+			projectGroup.POST("/:id/snapshots/:snapshotId/restore", adminProject, s.handleRestoreWorkspaceSnapshot)
+			projectGroup.DELETE("/:id/snapshots/:snapshotId", adminProject, s.handleDeleteWorkspaceSnapshot)
 		}
 
 		// Session routes
 		sessionGroup := apiGroup.Group("/sessions")
-		sessionGroup.Use(auth.GinAuthMiddleware())
+		sessionGroup.Use(auth.GinAuthMiddleware(), limitRequests, dedupeRequests)
 		{
-			sessionGroup.POST("", s.handleCreateSession)
-			sessionGroup.GET("/:id/messages", s.handleGetSessionMessages)
-			sessionGroup.GET("/:id/config", s.handleGetSessionConfig)
-			sessionGroup.PUT("/:id/config", s.handleUpdateSessionConfig)
-			sessionGroup.DELETE("/:id", s.handleDeleteSession)
+			sessionGroup.POST("", writePrompts, s.handleCreateSession)
+			// Archive, delete or tag many sessions in a background job
+			sessionGroup.POST("/bulk", writePrompts, s.handleCreateBulkSessionJob)
+			sessionGroup.GET("/bulk", readSessions, s.handleListBulkSessionJobs)
+			sessionGroup.GET("/bulk/:id", readSessions, s.handleGetBulkSessionJob)
+			sessionGroup.GET("/:id/messages", readSessions, s.handleGetSessionMessages)
+			// Conversation export as markdown, JSON or HTML
+			sessionGroup.GET("/:id/export", readSessions, s.handleExportSession)
+			sessionGroup.GET("/:id/config", readSessions, s.handleGetSessionConfig)
+			sessionGroup.PUT("/:id/config", writePrompts, s.handleUpdateSessionConfig)
+			sessionGroup.DELETE("/:id", writePrompts, s.handleDeleteSession)
 			// Session running status (for checking if agent is still processing)
-			sessionGroup.GET("/:id/status", s.handleGetSessionRunningStatus)
+			sessionGroup.GET("/:id/status", readSessions, s.handleGetSessionRunningStatus)
+			// Prompts queued behind the running turn
+			sessionGroup.GET("/:id/queue", readSessions, s.handleGetSessionQueue)
+			sessionGroup.PUT("/:id/queue", writePrompts, s.handleReorderSessionQueue)
+			sessionGroup.DELETE("/:id/queue/:promptId", writePrompts, s.handleDeleteQueuedPrompt)
+			// Session, project and user spending limits with their usage
+			sessionGroup.GET("/:id/budget", readSessions, s.handleGetSessionBudget)
+			sessionGroup.PUT("/:id/budget", writePrompts, s.handleSetSessionBudget)
+			sessionGroup.DELETE("/:id/budget", writePrompts, s.handleDeleteSessionBudget)
 			// Tool call routes
-			sessionGroup.GET("/:id/tool-calls", s.handleGetSessionToolCalls)
-			sessionGroup.GET("/:id/tool-calls/pending", s.handleGetPendingToolCalls)
-			sessionGroup.GET("/:id/tool-calls/:toolCallId", s.handleGetToolCall)
+			sessionGroup.GET("/:id/tool-calls", readSessions, s.handleGetSessionToolCalls)
+			sessionGroup.GET("/:id/tool-calls/pending", readSessions, s.handleGetPendingToolCalls)
+			sessionGroup.GET("/:id/tool-calls/:toolCallId", readSessions, s.handleGetToolCall)
+			sessionGroup.GET("/:id/tool-calls/:toolCallId/permission-params", readSessions, s.handleGetPermissionParams)
+			// Audit log of the session, e.g. moderated assistant text
+			sessionGroup.GET("/:id/audit-events", readSessions, s.handleGetSessionAuditEvents)
+			// Versions of the files edited in the session, diffs between them and reverts
+			sessionGroup.GET("/:id/history", readSessions, s.handleGetSessionFileHistory)
+			sessionGroup.GET("/:id/history/diff", readSessions, s.handleGetSessionFileDiff)
+			sessionGroup.POST("/:id/history/revert", writePrompts, s.handleRevertSessionFile)
+			// Prompts run in plan mode, read-only tools and a plan as the answer
+			sessionGroup.POST("/:id/plan", writePrompts, s.handleCreatePlan)
+			sessionGroup.GET("/:id/plan/:planId", readSessions, s.handleGetPlan)
+			// LSP diagnostics of the edited files and the follow-up prompts fixing them
+			sessionGroup.GET("/:id/diagnostics", readSessions, s.handleGetSessionDiagnostics)
+			sessionGroup.GET("/:id/auto-fix", readSessions, s.handleGetSessionAutoFix)
+			sessionGroup.PUT("/:id/auto-fix", writePrompts, s.handleSetSessionAutoFix)
+			// What a prompt sent while the session is busy does
+			sessionGroup.GET("/:id/busy-policy", readSessions, s.handleGetSessionBusyPolicy)
+			sessionGroup.PUT("/:id/busy-policy", writePrompts, s.handleSetSessionBusyPolicy)
+			// Environment variables of the commands and fetched URLs of the session tools
+			sessionGroup.GET("/:id/env", readSessions, s.handleGetSessionEnv)
+			sessionGroup.PUT("/:id/env", writePrompts, s.handleSetSessionEnv)
+			// Read-only share link of the session, opened without an account
+			sessionGroup.POST("/:id/share", writePrompts, s.handleShareSession)
+		}
+
+		// Session opened from a share link: its export and live events, no
+		// prompts nor permission answers
+		sharedGroup := apiGroup.Group("/shared/:token")
+		sharedGroup.Use(limitRequests, shareTokenMiddleware())
+		{
+			sharedGroup.GET("", s.handleGetSharedSession)
+			sharedGroup.GET("/export", s.handleExportSharedSession)
+			sharedGroup.GET("/events", s.handleSharedSessionEvents)
+		}
+
+		// Audit log of the tool calls run by the agent in the projects of the user
+		apiGroup.GET("/audit/tool-calls", auth.GinAuthMiddleware(), limitRequests, readSessions, s.handleListToolAuditEntries)
+
+		// Full-text search over the messages of the user
+		apiGroup.GET("/search", auth.GinAuthMiddleware(), limitRequests, readSessions, s.handleSearch)
+
+		// Tokens, cost, tool calls, run durations and ratings in the projects of the user
+		analyticsGroup := apiGroup.Group("/analytics")
+		analyticsGroup.Use(auth.GinAuthMiddleware(), limitRequests, readSessions)
+		{
+			analyticsGroup.GET("/usage", s.handleAnalyticsUsage)
+			analyticsGroup.GET("/tools", s.handleAnalyticsTools)
+			analyticsGroup.GET("/runs", s.handleAnalyticsRuns)
+			analyticsGroup.GET("/feedback", s.handleAnalyticsFeedback)
+		}
+
+		// Message routes
+		messageGroup := apiGroup.Group("/messages")
+		messageGroup.Use(auth.GinAuthMiddleware(), limitRequests)
+		{
+			messageGroup.GET("/:id/timeline", readSessions, s.handleGetMessageTimeline)
+			messageGroup.GET("/:id/steps", readSessions, s.handleGetMessageSteps)
+			// Thumbs up or down on an answer of the agent, with a reason
+			messageGroup.POST("/:id/feedback", writePrompts, s.handleSubmitMessageFeedback)
 		}
 
 		// Provider routes
-		apiGroup.GET("/providers", auth.GinAuthMiddleware(), s.handleGetProviders)
-		apiGroup.GET("/providers/:provider/models", auth.GinAuthMiddleware(), s.handleGetProviderModels)
-		apiGroup.POST("/providers/test-connection", auth.GinAuthMiddleware(), s.handleTestProviderConnection)
-		apiGroup.POST("/providers/configure", auth.GinAuthMiddleware(), s.handleConfigureProvider)
+		apiGroup.GET("/providers", auth.GinAuthMiddleware(), limitRequests, readSessions, s.handleGetProviders)
+		apiGroup.GET("/providers/:provider/models", auth.GinAuthMiddleware(), limitRequests, readSessions, s.handleGetProviderModels)
+		apiGroup.POST("/providers/test-connection", auth.GinAuthMiddleware(), limitRequests, adminProject, dedupeRequests, s.handleTestProviderConnection)
+		apiGroup.POST("/providers/configure", auth.GinAuthMiddleware(), limitRequests, adminProject, dedupeRequests, s.handleConfigureProvider)
+
+		// Instance-wide administration, only for the operators listed in
+		// auth.admins
+		adminGroup := apiGroup.Group("/admin")
+		adminGroup.Use(auth.GinAuthMiddleware(), limitRequests, adminProject, auth.GinRequireOperator(), dedupeRequests)
+		{
+			// Deployment config promotion
+			adminGroup.GET("/config/export", s.handleExportConfig)
+			adminGroup.POST("/config/import", s.handleImportConfig)
+			// Sandbox containers without project and projects without container
+			adminGroup.GET("/sandbox/orphans", s.handleListSandboxOrphans)
+			adminGroup.POST("/sandbox/orphans/clean", s.handleCleanSandboxOrphans)
+			// Instance-wide activity and dependency health
+			adminGroup.GET("/overview", s.handleAdminOverview)
+			// Recent logs of this service
+			adminGroup.GET("/logs", s.handleAdminLogs)
+			// Instance-wide analytics, optionally of a user
+			adminGroup.GET("/analytics/usage", s.handleAdminAnalyticsUsage)
+			adminGroup.GET("/analytics/tools", s.handleAdminAnalyticsTools)
+			adminGroup.GET("/analytics/runs", s.handleAdminAnalyticsRuns)
+			adminGroup.GET("/analytics/feedback", s.handleAdminAnalyticsFeedback)
+			// Dry run of the session retention
+			adminGroup.GET("/retention/report", s.handleRetentionReport)
+			// Redis keys of sessions missing from the database
+			adminGroup.GET("/redis/orphans", s.handleListRedisOrphans)
+			// Global secrets, e.g. the API keys of the providers
+			adminGroup.GET("/secrets", s.handleListSecrets)
+			adminGroup.PUT("/secrets/:name", s.handleSetSecret)
+			adminGroup.DELETE("/secrets/:name", s.handleDeleteSecret)
+			// Project template gallery
+			adminGroup.POST("/templates", s.handleCreateTemplate)
+			adminGroup.PUT("/templates/:id", s.handleUpdateTemplate)
+			adminGroup.DELETE("/templates/:id", s.handleDeleteTemplate)
+		}
+
+		// Gallery of the templates new projects can start from
+		apiGroup.GET("/templates", auth.GinAuthMiddleware(), limitRequests, readSessions, s.handleListTemplates)
 
 		// Auto model config endpoint
-		apiGroup.GET("/auto-model", auth.GinAuthMiddleware(), s.handleGetAutoModel)
+		apiGroup.GET("/auto-model", auth.GinAuthMiddleware(), limitRequests, readSessions, s.handleGetAutoModel)
 
 		// File routes
-		apiGroup.GET("/files", auth.GinAuthMiddleware(), s.handleGetFiles)
+		apiGroup.GET("/files", auth.GinAuthMiddleware(), limitRequests, readSessions, s.handleGetFiles)
 
 		// Image upload route
-		apiGroup.POST("/upload", auth.GinAuthMiddleware(), s.handleUploadImage)
+		apiGroup.POST("/upload", auth.GinAuthMiddleware(), limitRequests, writePrompts, dedupeRequests, s.handleUploadImage)
+
+		// Resumable uploads of large attachments, referenced by crush:// URL
+		uploadGroup := apiGroup.Group("/uploads")
+		uploadGroup.Use(auth.GinAuthMiddleware(), limitRequests, writePrompts, dedupeRequests)
+		{
+			uploadGroup.POST("", s.handleCreateUpload)
+			uploadGroup.GET("/:id", s.handleGetUpload)
+			uploadGroup.PUT("/:id", s.handleUploadChunk)
+		}
 	}
 
 	slog.Info("HTTP server starting", "port", s.port)
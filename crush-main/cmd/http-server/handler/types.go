@@ -1,5 +1,20 @@
 package handler
 
+import (
+	"encoding/json"
+
+	"github.com/rolling1314/rolling-crush/domain/account"
+	"github.com/rolling1314/rolling-crush/domain/budget"
+	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/internal/diagnostics"
+	"github.com/rolling1314/rolling-crush/internal/pkg/log"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
 // RegisterRequest represents a user registration request
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
@@ -49,6 +64,11 @@ type ProjectRequest struct {
 	BackendCommand   *string `json:"backend_command,omitempty"`
 	BackendLanguage  *string `json:"backend_language,omitempty"`
 	Subdomain        *string `json:"subdomain,omitempty"`
+	SystemPrompt     *string `json:"system_prompt,omitempty"` // Added to the system prompt of the agent, kept on update when omitted
+	PermissionTimeout *int32 `json:"permission_timeout,omitempty"` // Seconds a permission request waits for the user, 0 uses the server default, kept on update when omitted
+	RetentionDays *int32 `json:"retention_days,omitempty"` // Days an inactive session is kept, 0 uses the server default, -1 keeps sessions, kept on update when omitted
+	Limits *ResourceLimits `json:"limits,omitempty"` // Resources of the container on create, the sandbox config defaults when omitted, ignored on update
+	TemplateID string `json:"template_id,omitempty"` // Template scaffolding the workspace on create, its stack applies unless the request sets one, ignored on update
 	NeedDatabase     bool    `json:"need_database"`
 }
 
@@ -73,10 +93,493 @@ type ProjectResponse struct {
 	BackendCommand   *string `json:"backend_command,omitempty"`
 	BackendLanguage  *string `json:"backend_language,omitempty"`
 	Subdomain        *string `json:"subdomain,omitempty"`
+	SystemPrompt     string  `json:"system_prompt,omitempty"`
+	PermissionTimeout int32  `json:"permission_timeout,omitempty"`
+	RetentionDays int32  `json:"retention_days,omitempty"`
+	Limits ResourceLimits `json:"limits"`
+	Usage *ResourceUsage `json:"usage,omitempty"` // Live usage of the container, only on single project reads
 	CreatedAt        int64   `json:"created_at"`
 	UpdatedAt        int64   `json:"updated_at"`
 }
 
+// ResourceLimits represents the resources of a project container, 0 means unlimited
+type ResourceLimits struct {
+	CPUs     float64 `json:"cpus"`
+	MemoryMB int32   `json:"memory_mb"`
+	DiskMB   int32   `json:"disk_mb"`
+}
+
+// ResourceUsage represents the live resource usage of a project container,
+// the percents are of the limits and 0 when a resource is unlimited
+type ResourceUsage struct {
+	CPUPercent    float64 `json:"cpu_percent"` // 100 is one full CPU
+	MemoryUsageMB int64   `json:"memory_usage_mb"`
+	MemoryLimitMB int64   `json:"memory_limit_mb"`
+	MemoryPercent float64 `json:"memory_percent"`
+	DiskUsageMB   int64   `json:"disk_usage_mb"`
+	DiskLimitMB   int64   `json:"disk_limit_mb"`
+	DiskPercent   float64 `json:"disk_percent"`
+}
+
+// ProjectResourcesResponse represents the resource limits and live usage of a project container
+type ProjectResourcesResponse struct {
+	ProjectID string         `json:"project_id"`
+	Limits    ResourceLimits `json:"limits"`
+	Usage     *ResourceUsage `json:"usage,omitempty"` // Missing when the project has no container
+}
+
+// ProjectPauseRequest represents a request to start a project maintenance window
+type ProjectPauseRequest struct {
+	Reason   string `json:"reason"`
+	Mode     string `json:"mode"`      // "reject" (default) or "queue"
+	Drain    bool   `json:"drain"`     // Cancel the agent runs that are in flight
+	ResumeAt int64  `json:"resume_at"` // Optional automatic resume time (Unix ms)
+}
+
+// ProjectPauseResponse represents the maintenance window state of a project
+type ProjectPauseResponse struct {
+	ProjectID       string   `json:"project_id"`
+	Paused          bool     `json:"paused"`
+	Reason          string   `json:"reason,omitempty"`
+	Mode            string   `json:"mode,omitempty"`
+	Drain           bool     `json:"drain,omitempty"`
+	PausedBy        string   `json:"paused_by,omitempty"`
+	PausedAt        int64    `json:"paused_at,omitempty"`
+	ResumeAt        int64    `json:"resume_at,omitempty"`
+	RunningSessions []string `json:"running_sessions,omitempty"`
+}
+
+// ProjectWebhookRequest represents a request to configure the inbound webhook of a project
+type ProjectWebhookRequest struct {
+	Secret         string   `json:"secret"`          // Generated (or kept) when empty
+	Events         []string `json:"events"`          // push, pull_request; defaults to both
+	PromptTemplate string   `json:"prompt_template"` // Go text/template rendered with the event
+	PostComment    bool     `json:"post_comment"`    // Post the result as a pull request comment
+	SCMToken       string   `json:"scm_token"`       // Token used to post comments
+	Enabled        *bool    `json:"enabled"`         // Defaults to true
+}
+
+// ProjectWebhookResponse represents the inbound webhook configuration of a project
+type ProjectWebhookResponse struct {
+	ProjectID      string   `json:"project_id"`
+	URL            string   `json:"url"`
+	Secret         string   `json:"secret"`
+	Events         []string `json:"events"`
+	PromptTemplate string   `json:"prompt_template"`
+	PostComment    bool     `json:"post_comment"`
+	HasSCMToken    bool     `json:"has_scm_token"`
+	Enabled        bool     `json:"enabled"`
+	CreatedAt      int64    `json:"created_at"`
+	UpdatedAt      int64    `json:"updated_at"`
+}
+
+// WebhookDeliveryResponse represents the outcome of an inbound webhook delivery
+type WebhookDeliveryResponse struct {
+	Status    string `json:"status"` // "accepted" or "ignored"
+	SessionID string `json:"session_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ChatHookRequest represents a request to configure a Slack or Discord hook of a project
+type ChatHookRequest struct {
+	Platform   string   `json:"platform" binding:"required"`    // slack or discord
+	WebhookURL string   `json:"webhook_url" binding:"required"` // Incoming webhook URL
+	Template   string   `json:"template"`                       // Go text/template rendered with the turn summary
+	Events     []string `json:"events"`                         // completed, failed, cancelled; defaults to completed and failed
+	Enabled    *bool    `json:"enabled"`                        // Defaults to true
+}
+
+// ChatHookResponse represents a Slack or Discord hook of a project
+type ChatHookResponse struct {
+	ID         string   `json:"id"`
+	ProjectID  string   `json:"project_id"`
+	Platform   string   `json:"platform"`
+	WebhookURL string   `json:"webhook_url"`
+	Template   string   `json:"template"`
+	Events     []string `json:"events"`
+	Enabled    bool     `json:"enabled"`
+	CreatedAt  int64    `json:"created_at"`
+	UpdatedAt  int64    `json:"updated_at"`
+}
+
+// BlueprintModelConfig is the model selection of a session blueprint
+type BlueprintModelConfig struct {
+	Provider        string `json:"provider" binding:"required"`
+	Model           string `json:"model" binding:"required"`
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	MaxTokens       int64  `json:"max_tokens,omitempty"`
+}
+
+// BlueprintRequest represents a request to configure a session blueprint of a project
+type BlueprintRequest struct {
+	Name          string                `json:"name" binding:"required"` // Used as ?blueprint= when creating sessions
+	Description   string                `json:"description"`
+	PinnedContext string                `json:"pinned_context"` // Added to the system prompt of every turn
+	ModelConfig   *BlueprintModelConfig `json:"model_config"`   // Defaults to the auto model
+	AllowedTools  []string              `json:"allowed_tools"`  // Tools the session may use without asking
+	Prompts       []string              `json:"prompts"`        // Opening prompts, run in order
+	Agent         string                `json:"agent"`          // Named agent of the opening prompts, defaults to the coder
+}
+
+// BlueprintResponse represents a session blueprint of a project
+type BlueprintResponse struct {
+	ID            string                `json:"id"`
+	ProjectID     string                `json:"project_id"`
+	Name          string                `json:"name"`
+	Description   string                `json:"description"`
+	PinnedContext string                `json:"pinned_context"`
+	ModelConfig   *BlueprintModelConfig `json:"model_config,omitempty"`
+	AllowedTools  []string              `json:"allowed_tools"`
+	Prompts       []string              `json:"prompts"`
+	Agent         string                `json:"agent,omitempty"`
+	CreatedAt     int64                 `json:"created_at"`
+	UpdatedAt     int64                 `json:"updated_at"`
+}
+
+// TemplateRequest represents a request to configure a project template
+type TemplateRequest struct {
+	Name            string   `json:"name" binding:"required"`
+	Description     string   `json:"description"`
+	BackendLanguage string   `json:"backend_language"` // "", "go", "java" or "python"
+	NeedDatabase    bool     `json:"need_database"`
+	FrontendCommand string   `json:"frontend_command"`
+	BackendCommand  string   `json:"backend_command"`
+	StarterRepo     string   `json:"starter_repo"` // https or ssh git remote cloned into the workspace
+	StarterRef      string   `json:"starter_ref"`  // Branch or tag, defaults to the default branch
+	Scripts         []string `json:"scripts"`      // Run in the workspace once it is created, in order
+}
+
+// TemplateResponse represents a project template
+type TemplateResponse struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	BackendLanguage string   `json:"backend_language,omitempty"`
+	NeedDatabase    bool     `json:"need_database"`
+	FrontendCommand string   `json:"frontend_command,omitempty"`
+	BackendCommand  string   `json:"backend_command,omitempty"`
+	StarterRepo     string   `json:"starter_repo,omitempty"`
+	StarterRef      string   `json:"starter_ref,omitempty"`
+	Scripts         []string `json:"scripts"`
+	CreatedAt       int64    `json:"created_at"`
+	UpdatedAt       int64    `json:"updated_at"`
+}
+
+// CreateBlueprintSessionRequest represents a request to create a session from a blueprint
+type CreateBlueprintSessionRequest struct {
+	Title string `json:"title"` // Defaults to the blueprint name
+}
+
+// BlueprintSessionResponse represents a session created from a blueprint
+type BlueprintSessionResponse struct {
+	SessionResponse
+	Blueprint string `json:"blueprint"`
+	Prompts   int    `json:"prompts"` // Opening prompts queued for the session
+}
+
+// TurnTimelineResponse is the timing breakdown of an agent turn
+type TurnTimelineResponse struct {
+	ID            string `json:"id"`
+	SessionID     string `json:"session_id"`
+	StartedAt     int64  `json:"started_at"`
+	TotalMs       int64  `json:"total_ms"`
+	ModelMs       int64  `json:"model_ms"`
+	ToolMs        int64  `json:"tool_ms"`
+	DBMs          int64  `json:"db_ms"`
+	OtherMs       int64  `json:"other_ms"` // Time not spent on the model, tools or persistence
+	StepCount     int    `json:"step_count"`
+	ToolCallCount int    `json:"tool_call_count"`
+	// Steps lists each model call with its first token latency and tool runs,
+	// offsets are milliseconds since the start of the turn
+	Steps json.RawMessage `json:"steps"`
+}
+
+// TurnStepResponse is a step of an agent turn: how its prompt was prepared,
+// the model call, the tools it ran and the tokens it used
+type TurnStepResponse struct {
+	MessageID  string            `json:"message_id"` // Assistant message written by the step
+	TimelineID string            `json:"timeline_id"`
+	SessionID  string            `json:"session_id"`
+	Index      int               `json:"index"`
+	StartedAt  int64             `json:"started_at"`
+	Prepare    TurnStepPrepare   `json:"prepare"`
+	ModelCall  TurnStepModelCall `json:"model_call"`
+	// ToolCalls lists the tool runs of the step, offsets are milliseconds
+	// since the start of the turn
+	ToolCalls json.RawMessage `json:"tool_calls"`
+	Usage     TurnStepUsage   `json:"usage"`
+}
+
+// TurnStepPrepare is how the prompt of a step was prepared
+type TurnStepPrepare struct {
+	DurationMs       int64 `json:"duration_ms"`
+	Messages         int   `json:"messages"`          // Messages sent to the model
+	QueuedPrompts    int   `json:"queued_prompts"`    // Queued prompts added to the step
+	CompactedResults int   `json:"compacted_results"` // Old tool results elided
+	LoopNudge        bool  `json:"loop_nudge"`        // Whether the model was nudged out of a tool call loop
+}
+
+// TurnStepModelCall is the model call of a step
+type TurnStepModelCall struct {
+	Provider     string `json:"provider"`
+	Model        string `json:"model"`
+	FirstTokenMs int64  `json:"first_token_ms"`
+	DurationMs   int64  `json:"duration_ms"`
+	FinishReason string `json:"finish_reason"` // Empty when the step did not finish
+}
+
+// TurnStepUsage is the tokens used by a step and their cost
+type TurnStepUsage struct {
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	Cost                float64 `json:"cost"`
+}
+
+// SyncChangesResponse is a page of the file change feed of a project, read by
+// the companion CLI applying agent edits to a local checkout
+type SyncChangesResponse struct {
+	// Cursor is passed back to receive the changes after this page
+	Cursor  string               `json:"cursor"`
+	Changes []history.SyncChange `json:"changes"`
+	HasMore bool                 `json:"has_more"`
+}
+
+// ProjectFilesResponse lists a directory of the sandbox of a project. Folders
+// within the requested depth are expanded, the others are listed on request.
+type ProjectFilesResponse struct {
+	Path      string              `json:"path"`
+	Entries   []sandbox.FileEntry `json:"entries"`
+	Truncated bool                `json:"truncated"`
+}
+
+// ProjectFileResponse is the content of a file of the sandbox of a project.
+// Text files are sent as is, other files base64 encoded.
+type ProjectFileResponse struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type"`
+	Encoding string `json:"encoding"` // "utf-8" or "base64"
+	Content  string `json:"content"`
+}
+
+// PermissionPolicyRequest replaces the permission policy rules of a project
+type PermissionPolicyRequest struct {
+	Rules []permission.PolicyRule `json:"rules"`
+}
+
+// PermissionPolicyResponse represents the permission policy of a project
+type PermissionPolicyResponse struct {
+	Rules []permission.PolicyRule `json:"rules"`
+}
+
+// PermissionPolicyImportRequest imports the permissions of a Claude Code
+// settings.json or a Cursor cli.json into the policy of a project
+type PermissionPolicyImportRequest struct {
+	// Format is "claude-code" or "cursor"
+	Format string `json:"format" binding:"required"`
+	// Settings is the content of the settings file
+	Settings string `json:"settings" binding:"required"`
+	// Replace drops the current rules instead of adding the imported ones to them
+	Replace bool `json:"replace"`
+	// DryRun previews the resulting policy without saving it
+	DryRun bool `json:"dry_run"`
+}
+
+// PermissionPolicyImportResponse previews or reports a policy import
+type PermissionPolicyImportResponse struct {
+	// Imported are the rules converted from the settings
+	Imported []permission.PolicyRule `json:"imported"`
+	// Added and Removed are the changes to the current policy
+	Added    []permission.PolicyRule `json:"added"`
+	Removed  []permission.PolicyRule `json:"removed"`
+	Warnings []string                `json:"warnings"`
+	// Rules is the resulting policy
+	Rules   []permission.PolicyRule `json:"rules"`
+	Applied bool                    `json:"applied"`
+}
+
+// ShadowPolicyRequest starts a shadow mode trial of candidate policy rules
+type ShadowPolicyRequest struct {
+	Rules []permission.PolicyRule `json:"rules"`
+	// Duration of the trial, e.g. "72h"; defaults to 7 days, at most 30 days
+	Duration string `json:"duration"`
+}
+
+// ShadowPolicyResponse represents the candidate policy trialed in shadow mode
+type ShadowPolicyResponse struct {
+	Rules     []permission.PolicyRule `json:"rules"`
+	StartedAt int64                   `json:"started_at"`
+	Until     int64                   `json:"until"`
+	Active    bool                    `json:"active"` // False once the trial period ended
+}
+
+// ShadowDecisionCountResponse counts the requests per pair of decisions
+type ShadowDecisionCountResponse struct {
+	Actual string `json:"actual"` // allow, deny or ask by the enforced policy
+	Shadow string `json:"shadow"` // allow, deny or ask by the shadow policy
+	Count  int64  `json:"count"`
+}
+
+// ShadowMismatchResponse is a request the shadow policy would have decided differently
+type ShadowMismatchResponse struct {
+	SessionID  string `json:"session_id"`
+	ToolName   string `json:"tool_name"`
+	Subject    string `json:"subject"`
+	Actual     string `json:"actual"`
+	Shadow     string `json:"shadow"`
+	ActualRule string `json:"actual_rule,omitempty"`
+	ShadowRule string `json:"shadow_rule,omitempty"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// ShadowReportResponse compares the decisions of the enforced and shadow policies
+type ShadowReportResponse struct {
+	Policy *ShadowPolicyResponse `json:"policy"` // Null when no trial was started
+	Total  int64                 `json:"total"`
+	Agreed int64                 `json:"agreed"`
+	// WouldDeny counts the requests a rollout of the shadow policy would block
+	WouldDeny  int64                         `json:"would_deny"`
+	WouldAllow int64                         `json:"would_allow"`
+	WouldAsk   int64                         `json:"would_ask"`
+	Counts     []ShadowDecisionCountResponse `json:"counts"`
+	Mismatches []ShadowMismatchResponse      `json:"mismatches"` // Latest first
+}
+
+// CleanSandboxOrphansRequest deletes orphaned sandbox containers
+type CleanSandboxOrphansRequest struct {
+	// ContainerIDs are the orphaned containers to delete, all of them when empty
+	ContainerIDs []string `json:"container_ids"`
+}
+
+// CleanSandboxOrphansResponse reports the deleted sandbox containers
+type CleanSandboxOrphansResponse struct {
+	Cleaned []string `json:"cleaned"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// RedisOrphansResponse reports the Redis keys left behind by deleted sessions
+type RedisOrphansResponse struct {
+	// Sessions is how many sessions have keys in Redis
+	Sessions     int           `json:"sessions"`
+	OrphanedKeys int           `json:"orphaned_keys"`
+	Orphans      []RedisOrphan `json:"orphans"`
+}
+
+// RedisOrphan counts the keys of a session missing from the database
+type RedisOrphan struct {
+	SessionID string `json:"session_id"`
+	Keys      int    `json:"keys"`
+}
+
+// AuditEventResponse represents an audit log entry of a session
+type AuditEventResponse struct {
+	ID        string          `json:"id"`
+	SessionID string          `json:"session_id"`
+	MessageID string          `json:"message_id,omitempty"`
+	Category  string          `json:"category"`
+	Action    string          `json:"action"`
+	Detail    json.RawMessage `json:"detail"`
+	CreatedAt int64           `json:"created_at"`
+}
+
+// AccountExportResponse represents an export job of the current user's data
+type AccountExportResponse struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"` // pending, running, completed, failed
+	Size        int64  `json:"size,omitempty"`
+	Error       string `json:"error,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	CompletedAt int64  `json:"completed_at,omitempty"`
+}
+
+// BulkSessionFilter selects the top-level sessions of the current user,
+// empty fields match every session
+type BulkSessionFilter struct {
+	ProjectID     string `json:"project_id,omitempty"`
+	Archived      string `json:"archived,omitempty"` // archived, active or empty for both
+	Tag           string `json:"tag,omitempty"`
+	Query         string `json:"query,omitempty"` // Case-insensitive match on the titles
+	CreatedAfter  int64  `json:"created_after,omitempty"`
+	CreatedBefore int64  `json:"created_before,omitempty"`
+}
+
+// BulkSessionRequest archives, deletes or tags either the listed sessions or
+// the ones matching the filter
+type BulkSessionRequest struct {
+	Action     string             `json:"action" binding:"required"` // archive, delete, tag
+	SessionIDs []string           `json:"session_ids,omitempty"`
+	Filter     *BulkSessionFilter `json:"filter,omitempty"`
+	Tags       []string           `json:"tags,omitempty"` // Added by the tag action
+}
+
+// BulkSessionJobResponse represents a bulk session job with its progress
+type BulkSessionJobResponse struct {
+	ID          string                `json:"id"`
+	Action      string                `json:"action"`
+	Status      string                `json:"status"` // pending, running, completed, failed
+	Total       int                   `json:"total"`
+	Processed   int                   `json:"processed"`
+	Failed      int                   `json:"failed"`
+	Failures    []account.BulkFailure `json:"failures,omitempty"`
+	Error       string                `json:"error,omitempty"`
+	CreatedAt   int64                 `json:"created_at"`
+	CompletedAt int64                 `json:"completed_at,omitempty"`
+}
+
+// CreateUploadRequest starts a resumable upload
+type CreateUploadRequest struct {
+	Filename string `json:"filename" binding:"required"`
+	MimeType string `json:"mime_type" binding:"required"`
+	Size     int64  `json:"size" binding:"required"` // File size in bytes
+}
+
+// UploadResponse represents a resumable upload of the current user
+type UploadResponse struct {
+	ID          string `json:"id"`
+	URL         string `json:"url,omitempty"` // crush:// URL for message attachments, once completed
+	Filename    string `json:"filename"`
+	MimeType    string `json:"mime_type"`
+	Size        int64  `json:"size"`
+	ChunkSize   int64  `json:"chunk_size"` // Size of every chunk but the last
+	Received    int64  `json:"received"`   // Offset of the next chunk
+	Status      string `json:"status"`     // uploading, completed
+	CreatedAt   int64  `json:"created_at"`
+	CompletedAt int64  `json:"completed_at,omitempty"`
+}
+
+// DeleteAccountRequest confirms the permanent deletion of the current account
+type DeleteAccountRequest struct {
+	Confirm string `json:"confirm" binding:"required"` // Username of the account
+}
+
+// CreateAPITokenRequest represents a request to create a personal access token
+type CreateAPITokenRequest struct {
+	Name      string   `json:"name" binding:"required"`
+	Scopes    []string `json:"scopes" binding:"required"` // read:sessions, write:prompts, admin:project, or read, write, admin
+	ExpiresAt int64    `json:"expires_at"`                // Optional expiry (Unix ms)
+}
+
+// APITokenResponse represents a personal access token in API responses
+type APITokenResponse struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	LastUsedAt int64    `json:"last_used_at,omitempty"`
+	ExpiresAt  int64    `json:"expires_at,omitempty"`
+	RevokedAt  int64    `json:"revoked_at,omitempty"`
+	CreatedAt  int64    `json:"created_at"`
+}
+
+// CreateAPITokenResponse includes the token itself, which is only shown once
+type CreateAPITokenResponse struct {
+	APITokenResponse
+	Token string `json:"token"`
+}
+
 // TodoResponse represents a todo item in API responses
 type TodoResponse struct {
 	Content    string `json:"content"`
@@ -95,10 +598,35 @@ type SessionResponse struct {
 	Cost             float64        `json:"cost"`
 	ContextWindow    int64          `json:"context_window"`
 	Todos            []TodoResponse `json:"todos,omitempty"`
+	ArchivedAt       int64          `json:"archived_at,omitempty"`
+	Tags             []string       `json:"tags,omitempty"`
 	CreatedAt        int64          `json:"created_at"`
 	UpdatedAt        int64          `json:"updated_at"`
 }
 
+// MessageResponse represents a message of a paged session history. Parts
+// holds the typed content parts, e.g. {"type":"tool_call","data":{...}}.
+type MessageResponse struct {
+	ID               string          `json:"id"`
+	SessionID        string          `json:"session_id"`
+	Role             string          `json:"role"`
+	Parts            json.RawMessage `json:"parts"`
+	Model            string          `json:"model,omitempty"`
+	Provider         string          `json:"provider,omitempty"`
+	IsSummaryMessage bool            `json:"is_summary_message"`
+	CreatedAt        int64           `json:"created_at"`
+	UpdatedAt        int64           `json:"updated_at"`
+}
+
+// SessionMessagesPageResponse is a page of the messages of a session, oldest
+// first. FirstID and LastID are the before and after cursors of the next pages.
+type SessionMessagesPageResponse struct {
+	Messages []MessageResponse `json:"messages"`
+	HasMore  bool              `json:"has_more"`
+	FirstID  string            `json:"first_id,omitempty"`
+	LastID   string            `json:"last_id,omitempty"`
+}
+
 // SessionModelConfig represents model configuration for a session
 type SessionModelConfig struct {
 	Provider        string   `json:"provider" binding:"required"`
@@ -146,9 +674,26 @@ type UpdateSessionConfigRequest struct {
 	ReasoningEffort string   `json:"reasoning_effort"`
 }
 
-// ErrorResponse represents an error response
+// ErrorResponse represents an error response. Error is the message for
+// humans, the other fields classify it (see package apierr) and are filled in
+// from the status by errorCodeMiddleware when the handler leaves them unset.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string          `json:"error"`
+	ErrorCode apierr.Code     `json:"error_code,omitempty"`
+	Category  apierr.Category `json:"category,omitempty"`
+	Retryable bool            `json:"retryable,omitempty"`
+	Detail    string          `json:"detail,omitempty"`
+}
+
+// newErrorResponse returns the response of a classified error
+func newErrorResponse(message string, info apierr.Error) ErrorResponse {
+	return ErrorResponse{
+		Error:     message,
+		ErrorCode: info.Code,
+		Category:  info.Category,
+		Retryable: info.Retryable,
+		Detail:    info.Detail,
+	}
 }
 
 // ProviderInfo represents provider information in API responses
@@ -238,3 +783,267 @@ type SessionRunningStatusResponse struct {
 	Status    string `json:"status"`    // "running", "completed", "error", "cancelled", or empty if not found
 	IsRunning bool   `json:"is_running"` // Convenience field for frontend
 }
+
+// ShareSessionRequest asks for a read-only share link of a session
+type ShareSessionRequest struct {
+	// ExpiresIn is how long the link is valid in seconds, 24 hours by default and up to 30 days
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// ShareSessionResponse is a read-only share link of a session
+type ShareSessionResponse struct {
+	Token string `json:"token"`
+	// Path is the API path of the shared session, also followed by /export and /events
+	Path      string `json:"path"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// SharedSessionResponse describes a session opened from a share link
+type SharedSessionResponse struct {
+	SessionID    string `json:"session_id"`
+	Title        string `json:"title"`
+	MessageCount int64  `json:"message_count"`
+	Status       string `json:"status"`
+	IsRunning    bool   `json:"is_running"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// SessionQueueResponse lists the prompts queued behind the running turn of a session
+type SessionQueueResponse struct {
+	SessionID string                    `json:"session_id"`
+	Prompts   []storeredis.QueuedPrompt `json:"prompts"`
+	Count     int                       `json:"count"`
+}
+
+// ReorderQueueRequest sets the order of the queued prompts of a session.
+// Listed prompts move to the front, the others keep their order after them.
+type ReorderQueueRequest struct {
+	PromptIDs []string `json:"prompt_ids" binding:"required"`
+}
+
+// ConfigImportResponse describes the result of importing a config bundle
+type ConfigImportResponse struct {
+	DryRun  bool                  `json:"dry_run"`
+	Applied bool                  `json:"applied"`
+	Changes []config.ConfigChange `json:"changes"`
+	// RestartRequired lists changed settings that only take effect after a restart
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// AdminOverviewResponse aggregates the activity and health of the deployment
+type AdminOverviewResponse struct {
+	GeneratedAt int64 `json:"generated_at"`
+	// ActiveRuns and ConnectedSessions are nil when Redis is unavailable
+	ActiveRuns        *int                       `json:"active_runs"`
+	ConnectedSessions *int                       `json:"connected_sessions"`
+	Health            map[string]ComponentHealth `json:"health"`
+	// Today counts the turns since midnight UTC, LastHour the last hour in 5 minute buckets
+	Today       UsageSummary      `json:"today"`
+	LastHour    UsageSummary      `json:"last_hour"`
+	TopSessions []TopSessionUsage `json:"top_sessions"`
+	// Errors lists the parts of the overview that could not be computed
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ComponentHealth is the result of probing a dependency of the deployment
+type ComponentHealth struct {
+	Status    string `json:"status"` // "ok", "down" or "disabled"
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// UsageSummary sums the agent turns of a period
+type UsageSummary struct {
+	Turns        int64   `json:"turns"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	Cost         float64 `json:"cost"`
+	FeedbackUp   int64   `json:"feedback_up"`
+	FeedbackDown int64   `json:"feedback_down"`
+}
+
+// TopSessionUsage is the usage of one of the most expensive sessions of the day
+type TopSessionUsage struct {
+	SessionID string  `json:"session_id"`
+	Title     string  `json:"title"`
+	ProjectID string  `json:"project_id,omitempty"`
+	Turns     int64   `json:"turns"`
+	Cost      float64 `json:"cost"`
+}
+
+// AdminLogsResponse holds recent log records, oldest first
+type AdminLogsResponse struct {
+	Entries []log.Entry `json:"entries"`
+}
+
+// ProjectMemoryRequest adds a note to the memory of a project
+type ProjectMemoryRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// MessageFeedbackRequest rates an answer of the agent
+type MessageFeedbackRequest struct {
+	Rating   string `json:"rating" binding:"required"` // "up" or "down"
+	Category string `json:"category"`                  // Reason of the rating, e.g. "incorrect"
+	Comment  string `json:"comment"`
+}
+
+// SecretRequest sets the value of a secret, which is never returned
+type SecretRequest struct {
+	Value string `json:"value" binding:"required"`
+}
+
+// BudgetRequest sets the limits of a budget, 0 means unlimited
+type BudgetRequest struct {
+	MaxCost   float64 `json:"max_cost"`
+	MaxTokens int64   `json:"max_tokens"`
+}
+
+// SessionBudgetResponse holds the budgets bounding a session with their usage
+type SessionBudgetResponse struct {
+	SessionID string          `json:"session_id"`
+	Budgets   []budget.Status `json:"budgets"`
+	Exceeded  bool            `json:"exceeded"`
+}
+
+// SessionDiagnosticsResponse holds the current LSP diagnostics of the files
+// the agent edited in a session
+type SessionDiagnosticsResponse struct {
+	SessionID string `json:"session_id"`
+	diagnostics.Summary
+}
+
+// AutoFixRequest configures the follow-up prompts fixing the errors introduced
+// by the agent in a session, 0 iterations select the default
+type AutoFixRequest struct {
+	Enabled       bool `json:"enabled"`
+	MaxIterations int  `json:"max_iterations" binding:"min=0,max=10"`
+}
+
+// AutoFixResponse holds the auto-fix settings of a session
+type AutoFixResponse struct {
+	SessionID     string `json:"session_id"`
+	Enabled       bool   `json:"enabled"`
+	MaxIterations int    `json:"max_iterations"`
+}
+
+// BusyPolicyRequest sets what a prompt sent while the session is busy does:
+// "queue", "reject" or "interrupt"
+type BusyPolicyRequest struct {
+	Policy string `json:"policy" binding:"required,oneof=queue reject interrupt"`
+}
+
+// BusyPolicyResponse holds the busy policy of a session
+type BusyPolicyResponse struct {
+	SessionID string `json:"session_id"`
+	Policy    string `json:"policy"`
+}
+
+// SessionEnvRequest replaces the environment variables of the tools of a
+// session, an empty env clears them
+type SessionEnvRequest struct {
+	Env map[string]string `json:"env"`
+}
+
+// SessionEnvResponse holds the environment variables of the tools of a session
+type SessionEnvResponse struct {
+	SessionID string            `json:"session_id"`
+	Env       map[string]string `json:"env"`
+}
+
+// WorkspaceSnapshotResponse represents an archive of the workspace of a project
+type WorkspaceSnapshotResponse struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	SessionID string `json:"session_id,omitempty"`
+	Reason    string `json:"reason"` // manual, run or restore
+	Size      int64  `json:"size"`
+	CreatedBy string `json:"created_by,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// RestoreWorkspaceSnapshotResponse reports a restored snapshot with the
+// snapshot of the workspace taken before, restoring it undoes the restore
+type RestoreWorkspaceSnapshotResponse struct {
+	Restored WorkspaceSnapshotResponse `json:"restored"`
+	Previous WorkspaceSnapshotResponse `json:"previous"`
+}
+
+// FileVersionResponse represents a version of a file recorded in a session
+type FileVersionResponse struct {
+	ID        string `json:"id"`
+	Version   int64  `json:"version"`
+	Size      int    `json:"size"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// FileHistoryResponse lists the versions of a file recorded in a session,
+// oldest first
+type FileHistoryResponse struct {
+	Path     string                `json:"path"`
+	Versions []FileVersionResponse `json:"versions"`
+}
+
+// FileDiffResponse holds the unified diff between two versions of a file
+type FileDiffResponse struct {
+	Path      string `json:"path"`
+	From      int64  `json:"from"` // -1 when diffing from an empty file
+	To        int64  `json:"to"`
+	Diff      string `json:"diff"`
+	Additions int    `json:"additions"`
+	Removals  int    `json:"removals"`
+}
+
+// RevertFileRequest reverts a file of a session to one of its versions
+type RevertFileRequest struct {
+	Path    string `json:"path" binding:"required"`
+	Version *int64 `json:"version" binding:"required"`
+}
+
+// RevertFileResponse reports a revert waiting for the permission of the
+// session's clients, the outcome is sent as a file_revert event with its ID
+type RevertFileResponse struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Version int64  `json:"version"`
+	Status  string `json:"status"` // pending
+}
+
+// CreatePlanRequest runs a prompt in plan mode, the agent only reads the
+// workspace and answers with the changes it would make
+type CreatePlanRequest struct {
+	Prompt string `json:"prompt" binding:"required"`
+	Agent  string `json:"agent"` // Empty runs the prompt with the coder
+}
+
+// PlanRunResponse represents a prompt run in plan mode and, once done, its plan
+type PlanRunResponse struct {
+	ID          string `json:"id"`
+	SessionID   string `json:"session_id"`
+	Status      string `json:"status"` // pending, running, done or failed
+	Plan        string `json:"plan,omitempty"`
+	Error       string `json:"error,omitempty"`
+	RequestedAt int64  `json:"requested_at"`
+	FinishedAt  int64  `json:"finished_at,omitempty"`
+}
+
+// RedisHealthResponse is the health of the Redis deployment
+type RedisHealthResponse struct {
+	Mode      string            `json:"mode"`   // standalone, sentinel or cluster
+	Status    string            `json:"status"` // "ok", "degraded", "down" or "disabled"
+	LatencyMs int64             `json:"latency_ms"`
+	Error     string            `json:"error,omitempty"`
+	Nodes     []RedisNodeHealth `json:"nodes"`
+}
+
+// RedisNodeHealth is the health of a Redis node
+type RedisNodeHealth struct {
+	Addr      string `json:"addr"`
+	Role      string `json:"role"` // master, replica or sentinel
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	Master    string `json:"master,omitempty"` // Master address reported by a sentinel
+}
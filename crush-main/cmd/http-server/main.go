@@ -11,7 +11,9 @@ import (
 	"syscall"
 
 	httpapp "github.com/rolling1314/rolling-crush/cmd/http-server/app"
+	"github.com/rolling1314/rolling-crush/internal/event"
 	"github.com/rolling1314/rolling-crush/internal/shared"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
 )
 
 func main() {
@@ -25,7 +27,6 @@ func main() {
 		}()
 	}
 
-	fmt.Println()
 	slog.Info("Starting Crush HTTP API Server")
 
 	ctx := context.Background()
@@ -36,25 +37,33 @@ func main() {
 		DataDir:    os.Getenv("CRUSH_DATA_DIR"), // Optional: override data directory
 		Debug:      false,
 		Yolo:       false,
+		Replica:    true,
+		Service:    "crush-http",
 	})
 	if err != nil {
 		slog.Error("Failed to initialize", "error", err)
-		fmt.Printf("ERROR: Failed to initialize: %v\n", err) // Print to stdout for visibility
 		os.Exit(1)
 	}
+	defer tracing.Shutdown(context.Background())
 
 	// Get server configuration from config.yaml
 	serverCfg := shared.GetServerConfig()
 
 	// Create HTTP application
-	httpApp, err := httpapp.NewHTTPApp(ctx, initResult.DB, initResult.Config, serverCfg.HTTPPort)
+	httpApp, err := httpapp.NewHTTPApp(ctx, initResult.DB, initResult.ReplicaDB, initResult.Config, initResult.Secrets, serverCfg.HTTPPort)
 	if err != nil {
 		slog.Error("Failed to create HTTP app", "error", err)
-		fmt.Printf("ERROR: Failed to create HTTP app: %v\n", err) // Print to stdout for visibility
 		os.Exit(1)
 	}
 	defer httpApp.Shutdown()
 
+	// Initialize event tracking if metrics are enabled, e.g. for the ratings
+	// of the answers
+	if !initResult.Config.Options.DisableMetrics {
+		event.Init()
+		defer event.Flush()
+	}
+
 	// Start HTTP server in a goroutine
 	go func() {
 		slog.Info("HTTP Server starting", "port", serverCfg.HTTPPort)
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	wsapp "github.com/rolling1314/rolling-crush/cmd/ws-server/app"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/agent/synthetic"
+	"github.com/rolling1314/rolling-crush/internal/shared"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// loadtestProviderID is the provider injected by loadtest when --synthetic is set.
+const loadtestProviderID = "loadtest-synthetic"
+
+var loadtestCmd = &cobra.Command{
+	Use:   "loadtest",
+	Short: "Drive concurrent fake sessions to size the deployment",
+	Long: `Run N concurrent sessions through the agent worker pool, Redis and Postgres,
+and report latency and throughput.
+
+By default the configured models are replaced with an in-process synthetic
+provider that streams generated tokens at the given rate, so no real API is
+called. Use --synthetic=false to load test the configured providers instead.
+Permissions are always granted.`,
+	Example: `
+# 50 sessions sending 3 prompts each
+crush loadtest --sessions 50 --prompts 3
+
+# Slow streams with two tool calls per turn
+crush loadtest --sessions 20 --tokens-per-second 20 --tool-calls 2 --tool-pattern ls,view
+  `,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		debug, _ := cmd.Flags().GetBool("debug")
+		dataDir, _ := cmd.Flags().GetString("data-dir")
+		sessions, _ := cmd.Flags().GetInt("sessions")
+		prompts, _ := cmd.Flags().GetInt("prompts")
+		prompt, _ := cmd.Flags().GetString("prompt")
+		useSynthetic, _ := cmd.Flags().GetBool("synthetic")
+
+		if sessions < 1 || prompts < 1 {
+			return fmt.Errorf("--sessions and --prompts must be at least 1")
+		}
+
+		cwd, err := ResolveCwd(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+
+		initResult, err := shared.Initialize(ctx, shared.InitOptions{
+			WorkingDir: cwd,
+			DataDir:    dataDir,
+			Debug:      debug,
+			Yolo:       true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if useSynthetic {
+			configureSyntheticProvider(cmd, initResult.Config)
+		}
+
+		wsApp, err := wsapp.NewWSApp(ctx, initResult.DB, initResult.Config, initResult.Secrets)
+		if err != nil {
+			return err
+		}
+		defer wsApp.Shutdown()
+
+		if !wsApp.Config().IsConfigured() {
+			return fmt.Errorf("no providers configured - please set up providers first")
+		}
+		if wsApp.AgentCoordinator == nil {
+			return fmt.Errorf("agent coordinator not initialized")
+		}
+
+		result := runLoadTest(ctx, wsApp, sessions, prompts, prompt)
+		result.print(os.Stdout)
+		if wsApp.AgentWorkerPool != nil {
+			stats := wsApp.AgentWorkerPool.Stats()
+			fmt.Fprintf(os.Stdout, "pool:       completed=%d failed=%d preempted=%d\n",
+				stats.CompletedTasks, stats.FailedTasks, stats.PreemptedTasks)
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := loadtestCmd.Flags()
+	flags.Int("sessions", 10, "Number of concurrent sessions")
+	flags.Int("prompts", 1, "Prompts sent sequentially in each session")
+	flags.String("prompt", "List the files of this project and summarize them", "Prompt sent to every session")
+	flags.Bool("synthetic", true, "Use the synthetic provider instead of the configured models")
+
+	defaults := synthetic.DefaultOptions()
+	flags.Float64("tokens-per-second", defaults.TokensPerSecond, "Synthetic streaming rate")
+	flags.Int("output-tokens", defaults.OutputTokens, "Synthetic answer length in tokens")
+	flags.Duration("first-token-latency", defaults.FirstTokenLatency, "Synthetic delay before the first token")
+	flags.Int("tool-calls", defaults.ToolCallsPerTurn, "Synthetic tool calls per turn")
+	flags.String("tool-pattern", strings.Join(defaults.ToolPattern, ","), "Tools called in turn by the synthetic model")
+	flags.Float64("error-rate", defaults.ErrorRate, "Probability (0-1) that a synthetic call fails")
+}
+
+// configureSyntheticProvider adds a synthetic provider built from the flags
+// and selects it for every model slot.
+func configureSyntheticProvider(cmd *cobra.Command, cfg *config.Config) {
+	flags := cmd.Flags()
+	tokensPerSecond, _ := flags.GetFloat64("tokens-per-second")
+	outputTokens, _ := flags.GetInt("output-tokens")
+	firstTokenLatency, _ := flags.GetDuration("first-token-latency")
+	toolCalls, _ := flags.GetInt("tool-calls")
+	toolPattern, _ := flags.GetString("tool-pattern")
+	errorRate, _ := flags.GetFloat64("error-rate")
+
+	model := catwalk.Model{
+		ID:               "synthetic-model",
+		Name:             "Synthetic",
+		ContextWindow:    200000,
+		DefaultMaxTokens: 8192,
+	}
+	cfg.Providers.Set(loadtestProviderID, config.ProviderConfig{
+		ID:   loadtestProviderID,
+		Name: "Load test",
+		Type: config.ProviderTypeSynthetic,
+		ProviderOptions: map[string]any{
+			"tokens_per_second":      tokensPerSecond,
+			"output_tokens":          outputTokens,
+			"first_token_latency_ms": firstTokenLatency.Milliseconds(),
+			"tool_calls_per_turn":    toolCalls,
+			"tool_pattern":           toolPattern,
+			"error_rate":             errorRate,
+		},
+		Models: []catwalk.Model{model},
+	})
+
+	if cfg.Models == nil {
+		cfg.Models = make(map[config.SelectedModelType]config.SelectedModel)
+	}
+	for _, modelType := range []config.SelectedModelType{
+		config.SelectedModelTypeLarge,
+		config.SelectedModelTypeSmall,
+		config.SelectedModelTypeTitle,
+		config.SelectedModelTypeSummary,
+	} {
+		cfg.Models[modelType] = config.SelectedModel{Model: model.ID, Provider: loadtestProviderID}
+	}
+}
+
+// loadTestResult aggregates the outcome of every prompt of a load test.
+type loadTestResult struct {
+	elapsed   time.Duration
+	latencies []time.Duration
+	failures  map[string]int
+}
+
+// runLoadTest creates the sessions and sends their prompts concurrently,
+// through the worker pool when there is one.
+func runLoadTest(ctx context.Context, app *wsapp.WSApp, sessions, prompts int, prompt string) *loadTestResult {
+	result := &loadTestResult{failures: make(map[string]int)}
+	var mu sync.Mutex
+	record := func(latency time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			result.failures[err.Error()]++
+			return
+		}
+		result.latencies = append(result.latencies, latency)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sess, err := app.Sessions.Create(ctx, "", fmt.Sprintf("Load test %d", i+1))
+			if err != nil {
+				record(0, fmt.Errorf("create session: %w", err))
+				return
+			}
+			for range prompts {
+				if ctx.Err() != nil {
+					return
+				}
+				promptStart := time.Now()
+				err := runLoadTestPrompt(ctx, app, sess.ID, prompt)
+				record(time.Since(promptStart), err)
+			}
+		}()
+	}
+	wg.Wait()
+	result.elapsed = time.Since(start)
+	return result
+}
+
+// runLoadTestPrompt sends one prompt and waits for the agent to finish.
+func runLoadTestPrompt(ctx context.Context, app *wsapp.WSApp, sessionID, prompt string) error {
+	if app.AgentWorkerPool == nil {
+		_, err := app.AgentCoordinator.Run(ctx, sessionID, prompt)
+		return err
+	}
+
+	resultChan := make(chan agent.AgentTaskResult, 1)
+	err := app.AgentWorkerPool.Submit(ctx, agent.AgentTask{
+		SessionID:  sessionID,
+		Prompt:     prompt,
+		ResultChan: resultChan,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case result := <-resultChan:
+		return result.Error
+	}
+}
+
+func (r *loadTestResult) print(w io.Writer) {
+	failed := 0
+	for _, count := range r.failures {
+		failed += count
+	}
+	total := len(r.latencies) + failed
+
+	fmt.Fprintf(w, "prompts:    %d (%d failed)\n", total, failed)
+	fmt.Fprintf(w, "elapsed:    %s\n", r.elapsed.Round(time.Millisecond))
+	if r.elapsed > 0 {
+		fmt.Fprintf(w, "throughput: %.2f prompts/s\n", float64(len(r.latencies))/r.elapsed.Seconds())
+	}
+	if len(r.latencies) > 0 {
+		slices.Sort(r.latencies)
+		fmt.Fprintf(w, "latency:    p50=%s p95=%s p99=%s max=%s\n",
+			percentile(r.latencies, 50),
+			percentile(r.latencies, 95),
+			percentile(r.latencies, 99),
+			r.latencies[len(r.latencies)-1].Round(time.Millisecond),
+		)
+	}
+	for msg, count := range r.failures {
+		fmt.Fprintf(w, "error:      %dx %s\n", count, msg)
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	idx := (len(sorted)*p + 99) / 100
+	idx = min(max(idx-1, 0), len(sorted)-1)
+	return sorted[idx].Round(time.Millisecond)
+}
@@ -26,10 +26,12 @@ func init() {
 
 	rootCmd.AddCommand(
 		runCmd,
+		loadtestCmd,
 		dirsCmd,
 		updateProvidersCmd,
 		logsCmd,
 		schemaCmd,
+		syncCmd,
 	)
 }
 
@@ -54,6 +56,12 @@ crush schema     # Show configuration schema
 
 # Run a single non-interactive prompt (requires WebSocket server)
 crush run "Explain the use of context in Go"
+
+# Load test the agent stack with synthetic sessions
+crush loadtest --sessions 50
+
+# Apply the agent edits of a project to the local checkout
+crush sync --server https://crush.example.com --project 42
   `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// If no subcommand is provided, show help
@@ -54,7 +54,7 @@ crush run --quiet "Generate a README for this project"
 		}
 
 		// Create WebSocket application for non-interactive mode
-		wsApp, err := wsapp.NewWSApp(ctx, initResult.DB, initResult.Config)
+		wsApp, err := wsapp.NewWSApp(ctx, initResult.DB, initResult.Config, initResult.Secrets)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// syncWaitSeconds is the long poll of each change feed request.
+	syncWaitSeconds = 30
+	// syncRetryDelay is the pause after a failed change feed request.
+	syncRetryDelay = 5 * time.Second
+	// syncConflictSuffix names the file holding the remote content of a conflict.
+	syncConflictSuffix = ".crush-remote"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Apply the agent edits of a project to a local checkout",
+	Long: `Follow the file changes the agent makes in a project sandbox and apply them
+to a local checkout as they happen, so local editors and IDEs see them.
+
+An edit is only applied when the local file still has the content the edit
+was made against. Otherwise the local file is kept, the remote content is
+written next to it with a .crush-remote suffix and the conflict is reported.
+
+The position in the change feed is saved in .crush/ of the checkout, a
+restarted sync resumes where it stopped.`,
+	Example: `
+# Follow a project from the current checkout
+crush sync --server https://crush.example.com --token $CRUSH_API_TOKEN --project 42
+
+# Apply the pending edits once and exit
+crush sync --project 42 --once
+
+# Print the pending edits as a patch bundle for git apply
+crush sync --project 42 --patch | git apply
+  `,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server, _ := cmd.Flags().GetString("server")
+		token, _ := cmd.Flags().GetString("token")
+		projectID, _ := cmd.Flags().GetString("project")
+		fromStart, _ := cmd.Flags().GetBool("from-start")
+		once, _ := cmd.Flags().GetBool("once")
+		patch, _ := cmd.Flags().GetBool("patch")
+
+		server = cmp.Or(server, os.Getenv("CRUSH_SERVER_URL"))
+		token = cmp.Or(token, os.Getenv("CRUSH_API_TOKEN"))
+		if server == "" || token == "" || projectID == "" {
+			return fmt.Errorf("--server, --token and --project are required")
+		}
+
+		dir, err := ResolveCwd(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		client := &syncClient{
+			server:    strings.TrimRight(server, "/"),
+			token:     token,
+			projectID: projectID,
+			http:      &http.Client{Timeout: (syncWaitSeconds + 30) * time.Second},
+		}
+		cursorFile := filepath.Join(dir, ".crush", "sync-"+projectID+".cursor")
+		cursor, err := readSyncCursor(cursorFile)
+		if err != nil {
+			return err
+		}
+		if cursor == "" && !fromStart {
+			cursor = history.SyncCursorLatest
+		}
+
+		if patch {
+			if cursor == history.SyncCursorLatest {
+				cursor = ""
+			}
+			return client.patch(ctx, cursor, cmd.OutOrStdout())
+		}
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Syncing project %s into %s\n", projectID, dir)
+		for {
+			wait := syncWaitSeconds
+			if once {
+				wait = 0
+			}
+			page, err := client.changes(ctx, cursor, wait)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				if once {
+					return err
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "Sync failed, retrying: %v\n", err)
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(syncRetryDelay):
+				}
+				continue
+			}
+
+			for _, change := range page.Changes {
+				result, err := applySyncChange(dir, change)
+				if err != nil {
+					return fmt.Errorf("failed to apply %s: %w", change.Path, err)
+				}
+				printSyncResult(out, change, result)
+			}
+			if page.Cursor != cursor {
+				cursor = page.Cursor
+				if err := writeSyncCursor(cursorFile, cursor); err != nil {
+					return err
+				}
+			}
+			if once && !page.HasMore {
+				return nil
+			}
+		}
+	},
+}
+
+func init() {
+	syncCmd.Flags().String("server", "", "URL of the Crush HTTP server (default $CRUSH_SERVER_URL)")
+	syncCmd.Flags().String("token", "", "Personal access token with the sessions:read scope (default $CRUSH_API_TOKEN)")
+	syncCmd.Flags().String("project", "", "ID of the project to sync")
+	syncCmd.Flags().Bool("from-start", false, "Replay every edit of the project instead of only new ones")
+	syncCmd.Flags().Bool("once", false, "Apply the pending edits and exit")
+	syncCmd.Flags().Bool("patch", false, "Print the pending edits as a patch bundle and exit")
+}
+
+// syncResult is the outcome of applying a change to the local checkout.
+type syncResult int
+
+const (
+	syncApplied syncResult = iota
+	// syncUpToDate means the local file already has the edited content.
+	syncUpToDate
+	// syncConflict means the local file changed since the edit's base content.
+	syncConflict
+)
+
+// applySyncChange writes an edit to the checkout at root. The local file must
+// have the base content of the edit, a missing file counting as empty;
+// otherwise the remote content is written next to it and a conflict reported.
+func applySyncChange(root string, change history.SyncChange) (syncResult, error) {
+	rel := filepath.FromSlash(change.Path)
+	if !filepath.IsLocal(rel) {
+		return 0, fmt.Errorf("path escapes the checkout")
+	}
+	target := filepath.Join(root, rel)
+
+	local, err := os.ReadFile(target)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	switch history.ContentSHA256(string(local)) {
+	case change.SHA256:
+		return syncUpToDate, nil
+	case change.BaseSHA256:
+		return syncApplied, writeSyncFile(target, change.Content)
+	default:
+		return syncConflict, writeSyncFile(target+syncConflictSuffix, change.Content)
+	}
+}
+
+func writeSyncFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(path, []byte(content), mode)
+}
+
+func printSyncResult(w io.Writer, change history.SyncChange, result syncResult) {
+	switch result {
+	case syncApplied:
+		fmt.Fprintf(w, "applied   %s (v%d)\n", change.Path, change.Version)
+	case syncUpToDate:
+		fmt.Fprintf(w, "unchanged %s (v%d)\n", change.Path, change.Version)
+	case syncConflict:
+		fmt.Fprintf(w, "CONFLICT  %s (v%d): local changes kept, remote content in %s%s\n",
+			change.Path, change.Version, change.Path, syncConflictSuffix)
+	}
+}
+
+func readSyncCursor(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read sync cursor: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func writeSyncCursor(path, cursor string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to save sync cursor: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(cursor+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to save sync cursor: %w", err)
+	}
+	return nil
+}
+
+// syncClient reads the change feed of a project from the HTTP server.
+type syncClient struct {
+	server    string
+	token     string
+	projectID string
+	http      *http.Client
+}
+
+// syncPage is a page of the change feed.
+type syncPage struct {
+	Cursor  string               `json:"cursor"`
+	Changes []history.SyncChange `json:"changes"`
+	HasMore bool                 `json:"has_more"`
+}
+
+func (c *syncClient) changes(ctx context.Context, cursor string, wait int) (*syncPage, error) {
+	query := url.Values{}
+	query.Set("cursor", cursor)
+	query.Set("wait", fmt.Sprint(wait))
+	resp, err := c.get(ctx, "/sync/changes", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var page syncPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("invalid change feed response: %w", err)
+	}
+	return &page, nil
+}
+
+func (c *syncClient) patch(ctx context.Context, cursor string, w io.Writer) error {
+	query := url.Values{}
+	query.Set("cursor", cursor)
+	resp, err := c.get(ctx, "/sync/patch", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return err
+	}
+	if resp.Header.Get("X-Sync-Has-More") == "true" {
+		fmt.Fprintln(os.Stderr, "The patch is truncated, apply it and sync again for the remaining edits")
+	}
+	return nil
+}
+
+func (c *syncClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	endpoint := c.server + "/api/projects/" + url.PathEscape(c.projectID) + path + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return nil, fmt.Errorf("server returned %s: %s", resp.Status, body.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/stretchr/testify/require"
+)
+
+func syncChange(path, base, content string) history.SyncChange {
+	return history.SyncChange{
+		Path:       path,
+		Version:    1,
+		BaseSHA256: history.ContentSHA256(base),
+		SHA256:     history.ContentSHA256(content),
+		Content:    content,
+	}
+}
+
+func TestApplySyncChange(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "main.go")
+	require.NoError(t, os.WriteFile(file, []byte("package main\n"), 0o600))
+
+	result, err := applySyncChange(root, syncChange("main.go", "package main\n", "package main\n\nfunc main() {}\n"))
+	require.NoError(t, err)
+	require.Equal(t, syncApplied, result)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "package main\n\nfunc main() {}\n", string(data))
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// Receiving the same edit again is a no-op
+	result, err = applySyncChange(root, syncChange("main.go", "package main\n", "package main\n\nfunc main() {}\n"))
+	require.NoError(t, err)
+	require.Equal(t, syncUpToDate, result)
+}
+
+func TestApplySyncChangeNewFile(t *testing.T) {
+	root := t.TempDir()
+	result, err := applySyncChange(root, syncChange("pkg/util/util.go", "", "package util\n"))
+	require.NoError(t, err)
+	require.Equal(t, syncApplied, result)
+	data, err := os.ReadFile(filepath.Join(root, "pkg", "util", "util.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package util\n", string(data))
+}
+
+func TestApplySyncChangeConflict(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	require.NoError(t, os.WriteFile(file, []byte("# Local edit\n"), 0o644))
+
+	result, err := applySyncChange(root, syncChange("README.md", "# Project\n", "# Project\n\nRemote edit\n"))
+	require.NoError(t, err)
+	require.Equal(t, syncConflict, result)
+
+	local, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "# Local edit\n", string(local))
+	remote, err := os.ReadFile(file + syncConflictSuffix)
+	require.NoError(t, err)
+	require.Equal(t, "# Project\n\nRemote edit\n", string(remote))
+}
+
+func TestApplySyncChangeRejectsEscapingPaths(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{"../outside.txt", "/etc/passwd"} {
+		_, err := applySyncChange(root, syncChange(path, "", "x"))
+		require.Error(t, err, path)
+	}
+}
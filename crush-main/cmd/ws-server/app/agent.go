@@ -2,7 +2,6 @@ package app
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
 
 	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
@@ -11,7 +10,6 @@ import (
 )
 
 func (app *WSApp) InitCoderAgent(ctx context.Context) error {
-	fmt.Println("=== InitCoderAgent called ===")
 
 	// Ensure agent configuration exists (for Web mode)
 	if app.config.Agents == nil {
@@ -20,7 +18,7 @@ func (app *WSApp) InitCoderAgent(ctx context.Context) error {
 
 	coderAgentCfg, ok := app.config.Agents[config.AgentCoder]
 	if !ok || coderAgentCfg.ID == "" {
-		fmt.Println("No coder agent config found, creating default config")
+		slog.Info("No coder agent config found, creating default config")
 		// Create a default coder agent config for Web mode
 		coderAgentCfg = config.Agent{
 			ID:    config.AgentCoder,
@@ -32,27 +30,35 @@ func (app *WSApp) InitCoderAgent(ctx context.Context) error {
 				"bash",
 				"job_output",
 				"job_kill",
+				"git_status",
+				"git_diff",
+				"git_commit",
+				"git_branch",
+				"git_checkout",
 				"download",
 				"edit",
 				"multi_edit",
+				"apply_patch",
 				"fetch",
 				"glob",
 				"grep",
 				"ls",
 				"sourcegraph",
+				"code_search",
 				"view",
 				"write",
 				"diagnostics",
 				"references",
+				"rename_symbol",
 				"todos",
+				"memory",
 			},
 		}
 		app.config.Agents[config.AgentCoder] = coderAgentCfg
-		fmt.Println("Default coder agent config created")
 	}
 
 	var err error
-	fmt.Println("Creating coordinator with dbReader:", app.db != nil)
+	slog.Debug("Creating coordinator", "db", app.db != nil)
 
 	// Get Redis command service for real-time tool call state updates
 	var redisCmd *storeredis.CommandService
@@ -73,11 +79,10 @@ func (app *WSApp) InitCoderAgent(ctx context.Context) error {
 		app.db, // Pass DB queries as DBReader for session config loading
 	)
 	if err != nil {
-		fmt.Println("Failed to create coordinator:", err)
 		slog.Error("Failed to create coder agent", "err", err)
 		return err
 	}
-	fmt.Println("Coordinator created successfully")
+	slog.Info("Coordinator created")
 	return nil
 }
 
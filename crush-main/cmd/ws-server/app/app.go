@@ -4,18 +4,25 @@ package app
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	tea "charm.land/bubbletea/v2"
+	"github.com/rolling1314/rolling-crush/auth"
 	"github.com/rolling1314/rolling-crush/cmd/ws-server/handler"
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/budget"
 	"github.com/rolling1314/rolling-crush/domain/history"
 	"github.com/rolling1314/rolling-crush/domain/message"
 	"github.com/rolling1314/rolling-crush/domain/permission"
 	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/domain/secret"
 	"github.com/rolling1314/rolling-crush/domain/session"
+	"github.com/rolling1314/rolling-crush/domain/snapshot"
 	"github.com/rolling1314/rolling-crush/domain/toolcall"
 	"github.com/rolling1314/rolling-crush/domain/user"
 	"github.com/rolling1314/rolling-crush/infra/postgres"
@@ -23,7 +30,10 @@ import (
 	"github.com/rolling1314/rolling-crush/infra/sandbox"
 	"github.com/rolling1314/rolling-crush/infra/storage"
 	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
 	"github.com/rolling1314/rolling-crush/internal/agent/tools/mcp"
+	internalapp "github.com/rolling1314/rolling-crush/internal/app"
+	"github.com/rolling1314/rolling-crush/internal/filewatch"
 	"github.com/rolling1314/rolling-crush/internal/lsp"
 	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
 	"github.com/rolling1314/rolling-crush/internal/pubsub"
@@ -51,6 +61,7 @@ type WSApp struct {
 
 	config *config.Config
 	db     *postgres.Queries // DB queries for session config loading
+	conn   *sql.DB           // Connection the transactions of the app run on
 
 	serviceEventsWG *sync.WaitGroup
 	eventsCtx       context.Context
@@ -63,6 +74,8 @@ type WSApp struct {
 	RedisStream *storeredis.StreamService
 	// Redis command service for tool call state management
 	RedisCmd *storeredis.CommandService
+	// Session ownership registry shared by the WS instances, nil without Redis
+	Ownership SessionOwnership
 
 	// Track the current active session for the single-user mode
 	currentSessionID string
@@ -70,20 +83,57 @@ type WSApp struct {
 	// Track connected sessions (session ID -> connected status)
 	connectedSessions *csync.Map[string, bool]
 
+	// Prompts held back while their project is paused (queue mode)
+	pausedPrompts pausedPrompts
+	// Prompts held while the worker pool is full, see overflow_queue_size
+	overflow overflowPrompts
+	// Session costs at the start of their running turn, for the metrics rollups
+	turnCosts *csync.Map[string, float64]
+	// Reports the file changes of the projects with a running turn, nil when disabled
+	fileWatcher *filewatch.Watcher
+	// Archives the project workspace before each run, nil when disabled
+	snapshots snapshot.Service
+	// Coalesces and numbers the streaming deltas of the messages being generated
+	deltas *deltaStreams
+	// Truncates and masks the parameters of permission requests sent to clients, nil when disabled
+	permissionParams *permission.ParamsRedactor
+	// Sets the secrets of the projects as the environment of their sandbox commands, nil when disabled
+	secrets secret.Service
+	// Set once the instance drains for a restart, drained is closed when done
+	draining atomic.Bool
+	drained  chan struct{}
+
 	// global context and cleanup functions
 	globalCtx    context.Context
 	cleanupFuncs []func() error
 }
 
-// NewWSApp creates a new WebSocket + Agent application instance.
-func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config) (*WSApp, error) {
-	q := postgres.New(conn)
+// NewWSApp creates a new WebSocket + Agent application instance. secrets is
+// the encrypted secrets store, nil when disabled.
+func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config, secrets secret.Service) (*WSApp, error) {
+	q := postgres.New(postgres.WithTracing(conn))
 	sessions := session.NewService(q)
-	messages := message.NewService(q)
-	toolCalls := toolcall.NewService(q)
+
+	// Batch message and tool call writes made while streaming to cut Postgres round trips
+	var streamQ postgres.Querier = q
+	var writeBatcher *postgres.WriteBatcher
+	if appCfg := config.GetGlobalAppConfig(); appCfg == nil || appCfg.Database.WriteBatchInterval >= 0 {
+		interval := postgres.DefaultWriteBatchInterval
+		if appCfg != nil && appCfg.Database.WriteBatchInterval > 0 {
+			interval = time.Duration(appCfg.Database.WriteBatchInterval) * time.Millisecond
+		}
+		writeBatcher = postgres.NewWriteBatcher(conn, q, interval)
+		streamQ = writeBatcher
+	}
+	messages := message.NewService(streamQ)
+	toolCalls := toolcall.NewService(streamQ)
 	files := history.NewService(q, conn)
 	users := user.NewService(q)
 	projects := project.NewService(q)
+
+	// Personal access tokens are resolved by the user service
+	auth.SetAPITokenValidator(users)
+
 	skipPermissionsRequests := cfg.Permissions != nil && cfg.Permissions.SkipRequests
 	allowedTools := []string{}
 	if cfg.Permissions != nil && cfg.Permissions.AllowedTools != nil {
@@ -102,16 +152,46 @@ func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config) (*WSApp, er
 
 		globalCtx: ctx,
 
-		config: cfg,
-		db:     q,
+		config:  cfg,
+		db:      q,
+		conn:    conn,
+		secrets: secrets,
 
 		events:            make(chan tea.Msg, 1000), // Increased buffer for streaming messages
 		serviceEventsWG:   &sync.WaitGroup{},
 		tuiWG:             &sync.WaitGroup{},
 		connectedSessions: csync.NewMap[string, bool](),
+		turnCosts:         csync.NewMap[string, float64](),
+		drained:           make(chan struct{}),
 
 		WSServer: handler.New(),
 	}
+	app.deltas = newDeltaStreams(config.GetGlobalAppConfig(), app.sendStreamDelta)
+
+	// Escalate permission requests that keep a run waiting for too long, and
+	// keep large and secret parameters of the requests off the clients
+	if appCfg := config.GetGlobalAppConfig(); appCfg != nil {
+		app.Permissions.SetBlockingThreshold(time.Duration(appCfg.Agent.PermissionBlockingAfter) * time.Second)
+
+		redactor, err := permission.NewParamsRedactor(permission.RedactOptions{
+			MaxBytes:    appCfg.PermissionParams.MaxBytes,
+			MaskSecrets: appCfg.PermissionParams.MaskSecrets,
+			Patterns:    appCfg.PermissionParams.SecretPatterns,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid permission params config: %w", err)
+		}
+		app.permissionParams = redactor
+	}
+
+	// Apply the rules of the configuration and of the project permission policies
+	if err := app.Permissions.SetBasePolicy(internalapp.PolicyRules(cfg)); err != nil {
+		return nil, fmt.Errorf("invalid permission rules: %w", err)
+	}
+	app.Permissions.SetPolicyChecker(app)
+
+	// Turn counts, failures and costs for the admin overview
+	go app.pruneMetricsRollups(ctx)
 
 	// Initialize Redis client and stream service
 	if err := storeredis.InitGlobalClient(); err != nil {
@@ -129,14 +209,42 @@ func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config) (*WSApp, er
 		}
 	}
 
+	// Route sessions across the WS instances sharing Redis
+	app.startOwnership(ctx)
+
+	// Listen for project maintenance windows started/ended through the HTTP API
+	app.subscribeProjectPauses(ctx)
+
+	// Apply the prompt queue changes made through the HTTP API
+	app.subscribeQueueCommands(ctx)
+
+	// Run prompts triggered by SCM webhooks received by the HTTP API
+	app.subscribeWebhookRuns(ctx)
+
+	// Run the opening prompts of sessions created from a blueprint
+	app.subscribeBlueprintRuns(ctx)
+
+	// Revert files to a version of their history, requested by the HTTP API
+	app.subscribeFileReverts(ctx)
+
+	// Run prompts in plan mode for the HTTP API, with read-only tools
+	app.subscribePlanRuns(ctx)
+
 	// Register the handler for incoming WebSocket messages
 	app.WSServer.SetMessageHandler(app.HandleClientMessage)
-	fmt.Println("=== WebSocket message handler registered ===")
-	fmt.Println("Handler function:", app.HandleClientMessage != nil)
 
 	// Register disconnect handler to clean up agent state when WebSocket disconnects
 	app.WSServer.SetDisconnectHandler(app.HandleClientDisconnect)
 
+	// Register the handler for editor presence of collaborators
+	app.WSServer.SetPresenceHandler(app.HandlePresence)
+
+	// Announce the collaborators joining and leaving sessions
+	app.WSServer.SetAttachHandler(app.HandleAttach)
+
+	// Drain the instance on POST /admin/drain before a rolling restart
+	app.WSServer.SetDrainHandler(app.StartDrain)
+
 	app.setupEvents()
 
 	// Initialize storage client from app config
@@ -155,6 +263,29 @@ func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config) (*WSApp, er
 		slog.Info("Sandbox client configured", "base_url", appCfg.Sandbox.BaseURL)
 	}
 
+	// Push the file changes made during a turn to the file explorer
+	if appCfg != nil && appCfg.Sandbox.FileWatchInterval > 0 {
+		app.startFileWatcher(ctx, time.Duration(appCfg.Sandbox.FileWatchInterval)*time.Millisecond)
+	}
+
+	// Archive the workspace before runs so that their edits can be rolled back
+	if appCfg != nil && appCfg.Sandbox.SnapshotBeforeRun {
+		app.startRunSnapshots(appCfg)
+	}
+
+	// Ping the connections and reap the ones that stopped answering
+	if appCfg != nil {
+		app.WSServer.SetHeartbeat(heartbeat(appCfg.Server))
+	}
+
+	// Reject prompts over the rate limits of their user or session
+	if appCfg != nil {
+		app.startRateLimits(appCfg.RateLimit)
+	}
+
+	// Check on the background jobs left running before the restart
+	go app.recoverBackgroundJobs(ctx)
+
 	// Initialize LSP clients in the background.
 	app.initLSPClients(ctx)
 
@@ -166,7 +297,10 @@ func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config) (*WSApp, er
 		mcp.Initialize(ctx, app.Permissions, cfg)
 	}()
 
-	// cleanup database upon app shutdown
+	// cleanup database upon app shutdown, flushing batched writes first
+	if writeBatcher != nil {
+		app.cleanupFuncs = append(app.cleanupFuncs, writeBatcher.Close)
+	}
 	app.cleanupFuncs = append(app.cleanupFuncs, conn.Close, mcp.Close)
 
 	// Initialize the agent worker pool from app config
@@ -178,7 +312,28 @@ func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config) (*WSApp, er
 			if app.AgentCoordinator == nil {
 				return fmt.Errorf("agent coordinator not initialized")
 			}
-			_, err := app.AgentCoordinator.Run(taskCtx, task.SessionID, task.Prompt, task.Attachments...)
+			// Skip tasks of paused projects (queued before the pause or scheduled jobs)
+			if err := app.checkProjectPaused(taskCtx, task.SessionID); err != nil {
+				return err
+			}
+			if task.WorkingDir != "" {
+				taskCtx = context.WithValue(taskCtx, tools.WorkingDirContextKey, task.WorkingDir)
+			}
+			if task.PlanMode {
+				taskCtx = context.WithValue(taskCtx, tools.PlanModeContextKey, true)
+			}
+			if task.ResumeToolCall != "" {
+				taskCtx = context.WithValue(taskCtx, tools.ResumeToolCallContextKey, task.ResumeToolCall)
+			}
+			if task.BusyPolicy != "" {
+				taskCtx = context.WithValue(taskCtx, tools.BusyPolicyContextKey, task.BusyPolicy)
+			}
+			if task.ModelOverride != nil {
+				taskCtx = context.WithValue(taskCtx, tools.ModelOverrideContextKey, task.ModelOverride)
+			}
+			taskCtx = app.withProjectSecrets(taskCtx, task.SessionID)
+			taskCtx = app.withSessionEnv(taskCtx, task.SessionID)
+			_, err := app.AgentCoordinator.RunAgent(taskCtx, task.Agent, task.SessionID, task.Prompt, task.Attachments...)
 			return err
 		}
 
@@ -200,23 +355,39 @@ func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config) (*WSApp, er
 
 			// Send session status update to WebSocket clients
 			app.sendSessionStatusUpdate(sessionID, storeredis.SessionStatusRunning)
+			app.startTurnMetrics(ctx, sessionID)
+			app.snapshotBeforeRun(sessionID)
+			app.watchFiles(sessionID)
 		}
 
 		// onTaskComplete callback - called when worker finishes executing a task
 		onTaskComplete := func(sessionID string, err error, reason string) {
 			ctx := context.Background()
 			slog.Info("[LIFECYCLE] Agent task completed", "session_id", sessionID, "reason", reason, "error", err)
+			if reason == "requeued" {
+				// The preempted task runs again on the next free background
+				// worker, the session stays running
+				app.unwatchFiles(sessionID)
+				return
+			}
 
 			// Determine final status
 			var status storeredis.SessionRunningStatus
-			switch reason {
-			case "completed":
+			switch {
+			case isProjectPausedErr(err):
+				status = storeredis.SessionStatusCancelled
+				app.sendErrorToClient(sessionID, err)
+			case errors.Is(err, agent.ErrSessionBusy):
+				// The prompt was refused, the running one goes on
+				status = storeredis.SessionStatusRunning
+				app.sendBusyError(sessionID)
+			case reason == "completed":
 				status = storeredis.SessionStatusCompleted
-			case "cancelled":
+			case reason == "cancelled", reason == "preempted":
 				status = storeredis.SessionStatusCancelled
-			case "timeout":
+			case reason == "timeout":
 				status = storeredis.SessionStatusError
-			case "shutdown":
+			case reason == "shutdown":
 				status = storeredis.SessionStatusCancelled
 			default:
 				status = storeredis.SessionStatusError
@@ -233,24 +404,32 @@ func NewWSApp(ctx context.Context, conn *sql.DB, cfg *config.Config) (*WSApp, er
 				}
 
 				// Publish generation complete event to Redis stream
-				if pubErr := app.RedisStream.PublishMessage(ctx, sessionID, "generation_complete", map[string]interface{}{
-					"session_id": sessionID,
-					"status":     string(status),
-					"error":      err != nil,
-				}); pubErr != nil {
-					slog.Warn("Failed to publish generation complete event", "error", pubErr)
-				}
+				app.publishGenerationComplete(ctx, sessionID, status, err)
+			}
+			if status != storeredis.SessionStatusRunning {
+				app.collectTurnKeys(ctx, sessionID)
+				app.releaseIdleSession(sessionID)
 			}
 
 			// Send session status update to WebSocket clients
 			app.sendSessionStatusUpdate(sessionID, status)
+			app.recordTurnMetrics(ctx, sessionID, status)
+			app.unwatchFiles(sessionID)
+
+			// Post the turn summary to the project's chat hooks
+			go app.notifyChatHooks(sessionID, status, err)
 		}
 
 		app.AgentWorkerPool = agent.NewAgentWorkerPool(agentCfg, executor, onTaskStart, onTaskComplete)
 		slog.Info("[GOROUTINE] Agent worker pool initialized",
 			"max_workers", agentCfg.MaxWorkers,
 			"queue_size", agentCfg.TaskQueueSize,
+			"overflow_queue_size", agentCfg.OverflowQueueSize,
 		)
+		if agentCfg.OverflowQueueSize > 0 {
+			app.overflow.size = agentCfg.OverflowQueueSize
+			go app.runOverflowQueue(ctx)
+		}
 	}
 
 	// Try to initialize agent if config is available
@@ -298,10 +477,11 @@ func (app *WSApp) Shutdown() {
 	}
 
 	if app.AgentCoordinator != nil {
-		app.AgentCoordinator.CancelAll()
+		app.AgentCoordinator.CancelAll(message.CancelReasonShutdown)
 	}
 
-	// Kill all background shells.
+	// Kill all local background shells. The background jobs of the agent run
+	// in the sandbox containers and are left running.
 	shell.GetBackgroundShellManager().KillAll()
 
 	// Shutdown all LSP clients.
@@ -327,15 +507,12 @@ func (app *WSApp) Shutdown() {
 
 // sendSessionStatusUpdate sends a session running status update to WebSocket clients.
 func (app *WSApp) sendSessionStatusUpdate(sessionID string, status storeredis.SessionRunningStatus) {
-	statusMsg := map[string]interface{}{
-		"Type":       "session_status",
-		"session_id": sessionID,
-		"status":     string(status),
-		"is_running": status == storeredis.SessionStatusRunning,
-	}
-
 	// Always try to send via WebSocket
-	app.WSServer.SendToSession(sessionID, statusMsg)
+	app.send(sessionID, protocol.SessionStatus{
+		SessionID: sessionID,
+		Status:    string(status),
+		IsRunning: status == storeredis.SessionStatusRunning,
+	}, 0)
 
 	slog.Info("Sent session status update",
 		"session_id", sessionID,
@@ -358,3 +535,39 @@ func (app *WSApp) checkForUpdates(ctx context.Context) {
 		IsDevelopment:  info.IsDevelopment(),
 	}
 }
+
+// generationComplete builds the generation_complete event of a session, with
+// the timing summary of the last turn when the agent recorded one.
+func (app *WSApp) generationComplete(sessionID string, status storeredis.SessionRunningStatus, err error) protocol.GenerationComplete {
+	event := protocol.GenerationComplete{
+		SessionID:      sessionID,
+		Status:         string(status),
+		Error:          err != nil,
+		Stalled:        errors.Is(err, agent.ErrStreamStalled),
+		BudgetExceeded: errors.Is(err, budget.ErrExceeded),
+	}
+	if app.AgentCoordinator != nil {
+		if timeline, ok := app.AgentCoordinator.LastTimeline(sessionID); ok {
+			summary := timeline.Summary()
+			event.Timeline = &summary
+		}
+	}
+	return event
+}
+
+// heartbeat returns the ping interval and pong timeout of the WebSocket
+// connections, the defaults when unset. A negative interval disables pings.
+// The timeout spans at least two pings, so that a healthy connection is never
+// reaped before it had the chance to answer.
+func heartbeat(cfg config.ServerConfig) (time.Duration, time.Duration) {
+	interval, timeout := handler.DefaultPingInterval, handler.DefaultPongTimeout
+	if cfg.PingInterval < 0 {
+		interval = 0
+	} else if cfg.PingInterval > 0 {
+		interval = time.Duration(cfg.PingInterval) * time.Second
+	}
+	if cfg.PongTimeout > 0 {
+		timeout = time.Duration(cfg.PongTimeout) * time.Second
+	}
+	return interval, max(timeout, 2*interval)
+}
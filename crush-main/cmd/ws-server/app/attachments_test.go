@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/handler"
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+	"github.com/stretchr/testify/require"
+)
+
+// storedMessages serves the messages it holds.
+type storedMessages struct {
+	message.Service
+	messages map[string]message.Message
+}
+
+func (s storedMessages) Get(_ context.Context, id string) (message.Message, error) {
+	msg, ok := s.messages[id]
+	if !ok {
+		return message.Message{}, errors.New("not found")
+	}
+	return msg, nil
+}
+
+// newAttachmentTestApp returns an app whose session s1 has an image stored
+// at imageURL in message m1, and the events it sends to the sessions.
+func newAttachmentTestApp(imageURL string) (*WSApp, *recordingPool, chan protocol.Envelope) {
+	sent := make(chan protocol.Envelope, 10)
+	server := handler.New()
+	server.SetRelay(func(_ string, data []byte) {
+		var env protocol.Envelope
+		if json.Unmarshal(data, &env) == nil {
+			sent <- env
+		}
+	})
+	pool := &recordingPool{tasks: make(chan agent.AgentTask, 10)}
+	return &WSApp{
+		Messages: storedMessages{messages: map[string]message.Message{
+			"m1": {ID: "m1", SessionID: "s1", Parts: []message.ContentPart{
+				message.TextContent{Text: "look at this"},
+				message.BinaryContent{Path: imageURL, MIMEType: "image/png"},
+			}},
+		}},
+		AgentCoordinator:  &busyCoordinator{busy: map[string]bool{}},
+		AgentWorkerPool:   pool,
+		WSServer:          server,
+		connectedSessions: csync.NewMap[string, bool](),
+	}, pool, sent
+}
+
+func TestProcessImageAttachmentsResolvesReferences(t *testing.T) {
+	image := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("png"))
+	}))
+	defer image.Close()
+	app, _, _ := newAttachmentTestApp(image.URL + "/uploads/shot.png")
+
+	attachments, err := app.processImageAttachments("s1", []protocol.ImageAttachment{
+		{Type: wsAttachmentReference, MessageID: "m1", PartIndex: 1},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []message.Attachment{{
+		FilePath: image.URL + "/uploads/shot.png",
+		FileName: "shot.png",
+		MimeType: "image/png",
+		Content:  []byte("png"),
+	}}, attachments)
+
+	for _, ref := range []protocol.ImageAttachment{
+		{Type: wsAttachmentReference, MessageID: "m2", PartIndex: 1},
+		{Type: wsAttachmentReference, MessageID: "m1", PartIndex: 0},
+		{Type: wsAttachmentReference, MessageID: "m1", PartIndex: 5},
+	} {
+		_, err := app.processImageAttachments("s1", []protocol.ImageAttachment{ref})
+		require.ErrorIs(t, err, message.ErrInvalidAttachmentReference)
+	}
+	_, err = app.processImageAttachments("s2", []protocol.ImageAttachment{{Type: wsAttachmentReference, MessageID: "m1", PartIndex: 1}})
+	require.ErrorIs(t, err, message.ErrInvalidAttachmentReference, "the image of another session")
+}
+
+func TestUnresolvedReferenceRejectsPrompt(t *testing.T) {
+	app, pool, sent := newAttachmentTestApp("https://files.example.com/shot.png")
+
+	raw, err := json.Marshal(protocol.ClientMessage{
+		SessionID: "s1",
+		Content:   "what about this one?",
+		Images:    []protocol.ImageAttachment{{Type: wsAttachmentReference, MessageID: "m1", PartIndex: 0}},
+	})
+	require.NoError(t, err)
+	app.HandleClientMessage(raw, nil)
+
+	env := <-sent
+	require.Equal(t, protocol.TypeError, env.Type)
+	var event protocol.Error
+	require.NoError(t, json.Unmarshal(env.Payload, &event))
+	require.Equal(t, apierr.CodeInvalidRequest, event.ErrorCode)
+	require.Contains(t, event.Error, "invalid attachment reference")
+	require.Empty(t, pool.tasks, "the prompt does not run without its image")
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/domain/project"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+)
+
+// subscribeBlueprintRuns listens for the opening prompts of sessions created
+// from a blueprint through the HTTP API.
+func (app *WSApp) subscribeBlueprintRuns(ctx context.Context) {
+	if app.RedisCmd == nil {
+		return
+	}
+	cmds, cancel := app.RedisCmd.SubscribeGlobalCommands(ctx)
+	app.cleanupFuncs = append(app.cleanupFuncs, func() error {
+		cancel()
+		return nil
+	})
+
+	go func() {
+		slog.Info("[GOROUTINE] Blueprint run subscriber started")
+		defer slog.Info("[GOROUTINE] Blueprint run subscriber stopped")
+		for cmd := range cmds {
+			if cmd.Type != storeredis.CmdBlueprintRun {
+				continue
+			}
+			var run storeredis.BlueprintRunPayload
+			if err := json.Unmarshal(cmd.Payload, &run); err != nil {
+				slog.Warn("Failed to unmarshal blueprint run payload", "error", err)
+				continue
+			}
+			app.runBlueprintPrompts(ctx, run)
+		}
+	}()
+}
+
+// runBlueprintPrompts runs the opening prompts of a blueprint session one after
+// the other, each one waiting for the turn of the previous one. The sequence
+// stops at the first failed or cancelled turn.
+func (app *WSApp) runBlueprintPrompts(ctx context.Context, run storeredis.BlueprintRunPayload) {
+	// Every WS instance receives the broadcast, only one of them runs it
+	claimed, err := app.RedisCmd.ClaimCommand(ctx, string(storeredis.CmdBlueprintRun)+":"+run.SessionID, webhookRunClaimTTL)
+	if err != nil {
+		slog.Warn("Failed to claim blueprint run", "session_id", run.SessionID, "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	slog.Info("Running blueprint prompts",
+		"project_id", run.ProjectID,
+		"session_id", run.SessionID,
+		"blueprint", run.Blueprint,
+		"prompts", len(run.Prompts),
+	)
+	if !app.ensureAgentInitialized() {
+		return
+	}
+
+	go func() {
+		ctx := context.Background()
+		for i, content := range run.Prompts {
+			prompt := queuedPrompt{sessionID: run.SessionID, agent: run.Agent, content: content}
+			if app.holdIfProjectPaused(prompt) {
+				app.holdBlueprintPrompts(ctx, run, i+1)
+				return
+			}
+			if err := app.runBlueprintPrompt(ctx, prompt); err != nil {
+				slog.Warn("Blueprint prompt failed, skipping the remaining prompts",
+					"session_id", run.SessionID,
+					"blueprint", run.Blueprint,
+					"prompt", i+1,
+					"error", err,
+				)
+				if !errors.Is(err, context.Canceled) && !isProjectPausedErr(err) {
+					app.sendErrorToClient(run.SessionID, err)
+				}
+				return
+			}
+		}
+		slog.Info("Blueprint prompts completed", "session_id", run.SessionID, "blueprint", run.Blueprint)
+	}()
+}
+
+// runBlueprintPrompt runs a prompt and waits for its turn to finish.
+func (app *WSApp) runBlueprintPrompt(ctx context.Context, prompt queuedPrompt) error {
+	if app.AgentWorkerPool == nil {
+		slog.Warn("[GOROUTINE] Worker pool not available, running blueprint prompt directly", "session_id", prompt.sessionID)
+		_, err := app.AgentCoordinator.RunAgent(ctx, prompt.agent, prompt.sessionID, prompt.content)
+		return err
+	}
+
+	task := agent.AgentTask{
+		SessionID:  prompt.sessionID,
+		Prompt:     prompt.content,
+		Agent:      prompt.agent,
+		ResultChan: make(chan agent.AgentTaskResult, 1),
+	}
+	if err := app.AgentWorkerPool.Submit(ctx, task); err != nil {
+		return err
+	}
+	return (<-task.ResultChan).Error
+}
+
+// holdBlueprintPrompts queues the prompts of a blueprint run from the given
+// index behind the one held by a paused project, so that they run in order
+// once it resumes. Nothing is queued when the project rejects prompts.
+func (app *WSApp) holdBlueprintPrompts(ctx context.Context, run storeredis.BlueprintRunPayload, from int) {
+	projectID, pause := app.sessionProjectPause(ctx, run.SessionID)
+	if pause == nil || pause.Mode != project.PauseModeQueue {
+		return
+	}
+	for _, content := range run.Prompts[from:] {
+		app.pausedPrompts.add(projectID, queuedPrompt{sessionID: run.SessionID, agent: run.Agent, content: content})
+	}
+	app.scheduleResume(projectID, pause.ResumeAt)
+}
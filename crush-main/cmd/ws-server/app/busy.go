@@ -0,0 +1,57 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// rejectIfBusy refuses a prompt sent while its session runs another one when
+// the prompt or the session asks for it, and tells the client. The agent
+// checks again when the prompt runs; refusing it here spares the session the
+// status updates of a turn that does not run.
+func (app *WSApp) rejectIfBusy(prompt queuedPrompt) bool {
+	if app.AgentCoordinator == nil || !app.AgentCoordinator.IsSessionBusy(prompt.sessionID) {
+		return false
+	}
+	policy := cmp.Or(prompt.busyPolicy, app.sessionBusyPolicy(context.Background(), prompt.sessionID))
+	if policy != config.BusyPolicyReject {
+		return false
+	}
+	slog.Info("Rejected a prompt of a busy session", "session_id", prompt.sessionID)
+	app.sendBusyError(prompt.sessionID)
+	return true
+}
+
+// sessionBusyPolicy returns the busy policy saved in the config of a session,
+// empty when it has none.
+func (app *WSApp) sessionBusyPolicy(ctx context.Context, sessionID string) config.BusyPolicy {
+	if app.db == nil {
+		return ""
+	}
+	configJSON, err := app.db.GetSessionConfigJSON(ctx, sessionID)
+	if err != nil || configJSON == "" {
+		return ""
+	}
+	var sessionConfig struct {
+		Options struct {
+			BusyPolicy config.BusyPolicy `json:"busy_policy"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal([]byte(configJSON), &sessionConfig); err != nil {
+		slog.Warn("Ignoring invalid session config", "session_id", sessionID, "error", err)
+		return ""
+	}
+	return sessionConfig.Options.BusyPolicy
+}
+
+// sendBusyError tells a client its prompt was refused because the session
+// runs another one.
+func (app *WSApp) sendBusyError(sessionID string) {
+	app.sendError(sessionID, agent.ErrSessionBusy.Error(), apierr.New(apierr.CodeSessionBusy, ""))
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/infra/chat"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// chatHookTimeout bounds the time spent notifying the chat hooks of a turn.
+const chatHookTimeout = 30 * time.Second
+
+// chatHookEvent maps the final status of a turn to its chat hook event.
+func chatHookEvent(status storeredis.SessionRunningStatus) string {
+	switch status {
+	case storeredis.SessionStatusCompleted:
+		return project.ChatHookEventCompleted
+	case storeredis.SessionStatusError:
+		return project.ChatHookEventFailed
+	case storeredis.SessionStatusCancelled:
+		return project.ChatHookEventCancelled
+	}
+	return ""
+}
+
+// notifyChatHooks sends a turn summary to the Slack and Discord hooks of the
+// session's project that subscribe to the final status of the turn.
+func (app *WSApp) notifyChatHooks(sessionID string, status storeredis.SessionRunningStatus, taskErr error) {
+	event := chatHookEvent(status)
+	if event == "" {
+		return
+	}
+	app.sendChatHooks(sessionID, event, func(ctx context.Context, summary *project.TurnSummary) {
+		if files, err := app.History.ListLatestSessionFiles(ctx, sessionID); err == nil {
+			summary.FileCount = len(files)
+			for _, file := range files[:min(len(files), project.MaxSummaryFiles)] {
+				summary.FilesChanged = append(summary.FilesChanged, file.Path)
+			}
+		}
+		if taskErr != nil {
+			summary.Error = taskErr.Error()
+		}
+	})
+}
+
+// notifyPermissionBlocking tells the chat hooks of the session's project that
+// a run has been waiting on a permission request for too long.
+func (app *WSApp) notifyPermissionBlocking(blocking permission.PermissionBlocking) {
+	app.sendChatHooks(blocking.SessionID, project.ChatHookEventPermissionBlocking, func(_ context.Context, summary *project.TurnSummary) {
+		summary.ToolName = blocking.ToolName
+		summary.Description = blocking.Description
+		summary.Blocked = (time.Duration(blocking.BlockedMs) * time.Millisecond).Round(time.Second).String()
+	})
+}
+
+// sendChatHooks renders the summary of a session event, completed by fill,
+// and sends it to the project's chat hooks subscribed to the event.
+func (app *WSApp) sendChatHooks(sessionID, event string, fill func(ctx context.Context, summary *project.TurnSummary)) {
+	if app.Projects == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), chatHookTimeout)
+	defer cancel()
+
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil || sess.ProjectID == "" {
+		return
+	}
+	hooks, err := app.Projects.ListChatHooks(ctx, sess.ProjectID)
+	if err != nil {
+		slog.Warn("Failed to list chat hooks", "project_id", sess.ProjectID, "error", err)
+		return
+	}
+	hooks = filterChatHooks(hooks, event)
+	if len(hooks) == 0 {
+		return
+	}
+
+	summary := project.TurnSummary{
+		Event:     event,
+		ProjectID: sess.ProjectID,
+		SessionID: sessionID,
+		Title:     sess.Title,
+		Cost:      sess.Cost,
+		URL:       sessionURL(sessionID),
+	}
+	if proj, err := app.Projects.GetByID(ctx, sess.ProjectID); err == nil {
+		summary.ProjectName = proj.Name
+	}
+	fill(ctx, &summary)
+
+	client := chat.NewClient()
+	for _, hook := range hooks {
+		text, err := hook.RenderMessage(summary)
+		if err != nil {
+			slog.Warn("Failed to render chat hook message", "hook_id", hook.ID, "error", err)
+			continue
+		}
+		if err := client.Send(ctx, chat.Platform(hook.Platform), hook.WebhookURL, text); err != nil {
+			slog.Warn("Failed to send chat hook message", "hook_id", hook.ID, "platform", hook.Platform, "error", err)
+			continue
+		}
+		slog.Info("Sent chat hook message", "hook_id", hook.ID, "platform", hook.Platform, "session_id", sessionID, "event", event)
+	}
+}
+
+// filterChatHooks keeps the hooks subscribed to an event.
+func filterChatHooks(hooks []project.ChatHook, event string) []project.ChatHook {
+	var subscribed []project.ChatHook
+	for _, hook := range hooks {
+		if hook.Handles(event) {
+			subscribed = append(subscribed, hook)
+		}
+	}
+	return subscribed
+}
+
+// sessionURL links to a session in the web UI, empty without a public URL.
+func sessionURL(sessionID string) string {
+	appCfg := config.GetGlobalAppConfig()
+	if appCfg == nil || appCfg.Server.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimRight(appCfg.Server.PublicURL, "/") + "/sessions/" + sessionID
+}
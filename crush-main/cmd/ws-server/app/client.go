@@ -1,90 +1,89 @@
 package app
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
 	"github.com/rolling1314/rolling-crush/domain/message"
 	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/domain/upload"
 	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
 	"github.com/rolling1314/rolling-crush/infra/storage"
 	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/pkg/config"
 )
 
-// WSImageAttachment represents an image attached to a message
-type WSImageAttachment struct {
-	URL      string `json:"url"`
-	MimeType string `json:"mime_type"`
-	Filename string `json:"filename"`
-}
+// wsAttachmentReference is the type of attachments referencing an image of a previous message
+const wsAttachmentReference = "reference"
 
-// HandleClientDisconnect handles WebSocket disconnection
+// HandleClientDisconnect handles WebSocket disconnection, including the
+// connections reaped by the heartbeat after they stopped answering pings.
 // Instead of cancelling the agent, we mark the session as disconnected so messages
 // continue to be buffered in Redis for later retrieval
-func (app *WSApp) HandleClientDisconnect() {
-	fmt.Println("=== HandleClientDisconnect called ===")
-	slog.Info("WebSocket client disconnected", "sessionID", app.currentSessionID)
+func (app *WSApp) HandleClientDisconnect(sessionID string) {
+	sessionID = cmp.Or(sessionID, app.currentSessionID)
+	slog.Info("WebSocket client disconnected", "sessionID", sessionID)
 
 	// Mark session as disconnected but DON'T cancel the agent
 	// The agent will continue running and messages will be buffered in Redis
-	if app.currentSessionID != "" {
-		app.connectedSessions.Set(app.currentSessionID, false)
+	// Other clients of the session on this instance keep it connected
+	if sessionID != "" && !app.WSServer.HasSessionClients(sessionID) {
+		app.connectedSessions.Set(sessionID, false)
 
 		// Update Redis connection status
 		if app.RedisStream != nil {
 			ctx := context.Background()
-			if err := app.RedisStream.SetConnectionStatus(ctx, app.currentSessionID, false); err != nil {
+			if err := app.RedisStream.SetConnectionStatus(ctx, sessionID, false); err != nil {
 				slog.Warn("Failed to update Redis connection status", "error", err)
 			}
 		}
 
-		fmt.Printf("Session %s marked as disconnected, agent continues running\n", app.currentSessionID)
-		slog.Info("Session marked as disconnected, agent continues running", "sessionID", app.currentSessionID)
+		slog.Info("Session marked as disconnected, agent continues running", "sessionID", sessionID)
+
+		// The instance keeps the session while its turn runs
+		app.releaseIdleSession(sessionID)
 	}
 
 	// Clear the current session ID so new connections start fresh
 	app.currentSessionID = ""
-	fmt.Println("Current session ID cleared")
 }
 
 // HandleClientMessage processes messages from the WebSocket client
 // updateSessionID is a callback to update the WebSocket client's session ID mapping
 func (app *WSApp) HandleClientMessage(rawMsg []byte, updateSessionID func(sessionID string)) {
-	fmt.Println("=== HandleClientMessage called ===")
-	fmt.Println("Raw message:", string(rawMsg))
-
-	type ClientMsg struct {
-		Type            string              `json:"type"`
-		Content         string              `json:"content"`
-		SessionID       string              `json:"sessionID"`  // Optional: if frontend sends it (camelCase)
-		SessionIDSnake  string              `json:"session_id"` // Optional: for permission_response (snake_case)
-		ID              string              `json:"id"`
-		ToolCallID      string              `json:"tool_call_id"`
-		Granted         bool                `json:"granted"`
-		Denied          bool                `json:"denied"`
-		AllowForSession bool                `json:"allow_for_session"` // Allow this tool for the entire session
-		ToolName        string              `json:"tool_name"`         // Tool name for allowlist
-		Action          string              `json:"action"`            // Action for allowlist
-		Path            string              `json:"path"`              // Path for allowlist
-		Images          []WSImageAttachment `json:"images"`            // Image attachments
-		LastMsgID       string              `json:"lastMsgId"`         // For reconnection - last received Redis stream message ID
-	}
-
-	var msg ClientMsg
-	if err := json.Unmarshal(rawMsg, &msg); err != nil {
+	app.handleClientMessage(rawMsg, updateSessionID, "")
+}
+
+// handleClientMessage processes a client message. forwardedFor is the session
+// of a message another instance forwarded to this one as the session owner,
+// which is then never forwarded again.
+func (app *WSApp) handleClientMessage(rawMsg []byte, updateSessionID func(sessionID string), forwardedFor string) {
+
+	msg, err := protocol.DecodeClientMessage(rawMsg)
+	if err != nil {
 		slog.Error("Failed to unmarshal client message", "error", err)
 		return
 	}
 
-	fmt.Println("Parsed message type:", msg.Type, "content:", msg.Content, "sessionID:", msg.SessionID)
+	slog.Debug("Parsed client message", "type", msg.Type, "sessionID", msg.SessionID)
+	if forwardedFor != "" && msg.SessionID == "" {
+		msg.SessionID = forwardedFor
+	}
 
 	// Handle reconnection request - client wants to resume receiving messages
-	if msg.Type == "reconnect" {
+	if msg.Type == protocol.TypeReconnect {
 		// Update WebSocket client's session ID for reconnection
 		if msg.SessionID != "" && updateSessionID != nil {
 			updateSessionID(msg.SessionID)
@@ -93,8 +92,18 @@ func (app *WSApp) HandleClientMessage(rawMsg []byte, updateSessionID func(sessio
 		return
 	}
 
+	// Handle backfill requests - client noticed a gap in the event sequence numbers
+	if msg.Type == protocol.TypeBackfill {
+		sessionID := msg.SessionIDSnake
+		if sessionID == "" {
+			sessionID = msg.SessionID
+		}
+		app.handleBackfill(sessionID, msg.FromSeq, msg.ToSeq)
+		return
+	}
+
 	// Handle permission responses
-	if msg.Type == "permission_response" {
+	if msg.Type == protocol.TypePermissionResponse {
 		// Get session ID from snake_case field (from permission_response)
 		sessionID := msg.SessionIDSnake
 		if sessionID == "" {
@@ -103,13 +112,83 @@ func (app *WSApp) HandleClientMessage(rawMsg []byte, updateSessionID func(sessio
 		if sessionID == "" {
 			sessionID = app.currentSessionID // Fallback to current session
 		}
-		app.handlePermissionResponse(msg.ID, msg.ToolCallID, sessionID, msg.Granted, msg.Denied, msg.AllowForSession, msg.ToolName, msg.Action, msg.Path)
+		// The pending request lives on the instance running the session's agent
+		if owner := app.remoteOwner(sessionID); owner != "" && forwardedFor == "" {
+			payload := storeredis.PermissionResponsePayload{
+				ID:              msg.ID,
+				ToolCallID:      msg.ToolCallID,
+				Granted:         msg.Granted,
+				Denied:          msg.Denied,
+				AllowForSession: msg.AllowForSession,
+				ToolName:        msg.ToolName,
+				Action:          msg.Action,
+				Path:            msg.Path,
+				Reason:          msg.Reason,
+				ApprovedHunks:   msg.ApprovedHunks,
+			}
+			if app.forwardToOwner(owner, storeredis.CmdPermissionResponse, sessionID, payload) {
+				return
+			}
+		}
+		app.handlePermissionResponse(msg.ID, msg.ToolCallID, sessionID, msg.Granted, msg.Denied, msg.AllowForSession, msg.ToolName, msg.Action, msg.Path, msg.Reason, msg.ApprovedHunks)
 		return
 	}
 
 	// Handle cancel requests - 取消当前会话的 agent 请求
-	if msg.Type == "cancel" {
-		app.handleCancelRequest(msg.SessionID)
+	if msg.Type == protocol.TypeCancel {
+		sessionID := msg.SessionID
+		if sessionID == "" {
+			sessionID = app.currentSessionID
+		}
+		if owner := app.remoteOwner(sessionID); owner != "" && forwardedFor == "" {
+			if app.forwardToOwner(owner, storeredis.CmdCancel, sessionID, storeredis.CancelPayload{Mode: msg.Mode}) {
+				return
+			}
+		}
+		app.handleCancelRequest(sessionID, agent.ParseCancelMode(msg.Mode))
+		return
+	}
+
+	// Inspect and manage the prompts queued behind the running turn
+	if msg.Type == protocol.TypeQueueList || msg.Type == protocol.TypeQueueRemove || msg.Type == protocol.TypeQueueReorder {
+		sessionID := cmp.Or(msg.SessionIDSnake, msg.SessionID, app.currentSessionID)
+		if owner := app.remoteOwner(sessionID); owner != "" && forwardedFor == "" {
+			if app.forwardToOwner(owner, storeredis.CmdClientMessage, sessionID, rawMsg) {
+				return
+			}
+		}
+		app.handleQueueMessage(msg.Type, sessionID, msg.PromptID, msg.PromptIDs)
+		return
+	}
+
+	// Acknowledge the stream deltas applied, deltas are held while a client falls behind
+	if msg.Type == protocol.TypeStreamAck {
+		sessionID := cmp.Or(msg.SessionIDSnake, msg.SessionID, app.currentSessionID)
+		if owner := app.remoteOwner(sessionID); owner != "" && forwardedFor == "" {
+			if app.forwardToOwner(owner, storeredis.CmdClientMessage, sessionID, rawMsg) {
+				return
+			}
+		}
+		app.deltas.ack(sessionID, msg.MessageID, msg.Seq)
+		return
+	}
+
+	// Switch the model of the next turns
+	if msg.Type == protocol.TypeSetModel {
+		sessionID := cmp.Or(msg.SessionIDSnake, msg.SessionID, app.currentSessionID)
+		if owner := app.remoteOwner(sessionID); owner != "" && forwardedFor == "" {
+			if app.forwardToOwner(owner, storeredis.CmdClientMessage, sessionID, rawMsg) {
+				return
+			}
+		}
+		app.handleSetModel(sessionID, msg.Slot, msg.Provider, msg.Model)
+		return
+	}
+
+	// Set the environment variables of the tools of the next turns, read from
+	// the session config when a turn starts on any instance
+	if msg.Type == protocol.TypeSetEnv {
+		app.handleSetEnv(cmp.Or(msg.SessionIDSnake, msg.SessionID, app.currentSessionID), msg.Env)
 		return
 	}
 
@@ -128,41 +207,115 @@ func (app *WSApp) HandleClientMessage(rawMsg []byte, updateSessionID func(sessio
 	// Mark session as connected
 	app.markSessionConnected(sessionID)
 
-	fmt.Println("Final sessionID:", sessionID)
+	// Prompts run on the instance owning the session, so that a single agent
+	// runs it and cancel/permission messages can be routed there
+	if forwardedFor == "" {
+		if owner := app.claimSession(sessionID); owner != "" {
+			if app.forwardToOwner(owner, storeredis.CmdClientMessage, sessionID, rawMsg) {
+				return
+			}
+		}
+	}
+
 	slog.Info("Received message from client", "content", msg.Content, "sessionID", sessionID)
 
+	// A prompt retried with the same idempotency key runs once, its key is
+	// released when it is rejected so that the retry runs
+	fingerprint := promptFingerprint(msg.Type, msg.Content, msg.MessageID)
+	if !app.reservePrompt(sessionID, msg.IdempotencyKey, fingerprint) {
+		return
+	}
+
 	// Ensure AgentCoordinator is initialized
 	if !app.ensureAgentInitialized() {
+		app.releasePrompt(sessionID, msg.IdempotencyKey)
+		return
+	}
+
+	if msg.Agent != "" && !slices.Contains(app.AgentCoordinator.Agents(), msg.Agent) {
+		app.releasePrompt(sessionID, msg.IdempotencyKey)
+		app.sendError(sessionID, fmt.Sprintf("unknown agent %q", msg.Agent), apierr.New(apierr.CodeInvalidRequest, ""))
+		return
+	}
+
+	if !config.BusyPolicy(msg.BusyPolicy).Valid() {
+		app.releasePrompt(sessionID, msg.IdempotencyKey)
+		app.sendError(sessionID, fmt.Sprintf("unknown busy policy %q", msg.BusyPolicy), apierr.New(apierr.CodeInvalidRequest, ""))
+		return
+	}
+
+	workingDir, err := app.resolvePromptWorkdir(sessionID, msg.Cwd)
+	if err != nil {
+		app.releasePrompt(sessionID, msg.IdempotencyKey)
+		app.sendErrorToClient(sessionID, err)
 		return
 	}
 
+	// Retry the last turn: its user message runs again with its images, in
+	// place of the turn, optionally with another model or sampling
+	var modelOverride *config.ModelOverride
+	if msg.Type == protocol.TypeRetry {
+		turn, err := app.prepareRetry(sessionID, msg)
+		if err != nil {
+			app.releasePrompt(sessionID, msg.IdempotencyKey)
+			app.sendErrorToClient(sessionID, err)
+			return
+		}
+		msg.MessageID, msg.Content, msg.Images = turn.messageID, turn.content, turn.images
+		modelOverride = turn.override
+	}
+
 	// Fetch image attachments if any
-	attachments := app.processImageAttachments(msg.Images)
+	attachments, err := app.processImageAttachments(sessionID, msg.Images)
+	if err != nil {
+		app.releasePrompt(sessionID, msg.IdempotencyKey)
+		app.sendErrorToClient(sessionID, err)
+		return
+	}
 
-	// Run the agent via worker pool for bounded concurrency
-	if err := app.runAgentViaPool(sessionID, msg.Content, attachments); err != nil {
-		slog.Error("[GOROUTINE] Failed to submit agent task",
-			"session_id", sessionID,
-			"error", err,
-		)
-		// Send error message to client
-		app.sendErrorToClient(sessionID, "系统繁忙，请稍后重试 (503)")
+	// Regenerate from an edited user message: the conversation is cut back to
+	// it, the attachments are resolved first as they may reference its images
+	if msg.Type == protocol.TypeRegenerate || msg.Type == protocol.TypeRetry {
+		if err := app.regenerateFrom(sessionID, msg.MessageID); err != nil {
+			app.releasePrompt(sessionID, msg.IdempotencyKey)
+			app.sendErrorToClient(sessionID, err)
+			return
+		}
+	}
+	prompt := queuedPrompt{sessionID: sessionID, agent: msg.Agent, content: msg.Content, attachments: attachments, workingDir: workingDir, planMode: msg.PlanMode, busyPolicy: config.BusyPolicy(msg.BusyPolicy), modelOverride: modelOverride}
+	if app.rejectIfBusy(prompt) {
+		app.releasePrompt(sessionID, msg.IdempotencyKey)
 		return
 	}
+	app.acceptPrompt(sessionID, msg.IdempotencyKey, fingerprint)
+
+	// Reject or queue the prompt while the project is in a maintenance window
+	if app.holdIfProjectPaused(prompt) {
+		return
+	}
+
+	// Run the agent via worker pool for bounded concurrency
+	if !app.submitPrompt(prompt) {
+		app.releasePrompt(sessionID, msg.IdempotencyKey)
+	}
 }
 
-// handlePermissionResponse handles permission grant/deny responses
-func (app *WSApp) handlePermissionResponse(id, toolCallID, sessionID string, granted, denied, allowForSession bool, toolName, action, path string) {
+// handlePermissionResponse handles permission grant/deny responses.
+// reason is an optional note from the user that is passed on to the agent with a denial.
+// approvedHunks limits an edit grant to some hunks of the proposed diff, nil approves all.
+func (app *WSApp) handlePermissionResponse(id, toolCallID, sessionID string, granted, denied, allowForSession bool, toolName, action, path, reason string, approvedHunks []int) {
 	ctx := context.Background()
 	permissionChan := app.Permissions.Subscribe(ctx)
 
 	permissionReq := permission.PermissionRequest{
-		ID:         id,
-		ToolCallID: toolCallID,
-		SessionID:  sessionID,
-		ToolName:   toolName,
-		Action:     action,
-		Path:       path,
+		ID:            id,
+		ToolCallID:    toolCallID,
+		SessionID:     sessionID,
+		ToolName:      toolName,
+		Action:        action,
+		Path:          path,
+		Reason:        reason,
+		ApprovedHunks: approvedHunks,
 	}
 
 	// Check if this is a resumed permission request (tool call in awaiting_permission status)
@@ -175,7 +328,7 @@ func (app *WSApp) handlePermissionResponse(id, toolCallID, sessionID string, gra
 				"session_id", sessionID,
 				"granted", granted || allowForSession,
 			)
-			app.handleResumedPermissionResponse(ctx, toolCallID, sessionID, granted || allowForSession, toolName, action, path)
+			app.handleResumedPermissionResponse(ctx, toolCallID, sessionID, granted, allowForSession, toolName, action, path)
 			// Clean up subscription
 			go func() {
 				<-permissionChan
@@ -194,10 +347,10 @@ func (app *WSApp) handlePermissionResponse(id, toolCallID, sessionID string, gra
 		)
 		app.Permissions.GrantForSession(permissionReq)
 	} else if granted {
-		slog.Info("Permission granted by client", "tool_call_id", toolCallID, "session_id", sessionID)
+		slog.Info("Permission granted by client", "tool_call_id", toolCallID, "session_id", sessionID, "approved_hunks", approvedHunks)
 		app.Permissions.Grant(permissionReq)
 	} else if denied {
-		slog.Info("Permission denied by client", "tool_call_id", toolCallID, "session_id", sessionID)
+		slog.Info("Permission denied by client", "tool_call_id", toolCallID, "session_id", sessionID, "reason", reason)
 		app.Permissions.Deny(permissionReq)
 	}
 
@@ -207,7 +360,7 @@ func (app *WSApp) handlePermissionResponse(id, toolCallID, sessionID string, gra
 		if granted || allowForSession {
 			status = "granted"
 		}
-		if err := app.RedisStream.UpdatePermissionStatus(ctx, sessionID, toolCallID, status); err != nil {
+		if err := app.RedisStream.UpdatePermissionStatus(ctx, sessionID, toolCallID, status, reason); err != nil {
 			slog.Warn("Failed to update permission status in Redis", "error", err, "session_id", sessionID, "tool_call_id", toolCallID)
 		} else {
 			slog.Info("Permission status updated in Redis", "session_id", sessionID, "tool_call_id", toolCallID, "status", status)
@@ -220,34 +373,53 @@ func (app *WSApp) handlePermissionResponse(id, toolCallID, sessionID string, gra
 	}()
 }
 
-// handleCancelRequest handles agent cancellation requests
-func (app *WSApp) handleCancelRequest(sessionID string) {
+// handleCancelRequest handles agent cancellation requests. A soft cancel lets
+// the running tool finish before the turn stops, a hard cancel stops it mid-tool.
+func (app *WSApp) handleCancelRequest(sessionID string, mode agent.CancelMode) {
 	if sessionID == "" {
 		sessionID = app.currentSessionID
 	}
 	if sessionID != "" && app.AgentCoordinator != nil {
-		fmt.Printf("[CANCEL] Cancelling agent request for session: %s\n", sessionID)
-		slog.Info("Cancelling agent request", "sessionID", sessionID)
-		app.AgentCoordinator.Cancel(sessionID)
+		slog.Info("Cancelling agent request", "sessionID", sessionID, "mode", mode)
+		app.AgentCoordinator.CancelWithMode(sessionID, mode, message.CancelReasonUser)
+	}
+}
+
+// resolvePromptWorkdir validates the working directory requested for a prompt
+// against the workspace of the session's project. An empty directory keeps the
+// project default.
+func (app *WSApp) resolvePromptWorkdir(sessionID, cwd string) (string, error) {
+	if cwd == "" {
+		return "", nil
+	}
+	ctx := context.Background()
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get session: %w", err)
+	}
+	if sess.ProjectID == "" {
+		return "", errors.New("a working directory requires a session in a project")
+	}
+	proj, err := app.Projects.GetByID(ctx, sess.ProjectID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get project: %w", err)
 	}
+	return proj.ResolveWorkdir(cwd)
 }
 
 // resolveSessionID resolves the session ID from the message or creates a new session
 func (app *WSApp) resolveSessionID(msgSessionID string) string {
 	sessionID := msgSessionID
-	fmt.Println("Processing message, sessionID from message:", sessionID)
 
 	if sessionID == "" {
-		fmt.Println("No sessionID in message, checking currentSessionID:", app.currentSessionID)
 		if app.currentSessionID == "" {
-			fmt.Println("Creating new session...")
 			sess, err := app.Sessions.Create(context.Background(), "", "Web Session")
 			if err != nil {
 				slog.Error("Failed to create session", "error", err)
 				return ""
 			}
 			app.currentSessionID = sess.ID
-			fmt.Println("Created session with ID:", sess.ID)
+			slog.Info("Created session for client", "sessionID", sess.ID)
 		}
 		sessionID = app.currentSessionID
 	} else {
@@ -271,65 +443,66 @@ func (app *WSApp) markSessionConnected(sessionID string) {
 // ensureAgentInitialized ensures the AgentCoordinator is initialized
 func (app *WSApp) ensureAgentInitialized() bool {
 	if app.AgentCoordinator == nil {
-		fmt.Println("AgentCoordinator is nil, attempting to initialize...")
 		slog.Warn("AgentCoordinator not initialized, attempting to initialize now")
 		if err := app.InitCoderAgent(context.Background()); err != nil {
-			fmt.Println("Failed to initialize AgentCoordinator:", err)
 			slog.Error("Failed to initialize AgentCoordinator", "error", err)
 			return false
 		}
-		fmt.Println("AgentCoordinator initialized successfully")
-	} else {
-		fmt.Println("AgentCoordinator already initialized")
+		slog.Info("AgentCoordinator initialized")
 	}
 	return true
 }
 
 // processImageAttachments processes image attachments from the message
-func (app *WSApp) processImageAttachments(images []WSImageAttachment) []message.Attachment {
+// and resolves the references to images already sent in the session. A
+// reference that does not resolve rejects the prompt, the user asked for an
+// image the model would not see.
+func (app *WSApp) processImageAttachments(sessionID string, images []protocol.ImageAttachment) ([]message.Attachment, error) {
 	var attachments []message.Attachment
-	fmt.Println("=== 开始检查图片附件 ===")
-	fmt.Printf("收到的消息中包含图片数量: %d\n", len(images))
 
 	if len(images) == 0 {
-		fmt.Println("  - 没有图片附件")
-		return attachments
+		return attachments, nil
 	}
 
-	fmt.Printf("Processing %d image attachments\n", len(images))
+	slog.Debug("Processing image attachments", "sessionID", sessionID, "count", len(images))
 	minioClient := storage.GetMinIOClient()
 
 	for i, img := range images {
-		fmt.Printf("\n[图片 %d/%d] 开始处理\n", i+1, len(images))
-		fmt.Printf("  - URL: %s\n", img.URL)
-		fmt.Printf("  - Filename: %s\n", img.Filename)
-		fmt.Printf("  - MimeType: %s\n", img.MimeType)
-		fmt.Printf("Fetching image: %s\n", img.URL)
+		if img.Type == wsAttachmentReference {
+			ref := message.AttachmentReference{MessageID: img.MessageID, PartIndex: img.PartIndex}
+			stored, err := message.ResolveAttachmentReference(context.Background(), app.Messages, sessionID, ref)
+			if err != nil {
+				slog.Warn("Failed to resolve attachment reference", "session_id", sessionID, "message_id", img.MessageID, "part_index", img.PartIndex, "error", err)
+				return nil, err
+			}
+			slog.Debug("Resolved image reference", "messageID", img.MessageID, "part", img.PartIndex)
+			img.URL = stored.FilePath
+			img.MimeType = cmp.Or(img.MimeType, stored.MimeType)
+			img.Filename = cmp.Or(img.Filename, stored.FileName)
+		}
+		slog.Debug("Fetching image", "index", i, "url", img.URL, "filename", img.Filename, "mimeType", img.MimeType)
 
 		var imageData []byte
 		var mimeType string
 		var err error
 
-		// Check if it's a MinIO URL and fetch accordingly
-		if minioClient != nil && minioClient.IsMinIOURL(img.URL) {
-			fmt.Println("  - 检测到 MinIO URL，从 MinIO 获取图片")
+		// Check if it's a resumable upload or a MinIO URL and fetch accordingly
+		if uploadID, ok := upload.ParseURL(img.URL); ok {
+			imageData, mimeType, err = app.readUpload(sessionID, uploadID)
+		} else if minioClient != nil && minioClient.IsMinIOURL(img.URL) {
 			imageData, mimeType, err = minioClient.GetFile(context.Background(), img.URL)
 		} else {
 			// Fetch from external URL
-			fmt.Println("  - 检测到外部 URL，开始下载图片")
 			imageData, mimeType, err = wsFetchImageFromURL(img.URL)
 		}
 
 		if err != nil {
-			fmt.Printf("  ❌ Failed to fetch image %s: %v\n", img.URL, err)
 			slog.Error("Failed to fetch image", "url", img.URL, "error", err)
 			continue
 		}
-		fmt.Printf("  ✅ 图片下载成功！大小: %d bytes, MIME类型: %s\n", len(imageData), mimeType)
 
 		// Use provided mime type if available
 		if img.MimeType != "" {
-			fmt.Printf("  - 使用客户端提供的 MIME 类型: %s\n", img.MimeType)
 			mimeType = img.MimeType
 		}
 
@@ -338,9 +511,6 @@ func (app *WSApp) processImageAttachments(images []WSImageAttachment) []message.
 			// Extract filename from URL
 			parts := strings.Split(img.URL, "/")
 			filename = parts[len(parts)-1]
-			fmt.Printf("  - 从 URL 提取文件名: %s\n", filename)
-		} else {
-			fmt.Printf("  - 使用客户端提供的文件名: %s\n", filename)
 		}
 
 		attachments = append(attachments, message.Attachment{
@@ -349,30 +519,71 @@ func (app *WSApp) processImageAttachments(images []WSImageAttachment) []message.
 			MimeType: mimeType,
 			Content:  imageData,
 		})
-		fmt.Printf("  ✅ Image attachment added: %s (%s, %d bytes)\n", filename, mimeType, len(imageData))
-		fmt.Printf("[图片 %d/%d] 处理完成\n", i+1, len(images))
+		slog.Debug("Image attachment added", "filename", filename, "mimeType", mimeType, "size", len(imageData))
+	}
+
+	return attachments, nil
+}
+
+// readUpload reads a completed upload of the owner of the session's project.
+func (app *WSApp) readUpload(sessionID, uploadID string) ([]byte, string, error) {
+	minioClient := storage.GetMinIOClient()
+	if app.db == nil || minioClient == nil {
+		return nil, "", upload.ErrStorageUnavailable
+	}
+	ctx := context.Background()
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get session: %w", err)
+	}
+	proj, err := app.Projects.GetByID(ctx, sess.ProjectID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get project: %w", err)
 	}
 
-	fmt.Printf("\n=== 图片处理完成，共添加 %d 个附件 ===\n\n", len(attachments))
-	return attachments
+	reader, u, err := upload.NewService(app.db, minioClient, upload.Limits{}).Open(ctx, proj.UserID, uploadID)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	return data, u.MimeType, nil
 }
 
 // runAgentViaPool submits an agent task to the worker pool for execution.
-// Returns an error if the pool is full or shutting down.
+// prompt.agent selects the agent running the prompt, the coder when empty.
+// Returns an error if the pool is full or shutting down, or the instance drains.
 // This method provides bounded concurrency control.
-func (app *WSApp) runAgentViaPool(sessionID, content string, attachments []message.Attachment) error {
+func (app *WSApp) runAgentViaPool(prompt queuedPrompt) error {
+	sessionID := prompt.sessionID
+	if app.draining.Load() {
+		return errDraining
+	}
+	// Webhook and blueprint runs have no client message to route, take the session for the run
+	if owner := app.claimSession(sessionID); owner != "" {
+		slog.Warn("Running prompt of a session owned by another instance", "session_id", sessionID, "owner", owner)
+	}
 	if app.AgentWorkerPool == nil {
 		// Fall back to direct execution if pool not initialized
 		slog.Warn("[GOROUTINE] Worker pool not available, falling back to direct execution")
-		app.runAgentAsync(sessionID, content, attachments)
+		app.runAgentAsync(prompt)
 		return nil
 	}
 
 	task := agent.AgentTask{
-		SessionID:   sessionID,
-		Prompt:      content,
-		Attachments: attachments,
-		ResultChan:  make(chan agent.AgentTaskResult, 1),
+		SessionID:      sessionID,
+		Prompt:         prompt.content,
+		Attachments:    prompt.attachments,
+		Agent:          prompt.agent,
+		WorkingDir:     prompt.workingDir,
+		PlanMode:       prompt.planMode,
+		ResumeToolCall: prompt.resumeToolCall,
+		BusyPolicy:     prompt.busyPolicy,
+		ModelOverride:  prompt.modelOverride,
+		ResultChan:     make(chan agent.AgentTaskResult, 1),
 	}
 
 	if err := app.AgentWorkerPool.Submit(context.Background(), task); err != nil {
@@ -392,19 +603,29 @@ func (app *WSApp) runAgentViaPool(sessionID, content string, attachments []messa
 
 // runAgentAsync runs the agent asynchronously (fallback when worker pool is not available)
 // Note: This uses the same lifecycle pattern as the worker pool for consistency
-func (app *WSApp) runAgentAsync(sessionID, content string, attachments []message.Attachment) {
-	fmt.Println("\n=== About to call AgentCoordinator.Run in goroutine ===")
-	fmt.Printf("准备传递的附件数量: %d\n", len(attachments))
-	for i, att := range attachments {
-		fmt.Printf("  [附件 %d] FileName: %s, MimeType: %s, Size: %d bytes\n",
-			i+1, att.FileName, att.MimeType, len(att.Content))
-	}
+func (app *WSApp) runAgentAsync(prompt queuedPrompt) {
+	sessionID, attachments := prompt.sessionID, prompt.attachments
+	slog.Debug("Running agent", "sessionID", sessionID, "attachments", len(attachments))
 
 	go func() {
-		fmt.Printf("\n[GOROUTINE] 🚀 Session Agent Goroutine 创建 | sessionID=%s\n", sessionID)
-		defer fmt.Printf("[GOROUTINE] 🛑 Session Agent Goroutine 退出 | sessionID=%s\n", sessionID)
-
 		ctx := context.Background()
+		if prompt.workingDir != "" {
+			ctx = context.WithValue(ctx, tools.WorkingDirContextKey, prompt.workingDir)
+		}
+		if prompt.planMode {
+			ctx = context.WithValue(ctx, tools.PlanModeContextKey, true)
+		}
+		if prompt.resumeToolCall != "" {
+			ctx = context.WithValue(ctx, tools.ResumeToolCallContextKey, prompt.resumeToolCall)
+		}
+		if prompt.busyPolicy != "" {
+			ctx = context.WithValue(ctx, tools.BusyPolicyContextKey, prompt.busyPolicy)
+		}
+		if prompt.modelOverride != nil {
+			ctx = context.WithValue(ctx, tools.ModelOverrideContextKey, prompt.modelOverride)
+		}
+		ctx = app.withProjectSecrets(ctx, sessionID)
+		ctx = app.withSessionEnv(ctx, sessionID)
 
 		// === LIFECYCLE: Task Start ===
 		slog.Info("[LIFECYCLE] Agent task started (async)", "session_id", sessionID)
@@ -417,15 +638,18 @@ func (app *WSApp) runAgentAsync(sessionID, content string, attachments []message
 			}
 		}
 		app.sendSessionStatusUpdate(sessionID, storeredis.SessionStatusRunning)
+		app.startTurnMetrics(ctx, sessionID)
+		app.snapshotBeforeRun(sessionID)
+		app.watchFiles(sessionID)
 
 		// === Execute Agent ===
-		_, err := app.AgentCoordinator.Run(ctx, sessionID, content, attachments...)
+		_, err := app.AgentCoordinator.RunAgent(ctx, prompt.agent, sessionID, prompt.content, attachments...)
 
 		// === LIFECYCLE: Task Complete ===
 		var finalStatus storeredis.SessionRunningStatus
 		var reason string
 		if err != nil {
-			if ctx.Err() == context.Canceled {
+			if ctx.Err() == context.Canceled || errors.Is(err, context.Canceled) {
 				finalStatus = storeredis.SessionStatusCancelled
 				reason = "cancelled"
 			} else {
@@ -446,26 +670,22 @@ func (app *WSApp) runAgentAsync(sessionID, content string, attachments []message
 			if setErr := app.RedisStream.SetActiveGeneration(ctx, sessionID, false); setErr != nil {
 				slog.Warn("Failed to mark generation as complete", "error", setErr)
 			}
-			if pubErr := app.RedisStream.PublishMessage(ctx, sessionID, "generation_complete", map[string]interface{}{
-				"session_id": sessionID,
-				"status":     string(finalStatus),
-				"error":      err != nil,
-			}); pubErr != nil {
-				slog.Warn("Failed to publish generation complete event", "error", pubErr)
-			}
+			app.publishGenerationComplete(ctx, sessionID, finalStatus, err)
 		}
+		app.collectTurnKeys(context.Background(), sessionID)
+		app.releaseIdleSession(sessionID)
 		app.sendSessionStatusUpdate(sessionID, finalStatus)
+		app.recordTurnMetrics(ctx, sessionID, finalStatus)
+		app.unwatchFiles(sessionID)
 
 		if err != nil {
 			slog.Error("Agent run error", "error", err)
 		}
 	}()
-	fmt.Println("Goroutine started, HandleClientMessage returning")
 }
 
 // handleReconnection handles client reconnection and sends missed messages
 func (app *WSApp) handleReconnection(sessionID string, lastMsgID string) {
-	fmt.Printf("=== handleReconnection called for session %s, lastMsgID: %s ===\n", sessionID, lastMsgID)
 	slog.Info("Handling reconnection", "sessionID", sessionID, "lastMsgID", lastMsgID)
 
 	if sessionID == "" {
@@ -496,54 +716,26 @@ func (app *WSApp) handleReconnection(sessionID string, lastMsgID string) {
 		return
 	}
 
-	fmt.Printf("Found %d missed messages for session %s\n", len(messages), sessionID)
 	slog.Info("Replaying missed messages", "sessionID", sessionID, "count", len(messages))
 
 	// Send missed messages to the client
 	for _, msg := range messages {
 		// Skip permission-related messages during replay - they are managed separately
 		// via pending permissions state (not in stream anymore, but skip for backwards compatibility)
-		if msg.Type == "permission_request" || msg.Type == "permission_notification" {
+		if msg.Type == protocol.TypePermissionRequest || msg.Type == protocol.TypePermissionNotification {
 			slog.Debug("Skipping permission message during replay", "type", msg.Type, "streamId", msg.ID)
 			continue
 		}
 
 		// Skip tool_call_update messages during replay - we'll send the latest state separately
 		// This prevents showing outdated tool status (e.g., pending when it's already completed)
-		if msg.Type == "tool_call_update" {
+		if msg.Type == protocol.TypeToolCallUpdate {
 			slog.Debug("Skipping tool_call_update during replay, will send latest state", "streamId", msg.ID)
 			continue
 		}
 
-		// Handle stream_delta messages - send them directly without wrapping
-		if msg.Type == "stream_delta" {
-			var deltaPayload map[string]interface{}
-			if err := json.Unmarshal(msg.Payload, &deltaPayload); err != nil {
-				slog.Warn("Failed to unmarshal stream_delta payload", "error", err)
-				continue
-			}
-			// Add replay metadata and stream ID
-			deltaPayload["Type"] = "stream_delta"
-			deltaPayload["_replay"] = true
-			deltaPayload["_streamId"] = msg.ID
-			app.WSServer.SendToSession(sessionID, deltaPayload)
-			continue
-		}
-
-		var payload interface{}
-		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
-			slog.Warn("Failed to unmarshal message payload", "error", err)
-			continue
-		}
-
-		// Send the message with its original type
-		app.WSServer.SendToSession(sessionID, map[string]interface{}{
-			"_replay":    true,
-			"_streamId":  msg.ID,
-			"_type":      msg.Type,
-			"_timestamp": msg.Timestamp,
-			"_payload":   payload,
-		})
+		// Send the message with its original type and sequence number
+		app.sendStreamMessage(sessionID, msg, protocol.ReplayReconnect)
 	}
 
 	// Send latest tool call states from Redis (real-time status)
@@ -554,29 +746,25 @@ func (app *WSApp) handleReconnection(sessionID string, lastMsgID string) {
 		} else if len(toolCallStates) > 0 {
 			slog.Info("Sending latest tool call states on reconnection", "sessionID", sessionID, "count", len(toolCallStates))
 			for _, state := range toolCallStates {
-				toolCallMsg := map[string]interface{}{
-					"Type":       "tool_call_update",
-					"id":         state.ID,
-					"session_id": state.SessionID,
-					"message_id": state.MessageID,
-					"name":       state.Name,
-					"input":      state.Input,
-					"status":     state.Status,
-				}
-				app.WSServer.SendToSession(sessionID, toolCallMsg)
+				app.send(sessionID, protocol.ToolCallUpdate{
+					ID:        state.ID,
+					SessionID: state.SessionID,
+					MessageID: state.MessageID,
+					Name:      state.Name,
+					Input:     state.Input,
+					Status:    state.Status,
+				}, 0)
 
 				// If tool is not pending, it means permission was already granted/denied
 				// Send permission_notification to clear the permission card in frontend
 				if state.Status != "pending" {
 					granted := state.Status == "running" || state.Status == "completed"
 					denied := state.Status == "error" || state.Status == "cancelled"
-					permNotif := map[string]interface{}{
-						"Type":         "permission_notification",
-						"tool_call_id": state.ID,
-						"granted":      granted,
-						"denied":       denied,
-					}
-					app.WSServer.SendToSession(sessionID, permNotif)
+					app.send(sessionID, protocol.PermissionNotification{
+						ToolCallID: state.ID,
+						Granted:    granted,
+						Denied:     denied,
+					}, 0)
 				}
 			}
 		}
@@ -589,18 +777,17 @@ func (app *WSApp) handleReconnection(sessionID string, lastMsgID string) {
 	} else if len(pendingPerms) > 0 {
 		slog.Info("Sending pending permissions on reconnection", "sessionID", sessionID, "count", len(pendingPerms))
 		for _, perm := range pendingPerms {
-			permMsg := map[string]interface{}{
-				"Type":         "permission_request",
-				"id":           perm.ID,
-				"session_id":   perm.SessionID,
-				"tool_call_id": perm.ToolCallID,
-				"tool_name":    perm.ToolName,
-				"description":  perm.Description,
-				"action":       perm.Action,
-				"params":       perm.Params,
-				"path":         perm.Path,
-			}
-			app.WSServer.SendToSession(sessionID, permMsg)
+			app.send(sessionID, protocol.PermissionRequest{
+				ID:             perm.ID,
+				SessionID:      perm.SessionID,
+				ToolCallID:     perm.ToolCallID,
+				ToolName:       perm.ToolName,
+				Description:    perm.Description,
+				Action:         perm.Action,
+				Params:         perm.Params,
+				ParamsRedacted: perm.ParamsRedacted,
+				Path:           perm.Path,
+			}, 0)
 		}
 	}
 
@@ -630,15 +817,14 @@ func (app *WSApp) handleReconnection(sessionID string, lastMsgID string) {
 	isRunning := sessionStatus == storeredis.SessionStatusRunning || isActive
 
 	// Notify client about reconnection status including session running status
-	app.WSServer.SendToSession(sessionID, map[string]interface{}{
-		"Type":              "reconnection_status",
-		"session_id":        sessionID,
-		"messages_replayed": len(messages),
-		"generation_active": isActive,
-		"session_status":    string(sessionStatus),
-		"is_running":        isRunning,
-		"last_stream_id":    newLastID,
-	})
+	app.send(sessionID, protocol.ReconnectionStatus{
+		SessionID:        sessionID,
+		MessagesReplayed: len(messages),
+		GenerationActive: isActive,
+		SessionStatus:    string(sessionStatus),
+		IsRunning:        isRunning,
+		LastStreamID:     newLastID,
+	}, 0)
 
 	// Send current session info including context_window
 	app.sendSessionUpdate(ctx, sessionID)
@@ -646,7 +832,10 @@ func (app *WSApp) handleReconnection(sessionID string, lastMsgID string) {
 	// Send current todos if available
 	app.sendTodosOnReconnect(ctx, sessionID)
 
-	fmt.Printf("Reconnection complete for session %s\n", sessionID)
+	// Send who else is in the session
+	app.sendPresence(ctx, sessionID)
+
+	slog.Info("Reconnection complete", "sessionID", sessionID)
 }
 
 // sendTodosOnReconnect sends the current session's todos to the client on WebSocket reconnection
@@ -682,53 +871,29 @@ func (app *WSApp) sendSessionUpdate(ctx context.Context, sessionID string) {
 	slog.Info("Sending session update on connect", "sessionID", sessionID, "context_window", contextWindow, "cost", sess.Cost)
 
 	// Send session update to client
-	sessionMsg := map[string]interface{}{
-		"Type":              "session_update",
-		"id":                sessionID,
-		"project_id":        sess.ProjectID,
-		"title":             sess.Title,
-		"message_count":     sess.MessageCount,
-		"prompt_tokens":     sess.PromptTokens,
-		"completion_tokens": sess.CompletionTokens,
-		"cost":              sess.Cost,
-		"context_window":    contextWindow,
-		"created_at":        sess.CreatedAt,
-		"updated_at":        sess.UpdatedAt,
-	}
-
-	app.WSServer.SendToSession(sessionID, sessionMsg)
+	app.send(sessionID, sessionUpdate(sess, contextWindow), 0)
 }
 
 // wsFetchImageFromURL fetches an image from an external URL
 func wsFetchImageFromURL(url string) ([]byte, string, error) {
-	fmt.Printf("    → 开始 HTTP GET 请求: %s\n", url)
 	resp, err := http.Get(url)
 	if err != nil {
-		fmt.Printf("    ❌ HTTP 请求失败: %v\n", err)
 		return nil, "", fmt.Errorf("failed to fetch image: %w", err)
 	}
 	defer resp.Body.Close()
 
-	fmt.Printf("    → HTTP 状态码: %d\n", resp.StatusCode)
 	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("    ❌ HTTP 状态码错误: %d\n", resp.StatusCode)
 		return nil, "", fmt.Errorf("failed to fetch image: status %d", resp.StatusCode)
 	}
 
-	fmt.Println("    → 开始读取响应数据...")
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("    ❌ 读取数据失败: %v\n", err)
 		return nil, "", fmt.Errorf("failed to read image data: %w", err)
 	}
-	fmt.Printf("    → 读取完成，数据大小: %d bytes\n", len(data))
 
 	mimeType := resp.Header.Get("Content-Type")
 	if mimeType == "" {
 		mimeType = http.DetectContentType(data)
-		fmt.Printf("    → 自动检测 MIME 类型: %s\n", mimeType)
-	} else {
-		fmt.Printf("    → 从响应头获取 MIME 类型: %s\n", mimeType)
 	}
 
 	return data, mimeType, nil
@@ -761,28 +926,27 @@ func (app *WSApp) checkAndSendAwaitingPermissionToolCalls(ctx context.Context, s
 
 	// Send each awaiting permission tool call as a permission request to the client
 	for _, tc := range toolCalls {
-		permMsg := map[string]interface{}{
-			"Type":            "permission_request",
-			"id":              tc.ID,
-			"session_id":      tc.SessionID,
-			"tool_call_id":    tc.ID,
-			"tool_name":       tc.Name,
-			"description":     fmt.Sprintf("Tool %s requires permission (resumed from previous session)", tc.Name),
-			"action":          tc.PermissionAction.String,
-			"path":            tc.PermissionPath.String,
-			"original_prompt": tc.OriginalPrompt.String,
-			"_resumed":        true, // Mark as resumed for frontend
-		}
-
-		// Parse input if available
+		permMsg := protocol.PermissionRequest{
+			ID:             tc.ID,
+			SessionID:      tc.SessionID,
+			ToolCallID:     tc.ID,
+			ToolName:       tc.Name,
+			Description:    fmt.Sprintf("Tool %s requires permission (resumed from previous session)", tc.Name),
+			Action:         tc.PermissionAction.String,
+			Path:           tc.PermissionPath.String,
+			OriginalPrompt: tc.OriginalPrompt.String,
+			Resumed:        true, // Mark as resumed for frontend
+		}
+
+		// Parse input if available, the full input is the tool call's
 		if tc.Input.Valid && tc.Input.String != "" {
 			var params interface{}
 			if err := json.Unmarshal([]byte(tc.Input.String), &params); err == nil {
-				permMsg["params"] = params
+				permMsg.Params, permMsg.ParamsRedacted = app.permissionParams.Redact(params)
 			}
 		}
 
-		app.WSServer.SendToSession(sessionID, permMsg)
+		app.send(sessionID, permMsg, 0)
 		slog.Info("[GOROUTINE] Sent awaiting permission request to client",
 			"sessionID", sessionID,
 			"toolCallID", tc.ID,
@@ -791,9 +955,9 @@ func (app *WSApp) checkAndSendAwaitingPermissionToolCalls(ctx context.Context, s
 	}
 }
 
-// handleResumedPermissionResponse handles permission response for a resumed (previously timed out) tool call
-// It updates the database and re-submits the original task to the agent
-func (app *WSApp) handleResumedPermissionResponse(ctx context.Context, toolCallID, sessionID string, granted bool, toolName, action, path string) {
+// handleResumedPermissionResponse handles permission response for a resumed (previously timed out) tool call.
+// A grant runs the suspended call as it was made, then the agent goes on from its result.
+func (app *WSApp) handleResumedPermissionResponse(ctx context.Context, toolCallID, sessionID string, granted, allowForSession bool, toolName, action, path string) {
 	if app.db == nil {
 		slog.Warn("Database not available, cannot handle resumed permission response")
 		return
@@ -815,51 +979,37 @@ func (app *WSApp) handleResumedPermissionResponse(ctx context.Context, toolCallI
 		return
 	}
 
-	if granted {
-		slog.Info("[GOROUTINE] Resumed permission granted, re-submitting task",
+	if granted || allowForSession {
+		slog.Info("[GOROUTINE] Resumed permission granted, resuming tool call",
 			"sessionID", sessionID,
 			"toolCallID", toolCallID,
 			"toolName", toolCall.Name,
 		)
 
-		// Update tool call status to running
-		if err := app.db.UpdateToolCallPermissionGranted(ctx, toolCallID); err != nil {
-			slog.Error("Failed to update tool call permission granted", "error", err)
-		}
-
-		// Add to session allowlist so the re-run will pass permission check
-		if app.RedisStream != nil {
-			// Grant for session via the permission service which handles allowlist properly
-			permReq := permission.PermissionRequest{
+		// The suspended call asks again when it runs, it is granted without asking
+		app.Permissions.GrantToolCall(toolCallID)
+		if allowForSession {
+			app.Permissions.GrantForSession(permission.PermissionRequest{
 				ID:         toolCallID,
 				SessionID:  sessionID,
 				ToolCallID: toolCallID,
-				ToolName:   toolName,
-				Action:     action,
-				Path:       path,
-			}
-			app.Permissions.GrantForSession(permReq)
+				ToolName:   cmp.Or(toolName, toolCall.Name),
+				Action:     cmp.Or(action, toolCall.PermissionAction.String),
+				Path:       cmp.Or(path, toolCall.PermissionPath.String),
+			})
 		}
 
-		// Re-submit the original task to the agent via worker pool
-		if toolCall.OriginalPrompt.Valid && toolCall.OriginalPrompt.String != "" {
-			slog.Info("[GOROUTINE] Re-running agent with original prompt",
-				"sessionID", sessionID,
-				"prompt_length", len(toolCall.OriginalPrompt.String),
-			)
-			// Run agent via worker pool with the original prompt
-			if err := app.runAgentViaPool(sessionID, toolCall.OriginalPrompt.String, nil); err != nil {
-				slog.Error("[GOROUTINE] Failed to re-submit resumed task",
-					"session_id", sessionID,
-					"error", err,
-				)
-				app.sendErrorToClient(sessionID, "系统繁忙，无法恢复任务 (503)")
-			}
-		} else {
-			slog.Warn("No original prompt found for resumed task, cannot re-run",
-				"sessionID", sessionID,
-				"toolCallID", toolCallID,
+		// Run the suspended call then the rest of the task via worker pool
+		if err := app.runAgentViaPool(queuedPrompt{
+			sessionID:      sessionID,
+			content:        agent.ResumedToolCallPrompt(toolCall.Name),
+			resumeToolCall: toolCallID,
+		}); err != nil {
+			slog.Error("[GOROUTINE] Failed to re-submit resumed task",
+				"session_id", sessionID,
+				"error", err,
 			)
+			app.sendError(sessionID, "系统繁忙，无法恢复任务 (503)", classifyError(err))
 		}
 	} else {
 		slog.Info("[GOROUTINE] Resumed permission denied",
@@ -874,11 +1024,28 @@ func (app *WSApp) handleResumedPermissionResponse(ctx context.Context, toolCallI
 	}
 }
 
-// sendErrorToClient sends an error message to the client via WebSocket
-func (app *WSApp) sendErrorToClient(sessionID, errorMessage string) {
-	app.WSServer.SendToSession(sessionID, map[string]interface{}{
-		"Type":       "error",
-		"session_id": sessionID,
-		"error":      errorMessage,
-	})
+// sendErrorToClient sends an error to the client via WebSocket, with its
+// classification for the client to act on its code rather than the message
+func (app *WSApp) sendErrorToClient(sessionID string, err error) {
+	app.sendError(sessionID, err.Error(), classifyError(err))
+}
+
+// sendError sends an error message with the given classification
+func (app *WSApp) sendError(sessionID, errorMessage string, info apierr.Error) {
+	app.send(sessionID, protocol.NewError(sessionID, errorMessage, info), 0)
+}
+
+// classifyError returns the API error of a failed client message or run
+func classifyError(err error) apierr.Error {
+	switch {
+	case isProjectPausedErr(err):
+		return apierr.New(apierr.CodeProjectPaused, "")
+	case errors.Is(err, project.ErrWorkdirOutsideProject):
+		return apierr.New(apierr.CodeInvalidRequest, "")
+	case errors.Is(err, message.ErrMessageNotInSession):
+		return apierr.New(apierr.CodeNotFound, "")
+	case errors.Is(err, message.ErrInvalidAttachmentReference):
+		return apierr.New(apierr.CodeInvalidRequest, "")
+	}
+	return agent.ClassifyError(err)
 }
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+const (
+	// defaultDrainTimeout bounds how long a drain waits for the running turns.
+	defaultDrainTimeout = 5 * time.Minute
+	// drainPollInterval is how often a drain checks for running turns.
+	drainPollInterval = time.Second
+)
+
+// errDraining rejects the prompts sent to a draining instance.
+var errDraining = errors.New("server is draining, retry on another instance")
+
+// StartDrain drains the instance in the background for a rolling restart:
+// new connections and prompts are rejected, the running turns are waited for
+// up to the drain timeout, and Drained is closed once the state is flushed.
+// Draining again is a no-op.
+func (app *WSApp) StartDrain() {
+	if !app.draining.CompareAndSwap(false, true) {
+		return
+	}
+	go app.drain()
+}
+
+// Drained is closed when a drain is done and the process can exit.
+func (app *WSApp) Drained() <-chan struct{} {
+	return app.drained
+}
+
+func (app *WSApp) drain() {
+	defer close(app.drained)
+	timeout := defaultDrainTimeout
+	if appCfg := config.GetGlobalAppConfig(); appCfg != nil && appCfg.Server.DrainTimeout > 0 {
+		timeout = time.Duration(appCfg.Server.DrainTimeout) * time.Second
+	}
+	slog.Info("Draining WS instance", "timeout", timeout)
+
+	app.WSServer.SetDraining()
+	// Clients without a running turn can reconnect to another instance now
+	app.WSServer.Broadcast(protocol.ServerDraining{RetryAfter: int(timeout.Seconds())})
+
+	ctx, cancel := context.WithTimeout(app.globalCtx, timeout)
+	defer cancel()
+	if err := app.waitForRuns(ctx); err != nil {
+		slog.Warn("Drain timed out, running turns are cancelled on shutdown", "error", err)
+	}
+
+	// Flush the buffered writes and hand the sessions over to the other instances
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer flushCancel()
+	if err := app.Messages.Flush(flushCtx); err != nil {
+		slog.Warn("Failed to flush messages on drain", "error", err)
+	}
+	if err := app.ToolCalls.Flush(flushCtx); err != nil {
+		slog.Warn("Failed to flush tool calls on drain", "error", err)
+	}
+	if app.Ownership != nil {
+		if err := app.Ownership.ReleaseAll(flushCtx); err != nil {
+			slog.Warn("Failed to release session ownership on drain", "error", err)
+		}
+	}
+	slog.Info("WS instance drained")
+}
+
+// waitForRuns waits until no turn runs or waits for a worker, or ctx is done.
+func (app *WSApp) waitForRuns(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		active, queued := app.activeRuns()
+		if active == 0 && queued == 0 {
+			return nil
+		}
+		slog.Info("Waiting for running turns to drain", "active", active, "queued", queued)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// activeRuns returns how many turns run and how many prompts wait for a worker.
+func (app *WSApp) activeRuns() (active int64, queued int) {
+	if app.AgentWorkerPool != nil {
+		stats := app.AgentWorkerPool.Stats()
+		active, queued = stats.ActiveWorkers, stats.QueuedTasks
+	}
+	if active == 0 && app.AgentCoordinator != nil && app.AgentCoordinator.IsBusy() {
+		active = 1
+	}
+	return active, queued
+}
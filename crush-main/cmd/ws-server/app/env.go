@@ -0,0 +1,86 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/tidwall/sjson"
+)
+
+// handleSetEnv replaces the environment variables of the tools of a session,
+// saved in its config as options.env, and answers with an env_updated event.
+// An empty env clears them.
+func (app *WSApp) handleSetEnv(sessionID string, env map[string]string) {
+	if sessionID == "" || app.db == nil {
+		return
+	}
+	if err := config.SessionEnv(env).Validate(); err != nil {
+		app.sendError(sessionID, err.Error(), apierr.New(apierr.CodeInvalidRequest, ""))
+		return
+	}
+
+	ctx := context.Background()
+	configJSON, err := app.db.GetSessionConfigJSON(ctx, sessionID)
+	if err == nil {
+		// Only the env key is replaced, the other keys are kept
+		if len(env) == 0 {
+			configJSON, err = sjson.Delete(cmp.Or(configJSON, "{}"), "options.env")
+		} else {
+			configJSON, err = sjson.Set(cmp.Or(configJSON, "{}"), "options.env", env)
+		}
+	}
+	if err == nil {
+		err = app.db.SaveConfigJSON(ctx, sessionID, configJSON)
+	}
+	if err != nil {
+		slog.Warn("Failed to set session env", "session_id", sessionID, "error", err)
+		app.sendErrorToClient(sessionID, err)
+		return
+	}
+	slog.Info("Set session env", "session_id", sessionID, "count", len(env))
+
+	if env == nil {
+		env = map[string]string{}
+	}
+	event := protocol.EnvUpdated{SessionID: sessionID, Env: env}
+	seq := app.publishEvent(ctx, sessionID, event)
+	app.send(sessionID, event, seq)
+}
+
+// withSessionEnv sets the environment variables of the session for the
+// commands the run executes and the URLs it fetches.
+func (app *WSApp) withSessionEnv(ctx context.Context, sessionID string) context.Context {
+	env := app.sessionEnv(ctx, sessionID)
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, tools.SessionEnvContextKey, map[string]string(env))
+}
+
+// sessionEnv returns the environment variables saved in the config of a
+// session, nil when it has none.
+func (app *WSApp) sessionEnv(ctx context.Context, sessionID string) config.SessionEnv {
+	if app.db == nil {
+		return nil
+	}
+	configJSON, err := app.db.GetSessionConfigJSON(ctx, sessionID)
+	if err != nil || configJSON == "" {
+		return nil
+	}
+	var sessionConfig struct {
+		Options struct {
+			Env config.SessionEnv `json:"env"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal([]byte(configJSON), &sessionConfig); err != nil {
+		slog.Warn("Ignoring invalid session config", "session_id", sessionID, "error", err)
+		return nil
+	}
+	return sessionConfig.Options.Env
+}
@@ -2,17 +2,19 @@ package app
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
 	tea "charm.land/bubbletea/v2"
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
 	"github.com/rolling1314/rolling-crush/domain/message"
 	"github.com/rolling1314/rolling-crush/domain/permission"
 	"github.com/rolling1314/rolling-crush/domain/session"
 	"github.com/rolling1314/rolling-crush/domain/toolcall"
 	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
 	"github.com/rolling1314/rolling-crush/internal/agent/tools/mcp"
 	internalapp "github.com/rolling1314/rolling-crush/internal/app"
 	"github.com/rolling1314/rolling-crush/internal/pkg/log"
@@ -27,9 +29,14 @@ func (app *WSApp) setupEvents() {
 	wsSetupSubscriber(ctx, app.serviceEventsWG, "toolcalls", app.ToolCalls.Subscribe, app.events)
 	wsSetupSubscriber(ctx, app.serviceEventsWG, "permissions", app.Permissions.Subscribe, app.events)
 	wsSetupSubscriber(ctx, app.serviceEventsWG, "permissions-notifications", app.Permissions.SubscribeNotifications, app.events)
+	wsSetupSubscriber(ctx, app.serviceEventsWG, "permissions-blocking", app.Permissions.SubscribeBlocking, app.events)
 	wsSetupSubscriber(ctx, app.serviceEventsWG, "history", app.History.Subscribe, app.events)
 	wsSetupSubscriber(ctx, app.serviceEventsWG, "mcp", mcp.SubscribeEvents, app.events)
 	wsSetupSubscriber(ctx, app.serviceEventsWG, "lsp", internalapp.SubscribeLSPEvents, app.events)
+	wsSetupSubscriber(ctx, app.serviceEventsWG, "lint", tools.SubscribeLintEvents, app.events)
+	wsSetupSubscriber(ctx, app.serviceEventsWG, "tool-output", tools.SubscribeToolOutput, app.events)
+	wsSetupSubscriber(ctx, app.serviceEventsWG, "queue", agent.SubscribeQueueUpdates, app.events)
+	wsSetupSubscriber(ctx, app.serviceEventsWG, "model-switches", agent.SubscribeModelSwitches, app.events)
 	// Subscribe to stream delta events for incremental streaming
 	wsSetupSubscriber(ctx, app.serviceEventsWG, "deltas", app.Messages.SubscribeDeltas, app.events)
 	cleanupFunc := func() error {
@@ -63,7 +70,6 @@ func wsSetupSubscriber[T any](
 				case <-time.After(10 * time.Second):
 					// Increased timeout from 2s to 10s to reduce message drops during heavy streaming
 					slog.Warn("message dropped due to slow consumer", "name", name)
-					fmt.Printf("[EVENT DROP] Message dropped for subscriber %s due to slow consumer\n", name)
 				case <-ctx.Done():
 					slog.Debug("subscription cancelled", "name", name)
 					return
@@ -78,7 +84,7 @@ func wsSetupSubscriber[T any](
 
 // Subscribe handles event processing and broadcasting.
 func (app *WSApp) Subscribe() {
-	fmt.Println("=== Subscribe() started - listening for events ===")
+	slog.Info("Subscribing to agent events")
 	defer log.RecoverPanic("app.Subscribe", func() {
 		slog.Info("Subscription panic: attempting graceful shutdown")
 	})
@@ -111,15 +117,18 @@ func (app *WSApp) Subscribe() {
 
 // handleEvent processes a single event from the events channel
 func (app *WSApp) handleEvent(msg tea.Msg) {
-	// DEBUG: 打印收到的事件类型
-	fmt.Printf("[EVENT] Received event type: %T\n", msg)
-
 	// Handle stream delta events for incremental streaming (highest priority for low latency)
 	if event, ok := msg.(pubsub.Event[message.StreamDelta]); ok {
 		app.handleStreamDeltaEvent(event)
 		return
 	}
 
+	// Live output of running tool calls, e.g. bash builds and test runs
+	if event, ok := msg.(pubsub.Event[tools.ToolOutputDelta]); ok {
+		app.handleToolOutputEvent(event)
+		return
+	}
+
 	// Send messages to specific session via WebSocket
 	if event, ok := msg.(pubsub.Event[message.Message]); ok {
 		app.handleMessageEvent(event)
@@ -140,71 +149,68 @@ func (app *WSApp) handleEvent(msg tea.Msg) {
 		app.handlePermissionNotificationEvent(event)
 	}
 
+	// Escalate permission requests blocking a run for too long
+	if event, ok := msg.(pubsub.Event[permission.PermissionBlocking]); ok {
+		app.handlePermissionBlockingEvent(event)
+	}
+
 	// Send session updates to specific session via WebSocket (like TUI does)
 	if event, ok := msg.(pubsub.Event[session.Session]); ok {
 		app.handleSessionEvent(event)
 	}
-}
-
-// handleStreamDeltaEvent handles incremental streaming delta events
-func (app *WSApp) handleStreamDeltaEvent(event pubsub.Event[message.StreamDelta]) {
-	sessionID := event.Payload.SessionID
-	fmt.Printf("[DELTA] Sending delta to session: MessageID=%s, Type=%s, SessionID=%s, ContentLen=%d\n",
-		event.Payload.MessageID, event.Payload.DeltaType, sessionID, len(event.Payload.Content))
 
-	// Publish delta to Redis stream for buffering (enables reconnection replay)
-	if app.RedisStream != nil {
-		ctx := context.Background()
-		if err := app.RedisStream.PublishMessage(ctx, sessionID, "stream_delta", event.Payload); err != nil {
-			slog.Warn("Failed to publish delta to Redis stream", "error", err)
-		}
+	// Send lint findings to specific session via WebSocket
+	if event, ok := msg.(pubsub.Event[tools.LintEvent]); ok {
+		app.handleLintEvent(event)
 	}
 
-	// Build the delta message for WebSocket
-	deltaMsg := map[string]interface{}{
-		"Type":       "stream_delta",
-		"message_id": event.Payload.MessageID,
-		"session_id": sessionID,
-		"delta_type": string(event.Payload.DeltaType),
-		"content":    event.Payload.Content,
-		"timestamp":  event.Payload.Timestamp,
+	// Send the prompts queued behind the running turn
+	if event, ok := msg.(pubsub.Event[agent.QueueUpdate]); ok {
+		app.handleQueueUpdateEvent(event)
 	}
 
-	// Add optional fields if present
-	if event.Payload.ToolCallID != "" {
-		deltaMsg["tool_call_id"] = event.Payload.ToolCallID
-	}
-	if event.Payload.ToolCallName != "" {
-		deltaMsg["tool_call_name"] = event.Payload.ToolCallName
-	}
-	if event.Payload.FinishReason != "" {
-		deltaMsg["finish_reason"] = event.Payload.FinishReason
+	// Tell the clients which model answers once a turn fails over
+	if event, ok := msg.(pubsub.Event[agent.ModelSwitch]); ok {
+		app.handleModelSwitchEvent(event)
 	}
+}
+
+// handleStreamDeltaEvent handles incremental streaming delta events, sent
+// once coalesced
+func (app *WSApp) handleStreamDeltaEvent(event pubsub.Event[message.StreamDelta]) {
+	app.deltas.add(event.Payload)
+}
 
-	// Send via WebSocket - always try to send (SendToSession handles missing clients)
-	app.WSServer.SendToSession(sessionID, deltaMsg)
+// handleToolOutputEvent sends a chunk of the output of a running tool call.
+// The chunks are buffered in Redis like stream deltas, so reconnecting clients
+// can replay the terminal output of a tool call still running.
+func (app *WSApp) handleToolOutputEvent(event pubsub.Event[tools.ToolOutputDelta]) {
+	sessionID := event.Payload.SessionID
+	output := protocol.ToolCallOutputDelta{ToolOutputDelta: event.Payload}
+	seq := app.publishEvent(context.Background(), sessionID, output)
+	app.send(sessionID, output, seq)
 }
 
 // handleMessageEvent handles message events
 func (app *WSApp) handleMessageEvent(event pubsub.Event[message.Message]) {
 	sessionID := event.Payload.SessionID
-	fmt.Printf("[SEND] Sending message to session: ID=%s, Role=%s, SessionID=%s\n", event.Payload.ID, event.Payload.Role, sessionID)
+	// Clients build the assistant message from its deltas while it streams,
+	// it is sent whole again once finished
+	if event.Type == pubsub.UpdatedEvent && event.Payload.Role == message.Assistant && !event.Payload.IsFinished() {
+		return
+	}
+	slog.Debug("Sending message", "sessionID", sessionID, "messageID", event.Payload.ID, "role", event.Payload.Role)
 
 	// Always publish to Redis stream for buffering
-	if app.RedisStream != nil {
-		ctx := context.Background()
-		if err := app.RedisStream.PublishMessage(ctx, sessionID, "message", event.Payload); err != nil {
-			slog.Warn("Failed to publish message to Redis stream", "error", err)
-		}
-	}
+	msg := protocol.Message{Message: event.Payload}
+	seq := app.publishEvent(context.Background(), sessionID, msg)
 
 	// Check if session is connected before sending via WebSocket
 	isConnected, _ := app.connectedSessions.Get(sessionID)
-	fmt.Printf("[SEND] Session %s connected status: %v\n", sessionID, isConnected)
 
 	// Always try to send via WebSocket - SendToSession handles the case where no clients match
 	// This ensures messages aren't lost due to stale connection state
-	app.WSServer.SendToSession(sessionID, event.Payload)
+	app.send(sessionID, msg, seq)
 
 	if !isConnected {
 		slog.Info("Session marked as disconnected but attempted WebSocket send anyway", "sessionID", sessionID)
@@ -216,31 +222,40 @@ func (app *WSApp) handlePermissionRequestEvent(event pubsub.Event[permission.Per
 	sessionID := event.Payload.SessionID
 	slog.Info("Sending permission request to session", "session_id", sessionID, "tool_call_id", event.Payload.ToolCallID)
 
-	permMsg := map[string]interface{}{
-		"Type":         "permission_request",
-		"id":           event.Payload.ID,
-		"session_id":   sessionID,
-		"tool_call_id": event.Payload.ToolCallID,
-		"tool_name":    event.Payload.ToolName,
-		"description":  event.Payload.Description,
-		"action":       event.Payload.Action,
-		"params":       event.Payload.Params,
-		"path":         event.Payload.Path,
+	// Clients get the parameters truncated and masked, the full ones are
+	// fetched through the HTTP API
+	params, redacted := app.permissionParams.Redact(event.Payload.Params)
+	permMsg := protocol.PermissionRequest{
+		ID:             event.Payload.ID,
+		SessionID:      sessionID,
+		ToolCallID:     event.Payload.ToolCallID,
+		ToolName:       event.Payload.ToolName,
+		Description:    event.Payload.Description,
+		Action:         event.Payload.Action,
+		Params:         params,
+		ParamsRedacted: redacted,
+		Path:           event.Payload.Path,
 	}
 
 	// Store pending permission in Redis (separate from stream)
 	// This allows proper state management for reconnection
 	if app.RedisStream != nil {
 		ctx := context.Background()
+		if redacted {
+			if err := app.RedisStream.SetPermissionParams(ctx, sessionID, event.Payload.ToolCallID, event.Payload.Params); err != nil {
+				slog.Warn("Failed to store permission params in Redis", "error", err)
+			}
+		}
 		perm := storeredis.PendingPermission{
-			ID:          event.Payload.ID,
-			SessionID:   sessionID,
-			ToolCallID:  event.Payload.ToolCallID,
-			ToolName:    event.Payload.ToolName,
-			Description: event.Payload.Description,
-			Action:      event.Payload.Action,
-			Params:      event.Payload.Params,
-			Path:        event.Payload.Path,
+			ID:             event.Payload.ID,
+			SessionID:      sessionID,
+			ToolCallID:     event.Payload.ToolCallID,
+			ToolName:       event.Payload.ToolName,
+			Description:    event.Payload.Description,
+			Action:         event.Payload.Action,
+			Params:         params,
+			ParamsRedacted: redacted,
+			Path:           event.Payload.Path,
 		}
 		if err := app.RedisStream.SetPendingPermission(ctx, perm); err != nil {
 			slog.Warn("Failed to store pending permission in Redis", "error", err)
@@ -254,7 +269,7 @@ func (app *WSApp) handlePermissionRequestEvent(event pubsub.Event[permission.Per
 	// Send via WebSocket if connected
 	isConnected, _ := app.connectedSessions.Get(sessionID)
 	if isConnected {
-		app.WSServer.SendToSession(sessionID, permMsg)
+		app.send(sessionID, permMsg, 0)
 	}
 }
 
@@ -263,11 +278,11 @@ func (app *WSApp) handlePermissionNotificationEvent(event pubsub.Event[permissio
 	sessionID := event.Payload.SessionID
 	slog.Info("Sending permission notification to session", "session_id", sessionID, "tool_call_id", event.Payload.ToolCallID, "granted", event.Payload.Granted)
 
-	notifMsg := map[string]interface{}{
-		"Type":         "permission_notification",
-		"tool_call_id": event.Payload.ToolCallID,
-		"granted":      event.Payload.Granted,
-		"denied":       event.Payload.Denied,
+	notifMsg := protocol.PermissionNotification{
+		ToolCallID: event.Payload.ToolCallID,
+		Granted:    event.Payload.Granted,
+		Denied:     event.Payload.Denied,
+		Reason:     event.Payload.Reason,
 	}
 
 	// Update permission status in Redis
@@ -281,7 +296,7 @@ func (app *WSApp) handlePermissionNotificationEvent(event pubsub.Event[permissio
 		}
 		// Only update if it's a final status (granted or denied)
 		if status != "pending" {
-			if err := app.RedisStream.UpdatePermissionStatus(ctx, sessionID, event.Payload.ToolCallID, status); err != nil {
+			if err := app.RedisStream.UpdatePermissionStatus(ctx, sessionID, event.Payload.ToolCallID, status, event.Payload.Reason); err != nil {
 				slog.Warn("Failed to update permission status in Redis", "error", err)
 			}
 		}
@@ -293,7 +308,7 @@ func (app *WSApp) handlePermissionNotificationEvent(event pubsub.Event[permissio
 	// Send via WebSocket if connected
 	isConnected, _ := app.connectedSessions.Get(sessionID)
 	if isConnected {
-		app.WSServer.SendToSession(sessionID, notifMsg)
+		app.send(sessionID, notifMsg, 0)
 	}
 }
 
@@ -308,39 +323,97 @@ func (app *WSApp) handleToolCallEvent(event pubsub.Event[toolcall.ToolCall]) {
 		"status", event.Payload.Status,
 	)
 
-	toolCallMsg := map[string]interface{}{
-		"Type":          "tool_call_update",
-		"id":            event.Payload.ID,
-		"session_id":    sessionID,
-		"message_id":    event.Payload.MessageID,
-		"name":          event.Payload.Name,
-		"input":         event.Payload.Input,
-		"status":        string(event.Payload.Status),
-		"result":        event.Payload.Result,
-		"is_error":      event.Payload.IsError,
-		"error_message": event.Payload.ErrorMessage,
-		"created_at":    event.Payload.CreatedAt,
-		"updated_at":    event.Payload.UpdatedAt,
+	toolCallMsg := protocol.ToolCallUpdate{
+		ID:           event.Payload.ID,
+		SessionID:    sessionID,
+		MessageID:    event.Payload.MessageID,
+		Name:         event.Payload.Name,
+		Input:        event.Payload.Input,
+		Status:       string(event.Payload.Status),
+		Result:       event.Payload.Result,
+		IsError:      event.Payload.IsError,
+		ErrorMessage: event.Payload.ErrorMessage,
+		CreatedAt:    event.Payload.CreatedAt,
+		UpdatedAt:    event.Payload.UpdatedAt,
+		StartedAt:    event.Payload.StartedAt,
+		FinishedAt:   event.Payload.FinishedAt,
 	}
-	if event.Payload.StartedAt != nil {
-		toolCallMsg["started_at"] = *event.Payload.StartedAt
+
+	// Publish to Redis for buffering
+	seq := app.publishEvent(context.Background(), sessionID, toolCallMsg)
+
+	// Send via WebSocket if connected
+	isConnected, _ := app.connectedSessions.Get(sessionID)
+	if isConnected {
+		app.send(sessionID, toolCallMsg, seq)
 	}
-	if event.Payload.FinishedAt != nil {
-		toolCallMsg["finished_at"] = *event.Payload.FinishedAt
+}
+
+// handlePermissionBlockingEvent escalates a permission request that has kept its
+// run waiting: the session receives a permission_blocking message, buffered in
+// the Redis stream for clients that come back later, and the project's chat
+// hooks are notified.
+func (app *WSApp) handlePermissionBlockingEvent(event pubsub.Event[permission.PermissionBlocking]) {
+	sessionID := event.Payload.SessionID
+	slog.Warn("Permission request blocking run", "session_id", sessionID, "tool_call_id", event.Payload.ToolCallID, "blocked_ms", event.Payload.BlockedMs)
+
+	blockingMsg := protocol.PermissionBlocking{
+		PermissionID: event.Payload.PermissionID,
+		SessionID:    sessionID,
+		ToolCallID:   event.Payload.ToolCallID,
+		ToolName:     event.Payload.ToolName,
+		Description:  event.Payload.Description,
+		BlockedMs:    event.Payload.BlockedMs,
 	}
 
-	// Publish to Redis for buffering
-	if app.RedisStream != nil {
-		ctx := context.Background()
-		if err := app.RedisStream.PublishMessage(ctx, sessionID, "tool_call_update", toolCallMsg); err != nil {
-			slog.Warn("Failed to publish tool call update to Redis stream", "error", err)
-		}
+	seq := app.publishEvent(context.Background(), sessionID, blockingMsg)
+
+	isConnected, _ := app.connectedSessions.Get(sessionID)
+	if isConnected {
+		app.send(sessionID, blockingMsg, seq)
 	}
 
+	go app.notifyPermissionBlocking(event.Payload)
+}
+
+// handleLintEvent sends the findings of a lint tool run as diagnostics
+func (app *WSApp) handleLintEvent(event pubsub.Event[tools.LintEvent]) {
+	sessionID := event.Payload.SessionID
+	slog.Info("Lint event received", "session_id", sessionID, "tool_call_id", event.Payload.ToolCallID, "findings", len(event.Payload.Findings))
+
+	diagnosticsMsg := protocol.Diagnostics{Source: "lint", LintEvent: event.Payload}
+
+	// Publish to Redis for buffering
+	seq := app.publishEvent(context.Background(), sessionID, diagnosticsMsg)
+
 	// Send via WebSocket if connected
 	isConnected, _ := app.connectedSessions.Get(sessionID)
 	if isConnected {
-		app.WSServer.SendToSession(sessionID, toolCallMsg)
+		app.send(sessionID, diagnosticsMsg, seq)
+	}
+}
+
+// handleModelSwitchEvent tells the clients of a session that its turn failed
+// over to another model, which answers from then on.
+func (app *WSApp) handleModelSwitchEvent(event pubsub.Event[agent.ModelSwitch]) {
+	sw := event.Payload
+	slog.Info("Model switched", "session_id", sw.SessionID, "from_model", sw.FromModel, "to_model", sw.ToModel)
+
+	switchMsg := protocol.ModelSwitched{
+		SessionID:    sw.SessionID,
+		MessageID:    sw.MessageID,
+		FromProvider: sw.FromProvider,
+		FromModel:    sw.FromModel,
+		Provider:     sw.ToProvider,
+		Model:        sw.ToModel,
+		Reason:       sw.Reason,
+	}
+
+	seq := app.publishEvent(context.Background(), sw.SessionID, switchMsg)
+
+	isConnected, _ := app.connectedSessions.Get(sw.SessionID)
+	if isConnected {
+		app.send(sw.SessionID, switchMsg, seq)
 	}
 }
 
@@ -359,31 +432,15 @@ func (app *WSApp) handleSessionEvent(event pubsub.Event[session.Session]) {
 
 	slog.Info("Sending session update to WebSocket clients", "session_id", sessionID, "context_window", contextWindow, "total_tokens", event.Payload.PromptTokens+event.Payload.CompletionTokens)
 
-	sessionMsg := map[string]interface{}{
-		"Type":              "session_update",
-		"id":                sessionID,
-		"project_id":        event.Payload.ProjectID,
-		"title":             event.Payload.Title,
-		"message_count":     event.Payload.MessageCount,
-		"prompt_tokens":     event.Payload.PromptTokens,
-		"completion_tokens": event.Payload.CompletionTokens,
-		"cost":              event.Payload.Cost,
-		"context_window":    contextWindow,
-		"created_at":        event.Payload.CreatedAt,
-		"updated_at":        event.Payload.UpdatedAt,
-	}
+	sessionMsg := sessionUpdate(event.Payload, contextWindow)
 
 	// Publish to Redis
-	if app.RedisStream != nil {
-		if err := app.RedisStream.PublishMessage(ctx, sessionID, "session_update", sessionMsg); err != nil {
-			slog.Warn("Failed to publish session update to Redis stream", "error", err)
-		}
-	}
+	seq := app.publishEvent(ctx, sessionID, sessionMsg)
 
 	// Send via WebSocket if connected
 	isConnected, _ := app.connectedSessions.Get(sessionID)
 	if isConnected {
-		app.WSServer.SendToSession(sessionID, sessionMsg)
+		app.send(sessionID, sessionMsg, seq)
 	}
 
 	// Send todos update if there are todos
@@ -419,27 +476,37 @@ func (app *WSApp) sendTodosUpdate(sessionID string, todos []session.Todo) {
 		}
 	}
 
-	todosMsg := map[string]interface{}{
-		"Type":         "todos_update",
-		"session_id":   sessionID,
-		"todos":        todos,
-		"completed":    completed,
-		"in_progress":  inProgress,
-		"pending":      pending,
-		"total":        len(todos),
-		"current_task": currentTask,
+	todosMsg := protocol.TodosUpdate{
+		SessionID:   sessionID,
+		Todos:       todos,
+		Completed:   completed,
+		InProgress:  inProgress,
+		Pending:     pending,
+		Total:       len(todos),
+		CurrentTask: currentTask,
 	}
 
 	slog.Info("Sending todos update", "session_id", sessionID, "total", len(todos), "completed", completed)
 
 	// Publish to Redis
-	ctx := context.Background()
-	if app.RedisStream != nil {
-		if err := app.RedisStream.PublishMessage(ctx, sessionID, "todos_update", todosMsg); err != nil {
-			slog.Warn("Failed to publish todos update to Redis stream", "error", err)
-		}
-	}
+	seq := app.publishEvent(context.Background(), sessionID, todosMsg)
 
 	// Send via WebSocket
-	app.WSServer.SendToSession(sessionID, todosMsg)
+	app.send(sessionID, todosMsg, seq)
+}
+
+// sessionUpdate builds the session_update event of a session.
+func sessionUpdate(sess session.Session, contextWindow int64) protocol.SessionUpdate {
+	return protocol.SessionUpdate{
+		ID:               sess.ID,
+		ProjectID:        sess.ProjectID,
+		Title:            sess.Title,
+		MessageCount:     sess.MessageCount,
+		PromptTokens:     sess.PromptTokens,
+		CompletionTokens: sess.CompletionTokens,
+		Cost:             sess.Cost,
+		ContextWindow:    contextWindow,
+		CreatedAt:        sess.CreatedAt,
+		UpdatedAt:        sess.UpdatedAt,
+	}
 }
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/filewatch"
+)
+
+const (
+	// fileWatchTimeout bounds a snapshot taken when a turn starts or ends
+	fileWatchTimeout = 10 * time.Second
+	// fileWatchMaxEvents bounds the file events of a poll, a larger change
+	// such as a dependency install is sent as a single files_changed event
+	fileWatchMaxEvents = 200
+	// fileWatchMaxEntries bounds the files of a project snapshot
+	fileWatchMaxEntries = 20000
+)
+
+// startFileWatcher polls the working directory of the projects with a
+// running turn, so that the file explorer of the clients and the code search
+// index follow the edits.
+func (app *WSApp) startFileWatcher(ctx context.Context, interval time.Duration) {
+	source := func(ctx context.Context, projectID string) (filewatch.Snapshot, error) {
+		resp, err := sandbox.GetDefaultClient().Snapshot(ctx, sandbox.FileSnapshotRequest{
+			ProjectID:  projectID,
+			MaxEntries: fileWatchMaxEntries,
+		})
+		if err != nil {
+			return nil, err
+		}
+		snapshot := make(filewatch.Snapshot, len(resp.Files))
+		for path, stat := range resp.Files {
+			snapshot[path] = filewatch.Stat{Modified: stat.Modified, Size: stat.Size}
+		}
+		app.refreshCodeIndex(projectID, snapshot)
+		return snapshot, nil
+	}
+	app.fileWatcher = filewatch.New(source, app.publishFileChanges, interval)
+	go app.fileWatcher.Run(ctx)
+	slog.Info("File watcher started", "interval", interval)
+}
+
+// watchFiles starts reporting the file changes of the project of a session
+// while its turn runs.
+func (app *WSApp) watchFiles(sessionID string) {
+	if app.fileWatcher == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fileWatchTimeout)
+	defer cancel()
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil || sess.ProjectID == "" {
+		return
+	}
+	app.fileWatcher.Watch(ctx, sessionID, sess.ProjectID)
+}
+
+// unwatchFiles reports the last file changes of a finished turn.
+func (app *WSApp) unwatchFiles(sessionID string) {
+	if app.fileWatcher == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fileWatchTimeout)
+	defer cancel()
+	app.fileWatcher.Unwatch(ctx, sessionID)
+}
+
+// publishFileChanges sends a file_created, file_modified or file_deleted
+// event per changed file to the clients of a session.
+func (app *WSApp) publishFileChanges(sessionID string, changes []filewatch.Change) {
+	ctx := context.Background()
+	app.invalidateToolCache(ctx, sessionID)
+	if len(changes) > fileWatchMaxEvents {
+		event := protocol.FilesChanged{SessionID: sessionID, Count: len(changes)}
+		seq := app.publishEvent(ctx, sessionID, event)
+		app.send(sessionID, event, seq)
+		return
+	}
+	for _, change := range changes {
+		event := protocol.FileChange{
+			Type:      string(change.Type),
+			SessionID: sessionID,
+			Path:      change.Path,
+		}
+		if change.Type != filewatch.Deleted {
+			event.Size = change.Size
+			event.Modified = change.Modified
+		}
+		seq := app.publishEvent(ctx, sessionID, event)
+		app.send(sessionID, event, seq)
+	}
+}
+
+// refreshCodeIndex keeps the code search index of a project in step with
+// the snapshots of its workspace.
+func (app *WSApp) refreshCodeIndex(projectID string, snapshot filewatch.Snapshot) {
+	if app.AgentCoordinator == nil {
+		return
+	}
+	if index := app.AgentCoordinator.CodeIndex(); index != nil {
+		index.Refresh(projectID, snapshot)
+	}
+}
+
+// invalidateToolCache drops the cached tool results of a session whose files
+// changed, e.g. through a command or another session of its project.
+func (app *WSApp) invalidateToolCache(ctx context.Context, sessionID string) {
+	client := storeredis.GetClient()
+	if client == nil || !app.config.Tools.Cache.Enabled {
+		return
+	}
+	if err := storeredis.NewToolResultCache(client).Invalidate(ctx, sessionID); err != nil {
+		slog.Warn("Failed to invalidate tool result cache", "session_id", sessionID, "error", err)
+	}
+}
@@ -0,0 +1,23 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+)
+
+// collectTurnKeys removes the tool call states and decided permission
+// requests of a finished turn from Redis, they would otherwise linger until
+// their TTLs.
+func (app *WSApp) collectTurnKeys(ctx context.Context, sessionID string) {
+	if app.RedisStream == nil {
+		return
+	}
+	n, err := app.RedisStream.CollectTurnKeys(ctx, sessionID)
+	if err != nil {
+		slog.Warn("Failed to collect the Redis keys of the turn", "session_id", sessionID, "error", err)
+		return
+	}
+	if n > 0 {
+		slog.Debug("Collected the Redis keys of the turn", "session_id", sessionID, "keys", n)
+	}
+}
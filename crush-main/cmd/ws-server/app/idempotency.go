@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+)
+
+// maxIdempotencyKeyLength bounds the idempotency keys of prompts.
+const maxIdempotencyKeyLength = 255
+
+// promptAcceptance is the result of a prompt sent with an idempotency key,
+// replayed to its retries.
+type promptAcceptance struct {
+	SessionID      string `json:"session_id"`
+	IdempotencyKey string `json:"idempotency_key"`
+	// AcceptedSeq is the sequence number of the first prompt_accepted event,
+	// the events of the prompt follow it and can be backfilled from it
+	AcceptedSeq int64 `json:"accepted_seq,omitempty"`
+	AcceptedAt  int64 `json:"accepted_at"`
+}
+
+// promptFingerprint identifies a prompt, the key of a retry must come with
+// the same prompt.
+func promptFingerprint(msgType, content, messageID string) string {
+	h := sha256.Sum256([]byte(msgType + "\n" + messageID + "\n" + content))
+	return hex.EncodeToString(h[:])
+}
+
+// reservePrompt reserves the idempotency key of a prompt so that a retry of
+// it, e.g. after a reconnection, is not run twice. It returns false when the
+// prompt must not run: the retry is answered with the acceptance of the first
+// prompt, marked duplicate. Without key or Redis every prompt runs.
+func (app *WSApp) reservePrompt(sessionID, key, fingerprint string) bool {
+	if key == "" || app.RedisStream == nil {
+		return true
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		app.sendError(sessionID, "idempotency_key is too long", apierr.New(apierr.CodeInvalidRequest, ""))
+		return false
+	}
+	result, err := app.RedisStream.ReserveIdempotencyKey(context.Background(), storeredis.PromptIdempotencyScope(sessionID), key, fingerprint)
+	if err != nil {
+		slog.Warn("Failed to reserve prompt idempotency key", "session_id", sessionID, "error", err)
+		return true
+	}
+	if result == nil {
+		return true
+	}
+	if result.Fingerprint != fingerprint {
+		app.sendError(sessionID, "idempotency_key was used for a different prompt", apierr.New(apierr.CodeConflict, ""))
+		return false
+	}
+
+	slog.Info("Duplicate prompt dropped", "session_id", sessionID, "idempotency_key", key, "pending", result.Pending)
+	var event protocol.PromptAccepted
+	if !result.Pending {
+		if err := json.Unmarshal(result.Body, &event); err != nil {
+			slog.Warn("Failed to unmarshal prompt acceptance", "session_id", sessionID, "error", err)
+		}
+	}
+	event.SessionID = sessionID
+	event.IdempotencyKey = key
+	event.Duplicate = true
+	app.send(sessionID, event, 0)
+	return false
+}
+
+// acceptPrompt tells the client its prompt passed validation and stores the
+// acceptance for the retries of the prompt.
+func (app *WSApp) acceptPrompt(sessionID, key, fingerprint string) {
+	if key == "" || app.RedisStream == nil {
+		return
+	}
+	ctx := context.Background()
+	acceptance := promptAcceptance{
+		SessionID:      sessionID,
+		IdempotencyKey: key,
+		AcceptedAt:     time.Now().UnixMilli(),
+	}
+	event := protocol.PromptAccepted{
+		SessionID:      sessionID,
+		IdempotencyKey: key,
+		AcceptedAt:     acceptance.AcceptedAt,
+	}
+	seq := app.publishEvent(ctx, sessionID, event)
+	app.send(sessionID, event, seq)
+
+	acceptance.AcceptedSeq = seq
+	body, err := json.Marshal(acceptance)
+	if err == nil {
+		err = app.RedisStream.CompleteIdempotencyKey(ctx, storeredis.PromptIdempotencyScope(sessionID), key, storeredis.IdempotentResult{
+			Fingerprint: fingerprint,
+			Body:        body,
+			CreatedAt:   acceptance.AcceptedAt,
+		})
+	}
+	if err != nil {
+		slog.Warn("Failed to store prompt acceptance", "session_id", sessionID, "error", err)
+	}
+}
+
+// releasePrompt drops the idempotency key of a rejected prompt, so that its
+// retry runs.
+func (app *WSApp) releasePrompt(sessionID, key string) {
+	if key == "" || app.RedisStream == nil {
+		return
+	}
+	if err := app.RedisStream.ReleaseIdempotencyKey(context.Background(), storeredis.PromptIdempotencyScope(sessionID), key); err != nil {
+		slog.Warn("Failed to release prompt idempotency key", "session_id", sessionID, "error", err)
+	}
+}
@@ -0,0 +1,22 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/domain/job"
+)
+
+// recoverBackgroundJobs checks on the background jobs recorded as running.
+// They run in the sandbox containers and outlive the WS server, job_output
+// reaches them again once the server is back.
+func (app *WSApp) recoverBackgroundJobs(ctx context.Context) {
+	running, err := job.NewService(app.db, nil).Recover(ctx)
+	if err != nil {
+		slog.Warn("Failed to recover background jobs", "error", err)
+		return
+	}
+	if running > 0 {
+		slog.Info("Reattached to background jobs", "running", running)
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+const (
+	// metricsBucket is the resolution of the metrics rollups.
+	metricsBucket = 5 * time.Minute
+	// metricsRetention is how long the metrics rollups are kept.
+	metricsRetention = 30 * 24 * time.Hour
+)
+
+// startTurnMetrics remembers the cost of a session when its turn starts, to
+// attribute the cost of the turn to the time it finished.
+func (app *WSApp) startTurnMetrics(ctx context.Context, sessionID string) {
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return
+	}
+	app.turnCosts.Set(sessionID, sess.Cost)
+}
+
+// recordTurnMetrics adds a finished turn, its cost and whether it failed to
+// the metrics rollups.
+func (app *WSApp) recordTurnMetrics(ctx context.Context, sessionID string, status storeredis.SessionRunningStatus) {
+	if app.db == nil {
+		return
+	}
+	startCost, _ := app.turnCosts.Take(sessionID)
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		slog.Warn("Failed to get session for metrics", "session_id", sessionID, "error", err)
+		return
+	}
+	var errors int32
+	if status == storeredis.SessionStatusError {
+		errors = 1
+	}
+	if err := app.db.AddMetricsRollup(ctx, postgres.AddMetricsRollupParams{
+		Bucket:    time.Now().Truncate(metricsBucket).UnixMilli(),
+		SessionID: sessionID,
+		Turns:     1,
+		Errors:    errors,
+		Cost:      max(sess.Cost-startCost, 0),
+	}); err != nil {
+		slog.Warn("Failed to record turn metrics", "session_id", sessionID, "error", err)
+	}
+}
+
+// pruneMetricsRollups deletes the rollups older than the retention daily.
+func (app *WSApp) pruneMetricsRollups(ctx context.Context) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		before := time.Now().Add(-metricsRetention).UnixMilli()
+		if err := app.db.DeleteMetricsRollupsBefore(ctx, before); err != nil {
+			slog.Warn("Failed to prune metrics rollups", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/tidwall/sjson"
+)
+
+// handleSetModel selects the model of a slot, large by default, for the next
+// turns of a session. The model is saved in the session config and answered
+// with a model_updated event.
+func (app *WSApp) handleSetModel(sessionID, slot, provider, model string) {
+	if sessionID == "" {
+		return
+	}
+	modelType := config.SelectedModelType(cmp.Or(slot, string(config.SelectedModelTypeLarge)))
+	if err := app.setSessionModel(context.Background(), sessionID, modelType, provider, model); err != nil {
+		slog.Warn("Failed to set session model", "session_id", sessionID, "slot", modelType, "provider", provider, "model", model, "error", err)
+		app.sendErrorToClient(sessionID, err)
+		return
+	}
+	slog.Info("Set session model", "session_id", sessionID, "slot", modelType, "provider", provider, "model", model)
+
+	event := protocol.ModelUpdated{
+		SessionID: sessionID,
+		Slot:      string(modelType),
+		Provider:  provider,
+		Model:     model,
+	}
+	seq := app.publishEvent(context.Background(), sessionID, event)
+	app.send(sessionID, event, seq)
+}
+
+func (app *WSApp) setSessionModel(ctx context.Context, sessionID string, modelType config.SelectedModelType, provider, model string) error {
+	if modelType != config.SelectedModelTypeLarge && modelType != config.SelectedModelTypeSmall {
+		return apierr.WithCode(apierr.CodeInvalidRequest, fmt.Errorf("unknown model slot %q, expected large or small", modelType))
+	}
+	if provider == "" || model == "" {
+		return apierr.WithCode(apierr.CodeInvalidRequest, fmt.Errorf("provider and model are required"))
+	}
+
+	if err := app.checkSessionModel(ctx, sessionID, provider, model); err != nil {
+		return err
+	}
+
+	configJSON, err := app.db.GetSessionConfigJSON(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to read session config: %w", err)
+	}
+	// Only the model of the slot is replaced, the other keys are kept
+	updated, err := sjson.Set(cmp.Or(configJSON, "{}"), "models."+string(modelType), config.SelectedModel{Provider: provider, Model: model})
+	if err != nil {
+		return fmt.Errorf("failed to update session config: %w", err)
+	}
+	if err := app.db.SaveConfigJSON(ctx, sessionID, updated); err != nil {
+		return fmt.Errorf("failed to save session config: %w", err)
+	}
+
+	if app.AgentCoordinator == nil {
+		return nil
+	}
+	if err := app.AgentCoordinator.UpdateSessionModels(ctx, sessionID); err != nil {
+		// Keep the model that works
+		if restoreErr := app.db.SaveConfigJSON(ctx, sessionID, configJSON); restoreErr != nil {
+			slog.Error("Failed to restore session config", "session_id", sessionID, "error", restoreErr)
+		}
+		return fmt.Errorf("failed to build model %q of provider %q: %w", model, provider, err)
+	}
+	return nil
+}
+
+// checkSessionModel checks that a model is offered by a provider configured
+// for a session.
+func (app *WSApp) checkSessionModel(ctx context.Context, sessionID, provider, model string) error {
+	// The providers of the session config count, e.g. the API key of the user
+	cfg, err := config.LoadWithSessionConfig(ctx, app.config.WorkingDir(), app.config.Options.DataDirectory, app.config.Options.Debug, sessionID, app.db)
+	if err != nil {
+		return fmt.Errorf("failed to load session config: %w", err)
+	}
+	providerCfg, ok := cfg.Providers.Get(provider)
+	if !ok || providerCfg.Disable {
+		return apierr.WithCode(apierr.CodeInvalidRequest, fmt.Errorf("provider %q is not configured", provider))
+	}
+	if !slices.ContainsFunc(providerCfg.Models, func(m catwalk.Model) bool { return m.ID == model }) {
+		return apierr.WithCode(apierr.CodeInvalidRequest, fmt.Errorf("model %q is not offered by provider %q", model, provider))
+	}
+	return nil
+}
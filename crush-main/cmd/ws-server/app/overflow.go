@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+)
+
+// overflowRetryInterval is how often the prompts held while the worker pool
+// is full are submitted again.
+const overflowRetryInterval = time.Second
+
+// overflowPrompts holds the interactive prompts rejected by a full worker
+// pool, in arrival order, until a queue slot frees up.
+type overflowPrompts struct {
+	mu      sync.Mutex
+	size    int
+	prompts []queuedPrompt
+}
+
+// add holds a prompt and returns its position, 0 when the overflow is full.
+func (o *overflowPrompts) add(prompt queuedPrompt) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.prompts) >= o.size {
+		return 0
+	}
+	o.prompts = append(o.prompts, prompt)
+	return len(o.prompts)
+}
+
+func (o *overflowPrompts) head() (queuedPrompt, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.prompts) == 0 {
+		return queuedPrompt{}, false
+	}
+	return o.prompts[0], true
+}
+
+func (o *overflowPrompts) pop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.prompts = o.prompts[1:]
+}
+
+func (o *overflowPrompts) list() []queuedPrompt {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]queuedPrompt(nil), o.prompts...)
+}
+
+// submitPrompt runs a prompt via the worker pool. When the pool is full the
+// prompt is held in the overflow queue if it is enabled, otherwise the client
+// is told how loaded the pool is and when to retry. It returns false when the
+// prompt was rejected.
+func (app *WSApp) submitPrompt(prompt queuedPrompt) bool {
+	sessionID := prompt.sessionID
+	err := app.runAgentViaPool(prompt)
+	if err == nil {
+		return true
+	}
+	var capacityErr *agent.CapacityError
+	if errors.As(err, &capacityErr) && app.overflow.size > 0 {
+		if position := app.overflow.add(prompt); position > 0 {
+			slog.Info("[GOROUTINE] Worker pool full, prompt held in overflow queue", "session_id", sessionID, "position", position)
+			app.sendQueuePosition(sessionID, position, capacityErr.QueueDepth+position-1)
+			return true
+		}
+	}
+	app.sendCapacityError(sessionID, err)
+	return false
+}
+
+// sendCapacityError tells a client its prompt was rejected. When the pool is
+// full the error includes the load of the pool and when to retry.
+func (app *WSApp) sendCapacityError(sessionID string, err error) {
+	code := apierr.CodeCapacityExceeded
+	if errors.Is(err, errDraining) {
+		code = apierr.CodeUnavailable
+	}
+	event := protocol.NewError(sessionID, "系统繁忙，请稍后重试 (503)", apierr.New(code, ""))
+	event.Draining = errors.Is(err, errDraining)
+	var capacityErr *agent.CapacityError
+	if errors.As(err, &capacityErr) {
+		event.Capacity = &protocol.Capacity{
+			QueueDepth:       capacityErr.QueueDepth,
+			QueueSize:        capacityErr.QueueSize,
+			ActiveWorkers:    capacityErr.ActiveWorkers,
+			MaxWorkers:       capacityErr.MaxWorkers,
+			EstimatedWaitSec: seconds(capacityErr.EstimatedWait),
+			RetryAfterSec:    seconds(capacityErr.RetryAfter),
+		}
+	}
+	app.send(sessionID, event, 0)
+}
+
+// sendQueuePosition tells a client where its prompt is in the overflow
+// queue, ahead being the tasks that run before it.
+func (app *WSApp) sendQueuePosition(sessionID string, position, ahead int) {
+	app.send(sessionID, protocol.QueuePosition{
+		SessionID:        sessionID,
+		Position:         position,
+		EstimatedWaitSec: seconds(app.AgentWorkerPool.EstimateWait(agent.PriorityInteractive, ahead)),
+	}, 0)
+}
+
+// runOverflowQueue submits the held prompts in order as queue slots free up
+// and sends the remaining ones their new positions, until ctx is done.
+func (app *WSApp) runOverflowQueue(ctx context.Context) {
+	ticker := time.NewTicker(overflowRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		moved := false
+		for {
+			prompt, ok := app.overflow.head()
+			if !ok {
+				break
+			}
+			err := app.runAgentViaPool(prompt)
+			if errors.Is(err, agent.ErrPoolFull) {
+				break
+			}
+			app.overflow.pop()
+			moved = true
+			if err != nil {
+				app.sendCapacityError(prompt.sessionID, err)
+				continue
+			}
+			app.send(prompt.sessionID, protocol.QueuePosition{
+				SessionID:  prompt.sessionID,
+				Dispatched: true,
+			}, 0)
+		}
+		if !moved {
+			continue
+		}
+		stats := app.AgentWorkerPool.Stats()
+		queued := stats.QueuedTasks - stats.QueuedBackgroundTasks
+		for i, prompt := range app.overflow.list() {
+			app.sendQueuePosition(prompt.sessionID, i+1, queued+i)
+		}
+	}
+}
+
+// seconds rounds a duration up to whole seconds for clients.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,256 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// ownershipHeartbeatInterval keeps the instance well within storeredis.InstanceTTL.
+const ownershipHeartbeatInterval = storeredis.InstanceTTL / 3
+
+// relayBufferSize bounds the session messages waiting to be relayed to the
+// other instances. Clients backfill the ones dropped when it is full.
+const relayBufferSize = 1000
+
+// relayedEvent is a message sent to the clients of a session, to relay.
+type relayedEvent struct {
+	sessionID string
+	message   []byte
+}
+
+// SessionOwnership is the registry of the sessions owned by the WS instances,
+// implemented by storeredis.OwnershipService.
+type SessionOwnership interface {
+	InstanceID() string
+	Heartbeat(ctx context.Context) error
+	Claim(ctx context.Context, sessionID string) (string, error)
+	Owner(ctx context.Context, sessionID string) (string, error)
+	Release(ctx context.Context, sessionID string) error
+	ReleaseAll(ctx context.Context) error
+	LiveInstances(ctx context.Context) ([]string, error)
+}
+
+// instanceID returns the configured ID of this WS instance, or the hostname
+// with a random suffix so that restarted instances never share an ID.
+func instanceID() string {
+	if appCfg := config.GetGlobalAppConfig(); appCfg != nil && appCfg.Server.InstanceID != "" {
+		return appCfg.Server.InstanceID
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "ws"
+	}
+	return host + "-" + uuid.NewString()[:8]
+}
+
+// startOwnership registers the instance in the session ownership registry so
+// that several WS instances can run behind a load balancer: the messages of
+// a session are forwarded to the instance running its agent and the messages
+// sent to its clients are relayed to the other instances.
+func (app *WSApp) startOwnership(ctx context.Context) {
+	if app.RedisCmd == nil {
+		return
+	}
+	client := storeredis.GetClient()
+	if client == nil {
+		return
+	}
+	app.Ownership = storeredis.NewOwnershipService(client, instanceID())
+	if err := app.Ownership.Heartbeat(ctx); err != nil {
+		slog.Warn("Failed to register WS instance", "instance_id", app.Ownership.InstanceID(), "error", err)
+	}
+	slog.Info("WS instance registered", "instance_id", app.Ownership.InstanceID())
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmds, cancelCmds := app.RedisCmd.SubscribeInstanceCommands(ctx, app.Ownership.InstanceID())
+	events, cancelEvents := app.RedisCmd.SubscribeSessionEvents(ctx)
+	relay := make(chan relayedEvent, relayBufferSize)
+	var peers atomic.Int64
+
+	app.cleanupFuncs = append(app.cleanupFuncs, func() error {
+		cancel()
+		cancelCmds()
+		cancelEvents()
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer releaseCancel()
+		return app.Ownership.ReleaseAll(releaseCtx)
+	})
+
+	go func() {
+		slog.Info("[GOROUTINE] Ownership heartbeat started")
+		defer slog.Info("[GOROUTINE] Ownership heartbeat stopped")
+		ticker := time.NewTicker(ownershipHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			if instances, err := app.Ownership.LiveInstances(ctx); err == nil {
+				peers.Store(int64(len(instances) - 1))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := app.Ownership.Heartbeat(ctx); err != nil {
+				slog.Warn("Failed to send ownership heartbeat", "error", err)
+			}
+		}
+	}()
+
+	go func() {
+		slog.Info("[GOROUTINE] Instance command subscriber started")
+		defer slog.Info("[GOROUTINE] Instance command subscriber stopped")
+		for cmd := range cmds {
+			app.handleInstanceCommand(cmd)
+		}
+	}()
+
+	go func() {
+		slog.Info("[GOROUTINE] Session event subscriber started")
+		defer slog.Info("[GOROUTINE] Session event subscriber stopped")
+		for cmd := range events {
+			if cmd.Source == app.Ownership.InstanceID() {
+				continue
+			}
+			app.WSServer.DeliverToSession(cmd.SessionID, cmd.Payload)
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-relay:
+				if err := app.RedisCmd.PublishSessionEvent(ctx, app.Ownership.InstanceID(), event.sessionID, event.message); err != nil && ctx.Err() == nil {
+					slog.Warn("Failed to relay session message", "session_id", event.sessionID, "error", err)
+				}
+			}
+		}
+	}()
+
+	app.WSServer.SetRelay(func(sessionID string, message []byte) {
+		// Nothing to relay while this is the only instance
+		if peers.Load() <= 0 || ctx.Err() != nil {
+			return
+		}
+		select {
+		case relay <- relayedEvent{sessionID: sessionID, message: message}:
+		default:
+			slog.Warn("Relay buffer full, dropping session message", "session_id", sessionID)
+		}
+	})
+}
+
+// handleInstanceCommand runs a command another instance forwarded to the owner of a session.
+func (app *WSApp) handleInstanceCommand(cmd storeredis.Command) {
+	slog.Debug("Received forwarded command", "type", cmd.Type, "session_id", cmd.SessionID, "source", cmd.Source)
+	switch cmd.Type {
+	case storeredis.CmdCancel:
+		var payload storeredis.CancelPayload
+		if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+			slog.Warn("Failed to unmarshal forwarded cancel", "error", err)
+			return
+		}
+		app.handleCancelRequest(cmd.SessionID, agent.ParseCancelMode(payload.Mode))
+	case storeredis.CmdPermissionResponse:
+		var p storeredis.PermissionResponsePayload
+		if err := json.Unmarshal(cmd.Payload, &p); err != nil {
+			slog.Warn("Failed to unmarshal forwarded permission response", "error", err)
+			return
+		}
+		app.handlePermissionResponse(p.ID, p.ToolCallID, cmd.SessionID, p.Granted, p.Denied, p.AllowForSession, p.ToolName, p.Action, p.Path, p.Reason, p.ApprovedHunks)
+	case storeredis.CmdClientMessage:
+		app.handleClientMessage(cmd.Payload, nil, cmd.SessionID)
+	}
+}
+
+// remoteOwner returns the live instance other than this one owning a session,
+// empty when the session is handled here.
+func (app *WSApp) remoteOwner(sessionID string) string {
+	if app.Ownership == nil || sessionID == "" {
+		return ""
+	}
+	owner, err := app.Ownership.Owner(context.Background(), sessionID)
+	if err != nil {
+		slog.Warn("Failed to get session owner, handling locally", "session_id", sessionID, "error", err)
+		return ""
+	}
+	if owner == app.Ownership.InstanceID() {
+		return ""
+	}
+	return owner
+}
+
+// claimSession makes this instance the owner of a session unless another live
+// instance owns it, whose ID is then returned.
+func (app *WSApp) claimSession(sessionID string) string {
+	if app.Ownership == nil {
+		return ""
+	}
+	owner, err := app.Ownership.Claim(context.Background(), sessionID)
+	if err != nil {
+		slog.Warn("Failed to claim session, handling locally", "session_id", sessionID, "error", err)
+		return ""
+	}
+	if owner == app.Ownership.InstanceID() {
+		return ""
+	}
+	return owner
+}
+
+// releaseIdleSession gives up the ownership of a session once it has no
+// running turn and no client on this instance. The next prompt claims it
+// again, on whichever instance receives it.
+func (app *WSApp) releaseIdleSession(sessionID string) {
+	if app.Ownership == nil || sessionID == "" {
+		return
+	}
+	if app.AgentCoordinator != nil && app.AgentCoordinator.IsSessionBusy(sessionID) {
+		return
+	}
+	if app.WSServer != nil && app.WSServer.HasSessionClients(sessionID) {
+		return
+	}
+	if err := app.Ownership.Release(context.Background(), sessionID); err != nil {
+		slog.Warn("Failed to release session", "session_id", sessionID, "error", err)
+		return
+	}
+	slog.Debug("Released idle session", "session_id", sessionID)
+}
+
+// forwardToOwner sends a command to the instance owning its session.
+// It reports whether the command was sent.
+func (app *WSApp) forwardToOwner(owner string, cmdType storeredis.CommandType, sessionID string, payload interface{}) bool {
+	var raw json.RawMessage
+	if b, ok := payload.([]byte); ok {
+		raw = b
+	} else {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			slog.Error("Failed to marshal forwarded command", "type", cmdType, "error", err)
+			return false
+		}
+		raw = b
+	}
+	err := app.RedisCmd.ForwardToInstance(context.Background(), owner, storeredis.Command{
+		Type:      cmdType,
+		SessionID: sessionID,
+		Payload:   raw,
+		Source:    app.Ownership.InstanceID(),
+	})
+	if err != nil {
+		slog.Warn("Failed to forward command to session owner, handling locally", "type", cmdType, "session_id", sessionID, "owner", owner, "error", err)
+		return false
+	}
+	slog.Info("Forwarded command to session owner", "type", cmdType, "session_id", sessionID, "owner", owner)
+	return true
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/handler"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOwnership records the sessions owned by the instance.
+type fakeOwnership struct {
+	SessionOwnership
+	owned map[string]bool
+}
+
+func (f *fakeOwnership) Claim(_ context.Context, sessionID string) (string, error) {
+	f.owned[sessionID] = true
+	return "local", nil
+}
+
+func (f *fakeOwnership) Release(_ context.Context, sessionID string) error {
+	delete(f.owned, sessionID)
+	return nil
+}
+
+func (f *fakeOwnership) InstanceID() string { return "local" }
+
+// busyCoordinator reports the sessions with a running turn.
+type busyCoordinator struct {
+	agent.Coordinator
+	busy map[string]bool
+}
+
+func (c *busyCoordinator) IsSessionBusy(sessionID string) bool { return c.busy[sessionID] }
+
+func newOwnershipTestApp() (*WSApp, *fakeOwnership, *busyCoordinator) {
+	ownership := &fakeOwnership{owned: map[string]bool{}}
+	coordinator := &busyCoordinator{busy: map[string]bool{}}
+	return &WSApp{
+		Ownership:         ownership,
+		AgentCoordinator:  coordinator,
+		WSServer:          handler.New(),
+		connectedSessions: csync.NewMap[string, bool](),
+	}, ownership, coordinator
+}
+
+func TestReleaseIdleSessionOnTurnEnd(t *testing.T) {
+	app, ownership, coordinator := newOwnershipTestApp()
+	require.Empty(t, app.claimSession("s1"))
+	require.Empty(t, app.claimSession("s2"))
+
+	// A queued prompt keeps the session running
+	coordinator.busy["s2"] = true
+	app.releaseIdleSession("s1")
+	app.releaseIdleSession("s2")
+	require.Equal(t, map[string]bool{"s2": true}, ownership.owned)
+
+	coordinator.busy["s2"] = false
+	app.releaseIdleSession("s2")
+	require.Empty(t, ownership.owned)
+}
+
+func TestReleaseIdleSessionOnLastDisconnect(t *testing.T) {
+	app, ownership, coordinator := newOwnershipTestApp()
+	require.Empty(t, app.claimSession("s1"))
+
+	// The turn keeps running without clients, it releases the session when done
+	coordinator.busy["s1"] = true
+	app.HandleClientDisconnect("s1")
+	require.True(t, ownership.owned["s1"])
+
+	coordinator.busy["s1"] = false
+	app.HandleClientDisconnect("s1")
+	require.Empty(t, ownership.owned)
+}
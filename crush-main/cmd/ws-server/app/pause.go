@@ -0,0 +1,325 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/domain/project"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// queuedPrompt is a prompt held back while its project is paused.
+type queuedPrompt struct {
+	sessionID   string
+	agent       string
+	content     string
+	attachments []message.Attachment
+	workingDir  string
+	planMode    bool
+	// busyPolicy overrides the busy policy of the session for the prompt
+	busyPolicy config.BusyPolicy
+	// resumeToolCall is a suspended tool call the user granted, run before the prompt
+	resumeToolCall string
+	// modelOverride changes the large model of the session for the prompt, e.g. a retry
+	modelOverride *config.ModelOverride
+}
+
+// resumeRetryInterval is how long the release of the prompts of a project
+// waits when its pause could not be checked.
+const resumeRetryInterval = time.Minute
+
+// heldPrompt is the stored form of a queued prompt.
+type heldPrompt struct {
+	SessionID      string                `json:"session_id"`
+	Agent          string                `json:"agent,omitempty"`
+	Content        string                `json:"content"`
+	Attachments    []message.Attachment  `json:"attachments,omitempty"`
+	WorkingDir     string                `json:"working_dir,omitempty"`
+	PlanMode       bool                  `json:"plan_mode,omitempty"`
+	BusyPolicy     config.BusyPolicy     `json:"busy_policy,omitempty"`
+	ResumeToolCall string                `json:"resume_tool_call,omitempty"`
+	ModelOverride  *config.ModelOverride `json:"model_override,omitempty"`
+}
+
+func (p queuedPrompt) held() heldPrompt {
+	return heldPrompt{
+		SessionID:      p.sessionID,
+		Agent:          p.agent,
+		Content:        p.content,
+		Attachments:    p.attachments,
+		WorkingDir:     p.workingDir,
+		PlanMode:       p.planMode,
+		BusyPolicy:     p.busyPolicy,
+		ResumeToolCall: p.resumeToolCall,
+		ModelOverride:  p.modelOverride,
+	}
+}
+
+func (h heldPrompt) queued() queuedPrompt {
+	return queuedPrompt{
+		sessionID:      h.SessionID,
+		agent:          h.Agent,
+		content:        h.Content,
+		attachments:    h.Attachments,
+		workingDir:     h.WorkingDir,
+		planMode:       h.PlanMode,
+		busyPolicy:     h.BusyPolicy,
+		resumeToolCall: h.ResumeToolCall,
+		modelOverride:  h.ModelOverride,
+	}
+}
+
+// pausedPromptStore keeps the queued prompts of the paused projects across
+// restarts and WS instances, implemented by storeredis.StreamService.
+type pausedPromptStore interface {
+	HoldPausedPrompt(ctx context.Context, projectID string, prompt []byte) (int, error)
+	TakePausedPrompts(ctx context.Context, projectID string) ([][]byte, error)
+	PausedProjects(ctx context.Context) ([]string, error)
+}
+
+// pausedPrompts holds the prompts queued per project during maintenance
+// windows, in the store when there is one, and the timers releasing them
+// when the windows end.
+type pausedPrompts struct {
+	mu sync.Mutex
+	// prompts are the ones held in memory, without a store or when it fails
+	prompts map[string][]queuedPrompt
+	store   pausedPromptStore
+	timers  map[string]*time.Timer
+}
+
+func (p *pausedPrompts) add(projectID string, prompt queuedPrompt) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.store != nil {
+		data, err := json.Marshal(prompt.held())
+		if err == nil {
+			var queued int
+			queued, err = p.store.HoldPausedPrompt(context.Background(), projectID, data)
+			if err == nil {
+				return queued + len(p.prompts[projectID])
+			}
+		}
+		slog.Warn("Failed to store paused prompt, keeping it in memory", "project_id", projectID, "error", err)
+	}
+	if p.prompts == nil {
+		p.prompts = make(map[string][]queuedPrompt)
+	}
+	p.prompts[projectID] = append(p.prompts[projectID], prompt)
+	return len(p.prompts[projectID])
+}
+
+func (p *pausedPrompts) take(projectID string) []queuedPrompt {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if timer, ok := p.timers[projectID]; ok {
+		timer.Stop()
+		delete(p.timers, projectID)
+	}
+	var prompts []queuedPrompt
+	if p.store != nil {
+		stored, err := p.store.TakePausedPrompts(context.Background(), projectID)
+		if err != nil {
+			slog.Warn("Failed to take stored paused prompts", "project_id", projectID, "error", err)
+		}
+		for _, data := range stored {
+			var held heldPrompt
+			if err := json.Unmarshal(data, &held); err != nil {
+				slog.Warn("Failed to decode stored paused prompt", "project_id", projectID, "error", err)
+				continue
+			}
+			prompts = append(prompts, held.queued())
+		}
+	}
+	prompts = append(prompts, p.prompts[projectID]...)
+	delete(p.prompts, projectID)
+	return prompts
+}
+
+// schedule runs release after delay, replacing the timer of the project.
+func (p *pausedPrompts) schedule(projectID string, delay time.Duration, release func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timers == nil {
+		p.timers = make(map[string]*time.Timer)
+	}
+	if timer, ok := p.timers[projectID]; ok {
+		timer.Stop()
+	}
+	p.timers[projectID] = time.AfterFunc(max(delay, 0), release)
+}
+
+// sessionProjectPause returns the project of a session and its active
+// maintenance window, if any.
+func (app *WSApp) sessionProjectPause(ctx context.Context, sessionID string) (string, *project.Pause) {
+	if app.db == nil || app.Projects == nil {
+		return "", nil
+	}
+	dbSession, err := app.db.GetSessionByID(ctx, sessionID)
+	if err != nil || !dbSession.ProjectID.Valid || dbSession.ProjectID.String == "" {
+		return "", nil
+	}
+	projectID := dbSession.ProjectID.String
+	pause, err := app.Projects.GetPause(ctx, projectID)
+	if err != nil {
+		slog.Warn("Failed to check project pause", "project_id", projectID, "error", err)
+		return projectID, nil
+	}
+	return projectID, pause
+}
+
+// holdIfProjectPaused rejects or queues a prompt when the session's project is
+// paused. It reports whether the prompt was handled and must not be run now.
+func (app *WSApp) holdIfProjectPaused(prompt queuedPrompt) bool {
+	ctx := context.Background()
+	sessionID := prompt.sessionID
+	projectID, pause := app.sessionProjectPause(ctx, sessionID)
+	if projectID != "" && pause == nil {
+		// The window may have ended without a resume notification (e.g. resume_at passed)
+		app.submitQueuedPrompts(projectID)
+		return false
+	}
+	if pause == nil {
+		return false
+	}
+
+	if pause.Mode == project.PauseModeQueue {
+		queued := app.pausedPrompts.add(projectID, prompt)
+		app.scheduleResume(projectID, pause.ResumeAt)
+		slog.Info("Project paused, prompt queued", "project_id", projectID, "session_id", sessionID, "queued", queued)
+		app.send(sessionID, protocol.ProjectPaused{
+			SessionID: sessionID,
+			ProjectID: projectID,
+			Reason:    pause.Reason,
+			Queued:    true,
+		}, 0)
+		return true
+	}
+
+	slog.Info("Project paused, prompt rejected", "project_id", projectID, "session_id", sessionID)
+	app.sendErrorToClient(sessionID, pause.Error())
+	return true
+}
+
+// submitQueuedPrompts runs the prompts that were queued while a project was paused.
+func (app *WSApp) submitQueuedPrompts(projectID string) {
+	for _, prompt := range app.pausedPrompts.take(projectID) {
+		slog.Info("Submitting prompt queued during project pause", "project_id", projectID, "session_id", prompt.sessionID)
+		app.submitPrompt(prompt)
+	}
+}
+
+// scheduleResume releases the prompts queued for a project when its
+// maintenance window ends at resumeAt (Unix ms). Windows without an end wait
+// for the resume command.
+func (app *WSApp) scheduleResume(projectID string, resumeAt int64) {
+	if resumeAt <= 0 {
+		return
+	}
+	app.pausedPrompts.schedule(projectID, time.Until(time.UnixMilli(resumeAt)), func() {
+		app.releaseIfResumed(projectID)
+	})
+}
+
+// releaseIfResumed runs the prompts queued for a project unless it is still
+// paused, e.g. its window was extended.
+func (app *WSApp) releaseIfResumed(projectID string) {
+	if app.Projects == nil {
+		return
+	}
+	pause, err := app.Projects.GetPause(context.Background(), projectID)
+	if err != nil {
+		slog.Warn("Failed to check project pause, retrying", "project_id", projectID, "error", err)
+		app.pausedPrompts.schedule(projectID, resumeRetryInterval, func() { app.releaseIfResumed(projectID) })
+		return
+	}
+	if pause != nil {
+		app.scheduleResume(projectID, pause.ResumeAt)
+		return
+	}
+	app.submitQueuedPrompts(projectID)
+}
+
+// resumePausedProjects picks up the prompts queued before a restart or by
+// another instance: they run now if their window is over, or when it ends.
+func (app *WSApp) resumePausedProjects(ctx context.Context) {
+	if app.pausedPrompts.store == nil {
+		return
+	}
+	projectIDs, err := app.pausedPrompts.store.PausedProjects(ctx)
+	if err != nil {
+		slog.Warn("Failed to list the projects with queued prompts", "error", err)
+		return
+	}
+	for _, projectID := range projectIDs {
+		app.releaseIfResumed(projectID)
+	}
+}
+
+// checkProjectPaused is used by the worker pool executor so that tasks
+// submitted before a pause, and scheduled background jobs, are skipped.
+func (app *WSApp) checkProjectPaused(ctx context.Context, sessionID string) error {
+	if _, pause := app.sessionProjectPause(ctx, sessionID); pause != nil {
+		return pause.Error()
+	}
+	return nil
+}
+
+// subscribeProjectPauses listens for project pause/resume commands from the HTTP service.
+func (app *WSApp) subscribeProjectPauses(ctx context.Context) {
+	if app.RedisCmd == nil {
+		return
+	}
+	if app.RedisStream != nil {
+		app.pausedPrompts.store = app.RedisStream
+	}
+	cmds, cancel := app.RedisCmd.SubscribeGlobalCommands(ctx)
+	app.cleanupFuncs = append(app.cleanupFuncs, func() error {
+		cancel()
+		return nil
+	})
+
+	go app.resumePausedProjects(ctx)
+
+	go func() {
+		slog.Info("[GOROUTINE] Project pause subscriber started")
+		defer slog.Info("[GOROUTINE] Project pause subscriber stopped")
+		for cmd := range cmds {
+			if cmd.Type != storeredis.CmdProjectPause && cmd.Type != storeredis.CmdProjectResume {
+				continue
+			}
+			var payload storeredis.ProjectPausePayload
+			if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+				slog.Warn("Failed to unmarshal project pause payload", "error", err)
+				continue
+			}
+			switch cmd.Type {
+			case storeredis.CmdProjectPause:
+				slog.Info("Project paused", "project_id", payload.ProjectID, "drain", payload.Drain)
+				if payload.Drain && app.AgentCoordinator != nil {
+					for _, sessionID := range payload.SessionIDs {
+						slog.Info("Draining agent run for paused project", "project_id", payload.ProjectID, "session_id", sessionID)
+						// An admin paused the project, the run is stopped on their behalf
+						app.AgentCoordinator.CancelWithMode(sessionID, agent.CancelSoft, message.CancelReasonUser)
+					}
+				}
+			case storeredis.CmdProjectResume:
+				slog.Info("Project resumed", "project_id", payload.ProjectID)
+				app.submitQueuedPrompts(payload.ProjectID)
+			}
+		}
+	}()
+}
+
+// isProjectPausedErr reports whether an agent task was skipped because of a maintenance window.
+func isProjectPausedErr(err error) bool {
+	return errors.Is(err, project.ErrProjectPaused)
+}
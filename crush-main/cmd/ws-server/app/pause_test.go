@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/project"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryPausedStore is a pausedPromptStore shared by the test instances.
+type memoryPausedStore struct {
+	mu      sync.Mutex
+	prompts map[string][][]byte
+}
+
+func (s *memoryPausedStore) HoldPausedPrompt(_ context.Context, projectID string, prompt []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prompts[projectID] = append(s.prompts[projectID], prompt)
+	return len(s.prompts[projectID]), nil
+}
+
+func (s *memoryPausedStore) TakePausedPrompts(_ context.Context, projectID string) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prompts := s.prompts[projectID]
+	delete(s.prompts, projectID)
+	return prompts, nil
+}
+
+func (s *memoryPausedStore) PausedProjects(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var projectIDs []string
+	for projectID := range s.prompts {
+		projectIDs = append(projectIDs, projectID)
+	}
+	return projectIDs, nil
+}
+
+// pausingProjects pauses the projects until their resume time.
+type pausingProjects struct {
+	project.Service
+	mu       sync.Mutex
+	resumeAt map[string]int64
+}
+
+func (p *pausingProjects) GetPause(_ context.Context, projectID string) (*project.Pause, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	resumeAt, ok := p.resumeAt[projectID]
+	if !ok || time.Now().UnixMilli() >= resumeAt {
+		return nil, nil
+	}
+	return &project.Pause{ProjectID: projectID, Mode: project.PauseModeQueue, ResumeAt: resumeAt}, nil
+}
+
+// recordingPool records the submitted tasks.
+type recordingPool struct {
+	agent.AgentWorkerPool
+	tasks chan agent.AgentTask
+}
+
+func (p *recordingPool) Submit(_ context.Context, task agent.AgentTask) error {
+	p.tasks <- task
+	return nil
+}
+
+func (p *recordingPool) Stats() agent.PoolStats { return agent.PoolStats{} }
+
+func newPauseTestApp(store pausedPromptStore, projects project.Service) (*WSApp, *recordingPool) {
+	pool := &recordingPool{tasks: make(chan agent.AgentTask, 10)}
+	app := &WSApp{Projects: projects, AgentWorkerPool: pool}
+	app.pausedPrompts.store = store
+	return app, pool
+}
+
+func receiveTask(t *testing.T, pool *recordingPool) agent.AgentTask {
+	t.Helper()
+	select {
+	case task := <-pool.tasks:
+		return task
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queued prompt was not submitted")
+		return agent.AgentTask{}
+	}
+}
+
+func TestPausedPromptsReleasedAtResumeTime(t *testing.T) {
+	resumeAt := time.Now().Add(100 * time.Millisecond).UnixMilli()
+	projects := &pausingProjects{resumeAt: map[string]int64{"p1": resumeAt}}
+	app, pool := newPauseTestApp(&memoryPausedStore{prompts: map[string][][]byte{}}, projects)
+
+	require.Equal(t, 1, app.pausedPrompts.add("p1", queuedPrompt{sessionID: "s1", content: "first"}))
+	require.Equal(t, 2, app.pausedPrompts.add("p1", queuedPrompt{sessionID: "s1", content: "second", planMode: true}))
+	app.scheduleResume("p1", resumeAt)
+
+	// No other prompt arrives, the timer releases them in order
+	first := receiveTask(t, pool)
+	require.Equal(t, "first", first.Prompt)
+	second := receiveTask(t, pool)
+	require.Equal(t, "second", second.Prompt)
+	require.True(t, second.PlanMode)
+	require.GreaterOrEqual(t, time.Now().UnixMilli(), resumeAt)
+}
+
+func TestPausedPromptsWaitForExtendedWindow(t *testing.T) {
+	projects := &pausingProjects{resumeAt: map[string]int64{"p1": time.Now().Add(time.Hour).UnixMilli()}}
+	app, pool := newPauseTestApp(&memoryPausedStore{prompts: map[string][][]byte{}}, projects)
+	app.pausedPrompts.add("p1", queuedPrompt{sessionID: "s1", content: "held"})
+	t.Cleanup(func() { app.pausedPrompts.take("p1") })
+
+	// The window was extended after the timer was set
+	app.releaseIfResumed("p1")
+	require.Empty(t, pool.tasks)
+	app.pausedPrompts.mu.Lock()
+	require.Contains(t, app.pausedPrompts.timers, "p1")
+	app.pausedPrompts.mu.Unlock()
+}
+
+func TestPausedPromptsSurviveRestart(t *testing.T) {
+	store := &memoryPausedStore{prompts: map[string][][]byte{}}
+	projects := &pausingProjects{resumeAt: map[string]int64{}}
+	before, _ := newPauseTestApp(store, projects)
+	before.pausedPrompts.add("p1", queuedPrompt{sessionID: "s1", content: "held", agent: "task", workingDir: "/w"})
+
+	// Another instance, or this one restarted, finds the window over
+	after, pool := newPauseTestApp(store, projects)
+	after.resumePausedProjects(t.Context())
+	task := receiveTask(t, pool)
+	require.Equal(t, "held", task.Prompt)
+	require.Equal(t, "task", task.Agent)
+	require.Equal(t, "/w", task.WorkingDir)
+
+	// The prompts run once
+	require.Empty(t, before.pausedPrompts.take("p1"))
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+)
+
+// subscribePlanRuns listens for prompts run in plan mode through the HTTP API.
+func (app *WSApp) subscribePlanRuns(ctx context.Context) {
+	if app.RedisCmd == nil {
+		return
+	}
+	cmds, cancel := app.RedisCmd.SubscribeGlobalCommands(ctx)
+	app.cleanupFuncs = append(app.cleanupFuncs, func() error {
+		cancel()
+		return nil
+	})
+
+	go func() {
+		slog.Info("[GOROUTINE] Plan run subscriber started")
+		defer slog.Info("[GOROUTINE] Plan run subscriber stopped")
+		for cmd := range cmds {
+			if cmd.Type != storeredis.CmdPlanRun {
+				continue
+			}
+			var run storeredis.PlanRunPayload
+			if err := json.Unmarshal(cmd.Payload, &run); err != nil {
+				slog.Warn("Failed to unmarshal plan run payload", "error", err)
+				continue
+			}
+			app.runPlanPrompt(ctx, run)
+		}
+	}()
+}
+
+// runPlanPrompt runs a prompt with read-only tools and stores the answer of
+// the agent as the plan, for the HTTP API to return.
+func (app *WSApp) runPlanPrompt(ctx context.Context, run storeredis.PlanRunPayload) {
+	// Every WS instance receives the broadcast, only one of them runs it
+	claimed, err := app.RedisCmd.ClaimCommand(ctx, string(storeredis.CmdPlanRun)+":"+run.ID, webhookRunClaimTTL)
+	if err != nil {
+		slog.Warn("Failed to claim plan run", "session_id", run.SessionID, "plan_id", run.ID, "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	slog.Info("Running plan prompt", "session_id", run.SessionID, "plan_id", run.ID, "agent", run.Agent)
+	planRun := storeredis.PlanRun{ID: run.ID, SessionID: run.SessionID, RequestedAt: run.RequestedAt}
+	if !app.ensureAgentInitialized() {
+		app.finishPlanRun(planRun, "", errors.New("agent not initialized"))
+		return
+	}
+	if app.AgentWorkerPool == nil {
+		app.finishPlanRun(planRun, "", errors.New("worker pool not available"))
+		return
+	}
+	if app.draining.Load() {
+		app.finishPlanRun(planRun, "", errDraining)
+		return
+	}
+	if owner := app.claimSession(run.SessionID); owner != "" {
+		slog.Warn("Running plan prompt of a session owned by another instance", "session_id", run.SessionID, "owner", owner)
+	}
+
+	task := agent.AgentTask{
+		SessionID:  run.SessionID,
+		Prompt:     run.Prompt,
+		Agent:      run.Agent,
+		PlanMode:   true,
+		ResultChan: make(chan agent.AgentTaskResult, 1),
+	}
+	if err := app.AgentWorkerPool.Submit(ctx, task); err != nil {
+		app.finishPlanRun(planRun, "", fmt.Errorf("failed to submit plan run: %w", err))
+		return
+	}
+	planRun.Status = storeredis.PlanStatusRunning
+	app.setPlanRun(planRun)
+
+	go func() {
+		result := <-task.ResultChan
+		if result.Error != nil {
+			app.finishPlanRun(planRun, "", result.Error)
+			return
+		}
+		plan, err := app.lastAssistantText(context.Background(), run.SessionID)
+		app.finishPlanRun(planRun, plan, err)
+	}()
+}
+
+// lastAssistantText returns the text of the last assistant message of a session.
+func (app *WSApp) lastAssistantText(ctx context.Context, sessionID string) (string, error) {
+	msgs, err := app.Messages.List(ctx, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list session messages: %w", err)
+	}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == message.Assistant && msgs[i].Content().Text != "" {
+			return msgs[i].Content().Text, nil
+		}
+	}
+	return "", nil
+}
+
+// finishPlanRun stores the plan of a run, or the error that stopped it.
+func (app *WSApp) finishPlanRun(planRun storeredis.PlanRun, plan string, err error) {
+	planRun.Status = storeredis.PlanStatusDone
+	planRun.Plan = plan
+	if err != nil {
+		slog.Warn("Plan run failed", "session_id", planRun.SessionID, "plan_id", planRun.ID, "error", err)
+		planRun.Status = storeredis.PlanStatusFailed
+		planRun.Error = err.Error()
+	}
+	planRun.FinishedAt = time.Now().UnixMilli()
+	app.setPlanRun(planRun)
+}
+
+func (app *WSApp) setPlanRun(planRun storeredis.PlanRun) {
+	if app.RedisStream == nil {
+		return
+	}
+	if err := app.RedisStream.SetPlanRun(context.Background(), planRun); err != nil {
+		slog.Warn("Failed to store plan run", "session_id", planRun.SessionID, "plan_id", planRun.ID, "error", err)
+	}
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/permission"
+)
+
+// SessionPolicy returns the permission policy of the project of a session and
+// the project directory its path patterns are relative to.
+func (app *WSApp) SessionPolicy(ctx context.Context, sessionID string) ([]permission.PolicyRule, string, error) {
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil || sess.ProjectID == "" {
+		return nil, "", err
+	}
+	rules, err := app.Projects.GetPermissionPolicy(ctx, sess.ProjectID)
+	if err != nil || len(rules) == 0 {
+		return nil, "", err
+	}
+	proj, err := app.Projects.GetByID(ctx, sess.ProjectID)
+	if err != nil {
+		return nil, "", err
+	}
+	return rules, cmp.Or(proj.WorkdirPath.String, proj.WorkspacePath), nil
+}
+
+// SessionShadowPolicy returns the candidate permission policy trialed in
+// shadow mode for the project of a session, nil when no trial is running.
+func (app *WSApp) SessionShadowPolicy(ctx context.Context, sessionID string) ([]permission.PolicyRule, string, error) {
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil || sess.ProjectID == "" {
+		return nil, "", err
+	}
+	shadow, err := app.Projects.GetShadowPolicy(ctx, sess.ProjectID)
+	if err != nil || shadow == nil || !shadow.Active(time.Now()) {
+		return nil, "", err
+	}
+	proj, err := app.Projects.GetByID(ctx, sess.ProjectID)
+	if err != nil {
+		return nil, "", err
+	}
+	return shadow.Rules, cmp.Or(proj.WorkdirPath.String, proj.WorkspacePath), nil
+}
+
+// RecordShadowDecision stores the decisions of the enforced and shadow
+// permission policies of the project of a session.
+func (app *WSApp) RecordShadowDecision(ctx context.Context, decision permission.ShadowDecision) {
+	sess, err := app.Sessions.Get(ctx, decision.SessionID)
+	if err == nil && sess.ProjectID != "" {
+		err = app.Projects.RecordShadowDecision(ctx, sess.ProjectID, decision)
+	}
+	if err != nil {
+		slog.Warn("Failed to record shadow permission decision", "session_id", decision.SessionID, "error", err)
+	}
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/handler"
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+// HandlePresence stores the editor presence of a collaborator and broadcasts
+// the presence of everyone in the session. Typing signals are handled by
+// handleTyping.
+func (app *WSApp) HandlePresence(sessionID string, user handler.PresenceUser, rawMsg []byte) {
+	ctx := context.Background()
+
+	msg, err := protocol.DecodeClientMessage(rawMsg)
+	if err != nil {
+		slog.Warn("Failed to unmarshal presence message", "error", err, "session_id", sessionID)
+		return
+	}
+	if msg.Type == protocol.TypeUserTyping {
+		app.handleTyping(ctx, sessionID, user, msg.Typing)
+		return
+	}
+
+	presence := storeredis.Presence{
+		UserID:   user.UserID,
+		Username: user.Username,
+	}
+	var position struct {
+		Path       string                       `json:"path"`
+		Cursor     *storeredis.PresencePosition `json:"cursor"`
+		Selections []storeredis.PresenceRange   `json:"selections"`
+	}
+	if err := json.Unmarshal(protocol.ClientPayload(rawMsg), &position); err != nil {
+		slog.Warn("Failed to unmarshal presence message", "error", err, "session_id", sessionID)
+		return
+	}
+	presence.Path = position.Path
+	presence.Cursor = position.Cursor
+	presence.Selections = position.Selections
+
+	// Without Redis only the update itself is relayed to the session
+	if app.RedisStream == nil {
+		app.send(sessionID, protocol.Presence{
+			SessionID: sessionID,
+			Users:     []storeredis.Presence{presence},
+		}, 0)
+		return
+	}
+
+	if err := app.RedisStream.SetPresence(ctx, sessionID, user.ConnID, presence); err != nil {
+		slog.Warn("Failed to store presence", "error", err, "session_id", sessionID, "user_id", user.UserID)
+		return
+	}
+
+	app.sendPresence(ctx, sessionID)
+}
+
+// HandleAttach tracks a connection that started or stopped following a
+// session. A user joins a session with their first connection to it and
+// leaves it with their last, on any instance: the other clients are told,
+// followed by the presence of everyone in the session. A user who leaves is
+// no longer typing.
+func (app *WSApp) HandleAttach(sessionID string, user handler.PresenceUser, attached bool) {
+	ctx := context.Background()
+
+	presence := storeredis.Presence{
+		UserID:   user.UserID,
+		Username: user.Username,
+	}
+	// The change is announced when the connections cannot be counted
+	changed := true
+	if app.RedisStream != nil {
+		if attached {
+			first, err := app.RedisStream.JoinPresence(ctx, sessionID, user.ConnID, presence)
+			if err != nil {
+				slog.Warn("Failed to store presence", "error", err, "session_id", sessionID, "user_id", user.UserID)
+			} else {
+				changed = first
+			}
+		} else {
+			last, err := app.RedisStream.RemovePresence(ctx, sessionID, user.ConnID, user.UserID)
+			if err != nil {
+				slog.Warn("Failed to remove presence", "error", err, "session_id", sessionID, "user_id", user.UserID)
+			} else {
+				changed = last
+			}
+			if changed {
+				if err := app.RedisStream.SetTyping(ctx, sessionID, user.UserID, false); err != nil {
+					slog.Warn("Failed to clear typing", "error", err, "session_id", sessionID, "user_id", user.UserID)
+				}
+			}
+		}
+	} else {
+		// Without Redis this instance has all the connections
+		connections := app.WSServer.UserConnections(sessionID, user.UserID)
+		changed = attached && connections == 1 || !attached && connections == 0
+	}
+	slog.Debug("Session connection changed", "session_id", sessionID, "user_id", user.UserID, "conn_id", user.ConnID, "attached", attached, "user_changed", changed)
+
+	if changed {
+		app.send(sessionID, protocol.PresenceChange{
+			SessionID: sessionID,
+			UserID:    user.UserID,
+			Username:  user.Username,
+			Joined:    attached,
+		}, 0)
+	}
+
+	// Without Redis only the change itself is relayed to the session
+	if app.RedisStream == nil {
+		if !changed {
+			return
+		}
+		app.send(sessionID, protocol.Presence{
+			SessionID: sessionID,
+			Users:     []storeredis.Presence{presence},
+			Left:      !attached,
+		}, 0)
+		return
+	}
+	app.sendPresence(ctx, sessionID)
+}
+
+// handleTyping stores whether a user is typing a prompt, for TypingTTL, and
+// relays it to the clients of the session.
+func (app *WSApp) handleTyping(ctx context.Context, sessionID string, user handler.PresenceUser, typing bool) {
+	if app.RedisStream != nil {
+		if err := app.RedisStream.SetTyping(ctx, sessionID, user.UserID, typing); err != nil {
+			slog.Warn("Failed to store typing", "error", err, "session_id", sessionID, "user_id", user.UserID)
+		}
+	}
+
+	event := protocol.UserTyping{
+		SessionID: sessionID,
+		UserID:    user.UserID,
+		Username:  user.Username,
+		Typing:    typing,
+	}
+	if typing {
+		event.ExpiresIn = int(storeredis.TypingTTL.Seconds())
+	}
+	app.send(sessionID, event, 0)
+}
+
+// sendPresence sends the presence of all collaborators of a session, and who
+// is typing, to its clients.
+func (app *WSApp) sendPresence(ctx context.Context, sessionID string) {
+	if app.RedisStream == nil {
+		return
+	}
+	users, err := app.RedisStream.GetSessionPresence(ctx, sessionID)
+	if err != nil {
+		slog.Warn("Failed to load session presence", "error", err, "session_id", sessionID)
+		return
+	}
+	typing, err := app.RedisStream.GetTyping(ctx, sessionID)
+	if err != nil {
+		slog.Warn("Failed to load typing users", "error", err, "session_id", sessionID)
+	}
+	app.send(sessionID, protocol.Presence{SessionID: sessionID, Users: users, Typing: typing}, 0)
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/pubsub"
+)
+
+// handleQueueUpdateEvent sends the prompts queued behind the running turn of
+// a session to its clients and mirrors them in Redis for the HTTP API.
+func (app *WSApp) handleQueueUpdateEvent(event pubsub.Event[agent.QueueUpdate]) {
+	app.sendQueueUpdate(event.Payload.SessionID)
+}
+
+func (app *WSApp) sendQueueUpdate(sessionID string) {
+	ctx := context.Background()
+	prompts := []agent.QueuedPrompt{}
+	if app.AgentCoordinator != nil {
+		prompts = append(prompts, app.AgentCoordinator.ListQueue(sessionID)...)
+	}
+
+	if app.RedisStream != nil {
+		mirrored := make([]storeredis.QueuedPrompt, len(prompts))
+		for i, p := range prompts {
+			mirrored[i] = storeredis.QueuedPrompt{
+				ID:          p.ID,
+				Agent:       p.Agent,
+				Prompt:      p.Prompt,
+				Attachments: p.Attachments,
+				QueuedAt:    p.QueuedAt,
+			}
+		}
+		if err := app.RedisStream.SetSessionQueue(ctx, sessionID, mirrored); err != nil {
+			slog.Warn("Failed to mirror session queue", "session_id", sessionID, "error", err)
+		}
+	}
+
+	event := protocol.QueueUpdated{
+		SessionID: sessionID,
+		Prompts:   prompts,
+		Count:     len(prompts),
+	}
+	seq := app.publishEvent(ctx, sessionID, event)
+	app.send(sessionID, event, seq)
+}
+
+// handleQueueMessage handles the queue messages of a client. Every change is
+// answered with a queue_updated event, queue_list sends one right away.
+func (app *WSApp) handleQueueMessage(msgType, sessionID, promptID string, promptIDs []string) {
+	if sessionID == "" {
+		return
+	}
+	var err error
+	switch msgType {
+	case "queue_list":
+		app.sendQueueUpdate(sessionID)
+	case "queue_remove":
+		err = app.handleQueueCommand(storeredis.CmdQueueRemove, storeredis.QueueCommandPayload{SessionID: sessionID, PromptID: promptID})
+	case "queue_reorder":
+		err = app.handleQueueCommand(storeredis.CmdQueueReorder, storeredis.QueueCommandPayload{SessionID: sessionID, PromptIDs: promptIDs})
+	}
+	if err != nil {
+		app.sendErrorToClient(sessionID, err)
+	}
+}
+
+// handleQueueCommand removes or reorders queued prompts of a session. It
+// reports agent.ErrQueuedPromptNotFound when the prompts are not queued here.
+func (app *WSApp) handleQueueCommand(cmdType storeredis.CommandType, payload storeredis.QueueCommandPayload) error {
+	if app.AgentCoordinator == nil {
+		return agent.ErrQueuedPromptNotFound
+	}
+	switch cmdType {
+	case storeredis.CmdQueueRemove:
+		slog.Info("Removing queued prompt", "session_id", payload.SessionID, "prompt_id", payload.PromptID)
+		return app.AgentCoordinator.RemoveQueued(payload.SessionID, payload.PromptID)
+	case storeredis.CmdQueueReorder:
+		slog.Info("Reordering queued prompts", "session_id", payload.SessionID, "prompt_ids", payload.PromptIDs)
+		return app.AgentCoordinator.ReorderQueue(payload.SessionID, payload.PromptIDs)
+	}
+	return nil
+}
+
+// subscribeQueueCommands listens for queue changes made through the HTTP API.
+func (app *WSApp) subscribeQueueCommands(ctx context.Context) {
+	if app.RedisCmd == nil {
+		return
+	}
+	cmds, cancel := app.RedisCmd.SubscribeGlobalCommands(ctx)
+	app.cleanupFuncs = append(app.cleanupFuncs, func() error {
+		cancel()
+		return nil
+	})
+
+	go func() {
+		slog.Info("[GOROUTINE] Queue command subscriber started")
+		defer slog.Info("[GOROUTINE] Queue command subscriber stopped")
+		for cmd := range cmds {
+			if cmd.Type != storeredis.CmdQueueRemove && cmd.Type != storeredis.CmdQueueReorder {
+				continue
+			}
+			var payload storeredis.QueueCommandPayload
+			if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+				slog.Warn("Failed to unmarshal queue command payload", "error", err)
+				continue
+			}
+			// Every WS instance receives the broadcast, the queue lives on one of them
+			if err := app.handleQueueCommand(cmd.Type, payload); err != nil && !errors.Is(err, agent.ErrQueuedPromptNotFound) {
+				slog.Warn("Failed to apply queue command", "type", cmd.Type, "session_id", payload.SessionID, "error", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/handler"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/ratelimit"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// startRateLimits rejects the prompts sent over the limits of their user or
+// session with a rate_limited event. The buckets are shared by the instances
+// through Redis when available.
+func (app *WSApp) startRateLimits(cfg config.RateLimitConfig) {
+	var store ratelimit.Store
+	if client := storeredis.GetClient(); client != nil {
+		store = storeredis.NewRateLimitStore(client)
+	}
+	users := ratelimit.New(store, "ws:user:", ratelimit.Limit(cfg.User))
+	sessions := ratelimit.New(store, "ws:session:", ratelimit.Limit(cfg.Session))
+	if users == nil && sessions == nil {
+		return
+	}
+	app.WSServer.SetRateLimiter(func(user handler.PresenceUser, sessionID string, rawMsg []byte) (bool, time.Duration) {
+		return limitMessage(users, sessions, user, sessionID, rawMsg)
+	})
+	slog.Info("Prompt rate limits enabled", "user_rate", cfg.User.Rate, "session_rate", cfg.Session.Rate)
+}
+
+// limitMessage takes a token from the buckets of the user and session of a
+// prompt. Messages that do not run the agent, such as cancellations and
+// permission responses, are never limited.
+func limitMessage(users, sessions *ratelimit.Limiter, user handler.PresenceUser, sessionID string, rawMsg []byte) (bool, time.Duration) {
+	var msg struct {
+		Type      string `json:"type"`
+		SessionID string `json:"sessionID"`
+	}
+	if err := json.Unmarshal(rawMsg, &msg); err != nil || !isPromptMessage(msg.Type) {
+		return true, 0
+	}
+	if msg.SessionID != "" {
+		sessionID = msg.SessionID
+	}
+
+	ctx := context.Background()
+	if ok, retryAfter := users.Allow(ctx, user.UserID); !ok {
+		return false, retryAfter
+	}
+	// New sessions are only limited per user
+	if sessionID != "" {
+		if ok, retryAfter := sessions.Allow(ctx, sessionID); !ok {
+			return false, retryAfter
+		}
+	}
+	return true, 0
+}
+
+// isPromptMessage reports whether a client message type submits a prompt to
+// the agent, see handleClientMessage.
+func isPromptMessage(msgType string) bool {
+	switch msgType {
+	case "reconnect", "backfill", "permission_response", "cancel", "presence", "user_typing",
+		"queue_list", "queue_remove", "queue_reorder", "set_model", "set_env", "stream_ack":
+		return false
+	}
+	return true
+}
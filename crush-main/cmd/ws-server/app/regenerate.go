@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/domain/session"
+	"github.com/rolling1314/rolling-crush/domain/toolcall"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/internal/pubsub"
+)
+
+// regenerateFrom truncates a session back to one of its user messages before
+// the edited prompt runs in its place: the message and every later message
+// and tool call are deleted, and the token counters are restored to the ones
+// of the session when the message was sent. It all happens in one
+// transaction, a failure leaves the session as it was and the prompt is not
+// run.
+func (app *WSApp) regenerateFrom(sessionID, messageID string) error {
+	if messageID == "" {
+		return apierr.WithCode(apierr.CodeInvalidRequest, errors.New("message_id is required to regenerate"))
+	}
+	if app.AgentCoordinator.IsSessionBusy(sessionID) {
+		return apierr.WithCode(apierr.CodeSessionBusy, errors.New("the session is busy, cancel the running turn before regenerating"))
+	}
+
+	ctx := context.Background()
+	msg, err := app.Messages.Get(ctx, messageID)
+	if err != nil || msg.SessionID != sessionID {
+		return message.ErrMessageNotInSession
+	}
+	if msg.Role != message.User {
+		return apierr.WithCode(apierr.CodeInvalidRequest, errors.New("only user messages can be edited"))
+	}
+
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var deleted []message.Message
+	if app.conn == nil {
+		deleted, sess, err = truncateSession(ctx, app.Messages, app.ToolCalls, app.Sessions, sess, messageID)
+	} else {
+		deleted, sess, err = app.truncateSessionTx(ctx, sess, messageID)
+	}
+	if err != nil {
+		return err
+	}
+
+	deletedIDs := make([]string, len(deleted))
+	for i, m := range deleted {
+		deletedIDs[i] = m.ID
+	}
+	slog.Info("Truncated session to regenerate", "session_id", sessionID, "message_id", messageID, "deleted", len(deleted))
+	event := protocol.MessagesTruncated{
+		SessionID:  sessionID,
+		MessageID:  messageID,
+		MessageIDs: deletedIDs,
+	}
+	seq := app.publishEvent(ctx, sessionID, event)
+	app.send(sessionID, event, seq)
+	return nil
+}
+
+// truncateSessionTx runs truncateSession in a transaction. The buffered
+// writes of the messages are flushed first, the transaction sees them.
+func (app *WSApp) truncateSessionTx(ctx context.Context, sess session.Session, messageID string) ([]message.Message, session.Session, error) {
+	// The writes failing to flush may be the ones of other sessions, they
+	// are retried by the batcher
+	if err := app.Messages.Flush(ctx); err != nil {
+		slog.Warn("Failed to flush messages before truncating", "session_id", sess.ID, "error", err)
+	}
+	tx, err := app.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, session.Session{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	qtx := app.db.WithTx(tx)
+	deleted, sess, err := truncateSession(ctx, message.NewService(qtx), toolcall.NewService(qtx), session.NewService(qtx), sess, messageID)
+	if err != nil {
+		return nil, session.Session{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, session.Session{}, fmt.Errorf("failed to commit truncation: %w", err)
+	}
+	// The session was saved by a service of the transaction, the clients
+	// are told here
+	app.handleSessionEvent(pubsub.Event[session.Session]{Type: pubsub.UpdatedEvent, Payload: sess})
+	return deleted, sess, nil
+}
+
+// truncateSession deletes a message of a session, the later ones and their
+// tool calls, clears the summary pointer when its message is deleted and
+// restores the token counters of the message. The first failure is returned,
+// a transaction around it is rolled back.
+func truncateSession(ctx context.Context, messages message.Service, toolCalls toolcall.Service, sessions session.Service, sess session.Session, messageID string) ([]message.Message, session.Session, error) {
+	deleted, err := messages.Truncate(ctx, sess.ID, messageID)
+	if err != nil {
+		return nil, session.Session{}, fmt.Errorf("failed to truncate session: %w", err)
+	}
+	for _, m := range deleted {
+		if m.ID == sess.SummaryMessageID {
+			sess.SummaryMessageID = ""
+		}
+		calls, err := toolCalls.ListByMessage(ctx, m.ID)
+		if err != nil {
+			return nil, session.Session{}, fmt.Errorf("failed to list tool calls of message %s: %w", m.ID, err)
+		}
+		for _, tc := range calls {
+			if err := toolCalls.Delete(ctx, tc.ID); err != nil {
+				return nil, session.Session{}, fmt.Errorf("failed to delete tool call %s: %w", tc.ID, err)
+			}
+		}
+	}
+
+	// Saves the cleared summary pointer with the counters
+	restored, err := sessions.RestoreCheckpoint(ctx, sess, messageID)
+	if err != nil {
+		return nil, session.Session{}, fmt.Errorf("failed to restore session token counters: %w", err)
+	}
+	return deleted, restored, nil
+}
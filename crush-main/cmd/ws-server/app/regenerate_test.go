@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/handler"
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/domain/session"
+	"github.com/rolling1314/rolling-crush/domain/toolcall"
+	"github.com/stretchr/testify/require"
+)
+
+// truncatedMessages truncates the messages it holds, in order.
+type truncatedMessages struct {
+	storedMessages
+	order []string
+}
+
+func (m *truncatedMessages) Truncate(_ context.Context, _ string, messageID string) ([]message.Message, error) {
+	for i, id := range m.order {
+		if id == messageID {
+			var deleted []message.Message
+			for _, id := range m.order[i:] {
+				deleted = append(deleted, m.messages[id])
+			}
+			m.order = m.order[:i]
+			return deleted, nil
+		}
+	}
+	return nil, message.ErrMessageNotInSession
+}
+
+// messageToolCalls lists the tool calls of the messages and records the
+// deleted ones.
+type messageToolCalls struct {
+	toolcall.Service
+	byMessage map[string][]toolcall.ToolCall
+	deleted   []string
+}
+
+func (t *messageToolCalls) ListByMessage(_ context.Context, messageID string) ([]toolcall.ToolCall, error) {
+	return t.byMessage[messageID], nil
+}
+
+func (t *messageToolCalls) Delete(_ context.Context, id string) error {
+	t.deleted = append(t.deleted, id)
+	return nil
+}
+
+// checkpointSessions restores the counters of the session, or fails with err.
+type checkpointSessions struct {
+	session.Service
+	sess  session.Session
+	err   error
+	saved []session.Session
+}
+
+func (s *checkpointSessions) Get(context.Context, string) (session.Session, error) {
+	return s.sess, nil
+}
+
+func (s *checkpointSessions) RestoreCheckpoint(_ context.Context, sess session.Session, _ string) (session.Session, error) {
+	if s.err != nil {
+		return session.Session{}, s.err
+	}
+	sess.PromptTokens = 10
+	s.saved = append(s.saved, sess)
+	return sess, nil
+}
+
+func newRegenerateTestApp(sessions *checkpointSessions) (*WSApp, *truncatedMessages, *messageToolCalls, chan protocol.Envelope) {
+	messages := &truncatedMessages{
+		storedMessages: storedMessages{messages: map[string]message.Message{
+			"m1": {ID: "m1", SessionID: "s1", Role: message.User},
+			"m2": {ID: "m2", SessionID: "s1", Role: message.Assistant},
+			"m3": {ID: "m3", SessionID: "s1", Role: message.Assistant},
+		}},
+		order: []string{"m1", "m2", "m3"},
+	}
+	toolCalls := &messageToolCalls{byMessage: map[string][]toolcall.ToolCall{"m2": {{ID: "t1"}}}}
+	sent := make(chan protocol.Envelope, 10)
+	server := handler.New()
+	server.SetRelay(func(_ string, data []byte) {
+		var env protocol.Envelope
+		if json.Unmarshal(data, &env) == nil {
+			sent <- env
+		}
+	})
+	return &WSApp{
+		Messages:         messages,
+		ToolCalls:        toolCalls,
+		Sessions:         sessions,
+		AgentCoordinator: &busyCoordinator{busy: map[string]bool{}},
+		WSServer:         server,
+	}, messages, toolCalls, sent
+}
+
+func TestRegenerateFromClearsSummary(t *testing.T) {
+	sessions := &checkpointSessions{sess: session.Session{ID: "s1", SummaryMessageID: "m3", PromptTokens: 500}}
+	app, messages, toolCalls, sent := newRegenerateTestApp(sessions)
+
+	require.NoError(t, app.regenerateFrom("s1", "m1"))
+	require.Empty(t, messages.order)
+	require.Equal(t, []string{"t1"}, toolCalls.deleted)
+	require.Len(t, sessions.saved, 1)
+	require.Empty(t, sessions.saved[0].SummaryMessageID, "the summary was truncated")
+	require.EqualValues(t, 10, sessions.saved[0].PromptTokens)
+
+	env := <-sent
+	require.Equal(t, protocol.TypeMessagesTruncated, env.Type)
+}
+
+func TestRegenerateFromAbortsOnCheckpointFailure(t *testing.T) {
+	sessions := &checkpointSessions{sess: session.Session{ID: "s1", SummaryMessageID: "m3"}, err: errors.New("connection reset")}
+	app, _, _, sent := newRegenerateTestApp(sessions)
+
+	err := app.regenerateFrom("s1", "m1")
+	require.ErrorContains(t, err, "failed to restore session token counters")
+	require.Empty(t, sessions.saved)
+	require.Empty(t, sent, "the clients are not told of a truncation that is rolled back")
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// maxRetryTemperature bounds the temperature of a retried turn, the highest
+// one the providers accept.
+const maxRetryTemperature = 2
+
+// retryTurn is the last turn of a session to run again.
+type retryTurn struct {
+	// messageID is the user message of the turn, the session is truncated
+	// back to it like a regenerated message
+	messageID string
+	content   string
+	// images reference the images of the user message, they are resolved
+	// before the message is deleted
+	images   []protocol.ImageAttachment
+	override *config.ModelOverride
+}
+
+// prepareRetry finds the last user message of a session and validates the
+// parameters the retry overrides. Nothing is deleted yet.
+func (app *WSApp) prepareRetry(sessionID string, msg protocol.ClientMessage) (retryTurn, error) {
+	if app.AgentCoordinator.IsSessionBusy(sessionID) {
+		return retryTurn{}, apierr.WithCode(apierr.CodeSessionBusy, errors.New("the session is busy, cancel the running turn before retrying"))
+	}
+	ctx := context.Background()
+	override, err := app.retryOverride(ctx, sessionID, msg)
+	if err != nil {
+		return retryTurn{}, err
+	}
+
+	messages, err := app.Messages.List(ctx, sessionID)
+	if err != nil {
+		return retryTurn{}, fmt.Errorf("failed to list messages: %w", err)
+	}
+	last := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == message.User {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return retryTurn{}, apierr.WithCode(apierr.CodeInvalidRequest, errors.New("the session has no turn to retry"))
+	}
+	prompt := messages[last]
+
+	turn := retryTurn{messageID: prompt.ID, content: prompt.Content().Text, override: override}
+	for index, part := range prompt.Parts {
+		if bc, ok := part.(message.BinaryContent); ok && bc.Path != "" {
+			turn.images = append(turn.images, protocol.ImageAttachment{
+				Type:      wsAttachmentReference,
+				MimeType:  bc.MIMEType,
+				MessageID: prompt.ID,
+				PartIndex: index,
+			})
+		}
+	}
+	return turn, nil
+}
+
+// retryOverride returns the model, temperature and reasoning effort a retry
+// runs with instead of the ones of the session, nil when it keeps them.
+func (app *WSApp) retryOverride(ctx context.Context, sessionID string, msg protocol.ClientMessage) (*config.ModelOverride, error) {
+	override := config.ModelOverride{
+		Provider:        msg.Provider,
+		Model:           msg.Model,
+		Temperature:     msg.Temperature,
+		ReasoningEffort: msg.ReasoningEffort,
+	}
+	if override == (config.ModelOverride{}) {
+		return nil, nil
+	}
+	if override.Provider != "" || override.Model != "" {
+		if override.Provider == "" || override.Model == "" {
+			return nil, apierr.WithCode(apierr.CodeInvalidRequest, errors.New("provider and model are required to retry with another model"))
+		}
+		if err := app.checkSessionModel(ctx, sessionID, override.Provider, override.Model); err != nil {
+			return nil, err
+		}
+	}
+	if t := override.Temperature; t != nil && (*t < 0 || *t > maxRetryTemperature) {
+		return nil, apierr.WithCode(apierr.CodeInvalidRequest, fmt.Errorf("temperature must be between 0 and %d", maxRetryTemperature))
+	}
+	if override.ReasoningEffort != "" && !slices.Contains(config.ReasoningEfforts, override.ReasoningEffort) {
+		return nil, apierr.WithCode(apierr.CodeInvalidRequest, fmt.Errorf("unknown reasoning effort %q, expected low, medium or high", override.ReasoningEffort))
+	}
+	return &override, nil
+}
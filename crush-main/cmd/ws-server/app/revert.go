@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+)
+
+// fileRevertClaimTTL outlives the permission prompt of a revert, so that no
+// other instance picks the command up while it waits.
+const fileRevertClaimTTL = time.Hour
+
+// subscribeFileReverts listens for file reverts requested through the HTTP
+// API and runs those of the sessions handled here.
+func (app *WSApp) subscribeFileReverts(ctx context.Context) {
+	if app.RedisCmd == nil {
+		return
+	}
+	cmds, cancel := app.RedisCmd.SubscribeGlobalCommands(ctx)
+	app.cleanupFuncs = append(app.cleanupFuncs, func() error {
+		cancel()
+		return nil
+	})
+
+	go func() {
+		slog.Info("[GOROUTINE] File revert subscriber started")
+		defer slog.Info("[GOROUTINE] File revert subscriber stopped")
+		for cmd := range cmds {
+			if cmd.Type != storeredis.CmdFileRevert {
+				continue
+			}
+			var revert storeredis.FileRevertPayload
+			if err := json.Unmarshal(cmd.Payload, &revert); err != nil {
+				slog.Warn("Failed to unmarshal file revert payload", "error", err)
+				continue
+			}
+			if app.remoteOwner(revert.SessionID) != "" {
+				continue
+			}
+			// Every WS instance receives the broadcast, only one of them runs it
+			claimed, err := app.RedisCmd.ClaimCommand(ctx, string(storeredis.CmdFileRevert)+":"+revert.ID, fileRevertClaimTTL)
+			if err != nil {
+				slog.Warn("Failed to claim file revert", "session_id", revert.SessionID, "revert_id", revert.ID, "error", err)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+			go app.revertFile(context.Background(), revert)
+		}
+	}()
+}
+
+// revertFile asks the clients of the session for permission to write a version
+// of a file back to the sandbox, then writes it and records it as a new
+// version. The outcome is sent to the session as a file_revert event.
+func (app *WSApp) revertFile(ctx context.Context, revert storeredis.FileRevertPayload) {
+	status, err := app.applyFileRevert(ctx, revert)
+	if err != nil {
+		slog.Warn("Failed to revert file", "session_id", revert.SessionID, "path", revert.Path, "version", revert.Version, "error", err)
+	} else {
+		slog.Info("File revert finished", "session_id", revert.SessionID, "path", revert.Path, "version", revert.Version, "status", status)
+	}
+
+	event := protocol.FileRevert{
+		SessionID: revert.SessionID,
+		ID:        revert.ID,
+		Path:      revert.Path,
+		Version:   revert.Version,
+		Status:    status,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	seq := app.publishEvent(ctx, revert.SessionID, event)
+	app.send(revert.SessionID, event, seq)
+}
+
+// applyFileRevert returns the status of a revert: reverted, denied or failed.
+func (app *WSApp) applyFileRevert(ctx context.Context, revert storeredis.FileRevertPayload) (string, error) {
+	files, err := app.History.ListBySession(ctx, revert.SessionID)
+	if err != nil {
+		return "failed", fmt.Errorf("failed to list file history: %w", err)
+	}
+	var target history.File
+	found := false
+	for _, versions := range history.GroupVersions(files) {
+		if versions.Path == revert.Path {
+			target, found = versions.Find(revert.Version)
+			break
+		}
+	}
+	if !found {
+		return "failed", fmt.Errorf("version %d of %s not found", revert.Version, revert.Path)
+	}
+
+	client := sandbox.GetDefaultClient()
+	current, err := client.ReadFile(ctx, sandbox.FileReadRequest{SessionID: revert.SessionID, FilePath: revert.Path})
+	if err != nil {
+		return "failed", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	granted, err := app.Permissions.RequestWithTimeout(ctx, permission.CreatePermissionRequest{
+		SessionID:   revert.SessionID,
+		ToolCallID:  "revert-" + revert.ID,
+		ToolName:    tools.EditToolName,
+		Description: fmt.Sprintf("Revert %s to version %d", revert.Path, revert.Version),
+		Action:      "write",
+		Params: tools.EditPermissionsParams{
+			FilePath:   revert.Path,
+			OldContent: current.Content,
+			NewContent: target.Content,
+		},
+		Path: revert.Path,
+	}, tools.GetPermissionTimeout(), "", nil)
+	if errors.Is(err, permission.ErrorPermissionDenied) {
+		return "denied", nil
+	}
+	if !granted {
+		return "denied", err
+	}
+
+	if _, err := client.WriteFile(ctx, sandbox.FileWriteRequest{
+		SessionID: revert.SessionID,
+		FilePath:  revert.Path,
+		Content:   target.Content,
+	}); err != nil {
+		return "failed", fmt.Errorf("failed to write file: %w", err)
+	}
+	if _, err := app.History.CreateVersion(ctx, revert.SessionID, revert.Path, target.Content); err != nil {
+		slog.Warn("Failed to record reverted file version", "session_id", revert.SessionID, "path", revert.Path, "error", err)
+	}
+	return "reverted", nil
+}
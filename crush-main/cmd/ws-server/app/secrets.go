@@ -0,0 +1,30 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+)
+
+// withProjectSecrets sets the secrets of the session's project as the
+// environment of the commands the run executes in the sandbox.
+func (app *WSApp) withProjectSecrets(ctx context.Context, sessionID string) context.Context {
+	if app.secrets == nil || app.db == nil {
+		return ctx
+	}
+	dbSession, err := app.db.GetSessionByID(ctx, sessionID)
+	if err != nil || !dbSession.ProjectID.Valid || dbSession.ProjectID.String == "" {
+		return ctx
+	}
+	env, err := app.secrets.ProjectEnv(ctx, dbSession.ProjectID.String)
+	if err != nil {
+		// The run goes on, its commands only miss the secrets
+		slog.Warn("Failed to load project secrets", "project_id", dbSession.ProjectID.String, "error", err)
+		return ctx
+	}
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, tools.EnvContextKey, env)
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+)
+
+// maxBackfillRange bounds the sequence numbers a client can ask for at once.
+const maxBackfillRange = 5000
+
+// publishEvent buffers an event in the session's Redis stream and returns its
+// sequence number in the session, 0 when it could not be buffered.
+func (app *WSApp) publishEvent(ctx context.Context, sessionID string, event protocol.Event) int64 {
+	if app.RedisStream == nil {
+		return 0
+	}
+	seq, err := app.RedisStream.PublishSequenced(ctx, sessionID, event.EventType(), event)
+	if err != nil {
+		slog.Warn("Failed to publish event to Redis stream", "session_id", sessionID, "type", event.EventType(), "error", err)
+		return 0
+	}
+	return seq
+}
+
+// send sends an event to the clients of a session. seq is the sequence number
+// of the event buffered in the session's stream, 0 for transient events.
+// Clients seeing a number skipped ask for it with a backfill message.
+func (app *WSApp) send(sessionID string, event protocol.Event, seq int64) {
+	env, err := protocol.NewEnvelope(sessionID, event, seq)
+	if err != nil {
+		slog.Error("Failed to encode WebSocket event", "session_id", sessionID, "type", event.EventType(), "error", err)
+		return
+	}
+	app.WSServer.SendToSession(sessionID, env)
+}
+
+// publishGenerationComplete buffers the end of a turn and also sends it to the
+// session, so live clients see its sequence number.
+func (app *WSApp) publishGenerationComplete(ctx context.Context, sessionID string, status storeredis.SessionRunningStatus, err error) {
+	// The deltas still held come before the end of the turn
+	app.deltas.closeSession(sessionID)
+	event := app.generationComplete(sessionID, status, err)
+	seq := app.publishEvent(ctx, sessionID, event)
+	if seq == 0 {
+		return
+	}
+	app.send(sessionID, event, seq)
+}
+
+// sendStreamMessage sends a buffered event to the session again, marked with
+// replay (protocol.ReplayReconnect or protocol.ReplayBackfill) and its stream
+// ID and sequence number.
+func (app *WSApp) sendStreamMessage(sessionID string, msg storeredis.StreamMessage, replay string) {
+	app.WSServer.SendToSession(sessionID, protocol.Replayed(sessionID, replay, msg.ID, msg.Type, msg.Seq, msg.Timestamp, msg.Payload))
+}
+
+// handleBackfill resends the events of a session a client reported missing.
+// Events still in the Redis stream are resent as they were; when some were
+// trimmed, the persisted messages of the session are resent from the
+// database so the client can rebuild its view. A backfill_complete message
+// tells the client what was recovered.
+func (app *WSApp) handleBackfill(sessionID string, fromSeq, toSeq int64) {
+	if sessionID == "" {
+		sessionID = app.currentSessionID
+	}
+	if sessionID == "" || fromSeq <= 0 || toSeq < fromSeq {
+		slog.Warn("Invalid backfill request", "session_id", sessionID, "from_seq", fromSeq, "to_seq", toSeq)
+		return
+	}
+	toSeq = min(toSeq, fromSeq+maxBackfillRange-1)
+
+	complete := protocol.BackfillComplete{
+		SessionID: sessionID,
+		FromSeq:   fromSeq,
+		ToSeq:     toSeq,
+	}
+	if app.RedisStream == nil {
+		complete.Source = "none"
+		app.send(sessionID, complete, 0)
+		return
+	}
+
+	ctx := context.Background()
+	messages, missing, err := app.RedisStream.ReadSequenceRange(ctx, sessionID, fromSeq, toSeq)
+	if err != nil {
+		slog.Error("Failed to read backfill range", "session_id", sessionID, "error", err)
+		missing = nil
+		for seq := fromSeq; seq <= toSeq; seq++ {
+			missing = append(missing, seq)
+		}
+	}
+	for _, msg := range messages {
+		app.sendStreamMessage(sessionID, msg, protocol.ReplayBackfill)
+	}
+	complete.Replayed = len(messages)
+	complete.Missing = len(missing)
+	complete.Source = "redis"
+
+	if len(missing) > 0 {
+		slog.Warn("Backfill range trimmed from Redis, resending messages from database",
+			"session_id", sessionID,
+			"from_seq", fromSeq,
+			"to_seq", toSeq,
+			"missing", len(missing),
+		)
+		msgs, err := app.Messages.List(ctx, sessionID)
+		if err != nil {
+			slog.Error("Failed to list session messages for backfill", "session_id", sessionID, "error", err)
+		} else {
+			for _, msg := range msgs {
+				payload, err := json.Marshal(protocol.Message{Message: msg})
+				if err != nil {
+					slog.Warn("Failed to marshal backfilled message", "session_id", sessionID, "message_id", msg.ID, "error", err)
+					continue
+				}
+				app.WSServer.SendToSession(sessionID, protocol.Replayed(sessionID, protocol.ReplayBackfill, "", protocol.TypeMessage, 0, 0, payload))
+			}
+			complete.Source = "redis+db"
+		}
+	}
+
+	slog.Info("Backfilled session events",
+		"session_id", sessionID,
+		"from_seq", fromSeq,
+		"to_seq", toSeq,
+		"replayed", len(messages),
+		"missing", len(missing),
+	)
+	app.send(sessionID, complete, 0)
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/snapshot"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/infra/storage"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// runSnapshotTimeout bounds the snapshot taken before a run, the run starts
+// without one when it takes longer.
+const runSnapshotTimeout = 2 * time.Minute
+
+// startRunSnapshots archives the project workspace before each run, so that
+// the edits of the run can be rolled back through the HTTP API.
+func (app *WSApp) startRunSnapshots(appCfg *config.AppConfig) {
+	client := storage.GetMinIOClient()
+	if client == nil {
+		slog.Warn("Snapshots before runs are enabled but storage is unavailable")
+		return
+	}
+	app.snapshots = snapshot.NewService(app.db, client, sandbox.GetDefaultClient(), snapshot.Options{
+		MaxSize:   int64(appCfg.Sandbox.SnapshotMaxSize) << 20,
+		Retention: appCfg.Sandbox.SnapshotRetention,
+	})
+	slog.Info("Workspace snapshots before runs enabled", "max_size_mb", appCfg.Sandbox.SnapshotMaxSize, "retention", appCfg.Sandbox.SnapshotRetention)
+}
+
+// snapshotBeforeRun archives the workspace of the project of a session and
+// tells its clients, a failure is logged and the run goes on.
+func (app *WSApp) snapshotBeforeRun(sessionID string) {
+	if app.snapshots == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), runSnapshotTimeout)
+	defer cancel()
+	sess, err := app.Sessions.Get(ctx, sessionID)
+	if err != nil || sess.ProjectID == "" {
+		return
+	}
+	snap, err := app.snapshots.Create(ctx, sess.ProjectID, sessionID, snapshot.ReasonRun, "")
+	if err != nil {
+		slog.Warn("Failed to snapshot workspace before run", "session_id", sessionID, "project_id", sess.ProjectID, "error", err)
+		return
+	}
+
+	event := protocol.WorkspaceSnapshot{
+		SessionID:  sessionID,
+		ProjectID:  sess.ProjectID,
+		SnapshotID: snap.ID,
+		Size:       snap.Size,
+	}
+	seq := app.publishEvent(ctx, sessionID, event)
+	app.send(sessionID, event, seq)
+}
@@ -0,0 +1,205 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+const (
+	// defaultDeltaCoalesceInterval is how long the text deltas of a message
+	// are merged before they are sent.
+	defaultDeltaCoalesceInterval = 50 * time.Millisecond
+	// defaultDeltaAckWindow is how many deltas of a message are sent ahead of
+	// the last one the client acknowledged.
+	defaultDeltaAckWindow = 64
+	// behindDeltaInterval is how long deltas are merged for a client behind
+	// the ack window, so a client that stopped acking still sees the reply.
+	behindDeltaInterval = time.Second
+)
+
+// deltaStreams coalesces the streaming deltas of the messages being generated
+// and numbers them per message. Consecutive text or reasoning deltas of a part
+// are merged for the coalesce interval, the other deltas flush them. Clients
+// acknowledge the deltas they applied with stream_ack; the deltas of a client
+// that falls behind by the ack window are merged until it catches up.
+type deltaStreams struct {
+	mu       sync.Mutex
+	streams  map[string]*deltaStream // by message ID
+	interval time.Duration           // 0 sends every delta right away
+	window   int64
+	send     func(message.StreamDelta)
+}
+
+type deltaStream struct {
+	mu        sync.Mutex
+	sessionID string
+	seq       int64 // last sent
+	acked     int64 // last acknowledged, 0 while the client does not ack
+	pending   *message.StreamDelta
+	timer     *time.Timer
+}
+
+func newDeltaStreams(appCfg *config.AppConfig, send func(message.StreamDelta)) *deltaStreams {
+	ds := &deltaStreams{
+		streams:  make(map[string]*deltaStream),
+		interval: defaultDeltaCoalesceInterval,
+		window:   defaultDeltaAckWindow,
+		send:     send,
+	}
+	if appCfg != nil {
+		switch {
+		case appCfg.Server.DeltaCoalesceInterval < 0:
+			ds.interval = 0
+		case appCfg.Server.DeltaCoalesceInterval > 0:
+			ds.interval = time.Duration(appCfg.Server.DeltaCoalesceInterval) * time.Millisecond
+		}
+		if appCfg.Server.DeltaAckWindow > 0 {
+			ds.window = int64(appCfg.Server.DeltaAckWindow)
+		}
+	}
+	return ds
+}
+
+// mergeable reports whether later deltas may be merged into d.
+func mergeable(d message.StreamDelta) bool {
+	return d.CanMerge(d)
+}
+
+// add queues a delta, sending it right away when it cannot be merged.
+func (ds *deltaStreams) add(d message.StreamDelta) {
+	if d.MessageID == "" {
+		// Errors are not part of a message
+		ds.send(d)
+		return
+	}
+	s := ds.stream(d.SessionID, d.MessageID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil && s.pending.CanMerge(d) {
+		merged := s.pending.Merge(d)
+		s.pending = &merged
+	} else {
+		ds.flushLocked(s)
+		s.pending = &d
+	}
+
+	switch {
+	case d.DeltaType == message.DeltaTypeFinish:
+		ds.flushLocked(s)
+		ds.remove(d.MessageID)
+	case !mergeable(d):
+		ds.flushLocked(s)
+	case ds.interval <= 0 && !ds.behindLocked(s):
+		// A client behind the window still gets merged deltas
+		ds.flushLocked(s)
+	case s.timer == nil:
+		delay := ds.interval
+		if ds.behindLocked(s) {
+			delay = behindDeltaInterval
+		}
+		s.timer = time.AfterFunc(delay, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			ds.flushLocked(s)
+		})
+	}
+}
+
+// ack records the last delta of a message a client applied, and sends the
+// deltas held back for it once it caught up.
+func (ds *deltaStreams) ack(sessionID, messageID string, seq int64) {
+	ds.mu.Lock()
+	s, ok := ds.streams[messageID]
+	ds.mu.Unlock()
+	if !ok || s.sessionID != sessionID {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq <= s.acked || seq > s.seq {
+		return
+	}
+	s.acked = seq
+	if s.pending != nil && !ds.behindLocked(s) {
+		ds.flushLocked(s)
+	}
+}
+
+// closeSession sends the held deltas of a session and forgets its messages,
+// e.g. when the turn ended without finishing them.
+func (ds *deltaStreams) closeSession(sessionID string) {
+	ds.mu.Lock()
+	var closed []*deltaStream
+	for id, s := range ds.streams {
+		if s.sessionID == sessionID {
+			closed = append(closed, s)
+			delete(ds.streams, id)
+		}
+	}
+	ds.mu.Unlock()
+	for _, s := range closed {
+		s.mu.Lock()
+		ds.flushLocked(s)
+		s.mu.Unlock()
+	}
+}
+
+func (ds *deltaStreams) stream(sessionID, messageID string) *deltaStream {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	s, ok := ds.streams[messageID]
+	if !ok {
+		s = &deltaStream{sessionID: sessionID}
+		ds.streams[messageID] = s
+	}
+	return s
+}
+
+func (ds *deltaStreams) remove(messageID string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	delete(ds.streams, messageID)
+}
+
+// behindLocked reports whether the client acknowledges deltas and is a window
+// or more behind.
+func (ds *deltaStreams) behindLocked(s *deltaStream) bool {
+	return s.acked > 0 && s.seq-s.acked >= ds.window
+}
+
+// flushLocked sends the pending delta of a stream with the next sequence
+// number.
+func (ds *deltaStreams) flushLocked(s *deltaStream) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.pending == nil {
+		return
+	}
+	s.seq++
+	s.pending.Seq = s.seq
+	ds.send(*s.pending)
+	s.pending = nil
+}
+
+// sendStreamDelta buffers a delta in the session's Redis stream and sends it
+// to the session.
+func (app *WSApp) sendStreamDelta(delta message.StreamDelta) {
+	sessionID := delta.SessionID
+	slog.Debug("Sending stream delta", "sessionID", sessionID, "messageID", delta.MessageID, "type", delta.DeltaType, "seq", delta.Seq, "contentLen", len(delta.Content))
+
+	// Publish delta to Redis stream for buffering (enables reconnection replay)
+	event := protocol.StreamDelta{StreamDelta: delta}
+	seq := app.publishEvent(context.Background(), sessionID, event)
+
+	// Send via WebSocket - always try to send (SendToSession handles missing clients)
+	app.send(sessionID, event, seq)
+}
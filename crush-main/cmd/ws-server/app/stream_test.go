@@ -0,0 +1,183 @@
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+// sentDeltas records the deltas sent by a deltaStreams.
+type sentDeltas struct {
+	mu     sync.Mutex
+	deltas []message.StreamDelta
+}
+
+func (s *sentDeltas) send(d message.StreamDelta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deltas = append(s.deltas, d)
+}
+
+// take returns the deltas sent since the last call.
+func (s *sentDeltas) take() []message.StreamDelta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deltas := s.deltas
+	s.deltas = nil
+	return deltas
+}
+
+func newTestDeltaStreams(coalesceMs, window int) (*deltaStreams, *sentDeltas) {
+	sent := &sentDeltas{}
+	return newDeltaStreams(&config.AppConfig{Server: config.ServerConfig{
+		DeltaCoalesceInterval: coalesceMs,
+		DeltaAckWindow:        window,
+	}}, sent.send), sent
+}
+
+func textDelta(part int, content string) message.StreamDelta {
+	d := message.NewTextDelta("m1", "s1", content)
+	d.PartIndex = part
+	return d
+}
+
+func TestDeltaStreamsCoalesce(t *testing.T) {
+	t.Parallel()
+
+	// The timer never fires, the other deltas flush the text
+	ds, sent := newTestDeltaStreams(int(time.Hour/time.Millisecond), 0)
+	ds.add(textDelta(0, "Hel"))
+	ds.add(textDelta(0, "lo"))
+	require.Empty(t, sent.take())
+
+	ds.add(textDelta(1, " world"))
+	deltas := sent.take()
+	require.Len(t, deltas, 1, "a delta of another part flushes the text")
+	require.Equal(t, "Hello", deltas[0].Content)
+	require.EqualValues(t, 1, deltas[0].Seq)
+
+	ds.add(message.NewToolCallDelta("m1", "s1", "t1", "view"))
+	deltas = sent.take()
+	require.Len(t, deltas, 2)
+	require.Equal(t, " world", deltas[0].Content)
+	require.EqualValues(t, 2, deltas[0].Seq)
+	require.Equal(t, message.DeltaTypeToolCall, deltas[1].DeltaType, "tool calls are sent right away")
+	require.EqualValues(t, 3, deltas[1].Seq)
+
+	ds.add(textDelta(2, "done"))
+	ds.add(message.NewFinishDelta("m1", "s1", "end_turn"))
+	deltas = sent.take()
+	require.Len(t, deltas, 2)
+	require.Equal(t, "done", deltas[0].Content)
+	require.Equal(t, message.DeltaTypeFinish, deltas[1].DeltaType)
+	require.EqualValues(t, 5, deltas[1].Seq)
+	require.Empty(t, ds.streams, "a finished message is forgotten")
+
+	ds.add(message.NewErrorDelta("s1", "boom", apierr.Error{Code: apierr.CodeUnavailable}))
+	deltas = sent.take()
+	require.Len(t, deltas, 1)
+	require.Zero(t, deltas[0].Seq, "errors are not numbered")
+}
+
+func TestDeltaStreamsCoalesceInterval(t *testing.T) {
+	t.Parallel()
+
+	ds, sent := newTestDeltaStreams(10, 0)
+	ds.add(textDelta(0, "a"))
+	ds.add(textDelta(0, "b"))
+	var deltas []message.StreamDelta
+	require.Eventually(t, func() bool {
+		deltas = append(deltas, sent.take()...)
+		return len(deltas) > 0
+	}, time.Second, time.Millisecond)
+	require.Len(t, deltas, 1)
+	require.Equal(t, "ab", deltas[0].Content)
+	require.EqualValues(t, 1, deltas[0].Seq)
+}
+
+func TestDeltaStreamsWithoutCoalescing(t *testing.T) {
+	t.Parallel()
+
+	ds, sent := newTestDeltaStreams(-1, 0)
+	ds.add(textDelta(0, "a"))
+	ds.add(textDelta(0, "b"))
+	deltas := sent.take()
+	require.Len(t, deltas, 2)
+	require.EqualValues(t, 1, deltas[0].Seq)
+	require.EqualValues(t, 2, deltas[1].Seq)
+}
+
+func TestDeltaStreamsAck(t *testing.T) {
+	t.Parallel()
+
+	ds, sent := newTestDeltaStreams(-1, 2)
+	ds.add(textDelta(0, "a"))
+	require.Len(t, sent.take(), 1)
+
+	// Acks of other sessions, unknown messages and unsent deltas are ignored
+	ds.ack("s2", "m1", 1)
+	ds.ack("s1", "m2", 1)
+	ds.ack("s1", "m1", 2)
+	require.Zero(t, ds.streams["m1"].acked)
+
+	ds.ack("s1", "m1", 1)
+	ds.add(message.NewToolCallDelta("m1", "s1", "t1", "view"))
+	ds.add(message.NewToolCallDelta("m1", "s1", "t2", "ls"))
+	require.Len(t, sent.take(), 2)
+
+	// Two deltas ahead of the ack, the text is held until the client catches up
+	ds.add(textDelta(3, "b"))
+	ds.add(textDelta(3, "c"))
+	require.Empty(t, sent.take())
+
+	ds.ack("s1", "m1", 1)
+	require.Empty(t, sent.take(), "stale acks are ignored")
+
+	ds.ack("s1", "m1", 2)
+	deltas := sent.take()
+	require.Len(t, deltas, 1)
+	require.Equal(t, "bc", deltas[0].Content)
+	require.EqualValues(t, 4, deltas[0].Seq)
+}
+
+func TestDeltaStreamsBehindClientStillReceives(t *testing.T) {
+	t.Parallel()
+
+	ds, sent := newTestDeltaStreams(-1, 1)
+	ds.add(textDelta(0, "a"))
+	ds.ack("s1", "m1", 1)
+	ds.add(message.NewToolCallDelta("m1", "s1", "t1", "view"))
+	require.Len(t, sent.take(), 2)
+
+	// The client stopped acking, the held text is sent after behindDeltaInterval
+	ds.add(textDelta(2, "b"))
+	require.Empty(t, sent.take())
+	var deltas []message.StreamDelta
+	require.Eventually(t, func() bool {
+		deltas = append(deltas, sent.take()...)
+		return len(deltas) > 0
+	}, 3*behindDeltaInterval, 10*time.Millisecond)
+	require.Equal(t, "b", deltas[0].Content)
+	require.EqualValues(t, 3, deltas[0].Seq)
+}
+
+func TestDeltaStreamsCloseSession(t *testing.T) {
+	t.Parallel()
+
+	ds, sent := newTestDeltaStreams(int(time.Hour/time.Millisecond), 0)
+	ds.add(textDelta(0, "partial"))
+	other := message.NewTextDelta("m2", "s2", "other")
+	ds.add(other)
+
+	ds.closeSession("s1")
+	deltas := sent.take()
+	require.Len(t, deltas, 1)
+	require.Equal(t, "partial", deltas[0].Content)
+	require.NotContains(t, ds.streams, "m1")
+	require.Contains(t, ds.streams, "m2")
+}
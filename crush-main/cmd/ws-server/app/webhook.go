@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/project"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/infra/scm"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+)
+
+// webhookRunClaimTTL keeps the claim of a webhook or blueprint run long enough
+// for every WS instance to have seen the broadcast.
+const webhookRunClaimTTL = time.Hour
+
+// subscribeWebhookRuns listens for runs triggered by SCM webhooks through the HTTP API.
+func (app *WSApp) subscribeWebhookRuns(ctx context.Context) {
+	if app.RedisCmd == nil {
+		return
+	}
+	cmds, cancel := app.RedisCmd.SubscribeGlobalCommands(ctx)
+	app.cleanupFuncs = append(app.cleanupFuncs, func() error {
+		cancel()
+		return nil
+	})
+
+	go func() {
+		slog.Info("[GOROUTINE] Webhook run subscriber started")
+		defer slog.Info("[GOROUTINE] Webhook run subscriber stopped")
+		for cmd := range cmds {
+			if cmd.Type != storeredis.CmdWebhookRun {
+				continue
+			}
+			var run storeredis.WebhookRunPayload
+			if err := json.Unmarshal(cmd.Payload, &run); err != nil {
+				slog.Warn("Failed to unmarshal webhook run payload", "error", err)
+				continue
+			}
+			app.runWebhookPrompt(ctx, run)
+		}
+	}()
+}
+
+// runWebhookPrompt runs the prompt of a webhook delivery in its session and,
+// when the delivery was a pull request, posts the final answer back as a comment.
+func (app *WSApp) runWebhookPrompt(ctx context.Context, run storeredis.WebhookRunPayload) {
+	// Every WS instance receives the broadcast, only one of them runs it
+	claimed, err := app.RedisCmd.ClaimCommand(ctx, string(storeredis.CmdWebhookRun)+":"+run.SessionID, webhookRunClaimTTL)
+	if err != nil {
+		slog.Warn("Failed to claim webhook run", "session_id", run.SessionID, "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	slog.Info("Running webhook prompt",
+		"project_id", run.ProjectID,
+		"session_id", run.SessionID,
+		"provider", run.Provider,
+		"event", run.EventKind,
+	)
+
+	if !app.ensureAgentInitialized() {
+		return
+	}
+	prompt := queuedPrompt{sessionID: run.SessionID, content: run.Prompt}
+	if app.holdIfProjectPaused(prompt) {
+		return
+	}
+
+	if app.AgentWorkerPool == nil {
+		slog.Warn("[GOROUTINE] Worker pool not available, webhook run will not be commented back", "session_id", run.SessionID)
+		app.runAgentAsync(prompt)
+		return
+	}
+
+	task := agent.AgentTask{
+		SessionID:  run.SessionID,
+		Prompt:     run.Prompt,
+		Priority:   agent.PriorityBackground,
+		ResultChan: make(chan agent.AgentTaskResult, 1),
+	}
+	if err := app.AgentWorkerPool.Submit(ctx, task); err != nil {
+		slog.Error("[GOROUTINE] Failed to submit webhook run", "session_id", run.SessionID, "error", err)
+		return
+	}
+	if run.CommentURL == "" {
+		return
+	}
+
+	go func() {
+		result := <-task.ResultChan
+		if result.Error != nil {
+			slog.Warn("Webhook run failed, no comment posted", "session_id", run.SessionID, "error", result.Error)
+			return
+		}
+		if err := app.postWebhookComment(context.Background(), run); err != nil {
+			slog.Error("Failed to post webhook run comment", "session_id", run.SessionID, "error", err)
+		}
+	}()
+}
+
+// postWebhookComment posts the last assistant answer of a webhook run to its pull request.
+func (app *WSApp) postWebhookComment(ctx context.Context, run storeredis.WebhookRunPayload) error {
+	webhook, err := app.Projects.GetWebhook(ctx, run.ProjectID)
+	if errors.Is(err, project.ErrWebhookNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !webhook.PostComment || webhook.SCMToken == "" {
+		return nil
+	}
+
+	answer, err := app.lastAssistantText(ctx, run.SessionID)
+	if err != nil || answer == "" {
+		return err
+	}
+
+	if err := scm.NewClient().PostComment(ctx, scm.Provider(run.Provider), run.CommentURL, webhook.SCMToken, answer); err != nil {
+		return err
+	}
+	slog.Info("Posted webhook run comment", "session_id", run.SessionID, "provider", run.Provider)
+	return nil
+}
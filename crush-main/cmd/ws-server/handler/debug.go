@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/log"
+)
+
+// debugLogsDefaultLimit is how many records are returned without a limit.
+const debugLogsDefaultLimit = 200
+
+// handleDebugLogs returns the recent logs of the WebSocket service, filtered
+// by the limit, level, module, session_id and request_id query parameters.
+// It needs a token of an operator of the instance.
+func handleDebugLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	filter, err := log.ParseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = debugLogsDefaultLimit
+	}
+	entries := log.Recent(filter)
+	if entries == nil {
+		entries = []log.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"entries": entries}); err != nil {
+		slog.Warn("Failed to write debug logs", "error", err)
+	}
+}
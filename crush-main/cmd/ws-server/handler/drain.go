@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/rolling1314/rolling-crush/auth"
+)
+
+// drainRetryAfter is the Retry-After in seconds of the connections rejected
+// while draining, clients reconnect to another instance by then.
+const drainRetryAfter = 5
+
+// DrainFunc defines the callback starting to drain the instance
+type DrainFunc func()
+
+// SetDrainHandler sets the callback started by POST /admin/drain
+func (s *Server) SetDrainHandler(drain DrainFunc) {
+	s.drain = drain
+}
+
+// SetDraining makes the server reject new WebSocket connections, the open
+// ones are kept until the process exits.
+func (s *Server) SetDraining() {
+	s.draining.Store(true)
+}
+
+// IsDraining reports whether new WebSocket connections are rejected.
+func (s *Server) IsDraining() bool {
+	return s.draining.Load()
+}
+
+// handleDrain starts draining the instance on POST and reports whether it is
+// draining on GET. It needs a token of an operator of the instance.
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		if s.drain == nil {
+			http.Error(w, "Draining is not available", http.StatusNotImplemented)
+			return
+		}
+		slog.Info("Drain requested", "remote_addr", r.RemoteAddr)
+		s.drain()
+		status = http.StatusAccepted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]any{"draining": s.IsDraining()}); err != nil {
+		slog.Warn("Failed to write drain status", "error", err)
+	}
+}
+
+// rejectDraining answers a connection attempt while draining.
+func rejectDraining(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(drainRetryAfter))
+	http.Error(w, "Service Unavailable: server is draining", http.StatusServiceUnavailable)
+}
+
+// authorizeAdmin checks that the request has a token with the admin:project
+// scope of an operator listed in auth.admins, and writes the error response
+// when it has not. Any logged in user has the scope, draining and reading the
+// logs of the instance are only for its operators.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := extractToken(r)
+	if token == "" {
+		http.Error(w, "Unauthorized: token required", http.StatusUnauthorized)
+		return false
+	}
+	claims, err := auth.Authenticate(r.Context(), token)
+	if err != nil {
+		http.Error(w, "Unauthorized: invalid or expired token", http.StatusUnauthorized)
+		return false
+	}
+	if !claims.HasScope(auth.ScopeAdminProject) {
+		http.Error(w, "Forbidden: token requires "+auth.ScopeAdminProject+" scope", http.StatusForbidden)
+		return false
+	}
+	if !auth.IsOperator(claims) {
+		http.Error(w, "Forbidden: operator of the instance required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultPingInterval is how often the connections are pinged by default.
+	DefaultPingInterval = 25 * time.Second
+	// DefaultPongTimeout is how long a connection may stay silent by default
+	// before it is reaped, more than two missed pings.
+	DefaultPongTimeout = 60 * time.Second
+	// writeWait bounds how long a write to a connection may block, so that a
+	// half-open socket with a full send buffer cannot hold up the others.
+	writeWait = 10 * time.Second
+)
+
+// SetHeartbeat sets how often the connections are pinged and how long one may
+// go without a pong or message before it is closed as stale. A zero interval
+// disables the pings and the reaping.
+func (s *Server) SetHeartbeat(interval, timeout time.Duration) {
+	s.pingInterval = interval
+	s.pongTimeout = timeout
+}
+
+// heartbeat pings a connection until done is closed, and closes it when it
+// stopped answering. Closing the connection ends its read loop, which then
+// unregisters it and reports the session disconnected.
+func (s *Server) heartbeat(ws *websocket.Conn, done <-chan struct{}) {
+	if s.pingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		c, ok := s.client(ws)
+		if !ok {
+			return
+		}
+		if idle := time.Since(c.lastSeen); s.pongTimeout > 0 && idle > s.pongTimeout {
+			slog.Warn("Reaping stale WebSocket connection", "session_id", c.sessionID, "idle", idle.Round(time.Second))
+			ws.Close()
+			return
+		}
+		// Pings are control frames, which may be written concurrently with the messages
+		if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+			slog.Warn("WebSocket ping failed, closing connection", "session_id", c.sessionID, "error", err)
+			ws.Close()
+			return
+		}
+	}
+}
+
+// touch records that a connection is alive.
+func (s *Server) touch(ws *websocket.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if c, exists := s.clients[ws]; exists {
+		c.lastSeen = time.Now()
+	}
+}
+
+// client returns a copy of the state of a connection.
+func (s *Server) client(ws *websocket.Conn) (client, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c, exists := s.clients[ws]
+	if !exists {
+		return client{}, false
+	}
+	return *c, true
+}
+
+// HasSessionClients reports whether clients of a session are connected to
+// this instance.
+func (s *Server) HasSessionClients(sessionID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range s.clients {
+		if c.sessionID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMessage writes a message to a connection within writeWait.
+func writeMessage(ws *websocket.Conn, data []byte) error {
+	if err := ws.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return ws.WriteMessage(websocket.TextMessage, data)
+}
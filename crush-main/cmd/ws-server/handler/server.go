@@ -2,14 +2,19 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rolling1314/rolling-crush/auth"
+	"github.com/rolling1314/rolling-crush/cmd/ws-server/protocol"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -17,27 +22,77 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow all origins for development
 	},
+	// Clients may ask for a protocol version as a subprotocol, e.g. crush.v2
+	Subprotocols: protocol.Subprotocols(),
 }
 
 // HandlerFunc defines the callback for processing incoming messages
 // The second parameter is a function to update the client's session ID
 type HandlerFunc func(message []byte, updateSessionID func(sessionID string))
 
-// DisconnectFunc defines the callback for WebSocket disconnection
-type DisconnectFunc func()
+// DisconnectFunc defines the callback for WebSocket disconnection.
+// sessionID is the session of the closed connection, "" if it had none.
+type DisconnectFunc func(sessionID string)
+
+// PresenceUser identifies the collaborator behind a connection
+type PresenceUser struct {
+	UserID   string
+	Username string
+	// ConnID identifies the connection, unique across the WS instances
+	ConnID string
+}
+
+// PresenceFunc defines the callback for editor presence updates and typing
+// signals.
+type PresenceFunc func(sessionID string, user PresenceUser, message []byte)
+
+// AttachFunc defines the callback for a connection that started following a
+// session, or stopped. A user may follow a session from several connections,
+// on several instances.
+type AttachFunc func(sessionID string, user PresenceUser, attached bool)
+
+// RelayFunc defines the callback passing the messages sent to a session on to
+// the other WS instances, whose clients may follow the same session.
+type RelayFunc func(sessionID string, message []byte)
+
+// RateLimitFunc defines the callback checking a client message against the
+// rate limits of its user and session. sessionID is the session of the
+// connection. It returns false and how long to wait before retrying when the
+// message is over a limit.
+type RateLimitFunc func(user PresenceUser, sessionID string, message []byte) (bool, time.Duration)
+
+// client is a WebSocket connection
+type client struct {
+	sessionID string
+	user      PresenceUser
+	// version is the protocol version negotiated at connect
+	version int
+	// lastSeen is when the client last answered a ping or sent a message
+	lastSeen time.Time
+}
 
 type Server struct {
-	clients           map[*websocket.Conn]string // conn -> sessionID
+	clients           map[*websocket.Conn]*client
 	broadcast         chan []byte
 	mutex             sync.Mutex
 	handler           HandlerFunc
 	disconnectHandler DisconnectFunc
+	presenceHandler   PresenceFunc
+	attachHandler     AttachFunc
+	relay             RelayFunc
+	rateLimit         RateLimitFunc
+	drain             DrainFunc
+	draining          atomic.Bool
+	pingInterval      time.Duration
+	pongTimeout       time.Duration
 }
 
 func New() *Server {
 	return &Server{
-		clients:   make(map[*websocket.Conn]string),
-		broadcast: make(chan []byte),
+		clients:      make(map[*websocket.Conn]*client),
+		broadcast:    make(chan []byte),
+		pingInterval: DefaultPingInterval,
+		pongTimeout:  DefaultPongTimeout,
 	}
 }
 
@@ -51,7 +106,34 @@ func (s *Server) SetDisconnectHandler(handler DisconnectFunc) {
 	s.disconnectHandler = handler
 }
 
+// SetPresenceHandler sets the callback for editor presence updates
+func (s *Server) SetPresenceHandler(handler PresenceFunc) {
+	s.presenceHandler = handler
+}
+
+// SetAttachHandler sets the callback for users joining or leaving a session
+func (s *Server) SetAttachHandler(handler AttachFunc) {
+	s.attachHandler = handler
+}
+
+// SetRateLimiter sets the callback rejecting the messages over the rate limits
+func (s *Server) SetRateLimiter(rateLimit RateLimitFunc) {
+	s.rateLimit = rateLimit
+}
+
+// SetRelay sets the callback relaying session messages to the other WS instances
+func (s *Server) SetRelay(relay RelayFunc) {
+	s.relay = relay
+}
+
 func (s *Server) HandleConnections(w http.ResponseWriter, r *http.Request) {
+	// A draining instance only keeps the connections it has
+	if s.IsDraining() {
+		slog.Info("WebSocket connection rejected: server is draining")
+		rejectDraining(w)
+		return
+	}
+
 	// Validate JWT token before upgrading connection
 	token := extractToken(r)
 	if token == "" {
@@ -60,12 +142,19 @@ func (s *Server) HandleConnections(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims, err := auth.ValidateToken(token)
+	claims, err := auth.Authenticate(r.Context(), token)
 	if err != nil {
 		slog.Warn("WebSocket connection rejected: invalid token", "error", err)
 		http.Error(w, "Unauthorized: invalid or expired token", http.StatusUnauthorized)
 		return
 	}
+	if !claims.HasScope(auth.ScopeReadSessions) && !claims.HasScope(auth.ScopeWritePrompts) {
+		slog.Warn("WebSocket connection rejected: insufficient scope", "user_id", claims.UserID, "token_id", claims.TokenID)
+		http.Error(w, "Forbidden: token requires read:sessions or write:prompts scope", http.StatusForbidden)
+		return
+	}
+	// Tokens without write:prompts may only follow sessions, not drive them
+	canWrite := claims.HasScope(auth.ScopeWritePrompts)
 
 	slog.Info("WebSocket authentication successful", "user_id", claims.UserID, "username", claims.Username)
 
@@ -79,64 +168,122 @@ func (s *Server) HandleConnections(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Clients that ask for no version speak the legacy protocol
+	version := protocol.Negotiate(ws.Subprotocol(), r.URL.Query().Get("v"))
 	s.mutex.Lock()
-	s.clients[ws] = sessionID
+	presenceUser := PresenceUser{UserID: claims.UserID, Username: claims.Username, ConnID: uuid.NewString()}
+	s.clients[ws] = &client{sessionID: sessionID, user: presenceUser, version: version, lastSeen: time.Now()}
 	s.mutex.Unlock()
-	slog.Info("New WebSocket connection established", "username", claims.Username, "session_id", sessionID)
+	slog.Info("New WebSocket connection established", "username", claims.Username, "session_id", sessionID, "protocol_version", version)
+	if version >= protocol.Version2 {
+		s.writeToConn(ws, sessionID, protocol.Hello{Version: version, Versions: protocol.Versions(), SessionID: sessionID})
+	}
+	s.notifyAttach(ws, presenceUser, "", sessionID)
+
+	// Ping the connection and reap it once it stops answering
+	done := make(chan struct{})
+	ws.SetPongHandler(func(string) error {
+		s.touch(ws)
+		return nil
+	})
+	go s.heartbeat(ws, done)
 
 	// Keep connection alive and handle disconnects
 	go func() {
 		defer func() {
+			close(done)
 			s.mutex.Lock()
+			closedSessionID := ""
+			if c, exists := s.clients[ws]; exists {
+				closedSessionID = c.sessionID
+			}
 			delete(s.clients, ws)
 			s.mutex.Unlock()
 			ws.Close()
-			slog.Info("WebSocket connection closed")
+			slog.Info("WebSocket connection closed", "session_id", closedSessionID)
+
+			// Collaborators see the user leave right away instead of after the presence TTL
+			s.notifyAttach(ws, presenceUser, closedSessionID, "")
 			
 			// Call disconnect handler to clean up agent state
 			if s.disconnectHandler != nil {
 				slog.Info("Calling disconnect handler to clean up agent state")
-				s.disconnectHandler()
+				s.disconnectHandler(closedSessionID)
 			}
 		}()
 
 		for {
 			_, msg, err := ws.ReadMessage()
-			fmt.Println("=== WebSocket message received ===")
-			fmt.Println("Message bytes:", msg)
-			fmt.Println("Message string:", string(msg))
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					slog.Error("WebSocket read error", "error", err)
 				}
 				break
 			}
+			s.touch(ws)
+
+			msgType := messageType(msg)
+			slog.Debug("WebSocket message received", "type", msgType, "size", len(msg), "user_id", claims.UserID)
+			if !canWrite && !isReadOnlyMessage(msgType) {
+				slog.Warn("WebSocket message rejected: token lacks write:prompts scope", "user_id", claims.UserID, "token_id", claims.TokenID)
+				s.writeToConn(ws, s.sessionOf(ws), protocol.NewError("",
+					"Token is missing the required scope: "+auth.ScopeWritePrompts, apierr.New(apierr.CodeForbidden, "")))
+				continue
+			}
+
+			// Presence updates and typing signals are handled apart from the agent message flow
+			if (msgType == protocol.TypePresence || msgType == protocol.TypeUserTyping) && s.presenceHandler != nil {
+				if sessionID := s.sessionOf(ws); sessionID != "" {
+					s.presenceHandler(sessionID, presenceUser, msg)
+				}
+				continue
+			}
+
+			// Messages over the rate limits are rejected rather than queued
+			if s.rateLimit != nil {
+				sessionID := s.sessionOf(ws)
+				if ok, retryAfter := s.rateLimit(presenceUser, sessionID, msg); !ok {
+					slog.Warn("WebSocket message rejected: rate limited", "type", msgType, "user_id", claims.UserID, "retry_after", retryAfter)
+					s.writeToConn(ws, sessionID, protocol.RateLimited{
+						SessionID:  sessionID,
+						Message:    msgType,
+						RetryAfter: max(1, int(math.Ceil(retryAfter.Seconds()))),
+						Error:      "Too many requests, retry later",
+					})
+					continue
+				}
+			}
 
 			// Handle incoming message via callback
-			fmt.Println("Handler exists:", s.handler != nil)
 			if s.handler != nil {
-				fmt.Println("Calling handler with message")
 				// Create a closure to update this client's session ID
 				updateSessionID := func(sessionID string) {
 					s.mutex.Lock()
-					defer s.mutex.Unlock()
-					if _, exists := s.clients[ws]; exists {
-						oldSessionID := s.clients[ws]
-						s.clients[ws] = sessionID
+					oldSessionID := ""
+					if c, exists := s.clients[ws]; exists {
+						oldSessionID = c.sessionID
+						c.sessionID = sessionID
 						slog.Info("Updated client session ID", "old_session_id", oldSessionID, "new_session_id", sessionID)
 					}
+					s.mutex.Unlock()
+					s.notifyAttach(ws, presenceUser, oldSessionID, sessionID)
 				}
 				s.handler(msg, updateSessionID)
-				fmt.Println("Handler returned")
 			} else {
-				fmt.Println("WARNING: No handler set!")
+				slog.Warn("WebSocket message dropped: no handler set", "type", msgType)
 			}
 		}
 	}()
 }
 
-func (s *Server) Broadcast(msg interface{}) {
-	jsonMsg, err := json.Marshal(msg)
+// Broadcast sends an event to every client of this instance
+func (s *Server) Broadcast(event protocol.Event) {
+	env, err := protocol.NewEnvelope("", event, 0)
+	if err != nil {
+		slog.Error("JSON marshal error", "error", err)
+		return
+	}
+	jsonMsg, err := json.Marshal(env)
 	if err != nil {
 		slog.Error("JSON marshal error", "error", err)
 		return
@@ -145,67 +292,192 @@ func (s *Server) Broadcast(msg interface{}) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	for client := range s.clients {
-		err := client.WriteMessage(websocket.TextMessage, jsonMsg)
+	encoded := encodings{message: jsonMsg}
+	for conn, c := range s.clients {
+		data, ok := encoded.get(c.version)
+		if !ok {
+			continue
+		}
+		err := writeMessage(conn, data)
 		if err != nil {
 			slog.Error("WebSocket write error", "error", err)
-			client.Close()
-			delete(s.clients, client)
+			conn.Close()
+			delete(s.clients, conn)
 		}
 	}
 }
 
 // SendToSession sends a message only to clients connected to a specific session
-func (s *Server) SendToSession(sessionID string, msg interface{}) {
-	jsonMsg, err := json.Marshal(msg)
+func (s *Server) SendToSession(sessionID string, env protocol.Envelope) {
+	jsonMsg, err := json.Marshal(env)
 	if err != nil {
 		slog.Error("JSON marshal error", "error", err)
 		return
 	}
 
+	s.DeliverToSession(sessionID, jsonMsg)
+	if s.relay != nil {
+		s.relay(sessionID, jsonMsg)
+	}
+}
+
+// DeliverToSession writes an encoded message to the clients of a session
+// connected to this instance, in the protocol version of each, and returns
+// how many received it
+func (s *Server) DeliverToSession(sessionID string, jsonMsg []byte) int {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	sentCount := 0
 	totalClients := len(s.clients)
-	
-	// Debug: print all client session IDs for comparison
-	if totalClients > 0 {
-		clientSessions := make([]string, 0, totalClients)
-		for _, clientSID := range s.clients {
-			clientSessions = append(clientSessions, clientSID)
-		}
-		fmt.Printf("[WS DEBUG] Looking for session_id=%s, available sessions=%v\n", sessionID, clientSessions)
-	}
-	
-	for client, clientSessionID := range s.clients {
-		if clientSessionID == sessionID {
-			err := client.WriteMessage(websocket.TextMessage, jsonMsg)
+
+	encoded := encodings{message: jsonMsg}
+	for conn, c := range s.clients {
+		if c.sessionID == sessionID {
+			data, ok := encoded.get(c.version)
+			if !ok {
+				continue
+			}
+			err := writeMessage(conn, data)
 			if err != nil {
 				slog.Error("WebSocket write error", "error", err)
-				client.Close()
-				delete(s.clients, client)
+				conn.Close()
+				delete(s.clients, conn)
 			} else {
 				sentCount++
 			}
 		}
 	}
-	// 使用 Info 级别以便调试
-	fmt.Printf("[WS SEND] session_id=%s, sent_to=%d/%d clients\n", sessionID, sentCount, totalClients)
+	slog.Debug("Sent message to session", "session_id", sessionID, "sent_to", sentCount, "total_clients", totalClients)
 	
-	// Warn if no clients received the message
-	if sentCount == 0 && totalClients > 0 {
+	// Warn if no clients received the message, unless they may be connected to another instance
+	if sentCount == 0 && totalClients > 0 && s.relay == nil {
 		slog.Warn("Message not delivered - no matching session found", "target_session", sessionID, "total_clients", totalClients)
 	}
+	return sentCount
+}
+
+// encodings translates a message once per protocol version of the clients
+// it is written to.
+type encodings struct {
+	message  []byte
+	versions map[int][]byte
+}
+
+// get returns the message in a protocol version, false when it cannot be
+// translated.
+func (e *encodings) get(version int) ([]byte, bool) {
+	if data, ok := e.versions[version]; ok {
+		return data, data != nil
+	}
+	data, err := protocol.Encode(e.message, version)
+	if err != nil {
+		slog.Error("Failed to encode WebSocket message", "protocol_version", version, "error", err)
+	}
+	if e.versions == nil {
+		e.versions = make(map[int][]byte)
+	}
+	e.versions[version] = data
+	return data, data != nil
 }
 
 // UpdateClientSession updates the session ID for a specific client connection
 func (s *Server) UpdateClientSession(ws *websocket.Conn, sessionID string) {
+	s.mutex.Lock()
+	c, exists := s.clients[ws]
+	if !exists {
+		s.mutex.Unlock()
+		return
+	}
+	oldSessionID := c.sessionID
+	c.sessionID = sessionID
+	s.mutex.Unlock()
+	slog.Info("Updated client session", "session_id", sessionID)
+	s.notifyAttach(ws, c.user, oldSessionID, sessionID)
+}
+
+// notifyAttach reports a connection that moved from one session to another,
+// "" being none.
+func (s *Server) notifyAttach(ws *websocket.Conn, user PresenceUser, from, to string) {
+	if s.attachHandler == nil || from == to || user.UserID == "" {
+		return
+	}
+	if from != "" {
+		s.attachHandler(from, user, false)
+	}
+	if to != "" {
+		s.attachHandler(to, user, true)
+	}
+}
+
+// UserConnections returns how many connections of a user follow a session on
+// this instance.
+func (s *Server) UserConnections(sessionID, userID string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	count := 0
+	for _, c := range s.clients {
+		if c.user.UserID == userID && c.sessionID == sessionID {
+			count++
+		}
+	}
+	return count
+}
+
+// sessionOf returns the session of a connection.
+func (s *Server) sessionOf(ws *websocket.Conn) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if c, exists := s.clients[ws]; exists {
+		return c.sessionID
+	}
+	return ""
+}
+
+// messageType returns the type of a client message of any protocol version,
+// or "" if it cannot be decoded.
+func messageType(msg []byte) string {
+	var m struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return ""
+	}
+	return m.Type
+}
+
+// isReadOnlyMessage reports whether a client message type only subscribes to
+// session output, asks for missed output or the queued prompts, or shares
+// presence and can be sent without the write:prompts scope.
+func isReadOnlyMessage(msgType string) bool {
+	return msgType == protocol.TypeReconnect || msgType == protocol.TypePresence || msgType == protocol.TypeBackfill || msgType == protocol.TypeQueueList
+}
+
+// writeToConn sends an event to a single connection, in its protocol version
+func (s *Server) writeToConn(ws *websocket.Conn, sessionID string, event protocol.Event) {
+	env, err := protocol.NewEnvelope(sessionID, event, 0)
+	if err != nil {
+		slog.Error("JSON marshal error", "error", err)
+		return
+	}
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	if _, exists := s.clients[ws]; exists {
-		s.clients[ws] = sessionID
-		slog.Info("Updated client session", "session_id", sessionID)
+	c, exists := s.clients[ws]
+	if !exists {
+		return
+	}
+	var jsonMsg []byte
+	if c.version >= protocol.Version2 {
+		jsonMsg, err = json.Marshal(env)
+	} else {
+		jsonMsg, err = protocol.Legacy(env)
+	}
+	if err != nil {
+		slog.Error("JSON marshal error", "error", err)
+		return
+	}
+	if err := writeMessage(ws, jsonMsg); err != nil {
+		slog.Error("WebSocket write error", "error", err)
 	}
 }
 
@@ -241,6 +513,8 @@ func (s *Server) Start(port string) {
 
 	wsMux := http.NewServeMux()
 	wsMux.HandleFunc("/ws", s.HandleConnections)
+	wsMux.HandleFunc("/debug/logs", handleDebugLogs)
+	wsMux.HandleFunc("/admin/drain", s.handleDrain)
 
 	if err := http.ListenAndServe(":"+port, wsMux); err != nil {
 		slog.Error("WebSocket server error", "error", err)
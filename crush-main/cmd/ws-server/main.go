@@ -13,6 +13,7 @@ import (
 	wsapp "github.com/rolling1314/rolling-crush/cmd/ws-server/app"
 	"github.com/rolling1314/rolling-crush/internal/event"
 	"github.com/rolling1314/rolling-crush/internal/shared"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
 )
 
 func main() {
@@ -26,7 +27,6 @@ func main() {
 		}()
 	}
 
-	fmt.Println()
 	slog.Info("Starting Crush WebSocket + Agent Server")
 
 	ctx := context.Background()
@@ -37,17 +37,19 @@ func main() {
 		DataDir:    os.Getenv("CRUSH_DATA_DIR"), // Optional: override data directory
 		Debug:      false,
 		Yolo:       os.Getenv("CRUSH_YOLO") == "true", // Skip permission requests
+		Service:    "crush-ws",
 	})
 	if err != nil {
 		slog.Error("Failed to initialize", "error", err)
 		os.Exit(1)
 	}
+	defer tracing.Shutdown(context.Background())
 
 	// Get server configuration from config.yaml
 	serverCfg := shared.GetServerConfig()
 
 	// Create WebSocket application
-	wsApp, err := wsapp.NewWSApp(ctx, initResult.DB, initResult.Config)
+	wsApp, err := wsapp.NewWSApp(ctx, initResult.DB, initResult.Config, initResult.Secrets)
 	if err != nil {
 		slog.Error("Failed to create WebSocket app", "error", err)
 		os.Exit(1)
@@ -73,10 +75,22 @@ func main() {
 	slog.Info("Crush WebSocket + Agent Server is running")
 	slog.Info("Press Ctrl+C to stop.")
 
+	// SIGUSR1 drains the server before a rolling restart, it exits once drained
+	drain := make(chan os.Signal, 1)
+	signal.Notify(drain, syscall.SIGUSR1)
+	go func() {
+		for range drain {
+			wsApp.StartDrain()
+		}
+	}()
+
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case <-wsApp.Drained():
+	}
 
 	slog.Info("Shutting down WebSocket server...")
 	event.AppExited()
@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Types of the messages sent by the clients, besides TypePresence sharing the
+// editor presence of the user and TypeUserTyping telling whether they type a
+// prompt. Messages of any other type are prompts.
+const (
+	TypeReconnect          = "reconnect"
+	TypeBackfill           = "backfill"
+	TypePermissionResponse = "permission_response"
+	TypeCancel             = "cancel"
+	TypeQueueList          = "queue_list"
+	TypeQueueRemove        = "queue_remove"
+	TypeQueueReorder       = "queue_reorder"
+	TypeStreamAck          = "stream_ack"
+	TypeSetModel           = "set_model"
+	TypeRegenerate         = "regenerate"
+	TypeRetry              = "retry"
+	TypeSetEnv             = "set_env"
+)
+
+// ImageAttachment represents an image attached to a message
+type ImageAttachment struct {
+	Type     string `json:"type,omitempty"` // "reference" for an image already in the session, uploaded otherwise
+	URL      string `json:"url"`            // Image URL, or the crush:// URL of a completed upload
+	MimeType string `json:"mime_type"`
+	Filename string `json:"filename"`
+	// MessageID and PartIndex point to the image of a reference attachment
+	MessageID string `json:"message_id,omitempty"`
+	PartIndex int    `json:"part_index,omitempty"`
+}
+
+// ClientMessage is a message sent by a client. Legacy clients send it as a
+// flat object, later versions as the payload of an envelope whose type and
+// session fill Type and SessionID.
+type ClientMessage struct {
+	Type            string            `json:"type"`
+	Content         string            `json:"content"`
+	SessionID       string            `json:"sessionID"`  // Optional: if frontend sends it (camelCase)
+	SessionIDSnake  string            `json:"session_id"` // Optional: for permission_response (snake_case)
+	ID              string            `json:"id"`
+	ToolCallID      string            `json:"tool_call_id"`
+	Granted         bool              `json:"granted"`
+	Denied          bool              `json:"denied"`
+	AllowForSession bool              `json:"allow_for_session"` // Allow this tool for the entire session
+	ToolName        string            `json:"tool_name"`         // Tool name for allowlist
+	Action          string            `json:"action"`            // Action for allowlist
+	Path            string            `json:"path"`              // Path for allowlist
+	Reason          string            `json:"reason"`            // Optional note for the permission decision
+	ApprovedHunks   []int             `json:"approved_hunks"`    // Diff hunks accepted for a partial edit approval
+	Images          []ImageAttachment `json:"images"`            // Image attachments
+	Agent           string            `json:"agent"`             // Named agent to run the prompt, the coder when empty
+	LastMsgID       string            `json:"lastMsgId"`         // For reconnection - last received Redis stream message ID
+	Mode            string            `json:"mode"`              // Cancel mode: "soft" (default) or "hard"
+	FromSeq         int64             `json:"from_seq"`          // For backfill - first missing event sequence number
+	ToSeq           int64             `json:"to_seq"`            // For backfill - last missing event sequence number
+	Cwd             string            `json:"cwd"`               // Optional working directory of the prompt, inside the project workspace
+	PromptID        string            `json:"prompt_id"`         // For queue_remove - the queued prompt to drop
+	PromptIDs       []string          `json:"prompt_ids"`        // For queue_reorder - the new order of the queued prompts
+	MessageID       string            `json:"message_id"`        // For regenerate - the user message edited into content
+	Provider        string            `json:"provider"`          // For set_model and retry - the provider of the model
+	Model           string            `json:"model"`             // For set_model and retry - the model ID as used by the provider API
+	Temperature     *float64          `json:"temperature"`       // For retry - the sampling temperature of the retried turn
+	ReasoningEffort string            `json:"reasoning_effort"`  // For retry - "low", "medium" or "high" for the retried turn
+	Slot            string            `json:"slot"`              // For set_model - "large" (default) or "small"
+	Seq             int64             `json:"seq"`               // For stream_ack - the last stream delta of message_id applied
+	PlanMode        bool              `json:"plan_mode"`         // Run the prompt with read-only tools, the agent answers with a plan
+	BusyPolicy      string            `json:"busy_policy"`       // While the session is busy, "queue", "reject" or "interrupt" the prompt; defaults to the session policy
+	IdempotencyKey  string            `json:"idempotency_key"`   // Retries of a prompt with the same key are not run again
+	Typing          bool              `json:"typing"`            // For user_typing - whether the user is typing a prompt
+	Env             map[string]string `json:"env"`               // For set_env - the environment variables of the session tools, replacing the previous ones
+}
+
+// DecodeClientMessage decodes a client message of any version.
+func DecodeClientMessage(data []byte) (ClientMessage, error) {
+	var msg ClientMessage
+	if !IsEnvelope(data) {
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return ClientMessage{}, err
+		}
+		return msg, nil
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return ClientMessage{}, err
+	}
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, &msg); err != nil {
+			return ClientMessage{}, fmt.Errorf("invalid %s payload: %w", env.Type, err)
+		}
+	}
+	msg.Type = env.Type
+	if env.SessionID != "" {
+		msg.SessionID = env.SessionID
+		msg.SessionIDSnake = env.SessionID
+	}
+	return msg, nil
+}
+
+// ClientPayload returns the fields of a client message of any version: the
+// payload of an envelope or the legacy message itself.
+func ClientPayload(data []byte) []byte {
+	if !IsEnvelope(data) {
+		return data
+	}
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil || len(env.Payload) == 0 {
+		return []byte("{}")
+	}
+	return env.Payload
+}
@@ -0,0 +1,422 @@
+package protocol
+
+import (
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/domain/session"
+	storeredis "github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/internal/agent"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+)
+
+// Types of the events sent by the server.
+const (
+	TypeHello                  = "hello"
+	TypeError                  = "error"
+	TypeRateLimited            = "rate_limited"
+	TypeServerDraining         = "server_draining"
+	TypeMessage                = "message"
+	TypeStreamDelta            = "stream_delta"
+	TypeToolCallOutputDelta    = "tool_call_output_delta"
+	TypeToolCallUpdate         = "tool_call_update"
+	TypePermissionRequest      = "permission_request"
+	TypePermissionNotification = "permission_notification"
+	TypePermissionBlocking     = "permission_blocking"
+	TypeDiagnostics            = "diagnostics"
+	TypeModelSwitched          = "model_switched"
+	TypeModelUpdated           = "model_updated"
+	TypeEnvUpdated             = "env_updated"
+	TypeSessionUpdate          = "session_update"
+	TypeSessionStatus          = "session_status"
+	TypeTodosUpdate            = "todos_update"
+	TypeGenerationComplete     = "generation_complete"
+	TypeReconnectionStatus     = "reconnection_status"
+	TypeBackfillComplete       = "backfill_complete"
+	TypePromptAccepted         = "prompt_accepted"
+	TypeQueueUpdated           = "queue_updated"
+	TypeQueuePosition          = "queue_position"
+	TypeProjectPaused          = "project_paused"
+	TypePresence               = "presence"
+	TypePresenceChange         = "presence_change"
+	TypeUserTyping             = "user_typing"
+	TypeMessagesTruncated      = "messages_truncated"
+	TypeWorkspaceSnapshot      = "workspace_snapshot"
+	TypeFileRevert             = "file_revert"
+	TypeFilesChanged           = "files_changed"
+	TypeFileCreated            = "file_created"
+	TypeFileModified           = "file_modified"
+	TypeFileDeleted            = "file_deleted"
+)
+
+// Event is the payload of a message sent by the server.
+type Event interface {
+	EventType() string
+}
+
+// Hello is sent first to the clients of protocol version 2 or later, with
+// the version negotiated for the connection.
+type Hello struct {
+	Version   int    `json:"version"`
+	Versions  []int  `json:"versions"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// Error reports a failed client message or run. Error is the message for
+// humans, ErrorCode, Category and Retryable classify it, see package apierr.
+type Error struct {
+	SessionID string `json:"session_id,omitempty"`
+	Error     string `json:"error"`
+	// Code is the HTTP status of the error
+	Code      int             `json:"code,omitempty"`
+	ErrorCode apierr.Code     `json:"error_code"`
+	Category  apierr.Category `json:"category"`
+	Retryable bool            `json:"retryable"`
+	Detail    string          `json:"detail,omitempty"`
+	// Draining is set when the instance no longer runs prompts
+	Draining bool      `json:"draining,omitempty"`
+	Capacity *Capacity `json:"capacity,omitempty"`
+}
+
+// NewError returns the error event of a classified error.
+func NewError(sessionID, message string, info apierr.Error) Error {
+	return Error{
+		SessionID: sessionID,
+		Error:     message,
+		Code:      info.Code.Status(),
+		ErrorCode: info.Code,
+		Category:  info.Category,
+		Retryable: info.Retryable,
+		Detail:    info.Detail,
+	}
+}
+
+// Capacity is the load of the worker pool when a prompt was rejected.
+type Capacity struct {
+	QueueDepth       int   `json:"queue_depth"`
+	QueueSize        int   `json:"queue_size"`
+	ActiveWorkers    int64 `json:"active_workers"`
+	MaxWorkers       int   `json:"max_workers"`
+	EstimatedWaitSec int   `json:"estimated_wait_sec"`
+	RetryAfterSec    int   `json:"retry_after_sec"`
+}
+
+// RateLimited rejects a client message over the rate limits.
+type RateLimited struct {
+	SessionID string `json:"session_id"`
+	// Message is the type of the rejected message
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after"` // seconds
+	Error      string `json:"error"`
+}
+
+// ServerDraining tells the clients to reconnect to another instance.
+type ServerDraining struct {
+	RetryAfter int `json:"retry_after"` // seconds
+}
+
+// Message is a created or finished message of a session.
+type Message struct {
+	message.Message
+}
+
+// StreamDelta extends a message being generated.
+type StreamDelta struct {
+	message.StreamDelta
+}
+
+// ToolCallOutputDelta is a chunk of the output of a running tool call.
+type ToolCallOutputDelta struct {
+	tools.ToolOutputDelta
+}
+
+// ToolCallUpdate is the state of a tool call.
+type ToolCallUpdate struct {
+	ID           string `json:"id"`
+	SessionID    string `json:"session_id"`
+	MessageID    string `json:"message_id"`
+	Name         string `json:"name"`
+	Input        string `json:"input"`
+	Status       string `json:"status"`
+	Result       string `json:"result,omitempty"`
+	IsError      bool   `json:"is_error,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	CreatedAt    int64  `json:"created_at,omitempty"`
+	UpdatedAt    int64  `json:"updated_at,omitempty"`
+	StartedAt    *int64 `json:"started_at,omitempty"`
+	FinishedAt   *int64 `json:"finished_at,omitempty"`
+}
+
+// PermissionRequest asks the clients to allow a tool call.
+type PermissionRequest struct {
+	ID          string `json:"id"`
+	SessionID   string `json:"session_id"`
+	ToolCallID  string `json:"tool_call_id"`
+	ToolName    string `json:"tool_name"`
+	Description string `json:"description"`
+	Action      string `json:"action"`
+	// Params are truncated and masked when ParamsRedacted is set, the full
+	// ones are fetched through the HTTP API
+	Params         any    `json:"params,omitempty"`
+	ParamsRedacted bool   `json:"params_redacted"`
+	Path           string `json:"path"`
+	// OriginalPrompt and Resumed are set for the tool calls suspended by an
+	// earlier run
+	OriginalPrompt string `json:"original_prompt,omitempty"`
+	Resumed        bool   `json:"_resumed,omitempty"`
+}
+
+// PermissionNotification tells the clients a permission request was answered.
+type PermissionNotification struct {
+	ToolCallID string `json:"tool_call_id"`
+	Granted    bool   `json:"granted"`
+	Denied     bool   `json:"denied"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// PermissionBlocking escalates a permission request that kept its run waiting.
+type PermissionBlocking struct {
+	PermissionID string `json:"permission_id"`
+	SessionID    string `json:"session_id"`
+	ToolCallID   string `json:"tool_call_id"`
+	ToolName     string `json:"tool_name"`
+	Description  string `json:"description"`
+	BlockedMs    int64  `json:"blocked_ms"`
+}
+
+// Diagnostics are the findings of a lint run.
+type Diagnostics struct {
+	Source string `json:"source"`
+	tools.LintEvent
+}
+
+// ModelSwitched tells the clients a turn failed over to another model.
+type ModelSwitched struct {
+	SessionID    string `json:"session_id"`
+	MessageID    string `json:"message_id"`
+	FromProvider string `json:"from_provider"`
+	FromModel    string `json:"from_model"`
+	Provider     string `json:"provider"`
+	Model        string `json:"model"`
+	Reason       string `json:"reason"`
+}
+
+// ModelUpdated tells the clients the model of the next turns changed.
+type ModelUpdated struct {
+	SessionID string `json:"session_id"`
+	Slot      string `json:"slot"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+}
+
+// EnvUpdated tells the clients the environment variables of the session
+// tools changed, they apply from the next turn.
+type EnvUpdated struct {
+	SessionID string            `json:"session_id"`
+	Env       map[string]string `json:"env"`
+}
+
+// SessionUpdate is the state of a session.
+type SessionUpdate struct {
+	ID               string  `json:"id"`
+	ProjectID        string  `json:"project_id"`
+	Title            string  `json:"title"`
+	MessageCount     int64   `json:"message_count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	ContextWindow    int64   `json:"context_window"`
+	CreatedAt        int64   `json:"created_at"`
+	UpdatedAt        int64   `json:"updated_at"`
+}
+
+// SessionStatus tells whether the agent runs in a session.
+type SessionStatus struct {
+	SessionID string `json:"session_id"`
+	Status    string `json:"status"`
+	IsRunning bool   `json:"is_running"`
+}
+
+// TodosUpdate is the todo list of a session.
+type TodosUpdate struct {
+	SessionID   string         `json:"session_id"`
+	Todos       []session.Todo `json:"todos"`
+	Completed   int            `json:"completed"`
+	InProgress  int            `json:"in_progress"`
+	Pending     int            `json:"pending"`
+	Total       int            `json:"total"`
+	CurrentTask string         `json:"current_task"`
+}
+
+// GenerationComplete ends a turn.
+type GenerationComplete struct {
+	SessionID string `json:"session_id"`
+	Status    string `json:"status"`
+	Error     bool   `json:"error"`
+	// Stalled is set when the watchdog cancelled a provider stream that
+	// stopped responding
+	Stalled bool `json:"stalled,omitempty"`
+	// BudgetExceeded is set when a session, project or user budget was used up
+	BudgetExceeded bool                   `json:"budget_exceeded,omitempty"`
+	Timeline       *agent.TimelineSummary `json:"timeline,omitempty"`
+}
+
+// ReconnectionStatus ends the replay of the events missed by a client.
+type ReconnectionStatus struct {
+	SessionID        string `json:"session_id"`
+	MessagesReplayed int    `json:"messages_replayed"`
+	GenerationActive bool   `json:"generation_active"`
+	SessionStatus    string `json:"session_status"`
+	IsRunning        bool   `json:"is_running"`
+	LastStreamID     string `json:"last_stream_id"`
+}
+
+// BackfillComplete tells a client what was recovered of the events it missed.
+type BackfillComplete struct {
+	SessionID string `json:"session_id"`
+	FromSeq   int64  `json:"from_seq"`
+	ToSeq     int64  `json:"to_seq"`
+	Replayed  int    `json:"replayed"`
+	Missing   int    `json:"missing"`
+	// Source is none, redis or redis+db
+	Source string `json:"source"`
+}
+
+// PromptAccepted tells a client its prompt passed validation.
+type PromptAccepted struct {
+	SessionID      string `json:"session_id"`
+	IdempotencyKey string `json:"idempotency_key"`
+	// AcceptedSeq is the sequence number of the first acceptance, sent again
+	// with the duplicates
+	AcceptedSeq int64 `json:"accepted_seq,omitempty"`
+	AcceptedAt  int64 `json:"accepted_at,omitempty"`
+	Duplicate   bool  `json:"duplicate,omitempty"`
+}
+
+// QueueUpdated lists the prompts queued behind the running turn.
+type QueueUpdated struct {
+	SessionID string               `json:"session_id"`
+	Prompts   []agent.QueuedPrompt `json:"prompts"`
+	Count     int                  `json:"count"`
+}
+
+// QueuePosition is the position of a prompt in the overflow queue, 0 once it
+// was dispatched.
+type QueuePosition struct {
+	SessionID        string `json:"session_id"`
+	Position         int    `json:"position"`
+	EstimatedWaitSec int    `json:"estimated_wait_sec,omitempty"`
+	Dispatched       bool   `json:"dispatched,omitempty"`
+}
+
+// ProjectPaused tells a client its prompt waits for the end of a
+// maintenance window.
+type ProjectPaused struct {
+	SessionID string `json:"session_id"`
+	ProjectID string `json:"project_id"`
+	Reason    string `json:"reason"`
+	Queued    bool   `json:"queued"`
+}
+
+// Presence lists the collaborators in a session.
+type Presence struct {
+	SessionID string                `json:"session_id"`
+	Users     []storeredis.Presence `json:"users"`
+	Left      bool                  `json:"left,omitempty"`
+	// Typing lists the IDs of the users typing a prompt
+	Typing []string `json:"typing,omitempty"`
+}
+
+// PresenceChange tells the clients of a session that a user started or
+// stopped following it.
+type PresenceChange struct {
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Joined    bool   `json:"joined"`
+}
+
+// UserTyping tells the clients of a session that a user is typing a prompt,
+// or stopped. A user still typing resends the signal within ExpiresIn
+// seconds, after which they are shown as no longer typing.
+type UserTyping struct {
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Typing    bool   `json:"typing"`
+	ExpiresIn int    `json:"expires_in,omitempty"`
+}
+
+// MessagesTruncated lists the messages removed to regenerate a turn.
+type MessagesTruncated struct {
+	SessionID  string   `json:"session_id"`
+	MessageID  string   `json:"message_id"`
+	MessageIDs []string `json:"message_ids"`
+}
+
+// WorkspaceSnapshot tells the clients the workspace was archived before a run.
+type WorkspaceSnapshot struct {
+	SessionID  string `json:"session_id"`
+	ProjectID  string `json:"project_id"`
+	SnapshotID string `json:"snapshot_id"`
+	Size       int64  `json:"size"`
+}
+
+// FileRevert is the outcome of a file revert: reverted, denied or failed.
+type FileRevert struct {
+	SessionID string `json:"session_id"`
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	Version   int64  `json:"version"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// FilesChanged replaces the file events of a turn that changed too many files.
+type FilesChanged struct {
+	SessionID string `json:"session_id"`
+	Count     int    `json:"count"`
+}
+
+// FileChange reports a file created, modified or deleted in the workspace.
+type FileChange struct {
+	// Type is TypeFileCreated, TypeFileModified or TypeFileDeleted
+	Type      string `json:"-"`
+	SessionID string `json:"session_id"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size,omitempty"`
+	Modified  int64  `json:"modified,omitempty"`
+}
+
+func (Hello) EventType() string                  { return TypeHello }
+func (Error) EventType() string                  { return TypeError }
+func (RateLimited) EventType() string            { return TypeRateLimited }
+func (ServerDraining) EventType() string         { return TypeServerDraining }
+func (Message) EventType() string                { return TypeMessage }
+func (StreamDelta) EventType() string            { return TypeStreamDelta }
+func (ToolCallOutputDelta) EventType() string    { return TypeToolCallOutputDelta }
+func (ToolCallUpdate) EventType() string         { return TypeToolCallUpdate }
+func (PermissionRequest) EventType() string      { return TypePermissionRequest }
+func (PermissionNotification) EventType() string { return TypePermissionNotification }
+func (PermissionBlocking) EventType() string     { return TypePermissionBlocking }
+func (Diagnostics) EventType() string            { return TypeDiagnostics }
+func (ModelSwitched) EventType() string          { return TypeModelSwitched }
+func (ModelUpdated) EventType() string           { return TypeModelUpdated }
+func (EnvUpdated) EventType() string             { return TypeEnvUpdated }
+func (SessionUpdate) EventType() string          { return TypeSessionUpdate }
+func (SessionStatus) EventType() string          { return TypeSessionStatus }
+func (TodosUpdate) EventType() string            { return TypeTodosUpdate }
+func (GenerationComplete) EventType() string     { return TypeGenerationComplete }
+func (ReconnectionStatus) EventType() string     { return TypeReconnectionStatus }
+func (BackfillComplete) EventType() string       { return TypeBackfillComplete }
+func (PromptAccepted) EventType() string         { return TypePromptAccepted }
+func (QueueUpdated) EventType() string           { return TypeQueueUpdated }
+func (QueuePosition) EventType() string          { return TypeQueuePosition }
+func (ProjectPaused) EventType() string          { return TypeProjectPaused }
+func (Presence) EventType() string               { return TypePresence }
+func (PresenceChange) EventType() string         { return TypePresenceChange }
+func (UserTyping) EventType() string             { return TypeUserTyping }
+func (MessagesTruncated) EventType() string      { return TypeMessagesTruncated }
+func (WorkspaceSnapshot) EventType() string      { return TypeWorkspaceSnapshot }
+func (FileRevert) EventType() string             { return TypeFileRevert }
+func (FilesChanged) EventType() string           { return TypeFilesChanged }
+func (e FileChange) EventType() string           { return e.Type }
@@ -0,0 +1,176 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Keys of the legacy schema.
+const (
+	legacyTypeKey      = "Type"
+	legacySeqKey       = "_seq"
+	legacyStreamIDKey  = "_streamId"
+	legacyEventTypeKey = "_type"
+	legacyTimeKey      = "_timestamp"
+	legacyPayloadKey   = "_payload"
+)
+
+// Encode returns a message in the given protocol version. The message is an
+// envelope, or a legacy message relayed by an instance that predates the
+// envelopes.
+func Encode(data []byte, version int) ([]byte, error) {
+	envelope := IsEnvelope(data)
+	switch {
+	case version >= Version2 && envelope, version < Version2 && !envelope:
+		return data, nil
+	case envelope:
+		var env Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			return nil, err
+		}
+		return Legacy(env)
+	default:
+		env, err := FromLegacy(data)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(env)
+	}
+}
+
+// Legacy translates an envelope to the legacy schema: the fields of the
+// payload with the type as "Type" and the sequence number as "_seq". Messages
+// carry no type, they are told apart by their fields. Replayed events are
+// wrapped with their stream ID, type and time, except for the deltas which
+// are flagged in place.
+func Legacy(env Envelope) ([]byte, error) {
+	fields := map[string]any{}
+	if env.Replay != "" && !isDelta(env.Type) {
+		var payload any = env.Payload
+		if env.Type != TypeMessage {
+			typed, err := payloadFields(env)
+			if err != nil {
+				return nil, err
+			}
+			typed[legacyTypeKey] = env.Type
+			payload = typed
+		}
+		fields["_"+env.Replay] = true
+		fields[legacyEventTypeKey] = env.Type
+		fields[legacyPayloadKey] = payload
+		if env.StreamID != "" {
+			fields[legacyStreamIDKey] = env.StreamID
+		}
+		if env.Timestamp != 0 {
+			fields[legacyTimeKey] = env.Timestamp
+		}
+	} else {
+		var err error
+		if fields, err = payloadFields(env); err != nil {
+			return nil, err
+		}
+		if env.Type != TypeMessage {
+			fields[legacyTypeKey] = env.Type
+		}
+		if env.Replay != "" {
+			fields["_"+env.Replay] = true
+			fields[legacyStreamIDKey] = env.StreamID
+		}
+	}
+	if env.Seq > 0 {
+		fields[legacySeqKey] = env.Seq
+	}
+	return json.Marshal(fields)
+}
+
+// FromLegacy wraps a legacy message in an envelope.
+func FromLegacy(data []byte) (Envelope, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Envelope{}, err
+	}
+	env := Envelope{V: LatestVersion, Type: TypeMessage}
+	take := func(key string, v any) bool {
+		raw, ok := fields[key]
+		if !ok {
+			return false
+		}
+		delete(fields, key)
+		return json.Unmarshal(raw, v) == nil
+	}
+
+	take(legacySeqKey, &env.Seq)
+	for _, replay := range []string{ReplayReconnect, ReplayBackfill} {
+		var flagged bool
+		if take("_"+replay, &flagged) && flagged {
+			env.Replay = replay
+		}
+	}
+	take(legacyStreamIDKey, &env.StreamID)
+	take(legacyTimeKey, &env.Timestamp)
+	take(legacyEventTypeKey, &env.Type)
+	take(legacyTypeKey, &env.Type)
+
+	var payload json.RawMessage
+	if raw, ok := fields[legacyPayloadKey]; ok {
+		payload = withoutLegacyType(raw)
+	} else {
+		var err error
+		if payload, err = json.Marshal(fields); err != nil {
+			return Envelope{}, err
+		}
+	}
+	env.Payload = payload
+
+	var scope struct {
+		SessionID string `json:"session_id"`
+		// Messages name their session in Go style
+		MessageSessionID string `json:"SessionID"`
+	}
+	if json.Unmarshal(payload, &scope) == nil {
+		env.SessionID = scope.SessionID
+		if env.SessionID == "" {
+			env.SessionID = scope.MessageSessionID
+		}
+	}
+	return env, nil
+}
+
+// payloadFields decodes the payload of an envelope, which is an object. The
+// values are kept encoded so that they are written back unchanged.
+func payloadFields(env Envelope) (map[string]any, error) {
+	var raw map[string]json.RawMessage
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, &raw); err != nil {
+			return nil, fmt.Errorf("invalid %s payload: %w", env.Type, err)
+		}
+	}
+	fields := make(map[string]any, len(raw)+2)
+	for k, v := range raw {
+		fields[k] = v
+	}
+	return fields, nil
+}
+
+// withoutLegacyType drops the "Type" key the payloads buffered by older
+// instances carry.
+func withoutLegacyType(payload json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(payload, &fields) != nil {
+		return payload
+	}
+	if _, ok := fields[legacyTypeKey]; !ok {
+		return payload
+	}
+	delete(fields, legacyTypeKey)
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	return data
+}
+
+// isDelta reports whether an event type is a delta, replayed in place.
+func isDelta(eventType string) bool {
+	return eventType == TypeStreamDelta || eventType == TypeToolCallOutputDelta
+}
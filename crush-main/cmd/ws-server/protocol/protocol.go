@@ -0,0 +1,126 @@
+// Package protocol defines the messages exchanged with the WebSocket clients.
+//
+// From version 2 every message is an Envelope carrying its protocol version,
+// type, ID, session and a typed payload. Version 1 is the legacy schema of
+// flat JSON objects with a "Type" key, still spoken to the clients that do
+// not ask for a version: the server builds envelopes and translates them for
+// those clients when they are written, see Legacy.
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Protocol versions.
+const (
+	// VersionLegacy is the flat schema of the clients that do not negotiate
+	VersionLegacy = 1
+	Version2      = 2
+	// LatestVersion is the version spoken by default to negotiating clients
+	LatestVersion = Version2
+)
+
+// subprotocolPrefix prefixes the version in the WebSocket subprotocols, e.g.
+// crush.v2.
+const subprotocolPrefix = "crush.v"
+
+// Envelope is a message of protocol version 2 or later.
+type Envelope struct {
+	V         int    `json:"v"`
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	// Seq is the sequence number of the event in the session, clients seeing
+	// a number skipped ask for it with a backfill message
+	Seq int64 `json:"seq,omitempty"`
+	// Replay is "replay" or "backfill" for an event sent again from the
+	// session's stream, with the ID and time it was buffered at
+	Replay    string          `json:"replay,omitempty"`
+	StreamID  string          `json:"stream_id,omitempty"`
+	Timestamp int64           `json:"timestamp,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// Replay sources of an envelope.
+const (
+	ReplayReconnect = "replay"
+	ReplayBackfill  = "backfill"
+)
+
+// NewEnvelope wraps an event of a session, seq is 0 for the events not
+// buffered in the session's stream.
+func NewEnvelope(sessionID string, event Event, seq int64) (Envelope, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to marshal %s event: %w", event.EventType(), err)
+	}
+	return Envelope{
+		V:         LatestVersion,
+		Type:      event.EventType(),
+		ID:        uuid.NewString(),
+		SessionID: sessionID,
+		Seq:       seq,
+		Payload:   payload,
+	}, nil
+}
+
+// Replayed wraps an event buffered in the session's stream to send it again.
+// replay is ReplayReconnect or ReplayBackfill.
+func Replayed(sessionID, replay, streamID, eventType string, seq, timestamp int64, payload json.RawMessage) Envelope {
+	return Envelope{
+		V:         LatestVersion,
+		Type:      eventType,
+		ID:        uuid.NewString(),
+		SessionID: sessionID,
+		Seq:       seq,
+		Replay:    replay,
+		StreamID:  streamID,
+		Timestamp: timestamp,
+		Payload:   withoutLegacyType(payload),
+	}
+}
+
+// Versions returns the supported protocol versions, latest first.
+func Versions() []int {
+	return []int{Version2, VersionLegacy}
+}
+
+// Subprotocols returns the WebSocket subprotocols naming the supported
+// versions, latest first.
+func Subprotocols() []string {
+	versions := Versions()
+	protocols := make([]string, len(versions))
+	for i, v := range versions {
+		protocols[i] = subprotocolPrefix + strconv.Itoa(v)
+	}
+	return protocols
+}
+
+// Negotiate returns the version of a connection from the subprotocol agreed
+// on at the upgrade or, without one, the version asked for in the URL. Clients
+// asking for nothing get the legacy schema, clients asking for a newer
+// version than the server knows get the latest one.
+func Negotiate(subprotocol, requested string) int {
+	if v, ok := strings.CutPrefix(subprotocol, subprotocolPrefix); ok {
+		requested = v
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(requested, "v"))
+	if err != nil || v < VersionLegacy {
+		return VersionLegacy
+	}
+	return min(v, LatestVersion)
+}
+
+// IsEnvelope reports whether a message is an envelope rather than a legacy
+// message.
+func IsEnvelope(data []byte) bool {
+	var probe struct {
+		V int `json:"v"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.V >= Version2
+}
@@ -0,0 +1,202 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		subprotocol string
+		requested   string
+		want        int
+	}{
+		{"nothing asked", "", "", VersionLegacy},
+		{"subprotocol", "crush.v2", "", Version2},
+		{"subprotocol wins over query", "crush.v1", "2", VersionLegacy},
+		{"query", "", "2", Version2},
+		{"query with prefix", "", "v2", Version2},
+		{"newer than known", "", "9", LatestVersion},
+		{"invalid", "", "latest", VersionLegacy},
+		{"zero", "", "0", VersionLegacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, Negotiate(tt.subprotocol, tt.requested))
+		})
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("event", func(t *testing.T) {
+		t.Parallel()
+		env, err := NewEnvelope("s1", PermissionNotification{ToolCallID: "tc1", Granted: true}, 7)
+		require.NoError(t, err)
+
+		data, err := Legacy(env)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"Type":"permission_notification","tool_call_id":"tc1","granted":true,"denied":false,"_seq":7}`, string(data))
+	})
+
+	t.Run("message has no type", func(t *testing.T) {
+		t.Parallel()
+		env := Envelope{V: Version2, Type: TypeMessage, Payload: json.RawMessage(`{"ID":"m1","SessionID":"s1"}`)}
+
+		data, err := Legacy(env)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"ID":"m1","SessionID":"s1"}`, string(data))
+	})
+
+	t.Run("replay is wrapped", func(t *testing.T) {
+		t.Parallel()
+		env := Replayed("s1", ReplayReconnect, "1-0", TypeTodosUpdate, 3, 1700, json.RawMessage(`{"Type":"todos_update","total":2}`))
+
+		data, err := Legacy(env)
+		require.NoError(t, err)
+		require.JSONEq(t, `{
+			"_replay": true,
+			"_type": "todos_update",
+			"_payload": {"Type": "todos_update", "total": 2},
+			"_streamId": "1-0",
+			"_timestamp": 1700,
+			"_seq": 3
+		}`, string(data))
+	})
+
+	t.Run("delta replay is flagged in place", func(t *testing.T) {
+		t.Parallel()
+		env := Replayed("s1", ReplayBackfill, "2-0", TypeStreamDelta, 4, 1700, json.RawMessage(`{"message_id":"m1"}`))
+
+		data, err := Legacy(env)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"Type":"stream_delta","message_id":"m1","_backfill":true,"_streamId":"2-0","_seq":4}`, string(data))
+	})
+
+	t.Run("numbers are kept", func(t *testing.T) {
+		t.Parallel()
+		env := Envelope{V: Version2, Type: TypeFileRevert, Payload: json.RawMessage(`{"version":9007199254740993}`)}
+
+		data, err := Legacy(env)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"Type":"file_revert","version":9007199254740993}`, string(data))
+	})
+}
+
+func TestFromLegacy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("event", func(t *testing.T) {
+		t.Parallel()
+		env, err := FromLegacy([]byte(`{"Type":"session_status","session_id":"s1","status":"idle","_seq":5}`))
+		require.NoError(t, err)
+		require.Equal(t, LatestVersion, env.V)
+		require.Equal(t, TypeSessionStatus, env.Type)
+		require.Equal(t, "s1", env.SessionID)
+		require.Equal(t, int64(5), env.Seq)
+		require.JSONEq(t, `{"session_id":"s1","status":"idle"}`, string(env.Payload))
+	})
+
+	t.Run("message", func(t *testing.T) {
+		t.Parallel()
+		env, err := FromLegacy([]byte(`{"ID":"m1","SessionID":"s1"}`))
+		require.NoError(t, err)
+		require.Equal(t, TypeMessage, env.Type)
+		require.Equal(t, "s1", env.SessionID)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		t.Parallel()
+		env, err := FromLegacy([]byte(`{"_replay":true,"_type":"todos_update","_payload":{"Type":"todos_update","total":2},"_streamId":"1-0","_timestamp":1700,"_seq":3}`))
+		require.NoError(t, err)
+		require.Equal(t, TypeTodosUpdate, env.Type)
+		require.Equal(t, ReplayReconnect, env.Replay)
+		require.Equal(t, "1-0", env.StreamID)
+		require.Equal(t, int64(1700), env.Timestamp)
+		require.Equal(t, int64(3), env.Seq)
+		require.JSONEq(t, `{"total":2}`, string(env.Payload))
+	})
+}
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	env, err := NewEnvelope("s1", SessionStatus{SessionID: "s1", Status: "idle"}, 2)
+	require.NoError(t, err)
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+
+	same, err := Encode(data, Version2)
+	require.NoError(t, err)
+	require.Equal(t, data, same)
+
+	legacy, err := Encode(data, VersionLegacy)
+	require.NoError(t, err)
+	require.False(t, IsEnvelope(legacy))
+
+	upgraded, err := Encode(legacy, Version2)
+	require.NoError(t, err)
+	require.True(t, IsEnvelope(upgraded))
+
+	var back Envelope
+	require.NoError(t, json.Unmarshal(upgraded, &back))
+	require.Equal(t, TypeSessionStatus, back.Type)
+	require.Equal(t, "s1", back.SessionID)
+	require.Equal(t, int64(2), back.Seq)
+	require.JSONEq(t, string(env.Payload), string(back.Payload))
+}
+
+func TestDecodeClientMessage(t *testing.T) {
+	t.Parallel()
+
+	t.Run("legacy", func(t *testing.T) {
+		t.Parallel()
+		msg, err := DecodeClientMessage([]byte(`{"type":"cancel","sessionID":"s1","mode":"hard"}`))
+		require.NoError(t, err)
+		require.Equal(t, TypeCancel, msg.Type)
+		require.Equal(t, "s1", msg.SessionID)
+		require.Equal(t, "hard", msg.Mode)
+	})
+
+	t.Run("envelope", func(t *testing.T) {
+		t.Parallel()
+		msg, err := DecodeClientMessage([]byte(`{"v":2,"type":"permission_response","session_id":"s1","payload":{"id":"p1","granted":true}}`))
+		require.NoError(t, err)
+		require.Equal(t, TypePermissionResponse, msg.Type)
+		require.Equal(t, "s1", msg.SessionID)
+		require.Equal(t, "s1", msg.SessionIDSnake)
+		require.Equal(t, "p1", msg.ID)
+		require.True(t, msg.Granted)
+	})
+
+	t.Run("typing", func(t *testing.T) {
+		t.Parallel()
+		msg, err := DecodeClientMessage([]byte(`{"v":2,"type":"user_typing","session_id":"s1","payload":{"typing":true}}`))
+		require.NoError(t, err)
+		require.Equal(t, TypeUserTyping, msg.Type)
+		require.True(t, msg.Typing)
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		t.Parallel()
+		msg, err := DecodeClientMessage([]byte(`{"v":2,"type":"retry","session_id":"s1","payload":{"temperature":0,"reasoning_effort":"high"}}`))
+		require.NoError(t, err)
+		require.Equal(t, TypeRetry, msg.Type)
+		require.NotNil(t, msg.Temperature, "a zero temperature is an override")
+		require.Zero(t, *msg.Temperature)
+		require.Equal(t, "high", msg.ReasoningEffort)
+	})
+
+	t.Run("envelope payload", func(t *testing.T) {
+		t.Parallel()
+		require.JSONEq(t, `{"cursor":1}`, string(ClientPayload([]byte(`{"v":2,"type":"presence","payload":{"cursor":1}}`))))
+		require.JSONEq(t, `{"type":"presence"}`, string(ClientPayload([]byte(`{"type":"presence"}`))))
+	})
+}
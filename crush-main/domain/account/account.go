@@ -0,0 +1,221 @@
+// Package account implements the data lifecycle of user accounts: exporting
+// everything a user owns, archiving, tagging and deleting sessions in bulk,
+// retaining sessions for a limited time and permanently deleting it all.
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// Export job statuses.
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// exportTimeout bounds the time spent building an export archive.
+const exportTimeout = 30 * time.Minute
+
+var (
+	// ErrExportNotFound is returned when an export job does not belong to the user.
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportNotReady is returned when downloading an export that is not completed.
+	ErrExportNotReady = errors.New("export is not completed")
+	// ErrStorageUnavailable is returned when object storage is required but not configured.
+	ErrStorageUnavailable = errors.New("storage service unavailable")
+)
+
+// ObjectStore is the object storage holding attachments and export archives.
+type ObjectStore interface {
+	PutObject(ctx context.Context, objectName string, data []byte, contentType string) error
+	GetObject(ctx context.Context, objectName string) (io.ReadCloser, int64, error)
+	RemoveObject(ctx context.Context, objectName string) error
+	ObjectExists(ctx context.Context, objectName string) (bool, error)
+	// ObjectName returns the object of a storage URL, false for other URLs.
+	ObjectName(objectURL string) (string, bool)
+}
+
+// KeyPurger removes the Redis state of sessions.
+type KeyPurger interface {
+	PurgeSessionKeys(ctx context.Context, sessionID string) (int, error)
+	CountSessionKeys(ctx context.Context, sessionID string) (int, error)
+}
+
+// ExportJob is an asynchronous export of the data of a user.
+type ExportJob struct {
+	ID          string
+	UserID      string
+	Status      string
+	ObjectName  string
+	Size        int64
+	Error       string
+	CreatedAt   int64
+	CompletedAt int64
+}
+
+type Service interface {
+	// StartExport creates an export job and builds its archive in the background.
+	StartExport(ctx context.Context, userID string) (ExportJob, error)
+	// GetExport returns an export job of the user, or ErrExportNotFound.
+	GetExport(ctx context.Context, userID, jobID string) (ExportJob, error)
+	// ListExports returns the export jobs of the user, newest first.
+	ListExports(ctx context.Context, userID string) ([]ExportJob, error)
+	// OpenExport opens the archive of a completed export job.
+	OpenExport(ctx context.Context, userID, jobID string) (io.ReadCloser, int64, error)
+	// DeleteAccount permanently deletes the user and everything they own in
+	// Postgres, Redis and object storage, then verifies nothing is left.
+	DeleteAccount(ctx context.Context, userID string) (DeletionReport, error)
+	// StartBulkSessions creates a job archiving, deleting or tagging sessions
+	// of the user and runs it in the background. Deleting a session also
+	// purges its Redis keys and attachments.
+	StartBulkSessions(ctx context.Context, userID string, req BulkSessionRequest) (BulkSessionJob, error)
+	// GetBulkSessions returns a bulk job of the user with its progress, or
+	// ErrBulkJobNotFound.
+	GetBulkSessions(ctx context.Context, userID, jobID string) (BulkSessionJob, error)
+	// ListBulkSessions returns the bulk jobs of the user, newest first.
+	ListBulkSessions(ctx context.Context, userID string) ([]BulkSessionJob, error)
+	// ApplyRetention soft-deletes the sessions of all users past their
+	// retention and purges the ones soft-deleted past the grace period. A dry
+	// run only reports what would be removed.
+	ApplyRetention(ctx context.Context, dryRun bool) (RetentionReport, error)
+}
+
+type service struct {
+	q         postgres.Querier
+	messages  message.Service
+	objects   ObjectStore
+	keys      KeyPurger
+	retention RetentionPolicy
+}
+
+// NewService creates the account service. objects and keys are optional;
+// without them exports are unavailable and deletions report the skipped stores.
+func NewService(q postgres.Querier, messages message.Service, objects ObjectStore, keys KeyPurger, retention RetentionPolicy) Service {
+	return &service{
+		q:         q,
+		messages:  messages,
+		objects:   objects,
+		keys:      keys,
+		retention: retention,
+	}
+}
+
+func (s *service) StartExport(ctx context.Context, userID string) (ExportJob, error) {
+	if s.objects == nil {
+		return ExportJob{}, ErrStorageUnavailable
+	}
+	dbJob, err := s.q.CreateDataExportJob(ctx, postgres.CreateDataExportJobParams{
+		ID:     uuid.New().String(),
+		UserID: userID,
+	})
+	if err != nil {
+		return ExportJob{}, err
+	}
+	job := exportJobFromDB(dbJob)
+
+	go func() {
+		slog.Info("[GOROUTINE] Account export started", "job_id", job.ID, "user_id", userID)
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		s.runExport(ctx, job)
+		slog.Info("[GOROUTINE] Account export finished", "job_id", job.ID, "user_id", userID)
+	}()
+	return job, nil
+}
+
+// runExport builds the archive of an export job and records the outcome.
+func (s *service) runExport(ctx context.Context, job ExportJob) {
+	s.updateExport(ctx, job.ID, postgres.UpdateDataExportJobParams{Status: ExportStatusRunning})
+
+	objectName := fmt.Sprintf("exports/%s/%s.zip", job.UserID, job.ID)
+	archive, err := s.buildArchive(ctx, job.UserID)
+	if err == nil {
+		err = s.objects.PutObject(ctx, objectName, archive, "application/zip")
+	}
+
+	update := postgres.UpdateDataExportJobParams{
+		CompletedAt: sql.NullInt64{Int64: time.Now().UnixMilli(), Valid: true},
+	}
+	if err != nil {
+		slog.Error("Account export failed", "job_id", job.ID, "user_id", job.UserID, "error", err)
+		update.Status = ExportStatusFailed
+		update.Error = err.Error()
+	} else {
+		update.Status = ExportStatusCompleted
+		update.ObjectName = objectName
+		update.Size = int64(len(archive))
+	}
+	s.updateExport(ctx, job.ID, update)
+}
+
+func (s *service) updateExport(ctx context.Context, jobID string, update postgres.UpdateDataExportJobParams) {
+	update.ID = jobID
+	if err := s.q.UpdateDataExportJob(ctx, update); err != nil {
+		slog.Error("Failed to update export job", "job_id", jobID, "error", err)
+	}
+}
+
+func (s *service) GetExport(ctx context.Context, userID, jobID string) (ExportJob, error) {
+	dbJob, err := s.q.GetDataExportJob(ctx, postgres.GetDataExportJobParams{
+		ID:     jobID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ExportJob{}, ErrExportNotFound
+	}
+	if err != nil {
+		return ExportJob{}, err
+	}
+	return exportJobFromDB(dbJob), nil
+}
+
+func (s *service) ListExports(ctx context.Context, userID string) ([]ExportJob, error) {
+	dbJobs, err := s.q.ListDataExportJobsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]ExportJob, len(dbJobs))
+	for i, item := range dbJobs {
+		jobs[i] = exportJobFromDB(item)
+	}
+	return jobs, nil
+}
+
+func (s *service) OpenExport(ctx context.Context, userID, jobID string) (io.ReadCloser, int64, error) {
+	job, err := s.GetExport(ctx, userID, jobID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if job.Status != ExportStatusCompleted {
+		return nil, 0, ErrExportNotReady
+	}
+	if s.objects == nil {
+		return nil, 0, ErrStorageUnavailable
+	}
+	return s.objects.GetObject(ctx, job.ObjectName)
+}
+
+func exportJobFromDB(item postgres.DataExportJob) ExportJob {
+	return ExportJob{
+		ID:          item.ID,
+		UserID:      item.UserID,
+		Status:      item.Status,
+		ObjectName:  item.ObjectName,
+		Size:        item.Size,
+		Error:       item.Error,
+		CreatedAt:   item.CreatedAt,
+		CompletedAt: item.CompletedAt.Int64,
+	}
+}
@@ -0,0 +1,207 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/upload"
+)
+
+// DeletionReport describes what a hard delete removed and whether a second
+// pass found anything left behind.
+type DeletionReport struct {
+	UserID      string `json:"user_id"`
+	StartedAt   int64  `json:"started_at"`
+	CompletedAt int64  `json:"completed_at"`
+
+	// Postgres rows removed with the user
+	Projects    int `json:"projects"`
+	Sessions    int `json:"sessions"`
+	Messages    int `json:"messages"`
+	ExportJobs  int `json:"export_jobs"`
+	Attachments int `json:"attachments"`
+	Secrets     int `json:"secrets"`
+
+	RedisKeysDeleted int `json:"redis_keys_deleted"`
+	ObjectsDeleted   int `json:"objects_deleted"`
+
+	// Stores that could not be purged because they are not configured
+	Skipped []string `json:"skipped,omitempty"`
+	// Errors met while purging, the deletion goes on regardless
+	Errors []string `json:"errors,omitempty"`
+
+	Verification Verification `json:"verification"`
+}
+
+// Verification is the result of looking for remaining data after a deletion.
+type Verification struct {
+	UserRemains      bool `json:"user_remains"`
+	ProjectsRemain   int  `json:"projects_remaining"`
+	SessionsRemain   int  `json:"sessions_remaining"`
+	RedisKeysRemain  int  `json:"redis_keys_remaining"`
+	ObjectsRemain    int  `json:"objects_remaining"`
+	Verified         bool `json:"verified"`
+	ChecksIncomplete bool `json:"checks_incomplete,omitempty"`
+}
+
+func (s *service) DeleteAccount(ctx context.Context, userID string) (DeletionReport, error) {
+	report := DeletionReport{UserID: userID, StartedAt: time.Now().UnixMilli()}
+
+	inv, err := s.collect(ctx, userID)
+	if err != nil {
+		return report, err
+	}
+	report.Projects = len(inv.projects)
+	report.Sessions = len(inv.sessions)
+	report.ExportJobs = len(inv.exports)
+	report.Attachments = len(inv.attachments)
+	for _, msgs := range inv.messages {
+		report.Messages += len(msgs)
+	}
+
+	objects := inv.objectNames()
+	if s.objects == nil {
+		if len(objects) > 0 {
+			report.Skipped = append(report.Skipped, "storage")
+		}
+	} else {
+		for _, name := range objects {
+			if err := s.objects.RemoveObject(ctx, name); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("storage %s: %s", name, err))
+				continue
+			}
+			report.ObjectsDeleted++
+		}
+	}
+
+	if s.keys == nil {
+		report.Skipped = append(report.Skipped, "redis")
+	} else {
+		for _, sess := range inv.sessions {
+			n, err := s.keys.PurgeSessionKeys(ctx, sess.ID)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("redis session %s: %s", sess.ID, err))
+			}
+			report.RedisKeysDeleted += n
+		}
+	}
+
+	// The analytics rollups only refer to the user by ID
+	if err := s.q.DeleteUserRollups(ctx, userID); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("analytics rollups: %s", err))
+	}
+
+	// The secrets have no foreign key to their project
+	for _, proj := range inv.projects {
+		n, err := s.q.DeleteProjectSecrets(ctx, proj.ID)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("secrets of project %s: %s", proj.ID, err))
+		}
+		report.Secrets += int(n)
+	}
+
+	// Projects, sessions, messages, files, tool calls, tokens, export jobs,
+	// uploads and workspace snapshots cascade from the user row
+	if err := s.q.DeleteUser(ctx, userID); err != nil {
+		return report, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	report.Verification = s.verify(ctx, inv, objects)
+	report.CompletedAt = time.Now().UnixMilli()
+	slog.Info("Account deleted",
+		"user_id", userID,
+		"projects", report.Projects,
+		"sessions", report.Sessions,
+		"secrets", report.Secrets,
+		"objects_deleted", report.ObjectsDeleted,
+		"redis_keys_deleted", report.RedisKeysDeleted,
+		"verified", report.Verification.Verified,
+	)
+	return report, nil
+}
+
+// verify looks for data of a deleted user left in any store.
+func (s *service) verify(ctx context.Context, inv *inventory, objects []string) Verification {
+	var v Verification
+	userID := inv.user.ID
+
+	if _, err := s.q.GetUserByID(ctx, userID); err == nil {
+		v.UserRemains = true
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		v.ChecksIncomplete = true
+	}
+	if projects, err := s.q.ListProjectsByUser(ctx, userID); err == nil {
+		v.ProjectsRemain = len(projects)
+	} else {
+		v.ChecksIncomplete = true
+	}
+	for _, sess := range inv.sessions {
+		if _, err := s.q.GetSessionByID(ctx, sess.ID); err == nil {
+			v.SessionsRemain++
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			v.ChecksIncomplete = true
+		}
+	}
+
+	if s.keys != nil {
+		for _, sess := range inv.sessions {
+			n, err := s.keys.CountSessionKeys(ctx, sess.ID)
+			if err != nil {
+				v.ChecksIncomplete = true
+			}
+			v.RedisKeysRemain += n
+		}
+	} else {
+		v.ChecksIncomplete = true
+	}
+
+	if s.objects != nil {
+		for _, name := range objects {
+			exists, err := s.objects.ObjectExists(ctx, name)
+			if err != nil {
+				v.ChecksIncomplete = true
+			}
+			if exists {
+				v.ObjectsRemain++
+			}
+		}
+	} else if len(objects) > 0 {
+		v.ChecksIncomplete = true
+	}
+
+	v.Verified = !v.UserRemains && v.ProjectsRemain == 0 && v.SessionsRemain == 0 &&
+		v.RedisKeysRemain == 0 && v.ObjectsRemain == 0 && !v.ChecksIncomplete
+	return v
+}
+
+// objectNames returns the stored objects of the inventory: attachments kept
+// in our storage, export archives, uploaded files and workspace snapshots.
+func (inv *inventory) objectNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, a := range inv.attachments {
+		add(a.ObjectName)
+	}
+	for _, job := range inv.exports {
+		add(job.ObjectName)
+	}
+	for _, u := range inv.uploads {
+		for _, name := range upload.ObjectNames(u) {
+			add(name)
+		}
+	}
+	for _, snap := range inv.snapshots {
+		add(snap.ObjectName)
+	}
+	return names
+}
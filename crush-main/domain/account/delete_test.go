@@ -0,0 +1,33 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventoryObjectNames(t *testing.T) {
+	t.Parallel()
+
+	inv := &inventory{
+		attachments: []Attachment{
+			{URL: "https://example.com/a.png"},
+			{URL: "http://minio/bucket/s1/a.png", ObjectName: "s1/a.png"},
+			{URL: "http://minio/bucket/s1/a.png", ObjectName: "s1/a.png"},
+		},
+		exports: []postgres.DataExportJob{
+			{ID: "pending"},
+			{ID: "done", ObjectName: "exports/u1/done.zip"},
+		},
+		uploads: []postgres.Upload{
+			{ID: "partial", Status: "uploading", ChunkSize: 10, Received: 10},
+			{ID: "full", Status: "completed", ChunkSize: 10, Received: 15, ObjectName: "uploads/full.png"},
+		},
+		snapshots: []postgres.WorkspaceSnapshot{
+			{ID: "w1", ObjectName: "snapshots/p1/w1.tar.gz"},
+		},
+	}
+
+	require.Equal(t, []string{"s1/a.png", "exports/u1/done.zip", "uploads/partial/part-00000", "uploads/full.png", "snapshots/p1/w1.tar.gz"}, inv.objectNames())
+}
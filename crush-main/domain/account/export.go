@@ -0,0 +1,260 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// Attachment is an entry of the attachments manifest of an export.
+type Attachment struct {
+	SessionID string `json:"session_id"`
+	MessageID string `json:"message_id"`
+	Kind      string `json:"kind"` // binary or image_url
+	URL       string `json:"url"`
+	MIMEType  string `json:"mime_type,omitempty"`
+	// ObjectName is set for attachments kept in our object storage.
+	ObjectName string `json:"object_name,omitempty"`
+}
+
+// inventory is everything a user owns.
+type inventory struct {
+	user        postgres.User
+	projects    []postgres.Project
+	sessions    []postgres.Session
+	messages    map[string][]message.Message
+	attachments []Attachment
+	exports     []postgres.DataExportJob
+	uploads     []postgres.Upload
+	snapshots   []postgres.WorkspaceSnapshot
+}
+
+// collect loads the inventory of a user.
+func (s *service) collect(ctx context.Context, userID string) (*inventory, error) {
+	inv := &inventory{messages: make(map[string][]message.Message)}
+
+	var err error
+	if inv.user, err = s.q.GetUserByID(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if inv.projects, err = s.q.ListProjectsByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	if inv.sessions, err = s.q.ListSessionsByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	if inv.exports, err = s.q.ListDataExportJobsByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to list exports: %w", err)
+	}
+	if inv.uploads, err = s.q.ListUploadsByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	if inv.snapshots, err = s.q.ListWorkspaceSnapshotsByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to list workspace snapshots: %w", err)
+	}
+
+	for _, sess := range inv.sessions {
+		msgs, err := s.messages.List(ctx, sess.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list messages of session %s: %w", sess.ID, err)
+		}
+		inv.messages[sess.ID] = msgs
+		for _, msg := range msgs {
+			for _, part := range msg.BinaryContent() {
+				inv.attachments = append(inv.attachments, s.attachment(msg, "binary", part.Path, part.MIMEType))
+			}
+			for _, part := range msg.ImageURLContent() {
+				inv.attachments = append(inv.attachments, s.attachment(msg, "image_url", part.URL, ""))
+			}
+		}
+	}
+	return inv, nil
+}
+
+func (s *service) attachment(msg message.Message, kind, url, mimeType string) Attachment {
+	a := Attachment{
+		SessionID: msg.SessionID,
+		MessageID: msg.ID,
+		Kind:      kind,
+		URL:       url,
+		MIMEType:  mimeType,
+	}
+	if s.objects != nil {
+		if name, ok := s.objects.ObjectName(url); ok {
+			a.ObjectName = name
+		}
+	}
+	return a
+}
+
+type exportedUser struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type exportedProject struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Description       string `json:"description,omitempty"`
+	WorkspacePath     string `json:"workspace_path"`
+	Subdomain         string `json:"subdomain,omitempty"`
+	SystemPrompt      string `json:"system_prompt,omitempty"`
+	PermissionTimeout int32  `json:"permission_timeout,omitempty"`
+	RetentionDays     int32  `json:"retention_days,omitempty"`
+	CreatedAt         int64  `json:"created_at"`
+	UpdatedAt         int64  `json:"updated_at"`
+}
+
+type exportedSession struct {
+	ID               string            `json:"id"`
+	ProjectID        string            `json:"project_id"`
+	ParentSessionID  string            `json:"parent_session_id,omitempty"`
+	Title            string            `json:"title"`
+	PromptTokens     int64             `json:"prompt_tokens"`
+	CompletionTokens int64             `json:"completion_tokens"`
+	Cost             float64           `json:"cost"`
+	CreatedAt        int64             `json:"created_at"`
+	UpdatedAt        int64             `json:"updated_at"`
+	Messages         []exportedMessage `json:"messages"`
+}
+
+type exportedMessage struct {
+	ID          string               `json:"id"`
+	Role        string               `json:"role"`
+	Model       string               `json:"model,omitempty"`
+	Provider    string               `json:"provider,omitempty"`
+	Text        string               `json:"text,omitempty"`
+	Reasoning   string               `json:"reasoning,omitempty"`
+	ToolCalls   []message.ToolCall   `json:"tool_calls,omitempty"`
+	ToolResults []message.ToolResult `json:"tool_results,omitempty"`
+	CreatedAt   int64                `json:"created_at"`
+}
+
+type exportSummary struct {
+	UserID      string `json:"user_id"`
+	ExportedAt  int64  `json:"exported_at"`
+	Projects    int    `json:"projects"`
+	Sessions    int    `json:"sessions"`
+	Messages    int    `json:"messages"`
+	Attachments int    `json:"attachments"`
+}
+
+// buildArchive writes the inventory of a user as a zip archive:
+// export.json, user.json, projects.json, sessions/<id>.json and attachments.json.
+func (s *service) buildArchive(ctx context.Context, userID string) ([]byte, error) {
+	// The archive is read from the replica, when one is configured
+	inv, err := s.collect(postgres.WithReplica(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name string, v any) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	summary := exportSummary{
+		UserID:      userID,
+		ExportedAt:  time.Now().UnixMilli(),
+		Projects:    len(inv.projects),
+		Sessions:    len(inv.sessions),
+		Attachments: len(inv.attachments),
+	}
+	for _, msgs := range inv.messages {
+		summary.Messages += len(msgs)
+	}
+	if err := write("export.json", summary); err != nil {
+		return nil, err
+	}
+
+	if err := write("user.json", exportedUser{
+		ID:        inv.user.ID,
+		Username:  inv.user.Username,
+		Email:     inv.user.Email,
+		AvatarURL: inv.user.AvatarUrl.String,
+		CreatedAt: inv.user.CreatedAt,
+		UpdatedAt: inv.user.UpdatedAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	projects := make([]exportedProject, len(inv.projects))
+	for i, p := range inv.projects {
+		projects[i] = exportedProject{
+			ID:                p.ID,
+			Name:              p.Name,
+			Description:       p.Description.String,
+			WorkspacePath:     p.WorkspacePath,
+			Subdomain:         p.Subdomain.String,
+			SystemPrompt:      p.SystemPrompt,
+			PermissionTimeout: p.PermissionTimeout,
+			RetentionDays:     p.RetentionDays,
+			CreatedAt:         p.CreatedAt,
+			UpdatedAt:         p.UpdatedAt,
+		}
+	}
+	if err := write("projects.json", projects); err != nil {
+		return nil, err
+	}
+
+	for _, sess := range inv.sessions {
+		exported := exportedSession{
+			ID:               sess.ID,
+			ProjectID:        sess.ProjectID.String,
+			ParentSessionID:  sess.ParentSessionID.String,
+			Title:            sess.Title,
+			PromptTokens:     sess.PromptTokens,
+			CompletionTokens: sess.CompletionTokens,
+			Cost:             sess.Cost,
+			CreatedAt:        sess.CreatedAt,
+			UpdatedAt:        sess.UpdatedAt,
+			Messages:         []exportedMessage{},
+		}
+		for _, msg := range inv.messages[sess.ID] {
+			exported.Messages = append(exported.Messages, exportedMessage{
+				ID:          msg.ID,
+				Role:        string(msg.Role),
+				Model:       msg.Model,
+				Provider:    msg.Provider,
+				Text:        msg.Content().Text,
+				Reasoning:   msg.ReasoningContent().Thinking,
+				ToolCalls:   msg.ToolCalls(),
+				ToolResults: msg.ToolResults(),
+				CreatedAt:   msg.CreatedAt,
+			})
+		}
+		if err := write("sessions/"+sess.ID+".json", exported); err != nil {
+			return nil, err
+		}
+	}
+
+	attachments := inv.attachments
+	if attachments == nil {
+		attachments = []Attachment{}
+	}
+	if err := write("attachments.json", attachments); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
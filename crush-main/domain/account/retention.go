@@ -0,0 +1,162 @@
+package account
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// defaultRetentionBatchSize bounds the sessions soft-deleted and purged per
+// run when the policy leaves it out.
+const defaultRetentionBatchSize = 500
+
+// RetentionPolicy is the retention of the sessions. Sessions inactive for
+// longer than the retention of their project are soft-deleted, then purged
+// once Grace is over.
+type RetentionPolicy struct {
+	// SessionDays is how many days an inactive session is kept when its
+	// project has no retention of its own, 0 keeps the sessions.
+	SessionDays int
+	// Grace is how long a soft-deleted session is kept before it is purged.
+	Grace time.Duration
+	// BatchSize bounds the sessions soft-deleted and purged per run.
+	BatchSize int
+}
+
+// RetainedSession is a session soft-deleted or purged by a retention run.
+type RetainedSession struct {
+	ID           string `json:"id"`
+	ProjectID    string `json:"project_id"`
+	Title        string `json:"title"`
+	MessageCount int64  `json:"message_count"`
+	UpdatedAt    int64  `json:"updated_at"`
+	DeletedAt    int64  `json:"deleted_at,omitempty"`
+}
+
+// RetentionReport describes what a retention run soft-deleted and purged, or
+// would have with a dry run. The purged counts include the child sessions.
+type RetentionReport struct {
+	DryRun      bool  `json:"dry_run"`
+	SessionDays int   `json:"session_days"`
+	GraceHours  int   `json:"grace_hours"`
+	StartedAt   int64 `json:"started_at"`
+	CompletedAt int64 `json:"completed_at"`
+
+	SoftDeleted []RetainedSession `json:"soft_deleted"`
+	Purged      []RetainedSession `json:"purged"`
+
+	PurgedSessions   int `json:"purged_sessions"`
+	PurgedMessages   int `json:"purged_messages"`
+	RedisKeysDeleted int `json:"redis_keys_deleted"`
+	ObjectsDeleted   int `json:"objects_deleted"`
+
+	// Errors met on single sessions, the run goes on regardless
+	Errors []string `json:"errors,omitempty"`
+}
+
+// RunRetention applies the retention every interval until ctx is done. A
+// zero interval disables it.
+func RunRetention(ctx context.Context, s Service, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if report, err := s.ApplyRetention(ctx, false); err != nil {
+			slog.Warn("Failed to apply session retention", "error", err)
+		} else if len(report.SoftDeleted) > 0 || len(report.Purged) > 0 {
+			slog.Info("Applied session retention",
+				"soft_deleted", len(report.SoftDeleted),
+				"purged", report.PurgedSessions,
+				"messages", report.PurgedMessages,
+				"redis_keys_deleted", report.RedisKeysDeleted,
+				"objects_deleted", report.ObjectsDeleted,
+				"errors", len(report.Errors),
+			)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *service) ApplyRetention(ctx context.Context, dryRun bool) (RetentionReport, error) {
+	now := time.Now()
+	report := RetentionReport{
+		DryRun:      dryRun,
+		SessionDays: s.retention.SessionDays,
+		GraceHours:  int(s.retention.Grace.Hours()),
+		StartedAt:   now.UnixMilli(),
+		SoftDeleted: []RetainedSession{},
+		Purged:      []RetainedSession{},
+	}
+	limit := int32(cmp.Or(s.retention.BatchSize, defaultRetentionBatchSize))
+
+	// Sessions soft-deleted by this run are purged after the grace period,
+	// the purge only takes the ones deleted by earlier runs
+	expired, err := s.q.ListExpiredSessions(ctx, postgres.ListExpiredSessionsParams{
+		DefaultDays: int32(s.retention.SessionDays),
+		Now:         now.UnixMilli(),
+		Limit:       limit,
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to list expired sessions: %w", err)
+	}
+	purgeable, err := s.q.ListSoftDeletedSessions(ctx, postgres.ListSoftDeletedSessionsParams{
+		DeletedBefore: sql.NullInt64{Int64: now.Add(-s.retention.Grace).UnixMilli(), Valid: true},
+		Limit:         limit,
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to list soft-deleted sessions: %w", err)
+	}
+
+	for _, sess := range expired {
+		if !dryRun {
+			err := s.q.SoftDeleteSession(ctx, postgres.SoftDeleteSessionParams{
+				ID:        sess.ID,
+				DeletedAt: sql.NullInt64{Int64: now.UnixMilli(), Valid: true},
+			})
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("soft delete session %s: %s", sess.ID, err))
+				continue
+			}
+			sess.DeletedAt = sql.NullInt64{Int64: now.UnixMilli(), Valid: true}
+		}
+		report.SoftDeleted = append(report.SoftDeleted, retainedSession(sess))
+	}
+
+	for _, sess := range purgeable {
+		cleanup, err := s.deleteSession(ctx, sess, dryRun)
+		report.PurgedSessions += cleanup.sessions
+		report.PurgedMessages += cleanup.messages
+		report.RedisKeysDeleted += cleanup.redisKeys
+		report.ObjectsDeleted += cleanup.objects
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("purge session %s: %s", sess.ID, err))
+			continue
+		}
+		report.Purged = append(report.Purged, retainedSession(sess))
+	}
+
+	report.CompletedAt = time.Now().UnixMilli()
+	return report, nil
+}
+
+func retainedSession(sess postgres.Session) RetainedSession {
+	return RetainedSession{
+		ID:           sess.ID,
+		ProjectID:    sess.ProjectID.String,
+		Title:        sess.Title,
+		MessageCount: sess.MessageCount,
+		UpdatedAt:    sess.UpdatedAt,
+		DeletedAt:    sess.DeletedAt.Int64,
+	}
+}
@@ -0,0 +1,133 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/require"
+)
+
+type retentionQuerier struct {
+	postgres.Querier
+	expired     []postgres.Session
+	softDeleted []postgres.Session
+	children    map[string][]postgres.Session
+
+	expiredArg postgres.ListExpiredSessionsParams
+	markedIDs  []string
+	deletedIDs []string
+}
+
+func (q *retentionQuerier) ListExpiredSessions(_ context.Context, arg postgres.ListExpiredSessionsParams) ([]postgres.Session, error) {
+	q.expiredArg = arg
+	return q.expired, nil
+}
+
+func (q *retentionQuerier) ListSoftDeletedSessions(context.Context, postgres.ListSoftDeletedSessionsParams) ([]postgres.Session, error) {
+	return q.softDeleted, nil
+}
+
+func (q *retentionQuerier) ListChildSessions(_ context.Context, parentID sql.NullString) ([]postgres.Session, error) {
+	return q.children[parentID.String], nil
+}
+
+func (q *retentionQuerier) SoftDeleteSession(_ context.Context, arg postgres.SoftDeleteSessionParams) error {
+	q.markedIDs = append(q.markedIDs, arg.ID)
+	return nil
+}
+
+func (q *retentionQuerier) DeleteSession(_ context.Context, id string) error {
+	q.deletedIDs = append(q.deletedIDs, id)
+	return nil
+}
+
+type retentionMessages struct {
+	message.Service
+	messages map[string][]message.Message
+}
+
+func (m retentionMessages) List(_ context.Context, sessionID string) ([]message.Message, error) {
+	return m.messages[sessionID], nil
+}
+
+type retentionObjects struct {
+	ObjectStore
+	removed []string
+}
+
+func (o *retentionObjects) ObjectName(url string) (string, bool) {
+	return strings.CutPrefix(url, "http://minio/bucket/")
+}
+
+func (o *retentionObjects) RemoveObject(_ context.Context, name string) error {
+	o.removed = append(o.removed, name)
+	return nil
+}
+
+type retentionKeys struct {
+	purged []string
+}
+
+func (k *retentionKeys) PurgeSessionKeys(_ context.Context, sessionID string) (int, error) {
+	k.purged = append(k.purged, sessionID)
+	return 2, nil
+}
+
+func (k *retentionKeys) CountSessionKeys(context.Context, string) (int, error) {
+	return 2, nil
+}
+
+func TestApplyRetention(t *testing.T) {
+	t.Parallel()
+
+	newService := func() (*service, *retentionQuerier, *retentionObjects, *retentionKeys) {
+		q := &retentionQuerier{
+			expired:     []postgres.Session{{ID: "idle", Title: "Idle"}},
+			softDeleted: []postgres.Session{{ID: "old", DeletedAt: sql.NullInt64{Int64: 1, Valid: true}}},
+			children:    map[string][]postgres.Session{"old": {{ID: "old-title"}}},
+		}
+		objects := &retentionObjects{}
+		keys := &retentionKeys{}
+		messages := retentionMessages{messages: map[string][]message.Message{
+			"old": {{ID: "m1", SessionID: "old", Parts: []message.ContentPart{
+				message.TextContent{Text: "look"},
+				message.BinaryContent{Path: "http://minio/bucket/old/a.png", MIMEType: "image/png"},
+			}}},
+		}}
+		s := &service{q: q, messages: messages, objects: objects, keys: keys, retention: RetentionPolicy{SessionDays: 30, Grace: 7 * 24 * time.Hour}}
+		return s, q, objects, keys
+	}
+
+	s, q, objects, keys := newService()
+	report, err := s.ApplyRetention(t.Context(), true)
+	require.NoError(t, err)
+	require.True(t, report.DryRun)
+	require.Equal(t, int32(30), q.expiredArg.DefaultDays)
+	require.Equal(t, int32(defaultRetentionBatchSize), q.expiredArg.Limit)
+	require.Len(t, report.SoftDeleted, 1)
+	require.Len(t, report.Purged, 1)
+	require.Equal(t, 2, report.PurgedSessions, "the child session is purged with its parent")
+	require.Equal(t, 1, report.PurgedMessages)
+	require.Equal(t, 4, report.RedisKeysDeleted)
+	require.Equal(t, 1, report.ObjectsDeleted)
+	require.Empty(t, q.markedIDs, "a dry run removes nothing")
+	require.Empty(t, q.deletedIDs)
+	require.Empty(t, objects.removed)
+	require.Empty(t, keys.purged)
+
+	s, q, objects, keys = newService()
+	report, err = s.ApplyRetention(t.Context(), false)
+	require.NoError(t, err)
+	require.Empty(t, report.Errors)
+	require.Equal(t, []string{"idle"}, q.markedIDs)
+	require.NotZero(t, report.SoftDeleted[0].DeletedAt)
+	require.Equal(t, []string{"old-title", "old"}, q.deletedIDs)
+	require.Equal(t, []string{"old/a.png"}, objects.removed)
+	require.Equal(t, []string{"old-title", "old"}, keys.purged)
+	require.Equal(t, 2, report.PurgedSessions)
+}
@@ -0,0 +1,434 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// Bulk session actions.
+const (
+	BulkActionArchive = "archive"
+	BulkActionDelete  = "delete"
+	BulkActionTag     = "tag"
+)
+
+// Bulk job statuses, the same as the export job ones.
+const (
+	BulkStatusPending   = ExportStatusPending
+	BulkStatusRunning   = ExportStatusRunning
+	BulkStatusCompleted = ExportStatusCompleted
+	BulkStatusFailed    = ExportStatusFailed
+)
+
+const (
+	// MaxBulkSessions bounds the sessions a bulk job acts on.
+	MaxBulkSessions = 1000
+	// MaxSessionTags bounds the tags of a session.
+	MaxSessionTags = 32
+	// maxTagLength bounds the length of a tag, in bytes.
+	maxTagLength = 64
+	// bulkTimeout bounds the time spent running a bulk job.
+	bulkTimeout = 30 * time.Minute
+)
+
+var (
+	// ErrBulkJobNotFound is returned when a bulk job does not belong to the user.
+	ErrBulkJobNotFound = errors.New("bulk job not found")
+	// ErrInvalidBulkRequest is returned for an unknown action, a selection
+	// that is not either session IDs or a filter, or invalid tags.
+	ErrInvalidBulkRequest = errors.New("invalid bulk request")
+	// ErrTooManySessions is returned when more than MaxBulkSessions are selected.
+	ErrTooManySessions = fmt.Errorf("a bulk job acts on at most %d sessions", MaxBulkSessions)
+)
+
+// SessionFilter selects the top-level sessions of a user. Empty fields match
+// every session.
+type SessionFilter struct {
+	ProjectID string
+	// Archived is "archived", "active" or empty for both.
+	Archived string
+	Tag      string
+	// Query is matched against the titles, case insensitively.
+	Query         string
+	CreatedAfter  int64
+	CreatedBefore int64
+}
+
+// BulkSessionRequest is an action on either a list of sessions or the
+// sessions matching a filter.
+type BulkSessionRequest struct {
+	Action     string
+	SessionIDs []string
+	Filter     *SessionFilter
+	// Tags are added to the sessions by the tag action.
+	Tags []string
+}
+
+// BulkFailure is a session a bulk job failed to act on.
+type BulkFailure struct {
+	SessionID string `json:"session_id"`
+	Error     string `json:"error"`
+}
+
+// BulkSessionJob is an asynchronous action on many sessions of a user.
+type BulkSessionJob struct {
+	ID          string
+	UserID      string
+	Action      string
+	Status      string
+	Total       int
+	Processed   int
+	Failed      int
+	Failures    []BulkFailure
+	Error       string
+	CreatedAt   int64
+	CompletedAt int64
+}
+
+func (s *service) StartBulkSessions(ctx context.Context, userID string, req BulkSessionRequest) (BulkSessionJob, error) {
+	tags, err := validateBulkRequest(req)
+	if err != nil {
+		return BulkSessionJob{}, err
+	}
+	sessions, failures, err := s.selectSessions(ctx, userID, req)
+	if err != nil {
+		return BulkSessionJob{}, err
+	}
+
+	dbJob, err := s.q.CreateSessionBulkJob(ctx, postgres.CreateSessionBulkJobParams{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		Action: req.Action,
+		Total:  int32(len(sessions) + len(failures)),
+	})
+	if err != nil {
+		return BulkSessionJob{}, err
+	}
+	job := bulkJobFromDB(dbJob)
+
+	go func() {
+		slog.Info("[GOROUTINE] Bulk session job started", "job_id", job.ID, "user_id", userID, "action", job.Action, "sessions", job.Total)
+		ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+		defer cancel()
+		s.runBulkSessions(ctx, job, sessions, failures, tags)
+		slog.Info("[GOROUTINE] Bulk session job finished", "job_id", job.ID, "user_id", userID)
+	}()
+	return job, nil
+}
+
+// validateBulkRequest checks the action and selection of req and returns
+// its tags trimmed and deduplicated.
+func validateBulkRequest(req BulkSessionRequest) ([]string, error) {
+	switch req.Action {
+	case BulkActionArchive, BulkActionDelete, BulkActionTag:
+	default:
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidBulkRequest, req.Action)
+	}
+	if (len(req.SessionIDs) == 0) == (req.Filter == nil) {
+		return nil, fmt.Errorf("%w: select sessions with either session_ids or a filter", ErrInvalidBulkRequest)
+	}
+	if len(req.SessionIDs) > MaxBulkSessions {
+		return nil, ErrTooManySessions
+	}
+	if f := req.Filter; f != nil && f.Archived != "" && f.Archived != "archived" && f.Archived != "active" {
+		return nil, fmt.Errorf("%w: archived must be archived or active", ErrInvalidBulkRequest)
+	}
+	if req.Action != BulkActionTag {
+		return nil, nil
+	}
+
+	var tags []string
+	for _, tag := range req.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: tags must be 1 to %d bytes", ErrInvalidBulkRequest, maxTagLength)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("%w: the tag action needs tags", ErrInvalidBulkRequest)
+	}
+	if len(tags) > MaxSessionTags {
+		return nil, fmt.Errorf("%w: a session has at most %d tags", ErrInvalidBulkRequest, MaxSessionTags)
+	}
+	return tags, nil
+}
+
+// selectSessions loads the sessions of the user selected by req. Listed
+// sessions that are not found, or belong to another user, are returned as
+// failures.
+func (s *service) selectSessions(ctx context.Context, userID string, req BulkSessionRequest) ([]postgres.Session, []BulkFailure, error) {
+	if f := req.Filter; f != nil {
+		sessions, err := s.q.ListSessionsForBulk(ctx, postgres.ListSessionsForBulkParams{
+			UserID:        userID,
+			ProjectID:     f.ProjectID,
+			Archived:      f.Archived,
+			Tag:           f.Tag,
+			Query:         f.Query,
+			CreatedAfter:  f.CreatedAfter,
+			CreatedBefore: f.CreatedBefore,
+			Limit:         MaxBulkSessions + 1,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		if len(sessions) > MaxBulkSessions {
+			return nil, nil, ErrTooManySessions
+		}
+		return sessions, nil, nil
+	}
+
+	var (
+		sessions []postgres.Session
+		failures []BulkFailure
+		seen     = make(map[string]bool)
+	)
+	for _, id := range req.SessionIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		sess, err := s.q.GetUserSession(ctx, postgres.GetUserSessionParams{ID: id, UserID: userID})
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			failures = append(failures, BulkFailure{SessionID: id, Error: "session not found"})
+		case err != nil:
+			return nil, nil, fmt.Errorf("failed to get session %s: %w", id, err)
+		default:
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions, failures, nil
+}
+
+// runBulkSessions acts on the sessions of a bulk job one at a time and
+// records the progress after each of them.
+func (s *service) runBulkSessions(ctx context.Context, job BulkSessionJob, sessions []postgres.Session, failures []BulkFailure, tags []string) {
+	progress := postgres.UpdateSessionBulkJobParams{
+		Status:    BulkStatusRunning,
+		Processed: int32(len(failures)),
+		Failed:    int32(len(failures)),
+	}
+	s.updateBulkJob(ctx, job.ID, progress, failures)
+
+	for _, sess := range sessions {
+		if ctx.Err() != nil {
+			break
+		}
+		var err error
+		switch job.Action {
+		case BulkActionArchive:
+			err = s.q.ArchiveSession(ctx, postgres.ArchiveSessionParams{
+				ID:         sess.ID,
+				ArchivedAt: sql.NullInt64{Int64: time.Now().UnixMilli(), Valid: true},
+			})
+		case BulkActionTag:
+			err = s.tagSession(ctx, sess, tags)
+		case BulkActionDelete:
+			_, err = s.deleteSession(ctx, sess, false)
+		}
+		progress.Processed++
+		if err != nil {
+			slog.Warn("Bulk session action failed", "job_id", job.ID, "session_id", sess.ID, "action", job.Action, "error", err)
+			progress.Failed++
+			failures = append(failures, BulkFailure{SessionID: sess.ID, Error: err.Error()})
+		}
+		s.updateBulkJob(ctx, job.ID, progress, failures)
+	}
+
+	progress.Status = BulkStatusCompleted
+	if err := ctx.Err(); err != nil {
+		progress.Status = BulkStatusFailed
+		progress.Error = fmt.Sprintf("stopped after %d of %d sessions: %s", progress.Processed, job.Total, err)
+	}
+	progress.CompletedAt = sql.NullInt64{Int64: time.Now().UnixMilli(), Valid: true}
+	// The job context may be done, the outcome is recorded regardless
+	s.updateBulkJob(context.WithoutCancel(ctx), job.ID, progress, failures)
+	slog.Info("Bulk session job done", "job_id", job.ID, "action", job.Action, "status", progress.Status, "processed", progress.Processed, "failed", progress.Failed)
+}
+
+// tagSession adds tags to the tags of sess.
+func (s *service) tagSession(ctx context.Context, sess postgres.Session, tags []string) error {
+	var current []string
+	if sess.Tags != "" {
+		if err := json.Unmarshal([]byte(sess.Tags), &current); err != nil {
+			return fmt.Errorf("failed to read the tags: %w", err)
+		}
+	}
+	for _, tag := range tags {
+		if !slices.Contains(current, tag) {
+			current = append(current, tag)
+		}
+	}
+	if len(current) > MaxSessionTags {
+		return fmt.Errorf("a session has at most %d tags", MaxSessionTags)
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	return s.q.SetSessionTags(ctx, postgres.SetSessionTagsParams{ID: sess.ID, Tags: string(data)})
+}
+
+// sessionCleanup counts what deleting sessions removes, or would remove.
+type sessionCleanup struct {
+	sessions  int
+	messages  int
+	redisKeys int
+	objects   int
+}
+
+func (c *sessionCleanup) add(other sessionCleanup) {
+	c.sessions += other.sessions
+	c.messages += other.messages
+	c.redisKeys += other.redisKeys
+	c.objects += other.objects
+}
+
+// deleteSession deletes a session with its child sessions, e.g. the ones of
+// sub-agents, and their state in Redis and object storage. Messages, file
+// history, tool calls and the other rows of a session cascade from it. A dry
+// run only counts what would be removed.
+func (s *service) deleteSession(ctx context.Context, sess postgres.Session, dryRun bool) (sessionCleanup, error) {
+	var cleanup sessionCleanup
+	children, err := s.q.ListChildSessions(ctx, sql.NullString{String: sess.ID, Valid: true})
+	if err != nil {
+		return cleanup, fmt.Errorf("failed to list child sessions: %w", err)
+	}
+	for _, child := range children {
+		childCleanup, err := s.deleteSession(ctx, child, dryRun)
+		cleanup.add(childCleanup)
+		if err != nil {
+			return cleanup, err
+		}
+	}
+
+	msgs, err := s.messages.List(ctx, sess.ID)
+	if err != nil {
+		return cleanup, fmt.Errorf("failed to list messages: %w", err)
+	}
+	var objects []string
+	for _, msg := range msgs {
+		for _, part := range msg.BinaryContent() {
+			if a := s.attachment(msg, "binary", part.Path, part.MIMEType); a.ObjectName != "" {
+				objects = append(objects, a.ObjectName)
+			}
+		}
+		for _, part := range msg.ImageURLContent() {
+			if a := s.attachment(msg, "image_url", part.URL, ""); a.ObjectName != "" {
+				objects = append(objects, a.ObjectName)
+			}
+		}
+	}
+
+	if dryRun {
+		cleanup.sessions++
+		cleanup.messages += len(msgs)
+		cleanup.objects += len(objects)
+		if s.keys != nil {
+			n, err := s.keys.CountSessionKeys(ctx, sess.ID)
+			if err != nil {
+				return cleanup, fmt.Errorf("failed to count Redis keys: %w", err)
+			}
+			cleanup.redisKeys += n
+		}
+		return cleanup, nil
+	}
+
+	for _, name := range objects {
+		if err := s.objects.RemoveObject(ctx, name); err != nil {
+			return cleanup, fmt.Errorf("failed to remove attachment %s: %w", name, err)
+		}
+		cleanup.objects++
+	}
+
+	if s.keys != nil {
+		n, err := s.keys.PurgeSessionKeys(ctx, sess.ID)
+		if err != nil {
+			return cleanup, fmt.Errorf("failed to purge Redis keys: %w", err)
+		}
+		cleanup.redisKeys += n
+	} else {
+		slog.Warn("Redis not configured, session keys are left to expire", "session_id", sess.ID)
+	}
+
+	if err := s.q.DeleteSession(ctx, sess.ID); err != nil {
+		return cleanup, fmt.Errorf("failed to delete session: %w", err)
+	}
+	cleanup.sessions++
+	cleanup.messages += len(msgs)
+	return cleanup, nil
+}
+
+func (s *service) updateBulkJob(ctx context.Context, jobID string, update postgres.UpdateSessionBulkJobParams, failures []BulkFailure) {
+	update.ID = jobID
+	update.Failures = "[]"
+	if len(failures) > 0 {
+		data, err := json.Marshal(failures)
+		if err != nil {
+			slog.Error("Failed to encode bulk job failures", "job_id", jobID, "error", err)
+		} else {
+			update.Failures = string(data)
+		}
+	}
+	if err := s.q.UpdateSessionBulkJob(ctx, update); err != nil {
+		slog.Error("Failed to update bulk session job", "job_id", jobID, "error", err)
+	}
+}
+
+func (s *service) GetBulkSessions(ctx context.Context, userID, jobID string) (BulkSessionJob, error) {
+	dbJob, err := s.q.GetSessionBulkJob(ctx, postgres.GetSessionBulkJobParams{
+		ID:     jobID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return BulkSessionJob{}, ErrBulkJobNotFound
+	}
+	if err != nil {
+		return BulkSessionJob{}, err
+	}
+	return bulkJobFromDB(dbJob), nil
+}
+
+func (s *service) ListBulkSessions(ctx context.Context, userID string) ([]BulkSessionJob, error) {
+	dbJobs, err := s.q.ListSessionBulkJobsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]BulkSessionJob, len(dbJobs))
+	for i, item := range dbJobs {
+		jobs[i] = bulkJobFromDB(item)
+	}
+	return jobs, nil
+}
+
+func bulkJobFromDB(item postgres.SessionBulkJob) BulkSessionJob {
+	job := BulkSessionJob{
+		ID:          item.ID,
+		UserID:      item.UserID,
+		Action:      item.Action,
+		Status:      item.Status,
+		Total:       int(item.Total),
+		Processed:   int(item.Processed),
+		Failed:      int(item.Failed),
+		Error:       item.Error,
+		CreatedAt:   item.CreatedAt,
+		CompletedAt: item.CompletedAt.Int64,
+	}
+	if err := json.Unmarshal([]byte(item.Failures), &job.Failures); err != nil && item.Failures != "" {
+		slog.Warn("Failed to decode bulk job failures", "job_id", item.ID, "error", err)
+	}
+	return job
+}
@@ -0,0 +1,38 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBulkRequest(t *testing.T) {
+	t.Parallel()
+
+	tags, err := validateBulkRequest(BulkSessionRequest{
+		Action:     BulkActionTag,
+		SessionIDs: []string{"s1"},
+		Tags:       []string{" release ", "release", "bug"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"release", "bug"}, tags)
+
+	_, err = validateBulkRequest(BulkSessionRequest{Action: BulkActionDelete, Filter: &SessionFilter{ProjectID: "p1"}})
+	require.NoError(t, err)
+
+	invalid := []BulkSessionRequest{
+		{Action: "rename", SessionIDs: []string{"s1"}},
+		{Action: BulkActionArchive},
+		{Action: BulkActionArchive, SessionIDs: []string{"s1"}, Filter: &SessionFilter{}},
+		{Action: BulkActionArchive, Filter: &SessionFilter{Archived: "yes"}},
+		{Action: BulkActionTag, SessionIDs: []string{"s1"}},
+		{Action: BulkActionTag, SessionIDs: []string{"s1"}, Tags: []string{" "}},
+	}
+	for _, req := range invalid {
+		_, err := validateBulkRequest(req)
+		require.ErrorIs(t, err, ErrInvalidBulkRequest, "%+v", req)
+	}
+
+	_, err = validateBulkRequest(BulkSessionRequest{Action: BulkActionDelete, SessionIDs: make([]string, MaxBulkSessions+1)})
+	require.ErrorIs(t, err, ErrTooManySessions)
+}
@@ -0,0 +1,354 @@
+// Package analytics aggregates the tokens, cost, tool calls, run durations and
+// ratings of the agent by day, user, project and model. A background job rolls
+// the model usage, the tool audit log, the turn timelines and the message
+// feedback up by day, the queries only read these rollups.
+package analytics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// GroupBy is the dimension the rollups are aggregated by.
+type GroupBy string
+
+const (
+	GroupByDay     GroupBy = "day"
+	GroupByUser    GroupBy = "user"
+	GroupByProject GroupBy = "project"
+	GroupByModel   GroupBy = "model"
+	GroupByTool    GroupBy = "tool"
+	// GroupByCategory groups ratings by their reason.
+	GroupByCategory GroupBy = "category"
+)
+
+const (
+	day = 24 * time.Hour
+	// DefaultRange is the period aggregated when a query has no start.
+	DefaultRange = 30 * day
+	// dayFormat is the key of the days.
+	dayFormat = "2006-01-02"
+)
+
+// ErrInvalidQuery is returned for unknown dimensions and bad time ranges.
+var ErrInvalidQuery = errors.New("invalid analytics query")
+
+// Query selects the rollups to aggregate. The time range is rounded to whole
+// UTC days.
+type Query struct {
+	// UserID restricts the query to the projects of a user, empty for the
+	// whole instance.
+	UserID    string
+	ProjectID string
+	Since     int64 // Unix milliseconds, inclusive, DefaultRange before Until when 0
+	Until     int64 // Unix milliseconds, exclusive, now when 0
+	GroupBy   GroupBy
+}
+
+// Usage is the model usage of a group.
+type Usage struct {
+	Key                 string  `json:"key"`
+	Requests            int64   `json:"requests"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	Cost                float64 `json:"cost"`
+}
+
+// ToolUsage is the tool calls of a group.
+type ToolUsage struct {
+	Key           string `json:"key"`
+	Calls         int64  `json:"calls"`
+	Errors        int64  `json:"errors"`
+	DurationMs    int64  `json:"duration_ms"`
+	AvgDurationMs int64  `json:"avg_duration_ms"`
+}
+
+// Runs is the agent turns of a group.
+type Runs struct {
+	Key     string `json:"key"`
+	Runs    int64  `json:"runs"`
+	TotalMs int64  `json:"total_ms"`
+	ModelMs int64  `json:"model_ms"`
+	ToolMs  int64  `json:"tool_ms"`
+	AvgMs   int64  `json:"avg_ms"`
+	MaxMs   int64  `json:"max_ms"`
+}
+
+// Feedback is the ratings of the answers of the agent in a group.
+type Feedback struct {
+	Key  string `json:"key"`
+	Up   int64  `json:"up"`
+	Down int64  `json:"down"`
+	// DownRate is the share of the ratings that are thumbs down.
+	DownRate float64 `json:"down_rate"`
+}
+
+type Service interface {
+	// Usage aggregates the tokens and cost of the model requests by day,
+	// user, project or model.
+	Usage(ctx context.Context, query Query) ([]Usage, error)
+	// Tools aggregates the tool calls by day, user, project or tool.
+	Tools(ctx context.Context, query Query) ([]ToolUsage, error)
+	// Runs aggregates the durations of the agent turns by day, user or project.
+	Runs(ctx context.Context, query Query) ([]Runs, error)
+	// Feedback aggregates the ratings of the answers by day, user, project,
+	// model or category.
+	Feedback(ctx context.Context, query Query) ([]Feedback, error)
+	// Rollup recomputes the rollups from the day before the last rolled up
+	// one, every day the first time.
+	Rollup(ctx context.Context) error
+}
+
+type service struct {
+	q   postgres.Querier
+	now func() time.Time
+}
+
+// NewService creates the analytics service.
+func NewService(q postgres.Querier) Service {
+	return &service{q: q, now: time.Now}
+}
+
+// RunRollups rolls the analytics up every interval until ctx is done. A zero
+// interval disables the rollups.
+func RunRollups(ctx context.Context, s Service, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Rollup(ctx); err != nil {
+			slog.Warn("Failed to roll up analytics", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *service) Rollup(ctx context.Context) error {
+	latest, err := s.q.GetLatestUsageRollupDay(ctx)
+	if err != nil {
+		return err
+	}
+	// Late records, e.g. of turns running over midnight, land in the day before
+	since := max(latest-day.Milliseconds(), 0)
+	start := time.Now()
+	if err := s.q.RollupModelUsage(ctx, since); err != nil {
+		return err
+	}
+	if err := s.q.RollupToolUsage(ctx, since); err != nil {
+		return err
+	}
+	if err := s.q.RollupRuns(ctx, since); err != nil {
+		return err
+	}
+	if err := s.q.DeleteFeedbackRollupsSince(ctx, since); err != nil {
+		return err
+	}
+	if err := s.q.RollupFeedback(ctx, since); err != nil {
+		return err
+	}
+	slog.Debug("Rolled up analytics", "since", time.UnixMilli(since).UTC().Format(dayFormat), "elapsed", time.Since(start))
+	return nil
+}
+
+// bounds returns the day range of a query.
+func (s *service) bounds(query Query, dims ...GroupBy) (since, until int64, err error) {
+	if !slices.Contains(dims, query.GroupBy) || query.Since < 0 || query.Until < 0 {
+		return 0, 0, ErrInvalidQuery
+	}
+	until = query.Until
+	if until == 0 {
+		until = s.now().UnixMilli()
+	}
+	since = query.Since
+	if since == 0 {
+		since = until - DefaultRange.Milliseconds()
+	}
+	if until <= since {
+		return 0, 0, ErrInvalidQuery
+	}
+	// Whole days, the one until falls in included
+	return truncateDay(since), truncateDay(until + day.Milliseconds() - 1), nil
+}
+
+func truncateDay(ms int64) int64 {
+	return ms - ms%day.Milliseconds()
+}
+
+// key returns the group of a rollup row.
+func key(groupBy GroupBy, dayStart int64, userID, projectID, other string) string {
+	switch groupBy {
+	case GroupByDay:
+		return time.UnixMilli(dayStart).UTC().Format(dayFormat)
+	case GroupByUser:
+		return userID
+	case GroupByProject:
+		return projectID
+	}
+	return other
+}
+
+// groups accumulates rows by key, in the order of the keys.
+type groups[T any] struct {
+	keys []string
+	rows map[string]*T
+}
+
+func (g *groups[T]) get(key string, init func(string) T) *T {
+	if g.rows == nil {
+		g.rows = make(map[string]*T)
+	}
+	row, ok := g.rows[key]
+	if !ok {
+		v := init(key)
+		row = &v
+		g.rows[key] = row
+		g.keys = append(g.keys, key)
+	}
+	return row
+}
+
+func (g *groups[T]) sorted() []T {
+	slices.Sort(g.keys)
+	out := make([]T, 0, len(g.keys))
+	for _, k := range g.keys {
+		out = append(out, *g.rows[k])
+	}
+	return out
+}
+
+func (s *service) Usage(ctx context.Context, query Query) ([]Usage, error) {
+	since, until, err := s.bounds(query, GroupByDay, GroupByUser, GroupByProject, GroupByModel)
+	if err != nil {
+		return nil, err
+	}
+	// Rollups are read from the replica when one is configured, its lag does
+	// not show in daily aggregates
+	rows, err := s.q.ListUsageRollups(postgres.WithReplica(ctx), postgres.ListUsageRollupsParams{
+		UserID:    query.UserID,
+		ProjectID: query.ProjectID,
+		DayAfter:  since,
+		DayBefore: until,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var g groups[Usage]
+	for _, r := range rows {
+		model := r.Model
+		if r.Provider != "" {
+			model = r.Provider + "/" + r.Model
+		}
+		u := g.get(key(query.GroupBy, r.Day, r.UserID, r.ProjectID, model), func(k string) Usage { return Usage{Key: k} })
+		u.Requests += int64(r.Requests)
+		u.InputTokens += r.InputTokens
+		u.OutputTokens += r.OutputTokens
+		u.CacheCreationTokens += r.CacheCreationTokens
+		u.CacheReadTokens += r.CacheReadTokens
+		u.Cost += r.Cost
+	}
+	return g.sorted(), nil
+}
+
+func (s *service) Tools(ctx context.Context, query Query) ([]ToolUsage, error) {
+	since, until, err := s.bounds(query, GroupByDay, GroupByUser, GroupByProject, GroupByTool)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.q.ListToolUsageRollups(postgres.WithReplica(ctx), postgres.ListToolUsageRollupsParams{
+		UserID:    query.UserID,
+		ProjectID: query.ProjectID,
+		DayAfter:  since,
+		DayBefore: until,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var g groups[ToolUsage]
+	for _, r := range rows {
+		t := g.get(key(query.GroupBy, r.Day, r.UserID, r.ProjectID, r.ToolName), func(k string) ToolUsage { return ToolUsage{Key: k} })
+		t.Calls += int64(r.Calls)
+		t.Errors += int64(r.Errors)
+		t.DurationMs += r.DurationMs
+	}
+	usage := g.sorted()
+	for i := range usage {
+		usage[i].AvgDurationMs = usage[i].DurationMs / max(usage[i].Calls, 1)
+	}
+	return usage, nil
+}
+
+func (s *service) Runs(ctx context.Context, query Query) ([]Runs, error) {
+	since, until, err := s.bounds(query, GroupByDay, GroupByUser, GroupByProject)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.q.ListRunRollups(postgres.WithReplica(ctx), postgres.ListRunRollupsParams{
+		UserID:    query.UserID,
+		ProjectID: query.ProjectID,
+		DayAfter:  since,
+		DayBefore: until,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var g groups[Runs]
+	for _, r := range rows {
+		run := g.get(key(query.GroupBy, r.Day, r.UserID, r.ProjectID, ""), func(k string) Runs { return Runs{Key: k} })
+		run.Runs += int64(r.Runs)
+		run.TotalMs += r.TotalMs
+		run.ModelMs += r.ModelMs
+		run.ToolMs += r.ToolMs
+		run.MaxMs = max(run.MaxMs, r.MaxMs)
+	}
+	runs := g.sorted()
+	for i := range runs {
+		runs[i].AvgMs = runs[i].TotalMs / max(runs[i].Runs, 1)
+	}
+	return runs, nil
+}
+
+func (s *service) Feedback(ctx context.Context, query Query) ([]Feedback, error) {
+	since, until, err := s.bounds(query, GroupByDay, GroupByUser, GroupByProject, GroupByModel, GroupByCategory)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.q.ListFeedbackRollups(postgres.WithReplica(ctx), postgres.ListFeedbackRollupsParams{
+		UserID:    query.UserID,
+		ProjectID: query.ProjectID,
+		DayAfter:  since,
+		DayBefore: until,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var g groups[Feedback]
+	for _, r := range rows {
+		other := r.Model
+		if query.GroupBy == GroupByCategory {
+			other = r.Category
+		}
+		f := g.get(key(query.GroupBy, r.Day, r.UserID, r.ProjectID, other), func(k string) Feedback { return Feedback{Key: k} })
+		f.Up += int64(r.Up)
+		f.Down += int64(r.Down)
+	}
+	feedback := g.sorted()
+	for i := range feedback {
+		if total := feedback[i].Up + feedback[i].Down; total > 0 {
+			feedback[i].DownRate = float64(feedback[i].Down) / float64(total)
+		}
+	}
+	return feedback, nil
+}
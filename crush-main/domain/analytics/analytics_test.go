@@ -0,0 +1,124 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRollups serves fixed rollups and records the listed range.
+type fakeRollups struct {
+	postgres.Querier
+	usage    []postgres.UsageRollup
+	runs     []postgres.RunRollup
+	feedback []postgres.FeedbackRollup
+	params   postgres.ListUsageRollupsParams
+}
+
+func (f *fakeRollups) ListUsageRollups(_ context.Context, arg postgres.ListUsageRollupsParams) ([]postgres.UsageRollup, error) {
+	f.params = arg
+	return f.usage, nil
+}
+
+func (f *fakeRollups) ListRunRollups(_ context.Context, _ postgres.ListRunRollupsParams) ([]postgres.RunRollup, error) {
+	return f.runs, nil
+}
+
+func (f *fakeRollups) ListFeedbackRollups(_ context.Context, _ postgres.ListFeedbackRollupsParams) ([]postgres.FeedbackRollup, error) {
+	return f.feedback, nil
+}
+
+func dayOf(date string) int64 {
+	t, _ := time.Parse(dayFormat, date)
+	return t.UnixMilli()
+}
+
+func TestUsageGroups(t *testing.T) {
+	q := &fakeRollups{usage: []postgres.UsageRollup{
+		{Day: dayOf("2026-03-01"), UserID: "u1", ProjectID: "p1", Provider: "anthropic", Model: "sonnet", Requests: 2, InputTokens: 100, Cost: 1},
+		{Day: dayOf("2026-03-01"), UserID: "u1", ProjectID: "p2", Provider: "openai", Model: "gpt", Requests: 1, InputTokens: 50, Cost: 0.5},
+		{Day: dayOf("2026-03-02"), UserID: "u1", ProjectID: "p1", Provider: "anthropic", Model: "sonnet", Requests: 3, InputTokens: 200, Cost: 2},
+	}}
+	s := NewService(q)
+
+	byModel, err := s.Usage(t.Context(), Query{UserID: "u1", GroupBy: GroupByModel})
+	require.NoError(t, err)
+	require.Len(t, byModel, 2)
+	assert.Equal(t, Usage{Key: "anthropic/sonnet", Requests: 5, InputTokens: 300, Cost: 3}, byModel[0])
+	assert.Equal(t, "openai/gpt", byModel[1].Key)
+
+	byDay, err := s.Usage(t.Context(), Query{UserID: "u1", GroupBy: GroupByDay})
+	require.NoError(t, err)
+	require.Len(t, byDay, 2)
+	assert.Equal(t, "2026-03-01", byDay[0].Key)
+	assert.Equal(t, int64(3), byDay[0].Requests)
+
+	byProject, err := s.Usage(t.Context(), Query{UserID: "u1", GroupBy: GroupByProject})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p1", "p2"}, []string{byProject[0].Key, byProject[1].Key})
+}
+
+func TestQueryBounds(t *testing.T) {
+	q := &fakeRollups{}
+	s := &service{q: q, now: func() time.Time { return time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC) }}
+
+	_, err := s.Usage(t.Context(), Query{GroupBy: GroupByDay})
+	require.NoError(t, err)
+	assert.Equal(t, dayOf("2026-02-08"), q.params.DayAfter, "the default range is 30 days")
+	assert.Equal(t, dayOf("2026-03-11"), q.params.DayBefore, "the current day is included")
+
+	_, err = s.Usage(t.Context(), Query{GroupBy: GroupByDay, Since: dayOf("2026-03-01") + 1000, Until: dayOf("2026-03-05")})
+	require.NoError(t, err)
+	assert.Equal(t, dayOf("2026-03-01"), q.params.DayAfter)
+	assert.Equal(t, dayOf("2026-03-05"), q.params.DayBefore)
+
+	for name, query := range map[string]Query{
+		"unknown dimension": {GroupBy: "week"},
+		"tool runs":         {GroupBy: GroupByTool},
+		"empty range":       {GroupBy: GroupByDay, Since: 2000, Until: 1000},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.Runs(t.Context(), query)
+			require.ErrorIs(t, err, ErrInvalidQuery)
+		})
+	}
+}
+
+func TestRunsAverages(t *testing.T) {
+	q := &fakeRollups{runs: []postgres.RunRollup{
+		{Day: dayOf("2026-03-01"), UserID: "u1", ProjectID: "p1", Runs: 2, TotalMs: 3000, MaxMs: 2000},
+		{Day: dayOf("2026-03-02"), UserID: "u1", ProjectID: "p1", Runs: 2, TotalMs: 1000, MaxMs: 600},
+	}}
+	runs, err := NewService(q).Runs(t.Context(), Query{UserID: "u1", GroupBy: GroupByUser})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, Runs{Key: "u1", Runs: 4, TotalMs: 4000, AvgMs: 1000, MaxMs: 2000}, runs[0])
+}
+
+func TestFeedbackGroups(t *testing.T) {
+	q := &fakeRollups{feedback: []postgres.FeedbackRollup{
+		{Day: dayOf("2026-03-01"), UserID: "u1", ProjectID: "p1", Model: "sonnet", Up: 3},
+		{Day: dayOf("2026-03-01"), UserID: "u1", ProjectID: "p1", Model: "sonnet", Category: "incorrect", Down: 1},
+		{Day: dayOf("2026-03-02"), UserID: "u1", ProjectID: "p1", Model: "gpt", Category: "incorrect", Down: 2},
+	}}
+	s := NewService(q)
+
+	byModel, err := s.Feedback(t.Context(), Query{UserID: "u1", GroupBy: GroupByModel})
+	require.NoError(t, err)
+	assert.Equal(t, []Feedback{
+		{Key: "gpt", Down: 2, DownRate: 1},
+		{Key: "sonnet", Up: 3, Down: 1, DownRate: 0.25},
+	}, byModel)
+
+	byCategory, err := s.Feedback(t.Context(), Query{UserID: "u1", GroupBy: GroupByCategory})
+	require.NoError(t, err)
+	require.Len(t, byCategory, 2)
+	assert.Equal(t, Feedback{Key: "incorrect", Down: 3, DownRate: 1}, byCategory[1])
+
+	_, err = s.Usage(t.Context(), Query{GroupBy: GroupByCategory})
+	require.ErrorIs(t, err, ErrInvalidQuery, "only ratings have categories")
+}
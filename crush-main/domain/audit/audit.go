@@ -0,0 +1,193 @@
+// Package audit records every tool call run by the agent, for compliance
+// review of what it did to a workspace. An entry holds the tool, a hash of
+// its input, how its permission was decided, its duration and the size of its
+// result. Entries outlive their sessions and projects, they are only deleted
+// with the account of the user.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+)
+
+// PermissionNotRequired is the permission of the tool calls that asked for none.
+const PermissionNotRequired = "not_required"
+
+const (
+	// DefaultLimit is the number of entries listed when no limit is given.
+	DefaultLimit = 100
+	// MaxLimit bounds the number of entries listed at once.
+	MaxLimit = 1000
+)
+
+// ErrInvalidFilter is returned for filters without user or with a bad range.
+var ErrInvalidFilter = errors.New("invalid audit filter")
+
+// Entry is a tool call of the audit log.
+type Entry struct {
+	ID         string `json:"id"`
+	ToolCallID string `json:"tool_call_id"`
+	SessionID  string `json:"session_id"`
+	ProjectID  string `json:"project_id,omitempty"`
+	UserID     string `json:"user_id,omitempty"`
+	MessageID  string `json:"message_id,omitempty"`
+	ToolName   string `json:"tool_name"`
+	ParamsHash string `json:"params_hash"`
+	Permission string `json:"permission"`
+	DurationMs int64  `json:"duration_ms"`
+	ResultSize int64  `json:"result_size"`
+	IsError    bool   `json:"is_error"`
+	Error      string `json:"error,omitempty"`
+	CreatedAt  int64  `json:"created_at"` // Unix milliseconds
+}
+
+// Filter selects the entries of a user. Empty fields match everything.
+type Filter struct {
+	UserID    string
+	SessionID string
+	ProjectID string
+	ToolName  string
+	Since     int64 // Unix milliseconds, inclusive
+	Until     int64 // Unix milliseconds, exclusive
+	Limit     int
+	Offset    int
+}
+
+// HashParams returns the hash of the input of a tool call, which identifies
+// identical calls without keeping their content in the log.
+func HashParams(input string) string {
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
+
+type Service interface {
+	// Record adds a tool call to the log. The project and user are looked up
+	// from the session when not set.
+	Record(ctx context.Context, entry Entry) error
+	// List returns the entries matching the filter, oldest first.
+	List(ctx context.Context, filter Filter) ([]Entry, error)
+}
+
+// owner is the project and user of a session.
+type owner struct {
+	projectID string
+	userID    string
+}
+
+type service struct {
+	q postgres.Querier
+	// owners caches the owners of the sessions, which never change
+	owners *csync.Map[string, owner]
+}
+
+// NewService creates the audit service.
+func NewService(q postgres.Querier) Service {
+	return &service{q: q, owners: csync.NewMap[string, owner]()}
+}
+
+func (s *service) Record(ctx context.Context, entry Entry) error {
+	if entry.ProjectID == "" && entry.UserID == "" {
+		o, err := s.owner(ctx, entry.SessionID)
+		if err != nil {
+			return err
+		}
+		entry.ProjectID, entry.UserID = o.projectID, o.userID
+	}
+	if entry.Permission == "" {
+		entry.Permission = PermissionNotRequired
+	}
+	return s.q.CreateToolAuditEntry(ctx, postgres.CreateToolAuditEntryParams{
+		ID:         uuid.New().String(),
+		ToolCallID: entry.ToolCallID,
+		SessionID:  entry.SessionID,
+		ProjectID:  entry.ProjectID,
+		UserID:     sql.NullString{String: entry.UserID, Valid: entry.UserID != ""},
+		MessageID:  entry.MessageID,
+		ToolName:   entry.ToolName,
+		ParamsHash: entry.ParamsHash,
+		Permission: entry.Permission,
+		DurationMs: entry.DurationMs,
+		ResultSize: entry.ResultSize,
+		IsError:    entry.IsError,
+		Error:      entry.Error,
+	})
+}
+
+// owner returns the project and user of a session, empty for sessions
+// without project.
+func (s *service) owner(ctx context.Context, sessionID string) (owner, error) {
+	if o, ok := s.owners.Get(sessionID); ok {
+		return o, nil
+	}
+	sess, err := s.q.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		return owner{}, err
+	}
+	var o owner
+	if sess.ProjectID.Valid && sess.ProjectID.String != "" {
+		project, err := s.q.GetProjectByID(ctx, sess.ProjectID.String)
+		if err != nil {
+			return owner{}, err
+		}
+		o = owner{projectID: project.ID, userID: project.UserID}
+	}
+	s.owners.Set(sessionID, o)
+	return o, nil
+}
+
+func (s *service) List(ctx context.Context, filter Filter) ([]Entry, error) {
+	if filter.UserID == "" || filter.Since < 0 || filter.Until < 0 || filter.Offset < 0 ||
+		(filter.Until > 0 && filter.Until <= filter.Since) {
+		return nil, ErrInvalidFilter
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	rows, err := s.q.ListToolAuditEntries(ctx, postgres.ListToolAuditEntriesParams{
+		UserID:        sql.NullString{String: filter.UserID, Valid: true},
+		SessionID:     filter.SessionID,
+		ProjectID:     filter.ProjectID,
+		ToolName:      filter.ToolName,
+		CreatedAfter:  filter.Since,
+		CreatedBefore: filter.Until,
+		Limit:         int32(limit),
+		Offset:        int32(filter.Offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, len(rows))
+	for i, row := range rows {
+		entries[i] = fromDB(row)
+	}
+	return entries, nil
+}
+
+func fromDB(e postgres.ToolAuditLog) Entry {
+	return Entry{
+		ID:         e.ID,
+		ToolCallID: e.ToolCallID,
+		SessionID:  e.SessionID,
+		ProjectID:  e.ProjectID,
+		UserID:     e.UserID.String,
+		MessageID:  e.MessageID,
+		ToolName:   e.ToolName,
+		ParamsHash: e.ParamsHash,
+		Permission: e.Permission,
+		DurationMs: e.DurationMs,
+		ResultSize: e.ResultSize,
+		IsError:    e.IsError,
+		Error:      e.Error,
+		CreatedAt:  e.CreatedAt,
+	}
+}
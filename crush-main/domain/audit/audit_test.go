@@ -0,0 +1,29 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashParams(t *testing.T) {
+	hash := HashParams(`{"command":"ls"}`)
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashParams(`{"command":"ls"}`))
+	assert.NotEqual(t, hash, HashParams(`{"command":"rm -rf /"}`))
+}
+
+func TestListInvalidFilter(t *testing.T) {
+	s := NewService(nil)
+	for name, filter := range map[string]Filter{
+		"without user":    {},
+		"negative offset": {UserID: "u1", Offset: -1},
+		"empty range":     {UserID: "u1", Since: 2000, Until: 1000},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.List(t.Context(), filter)
+			require.ErrorIs(t, err, ErrInvalidFilter)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Package budget enforces hard limits on the cost and tokens spent by the
+// agent. Limits are set per session, project and user; a turn is refused, or
+// stopped between steps, once the usage of any of them reaches its limit.
+// Limits stored for a scope override the configured defaults.
+package budget
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// Scope is what a budget applies to.
+type Scope string
+
+const (
+	// ScopeSession covers a session and its agent tool sessions.
+	ScopeSession Scope = "session"
+	// ScopeProject covers the sessions of a project.
+	ScopeProject Scope = "project"
+	// ScopeUser covers the sessions of all projects of a user.
+	ScopeUser Scope = "user"
+)
+
+var (
+	// ErrExceeded is returned when the usage reached the limit of a budget.
+	ErrExceeded = errors.New("budget exceeded")
+	// ErrInvalidLimit is returned for negative limits.
+	ErrInvalidLimit = errors.New("budget limits must not be negative")
+	// ErrNotFound is returned when the session of a check does not exist.
+	ErrNotFound = errors.New("session not found")
+)
+
+// Limit bounds the usage of a scope, zero values mean unlimited.
+type Limit struct {
+	MaxCost   float64 `json:"max_cost"`
+	MaxTokens int64   `json:"max_tokens"`
+}
+
+// Unlimited reports whether the limit bounds nothing.
+func (l Limit) Unlimited() bool {
+	return l.MaxCost <= 0 && l.MaxTokens <= 0
+}
+
+// Defaults are the limits of the scopes without stored limits.
+type Defaults struct {
+	Session Limit
+	Project Limit
+	User    Limit
+}
+
+func (d Defaults) of(scope Scope) Limit {
+	switch scope {
+	case ScopeSession:
+		return d.Session
+	case ScopeProject:
+		return d.Project
+	case ScopeUser:
+		return d.User
+	}
+	return Limit{}
+}
+
+// Budget is the limit of a scope.
+type Budget struct {
+	Scope   Scope  `json:"scope"`
+	ScopeID string `json:"scope_id"`
+	Limit
+	// Default is true when no limit is stored and the configured one applies.
+	Default   bool  `json:"default"`
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
+
+// Status is a budget with the usage it bounds.
+type Status struct {
+	Budget
+	Cost   float64 `json:"cost"`
+	Tokens int64   `json:"tokens"`
+}
+
+// Exceeded reports whether the usage reached the limit.
+func (s Status) Exceeded() bool {
+	return (s.MaxCost > 0 && s.Cost >= s.MaxCost) || (s.MaxTokens > 0 && s.Tokens >= s.MaxTokens)
+}
+
+// ExceededError is returned by Enforce with the first exceeded budget.
+type ExceededError struct {
+	Status Status
+}
+
+func (e *ExceededError) Error() string {
+	s := e.Status
+	var over []string
+	if s.MaxCost > 0 && s.Cost >= s.MaxCost {
+		over = append(over, fmt.Sprintf("$%.4f of $%.4f spent", s.Cost, s.MaxCost))
+	}
+	if s.MaxTokens > 0 && s.Tokens >= s.MaxTokens {
+		over = append(over, fmt.Sprintf("%d of %d tokens used", s.Tokens, s.MaxTokens))
+	}
+	return fmt.Sprintf("%s budget exceeded: %s", s.Scope, strings.Join(over, ", "))
+}
+
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrExceeded
+}
+
+type Service interface {
+	// Get returns the budget of a scope, the default one when none is stored.
+	Get(ctx context.Context, scope Scope, scopeID string) (Budget, error)
+	// Set stores the limit of a scope.
+	Set(ctx context.Context, scope Scope, scopeID string, limit Limit) (Budget, error)
+	// Delete removes the stored limit of a scope, the default applies again.
+	Delete(ctx context.Context, scope Scope, scopeID string) error
+	// Check returns the session, project and user budgets of a session with
+	// their usage. Scopes the session does not belong to are left out.
+	Check(ctx context.Context, sessionID string) ([]Status, error)
+	// Enforce returns an *ExceededError when a budget of the session is exceeded.
+	Enforce(ctx context.Context, sessionID string) error
+}
+
+type service struct {
+	q        postgres.Querier
+	defaults Defaults
+}
+
+// NewService creates the budget service.
+func NewService(q postgres.Querier, defaults Defaults) Service {
+	return &service{q: q, defaults: defaults}
+}
+
+func (s *service) Get(ctx context.Context, scope Scope, scopeID string) (Budget, error) {
+	dbBudget, err := s.q.GetBudget(ctx, postgres.GetBudgetParams{Scope: string(scope), ScopeID: scopeID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Budget{Scope: scope, ScopeID: scopeID, Limit: s.defaults.of(scope), Default: true}, nil
+	}
+	if err != nil {
+		return Budget{}, err
+	}
+	return fromDB(dbBudget), nil
+}
+
+func (s *service) Set(ctx context.Context, scope Scope, scopeID string, limit Limit) (Budget, error) {
+	if limit.MaxCost < 0 || limit.MaxTokens < 0 {
+		return Budget{}, ErrInvalidLimit
+	}
+	dbBudget, err := s.q.UpsertBudget(ctx, postgres.UpsertBudgetParams{
+		Scope:     string(scope),
+		ScopeID:   scopeID,
+		MaxCost:   limit.MaxCost,
+		MaxTokens: limit.MaxTokens,
+	})
+	if err != nil {
+		return Budget{}, err
+	}
+	return fromDB(dbBudget), nil
+}
+
+func (s *service) Delete(ctx context.Context, scope Scope, scopeID string) error {
+	_, err := s.q.DeleteBudget(ctx, postgres.DeleteBudgetParams{Scope: string(scope), ScopeID: scopeID})
+	return err
+}
+
+func (s *service) Check(ctx context.Context, sessionID string) ([]Status, error) {
+	usage, err := s.q.GetSessionBudgetUsage(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []struct {
+		scope  Scope
+		id     string
+		cost   float64
+		tokens int64
+	}{
+		{ScopeSession, sessionID, usage.SessionCost, usage.SessionTokens},
+		{ScopeProject, usage.ProjectID, usage.ProjectCost, usage.ProjectTokens},
+		{ScopeUser, usage.UserID, usage.UserCost, usage.UserTokens},
+	}
+	statuses := make([]Status, 0, len(scopes))
+	for _, sc := range scopes {
+		if sc.id == "" {
+			continue
+		}
+		b, err := s.Get(ctx, sc.scope, sc.id)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, Status{Budget: b, Cost: sc.cost, Tokens: sc.tokens})
+	}
+	return statuses, nil
+}
+
+func (s *service) Enforce(ctx context.Context, sessionID string) error {
+	statuses, err := s.Check(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	return exceeded(statuses)
+}
+
+// exceeded returns an *ExceededError for the first exceeded budget.
+func exceeded(statuses []Status) error {
+	for _, st := range statuses {
+		if st.Exceeded() {
+			return &ExceededError{Status: st}
+		}
+	}
+	return nil
+}
+
+func fromDB(b postgres.Budget) Budget {
+	return Budget{
+		Scope:     Scope(b.Scope),
+		ScopeID:   b.ScopeID,
+		Limit:     Limit{MaxCost: b.MaxCost, MaxTokens: b.MaxTokens},
+		UpdatedAt: b.UpdatedAt,
+	}
+}
@@ -0,0 +1,32 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusExceeded(t *testing.T) {
+	assert.False(t, Status{Cost: 100, Tokens: 1_000_000}.Exceeded(), "unlimited")
+	assert.False(t, Status{Budget: Budget{Limit: Limit{MaxCost: 1}}, Cost: 0.99}.Exceeded())
+	assert.True(t, Status{Budget: Budget{Limit: Limit{MaxCost: 1}}, Cost: 1}.Exceeded())
+	assert.True(t, Status{Budget: Budget{Limit: Limit{MaxCost: 1, MaxTokens: 10}}, Cost: 0.5, Tokens: 12}.Exceeded())
+}
+
+func TestExceeded(t *testing.T) {
+	statuses := []Status{
+		{Budget: Budget{Scope: ScopeSession, Limit: Limit{MaxTokens: 100}}, Tokens: 50},
+		{Budget: Budget{Scope: ScopeProject, Limit: Limit{MaxCost: 2}}, Cost: 2.5},
+		{Budget: Budget{Scope: ScopeUser, Limit: Limit{MaxCost: 1}}, Cost: 2.5},
+	}
+	require.NoError(t, exceeded(statuses[:1]))
+
+	err := exceeded(statuses)
+	require.ErrorIs(t, err, ErrExceeded)
+	var exceededErr *ExceededError
+	require.True(t, errors.As(err, &exceededErr))
+	assert.Equal(t, ScopeProject, exceededErr.Status.Scope)
+	assert.Equal(t, "project budget exceeded: $2.5000 of $2.0000 spent", err.Error())
+}
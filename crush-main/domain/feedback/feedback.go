@@ -0,0 +1,196 @@
+// Package feedback records how users rate the answers of the agent, thumbs up
+// or down with a reason, so that failing answers show up in the metrics and
+// the analytics.
+package feedback
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/internal/event"
+)
+
+// Rating is a thumbs up or down.
+type Rating string
+
+const (
+	RatingUp   Rating = "up"
+	RatingDown Rating = "down"
+)
+
+// Categories are the reasons of a rating, an empty category is allowed.
+var Categories = []string{
+	"incorrect",
+	"incomplete",
+	"instructions_ignored",
+	"too_slow",
+	"unsafe",
+	"other",
+}
+
+const (
+	// MaxCommentLength bounds the free text of a rating, in characters.
+	MaxCommentLength = 2000
+	// metricsBucket is the resolution of the metrics rollups.
+	metricsBucket = 5 * time.Minute
+)
+
+var (
+	// ErrNotFound is returned when the rated message does not exist.
+	ErrNotFound = errors.New("message not found")
+	// ErrNotAssistant is returned when the rated message is not an answer of
+	// the agent.
+	ErrNotAssistant = errors.New("only assistant messages can be rated")
+	// ErrInvalidRating is returned for ratings other than up and down.
+	ErrInvalidRating = errors.New(`rating must be "up" or "down"`)
+	// ErrInvalidCategory is returned for unknown categories.
+	ErrInvalidCategory = fmt.Errorf("category must be one of %s", strings.Join(Categories, ", "))
+	// ErrInvalidComment is returned for oversized comments.
+	ErrInvalidComment = fmt.Errorf("comment must be at most %d characters", MaxCommentLength)
+)
+
+// Feedback is the rating of a message by a user.
+type Feedback struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id"`
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	Rating    Rating `json:"rating"`
+	Category  string `json:"category,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	CreatedAt int64  `json:"created_at"` // Unix milliseconds
+	UpdatedAt int64  `json:"updated_at"` // Unix milliseconds
+}
+
+// Submission is a rating given by a user.
+type Submission struct {
+	MessageID string
+	UserID    string
+	Rating    Rating
+	Category  string
+	Comment   string
+}
+
+type Service interface {
+	// Submit records the rating of an assistant message by a user, replacing
+	// the previous rating of the user.
+	Submit(ctx context.Context, submission Submission) (Feedback, error)
+}
+
+type service struct {
+	q postgres.Querier
+}
+
+func NewService(q postgres.Querier) Service {
+	return &service{q: q}
+}
+
+func (s *service) Submit(ctx context.Context, submission Submission) (Feedback, error) {
+	if submission.Rating != RatingUp && submission.Rating != RatingDown {
+		return Feedback{}, ErrInvalidRating
+	}
+	category := strings.TrimSpace(submission.Category)
+	if category != "" && !slices.Contains(Categories, category) {
+		return Feedback{}, ErrInvalidCategory
+	}
+	comment := strings.TrimSpace(submission.Comment)
+	if utf8.RuneCountInString(comment) > MaxCommentLength {
+		return Feedback{}, ErrInvalidComment
+	}
+
+	msg, err := s.q.GetMessage(ctx, submission.MessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Feedback{}, ErrNotFound
+	}
+	if err != nil {
+		return Feedback{}, err
+	}
+	if message.MessageRole(msg.Role) != message.Assistant {
+		return Feedback{}, ErrNotAssistant
+	}
+
+	previous, err := s.q.GetMessageFeedback(ctx, postgres.GetMessageFeedbackParams{
+		MessageID: msg.ID,
+		UserID:    submission.UserID,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Feedback{}, err
+	}
+	dbFeedback, err := s.q.UpsertMessageFeedback(ctx, postgres.UpsertMessageFeedbackParams{
+		ID:        uuid.New().String(),
+		MessageID: msg.ID,
+		SessionID: msg.SessionID,
+		UserID:    submission.UserID,
+		Rating:    string(submission.Rating),
+		Category:  category,
+		Comment:   comment,
+	})
+	if err != nil {
+		return Feedback{}, err
+	}
+
+	s.recordMetrics(ctx, msg.SessionID, Rating(previous.Rating), submission.Rating)
+	// The comment stays in the database, only whether there is one is sent
+	event.FeedbackGiven(
+		"session id", msg.SessionID,
+		"message id", msg.ID,
+		"provider", msg.Provider.String,
+		"model", msg.Model.String,
+		"rating", string(submission.Rating),
+		"category", category,
+		"has comment", comment != "",
+	)
+	return fromDB(dbFeedback), nil
+}
+
+// recordMetrics moves a rating of a session in the metrics rollups, from the
+// previous rating of the user if any.
+func (s *service) recordMetrics(ctx context.Context, sessionID string, previous, rating Rating) {
+	if previous == rating {
+		return
+	}
+	var up, down int32
+	switch previous {
+	case RatingUp:
+		up--
+	case RatingDown:
+		down--
+	}
+	if rating == RatingUp {
+		up++
+	} else {
+		down++
+	}
+	if err := s.q.AddFeedbackMetricsRollup(ctx, postgres.AddFeedbackMetricsRollupParams{
+		Bucket:       time.Now().Truncate(metricsBucket).UnixMilli(),
+		SessionID:    sessionID,
+		FeedbackUp:   up,
+		FeedbackDown: down,
+	}); err != nil {
+		slog.Warn("Failed to record feedback metrics", "session_id", sessionID, "error", err)
+	}
+}
+
+func fromDB(item postgres.MessageFeedback) Feedback {
+	return Feedback{
+		ID:        item.ID,
+		MessageID: item.MessageID,
+		SessionID: item.SessionID,
+		UserID:    item.UserID,
+		Rating:    Rating(item.Rating),
+		Category:  item.Category,
+		Comment:   item.Comment,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}
+}
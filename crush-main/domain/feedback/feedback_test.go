@@ -0,0 +1,110 @@
+package feedback
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQuerier keeps one rating per message and user, and records the metrics.
+type fakeQuerier struct {
+	postgres.Querier
+	messages map[string]postgres.Message
+	feedback map[string]postgres.MessageFeedback
+	metrics  []postgres.AddFeedbackMetricsRollupParams
+}
+
+func newFakeQuerier() *fakeQuerier {
+	return &fakeQuerier{
+		messages: map[string]postgres.Message{
+			"a1": {ID: "a1", SessionID: "s1", Role: "assistant"},
+			"u1": {ID: "u1", SessionID: "s1", Role: "user"},
+		},
+		feedback: map[string]postgres.MessageFeedback{},
+	}
+}
+
+func (q *fakeQuerier) GetMessage(_ context.Context, id string) (postgres.Message, error) {
+	msg, ok := q.messages[id]
+	if !ok {
+		return postgres.Message{}, sql.ErrNoRows
+	}
+	return msg, nil
+}
+
+func (q *fakeQuerier) GetMessageFeedback(_ context.Context, arg postgres.GetMessageFeedbackParams) (postgres.MessageFeedback, error) {
+	f, ok := q.feedback[arg.MessageID+"/"+arg.UserID]
+	if !ok {
+		return postgres.MessageFeedback{}, sql.ErrNoRows
+	}
+	return f, nil
+}
+
+func (q *fakeQuerier) UpsertMessageFeedback(_ context.Context, arg postgres.UpsertMessageFeedbackParams) (postgres.MessageFeedback, error) {
+	f := postgres.MessageFeedback{
+		ID:        arg.ID,
+		MessageID: arg.MessageID,
+		SessionID: arg.SessionID,
+		UserID:    arg.UserID,
+		Rating:    arg.Rating,
+		Category:  arg.Category,
+		Comment:   arg.Comment,
+	}
+	q.feedback[arg.MessageID+"/"+arg.UserID] = f
+	return f, nil
+}
+
+func (q *fakeQuerier) AddFeedbackMetricsRollup(_ context.Context, arg postgres.AddFeedbackMetricsRollupParams) error {
+	q.metrics = append(q.metrics, arg)
+	return nil
+}
+
+func TestSubmit(t *testing.T) {
+	q := newFakeQuerier()
+	s := NewService(q)
+
+	f, err := s.Submit(t.Context(), Submission{MessageID: "a1", UserID: "user", Rating: RatingDown, Category: " incorrect ", Comment: "wrong file"})
+	require.NoError(t, err)
+	assert.Equal(t, "s1", f.SessionID)
+	assert.Equal(t, "incorrect", f.Category)
+	require.Len(t, q.metrics, 1)
+	assert.Equal(t, int32(0), q.metrics[0].FeedbackUp)
+	assert.Equal(t, int32(1), q.metrics[0].FeedbackDown)
+
+	// Changing the rating moves it in the metrics
+	_, err = s.Submit(t.Context(), Submission{MessageID: "a1", UserID: "user", Rating: RatingUp})
+	require.NoError(t, err)
+	require.Len(t, q.metrics, 2)
+	assert.Equal(t, int32(1), q.metrics[1].FeedbackUp)
+	assert.Equal(t, int32(-1), q.metrics[1].FeedbackDown)
+
+	// Rating again the same way only updates the reason
+	_, err = s.Submit(t.Context(), Submission{MessageID: "a1", UserID: "user", Rating: RatingUp, Category: "other"})
+	require.NoError(t, err)
+	assert.Len(t, q.metrics, 2)
+}
+
+func TestSubmitInvalid(t *testing.T) {
+	s := NewService(newFakeQuerier())
+
+	for name, tc := range map[string]struct {
+		submission Submission
+		err        error
+	}{
+		"rating":    {Submission{MessageID: "a1", Rating: "meh"}, ErrInvalidRating},
+		"category":  {Submission{MessageID: "a1", Rating: RatingDown, Category: "rude"}, ErrInvalidCategory},
+		"comment":   {Submission{MessageID: "a1", Rating: RatingDown, Comment: strings.Repeat("a", MaxCommentLength+1)}, ErrInvalidComment},
+		"missing":   {Submission{MessageID: "nope", Rating: RatingUp}, ErrNotFound},
+		"user role": {Submission{MessageID: "u1", Rating: RatingUp}, ErrNotAssistant},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.Submit(t.Context(), tc.submission)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/internal/pkg/diff"
+)
+
+// SyncCursorLatest asks for the cursor of the latest change, so a new local
+// sync client only receives the edits made after it started.
+const SyncCursorLatest = "latest"
+
+// SyncChange is an agent edit of a project file, as sent to the companion
+// CLI that applies the edits to a local checkout.
+type SyncChange struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	// Path is relative to the project working directory, slash separated.
+	Path    string `json:"path"`
+	Version int64  `json:"version"`
+	// BaseSHA256 is the hash of the content the edit applies to, the empty
+	// content for a new file. A local file with another hash is a conflict.
+	BaseSHA256 string `json:"base_sha256"`
+	SHA256     string `json:"sha256"`
+	Content    string `json:"content"`
+	// Diff is the unified diff of the edit, for display.
+	Diff      string `json:"diff"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// SyncCursor is the position of a local sync client in the change feed of a
+// project: the time and ID of the last change it received.
+type SyncCursor struct {
+	CreatedAt int64
+	ID        string
+}
+
+// String encodes the cursor as sent to clients.
+func (c SyncCursor) String() string {
+	if c.CreatedAt == 0 && c.ID == "" {
+		return ""
+	}
+	return strconv.FormatInt(c.CreatedAt, 10) + ":" + c.ID
+}
+
+// ParseSyncCursor decodes a cursor, the empty cursor starts from the first change.
+func ParseSyncCursor(s string) (SyncCursor, error) {
+	if s == "" {
+		return SyncCursor{}, nil
+	}
+	createdAt, id, ok := strings.Cut(s, ":")
+	ms, err := strconv.ParseInt(createdAt, 10, 64)
+	if !ok || err != nil || id == "" {
+		return SyncCursor{}, fmt.Errorf("invalid sync cursor %q", s)
+	}
+	return SyncCursor{CreatedAt: ms, ID: id}, nil
+}
+
+// ContentSHA256 returns the hex SHA-256 of file content.
+func ContentSHA256(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// SyncPath returns the path of a file relative to the project working
+// directory, false when the file is outside of it.
+func SyncPath(workdir, file string) (string, bool) {
+	workdir = strings.TrimRight(workdir, "/")
+	if workdir == "" {
+		return "", false
+	}
+	rel, ok := strings.CutPrefix(path.Clean(file), workdir+"/")
+	if !ok || rel == "" {
+		return "", false
+	}
+	return rel, true
+}
+
+// NewSyncChange builds the change sent to local sync clients for an edit,
+// false when the file is outside of the project working directory.
+func NewSyncChange(workdir string, row postgres.ListProjectFileChangesRow) (SyncChange, bool) {
+	rel, ok := SyncPath(workdir, row.Path)
+	if !ok {
+		return SyncChange{}, false
+	}
+	base := row.BaseContent.String
+	unified, _, _ := diff.GenerateDiff(base, row.Content, rel)
+	return SyncChange{
+		ID:         row.ID,
+		SessionID:  row.SessionID,
+		Path:       rel,
+		Version:    row.Version,
+		BaseSHA256: ContentSHA256(base),
+		SHA256:     ContentSHA256(row.Content),
+		Content:    row.Content,
+		Diff:       unified,
+		CreatedAt:  row.CreatedAt,
+	}, true
+}
+
+// SyncPatch collapses the edits of each file into one unified diff, from its
+// content before the first edit to its content after the last one. The patch
+// bundle applies with git apply to a checkout synced up to the edits.
+func SyncPatch(workdir string, rows []postgres.ListProjectFileChangesRow) string {
+	type span struct {
+		base, content string
+	}
+	var order []string
+	spans := map[string]*span{}
+	for _, row := range rows {
+		rel, ok := SyncPath(workdir, row.Path)
+		if !ok {
+			continue
+		}
+		if s, ok := spans[rel]; ok {
+			s.content = row.Content
+			continue
+		}
+		order = append(order, rel)
+		spans[rel] = &span{base: row.BaseContent.String, content: row.Content}
+	}
+
+	var patch strings.Builder
+	for _, rel := range order {
+		s := spans[rel]
+		if s.base == s.content {
+			continue
+		}
+		unified, _, _ := diff.GenerateDiff(s.base, s.content, rel)
+		if s.base == "" {
+			// git apply creates files from /dev/null
+			unified = strings.Replace(unified, "--- a/"+rel+"\n", "--- /dev/null\n", 1)
+		}
+		patch.WriteString(unified)
+	}
+	return patch.String()
+}
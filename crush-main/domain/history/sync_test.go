@@ -0,0 +1,65 @@
+package history
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCursor(t *testing.T) {
+	cursor, err := ParseSyncCursor("")
+	require.NoError(t, err)
+	require.Equal(t, SyncCursor{}, cursor)
+	require.Empty(t, cursor.String())
+
+	cursor = SyncCursor{CreatedAt: 1760000000000, ID: "3f2c-11"}
+	parsed, err := ParseSyncCursor(cursor.String())
+	require.NoError(t, err)
+	require.Equal(t, cursor, parsed)
+
+	for _, invalid := range []string{"latest", "12:", "abc:id"} {
+		_, err := ParseSyncCursor(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestSyncPath(t *testing.T) {
+	rel, ok := SyncPath("/workspace/app/", "/workspace/app/src/main.go")
+	require.True(t, ok)
+	require.Equal(t, "src/main.go", rel)
+
+	for _, path := range []string{"/workspace/application/x.go", "/workspace/app", "/workspace/app/../etc/passwd", "/tmp/x"} {
+		_, ok := SyncPath("/workspace/app", path)
+		require.False(t, ok, path)
+	}
+}
+
+func TestSyncPatchCollapsesEdits(t *testing.T) {
+	rows := []postgres.ListProjectFileChangesRow{
+		{ID: "1", Path: "/workspace/main.go", Content: "a\nb\n", BaseContent: sql.NullString{String: "a\n", Valid: true}},
+		{ID: "2", Path: "/tmp/scratch.txt", Content: "ignored\n"},
+		{ID: "3", Path: "/workspace/main.go", Content: "a\nb\nc\n", BaseContent: sql.NullString{String: "a\nb\n", Valid: true}},
+		{ID: "4", Path: "/workspace/new.txt", Content: "new\n"},
+	}
+
+	change, ok := NewSyncChange("/workspace", rows[0])
+	require.True(t, ok)
+	require.Equal(t, "main.go", change.Path)
+	require.Equal(t, ContentSHA256("a\n"), change.BaseSHA256)
+	require.Contains(t, change.Diff, "+b")
+
+	patch := SyncPatch("/workspace", rows)
+	require.Equal(t, `--- a/main.go
++++ b/main.go
+@@ -1 +1,3 @@
+ a
++b
++c
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++new
+`, patch)
+}
@@ -0,0 +1,72 @@
+package history
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/diff"
+)
+
+// FileVersions are the versions of a file recorded in a session, oldest
+// first. Versions are numbered per path across sessions, so the numbers of a
+// session may have gaps.
+type FileVersions struct {
+	Path     string
+	Versions []File
+}
+
+// GroupVersions groups the files of a session by path, sorted by path.
+func GroupVersions(files []File) []FileVersions {
+	byPath := make(map[string]*FileVersions)
+	var grouped []*FileVersions
+	for _, f := range files {
+		v, ok := byPath[f.Path]
+		if !ok {
+			v = &FileVersions{Path: f.Path}
+			byPath[f.Path] = v
+			grouped = append(grouped, v)
+		}
+		v.Versions = append(v.Versions, f)
+	}
+
+	result := make([]FileVersions, len(grouped))
+	for i, v := range grouped {
+		slices.SortStableFunc(v.Versions, func(a, b File) int {
+			return cmp.Or(cmp.Compare(a.Version, b.Version), cmp.Compare(a.CreatedAt, b.CreatedAt))
+		})
+		result[i] = *v
+	}
+	slices.SortFunc(result, func(a, b FileVersions) int { return cmp.Compare(a.Path, b.Path) })
+	return result
+}
+
+// Find returns the file at a version, false when the session has no such
+// version.
+func (v FileVersions) Find(version int64) (File, bool) {
+	i := slices.IndexFunc(v.Versions, func(f File) bool { return f.Version == version })
+	if i < 0 {
+		return File{}, false
+	}
+	return v.Versions[i], true
+}
+
+// Previous returns the version recorded before a file in the session, false
+// for the first one.
+func (v FileVersions) Previous(f File) (File, bool) {
+	i := slices.IndexFunc(v.Versions, func(o File) bool { return o.ID == f.ID })
+	if i <= 0 {
+		return File{}, false
+	}
+	return v.Versions[i-1], true
+}
+
+// Latest returns the last version of the file in the session.
+func (v FileVersions) Latest() File {
+	return v.Versions[len(v.Versions)-1]
+}
+
+// Diff returns the unified diff from one version of a file to another with
+// the number of added and removed lines.
+func Diff(from, to File) (string, int, int) {
+	return diff.GenerateDiff(from.Content, to.Content, to.Path)
+}
@@ -0,0 +1,38 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupVersions(t *testing.T) {
+	t.Parallel()
+
+	files := []File{
+		{ID: "b0", Path: "/w/b.go", Version: 0, Content: "package b\n"},
+		{ID: "a3", Path: "/w/a.go", Version: 3, Content: "a3\n"},
+		{ID: "a1", Path: "/w/a.go", Version: 1, Content: "a1\n"},
+	}
+	grouped := GroupVersions(files)
+	require.Len(t, grouped, 2)
+	require.Equal(t, "/w/a.go", grouped[0].Path)
+
+	a := grouped[0]
+	require.Equal(t, "a3", a.Latest().ID)
+	v1, ok := a.Find(1)
+	require.True(t, ok)
+	_, ok = a.Find(2)
+	require.False(t, ok, "version 2 was recorded in another session")
+
+	prev, ok := a.Previous(a.Latest())
+	require.True(t, ok)
+	require.Equal(t, v1, prev)
+	_, ok = a.Previous(v1)
+	require.False(t, ok)
+
+	unified, additions, removals := Diff(v1, a.Latest())
+	require.Contains(t, unified, "-a1\n+a3")
+	require.Equal(t, 1, additions)
+	require.Equal(t, 1, removals)
+}
@@ -0,0 +1,349 @@
+// Package job runs background jobs of the agent inside the sandbox
+// containers. A job is started detached from the sandbox request, writes its
+// output and exit code to files in the container, and is recorded in the
+// database, so that it keeps running and stays reachable across restarts of
+// the WS server.
+package job
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+)
+
+// Job statuses.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusKilled    = "killed"
+	// StatusLost is set when the process is gone without an exit code, e.g.
+	// after the container was restarted.
+	StatusLost = "lost"
+)
+
+const (
+	// MaxRunningPerSession bounds the jobs running at once in a session.
+	MaxRunningPerSession = 50
+	// OutputLimit is the number of trailing output bytes returned by Output.
+	OutputLimit = 30000
+	// dir holds the output and exit code files of the jobs in the container.
+	dir = "/tmp/crush-jobs"
+)
+
+var (
+	// ErrNotFound is returned when a job does not exist.
+	ErrNotFound = errors.New("background job not found")
+	// ErrTooManyJobs is returned when a session has too many running jobs.
+	ErrTooManyJobs = fmt.Errorf("maximum number of background jobs (%d) reached, terminate or wait for some jobs to complete", MaxRunningPerSession)
+)
+
+// Executor runs commands in the sandbox container of a session.
+type Executor interface {
+	Execute(ctx context.Context, req sandbox.ExecuteRequest) (*sandbox.ExecuteResponse, error)
+}
+
+// Job is a command running in the background in a sandbox container.
+type Job struct {
+	ID            string
+	SessionID     string
+	ContainerName string
+	Command       string
+	Description   string
+	WorkingDir    string
+	PID           int
+	Status        string
+	// ExitCode is set once the job completed.
+	ExitCode    *int
+	CreatedAt   int64
+	CompletedAt int64
+}
+
+// Done reports whether the job is no longer running.
+func (j Job) Done() bool {
+	return j.Status != StatusRunning
+}
+
+type Service interface {
+	// Start runs a command in the background in the container of a session.
+	Start(ctx context.Context, sessionID, workingDir, command, description string) (Job, error)
+	// Get returns a job without checking on its process.
+	Get(ctx context.Context, id string) (Job, error)
+	// Output checks on the process of a job and returns the job with the
+	// trailing OutputLimit bytes of its combined output.
+	Output(ctx context.Context, id string) (Job, string, error)
+	// Kill terminates a running job and its child processes.
+	Kill(ctx context.Context, id string) (Job, error)
+	// ListBySession returns the jobs of a session, oldest first.
+	ListBySession(ctx context.Context, sessionID string) ([]Job, error)
+	// Recover checks on the jobs recorded as running, e.g. after a restart,
+	// and returns the number still running.
+	Recover(ctx context.Context) (int, error)
+}
+
+type service struct {
+	q        postgres.Querier
+	executor Executor
+}
+
+// NewService creates the background job service. A nil executor uses the
+// default sandbox client, looked up on each call as it is configured after
+// the services are created.
+func NewService(q postgres.Querier, executor Executor) Service {
+	return &service{q: q, executor: executor}
+}
+
+func (s *service) exec() Executor {
+	if s.executor == nil {
+		return sandbox.GetDefaultClient()
+	}
+	return s.executor
+}
+
+func (s *service) Start(ctx context.Context, sessionID, workingDir, command, description string) (Job, error) {
+	running, err := s.ListBySession(ctx, sessionID)
+	if err != nil {
+		return Job{}, err
+	}
+	count := 0
+	for _, j := range running {
+		if !j.Done() {
+			count++
+		}
+	}
+	if count >= MaxRunningPerSession {
+		return Job{}, ErrTooManyJobs
+	}
+
+	id := uuid.NewString()[:8]
+	resp, err := s.exec().Execute(ctx, sandbox.ExecuteRequest{
+		SessionID:  sessionID,
+		Command:    startScript(id, command),
+		Language:   "bash",
+		WorkingDir: workingDir,
+	})
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to start background job: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(resp.Stdout))
+	if err != nil || resp.ExitCode != 0 {
+		return Job{}, fmt.Errorf("failed to start background job: %s", strings.TrimSpace(resp.Stdout+"\n"+resp.Stderr))
+	}
+
+	dbJob, err := s.q.CreateBackgroundJob(ctx, postgres.CreateBackgroundJobParams{
+		ID:            id,
+		SessionID:     sessionID,
+		ContainerName: s.containerName(ctx, sessionID),
+		Command:       command,
+		Description:   description,
+		WorkingDir:    workingDir,
+		Pid:           int32(pid),
+	})
+	if err != nil {
+		// Unrecorded jobs could not be reached, do not leave them running
+		s.signal(context.Background(), sessionID, pid)
+		return Job{}, err
+	}
+	slog.Info("Background job started", "job_id", id, "session_id", sessionID, "pid", pid)
+	return fromDB(dbJob), nil
+}
+
+func (s *service) Get(ctx context.Context, id string) (Job, error) {
+	dbJob, err := s.q.GetBackgroundJob(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return fromDB(dbJob), nil
+}
+
+func (s *service) Output(ctx context.Context, id string) (Job, string, error) {
+	j, err := s.Get(ctx, id)
+	if err != nil {
+		return Job{}, "", err
+	}
+	resp, err := s.exec().Execute(ctx, sandbox.ExecuteRequest{
+		SessionID: j.SessionID,
+		Command:   probeScript(j),
+		Language:  "bash",
+	})
+	if err != nil {
+		return j, "", fmt.Errorf("failed to read background job output: %w", err)
+	}
+	state, output, _ := strings.Cut(resp.Stdout, "\n")
+	j, err = s.update(ctx, j, state)
+	return j, output, err
+}
+
+func (s *service) Kill(ctx context.Context, id string) (Job, error) {
+	j, err := s.Get(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if j.Done() {
+		return j, nil
+	}
+	if err := s.signal(ctx, j.SessionID, j.PID); err != nil {
+		return j, err
+	}
+	if err := s.finish(ctx, &j, StatusKilled, nil); err != nil {
+		return j, err
+	}
+	slog.Info("Background job killed", "job_id", j.ID, "session_id", j.SessionID, "pid", j.PID)
+	return j, nil
+}
+
+func (s *service) ListBySession(ctx context.Context, sessionID string) ([]Job, error) {
+	dbJobs, err := s.q.ListBackgroundJobsBySession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]Job, len(dbJobs))
+	for i, dbJob := range dbJobs {
+		jobs[i] = fromDB(dbJob)
+	}
+	return jobs, nil
+}
+
+func (s *service) Recover(ctx context.Context) (int, error) {
+	dbJobs, err := s.q.ListRunningBackgroundJobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	running := 0
+	for _, dbJob := range dbJobs {
+		j, _, err := s.Output(ctx, dbJob.ID)
+		if err != nil {
+			// The container may be down for now, check again on the next job_output
+			slog.Warn("Failed to check on background job", "job_id", dbJob.ID, "session_id", dbJob.SessionID, "error", err)
+			running++
+			continue
+		}
+		if !j.Done() {
+			running++
+		}
+	}
+	return running, nil
+}
+
+// update records the state reported by probeScript: "running", the exit
+// code of the command, or "lost".
+func (s *service) update(ctx context.Context, j Job, state string) (Job, error) {
+	if j.Done() {
+		return j, nil
+	}
+	var err error
+	switch state = strings.TrimSpace(state); state {
+	case StatusRunning:
+	case StatusLost:
+		err = s.finish(ctx, &j, StatusLost, nil)
+	default:
+		code, convErr := strconv.Atoi(state)
+		if convErr != nil {
+			return j, fmt.Errorf("unexpected background job state %q", state)
+		}
+		err = s.finish(ctx, &j, StatusCompleted, &code)
+	}
+	return j, err
+}
+
+func (s *service) finish(ctx context.Context, j *Job, status string, exitCode *int) error {
+	params := postgres.FinishBackgroundJobParams{ID: j.ID, Status: status}
+	if exitCode != nil {
+		params.ExitCode = sql.NullInt32{Int32: int32(*exitCode), Valid: true}
+	}
+	if err := s.q.FinishBackgroundJob(ctx, params); err != nil {
+		return err
+	}
+	j.Status = status
+	j.ExitCode = exitCode
+	return nil
+}
+
+// signal terminates the process group of a job.
+func (s *service) signal(ctx context.Context, sessionID string, pid int) error {
+	_, err := s.exec().Execute(ctx, sandbox.ExecuteRequest{
+		SessionID: sessionID,
+		Command:   fmt.Sprintf("kill -TERM -- -%d 2>/dev/null || kill -TERM %d 2>/dev/null; true", pid, pid),
+		Language:  "bash",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to kill background job: %w", err)
+	}
+	return nil
+}
+
+// containerName returns the container of the project of a session, empty
+// when unknown.
+func (s *service) containerName(ctx context.Context, sessionID string) string {
+	dbSession, err := s.q.GetSessionByID(ctx, sessionID)
+	if err != nil || !dbSession.ProjectID.Valid {
+		return ""
+	}
+	project, err := s.q.GetProjectByID(ctx, dbSession.ProjectID.String)
+	if err != nil {
+		return ""
+	}
+	return project.ContainerName.String
+}
+
+// startScript starts a command in its own session, detached from the
+// sandbox request, and prints its PID. The exit code is written once the
+// command is done.
+func startScript(id, command string) string {
+	wrapped := fmt.Sprintf("bash -c %s; echo $? > %s.tmp && mv %s.tmp %s",
+		shellQuote(command), exitFile(id), exitFile(id), exitFile(id))
+	return fmt.Sprintf(`mkdir -p %s
+launcher=; command -v setsid >/dev/null 2>&1 && launcher=setsid
+$launcher nohup sh -c %s </dev/null >%s 2>&1 &
+echo $!`, dir, shellQuote(wrapped), logFile(id))
+}
+
+// probeScript prints the state of a job on the first line, followed by the
+// end of its output. The exit code file is checked first as finished
+// processes may linger as zombies in containers without an init process.
+func probeScript(j Job) string {
+	return fmt.Sprintf(`if [ -f %s ]; then cat %s; elif kill -0 %d 2>/dev/null; then echo %s; else echo %s; fi
+tail -c %d %s 2>/dev/null || true`, exitFile(j.ID), exitFile(j.ID), j.PID, StatusRunning, StatusLost, OutputLimit, logFile(j.ID))
+}
+
+func logFile(id string) string {
+	return dir + "/" + id + ".log"
+}
+
+func exitFile(id string) string {
+	return dir + "/" + id + ".exit"
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fromDB(j postgres.BackgroundJob) Job {
+	job := Job{
+		ID:            j.ID,
+		SessionID:     j.SessionID,
+		ContainerName: j.ContainerName,
+		Command:       j.Command,
+		Description:   j.Description,
+		WorkingDir:    j.WorkingDir,
+		PID:           int(j.Pid),
+		Status:        j.Status,
+		CreatedAt:     j.CreatedAt,
+		CompletedAt:   j.CompletedAt.Int64,
+	}
+	if j.ExitCode.Valid {
+		code := int(j.ExitCode.Int32)
+		job.ExitCode = &code
+	}
+	return job
+}
@@ -0,0 +1,60 @@
+package job
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runScript runs a script like the sandbox does.
+func runScript(t *testing.T, script string) string {
+	t.Helper()
+	out, err := exec.Command("bash", "-c", script).Output()
+	require.NoError(t, err)
+	return string(out)
+}
+
+func probe(t *testing.T, j Job) (string, string) {
+	t.Helper()
+	state, output, _ := strings.Cut(runScript(t, probeScript(j)), "\n")
+	return state, output
+}
+
+func TestScripts(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	j := Job{ID: "test-" + uuid.NewString()[:8]}
+	t.Cleanup(func() {
+		_ = os.Remove(logFile(j.ID))
+		_ = os.Remove(exitFile(j.ID))
+	})
+	pid, err := strconv.Atoi(strings.TrimSpace(runScript(t, startScript(j.ID, `echo "it's running"; sleep 0.3; exit 3`))))
+	require.NoError(t, err)
+	j.PID = pid
+
+	var state, output string
+	require.Eventually(t, func() bool {
+		state, output = probe(t, j)
+		return output != ""
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, StatusRunning, state)
+	assert.Equal(t, "it's running\n", output)
+
+	require.Eventually(t, func() bool {
+		state, _ = probe(t, j)
+		return state != StatusRunning
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "3", state)
+
+	state, _ = probe(t, Job{ID: "test-" + uuid.NewString()[:8], PID: 1 << 22})
+	assert.Equal(t, StatusLost, state)
+}
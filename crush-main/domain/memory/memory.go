@@ -0,0 +1,212 @@
+// Package memory keeps notes about a project that outlive its sessions, e.g.
+// the build commands and the gotchas the agent learned. The agent writes and
+// searches them with the memory tool, and the notes most relevant to a prompt
+// are added to the system prompt of the turn.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+const (
+	// MaxContentLength bounds the length of a note, in characters.
+	MaxContentLength = 2000
+	// MaxEntries bounds the number of notes of a project.
+	MaxEntries = 500
+	// DefaultLimit is the number of notes returned when no limit is given.
+	DefaultLimit = 20
+	// MaxLimit bounds the number of notes returned at once.
+	MaxLimit = 100
+	// maxQueryWords bounds the words of a prompt used to rank the notes.
+	maxQueryWords = 64
+)
+
+var (
+	// ErrNotFound is returned when a note does not exist.
+	ErrNotFound = errors.New("memory not found")
+	// ErrInvalidContent is returned for empty or oversized notes.
+	ErrInvalidContent = fmt.Errorf("memory content must be 1 to %d characters", MaxContentLength)
+	// ErrFull is returned when a project has MaxEntries notes.
+	ErrFull = fmt.Errorf("project memory is full (%d entries), delete outdated entries first", MaxEntries)
+)
+
+// Memory is a note about a project.
+type Memory struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	Content   string `json:"content"`
+	// SessionID is the session the note was written in, empty when it was
+	// added through the API
+	SessionID string `json:"session_id,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+	CreatedAt int64  `json:"created_at"` // Unix milliseconds
+}
+
+type Service interface {
+	// Append adds a note to a project.
+	Append(ctx context.Context, projectID, content, sessionID, userID string) (Memory, error)
+	// List returns the notes of a project, most recent first.
+	List(ctx context.Context, projectID string, limit, offset int) ([]Memory, error)
+	// Search returns the notes of a project matching a query, best match
+	// first.
+	Search(ctx context.Context, projectID, query string, limit int) ([]Memory, error)
+	// Relevant returns up to limit notes of a project ranked by relevance
+	// to a text, e.g. a prompt. Recent notes fill up the limit when fewer
+	// are related to the text.
+	Relevant(ctx context.Context, projectID, text string, limit int) ([]Memory, error)
+	// Delete removes a note of a project.
+	Delete(ctx context.Context, projectID, id string) error
+}
+
+type service struct {
+	q postgres.Querier
+}
+
+func NewService(q postgres.Querier) Service {
+	return &service{q: q}
+}
+
+func (s *service) Append(ctx context.Context, projectID, content, sessionID, userID string) (Memory, error) {
+	if projectID == "" {
+		return Memory{}, errors.New("project ID is required")
+	}
+	content = strings.TrimSpace(content)
+	if content == "" || utf8.RuneCountInString(content) > MaxContentLength {
+		return Memory{}, ErrInvalidContent
+	}
+	count, err := s.q.CountProjectMemories(ctx, projectID)
+	if err != nil {
+		return Memory{}, err
+	}
+	if count >= MaxEntries {
+		return Memory{}, ErrFull
+	}
+	dbMemory, err := s.q.CreateProjectMemory(ctx, postgres.CreateProjectMemoryParams{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Content:   content,
+		SessionID: sessionID,
+		CreatedBy: userID,
+	})
+	if err != nil {
+		return Memory{}, err
+	}
+	return fromDB(dbMemory), nil
+}
+
+func (s *service) List(ctx context.Context, projectID string, limit, offset int) ([]Memory, error) {
+	dbMemories, err := s.q.ListProjectMemories(ctx, postgres.ListProjectMemoriesParams{
+		ProjectID: projectID,
+		Limit:     int32(clampLimit(limit)),
+		Offset:    int32(max(offset, 0)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromDBList(dbMemories), nil
+}
+
+func (s *service) Search(ctx context.Context, projectID, query string, limit int) ([]Memory, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return s.List(ctx, projectID, limit, 0)
+	}
+	dbMemories, err := s.q.SearchProjectMemories(ctx, postgres.SearchProjectMemoriesParams{
+		ProjectID: projectID,
+		Query:     query,
+		Pattern:   likePattern(query),
+		Limit:     int32(clampLimit(limit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromDBList(dbMemories), nil
+}
+
+func (s *service) Relevant(ctx context.Context, projectID, text string, limit int) ([]Memory, error) {
+	if projectID == "" || limit <= 0 {
+		return nil, nil
+	}
+	dbMemories, err := s.q.ListRelevantProjectMemories(ctx, postgres.ListRelevantProjectMemoriesParams{
+		ProjectID: projectID,
+		Query:     anyWordQuery(text),
+		Limit:     int32(min(limit, MaxLimit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromDBList(dbMemories), nil
+}
+
+func (s *service) Delete(ctx context.Context, projectID, id string) error {
+	rows, err := s.q.DeleteProjectMemory(ctx, postgres.DeleteProjectMemoryParams{ProjectID: projectID, ID: id})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// anyWordQuery turns a text into a web search query matching any of its
+// words, so that a note is ranked by how many words of the prompt it shares.
+func anyWordQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(words))
+	var kept []string
+	for _, word := range words {
+		// "or" is the operator of the query
+		if len(word) < 3 || word == "or" || seen[word] {
+			continue
+		}
+		seen[word] = true
+		kept = append(kept, word)
+		if len(kept) == maxQueryWords {
+			break
+		}
+	}
+	return strings.Join(kept, " or ")
+}
+
+// likePattern matches the notes containing the query, ILIKE wildcards in the
+// query are matched literally.
+func likePattern(query string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query) + "%"
+}
+
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	return min(limit, MaxLimit)
+}
+
+func fromDBList(items []postgres.ProjectMemory) []Memory {
+	memories := make([]Memory, len(items))
+	for i, item := range items {
+		memories[i] = fromDB(item)
+	}
+	return memories
+}
+
+func fromDB(item postgres.ProjectMemory) Memory {
+	return Memory{
+		ID:        item.ID,
+		ProjectID: item.ProjectID,
+		Content:   item.Content,
+		SessionID: item.SessionID,
+		CreatedBy: item.CreatedBy,
+		CreatedAt: item.CreatedAt,
+	}
+}
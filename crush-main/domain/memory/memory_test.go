@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQuerier struct {
+	postgres.Querier
+	count    int64
+	created  postgres.CreateProjectMemoryParams
+	search   postgres.SearchProjectMemoriesParams
+	relevant postgres.ListRelevantProjectMemoriesParams
+}
+
+func (q *fakeQuerier) CountProjectMemories(context.Context, string) (int64, error) {
+	return q.count, nil
+}
+
+func (q *fakeQuerier) CreateProjectMemory(_ context.Context, arg postgres.CreateProjectMemoryParams) (postgres.ProjectMemory, error) {
+	q.created = arg
+	return postgres.ProjectMemory{ID: arg.ID, ProjectID: arg.ProjectID, Content: arg.Content, SessionID: arg.SessionID}, nil
+}
+
+func (q *fakeQuerier) SearchProjectMemories(_ context.Context, arg postgres.SearchProjectMemoriesParams) ([]postgres.ProjectMemory, error) {
+	q.search = arg
+	return []postgres.ProjectMemory{{ID: "m1", Content: "run make test"}}, nil
+}
+
+func (q *fakeQuerier) ListRelevantProjectMemories(_ context.Context, arg postgres.ListRelevantProjectMemoriesParams) ([]postgres.ProjectMemory, error) {
+	q.relevant = arg
+	return nil, nil
+}
+
+func (q *fakeQuerier) DeleteProjectMemory(context.Context, postgres.DeleteProjectMemoryParams) (int64, error) {
+	return 0, nil
+}
+
+func TestAppend(t *testing.T) {
+	q := &fakeQuerier{}
+	s := NewService(q)
+
+	m, err := s.Append(t.Context(), "p1", "  Run `make test-unit`, not go test  ", "s1", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "Run `make test-unit`, not go test", m.Content)
+	assert.Equal(t, "s1", q.created.SessionID)
+	assert.Equal(t, "u1", q.created.CreatedBy)
+
+	_, err = s.Append(t.Context(), "p1", " ", "s1", "u1")
+	assert.ErrorIs(t, err, ErrInvalidContent)
+	_, err = s.Append(t.Context(), "p1", strings.Repeat("é", MaxContentLength+1), "s1", "u1")
+	assert.ErrorIs(t, err, ErrInvalidContent)
+
+	q.count = MaxEntries
+	_, err = s.Append(t.Context(), "p1", "one more", "s1", "u1")
+	assert.ErrorIs(t, err, ErrFull)
+}
+
+func TestSearch(t *testing.T) {
+	q := &fakeQuerier{}
+	s := NewService(q)
+
+	memories, err := s.Search(t.Context(), "p1", " make_test ", 1000)
+	require.NoError(t, err)
+	require.Len(t, memories, 1)
+	assert.Equal(t, "make_test", q.search.Query)
+	assert.Equal(t, `%make\_test%`, q.search.Pattern)
+	assert.Equal(t, int32(MaxLimit), q.search.Limit)
+}
+
+func TestRelevant(t *testing.T) {
+	q := &fakeQuerier{}
+	s := NewService(q)
+
+	_, err := s.Relevant(t.Context(), "p1", "Fix the build: go test fails on CI, or the build?", 10)
+	require.NoError(t, err)
+	assert.Equal(t, "fix or the or build or test or fails", q.relevant.Query)
+	assert.Equal(t, int32(10), q.relevant.Limit)
+}
+
+func TestDeleteNotFound(t *testing.T) {
+	s := NewService(&fakeQuerier{})
+	assert.ErrorIs(t, s.Delete(t.Context(), "p1", "missing"), ErrNotFound)
+}
@@ -0,0 +1,50 @@
+package message
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// SummaryAppendix is the machine-readable part of a summary message. It keeps
+// the references a prose summary tends to lose, the files and commands the
+// compacted conversation worked with and the todos it left open, and is
+// re-injected verbatim into the prompt after compaction.
+type SummaryAppendix struct {
+	FilesTouched []string `json:"files_touched,omitempty"`
+	FilesRead    []string `json:"files_read,omitempty"`
+	Commands     []string `json:"commands,omitempty"`
+	OpenTodos    []string `json:"open_todos,omitempty"`
+}
+
+func (SummaryAppendix) isPart() {}
+
+// IsEmpty reports whether the appendix references nothing.
+func (a SummaryAppendix) IsEmpty() bool {
+	return len(a.FilesTouched) == 0 && len(a.FilesRead) == 0 && len(a.Commands) == 0 && len(a.OpenTodos) == 0
+}
+
+// String renders the appendix as it is injected into the prompt.
+func (a SummaryAppendix) String() string {
+	data, _ := json.MarshalIndent(a, "", "  ")
+	return "<summary_appendix>\n" + string(data) + "\n</summary_appendix>"
+}
+
+// SummaryAppendix returns the appendix of a summary message, nil when it has none.
+func (m *Message) SummaryAppendix() *SummaryAppendix {
+	for _, part := range m.Parts {
+		if c, ok := part.(SummaryAppendix); ok {
+			return &c
+		}
+	}
+	return nil
+}
+
+// SetSummaryAppendix attaches an appendix to a summary message, replacing
+// the one it had.
+func (m *Message) SetSummaryAppendix(appendix SummaryAppendix) {
+	m.Parts = slices.DeleteFunc(m.Parts, func(part ContentPart) bool {
+		_, ok := part.(SummaryAppendix)
+		return ok
+	})
+	m.Parts = append(m.Parts, appendix)
+}
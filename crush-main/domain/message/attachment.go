@@ -1,8 +1,50 @@
 package message
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+)
+
 type Attachment struct {
 	FilePath string
 	FileName string
 	MimeType string
 	Content  []byte
 }
+
+// ErrInvalidAttachmentReference is returned when a reference does not point
+// to an attachment of the session.
+var ErrInvalidAttachmentReference = errors.New("invalid attachment reference")
+
+// AttachmentReference points to an attachment already sent in the session,
+// so a prompt can include it again without uploading it again. PartIndex is
+// the index of the part in the parts of the message.
+type AttachmentReference struct {
+	MessageID string `json:"message_id"`
+	PartIndex int    `json:"part_index"`
+}
+
+// ResolveAttachmentReference returns the stored attachment a reference points
+// to. Its Content is empty, it is fetched from FilePath like an upload.
+func ResolveAttachmentReference(ctx context.Context, messages Service, sessionID string, ref AttachmentReference) (Attachment, error) {
+	msg, err := messages.Get(ctx, ref.MessageID)
+	if err != nil || msg.SessionID != sessionID {
+		return Attachment{}, fmt.Errorf("%w: message %s not found in session", ErrInvalidAttachmentReference, ref.MessageID)
+	}
+	if ref.PartIndex < 0 || ref.PartIndex >= len(msg.Parts) {
+		return Attachment{}, fmt.Errorf("%w: message %s has no part %d", ErrInvalidAttachmentReference, ref.MessageID, ref.PartIndex)
+	}
+	bc, ok := msg.Parts[ref.PartIndex].(BinaryContent)
+	if !ok || bc.Path == "" {
+		return Attachment{}, fmt.Errorf("%w: part %d of message %s is not a stored attachment", ErrInvalidAttachmentReference, ref.PartIndex, ref.MessageID)
+	}
+
+	name := path.Base(bc.Path)
+	if u, err := url.Parse(bc.Path); err == nil && u.Path != "" {
+		name = path.Base(u.Path)
+	}
+	return Attachment{FilePath: bc.Path, FileName: name, MimeType: bc.MIMEType}, nil
+}
@@ -0,0 +1,56 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// storedMessages serves the messages it holds.
+type storedMessages struct {
+	Service
+	messages map[string]Message
+}
+
+func (s storedMessages) Get(_ context.Context, id string) (Message, error) {
+	msg, ok := s.messages[id]
+	if !ok {
+		return Message{}, errors.New("not found")
+	}
+	return msg, nil
+}
+
+func TestResolveAttachmentReference(t *testing.T) {
+	t.Parallel()
+
+	messages := storedMessages{messages: map[string]Message{
+		"m1": {ID: "m1", SessionID: "s1", Parts: []ContentPart{
+			TextContent{Text: "look at this"},
+			BinaryContent{Path: "https://files.example.com/uploads/shot.png?sig=abc", MIMEType: "image/png"},
+			BinaryContent{MIMEType: "image/png", Data: []byte("inline")},
+		}},
+	}}
+
+	att, err := ResolveAttachmentReference(t.Context(), messages, "s1", AttachmentReference{MessageID: "m1", PartIndex: 1})
+	require.NoError(t, err)
+	require.Equal(t, Attachment{FilePath: "https://files.example.com/uploads/shot.png?sig=abc", FileName: "shot.png", MimeType: "image/png"}, att)
+
+	for name, tc := range map[string]struct {
+		sessionID string
+		ref       AttachmentReference
+	}{
+		"unknown message":      {"s1", AttachmentReference{MessageID: "m2", PartIndex: 1}},
+		"other session":        {"s2", AttachmentReference{MessageID: "m1", PartIndex: 1}},
+		"negative part":        {"s1", AttachmentReference{MessageID: "m1", PartIndex: -1}},
+		"part out of range":    {"s1", AttachmentReference{MessageID: "m1", PartIndex: 3}},
+		"not an attachment":    {"s1", AttachmentReference{MessageID: "m1", PartIndex: 0}},
+		"attachment not saved": {"s1", AttachmentReference{MessageID: "m1", PartIndex: 2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ResolveAttachmentReference(t.Context(), messages, tc.sessionID, tc.ref)
+			require.ErrorIs(t, err, ErrInvalidAttachmentReference)
+		})
+	}
+}
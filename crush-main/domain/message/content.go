@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"slices"
 	"strings"
 	"time"
@@ -34,11 +35,52 @@ const (
 	FinishReasonCanceled         FinishReason = "canceled"
 	FinishReasonError            FinishReason = "error"
 	FinishReasonPermissionDenied FinishReason = "permission_denied"
+	FinishReasonLoopDetected     FinishReason = "loop_detected"
+	// FinishReasonModerated is set when a moderation policy halted the response.
+	FinishReasonModerated FinishReason = "moderated"
+	// FinishReasonStalled is set when the provider stream stopped sending
+	// events and the watchdog cancelled it.
+	FinishReasonStalled FinishReason = "stalled"
+	// FinishReasonBudgetExceeded is set when the session, project or user
+	// spending budget was used up.
+	FinishReasonBudgetExceeded FinishReason = "budget_exceeded"
+	// FinishReasonPermissionTimeout is set when a permission request was not
+	// answered in time, its tool call waits for the user to resume the turn.
+	FinishReasonPermissionTimeout FinishReason = "permission_timeout"
 
 	// Should never happen
 	FinishReasonUnknown FinishReason = "unknown"
 )
 
+// CancelReason tells why a turn was cancelled, it is recorded on the finish
+// part of the assistant message.
+type CancelReason string
+
+const (
+	CancelReasonUser     CancelReason = "user"
+	CancelReasonTimeout  CancelReason = "timeout"
+	CancelReasonBudget   CancelReason = "budget"
+	CancelReasonShutdown CancelReason = "shutdown"
+	// CancelReasonReplaced is set when a new prompt interrupted the turn
+	CancelReasonReplaced CancelReason = "replaced"
+)
+
+// Message describes the cancellation to users.
+func (r CancelReason) Message() string {
+	switch r {
+	case CancelReasonTimeout:
+		return "Request timed out"
+	case CancelReasonBudget:
+		return "Budget exceeded"
+	case CancelReasonShutdown:
+		return "Server shutting down"
+	case CancelReasonReplaced:
+		return "Replaced by a new prompt"
+	default:
+		return "User canceled request"
+	}
+}
+
 type ContentPart interface {
 	isPart()
 }
@@ -153,6 +195,10 @@ type Finish struct {
 	Time    int64        `json:"time"`
 	Message string       `json:"message,omitempty"`
 	Details string       `json:"details,omitempty"`
+	// CancelReason is set when the turn was cut short, Partial when the
+	// message holds the text or tool calls generated until then.
+	CancelReason CancelReason `json:"cancel_reason,omitempty"`
+	Partial      bool         `json:"partial,omitempty"`
 }
 
 func (Finish) isPart() {}
@@ -229,10 +275,8 @@ func (m *Message) HydrateBinaryContents(fetcher ImageFetcher) error {
 			continue
 		}
 
-		fmt.Printf("[HydrateBinaryContents] Fetching image from URL: %s\n", bc.Path)
 		data, mimeType, err := fetcher(bc.Path)
 		if err != nil {
-			fmt.Printf("[HydrateBinaryContents] ❌ Failed to fetch image: %v\n", err)
 			return fmt.Errorf("failed to fetch image from %s: %w", bc.Path, err)
 		}
 
@@ -242,7 +286,7 @@ func (m *Message) HydrateBinaryContents(fetcher ImageFetcher) error {
 			bc.MIMEType = mimeType
 		}
 		m.Parts[i] = bc
-		fmt.Printf("[HydrateBinaryContents] ✅ Image fetched: %d bytes, MIME: %s\n", len(data), bc.MIMEType)
+		slog.Debug("Hydrated binary content", "path", bc.Path, "size", len(data), "mime_type", bc.MIMEType)
 	}
 
 	return nil
@@ -503,6 +547,18 @@ func (m *Message) AddFinish(reason FinishReason, message, details string) {
 	m.Parts = append(m.Parts, Finish{Reason: reason, Time: time.Now().Unix(), Message: message, Details: details})
 }
 
+// AddCancelFinish finishes a message whose turn was cut short for reason,
+// as cancelled unless finishReason tells more, e.g. budget_exceeded. The
+// content generated until then is kept and the finish marked partial.
+func (m *Message) AddCancelFinish(finishReason FinishReason, reason CancelReason, details string) {
+	partial := m.Content().Text != "" || m.ReasoningContent().Thinking != "" || len(m.ToolCalls()) > 0
+	m.AddFinish(finishReason, reason.Message(), details)
+	finish := m.Parts[len(m.Parts)-1].(Finish)
+	finish.CancelReason = reason
+	finish.Partial = partial
+	m.Parts[len(m.Parts)-1] = finish
+}
+
 func (m *Message) AddImageURL(url, detail string) {
 	m.Parts = append(m.Parts, ImageURLContent{URL: url, Detail: detail})
 }
@@ -516,31 +572,18 @@ func (m *Message) ToAIMessage() []fantasy.Message {
 	switch m.Role {
 	case User:
 		binaryContents := m.BinaryContent()
-		if len(binaryContents) > 0 {
-			fmt.Printf("\n=== Message: 转换用户消息为 AI 消息 (ID: %s) ===\n", m.ID)
-			fmt.Printf("消息包含 %d 个二进制内容\n", len(binaryContents))
-		}
-
 		var parts []fantasy.MessagePart
 		text := strings.TrimSpace(m.Content().Text)
 		if text != "" {
 			parts = append(parts, fantasy.TextPart{Text: text})
 		}
-		for i, content := range binaryContents {
-			fmt.Printf("[二进制内容 %d/%d] 转换为 FilePart\n", i+1, len(binaryContents))
-			fmt.Printf("  - Path: %s\n", content.Path)
-			fmt.Printf("  - MIMEType: %s\n", content.MIMEType)
-			fmt.Printf("  - Data Size: %d bytes\n", len(content.Data))
+		for _, content := range binaryContents {
 			parts = append(parts, fantasy.FilePart{
 				Filename:  content.Path,
 				Data:      content.Data,
 				MediaType: content.MIMEType,
 			})
 		}
-		if len(binaryContents) > 0 {
-			fmt.Printf("✅ 用户消息转换完成：%d 个部分\n", len(parts))
-			fmt.Println("=== Message: 转换完成 ===\n")
-		}
 		messages = append(messages, fantasy.Message{
 			Role:    fantasy.MessageRoleUser,
 			Content: parts,
@@ -1,6 +1,10 @@
 package message
 
-import "time"
+import (
+	"time"
+
+	"github.com/rolling1314/rolling-crush/internal/apierr"
+)
 
 // DeltaType represents the type of streaming delta content
 type DeltaType string
@@ -22,11 +26,18 @@ const (
 
 // StreamDelta represents an incremental update to a message during streaming.
 // Instead of sending the full message on every update, we send only the delta (change).
+// The full message is only published when it is created and when it is finished.
 type StreamDelta struct {
 	// MessageID is the ID of the message being updated
 	MessageID string `json:"message_id"`
 	// SessionID is the session this message belongs to
 	SessionID string `json:"session_id"`
+	// PartIndex is the index of the message part the delta extends, -1 for
+	// finish and error deltas
+	PartIndex int `json:"part_index"`
+	// Seq numbers the deltas sent for a message in order, starting at 1. It is
+	// set when the delta is sent, consecutive deltas may be merged first.
+	Seq int64 `json:"seq"`
 	// DeltaType indicates what kind of content is being streamed
 	DeltaType DeltaType `json:"delta_type"`
 	// Content is the incremental text content (for text, reasoning, tool_call_input)
@@ -37,6 +48,10 @@ type StreamDelta struct {
 	ToolCallName string `json:"tool_call_name,omitempty"`
 	// FinishReason is set when DeltaType is finish
 	FinishReason string `json:"finish_reason,omitempty"`
+	// CancelReason is set on the finish delta of a cancelled turn
+	CancelReason CancelReason `json:"cancel_reason,omitempty"`
+	// Error classifies the error of an error delta, its fields are inlined
+	*apierr.Error
 	// Timestamp when this delta was created
 	Timestamp int64 `json:"timestamp"`
 }
@@ -92,19 +107,67 @@ func NewFinishDelta(messageID, sessionID, finishReason string) StreamDelta {
 	return StreamDelta{
 		MessageID:    messageID,
 		SessionID:    sessionID,
+		PartIndex:    -1,
 		DeltaType:    DeltaTypeFinish,
 		FinishReason: finishReason,
 		Timestamp:    time.Now().UnixMilli(),
 	}
 }
 
+// NewCancelFinishDelta creates a finish delta for a turn cut short for reason
+func NewCancelFinishDelta(messageID, sessionID string, finishReason FinishReason, reason CancelReason) StreamDelta {
+	delta := NewFinishDelta(messageID, sessionID, string(finishReason))
+	delta.CancelReason = reason
+	return delta
+}
+
 // NewErrorDelta creates a delta for error notification (shown as toast in frontend)
-func NewErrorDelta(sessionID, errorMessage string) StreamDelta {
+func NewErrorDelta(sessionID, errorMessage string, info apierr.Error) StreamDelta {
 	return StreamDelta{
 		MessageID: "",
 		SessionID: sessionID,
+		PartIndex: -1,
 		DeltaType: DeltaTypeError,
 		Content:   errorMessage,
+		Error:     &info,
 		Timestamp: time.Now().UnixMilli(),
 	}
 }
+
+// CanMerge reports whether next continues the text of d, so both can be sent
+// as one delta.
+func (d StreamDelta) CanMerge(next StreamDelta) bool {
+	return (d.DeltaType == DeltaTypeText || d.DeltaType == DeltaTypeReasoning) &&
+		next.DeltaType == d.DeltaType &&
+		next.MessageID == d.MessageID &&
+		next.PartIndex == d.PartIndex
+}
+
+// Merge appends the text of next, which CanMerge, to d.
+func (d StreamDelta) Merge(next StreamDelta) StreamDelta {
+	d.Content += next.Content
+	d.Timestamp = next.Timestamp
+	return d
+}
+
+// DeltaPartIndex returns the index of the part of m extended by delta, -1
+// when the message has no such part.
+func (m *Message) DeltaPartIndex(delta StreamDelta) int {
+	for i, part := range m.Parts {
+		switch p := part.(type) {
+		case TextContent:
+			if delta.DeltaType == DeltaTypeText {
+				return i
+			}
+		case ReasoningContent:
+			if delta.DeltaType == DeltaTypeReasoning {
+				return i
+			}
+		case ToolCall:
+			if (delta.DeltaType == DeltaTypeToolCall || delta.DeltaType == DeltaTypeToolCallInput) && p.ID == delta.ToolCallID {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,315 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/diff"
+)
+
+// ExportFormat is the format a conversation is exported to.
+type ExportFormat string
+
+const (
+	ExportMarkdown ExportFormat = "markdown"
+	ExportJSON     ExportFormat = "json"
+	ExportHTML     ExportFormat = "html"
+)
+
+// ParseExportFormat returns the export format of a name, markdown when empty.
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch f := ExportFormat(strings.ToLower(name)); f {
+	case "", "md", ExportMarkdown:
+		return ExportMarkdown, nil
+	case ExportJSON, ExportHTML:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q, expected markdown, json or html", name)
+}
+
+// Extension returns the file extension of exports in the format.
+func (f ExportFormat) Extension() string {
+	if f == ExportMarkdown {
+		return "md"
+	}
+	return string(f)
+}
+
+// ContentType returns the MIME type of exports in the format.
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportJSON:
+		return "application/json; charset=utf-8"
+	case ExportHTML:
+		return "text/html; charset=utf-8"
+	}
+	return "text/markdown; charset=utf-8"
+}
+
+// Transcript is a conversation as it is exported, with the results of the
+// tool calls attached to the calls.
+type Transcript struct {
+	SessionID        string              `json:"session_id"`
+	Title            string              `json:"title"`
+	PromptTokens     int64               `json:"prompt_tokens"`
+	CompletionTokens int64               `json:"completion_tokens"`
+	Cost             float64             `json:"cost"`
+	CreatedAt        int64               `json:"created_at"`
+	ExportedAt       int64               `json:"exported_at"`
+	Messages         []TranscriptMessage `json:"messages"`
+}
+
+// TranscriptMessage is a user or assistant message of a transcript.
+type TranscriptMessage struct {
+	ID          string               `json:"id"`
+	Role        string               `json:"role"`
+	Model       string               `json:"model,omitempty"`
+	Provider    string               `json:"provider,omitempty"`
+	Summary     bool                 `json:"summary,omitempty"`
+	Reasoning   string               `json:"reasoning,omitempty"`
+	Text        string               `json:"text,omitempty"`
+	Attachments []string             `json:"attachments,omitempty"`
+	ToolCalls   []TranscriptToolCall `json:"tool_calls,omitempty"`
+	Finish      FinishReason         `json:"finish_reason,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	CreatedAt   int64                `json:"created_at"`
+}
+
+// TranscriptToolCall is a tool call with its result and, for file edits, the diff.
+type TranscriptToolCall struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Input   string `json:"input"`
+	Result  string `json:"result,omitempty"`
+	IsError bool   `json:"is_error,omitempty"`
+	Diff    string `json:"diff,omitempty"`
+}
+
+// NewTranscript builds the transcript of the messages of a session. The
+// reasoning of the assistant is only kept with includeReasoning.
+func NewTranscript(msgs []Message, includeReasoning bool) Transcript {
+	results := make(map[string]ToolResult)
+	for _, msg := range msgs {
+		for _, result := range msg.ToolResults() {
+			results[result.ToolCallID] = result
+		}
+	}
+
+	t := Transcript{Messages: []TranscriptMessage{}}
+	for _, msg := range msgs {
+		if msg.Role == Tool || msg.Role == System {
+			continue
+		}
+		tm := TranscriptMessage{
+			ID:        msg.ID,
+			Role:      string(msg.Role),
+			Model:     msg.Model,
+			Provider:  msg.Provider,
+			Summary:   msg.IsSummaryMessage,
+			Text:      msg.Content().Text,
+			CreatedAt: msg.CreatedAt,
+		}
+		if includeReasoning {
+			tm.Reasoning = msg.ReasoningContent().Thinking
+		}
+		for _, img := range msg.ImageURLContent() {
+			tm.Attachments = append(tm.Attachments, img.URL)
+		}
+		for _, bin := range msg.BinaryContent() {
+			tm.Attachments = append(tm.Attachments, bin.Path)
+		}
+		for _, call := range msg.ToolCalls() {
+			tc := TranscriptToolCall{ID: call.ID, Name: call.Name, Input: call.Input}
+			if result, ok := results[call.ID]; ok {
+				tc.Result = result.Content
+				tc.IsError = result.IsError
+				tc.Diff = resultDiff(call, result)
+			}
+			tm.ToolCalls = append(tm.ToolCalls, tc)
+		}
+		if finish := msg.FinishPart(); finish != nil && finish.Reason != FinishReasonToolUse {
+			tm.Finish = finish.Reason
+			if finish.Reason == FinishReasonError {
+				tm.Error = strings.TrimSpace(finish.Message + " " + finish.Details)
+			}
+		}
+		t.Messages = append(t.Messages, tm)
+	}
+	return t
+}
+
+// resultDiff returns the diff recorded in the metadata of a file tool result,
+// or computed from the file contents before and after the edit.
+func resultDiff(call ToolCall, result ToolResult) string {
+	if result.Metadata == "" {
+		return ""
+	}
+	var meta struct {
+		Diff       string `json:"diff"`
+		OldContent string `json:"old_content"`
+		NewContent string `json:"new_content"`
+	}
+	if err := json.Unmarshal([]byte(result.Metadata), &meta); err != nil {
+		return ""
+	}
+	if meta.Diff != "" || meta.OldContent == meta.NewContent {
+		return meta.Diff
+	}
+	var input struct {
+		FilePath string `json:"file_path"`
+	}
+	_ = json.Unmarshal([]byte(call.Input), &input)
+	d, _, _ := diff.GenerateDiff(meta.OldContent, meta.NewContent, input.FilePath)
+	return d
+}
+
+// Render writes the transcript in a format.
+func (t Transcript) Render(w io.Writer, format ExportFormat) error {
+	switch format {
+	case ExportJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	case ExportHTML:
+		return transcriptHTML.Execute(w, t)
+	}
+	_, err := io.WriteString(w, t.markdown())
+	return err
+}
+
+func (t Transcript) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", exportTitle(t.Title))
+	fmt.Fprintf(&b, "- Session: `%s`\n", t.SessionID)
+	fmt.Fprintf(&b, "- Created: %s\n", formatExportTime(t.CreatedAt))
+	fmt.Fprintf(&b, "- Tokens: %d prompt, %d completion\n", t.PromptTokens, t.CompletionTokens)
+	fmt.Fprintf(&b, "- Cost: $%.4f\n\n", t.Cost)
+
+	for _, m := range t.Messages {
+		fmt.Fprintf(&b, "---\n\n## %s\n\n", m.heading())
+		if m.Reasoning != "" {
+			b.WriteString("<details>\n<summary>Reasoning</summary>\n\n")
+			b.WriteString(codeBlock("", m.Reasoning))
+			b.WriteString("</details>\n\n")
+		}
+		if m.Text != "" {
+			b.WriteString(strings.TrimSpace(m.Text))
+			b.WriteString("\n\n")
+		}
+		for _, a := range m.Attachments {
+			fmt.Fprintf(&b, "- Attachment: %s\n", a)
+		}
+		if len(m.Attachments) > 0 {
+			b.WriteString("\n")
+		}
+		for _, tc := range m.ToolCalls {
+			fmt.Fprintf(&b, "### Tool: %s\n\n", tc.Name)
+			b.WriteString(codeBlock("json", tc.Input))
+			if tc.Diff != "" {
+				b.WriteString(codeBlock("diff", tc.Diff))
+			}
+			if tc.Result != "" {
+				if tc.IsError {
+					b.WriteString("Error:\n\n")
+				} else {
+					b.WriteString("Result:\n\n")
+				}
+				b.WriteString(codeBlock("", tc.Result))
+			}
+		}
+		if m.Error != "" {
+			fmt.Fprintf(&b, "> Error: %s\n\n", m.Error)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// heading describes the author and time of a message.
+func (m TranscriptMessage) heading() string {
+	author := m.Role
+	if m.Summary {
+		author = "summary"
+	}
+	parts := []string{strings.ToUpper(author[:1]) + author[1:]}
+	if m.Model != "" {
+		parts = append(parts, m.Model)
+	}
+	if m.CreatedAt != 0 {
+		parts = append(parts, formatExportTime(m.CreatedAt))
+	}
+	if m.Finish != "" && m.Finish != FinishReasonEndTurn {
+		parts = append(parts, string(m.Finish))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// codeBlock fences text with more backticks than it contains in a row.
+func codeBlock(lang, text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n\n"
+}
+
+func exportTitle(title string) string {
+	if title == "" {
+		return "Untitled session"
+	}
+	return title
+}
+
+func formatExportTime(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+var transcriptHTML = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"title":   exportTitle,
+	"time":    formatExportTime,
+	"heading": TranscriptMessage.heading,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{title .Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 900px; margin: 2rem auto; padding: 0 1rem; color: #1f2328; }
+.meta { color: #59636e; }
+.message { border-top: 1px solid #d1d9e0; padding: 1rem 0; }
+.message h2 { font-size: 1rem; color: #59636e; }
+.text { white-space: pre-wrap; }
+pre { background: #f6f8fa; padding: .75rem; overflow-x: auto; border-radius: 6px; }
+.error { color: #d1242f; }
+details { margin: .5rem 0; }
+</style>
+</head>
+<body>
+<h1>{{title .Title}}</h1>
+<ul class="meta">
+<li>Session: <code>{{.SessionID}}</code></li>
+<li>Created: {{time .CreatedAt}}</li>
+<li>Tokens: {{.PromptTokens}} prompt, {{.CompletionTokens}} completion</li>
+<li>Cost: ${{printf "%.4f" .Cost}}</li>
+</ul>
+{{range .Messages}}<div class="message {{.Role}}">
+<h2>{{heading .}}</h2>
+{{if .Reasoning}}<details><summary>Reasoning</summary><pre>{{.Reasoning}}</pre></details>
+{{end}}{{if .Text}}<div class="text">{{.Text}}</div>
+{{end}}{{range .Attachments}}<p>Attachment: <a href="{{.}}">{{.}}</a></p>
+{{end}}{{range .ToolCalls}}<details><summary>Tool: {{.Name}}{{if .IsError}} <span class="error">(error)</span>{{end}}</summary>
+<pre>{{.Input}}</pre>
+{{if .Diff}}<pre>{{.Diff}}</pre>
+{{end}}{{if .Result}}<pre{{if .IsError}} class="error"{{end}}>{{.Result}}</pre>
+{{end}}</details>
+{{end}}{{if .Error}}<p class="error">Error: {{.Error}}</p>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/rolling1314/rolling-crush/infra/postgres"
@@ -12,6 +14,10 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrMessageNotInSession is returned when a message is not part of the session
+// it is looked up in.
+var ErrMessageNotInSession = errors.New("message not found in session")
+
 type CreateMessageParams struct {
 	Role             MessageRole
 	Parts            []ContentPart
@@ -24,10 +30,6 @@ type Service interface {
 	pubsub.Suscriber[Message]
 	Create(ctx context.Context, sessionID string, params CreateMessageParams) (Message, error)
 	Update(ctx context.Context, message Message) error
-	// PublishUpdate publishes a message update event to subscribers without writing to database.
-	// This is used for streaming updates where we want real-time frontend updates but don't need
-	// to persist every delta to the database. Call Update() when the message is complete.
-	PublishUpdate(message Message)
 	// PublishDelta publishes a streaming delta event. This sends only the incremental change
 	// rather than the full message, reducing bandwidth and improving streaming performance.
 	PublishDelta(delta StreamDelta)
@@ -35,8 +37,16 @@ type Service interface {
 	SubscribeDeltas(ctx context.Context) <-chan pubsub.Event[StreamDelta]
 	Get(ctx context.Context, id string) (Message, error)
 	List(ctx context.Context, sessionID string) ([]Message, error)
+	// ListPage returns a page of the messages of a session, oldest first.
+	ListPage(ctx context.Context, sessionID string, params PageParams) (Page, error)
 	Delete(ctx context.Context, id string) error
 	DeleteSessionMessages(ctx context.Context, sessionID string) error
+	// Truncate deletes a message of a session and every message after it, and
+	// returns the deleted messages, oldest first.
+	Truncate(ctx context.Context, sessionID, messageID string) ([]Message, error)
+	// Flush writes any buffered message changes to the database. It is a no-op
+	// unless the service is backed by a batching querier.
+	Flush(ctx context.Context) error
 }
 
 type service struct {
@@ -116,6 +126,26 @@ func (s *service) DeleteSessionMessages(ctx context.Context, sessionID string) e
 	return nil
 }
 
+func (s *service) Truncate(ctx context.Context, sessionID, messageID string) ([]Message, error) {
+	messages, err := s.List(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	from := slices.IndexFunc(messages, func(m Message) bool { return m.ID == messageID })
+	if from < 0 {
+		return nil, ErrMessageNotInSession
+	}
+	// Delete the newest first so that a failure leaves a consistent prefix
+	deleted := messages[from:]
+	for i := len(deleted) - 1; i >= 0; i-- {
+		if err := s.q.DeleteMessage(ctx, deleted[i].ID); err != nil {
+			return nil, err
+		}
+		s.Publish(pubsub.DeletedEvent, deleted[i])
+	}
+	return deleted, nil
+}
+
 func (s *service) Update(ctx context.Context, message Message) error {
 	parts, err := marshallParts(message.Parts)
 	if err != nil {
@@ -139,14 +169,6 @@ func (s *service) Update(ctx context.Context, message Message) error {
 	return nil
 }
 
-// PublishUpdate publishes a message update event to subscribers without writing to database.
-// This is used for streaming updates where we want real-time frontend updates but don't need
-// to persist every delta to the database.
-func (s *service) PublishUpdate(message Message) {
-	message.UpdatedAt = time.Now().Unix()
-	s.Publish(pubsub.UpdatedEvent, message)
-}
-
 // PublishDelta publishes a streaming delta event. This sends only the incremental change
 // rather than the full message, reducing bandwidth and improving streaming performance.
 func (s *service) PublishDelta(delta StreamDelta) {
@@ -181,6 +203,13 @@ func (s *service) List(ctx context.Context, sessionID string) ([]Message, error)
 	return messages, nil
 }
 
+func (s *service) Flush(ctx context.Context) error {
+	if f, ok := s.q.(postgres.Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
 func (s *service) fromDBItem(item postgres.Message) (Message, error) {
 	parts, err := unmarshallParts([]byte(item.Parts))
 	if err != nil {
@@ -209,6 +238,7 @@ const (
 	toolCallType   partType = "tool_call"
 	toolResultType partType = "tool_result"
 	finishType     partType = "finish"
+	appendixType   partType = "summary_appendix"
 )
 
 type partWrapper struct {
@@ -237,6 +267,8 @@ func marshallParts(parts []ContentPart) ([]byte, error) {
 			typ = toolResultType
 		case Finish:
 			typ = finishType
+		case SummaryAppendix:
+			typ = appendixType
 		default:
 			return nil, fmt.Errorf("unknown part type: %T", part)
 		}
@@ -311,6 +343,12 @@ func unmarshallParts(data []byte) ([]ContentPart, error) {
 				return nil, err
 			}
 			parts = append(parts, part)
+		case appendixType:
+			part := SummaryAppendix{}
+			if err := json.Unmarshal(wrapper.Data, &part); err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
 		default:
 			return nil, fmt.Errorf("unknown part type: %s", wrapper.Type)
 		}
@@ -0,0 +1,102 @@
+package message
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// ErrCursorNotFound is returned when the message a page starts from is not a
+// message of the session.
+var ErrCursorNotFound = errors.New("cursor message not found in session")
+
+// PageParams selects a page of the messages of a session. Without Before or
+// After the latest messages are returned.
+type PageParams struct {
+	Limit int
+	// Before returns the messages preceding this message ID.
+	Before string
+	// After returns the messages following this message ID.
+	After string
+}
+
+// Page is a page of the messages of a session, oldest first.
+type Page struct {
+	Messages []Message
+	// HasMore reports whether more messages exist in the paging direction:
+	// older ones for Before and the latest page, newer ones for After.
+	HasMore bool
+}
+
+func (s *service) ListPage(ctx context.Context, sessionID string, params PageParams) (Page, error) {
+	if params.Before != "" && params.After != "" {
+		return Page{}, errors.New("before and after cannot be combined")
+	}
+	if params.Limit <= 0 {
+		return Page{}, errors.New("limit must be positive")
+	}
+
+	var dbMessages []postgres.Message
+	var err error
+	if params.After != "" {
+		cursor, cursorErr := s.pageCursor(ctx, sessionID, params.After)
+		if cursorErr != nil {
+			return Page{}, cursorErr
+		}
+		dbMessages, err = s.q.ListSessionMessagesAfter(ctx, postgres.ListSessionMessagesAfterParams{
+			SessionID: sessionID,
+			CreatedAt: cursor.CreatedAt,
+			ID:        cursor.ID,
+			Limit:     int32(params.Limit + 1),
+		})
+	} else {
+		// The latest page starts before any message
+		cursor := postgres.Message{CreatedAt: math.MaxInt64}
+		if params.Before != "" {
+			if cursor, err = s.pageCursor(ctx, sessionID, params.Before); err != nil {
+				return Page{}, err
+			}
+		}
+		dbMessages, err = s.q.ListSessionMessagesBefore(ctx, postgres.ListSessionMessagesBeforeParams{
+			SessionID: sessionID,
+			CreatedAt: cursor.CreatedAt,
+			ID:        cursor.ID,
+			Limit:     int32(params.Limit + 1),
+		})
+	}
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{HasMore: len(dbMessages) > params.Limit}
+	dbMessages = dbMessages[:min(len(dbMessages), params.Limit)]
+	if params.After == "" {
+		slices.Reverse(dbMessages)
+	}
+	page.Messages = make([]Message, len(dbMessages))
+	for i, dbMessage := range dbMessages {
+		if page.Messages[i], err = s.fromDBItem(dbMessage); err != nil {
+			return Page{}, err
+		}
+	}
+	return page, nil
+}
+
+func (s *service) pageCursor(ctx context.Context, sessionID, messageID string) (postgres.Message, error) {
+	cursor, err := s.q.GetMessage(ctx, messageID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && cursor.SessionID != sessionID) {
+		return postgres.Message{}, ErrCursorNotFound
+	}
+	return cursor, err
+}
+
+// MarshalParts encodes the parts of a message with their type, as they are
+// stored, so clients can tell text, reasoning, tool calls and results apart.
+func MarshalParts(parts []ContentPart) (json.RawMessage, error) {
+	return marshallParts(parts)
+}
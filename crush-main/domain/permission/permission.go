@@ -7,7 +7,9 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -50,6 +52,7 @@ type PermissionNotification struct {
 	ToolCallID string `json:"tool_call_id"`
 	Granted    bool   `json:"granted"`
 	Denied     bool   `json:"denied"`
+	Reason     string `json:"reason,omitempty"`
 }
 
 type PermissionRequest struct {
@@ -61,6 +64,103 @@ type PermissionRequest struct {
 	Action      string `json:"action"`
 	Params      any    `json:"params"`
 	Path        string `json:"path"`
+	// Reason is the optional note the user attached to the decision, e.g. why
+	// the request was denied or under which conditions it would be approved.
+	Reason string `json:"reason,omitempty"`
+	// ApprovedHunks lists the diff hunks the user accepted when granting an
+	// edit. Nil means the whole change was approved.
+	ApprovedHunks []int `json:"approved_hunks,omitempty"`
+}
+
+// PermissionBlocking is published once when a permission request has kept
+// its run waiting for longer than the blocking threshold.
+type PermissionBlocking struct {
+	PermissionID string `json:"permission_id"`
+	SessionID    string `json:"session_id"`
+	ToolCallID   string `json:"tool_call_id"`
+	ToolName     string `json:"tool_name"`
+	Description  string `json:"description"`
+	// BlockedMs is how long the run has been waiting for the user.
+	BlockedMs int64 `json:"blocked_ms"`
+}
+
+// Decision is how the permission of a tool call was decided, kept for the
+// audit log of the tool calls.
+type Decision string
+
+const (
+	// DecisionSkipped means permission requests are disabled (yolo mode).
+	DecisionSkipped Decision = "skipped"
+	// DecisionPolicyAllow and DecisionPolicyDeny come from a policy rule.
+	DecisionPolicyAllow Decision = "policy_allow"
+	DecisionPolicyDeny  Decision = "policy_deny"
+	// DecisionAllowlist comes from the allowed tools, the session allowlist
+	// or an earlier grant for the session.
+	DecisionAllowlist Decision = "allowlist"
+	// DecisionAutoApproved means every request of the session is approved.
+	DecisionAutoApproved Decision = "auto_approved"
+	// DecisionGranted and DecisionDenied are answers of the user.
+	DecisionGranted Decision = "granted"
+	DecisionDenied  Decision = "denied"
+	// DecisionTimeout and DecisionCancelled mean the user did not answer.
+	DecisionTimeout   Decision = "timeout"
+	DecisionCancelled Decision = "cancelled"
+)
+
+// decision is the answer to a pending permission request.
+type decision struct {
+	granted bool
+	reason  string
+	hunks   []int
+	source  Decision
+}
+
+// DeniedError is returned when the user denied a permission request with a reason.
+// It matches ErrorPermissionDenied with errors.Is.
+type DeniedError struct {
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return ErrorPermissionDenied.Error() + ": " + e.Reason
+}
+
+func (e *DeniedError) Is(target error) bool {
+	return target == ErrorPermissionDenied
+}
+
+// NewDeniedError returns the error for a denied request, carrying the user's
+// reason when one was given.
+func NewDeniedError(reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrorPermissionDenied
+	}
+	return &DeniedError{Reason: reason}
+}
+
+// DenialReason returns the reason the user gave for denying a permission, if any.
+func DenialReason(err error) string {
+	var denied *DeniedError
+	if errors.As(err, &denied) {
+		return denied.Reason
+	}
+	return ""
+}
+
+// TimeoutError is returned when a permission request timed out, carrying the
+// request so that its tool call can be suspended until the user answers.
+// It matches ErrorPermissionTimeout with errors.Is.
+type TimeoutError struct {
+	Request PermissionRequest
+}
+
+func (e *TimeoutError) Error() string {
+	return ErrorPermissionTimeout.Error()
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrorPermissionTimeout
 }
 
 // PermissionTimeoutCallback is called when a permission request times out.
@@ -79,21 +179,48 @@ type Service interface {
 	// Returns (granted, error) where error is ErrorPermissionTimeout on timeout,
 	// ErrorPermissionDenied on denial, or nil on success.
 	RequestWithTimeout(ctx context.Context, opts CreatePermissionRequest, timeout time.Duration, originalPrompt string, onTimeout PermissionTimeoutCallback) (bool, error)
+	// RequestHunksWithTimeout is RequestWithTimeout for edits whose params carry
+	// diff hunks. It also returns the hunks the user approved, nil meaning all.
+	RequestHunksWithTimeout(ctx context.Context, opts CreatePermissionRequest, timeout time.Duration, originalPrompt string, onTimeout PermissionTimeoutCallback) (bool, []int, error)
 	AutoApproveSession(sessionID string)
+	// GrantToolCall grants the next request of a tool call without asking,
+	// for suspended tool calls the user approved after their request timed
+	// out. Policy deny rules still apply.
+	GrantToolCall(toolCallID string)
+	// TakeDecision returns how the permission of a tool call was decided and
+	// forgets it. It returns false for tool calls that requested none.
+	TakeDecision(toolCallID string) (Decision, bool)
 	SetSkipRequests(skip bool)
 	SkipRequests() bool
 	SubscribeNotifications(ctx context.Context) <-chan pubsub.Event[PermissionNotification]
+	// SubscribeBlocking receives the requests blocking their run for longer
+	// than the blocking threshold.
+	SubscribeBlocking(ctx context.Context) <-chan pubsub.Event[PermissionBlocking]
+	// SetBlockingThreshold sets how long a request waits before it is
+	// escalated as blocking, zero disables the escalation.
+	SetBlockingThreshold(threshold time.Duration)
 	SetAllowlistChecker(checker AllowlistChecker)
+	// SetPolicyChecker sets the lookup of the project permission policies,
+	// whose rules allow or deny requests before the user is asked. Checkers
+	// implementing ShadowPolicyChecker also get the decisions of trialed policies.
+	SetPolicyChecker(checker PolicyChecker)
+	// SetBasePolicy sets the policy rules of the configuration, evaluated
+	// together with the rules of the project policies.
+	SetBasePolicy(rules []PolicyRule) error
 }
 
 type permissionService struct {
 	*pubsub.Broker[PermissionRequest]
 
 	notificationBroker    *pubsub.Broker[PermissionNotification]
+	blockingBroker        *pubsub.Broker[PermissionBlocking]
+	blockingThreshold     atomic.Int64
 	workingDir            string
 	sessionPermissions    []PermissionRequest
 	sessionPermissionsMu  sync.RWMutex
-	pendingRequests       *csync.Map[string, chan bool]
+	pendingRequests       *csync.Map[string, chan decision]
+	decisions             *csync.Map[string, Decision] // tool call ID -> decision
+	grantedToolCalls      *csync.Map[string, bool]     // tool call IDs granted ahead of their request
 	autoApproveSessions   map[string]bool
 	autoApproveSessionsMu sync.RWMutex
 	skip                  bool
@@ -106,6 +233,12 @@ type permissionService struct {
 	// Allowlist checker for session-level tool allowlist (Redis-backed)
 	allowlistChecker   AllowlistChecker
 	allowlistCheckerMu sync.RWMutex
+
+	// Policy checker for project permission policies (database-backed) and
+	// the policy rules of the configuration
+	policyChecker   PolicyChecker
+	basePolicy      []PolicyRule
+	policyCheckerMu sync.RWMutex
 }
 
 func (s *permissionService) GrantPersistent(permission PermissionRequest) {
@@ -113,6 +246,7 @@ func (s *permissionService) GrantPersistent(permission PermissionRequest) {
 		SessionID:  permission.SessionID,
 		ToolCallID: permission.ToolCallID,
 		Granted:    true,
+		Reason:     permission.Reason,
 	})
 
 	// Track whether we found the channel
@@ -121,7 +255,7 @@ func (s *permissionService) GrantPersistent(permission PermissionRequest) {
 	// Try to find the channel by permission.ID first
 	respCh, ok := s.pendingRequests.Get(permission.ID)
 	if ok {
-		respCh <- true
+		respCh <- decision{granted: true, reason: permission.Reason, hunks: permission.ApprovedHunks}
 		channelFound = true
 		// Clear active request for this session
 		if activeReq, ok := s.sessionActiveRequest.Get(permission.SessionID); ok && activeReq != nil && activeReq.ID == permission.ID {
@@ -139,7 +273,7 @@ func (s *permissionService) GrantPersistent(permission PermissionRequest) {
 				"received_permission_id", permission.ID,
 			)
 			if ch, chOk := s.pendingRequests.Get(activeReq.ID); chOk {
-				ch <- true
+				ch <- decision{granted: true, reason: permission.Reason, hunks: permission.ApprovedHunks}
 				channelFound = true
 				s.sessionActiveRequest.Del(permission.SessionID)
 			}
@@ -164,12 +298,13 @@ func (s *permissionService) Grant(permission PermissionRequest) {
 		SessionID:  permission.SessionID,
 		ToolCallID: permission.ToolCallID,
 		Granted:    true,
+		Reason:     permission.Reason,
 	})
 
 	// Try to find the channel by permission.ID first
 	respCh, ok := s.pendingRequests.Get(permission.ID)
 	if ok {
-		respCh <- true
+		respCh <- decision{granted: true, reason: permission.Reason, hunks: permission.ApprovedHunks}
 		// Clear active request for this session
 		if activeReq, ok := s.sessionActiveRequest.Get(permission.SessionID); ok && activeReq != nil && activeReq.ID == permission.ID {
 			s.sessionActiveRequest.Del(permission.SessionID)
@@ -188,7 +323,7 @@ func (s *permissionService) Grant(permission PermissionRequest) {
 				"received_permission_id", permission.ID,
 			)
 			if ch, chOk := s.pendingRequests.Get(activeReq.ID); chOk {
-				ch <- true
+				ch <- decision{granted: true, reason: permission.Reason, hunks: permission.ApprovedHunks}
 				s.sessionActiveRequest.Del(permission.SessionID)
 				return
 			}
@@ -209,6 +344,7 @@ func (s *permissionService) GrantForSession(permission PermissionRequest) {
 		SessionID:  permission.SessionID,
 		ToolCallID: permission.ToolCallID,
 		Granted:    true,
+		Reason:     permission.Reason,
 	})
 
 	// Track whether we found the channel (to avoid duplicate allowlist additions)
@@ -217,7 +353,7 @@ func (s *permissionService) GrantForSession(permission PermissionRequest) {
 	// Try to find the channel by permission.ID first
 	respCh, ok := s.pendingRequests.Get(permission.ID)
 	if ok {
-		respCh <- true
+		respCh <- decision{granted: true, reason: permission.Reason, hunks: permission.ApprovedHunks}
 		channelFound = true
 		// Clear active request for this session
 		if activeReq, ok := s.sessionActiveRequest.Get(permission.SessionID); ok && activeReq != nil && activeReq.ID == permission.ID {
@@ -236,7 +372,7 @@ func (s *permissionService) GrantForSession(permission PermissionRequest) {
 				"received_permission_id", permission.ID,
 			)
 			if ch, chOk := s.pendingRequests.Get(activeReq.ID); chOk {
-				ch <- true
+				ch <- decision{granted: true, reason: permission.Reason, hunks: permission.ApprovedHunks}
 				channelFound = true
 				s.sessionActiveRequest.Del(permission.SessionID)
 			}
@@ -292,12 +428,13 @@ func (s *permissionService) Deny(permission PermissionRequest) {
 		ToolCallID: permission.ToolCallID,
 		Granted:    false,
 		Denied:     true,
+		Reason:     permission.Reason,
 	})
 
 	// Try to find the channel by permission.ID first
 	respCh, ok := s.pendingRequests.Get(permission.ID)
 	if ok {
-		respCh <- false
+		respCh <- decision{granted: false, reason: permission.Reason}
 		// Clear active request for this session
 		if activeReq, ok := s.sessionActiveRequest.Get(permission.SessionID); ok && activeReq != nil && activeReq.ID == permission.ID {
 			s.sessionActiveRequest.Del(permission.SessionID)
@@ -316,7 +453,7 @@ func (s *permissionService) Deny(permission PermissionRequest) {
 				"received_permission_id", permission.ID,
 			)
 			if ch, chOk := s.pendingRequests.Get(activeReq.ID); chOk {
-				ch <- false
+				ch <- decision{granted: false, reason: permission.Reason}
 				s.sessionActiveRequest.Del(permission.SessionID)
 				return
 			}
@@ -347,9 +484,17 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	sessionMu.Lock()
 	defer sessionMu.Unlock()
 
+	// Project policy rules come first, so deny rules also hold for allowed tools
+	rule := s.evaluatePolicy(context.Background(), opts)
+	if rule != nil && rule.Effect != PolicyAsk {
+		return rule.Effect == PolicyAllow
+	}
+	// Ask rules skip the allowlists and earlier grants
+	ask := rule != nil
+
 	// Check if the tool/action combination is in the static allowlist
 	commandKey := opts.ToolName + ":" + opts.Action
-	if slices.Contains(s.allowedTools, commandKey) || slices.Contains(s.allowedTools, opts.ToolName) {
+	if !ask && (slices.Contains(s.allowedTools, commandKey) || slices.Contains(s.allowedTools, opts.ToolName)) {
 		return true
 	}
 
@@ -357,7 +502,7 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	autoApprove := s.autoApproveSessions[opts.SessionID]
 	s.autoApproveSessionsMu.RUnlock()
 
-	if autoApprove {
+	if autoApprove && !ask {
 		return true
 	}
 
@@ -380,7 +525,7 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	checker := s.allowlistChecker
 	s.allowlistCheckerMu.RUnlock()
 
-	if checker != nil {
+	if checker != nil && !ask {
 		ctx := context.Background()
 		allowed, err := checker.IsToolAllowedInSession(ctx, opts.SessionID, opts.ToolName, opts.Action, dir)
 		if err != nil {
@@ -413,7 +558,7 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	// Check in-memory session permissions (for backward compatibility)
 	s.sessionPermissionsMu.RLock()
 	for _, p := range s.sessionPermissions {
-		if p.ToolName == permission.ToolName && p.Action == permission.Action && p.SessionID == permission.SessionID && p.Path == permission.Path {
+		if !ask && p.ToolName == permission.ToolName && p.Action == permission.Action && p.SessionID == permission.SessionID && p.Path == permission.Path {
 			s.sessionPermissionsMu.RUnlock()
 			return true
 		}
@@ -423,14 +568,14 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	// Set active request for this session
 	s.sessionActiveRequest.Set(opts.SessionID, &permission)
 
-	respCh := make(chan bool, 1)
+	respCh := make(chan decision, 1)
 	s.pendingRequests.Set(permission.ID, respCh)
 	defer s.pendingRequests.Del(permission.ID)
 
 	// Publish the request
 	s.Publish(pubsub.CreatedEvent, permission)
 
-	return <-respCh
+	return (<-respCh).granted
 }
 
 // RequestWithTimeout requests permission with a timeout.
@@ -440,9 +585,35 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 // - ErrorPermissionTimeout if timeout occurs
 // - ctx.Err() if context is cancelled
 func (s *permissionService) RequestWithTimeout(ctx context.Context, opts CreatePermissionRequest, timeout time.Duration, originalPrompt string, onTimeout PermissionTimeoutCallback) (bool, error) {
+	d, err := s.requestWithTimeout(ctx, opts, timeout, originalPrompt, onTimeout)
+	s.recordDecision(opts.ToolCallID, d.source)
+	return d.granted, err
+}
+
+func (s *permissionService) RequestHunksWithTimeout(ctx context.Context, opts CreatePermissionRequest, timeout time.Duration, originalPrompt string, onTimeout PermissionTimeoutCallback) (bool, []int, error) {
+	d, err := s.requestWithTimeout(ctx, opts, timeout, originalPrompt, onTimeout)
+	s.recordDecision(opts.ToolCallID, d.source)
+	return d.granted, d.hunks, err
+}
+
+// recordDecision keeps the decision of a tool call until TakeDecision. The
+// last request of a tool call wins, as tools stop at the first refusal.
+func (s *permissionService) recordDecision(toolCallID string, d Decision) {
+	if toolCallID == "" || d == "" {
+		return
+	}
+	s.decisions.Set(toolCallID, d)
+}
+
+func (s *permissionService) TakeDecision(toolCallID string) (Decision, bool) {
+	return s.decisions.Take(toolCallID)
+}
+
+func (s *permissionService) requestWithTimeout(ctx context.Context, opts CreatePermissionRequest, timeout time.Duration, originalPrompt string, onTimeout PermissionTimeoutCallback) (decision, error) {
 	if s.skip {
-		return true, nil
+		return decision{granted: true, source: DecisionSkipped}, nil
 	}
+	granted := decision{granted: true, source: DecisionAllowlist}
 
 	// Get or create per-session mutex
 	sessionMu, _ := s.sessionRequestMu.Get(opts.SessionID)
@@ -453,18 +624,32 @@ func (s *permissionService) RequestWithTimeout(ctx context.Context, opts CreateP
 	sessionMu.Lock()
 	defer sessionMu.Unlock()
 
+	// Project policy rules come first, so deny rules also hold for allowed tools
+	rule := s.evaluatePolicy(ctx, opts)
+	if rule != nil && rule.Effect == PolicyDeny {
+		return decision{source: DecisionPolicyDeny}, NewDeniedError("denied by the permission policy: " + rule.String())
+	}
+	if rule != nil && rule.Effect == PolicyAllow {
+		return decision{granted: true, source: DecisionPolicyAllow}, nil
+	}
+	if _, ok := s.grantedToolCalls.Take(opts.ToolCallID); ok {
+		return decision{granted: true, source: DecisionGranted}, nil
+	}
+	// Ask rules skip the allowlists and earlier grants
+	ask := rule != nil
+
 	// Check if the tool/action combination is in the static allowlist
 	commandKey := opts.ToolName + ":" + opts.Action
-	if slices.Contains(s.allowedTools, commandKey) || slices.Contains(s.allowedTools, opts.ToolName) {
-		return true, nil
+	if !ask && (slices.Contains(s.allowedTools, commandKey) || slices.Contains(s.allowedTools, opts.ToolName)) {
+		return granted, nil
 	}
 
 	s.autoApproveSessionsMu.RLock()
 	autoApprove := s.autoApproveSessions[opts.SessionID]
 	s.autoApproveSessionsMu.RUnlock()
 
-	if autoApprove {
-		return true, nil
+	if autoApprove && !ask {
+		return decision{granted: true, source: DecisionAutoApproved}, nil
 	}
 
 	fileInfo, err := os.Stat(opts.Path)
@@ -486,7 +671,7 @@ func (s *permissionService) RequestWithTimeout(ctx context.Context, opts CreateP
 	checker := s.allowlistChecker
 	s.allowlistCheckerMu.RUnlock()
 
-	if checker != nil {
+	if checker != nil && !ask {
 		allowed, err := checker.IsToolAllowedInSession(ctx, opts.SessionID, opts.ToolName, opts.Action, dir)
 		if err != nil {
 			slog.Warn("Failed to check session allowlist",
@@ -500,7 +685,7 @@ func (s *permissionService) RequestWithTimeout(ctx context.Context, opts CreateP
 				"tool_name", opts.ToolName,
 				"action", opts.Action,
 			)
-			return true, nil
+			return granted, nil
 		}
 	}
 
@@ -518,9 +703,9 @@ func (s *permissionService) RequestWithTimeout(ctx context.Context, opts CreateP
 	// Check in-memory session permissions (for backward compatibility)
 	s.sessionPermissionsMu.RLock()
 	for _, p := range s.sessionPermissions {
-		if p.ToolName == permission.ToolName && p.Action == permission.Action && p.SessionID == permission.SessionID && p.Path == permission.Path {
+		if !ask && p.ToolName == permission.ToolName && p.Action == permission.Action && p.SessionID == permission.SessionID && p.Path == permission.Path {
 			s.sessionPermissionsMu.RUnlock()
-			return true, nil
+			return granted, nil
 		}
 	}
 	s.sessionPermissionsMu.RUnlock()
@@ -528,7 +713,7 @@ func (s *permissionService) RequestWithTimeout(ctx context.Context, opts CreateP
 	// Set active request for this session
 	s.sessionActiveRequest.Set(opts.SessionID, &permission)
 
-	respCh := make(chan bool, 1)
+	respCh := make(chan decision, 1)
 	s.pendingRequests.Set(permission.ID, respCh)
 	defer func() {
 		s.pendingRequests.Del(permission.ID)
@@ -548,45 +733,85 @@ func (s *permissionService) RequestWithTimeout(ctx context.Context, opts CreateP
 		"timeout", timeout,
 	)
 
+	requestedAt := time.Now()
+	timeoutTimer := time.NewTimer(timeout)
+	defer timeoutTimer.Stop()
+
+	// Escalate once when the request keeps the run waiting for too long
+	var blocking <-chan time.Time
+	if threshold := time.Duration(s.blockingThreshold.Load()); threshold > 0 && threshold < timeout {
+		blockingTimer := time.NewTimer(threshold)
+		defer blockingTimer.Stop()
+		blocking = blockingTimer.C
+	}
+
 	// Wait with timeout
-	select {
-	case granted := <-respCh:
-		if granted {
-			slog.Info("[GOROUTINE] Permission granted",
+	for {
+		select {
+		case <-blocking:
+			blocking = nil
+			blocked := time.Since(requestedAt)
+			slog.Warn("[GOROUTINE] Permission request is blocking the run",
 				"permission_id", permission.ID,
 				"session_id", opts.SessionID,
+				"tool_name", opts.ToolName,
+				"blocked", blocked,
 			)
-			return true, nil
-		}
-		slog.Info("[GOROUTINE] Permission denied",
-			"permission_id", permission.ID,
-			"session_id", opts.SessionID,
-		)
-		return false, ErrorPermissionDenied
+			s.blockingBroker.Publish(pubsub.CreatedEvent, PermissionBlocking{
+				PermissionID: permission.ID,
+				SessionID:    permission.SessionID,
+				ToolCallID:   permission.ToolCallID,
+				ToolName:     permission.ToolName,
+				Description:  permission.Description,
+				BlockedMs:    blocked.Milliseconds(),
+			})
+			continue
+
+		case d := <-respCh:
+			d.source = DecisionDenied
+			if d.granted {
+				d.source = DecisionGranted
+				slog.Info("[GOROUTINE] Permission granted",
+					"permission_id", permission.ID,
+					"session_id", opts.SessionID,
+				)
+				return d, nil
+			}
+			slog.Info("[GOROUTINE] Permission denied",
+				"permission_id", permission.ID,
+				"session_id", opts.SessionID,
+				"reason", d.reason,
+			)
+			return d, NewDeniedError(d.reason)
 
-	case <-time.After(timeout):
-		slog.Warn("[GOROUTINE] Permission request timed out",
-			"permission_id", permission.ID,
-			"session_id", opts.SessionID,
-			"tool_name", opts.ToolName,
-			"timeout", timeout,
-		)
-		// Call the timeout callback to persist state
-		if onTimeout != nil {
-			onTimeout(permission, originalPrompt)
-		}
-		return false, ErrorPermissionTimeout
+		case <-timeoutTimer.C:
+			slog.Warn("[GOROUTINE] Permission request timed out",
+				"permission_id", permission.ID,
+				"session_id", opts.SessionID,
+				"tool_name", opts.ToolName,
+				"timeout", timeout,
+			)
+			// Call the timeout callback to persist state
+			if onTimeout != nil {
+				onTimeout(permission, originalPrompt)
+			}
+			return decision{source: DecisionTimeout}, &TimeoutError{Request: permission}
 
-	case <-ctx.Done():
-		slog.Info("[GOROUTINE] Permission request cancelled",
-			"permission_id", permission.ID,
-			"session_id", opts.SessionID,
-			"reason", ctx.Err(),
-		)
-		return false, ctx.Err()
+		case <-ctx.Done():
+			slog.Info("[GOROUTINE] Permission request cancelled",
+				"permission_id", permission.ID,
+				"session_id", opts.SessionID,
+				"reason", ctx.Err(),
+			)
+			return decision{source: DecisionCancelled}, ctx.Err()
+		}
 	}
 }
 
+func (s *permissionService) GrantToolCall(toolCallID string) {
+	s.grantedToolCalls.Set(toolCallID, true)
+}
+
 func (s *permissionService) AutoApproveSession(sessionID string) {
 	s.autoApproveSessionsMu.Lock()
 	s.autoApproveSessions[sessionID] = true
@@ -597,6 +822,14 @@ func (s *permissionService) SubscribeNotifications(ctx context.Context) <-chan p
 	return s.notificationBroker.Subscribe(ctx)
 }
 
+func (s *permissionService) SubscribeBlocking(ctx context.Context) <-chan pubsub.Event[PermissionBlocking] {
+	return s.blockingBroker.Subscribe(ctx)
+}
+
+func (s *permissionService) SetBlockingThreshold(threshold time.Duration) {
+	s.blockingThreshold.Store(int64(threshold))
+}
+
 func (s *permissionService) SetSkipRequests(skip bool) {
 	s.skip = skip
 }
@@ -614,16 +847,77 @@ func (s *permissionService) SetAllowlistChecker(checker AllowlistChecker) {
 	slog.Info("Allowlist checker set for permission service")
 }
 
+// SetPolicyChecker sets the lookup of the project permission policies.
+func (s *permissionService) SetPolicyChecker(checker PolicyChecker) {
+	s.policyCheckerMu.Lock()
+	s.policyChecker = checker
+	s.policyCheckerMu.Unlock()
+}
+
+// SetBasePolicy sets the policy rules of the configuration.
+func (s *permissionService) SetBasePolicy(rules []PolicyRule) error {
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	s.policyCheckerMu.Lock()
+	s.basePolicy = slices.Clone(rules)
+	s.policyCheckerMu.Unlock()
+	return nil
+}
+
+// evaluatePolicy returns the policy rule deciding a request, nil when the
+// user has to be asked without an ask rule. The rules of the configuration
+// are evaluated with the ones of the project of the session. A policy trialed
+// in shadow mode is evaluated too, its decision is only recorded.
+func (s *permissionService) evaluatePolicy(ctx context.Context, opts CreatePermissionRequest) *PolicyRule {
+	s.policyCheckerMu.RLock()
+	checker := s.policyChecker
+	rules := s.basePolicy
+	s.policyCheckerMu.RUnlock()
+
+	workdir := s.workingDir
+	if checker != nil {
+		projectRules, projectWorkdir, err := checker.SessionPolicy(ctx, opts.SessionID)
+		if err != nil {
+			slog.Warn("Failed to get project permission policy",
+				"error", err,
+				"session_id", opts.SessionID,
+			)
+		} else if projectRules != nil {
+			rules = append(slices.Clone(rules), projectRules...)
+			workdir = projectWorkdir
+		}
+	}
+
+	rule := EvaluatePolicy(rules, workdir, opts)
+	if checker != nil {
+		shadowPolicy(ctx, checker, opts, rule)
+	}
+	if rule != nil {
+		slog.Info("Permission request decided by policy",
+			"session_id", opts.SessionID,
+			"tool_name", opts.ToolName,
+			"rule", rule.String(),
+		)
+	}
+	return rule
+}
+
 func NewPermissionService(workingDir string, skip bool, allowedTools []string) Service {
 	return &permissionService{
 		Broker:               pubsub.NewBroker[PermissionRequest](),
 		notificationBroker:   pubsub.NewBroker[PermissionNotification](),
+		blockingBroker:       pubsub.NewBroker[PermissionBlocking](),
 		workingDir:           workingDir,
 		sessionPermissions:   make([]PermissionRequest, 0),
 		autoApproveSessions:  make(map[string]bool),
 		skip:                 skip,
 		allowedTools:         allowedTools,
-		pendingRequests:      csync.NewMap[string, chan bool](),
+		pendingRequests:      csync.NewMap[string, chan decision](),
+		decisions:            csync.NewMap[string, Decision](),
+		grantedToolCalls:     csync.NewMap[string, bool](),
 		sessionRequestMu:     csync.NewMap[string, *sync.Mutex](),
 		sessionActiveRequest: csync.NewMap[string, *PermissionRequest](),
 	}
@@ -1,10 +1,14 @@
 package permission
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPermissionService_AllowedCommands(t *testing.T) {
@@ -245,3 +249,168 @@ func TestPermissionService_SequentialProperties(t *testing.T) {
 		assert.True(t, result, "Repeated request should be auto-approved due to persistent permission")
 	})
 }
+
+func TestPermissionService_DenialReason(t *testing.T) {
+	service := NewPermissionService("/tmp", false, []string{})
+	events := service.Subscribe(t.Context())
+	notifications := service.SubscribeNotifications(t.Context())
+
+	req := CreatePermissionRequest{
+		SessionID:  "reason-session",
+		ToolCallID: "call-1",
+		ToolName:   "bash",
+		Action:     "execute",
+		Path:       "/tmp",
+	}
+
+	var granted bool
+	var err error
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		granted, err = service.RequestWithTimeout(t.Context(), req, time.Minute, "", nil)
+	})
+
+	permissionReq := (<-events).Payload
+	permissionReq.Reason = "use the staging DB instead"
+	service.Deny(permissionReq)
+	wg.Wait()
+
+	assert.False(t, granted)
+	assert.True(t, errors.Is(err, ErrorPermissionDenied))
+	assert.Equal(t, "use the staging DB instead", DenialReason(err))
+	assert.Equal(t, "user denied permission: use the staging DB instead", err.Error())
+
+	decision, ok := service.TakeDecision("call-1")
+	assert.True(t, ok)
+	assert.Equal(t, DecisionDenied, decision)
+	_, ok = service.TakeDecision("call-1")
+	assert.False(t, ok, "decisions are forgotten once taken")
+
+	notification := (<-notifications).Payload
+	assert.True(t, notification.Denied)
+	assert.Equal(t, "use the staging DB instead", notification.Reason)
+
+	t.Run("without reason", func(t *testing.T) {
+		assert.Equal(t, ErrorPermissionDenied, NewDeniedError("  "))
+		assert.Empty(t, DenialReason(ErrorPermissionDenied))
+	})
+}
+
+func TestPermissionService_ApprovedHunks(t *testing.T) {
+	service := NewPermissionService("/tmp", false, []string{})
+	events := service.Subscribe(t.Context())
+
+	req := CreatePermissionRequest{
+		SessionID:  "hunks-session",
+		ToolCallID: "call-1",
+		ToolName:   "edit",
+		Action:     "edit",
+		Path:       "/tmp",
+	}
+
+	var granted bool
+	var hunks []int
+	var err error
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		granted, hunks, err = service.RequestHunksWithTimeout(t.Context(), req, time.Minute, "", nil)
+	})
+
+	permissionReq := (<-events).Payload
+	permissionReq.ApprovedHunks = []int{0, 2}
+	service.Grant(permissionReq)
+	wg.Wait()
+
+	require.NoError(t, err)
+	assert.True(t, granted)
+	assert.Equal(t, []int{0, 2}, hunks)
+	decision, _ := service.TakeDecision("call-1")
+	assert.Equal(t, DecisionGranted, decision)
+
+	t.Run("skipped requests approve everything", func(t *testing.T) {
+		skipping := NewPermissionService("/tmp", true, []string{})
+		granted, hunks, err := skipping.RequestHunksWithTimeout(t.Context(), req, time.Minute, "", nil)
+		require.NoError(t, err)
+		assert.True(t, granted)
+		assert.Nil(t, hunks)
+		decision, _ := skipping.TakeDecision("call-1")
+		assert.Equal(t, DecisionSkipped, decision)
+	})
+}
+
+func TestPermissionService_BlockingEscalation(t *testing.T) {
+	service := NewPermissionService("/tmp", false, []string{})
+	service.SetBlockingThreshold(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	blockingCh := service.SubscribeBlocking(ctx)
+	requests := service.Subscribe(ctx)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := service.RequestWithTimeout(ctx, CreatePermissionRequest{
+			SessionID:  "session1",
+			ToolCallID: "call1",
+			ToolName:   "bash",
+			Action:     "execute",
+			Path:       "/tmp",
+		}, time.Second, "", nil)
+		result <- err
+	}()
+
+	req := (<-requests).Payload
+	select {
+	case event := <-blockingCh:
+		assert.Equal(t, req.ID, event.Payload.PermissionID)
+		assert.Equal(t, "session1", event.Payload.SessionID)
+		assert.Equal(t, "bash", event.Payload.ToolName)
+		assert.GreaterOrEqual(t, event.Payload.BlockedMs, int64(20))
+	case <-time.After(time.Second):
+		t.Fatal("expected a blocking event")
+	}
+
+	service.Grant(req)
+	require.NoError(t, <-result)
+
+	select {
+	case event := <-blockingCh:
+		t.Fatalf("unexpected second blocking event %+v", event.Payload)
+	default:
+	}
+}
+
+func TestPermissionService_TimeoutAndResumedGrant(t *testing.T) {
+	service := NewPermissionService("/tmp", false, []string{})
+	req := CreatePermissionRequest{
+		SessionID:  "resume-session",
+		ToolCallID: "call-1",
+		ToolName:   "edit",
+		Action:     "write",
+		Path:       "/tmp",
+	}
+
+	var suspended PermissionRequest
+	granted, err := service.RequestWithTimeout(t.Context(), req, 10*time.Millisecond, "fix the tests", func(req PermissionRequest, _ string) {
+		suspended = req
+	})
+	require.False(t, granted)
+	require.ErrorIs(t, err, ErrorPermissionTimeout)
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, suspended, timeoutErr.Request)
+	assert.Equal(t, "call-1", timeoutErr.Request.ToolCallID)
+	assert.Equal(t, "write", timeoutErr.Request.Action)
+
+	// The user grants the suspended call, it runs again without asking once
+	service.GrantToolCall("call-1")
+	granted, err = service.RequestWithTimeout(t.Context(), req, 10*time.Millisecond, "", nil)
+	require.NoError(t, err)
+	require.True(t, granted)
+	decision, ok := service.TakeDecision("call-1")
+	require.True(t, ok)
+	assert.Equal(t, DecisionGranted, decision)
+
+	_, err = service.RequestWithTimeout(t.Context(), req, 10*time.Millisecond, "", nil)
+	require.ErrorIs(t, err, ErrorPermissionTimeout, "the grant is used up")
+}
@@ -0,0 +1,295 @@
+package permission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// PolicyEffect is what a project permission rule does with the requests it matches.
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+	// PolicyAsk has the user asked, even for tools that are allowed otherwise.
+	PolicyAsk PolicyEffect = "ask"
+)
+
+// PolicyRule is a rule of the permission policy of a project. It matches the
+// requests of Tool whose subject matches Pattern or Regex: the command for
+// bash, the host for fetches and the file path for the other tools. A rule
+// without either matches every request of the tool.
+type PolicyRule struct {
+	Effect PolicyEffect `json:"effect"`
+	// Tool is a tool name, "mcp_github_*" matching every tool of an MCP server.
+	Tool string `json:"tool"`
+	// Action restricts the rule to the requests of an action of the tool,
+	// e.g. "execute" or "write". It may contain wildcards.
+	Action string `json:"action,omitempty"`
+	// Pattern is a command ending in " *" to match its arguments, a host
+	// ("*.example.com") or a glob of paths relative to the project ("src/**"),
+	// absolute when it starts with a slash.
+	Pattern string `json:"pattern,omitempty"`
+	// Regex is a regular expression the subject has to match instead of
+	// Pattern, e.g. `^go (build|test)( |$)` for commands.
+	Regex string `json:"regex,omitempty"`
+	// Source is the setting the rule was imported from, e.g. "Bash(npm test:*)".
+	Source string `json:"source,omitempty"`
+}
+
+// PolicyChecker looks up the permission policy of the project of a session.
+// This is typically implemented by the WebSocket app from the database.
+type PolicyChecker interface {
+	SessionPolicy(ctx context.Context, sessionID string) (rules []PolicyRule, workdir string, err error)
+}
+
+// String formats the rule for logs and denial reasons.
+func (r PolicyRule) String() string {
+	tool := r.Tool
+	if r.Action != "" {
+		tool += ":" + r.Action
+	}
+	switch {
+	case r.Regex != "":
+		return fmt.Sprintf("%s %s(/%s/)", r.Effect, tool, r.Regex)
+	case r.Pattern != "":
+		return fmt.Sprintf("%s %s(%s)", r.Effect, tool, r.Pattern)
+	default:
+		return fmt.Sprintf("%s %s", r.Effect, tool)
+	}
+}
+
+// Validate checks the effect, tool, action and pattern of the rule.
+func (r PolicyRule) Validate() error {
+	if r.Effect != PolicyAllow && r.Effect != PolicyDeny && r.Effect != PolicyAsk {
+		return fmt.Errorf("invalid policy effect %q", r.Effect)
+	}
+	if r.Tool == "" {
+		return fmt.Errorf("policy rule has no tool")
+	}
+	if _, err := path.Match(r.Tool, ""); err != nil {
+		return fmt.Errorf("invalid policy tool %q", r.Tool)
+	}
+	if _, err := path.Match(r.Action, ""); err != nil {
+		return fmt.Errorf("invalid policy action %q", r.Action)
+	}
+	if r.Pattern != "" && r.Regex != "" {
+		return fmt.Errorf("policy rule %s has both a pattern and a regex", r.Tool)
+	}
+	if r.Pattern != "" && policySubjectKind(r.Tool) != policySubjectCommand && !doublestar.ValidatePattern(r.Pattern) {
+		return fmt.Errorf("invalid policy pattern %q", r.Pattern)
+	}
+	if _, err := regexp.Compile(r.Regex); err != nil {
+		return fmt.Errorf("invalid policy regex %q: %w", r.Regex, err)
+	}
+	return nil
+}
+
+type policySubject int
+
+const (
+	policySubjectPath policySubject = iota
+	policySubjectCommand
+	policySubjectHost
+)
+
+func policySubjectKind(tool string) policySubject {
+	switch tool {
+	case "bash":
+		return policySubjectCommand
+	case "fetch", "agentic_fetch", "web_fetch", "download":
+		return policySubjectHost
+	default:
+		return policySubjectPath
+	}
+}
+
+// EvaluatePolicy returns the rule deciding a permission request, nil when the
+// policy does not decide it and the user is asked. Deny rules take precedence
+// over ask rules, which take precedence over allow rules. Compound bash
+// commands are denied or asked when any of their commands is and only allowed
+// when all of them are. workdir is the project directory the relative path
+// patterns apply to.
+func EvaluatePolicy(rules []PolicyRule, workdir string, opts CreatePermissionRequest) *PolicyRule {
+	kind := policySubjectKind(opts.ToolName)
+	subjects := requestSubjects(kind, workdir, opts)
+	allowable := len(subjects) > 0
+	if kind == policySubjectCommand {
+		// Substitutions run commands the rules cannot see
+		command := requestParam(opts.Params, "command")
+		allowable = allowable && !strings.Contains(command, "$(") && !strings.Contains(command, "`")
+	}
+
+	var allowed []*PolicyRule
+	for _, effect := range []PolicyEffect{PolicyDeny, PolicyAsk, PolicyAllow} {
+		for _, subject := range subjects {
+			var match *PolicyRule
+			for i := range rules {
+				rule := &rules[i]
+				if rule.Effect == effect && rule.matches(kind, subject, opts) {
+					match = rule
+					break
+				}
+			}
+			if effect != PolicyAllow && match != nil {
+				return match
+			}
+			if effect == PolicyAllow {
+				allowed = append(allowed, match)
+			}
+		}
+	}
+	if !allowable {
+		return nil
+	}
+	for _, rule := range allowed {
+		if rule == nil {
+			return nil
+		}
+	}
+	return allowed[0]
+}
+
+func (r *PolicyRule) matches(kind policySubject, subject string, opts CreatePermissionRequest) bool {
+	if ok, _ := path.Match(r.Tool, opts.ToolName); !ok {
+		return false
+	}
+	if r.Action != "" {
+		if ok, _ := path.Match(r.Action, opts.Action); !ok {
+			return false
+		}
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		return err == nil && re.MatchString(subject)
+	}
+	if r.Pattern == "" {
+		return true
+	}
+	switch kind {
+	case policySubjectCommand:
+		if prefix, ok := strings.CutSuffix(r.Pattern, " *"); ok {
+			return subject == prefix || strings.HasPrefix(subject, prefix+" ")
+		}
+		if prefix, ok := strings.CutSuffix(r.Pattern, "*"); ok {
+			return strings.HasPrefix(subject, prefix)
+		}
+		return subject == r.Pattern
+	case policySubjectHost:
+		ok, _ := path.Match(r.Pattern, subject)
+		return ok
+	default:
+		pattern := r.Pattern
+		if strings.HasPrefix(subject, "/") != strings.HasPrefix(pattern, "/") {
+			return false
+		}
+		// Like gitignore, a pattern without a slash matches at any depth
+		if !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		if ok, _ := doublestar.Match(pattern, subject); ok {
+			return true
+		}
+		// A directory pattern also matches the files below it
+		ok, _ := doublestar.Match(strings.TrimSuffix(pattern, "/")+"/**", subject)
+		return ok
+	}
+}
+
+// requestSubjects returns what the rules of a request match against: the
+// commands of a bash command line, the host of a fetched URL or the path of
+// a file, relative to workdir when it is inside of it.
+func requestSubjects(kind policySubject, workdir string, opts CreatePermissionRequest) []string {
+	switch kind {
+	case policySubjectCommand:
+		return splitCommand(requestParam(opts.Params, "command"))
+	case policySubjectHost:
+		u, err := url.Parse(requestParam(opts.Params, "url"))
+		if err != nil || u.Hostname() == "" {
+			return nil
+		}
+		return []string{strings.ToLower(u.Hostname())}
+	default:
+		file := requestParam(opts.Params, "file_path")
+		if file == "" {
+			file = opts.Path
+		}
+		if file == "" {
+			// Only rules without a pattern match, e.g. for MCP tools
+			return []string{""}
+		}
+		file = path.Clean(file)
+		workdir = strings.TrimRight(workdir, "/")
+		if rel, ok := strings.CutPrefix(file, workdir+"/"); ok && workdir != "" {
+			return []string{rel}
+		}
+		if file == workdir {
+			return []string{"."}
+		}
+		return []string{file}
+	}
+}
+
+// requestParam returns a string field of the params of a request, e.g. the
+// command of bash permission params.
+func requestParam(params any, key string) string {
+	if params == nil {
+		return ""
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ""
+	}
+	s, _ := fields[key].(string)
+	return s
+}
+
+// splitCommand splits a command line into its commands at the shell control
+// operators, so each of them is checked against the policy.
+func splitCommand(command string) []string {
+	var commands []string
+	for _, line := range strings.FieldsFunc(command, func(r rune) bool { return r == '\n' || r == ';' }) {
+		line = strings.NewReplacer("&&", "\x00", "||", "\x00", "|", "\x00", "&", "\x00").Replace(line)
+		for _, cmd := range strings.Split(line, "\x00") {
+			if cmd = strings.Join(strings.Fields(cmd), " "); cmd != "" {
+				commands = append(commands, cmd)
+			}
+		}
+	}
+	return commands
+}
+
+// MergePolicyRules appends the rules of add missing from rules, returning the
+// merged policy and the rules that were added.
+func MergePolicyRules(rules, add []PolicyRule) (merged, added []PolicyRule) {
+	type key struct {
+		effect                       PolicyEffect
+		tool, action, pattern, regex string
+	}
+	seen := map[key]bool{}
+	merged = append([]PolicyRule{}, rules...)
+	for _, rule := range rules {
+		seen[key{rule.Effect, rule.Tool, rule.Action, rule.Pattern, rule.Regex}] = true
+	}
+	for _, rule := range add {
+		k := key{rule.Effect, rule.Tool, rule.Action, rule.Pattern, rule.Regex}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		merged = append(merged, rule)
+		added = append(added, rule)
+	}
+	return merged, added
+}
@@ -0,0 +1,161 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Settings formats a project permission policy can be imported from.
+const (
+	// PolicyFormatClaudeCode is the permissions of a Claude Code settings.json.
+	PolicyFormatClaudeCode = "claude-code"
+	// PolicyFormatCursor is the permissions of a Cursor CLI cli.json.
+	PolicyFormatCursor = "cursor"
+)
+
+// PolicyImport is the result of converting settings to policy rules.
+type PolicyImport struct {
+	Rules []PolicyRule `json:"rules"`
+	// Warnings lists the settings that have no equivalent and were skipped.
+	Warnings []string `json:"warnings"`
+}
+
+// policyImportTools maps the tools of each format to the Crush tools their
+// rules apply to.
+var policyImportTools = map[string]map[string][]string{
+	PolicyFormatClaudeCode: {
+		"Bash":      {"bash"},
+		"Read":      {"view", "ls"},
+		"Edit":      {"edit", "multiedit", "apply_patch", "write"},
+		"MultiEdit": {"multiedit"},
+		"Write":     {"write"},
+		"WebFetch":  {"fetch", "agentic_fetch", "web_fetch"},
+	},
+	PolicyFormatCursor: {
+		"Shell": {"bash"},
+		"Read":  {"view", "ls"},
+		"Write": {"edit", "multiedit", "apply_patch", "write"},
+	},
+}
+
+// policySettingRe parses a permission setting like "Bash(npm run test:*)".
+var policySettingRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_-]*)(?:\((.*)\))?$`)
+
+// ImportPolicy converts the allow, ask and deny permissions of a Claude Code
+// or Cursor settings file to project policy rules.
+func ImportPolicy(format string, data []byte) (PolicyImport, error) {
+	tools, ok := policyImportTools[format]
+	if !ok {
+		return PolicyImport{}, fmt.Errorf("unsupported settings format %q", format)
+	}
+	var settings struct {
+		Permissions struct {
+			Allow       []string `json:"allow"`
+			Deny        []string `json:"deny"`
+			Ask         []string `json:"ask"`
+			DefaultMode string   `json:"defaultMode"`
+		} `json:"permissions"`
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return PolicyImport{}, fmt.Errorf("invalid settings file: %w", err)
+	}
+
+	result := PolicyImport{Rules: []PolicyRule{}, Warnings: []string{}}
+	perms := settings.Permissions
+	for _, entry := range []struct {
+		effect   PolicyEffect
+		settings []string
+	}{{PolicyDeny, perms.Deny}, {PolicyAsk, perms.Ask}, {PolicyAllow, perms.Allow}} {
+		for _, setting := range entry.settings {
+			rules, err := importPolicySetting(format, tools, entry.effect, strings.TrimSpace(setting))
+			if err != nil {
+				result.Warnings = append(result.Warnings, err.Error())
+				continue
+			}
+			result.Rules, _ = MergePolicyRules(result.Rules, rules)
+		}
+	}
+	if perms.DefaultMode != "" {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("defaultMode %q is not imported", perms.DefaultMode))
+	}
+	return result, nil
+}
+
+func importPolicySetting(format string, tools map[string][]string, effect PolicyEffect, setting string) ([]PolicyRule, error) {
+	if format == PolicyFormatClaudeCode && strings.HasPrefix(setting, "mcp__") {
+		// mcp__server or mcp__server__tool
+		server, tool, _ := strings.Cut(strings.TrimPrefix(setting, "mcp__"), "__")
+		if server == "" {
+			return nil, fmt.Errorf("%s: invalid MCP rule", setting)
+		}
+		if tool == "" {
+			tool = "*"
+		}
+		return []PolicyRule{{Effect: effect, Tool: "mcp_" + server + "_" + tool, Source: setting}}, nil
+	}
+
+	m := policySettingRe.FindStringSubmatch(setting)
+	if m == nil {
+		return nil, fmt.Errorf("%s: invalid permission rule", setting)
+	}
+	crushTools, ok := tools[m[1]]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s has no equivalent tool", setting, m[1])
+	}
+
+	pattern, err := importPolicyPattern(format, policySubjectKind(crushTools[0]), strings.TrimSpace(m[2]))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", setting, err)
+	}
+	rules := make([]PolicyRule, 0, len(crushTools))
+	for _, tool := range crushTools {
+		rule := PolicyRule{Effect: effect, Tool: tool, Pattern: pattern, Source: setting}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", setting, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// importPolicyPattern converts the argument of a permission setting to the
+// pattern of a policy rule.
+func importPolicyPattern(format string, kind policySubject, arg string) (string, error) {
+	if arg == "" || arg == "*" {
+		return "", nil
+	}
+	switch kind {
+	case policySubjectCommand:
+		// "npm run test:*" matches the command with any arguments
+		if prefix, ok := strings.CutSuffix(arg, ":*"); ok {
+			return prefix + " *", nil
+		}
+		// Cursor matches a command by its base, "git" allowing any git command
+		if format == PolicyFormatCursor && !strings.ContainsAny(arg, " *") {
+			return arg + " *", nil
+		}
+		return arg, nil
+	case policySubjectHost:
+		host, ok := strings.CutPrefix(arg, "domain:")
+		if !ok {
+			return "", fmt.Errorf("only domain: rules are supported")
+		}
+		return strings.ToLower(host), nil
+	default:
+		switch {
+		case strings.HasPrefix(arg, "~"):
+			return "", fmt.Errorf("home directory paths do not exist in the sandbox")
+		case strings.HasPrefix(arg, "//"):
+			// Absolute path
+			return arg[1:], nil
+		case strings.HasPrefix(arg, "./"):
+			return arg[2:], nil
+		case format == PolicyFormatClaudeCode && strings.HasPrefix(arg, "/"):
+			// Relative to the settings file, the project root
+			return arg[1:], nil
+		}
+		return arg, nil
+	}
+}
@@ -0,0 +1,110 @@
+package permission
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// PolicyDecision is the outcome of a policy for a permission request.
+type PolicyDecision string
+
+const (
+	PolicyDecisionAllow PolicyDecision = "allow"
+	PolicyDecisionDeny  PolicyDecision = "deny"
+	// PolicyDecisionAsk is used when the user is asked, because no rule or
+	// an ask rule matches.
+	PolicyDecisionAsk PolicyDecision = "ask"
+)
+
+// DecisionOf returns the decision of the rule returned by EvaluatePolicy.
+func DecisionOf(rule *PolicyRule) PolicyDecision {
+	switch {
+	case rule == nil, rule.Effect == PolicyAsk:
+		return PolicyDecisionAsk
+	case rule.Effect == PolicyDeny:
+		return PolicyDecisionDeny
+	default:
+		return PolicyDecisionAllow
+	}
+}
+
+// ShadowDecision compares the decision of the enforced policy of a project
+// with the one a candidate policy in shadow mode would have made.
+type ShadowDecision struct {
+	SessionID string
+	ToolName  string
+	// Subject is the command, URL or path the request is about.
+	Subject string
+	Actual  PolicyDecision
+	Shadow  PolicyDecision
+	// ActualRule and ShadowRule are the deciding rules, empty for asks.
+	ActualRule string
+	ShadowRule string
+}
+
+// ShadowPolicyChecker is implemented by policy checkers that can trial a
+// candidate policy before it is enforced. Its decisions are only recorded.
+type ShadowPolicyChecker interface {
+	// SessionShadowPolicy returns the candidate policy of the project of a
+	// session and its project directory, nil when no trial is running.
+	SessionShadowPolicy(ctx context.Context, sessionID string) (rules []PolicyRule, workdir string, err error)
+	// RecordShadowDecision stores the decisions of both policies for a request.
+	RecordShadowDecision(ctx context.Context, decision ShadowDecision)
+}
+
+// shadowPolicy records what the shadow policy of the project of a session
+// would have decided next to the decision of the enforced rule.
+func shadowPolicy(ctx context.Context, checker PolicyChecker, opts CreatePermissionRequest, actual *PolicyRule) {
+	shadow, ok := checker.(ShadowPolicyChecker)
+	if !ok {
+		return
+	}
+	rules, workdir, err := shadow.SessionShadowPolicy(ctx, opts.SessionID)
+	if err != nil {
+		slog.Warn("Failed to get shadow permission policy",
+			"error", err,
+			"session_id", opts.SessionID,
+		)
+		return
+	}
+	if rules == nil {
+		return
+	}
+
+	rule := EvaluatePolicy(rules, workdir, opts)
+	decision := ShadowDecision{
+		SessionID: opts.SessionID,
+		ToolName:  opts.ToolName,
+		Subject:   requestSubject(workdir, opts),
+		Actual:    DecisionOf(actual),
+		Shadow:    DecisionOf(rule),
+	}
+	if actual != nil {
+		decision.ActualRule = actual.String()
+	}
+	if rule != nil {
+		decision.ShadowRule = rule.String()
+	}
+	if decision.Actual != decision.Shadow {
+		slog.Info("Shadow permission policy disagrees",
+			"session_id", opts.SessionID,
+			"tool_name", opts.ToolName,
+			"actual", decision.Actual,
+			"shadow", decision.Shadow,
+		)
+	}
+	shadow.RecordShadowDecision(ctx, decision)
+}
+
+// requestSubject describes what a request is about for shadow decision reports.
+func requestSubject(workdir string, opts CreatePermissionRequest) string {
+	switch kind := policySubjectKind(opts.ToolName); kind {
+	case policySubjectCommand:
+		return requestParam(opts.Params, "command")
+	case policySubjectHost:
+		return requestParam(opts.Params, "url")
+	default:
+		return strings.Join(requestSubjects(kind, workdir, opts), " ")
+	}
+}
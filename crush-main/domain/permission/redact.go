@@ -0,0 +1,139 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/mask"
+)
+
+// secretPatterns match the credentials masked in the parameters of permission
+// requests, e.g. in the content of an edited .env file.
+var secretPatterns = []string{
+	// AWS, OpenAI/Anthropic, GitHub, Slack and Google keys and tokens
+	`\bAKIA[0-9A-Z]{16}\b`,
+	`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`,
+	`\bgh[pousr]_[A-Za-z0-9]{36,}`,
+	`\bxox[abposr]-[A-Za-z0-9-]{10,}`,
+	`\bAIza[0-9A-Za-z_-]{35}`,
+	// PEM private keys and JWTs
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`,
+	`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`,
+	// Values assigned to secret-looking names, the name is kept
+	`(?i)\b\w*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key)\b["']?\s*[:=]\s*["']?([^\s"',;]{4,})`,
+}
+
+// RedactOptions configures the redaction of the parameters of permission
+// requests before they are sent to clients.
+type RedactOptions struct {
+	// MaxBytes bounds each string parameter, e.g. file contents, 0 leaves
+	// them whole.
+	MaxBytes int
+	// MaskSecrets masks the credentials found by the built-in patterns.
+	MaskSecrets bool
+	// Patterns are extra regular expressions of secrets to mask. When one
+	// has a capture group, only the group is masked.
+	Patterns []string
+}
+
+// ParamsRedactor truncates and masks the parameters of permission requests,
+// the full parameters are kept apart for the clients asking for them.
+type ParamsRedactor struct {
+	maxBytes int
+	patterns []*regexp.Regexp
+}
+
+// NewParamsRedactor compiles the redaction options, it returns nil when they
+// leave the parameters untouched.
+func NewParamsRedactor(opts RedactOptions) (*ParamsRedactor, error) {
+	r := &ParamsRedactor{maxBytes: max(opts.MaxBytes, 0)}
+	var patterns []string
+	if opts.MaskSecrets {
+		patterns = append(patterns, secretPatterns...)
+	}
+	patterns = append(patterns, opts.Patterns...)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if r.maxBytes == 0 && len(r.patterns) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// Redact returns params with its strings masked and truncated, and whether
+// anything was. Unchanged params are returned as is, changed ones as their
+// JSON representation. A nil redactor only masks the values of the secrets
+// store, see package mask.
+func (r *ParamsRedactor) Redact(params any) (any, bool) {
+	if params == nil || (r == nil && !mask.Enabled()) {
+		return params, false
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return params, false
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return params, false
+	}
+	value, redacted := r.redactValue(value)
+	if !redacted {
+		return params, false
+	}
+	return value, true
+}
+
+func (r *ParamsRedactor) redactValue(value any) (any, bool) {
+	redacted := false
+	switch v := value.(type) {
+	case string:
+		return r.redactString(v)
+	case map[string]any:
+		for key, item := range v {
+			if item, changed := r.redactValue(item); changed {
+				v[key] = item
+				redacted = true
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if item, changed := r.redactValue(item); changed {
+				v[i] = item
+				redacted = true
+			}
+		}
+	}
+	return value, redacted
+}
+
+func (r *ParamsRedactor) redactString(s string) (string, bool) {
+	out := mask.String(s)
+	if r == nil {
+		return out, out != s
+	}
+	for _, re := range r.patterns {
+		out = re.ReplaceAllStringFunc(out, func(match string) string {
+			// Only the value of a name = value match is masked
+			loc := re.FindStringSubmatchIndex(match)
+			if len(loc) >= 4 && loc[2] >= 0 {
+				return match[:loc[2]] + mask.Placeholder + match[loc[3]:]
+			}
+			return mask.Placeholder
+		})
+	}
+	if r.maxBytes > 0 && len(out) > r.maxBytes {
+		cut := r.maxBytes
+		for cut > 0 && !utf8.RuneStart(out[cut]) {
+			cut--
+		}
+		out = fmt.Sprintf("%s\n... [truncated %d bytes]", out[:cut], len(out)-cut)
+	}
+	return out, out != s
+}
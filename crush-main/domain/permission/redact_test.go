@@ -0,0 +1,80 @@
+package permission
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/mask"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParamsRedactor(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		r, err := NewParamsRedactor(RedactOptions{})
+		require.NoError(t, err)
+		require.Nil(t, r)
+
+		params := map[string]string{"content": "password=hunter2"}
+		got, redacted := r.Redact(params)
+		require.False(t, redacted)
+		require.Equal(t, params, got)
+	})
+
+	t.Run("masks secrets", func(t *testing.T) {
+		r, err := NewParamsRedactor(RedactOptions{MaskSecrets: true})
+		require.NoError(t, err)
+
+		got, redacted := r.Redact(struct {
+			FilePath   string `json:"file_path"`
+			NewContent string `json:"new_content"`
+		}{
+			FilePath:   "/app/.env",
+			NewContent: "DB_PASSWORD=hunter22\nOPENAI_API_KEY=sk-abcdefghijklmnopqrstuvwxyz\nDEBUG=true",
+		})
+		require.True(t, redacted)
+		m := got.(map[string]any)
+		require.Equal(t, "/app/.env", m["file_path"])
+		content := m["new_content"].(string)
+		require.NotContains(t, content, "hunter22")
+		require.NotContains(t, content, "sk-abcdefghijklmnopqrstuvwxyz")
+		require.Contains(t, content, "DB_PASSWORD="+mask.Placeholder)
+		require.Contains(t, content, "DEBUG=true")
+	})
+
+	t.Run("unchanged params", func(t *testing.T) {
+		r, err := NewParamsRedactor(RedactOptions{MaskSecrets: true, MaxBytes: 100})
+		require.NoError(t, err)
+		params := map[string]any{"command": "go test ./..."}
+		got, redacted := r.Redact(params)
+		require.False(t, redacted)
+		require.Equal(t, params, got)
+	})
+
+	t.Run("truncates", func(t *testing.T) {
+		r, err := NewParamsRedactor(RedactOptions{MaxBytes: 10})
+		require.NoError(t, err)
+		got, redacted := r.Redact(map[string]any{"lines": []any{strings.Repeat("é", 8), "short"}})
+		require.True(t, redacted)
+		lines := got.(map[string]any)["lines"].([]any)
+		require.Equal(t, strings.Repeat("é", 5)+"\n... [truncated 6 bytes]", lines[0])
+		require.Equal(t, "short", lines[1])
+	})
+
+	t.Run("extra patterns", func(t *testing.T) {
+		r, err := NewParamsRedactor(RedactOptions{Patterns: []string{`internal-\d+`}})
+		require.NoError(t, err)
+		got, redacted := r.Redact(map[string]any{"url": "https://internal-42.example.com"})
+		require.True(t, redacted)
+		require.Equal(t, "https://"+mask.Placeholder+".example.com", got.(map[string]any)["url"])
+
+		_, err = NewParamsRedactor(RedactOptions{Patterns: []string{"("}})
+		require.Error(t, err)
+	})
+	t.Run("store secrets", func(t *testing.T) {
+		mask.Add("store-secret-1234")
+		var r *ParamsRedactor
+		got, redacted := r.Redact(map[string]any{"command": "curl -H 'X-Key: store-secret-1234' api"})
+		require.True(t, redacted)
+		require.Equal(t, "curl -H 'X-Key: "+mask.Placeholder+"' api", got.(map[string]any)["command"])
+	})
+}
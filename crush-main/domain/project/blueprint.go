@@ -0,0 +1,266 @@
+package project
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// Limits of a session blueprint.
+const (
+	MaxBlueprintPrompts       = 20
+	MaxBlueprintPinnedContext = 32 * 1024
+)
+
+var (
+	// ErrBlueprintNotFound is returned when a session blueprint does not exist in a project.
+	ErrBlueprintNotFound = errors.New("session blueprint not found")
+	// ErrBlueprintExists is returned when a project already has a blueprint of the same name.
+	ErrBlueprintExists = errors.New("session blueprint already exists")
+)
+
+// blueprintNamePattern keeps blueprint names usable as a query parameter.
+var blueprintNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Blueprint is a named bundle of session settings of a project, so recurring
+// workflows like bug triage or code review start consistently. Sessions
+// created from a blueprint get its model and pinned context, may use its
+// tools without asking and run its opening prompts in order.
+type Blueprint struct {
+	ID          string
+	ProjectID   string
+	Name        string
+	Description string
+	// PinnedContext is added to the system prompt of every turn of the session.
+	PinnedContext string
+	// Model is nil when sessions use the auto model.
+	Model        *BlueprintModel
+	AllowedTools []string
+	Prompts      []string
+	// Agent runs the opening prompts, empty for the coder.
+	Agent     string
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// BlueprintModel is the model selection of a blueprint. Provider credentials
+// come from the server configuration.
+type BlueprintModel struct {
+	Provider        string `json:"provider"`
+	Model           string `json:"model"`
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	MaxTokens       int64  `json:"max_tokens,omitempty"`
+}
+
+// BlueprintParams describes a session blueprint.
+type BlueprintParams struct {
+	Name          string
+	Description   string
+	PinnedContext string
+	Model         *BlueprintModel
+	AllowedTools  []string
+	Prompts       []string
+	Agent         string
+}
+
+// validateBlueprint trims the prompts and tools of a blueprint and checks its
+// name, model and limits.
+func validateBlueprint(params *BlueprintParams) error {
+	if !blueprintNamePattern.MatchString(params.Name) {
+		return errors.New("name must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if len(params.PinnedContext) > MaxBlueprintPinnedContext {
+		return fmt.Errorf("pinned_context exceeds %d bytes", MaxBlueprintPinnedContext)
+	}
+	if params.Model != nil && (params.Model.Provider == "" || params.Model.Model == "") {
+		return errors.New("model requires a provider and a model")
+	}
+
+	tools := make([]string, 0, len(params.AllowedTools))
+	for _, tool := range params.AllowedTools {
+		tool = strings.TrimSpace(tool)
+		if tool == "" {
+			continue
+		}
+		if strings.Contains(tool, ",") {
+			return fmt.Errorf("invalid tool name %q", tool)
+		}
+		tools = append(tools, tool)
+	}
+	params.AllowedTools = tools
+
+	prompts := make([]string, 0, len(params.Prompts))
+	for _, prompt := range params.Prompts {
+		if prompt = strings.TrimSpace(prompt); prompt != "" {
+			prompts = append(prompts, prompt)
+		}
+	}
+	if len(prompts) > MaxBlueprintPrompts {
+		return fmt.Errorf("a blueprint has at most %d prompts", MaxBlueprintPrompts)
+	}
+	params.Prompts = prompts
+	return nil
+}
+
+func (s *service) CreateBlueprint(ctx context.Context, projectID string, params BlueprintParams) (Blueprint, error) {
+	if err := validateBlueprint(&params); err != nil {
+		return Blueprint{}, err
+	}
+	if _, err := s.GetBlueprintByName(ctx, projectID, params.Name); err == nil {
+		return Blueprint{}, ErrBlueprintExists
+	} else if !errors.Is(err, ErrBlueprintNotFound) {
+		return Blueprint{}, err
+	}
+
+	modelConfig, prompts, err := marshalBlueprint(params)
+	if err != nil {
+		return Blueprint{}, err
+	}
+	dbBlueprint, err := s.q.CreateSessionBlueprint(ctx, postgres.CreateSessionBlueprintParams{
+		ID:            uuid.New().String(),
+		ProjectID:     projectID,
+		Name:          params.Name,
+		Description:   params.Description,
+		PinnedContext: params.PinnedContext,
+		ModelConfig:   modelConfig,
+		AllowedTools:  strings.Join(params.AllowedTools, ","),
+		Prompts:       prompts,
+		Agent:         params.Agent,
+	})
+	if err != nil {
+		return Blueprint{}, err
+	}
+	return blueprintFromDB(dbBlueprint)
+}
+
+func (s *service) GetBlueprint(ctx context.Context, projectID, blueprintID string) (Blueprint, error) {
+	dbBlueprint, err := s.q.GetSessionBlueprint(ctx, postgres.GetSessionBlueprintParams{
+		ID:        blueprintID,
+		ProjectID: projectID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Blueprint{}, ErrBlueprintNotFound
+	}
+	if err != nil {
+		return Blueprint{}, err
+	}
+	return blueprintFromDB(dbBlueprint)
+}
+
+func (s *service) GetBlueprintByName(ctx context.Context, projectID, name string) (Blueprint, error) {
+	dbBlueprint, err := s.q.GetSessionBlueprintByName(ctx, postgres.GetSessionBlueprintByNameParams{
+		ProjectID: projectID,
+		Name:      name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Blueprint{}, ErrBlueprintNotFound
+	}
+	if err != nil {
+		return Blueprint{}, err
+	}
+	return blueprintFromDB(dbBlueprint)
+}
+
+func (s *service) ListBlueprints(ctx context.Context, projectID string) ([]Blueprint, error) {
+	dbBlueprints, err := s.q.ListSessionBlueprints(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	blueprints := make([]Blueprint, len(dbBlueprints))
+	for i, item := range dbBlueprints {
+		if blueprints[i], err = blueprintFromDB(item); err != nil {
+			return nil, err
+		}
+	}
+	return blueprints, nil
+}
+
+func (s *service) UpdateBlueprint(ctx context.Context, projectID, blueprintID string, params BlueprintParams) (Blueprint, error) {
+	if err := validateBlueprint(&params); err != nil {
+		return Blueprint{}, err
+	}
+	if existing, err := s.GetBlueprintByName(ctx, projectID, params.Name); err == nil && existing.ID != blueprintID {
+		return Blueprint{}, ErrBlueprintExists
+	} else if err != nil && !errors.Is(err, ErrBlueprintNotFound) {
+		return Blueprint{}, err
+	}
+
+	modelConfig, prompts, err := marshalBlueprint(params)
+	if err != nil {
+		return Blueprint{}, err
+	}
+	dbBlueprint, err := s.q.UpdateSessionBlueprint(ctx, postgres.UpdateSessionBlueprintParams{
+		ID:            blueprintID,
+		ProjectID:     projectID,
+		Name:          params.Name,
+		Description:   params.Description,
+		PinnedContext: params.PinnedContext,
+		ModelConfig:   modelConfig,
+		AllowedTools:  strings.Join(params.AllowedTools, ","),
+		Prompts:       prompts,
+		Agent:         params.Agent,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Blueprint{}, ErrBlueprintNotFound
+	}
+	if err != nil {
+		return Blueprint{}, err
+	}
+	return blueprintFromDB(dbBlueprint)
+}
+
+func (s *service) DeleteBlueprint(ctx context.Context, projectID, blueprintID string) error {
+	return s.q.DeleteSessionBlueprint(ctx, postgres.DeleteSessionBlueprintParams{
+		ID:        blueprintID,
+		ProjectID: projectID,
+	})
+}
+
+// marshalBlueprint encodes the model and prompts of a blueprint for storage.
+func marshalBlueprint(params BlueprintParams) (modelConfig, prompts string, err error) {
+	if params.Model != nil {
+		data, err := json.Marshal(params.Model)
+		if err != nil {
+			return "", "", err
+		}
+		modelConfig = string(data)
+	}
+	data, err := json.Marshal(params.Prompts)
+	if err != nil {
+		return "", "", err
+	}
+	return modelConfig, string(data), nil
+}
+
+func blueprintFromDB(item postgres.SessionBlueprint) (Blueprint, error) {
+	blueprint := Blueprint{
+		ID:            item.ID,
+		ProjectID:     item.ProjectID,
+		Name:          item.Name,
+		Description:   item.Description,
+		PinnedContext: item.PinnedContext,
+		Agent:         item.Agent,
+		CreatedAt:     item.CreatedAt,
+		UpdatedAt:     item.UpdatedAt,
+	}
+	if item.AllowedTools != "" {
+		blueprint.AllowedTools = strings.Split(item.AllowedTools, ",")
+	}
+	if item.ModelConfig != "" {
+		blueprint.Model = &BlueprintModel{}
+		if err := json.Unmarshal([]byte(item.ModelConfig), blueprint.Model); err != nil {
+			return Blueprint{}, fmt.Errorf("invalid model config of blueprint %s: %w", item.ID, err)
+		}
+	}
+	if err := json.Unmarshal([]byte(item.Prompts), &blueprint.Prompts); err != nil {
+		return Blueprint{}, fmt.Errorf("invalid prompts of blueprint %s: %w", item.ID, err)
+	}
+	return blueprint, nil
+}
@@ -0,0 +1,65 @@
+package project
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBlueprint(t *testing.T) {
+	params := BlueprintParams{
+		Name:         "bug-triage",
+		AllowedTools: []string{" view ", "", "grep"},
+		Prompts:      []string{"Reproduce the bug", "  ", "Find the cause\n"},
+	}
+	require.NoError(t, validateBlueprint(&params))
+	assert.Equal(t, []string{"view", "grep"}, params.AllowedTools)
+	assert.Equal(t, []string{"Reproduce the bug", "Find the cause"}, params.Prompts)
+
+	for name, params := range map[string]BlueprintParams{
+		"name":    {Name: "Bug Triage"},
+		"empty":   {Name: ""},
+		"model":   {Name: "review", Model: &BlueprintModel{Provider: "openai"}},
+		"tool":    {Name: "review", AllowedTools: []string{"view,edit"}},
+		"prompts": {Name: "review", Prompts: strings.Split(strings.Repeat("p,", MaxBlueprintPrompts+1), ",")},
+		"context": {Name: "review", PinnedContext: strings.Repeat("x", MaxBlueprintPinnedContext+1)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, validateBlueprint(&params))
+		})
+	}
+}
+
+func TestBlueprintRoundTrip(t *testing.T) {
+	params := BlueprintParams{
+		Name:         "review",
+		Model:        &BlueprintModel{Provider: "anthropic", Model: "claude", MaxTokens: 4096},
+		AllowedTools: []string{"view", "grep"},
+		Prompts:      []string{"Summarize the diff", "List risky changes, with line numbers"},
+	}
+	modelConfig, prompts, err := marshalBlueprint(params)
+	require.NoError(t, err)
+
+	blueprint, err := blueprintFromDB(postgres.SessionBlueprint{
+		ID:           "b1",
+		Name:         params.Name,
+		ModelConfig:  modelConfig,
+		AllowedTools: strings.Join(params.AllowedTools, ","),
+		Prompts:      prompts,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, params.Model, blueprint.Model)
+	assert.Equal(t, params.AllowedTools, blueprint.AllowedTools)
+	assert.Equal(t, params.Prompts, blueprint.Prompts)
+
+	modelConfig, prompts, err = marshalBlueprint(BlueprintParams{Name: "empty"})
+	require.NoError(t, err)
+	blueprint, err = blueprintFromDB(postgres.SessionBlueprint{ModelConfig: modelConfig, Prompts: prompts})
+	require.NoError(t, err)
+	assert.Nil(t, blueprint.Model)
+	assert.Empty(t, blueprint.AllowedTools)
+	assert.Empty(t, blueprint.Prompts)
+}
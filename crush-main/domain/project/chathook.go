@@ -0,0 +1,238 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// ChatPlatform is the chat service that receives turn summaries.
+type ChatPlatform string
+
+const (
+	ChatPlatformSlack   ChatPlatform = "slack"
+	ChatPlatformDiscord ChatPlatform = "discord"
+)
+
+// Turn events a chat hook can subscribe to.
+const (
+	ChatHookEventCompleted = "completed"
+	ChatHookEventFailed    = "failed"
+	ChatHookEventCancelled = "cancelled"
+	// ChatHookEventPermissionBlocking is sent while a turn waits on a
+	// permission request for longer than the blocking threshold.
+	ChatHookEventPermissionBlocking = "permission_blocking"
+)
+
+// defaultChatHookEvents are subscribed when a chat hook lists no events.
+var defaultChatHookEvents = []string{ChatHookEventCompleted, ChatHookEventFailed}
+
+// DefaultChatHookTemplate is used when a chat hook has no message template.
+const DefaultChatHookTemplate = `{{if eq .Event "permission_blocking"}}⏳ {{.Title}} in {{.ProjectName}} has been waiting {{.Blocked}} for permission to run {{.ToolName}}
+{{if .Description}}{{.Description}}
+{{end}}{{.URL}}{{else}}{{if eq .Event "completed"}}✅{{else if eq .Event "failed"}}❌{{else}}⏹️{{end}} {{.Title}} {{.Event}} in {{.ProjectName}}
+Cost: ${{printf "%.4f" .Cost}} · Files changed: {{.FileCount}}
+{{range .FilesChanged}}• {{.}}
+{{end}}{{if .Error}}Error: {{.Error}}
+{{end}}{{.URL}}{{end}}`
+
+// ErrChatHookNotFound is returned when a chat hook does not exist in a project.
+var ErrChatHookNotFound = errors.New("chat hook not found")
+
+// ChatHook is an outbound Slack or Discord webhook of a project that receives
+// a summary when an agent turn finishes.
+type ChatHook struct {
+	ID         string
+	ProjectID  string
+	Platform   ChatPlatform
+	WebhookURL string
+	Template   string
+	Events     []string
+	Enabled    bool
+	CreatedAt  int64
+	UpdatedAt  int64
+}
+
+// ChatHookParams describes a chat hook configuration.
+type ChatHookParams struct {
+	Platform   ChatPlatform
+	WebhookURL string
+	Template   string
+	// Events defaults to completed and failed when empty.
+	Events  []string
+	Enabled bool
+}
+
+// TurnSummary is the data of chat hook message templates.
+type TurnSummary struct {
+	Event       string
+	ProjectID   string
+	ProjectName string
+	SessionID   string
+	Title       string
+	Cost        float64
+	// FilesChanged lists at most MaxSummaryFiles paths, FileCount counts them all.
+	FilesChanged []string
+	FileCount    int
+	Error        string
+	URL          string
+	// ToolName, Description and Blocked describe the permission request of a
+	// permission_blocking event, Blocked is the time waited so far.
+	ToolName    string
+	Description string
+	Blocked     string
+}
+
+// MaxSummaryFiles bounds the changed files listed in a turn summary.
+const MaxSummaryFiles = 10
+
+// Handles reports whether the chat hook subscribes to the given turn event.
+func (h *ChatHook) Handles(event string) bool {
+	return h.Enabled && slices.Contains(h.Events, event)
+}
+
+// RenderMessage renders the message template of the chat hook for a turn.
+func (h *ChatHook) RenderMessage(summary TurnSummary) (string, error) {
+	text := h.Template
+	if strings.TrimSpace(text) == "" {
+		text = DefaultChatHookTemplate
+	}
+	tmpl, err := template.New("chat_hook").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid message template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, summary); err != nil {
+		return "", fmt.Errorf("failed to render message template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// validateChatHook normalizes the events of a chat hook and checks its
+// platform, URL and template.
+func validateChatHook(params *ChatHookParams) error {
+	switch params.Platform {
+	case ChatPlatformSlack, ChatPlatformDiscord:
+	default:
+		return fmt.Errorf("unsupported chat platform %q", params.Platform)
+	}
+	u, err := url.Parse(params.WebhookURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("webhook_url must be an https URL")
+	}
+
+	if len(params.Events) == 0 {
+		params.Events = defaultChatHookEvents
+	}
+	for _, event := range params.Events {
+		switch event {
+		case ChatHookEventCompleted, ChatHookEventFailed, ChatHookEventCancelled, ChatHookEventPermissionBlocking:
+		default:
+			return fmt.Errorf("unsupported chat hook event %q", event)
+		}
+	}
+
+	if strings.TrimSpace(params.Template) != "" {
+		if _, err := template.New("chat_hook").Parse(params.Template); err != nil {
+			return fmt.Errorf("invalid message template: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *service) CreateChatHook(ctx context.Context, projectID string, params ChatHookParams) (ChatHook, error) {
+	if err := validateChatHook(&params); err != nil {
+		return ChatHook{}, err
+	}
+	dbHook, err := s.q.CreateProjectChatHook(ctx, postgres.CreateProjectChatHookParams{
+		ID:         uuid.New().String(),
+		ProjectID:  projectID,
+		Platform:   string(params.Platform),
+		WebhookUrl: params.WebhookURL,
+		Template:   params.Template,
+		Events:     strings.Join(params.Events, ","),
+		Enabled:    params.Enabled,
+	})
+	if err != nil {
+		return ChatHook{}, err
+	}
+	return chatHookFromDB(dbHook), nil
+}
+
+func (s *service) GetChatHook(ctx context.Context, projectID, hookID string) (ChatHook, error) {
+	dbHook, err := s.q.GetProjectChatHook(ctx, postgres.GetProjectChatHookParams{
+		ID:        hookID,
+		ProjectID: projectID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChatHook{}, ErrChatHookNotFound
+	}
+	if err != nil {
+		return ChatHook{}, err
+	}
+	return chatHookFromDB(dbHook), nil
+}
+
+func (s *service) ListChatHooks(ctx context.Context, projectID string) ([]ChatHook, error) {
+	dbHooks, err := s.q.ListProjectChatHooks(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	hooks := make([]ChatHook, len(dbHooks))
+	for i, item := range dbHooks {
+		hooks[i] = chatHookFromDB(item)
+	}
+	return hooks, nil
+}
+
+func (s *service) UpdateChatHook(ctx context.Context, projectID, hookID string, params ChatHookParams) (ChatHook, error) {
+	if err := validateChatHook(&params); err != nil {
+		return ChatHook{}, err
+	}
+	dbHook, err := s.q.UpdateProjectChatHook(ctx, postgres.UpdateProjectChatHookParams{
+		ID:         hookID,
+		ProjectID:  projectID,
+		Platform:   string(params.Platform),
+		WebhookUrl: params.WebhookURL,
+		Template:   params.Template,
+		Events:     strings.Join(params.Events, ","),
+		Enabled:    params.Enabled,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChatHook{}, ErrChatHookNotFound
+	}
+	if err != nil {
+		return ChatHook{}, err
+	}
+	return chatHookFromDB(dbHook), nil
+}
+
+func (s *service) DeleteChatHook(ctx context.Context, projectID, hookID string) error {
+	return s.q.DeleteProjectChatHook(ctx, postgres.DeleteProjectChatHookParams{
+		ID:        hookID,
+		ProjectID: projectID,
+	})
+}
+
+func chatHookFromDB(item postgres.ProjectChatHook) ChatHook {
+	return ChatHook{
+		ID:         item.ID,
+		ProjectID:  item.ProjectID,
+		Platform:   ChatPlatform(item.Platform),
+		WebhookURL: item.WebhookUrl,
+		Template:   item.Template,
+		Events:     strings.Split(item.Events, ","),
+		Enabled:    item.Enabled,
+		CreatedAt:  item.CreatedAt,
+		UpdatedAt:  item.UpdatedAt,
+	}
+}
@@ -0,0 +1,76 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateChatHook(t *testing.T) {
+	params := ChatHookParams{Platform: ChatPlatformSlack, WebhookURL: "https://hooks.slack.com/services/T/B/X"}
+	require.NoError(t, validateChatHook(&params))
+	assert.Equal(t, []string{ChatHookEventCompleted, ChatHookEventFailed}, params.Events)
+
+	for name, params := range map[string]ChatHookParams{
+		"platform": {Platform: "teams", WebhookURL: "https://example.com/hook"},
+		"http url": {Platform: ChatPlatformDiscord, WebhookURL: "http://example.com/hook"},
+		"event":    {Platform: ChatPlatformDiscord, WebhookURL: "https://example.com/hook", Events: []string{"started"}},
+		"template": {Platform: ChatPlatformDiscord, WebhookURL: "https://example.com/hook", Template: "{{.Title"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, validateChatHook(&params))
+		})
+	}
+}
+
+func TestChatHookRenderMessage(t *testing.T) {
+	summary := TurnSummary{
+		Event:        ChatHookEventFailed,
+		ProjectName:  "shop",
+		Title:        "Fix checkout",
+		Cost:         0.0123,
+		FilesChanged: []string{"cart.go", "cart_test.go"},
+		FileCount:    2,
+		Error:        "context deadline exceeded",
+		URL:          "https://app.example.com/sessions/s1",
+	}
+
+	hook := ChatHook{Enabled: true, Events: []string{ChatHookEventFailed}}
+	assert.True(t, hook.Handles(ChatHookEventFailed))
+	assert.False(t, hook.Handles(ChatHookEventCompleted))
+
+	text, err := hook.RenderMessage(summary)
+	require.NoError(t, err)
+	assert.Equal(t, `❌ Fix checkout failed in shop
+Cost: $0.0123 · Files changed: 2
+• cart.go
+• cart_test.go
+Error: context deadline exceeded
+https://app.example.com/sessions/s1`, text)
+
+	hook.Template = "{{.Title}}: {{.Event}}"
+	text, err = hook.RenderMessage(summary)
+	require.NoError(t, err)
+	assert.Equal(t, "Fix checkout: failed", text)
+
+	hook.Enabled = false
+	assert.False(t, hook.Handles(ChatHookEventFailed))
+}
+
+func TestChatHookRenderPermissionBlocking(t *testing.T) {
+	hook := ChatHook{Enabled: true, Events: []string{ChatHookEventPermissionBlocking}}
+	text, err := hook.RenderMessage(TurnSummary{
+		Event:       ChatHookEventPermissionBlocking,
+		ProjectName: "shop",
+		Title:       "Fix checkout",
+		ToolName:    "bash",
+		Description: "Run go test ./...",
+		Blocked:     "2m0s",
+		URL:         "https://app.example.com/sessions/s1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `⏳ Fix checkout in shop has been waiting 2m0s for permission to run bash
+Run go test ./...
+https://app.example.com/sessions/s1`, text)
+}
@@ -0,0 +1,293 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+)
+
+// OrphanKind tells how the sandbox containers and the projects disagree.
+type OrphanKind string
+
+const (
+	// OrphanContainer is a sandbox container no project refers to.
+	OrphanContainer OrphanKind = "container_without_project"
+	// OrphanProject is a project whose container is gone from the sandbox.
+	OrphanProject OrphanKind = "project_without_container"
+)
+
+// DefaultOrphanGrace is how old a container or project must be before it can
+// be flagged, so the ones being created are not.
+const DefaultOrphanGrace = 10 * time.Minute
+
+// ErrNotOrphan is returned when cleaning a container that is not flagged as orphaned.
+var ErrNotOrphan = errors.New("container is not an orphan")
+
+// Orphan is a sandbox container without project or a project without container.
+type Orphan struct {
+	Kind            OrphanKind `json:"kind"`
+	ContainerID     string     `json:"container_id"`
+	ContainerName   string     `json:"container_name,omitempty"`
+	ContainerStatus string     `json:"container_status,omitempty"`
+	ProjectID       string     `json:"project_id,omitempty"`
+	ProjectName     string     `json:"project_name,omitempty"`
+	UserID          string     `json:"user_id,omitempty"`
+	// FirstSeenAt is when the orphan was first flagged, in Unix milliseconds.
+	FirstSeenAt int64 `json:"first_seen_at"`
+}
+
+func (o Orphan) key() string {
+	return string(o.Kind) + "/" + o.ContainerID + "/" + o.ProjectID
+}
+
+// OrphanReport is the result of a reconciliation of the sandbox containers
+// with the projects.
+type OrphanReport struct {
+	Orphans    []Orphan `json:"orphans"`
+	Containers int      `json:"containers"`
+	Projects   int      `json:"projects"`
+	// Cleaned lists the containers the reconciliation deleted.
+	Cleaned   []string `json:"cleaned"`
+	CheckedAt int64    `json:"checked_at"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// FindOrphans matches the sandbox containers against the projects. Projects
+// refer to their container by ID, or by name for older projects. Containers
+// and projects created less than grace before now are skipped.
+func FindOrphans(projects []Project, containers []sandbox.Container, now time.Time, grace time.Duration) []Orphan {
+	cutoff := now.Add(-grace).UnixMilli()
+	orphans := []Orphan{}
+
+	for _, c := range containers {
+		if c.CreatedAt > cutoff {
+			continue
+		}
+		if !slices.ContainsFunc(projects, func(p Project) bool { return projectUsesContainer(p, c) }) {
+			orphans = append(orphans, Orphan{
+				Kind:            OrphanContainer,
+				ContainerID:     c.ContainerID,
+				ContainerName:   c.ContainerName,
+				ContainerStatus: c.Status,
+			})
+		}
+	}
+
+	for _, p := range projects {
+		if !p.ContainerName.Valid || p.ContainerName.String == "" || p.CreatedAt > cutoff {
+			continue
+		}
+		if !slices.ContainsFunc(containers, func(c sandbox.Container) bool { return projectUsesContainer(p, c) }) {
+			orphans = append(orphans, Orphan{
+				Kind:        OrphanProject,
+				ContainerID: p.ContainerName.String,
+				ProjectID:   p.ID,
+				ProjectName: p.Name,
+				UserID:      p.UserID,
+			})
+		}
+	}
+	return orphans
+}
+
+func projectUsesContainer(p Project, c sandbox.Container) bool {
+	ref := p.ContainerName.String
+	if ref == "" {
+		return false
+	}
+	if ref == c.ContainerID || ref == c.ContainerName {
+		return true
+	}
+	// Short and full container IDs
+	const shortID = 12
+	return len(ref) >= shortID && len(c.ContainerID) >= shortID &&
+		(strings.HasPrefix(ref, c.ContainerID) || strings.HasPrefix(c.ContainerID, ref))
+}
+
+// ProjectLister lists the projects of every user.
+type ProjectLister interface {
+	ListAll(ctx context.Context) ([]Project, error)
+}
+
+// SandboxContainers lists and deletes the project containers of the sandbox.
+// This is typically implemented by the sandbox client.
+type SandboxContainers interface {
+	ListProjects(ctx context.Context) (*sandbox.ListProjectsResponse, error)
+	DeleteProject(ctx context.Context, req sandbox.DeleteProjectRequest) (*sandbox.DeleteProjectResponse, error)
+}
+
+// ReconcilerOptions configures the orphan reconciliation.
+type ReconcilerOptions struct {
+	// Interval between reconciliations, Run does nothing when zero.
+	Interval time.Duration
+	// Grace is how old containers and projects must be to be flagged.
+	Grace time.Duration
+	// AutoClean deletes containers without a project once they have been
+	// flagged for CleanAfter. Projects without container are only flagged.
+	AutoClean  bool
+	CleanAfter time.Duration
+}
+
+// Reconciler periodically matches the sandbox containers against the project
+// records and keeps the report of the orphans for the admin API.
+type Reconciler struct {
+	projects ProjectLister
+	sandbox  SandboxContainers
+	opts     ReconcilerOptions
+	now      func() time.Time
+
+	mu        sync.Mutex
+	report    OrphanReport
+	firstSeen map[string]int64
+}
+
+// NewReconciler creates a reconciler of the sandbox containers.
+func NewReconciler(projects ProjectLister, sb SandboxContainers, opts ReconcilerOptions) *Reconciler {
+	if opts.Grace == 0 {
+		opts.Grace = DefaultOrphanGrace
+	}
+	return &Reconciler{
+		projects:  projects,
+		sandbox:   sb,
+		opts:      opts,
+		now:       time.Now,
+		report:    OrphanReport{Orphans: []Orphan{}, Cleaned: []string{}},
+		firstSeen: map[string]int64{},
+	}
+}
+
+// Run reconciles at every interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	if r.opts.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Reconcile(ctx); err != nil {
+			slog.Warn("Failed to reconcile sandbox containers", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report returns the result of the last reconciliation.
+func (r *Reconciler) Report() OrphanReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.report
+}
+
+// Reconcile lists the containers and projects, flags the orphans and, with
+// AutoClean, deletes the containers orphaned for longer than CleanAfter.
+func (r *Reconciler) Reconcile(ctx context.Context) (OrphanReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	report := OrphanReport{Orphans: []Orphan{}, Cleaned: []string{}, CheckedAt: now.UnixMilli()}
+	resp, err := r.sandbox.ListProjects(ctx)
+	if err != nil {
+		report.Error = err.Error()
+		r.report = report
+		return report, fmt.Errorf("failed to list sandbox containers: %w", err)
+	}
+	projects, err := r.projects.ListAll(ctx)
+	if err != nil {
+		report.Error = err.Error()
+		r.report = report
+		return report, fmt.Errorf("failed to list projects: %w", err)
+	}
+	report.Containers, report.Projects = len(resp.Containers), len(projects)
+
+	firstSeen := map[string]int64{}
+	for _, orphan := range FindOrphans(projects, resp.Containers, now, r.opts.Grace) {
+		key := orphan.key()
+		orphan.FirstSeenAt = now.UnixMilli()
+		if seen, ok := r.firstSeen[key]; ok {
+			orphan.FirstSeenAt = seen
+		}
+		firstSeen[key] = orphan.FirstSeenAt
+
+		if r.opts.AutoClean && orphan.Kind == OrphanContainer &&
+			now.Sub(time.UnixMilli(orphan.FirstSeenAt)) >= r.opts.CleanAfter {
+			if err := r.deleteContainer(ctx, orphan); err != nil {
+				slog.Warn("Failed to clean orphaned sandbox container", "container_id", orphan.ContainerID, "error", err)
+			} else {
+				report.Cleaned = append(report.Cleaned, orphan.ContainerID)
+				delete(firstSeen, key)
+				continue
+			}
+		}
+		report.Orphans = append(report.Orphans, orphan)
+	}
+	r.firstSeen = firstSeen
+	r.report = report
+
+	if len(report.Orphans) > 0 || len(report.Cleaned) > 0 {
+		slog.Info("Reconciled sandbox containers",
+			"containers", report.Containers,
+			"projects", report.Projects,
+			"orphans", len(report.Orphans),
+			"cleaned", len(report.Cleaned),
+		)
+	}
+	return report, nil
+}
+
+// Clean deletes containers flagged as orphans by the last reconciliation, all
+// of them when containerIDs is empty. It returns the deleted containers.
+func (r *Reconciler) Clean(ctx context.Context, containerIDs []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range containerIDs {
+		if !slices.ContainsFunc(r.report.Orphans, func(o Orphan) bool {
+			return o.Kind == OrphanContainer && o.ContainerID == id
+		}) {
+			return nil, fmt.Errorf("%w: %s", ErrNotOrphan, id)
+		}
+	}
+
+	cleaned := []string{}
+	var errs []error
+	remaining := []Orphan{}
+	for _, orphan := range r.report.Orphans {
+		if orphan.Kind != OrphanContainer || (len(containerIDs) > 0 && !slices.Contains(containerIDs, orphan.ContainerID)) {
+			remaining = append(remaining, orphan)
+			continue
+		}
+		if err := r.deleteContainer(ctx, orphan); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", orphan.ContainerID, err))
+			remaining = append(remaining, orphan)
+			continue
+		}
+		cleaned = append(cleaned, orphan.ContainerID)
+		delete(r.firstSeen, orphan.key())
+	}
+	r.report.Orphans = remaining
+	r.report.Cleaned = append(r.report.Cleaned, cleaned...)
+	return cleaned, errors.Join(errs...)
+}
+
+func (r *Reconciler) deleteContainer(ctx context.Context, orphan Orphan) error {
+	if _, err := r.sandbox.DeleteProject(ctx, sandbox.DeleteProjectRequest{ContainerID: orphan.ContainerID}); err != nil {
+		return err
+	}
+	slog.Info("Deleted orphaned sandbox container",
+		"container_id", orphan.ContainerID,
+		"container_name", orphan.ContainerName,
+	)
+	return nil
+}
@@ -0,0 +1,97 @@
+package project
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProjects []Project
+
+func (f fakeProjects) ListAll(ctx context.Context) ([]Project, error) {
+	return f, nil
+}
+
+type fakeSandbox struct {
+	containers []sandbox.Container
+	deleted    []string
+}
+
+func (f *fakeSandbox) ListProjects(ctx context.Context) (*sandbox.ListProjectsResponse, error) {
+	return &sandbox.ListProjectsResponse{Containers: f.containers}, nil
+}
+
+func (f *fakeSandbox) DeleteProject(ctx context.Context, req sandbox.DeleteProjectRequest) (*sandbox.DeleteProjectResponse, error) {
+	f.deleted = append(f.deleted, req.ContainerID)
+	return &sandbox.DeleteProjectResponse{Status: "success"}, nil
+}
+
+func containerProject(id, container string, createdAt int64) Project {
+	return Project{ID: id, Name: id, CreatedAt: createdAt, ContainerName: sql.NullString{String: container, Valid: container != ""}}
+}
+
+func TestFindOrphans(t *testing.T) {
+	now := time.UnixMilli(10_000_000)
+	old := now.Add(-time.Hour).UnixMilli()
+	projects := []Project{
+		containerProject("by-id", "aaaaaaaaaaaa", old),
+		containerProject("by-name", "crush-named", old),
+		containerProject("vanished", "cccccccccccc", old),
+		containerProject("creating", "dddddddddddd", now.UnixMilli()),
+		containerProject("no-container", "", old),
+	}
+	containers := []sandbox.Container{
+		{ContainerID: "aaaaaaaaaaaa", CreatedAt: old},
+		{ContainerID: "bbbbbbbbbbbb", ContainerName: "crush-named", CreatedAt: old},
+		{ContainerID: "eeeeeeeeeeee", ContainerName: "crush-stale", CreatedAt: old},
+		{ContainerID: "ffffffffffff", CreatedAt: now.UnixMilli()},
+	}
+
+	orphans := FindOrphans(projects, containers, now, DefaultOrphanGrace)
+	require.Len(t, orphans, 2)
+	assert.Equal(t, Orphan{Kind: OrphanContainer, ContainerID: "eeeeeeeeeeee", ContainerName: "crush-stale"}, orphans[0])
+	assert.Equal(t, OrphanProject, orphans[1].Kind)
+	assert.Equal(t, "vanished", orphans[1].ProjectID)
+}
+
+func TestReconciler_AutoClean(t *testing.T) {
+	now := time.UnixMilli(10_000_000)
+	sb := &fakeSandbox{containers: []sandbox.Container{{ContainerID: "eeeeeeeeeeee"}}}
+	r := NewReconciler(fakeProjects{}, sb, ReconcilerOptions{AutoClean: true, CleanAfter: time.Hour})
+	r.now = func() time.Time { return now }
+
+	report, err := r.Reconcile(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Orphans, 1)
+	assert.Equal(t, now.UnixMilli(), report.Orphans[0].FirstSeenAt)
+	assert.Empty(t, sb.deleted, "orphans are kept until clean_after has passed")
+
+	now = now.Add(time.Hour)
+	report, err = r.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Orphans)
+	assert.Equal(t, []string{"eeeeeeeeeeee"}, report.Cleaned)
+	assert.Equal(t, []string{"eeeeeeeeeeee"}, sb.deleted)
+}
+
+func TestReconciler_Clean(t *testing.T) {
+	sb := &fakeSandbox{containers: []sandbox.Container{{ContainerID: "eeeeeeeeeeee"}}}
+	projects := fakeProjects{containerProject("vanished", "cccccccccccc", 0)}
+	r := NewReconciler(projects, sb, ReconcilerOptions{})
+
+	_, err := r.Reconcile(context.Background())
+	require.NoError(t, err)
+	_, err = r.Clean(context.Background(), []string{"cccccccccccc"})
+	assert.ErrorIs(t, err, ErrNotOrphan)
+
+	cleaned, err := r.Clean(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eeeeeeeeeeee"}, cleaned)
+	require.Len(t, r.Report().Orphans, 1)
+	assert.Equal(t, OrphanProject, r.Report().Orphans[0].Kind)
+}
@@ -0,0 +1,117 @@
+package project
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// PauseMode decides what happens to prompts sent to a paused project.
+type PauseMode string
+
+const (
+	// PauseModeReject rejects new prompts with the pause reason.
+	PauseModeReject PauseMode = "reject"
+	// PauseModeQueue holds new prompts and runs them once the project is resumed.
+	PauseModeQueue PauseMode = "queue"
+)
+
+// ErrProjectPaused is returned when an agent run is refused because its project is paused.
+var ErrProjectPaused = errors.New("project paused")
+
+// Pause is an active maintenance window of a project. While a project is
+// paused no agent runs start for its sessions and scheduled jobs are skipped.
+type Pause struct {
+	ProjectID string
+	Reason    string
+	Mode      PauseMode
+	// Drain cancels the runs that were in flight when the pause started.
+	Drain    bool
+	PausedBy string
+	PausedAt int64
+	// ResumeAt ends the pause automatically (Unix ms); zero pauses until resumed.
+	ResumeAt int64
+}
+
+// PauseParams describes a new maintenance window.
+type PauseParams struct {
+	Reason   string
+	Mode     PauseMode
+	Drain    bool
+	PausedBy string
+	ResumeAt int64
+}
+
+// Error returns the error reported to clients whose prompt was refused.
+func (p *Pause) Error() error {
+	if p.Reason == "" {
+		return ErrProjectPaused
+	}
+	return fmt.Errorf("%w: %s", ErrProjectPaused, p.Reason)
+}
+
+// Expired reports whether the pause has reached its automatic resume time.
+func (p *Pause) Expired() bool {
+	return p.ResumeAt > 0 && time.Now().UnixMilli() >= p.ResumeAt
+}
+
+func (s *service) Pause(ctx context.Context, projectID string, params PauseParams) (Pause, error) {
+	mode := params.Mode
+	if mode == "" {
+		mode = PauseModeReject
+	}
+	if mode != PauseModeReject && mode != PauseModeQueue {
+		return Pause{}, fmt.Errorf("invalid pause mode %q", mode)
+	}
+	dbPause, err := s.q.UpsertProjectPause(ctx, postgres.UpsertProjectPauseParams{
+		ProjectID: projectID,
+		Reason:    params.Reason,
+		Mode:      string(mode),
+		Drain:     params.Drain,
+		PausedBy:  sql.NullString{String: params.PausedBy, Valid: params.PausedBy != ""},
+		ResumeAt:  sql.NullInt64{Int64: params.ResumeAt, Valid: params.ResumeAt > 0},
+	})
+	if err != nil {
+		return Pause{}, err
+	}
+	return pauseFromDB(dbPause), nil
+}
+
+func (s *service) Resume(ctx context.Context, projectID string) error {
+	return s.q.DeleteProjectPause(ctx, projectID)
+}
+
+func (s *service) GetPause(ctx context.Context, projectID string) (*Pause, error) {
+	dbPause, err := s.q.GetProjectPause(ctx, projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pause := pauseFromDB(dbPause)
+	if pause.Expired() {
+		// The maintenance window is over, clean it up lazily
+		if err := s.q.DeleteProjectPause(ctx, projectID); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &pause, nil
+}
+
+func pauseFromDB(item postgres.ProjectPause) Pause {
+	return Pause{
+		ProjectID: item.ProjectID,
+		Reason:    item.Reason,
+		Mode:      PauseMode(item.Mode),
+		Drain:     item.Drain,
+		PausedBy:  item.PausedBy.String,
+		PausedAt:  item.PausedAt,
+		ResumeAt:  item.ResumeAt.Int64,
+	}
+}
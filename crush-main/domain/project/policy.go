@@ -0,0 +1,249 @@
+package project
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+func (s *service) GetPermissionPolicy(ctx context.Context, projectID string) ([]permission.PolicyRule, error) {
+	policy, err := s.q.GetProjectPermissionPolicy(ctx, projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []permission.PolicyRule{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules := []permission.PolicyRule{}
+	if err := json.Unmarshal([]byte(policy.Rules), &rules); err != nil {
+		return nil, fmt.Errorf("invalid permission policy of project %s: %w", projectID, err)
+	}
+	return rules, nil
+}
+
+func (s *service) SetPermissionPolicy(ctx context.Context, projectID string, rules []permission.PolicyRule) ([]permission.PolicyRule, error) {
+	if rules == nil {
+		rules = []permission.PolicyRule{}
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.q.UpsertProjectPermissionPolicy(ctx, postgres.UpsertProjectPermissionPolicyParams{
+		ProjectID: projectID,
+		Rules:     string(data),
+	}); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Shadow mode trial periods of candidate permission policies.
+const (
+	DefaultShadowPeriod = 7 * 24 * time.Hour
+	MaxShadowPeriod     = 30 * 24 * time.Hour
+)
+
+// maxShadowMismatches bounds the disagreeing decisions listed in a shadow report.
+const maxShadowMismatches = 50
+
+// ShadowPolicy is a candidate permission policy of a project run in shadow
+// mode: its decisions are recorded next to the ones of the enforced policy
+// until the end of the trial, without deciding anything.
+type ShadowPolicy struct {
+	Rules     []permission.PolicyRule
+	StartedAt int64
+	Until     int64
+}
+
+// Active reports whether the trial of the shadow policy is still running.
+func (p *ShadowPolicy) Active(now time.Time) bool {
+	return now.UnixMilli() < p.Until
+}
+
+// ShadowDecisionCount counts the requests decided one way by the enforced
+// policy and another, or the same, by the shadow policy.
+type ShadowDecisionCount struct {
+	Actual permission.PolicyDecision
+	Shadow permission.PolicyDecision
+	Count  int64
+}
+
+// ShadowMismatch is a request the shadow policy would have decided differently.
+type ShadowMismatch struct {
+	SessionID  string
+	ToolName   string
+	Subject    string
+	Actual     permission.PolicyDecision
+	Shadow     permission.PolicyDecision
+	ActualRule string
+	ShadowRule string
+	CreatedAt  int64
+}
+
+// ShadowReport compares the decisions of the enforced and shadow policies of
+// a project since the trial started.
+type ShadowReport struct {
+	Policy *ShadowPolicy
+	Total  int64
+	Agreed int64
+	// WouldDeny counts the requests the shadow policy denies but the enforced
+	// one did not, the edits a rollout would block.
+	WouldDeny  int64
+	WouldAllow int64
+	WouldAsk   int64
+	Counts     []ShadowDecisionCount
+	// Mismatches lists the latest disagreeing decisions, newest first.
+	Mismatches []ShadowMismatch
+}
+
+func (s *service) StartShadowPolicy(ctx context.Context, projectID string, rules []permission.PolicyRule, period time.Duration) (ShadowPolicy, error) {
+	if period <= 0 {
+		period = DefaultShadowPeriod
+	}
+	if period > MaxShadowPeriod {
+		return ShadowPolicy{}, fmt.Errorf("shadow period exceeds %s", MaxShadowPeriod)
+	}
+	if rules == nil {
+		rules = []permission.PolicyRule{}
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return ShadowPolicy{}, err
+		}
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return ShadowPolicy{}, err
+	}
+
+	// A new trial starts a new comparison
+	if err := s.q.DeleteProjectShadowDecisions(ctx, projectID); err != nil {
+		return ShadowPolicy{}, err
+	}
+	policy, err := s.q.StartProjectShadowPolicy(ctx, postgres.StartProjectShadowPolicyParams{
+		ProjectID:   projectID,
+		ShadowRules: sql.NullString{String: string(data), Valid: true},
+		ShadowUntil: sql.NullInt64{Int64: time.Now().Add(period).UnixMilli(), Valid: true},
+	})
+	if err != nil {
+		return ShadowPolicy{}, err
+	}
+	return ShadowPolicy{
+		Rules:     rules,
+		StartedAt: policy.ShadowStartedAt.Int64,
+		Until:     policy.ShadowUntil.Int64,
+	}, nil
+}
+
+func (s *service) GetShadowPolicy(ctx context.Context, projectID string) (*ShadowPolicy, error) {
+	policy, err := s.q.GetProjectPermissionPolicy(ctx, projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !policy.ShadowRules.Valid {
+		return nil, nil
+	}
+	rules := []permission.PolicyRule{}
+	if err := json.Unmarshal([]byte(policy.ShadowRules.String), &rules); err != nil {
+		return nil, fmt.Errorf("invalid shadow permission policy of project %s: %w", projectID, err)
+	}
+	return &ShadowPolicy{
+		Rules:     rules,
+		StartedAt: policy.ShadowStartedAt.Int64,
+		Until:     policy.ShadowUntil.Int64,
+	}, nil
+}
+
+func (s *service) StopShadowPolicy(ctx context.Context, projectID string) error {
+	return s.q.StopProjectShadowPolicy(ctx, projectID)
+}
+
+func (s *service) RecordShadowDecision(ctx context.Context, projectID string, decision permission.ShadowDecision) error {
+	return s.q.CreatePermissionShadowDecision(ctx, postgres.CreatePermissionShadowDecisionParams{
+		ID:         uuid.New().String(),
+		ProjectID:  projectID,
+		SessionID:  decision.SessionID,
+		ToolName:   decision.ToolName,
+		Subject:    decision.Subject,
+		Actual:     string(decision.Actual),
+		Shadow:     string(decision.Shadow),
+		ActualRule: decision.ActualRule,
+		ShadowRule: decision.ShadowRule,
+	})
+}
+
+func (s *service) GetShadowReport(ctx context.Context, projectID string) (ShadowReport, error) {
+	policy, err := s.GetShadowPolicy(ctx, projectID)
+	if err != nil {
+		return ShadowReport{}, err
+	}
+	counts, err := s.q.CountProjectShadowDecisions(ctx, projectID)
+	if err != nil {
+		return ShadowReport{}, err
+	}
+	mismatches, err := s.q.ListProjectShadowMismatches(ctx, postgres.ListProjectShadowMismatchesParams{
+		ProjectID: projectID,
+		Limit:     maxShadowMismatches,
+	})
+	if err != nil {
+		return ShadowReport{}, err
+	}
+	return newShadowReport(policy, counts, mismatches), nil
+}
+
+// newShadowReport sums up the decision counts of a shadow policy trial.
+func newShadowReport(policy *ShadowPolicy, counts []postgres.CountProjectShadowDecisionsRow, mismatches []postgres.PermissionShadowDecision) ShadowReport {
+	report := ShadowReport{
+		Policy:     policy,
+		Counts:     make([]ShadowDecisionCount, len(counts)),
+		Mismatches: make([]ShadowMismatch, len(mismatches)),
+	}
+	for i, row := range counts {
+		count := ShadowDecisionCount{
+			Actual: permission.PolicyDecision(row.Actual),
+			Shadow: permission.PolicyDecision(row.Shadow),
+			Count:  row.Count,
+		}
+		report.Counts[i] = count
+		report.Total += count.Count
+		switch {
+		case count.Actual == count.Shadow:
+			report.Agreed += count.Count
+		case count.Shadow == permission.PolicyDecisionDeny:
+			report.WouldDeny += count.Count
+		case count.Shadow == permission.PolicyDecisionAllow:
+			report.WouldAllow += count.Count
+		default:
+			report.WouldAsk += count.Count
+		}
+	}
+	for i, item := range mismatches {
+		report.Mismatches[i] = ShadowMismatch{
+			SessionID:  item.SessionID,
+			ToolName:   item.ToolName,
+			Subject:    item.Subject,
+			Actual:     permission.PolicyDecision(item.Actual),
+			Shadow:     permission.PolicyDecision(item.Shadow),
+			ActualRule: item.ActualRule,
+			ShadowRule: item.ShadowRule,
+			CreatedAt:  item.CreatedAt,
+		}
+	}
+	return report
+}
@@ -0,0 +1,38 @@
+package project
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewShadowReport(t *testing.T) {
+	report := newShadowReport(nil, []postgres.CountProjectShadowDecisionsRow{
+		{Actual: "allow", Shadow: "allow", Count: 40},
+		{Actual: "allow", Shadow: "deny", Count: 3},
+		{Actual: "ask", Shadow: "allow", Count: 5},
+		{Actual: "ask", Shadow: "ask", Count: 10},
+		{Actual: "deny", Shadow: "ask", Count: 2},
+	}, []postgres.PermissionShadowDecision{
+		{ToolName: "edit", Subject: "src/gen/api.go", Actual: "allow", Shadow: "deny", ShadowRule: "deny edit(src/gen/**)"},
+	})
+
+	assert.EqualValues(t, 60, report.Total)
+	assert.EqualValues(t, 50, report.Agreed)
+	assert.EqualValues(t, 3, report.WouldDeny)
+	assert.EqualValues(t, 5, report.WouldAllow)
+	assert.EqualValues(t, 2, report.WouldAsk)
+	assert.Len(t, report.Counts, 5)
+	assert.Equal(t, permission.PolicyDecisionDeny, report.Mismatches[0].Shadow)
+	assert.Equal(t, "src/gen/api.go", report.Mismatches[0].Subject)
+}
+
+func TestShadowPolicyActive(t *testing.T) {
+	now := time.Now()
+	policy := ShadowPolicy{Until: now.Add(time.Hour).UnixMilli()}
+	assert.True(t, policy.Active(now))
+	assert.False(t, policy.Active(now.Add(2*time.Hour)))
+}
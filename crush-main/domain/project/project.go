@@ -3,7 +3,10 @@ package project
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
+	"github.com/rolling1314/rolling-crush/domain/permission"
 	"github.com/rolling1314/rolling-crush/infra/postgres"
 	"github.com/google/uuid"
 )
@@ -31,15 +34,120 @@ type Project struct {
 	BackendCommand   sql.NullString
 	BackendLanguage  sql.NullString
 	Subdomain        sql.NullString
+	// SystemPrompt is added to the system prompt of the agent in the
+	// project, e.g. the framework and style guide of the team.
+	SystemPrompt string
+	// PermissionTimeout is how many seconds a permission request of the
+	// agent waits for the user in the project, 0 uses the server default.
+	PermissionTimeout int32
+	// RetentionDays is how many days an inactive session of the project is
+	// kept before it is soft-deleted, 0 uses the server default and -1 keeps
+	// the sessions.
+	RetentionDays int32
+	// CPULimit, MemoryLimitMB and DiskLimitMB are the resources the project
+	// container was created with, 0 means unlimited.
+	CPULimit      float64
+	MemoryLimitMB int32
+	DiskLimitMB   int32
 }
 
+// MaxSystemPrompt bounds the system prompt of a project.
+const MaxSystemPrompt = 32 * 1024
+
+// ErrSystemPromptTooLong is returned when the system prompt of a project
+// exceeds MaxSystemPrompt.
+var ErrSystemPromptTooLong = fmt.Errorf("system_prompt exceeds %d bytes", MaxSystemPrompt)
+
+// MaxPermissionTimeout bounds the permission timeout of a project, in seconds.
+const MaxPermissionTimeout = 24 * 60 * 60
+
+// ErrInvalidPermissionTimeout is returned when the permission timeout of a
+// project is negative or exceeds MaxPermissionTimeout.
+var ErrInvalidPermissionTimeout = fmt.Errorf("permission_timeout must be between 0 and %d seconds", MaxPermissionTimeout)
+
+// MaxRetentionDays bounds the session retention of a project.
+const MaxRetentionDays = 10 * 365
+
+// ErrInvalidRetentionDays is returned when the session retention of a project
+// is below -1 or exceeds MaxRetentionDays.
+var ErrInvalidRetentionDays = fmt.Errorf("retention_days must be -1 to keep sessions, 0 for the server default or up to %d days", MaxRetentionDays)
+
+// ErrInvalidResourceLimits is returned when a resource limit of a project is
+// negative.
+var ErrInvalidResourceLimits = fmt.Errorf("resource limits cannot be negative")
+
 type Service interface {
 	Create(ctx context.Context, userID, name, description, externalIP, workspacePath string, frontendPort int32) (Project, error)
 	GetByID(ctx context.Context, id string) (Project, error)
 	ListByUser(ctx context.Context, userID string) ([]Project, error)
+	// ListAll returns the projects of every user, oldest first.
+	ListAll(ctx context.Context) ([]Project, error)
 	Update(ctx context.Context, project Project) (Project, error)
 	Delete(ctx context.Context, id string) error
 	GetSessions(ctx context.Context, projectID string) ([]postgres.Session, error)
+	// Pause starts a maintenance window, replacing any existing one.
+	Pause(ctx context.Context, projectID string, params PauseParams) (Pause, error)
+	// Resume ends the maintenance window of a project.
+	Resume(ctx context.Context, projectID string) error
+	// GetPause returns the active maintenance window, or nil if the project is not paused.
+	GetPause(ctx context.Context, projectID string) (*Pause, error)
+	// SetWebhook creates or replaces the inbound webhook of a project.
+	SetWebhook(ctx context.Context, projectID string, params WebhookParams) (Webhook, error)
+	// GetWebhook returns the webhook of a project, or ErrWebhookNotFound.
+	GetWebhook(ctx context.Context, projectID string) (*Webhook, error)
+	// DeleteWebhook removes the webhook of a project.
+	DeleteWebhook(ctx context.Context, projectID string) error
+	// CreateChatHook adds a Slack or Discord hook notified of finished turns.
+	CreateChatHook(ctx context.Context, projectID string, params ChatHookParams) (ChatHook, error)
+	// GetChatHook returns a chat hook of a project, or ErrChatHookNotFound.
+	GetChatHook(ctx context.Context, projectID, hookID string) (ChatHook, error)
+	// ListChatHooks returns the chat hooks of a project.
+	ListChatHooks(ctx context.Context, projectID string) ([]ChatHook, error)
+	// UpdateChatHook replaces the configuration of a chat hook.
+	UpdateChatHook(ctx context.Context, projectID, hookID string, params ChatHookParams) (ChatHook, error)
+	// DeleteChatHook removes a chat hook of a project.
+	DeleteChatHook(ctx context.Context, projectID, hookID string) error
+	// GetPermissionPolicy returns the permission policy rules of a project,
+	// empty when it has none.
+	GetPermissionPolicy(ctx context.Context, projectID string) ([]permission.PolicyRule, error)
+	// SetPermissionPolicy replaces the permission policy rules of a project.
+	SetPermissionPolicy(ctx context.Context, projectID string, rules []permission.PolicyRule) ([]permission.PolicyRule, error)
+	// StartShadowPolicy trials candidate policy rules in shadow mode for a
+	// period, DefaultShadowPeriod when zero, replacing any running trial.
+	StartShadowPolicy(ctx context.Context, projectID string, rules []permission.PolicyRule, period time.Duration) (ShadowPolicy, error)
+	// GetShadowPolicy returns the shadow policy of a project, nil when there is none.
+	GetShadowPolicy(ctx context.Context, projectID string) (*ShadowPolicy, error)
+	// StopShadowPolicy ends the shadow policy trial of a project.
+	StopShadowPolicy(ctx context.Context, projectID string) error
+	// RecordShadowDecision stores the decisions of the enforced and shadow
+	// policies of a project for a permission request.
+	RecordShadowDecision(ctx context.Context, projectID string, decision permission.ShadowDecision) error
+	// GetShadowReport compares the decisions of the enforced and shadow policies.
+	GetShadowReport(ctx context.Context, projectID string) (ShadowReport, error)
+	// CreateBlueprint adds a session blueprint, or fails with ErrBlueprintExists.
+	CreateBlueprint(ctx context.Context, projectID string, params BlueprintParams) (Blueprint, error)
+	// GetBlueprint returns a session blueprint of a project, or ErrBlueprintNotFound.
+	GetBlueprint(ctx context.Context, projectID, blueprintID string) (Blueprint, error)
+	// GetBlueprintByName returns the session blueprint of a project with the
+	// given name, or ErrBlueprintNotFound.
+	GetBlueprintByName(ctx context.Context, projectID, name string) (Blueprint, error)
+	// ListBlueprints returns the session blueprints of a project by name.
+	ListBlueprints(ctx context.Context, projectID string) ([]Blueprint, error)
+	// UpdateBlueprint replaces a session blueprint.
+	UpdateBlueprint(ctx context.Context, projectID, blueprintID string, params BlueprintParams) (Blueprint, error)
+	// DeleteBlueprint removes a session blueprint of a project.
+	DeleteBlueprint(ctx context.Context, projectID, blueprintID string) error
+	// CreateTemplate adds a project template, or fails with ErrTemplateExists.
+	CreateTemplate(ctx context.Context, params TemplateParams) (Template, error)
+	// GetTemplate returns a project template, or ErrTemplateNotFound.
+	GetTemplate(ctx context.Context, id string) (Template, error)
+	// ListTemplates returns the project templates by name.
+	ListTemplates(ctx context.Context) ([]Template, error)
+	// UpdateTemplate replaces a project template.
+	UpdateTemplate(ctx context.Context, id string, params TemplateParams) (Template, error)
+	// DeleteTemplate removes a project template, the projects created from it
+	// are kept.
+	DeleteTemplate(ctx context.Context, id string) error
 }
 
 type service struct {
@@ -100,7 +208,32 @@ func (s *service) ListByUser(ctx context.Context, userID string) ([]Project, err
 	return projects, nil
 }
 
+func (s *service) ListAll(ctx context.Context) ([]Project, error) {
+	dbProjects, err := s.q.ListProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]Project, len(dbProjects))
+	for i, dbProject := range dbProjects {
+		projects[i] = s.fromDBItem(dbProject)
+	}
+	return projects, nil
+}
+
 func (s *service) Update(ctx context.Context, project Project) (Project, error) {
+	if len(project.SystemPrompt) > MaxSystemPrompt {
+		return Project{}, ErrSystemPromptTooLong
+	}
+	if project.PermissionTimeout < 0 || project.PermissionTimeout > MaxPermissionTimeout {
+		return Project{}, ErrInvalidPermissionTimeout
+	}
+	if project.RetentionDays < -1 || project.RetentionDays > MaxRetentionDays {
+		return Project{}, ErrInvalidRetentionDays
+	}
+	if project.CPULimit < 0 || project.MemoryLimitMB < 0 || project.DiskLimitMB < 0 {
+		return Project{}, ErrInvalidResourceLimits
+	}
 	dbProject, err := s.q.UpdateProject(ctx, postgres.UpdateProjectParams{
 		ID:               project.ID,
 		Name:             project.Name,
@@ -121,6 +254,12 @@ func (s *service) Update(ctx context.Context, project Project) (Project, error)
 		BackendCommand:   project.BackendCommand,
 		BackendLanguage:  project.BackendLanguage,
 		Subdomain:        project.Subdomain,
+		SystemPrompt:     project.SystemPrompt,
+		PermissionTimeout: project.PermissionTimeout,
+		RetentionDays: project.RetentionDays,
+		CpuLimit: project.CPULimit,
+		MemoryLimitMb: project.MemoryLimitMB,
+		DiskLimitMb: project.DiskLimitMB,
 	})
 	if err != nil {
 		return Project{}, err
@@ -160,5 +299,11 @@ func (s *service) fromDBItem(item postgres.Project) Project {
 		BackendCommand:   item.BackendCommand,
 		BackendLanguage:  item.BackendLanguage,
 		Subdomain:        item.Subdomain,
+		SystemPrompt:     item.SystemPrompt,
+		PermissionTimeout: item.PermissionTimeout,
+		RetentionDays: item.RetentionDays,
+		CPULimit: item.CpuLimit,
+		MemoryLimitMB: item.MemoryLimitMb,
+		DiskLimitMB: item.DiskLimitMb,
 	}
 }
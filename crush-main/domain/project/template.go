@@ -0,0 +1,236 @@
+package project
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// Limits of a project template.
+const (
+	MaxTemplateScripts = 20
+	MaxTemplateScript  = 4 * 1024
+)
+
+var (
+	// ErrTemplateNotFound is returned when a project template does not exist.
+	ErrTemplateNotFound = errors.New("project template not found")
+	// ErrTemplateExists is returned when a template of the same name exists.
+	ErrTemplateExists = errors.New("project template already exists")
+)
+
+// TemplateBackendLanguages are the backend languages the sandbox images
+// support, empty for a frontend only project.
+var TemplateBackendLanguages = []string{"", "go", "java", "python"}
+
+// scpLikeRepoPattern matches git remotes such as git@github.com:org/repo.git.
+var scpLikeRepoPattern = regexp.MustCompile(`^[\w.-]+@[\w.-]+:[\w./~-]+$`)
+
+// Template is a starting point of new projects: the stack of the sandbox
+// container, a starter repository cloned into the workspace and scripts run
+// once the workspace is created, e.g. installing the dependencies.
+type Template struct {
+	ID              string
+	Name            string
+	Description     string
+	BackendLanguage string
+	NeedDatabase    bool
+	// FrontendCommand and BackendCommand start the servers of the project,
+	// empty keeps those of the sandbox image.
+	FrontendCommand string
+	BackendCommand  string
+	// StarterRepo is cloned into the workspace, at StarterRef when set.
+	StarterRepo string
+	StarterRef  string
+	Scripts     []string
+	CreatedAt   int64
+	UpdatedAt   int64
+}
+
+// TemplateParams describes a project template.
+type TemplateParams struct {
+	Name            string
+	Description     string
+	BackendLanguage string
+	NeedDatabase    bool
+	FrontendCommand string
+	BackendCommand  string
+	StarterRepo     string
+	StarterRef      string
+	Scripts         []string
+}
+
+// validateTemplate trims the scripts of a template and checks its name, stack
+// and starter repository.
+func validateTemplate(params *TemplateParams) error {
+	if !blueprintNamePattern.MatchString(params.Name) {
+		return errors.New("name must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if !slices.Contains(TemplateBackendLanguages, params.BackendLanguage) {
+		return fmt.Errorf("unsupported backend_language %q", params.BackendLanguage)
+	}
+	if params.StarterRepo != "" {
+		if err := validateStarterRepo(params.StarterRepo); err != nil {
+			return err
+		}
+	} else if params.StarterRef != "" {
+		return errors.New("starter_ref requires a starter_repo")
+	}
+	// The ref is passed to git, it must not read as an option
+	if strings.HasPrefix(params.StarterRef, "-") || strings.ContainsAny(params.StarterRef, " \t\n") {
+		return fmt.Errorf("invalid starter_ref %q", params.StarterRef)
+	}
+
+	scripts := make([]string, 0, len(params.Scripts))
+	for _, script := range params.Scripts {
+		if script = strings.TrimSpace(script); script == "" {
+			continue
+		}
+		if len(script) > MaxTemplateScript {
+			return fmt.Errorf("a script exceeds %d bytes", MaxTemplateScript)
+		}
+		scripts = append(scripts, script)
+	}
+	if len(scripts) > MaxTemplateScripts {
+		return fmt.Errorf("a template has at most %d scripts", MaxTemplateScripts)
+	}
+	params.Scripts = scripts
+	return nil
+}
+
+// validateStarterRepo accepts https and ssh git remotes.
+func validateStarterRepo(repo string) error {
+	if scpLikeRepoPattern.MatchString(repo) {
+		return nil
+	}
+	u, err := url.Parse(repo)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "ssh") || u.Host == "" || u.Path == "" {
+		return fmt.Errorf("starter_repo %q is not an https or ssh git remote", repo)
+	}
+	return nil
+}
+
+func (s *service) CreateTemplate(ctx context.Context, params TemplateParams) (Template, error) {
+	if err := validateTemplate(&params); err != nil {
+		return Template{}, err
+	}
+	if _, err := s.q.GetProjectTemplateByName(ctx, params.Name); err == nil {
+		return Template{}, ErrTemplateExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return Template{}, err
+	}
+
+	scripts, err := json.Marshal(params.Scripts)
+	if err != nil {
+		return Template{}, err
+	}
+	dbTemplate, err := s.q.CreateProjectTemplate(ctx, postgres.CreateProjectTemplateParams{
+		ID:              uuid.New().String(),
+		Name:            params.Name,
+		Description:     params.Description,
+		BackendLanguage: params.BackendLanguage,
+		NeedDatabase:    params.NeedDatabase,
+		FrontendCommand: params.FrontendCommand,
+		BackendCommand:  params.BackendCommand,
+		StarterRepo:     params.StarterRepo,
+		StarterRef:      params.StarterRef,
+		Scripts:         string(scripts),
+	})
+	if err != nil {
+		return Template{}, err
+	}
+	return templateFromDB(dbTemplate)
+}
+
+func (s *service) GetTemplate(ctx context.Context, id string) (Template, error) {
+	dbTemplate, err := s.q.GetProjectTemplate(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Template{}, ErrTemplateNotFound
+	}
+	if err != nil {
+		return Template{}, err
+	}
+	return templateFromDB(dbTemplate)
+}
+
+func (s *service) ListTemplates(ctx context.Context) ([]Template, error) {
+	dbTemplates, err := s.q.ListProjectTemplates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]Template, len(dbTemplates))
+	for i, item := range dbTemplates {
+		if templates[i], err = templateFromDB(item); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+func (s *service) UpdateTemplate(ctx context.Context, id string, params TemplateParams) (Template, error) {
+	if err := validateTemplate(&params); err != nil {
+		return Template{}, err
+	}
+	if existing, err := s.q.GetProjectTemplateByName(ctx, params.Name); err == nil && existing.ID != id {
+		return Template{}, ErrTemplateExists
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Template{}, err
+	}
+
+	scripts, err := json.Marshal(params.Scripts)
+	if err != nil {
+		return Template{}, err
+	}
+	dbTemplate, err := s.q.UpdateProjectTemplate(ctx, postgres.UpdateProjectTemplateParams{
+		ID:              id,
+		Name:            params.Name,
+		Description:     params.Description,
+		BackendLanguage: params.BackendLanguage,
+		NeedDatabase:    params.NeedDatabase,
+		FrontendCommand: params.FrontendCommand,
+		BackendCommand:  params.BackendCommand,
+		StarterRepo:     params.StarterRepo,
+		StarterRef:      params.StarterRef,
+		Scripts:         string(scripts),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Template{}, ErrTemplateNotFound
+	}
+	if err != nil {
+		return Template{}, err
+	}
+	return templateFromDB(dbTemplate)
+}
+
+func (s *service) DeleteTemplate(ctx context.Context, id string) error {
+	return s.q.DeleteProjectTemplate(ctx, id)
+}
+
+func templateFromDB(item postgres.ProjectTemplate) (Template, error) {
+	template := Template{
+		ID:              item.ID,
+		Name:            item.Name,
+		Description:     item.Description,
+		BackendLanguage: item.BackendLanguage,
+		NeedDatabase:    item.NeedDatabase,
+		FrontendCommand: item.FrontendCommand,
+		BackendCommand:  item.BackendCommand,
+		StarterRepo:     item.StarterRepo,
+		StarterRef:      item.StarterRef,
+		CreatedAt:       item.CreatedAt,
+		UpdatedAt:       item.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(item.Scripts), &template.Scripts); err != nil {
+		return Template{}, fmt.Errorf("invalid scripts of template %s: %w", item.ID, err)
+	}
+	return template, nil
+}
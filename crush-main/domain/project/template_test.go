@@ -0,0 +1,52 @@
+package project
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	params := TemplateParams{
+		Name:            "go-api",
+		BackendLanguage: "go",
+		StarterRepo:     "https://github.com/example/go-api-starter.git",
+		StarterRef:      "v1.2.0",
+		Scripts:         []string{" go mod download ", "", "npm install\n"},
+	}
+	require.NoError(t, validateTemplate(&params))
+	assert.Equal(t, []string{"go mod download", "npm install"}, params.Scripts)
+
+	require.NoError(t, validateTemplate(&TemplateParams{Name: "ssh", StarterRepo: "git@github.com:example/starter.git"}))
+
+	for name, params := range map[string]TemplateParams{
+		"name":     {Name: "Go API"},
+		"language": {Name: "rust", BackendLanguage: "rust"},
+		"repo":     {Name: "local", StarterRepo: "file:///etc"},
+		"option":   {Name: "option", StarterRepo: "--upload-pack=touch /tmp/x"},
+		"ref":      {Name: "ref", StarterRepo: "https://github.com/example/starter", StarterRef: "--help"},
+		"no repo":  {Name: "ref", StarterRef: "main"},
+		"scripts":  {Name: "many", Scripts: strings.Split(strings.Repeat("s,", MaxTemplateScripts+1), ",")},
+		"script":   {Name: "long", Scripts: []string{strings.Repeat("x", MaxTemplateScript+1)}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, validateTemplate(&params))
+		})
+	}
+}
+
+func TestTemplateFromDB(t *testing.T) {
+	template, err := templateFromDB(postgres.ProjectTemplate{
+		ID:      "t1",
+		Name:    "vite",
+		Scripts: `["npm install","npm run build"]`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"npm install", "npm run build"}, template.Scripts)
+
+	_, err = templateFromDB(postgres.ProjectTemplate{ID: "t2", Scripts: "npm install"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,435 @@
+package project
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// WebhookProvider is the SCM that sends webhook deliveries.
+type WebhookProvider string
+
+const (
+	WebhookProviderGitHub WebhookProvider = "github"
+	WebhookProviderGitLab WebhookProvider = "gitlab"
+)
+
+// Webhook event kinds a project can subscribe to.
+const (
+	WebhookEventPush        = "push"
+	WebhookEventPullRequest = "pull_request"
+)
+
+// DefaultWebhookPrompt is used when a webhook has no prompt template.
+const DefaultWebhookPrompt = `{{if eq .Kind "pull_request"}}Review pull request #{{.Number}} "{{.Title}}" in {{.Repository}} ({{.URL}}).
+It merges {{.Branch}} into {{.TargetBranch}} at commit {{.HeadSHA}}. Summarize the changes and point out bugs or risky code.{{else}}Review the new commits pushed to {{.Branch}} in {{.Repository}}:
+{{range .Commits}}- {{.ID}} {{.Message}}
+{{end}}Summarize the changes and point out bugs or risky code.{{end}}`
+
+var (
+	// ErrInvalidWebhookSignature is returned when a delivery fails HMAC or token verification.
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	// ErrWebhookNotFound is returned when a project has no webhook configured.
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+// Webhook is the inbound webhook configuration of a project. Deliveries for
+// the subscribed events start an agent run in a fresh session with the
+// rendered prompt template.
+type Webhook struct {
+	ProjectID string
+	// Secret verifies deliveries: the HMAC key for GitHub, the token for GitLab.
+	Secret         string
+	Events         []string
+	PromptTemplate string
+	// PostComment posts the final answer of a pull request run back as a comment.
+	PostComment bool
+	// SCMToken authenticates the comment request against the SCM API.
+	SCMToken  string
+	Enabled   bool
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// WebhookParams describes a webhook configuration.
+type WebhookParams struct {
+	// Secret is generated, or the current one kept, when empty.
+	Secret         string
+	Events         []string
+	PromptTemplate string
+	PostComment    bool
+	// SCMToken keeps the current token when empty.
+	SCMToken string
+	Enabled  bool
+}
+
+// Handles reports whether the webhook subscribes to the given event kind.
+func (w *Webhook) Handles(kind string) bool {
+	return w.Enabled && slices.Contains(w.Events, kind)
+}
+
+// RenderPrompt renders the prompt template of the webhook for an event.
+func (w *Webhook) RenderPrompt(event *WebhookEvent) (string, error) {
+	text := w.PromptTemplate
+	if strings.TrimSpace(text) == "" {
+		text = DefaultWebhookPrompt
+	}
+	tmpl, err := template.New("webhook").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// WebhookCommit is a commit included in a push event.
+type WebhookCommit struct {
+	ID      string
+	Message string
+	Author  string
+}
+
+// WebhookEvent is the provider independent view of a delivery, used as the
+// data of prompt templates.
+type WebhookEvent struct {
+	Provider   WebhookProvider
+	Kind       string
+	Action     string
+	Repository string
+	Sender     string
+	// Branch is the pushed branch, or the source branch of a pull request.
+	Branch       string
+	TargetBranch string
+	HeadSHA      string
+	Commits      []WebhookCommit
+	// Number, Title and URL describe the pull (merge) request.
+	Number int64
+	Title  string
+	URL    string
+	// CommentURL is the API endpoint used to comment on the pull request.
+	CommentURL string
+}
+
+// VerifyGitHubSignature checks the X-Hub-Signature-256 header of a GitHub delivery.
+func VerifyGitHubSignature(secret string, body []byte, signature string) error {
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok || secret == "" {
+		return ErrInvalidWebhookSignature
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// VerifyGitLabToken checks the X-Gitlab-Token header of a GitLab delivery.
+func VerifyGitLabToken(secret, token string) error {
+	if secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(token)) != 1 {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// ParseWebhookEvent decodes a delivery. It returns nil without error for
+// events that never trigger a run, such as pings, branch deletions or closed
+// pull requests.
+func ParseWebhookEvent(provider WebhookProvider, eventName string, body []byte) (*WebhookEvent, error) {
+	switch provider {
+	case WebhookProviderGitHub:
+		return parseGitHubEvent(eventName, body)
+	case WebhookProviderGitLab:
+		return parseGitLabEvent(eventName, body)
+	default:
+		return nil, fmt.Errorf("unsupported webhook provider %q", provider)
+	}
+}
+
+type githubRepository struct {
+	FullName string `json:"full_name"`
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+func parseGitHubEvent(eventName string, body []byte) (*WebhookEvent, error) {
+	switch eventName {
+	case "push":
+		var payload struct {
+			Ref        string           `json:"ref"`
+			After      string           `json:"after"`
+			Deleted    bool             `json:"deleted"`
+			Repository githubRepository `json:"repository"`
+			Sender     githubUser       `json:"sender"`
+			Commits    []struct {
+				ID      string `json:"id"`
+				Message string `json:"message"`
+				Author  struct {
+					Name string `json:"name"`
+				} `json:"author"`
+			} `json:"commits"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("invalid push payload: %w", err)
+		}
+		if payload.Deleted || len(payload.Commits) == 0 {
+			return nil, nil
+		}
+		event := &WebhookEvent{
+			Provider:   WebhookProviderGitHub,
+			Kind:       WebhookEventPush,
+			Repository: payload.Repository.FullName,
+			Sender:     payload.Sender.Login,
+			Branch:     strings.TrimPrefix(payload.Ref, "refs/heads/"),
+			HeadSHA:    payload.After,
+		}
+		for _, c := range payload.Commits {
+			event.Commits = append(event.Commits, WebhookCommit{ID: c.ID, Message: c.Message, Author: c.Author.Name})
+		}
+		return event, nil
+
+	case "pull_request":
+		var payload struct {
+			Action      string `json:"action"`
+			Number      int64  `json:"number"`
+			PullRequest struct {
+				Title       string `json:"title"`
+				HTMLURL     string `json:"html_url"`
+				CommentsURL string `json:"comments_url"`
+				Head        struct {
+					Ref string `json:"ref"`
+					SHA string `json:"sha"`
+				} `json:"head"`
+				Base struct {
+					Ref string `json:"ref"`
+				} `json:"base"`
+			} `json:"pull_request"`
+			Repository githubRepository `json:"repository"`
+			Sender     githubUser       `json:"sender"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("invalid pull_request payload: %w", err)
+		}
+		if !slices.Contains([]string{"opened", "reopened", "synchronize"}, payload.Action) {
+			return nil, nil
+		}
+		return &WebhookEvent{
+			Provider:     WebhookProviderGitHub,
+			Kind:         WebhookEventPullRequest,
+			Action:       payload.Action,
+			Repository:   payload.Repository.FullName,
+			Sender:       payload.Sender.Login,
+			Branch:       payload.PullRequest.Head.Ref,
+			TargetBranch: payload.PullRequest.Base.Ref,
+			HeadSHA:      payload.PullRequest.Head.SHA,
+			Number:       payload.Number,
+			Title:        payload.PullRequest.Title,
+			URL:          payload.PullRequest.HTMLURL,
+			CommentURL:   payload.PullRequest.CommentsURL,
+		}, nil
+	}
+	return nil, nil
+}
+
+type gitlabProject struct {
+	ID                int64  `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+// apiURL returns the REST API root of the GitLab instance hosting the project.
+func (p gitlabProject) apiURL() string {
+	root := strings.TrimSuffix(p.WebURL, "/"+p.PathWithNamespace)
+	return root + "/api/v4"
+}
+
+func parseGitLabEvent(eventName string, body []byte) (*WebhookEvent, error) {
+	switch eventName {
+	case "Push Hook":
+		var payload struct {
+			Ref      string        `json:"ref"`
+			After    string        `json:"after"`
+			UserName string        `json:"user_username"`
+			Project  gitlabProject `json:"project"`
+			Commits  []struct {
+				ID      string `json:"id"`
+				Message string `json:"message"`
+				Author  struct {
+					Name string `json:"name"`
+				} `json:"author"`
+			} `json:"commits"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("invalid push payload: %w", err)
+		}
+		if strings.Trim(payload.After, "0") == "" || len(payload.Commits) == 0 {
+			return nil, nil
+		}
+		event := &WebhookEvent{
+			Provider:   WebhookProviderGitLab,
+			Kind:       WebhookEventPush,
+			Repository: payload.Project.PathWithNamespace,
+			Sender:     payload.UserName,
+			Branch:     strings.TrimPrefix(payload.Ref, "refs/heads/"),
+			HeadSHA:    payload.After,
+		}
+		for _, c := range payload.Commits {
+			event.Commits = append(event.Commits, WebhookCommit{ID: c.ID, Message: c.Message, Author: c.Author.Name})
+		}
+		return event, nil
+
+	case "Merge Request Hook":
+		var payload struct {
+			User struct {
+				Username string `json:"username"`
+			} `json:"user"`
+			Project          gitlabProject `json:"project"`
+			ObjectAttributes struct {
+				IID          int64  `json:"iid"`
+				Title        string `json:"title"`
+				URL          string `json:"url"`
+				Action       string `json:"action"`
+				SourceBranch string `json:"source_branch"`
+				TargetBranch string `json:"target_branch"`
+				LastCommit   struct {
+					ID string `json:"id"`
+				} `json:"last_commit"`
+			} `json:"object_attributes"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("invalid merge request payload: %w", err)
+		}
+		attrs := payload.ObjectAttributes
+		if !slices.Contains([]string{"open", "reopen", "update"}, attrs.Action) {
+			return nil, nil
+		}
+		return &WebhookEvent{
+			Provider:     WebhookProviderGitLab,
+			Kind:         WebhookEventPullRequest,
+			Action:       attrs.Action,
+			Repository:   payload.Project.PathWithNamespace,
+			Sender:       payload.User.Username,
+			Branch:       attrs.SourceBranch,
+			TargetBranch: attrs.TargetBranch,
+			HeadSHA:      attrs.LastCommit.ID,
+			Number:       attrs.IID,
+			Title:        attrs.Title,
+			URL:          attrs.URL,
+			CommentURL:   fmt.Sprintf("%s/projects/%d/merge_requests/%d/notes", payload.Project.apiURL(), payload.Project.ID, attrs.IID),
+		}, nil
+	}
+	return nil, nil
+}
+
+func (s *service) SetWebhook(ctx context.Context, projectID string, params WebhookParams) (Webhook, error) {
+	events := params.Events
+	if len(events) == 0 {
+		events = []string{WebhookEventPush, WebhookEventPullRequest}
+	}
+	for _, event := range events {
+		if event != WebhookEventPush && event != WebhookEventPullRequest {
+			return Webhook{}, fmt.Errorf("invalid webhook event %q", event)
+		}
+	}
+	if params.PromptTemplate != "" {
+		if _, err := template.New("webhook").Parse(params.PromptTemplate); err != nil {
+			return Webhook{}, fmt.Errorf("invalid prompt template: %w", err)
+		}
+	}
+	// Secrets are write-only in the API, keep the current ones when omitted
+	secret, scmToken := params.Secret, params.SCMToken
+	if secret == "" || scmToken == "" {
+		existing, err := s.GetWebhook(ctx, projectID)
+		if err != nil && !errors.Is(err, ErrWebhookNotFound) {
+			return Webhook{}, err
+		}
+		if existing != nil {
+			secret = cmp.Or(secret, existing.Secret)
+			scmToken = cmp.Or(scmToken, existing.SCMToken)
+		}
+	}
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			return Webhook{}, err
+		}
+	}
+	if params.PostComment && scmToken == "" {
+		return Webhook{}, errors.New("scm_token is required to post comments")
+	}
+
+	dbWebhook, err := s.q.UpsertProjectWebhook(ctx, postgres.UpsertProjectWebhookParams{
+		ProjectID:      projectID,
+		Secret:         secret,
+		Events:         strings.Join(events, ","),
+		PromptTemplate: params.PromptTemplate,
+		PostComment:    params.PostComment,
+		ScmToken:       scmToken,
+		Enabled:        params.Enabled,
+	})
+	if err != nil {
+		return Webhook{}, err
+	}
+	return webhookFromDB(dbWebhook), nil
+}
+
+func (s *service) GetWebhook(ctx context.Context, projectID string) (*Webhook, error) {
+	dbWebhook, err := s.q.GetProjectWebhook(ctx, projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	webhook := webhookFromDB(dbWebhook)
+	return &webhook, nil
+}
+
+func (s *service) DeleteWebhook(ctx context.Context, projectID string) error {
+	return s.q.DeleteProjectWebhook(ctx, projectID)
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func webhookFromDB(item postgres.ProjectWebhook) Webhook {
+	return Webhook{
+		ProjectID:      item.ProjectID,
+		Secret:         item.Secret,
+		Events:         strings.Split(item.Events, ","),
+		PromptTemplate: item.PromptTemplate,
+		PostComment:    item.PostComment,
+		SCMToken:       item.ScmToken,
+		Enabled:        item.Enabled,
+		CreatedAt:      item.CreatedAt,
+		UpdatedAt:      item.UpdatedAt,
+	}
+}
@@ -0,0 +1,137 @@
+package project
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyGitHubSignature(t *testing.T) {
+	body := []byte(`{"zen":"Keep it logically awesome."}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.NoError(t, VerifyGitHubSignature("s3cret", body, signature))
+	assert.ErrorIs(t, VerifyGitHubSignature("other", body, signature), ErrInvalidWebhookSignature)
+	assert.ErrorIs(t, VerifyGitHubSignature("s3cret", []byte("{}"), signature), ErrInvalidWebhookSignature)
+	assert.ErrorIs(t, VerifyGitHubSignature("s3cret", body, ""), ErrInvalidWebhookSignature)
+	assert.ErrorIs(t, VerifyGitHubSignature("s3cret", body, "sha256=zz"), ErrInvalidWebhookSignature)
+}
+
+func TestVerifyGitLabToken(t *testing.T) {
+	assert.NoError(t, VerifyGitLabToken("s3cret", "s3cret"))
+	assert.ErrorIs(t, VerifyGitLabToken("s3cret", "wrong"), ErrInvalidWebhookSignature)
+	assert.ErrorIs(t, VerifyGitLabToken("", ""), ErrInvalidWebhookSignature)
+}
+
+func TestParseWebhookEvent(t *testing.T) {
+	t.Run("github push", func(t *testing.T) {
+		event, err := ParseWebhookEvent(WebhookProviderGitHub, "push", []byte(`{
+			"ref": "refs/heads/main",
+			"after": "abc123",
+			"repository": {"full_name": "acme/app"},
+			"sender": {"login": "octocat"},
+			"commits": [{"id": "abc123", "message": "Fix login", "author": {"name": "Octo"}}]
+		}`))
+		require.NoError(t, err)
+		require.NotNil(t, event)
+		assert.Equal(t, WebhookEventPush, event.Kind)
+		assert.Equal(t, "main", event.Branch)
+		assert.Equal(t, "acme/app", event.Repository)
+		assert.Equal(t, []WebhookCommit{{ID: "abc123", Message: "Fix login", Author: "Octo"}}, event.Commits)
+	})
+
+	t.Run("github branch deletion is ignored", func(t *testing.T) {
+		event, err := ParseWebhookEvent(WebhookProviderGitHub, "push", []byte(`{"ref": "refs/heads/old", "deleted": true}`))
+		require.NoError(t, err)
+		assert.Nil(t, event)
+	})
+
+	t.Run("github pull request", func(t *testing.T) {
+		event, err := ParseWebhookEvent(WebhookProviderGitHub, "pull_request", []byte(`{
+			"action": "opened",
+			"number": 7,
+			"pull_request": {
+				"title": "Add search",
+				"html_url": "https://github.com/acme/app/pull/7",
+				"comments_url": "https://api.github.com/repos/acme/app/issues/7/comments",
+				"head": {"ref": "search", "sha": "def456"},
+				"base": {"ref": "main"}
+			},
+			"repository": {"full_name": "acme/app"}
+		}`))
+		require.NoError(t, err)
+		require.NotNil(t, event)
+		assert.Equal(t, WebhookEventPullRequest, event.Kind)
+		assert.Equal(t, int64(7), event.Number)
+		assert.Equal(t, "search", event.Branch)
+		assert.Equal(t, "main", event.TargetBranch)
+		assert.Equal(t, "https://api.github.com/repos/acme/app/issues/7/comments", event.CommentURL)
+	})
+
+	t.Run("github closed pull request is ignored", func(t *testing.T) {
+		event, err := ParseWebhookEvent(WebhookProviderGitHub, "pull_request", []byte(`{"action": "closed", "number": 7}`))
+		require.NoError(t, err)
+		assert.Nil(t, event)
+	})
+
+	t.Run("github ping is ignored", func(t *testing.T) {
+		event, err := ParseWebhookEvent(WebhookProviderGitHub, "ping", []byte(`{"zen": "hi"}`))
+		require.NoError(t, err)
+		assert.Nil(t, event)
+	})
+
+	t.Run("gitlab merge request", func(t *testing.T) {
+		event, err := ParseWebhookEvent(WebhookProviderGitLab, "Merge Request Hook", []byte(`{
+			"user": {"username": "dev"},
+			"project": {"id": 42, "path_with_namespace": "group/app", "web_url": "https://gitlab.example.com/group/app"},
+			"object_attributes": {
+				"iid": 3,
+				"title": "Refactor",
+				"url": "https://gitlab.example.com/group/app/-/merge_requests/3",
+				"action": "open",
+				"source_branch": "refactor",
+				"target_branch": "main",
+				"last_commit": {"id": "fff000"}
+			}
+		}`))
+		require.NoError(t, err)
+		require.NotNil(t, event)
+		assert.Equal(t, WebhookEventPullRequest, event.Kind)
+		assert.Equal(t, "fff000", event.HeadSHA)
+		assert.Equal(t, "https://gitlab.example.com/api/v4/projects/42/merge_requests/3/notes", event.CommentURL)
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		_, err := ParseWebhookEvent(WebhookProviderGitLab, "Push Hook", []byte(`not json`))
+		assert.Error(t, err)
+	})
+}
+
+func TestWebhookRenderPrompt(t *testing.T) {
+	event := &WebhookEvent{
+		Kind:       WebhookEventPush,
+		Repository: "acme/app",
+		Branch:     "main",
+		Commits:    []WebhookCommit{{ID: "abc123", Message: "Fix login"}},
+	}
+
+	t.Run("default template", func(t *testing.T) {
+		prompt, err := (&Webhook{}).RenderPrompt(event)
+		require.NoError(t, err)
+		assert.Contains(t, prompt, "Review the new commits pushed to main in acme/app")
+		assert.Contains(t, prompt, "- abc123 Fix login")
+	})
+
+	t.Run("custom template", func(t *testing.T) {
+		webhook := &Webhook{PromptTemplate: "Check {{.Repository}}@{{.Branch}}"}
+		prompt, err := webhook.RenderPrompt(event)
+		require.NoError(t, err)
+		assert.Equal(t, "Check acme/app@main", prompt)
+	})
+}
@@ -0,0 +1,35 @@
+package project
+
+import (
+	"cmp"
+	"errors"
+	"path"
+	"strings"
+)
+
+// ErrWorkdirOutsideProject is returned for working directories that are not
+// inside the workspace of their project.
+var ErrWorkdirOutsideProject = errors.New("working directory is outside of the project workspace")
+
+// Workdir returns the directory the agent works in for the project.
+func (p Project) Workdir() string {
+	return cmp.Or(p.WorkdirPath.String, p.WorkspacePath)
+}
+
+// ResolveWorkdir resolves a working directory requested for a prompt, e.g. a
+// sub-app of a monorepo. Relative directories are relative to the project's
+// working directory and the result has to be inside of it.
+func (p Project) ResolveWorkdir(dir string) (string, error) {
+	root := path.Clean(p.Workdir())
+	if dir == "" {
+		return root, nil
+	}
+	if !path.IsAbs(dir) {
+		dir = path.Join(root, dir)
+	}
+	dir = path.Clean(dir)
+	if dir != root && !strings.HasPrefix(dir, strings.TrimSuffix(root, "/")+"/") {
+		return "", ErrWorkdirOutsideProject
+	}
+	return dir, nil
+}
@@ -0,0 +1,43 @@
+package project
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProject_ResolveWorkdir(t *testing.T) {
+	p := Project{WorkspacePath: "/data/p1", WorkdirPath: sql.NullString{String: "/workspace", Valid: true}}
+
+	tests := map[string]struct {
+		dir  string
+		want string
+		err  error
+	}{
+		"default":        {"", "/workspace", nil},
+		"relative":       {"apps/web", "/workspace/apps/web", nil},
+		"absolute":       {"/workspace/apps/api/", "/workspace/apps/api", nil},
+		"root":           {"/workspace", "/workspace", nil},
+		"dot dot":        {"../etc", "", ErrWorkdirOutsideProject},
+		"nested escape":  {"apps/../../etc", "", ErrWorkdirOutsideProject},
+		"outside":        {"/etc", "", ErrWorkdirOutsideProject},
+		"sibling prefix": {"/workspace-other", "", ErrWorkdirOutsideProject},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := p.ResolveWorkdir(tt.dir)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, dir)
+		})
+	}
+
+	dir, err := Project{WorkspacePath: "/data/p1"}.ResolveWorkdir("src")
+	require.NoError(t, err)
+	assert.Equal(t, "/data/p1/src", dir, "falls back to the workspace path")
+}
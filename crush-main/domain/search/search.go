@@ -0,0 +1,126 @@
+// Package search finds messages across the sessions of a user. Text, tool
+// call inputs and tool results are indexed by Postgres, with a text search
+// for prose and a trigram index for code snippets and identifiers. Hits point
+// at the session, message and part they were found in.
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+const (
+	// DefaultLimit is the number of hits returned when no limit is given.
+	DefaultLimit = 20
+	// MaxLimit bounds the number of hits returned at once.
+	MaxLimit = 100
+	// MaxQueryLength bounds the length of a query, in characters.
+	MaxQueryLength = 256
+)
+
+// Kinds of the searched message parts.
+const (
+	KindText       = "text"
+	KindToolCall   = "tool_call"
+	KindToolResult = "tool_result"
+)
+
+// ErrInvalidQuery is returned for queries without user or text, or too long.
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// Query selects the messages of a user containing Text. An empty ProjectID
+// searches every project.
+type Query struct {
+	UserID    string
+	Text      string
+	ProjectID string
+	Limit     int
+	Offset    int
+}
+
+// Hit is a message part matching a query.
+type Hit struct {
+	SessionID    string `json:"session_id"`
+	SessionTitle string `json:"session_title"`
+	ProjectID    string `json:"project_id"`
+	MessageID    string `json:"message_id"`
+	// PartIndex is the index of the matching part in the parts of the message
+	PartIndex  int    `json:"part_index"`
+	Role       string `json:"role"`
+	Kind       string `json:"kind"`
+	ToolName   string `json:"tool_name,omitempty"`
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Snippet is an excerpt of the part, matching words are wrapped in << and >>
+	Snippet   string  `json:"snippet"`
+	Rank      float64 `json:"rank"`
+	CreatedAt int64   `json:"created_at"` // Unix milliseconds
+}
+
+type Service interface {
+	// Search returns the message parts matching the query, best first.
+	Search(ctx context.Context, query Query) ([]Hit, error)
+}
+
+type service struct {
+	q postgres.Querier
+}
+
+// NewService creates the search service.
+func NewService(q postgres.Querier) Service {
+	return &service{q: q}
+}
+
+func (s *service) Search(ctx context.Context, query Query) ([]Hit, error) {
+	text := strings.TrimSpace(query.Text)
+	if query.UserID == "" || text == "" || utf8.RuneCountInString(text) > MaxQueryLength || query.Offset < 0 {
+		return nil, ErrInvalidQuery
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	rows, err := s.q.SearchMessages(ctx, postgres.SearchMessagesParams{
+		UserID:    query.UserID,
+		Query:     text,
+		Pattern:   likePattern(text),
+		ProjectID: query.ProjectID,
+		Limit:     int32(limit),
+		Offset:    int32(query.Offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]Hit, len(rows))
+	for i, row := range rows {
+		hits[i] = Hit{
+			SessionID:    row.SessionID,
+			SessionTitle: row.SessionTitle,
+			ProjectID:    row.ProjectID.String,
+			MessageID:    row.MessageID,
+			PartIndex:    int(row.PartIndex) - 1, // Postgres counts from 1
+			Role:         row.Role,
+			Kind:         row.Kind,
+			ToolName:     row.ToolName,
+			ToolCallID:   row.ToolCallID,
+			Snippet:      row.Snippet,
+			Rank:         row.Rank,
+			CreatedAt:    row.CreatedAt,
+		}
+	}
+	return hits, nil
+}
+
+// likeEscaper escapes the wildcards of ILIKE.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likePattern returns the ILIKE pattern matching text anywhere, so code
+// snippets the text search splits up are still found.
+func likePattern(text string) string {
+	return "%" + likeEscaper.Replace(text) + "%"
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQuerier struct {
+	postgres.Querier
+	arg  postgres.SearchMessagesParams
+	rows []postgres.SearchMessagesRow
+}
+
+func (q *fakeQuerier) SearchMessages(_ context.Context, arg postgres.SearchMessagesParams) ([]postgres.SearchMessagesRow, error) {
+	q.arg = arg
+	return q.rows, nil
+}
+
+func TestLikePattern(t *testing.T) {
+	assert.Equal(t, "%authMiddleware(%", likePattern("authMiddleware("))
+	assert.Equal(t, `%100\% of foo\_bar in C:\\%`, likePattern(`100% of foo_bar in C:\`))
+}
+
+func TestSearch(t *testing.T) {
+	q := &fakeQuerier{rows: []postgres.SearchMessagesRow{{
+		MessageID:  "m1",
+		PartIndex:  2,
+		SessionID:  "s1",
+		ProjectID:  sql.NullString{String: "p1", Valid: true},
+		Role:       "assistant",
+		Kind:       KindToolCall,
+		ToolName:   "edit",
+		ToolCallID: "call-1",
+		Snippet:    "<<auth>> <<middleware>>",
+	}}}
+	s := NewService(q)
+
+	hits, err := s.Search(t.Context(), Query{UserID: "u1", Text: "  auth middleware ", Limit: 1000})
+	require.NoError(t, err)
+	require.Equal(t, "auth middleware", q.arg.Query)
+	require.Equal(t, "%auth middleware%", q.arg.Pattern)
+	require.Equal(t, int32(MaxLimit), q.arg.Limit)
+	require.Len(t, hits, 1)
+	require.Equal(t, 1, hits[0].PartIndex)
+	require.Equal(t, "p1", hits[0].ProjectID)
+	require.Equal(t, "call-1", hits[0].ToolCallID)
+
+	_, err = s.Search(t.Context(), Query{UserID: "u1", Text: "auth", ProjectID: "p1"})
+	require.NoError(t, err)
+	require.Equal(t, int32(DefaultLimit), q.arg.Limit)
+	require.Equal(t, "p1", q.arg.ProjectID)
+}
+
+func TestSearchInvalidQuery(t *testing.T) {
+	s := NewService(nil)
+	for name, query := range map[string]Query{
+		"without user":    {Text: "auth"},
+		"blank text":      {UserID: "u1", Text: "   "},
+		"too long":        {UserID: "u1", Text: strings.Repeat("a", MaxQueryLength+1)},
+		"negative offset": {UserID: "u1", Text: "auth", Offset: -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.Search(t.Context(), query)
+			require.ErrorIs(t, err, ErrInvalidQuery)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// cipherBox seals the secret values with AES-256-GCM. The scope and name of a
+// secret are bound to its ciphertext, a value copied to another row does not
+// decrypt.
+type cipherBox struct {
+	aead cipher.AEAD
+}
+
+// newCipherBox creates the cipher of a base64 encoded 32 byte master key.
+func newCipherBox(masterKey string) (*cipherBox, error) {
+	key, err := base64.StdEncoding.DecodeString(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("master key is not base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &cipherBox{aead: aead}, nil
+}
+
+// seal encrypts a value, it returns the base64 nonce and ciphertext.
+func (b *cipherBox) seal(projectID, name, value string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(value), additionalData(projectID, name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value sealed by seal.
+func (b *cipherBox) open(projectID, name, sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < b.aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	value, err := b.aead.Open(nil, nonce, ciphertext, additionalData(projectID, name))
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func additionalData(projectID, name string) []byte {
+	return []byte(projectID + "\x00" + name)
+}
@@ -0,0 +1,221 @@
+// Package secret stores secrets encrypted with a master key, in place of
+// plaintext API keys in the config files. Global secrets are referenced from
+// the config as "secret://NAME", e.g. the API key of a provider; the secrets
+// of a project are also set as environment variables of the commands run in
+// its sandbox. Values are never returned by the API and are masked in the
+// logs and in the parameters of permission requests.
+package secret
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/internal/pkg/mask"
+)
+
+// Scheme is the prefix of the config values referencing a stored secret.
+const Scheme = "secret"
+
+// MaxValueSize bounds the size of a secret value.
+const MaxValueSize = 64 * 1024
+
+var (
+	// ErrNotFound is returned when a secret does not exist.
+	ErrNotFound = errors.New("secret not found")
+	// ErrInvalidName is returned for names that are not environment variable names.
+	ErrInvalidName = errors.New("secret name must be a letter or '_' followed by up to 127 letters, digits or '_'")
+	// ErrInvalidValue is returned for empty or oversized values.
+	ErrInvalidValue = fmt.Errorf("secret value must be 1 to %d bytes", MaxValueSize)
+)
+
+// namePattern matches environment variable names.
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+// Secret describes a stored secret, without its value.
+type Secret struct {
+	Name string `json:"name"`
+	// ProjectID is empty for the global secrets.
+	ProjectID string `json:"project_id,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type Service interface {
+	// Set encrypts and stores a secret of a project, or a global one when
+	// projectID is empty, replacing the value of an existing one.
+	Set(ctx context.Context, projectID, name, value, userID string) (Secret, error)
+	// List returns the secrets of a project, or the global ones when
+	// projectID is empty.
+	List(ctx context.Context, projectID string) ([]Secret, error)
+	// Delete removes a secret.
+	Delete(ctx context.Context, projectID, name string) error
+	// DeleteProject removes the secrets of a deleted project.
+	DeleteProject(ctx context.Context, projectID string) error
+	// Value returns the decrypted value of a secret.
+	Value(ctx context.Context, projectID, name string) (string, error)
+	// ProjectEnv returns the secrets of a project as environment variables.
+	// Global secrets are left out, they hold the keys of the server.
+	ProjectEnv(ctx context.Context, projectID string) (map[string]string, error)
+	// LoadMask decrypts all secrets so that their values are masked from the
+	// start, see package mask.
+	LoadMask(ctx context.Context) error
+
+	// Scheme and GetSecret implement config.SecretProvider for references
+	// such as "secret://OPENAI_API_KEY" or "secret://<project id>/NAME".
+	Scheme() string
+	GetSecret(ctx context.Context, path string) (string, error)
+}
+
+type service struct {
+	q   postgres.Querier
+	box *cipherBox
+}
+
+// NewService creates the secrets service with the base64 encoded 32 byte
+// master key.
+func NewService(q postgres.Querier, masterKey string) (Service, error) {
+	box, err := newCipherBox(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets master key: %w", err)
+	}
+	return &service{q: q, box: box}, nil
+}
+
+func (s *service) Set(ctx context.Context, projectID, name, value, userID string) (Secret, error) {
+	if !namePattern.MatchString(name) {
+		return Secret{}, ErrInvalidName
+	}
+	if value == "" || len(value) > MaxValueSize {
+		return Secret{}, ErrInvalidValue
+	}
+	sealed, err := s.box.seal(projectID, name, value)
+	if err != nil {
+		return Secret{}, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	dbSecret, err := s.q.UpsertSecret(ctx, postgres.UpsertSecretParams{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Name:      name,
+		Value:     sealed,
+		CreatedBy: userID,
+	})
+	if err != nil {
+		return Secret{}, err
+	}
+	mask.Add(value)
+	return fromDB(dbSecret), nil
+}
+
+func (s *service) List(ctx context.Context, projectID string) ([]Secret, error) {
+	dbSecrets, err := s.q.ListSecrets(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make([]Secret, len(dbSecrets))
+	for i, item := range dbSecrets {
+		secrets[i] = fromDB(item)
+	}
+	return secrets, nil
+}
+
+func (s *service) Delete(ctx context.Context, projectID, name string) error {
+	rows, err := s.q.DeleteSecret(ctx, postgres.DeleteSecretParams{ProjectID: projectID, Name: name})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *service) DeleteProject(ctx context.Context, projectID string) error {
+	if projectID == "" {
+		return errors.New("project ID is required")
+	}
+	_, err := s.q.DeleteProjectSecrets(ctx, projectID)
+	return err
+}
+
+func (s *service) Value(ctx context.Context, projectID, name string) (string, error) {
+	dbSecret, err := s.q.GetSecret(ctx, postgres.GetSecretParams{ProjectID: projectID, Name: name})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.open(dbSecret)
+}
+
+func (s *service) ProjectEnv(ctx context.Context, projectID string) (map[string]string, error) {
+	if projectID == "" {
+		return nil, nil
+	}
+	dbSecrets, err := s.q.ListSecrets(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(dbSecrets))
+	for _, item := range dbSecrets {
+		value, err := s.open(item)
+		if err != nil {
+			return nil, err
+		}
+		env[item.Name] = value
+	}
+	return env, nil
+}
+
+func (s *service) LoadMask(ctx context.Context) error {
+	dbSecrets, err := s.q.ListAllSecrets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, item := range dbSecrets {
+		if _, err := s.open(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) Scheme() string {
+	return Scheme
+}
+
+func (s *service) GetSecret(ctx context.Context, path string) (string, error) {
+	projectID, name, ok := strings.Cut(path, "/")
+	if !ok {
+		projectID, name = "", path
+	}
+	return s.Value(ctx, projectID, name)
+}
+
+// open decrypts a stored secret and masks its value.
+func (s *service) open(item postgres.Secret) (string, error) {
+	value, err := s.box.open(item.ProjectID, item.Name, item.Value)
+	if err != nil {
+		// A wrong master key fails every secret, name the first one
+		return "", fmt.Errorf("failed to decrypt secret %s: %w", item.Name, err)
+	}
+	mask.Add(value)
+	return value, nil
+}
+
+func fromDB(item postgres.Secret) Secret {
+	return Secret{
+		Name:      item.Name,
+		ProjectID: item.ProjectID,
+		CreatedBy: item.CreatedBy,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}
+}
@@ -0,0 +1,111 @@
+package secret
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/internal/pkg/mask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQuerier keeps the secrets in memory, keyed by project and name.
+type fakeQuerier struct {
+	postgres.Querier
+	secrets map[[2]string]postgres.Secret
+}
+
+func (f *fakeQuerier) UpsertSecret(_ context.Context, arg postgres.UpsertSecretParams) (postgres.Secret, error) {
+	item := postgres.Secret{ID: arg.ID, ProjectID: arg.ProjectID, Name: arg.Name, Value: arg.Value, CreatedBy: arg.CreatedBy}
+	f.secrets[[2]string{arg.ProjectID, arg.Name}] = item
+	return item, nil
+}
+
+func (f *fakeQuerier) GetSecret(_ context.Context, arg postgres.GetSecretParams) (postgres.Secret, error) {
+	item, ok := f.secrets[[2]string{arg.ProjectID, arg.Name}]
+	if !ok {
+		return postgres.Secret{}, sql.ErrNoRows
+	}
+	return item, nil
+}
+
+func (f *fakeQuerier) ListSecrets(_ context.Context, projectID string) ([]postgres.Secret, error) {
+	var items []postgres.Secret
+	for key, item := range f.secrets {
+		if key[0] == projectID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func newTestService(t *testing.T) (*service, *fakeQuerier) {
+	t.Helper()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	q := &fakeQuerier{secrets: make(map[[2]string]postgres.Secret)}
+	svc, err := NewService(q, base64.StdEncoding.EncodeToString(key))
+	require.NoError(t, err)
+	return svc.(*service), q
+}
+
+func TestNewServiceMasterKey(t *testing.T) {
+	_, err := NewService(nil, "not base64!")
+	require.Error(t, err)
+	_, err = NewService(nil, base64.StdEncoding.EncodeToString([]byte("too short")))
+	require.Error(t, err)
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	svc, q := newTestService(t)
+
+	_, err := svc.Set(ctx, "", "OPENAI_API_KEY", "sk-global-value-1234", "u1")
+	require.NoError(t, err)
+	_, err = svc.Set(ctx, "p1", "DATABASE_URL", "postgres://app:pw-value-1234@db/app", "u1")
+	require.NoError(t, err)
+
+	// Values are stored encrypted and masked once known
+	stored := q.secrets[[2]string{"", "OPENAI_API_KEY"}].Value
+	assert.NotContains(t, stored, "sk-global-value-1234")
+	assert.Equal(t, "key "+mask.Placeholder, mask.String("key sk-global-value-1234"))
+
+	value, err := svc.GetSecret(ctx, "OPENAI_API_KEY")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-global-value-1234", value)
+	value, err = svc.GetSecret(ctx, "p1/DATABASE_URL")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://app:pw-value-1234@db/app", value)
+	_, err = svc.Value(ctx, "p2", "DATABASE_URL")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Only the secrets of the project are injected
+	env, err := svc.ProjectEnv(ctx, "p1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"DATABASE_URL": "postgres://app:pw-value-1234@db/app"}, env)
+
+	// A value copied to another secret does not decrypt
+	q.secrets[[2]string{"p2", "DATABASE_URL"}] = postgres.Secret{ProjectID: "p2", Name: "DATABASE_URL", Value: q.secrets[[2]string{"p1", "DATABASE_URL"}].Value}
+	_, err = svc.Value(ctx, "p2", "DATABASE_URL")
+	require.Error(t, err)
+}
+
+func TestSetValidation(t *testing.T) {
+	svc, _ := newTestService(t)
+	for name, tc := range map[string]struct{ name, value string }{
+		"name":  {"1KEY", "value"},
+		"space": {"MY KEY", "value"},
+		"empty": {"KEY", ""},
+		"large": {"KEY", string(make([]byte, MaxValueSize+1))},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.Set(context.Background(), "", tc.name, tc.value, "")
+			require.Error(t, err)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -41,8 +42,11 @@ type Session struct {
 	SummaryMessageID string
 	Cost             float64
 	Todos            []Todo
-	CreatedAt        int64
-	UpdatedAt        int64
+	// ArchivedAt is when the session was archived, 0 while it is active.
+	ArchivedAt int64
+	Tags       []string
+	CreatedAt  int64
+	UpdatedAt  int64
 }
 
 type Service interface {
@@ -54,6 +58,12 @@ type Service interface {
 	List(ctx context.Context, projectID string) ([]Session, error)
 	Save(ctx context.Context, session Session) (Session, error)
 	Delete(ctx context.Context, id string) error
+	// Checkpoint records the token counters of session at a user message.
+	Checkpoint(ctx context.Context, session Session, messageID string) error
+	// RestoreCheckpoint resets the token counters of session to the ones
+	// recorded at a message and saves it. The cost is kept, it was spent. A
+	// message without checkpoint leaves the counters as they are.
+	RestoreCheckpoint(ctx context.Context, session Session, messageID string) (Session, error)
 
 	// Agent tool session management
 	CreateAgentToolSessionID(messageID, toolCallID string) string
@@ -134,6 +144,29 @@ func (s *service) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+func (s *service) Checkpoint(ctx context.Context, session Session, messageID string) error {
+	return s.q.CreateMessageCheckpoint(ctx, postgres.CreateMessageCheckpointParams{
+		MessageID:        messageID,
+		SessionID:        session.ID,
+		PromptTokens:     session.PromptTokens,
+		CompletionTokens: session.CompletionTokens,
+	})
+}
+
+func (s *service) RestoreCheckpoint(ctx context.Context, session Session, messageID string) (Session, error) {
+	checkpoint, err := s.q.GetMessageCheckpoint(ctx, messageID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		slog.Warn("No checkpoint to restore the token counters from", "session_id", session.ID, "message_id", messageID)
+	case err != nil:
+		return Session{}, err
+	default:
+		session.PromptTokens = checkpoint.PromptTokens
+		session.CompletionTokens = checkpoint.CompletionTokens
+	}
+	return s.Save(ctx, session)
+}
+
 func (s *service) Get(ctx context.Context, id string) (Session, error) {
 	dbSession, err := s.q.GetSessionByID(ctx, id)
 	if err != nil {
@@ -196,6 +229,10 @@ func (s service) fromDBItem(item postgres.Session) Session {
 	if err != nil {
 		slog.Error("failed to unmarshal todos", "session_id", item.ID, "error", err)
 	}
+	var tags []string
+	if err := json.Unmarshal([]byte(item.Tags), &tags); err != nil && item.Tags != "" {
+		slog.Error("failed to unmarshal tags", "session_id", item.ID, "error", err)
+	}
 	return Session{
 		ID:               item.ID,
 		ParentSessionID:  item.ParentSessionID.String,
@@ -207,6 +244,8 @@ func (s service) fromDBItem(item postgres.Session) Session {
 		SummaryMessageID: item.SummaryMessageID.String,
 		Cost:             item.Cost,
 		Todos:            todos,
+		ArchivedAt:       item.ArchivedAt.Int64,
+		Tags:             tags,
 		CreatedAt:        item.CreatedAt,
 		UpdatedAt:        item.UpdatedAt,
 	}
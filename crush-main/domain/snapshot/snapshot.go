@@ -0,0 +1,267 @@
+// Package snapshot archives the sandbox workspace of projects, so that the
+// edits of an agent run can be rolled back at once instead of file by file.
+package snapshot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+)
+
+// Reasons a snapshot was taken for.
+const (
+	ReasonManual = "manual"
+	// ReasonRun is a snapshot taken before an agent run.
+	ReasonRun = "run"
+	// ReasonRestore is the workspace as it was before a restore, so that the
+	// restore can be undone.
+	ReasonRestore = "restore"
+)
+
+var (
+	// ErrNotFound is returned when a snapshot does not belong to the project.
+	ErrNotFound = errors.New("snapshot not found")
+	// ErrStorageUnavailable is returned when object storage is not configured.
+	ErrStorageUnavailable = errors.New("storage service unavailable")
+)
+
+// ObjectStore is the object storage holding the workspace archives.
+type ObjectStore interface {
+	PutObject(ctx context.Context, objectName string, data []byte, contentType string) error
+	GetObject(ctx context.Context, objectName string) (io.ReadCloser, int64, error)
+	RemoveObject(ctx context.Context, objectName string) error
+}
+
+// Workspace archives and restores the working directory of project
+// containers. This is typically implemented by the sandbox client.
+type Workspace interface {
+	ArchiveWorkspace(ctx context.Context, req sandbox.WorkspaceArchiveRequest) ([]byte, error)
+	RestoreWorkspace(ctx context.Context, projectID string, archive []byte) error
+}
+
+// Options bound the snapshots.
+type Options struct {
+	// MaxSize bounds the size of an archive in bytes, 0 leaves it unbounded.
+	MaxSize int64
+	// Retention is how many snapshots are kept per project, the oldest are
+	// deleted beyond it. 0 keeps them all.
+	Retention int
+}
+
+// Snapshot is an archive of the workspace of a project.
+type Snapshot struct {
+	ID         string
+	ProjectID  string
+	SessionID  string
+	Reason     string
+	ObjectName string
+	Size       int64
+	CreatedBy  string
+	CreatedAt  int64
+}
+
+type Service interface {
+	// Create archives the workspace of a project and stores it, sessionID
+	// and createdBy are optional.
+	Create(ctx context.Context, projectID, sessionID, reason, createdBy string) (Snapshot, error)
+	// Get returns a snapshot of the project, or ErrNotFound.
+	Get(ctx context.Context, projectID, id string) (Snapshot, error)
+	// List returns the snapshots of the project, newest first.
+	List(ctx context.Context, projectID string) ([]Snapshot, error)
+	// Restore replaces the workspace of the project with a snapshot. The
+	// workspace is snapshotted first, that snapshot is returned.
+	Restore(ctx context.Context, projectID, id, restoredBy string) (Snapshot, error)
+	// Delete removes a snapshot of the project and its archive.
+	Delete(ctx context.Context, projectID, id string) error
+	// DeleteAll removes the snapshots of the project, e.g. before deleting it.
+	DeleteAll(ctx context.Context, projectID string) error
+}
+
+type service struct {
+	q         postgres.Querier
+	objects   ObjectStore
+	workspace Workspace
+	opts      Options
+}
+
+// NewService creates the snapshot service. Without objects snapshots are
+// unavailable.
+func NewService(q postgres.Querier, objects ObjectStore, workspace Workspace, opts Options) Service {
+	return &service{
+		q:         q,
+		objects:   objects,
+		workspace: workspace,
+		opts:      opts,
+	}
+}
+
+func (s *service) Create(ctx context.Context, projectID, sessionID, reason, createdBy string) (Snapshot, error) {
+	if s.objects == nil {
+		return Snapshot{}, ErrStorageUnavailable
+	}
+	archive, err := s.workspace.ArchiveWorkspace(ctx, sandbox.WorkspaceArchiveRequest{
+		ProjectID: projectID,
+		MaxSize:   s.opts.MaxSize,
+	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to archive workspace: %w", err)
+	}
+
+	id := uuid.New().String()
+	objectName := fmt.Sprintf("snapshots/%s/%s.tar.gz", projectID, id)
+	if err := s.objects.PutObject(ctx, objectName, archive, "application/gzip"); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to store workspace archive: %w", err)
+	}
+	dbSnapshot, err := s.q.CreateWorkspaceSnapshot(ctx, postgres.CreateWorkspaceSnapshotParams{
+		ID:         id,
+		ProjectID:  projectID,
+		SessionID:  sessionID,
+		Reason:     reason,
+		ObjectName: objectName,
+		Size:       int64(len(archive)),
+		CreatedBy:  createdBy,
+	})
+	if err != nil {
+		s.removeObject(ctx, objectName)
+		return Snapshot{}, err
+	}
+
+	slog.Info("Workspace snapshot created", "project_id", projectID, "snapshot_id", id, "reason", reason, "size", len(archive))
+	s.prune(ctx, projectID)
+	return snapshotFromDB(dbSnapshot), nil
+}
+
+// prune deletes the oldest snapshots of a project beyond the retention.
+func (s *service) prune(ctx context.Context, projectID string) {
+	if s.opts.Retention <= 0 {
+		return
+	}
+	snapshots, err := s.q.ListWorkspaceSnapshotsByProject(ctx, projectID)
+	if err != nil {
+		slog.Warn("Failed to list workspace snapshots to prune", "project_id", projectID, "error", err)
+		return
+	}
+	for _, item := range snapshots[min(s.opts.Retention, len(snapshots)):] {
+		if err := s.delete(ctx, item); err != nil {
+			slog.Warn("Failed to prune workspace snapshot", "project_id", projectID, "snapshot_id", item.ID, "error", err)
+		}
+	}
+}
+
+func (s *service) Get(ctx context.Context, projectID, id string) (Snapshot, error) {
+	dbSnapshot, err := s.get(ctx, projectID, id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return snapshotFromDB(dbSnapshot), nil
+}
+
+func (s *service) get(ctx context.Context, projectID, id string) (postgres.WorkspaceSnapshot, error) {
+	dbSnapshot, err := s.q.GetWorkspaceSnapshot(ctx, postgres.GetWorkspaceSnapshotParams{
+		ID:        id,
+		ProjectID: projectID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return postgres.WorkspaceSnapshot{}, ErrNotFound
+	}
+	return dbSnapshot, err
+}
+
+func (s *service) List(ctx context.Context, projectID string) ([]Snapshot, error) {
+	dbSnapshots, err := s.q.ListWorkspaceSnapshotsByProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]Snapshot, len(dbSnapshots))
+	for i, item := range dbSnapshots {
+		snapshots[i] = snapshotFromDB(item)
+	}
+	return snapshots, nil
+}
+
+func (s *service) Restore(ctx context.Context, projectID, id, restoredBy string) (Snapshot, error) {
+	if s.objects == nil {
+		return Snapshot{}, ErrStorageUnavailable
+	}
+	target, err := s.get(ctx, projectID, id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	reader, _, err := s.objects.GetObject(ctx, target.ObjectName)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to open workspace archive: %w", err)
+	}
+	archive, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read workspace archive: %w", err)
+	}
+
+	// Keep the current workspace, the restore is undone by restoring it
+	before, err := s.Create(ctx, projectID, "", ReasonRestore, restoredBy)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to snapshot workspace before restoring: %w", err)
+	}
+	if err := s.workspace.RestoreWorkspace(ctx, projectID, archive); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to restore workspace: %w", err)
+	}
+	slog.Info("Workspace snapshot restored", "project_id", projectID, "snapshot_id", id, "previous_snapshot_id", before.ID)
+	return before, nil
+}
+
+func (s *service) Delete(ctx context.Context, projectID, id string) error {
+	dbSnapshot, err := s.get(ctx, projectID, id)
+	if err != nil {
+		return err
+	}
+	return s.delete(ctx, dbSnapshot)
+}
+
+func (s *service) DeleteAll(ctx context.Context, projectID string) error {
+	snapshots, err := s.q.ListWorkspaceSnapshotsByProject(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, item := range snapshots {
+		errs = append(errs, s.delete(ctx, item))
+	}
+	return errors.Join(errs...)
+}
+
+// delete removes the archive of a snapshot, then its row.
+func (s *service) delete(ctx context.Context, item postgres.WorkspaceSnapshot) error {
+	if s.objects == nil {
+		return ErrStorageUnavailable
+	}
+	if err := s.objects.RemoveObject(ctx, item.ObjectName); err != nil {
+		return fmt.Errorf("failed to remove workspace archive: %w", err)
+	}
+	return s.q.DeleteWorkspaceSnapshot(ctx, item.ID)
+}
+
+func (s *service) removeObject(ctx context.Context, objectName string) {
+	if err := s.objects.RemoveObject(ctx, objectName); err != nil {
+		slog.Warn("Failed to remove workspace archive", "object_name", objectName, "error", err)
+	}
+}
+
+func snapshotFromDB(item postgres.WorkspaceSnapshot) Snapshot {
+	return Snapshot{
+		ID:         item.ID,
+		ProjectID:  item.ProjectID,
+		SessionID:  item.SessionID,
+		Reason:     item.Reason,
+		ObjectName: item.ObjectName,
+		Size:       item.Size,
+		CreatedBy:  item.CreatedBy,
+		CreatedAt:  item.CreatedAt,
+	}
+}
@@ -0,0 +1,143 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore keeps the snapshot rows and archives in memory, newest last.
+type fakeStore struct {
+	postgres.Querier
+	rows    []postgres.WorkspaceSnapshot
+	objects map[string][]byte
+	clock   int64
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{objects: make(map[string][]byte)}
+}
+
+func (f *fakeStore) CreateWorkspaceSnapshot(_ context.Context, arg postgres.CreateWorkspaceSnapshotParams) (postgres.WorkspaceSnapshot, error) {
+	f.clock++
+	row := postgres.WorkspaceSnapshot{
+		ID:         arg.ID,
+		ProjectID:  arg.ProjectID,
+		SessionID:  arg.SessionID,
+		Reason:     arg.Reason,
+		ObjectName: arg.ObjectName,
+		Size:       arg.Size,
+		CreatedBy:  arg.CreatedBy,
+		CreatedAt:  f.clock,
+	}
+	f.rows = append(f.rows, row)
+	return row, nil
+}
+
+func (f *fakeStore) GetWorkspaceSnapshot(_ context.Context, arg postgres.GetWorkspaceSnapshotParams) (postgres.WorkspaceSnapshot, error) {
+	for _, row := range f.rows {
+		if row.ID == arg.ID && row.ProjectID == arg.ProjectID {
+			return row, nil
+		}
+	}
+	return postgres.WorkspaceSnapshot{}, sql.ErrNoRows
+}
+
+func (f *fakeStore) ListWorkspaceSnapshotsByProject(_ context.Context, projectID string) ([]postgres.WorkspaceSnapshot, error) {
+	var rows []postgres.WorkspaceSnapshot
+	for _, row := range slices.Backward(f.rows) {
+		if row.ProjectID == projectID {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (f *fakeStore) DeleteWorkspaceSnapshot(_ context.Context, id string) error {
+	f.rows = slices.DeleteFunc(f.rows, func(row postgres.WorkspaceSnapshot) bool { return row.ID == id })
+	return nil
+}
+
+func (f *fakeStore) PutObject(_ context.Context, objectName string, data []byte, _ string) error {
+	f.objects[objectName] = data
+	return nil
+}
+
+func (f *fakeStore) GetObject(_ context.Context, objectName string) (io.ReadCloser, int64, error) {
+	data := f.objects[objectName]
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func (f *fakeStore) RemoveObject(_ context.Context, objectName string) error {
+	delete(f.objects, objectName)
+	return nil
+}
+
+// fakeWorkspace is a workspace whose archive is its content.
+type fakeWorkspace struct {
+	content string
+}
+
+func (w *fakeWorkspace) ArchiveWorkspace(context.Context, sandbox.WorkspaceArchiveRequest) ([]byte, error) {
+	return []byte(w.content), nil
+}
+
+func (w *fakeWorkspace) RestoreWorkspace(_ context.Context, _ string, archive []byte) error {
+	w.content = string(archive)
+	return nil
+}
+
+func TestRestore(t *testing.T) {
+	store := newFakeStore()
+	workspace := &fakeWorkspace{content: "v1"}
+	s := NewService(store, store, workspace, Options{})
+
+	v1, err := s.Create(t.Context(), "p1", "s1", ReasonRun, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), v1.Size)
+
+	workspace.content = "broken"
+	before, err := s.Restore(t.Context(), "p1", v1.ID, "u1")
+	require.NoError(t, err)
+	require.Equal(t, "v1", workspace.content)
+	require.Equal(t, ReasonRestore, before.Reason)
+
+	// The restore is undone by restoring the snapshot it took
+	_, err = s.Restore(t.Context(), "p1", before.ID, "u1")
+	require.NoError(t, err)
+	require.Equal(t, "broken", workspace.content)
+
+	_, err = s.Restore(t.Context(), "p2", v1.ID, "u1")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRetention(t *testing.T) {
+	store := newFakeStore()
+	s := NewService(store, store, &fakeWorkspace{content: "v"}, Options{Retention: 2})
+
+	var ids []string
+	for range 3 {
+		snap, err := s.Create(t.Context(), "p1", "", ReasonManual, "u1")
+		require.NoError(t, err)
+		ids = append(ids, snap.ID)
+	}
+
+	snapshots, err := s.List(t.Context(), "p1")
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	require.Equal(t, []string{ids[2], ids[1]}, []string{snapshots[0].ID, snapshots[1].ID})
+	require.Len(t, store.objects, 2, "the archive of the pruned snapshot is removed")
+}
+
+func TestStorageUnavailable(t *testing.T) {
+	s := NewService(newFakeStore(), nil, &fakeWorkspace{}, Options{})
+	_, err := s.Create(t.Context(), "p1", "", ReasonManual, "")
+	require.ErrorIs(t, err, ErrStorageUnavailable)
+}
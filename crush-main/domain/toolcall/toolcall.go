@@ -19,6 +19,9 @@ const (
 	StatusCompleted Status = "completed"
 	StatusError     Status = "error"
 	StatusCancelled Status = "cancelled"
+	// StatusAwaitingPermission is a call suspended after its permission
+	// request timed out, it runs again once the user grants it.
+	StatusAwaitingPermission Status = "awaiting_permission"
 )
 
 // ToolCall represents a tool call with its current state
@@ -36,6 +39,9 @@ type ToolCall struct {
 	UpdatedAt    int64  `json:"updated_at"`
 	StartedAt    *int64 `json:"started_at,omitempty"`
 	FinishedAt   *int64 `json:"finished_at,omitempty"`
+	// The permission request of a call awaiting permission.
+	PermissionAction string `json:"permission_action,omitempty"`
+	PermissionPath   string `json:"permission_path,omitempty"`
 }
 
 // Service provides tool call state management operations
@@ -57,6 +63,11 @@ type Service interface {
 	UpdateStatus(ctx context.Context, id string, status Status) error
 	// Complete marks the tool call as completed with result
 	Complete(ctx context.Context, id, result string, isError bool, errorMsg string) error
+	// AwaitPermission suspends a tool call whose permission request timed
+	// out, keeping the prompt of its turn and the action and path it asked for
+	AwaitPermission(ctx context.Context, id, originalPrompt, action, path string) error
+	// GrantPermission marks a tool call awaiting permission as running again
+	GrantPermission(ctx context.Context, id string) error
 	// Cancel cancels a pending/running tool call
 	Cancel(ctx context.Context, id string) error
 	// CancelSession cancels all pending/running tool calls for a session
@@ -65,6 +76,8 @@ type Service interface {
 	Delete(ctx context.Context, id string) error
 	// DeleteSession deletes all tool calls for a session
 	DeleteSession(ctx context.Context, sessionID string) error
+	// Flush writes any buffered tool call changes to the database
+	Flush(ctx context.Context) error
 }
 
 type service struct {
@@ -184,6 +197,37 @@ func (s *service) Complete(ctx context.Context, id, result string, isError bool,
 	return nil
 }
 
+func (s *service) AwaitPermission(ctx context.Context, id, originalPrompt, action, path string) error {
+	err := s.q.UpdateToolCallAwaitingPermission(ctx, postgres.UpdateToolCallAwaitingPermissionParams{
+		ID:               id,
+		OriginalPrompt:   sql.NullString{String: originalPrompt, Valid: originalPrompt != ""},
+		PermissionAction: sql.NullString{String: action, Valid: action != ""},
+		PermissionPath:   sql.NullString{String: path, Valid: path != ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	tc, err := s.Get(ctx, id)
+	if err == nil {
+		s.Publish(pubsub.UpdatedEvent, tc)
+	}
+	return nil
+}
+
+func (s *service) GrantPermission(ctx context.Context, id string) error {
+	err := s.q.UpdateToolCallPermissionGranted(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	tc, err := s.Get(ctx, id)
+	if err == nil {
+		s.Publish(pubsub.UpdatedEvent, tc)
+	}
+	return nil
+}
+
 func (s *service) Cancel(ctx context.Context, id string) error {
 	err := s.q.CancelToolCall(ctx, id)
 	if err != nil {
@@ -234,6 +278,13 @@ func (s *service) DeleteSession(ctx context.Context, sessionID string) error {
 	return s.q.DeleteSessionToolCalls(ctx, sessionID)
 }
 
+func (s *service) Flush(ctx context.Context) error {
+	if f, ok := s.q.(postgres.Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
 func (s *service) fromDB(db postgres.ToolCall) ToolCall {
 	tc := ToolCall{
 		ID:        db.ID,
@@ -263,6 +314,8 @@ func (s *service) fromDB(db postgres.ToolCall) ToolCall {
 	if db.FinishedAt.Valid {
 		tc.FinishedAt = &db.FinishedAt.Int64
 	}
+	tc.PermissionAction = db.PermissionAction.String
+	tc.PermissionPath = db.PermissionPath.String
 
 	return tc
 }
@@ -0,0 +1,357 @@
+// Package upload implements resumable uploads of message attachments. A file
+// is sent in fixed-size chunks, each stored as its own object, and assembled
+// into one object with the last chunk. Clients resume an interrupted upload
+// from the received offset and reference a completed one by its crush:// URL.
+package upload
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// Upload statuses.
+const (
+	StatusUploading = "uploading"
+	StatusCompleted = "completed"
+)
+
+const (
+	// URLPrefix starts the URLs of completed uploads.
+	URLPrefix = "crush://uploads/"
+	// ChunkSize is the size of every chunk but the last. Storage assembles
+	// objects from parts of at least 5 MiB.
+	ChunkSize = 5 << 20
+	// staleAfter is how long an unfinished upload is kept without progress.
+	staleAfter = 24 * time.Hour
+)
+
+var (
+	// ErrNotFound is returned when an upload does not belong to the user.
+	ErrNotFound = errors.New("upload not found")
+	// ErrNotCompleted is returned when opening an upload still in progress.
+	ErrNotCompleted = errors.New("upload is not completed")
+	// ErrAlreadyCompleted is returned when writing to a completed upload.
+	ErrAlreadyCompleted = errors.New("upload is already completed")
+	// ErrStorageUnavailable is returned when object storage is not configured.
+	ErrStorageUnavailable = errors.New("storage service unavailable")
+	// ErrInvalidType is returned for MIME types that cannot be attached.
+	ErrInvalidType = errors.New("file type not allowed")
+	// ErrTooLarge is returned for files above the size limit.
+	ErrTooLarge = errors.New("file is too large")
+	// ErrQuotaExceeded is returned when the uploads of a user would exceed the quota.
+	ErrQuotaExceeded = errors.New("upload quota exceeded")
+	// ErrInvalidChunk is returned for chunks that are empty, of the wrong size
+	// or past the end of the file.
+	ErrInvalidChunk = errors.New("invalid chunk")
+	// ErrContentMismatch is returned when the content does not match the declared MIME type.
+	ErrContentMismatch = errors.New("file content does not match its type")
+)
+
+// OffsetError is returned for a chunk not starting at the received offset,
+// e.g. when a client resumes from a stale offset.
+type OffsetError struct {
+	Received int64
+}
+
+func (e *OffsetError) Error() string {
+	return fmt.Sprintf("chunk must start at offset %d", e.Received)
+}
+
+// ObjectStore is the object storage holding the chunks and assembled files.
+type ObjectStore interface {
+	PutObject(ctx context.Context, objectName string, data []byte, contentType string) error
+	GetObject(ctx context.Context, objectName string) (io.ReadCloser, int64, error)
+	RemoveObject(ctx context.Context, objectName string) error
+	ComposeObject(ctx context.Context, objectName string, sources []string, contentType string) error
+}
+
+// Limits bound what users can upload.
+type Limits struct {
+	MaxFileSize int64
+	// UserQuota bounds the total size of the uploads of a user, unfinished
+	// ones included.
+	UserQuota int64
+	// AllowedTypes are the accepted MIME types. The content of the first
+	// chunk is sniffed and must match the declared type.
+	AllowedTypes []string
+}
+
+// Upload is a file uploaded in chunks.
+type Upload struct {
+	ID          string
+	UserID      string
+	Filename    string
+	MimeType    string
+	Size        int64
+	ChunkSize   int64
+	Received    int64
+	Status      string
+	ObjectName  string
+	CreatedAt   int64
+	CompletedAt int64
+}
+
+// URL returns the crush:// URL referencing the upload.
+func (u Upload) URL() string {
+	return URLPrefix + u.ID
+}
+
+// Completed reports whether all chunks were received and assembled.
+func (u Upload) Completed() bool {
+	return u.Status == StatusCompleted
+}
+
+// ParseURL returns the upload ID of a crush:// URL, false for other URLs.
+func ParseURL(url string) (string, bool) {
+	id, ok := strings.CutPrefix(url, URLPrefix)
+	return id, ok && id != "" && !strings.Contains(id, "/")
+}
+
+type Service interface {
+	// Create starts an upload after checking the type, size and quota.
+	Create(ctx context.Context, userID, filename, mimeType string, size int64) (Upload, error)
+	// Get returns an upload of the user, or ErrNotFound.
+	Get(ctx context.Context, userID, id string) (Upload, error)
+	// WriteChunk stores the chunk starting at offset, which must be the
+	// received offset. The file is assembled with the last chunk.
+	WriteChunk(ctx context.Context, userID, id string, offset int64, data []byte) (Upload, error)
+	// Open opens the file of a completed upload of the user.
+	Open(ctx context.Context, userID, id string) (io.ReadCloser, Upload, error)
+}
+
+type service struct {
+	q       postgres.Querier
+	objects ObjectStore
+	limits  Limits
+}
+
+// NewService creates the upload service. Without objects uploads are
+// unavailable.
+func NewService(q postgres.Querier, objects ObjectStore, limits Limits) Service {
+	return &service{q: q, objects: objects, limits: limits}
+}
+
+func (s *service) Create(ctx context.Context, userID, filename, mimeType string, size int64) (Upload, error) {
+	if err := s.limits.check(mimeType, size); err != nil {
+		return Upload{}, err
+	}
+	if s.objects == nil {
+		return Upload{}, ErrStorageUnavailable
+	}
+
+	// Abandoned uploads of the user would otherwise hold on to the quota
+	s.removeStale(ctx, userID)
+
+	used, err := s.q.SumUploadSizeByUser(ctx, userID)
+	if err != nil {
+		return Upload{}, err
+	}
+	if s.limits.UserQuota > 0 && used+size > s.limits.UserQuota {
+		return Upload{}, fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, used, s.limits.UserQuota)
+	}
+
+	dbUpload, err := s.q.CreateUpload(ctx, postgres.CreateUploadParams{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Filename:  path.Base(filename),
+		MimeType:  mimeType,
+		Size:      size,
+		ChunkSize: ChunkSize,
+	})
+	if err != nil {
+		return Upload{}, err
+	}
+	return fromDB(dbUpload), nil
+}
+
+func (s *service) Get(ctx context.Context, userID, id string) (Upload, error) {
+	dbUpload, err := s.q.GetUpload(ctx, postgres.GetUploadParams{ID: id, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Upload{}, ErrNotFound
+	}
+	if err != nil {
+		return Upload{}, err
+	}
+	return fromDB(dbUpload), nil
+}
+
+func (s *service) WriteChunk(ctx context.Context, userID, id string, offset int64, data []byte) (Upload, error) {
+	if s.objects == nil {
+		return Upload{}, ErrStorageUnavailable
+	}
+	u, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return Upload{}, err
+	}
+	if u.Completed() {
+		return u, ErrAlreadyCompleted
+	}
+	if err := validateChunk(u, offset, int64(len(data))); err != nil {
+		return u, err
+	}
+	if offset == 0 && http.DetectContentType(data) != u.MimeType {
+		return u, ErrContentMismatch
+	}
+
+	if err := s.objects.PutObject(ctx, partName(u.ID, offset/u.ChunkSize), data, u.MimeType); err != nil {
+		return u, err
+	}
+	u.Received = offset + int64(len(data))
+	if err := s.q.UpdateUploadReceived(ctx, postgres.UpdateUploadReceivedParams{ID: u.ID, Received: u.Received}); err != nil {
+		return u, err
+	}
+	if u.Received < u.Size {
+		return u, nil
+	}
+	return s.complete(ctx, u)
+}
+
+// complete assembles the chunks of a fully received upload.
+func (s *service) complete(ctx context.Context, u Upload) (Upload, error) {
+	parts := partNames(u)
+	objectName := "uploads/" + u.ID + path.Ext(u.Filename)
+	if err := s.objects.ComposeObject(ctx, objectName, parts, u.MimeType); err != nil {
+		return u, err
+	}
+	if err := s.q.CompleteUpload(ctx, postgres.CompleteUploadParams{ID: u.ID, ObjectName: objectName}); err != nil {
+		return u, err
+	}
+	s.removeObjects(ctx, parts)
+
+	u.Status = StatusCompleted
+	u.ObjectName = objectName
+	u.CompletedAt = time.Now().UnixMilli()
+	slog.Info("Upload completed", "upload_id", u.ID, "user_id", u.UserID, "size", u.Size, "mime_type", u.MimeType)
+	return u, nil
+}
+
+func (s *service) Open(ctx context.Context, userID, id string) (io.ReadCloser, Upload, error) {
+	if s.objects == nil {
+		return nil, Upload{}, ErrStorageUnavailable
+	}
+	u, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, Upload{}, err
+	}
+	if !u.Completed() {
+		return nil, u, ErrNotCompleted
+	}
+	reader, _, err := s.objects.GetObject(ctx, u.ObjectName)
+	if err != nil {
+		return nil, u, err
+	}
+	return reader, u, nil
+}
+
+// removeStale deletes the unfinished uploads of a user without progress for
+// staleAfter, with their chunks.
+func (s *service) removeStale(ctx context.Context, userID string) {
+	stale, err := s.q.ListStaleUploadsByUser(ctx, postgres.ListStaleUploadsByUserParams{
+		UserID:    userID,
+		UpdatedAt: time.Now().Add(-staleAfter).UnixMilli(),
+	})
+	if err != nil {
+		slog.Warn("Failed to list stale uploads", "user_id", userID, "error", err)
+		return
+	}
+	for _, dbUpload := range stale {
+		u := fromDB(dbUpload)
+		s.removeObjects(ctx, partNames(u))
+		if err := s.q.DeleteUpload(ctx, u.ID); err != nil {
+			slog.Warn("Failed to delete stale upload", "upload_id", u.ID, "error", err)
+		}
+	}
+}
+
+func (s *service) removeObjects(ctx context.Context, names []string) {
+	for _, name := range names {
+		if err := s.objects.RemoveObject(ctx, name); err != nil {
+			slog.Warn("Failed to remove upload object", "object", name, "error", err)
+		}
+	}
+}
+
+// check validates the type and size of a new upload.
+func (l Limits) check(mimeType string, size int64) error {
+	if !slices.Contains(l.AllowedTypes, mimeType) {
+		return fmt.Errorf("%w: %s", ErrInvalidType, mimeType)
+	}
+	if size <= 0 {
+		return fmt.Errorf("%w: size must be positive", ErrInvalidChunk)
+	}
+	if l.MaxFileSize > 0 && size > l.MaxFileSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrTooLarge, size, l.MaxFileSize)
+	}
+	return nil
+}
+
+// validateChunk checks that a chunk of length bytes continues the upload at
+// offset. All chunks but the last are exactly the chunk size of the upload.
+func validateChunk(u Upload, offset, length int64) error {
+	if offset != u.Received {
+		return &OffsetError{Received: u.Received}
+	}
+	end := offset + length
+	switch {
+	case length == 0:
+		return fmt.Errorf("%w: empty", ErrInvalidChunk)
+	case end > u.Size:
+		return fmt.Errorf("%w: ends at %d, past the size of %d", ErrInvalidChunk, end, u.Size)
+	case length != u.ChunkSize && end != u.Size:
+		return fmt.Errorf("%w: chunks must be %d bytes except the last", ErrInvalidChunk, u.ChunkSize)
+	}
+	return nil
+}
+
+// partName returns the object holding a chunk of an upload.
+func partName(id string, index int64) string {
+	return fmt.Sprintf("uploads/%s/part-%05d", id, index)
+}
+
+// partNames returns the objects of the chunks received so far.
+func partNames(u Upload) []string {
+	n := (u.Received + u.ChunkSize - 1) / u.ChunkSize
+	names := make([]string, n)
+	for i := range n {
+		names[i] = partName(u.ID, i)
+	}
+	return names
+}
+
+// ObjectNames returns the objects stored for an upload: its chunks until it
+// is completed, then the assembled file.
+func ObjectNames(dbUpload postgres.Upload) []string {
+	u := fromDB(dbUpload)
+	if u.Completed() {
+		return []string{u.ObjectName}
+	}
+	return partNames(u)
+}
+
+func fromDB(u postgres.Upload) Upload {
+	return Upload{
+		ID:          u.ID,
+		UserID:      u.UserID,
+		Filename:    u.Filename,
+		MimeType:    u.MimeType,
+		Size:        u.Size,
+		ChunkSize:   u.ChunkSize,
+		Received:    u.Received,
+		Status:      u.Status,
+		ObjectName:  u.ObjectName,
+		CreatedAt:   u.CreatedAt,
+		CompletedAt: u.CompletedAt.Int64,
+	}
+}
@@ -0,0 +1,50 @@
+package upload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURL(t *testing.T) {
+	u := Upload{ID: "abc"}
+	id, ok := ParseURL(u.URL())
+	require.True(t, ok)
+	assert.Equal(t, "abc", id)
+
+	for _, url := range []string{"crush://uploads/", "crush://uploads/a/b", "https://example.com/a.png", ""} {
+		_, ok := ParseURL(url)
+		assert.False(t, ok, url)
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	limits := Limits{MaxFileSize: 100, AllowedTypes: []string{"image/png"}}
+
+	require.NoError(t, limits.check("image/png", 100))
+	require.ErrorIs(t, limits.check("image/png", 101), ErrTooLarge)
+	require.ErrorIs(t, limits.check("application/zip", 10), ErrInvalidType)
+	require.ErrorIs(t, limits.check("image/png", 0), ErrInvalidChunk)
+}
+
+func TestValidateChunk(t *testing.T) {
+	u := Upload{Size: 25, ChunkSize: 10, Received: 10}
+
+	require.NoError(t, validateChunk(u, 10, 10), "full chunk")
+	require.NoError(t, validateChunk(Upload{Size: 25, ChunkSize: 10, Received: 20}, 20, 5), "last chunk")
+
+	var offsetErr *OffsetError
+	require.ErrorAs(t, validateChunk(u, 0, 10), &offsetErr, "chunk already received")
+	assert.Equal(t, int64(10), offsetErr.Received)
+
+	require.ErrorIs(t, validateChunk(u, 10, 0), ErrInvalidChunk, "empty")
+	require.ErrorIs(t, validateChunk(u, 10, 5), ErrInvalidChunk, "short chunk that is not the last")
+	require.ErrorIs(t, validateChunk(u, 10, 16), ErrInvalidChunk, "past the end")
+}
+
+func TestPartNames(t *testing.T) {
+	assert.Empty(t, partNames(Upload{ID: "x", ChunkSize: 10}))
+	assert.Equal(t, []string{"uploads/x/part-00000", "uploads/x/part-00001", "uploads/x/part-00002"},
+		partNames(Upload{ID: "x", ChunkSize: 10, Received: 25}))
+}
@@ -0,0 +1,168 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/auth"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// ErrTokenNotFound is returned when revoking a token the user does not own.
+var ErrTokenNotFound = errors.New("api token not found")
+
+// tokenTouchInterval limits how often last_used_at is written for a busy token.
+const tokenTouchInterval = time.Minute
+
+// APIToken is a personal access token. The token itself is only returned
+// once, on creation; afterwards it is identified by its prefix.
+type APIToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	Prefix     string
+	Scopes     []string
+	LastUsedAt int64
+	ExpiresAt  int64
+	RevokedAt  int64
+	CreatedAt  int64
+}
+
+// Active reports whether the token can still be used.
+func (t APIToken) Active() bool {
+	if t.RevokedAt > 0 {
+		return false
+	}
+	return t.ExpiresAt == 0 || time.Now().UnixMilli() < t.ExpiresAt
+}
+
+func (s *service) CreateToken(ctx context.Context, userID, name string, scopes []string, expiresAt int64) (APIToken, string, error) {
+	if len(scopes) == 0 {
+		return APIToken{}, "", errors.New("at least one scope is required")
+	}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		full, ok := auth.NormalizeScope(scope)
+		if !ok {
+			return APIToken{}, "", fmt.Errorf("invalid scope %q", scope)
+		}
+		if !slices.Contains(normalized, full) {
+			normalized = append(normalized, full)
+		}
+	}
+	scopes = normalized
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIToken{}, "", err
+	}
+	token := auth.APITokenPrefix + hex.EncodeToString(secret)
+
+	dbToken, err := s.q.CreateAPIToken(ctx, postgres.CreateAPITokenParams{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   hashToken(token),
+		TokenPrefix: token[:len(auth.APITokenPrefix)+8],
+		Scopes:      strings.Join(scopes, ","),
+		ExpiresAt:   sql.NullInt64{Int64: expiresAt, Valid: expiresAt > 0},
+	})
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	return tokenFromDB(dbToken), token, nil
+}
+
+func (s *service) ListTokens(ctx context.Context, userID string) ([]APIToken, error) {
+	dbTokens, err := s.q.ListAPITokensByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]APIToken, len(dbTokens))
+	for i, dbToken := range dbTokens {
+		tokens[i] = tokenFromDB(dbToken)
+	}
+	return tokens, nil
+}
+
+func (s *service) RevokeToken(ctx context.Context, userID, tokenID string) error {
+	rows, err := s.q.RevokeAPIToken(ctx, postgres.RevokeAPITokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// ValidateAPIToken implements auth.APITokenValidator.
+func (s *service) ValidateAPIToken(ctx context.Context, token string) (*auth.Claims, error) {
+	dbToken, err := s.q.GetAPITokenByHash(ctx, hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	apiToken := tokenFromDB(dbToken)
+	if apiToken.RevokedAt > 0 {
+		return nil, auth.ErrInvalidToken
+	}
+	if !apiToken.Active() {
+		return nil, auth.ErrExpiredToken
+	}
+
+	dbUser, err := s.q.GetUserByID(ctx, apiToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().UnixMilli()-apiToken.LastUsedAt > tokenTouchInterval.Milliseconds() {
+		if err := s.q.TouchAPIToken(ctx, apiToken.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &auth.Claims{
+		UserID:   dbUser.ID,
+		Username: dbUser.Username,
+		TokenID:  apiToken.ID,
+		Scopes:   apiToken.Scopes,
+	}, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenFromDB(item postgres.ApiToken) APIToken {
+	var scopes []string
+	if item.Scopes != "" {
+		scopes = strings.Split(item.Scopes, ",")
+	}
+	return APIToken{
+		ID:         item.ID,
+		UserID:     item.UserID,
+		Name:       item.Name,
+		Prefix:     item.TokenPrefix,
+		Scopes:     scopes,
+		LastUsedAt: item.LastUsedAt.Int64,
+		ExpiresAt:  item.ExpiresAt.Int64,
+		RevokedAt:  item.RevokedAt.Int64,
+		CreatedAt:  item.CreatedAt,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 
+	"github.com/rolling1314/rolling-crush/auth"
 	"github.com/rolling1314/rolling-crush/infra/postgres"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -28,6 +29,13 @@ type Service interface {
 	UpdatePassword(ctx context.Context, userID, newPassword string) error
 	Delete(ctx context.Context, id string) error
 	VerifyPassword(ctx context.Context, email, password string) (User, error)
+	// CreateToken issues a personal access token and returns it together with
+	// the token string, which is not stored and cannot be retrieved later.
+	CreateToken(ctx context.Context, userID, name string, scopes []string, expiresAt int64) (APIToken, string, error)
+	ListTokens(ctx context.Context, userID string) ([]APIToken, error)
+	RevokeToken(ctx context.Context, userID, tokenID string) error
+	// ValidateAPIToken resolves a personal access token for auth middleware.
+	ValidateAPIToken(ctx context.Context, token string) (*auth.Claims, error)
 }
 
 type service struct {
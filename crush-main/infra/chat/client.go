@@ -0,0 +1,85 @@
+// Package chat posts notifications to Slack and Discord incoming webhooks.
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Platform identifies the chat webhook flavour.
+type Platform string
+
+const (
+	PlatformSlack   Platform = "slack"
+	PlatformDiscord Platform = "discord"
+)
+
+// maxDiscordLength is the Discord message content limit.
+const maxDiscordLength = 2000
+
+// maxSlackLength keeps messages below the Slack text limit of 40000 characters.
+const maxSlackLength = 39000
+
+// Client posts messages to incoming webhooks.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates a chat client.
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// Send posts text to a Slack or Discord incoming webhook URL.
+func (c *Client) Send(ctx context.Context, platform Platform, webhookURL, text string) error {
+	var payload map[string]string
+	switch platform {
+	case PlatformSlack:
+		payload = map[string]string{"text": truncate(text, maxSlackLength)}
+	case PlatformDiscord:
+		payload = map[string]string{"content": truncate(text, maxDiscordLength)}
+	default:
+		return fmt.Errorf("unsupported chat platform %q", platform)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s webhook error: status %d: %s", platform, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// truncate cuts text to at most limit runes.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
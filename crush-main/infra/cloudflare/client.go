@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -60,7 +61,6 @@ func (c *Client) GetZoneID(ctx context.Context) (string, error) {
 	}
 
 	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?name=%s", c.domain)
-	fmt.Printf("📤 Cloudflare: GET %s\n", url)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -72,7 +72,6 @@ func (c *Client) GetZoneID(ctx context.Context) (string, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		fmt.Printf("❌ Cloudflare: Request failed: %v\n", err)
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -82,7 +81,7 @@ func (c *Client) GetZoneID(ctx context.Context) (string, error) {
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	fmt.Printf("📥 Cloudflare: Status %d, Response: %s\n", resp.StatusCode, string(body))
+	slog.DebugContext(ctx, "Cloudflare zone lookup", "domain", c.domain, "status", resp.StatusCode)
 
 	var r struct {
 		Success bool          `json:"success"`
@@ -94,17 +93,15 @@ func (c *Client) GetZoneID(ctx context.Context) (string, error) {
 	}
 
 	if !r.Success {
-		fmt.Printf("❌ Cloudflare API errors: %v\n", r.Errors)
 		return "", fmt.Errorf("cloudflare API error: %v", r.Errors)
 	}
 
 	if len(r.Result) == 0 {
-		fmt.Printf("❌ Cloudflare: No zones found for domain %s\n", c.domain)
 		return "", fmt.Errorf("no zones found for domain %s", c.domain)
 	}
 
 	c.zoneID = r.Result[0].ID
-	fmt.Printf("✅ Cloudflare: Zone ID = %s\n", c.zoneID)
+	slog.InfoContext(ctx, "Cloudflare zone resolved", "domain", c.domain, "zone_id", c.zoneID)
 	return c.zoneID, nil
 }
 
@@ -199,7 +196,7 @@ func (c *Client) CreateDNSRecord(ctx context.Context, subdomain, targetIP string
 		return fmt.Errorf("cloudflare API error: %v", r.Errors)
 	}
 
-	fmt.Printf("✅ Cloudflare: DNS record created for %s -> %s\n", fullDomain, targetIP)
+	slog.InfoContext(ctx, "Cloudflare DNS record created", "domain", fullDomain, "ip", targetIP)
 	return nil
 }
 
@@ -253,7 +250,7 @@ func (c *Client) UpdateDNSRecord(ctx context.Context, recordID, subdomain, targe
 		return fmt.Errorf("cloudflare API error: %v", r.Errors)
 	}
 
-	fmt.Printf("✅ Cloudflare: DNS record updated for %s -> %s\n", fullDomain, targetIP)
+	slog.InfoContext(ctx, "Cloudflare DNS record updated", "domain", fullDomain, "ip", targetIP)
 	return nil
 }
 
@@ -269,12 +266,10 @@ func (c *Client) AddOrUpdateDNSRecord(ctx context.Context, subdomain, targetIP s
 
 	if recordID == "" {
 		// 记录不存在，创建新记录
-		fmt.Printf("📝 Cloudflare: Creating DNS record for %s\n", fullDomain)
 		return c.CreateDNSRecord(ctx, subdomain, targetIP)
 	}
 
 	// 记录存在，更新记录
-	fmt.Printf("📝 Cloudflare: Updating DNS record for %s\n", fullDomain)
 	return c.UpdateDNSRecord(ctx, recordID, subdomain, targetIP)
 }
 
@@ -0,0 +1,758 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWriteBatchInterval is how often buffered writes are flushed to Postgres.
+	DefaultWriteBatchInterval = 100 * time.Millisecond
+	// maxFlushAttempts is how many times a failing write is retried before it
+	// is dropped and handed to the dead letter handler.
+	maxFlushAttempts = 3
+	// flushTimeout bounds a single flush round trip.
+	flushTimeout = 10 * time.Second
+)
+
+// ErrWritesDropped is returned to the next write of a session, or of a row,
+// whose buffered writes were dropped after repeated flush failures.
+var ErrWritesDropped = errors.New("buffered writes were dropped after repeated flush failures")
+
+// Flusher is implemented by queriers that buffer writes.
+type Flusher interface {
+	// Flush writes all buffered changes to the database.
+	Flush(ctx context.Context) error
+}
+
+// DroppedWrites are buffered writes given up after maxFlushAttempts. Either
+// the new rows of a session, or an update of a row that was already flushed.
+type DroppedWrites struct {
+	// SessionID is set for the new rows of a session.
+	SessionID      string
+	Messages       []Message
+	ToolCalls      []ToolCall
+	MessageUpdates []UpdateMessageParams
+	// ToolCallIDs are the tool calls whose update was dropped.
+	ToolCallIDs []string
+	Err         error
+}
+
+// DeadLetterFunc receives the dropped writes. It is called with the batcher
+// locked and must not use the batcher.
+type DeadLetterFunc func(DroppedWrites)
+
+// WriteBatcher is a Querier that coalesces message and tool call writes made
+// during a streaming turn and flushes them together.
+//
+// New messages and tool calls are kept in memory until the next flush, and
+// updates to them are folded into the pending rows, so a tool call that is
+// created, started and completed between two flushes costs a single insert.
+// The new rows of each session are inserted in a transaction of their own, so
+// a bad row only holds back the writes of its session. Updates to rows that
+// were already flushed are coalesced per row (latest wins) and applied row by
+// row. Writes that keep failing are dropped after a few attempts: they are
+// handed to the dead letter handler, and the next write of the session or
+// the row returns ErrWritesDropped.
+//
+// Reads of buffered rows are served from memory; list queries and writes that
+// are not batched flush first so callers never observe stale data. All other
+// queries go straight to the wrapped Querier.
+type WriteBatcher struct {
+	Querier
+	db *sql.DB
+	q  *Queries
+
+	// mu guards the buffers and is held for the whole flush so that writes
+	// made during a flush are ordered after it.
+	mu sync.Mutex
+
+	// messages and toolCalls are the new rows of all sessions, sessions
+	// keeps their order per session.
+	messages  map[string]*Message
+	toolCalls map[string]*ToolCall
+	sessions  map[string]*sessionBatch
+
+	messageUpdates map[string]*messageUpdate
+	updateOrder    []string
+	// toolCallOps are updates to tool calls that were already flushed, in call order.
+	toolCallOps []*toolCallOp
+
+	// dropped are the errors of the dropped writes, by session or row ID,
+	// until they are returned to a caller.
+	dropped    map[string]error
+	deadLetter DeadLetterFunc
+
+	lastCreatedAt int64
+
+	interval time.Duration
+	done     chan struct{}
+	stopped  chan struct{}
+	closeMu  sync.Once
+}
+
+// sessionBatch are the new rows of a session, inserted together.
+type sessionBatch struct {
+	messageOrder  []string
+	toolCallOrder []string
+	failures      int
+}
+
+type messageUpdate struct {
+	arg      UpdateMessageParams
+	failures int
+}
+
+type toolCallOp struct {
+	id       string
+	apply    func(ctx context.Context, q *Queries) error
+	failures int
+}
+
+// flushError is the failure of the writes of a session or a row.
+type flushError struct {
+	key string
+	err error
+}
+
+var (
+	_ Querier = (*WriteBatcher)(nil)
+	_ Flusher = (*WriteBatcher)(nil)
+)
+
+// NewWriteBatcher creates a WriteBatcher on top of q that flushes every interval.
+// Call Close to stop the background flusher and write any remaining changes.
+func NewWriteBatcher(db *sql.DB, q *Queries, interval time.Duration) *WriteBatcher {
+	if interval <= 0 {
+		interval = DefaultWriteBatchInterval
+	}
+	b := &WriteBatcher{
+		Querier:        q,
+		db:             db,
+		q:              q,
+		messages:       make(map[string]*Message),
+		toolCalls:      make(map[string]*ToolCall),
+		sessions:       make(map[string]*sessionBatch),
+		messageUpdates: make(map[string]*messageUpdate),
+		dropped:        make(map[string]error),
+		deadLetter:     logDroppedWrites,
+		interval:       interval,
+		done:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// SetDeadLetterHandler replaces the handler of the dropped writes, which
+// logs them by default.
+func (b *WriteBatcher) SetDeadLetterHandler(handler DeadLetterFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadLetter = handler
+}
+
+func logDroppedWrites(d DroppedWrites) {
+	slog.Error("Dropping batched writes after repeated failures",
+		"session_id", d.SessionID,
+		"messages", len(d.Messages),
+		"tool_calls", len(d.ToolCalls),
+		"message_updates", len(d.MessageUpdates),
+		"tool_call_updates", len(d.ToolCallIDs),
+		"error", d.Err,
+	)
+}
+
+func (b *WriteBatcher) run() {
+	slog.Info("[GOROUTINE] Write batcher started", "interval", b.interval)
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			slog.Info("[GOROUTINE] Write batcher stopped")
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			if err := b.Flush(ctx); err != nil {
+				slog.Error("Failed to flush batched writes", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Close stops the background flusher and flushes the remaining writes.
+func (b *WriteBatcher) Close() error {
+	b.closeMu.Do(func() { close(b.done) })
+	<-b.stopped
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	return b.Flush(ctx)
+}
+
+// Flush writes all buffered changes. The writes that fail stay buffered and
+// are retried on the next flush, the ones that keep failing are dropped
+// after a few attempts. It returns the failures of all sessions and rows.
+func (b *WriteBatcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var errs []error
+	for _, f := range b.flushLocked(ctx) {
+		errs = append(errs, f.err)
+	}
+	return errors.Join(errs...)
+}
+
+// flushFor flushes all buffered changes and only returns the failures of
+// the given sessions and rows, the others do not concern the caller and are
+// reported by the background flusher.
+func (b *WriteBatcher) flushFor(ctx context.Context, keys ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushForLocked(ctx, keys...)
+}
+
+func (b *WriteBatcher) flushForLocked(ctx context.Context, keys ...string) error {
+	var errs []error
+	for _, f := range b.flushLocked(ctx) {
+		if slices.Contains(keys, f.key) {
+			errs = append(errs, f.err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *WriteBatcher) flushLocked(ctx context.Context) []flushError {
+	var errs []flushError
+	for _, sessionID := range slices.Sorted(maps.Keys(b.sessions)) {
+		if err := b.flushSessionLocked(ctx, sessionID); err != nil {
+			errs = append(errs, flushError{key: sessionID, err: err})
+		}
+	}
+	errs = append(errs, b.flushMessageUpdatesLocked(ctx)...)
+	errs = append(errs, b.flushToolCallOpsLocked(ctx)...)
+	return errs
+}
+
+// flushSessionLocked inserts the new rows of a session in one transaction.
+func (b *WriteBatcher) flushSessionLocked(ctx context.Context, sessionID string) error {
+	batch := b.sessions[sessionID]
+	err := b.writeSessionLocked(ctx, batch)
+	if err == nil {
+		b.forgetSessionLocked(sessionID)
+		return nil
+	}
+	batch.failures++
+	if batch.failures < maxFlushAttempts {
+		return fmt.Errorf("failed to flush batched writes of session %s (attempt %d): %w", sessionID, batch.failures, err)
+	}
+
+	dropped := DroppedWrites{SessionID: sessionID, Err: err}
+	for _, id := range batch.messageOrder {
+		dropped.Messages = append(dropped.Messages, *b.messages[id])
+	}
+	for _, id := range batch.toolCallOrder {
+		dropped.ToolCalls = append(dropped.ToolCalls, *b.toolCalls[id])
+	}
+	b.forgetSessionLocked(sessionID)
+	b.dropLocked(dropped, sessionID)
+	return fmt.Errorf("dropped batched writes of session %s: %w", sessionID, err)
+}
+
+func (b *WriteBatcher) forgetSessionLocked(sessionID string) {
+	batch := b.sessions[sessionID]
+	for _, id := range batch.messageOrder {
+		delete(b.messages, id)
+	}
+	for _, id := range batch.toolCallOrder {
+		delete(b.toolCalls, id)
+	}
+	delete(b.sessions, sessionID)
+}
+
+func (b *WriteBatcher) writeSessionLocked(ctx context.Context, batch *sessionBatch) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := b.insertMessages(ctx, tx, batch.messageOrder); err != nil {
+		return fmt.Errorf("insert messages: %w", err)
+	}
+	if err := b.insertToolCalls(ctx, tx, batch.toolCallOrder); err != nil {
+		return fmt.Errorf("insert tool calls: %w", err)
+	}
+	return tx.Commit()
+}
+
+// flushMessageUpdatesLocked applies the updates of flushed messages row by
+// row, so that a failing row does not hold back the others.
+func (b *WriteBatcher) flushMessageUpdatesLocked(ctx context.Context) []flushError {
+	var errs []flushError
+	var kept []string
+	for _, id := range b.updateOrder {
+		update := b.messageUpdates[id]
+		err := b.q.UpdateMessage(ctx, update.arg)
+		if err == nil {
+			delete(b.messageUpdates, id)
+			continue
+		}
+		update.failures++
+		if update.failures < maxFlushAttempts {
+			kept = append(kept, id)
+			errs = append(errs, flushError{key: id, err: fmt.Errorf("failed to update message %s (attempt %d): %w", id, update.failures, err)})
+			continue
+		}
+		delete(b.messageUpdates, id)
+		b.dropLocked(DroppedWrites{MessageUpdates: []UpdateMessageParams{update.arg}, Err: err}, id)
+		errs = append(errs, flushError{key: id, err: fmt.Errorf("dropped update of message %s: %w", id, err)})
+	}
+	b.updateOrder = kept
+	return errs
+}
+
+// flushToolCallOpsLocked applies the updates of flushed tool calls in call
+// order. The later updates of a tool call whose update failed wait for it.
+func (b *WriteBatcher) flushToolCallOpsLocked(ctx context.Context) []flushError {
+	var errs []flushError
+	var kept []*toolCallOp
+	blocked := make(map[string]bool)
+	for _, op := range b.toolCallOps {
+		if blocked[op.id] {
+			kept = append(kept, op)
+			continue
+		}
+		err := op.apply(ctx, b.q)
+		if err == nil {
+			continue
+		}
+		op.failures++
+		if op.failures < maxFlushAttempts {
+			blocked[op.id] = true
+			kept = append(kept, op)
+			errs = append(errs, flushError{key: op.id, err: fmt.Errorf("failed to update tool call %s (attempt %d): %w", op.id, op.failures, err)})
+			continue
+		}
+		b.dropLocked(DroppedWrites{ToolCallIDs: []string{op.id}, Err: err}, op.id)
+		errs = append(errs, flushError{key: op.id, err: fmt.Errorf("dropped update of tool call %s: %w", op.id, err)})
+	}
+	b.toolCallOps = kept
+	return errs
+}
+
+// dropLocked hands dropped writes to the dead letter handler and keeps their
+// error for the next write of key.
+func (b *WriteBatcher) dropLocked(dropped DroppedWrites, key string) {
+	b.dropped[key] = fmt.Errorf("%w: %w", ErrWritesDropped, dropped.Err)
+	if b.deadLetter != nil {
+		b.deadLetter(dropped)
+	}
+}
+
+// takeDroppedLocked returns, once, the error of the dropped writes of a
+// session or a row.
+func (b *WriteBatcher) takeDroppedLocked(key string) error {
+	err, ok := b.dropped[key]
+	if ok {
+		delete(b.dropped, key)
+	}
+	return err
+}
+
+func (b *WriteBatcher) sessionLocked(sessionID string) *sessionBatch {
+	batch, ok := b.sessions[sessionID]
+	if !ok {
+		batch = &sessionBatch{}
+		b.sessions[sessionID] = batch
+	}
+	return batch
+}
+
+// insertMessages writes the buffered messages with one multi-row insert.
+// Timestamps are the ones handed out when the message was buffered, so the
+// creation order is kept even though the rows share a transaction.
+func (b *WriteBatcher) insertMessages(ctx context.Context, tx *sql.Tx, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	const columns = 10
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO messages (id, session_id, role, parts, model, provider, is_summary_message, created_at, updated_at, finished_at) VALUES `)
+	args := make([]any, 0, len(ids)*columns)
+	for i, id := range ids {
+		m := b.messages[id]
+		writePlaceholders(&sb, i, columns)
+		args = append(args, m.ID, m.SessionID, m.Role, m.Parts, m.Model, m.Provider, m.IsSummaryMessage, m.CreatedAt, m.UpdatedAt, m.FinishedAt)
+	}
+	_, err := tx.ExecContext(ctx, sb.String(), args...)
+	return err
+}
+
+// insertToolCalls writes the buffered tool calls with one multi-row insert.
+func (b *WriteBatcher) insertToolCalls(ctx context.Context, tx *sql.Tx, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	const columns = 13
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO tool_calls (id, session_id, message_id, name, input, status, result, is_error, error_message, created_at, updated_at, started_at, finished_at) VALUES `)
+	args := make([]any, 0, len(ids)*columns)
+	for i, id := range ids {
+		tc := b.toolCalls[id]
+		writePlaceholders(&sb, i, columns)
+		args = append(args, tc.ID, tc.SessionID, tc.MessageID, tc.Name, tc.Input, tc.Status, tc.Result, tc.IsError, tc.ErrorMessage, tc.CreatedAt, tc.UpdatedAt, tc.StartedAt, tc.FinishedAt)
+	}
+	_, err := tx.ExecContext(ctx, sb.String(), args...)
+	return err
+}
+
+func writePlaceholders(sb *strings.Builder, row, columns int) {
+	if row > 0 {
+		sb.WriteString(", ")
+	}
+	sb.WriteByte('(')
+	for c := range columns {
+		if c > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(sb, "$%d", row*columns+c+1)
+	}
+	sb.WriteByte(')')
+}
+
+// nowLocked returns the current time in milliseconds, strictly increasing
+// across calls so buffered rows keep their relative order.
+func (b *WriteBatcher) nowLocked() int64 {
+	now := time.Now().UnixMilli()
+	if now <= b.lastCreatedAt {
+		now = b.lastCreatedAt + 1
+	}
+	b.lastCreatedAt = now
+	return now
+}
+
+// ---- Messages ----
+
+func (b *WriteBatcher) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.takeDroppedLocked(arg.SessionID); err != nil {
+		return Message{}, err
+	}
+	if _, exists := b.messages[arg.ID]; exists {
+		return Message{}, fmt.Errorf("message %s already exists", arg.ID)
+	}
+	now := b.nowLocked()
+	m := &Message{
+		ID:               arg.ID,
+		SessionID:        arg.SessionID,
+		Role:             arg.Role,
+		Parts:            arg.Parts,
+		Model:            arg.Model,
+		Provider:         arg.Provider,
+		IsSummaryMessage: arg.IsSummaryMessage,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	b.messages[arg.ID] = m
+	batch := b.sessionLocked(arg.SessionID)
+	batch.messageOrder = append(batch.messageOrder, arg.ID)
+	return *m, nil
+}
+
+func (b *WriteBatcher) UpdateMessage(ctx context.Context, arg UpdateMessageParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if m, ok := b.messages[arg.ID]; ok {
+		m.Parts = arg.Parts
+		m.FinishedAt = arg.FinishedAt
+		m.UpdatedAt = b.nowLocked()
+		return nil
+	}
+	if err := b.takeDroppedLocked(arg.ID); err != nil {
+		return err
+	}
+	if update, ok := b.messageUpdates[arg.ID]; ok {
+		update.arg = arg
+		return nil
+	}
+	b.updateOrder = append(b.updateOrder, arg.ID)
+	b.messageUpdates[arg.ID] = &messageUpdate{arg: arg}
+	return nil
+}
+
+func (b *WriteBatcher) GetMessage(ctx context.Context, id string) (Message, error) {
+	b.mu.Lock()
+	if m, ok := b.messages[id]; ok {
+		b.mu.Unlock()
+		return *m, nil
+	}
+	if _, ok := b.messageUpdates[id]; ok {
+		if err := b.flushForLocked(ctx, id); err != nil {
+			b.mu.Unlock()
+			return Message{}, err
+		}
+	}
+	b.mu.Unlock()
+	return b.q.GetMessage(ctx, id)
+}
+
+func (b *WriteBatcher) ListMessagesBySession(ctx context.Context, sessionID string) ([]Message, error) {
+	if err := b.flushFor(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	return b.q.ListMessagesBySession(ctx, sessionID)
+}
+
+func (b *WriteBatcher) ListSessionMessagesAfter(ctx context.Context, arg ListSessionMessagesAfterParams) ([]Message, error) {
+	if err := b.flushFor(ctx, arg.SessionID); err != nil {
+		return nil, err
+	}
+	return b.q.ListSessionMessagesAfter(ctx, arg)
+}
+
+func (b *WriteBatcher) ListSessionMessagesBefore(ctx context.Context, arg ListSessionMessagesBeforeParams) ([]Message, error) {
+	if err := b.flushFor(ctx, arg.SessionID); err != nil {
+		return nil, err
+	}
+	return b.q.ListSessionMessagesBefore(ctx, arg)
+}
+
+func (b *WriteBatcher) DeleteMessage(ctx context.Context, id string) error {
+	if err := b.flushFor(ctx, id); err != nil {
+		return err
+	}
+	return b.q.DeleteMessage(ctx, id)
+}
+
+func (b *WriteBatcher) DeleteSessionMessages(ctx context.Context, sessionID string) error {
+	if err := b.flushFor(ctx, sessionID); err != nil {
+		return err
+	}
+	return b.q.DeleteSessionMessages(ctx, sessionID)
+}
+
+func (b *WriteBatcher) DeleteSession(ctx context.Context, id string) error {
+	if err := b.flushFor(ctx, id); err != nil {
+		return err
+	}
+	return b.q.DeleteSession(ctx, id)
+}
+
+// ---- Tool calls ----
+
+func (b *WriteBatcher) CreateToolCall(ctx context.Context, arg CreateToolCallParams) (ToolCall, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.takeDroppedLocked(arg.SessionID); err != nil {
+		return ToolCall{}, err
+	}
+	if _, exists := b.toolCalls[arg.ID]; exists {
+		return ToolCall{}, fmt.Errorf("tool call %s already exists", arg.ID)
+	}
+	now := b.nowLocked()
+	tc := &ToolCall{
+		ID:        arg.ID,
+		SessionID: arg.SessionID,
+		MessageID: arg.MessageID,
+		Name:      arg.Name,
+		Input:     arg.Input,
+		Status:    arg.Status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	b.toolCalls[arg.ID] = tc
+	batch := b.sessionLocked(arg.SessionID)
+	batch.toolCallOrder = append(batch.toolCallOrder, arg.ID)
+	return *tc, nil
+}
+
+// The updates below mirror the SQL in tool_calls.sql for rows that are still buffered.
+
+func (b *WriteBatcher) UpdateToolCallInput(ctx context.Context, arg UpdateToolCallInputParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if tc, ok := b.toolCalls[arg.ID]; ok {
+		now := b.nowLocked()
+		tc.Input = arg.Input
+		if tc.Status == "pending" {
+			tc.Status = "running"
+		}
+		if !tc.StartedAt.Valid {
+			tc.StartedAt = sql.NullInt64{Int64: now, Valid: true}
+		}
+		tc.UpdatedAt = now
+		return nil
+	}
+	if err := b.takeDroppedLocked(arg.ID); err != nil {
+		return err
+	}
+	b.toolCallOps = append(b.toolCallOps, &toolCallOp{id: arg.ID, apply: func(ctx context.Context, q *Queries) error {
+		return q.UpdateToolCallInput(ctx, arg)
+	}})
+	return nil
+}
+
+func (b *WriteBatcher) UpdateToolCallStatus(ctx context.Context, arg UpdateToolCallStatusParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if tc, ok := b.toolCalls[arg.ID]; ok {
+		now := b.nowLocked()
+		tc.Status = arg.Status
+		if arg.Status == "running" && !tc.StartedAt.Valid {
+			tc.StartedAt = sql.NullInt64{Int64: now, Valid: true}
+		}
+		tc.UpdatedAt = now
+		return nil
+	}
+	if err := b.takeDroppedLocked(arg.ID); err != nil {
+		return err
+	}
+	b.toolCallOps = append(b.toolCallOps, &toolCallOp{id: arg.ID, apply: func(ctx context.Context, q *Queries) error {
+		return q.UpdateToolCallStatus(ctx, arg)
+	}})
+	return nil
+}
+
+func (b *WriteBatcher) UpdateToolCallResult(ctx context.Context, arg UpdateToolCallResultParams) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if tc, ok := b.toolCalls[arg.ID]; ok {
+		now := b.nowLocked()
+		tc.Result = arg.Result
+		tc.IsError = arg.IsError
+		tc.ErrorMessage = arg.ErrorMessage
+		tc.Status = "completed"
+		if arg.IsError {
+			tc.Status = "error"
+		}
+		tc.FinishedAt = sql.NullInt64{Int64: now, Valid: true}
+		tc.UpdatedAt = now
+		return nil
+	}
+	if err := b.takeDroppedLocked(arg.ID); err != nil {
+		return err
+	}
+	b.toolCallOps = append(b.toolCallOps, &toolCallOp{id: arg.ID, apply: func(ctx context.Context, q *Queries) error {
+		return q.UpdateToolCallResult(ctx, arg)
+	}})
+	return nil
+}
+
+func (b *WriteBatcher) GetToolCall(ctx context.Context, id string) (ToolCall, error) {
+	b.mu.Lock()
+	if tc, ok := b.toolCalls[id]; ok {
+		b.mu.Unlock()
+		return *tc, nil
+	}
+	if len(b.toolCallOps) > 0 {
+		if err := b.flushForLocked(ctx, id); err != nil {
+			b.mu.Unlock()
+			return ToolCall{}, err
+		}
+	}
+	b.mu.Unlock()
+	return b.q.GetToolCall(ctx, id)
+}
+
+func (b *WriteBatcher) ListToolCallsBySession(ctx context.Context, sessionID string) ([]ToolCall, error) {
+	if err := b.flushFor(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	return b.q.ListToolCallsBySession(ctx, sessionID)
+}
+
+func (b *WriteBatcher) ListToolCallsByMessage(ctx context.Context, messageID sql.NullString) ([]ToolCall, error) {
+	if err := b.flushFor(ctx); err != nil {
+		return nil, err
+	}
+	return b.q.ListToolCallsByMessage(ctx, messageID)
+}
+
+func (b *WriteBatcher) ListPendingToolCalls(ctx context.Context, sessionID string) ([]ToolCall, error) {
+	if err := b.flushFor(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	return b.q.ListPendingToolCalls(ctx, sessionID)
+}
+
+func (b *WriteBatcher) CancelToolCall(ctx context.Context, id string) error {
+	if err := b.flushFor(ctx, id); err != nil {
+		return err
+	}
+	return b.q.CancelToolCall(ctx, id)
+}
+
+func (b *WriteBatcher) CancelSessionToolCalls(ctx context.Context, sessionID string) error {
+	if err := b.flushFor(ctx, sessionID); err != nil {
+		return err
+	}
+	return b.q.CancelSessionToolCalls(ctx, sessionID)
+}
+
+func (b *WriteBatcher) DeleteToolCall(ctx context.Context, id string) error {
+	if err := b.flushFor(ctx, id); err != nil {
+		return err
+	}
+	return b.q.DeleteToolCall(ctx, id)
+}
+
+func (b *WriteBatcher) DeleteSessionToolCalls(ctx context.Context, sessionID string) error {
+	if err := b.flushFor(ctx, sessionID); err != nil {
+		return err
+	}
+	return b.q.DeleteSessionToolCalls(ctx, sessionID)
+}
+
+func (b *WriteBatcher) UpdateToolCallAwaitingPermission(ctx context.Context, arg UpdateToolCallAwaitingPermissionParams) error {
+	if err := b.flushFor(ctx, arg.ID); err != nil {
+		return err
+	}
+	return b.q.UpdateToolCallAwaitingPermission(ctx, arg)
+}
+
+func (b *WriteBatcher) ListAwaitingPermissionToolCalls(ctx context.Context, sessionID string) ([]ToolCall, error) {
+	if err := b.flushFor(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	return b.q.ListAwaitingPermissionToolCalls(ctx, sessionID)
+}
+
+func (b *WriteBatcher) UpdateToolCallPermissionGranted(ctx context.Context, id string) error {
+	if err := b.flushFor(ctx, id); err != nil {
+		return err
+	}
+	return b.q.UpdateToolCallPermissionGranted(ctx, id)
+}
+
+func (b *WriteBatcher) UpdateToolCallPermissionTimeout(ctx context.Context, id string) error {
+	if err := b.flushFor(ctx, id); err != nil {
+		return err
+	}
+	return b.q.UpdateToolCallPermissionTimeout(ctx, id)
+}
+
+func (b *WriteBatcher) ListTimedOutPermissionRequests(ctx context.Context, timeoutMs int64) ([]ToolCall, error) {
+	if err := b.flushFor(ctx); err != nil {
+		return nil, err
+	}
+	return b.q.ListTimedOutPermissionRequests(ctx, timeoutMs)
+}
+
+func (b *WriteBatcher) CancelAwaitingPermissionToolCalls(ctx context.Context, sessionID string) error {
+	if err := b.flushFor(ctx, sessionID); err != nil {
+		return err
+	}
+	return b.q.CancelAwaitingPermissionToolCalls(ctx, sessionID)
+}
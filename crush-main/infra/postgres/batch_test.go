@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB is a database/sql driver recording the statements it commits. The
+// statements matching fail are rejected, and the queries return rows.
+type fakeDB struct {
+	mu        sync.Mutex
+	committed []fakeExec
+	fail      func(query string, args []any) bool
+	rows      [][]driver.Value
+}
+
+type fakeExec struct {
+	query string
+	args  []any
+}
+
+// touches reports whether a committed statement has value as an argument.
+func (d *fakeDB) touches(value any) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.ContainsFunc(d.committed, func(e fakeExec) bool { return slices.Contains(e.args, value) })
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: d}, nil }
+func (d *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db      *fakeDB
+	pending []fakeExec
+	inTx    bool
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { c.inTx = true; return c, nil }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	args := make([]any, len(named))
+	for i, v := range named {
+		args[i] = v.Value
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.db.fail != nil && c.db.fail(query, args) {
+		return nil, errors.New("constraint violation")
+	}
+	if c.inTx {
+		c.pending = append(c.pending, fakeExec{query, args})
+	} else {
+		c.db.committed = append(c.db.committed, fakeExec{query, args})
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.committed = append(c.db.committed, c.pending...)
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+// newTestBatcher returns a batcher that only flushes when told to.
+func newTestBatcher(t *testing.T, fail func(query string, args []any) bool) (*WriteBatcher, *fakeDB, *[]DroppedWrites) {
+	fake := &fakeDB{fail: fail}
+	db := sql.OpenDB(fake)
+	b := NewWriteBatcher(db, New(db), time.Hour)
+	var dropped []DroppedWrites
+	b.SetDeadLetterHandler(func(d DroppedWrites) { dropped = append(dropped, d) })
+	t.Cleanup(func() {
+		b.closeMu.Do(func() { close(b.done) })
+		<-b.stopped
+		db.Close()
+	})
+	return b, fake, &dropped
+}
+
+func failArg(value any) func(string, []any) bool {
+	return func(_ string, args []any) bool { return slices.Contains(args, value) }
+}
+
+func TestWriteBatcherIsolatesSessions(t *testing.T) {
+	b, fake, dropped := newTestBatcher(t, failArg("bad"))
+	ctx := t.Context()
+
+	_, err := b.CreateMessage(ctx, CreateMessageParams{ID: "m1", SessionID: "good", Role: "user"})
+	require.NoError(t, err)
+	_, err = b.CreateMessage(ctx, CreateMessageParams{ID: "m2", SessionID: "bad", Role: "user"})
+	require.NoError(t, err)
+	_, err = b.CreateToolCall(ctx, CreateToolCallParams{ID: "t1", SessionID: "good", Name: "view", Status: "pending"})
+	require.NoError(t, err)
+
+	require.Error(t, b.Flush(ctx))
+	require.True(t, fake.touches("m1"))
+	require.True(t, fake.touches("t1"))
+	require.False(t, fake.touches("m2"))
+
+	// The failing session stays buffered and does not fail the reads of the others
+	require.NoError(t, b.flushFor(ctx, "good"))
+	m, err := b.GetMessage(ctx, "m2")
+	require.NoError(t, err)
+	require.Equal(t, "bad", m.SessionID)
+	require.Empty(t, *dropped)
+}
+
+func TestWriteBatcherDropsToDeadLetter(t *testing.T) {
+	b, _, dropped := newTestBatcher(t, failArg("bad"))
+	ctx := t.Context()
+
+	_, err := b.CreateMessage(ctx, CreateMessageParams{ID: "m1", SessionID: "bad", Role: "user"})
+	require.NoError(t, err)
+	require.NoError(t, b.UpdateMessage(ctx, UpdateMessageParams{ID: "m1", Parts: "[]"}))
+
+	for range maxFlushAttempts {
+		require.Error(t, b.Flush(ctx))
+	}
+	require.Len(t, *dropped, 1)
+	require.Equal(t, "bad", (*dropped)[0].SessionID)
+	require.Len(t, (*dropped)[0].Messages, 1)
+	require.Equal(t, "[]", (*dropped)[0].Messages[0].Parts)
+	require.NoError(t, b.Flush(ctx), "dropped writes are not retried")
+
+	// The next write of the session is told, once
+	_, err = b.CreateMessage(ctx, CreateMessageParams{ID: "m3", SessionID: "bad", Role: "user"})
+	require.ErrorIs(t, err, ErrWritesDropped)
+	_, err = b.CreateMessage(ctx, CreateMessageParams{ID: "m3", SessionID: "bad", Role: "user"})
+	require.NoError(t, err)
+}
+
+func TestWriteBatcherAppliesUpdatesPerRow(t *testing.T) {
+	b, fake, dropped := newTestBatcher(t, failArg("m-bad"))
+	ctx := t.Context()
+
+	require.NoError(t, b.UpdateMessage(ctx, UpdateMessageParams{ID: "m-bad", Parts: "a"}))
+	require.NoError(t, b.UpdateMessage(ctx, UpdateMessageParams{ID: "m-ok", Parts: "b"}))
+	require.NoError(t, b.UpdateMessage(ctx, UpdateMessageParams{ID: "m-ok", Parts: "c"}))
+
+	require.Error(t, b.Flush(ctx))
+	require.True(t, fake.touches("c"), "the latest update of the other row is applied")
+	require.False(t, fake.touches("b"))
+
+	for range maxFlushAttempts - 1 {
+		require.Error(t, b.Flush(ctx))
+	}
+	require.Len(t, *dropped, 1)
+	require.Equal(t, []UpdateMessageParams{{ID: "m-bad", Parts: "a"}}, (*dropped)[0].MessageUpdates)
+	require.ErrorIs(t, b.UpdateMessage(ctx, UpdateMessageParams{ID: "m-bad", Parts: "d"}), ErrWritesDropped)
+}
+
+func TestWriteBatcherKeepsToolCallUpdateOrder(t *testing.T) {
+	failing := true
+	b, fake, _ := newTestBatcher(t, func(_ string, args []any) bool {
+		return failing && slices.Contains(args, "running")
+	})
+	ctx := t.Context()
+
+	require.NoError(t, b.UpdateToolCallStatus(ctx, UpdateToolCallStatusParams{ID: "t1", Status: "running"}))
+	require.NoError(t, b.UpdateToolCallResult(ctx, UpdateToolCallResultParams{ID: "t1", Result: sql.NullString{String: "done", Valid: true}}))
+
+	// The result waits for the status update that failed
+	require.Error(t, b.Flush(ctx))
+	require.False(t, fake.touches("done"))
+
+	failing = false
+	require.NoError(t, b.Flush(ctx))
+	require.True(t, fake.touches("running"))
+	require.True(t, fake.touches("done"))
+}
@@ -3,29 +3,47 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log/slog"
 
-	"github.com/rolling1314/rolling-crush/pkg/config"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pressly/goose/v3"
+	"github.com/rolling1314/rolling-crush/pkg/config"
 )
 
-func Connect(ctx context.Context, dataDir string) (*sql.DB, error) {
-	// Get configuration
-	cfg := config.GetGlobalAppConfig()
-	dbCfg := cfg.Database
-
-	// Build PostgreSQL connection string
-	connStr := fmt.Sprintf(
+// connString builds the PostgreSQL connection string of the database config.
+func connString(dbCfg config.DatabaseConfig) string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		dbCfg.Host, dbCfg.Port, dbCfg.User, dbCfg.Password, dbCfg.Database, dbCfg.SSLMode,
 	)
+}
+
+// currentConfigConnector opens each connection with the database config of
+// the current app config, so that the connections opened once a rotated
+// password was resolved use it, see config.StartSecretRotation. The open
+// connections stay authenticated with the previous one.
+type currentConfigConnector struct{}
 
-	db, err := sql.Open("postgres", connStr)
+func (currentConfigConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connector, err := pq.NewConnector(connString(config.GetGlobalAppConfig().Database))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
+	return connector.Connect(ctx)
+}
+
+func (currentConfigConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+func Connect(ctx context.Context, dataDir string) (*sql.DB, error) {
+	// Get configuration
+	cfg := config.GetGlobalAppConfig()
+	dbCfg := cfg.Database
+
+	db := sql.OpenDB(currentConfigConnector{})
 
 	// Configure connection pool from config
 	db.SetMaxOpenConns(dbCfg.MaxOpenConns)
@@ -41,7 +59,7 @@ func Connect(ctx context.Context, dataDir string) (*sql.DB, error) {
 	)
 
 	// Verify connection
-	if err = db.PingContext(ctx); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
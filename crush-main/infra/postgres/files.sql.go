@@ -7,6 +7,7 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 )
 
 const createFile = `-- name: CreateFile :one
@@ -278,3 +279,96 @@ func (q *Queries) ListNewFiles(ctx context.Context) ([]File, error) {
 	}
 	return items, nil
 }
+
+const listProjectFileChanges = `-- name: ListProjectFileChanges :many
+SELECT f.id, f.session_id, f.path, f.content, f.version, f.created_at,
+       prev.content AS base_content
+FROM files f
+JOIN sessions s ON s.id = f.session_id
+LEFT JOIN LATERAL (
+    SELECT p.content
+    FROM files p
+    WHERE p.path = f.path AND p.version < f.version
+    ORDER BY p.version DESC, p.created_at DESC
+    LIMIT 1
+) prev ON TRUE
+WHERE s.project_id = $1
+  AND f.version > 0
+  AND (f.created_at, f.id) > ($2::BIGINT, $3::TEXT)
+ORDER BY f.created_at ASC, f.id ASC
+LIMIT $4
+`
+
+type ListProjectFileChangesParams struct {
+	ProjectID sql.NullString `json:"project_id"`
+	CreatedAt int64          `json:"created_at"`
+	ID        string         `json:"id"`
+	Limit     int32          `json:"limit"`
+}
+
+type ListProjectFileChangesRow struct {
+	ID          string         `json:"id"`
+	SessionID   string         `json:"session_id"`
+	Path        string         `json:"path"`
+	Content     string         `json:"content"`
+	Version     int64          `json:"version"`
+	CreatedAt   int64          `json:"created_at"`
+	BaseContent sql.NullString `json:"base_content"`
+}
+
+func (q *Queries) ListProjectFileChanges(ctx context.Context, arg ListProjectFileChangesParams) ([]ListProjectFileChangesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listProjectFileChanges,
+		arg.ProjectID,
+		arg.CreatedAt,
+		arg.ID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListProjectFileChangesRow{}
+	for rows.Next() {
+		var i ListProjectFileChangesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Path,
+			&i.Content,
+			&i.Version,
+			&i.CreatedAt,
+			&i.BaseContent,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestProjectFileChange = `-- name: GetLatestProjectFileChange :one
+SELECT f.id, f.created_at
+FROM files f
+JOIN sessions s ON s.id = f.session_id
+WHERE s.project_id = $1
+ORDER BY f.created_at DESC, f.id DESC
+LIMIT 1
+`
+
+type GetLatestProjectFileChangeRow struct {
+	ID        string `json:"id"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (q *Queries) GetLatestProjectFileChange(ctx context.Context, projectID sql.NullString) (GetLatestProjectFileChangeRow, error) {
+	row := q.db.QueryRowContext(ctx, getLatestProjectFileChange, projectID)
+	var i GetLatestProjectFileChangeRow
+	err := row.Scan(&i.ID, &i.CreatedAt)
+	return i, err
+}
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS project_pauses (
+    project_id TEXT PRIMARY KEY,
+    reason TEXT NOT NULL DEFAULT '',
+    mode TEXT NOT NULL DEFAULT 'reject',  -- 'reject' or 'queue'
+    drain BOOLEAN NOT NULL DEFAULT FALSE,
+    paused_by TEXT,
+    paused_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    resume_at BIGINT,           -- Unix timestamp in milliseconds, NULL pauses until resumed
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS project_pauses;
+-- +goose StatementEnd
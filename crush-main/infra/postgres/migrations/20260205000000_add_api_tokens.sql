@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,  -- SHA-256 of the token, the token itself is never stored
+    token_prefix TEXT NOT NULL,       -- First characters of the token, shown in listings
+    scopes TEXT NOT NULL DEFAULT '',  -- Comma separated scopes, e.g. 'read:sessions,write:prompts'
+    last_used_at BIGINT,              -- Unix timestamp in milliseconds
+    expires_at BIGINT,                -- Unix timestamp in milliseconds, NULL never expires
+    revoked_at BIGINT,                -- Unix timestamp in milliseconds
+    created_at BIGINT NOT NULL,       -- Unix timestamp in milliseconds
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_api_tokens_user_id;
+DROP TABLE IF EXISTS api_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS project_webhooks (
+    project_id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,                     -- HMAC secret (GitHub) or token (GitLab)
+    events TEXT NOT NULL DEFAULT 'push,pull_request',
+    prompt_template TEXT NOT NULL,
+    post_comment BOOLEAN NOT NULL DEFAULT FALSE,
+    scm_token TEXT NOT NULL DEFAULT '',       -- Token used to comment on pull requests
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS project_webhooks;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS project_chat_hooks (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    platform TEXT NOT NULL,                   -- slack or discord
+    webhook_url TEXT NOT NULL,
+    template TEXT NOT NULL DEFAULT '',        -- Empty uses the default message
+    events TEXT NOT NULL DEFAULT 'completed,failed',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_chat_hooks_project_id ON project_chat_hooks (project_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS project_chat_hooks;
+-- +goose StatementEnd
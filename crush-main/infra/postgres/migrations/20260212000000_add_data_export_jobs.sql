@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS data_export_jobs (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',   -- pending, running, completed, failed
+    object_name TEXT NOT NULL DEFAULT '',     -- Archive object in storage
+    size BIGINT NOT NULL DEFAULT 0,           -- Archive size in bytes
+    error TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,    -- Unix timestamp in milliseconds
+    completed_at BIGINT,           -- Unix timestamp in milliseconds
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_export_jobs_user_id ON data_export_jobs (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS data_export_jobs;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS turn_timelines (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    started_at BIGINT NOT NULL,               -- Unix timestamp in milliseconds
+    total_ms BIGINT NOT NULL DEFAULT 0,
+    model_ms BIGINT NOT NULL DEFAULT 0,       -- Time spent streaming from the model
+    tool_ms BIGINT NOT NULL DEFAULT 0,        -- Time spent running tools
+    db_ms BIGINT NOT NULL DEFAULT 0,          -- Time spent persisting steps
+    step_count INTEGER NOT NULL DEFAULT 0,
+    tool_call_count INTEGER NOT NULL DEFAULT 0,
+    steps TEXT NOT NULL DEFAULT '[]',         -- JSON per-step breakdown
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_turn_timelines_session_id ON turn_timelines (session_id);
+
+-- Messages written during a turn, to find the timeline of any of them
+CREATE TABLE IF NOT EXISTS turn_timeline_messages (
+    message_id TEXT PRIMARY KEY,
+    timeline_id TEXT NOT NULL,
+    FOREIGN KEY (timeline_id) REFERENCES turn_timelines (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_turn_timeline_messages_timeline_id ON turn_timeline_messages (timeline_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS turn_timeline_messages;
+DROP TABLE IF EXISTS turn_timelines;
+-- +goose StatementEnd
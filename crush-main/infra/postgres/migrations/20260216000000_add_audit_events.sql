@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS audit_events (
+    id TEXT PRIMARY KEY,
+    session_id TEXT,                          -- Session the event happened in, if any
+    message_id TEXT,                          -- Message the event is about, if any
+    category TEXT NOT NULL,                   -- e.g. moderation
+    action TEXT NOT NULL,                     -- What was done, e.g. redact, halt or flag
+    detail TEXT NOT NULL DEFAULT '{}',        -- JSON details of the event
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_session_id ON audit_events (session_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_category ON audit_events (category, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS audit_events;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS project_permission_policies (
+    project_id TEXT PRIMARY KEY,
+    rules TEXT NOT NULL DEFAULT '[]',  -- JSON array of allow/deny rules
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS project_permission_policies;
+-- +goose StatementEnd
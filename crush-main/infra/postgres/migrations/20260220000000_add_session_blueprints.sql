@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS session_blueprints (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    name TEXT NOT NULL,                       -- Referenced by ?blueprint= when creating sessions
+    description TEXT NOT NULL DEFAULT '',
+    pinned_context TEXT NOT NULL DEFAULT '',  -- Appended to the system prompt of every turn
+    model_config TEXT NOT NULL DEFAULT '',    -- JSON model selection, empty uses the auto model
+    allowed_tools TEXT NOT NULL DEFAULT '',   -- Comma separated tools allowed without asking
+    prompts TEXT NOT NULL DEFAULT '[]',       -- JSON array of opening prompts, run in order
+    agent TEXT NOT NULL DEFAULT '',           -- Empty runs the opening prompts with the coder
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    UNIQUE (project_id, name),
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS session_blueprints;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE project_permission_policies
+    ADD COLUMN IF NOT EXISTS shadow_rules TEXT,           -- JSON array of the candidate rules, NULL when no trial runs
+    ADD COLUMN IF NOT EXISTS shadow_started_at BIGINT,    -- Unix timestamp in milliseconds
+    ADD COLUMN IF NOT EXISTS shadow_until BIGINT;         -- Unix timestamp in milliseconds
+
+CREATE TABLE IF NOT EXISTS permission_shadow_decisions (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    tool_name TEXT NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',         -- Command, URL or path of the request
+    actual TEXT NOT NULL,                     -- allow, deny or ask by the enforced policy
+    shadow TEXT NOT NULL,                     -- allow, deny or ask by the candidate policy
+    actual_rule TEXT NOT NULL DEFAULT '',
+    shadow_rule TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_permission_shadow_decisions_project_id ON permission_shadow_decisions (project_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS permission_shadow_decisions;
+
+ALTER TABLE project_permission_policies
+    DROP COLUMN IF EXISTS shadow_rules,
+    DROP COLUMN IF EXISTS shadow_started_at,
+    DROP COLUMN IF EXISTS shadow_until;
+-- +goose StatementEnd
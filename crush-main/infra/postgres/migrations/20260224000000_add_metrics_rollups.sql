@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS metrics_rollups (
+    bucket BIGINT NOT NULL,                   -- Start of the 5 minute bucket, Unix timestamp in milliseconds
+    session_id TEXT NOT NULL,
+    turns INTEGER NOT NULL DEFAULT 0,         -- Agent turns finished in the bucket
+    errors INTEGER NOT NULL DEFAULT 0,        -- Turns that failed
+    cost DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    PRIMARY KEY (bucket, session_id),
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_rollups_session_id ON metrics_rollups (session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS metrics_rollups;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS uploads (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size BIGINT NOT NULL,                     -- Declared file size in bytes
+    chunk_size BIGINT NOT NULL,               -- Size of every chunk but the last
+    received BIGINT NOT NULL DEFAULT 0,       -- Bytes stored so far, the resume offset
+    status TEXT NOT NULL DEFAULT 'uploading', -- uploading, completed
+    object_name TEXT NOT NULL DEFAULT '',     -- Assembled object in storage once completed
+    created_at BIGINT NOT NULL,    -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL,    -- Unix timestamp in milliseconds
+    completed_at BIGINT,           -- Unix timestamp in milliseconds
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_user_id ON uploads (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS uploads;
+-- +goose StatementEnd
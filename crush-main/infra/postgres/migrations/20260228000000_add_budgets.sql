@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS budgets (
+    scope TEXT NOT NULL,                             -- session, project, user
+    scope_id TEXT NOT NULL,                          -- ID of the session, project or user
+    max_cost DOUBLE PRECISION NOT NULL DEFAULT 0.0,  -- 0 means unlimited
+    max_tokens BIGINT NOT NULL DEFAULT 0,            -- Prompt and completion tokens, 0 means unlimited
+    created_at BIGINT NOT NULL,    -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL,    -- Unix timestamp in milliseconds
+    PRIMARY KEY (scope, scope_id),
+    CHECK (max_cost >= 0.0),
+    CHECK (max_tokens >= 0)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS budgets;
+-- +goose StatementEnd
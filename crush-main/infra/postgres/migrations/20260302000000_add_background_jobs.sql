@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS background_jobs (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    container_name TEXT NOT NULL DEFAULT '', -- Sandbox container running the job
+    command TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    working_dir TEXT NOT NULL DEFAULT '',
+    pid INTEGER NOT NULL,                    -- Process group leader inside the container
+    status TEXT NOT NULL DEFAULT 'running',  -- running, completed, killed, lost
+    exit_code INTEGER,
+    created_at BIGINT NOT NULL,    -- Unix timestamp in milliseconds
+    completed_at BIGINT,           -- Unix timestamp in milliseconds
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_background_jobs_session_id ON background_jobs (session_id);
+CREATE INDEX IF NOT EXISTS idx_background_jobs_status ON background_jobs (status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS background_jobs;
+-- +goose StatementEnd
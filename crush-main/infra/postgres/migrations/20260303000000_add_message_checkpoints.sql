@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Token counters of a session when a user message was sent, restored when the
+-- conversation is truncated back to that message to regenerate from it
+CREATE TABLE IF NOT EXISTS message_checkpoints (
+    message_id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    prompt_tokens BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_checkpoints_session_id ON message_checkpoints (session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_checkpoints;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tool_audit_log (
+    id TEXT PRIMARY KEY,
+    tool_call_id TEXT NOT NULL,
+    session_id TEXT NOT NULL,                 -- Kept after the session is deleted
+    project_id TEXT NOT NULL DEFAULT '',      -- Kept after the project is deleted
+    user_id TEXT,                             -- Owner of the project, the entries go with the account
+    message_id TEXT NOT NULL DEFAULT '',      -- Assistant message that called the tool
+    tool_name TEXT NOT NULL,
+    params_hash TEXT NOT NULL,                -- SHA-256 of the tool input
+    permission TEXT NOT NULL,                 -- How the permission was decided, e.g. granted, policy_deny or not_required
+    duration_ms BIGINT NOT NULL,
+    result_size BIGINT NOT NULL,              -- Bytes of the tool result
+    is_error BOOLEAN NOT NULL DEFAULT FALSE,
+    error TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tool_audit_log_session_id ON tool_audit_log (session_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_tool_audit_log_project_id ON tool_audit_log (project_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_tool_audit_log_user_id ON tool_audit_log (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_tool_audit_log_created_at ON tool_audit_log (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS tool_audit_log;
+-- +goose StatementEnd
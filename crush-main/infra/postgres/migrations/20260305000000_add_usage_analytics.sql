@@ -0,0 +1,75 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Tokens and cost of the model requests of the agent, titles and summaries
+CREATE TABLE IF NOT EXISTS model_usage (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    message_id TEXT NOT NULL DEFAULT '',      -- Assistant or summary message, empty for titles
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    cache_creation_tokens BIGINT NOT NULL DEFAULT 0,
+    cache_read_tokens BIGINT NOT NULL DEFAULT 0,
+    cost DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_model_usage_session_id ON model_usage (session_id);
+CREATE INDEX IF NOT EXISTS idx_model_usage_created_at ON model_usage (created_at);
+
+-- Daily rollups read by the analytics endpoints. user_id and project_id are
+-- empty for sessions without project.
+CREATE TABLE IF NOT EXISTS usage_rollups (
+    day BIGINT NOT NULL,                      -- Start of the UTC day, Unix timestamp in milliseconds
+    user_id TEXT NOT NULL,
+    project_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    cache_creation_tokens BIGINT NOT NULL DEFAULT 0,
+    cache_read_tokens BIGINT NOT NULL DEFAULT 0,
+    cost DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    PRIMARY KEY (day, user_id, project_id, provider, model)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_user_id ON usage_rollups (user_id, day);
+
+CREATE TABLE IF NOT EXISTS tool_usage_rollups (
+    day BIGINT NOT NULL,
+    user_id TEXT NOT NULL,
+    project_id TEXT NOT NULL,
+    tool_name TEXT NOT NULL,
+    calls INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, user_id, project_id, tool_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tool_usage_rollups_user_id ON tool_usage_rollups (user_id, day);
+
+CREATE TABLE IF NOT EXISTS run_rollups (
+    day BIGINT NOT NULL,
+    user_id TEXT NOT NULL,
+    project_id TEXT NOT NULL,
+    runs INTEGER NOT NULL DEFAULT 0,          -- Agent turns
+    total_ms BIGINT NOT NULL DEFAULT 0,
+    model_ms BIGINT NOT NULL DEFAULT 0,
+    tool_ms BIGINT NOT NULL DEFAULT 0,
+    max_ms BIGINT NOT NULL DEFAULT 0,         -- Longest turn
+    PRIMARY KEY (day, user_id, project_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_run_rollups_user_id ON run_rollups (user_id, day);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS run_rollups;
+DROP TABLE IF EXISTS tool_usage_rollups;
+DROP TABLE IF EXISTS usage_rollups;
+DROP TABLE IF EXISTS model_usage;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE projects
+    ADD COLUMN IF NOT EXISTS system_prompt TEXT NOT NULL DEFAULT '';  -- Added to the system prompt of the agent, e.g. project conventions
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE projects
+    DROP COLUMN IF EXISTS system_prompt;
+-- +goose StatementEnd
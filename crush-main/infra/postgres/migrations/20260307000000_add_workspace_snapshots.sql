@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workspace_snapshots (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    session_id TEXT NOT NULL DEFAULT '',     -- Session whose run was snapshotted, empty for manual snapshots
+    reason TEXT NOT NULL,                    -- manual, run or restore
+    object_name TEXT NOT NULL,               -- tar.gz archive of the workspace in storage
+    size BIGINT NOT NULL DEFAULT 0,          -- Archive size in bytes
+    created_by TEXT NOT NULL DEFAULT '',     -- User who took the snapshot, empty for automatic ones
+    created_at BIGINT NOT NULL,    -- Unix timestamp in milliseconds
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_snapshots_project_id ON workspace_snapshots (project_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workspace_snapshots;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE projects
+    ADD COLUMN IF NOT EXISTS permission_timeout INTEGER NOT NULL DEFAULT 0;  -- Seconds a permission request waits for the user, 0 uses the server default
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE projects
+    DROP COLUMN IF EXISTS permission_timeout;
+-- +goose StatementEnd
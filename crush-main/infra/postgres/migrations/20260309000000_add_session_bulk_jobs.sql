@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS archived_at BIGINT,                -- Unix timestamp in milliseconds, NULL while active
+    ADD COLUMN IF NOT EXISTS tags TEXT NOT NULL DEFAULT '[]';   -- JSON array of tags
+
+CREATE TABLE IF NOT EXISTS session_bulk_jobs (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    action TEXT NOT NULL,                     -- archive, delete, tag
+    status TEXT NOT NULL DEFAULT 'pending',   -- pending, running, completed, failed
+    total INTEGER NOT NULL DEFAULT 0,         -- Sessions selected
+    processed INTEGER NOT NULL DEFAULT 0,     -- Sessions done, failed ones included
+    failed INTEGER NOT NULL DEFAULT 0,
+    failures TEXT NOT NULL DEFAULT '[]',      -- JSON array of {session_id, error}
+    error TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,    -- Unix timestamp in milliseconds
+    completed_at BIGINT,           -- Unix timestamp in milliseconds
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_bulk_jobs_user_id ON session_bulk_jobs (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS session_bulk_jobs;
+
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS archived_at;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS deleted_at BIGINT;  -- Unix timestamp in milliseconds of the soft delete by the retention, purged after the grace period
+
+CREATE INDEX IF NOT EXISTS idx_sessions_deleted_at ON sessions (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE projects
+    ADD COLUMN IF NOT EXISTS retention_days INTEGER NOT NULL DEFAULT 0;  -- Days of inactivity before a session is soft-deleted, 0 uses the server default, -1 keeps sessions
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE projects
+    DROP COLUMN IF EXISTS retention_days;
+
+DROP INDEX IF EXISTS idx_sessions_deleted_at;
+
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
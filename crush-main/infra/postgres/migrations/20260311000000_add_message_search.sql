@@ -0,0 +1,90 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Searchable parts of the messages: text, tool call inputs and tool results.
+-- Rows are kept in sync with the messages by a trigger.
+CREATE TABLE IF NOT EXISTS message_search (
+    message_id TEXT NOT NULL,
+    part_index INTEGER NOT NULL,              -- Position of the part in the message, from 1
+    session_id TEXT NOT NULL,
+    role TEXT NOT NULL,
+    kind TEXT NOT NULL,                       -- text, tool_call or tool_result
+    tool_name TEXT NOT NULL DEFAULT '',
+    tool_call_id TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL,                    -- Truncated to 65536 characters
+    content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED,
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    PRIMARY KEY (message_id, part_index),
+    FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_search_session_id ON message_search (session_id);
+CREATE INDEX IF NOT EXISTS idx_message_search_content_tsv ON message_search USING GIN (content_tsv);
+-- Trigram index for code snippets and identifiers the text search splits up
+CREATE INDEX IF NOT EXISTS idx_message_search_content_trgm ON message_search USING GIN (content gin_trgm_ops);
+
+-- Rebuilds the search rows of a message from its parts
+CREATE OR REPLACE FUNCTION index_message_search()
+RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM message_search WHERE message_id = NEW.id;
+    INSERT INTO message_search (message_id, part_index, session_id, role, kind, tool_name, tool_call_id, content, created_at)
+    SELECT NEW.id, p.idx, NEW.session_id, NEW.role, p.part->>'type',
+           COALESCE(p.part->'data'->>'name', ''),
+           CASE p.part->>'type'
+               WHEN 'tool_call' THEN COALESCE(p.part->'data'->>'id', '')
+               WHEN 'tool_result' THEN COALESCE(p.part->'data'->>'tool_call_id', '')
+               ELSE ''
+           END,
+           LEFT(p.content, 65536),
+           NEW.created_at
+    FROM (
+        SELECT e.part, e.idx,
+               CASE e.part->>'type'
+                   WHEN 'text' THEN e.part->'data'->>'text'
+                   WHEN 'tool_call' THEN e.part->'data'->>'input'
+                   WHEN 'tool_result' THEN e.part->'data'->>'content'
+               END AS content
+        FROM jsonb_array_elements(NEW.parts::jsonb) WITH ORDINALITY AS e(part, idx)
+    ) p
+    WHERE COALESCE(p.content, '') <> '';
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER index_message_search_trigger
+AFTER INSERT OR UPDATE OF parts ON messages
+FOR EACH ROW
+EXECUTE FUNCTION index_message_search();
+
+-- Index the existing messages
+INSERT INTO message_search (message_id, part_index, session_id, role, kind, tool_name, tool_call_id, content, created_at)
+SELECT p.id, p.idx, p.session_id, p.role, p.part->>'type',
+       COALESCE(p.part->'data'->>'name', ''),
+       CASE p.part->>'type'
+           WHEN 'tool_call' THEN COALESCE(p.part->'data'->>'id', '')
+           WHEN 'tool_result' THEN COALESCE(p.part->'data'->>'tool_call_id', '')
+           ELSE ''
+       END,
+       LEFT(p.content, 65536),
+       p.created_at
+FROM (
+    SELECT m.id, m.session_id, m.role, m.created_at, e.part, e.idx,
+           CASE e.part->>'type'
+               WHEN 'text' THEN e.part->'data'->>'text'
+               WHEN 'tool_call' THEN e.part->'data'->>'input'
+               WHEN 'tool_result' THEN e.part->'data'->>'content'
+           END AS content
+    FROM messages m, jsonb_array_elements(m.parts::jsonb) WITH ORDINALITY AS e(part, idx)
+) p
+WHERE COALESCE(p.content, '') <> '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS index_message_search_trigger ON messages;
+DROP FUNCTION IF EXISTS index_message_search();
+DROP TABLE IF EXISTS message_search;
+-- +goose StatementEnd
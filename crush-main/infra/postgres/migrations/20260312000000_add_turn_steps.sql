@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Structured record of each step of a turn, keyed by its assistant message
+CREATE TABLE IF NOT EXISTS turn_steps (
+    message_id TEXT PRIMARY KEY,
+    timeline_id TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    step_index INTEGER NOT NULL,
+    started_at BIGINT NOT NULL,                  -- Unix timestamp in milliseconds
+    -- Preparation of the prompt
+    prepare_ms BIGINT NOT NULL DEFAULT 0,
+    message_count INTEGER NOT NULL DEFAULT 0,    -- Messages sent to the model
+    queued_prompts INTEGER NOT NULL DEFAULT 0,   -- Queued prompts added to the step
+    compacted_results INTEGER NOT NULL DEFAULT 0, -- Old tool results elided
+    loop_nudge BOOLEAN NOT NULL DEFAULT FALSE,   -- Whether the model was nudged out of a tool call loop
+    -- Model call
+    provider TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    first_token_ms BIGINT NOT NULL DEFAULT 0,
+    model_ms BIGINT NOT NULL DEFAULT 0,
+    finish_reason TEXT NOT NULL DEFAULT '',      -- Empty when the step did not finish
+    -- Tool calls
+    tool_calls TEXT NOT NULL DEFAULT '[]',       -- JSON tool runs of the step
+    -- Usage
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    cache_creation_tokens BIGINT NOT NULL DEFAULT 0,
+    cache_read_tokens BIGINT NOT NULL DEFAULT 0,
+    cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (timeline_id) REFERENCES turn_timelines (id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_turn_steps_timeline_id ON turn_steps (timeline_id, step_index);
+CREATE INDEX IF NOT EXISTS idx_turn_steps_session_id ON turn_steps (session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS turn_steps;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Embeddings of the chunks of the files of project workspaces, for semantic code search
+CREATE TABLE IF NOT EXISTS code_chunks (
+    project_id TEXT NOT NULL,
+    path TEXT NOT NULL,                  -- Relative to the workspace root
+    chunk_index INTEGER NOT NULL,
+    start_line INTEGER NOT NULL,
+    end_line INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    embedding BYTEA NOT NULL,            -- Little-endian float32 vector
+    model TEXT NOT NULL,                 -- Embedding model of the vector
+    file_modified BIGINT NOT NULL,       -- Unix timestamp in milliseconds of the indexed file
+    file_size BIGINT NOT NULL,
+    created_at BIGINT NOT NULL,          -- Unix timestamp in milliseconds
+    PRIMARY KEY (project_id, path, chunk_index),
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS code_chunks;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE projects
+    ADD COLUMN IF NOT EXISTS cpu_limit DOUBLE PRECISION NOT NULL DEFAULT 0,  -- CPUs the project container may use, 0 means unlimited
+    ADD COLUMN IF NOT EXISTS memory_limit_mb INTEGER NOT NULL DEFAULT 0,     -- Memory in MB the project container may use, 0 means unlimited
+    ADD COLUMN IF NOT EXISTS disk_limit_mb INTEGER NOT NULL DEFAULT 0;       -- Disk in MB the project workspace may use, 0 means unlimited
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE projects
+    DROP COLUMN IF EXISTS disk_limit_mb,
+    DROP COLUMN IF EXISTS memory_limit_mb,
+    DROP COLUMN IF EXISTS cpu_limit;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS project_templates (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,                  -- Shown in the template gallery
+    description TEXT NOT NULL DEFAULT '',
+    backend_language TEXT NOT NULL DEFAULT '',  -- "", "go", "java" or "python"
+    need_database BOOLEAN NOT NULL DEFAULT FALSE,
+    frontend_command TEXT NOT NULL DEFAULT '',  -- Empty keeps the command of the sandbox image
+    backend_command TEXT NOT NULL DEFAULT '',
+    starter_repo TEXT NOT NULL DEFAULT '',      -- Git repository cloned into the new workspace, empty for none
+    starter_ref TEXT NOT NULL DEFAULT '',       -- Branch or tag of the starter repository, empty for its default branch
+    scripts TEXT NOT NULL DEFAULT '[]',         -- JSON array of shell commands run in the workspace after it is created
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL   -- Unix timestamp in milliseconds
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS project_templates;
+-- +goose StatementEnd
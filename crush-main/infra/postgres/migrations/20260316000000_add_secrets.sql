@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS secrets (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL DEFAULT '',  -- Empty for the global secrets, e.g. provider API keys
+    name TEXT NOT NULL,                   -- Environment variable name, e.g. OPENAI_API_KEY
+    value TEXT NOT NULL,                  -- Base64 AES-GCM nonce and ciphertext, never the plaintext
+    created_by TEXT NOT NULL DEFAULT '',  -- User who set the secret first
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    UNIQUE (project_id, name)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS secrets;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Notes the agent keeps about a project, e.g. build commands and gotchas,
+-- shared by the sessions of the project
+CREATE TABLE IF NOT EXISTS project_memories (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    content TEXT NOT NULL,
+    content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED,
+    session_id TEXT NOT NULL DEFAULT '',  -- Session the note was written in, empty when added through the API
+    created_by TEXT NOT NULL DEFAULT '',  -- User who added the note through the API, empty for the agent
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_memories_project_id ON project_memories (project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_project_memories_content_tsv ON project_memories USING GIN (content_tsv);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS project_memories;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ratings of the agent answers by the users, one per user and message
+CREATE TABLE IF NOT EXISTS message_feedback (
+    id TEXT PRIMARY KEY,
+    message_id TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    rating TEXT NOT NULL,                 -- "up" or "down"
+    category TEXT NOT NULL DEFAULT '',    -- Reason of the rating, e.g. "incorrect"
+    comment TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    updated_at BIGINT NOT NULL,  -- Unix timestamp in milliseconds
+    UNIQUE (message_id, user_id),
+    FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_feedback_session_id ON message_feedback (session_id);
+CREATE INDEX IF NOT EXISTS idx_message_feedback_updated_at ON message_feedback (updated_at);
+
+ALTER TABLE metrics_rollups ADD COLUMN IF NOT EXISTS feedback_up INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE metrics_rollups ADD COLUMN IF NOT EXISTS feedback_down INTEGER NOT NULL DEFAULT 0;
+
+-- Ratings by day, user, project, model and category
+CREATE TABLE IF NOT EXISTS feedback_rollups (
+    day BIGINT NOT NULL,
+    user_id TEXT NOT NULL,
+    project_id TEXT NOT NULL,
+    model TEXT NOT NULL,
+    category TEXT NOT NULL,
+    up INTEGER NOT NULL DEFAULT 0,
+    down INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, user_id, project_id, model, category)
+);
+
+CREATE INDEX IF NOT EXISTS idx_feedback_rollups_user_id ON feedback_rollups (user_id, day);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS feedback_rollups;
+ALTER TABLE metrics_rollups DROP COLUMN IF EXISTS feedback_down;
+ALTER TABLE metrics_rollups DROP COLUMN IF EXISTS feedback_up;
+DROP TABLE IF EXISTS message_feedback;
+-- +goose StatementEnd
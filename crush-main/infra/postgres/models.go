@@ -8,6 +8,87 @@ import (
 	"database/sql"
 )
 
+type ApiToken struct {
+	ID          string        `json:"id"`
+	UserID      string        `json:"user_id"`
+	Name        string        `json:"name"`
+	TokenHash   string        `json:"token_hash"`
+	TokenPrefix string        `json:"token_prefix"`
+	Scopes      string        `json:"scopes"`
+	LastUsedAt  sql.NullInt64 `json:"last_used_at"`
+	ExpiresAt   sql.NullInt64 `json:"expires_at"`
+	RevokedAt   sql.NullInt64 `json:"revoked_at"`
+	CreatedAt   int64         `json:"created_at"`
+}
+
+type AuditEvent struct {
+	ID        string         `json:"id"`
+	SessionID sql.NullString `json:"session_id"`
+	MessageID sql.NullString `json:"message_id"`
+	Category  string         `json:"category"`
+	Action    string         `json:"action"`
+	Detail    string         `json:"detail"`
+	CreatedAt int64          `json:"created_at"`
+}
+
+type BackgroundJob struct {
+	ID            string        `json:"id"`
+	SessionID     string        `json:"session_id"`
+	ContainerName string        `json:"container_name"`
+	Command       string        `json:"command"`
+	Description   string        `json:"description"`
+	WorkingDir    string        `json:"working_dir"`
+	Pid           int32         `json:"pid"`
+	Status        string        `json:"status"`
+	ExitCode      sql.NullInt32 `json:"exit_code"`
+	CreatedAt     int64         `json:"created_at"`
+	CompletedAt   sql.NullInt64 `json:"completed_at"`
+}
+
+type Budget struct {
+	Scope     string  `json:"scope"`
+	ScopeID   string  `json:"scope_id"`
+	MaxCost   float64 `json:"max_cost"`
+	MaxTokens int64   `json:"max_tokens"`
+	CreatedAt int64   `json:"created_at"`
+	UpdatedAt int64   `json:"updated_at"`
+}
+
+type CodeChunk struct {
+	ProjectID    string `json:"project_id"`
+	Path         string `json:"path"`
+	ChunkIndex   int32  `json:"chunk_index"`
+	StartLine    int32  `json:"start_line"`
+	EndLine      int32  `json:"end_line"`
+	Content      string `json:"content"`
+	Embedding    []byte `json:"embedding"`
+	Model        string `json:"model"`
+	FileModified int64  `json:"file_modified"`
+	FileSize     int64  `json:"file_size"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+type DataExportJob struct {
+	ID          string        `json:"id"`
+	UserID      string        `json:"user_id"`
+	Status      string        `json:"status"`
+	ObjectName  string        `json:"object_name"`
+	Size        int64         `json:"size"`
+	Error       string        `json:"error"`
+	CreatedAt   int64         `json:"created_at"`
+	CompletedAt sql.NullInt64 `json:"completed_at"`
+}
+
+type FeedbackRollup struct {
+	Day       int64  `json:"day"`
+	UserID    string `json:"user_id"`
+	ProjectID string `json:"project_id"`
+	Model     string `json:"model"`
+	Category  string `json:"category"`
+	Up        int32  `json:"up"`
+	Down      int32  `json:"down"`
+}
+
 type File struct {
 	ID        string `json:"id"`
 	SessionID string `json:"session_id"`
@@ -31,29 +112,181 @@ type Message struct {
 	IsSummaryMessage int64          `json:"is_summary_message"`
 }
 
+type MessageCheckpoint struct {
+	MessageID        string `json:"message_id"`
+	SessionID        string `json:"session_id"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	CreatedAt        int64  `json:"created_at"`
+}
+
+type MessageFeedback struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id"`
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+	Rating    string `json:"rating"`
+	Category  string `json:"category"`
+	Comment   string `json:"comment"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type MetricsRollup struct {
+	Bucket       int64   `json:"bucket"`
+	SessionID    string  `json:"session_id"`
+	Turns        int32   `json:"turns"`
+	Errors       int32   `json:"errors"`
+	Cost         float64 `json:"cost"`
+	FeedbackUp   int32   `json:"feedback_up"`
+	FeedbackDown int32   `json:"feedback_down"`
+}
+
+type ModelUsage struct {
+	ID                  string  `json:"id"`
+	SessionID           string  `json:"session_id"`
+	MessageID           string  `json:"message_id"`
+	Provider            string  `json:"provider"`
+	Model               string  `json:"model"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	Cost                float64 `json:"cost"`
+	CreatedAt           int64   `json:"created_at"`
+}
+
 type Project struct {
-	ID               string         `json:"id"`
-	UserID           string         `json:"user_id"`
-	Name             string         `json:"name"`
-	Description      sql.NullString `json:"description"`
-	CreatedAt        int64          `json:"created_at"`
-	UpdatedAt        int64          `json:"updated_at"`
-	ExternalIP       string         `json:"external_ip"`
-	FrontendPort     int32          `json:"frontend_port"`
-	WorkspacePath    string         `json:"workspace_path"`
-	ContainerName    sql.NullString `json:"container_name"`
-	WorkdirPath      sql.NullString `json:"workdir_path"`
-	DbHost           sql.NullString `json:"db_host"`
-	DbPort           sql.NullInt32  `json:"db_port"`
-	DbUser           sql.NullString `json:"db_user"`
-	DbPassword       sql.NullString `json:"db_password"`
-	DbName           sql.NullString `json:"db_name"`
-	BackendPort      sql.NullInt32  `json:"backend_port"`
-	FrontendCommand  sql.NullString `json:"frontend_command"`
-	FrontendLanguage sql.NullString `json:"frontend_language"`
-	BackendCommand   sql.NullString `json:"backend_command"`
-	BackendLanguage  sql.NullString `json:"backend_language"`
-	Subdomain        sql.NullString `json:"subdomain"`
+	ID                string         `json:"id"`
+	UserID            string         `json:"user_id"`
+	Name              string         `json:"name"`
+	Description       sql.NullString `json:"description"`
+	CreatedAt         int64          `json:"created_at"`
+	UpdatedAt         int64          `json:"updated_at"`
+	ExternalIP        string         `json:"external_ip"`
+	FrontendPort      int32          `json:"frontend_port"`
+	WorkspacePath     string         `json:"workspace_path"`
+	ContainerName     sql.NullString `json:"container_name"`
+	WorkdirPath       sql.NullString `json:"workdir_path"`
+	DbHost            sql.NullString `json:"db_host"`
+	DbPort            sql.NullInt32  `json:"db_port"`
+	DbUser            sql.NullString `json:"db_user"`
+	DbPassword        sql.NullString `json:"db_password"`
+	DbName            sql.NullString `json:"db_name"`
+	BackendPort       sql.NullInt32  `json:"backend_port"`
+	FrontendCommand   sql.NullString `json:"frontend_command"`
+	FrontendLanguage  sql.NullString `json:"frontend_language"`
+	BackendCommand    sql.NullString `json:"backend_command"`
+	BackendLanguage   sql.NullString `json:"backend_language"`
+	Subdomain         sql.NullString `json:"subdomain"`
+	SystemPrompt      string         `json:"system_prompt"`
+	PermissionTimeout int32          `json:"permission_timeout"`
+	RetentionDays     int32          `json:"retention_days"`
+	CpuLimit          float64        `json:"cpu_limit"`
+	MemoryLimitMb     int32          `json:"memory_limit_mb"`
+	DiskLimitMb       int32          `json:"disk_limit_mb"`
+}
+
+type ProjectChatHook struct {
+	ID         string `json:"id"`
+	ProjectID  string `json:"project_id"`
+	Platform   string `json:"platform"`
+	WebhookUrl string `json:"webhook_url"`
+	Template   string `json:"template"`
+	Events     string `json:"events"`
+	Enabled    bool   `json:"enabled"`
+	CreatedAt  int64  `json:"created_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+type ProjectMemory struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	Content   string `json:"content"`
+	SessionID string `json:"session_id"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type ProjectPause struct {
+	ProjectID string         `json:"project_id"`
+	Reason    string         `json:"reason"`
+	Mode      string         `json:"mode"`
+	Drain     bool           `json:"drain"`
+	PausedBy  sql.NullString `json:"paused_by"`
+	PausedAt  int64          `json:"paused_at"`
+	ResumeAt  sql.NullInt64  `json:"resume_at"`
+}
+
+type PermissionShadowDecision struct {
+	ID         string `json:"id"`
+	ProjectID  string `json:"project_id"`
+	SessionID  string `json:"session_id"`
+	ToolName   string `json:"tool_name"`
+	Subject    string `json:"subject"`
+	Actual     string `json:"actual"`
+	Shadow     string `json:"shadow"`
+	ActualRule string `json:"actual_rule"`
+	ShadowRule string `json:"shadow_rule"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+type ProjectPermissionPolicy struct {
+	ProjectID       string         `json:"project_id"`
+	Rules           string         `json:"rules"`
+	CreatedAt       int64          `json:"created_at"`
+	UpdatedAt       int64          `json:"updated_at"`
+	ShadowRules     sql.NullString `json:"shadow_rules"`
+	ShadowStartedAt sql.NullInt64  `json:"shadow_started_at"`
+	ShadowUntil     sql.NullInt64  `json:"shadow_until"`
+}
+
+type ProjectTemplate struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	BackendLanguage string `json:"backend_language"`
+	NeedDatabase    bool   `json:"need_database"`
+	FrontendCommand string `json:"frontend_command"`
+	BackendCommand  string `json:"backend_command"`
+	StarterRepo     string `json:"starter_repo"`
+	StarterRef      string `json:"starter_ref"`
+	Scripts         string `json:"scripts"`
+	CreatedAt       int64  `json:"created_at"`
+	UpdatedAt       int64  `json:"updated_at"`
+}
+
+type ProjectWebhook struct {
+	ProjectID      string `json:"project_id"`
+	Secret         string `json:"secret"`
+	Events         string `json:"events"`
+	PromptTemplate string `json:"prompt_template"`
+	PostComment    bool   `json:"post_comment"`
+	ScmToken       string `json:"scm_token"`
+	Enabled        bool   `json:"enabled"`
+	CreatedAt      int64  `json:"created_at"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+type RunRollup struct {
+	Day       int64  `json:"day"`
+	UserID    string `json:"user_id"`
+	ProjectID string `json:"project_id"`
+	Runs      int32  `json:"runs"`
+	TotalMs   int64  `json:"total_ms"`
+	ModelMs   int64  `json:"model_ms"`
+	ToolMs    int64  `json:"tool_ms"`
+	MaxMs     int64  `json:"max_ms"`
+}
+
+type Secret struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
 }
 
 type Session struct {
@@ -69,6 +302,54 @@ type Session struct {
 	SummaryMessageID sql.NullString `json:"summary_message_id"`
 	ProjectID        sql.NullString `json:"project_id"`
 	Todos            sql.NullString `json:"todos"`
+	ArchivedAt       sql.NullInt64  `json:"archived_at"`
+	Tags             string         `json:"tags"`
+	DeletedAt        sql.NullInt64  `json:"deleted_at"`
+}
+
+type SessionBlueprint struct {
+	ID            string `json:"id"`
+	ProjectID     string `json:"project_id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	PinnedContext string `json:"pinned_context"`
+	ModelConfig   string `json:"model_config"`
+	AllowedTools  string `json:"allowed_tools"`
+	Prompts       string `json:"prompts"`
+	Agent         string `json:"agent"`
+	CreatedAt     int64  `json:"created_at"`
+	UpdatedAt     int64  `json:"updated_at"`
+}
+
+type SessionBulkJob struct {
+	ID          string        `json:"id"`
+	UserID      string        `json:"user_id"`
+	Action      string        `json:"action"`
+	Status      string        `json:"status"`
+	Total       int32         `json:"total"`
+	Processed   int32         `json:"processed"`
+	Failed      int32         `json:"failed"`
+	Failures    string        `json:"failures"`
+	Error       string        `json:"error"`
+	CreatedAt   int64         `json:"created_at"`
+	CompletedAt sql.NullInt64 `json:"completed_at"`
+}
+
+type ToolAuditLog struct {
+	ID         string         `json:"id"`
+	ToolCallID string         `json:"tool_call_id"`
+	SessionID  string         `json:"session_id"`
+	ProjectID  string         `json:"project_id"`
+	UserID     sql.NullString `json:"user_id"`
+	MessageID  string         `json:"message_id"`
+	ToolName   string         `json:"tool_name"`
+	ParamsHash string         `json:"params_hash"`
+	Permission string         `json:"permission"`
+	DurationMs int64          `json:"duration_ms"`
+	ResultSize int64          `json:"result_size"`
+	IsError    bool           `json:"is_error"`
+	Error      string         `json:"error"`
+	CreatedAt  int64          `json:"created_at"`
 }
 
 type ToolCall struct {
@@ -91,6 +372,89 @@ type ToolCall struct {
 	PermissionPath        sql.NullString `json:"permission_path"`
 }
 
+type ToolUsageRollup struct {
+	Day        int64  `json:"day"`
+	UserID     string `json:"user_id"`
+	ProjectID  string `json:"project_id"`
+	ToolName   string `json:"tool_name"`
+	Calls      int32  `json:"calls"`
+	Errors     int32  `json:"errors"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type TurnStep struct {
+	MessageID           string  `json:"message_id"`
+	TimelineID          string  `json:"timeline_id"`
+	SessionID           string  `json:"session_id"`
+	StepIndex           int32   `json:"step_index"`
+	StartedAt           int64   `json:"started_at"`
+	PrepareMs           int64   `json:"prepare_ms"`
+	MessageCount        int32   `json:"message_count"`
+	QueuedPrompts       int32   `json:"queued_prompts"`
+	CompactedResults    int32   `json:"compacted_results"`
+	LoopNudge           bool    `json:"loop_nudge"`
+	Provider            string  `json:"provider"`
+	Model               string  `json:"model"`
+	FirstTokenMs        int64   `json:"first_token_ms"`
+	ModelMs             int64   `json:"model_ms"`
+	FinishReason        string  `json:"finish_reason"`
+	ToolCalls           string  `json:"tool_calls"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	Cost                float64 `json:"cost"`
+	CreatedAt           int64   `json:"created_at"`
+}
+
+type TurnTimeline struct {
+	ID            string `json:"id"`
+	SessionID     string `json:"session_id"`
+	StartedAt     int64  `json:"started_at"`
+	TotalMs       int64  `json:"total_ms"`
+	ModelMs       int64  `json:"model_ms"`
+	ToolMs        int64  `json:"tool_ms"`
+	DbMs          int64  `json:"db_ms"`
+	StepCount     int32  `json:"step_count"`
+	ToolCallCount int32  `json:"tool_call_count"`
+	Steps         string `json:"steps"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+type TurnTimelineMessage struct {
+	MessageID  string `json:"message_id"`
+	TimelineID string `json:"timeline_id"`
+}
+
+type Upload struct {
+	ID          string        `json:"id"`
+	UserID      string        `json:"user_id"`
+	Filename    string        `json:"filename"`
+	MimeType    string        `json:"mime_type"`
+	Size        int64         `json:"size"`
+	ChunkSize   int64         `json:"chunk_size"`
+	Received    int64         `json:"received"`
+	Status      string        `json:"status"`
+	ObjectName  string        `json:"object_name"`
+	CreatedAt   int64         `json:"created_at"`
+	UpdatedAt   int64         `json:"updated_at"`
+	CompletedAt sql.NullInt64 `json:"completed_at"`
+}
+
+type UsageRollup struct {
+	Day                 int64   `json:"day"`
+	UserID              string  `json:"user_id"`
+	ProjectID           string  `json:"project_id"`
+	Provider            string  `json:"provider"`
+	Model               string  `json:"model"`
+	Requests            int32   `json:"requests"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	Cost                float64 `json:"cost"`
+}
+
 type User struct {
 	ID           string         `json:"id"`
 	Username     string         `json:"username"`
@@ -100,3 +464,14 @@ type User struct {
 	CreatedAt    int64          `json:"created_at"`
 	UpdatedAt    int64          `json:"updated_at"`
 }
+
+type WorkspaceSnapshot struct {
+	ID         string `json:"id"`
+	ProjectID  string `json:"project_id"`
+	SessionID  string `json:"session_id"`
+	Reason     string `json:"reason"`
+	ObjectName string `json:"object_name"`
+	Size       int64  `json:"size"`
+	CreatedBy  string `json:"created_by"`
+	CreatedAt  int64  `json:"created_at"`
+}
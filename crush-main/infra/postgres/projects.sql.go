@@ -39,7 +39,7 @@ INSERT INTO projects (
     EXTRACT(EPOCH FROM NOW()) * 1000,
     EXTRACT(EPOCH FROM NOW()) * 1000
 )
-RETURNING id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain
+RETURNING id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain, system_prompt, permission_timeout, retention_days, cpu_limit, memory_limit_mb, disk_limit_mb
 `
 
 type CreateProjectParams struct {
@@ -112,6 +112,12 @@ func (q *Queries) CreateProject(ctx context.Context, arg CreateProjectParams) (P
 		&i.BackendCommand,
 		&i.BackendLanguage,
 		&i.Subdomain,
+		&i.SystemPrompt,
+		&i.PermissionTimeout,
+		&i.RetentionDays,
+		&i.CpuLimit,
+		&i.MemoryLimitMb,
+		&i.DiskLimitMb,
 	)
 	return i, err
 }
@@ -127,7 +133,7 @@ func (q *Queries) DeleteProject(ctx context.Context, id string) error {
 }
 
 const getProjectByID = `-- name: GetProjectByID :one
-SELECT id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain
+SELECT id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain, system_prompt, permission_timeout, retention_days, cpu_limit, memory_limit_mb, disk_limit_mb
 FROM projects
 WHERE id = $1 LIMIT 1
 `
@@ -158,6 +164,12 @@ func (q *Queries) GetProjectByID(ctx context.Context, id string) (Project, error
 		&i.BackendCommand,
 		&i.BackendLanguage,
 		&i.Subdomain,
+		&i.SystemPrompt,
+		&i.PermissionTimeout,
+		&i.RetentionDays,
+		&i.CpuLimit,
+		&i.MemoryLimitMb,
+		&i.DiskLimitMb,
 	)
 	return i, err
 }
@@ -167,6 +179,7 @@ SELECT s.id, s.parent_session_id, s.title, s.message_count, s.prompt_tokens, s.c
 FROM sessions s
 WHERE s.project_id = $1
 AND s.parent_session_id IS NULL
+AND s.deleted_at IS NULL
 ORDER BY s.created_at DESC
 `
 
@@ -206,7 +219,7 @@ func (q *Queries) GetProjectSessions(ctx context.Context, projectID sql.NullStri
 }
 
 const listProjectsByUser = `-- name: ListProjectsByUser :many
-SELECT id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain
+SELECT id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain, system_prompt, permission_timeout, retention_days, cpu_limit, memory_limit_mb, disk_limit_mb
 FROM projects
 WHERE user_id = $1
 ORDER BY updated_at DESC
@@ -244,6 +257,70 @@ func (q *Queries) ListProjectsByUser(ctx context.Context, userID string) ([]Proj
 			&i.BackendCommand,
 			&i.BackendLanguage,
 			&i.Subdomain,
+			&i.SystemPrompt,
+			&i.PermissionTimeout,
+			&i.RetentionDays,
+			&i.CpuLimit,
+			&i.MemoryLimitMb,
+			&i.DiskLimitMb,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProjects = `-- name: ListProjects :many
+SELECT id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain, system_prompt, permission_timeout, retention_days, cpu_limit, memory_limit_mb, disk_limit_mb
+FROM projects
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListProjects(ctx context.Context) ([]Project, error) {
+	rows, err := q.db.QueryContext(ctx, listProjects)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Project{}
+	for rows.Next() {
+		var i Project
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.Description,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExternalIP,
+			&i.FrontendPort,
+			&i.WorkspacePath,
+			&i.ContainerName,
+			&i.WorkdirPath,
+			&i.DbHost,
+			&i.DbPort,
+			&i.DbUser,
+			&i.DbPassword,
+			&i.DbName,
+			&i.BackendPort,
+			&i.FrontendCommand,
+			&i.FrontendLanguage,
+			&i.BackendCommand,
+			&i.BackendLanguage,
+			&i.Subdomain,
+			&i.SystemPrompt,
+			&i.PermissionTimeout,
+			&i.RetentionDays,
+			&i.CpuLimit,
+			&i.MemoryLimitMb,
+			&i.DiskLimitMb,
 		); err != nil {
 			return nil, err
 		}
@@ -279,31 +356,43 @@ SET
     backend_command = $17,
     backend_language = $18,
     subdomain = $19,
+    system_prompt = $20,
+    permission_timeout = $21,
+    retention_days = $22,
+    cpu_limit = $23,
+    memory_limit_mb = $24,
+    disk_limit_mb = $25,
     updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
 WHERE id = $1
-RETURNING id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain
+RETURNING id, user_id, name, description, created_at, updated_at, external_ip, frontend_port, workspace_path, container_name, workdir_path, db_host, db_port, db_user, db_password, db_name, backend_port, frontend_command, frontend_language, backend_command, backend_language, subdomain, system_prompt, permission_timeout, retention_days, cpu_limit, memory_limit_mb, disk_limit_mb
 `
 
 type UpdateProjectParams struct {
-	ID               string         `json:"id"`
-	Name             string         `json:"name"`
-	Description      sql.NullString `json:"description"`
-	ExternalIP       string         `json:"external_ip"`
-	FrontendPort     int32          `json:"frontend_port"`
-	WorkspacePath    string         `json:"workspace_path"`
-	ContainerName    sql.NullString `json:"container_name"`
-	WorkdirPath      sql.NullString `json:"workdir_path"`
-	DbHost           sql.NullString `json:"db_host"`
-	DbPort           sql.NullInt32  `json:"db_port"`
-	DbUser           sql.NullString `json:"db_user"`
-	DbPassword       sql.NullString `json:"db_password"`
-	DbName           sql.NullString `json:"db_name"`
-	BackendPort      sql.NullInt32  `json:"backend_port"`
-	FrontendCommand  sql.NullString `json:"frontend_command"`
-	FrontendLanguage sql.NullString `json:"frontend_language"`
-	BackendCommand   sql.NullString `json:"backend_command"`
-	BackendLanguage  sql.NullString `json:"backend_language"`
-	Subdomain        sql.NullString `json:"subdomain"`
+	ID                string         `json:"id"`
+	Name              string         `json:"name"`
+	Description       sql.NullString `json:"description"`
+	ExternalIP        string         `json:"external_ip"`
+	FrontendPort      int32          `json:"frontend_port"`
+	WorkspacePath     string         `json:"workspace_path"`
+	ContainerName     sql.NullString `json:"container_name"`
+	WorkdirPath       sql.NullString `json:"workdir_path"`
+	DbHost            sql.NullString `json:"db_host"`
+	DbPort            sql.NullInt32  `json:"db_port"`
+	DbUser            sql.NullString `json:"db_user"`
+	DbPassword        sql.NullString `json:"db_password"`
+	DbName            sql.NullString `json:"db_name"`
+	BackendPort       sql.NullInt32  `json:"backend_port"`
+	FrontendCommand   sql.NullString `json:"frontend_command"`
+	FrontendLanguage  sql.NullString `json:"frontend_language"`
+	BackendCommand    sql.NullString `json:"backend_command"`
+	BackendLanguage   sql.NullString `json:"backend_language"`
+	Subdomain         sql.NullString `json:"subdomain"`
+	SystemPrompt      string         `json:"system_prompt"`
+	PermissionTimeout int32          `json:"permission_timeout"`
+	RetentionDays     int32          `json:"retention_days"`
+	CpuLimit          float64        `json:"cpu_limit"`
+	MemoryLimitMb     int32          `json:"memory_limit_mb"`
+	DiskLimitMb       int32          `json:"disk_limit_mb"`
 }
 
 func (q *Queries) UpdateProject(ctx context.Context, arg UpdateProjectParams) (Project, error) {
@@ -327,6 +416,12 @@ func (q *Queries) UpdateProject(ctx context.Context, arg UpdateProjectParams) (P
 		arg.BackendCommand,
 		arg.BackendLanguage,
 		arg.Subdomain,
+		arg.SystemPrompt,
+		arg.PermissionTimeout,
+		arg.RetentionDays,
+		arg.CpuLimit,
+		arg.MemoryLimitMb,
+		arg.DiskLimitMb,
 	)
 	var i Project
 	err := row.Scan(
@@ -352,6 +447,859 @@ func (q *Queries) UpdateProject(ctx context.Context, arg UpdateProjectParams) (P
 		&i.BackendCommand,
 		&i.BackendLanguage,
 		&i.Subdomain,
+		&i.SystemPrompt,
+		&i.PermissionTimeout,
+		&i.RetentionDays,
+		&i.CpuLimit,
+		&i.MemoryLimitMb,
+		&i.DiskLimitMb,
+	)
+	return i, err
+}
+
+const upsertProjectPause = `-- name: UpsertProjectPause :one
+INSERT INTO project_pauses (
+    project_id,
+    reason,
+    mode,
+    drain,
+    paused_by,
+    paused_at,
+    resume_at
+) VALUES (
+    $1, $2, $3, $4, $5, EXTRACT(EPOCH FROM NOW()) * 1000, $6
+)
+ON CONFLICT (project_id) DO UPDATE SET
+    reason = EXCLUDED.reason,
+    mode = EXCLUDED.mode,
+    drain = EXCLUDED.drain,
+    paused_by = EXCLUDED.paused_by,
+    paused_at = EXCLUDED.paused_at,
+    resume_at = EXCLUDED.resume_at
+RETURNING project_id, reason, mode, drain, paused_by, paused_at, resume_at
+`
+
+type UpsertProjectPauseParams struct {
+	ProjectID string         `json:"project_id"`
+	Reason    string         `json:"reason"`
+	Mode      string         `json:"mode"`
+	Drain     bool           `json:"drain"`
+	PausedBy  sql.NullString `json:"paused_by"`
+	ResumeAt  sql.NullInt64  `json:"resume_at"`
+}
+
+func (q *Queries) UpsertProjectPause(ctx context.Context, arg UpsertProjectPauseParams) (ProjectPause, error) {
+	row := q.db.QueryRowContext(ctx, upsertProjectPause,
+		arg.ProjectID,
+		arg.Reason,
+		arg.Mode,
+		arg.Drain,
+		arg.PausedBy,
+		arg.ResumeAt,
+	)
+	var i ProjectPause
+	err := row.Scan(
+		&i.ProjectID,
+		&i.Reason,
+		&i.Mode,
+		&i.Drain,
+		&i.PausedBy,
+		&i.PausedAt,
+		&i.ResumeAt,
+	)
+	return i, err
+}
+
+const getProjectPause = `-- name: GetProjectPause :one
+SELECT project_id, reason, mode, drain, paused_by, paused_at, resume_at FROM project_pauses
+WHERE project_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetProjectPause(ctx context.Context, projectID string) (ProjectPause, error) {
+	row := q.db.QueryRowContext(ctx, getProjectPause, projectID)
+	var i ProjectPause
+	err := row.Scan(
+		&i.ProjectID,
+		&i.Reason,
+		&i.Mode,
+		&i.Drain,
+		&i.PausedBy,
+		&i.PausedAt,
+		&i.ResumeAt,
+	)
+	return i, err
+}
+
+const deleteProjectPause = `-- name: DeleteProjectPause :exec
+DELETE FROM project_pauses
+WHERE project_id = $1
+`
+
+func (q *Queries) DeleteProjectPause(ctx context.Context, projectID string) error {
+	_, err := q.db.ExecContext(ctx, deleteProjectPause, projectID)
+	return err
+}
+
+const upsertProjectWebhook = `-- name: UpsertProjectWebhook :one
+INSERT INTO project_webhooks (
+    project_id,
+    secret,
+    events,
+    prompt_template,
+    post_comment,
+    scm_token,
+    enabled,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (project_id) DO UPDATE SET
+    secret = EXCLUDED.secret,
+    events = EXCLUDED.events,
+    prompt_template = EXCLUDED.prompt_template,
+    post_comment = EXCLUDED.post_comment,
+    scm_token = EXCLUDED.scm_token,
+    enabled = EXCLUDED.enabled,
+    updated_at = EXCLUDED.updated_at
+RETURNING project_id, secret, events, prompt_template, post_comment, scm_token, enabled, created_at, updated_at
+`
+
+type UpsertProjectWebhookParams struct {
+	ProjectID      string `json:"project_id"`
+	Secret         string `json:"secret"`
+	Events         string `json:"events"`
+	PromptTemplate string `json:"prompt_template"`
+	PostComment    bool   `json:"post_comment"`
+	ScmToken       string `json:"scm_token"`
+	Enabled        bool   `json:"enabled"`
+}
+
+func (q *Queries) UpsertProjectWebhook(ctx context.Context, arg UpsertProjectWebhookParams) (ProjectWebhook, error) {
+	row := q.db.QueryRowContext(ctx, upsertProjectWebhook,
+		arg.ProjectID,
+		arg.Secret,
+		arg.Events,
+		arg.PromptTemplate,
+		arg.PostComment,
+		arg.ScmToken,
+		arg.Enabled,
+	)
+	var i ProjectWebhook
+	err := row.Scan(
+		&i.ProjectID,
+		&i.Secret,
+		&i.Events,
+		&i.PromptTemplate,
+		&i.PostComment,
+		&i.ScmToken,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getProjectWebhook = `-- name: GetProjectWebhook :one
+SELECT project_id, secret, events, prompt_template, post_comment, scm_token, enabled, created_at, updated_at FROM project_webhooks
+WHERE project_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetProjectWebhook(ctx context.Context, projectID string) (ProjectWebhook, error) {
+	row := q.db.QueryRowContext(ctx, getProjectWebhook, projectID)
+	var i ProjectWebhook
+	err := row.Scan(
+		&i.ProjectID,
+		&i.Secret,
+		&i.Events,
+		&i.PromptTemplate,
+		&i.PostComment,
+		&i.ScmToken,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteProjectWebhook = `-- name: DeleteProjectWebhook :exec
+DELETE FROM project_webhooks
+WHERE project_id = $1
+`
+
+func (q *Queries) DeleteProjectWebhook(ctx context.Context, projectID string) error {
+	_, err := q.db.ExecContext(ctx, deleteProjectWebhook, projectID)
+	return err
+}
+
+const createProjectChatHook = `-- name: CreateProjectChatHook :one
+INSERT INTO project_chat_hooks (
+    id,
+    project_id,
+    platform,
+    webhook_url,
+    template,
+    events,
+    enabled,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING id, project_id, platform, webhook_url, template, events, enabled, created_at, updated_at
+`
+
+type CreateProjectChatHookParams struct {
+	ID         string `json:"id"`
+	ProjectID  string `json:"project_id"`
+	Platform   string `json:"platform"`
+	WebhookUrl string `json:"webhook_url"`
+	Template   string `json:"template"`
+	Events     string `json:"events"`
+	Enabled    bool   `json:"enabled"`
+}
+
+func (q *Queries) CreateProjectChatHook(ctx context.Context, arg CreateProjectChatHookParams) (ProjectChatHook, error) {
+	row := q.db.QueryRowContext(ctx, createProjectChatHook,
+		arg.ID,
+		arg.ProjectID,
+		arg.Platform,
+		arg.WebhookUrl,
+		arg.Template,
+		arg.Events,
+		arg.Enabled,
+	)
+	var i ProjectChatHook
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Platform,
+		&i.WebhookUrl,
+		&i.Template,
+		&i.Events,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getProjectChatHook = `-- name: GetProjectChatHook :one
+SELECT id, project_id, platform, webhook_url, template, events, enabled, created_at, updated_at FROM project_chat_hooks
+WHERE id = $1 AND project_id = $2 LIMIT 1
+`
+
+type GetProjectChatHookParams struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+}
+
+func (q *Queries) GetProjectChatHook(ctx context.Context, arg GetProjectChatHookParams) (ProjectChatHook, error) {
+	row := q.db.QueryRowContext(ctx, getProjectChatHook, arg.ID, arg.ProjectID)
+	var i ProjectChatHook
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Platform,
+		&i.WebhookUrl,
+		&i.Template,
+		&i.Events,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listProjectChatHooks = `-- name: ListProjectChatHooks :many
+SELECT id, project_id, platform, webhook_url, template, events, enabled, created_at, updated_at FROM project_chat_hooks
+WHERE project_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListProjectChatHooks(ctx context.Context, projectID string) ([]ProjectChatHook, error) {
+	rows, err := q.db.QueryContext(ctx, listProjectChatHooks, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ProjectChatHook{}
+	for rows.Next() {
+		var i ProjectChatHook
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.Platform,
+			&i.WebhookUrl,
+			&i.Template,
+			&i.Events,
+			&i.Enabled,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateProjectChatHook = `-- name: UpdateProjectChatHook :one
+UPDATE project_chat_hooks
+SET
+    platform = $3,
+    webhook_url = $4,
+    template = $5,
+    events = $6,
+    enabled = $7,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1 AND project_id = $2
+RETURNING id, project_id, platform, webhook_url, template, events, enabled, created_at, updated_at
+`
+
+type UpdateProjectChatHookParams struct {
+	ID         string `json:"id"`
+	ProjectID  string `json:"project_id"`
+	Platform   string `json:"platform"`
+	WebhookUrl string `json:"webhook_url"`
+	Template   string `json:"template"`
+	Events     string `json:"events"`
+	Enabled    bool   `json:"enabled"`
+}
+
+func (q *Queries) UpdateProjectChatHook(ctx context.Context, arg UpdateProjectChatHookParams) (ProjectChatHook, error) {
+	row := q.db.QueryRowContext(ctx, updateProjectChatHook,
+		arg.ID,
+		arg.ProjectID,
+		arg.Platform,
+		arg.WebhookUrl,
+		arg.Template,
+		arg.Events,
+		arg.Enabled,
+	)
+	var i ProjectChatHook
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Platform,
+		&i.WebhookUrl,
+		&i.Template,
+		&i.Events,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteProjectChatHook = `-- name: DeleteProjectChatHook :exec
+DELETE FROM project_chat_hooks
+WHERE id = $1 AND project_id = $2
+`
+
+type DeleteProjectChatHookParams struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+}
+
+func (q *Queries) DeleteProjectChatHook(ctx context.Context, arg DeleteProjectChatHookParams) error {
+	_, err := q.db.ExecContext(ctx, deleteProjectChatHook, arg.ID, arg.ProjectID)
+	return err
+}
+
+const upsertProjectPermissionPolicy = `-- name: UpsertProjectPermissionPolicy :one
+INSERT INTO project_permission_policies (
+    project_id,
+    rules,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (project_id) DO UPDATE SET
+    rules = EXCLUDED.rules,
+    updated_at = EXCLUDED.updated_at
+RETURNING project_id, rules, created_at, updated_at, shadow_rules, shadow_started_at, shadow_until
+`
+
+type UpsertProjectPermissionPolicyParams struct {
+	ProjectID string `json:"project_id"`
+	Rules     string `json:"rules"`
+}
+
+func (q *Queries) UpsertProjectPermissionPolicy(ctx context.Context, arg UpsertProjectPermissionPolicyParams) (ProjectPermissionPolicy, error) {
+	row := q.db.QueryRowContext(ctx, upsertProjectPermissionPolicy, arg.ProjectID, arg.Rules)
+	var i ProjectPermissionPolicy
+	err := row.Scan(
+		&i.ProjectID,
+		&i.Rules,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ShadowRules,
+		&i.ShadowStartedAt,
+		&i.ShadowUntil,
+	)
+	return i, err
+}
+
+const getProjectPermissionPolicy = `-- name: GetProjectPermissionPolicy :one
+SELECT project_id, rules, created_at, updated_at, shadow_rules, shadow_started_at, shadow_until FROM project_permission_policies
+WHERE project_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetProjectPermissionPolicy(ctx context.Context, projectID string) (ProjectPermissionPolicy, error) {
+	row := q.db.QueryRowContext(ctx, getProjectPermissionPolicy, projectID)
+	var i ProjectPermissionPolicy
+	err := row.Scan(
+		&i.ProjectID,
+		&i.Rules,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ShadowRules,
+		&i.ShadowStartedAt,
+		&i.ShadowUntil,
+	)
+	return i, err
+}
+
+const createSessionBlueprint = `-- name: CreateSessionBlueprint :one
+INSERT INTO session_blueprints (
+    id,
+    project_id,
+    name,
+    description,
+    pinned_context,
+    model_config,
+    allowed_tools,
+    prompts,
+    agent,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING id, project_id, name, description, pinned_context, model_config, allowed_tools, prompts, agent, created_at, updated_at
+`
+
+type CreateSessionBlueprintParams struct {
+	ID            string `json:"id"`
+	ProjectID     string `json:"project_id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	PinnedContext string `json:"pinned_context"`
+	ModelConfig   string `json:"model_config"`
+	AllowedTools  string `json:"allowed_tools"`
+	Prompts       string `json:"prompts"`
+	Agent         string `json:"agent"`
+}
+
+func (q *Queries) CreateSessionBlueprint(ctx context.Context, arg CreateSessionBlueprintParams) (SessionBlueprint, error) {
+	row := q.db.QueryRowContext(ctx, createSessionBlueprint,
+		arg.ID,
+		arg.ProjectID,
+		arg.Name,
+		arg.Description,
+		arg.PinnedContext,
+		arg.ModelConfig,
+		arg.AllowedTools,
+		arg.Prompts,
+		arg.Agent,
+	)
+	var i SessionBlueprint
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Name,
+		&i.Description,
+		&i.PinnedContext,
+		&i.ModelConfig,
+		&i.AllowedTools,
+		&i.Prompts,
+		&i.Agent,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getSessionBlueprint = `-- name: GetSessionBlueprint :one
+SELECT id, project_id, name, description, pinned_context, model_config, allowed_tools, prompts, agent, created_at, updated_at FROM session_blueprints
+WHERE id = $1 AND project_id = $2 LIMIT 1
+`
+
+type GetSessionBlueprintParams struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+}
+
+func (q *Queries) GetSessionBlueprint(ctx context.Context, arg GetSessionBlueprintParams) (SessionBlueprint, error) {
+	row := q.db.QueryRowContext(ctx, getSessionBlueprint, arg.ID, arg.ProjectID)
+	var i SessionBlueprint
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Name,
+		&i.Description,
+		&i.PinnedContext,
+		&i.ModelConfig,
+		&i.AllowedTools,
+		&i.Prompts,
+		&i.Agent,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getSessionBlueprintByName = `-- name: GetSessionBlueprintByName :one
+SELECT id, project_id, name, description, pinned_context, model_config, allowed_tools, prompts, agent, created_at, updated_at FROM session_blueprints
+WHERE project_id = $1 AND name = $2 LIMIT 1
+`
+
+type GetSessionBlueprintByNameParams struct {
+	ProjectID string `json:"project_id"`
+	Name      string `json:"name"`
+}
+
+func (q *Queries) GetSessionBlueprintByName(ctx context.Context, arg GetSessionBlueprintByNameParams) (SessionBlueprint, error) {
+	row := q.db.QueryRowContext(ctx, getSessionBlueprintByName, arg.ProjectID, arg.Name)
+	var i SessionBlueprint
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Name,
+		&i.Description,
+		&i.PinnedContext,
+		&i.ModelConfig,
+		&i.AllowedTools,
+		&i.Prompts,
+		&i.Agent,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listSessionBlueprints = `-- name: ListSessionBlueprints :many
+SELECT id, project_id, name, description, pinned_context, model_config, allowed_tools, prompts, agent, created_at, updated_at FROM session_blueprints
+WHERE project_id = $1
+ORDER BY name ASC
+`
+
+func (q *Queries) ListSessionBlueprints(ctx context.Context, projectID string) ([]SessionBlueprint, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionBlueprints, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SessionBlueprint{}
+	for rows.Next() {
+		var i SessionBlueprint
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.Name,
+			&i.Description,
+			&i.PinnedContext,
+			&i.ModelConfig,
+			&i.AllowedTools,
+			&i.Prompts,
+			&i.Agent,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateSessionBlueprint = `-- name: UpdateSessionBlueprint :one
+UPDATE session_blueprints
+SET
+    name = $3,
+    description = $4,
+    pinned_context = $5,
+    model_config = $6,
+    allowed_tools = $7,
+    prompts = $8,
+    agent = $9,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1 AND project_id = $2
+RETURNING id, project_id, name, description, pinned_context, model_config, allowed_tools, prompts, agent, created_at, updated_at
+`
+
+type UpdateSessionBlueprintParams struct {
+	ID            string `json:"id"`
+	ProjectID     string `json:"project_id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	PinnedContext string `json:"pinned_context"`
+	ModelConfig   string `json:"model_config"`
+	AllowedTools  string `json:"allowed_tools"`
+	Prompts       string `json:"prompts"`
+	Agent         string `json:"agent"`
+}
+
+func (q *Queries) UpdateSessionBlueprint(ctx context.Context, arg UpdateSessionBlueprintParams) (SessionBlueprint, error) {
+	row := q.db.QueryRowContext(ctx, updateSessionBlueprint,
+		arg.ID,
+		arg.ProjectID,
+		arg.Name,
+		arg.Description,
+		arg.PinnedContext,
+		arg.ModelConfig,
+		arg.AllowedTools,
+		arg.Prompts,
+		arg.Agent,
+	)
+	var i SessionBlueprint
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Name,
+		&i.Description,
+		&i.PinnedContext,
+		&i.ModelConfig,
+		&i.AllowedTools,
+		&i.Prompts,
+		&i.Agent,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteSessionBlueprint = `-- name: DeleteSessionBlueprint :exec
+DELETE FROM session_blueprints
+WHERE id = $1 AND project_id = $2
+`
+
+type DeleteSessionBlueprintParams struct {
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+}
+
+func (q *Queries) DeleteSessionBlueprint(ctx context.Context, arg DeleteSessionBlueprintParams) error {
+	_, err := q.db.ExecContext(ctx, deleteSessionBlueprint, arg.ID, arg.ProjectID)
+	return err
+}
+
+const startProjectShadowPolicy = `-- name: StartProjectShadowPolicy :one
+INSERT INTO project_permission_policies (
+    project_id,
+    rules,
+    shadow_rules,
+    shadow_started_at,
+    shadow_until,
+    created_at,
+    updated_at
+) VALUES (
+    $1, '[]', $2,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    $3,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (project_id) DO UPDATE SET
+    shadow_rules = EXCLUDED.shadow_rules,
+    shadow_started_at = EXCLUDED.shadow_started_at,
+    shadow_until = EXCLUDED.shadow_until,
+    updated_at = EXCLUDED.updated_at
+RETURNING project_id, rules, created_at, updated_at, shadow_rules, shadow_started_at, shadow_until
+`
+
+type StartProjectShadowPolicyParams struct {
+	ProjectID   string         `json:"project_id"`
+	ShadowRules sql.NullString `json:"shadow_rules"`
+	ShadowUntil sql.NullInt64  `json:"shadow_until"`
+}
+
+func (q *Queries) StartProjectShadowPolicy(ctx context.Context, arg StartProjectShadowPolicyParams) (ProjectPermissionPolicy, error) {
+	row := q.db.QueryRowContext(ctx, startProjectShadowPolicy, arg.ProjectID, arg.ShadowRules, arg.ShadowUntil)
+	var i ProjectPermissionPolicy
+	err := row.Scan(
+		&i.ProjectID,
+		&i.Rules,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ShadowRules,
+		&i.ShadowStartedAt,
+		&i.ShadowUntil,
 	)
 	return i, err
 }
+
+const stopProjectShadowPolicy = `-- name: StopProjectShadowPolicy :exec
+UPDATE project_permission_policies
+SET
+    shadow_rules = NULL,
+    shadow_started_at = NULL,
+    shadow_until = NULL,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE project_id = $1
+`
+
+func (q *Queries) StopProjectShadowPolicy(ctx context.Context, projectID string) error {
+	_, err := q.db.ExecContext(ctx, stopProjectShadowPolicy, projectID)
+	return err
+}
+
+const createPermissionShadowDecision = `-- name: CreatePermissionShadowDecision :exec
+INSERT INTO permission_shadow_decisions (
+    id,
+    project_id,
+    session_id,
+    tool_name,
+    subject,
+    actual,
+    shadow,
+    actual_rule,
+    shadow_rule,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+`
+
+type CreatePermissionShadowDecisionParams struct {
+	ID         string `json:"id"`
+	ProjectID  string `json:"project_id"`
+	SessionID  string `json:"session_id"`
+	ToolName   string `json:"tool_name"`
+	Subject    string `json:"subject"`
+	Actual     string `json:"actual"`
+	Shadow     string `json:"shadow"`
+	ActualRule string `json:"actual_rule"`
+	ShadowRule string `json:"shadow_rule"`
+}
+
+func (q *Queries) CreatePermissionShadowDecision(ctx context.Context, arg CreatePermissionShadowDecisionParams) error {
+	_, err := q.db.ExecContext(ctx, createPermissionShadowDecision,
+		arg.ID,
+		arg.ProjectID,
+		arg.SessionID,
+		arg.ToolName,
+		arg.Subject,
+		arg.Actual,
+		arg.Shadow,
+		arg.ActualRule,
+		arg.ShadowRule,
+	)
+	return err
+}
+
+const deleteProjectShadowDecisions = `-- name: DeleteProjectShadowDecisions :exec
+DELETE FROM permission_shadow_decisions
+WHERE project_id = $1
+`
+
+func (q *Queries) DeleteProjectShadowDecisions(ctx context.Context, projectID string) error {
+	_, err := q.db.ExecContext(ctx, deleteProjectShadowDecisions, projectID)
+	return err
+}
+
+const countProjectShadowDecisions = `-- name: CountProjectShadowDecisions :many
+SELECT actual, shadow, COUNT(*) AS count
+FROM permission_shadow_decisions
+WHERE project_id = $1
+GROUP BY actual, shadow
+ORDER BY actual, shadow
+`
+
+type CountProjectShadowDecisionsRow struct {
+	Actual string `json:"actual"`
+	Shadow string `json:"shadow"`
+	Count  int64  `json:"count"`
+}
+
+func (q *Queries) CountProjectShadowDecisions(ctx context.Context, projectID string) ([]CountProjectShadowDecisionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countProjectShadowDecisions, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountProjectShadowDecisionsRow{}
+	for rows.Next() {
+		var i CountProjectShadowDecisionsRow
+		if err := rows.Scan(&i.Actual, &i.Shadow, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProjectShadowMismatches = `-- name: ListProjectShadowMismatches :many
+SELECT id, project_id, session_id, tool_name, subject, actual, shadow, actual_rule, shadow_rule, created_at FROM permission_shadow_decisions
+WHERE project_id = $1 AND actual <> shadow
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type ListProjectShadowMismatchesParams struct {
+	ProjectID string `json:"project_id"`
+	Limit     int32  `json:"limit"`
+}
+
+func (q *Queries) ListProjectShadowMismatches(ctx context.Context, arg ListProjectShadowMismatchesParams) ([]PermissionShadowDecision, error) {
+	rows, err := q.db.QueryContext(ctx, listProjectShadowMismatches, arg.ProjectID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PermissionShadowDecision{}
+	for rows.Next() {
+		var i PermissionShadowDecision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.SessionID,
+			&i.ToolName,
+			&i.Subject,
+			&i.Actual,
+			&i.Shadow,
+			&i.ActualRule,
+			&i.ShadowRule,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
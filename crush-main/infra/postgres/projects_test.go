@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	return &fakeRows{columns: selectedColumns(query), rows: c.db.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// selectedColumns returns the columns of the SELECT in query.
+func selectedColumns(query string) []string {
+	_, list, _ := strings.Cut(query, "SELECT ")
+	list, _, _ = strings.Cut(list, "\nFROM")
+	return strings.Split(list, ", ")
+}
+
+// projectRow returns a projects row in the column order of the queries.
+func projectRow(id string) []driver.Value {
+	return []driver.Value{
+		id, "u1", "demo", "a demo", int64(1), int64(2), "10.0.0.1", int64(3000), "/workspace",
+		"crush-demo", nil, nil, nil, nil, nil, nil, int64(8080), "npm run dev", "typescript",
+		nil, nil, "demo", "be brief", int64(60), int64(30), 1.5, int64(2048), int64(10240),
+	}
+}
+
+func TestListProjectsScansEveryColumn(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeDB{rows: [][]driver.Value{projectRow("p1"), projectRow("p2")}}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	q := New(db)
+
+	require.Len(t, selectedColumns(listProjects), len(projectRow("p1")))
+	for name, list := range map[string]func() ([]Project, error){
+		"all":     func() ([]Project, error) { return q.ListProjects(t.Context()) },
+		"by user": func() ([]Project, error) { return q.ListProjectsByUser(t.Context(), "u1") },
+	} {
+		fake.mu.Lock()
+		fake.rows = [][]driver.Value{projectRow("p1"), projectRow("p2")}
+		fake.mu.Unlock()
+
+		projects, err := list()
+		require.NoError(t, err, name)
+		require.Len(t, projects, 2, name)
+		p := projects[1]
+		require.Equal(t, "p2", p.ID, name)
+		require.Equal(t, sql.NullString{String: "a demo", Valid: true}, p.Description, name)
+		require.False(t, p.DbPort.Valid, name)
+		require.Equal(t, sql.NullInt32{Int32: 8080, Valid: true}, p.BackendPort, name)
+		require.Equal(t, int32(30), p.RetentionDays, name)
+		require.Equal(t, 1.5, p.CpuLimit, name)
+		require.Equal(t, int32(2048), p.MemoryLimitMb, name)
+		require.Equal(t, int32(10240), p.DiskLimitMb, name)
+	}
+}
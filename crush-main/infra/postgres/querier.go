@@ -24,6 +24,7 @@ type Querier interface {
 	DeleteUser(ctx context.Context, id string) error
 	GetFile(ctx context.Context, id string) (File, error)
 	GetFileByPathAndSession(ctx context.Context, arg GetFileByPathAndSessionParams) (File, error)
+	GetLatestProjectFileChange(ctx context.Context, projectID sql.NullString) (GetLatestProjectFileChangeRow, error)
 	GetMessage(ctx context.Context, id string) (Message, error)
 	GetProjectByID(ctx context.Context, id string) (Project, error)
 	GetProjectSessions(ctx context.Context, projectID sql.NullString) ([]Session, error)
@@ -35,8 +36,12 @@ type Querier interface {
 	ListFilesBySession(ctx context.Context, sessionID string) ([]File, error)
 	ListLatestSessionFiles(ctx context.Context, sessionID string) ([]File, error)
 	ListMessagesBySession(ctx context.Context, sessionID string) ([]Message, error)
+	ListSessionMessagesAfter(ctx context.Context, arg ListSessionMessagesAfterParams) ([]Message, error)
+	ListSessionMessagesBefore(ctx context.Context, arg ListSessionMessagesBeforeParams) ([]Message, error)
 	ListNewFiles(ctx context.Context) ([]File, error)
+	ListProjectFileChanges(ctx context.Context, arg ListProjectFileChangesParams) ([]ListProjectFileChangesRow, error)
 	ListProjectsByUser(ctx context.Context, userID string) ([]Project, error)
+	ListProjects(ctx context.Context) ([]Project, error)
 	ListSessions(ctx context.Context, projectID sql.NullString) ([]Session, error)
 	UpdateMessage(ctx context.Context, arg UpdateMessageParams) error
 	UpdateProject(ctx context.Context, arg UpdateProjectParams) (Project, error)
@@ -63,6 +68,175 @@ type Querier interface {
 	UpdateToolCallPermissionTimeout(ctx context.Context, id string) error
 	ListTimedOutPermissionRequests(ctx context.Context, timeoutMs int64) ([]ToolCall, error)
 	CancelAwaitingPermissionToolCalls(ctx context.Context, sessionID string) error
+	// Project maintenance windows
+	UpsertProjectPause(ctx context.Context, arg UpsertProjectPauseParams) (ProjectPause, error)
+	GetProjectPause(ctx context.Context, projectID string) (ProjectPause, error)
+	DeleteProjectPause(ctx context.Context, projectID string) error
+	// Project webhooks
+	UpsertProjectWebhook(ctx context.Context, arg UpsertProjectWebhookParams) (ProjectWebhook, error)
+	GetProjectWebhook(ctx context.Context, projectID string) (ProjectWebhook, error)
+	DeleteProjectWebhook(ctx context.Context, projectID string) error
+	// Project chat hooks
+	CreateProjectChatHook(ctx context.Context, arg CreateProjectChatHookParams) (ProjectChatHook, error)
+	GetProjectChatHook(ctx context.Context, arg GetProjectChatHookParams) (ProjectChatHook, error)
+	ListProjectChatHooks(ctx context.Context, projectID string) ([]ProjectChatHook, error)
+	UpdateProjectChatHook(ctx context.Context, arg UpdateProjectChatHookParams) (ProjectChatHook, error)
+	DeleteProjectChatHook(ctx context.Context, arg DeleteProjectChatHookParams) error
+	// Project permission policies
+	UpsertProjectPermissionPolicy(ctx context.Context, arg UpsertProjectPermissionPolicyParams) (ProjectPermissionPolicy, error)
+	GetProjectPermissionPolicy(ctx context.Context, projectID string) (ProjectPermissionPolicy, error)
+	StartProjectShadowPolicy(ctx context.Context, arg StartProjectShadowPolicyParams) (ProjectPermissionPolicy, error)
+	StopProjectShadowPolicy(ctx context.Context, projectID string) error
+	CreatePermissionShadowDecision(ctx context.Context, arg CreatePermissionShadowDecisionParams) error
+	DeleteProjectShadowDecisions(ctx context.Context, projectID string) error
+	CountProjectShadowDecisions(ctx context.Context, projectID string) ([]CountProjectShadowDecisionsRow, error)
+	ListProjectShadowMismatches(ctx context.Context, arg ListProjectShadowMismatchesParams) ([]PermissionShadowDecision, error)
+	// Session blueprints
+	CreateSessionBlueprint(ctx context.Context, arg CreateSessionBlueprintParams) (SessionBlueprint, error)
+	GetSessionBlueprint(ctx context.Context, arg GetSessionBlueprintParams) (SessionBlueprint, error)
+	GetSessionBlueprintByName(ctx context.Context, arg GetSessionBlueprintByNameParams) (SessionBlueprint, error)
+	ListSessionBlueprints(ctx context.Context, projectID string) ([]SessionBlueprint, error)
+	UpdateSessionBlueprint(ctx context.Context, arg UpdateSessionBlueprintParams) (SessionBlueprint, error)
+	DeleteSessionBlueprint(ctx context.Context, arg DeleteSessionBlueprintParams) error
+	// Project templates
+	CreateProjectTemplate(ctx context.Context, arg CreateProjectTemplateParams) (ProjectTemplate, error)
+	GetProjectTemplate(ctx context.Context, id string) (ProjectTemplate, error)
+	GetProjectTemplateByName(ctx context.Context, name string) (ProjectTemplate, error)
+	ListProjectTemplates(ctx context.Context) ([]ProjectTemplate, error)
+	UpdateProjectTemplate(ctx context.Context, arg UpdateProjectTemplateParams) (ProjectTemplate, error)
+	DeleteProjectTemplate(ctx context.Context, id string) error
+
+	// Secrets
+	UpsertSecret(ctx context.Context, arg UpsertSecretParams) (Secret, error)
+	GetSecret(ctx context.Context, arg GetSecretParams) (Secret, error)
+	ListSecrets(ctx context.Context, projectID string) ([]Secret, error)
+	ListAllSecrets(ctx context.Context) ([]Secret, error)
+	DeleteSecret(ctx context.Context, arg DeleteSecretParams) (int64, error)
+	DeleteProjectSecrets(ctx context.Context, projectID string) (int64, error)
+
+	// Project memories
+	CreateProjectMemory(ctx context.Context, arg CreateProjectMemoryParams) (ProjectMemory, error)
+	ListProjectMemories(ctx context.Context, arg ListProjectMemoriesParams) ([]ProjectMemory, error)
+	SearchProjectMemories(ctx context.Context, arg SearchProjectMemoriesParams) ([]ProjectMemory, error)
+	ListRelevantProjectMemories(ctx context.Context, arg ListRelevantProjectMemoriesParams) ([]ProjectMemory, error)
+	CountProjectMemories(ctx context.Context, projectID string) (int64, error)
+	DeleteProjectMemory(ctx context.Context, arg DeleteProjectMemoryParams) (int64, error)
+
+	// Personal access tokens
+	CreateAPIToken(ctx context.Context, arg CreateAPITokenParams) (ApiToken, error)
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (ApiToken, error)
+	ListAPITokensByUser(ctx context.Context, userID string) ([]ApiToken, error)
+	RevokeAPIToken(ctx context.Context, arg RevokeAPITokenParams) (int64, error)
+	TouchAPIToken(ctx context.Context, id string) error
+
+	// Account data exports
+	CreateDataExportJob(ctx context.Context, arg CreateDataExportJobParams) (DataExportJob, error)
+	GetDataExportJob(ctx context.Context, arg GetDataExportJobParams) (DataExportJob, error)
+	ListDataExportJobsByUser(ctx context.Context, userID string) ([]DataExportJob, error)
+	UpdateDataExportJob(ctx context.Context, arg UpdateDataExportJobParams) error
+	ListSessionsByUser(ctx context.Context, userID string) ([]Session, error)
+
+	// Bulk session actions and their jobs
+	GetUserSession(ctx context.Context, arg GetUserSessionParams) (Session, error)
+	ListSessionsForBulk(ctx context.Context, arg ListSessionsForBulkParams) ([]Session, error)
+	ListChildSessions(ctx context.Context, parentSessionID sql.NullString) ([]Session, error)
+	ArchiveSession(ctx context.Context, arg ArchiveSessionParams) error
+	SetSessionTags(ctx context.Context, arg SetSessionTagsParams) error
+	CreateSessionBulkJob(ctx context.Context, arg CreateSessionBulkJobParams) (SessionBulkJob, error)
+	GetSessionBulkJob(ctx context.Context, arg GetSessionBulkJobParams) (SessionBulkJob, error)
+	ListSessionBulkJobsByUser(ctx context.Context, userID string) ([]SessionBulkJob, error)
+	UpdateSessionBulkJob(ctx context.Context, arg UpdateSessionBulkJobParams) error
+
+	// Retention of the sessions, soft-deleted then purged
+	ListExpiredSessions(ctx context.Context, arg ListExpiredSessionsParams) ([]Session, error)
+	SoftDeleteSession(ctx context.Context, arg SoftDeleteSessionParams) error
+	ListSoftDeletedSessions(ctx context.Context, arg ListSoftDeletedSessionsParams) ([]Session, error)
+
+	// Full-text search over the messages
+	SearchMessages(ctx context.Context, arg SearchMessagesParams) ([]SearchMessagesRow, error)
+
+	// Turn timelines
+	CreateTurnTimeline(ctx context.Context, arg CreateTurnTimelineParams) error
+	AddTurnTimelineMessage(ctx context.Context, arg AddTurnTimelineMessageParams) error
+	GetTurnTimelineByMessage(ctx context.Context, messageID string) (TurnTimeline, error)
+	CreateTurnStep(ctx context.Context, arg CreateTurnStepParams) error
+	// Steps of the turn a message belongs to, in order
+	ListTurnStepsByMessage(ctx context.Context, messageID string) ([]TurnStep, error)
+
+	// Audit events
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error
+	ListAuditEventsBySession(ctx context.Context, sessionID sql.NullString) ([]AuditEvent, error)
+
+	// Metrics rollups
+	AddMetricsRollup(ctx context.Context, arg AddMetricsRollupParams) error
+	// The counts are deltas, negative when a rating is changed
+	AddFeedbackMetricsRollup(ctx context.Context, arg AddFeedbackMetricsRollupParams) error
+	GetMetricsTotals(ctx context.Context, bucket int64) (GetMetricsTotalsRow, error)
+	ListTopSessionsByCost(ctx context.Context, arg ListTopSessionsByCostParams) ([]ListTopSessionsByCostRow, error)
+	DeleteMetricsRollupsBefore(ctx context.Context, bucket int64) error
+	PingDatabase(ctx context.Context) error
+
+	// Resumable uploads
+	CreateUpload(ctx context.Context, arg CreateUploadParams) (Upload, error)
+	GetUpload(ctx context.Context, arg GetUploadParams) (Upload, error)
+	ListUploadsByUser(ctx context.Context, userID string) ([]Upload, error)
+	ListStaleUploadsByUser(ctx context.Context, arg ListStaleUploadsByUserParams) ([]Upload, error)
+	SumUploadSizeByUser(ctx context.Context, userID string) (int64, error)
+	UpdateUploadReceived(ctx context.Context, arg UpdateUploadReceivedParams) error
+	CompleteUpload(ctx context.Context, arg CompleteUploadParams) error
+	DeleteUpload(ctx context.Context, id string) error
+
+	// Budgets
+	UpsertBudget(ctx context.Context, arg UpsertBudgetParams) (Budget, error)
+	GetBudget(ctx context.Context, arg GetBudgetParams) (Budget, error)
+	DeleteBudget(ctx context.Context, arg DeleteBudgetParams) (int64, error)
+	GetSessionBudgetUsage(ctx context.Context, id string) (GetSessionBudgetUsageRow, error)
+
+	// Background jobs running in sandbox containers
+	CreateBackgroundJob(ctx context.Context, arg CreateBackgroundJobParams) (BackgroundJob, error)
+	GetBackgroundJob(ctx context.Context, id string) (BackgroundJob, error)
+	ListBackgroundJobsBySession(ctx context.Context, sessionID string) ([]BackgroundJob, error)
+	ListRunningBackgroundJobs(ctx context.Context) ([]BackgroundJob, error)
+	FinishBackgroundJob(ctx context.Context, arg FinishBackgroundJobParams) error
+
+	// Session token counters at user messages, for regenerating from them
+	CreateMessageCheckpoint(ctx context.Context, arg CreateMessageCheckpointParams) error
+	GetMessageCheckpoint(ctx context.Context, messageID string) (MessageCheckpoint, error)
+
+	// Audit log of the tool calls run by the agent
+	CreateToolAuditEntry(ctx context.Context, arg CreateToolAuditEntryParams) error
+	ListToolAuditEntries(ctx context.Context, arg ListToolAuditEntriesParams) ([]ToolAuditLog, error)
+
+	// Model usage and the daily rollups of the analytics
+	CreateModelUsage(ctx context.Context, arg CreateModelUsageParams) error
+	GetLatestUsageRollupDay(ctx context.Context) (int64, error)
+	RollupModelUsage(ctx context.Context, day int64) error
+	RollupToolUsage(ctx context.Context, day int64) error
+	RollupRuns(ctx context.Context, day int64) error
+	DeleteFeedbackRollupsSince(ctx context.Context, day int64) error
+	RollupFeedback(ctx context.Context, day int64) error
+	ListUsageRollups(ctx context.Context, arg ListUsageRollupsParams) ([]UsageRollup, error)
+	ListToolUsageRollups(ctx context.Context, arg ListToolUsageRollupsParams) ([]ToolUsageRollup, error)
+	ListRunRollups(ctx context.Context, arg ListRunRollupsParams) ([]RunRollup, error)
+	ListFeedbackRollups(ctx context.Context, arg ListFeedbackRollupsParams) ([]FeedbackRollup, error)
+	DeleteUserRollups(ctx context.Context, userID string) error
+
+	// Archives of project workspaces, for rolling back agent edits
+	CreateWorkspaceSnapshot(ctx context.Context, arg CreateWorkspaceSnapshotParams) (WorkspaceSnapshot, error)
+	GetWorkspaceSnapshot(ctx context.Context, arg GetWorkspaceSnapshotParams) (WorkspaceSnapshot, error)
+	ListWorkspaceSnapshotsByProject(ctx context.Context, projectID string) ([]WorkspaceSnapshot, error)
+	ListWorkspaceSnapshotsByUser(ctx context.Context, userID string) ([]WorkspaceSnapshot, error)
+	DeleteWorkspaceSnapshot(ctx context.Context, id string) error
+
+	// Embedded chunks of the workspace files, for semantic code search
+	CreateCodeChunk(ctx context.Context, arg CreateCodeChunkParams) error
+	DeleteCodeChunksByPath(ctx context.Context, arg DeleteCodeChunksByPathParams) error
+	ListCodeChunksByProject(ctx context.Context, projectID string) ([]CodeChunk, error)
+	ListCodeIndexFiles(ctx context.Context, projectID string) ([]ListCodeIndexFilesRow, error)
+
+	// Ratings of the agent answers
+	GetMessageFeedback(ctx context.Context, arg GetMessageFeedbackParams) (MessageFeedback, error)
+	UpsertMessageFeedback(ctx context.Context, arg UpsertMessageFeedbackParams) (MessageFeedback, error)
 }
 
 var _ Querier = (*Queries)(nil)
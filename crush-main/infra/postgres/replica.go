@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// replicaRetryAfter is how long reads stay on the primary once the replica
+// failed, before it is tried again.
+const replicaRetryAfter = 30 * time.Second
+
+// ConnectReplica opens the read replica of the database configured by its
+// read-only DSN. Without one it returns nil. Migrations are left to Connect,
+// the replica follows the primary.
+func ConnectReplica(ctx context.Context) (*sql.DB, error) {
+	cfg := config.GetGlobalAppConfig()
+	if cfg == nil || cfg.Database.ReplicaDSN == "" {
+		return nil, nil
+	}
+	dbCfg := cfg.Database
+
+	db, err := sql.Open("postgres", dbCfg.ReplicaDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replica database: %w", err)
+	}
+	db.SetMaxOpenConns(dbCfg.MaxOpenConns)
+	db.SetMaxIdleConns(dbCfg.MaxIdleConns)
+	db.SetConnMaxLifetime(0)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to replica database: %w", err)
+	}
+	slog.Info("Replica database connection configured",
+		"max_open_conns", dbCfg.MaxOpenConns,
+		"max_idle_conns", dbCfg.MaxIdleConns,
+	)
+	return db, nil
+}
+
+type replicaContextKey struct{}
+
+// WithReplica marks the queries run with ctx as allowed to read from the
+// replica, for reads that tolerate its lag such as listings, analytics and
+// exports.
+func WithReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaContextKey{}, true)
+}
+
+func replicaAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(replicaContextKey{}).(bool)
+	return allowed
+}
+
+// ReplicaRouter is a DBTX sending the multi-row reads of contexts marked with
+// WithReplica to the replica, and everything else to the primary. A read that
+// cannot reach the replica is run on the primary, which keeps serving the
+// reads for replicaRetryAfter.
+type ReplicaRouter struct {
+	primary *sql.DB
+	replica *sql.DB
+	// downUntil is the unix time in milliseconds until which the replica is skipped
+	downUntil atomic.Int64
+}
+
+// NewReplicaRouter routes the reads of contexts marked with WithReplica to
+// replica.
+func NewReplicaRouter(primary, replica *sql.DB) *ReplicaRouter {
+	return &ReplicaRouter{primary: primary, replica: replica}
+}
+
+func (r *ReplicaRouter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+func (r *ReplicaRouter) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return r.primary.PrepareContext(ctx, query)
+}
+
+// QueryContext runs the query on the replica when ctx allows it, falling
+// back to the primary when the replica is unavailable.
+func (r *ReplicaRouter) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if !replicaAllowed(ctx) || time.Now().UnixMilli() < r.downUntil.Load() {
+		return r.primary.QueryContext(ctx, query, args...)
+	}
+	rows, err := r.replica.QueryContext(ctx, query, args...)
+	if err == nil || !replicaUnavailable(err) || ctx.Err() != nil {
+		return rows, err
+	}
+	slog.Warn("Replica database unavailable, reading from the primary", "retry_after", replicaRetryAfter, "error", err)
+	r.downUntil.Store(time.Now().Add(replicaRetryAfter).UnixMilli())
+	return r.primary.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext runs on the primary: the error of a single-row read only
+// shows when it is scanned, too late to fall back.
+func (r *ReplicaRouter) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return r.primary.QueryRowContext(ctx, query, args...)
+}
+
+// replicaUnavailable reports whether err means the replica could not serve
+// the read, as opposed to an error of the query itself.
+func replicaUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Connection exceptions, shutdowns and conflicts with the recovery of the replica
+		return pqErr.Code.Class() == "08" || pqErr.Code.Class() == "57" || pqErr.Code == "40001"
+	}
+	return false
+}
@@ -10,6 +10,22 @@ import (
 	"database/sql"
 )
 
+const archiveSession = `-- name: ArchiveSession :exec
+UPDATE sessions
+SET archived_at = $2
+WHERE id = $1 AND archived_at IS NULL
+`
+
+type ArchiveSessionParams struct {
+	ID         string        `json:"id"`
+	ArchivedAt sql.NullInt64 `json:"archived_at"`
+}
+
+func (q *Queries) ArchiveSession(ctx context.Context, arg ArchiveSessionParams) error {
+	_, err := q.db.ExecContext(ctx, archiveSession, arg.ID, arg.ArchivedAt)
+	return err
+}
+
 const createSession = `-- name: CreateSession :one
 INSERT INTO sessions (
     id,
@@ -35,7 +51,7 @@ INSERT INTO sessions (
     null,
     EXTRACT(EPOCH FROM NOW()) * 1000,
     EXTRACT(EPOCH FROM NOW()) * 1000
-) RETURNING id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos
+) RETURNING id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos, archived_at, tags, deleted_at
 `
 
 type CreateSessionParams struct {
@@ -74,6 +90,9 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 		&i.SummaryMessageID,
 		&i.ProjectID,
 		&i.Todos,
+		&i.ArchivedAt,
+		&i.Tags,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -89,9 +108,9 @@ func (q *Queries) DeleteSession(ctx context.Context, id string) error {
 }
 
 const getSessionByID = `-- name: GetSessionByID :one
-SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos
+SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos, archived_at, tags, deleted_at
 FROM sessions
-WHERE id = $1 LIMIT 1
+WHERE id = $1 AND deleted_at IS NULL LIMIT 1
 `
 
 func (q *Queries) GetSessionByID(ctx context.Context, id string) (Session, error) {
@@ -110,15 +129,99 @@ func (q *Queries) GetSessionByID(ctx context.Context, id string) (Session, error
 		&i.SummaryMessageID,
 		&i.ProjectID,
 		&i.Todos,
+		&i.ArchivedAt,
+		&i.Tags,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserSession = `-- name: GetUserSession :one
+SELECT s.id, s.parent_session_id, s.title, s.message_count, s.prompt_tokens, s.completion_tokens, s.cost, s.updated_at, s.created_at, s.summary_message_id, s.project_id, s.todos, s.archived_at, s.tags, s.deleted_at
+FROM sessions s
+JOIN projects p ON p.id = s.project_id
+WHERE s.id = $1 AND p.user_id = $2 AND s.deleted_at IS NULL LIMIT 1
+`
+
+type GetUserSessionParams struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+func (q *Queries) GetUserSession(ctx context.Context, arg GetUserSessionParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, getUserSession, arg.ID, arg.UserID)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.ParentSessionID,
+		&i.Title,
+		&i.MessageCount,
+		&i.PromptTokens,
+		&i.CompletionTokens,
+		&i.Cost,
+		&i.UpdatedAt,
+		&i.CreatedAt,
+		&i.SummaryMessageID,
+		&i.ProjectID,
+		&i.Todos,
+		&i.ArchivedAt,
+		&i.Tags,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const listChildSessions = `-- name: ListChildSessions :many
+SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos, archived_at, tags, deleted_at
+FROM sessions
+WHERE parent_session_id = $1
+`
+
+func (q *Queries) ListChildSessions(ctx context.Context, parentSessionID sql.NullString) ([]Session, error) {
+	rows, err := q.db.QueryContext(ctx, listChildSessions, parentSessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Session{}
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.ID,
+			&i.ParentSessionID,
+			&i.Title,
+			&i.MessageCount,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.Cost,
+			&i.UpdatedAt,
+			&i.CreatedAt,
+			&i.SummaryMessageID,
+			&i.ProjectID,
+			&i.Todos,
+			&i.ArchivedAt,
+			&i.Tags,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listSessions = `-- name: ListSessions :many
-SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos
+SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos, archived_at, tags, deleted_at
 FROM sessions
 WHERE parent_session_id is NULL
 AND project_id = $1
+AND deleted_at IS NULL
 ORDER BY created_at DESC
 `
 
@@ -144,6 +247,87 @@ func (q *Queries) ListSessions(ctx context.Context, projectID sql.NullString) ([
 			&i.SummaryMessageID,
 			&i.ProjectID,
 			&i.Todos,
+			&i.ArchivedAt,
+			&i.Tags,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSessionsForBulk = `-- name: ListSessionsForBulk :many
+SELECT s.id, s.parent_session_id, s.title, s.message_count, s.prompt_tokens, s.completion_tokens, s.cost, s.updated_at, s.created_at, s.summary_message_id, s.project_id, s.todos, s.archived_at, s.tags, s.deleted_at
+FROM sessions s
+JOIN projects p ON p.id = s.project_id
+WHERE p.user_id = $1
+  AND s.parent_session_id IS NULL
+  AND s.deleted_at IS NULL
+  AND ($2::text = '' OR s.project_id = $2)
+  AND ($3::text = '' OR ($3 = 'archived') = (s.archived_at IS NOT NULL))
+  AND ($4::text = '' OR s.tags::jsonb @> jsonb_build_array($4::text))
+  AND ($5::text = '' OR s.title ILIKE '%' || $5 || '%')
+  AND s.created_at >= $6
+  AND ($7::bigint = 0 OR s.created_at < $7)
+ORDER BY s.created_at ASC
+LIMIT $8
+`
+
+type ListSessionsForBulkParams struct {
+	UserID        string `json:"user_id"`
+	ProjectID     string `json:"project_id"`
+	Archived      string `json:"archived"`
+	Tag           string `json:"tag"`
+	Query         string `json:"query"`
+	CreatedAfter  int64  `json:"created_after"`
+	CreatedBefore int64  `json:"created_before"`
+	Limit         int32  `json:"limit"`
+}
+
+// Top-level sessions of the user. Empty filters match everything, archived
+// is empty, 'archived' or 'active', created_before 0 means now.
+func (q *Queries) ListSessionsForBulk(ctx context.Context, arg ListSessionsForBulkParams) ([]Session, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionsForBulk,
+		arg.UserID,
+		arg.ProjectID,
+		arg.Archived,
+		arg.Tag,
+		arg.Query,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Session{}
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.ID,
+			&i.ParentSessionID,
+			&i.Title,
+			&i.MessageCount,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.Cost,
+			&i.UpdatedAt,
+			&i.CreatedAt,
+			&i.SummaryMessageID,
+			&i.ProjectID,
+			&i.Todos,
+			&i.ArchivedAt,
+			&i.Tags,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -158,6 +342,22 @@ func (q *Queries) ListSessions(ctx context.Context, projectID sql.NullString) ([
 	return items, nil
 }
 
+const setSessionTags = `-- name: SetSessionTags :exec
+UPDATE sessions
+SET tags = $2
+WHERE id = $1
+`
+
+type SetSessionTagsParams struct {
+	ID   string `json:"id"`
+	Tags string `json:"tags"`
+}
+
+func (q *Queries) SetSessionTags(ctx context.Context, arg SetSessionTagsParams) error {
+	_, err := q.db.ExecContext(ctx, setSessionTags, arg.ID, arg.Tags)
+	return err
+}
+
 const updateSession = `-- name: UpdateSession :one
 UPDATE sessions
 SET
@@ -168,7 +368,7 @@ SET
     cost = $5,
     todos = $6
 WHERE id = $7
-RETURNING id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos
+RETURNING id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, project_id, todos, archived_at, tags, deleted_at
 `
 
 type UpdateSessionParams struct {
@@ -205,6 +405,9 @@ func (q *Queries) UpdateSession(ctx context.Context, arg UpdateSessionParams) (S
 		&i.SummaryMessageID,
 		&i.ProjectID,
 		&i.Todos,
+		&i.ArchivedAt,
+		&i.Tags,
+		&i.DeletedAt,
 	)
 	return i, err
 }
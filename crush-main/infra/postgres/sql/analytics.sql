@@ -0,0 +1,210 @@
+-- name: CreateModelUsage :exec
+INSERT INTO model_usage (
+    id,
+    session_id,
+    message_id,
+    provider,
+    model,
+    input_tokens,
+    output_tokens,
+    cache_creation_tokens,
+    cache_read_tokens,
+    cost,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+);
+
+-- name: GetLatestUsageRollupDay :one
+-- -1 when nothing was rolled up yet.
+SELECT COALESCE(MAX(day), -1)::BIGINT AS day
+FROM usage_rollups;
+
+-- name: RollupModelUsage :exec
+-- Recomputes the usage rollups of the days from $1, a day start.
+INSERT INTO usage_rollups (
+    day,
+    user_id,
+    project_id,
+    provider,
+    model,
+    requests,
+    input_tokens,
+    output_tokens,
+    cache_creation_tokens,
+    cache_read_tokens,
+    cost
+)
+SELECT
+    (u.created_at / 86400000 * 86400000)::BIGINT AS day,
+    COALESCE(p.user_id, '')::TEXT AS user_id,
+    COALESCE(s.project_id, '')::TEXT AS project_id,
+    u.provider,
+    u.model,
+    COUNT(*)::INTEGER AS requests,
+    SUM(u.input_tokens)::BIGINT AS input_tokens,
+    SUM(u.output_tokens)::BIGINT AS output_tokens,
+    SUM(u.cache_creation_tokens)::BIGINT AS cache_creation_tokens,
+    SUM(u.cache_read_tokens)::BIGINT AS cache_read_tokens,
+    SUM(u.cost)::DOUBLE PRECISION AS cost
+FROM model_usage u
+JOIN sessions s ON s.id = u.session_id
+LEFT JOIN projects p ON p.id = s.project_id
+WHERE u.created_at >= $1
+GROUP BY 1, 2, 3, u.provider, u.model
+ON CONFLICT (day, user_id, project_id, provider, model) DO UPDATE SET
+    requests = EXCLUDED.requests,
+    input_tokens = EXCLUDED.input_tokens,
+    output_tokens = EXCLUDED.output_tokens,
+    cache_creation_tokens = EXCLUDED.cache_creation_tokens,
+    cache_read_tokens = EXCLUDED.cache_read_tokens,
+    cost = EXCLUDED.cost;
+
+-- name: RollupToolUsage :exec
+-- Recomputes the tool usage rollups of the days from $1, a day start.
+INSERT INTO tool_usage_rollups (
+    day,
+    user_id,
+    project_id,
+    tool_name,
+    calls,
+    errors,
+    duration_ms
+)
+SELECT
+    (created_at / 86400000 * 86400000)::BIGINT AS day,
+    COALESCE(user_id, '')::TEXT AS user_id,
+    project_id,
+    tool_name,
+    COUNT(*)::INTEGER AS calls,
+    COUNT(*) FILTER (WHERE is_error)::INTEGER AS errors,
+    SUM(duration_ms)::BIGINT AS duration_ms
+FROM tool_audit_log
+WHERE created_at >= $1
+GROUP BY 1, 2, project_id, tool_name
+ON CONFLICT (day, user_id, project_id, tool_name) DO UPDATE SET
+    calls = EXCLUDED.calls,
+    errors = EXCLUDED.errors,
+    duration_ms = EXCLUDED.duration_ms;
+
+-- name: RollupRuns :exec
+-- Recomputes the run rollups of the days from $1, a day start.
+INSERT INTO run_rollups (
+    day,
+    user_id,
+    project_id,
+    runs,
+    total_ms,
+    model_ms,
+    tool_ms,
+    max_ms
+)
+SELECT
+    (t.started_at / 86400000 * 86400000)::BIGINT AS day,
+    COALESCE(p.user_id, '')::TEXT AS user_id,
+    COALESCE(s.project_id, '')::TEXT AS project_id,
+    COUNT(*)::INTEGER AS runs,
+    SUM(t.total_ms)::BIGINT AS total_ms,
+    SUM(t.model_ms)::BIGINT AS model_ms,
+    SUM(t.tool_ms)::BIGINT AS tool_ms,
+    MAX(t.total_ms)::BIGINT AS max_ms
+FROM turn_timelines t
+JOIN sessions s ON s.id = t.session_id
+LEFT JOIN projects p ON p.id = s.project_id
+WHERE t.started_at >= $1
+GROUP BY 1, 2, 3
+ON CONFLICT (day, user_id, project_id) DO UPDATE SET
+    runs = EXCLUDED.runs,
+    total_ms = EXCLUDED.total_ms,
+    model_ms = EXCLUDED.model_ms,
+    tool_ms = EXCLUDED.tool_ms,
+    max_ms = EXCLUDED.max_ms;
+
+-- name: DeleteFeedbackRollupsSince :exec
+-- Ratings move to the day they last changed, their rollups are recomputed
+-- rather than updated.
+DELETE FROM feedback_rollups
+WHERE day >= $1;
+
+-- name: RollupFeedback :exec
+-- Recomputes the feedback rollups of the days from $1, a day start, after
+-- DeleteFeedbackRollupsSince.
+INSERT INTO feedback_rollups (
+    day,
+    user_id,
+    project_id,
+    model,
+    category,
+    up,
+    down
+)
+SELECT
+    (f.updated_at / 86400000 * 86400000)::BIGINT AS day,
+    COALESCE(p.user_id, '')::TEXT AS user_id,
+    COALESCE(s.project_id, '')::TEXT AS project_id,
+    COALESCE(m.model, '')::TEXT AS model,
+    f.category,
+    COUNT(*) FILTER (WHERE f.rating = 'up')::INTEGER AS up,
+    COUNT(*) FILTER (WHERE f.rating = 'down')::INTEGER AS down
+FROM message_feedback f
+JOIN messages m ON m.id = f.message_id
+JOIN sessions s ON s.id = f.session_id
+LEFT JOIN projects p ON p.id = s.project_id
+WHERE f.updated_at >= $1
+GROUP BY 1, 2, 3, 4, f.category
+ON CONFLICT (day, user_id, project_id, model, category) DO UPDATE SET
+    up = EXCLUDED.up,
+    down = EXCLUDED.down;
+
+-- name: ListUsageRollups :many
+-- An empty user matches every user, day_before 0 means now.
+SELECT *
+FROM usage_rollups
+WHERE ($1::text = '' OR user_id = $1)
+  AND ($2::text = '' OR project_id = $2)
+  AND day >= $3
+  AND ($4::bigint = 0 OR day < $4)
+ORDER BY day ASC, user_id ASC, project_id ASC, provider ASC, model ASC;
+
+-- name: ListToolUsageRollups :many
+-- An empty user matches every user, day_before 0 means now.
+SELECT *
+FROM tool_usage_rollups
+WHERE ($1::text = '' OR user_id = $1)
+  AND ($2::text = '' OR project_id = $2)
+  AND day >= $3
+  AND ($4::bigint = 0 OR day < $4)
+ORDER BY day ASC, user_id ASC, project_id ASC, tool_name ASC;
+
+-- name: ListRunRollups :many
+-- An empty user matches every user, day_before 0 means now.
+SELECT *
+FROM run_rollups
+WHERE ($1::text = '' OR user_id = $1)
+  AND ($2::text = '' OR project_id = $2)
+  AND day >= $3
+  AND ($4::bigint = 0 OR day < $4)
+ORDER BY day ASC, user_id ASC, project_id ASC;
+
+-- name: ListFeedbackRollups :many
+-- An empty user matches every user, day_before 0 means now.
+SELECT *
+FROM feedback_rollups
+WHERE ($1::text = '' OR user_id = $1)
+  AND ($2::text = '' OR project_id = $2)
+  AND day >= $3
+  AND ($4::bigint = 0 OR day < $4)
+ORDER BY day ASC, user_id ASC, project_id ASC, model ASC, category ASC;
+
+-- name: DeleteUserRollups :exec
+-- The rollups have no foreign key to the user, they are deleted with the account.
+WITH deleted_usage AS (
+    DELETE FROM usage_rollups WHERE usage_rollups.user_id = $1
+), deleted_tools AS (
+    DELETE FROM tool_usage_rollups WHERE tool_usage_rollups.user_id = $1
+), deleted_runs AS (
+    DELETE FROM run_rollups WHERE run_rollups.user_id = $1
+)
+DELETE FROM feedback_rollups
+WHERE feedback_rollups.user_id = $1;
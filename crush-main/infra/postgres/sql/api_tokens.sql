@@ -0,0 +1,36 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (
+    id,
+    user_id,
+    name,
+    token_hash,
+    token_prefix,
+    scopes,
+    expires_at,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetAPITokenByHash :one
+SELECT *
+FROM api_tokens
+WHERE token_hash = $1 LIMIT 1;
+
+-- name: ListAPITokensByUser :many
+SELECT *
+FROM api_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: RevokeAPIToken :execrows
+UPDATE api_tokens
+SET revoked_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET last_used_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1;
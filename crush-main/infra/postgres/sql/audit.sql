@@ -0,0 +1,19 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+    id,
+    session_id,
+    message_id,
+    category,
+    action,
+    detail,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+);
+
+-- name: ListAuditEventsBySession :many
+SELECT *
+FROM audit_events
+WHERE session_id = $1
+ORDER BY created_at ASC;
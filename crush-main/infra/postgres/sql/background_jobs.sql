@@ -0,0 +1,40 @@
+-- name: CreateBackgroundJob :one
+INSERT INTO background_jobs (
+    id,
+    session_id,
+    container_name,
+    command,
+    description,
+    working_dir,
+    pid,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetBackgroundJob :one
+SELECT *
+FROM background_jobs
+WHERE id = $1 LIMIT 1;
+
+-- name: ListBackgroundJobsBySession :many
+SELECT *
+FROM background_jobs
+WHERE session_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListRunningBackgroundJobs :many
+SELECT *
+FROM background_jobs
+WHERE status = 'running'
+ORDER BY created_at ASC;
+
+-- name: FinishBackgroundJob :exec
+UPDATE background_jobs
+SET
+    status = $2,
+    exit_code = $3,
+    completed_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1 AND status = 'running';
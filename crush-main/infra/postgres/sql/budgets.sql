@@ -0,0 +1,49 @@
+-- name: UpsertBudget :one
+INSERT INTO budgets (
+    scope,
+    scope_id,
+    max_cost,
+    max_tokens,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (scope, scope_id) DO UPDATE SET
+    max_cost = EXCLUDED.max_cost,
+    max_tokens = EXCLUDED.max_tokens,
+    updated_at = EXCLUDED.updated_at
+RETURNING *;
+
+-- name: GetBudget :one
+SELECT *
+FROM budgets
+WHERE scope = $1 AND scope_id = $2 LIMIT 1;
+
+-- name: DeleteBudget :execrows
+DELETE FROM budgets
+WHERE scope = $1 AND scope_id = $2;
+
+-- name: GetSessionBudgetUsage :one
+SELECT
+    COALESCE(s.project_id, '')::TEXT AS project_id,
+    COALESCE(p.user_id, '')::TEXT AS user_id,
+    (SELECT COALESCE(SUM(cost), 0)::DOUBLE PRECISION
+        FROM sessions WHERE id = s.id OR parent_session_id = s.id) AS session_cost,
+    (SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0)::BIGINT
+        FROM sessions WHERE id = s.id OR parent_session_id = s.id) AS session_tokens,
+    (SELECT COALESCE(SUM(cost), 0)::DOUBLE PRECISION
+        FROM sessions WHERE project_id = s.project_id) AS project_cost,
+    (SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0)::BIGINT
+        FROM sessions WHERE project_id = s.project_id) AS project_tokens,
+    (SELECT COALESCE(SUM(us.cost), 0)::DOUBLE PRECISION
+        FROM sessions us JOIN projects up ON up.id = us.project_id
+        WHERE up.user_id = p.user_id) AS user_cost,
+    (SELECT COALESCE(SUM(us.prompt_tokens + us.completion_tokens), 0)::BIGINT
+        FROM sessions us JOIN projects up ON up.id = us.project_id
+        WHERE up.user_id = p.user_id) AS user_tokens
+FROM sessions s
+LEFT JOIN projects p ON p.id = s.project_id
+WHERE s.id = $1;
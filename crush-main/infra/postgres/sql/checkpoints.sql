@@ -0,0 +1,19 @@
+-- name: CreateMessageCheckpoint :exec
+INSERT INTO message_checkpoints (
+    message_id,
+    session_id,
+    prompt_tokens,
+    completion_tokens,
+    created_at
+) VALUES (
+    $1, $2, $3, $4,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (message_id) DO UPDATE SET
+    prompt_tokens = EXCLUDED.prompt_tokens,
+    completion_tokens = EXCLUDED.completion_tokens;
+
+-- name: GetMessageCheckpoint :one
+SELECT *
+FROM message_checkpoints
+WHERE message_id = $1 LIMIT 1;
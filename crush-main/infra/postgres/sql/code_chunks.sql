@@ -0,0 +1,43 @@
+-- name: CreateCodeChunk :exec
+INSERT INTO code_chunks (
+    project_id,
+    path,
+    chunk_index,
+    start_line,
+    end_line,
+    content,
+    embedding,
+    model,
+    file_modified,
+    file_size,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (project_id, path, chunk_index) DO UPDATE SET
+    start_line = EXCLUDED.start_line,
+    end_line = EXCLUDED.end_line,
+    content = EXCLUDED.content,
+    embedding = EXCLUDED.embedding,
+    model = EXCLUDED.model,
+    file_modified = EXCLUDED.file_modified,
+    file_size = EXCLUDED.file_size,
+    created_at = EXCLUDED.created_at;
+
+-- name: DeleteCodeChunksByPath :exec
+DELETE FROM code_chunks
+WHERE project_id = $1 AND path = $2;
+
+-- name: ListCodeChunksByProject :many
+SELECT *
+FROM code_chunks
+WHERE project_id = $1
+ORDER BY path, chunk_index;
+
+-- name: ListCodeIndexFiles :many
+SELECT path, file_modified, file_size, model
+FROM code_chunks
+WHERE project_id = $1
+GROUP BY path, file_modified, file_size, model
+ORDER BY path;
@@ -0,0 +1,39 @@
+-- name: CreateDataExportJob :one
+INSERT INTO data_export_jobs (
+    id,
+    user_id,
+    status,
+    created_at
+) VALUES (
+    $1, $2, 'pending',
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetDataExportJob :one
+SELECT *
+FROM data_export_jobs
+WHERE id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: ListDataExportJobsByUser :many
+SELECT *
+FROM data_export_jobs
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: UpdateDataExportJob :exec
+UPDATE data_export_jobs
+SET
+    status = $2,
+    object_name = $3,
+    size = $4,
+    error = $5,
+    completed_at = $6
+WHERE id = $1;
+
+-- name: ListSessionsByUser :many
+SELECT s.*
+FROM sessions s
+JOIN projects p ON p.id = s.project_id
+WHERE p.user_id = $1
+ORDER BY s.created_at ASC;
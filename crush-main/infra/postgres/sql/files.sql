@@ -60,3 +60,29 @@ SELECT *
 FROM files
 WHERE is_new = 1
 ORDER BY version DESC, created_at DESC;
+
+-- name: ListProjectFileChanges :many
+SELECT f.id, f.session_id, f.path, f.content, f.version, f.created_at,
+       prev.content AS base_content
+FROM files f
+JOIN sessions s ON s.id = f.session_id
+LEFT JOIN LATERAL (
+    SELECT p.content
+    FROM files p
+    WHERE p.path = f.path AND p.version < f.version
+    ORDER BY p.version DESC, p.created_at DESC
+    LIMIT 1
+) prev ON TRUE
+WHERE s.project_id = $1
+  AND f.version > 0
+  AND (f.created_at, f.id) > ($2::BIGINT, $3::TEXT)
+ORDER BY f.created_at ASC, f.id ASC
+LIMIT $4;
+
+-- name: GetLatestProjectFileChange :one
+SELECT f.id, f.created_at
+FROM files f
+JOIN sessions s ON s.id = f.session_id
+WHERE s.project_id = $1
+ORDER BY f.created_at DESC, f.id DESC
+LIMIT 1;
@@ -0,0 +1,28 @@
+-- name: GetMessageFeedback :one
+SELECT *
+FROM message_feedback
+WHERE message_id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: UpsertMessageFeedback :one
+-- A user rates a message once, rating it again replaces the rating.
+INSERT INTO message_feedback (
+    id,
+    message_id,
+    session_id,
+    user_id,
+    rating,
+    category,
+    comment,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (message_id, user_id) DO UPDATE SET
+    rating = EXCLUDED.rating,
+    category = EXCLUDED.category,
+    comment = EXCLUDED.comment,
+    updated_at = EXCLUDED.updated_at
+RETURNING *;
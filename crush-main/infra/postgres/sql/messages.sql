@@ -9,6 +9,20 @@ FROM messages
 WHERE session_id = $1
 ORDER BY created_at ASC;
 
+-- name: ListSessionMessagesBefore :many
+SELECT *
+FROM messages
+WHERE session_id = $1 AND (created_at, id) < ($2, $3)
+ORDER BY created_at DESC, id DESC
+LIMIT $4;
+
+-- name: ListSessionMessagesAfter :many
+SELECT *
+FROM messages
+WHERE session_id = $1 AND (created_at, id) > ($2, $3)
+ORDER BY created_at ASC, id ASC
+LIMIT $4;
+
 -- name: CreateMessage :one
 INSERT INTO messages (
     id,
@@ -0,0 +1,59 @@
+-- name: AddMetricsRollup :exec
+INSERT INTO metrics_rollups (
+    bucket,
+    session_id,
+    turns,
+    errors,
+    cost
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+ON CONFLICT (bucket, session_id) DO UPDATE SET
+    turns = metrics_rollups.turns + EXCLUDED.turns,
+    errors = metrics_rollups.errors + EXCLUDED.errors,
+    cost = metrics_rollups.cost + EXCLUDED.cost;
+
+-- name: AddFeedbackMetricsRollup :exec
+-- The counts are deltas, negative when a rating is changed.
+INSERT INTO metrics_rollups (
+    bucket,
+    session_id,
+    feedback_up,
+    feedback_down
+) VALUES (
+    $1, $2, $3, $4
+)
+ON CONFLICT (bucket, session_id) DO UPDATE SET
+    feedback_up = metrics_rollups.feedback_up + EXCLUDED.feedback_up,
+    feedback_down = metrics_rollups.feedback_down + EXCLUDED.feedback_down;
+
+-- name: GetMetricsTotals :one
+SELECT
+    COALESCE(SUM(turns), 0)::BIGINT AS turns,
+    COALESCE(SUM(errors), 0)::BIGINT AS errors,
+    COALESCE(SUM(cost), 0)::DOUBLE PRECISION AS cost,
+    COALESCE(SUM(feedback_up), 0)::BIGINT AS feedback_up,
+    COALESCE(SUM(feedback_down), 0)::BIGINT AS feedback_down
+FROM metrics_rollups
+WHERE bucket >= $1;
+
+-- name: ListTopSessionsByCost :many
+SELECT
+    r.session_id,
+    s.title,
+    s.project_id,
+    SUM(r.turns)::BIGINT AS turns,
+    SUM(r.cost)::DOUBLE PRECISION AS cost
+FROM metrics_rollups r
+JOIN sessions s ON s.id = r.session_id
+WHERE r.bucket >= $1
+GROUP BY r.session_id, s.title, s.project_id
+ORDER BY cost DESC
+LIMIT $2;
+
+-- name: DeleteMetricsRollupsBefore :exec
+DELETE FROM metrics_rollups
+WHERE bucket < $1;
+
+-- name: PingDatabase :exec
+SELECT 1;
@@ -0,0 +1,44 @@
+-- name: CreateProjectMemory :one
+INSERT INTO project_memories (
+    id,
+    project_id,
+    content,
+    session_id,
+    created_by,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING id, project_id, content, session_id, created_by, created_at;
+
+-- name: ListProjectMemories :many
+SELECT id, project_id, content, session_id, created_by, created_at FROM project_memories
+WHERE project_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: SearchProjectMemories :many
+-- Notes of a project matching the query by text search, or containing the
+-- pattern for identifiers and commands the text search splits up.
+SELECT id, project_id, content, session_id, created_by, created_at FROM project_memories
+WHERE project_id = $1
+  AND (content_tsv @@ websearch_to_tsquery('english', $2) OR content ILIKE $3)
+ORDER BY ts_rank_cd(content_tsv, websearch_to_tsquery('english', $2)) DESC, created_at DESC
+LIMIT $4;
+
+-- name: ListRelevantProjectMemories :many
+-- Notes of a project ranked by relevance to the query, the most recent ones
+-- fill up the limit when fewer match.
+SELECT id, project_id, content, session_id, created_by, created_at FROM project_memories
+WHERE project_id = $1
+ORDER BY ts_rank_cd(content_tsv, websearch_to_tsquery('english', $2)) DESC, created_at DESC
+LIMIT $3;
+
+-- name: CountProjectMemories :one
+SELECT COUNT(*) FROM project_memories
+WHERE project_id = $1;
+
+-- name: DeleteProjectMemory :execrows
+DELETE FROM project_memories
+WHERE project_id = $1 AND id = $2;
@@ -0,0 +1,52 @@
+-- name: CreateProjectTemplate :one
+INSERT INTO project_templates (
+    id,
+    name,
+    description,
+    backend_language,
+    need_database,
+    frontend_command,
+    backend_command,
+    starter_repo,
+    starter_ref,
+    scripts,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetProjectTemplate :one
+SELECT * FROM project_templates
+WHERE id = $1 LIMIT 1;
+
+-- name: GetProjectTemplateByName :one
+SELECT * FROM project_templates
+WHERE name = $1 LIMIT 1;
+
+-- name: ListProjectTemplates :many
+SELECT * FROM project_templates
+ORDER BY name ASC;
+
+-- name: UpdateProjectTemplate :one
+UPDATE project_templates
+SET
+    name = $2,
+    description = $3,
+    backend_language = $4,
+    need_database = $5,
+    frontend_command = $6,
+    backend_command = $7,
+    starter_repo = $8,
+    starter_ref = $9,
+    scripts = $10,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteProjectTemplate :exec
+DELETE FROM project_templates
+WHERE id = $1;
@@ -40,6 +40,11 @@ FROM projects
 WHERE user_id = $1
 ORDER BY updated_at DESC;
 
+-- name: ListProjects :many
+SELECT *
+FROM projects
+ORDER BY created_at ASC;
+
 -- name: UpdateProject :one
 UPDATE projects
 SET
@@ -61,6 +66,12 @@ SET
     backend_command = $17,
     backend_language = $18,
     subdomain = $19,
+    system_prompt = $20,
+    permission_timeout = $21,
+    retention_days = $22,
+    cpu_limit = $23,
+    memory_limit_mb = $24,
+    disk_limit_mb = $25,
     updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
 WHERE id = $1
 RETURNING *;
@@ -74,4 +85,248 @@ SELECT s.*
 FROM sessions s
 WHERE s.project_id = $1
 AND s.parent_session_id IS NULL
+AND s.deleted_at IS NULL
 ORDER BY s.created_at DESC;
+
+-- name: UpsertProjectPause :one
+INSERT INTO project_pauses (
+    project_id,
+    reason,
+    mode,
+    drain,
+    paused_by,
+    paused_at,
+    resume_at
+) VALUES (
+    $1, $2, $3, $4, $5, EXTRACT(EPOCH FROM NOW()) * 1000, $6
+)
+ON CONFLICT (project_id) DO UPDATE SET
+    reason = EXCLUDED.reason,
+    mode = EXCLUDED.mode,
+    drain = EXCLUDED.drain,
+    paused_by = EXCLUDED.paused_by,
+    paused_at = EXCLUDED.paused_at,
+    resume_at = EXCLUDED.resume_at
+RETURNING *;
+
+-- name: GetProjectPause :one
+SELECT * FROM project_pauses
+WHERE project_id = $1 LIMIT 1;
+
+-- name: DeleteProjectPause :exec
+DELETE FROM project_pauses
+WHERE project_id = $1;
+
+-- name: UpsertProjectWebhook :one
+INSERT INTO project_webhooks (
+    project_id,
+    secret,
+    events,
+    prompt_template,
+    post_comment,
+    scm_token,
+    enabled,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (project_id) DO UPDATE SET
+    secret = EXCLUDED.secret,
+    events = EXCLUDED.events,
+    prompt_template = EXCLUDED.prompt_template,
+    post_comment = EXCLUDED.post_comment,
+    scm_token = EXCLUDED.scm_token,
+    enabled = EXCLUDED.enabled,
+    updated_at = EXCLUDED.updated_at
+RETURNING *;
+
+-- name: GetProjectWebhook :one
+SELECT * FROM project_webhooks
+WHERE project_id = $1 LIMIT 1;
+
+-- name: DeleteProjectWebhook :exec
+DELETE FROM project_webhooks
+WHERE project_id = $1;
+
+-- name: CreateProjectChatHook :one
+INSERT INTO project_chat_hooks (
+    id,
+    project_id,
+    platform,
+    webhook_url,
+    template,
+    events,
+    enabled,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetProjectChatHook :one
+SELECT * FROM project_chat_hooks
+WHERE id = $1 AND project_id = $2 LIMIT 1;
+
+-- name: ListProjectChatHooks :many
+SELECT * FROM project_chat_hooks
+WHERE project_id = $1
+ORDER BY created_at ASC;
+
+-- name: UpdateProjectChatHook :one
+UPDATE project_chat_hooks
+SET
+    platform = $3,
+    webhook_url = $4,
+    template = $5,
+    events = $6,
+    enabled = $7,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1 AND project_id = $2
+RETURNING *;
+
+-- name: DeleteProjectChatHook :exec
+DELETE FROM project_chat_hooks
+WHERE id = $1 AND project_id = $2;
+
+-- name: UpsertProjectPermissionPolicy :one
+INSERT INTO project_permission_policies (
+    project_id,
+    rules,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (project_id) DO UPDATE SET
+    rules = EXCLUDED.rules,
+    updated_at = EXCLUDED.updated_at
+RETURNING *;
+
+-- name: GetProjectPermissionPolicy :one
+SELECT * FROM project_permission_policies
+WHERE project_id = $1 LIMIT 1;
+
+-- name: CreateSessionBlueprint :one
+INSERT INTO session_blueprints (
+    id,
+    project_id,
+    name,
+    description,
+    pinned_context,
+    model_config,
+    allowed_tools,
+    prompts,
+    agent,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetSessionBlueprint :one
+SELECT * FROM session_blueprints
+WHERE id = $1 AND project_id = $2 LIMIT 1;
+
+-- name: GetSessionBlueprintByName :one
+SELECT * FROM session_blueprints
+WHERE project_id = $1 AND name = $2 LIMIT 1;
+
+-- name: ListSessionBlueprints :many
+SELECT * FROM session_blueprints
+WHERE project_id = $1
+ORDER BY name ASC;
+
+-- name: UpdateSessionBlueprint :one
+UPDATE session_blueprints
+SET
+    name = $3,
+    description = $4,
+    pinned_context = $5,
+    model_config = $6,
+    allowed_tools = $7,
+    prompts = $8,
+    agent = $9,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1 AND project_id = $2
+RETURNING *;
+
+-- name: DeleteSessionBlueprint :exec
+DELETE FROM session_blueprints
+WHERE id = $1 AND project_id = $2;
+
+-- name: StartProjectShadowPolicy :one
+INSERT INTO project_permission_policies (
+    project_id,
+    rules,
+    shadow_rules,
+    shadow_started_at,
+    shadow_until,
+    created_at,
+    updated_at
+) VALUES (
+    $1, '[]', $2,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    $3,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (project_id) DO UPDATE SET
+    shadow_rules = EXCLUDED.shadow_rules,
+    shadow_started_at = EXCLUDED.shadow_started_at,
+    shadow_until = EXCLUDED.shadow_until,
+    updated_at = EXCLUDED.updated_at
+RETURNING *;
+
+-- name: StopProjectShadowPolicy :exec
+UPDATE project_permission_policies
+SET
+    shadow_rules = NULL,
+    shadow_started_at = NULL,
+    shadow_until = NULL,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE project_id = $1;
+
+-- name: CreatePermissionShadowDecision :exec
+INSERT INTO permission_shadow_decisions (
+    id,
+    project_id,
+    session_id,
+    tool_name,
+    subject,
+    actual,
+    shadow,
+    actual_rule,
+    shadow_rule,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+);
+
+-- name: DeleteProjectShadowDecisions :exec
+DELETE FROM permission_shadow_decisions
+WHERE project_id = $1;
+
+-- name: CountProjectShadowDecisions :many
+SELECT actual, shadow, COUNT(*) AS count
+FROM permission_shadow_decisions
+WHERE project_id = $1
+GROUP BY actual, shadow
+ORDER BY actual, shadow;
+
+-- name: ListProjectShadowMismatches :many
+SELECT * FROM permission_shadow_decisions
+WHERE project_id = $1 AND actual <> shadow
+ORDER BY created_at DESC
+LIMIT $2;
@@ -0,0 +1,26 @@
+-- name: ListExpiredSessions :many
+-- Top-level sessions inactive for longer than the retention of their
+-- project, which is default_days when the project has none. Zero or negative
+-- retentions keep the sessions.
+SELECT s.*
+FROM sessions s
+JOIN projects p ON p.id = s.project_id
+WHERE s.parent_session_id IS NULL
+  AND s.deleted_at IS NULL
+  AND (CASE WHEN p.retention_days = 0 THEN $1::integer ELSE p.retention_days END) > 0
+  AND s.updated_at < $2::bigint - (CASE WHEN p.retention_days = 0 THEN $1::integer ELSE p.retention_days END)::bigint * 86400000
+ORDER BY s.updated_at ASC
+LIMIT $3;
+
+-- name: SoftDeleteSession :exec
+UPDATE sessions
+SET deleted_at = $2
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: ListSoftDeletedSessions :many
+SELECT *
+FROM sessions
+WHERE deleted_at IS NOT NULL
+  AND deleted_at < $1
+ORDER BY deleted_at ASC
+LIMIT $2;
@@ -0,0 +1,27 @@
+-- name: SearchMessages :many
+-- Parts of the messages of the user matching the query, by text search or,
+-- for code snippets, by the pattern on the trigram index. Empty project_id
+-- matches every project.
+SELECT
+    ms.message_id,
+    ms.part_index,
+    ms.session_id,
+    s.project_id,
+    s.title AS session_title,
+    ms.role,
+    ms.kind,
+    ms.tool_name,
+    ms.tool_call_id,
+    ts_headline('english', ms.content, websearch_to_tsquery('english', $2),
+        'MaxFragments=2, MaxWords=24, MinWords=8, StartSel=<<, StopSel=>>')::TEXT AS snippet,
+    (ts_rank_cd(ms.content_tsv, websearch_to_tsquery('english', $2)) + word_similarity($2, ms.content))::DOUBLE PRECISION AS rank,
+    ms.created_at
+FROM message_search ms
+JOIN sessions s ON s.id = ms.session_id
+JOIN projects p ON p.id = s.project_id
+WHERE p.user_id = $1
+  AND s.deleted_at IS NULL
+  AND ($4::text = '' OR s.project_id = $4)
+  AND (ms.content_tsv @@ websearch_to_tsquery('english', $2) OR ms.content ILIKE $3)
+ORDER BY rank DESC, ms.created_at DESC
+LIMIT $5 OFFSET $6;
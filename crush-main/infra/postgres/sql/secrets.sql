@@ -0,0 +1,39 @@
+-- name: UpsertSecret :one
+INSERT INTO secrets (
+    id,
+    project_id,
+    name,
+    value,
+    created_by,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (project_id, name) DO UPDATE SET
+    value = EXCLUDED.value,
+    updated_at = EXCLUDED.updated_at
+RETURNING *;
+
+-- name: GetSecret :one
+SELECT * FROM secrets
+WHERE project_id = $1 AND name = $2 LIMIT 1;
+
+-- name: ListSecrets :many
+SELECT * FROM secrets
+WHERE project_id = $1
+ORDER BY name ASC;
+
+-- name: ListAllSecrets :many
+SELECT * FROM secrets
+ORDER BY project_id ASC, name ASC;
+
+-- name: DeleteSecret :execrows
+DELETE FROM secrets
+WHERE project_id = $1 AND name = $2;
+
+-- name: DeleteProjectSecrets :execrows
+DELETE FROM secrets
+WHERE project_id = $1;
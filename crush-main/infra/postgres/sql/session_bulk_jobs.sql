@@ -0,0 +1,35 @@
+-- name: CreateSessionBulkJob :one
+INSERT INTO session_bulk_jobs (
+    id,
+    user_id,
+    action,
+    status,
+    total,
+    created_at
+) VALUES (
+    $1, $2, $3, 'pending', $4,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetSessionBulkJob :one
+SELECT *
+FROM session_bulk_jobs
+WHERE id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: ListSessionBulkJobsByUser :many
+SELECT *
+FROM session_bulk_jobs
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: UpdateSessionBulkJob :exec
+UPDATE session_bulk_jobs
+SET
+    status = $2,
+    processed = $3,
+    failed = $4,
+    failures = $5,
+    error = $6,
+    completed_at = $7
+WHERE id = $1;
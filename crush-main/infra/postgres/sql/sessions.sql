@@ -28,13 +28,14 @@ INSERT INTO sessions (
 -- name: GetSessionByID :one
 SELECT *
 FROM sessions
-WHERE id = $1 LIMIT 1;
+WHERE id = $1 AND deleted_at IS NULL LIMIT 1;
 
 -- name: ListSessions :many
 SELECT *
 FROM sessions
 WHERE parent_session_id is NULL
 AND project_id = $1
+AND deleted_at IS NULL
 ORDER BY created_at DESC;
 
 -- name: UpdateSession :one
@@ -53,3 +54,42 @@ RETURNING *;
 -- name: DeleteSession :exec
 DELETE FROM sessions
 WHERE id = $1;
+
+-- name: GetUserSession :one
+SELECT s.*
+FROM sessions s
+JOIN projects p ON p.id = s.project_id
+WHERE s.id = $1 AND p.user_id = $2 AND s.deleted_at IS NULL LIMIT 1;
+
+-- name: ListSessionsForBulk :many
+-- Top-level sessions of the user. Empty filters match everything, archived
+-- is empty, 'archived' or 'active', created_before 0 means now.
+SELECT s.*
+FROM sessions s
+JOIN projects p ON p.id = s.project_id
+WHERE p.user_id = $1
+  AND s.parent_session_id IS NULL
+  AND s.deleted_at IS NULL
+  AND ($2::text = '' OR s.project_id = $2)
+  AND ($3::text = '' OR ($3 = 'archived') = (s.archived_at IS NOT NULL))
+  AND ($4::text = '' OR s.tags::jsonb @> jsonb_build_array($4::text))
+  AND ($5::text = '' OR s.title ILIKE '%' || $5 || '%')
+  AND s.created_at >= $6
+  AND ($7::bigint = 0 OR s.created_at < $7)
+ORDER BY s.created_at ASC
+LIMIT $8;
+
+-- name: ListChildSessions :many
+SELECT *
+FROM sessions
+WHERE parent_session_id = $1;
+
+-- name: ArchiveSession :exec
+UPDATE sessions
+SET archived_at = $2
+WHERE id = $1 AND archived_at IS NULL;
+
+-- name: SetSessionTags :exec
+UPDATE sessions
+SET tags = $2
+WHERE id = $1;
@@ -0,0 +1,71 @@
+-- name: CreateTurnTimeline :exec
+INSERT INTO turn_timelines (
+    id,
+    session_id,
+    started_at,
+    total_ms,
+    model_ms,
+    tool_ms,
+    db_ms,
+    step_count,
+    tool_call_count,
+    steps,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+);
+
+-- name: AddTurnTimelineMessage :exec
+INSERT INTO turn_timeline_messages (
+    message_id,
+    timeline_id
+) VALUES (
+    $1, $2
+)
+ON CONFLICT (message_id) DO UPDATE SET timeline_id = EXCLUDED.timeline_id;
+
+-- name: GetTurnTimelineByMessage :one
+SELECT t.*
+FROM turn_timelines t
+JOIN turn_timeline_messages m ON m.timeline_id = t.id
+WHERE m.message_id = $1 LIMIT 1;
+
+-- name: CreateTurnStep :exec
+INSERT INTO turn_steps (
+    message_id,
+    timeline_id,
+    session_id,
+    step_index,
+    started_at,
+    prepare_ms,
+    message_count,
+    queued_prompts,
+    compacted_results,
+    loop_nudge,
+    provider,
+    model,
+    first_token_ms,
+    model_ms,
+    finish_reason,
+    tool_calls,
+    input_tokens,
+    output_tokens,
+    cache_creation_tokens,
+    cache_read_tokens,
+    cost,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+    $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+    $21,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+ON CONFLICT (message_id) DO NOTHING;
+
+-- name: ListTurnStepsByMessage :many
+SELECT s.*
+FROM turn_steps s
+JOIN turn_timeline_messages m ON m.timeline_id = s.timeline_id
+WHERE m.message_id = $1
+ORDER BY s.step_index ASC;
@@ -0,0 +1,33 @@
+-- name: CreateToolAuditEntry :exec
+INSERT INTO tool_audit_log (
+    id,
+    tool_call_id,
+    session_id,
+    project_id,
+    user_id,
+    message_id,
+    tool_name,
+    params_hash,
+    permission,
+    duration_ms,
+    result_size,
+    is_error,
+    error,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+);
+
+-- name: ListToolAuditEntries :many
+-- Empty filters match everything, created_before 0 means now.
+SELECT *
+FROM tool_audit_log
+WHERE user_id = $1
+  AND ($2::text = '' OR session_id = $2)
+  AND ($3::text = '' OR project_id = $3)
+  AND ($4::text = '' OR tool_name = $4)
+  AND created_at >= $5
+  AND ($6::bigint = 0 OR created_at < $6)
+ORDER BY created_at ASC, id ASC
+LIMIT $7 OFFSET $8;
@@ -0,0 +1,57 @@
+-- name: CreateUpload :one
+INSERT INTO uploads (
+    id,
+    user_id,
+    filename,
+    mime_type,
+    size,
+    chunk_size,
+    created_at,
+    updated_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6,
+    EXTRACT(EPOCH FROM NOW()) * 1000,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetUpload :one
+SELECT *
+FROM uploads
+WHERE id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: ListUploadsByUser :many
+SELECT *
+FROM uploads
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: ListStaleUploadsByUser :many
+SELECT *
+FROM uploads
+WHERE user_id = $1 AND status = 'uploading' AND updated_at < $2;
+
+-- name: SumUploadSizeByUser :one
+SELECT COALESCE(SUM(size), 0)::BIGINT
+FROM uploads
+WHERE user_id = $1;
+
+-- name: UpdateUploadReceived :exec
+UPDATE uploads
+SET
+    received = $2,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1;
+
+-- name: CompleteUpload :exec
+UPDATE uploads
+SET
+    status = 'completed',
+    object_name = $2,
+    updated_at = EXTRACT(EPOCH FROM NOW()) * 1000,
+    completed_at = EXTRACT(EPOCH FROM NOW()) * 1000
+WHERE id = $1;
+
+-- name: DeleteUpload :exec
+DELETE FROM uploads
+WHERE id = $1;
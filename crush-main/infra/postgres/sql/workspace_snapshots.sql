@@ -0,0 +1,37 @@
+-- name: CreateWorkspaceSnapshot :one
+INSERT INTO workspace_snapshots (
+    id,
+    project_id,
+    session_id,
+    reason,
+    object_name,
+    size,
+    created_by,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7,
+    EXTRACT(EPOCH FROM NOW()) * 1000
+)
+RETURNING *;
+
+-- name: GetWorkspaceSnapshot :one
+SELECT *
+FROM workspace_snapshots
+WHERE id = $1 AND project_id = $2 LIMIT 1;
+
+-- name: ListWorkspaceSnapshotsByProject :many
+SELECT *
+FROM workspace_snapshots
+WHERE project_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: ListWorkspaceSnapshotsByUser :many
+SELECT w.*
+FROM workspace_snapshots w
+JOIN projects p ON p.id = w.project_id
+WHERE p.user_id = $1
+ORDER BY w.created_at DESC;
+
+-- name: DeleteWorkspaceSnapshot :exec
+DELETE FROM workspace_snapshots
+WHERE id = $1;
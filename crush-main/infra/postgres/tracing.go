@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/rolling1314/rolling-crush/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracing traces the queries run on db, each in a span named after its
+// sqlc query. db is returned as it is when tracing is disabled.
+func WithTracing(db DBTX) DBTX {
+	if !tracing.Enabled() {
+		return db
+	}
+	return &tracedDB{db: db}
+}
+
+type tracedDB struct {
+	db DBTX
+}
+
+func (t *tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	result, err := t.db.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (t *tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	tracing.End(span, err)
+	return stmt, err
+}
+
+func (t *tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+// QueryRowContext traces the query up to its first row, its error is only
+// known once the row is scanned.
+func (t *tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	var err error
+	if row != nil && !errors.Is(row.Err(), sql.ErrNoRows) {
+		err = row.Err()
+	}
+	tracing.End(span, err)
+	return row
+}
+
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	return tracing.Start(ctx, "postgres "+name,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", name),
+	)
+}
+
+// queryName returns the name of a sqlc query, e.g. "GetSessionByID" for
+// "-- name: GetSessionByID :one", or its first word for other queries.
+func queryName(query string) string {
+	query = strings.TrimSpace(query)
+	if rest, ok := strings.CutPrefix(query, "-- name:"); ok {
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	if fields := strings.Fields(query); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return "query"
+}
@@ -2,6 +2,7 @@
 package redis
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
 	"github.com/rolling1314/rolling-crush/pkg/config"
 )
 
@@ -20,38 +22,87 @@ var (
 
 // Client wraps the Redis client with additional functionality.
 type Client struct {
-	rdb          *redis.Client
+	// rdb is a standalone, sentinel (failover) or cluster client, see mode.
+	rdb          redis.UniversalClient
+	cfg          config.RedisConfig
 	streamMaxLen int64
 	streamTTL    time.Duration
+	// namespace prefixes every key and channel, see key.
+	namespace string
 }
 
 // NewClient creates a new Redis client from the configuration.
 func NewClient(cfg config.RedisConfig) (*Client, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-		PoolSize: cfg.PoolSize,
-	})
+	if err := config.ValidateRedisNamespace(cfg.Namespace); err != nil {
+		return nil, err
+	}
+	if err := config.ValidateRedisMode(cfg); err != nil {
+		return nil, err
+	}
+
+	// The connections opened once a rotated password was resolved use it,
+	// see config.StartSecretRotation
+	credentials := func() (string, string) {
+		if appCfg := config.GetGlobalAppConfig(); appCfg != nil {
+			return "", appCfg.Redis.Password
+		}
+		return "", cfg.Password
+	}
+
+	var rdb redis.UniversalClient
+	switch cfg.Mode {
+	case config.RedisModeSentinel:
+		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:          cfg.MasterName,
+			SentinelAddrs:       cfg.Addrs,
+			SentinelPassword:    cfg.SentinelPassword,
+			CredentialsProvider: credentials,
+			DB:                  cfg.DB,
+			PoolSize:            cfg.PoolSize,
+		})
+	case config.RedisModeCluster:
+		rdb = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:               cfg.Addrs,
+			CredentialsProvider: credentials,
+			PoolSize:            cfg.PoolSize,
+		})
+	default:
+		rdb = redis.NewClient(&redis.Options{
+			Addr:                fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			CredentialsProvider: credentials,
+			DB:                  cfg.DB,
+			PoolSize:            cfg.PoolSize,
+		})
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	if tracing.Enabled() {
+		rdb.AddHook(tracingHook{})
+	}
+
 	slog.Info("Redis connection established",
+		"mode", cmp.Or(cfg.Mode, config.RedisModeStandalone),
 		"host", cfg.Host,
 		"port", cfg.Port,
+		"addrs", cfg.Addrs,
 		"db", cfg.DB,
+		"namespace", cfg.Namespace,
 	)
 
 	return &Client{
 		rdb:          rdb,
+		cfg:          cfg,
 		streamMaxLen: cfg.StreamMaxLen,
 		streamTTL:    time.Duration(cfg.StreamTTL) * time.Second,
+		namespace:    cfg.Namespace,
 	}, nil
 }
 
@@ -90,10 +141,15 @@ func (c *Client) Close() error {
 }
 
 // Redis returns the underlying Redis client.
-func (c *Client) Redis() *redis.Client {
+func (c *Client) Redis() redis.UniversalClient {
 	return c.rdb
 }
 
+// Mode returns the deployment mode of the Redis: standalone, sentinel or cluster.
+func (c *Client) Mode() string {
+	return cmp.Or(c.cfg.Mode, config.RedisModeStandalone)
+}
+
 // StreamMaxLen returns the configured maximum stream length.
 func (c *Client) StreamMaxLen() int64 {
 	return c.streamMaxLen
@@ -103,3 +159,58 @@ func (c *Client) StreamMaxLen() int64 {
 func (c *Client) StreamTTL() time.Duration {
 	return c.streamTTL
 }
+
+// Namespace returns the configured key namespace.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// key prefixes a key or channel with the namespace of the deployment, so
+// environments sharing a Redis do not see each other's keys.
+func (c *Client) key(key string) string {
+	if c.namespace == "" {
+		return key
+	}
+	return c.namespace + ":" + key
+}
+
+// slotKey is key for the keys used together in scripts, which a cluster
+// requires in the same hash slot. In cluster mode the key is prefixed with the
+// hash tag of slot, e.g. the session ID for the stream and sequence of a
+// session. Standalone and sentinel keys are unchanged.
+func (c *Client) slotKey(slot, key string) string {
+	if c.cfg.Mode == config.RedisModeCluster {
+		key = "{" + slot + "}" + key
+	}
+	return c.key(key)
+}
+
+// scanKeys returns the keys matching pattern. A cluster is scanned on each of
+// its masters, as SCAN only sees the keys of the node it runs on.
+func (c *Client) scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	cluster, ok := c.rdb.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, c.rdb, pattern)
+	}
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanNode(ctx, node, pattern)
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
+
+func scanNode(ctx context.Context, node redis.Cmdable, pattern string) ([]string, error) {
+	var keys []string
+	iter := node.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
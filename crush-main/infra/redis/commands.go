@@ -18,6 +18,11 @@ const (
 	GlobalCommandChannel = "crush:cmd:global"
 	// SessionCommandChannel is the prefix for session-specific commands
 	SessionCommandChannelPrefix = "crush:cmd:session:"
+	// InstanceCommandChannelPrefix is the prefix for commands forwarded to the WS instance owning a session
+	InstanceCommandChannelPrefix = "crush:cmd:instance:"
+	// SessionEventChannelPrefix is the prefix for the messages a WS instance sends to the clients of a session,
+	// relayed to the clients connected to the other instances
+	SessionEventChannelPrefix = "crush:cmd:events:"
 )
 
 // CommandType defines the type of inter-service command
@@ -34,6 +39,24 @@ const (
 	CmdClientMessage CommandType = "client_message"
 	// CmdToolCallUpdate notifies about tool call status updates
 	CmdToolCallUpdate CommandType = "tool_call_update"
+	// CmdProjectPause notifies WS instances that a project entered a maintenance window
+	CmdProjectPause CommandType = "project_pause"
+	// CmdProjectResume notifies WS instances that a project maintenance window ended
+	CmdProjectResume CommandType = "project_resume"
+	// CmdWebhookRun asks a WS instance to run a prompt triggered by an SCM webhook
+	CmdWebhookRun CommandType = "webhook_run"
+	// CmdBlueprintRun asks a WS instance to run the opening prompts of a session blueprint
+	CmdBlueprintRun CommandType = "blueprint_run"
+	// CmdQueueRemove drops a prompt queued behind the running turn of a session
+	CmdQueueRemove CommandType = "queue_remove"
+	// CmdQueueReorder changes the order of the prompts queued for a session
+	CmdQueueReorder CommandType = "queue_reorder"
+	// CmdSessionEvent relays a message sent to the clients of a session to the other WS instances
+	CmdSessionEvent CommandType = "session_event"
+	// CmdFileRevert asks the WS instance running a session to revert a file to an earlier version
+	CmdFileRevert CommandType = "file_revert"
+	// CmdPlanRun runs a prompt in plan mode for the HTTP API, with read-only tools
+	CmdPlanRun CommandType = "plan_run"
 )
 
 // Command represents an inter-service command
@@ -42,33 +65,42 @@ type Command struct {
 	SessionID string          `json:"session_id"`
 	Payload   json.RawMessage `json:"payload"`
 	Timestamp int64           `json:"timestamp"`
-	Source    string          `json:"source"` // "http" or "ws"
+	Source    string          `json:"source"` // "http", "ws" or the ID of the sending WS instance
 }
 
 // CancelPayload is the payload for cancel commands
 type CancelPayload struct {
 	Reason string `json:"reason,omitempty"`
+	Mode   string `json:"mode,omitempty"` // "soft" (default) or "hard"
 }
 
 // PermissionResponsePayload is the payload for permission response commands
 type PermissionResponsePayload struct {
-	ID         string `json:"id"`
-	ToolCallID string `json:"tool_call_id"`
-	Granted    bool   `json:"granted"`
-	Denied     bool   `json:"denied"`
+	ID              string `json:"id"`
+	ToolCallID      string `json:"tool_call_id"`
+	Granted         bool   `json:"granted"`
+	Denied          bool   `json:"denied"`
+	AllowForSession bool   `json:"allow_for_session,omitempty"`
+	ToolName        string `json:"tool_name,omitempty"`
+	Action          string `json:"action,omitempty"`
+	Path            string `json:"path,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	ApprovedHunks   []int  `json:"approved_hunks,omitempty"`
 }
 
 // ClientMessagePayload is the payload for forwarded client messages
 type ClientMessagePayload struct {
-	Type       string          `json:"type"`
-	Content    string          `json:"content"`
-	SessionID  string          `json:"sessionID"`
-	ID         string          `json:"id"`
-	ToolCallID string          `json:"tool_call_id"`
-	Granted    bool            `json:"granted"`
-	Denied     bool            `json:"denied"`
-	Images     json.RawMessage `json:"images,omitempty"`
-	LastMsgID  string          `json:"lastMsgId,omitempty"`
+	Type          string          `json:"type"`
+	Content       string          `json:"content"`
+	SessionID     string          `json:"sessionID"`
+	ID            string          `json:"id"`
+	ToolCallID    string          `json:"tool_call_id"`
+	Granted       bool            `json:"granted"`
+	Denied        bool            `json:"denied"`
+	Reason        string          `json:"reason,omitempty"`
+	ApprovedHunks []int           `json:"approved_hunks,omitempty"`
+	Images        json.RawMessage `json:"images,omitempty"`
+	LastMsgID     string          `json:"lastMsgId,omitempty"`
 }
 
 // ToolCallUpdatePayload is the payload for tool call status updates
@@ -84,6 +116,58 @@ type ToolCallUpdatePayload struct {
 	ErrorMessage string `json:"error_message,omitempty"`
 }
 
+// ProjectPausePayload is the payload for project pause/resume commands
+type ProjectPausePayload struct {
+	ProjectID  string   `json:"project_id"`
+	SessionIDs []string `json:"session_ids,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	Drain      bool     `json:"drain,omitempty"` // Cancel the runs in flight for the listed sessions
+}
+
+// WebhookRunPayload is the payload for webhook triggered agent runs
+type WebhookRunPayload struct {
+	SessionID  string `json:"session_id"`
+	ProjectID  string `json:"project_id"`
+	Prompt     string `json:"prompt"`
+	Provider   string `json:"provider"`
+	EventKind  string `json:"event_kind"`
+	CommentURL string `json:"comment_url,omitempty"` // Set when the result is posted to a pull request
+}
+
+// BlueprintRunPayload is the payload for the opening prompts of a session created from a blueprint
+type BlueprintRunPayload struct {
+	SessionID string   `json:"session_id"`
+	ProjectID string   `json:"project_id"`
+	Blueprint string   `json:"blueprint"`
+	Agent     string   `json:"agent,omitempty"` // Empty runs the prompts with the coder
+	Prompts   []string `json:"prompts"`         // Run one after the other
+}
+
+// QueueCommandPayload is the payload for prompt queue commands
+type QueueCommandPayload struct {
+	SessionID string   `json:"session_id"`
+	PromptID  string   `json:"prompt_id,omitempty"`  // For queue_remove
+	PromptIDs []string `json:"prompt_ids,omitempty"` // For queue_reorder, the new order from the front
+}
+
+// FileRevertPayload is the payload for reverting a file of a session to a recorded version
+type FileRevertPayload struct {
+	ID          string `json:"id"` // Reported back in the file_revert event
+	SessionID   string `json:"session_id"`
+	Path        string `json:"path"`
+	Version     int64  `json:"version"`
+	RequestedBy string `json:"requested_by,omitempty"`
+}
+
+// PlanRunPayload is the payload for prompts run in plan mode through the HTTP API
+type PlanRunPayload struct {
+	ID          string `json:"id"` // The PlanRun holding the result
+	SessionID   string `json:"session_id"`
+	Agent       string `json:"agent,omitempty"` // Empty runs the prompt with the coder
+	Prompt      string `json:"prompt"`
+	RequestedAt int64  `json:"requested_at"`
+}
+
 // CommandService provides Redis pub/sub operations for inter-service communication.
 type CommandService struct {
 	client *Client
@@ -105,11 +189,37 @@ func GetGlobalCommandService() *CommandService {
 
 // sessionCommandChannel returns the Redis channel for session-specific commands.
 func (s *CommandService) sessionCommandChannel(sessionID string) string {
-	return SessionCommandChannelPrefix + sessionID
+	return s.client.key(SessionCommandChannelPrefix + sessionID)
 }
 
 // PublishCommand publishes a command to the appropriate channel.
 func (s *CommandService) PublishCommand(ctx context.Context, cmd Command) error {
+	// Publish to session-specific channel if sessionID is provided
+	channel := s.client.key(GlobalCommandChannel)
+	if cmd.SessionID != "" {
+		channel = s.sessionCommandChannel(cmd.SessionID)
+	}
+	return s.publish(ctx, channel, cmd)
+}
+
+// ForwardToInstance sends a command to a single WS instance, the owner of
+// the command's session.
+func (s *CommandService) ForwardToInstance(ctx context.Context, instanceID string, cmd Command) error {
+	return s.publish(ctx, s.client.key(InstanceCommandChannelPrefix+instanceID), cmd)
+}
+
+// PublishSessionEvent relays an encoded message sent to the clients of a
+// session by the source WS instance to the other instances.
+func (s *CommandService) PublishSessionEvent(ctx context.Context, source, sessionID string, msg []byte) error {
+	return s.publish(ctx, s.client.key(SessionEventChannelPrefix+sessionID), Command{
+		Type:      CmdSessionEvent,
+		SessionID: sessionID,
+		Payload:   msg,
+		Source:    source,
+	})
+}
+
+func (s *CommandService) publish(ctx context.Context, channel string, cmd Command) error {
 	cmd.Timestamp = time.Now().UnixMilli()
 
 	cmdJSON, err := json.Marshal(cmd)
@@ -117,12 +227,6 @@ func (s *CommandService) PublishCommand(ctx context.Context, cmd Command) error
 		return fmt.Errorf("failed to marshal command: %w", err)
 	}
 
-	// Publish to session-specific channel if sessionID is provided
-	channel := GlobalCommandChannel
-	if cmd.SessionID != "" {
-		channel = s.sessionCommandChannel(cmd.SessionID)
-	}
-
 	err = s.client.rdb.Publish(ctx, channel, string(cmdJSON)).Err()
 	if err != nil {
 		return fmt.Errorf("failed to publish command: %w", err)
@@ -181,6 +285,93 @@ func (s *CommandService) PublishToolCallUpdate(ctx context.Context, update ToolC
 	})
 }
 
+// PublishProjectPause broadcasts that a project was paused.
+func (s *CommandService) PublishProjectPause(ctx context.Context, pause ProjectPausePayload) error {
+	payload, _ := json.Marshal(pause)
+	return s.PublishCommand(ctx, Command{
+		Type:    CmdProjectPause,
+		Payload: payload,
+		Source:  "http",
+	})
+}
+
+// PublishProjectResume broadcasts that a project was resumed.
+func (s *CommandService) PublishProjectResume(ctx context.Context, projectID string) error {
+	payload, _ := json.Marshal(ProjectPausePayload{ProjectID: projectID})
+	return s.PublishCommand(ctx, Command{
+		Type:    CmdProjectResume,
+		Payload: payload,
+		Source:  "http",
+	})
+}
+
+// PublishWebhookRun broadcasts a webhook triggered run for a freshly created session.
+// The command goes to the global channel because no WS instance owns the session yet,
+// the instance that claims it first runs the prompt.
+func (s *CommandService) PublishWebhookRun(ctx context.Context, run WebhookRunPayload) error {
+	payload, _ := json.Marshal(run)
+	return s.PublishCommand(ctx, Command{
+		Type:    CmdWebhookRun,
+		Payload: payload,
+		Source:  "http",
+	})
+}
+
+// PublishBlueprintRun broadcasts the opening prompts of a session created from a blueprint.
+// Like webhook runs it goes to the global channel and is run by the instance that claims it.
+func (s *CommandService) PublishBlueprintRun(ctx context.Context, run BlueprintRunPayload) error {
+	payload, _ := json.Marshal(run)
+	return s.PublishCommand(ctx, Command{
+		Type:    CmdBlueprintRun,
+		Payload: payload,
+		Source:  "http",
+	})
+}
+
+// PublishQueueCommand broadcasts a change of the prompt queue of a session.
+// The queue lives in the memory of the WS instance running the session, the
+// other instances ignore the command.
+func (s *CommandService) PublishQueueCommand(ctx context.Context, cmdType CommandType, payload QueueCommandPayload) error {
+	data, _ := json.Marshal(payload)
+	return s.PublishCommand(ctx, Command{
+		Type:    cmdType,
+		Payload: data,
+		Source:  "http",
+	})
+}
+
+// PublishFileRevert broadcasts the revert of a file of a session. The WS
+// instance owning the session asks its clients for permission and writes it.
+func (s *CommandService) PublishFileRevert(ctx context.Context, revert FileRevertPayload) error {
+	payload, _ := json.Marshal(revert)
+	return s.PublishCommand(ctx, Command{
+		Type:    CmdFileRevert,
+		Payload: payload,
+		Source:  "http",
+	})
+}
+
+// PublishPlanRun broadcasts a prompt to run in plan mode, run by the instance
+// that claims it. The result is stored as a PlanRun.
+func (s *CommandService) PublishPlanRun(ctx context.Context, run PlanRunPayload) error {
+	payload, _ := json.Marshal(run)
+	return s.PublishCommand(ctx, Command{
+		Type:    CmdPlanRun,
+		Payload: payload,
+		Source:  "http",
+	})
+}
+
+// ClaimCommand marks a broadcast command as taken so that only one WS
+// instance acts on it. It reports whether the caller won the claim.
+func (s *CommandService) ClaimCommand(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ok, err := s.client.rdb.SetNX(ctx, s.client.key(CommandChannelPrefix+"claim:"+key), "1", ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim command: %w", err)
+	}
+	return ok, nil
+}
+
 // CommandHandler is a callback function for handling received commands
 type CommandHandler func(cmd Command)
 
@@ -192,7 +383,7 @@ func (s *CommandService) SubscribeCommands(ctx context.Context, sessionIDs []str
 	// Build list of channels to subscribe
 	channels := make([]string, 0, len(sessionIDs)+1)
 	if includeGlobal {
-		channels = append(channels, GlobalCommandChannel)
+		channels = append(channels, s.client.key(GlobalCommandChannel))
 	}
 	for _, sid := range sessionIDs {
 		channels = append(channels, s.sessionCommandChannel(sid))
@@ -202,7 +393,7 @@ func (s *CommandService) SubscribeCommands(ctx context.Context, sessionIDs []str
 	var pubsub *redis.PubSub
 	if len(sessionIDs) == 0 && includeGlobal {
 		// Subscribe to global channel and use pattern for session channels
-		pubsub = s.client.rdb.PSubscribe(ctx, GlobalCommandChannel, SessionCommandChannelPrefix+"*")
+		pubsub = s.client.rdb.PSubscribe(ctx, s.client.key(GlobalCommandChannel), s.client.key(SessionCommandChannelPrefix+"*"))
 	} else if len(channels) > 0 {
 		pubsub = s.client.rdb.Subscribe(ctx, channels...)
 	} else {
@@ -210,6 +401,11 @@ func (s *CommandService) SubscribeCommands(ctx context.Context, sessionIDs []str
 		return cmdChan, func() {}
 	}
 
+	return s.consume(ctx, pubsub, cmdChan)
+}
+
+// consume forwards the commands received on pubsub to cmdChan until the returned cancel function is called.
+func (s *CommandService) consume(ctx context.Context, pubsub *redis.PubSub, cmdChan chan Command) (<-chan Command, func()) {
 	subCtx, cancel := context.WithCancel(ctx)
 
 	go func() {
@@ -246,6 +442,23 @@ func (s *CommandService) SubscribeCommands(ctx context.Context, sessionIDs []str
 	return cmdChan, cancel
 }
 
+// SubscribeGlobalCommands subscribes to the global channel only.
+func (s *CommandService) SubscribeGlobalCommands(ctx context.Context) (<-chan Command, func()) {
+	return s.consume(ctx, s.client.rdb.Subscribe(ctx, s.client.key(GlobalCommandChannel)), make(chan Command, 100))
+}
+
+// SubscribeInstanceCommands subscribes to the commands forwarded to a WS instance.
+func (s *CommandService) SubscribeInstanceCommands(ctx context.Context, instanceID string) (<-chan Command, func()) {
+	return s.consume(ctx, s.client.rdb.Subscribe(ctx, s.client.key(InstanceCommandChannelPrefix+instanceID)), make(chan Command, 100))
+}
+
+// SubscribeSessionEvents subscribes to the session messages relayed by all WS
+// instances. The buffer is larger than for commands as streaming sends many
+// small messages; clients backfill the ones dropped from their sequence numbers.
+func (s *CommandService) SubscribeSessionEvents(ctx context.Context) (<-chan Command, func()) {
+	return s.consume(ctx, s.client.rdb.PSubscribe(ctx, s.client.key(SessionEventChannelPrefix+"*")), make(chan Command, 1000))
+}
+
 // SubscribeSessionCommands subscribes to commands for a specific session.
 func (s *CommandService) SubscribeSessionCommands(ctx context.Context, sessionID string) (<-chan Command, func()) {
 	return s.SubscribeCommands(ctx, []string{sessionID}, false)
@@ -289,12 +502,12 @@ type ToolCallState struct {
 
 // toolCallKey returns the Redis key for a tool call
 func (s *CommandService) toolCallKey(sessionID, toolCallID string) string {
-	return ToolCallKeyPrefix + sessionID + ":" + toolCallID
+	return s.client.key(ToolCallKeyPrefix + sessionID + ":" + toolCallID)
 }
 
 // sessionToolCallsKey returns the Redis key for session tool calls set
 func (s *CommandService) sessionToolCallsKey(sessionID string) string {
-	return ToolCallKeyPrefix + sessionID + ":all"
+	return s.client.key(ToolCallKeyPrefix + sessionID + ":all")
 }
 
 // SetToolCallState sets the tool call state in Redis
@@ -319,6 +532,11 @@ func (s *CommandService) SetToolCallState(ctx context.Context, state ToolCallSta
 		return fmt.Errorf("failed to add tool call to session set: %w", err)
 	}
 
+	// Both are deleted once the turn finished
+	if err := s.client.trackTurnKeys(ctx, state.SessionID, key, s.sessionToolCallsKey(state.SessionID)); err != nil {
+		return err
+	}
+
 	slog.Debug("Tool call state updated in Redis",
 		"tool_call_id", state.ID,
 		"session_id", state.SessionID,
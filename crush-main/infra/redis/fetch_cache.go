@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FetchCacheKeyPrefix stores pages fetched by the fetch tool
+const FetchCacheKeyPrefix = "crush:fetch:"
+
+// FetchCache shares the pages fetched by the fetch tool between sessions and
+// instances. It implements tools.FetchCache.
+type FetchCache struct {
+	client *Client
+}
+
+// NewFetchCache creates a fetch cache backed by the Redis client.
+func NewFetchCache(client *Client) *FetchCache {
+	return &FetchCache{client: client}
+}
+
+// Get returns the cached value, or nil if the key is missing.
+func (c *FetchCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.client.rdb.Get(ctx, c.client.key(FetchCacheKeyPrefix+key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fetch cache entry: %w", err)
+	}
+	return value, nil
+}
+
+// Set stores a value for the given TTL.
+func (c *FetchCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := c.client.rdb.Set(ctx, c.client.key(FetchCacheKeyPrefix+key), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set fetch cache entry: %w", err)
+	}
+	return nil
+}
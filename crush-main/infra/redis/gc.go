@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// TurnKeysKeyPrefix is the set of the keys written during the turns of a
+	// session, deleted once a turn finished
+	TurnKeysKeyPrefix = "crush:turnkeys:"
+	// turnKeysTTL outlives the keys recorded in the set
+	turnKeysTTL = 24 * time.Hour
+)
+
+func (c *Client) turnKeysKey(sessionID string) string {
+	return c.key(TurnKeysKeyPrefix + sessionID)
+}
+
+// trackTurnKeys records keys to delete once the running turn of a session
+// finished, see CollectTurnKeys.
+func (c *Client) trackTurnKeys(ctx context.Context, sessionID string, keys ...string) error {
+	members := make([]any, len(keys))
+	for i, key := range keys {
+		members[i] = key
+	}
+	pipe := c.rdb.Pipeline()
+	pipe.SAdd(ctx, c.turnKeysKey(sessionID), members...)
+	pipe.Expire(ctx, c.turnKeysKey(sessionID), turnKeysTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to track turn keys: %w", err)
+	}
+	return nil
+}
+
+// CollectTurnKeys deletes the keys recorded during the finished turn of a
+// session, the tool call states and the decided permission requests, rather
+// than leaving them to their TTLs, and returns how many were deleted. The
+// stream, sequence and allowlist of the session are kept for the next turns,
+// so are the permission requests still pending and the parameters of the
+// permission requests, a suspended tool call may be granted after the turn.
+func (s *StreamService) CollectTurnKeys(ctx context.Context, sessionID string) (int, error) {
+	setKey := s.client.turnKeysKey(sessionID)
+	keys, err := s.client.rdb.SMembers(ctx, setKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get turn keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	deleted, err := s.deleteKeys(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	// Only the collected members, others may have been recorded meanwhile
+	members := make([]any, len(keys))
+	for i, key := range keys {
+		members[i] = key
+	}
+	if err := s.client.rdb.SRem(ctx, setKey, members...).Err(); err != nil {
+		return deleted, fmt.Errorf("failed to untrack turn keys: %w", err)
+	}
+	return deleted, nil
+}
+
+// sessionKeyPrefix is the prefix of keys named after a session, the session
+// ID follows the prefix. Slotted keys carry a hash tag in cluster mode.
+type sessionKeyPrefix struct {
+	prefix  string
+	slotted bool
+}
+
+var sessionKeyPrefixes = []sessionKeyPrefix{
+	{StreamKeyPrefix, true},
+	{SequenceKeyPrefix, true},
+	{SessionOwnerKeyPrefix, true},
+	{ConnectionKeyPrefix, false},
+	{LastReadKeyPrefix, false},
+	{ActiveGenerationKeyPrefix, false},
+	{SessionRunningStatusKeyPrefix, false},
+	{SessionToolAllowlistKeyPrefix, false},
+	{PresenceKeyPrefix, false},
+	{TypingKeyPrefix, false},
+	{QueueKeyPrefix, false},
+	{PendingPermissionKeyPrefix, false},
+	{PermissionParamsKeyPrefix, false},
+	{ToolCallKeyPrefix, false},
+	{TurnKeysKeyPrefix, false},
+	{PlanKeyPrefix, false},
+	{GenerationCacheKeyPrefix, false},
+	{IdempotencyKeyPrefix + PromptIdempotencyScope(""), false},
+}
+
+// CountKeysBySession scans the keys named after a session and returns how
+// many each session has. Callers compare the sessions with the database to
+// find the keys left behind by deleted sessions.
+func (s *StreamService) CountKeysBySession(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int)
+	namespace := s.client.key("")
+	for _, p := range sessionKeyPrefixes {
+		pattern := s.client.key(p.prefix + "*")
+		if p.slotted {
+			pattern = s.client.slotKey("*", p.prefix+"*")
+		}
+		keys, err := s.client.scanKeys(ctx, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s keys: %w", p.prefix, err)
+		}
+		for _, key := range keys {
+			if sessionID := keySessionID(key, namespace, p.prefix); sessionID != "" {
+				counts[sessionID]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// keySessionID returns the session ID of a key, removing the namespace, the
+// hash tag, the prefix and what follows the ID, e.g. a tool call ID.
+func keySessionID(key, namespace, prefix string) string {
+	key = strings.TrimPrefix(key, namespace)
+	if strings.HasPrefix(key, "{") {
+		_, key, _ = strings.Cut(key, "}")
+	}
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok {
+		return ""
+	}
+	sessionID, _, _ := strings.Cut(rest, ":")
+	return sessionID
+}
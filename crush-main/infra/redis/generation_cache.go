@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GenerationCacheKeyPrefix stores the titles and summaries generated for a
+// session, keyed on the hash of their content.
+const GenerationCacheKeyPrefix = "crush:gencache:"
+
+// GenerationCache shares the titles and summaries of a session between the
+// replays of its turns and the instances serving it. It implements
+// agent.GenerationCache.
+type GenerationCache struct {
+	client *Client
+}
+
+// NewGenerationCache creates a generation cache backed by the Redis client.
+func NewGenerationCache(client *Client) *GenerationCache {
+	return &GenerationCache{client: client}
+}
+
+func (c *GenerationCache) entryKey(sessionID, key string) string {
+	return c.client.key(GenerationCacheKeyPrefix + sessionID + ":" + key)
+}
+
+// Get returns the cached generation, or nil if the key is missing.
+func (c *GenerationCache) Get(ctx context.Context, sessionID, key string) ([]byte, error) {
+	value, err := c.client.rdb.Get(ctx, c.entryKey(sessionID, key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get generation cache entry: %w", err)
+	}
+	return value, nil
+}
+
+// Set stores a generation for the given TTL.
+func (c *GenerationCache) Set(ctx context.Context, sessionID, key string, value []byte, ttl time.Duration) error {
+	if err := c.client.rdb.Set(ctx, c.entryKey(sessionID, key), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set generation cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// Health statuses of a Redis deployment.
+const (
+	HealthOK = "ok"
+	// HealthDegraded is a deployment answering with some of its nodes down,
+	// e.g. a replica or a sentinel.
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// Health is the state of the Redis deployment and of each of its nodes.
+type Health struct {
+	Mode      string
+	Status    string
+	LatencyMs int64
+	Error     string
+	Nodes     []NodeHealth
+}
+
+// NodeHealth is the state of a Redis node.
+type NodeHealth struct {
+	Addr      string
+	Role      string // master, replica or sentinel
+	Status    string
+	LatencyMs int64
+	Error     string
+	// Master is the master address reported by a sentinel.
+	Master string
+}
+
+// Health pings the deployment, then each of its nodes: the masters and
+// replicas of a cluster, or the sentinels with the master they report.
+func (c *Client) Health(ctx context.Context) Health {
+	health := Health{Mode: c.Mode(), Status: HealthOK}
+	start := time.Now()
+	if err := c.rdb.Ping(ctx).Err(); err != nil {
+		health.Status = HealthDown
+		health.Error = err.Error()
+	}
+	health.LatencyMs = time.Since(start).Milliseconds()
+
+	switch c.cfg.Mode {
+	case config.RedisModeCluster:
+		health.Nodes = c.clusterNodesHealth(ctx)
+	case config.RedisModeSentinel:
+		health.Nodes = c.sentinelsHealth(ctx)
+	default:
+		health.Nodes = []NodeHealth{{
+			Addr:      net.JoinHostPort(c.cfg.Host, fmt.Sprint(c.cfg.Port)),
+			Role:      "master",
+			Status:    health.Status,
+			LatencyMs: health.LatencyMs,
+			Error:     health.Error,
+		}}
+	}
+	for _, node := range health.Nodes {
+		if node.Status != HealthOK && health.Status == HealthOK {
+			health.Status = HealthDegraded
+		}
+	}
+	return health
+}
+
+// clusterNodesHealth pings the masters and replicas of the cluster.
+func (c *Client) clusterNodesHealth(ctx context.Context) []NodeHealth {
+	cluster, ok := c.rdb.(*redis.ClusterClient)
+	if !ok {
+		return nil
+	}
+	var (
+		mu    sync.Mutex
+		nodes []NodeHealth
+	)
+	probe := func(role string) func(ctx context.Context, node *redis.Client) error {
+		return func(ctx context.Context, node *redis.Client) error {
+			result := pingNode(ctx, node, role)
+			mu.Lock()
+			nodes = append(nodes, result)
+			mu.Unlock()
+			return nil
+		}
+	}
+	// The errors are reported per node, the cluster may not have replicas
+	_ = cluster.ForEachMaster(ctx, probe("master"))
+	_ = cluster.ForEachSlave(ctx, probe("replica"))
+	return nodes
+}
+
+// sentinelsHealth asks each sentinel for the address of the master.
+func (c *Client) sentinelsHealth(ctx context.Context) []NodeHealth {
+	nodes := make([]NodeHealth, len(c.cfg.Addrs))
+	var wg sync.WaitGroup
+	for i, addr := range c.cfg.Addrs {
+		wg.Go(func() {
+			sentinel := redis.NewSentinelClient(&redis.Options{Addr: addr, Password: c.cfg.SentinelPassword})
+			defer sentinel.Close()
+			node := NodeHealth{Addr: addr, Role: "sentinel", Status: HealthOK}
+			start := time.Now()
+			master, err := sentinel.GetMasterAddrByName(ctx, c.cfg.MasterName).Result()
+			node.LatencyMs = time.Since(start).Milliseconds()
+			if err != nil {
+				node.Status = HealthDown
+				node.Error = err.Error()
+			} else if len(master) == 2 {
+				node.Master = net.JoinHostPort(master[0], master[1])
+			}
+			nodes[i] = node
+		})
+	}
+	wg.Wait()
+	return nodes
+}
+
+func pingNode(ctx context.Context, node *redis.Client, role string) NodeHealth {
+	result := NodeHealth{Addr: node.Options().Addr, Role: role, Status: HealthOK}
+	start := time.Now()
+	if err := node.Ping(ctx).Err(); err != nil {
+		result.Status = HealthDown
+		result.Error = err.Error()
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	return result
+}
@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyKeyPrefix holds the results of the requests sent with an
+// idempotency key, per scope and key
+const IdempotencyKeyPrefix = "crush:idempotency:"
+
+const (
+	// IdempotencyTTL is how long the result of a request is replayed to its
+	// retries.
+	IdempotencyTTL = 24 * time.Hour
+	// idempotencyPendingTTL bounds the reservation of a request still being
+	// handled, so that the retries of a request lost with its instance are
+	// eventually handled again.
+	idempotencyPendingTTL = 5 * time.Minute
+)
+
+// IdempotentResult is the result of the first request sent with an
+// idempotency key. Until the request is handled it is pending, without result.
+type IdempotentResult struct {
+	Pending bool `json:"pending,omitempty"`
+	// Fingerprint identifies the request, a retry with another fingerprint
+	// reuses the key for a different request.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// PromptIdempotencyScope scopes the idempotency keys of the prompts of a
+// session, purged with the session.
+func PromptIdempotencyScope(sessionID string) string {
+	return "prompt:" + sessionID
+}
+
+func (s *StreamService) idempotencyKey(scope, key string) string {
+	return s.client.key(IdempotencyKeyPrefix + scope + ":" + key)
+}
+
+// ReserveIdempotencyKey reserves key in scope for a request identified by
+// fingerprint. It returns nil when the request is the first with the key and
+// must be handled, then completed with CompleteIdempotencyKey or released with
+// ReleaseIdempotencyKey. Otherwise it returns the result of the first request,
+// pending while it is handled.
+func (s *StreamService) ReserveIdempotencyKey(ctx context.Context, scope, key, fingerprint string) (*IdempotentResult, error) {
+	pending, err := json.Marshal(IdempotentResult{
+		Pending:     true,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal idempotency reservation: %w", err)
+	}
+	redisKey := s.idempotencyKey(scope, key)
+	// The first request may complete or expire between SETNX and GET, then
+	// the key is reserved again
+	for range 2 {
+		reserved, err := s.client.rdb.SetNX(ctx, redisKey, pending, idempotencyPendingTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+		if reserved {
+			return nil, nil
+		}
+		data, err := s.client.rdb.Get(ctx, redisKey).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotent result: %w", err)
+		}
+		var result IdempotentResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal idempotent result: %w", err)
+		}
+		return &result, nil
+	}
+	return nil, fmt.Errorf("failed to reserve idempotency key %q", key)
+}
+
+// CompleteIdempotencyKey stores the result of the request holding key in
+// scope, replayed to its retries for IdempotencyTTL.
+func (s *StreamService) CompleteIdempotencyKey(ctx context.Context, scope, key string, result IdempotentResult) error {
+	result.Pending = false
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotent result: %w", err)
+	}
+	if err := s.client.rdb.Set(ctx, s.idempotencyKey(scope, key), data, IdempotencyTTL).Err(); err != nil {
+		return fmt.Errorf("failed to set idempotent result: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey drops the reservation of key in scope, e.g. after a
+// failure worth retrying, so that the next request with it is handled.
+func (s *StreamService) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	if err := s.client.rdb.Del(ctx, s.idempotencyKey(scope, key)).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
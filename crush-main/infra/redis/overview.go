@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Ping checks that Redis answers.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
+// CountRunningSessions returns how many sessions have an agent run in progress
+// across the deployment.
+func (s *StreamService) CountRunningSessions(ctx context.Context) (int, error) {
+	return s.countKeysWithValue(ctx, SessionRunningStatusKeyPrefix, string(SessionStatusRunning))
+}
+
+// CountConnectedSessions returns how many sessions have a WebSocket client
+// connected across the deployment.
+func (s *StreamService) CountConnectedSessions(ctx context.Context) (int, error) {
+	return s.countKeysWithValue(ctx, ConnectionKeyPrefix, "1")
+}
+
+// countKeysWithValue counts the keys with a prefix holding value. The values
+// are read after the scan, so the count may be slightly off while they change.
+func (s *StreamService) countKeysWithValue(ctx context.Context, prefix, value string) (int, error) {
+	keys, err := s.client.scanKeys(ctx, s.client.key(prefix)+"*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan %s keys: %w", prefix, err)
+	}
+	count := 0
+	for batch := range slices.Chunk(keys, 100) {
+		// One GET per key, MGET needs the keys in one hash slot of a cluster
+		pipe := s.client.rdb.Pipeline()
+		gets := make([]*redis.StringCmd, len(batch))
+		for i, key := range batch {
+			gets[i] = pipe.Get(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return 0, fmt.Errorf("failed to read %s keys: %w", prefix, err)
+		}
+		for _, get := range gets {
+			if get.Val() == value {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,223 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// InstancesKey is a sorted set of the live WS instances, scored by their last heartbeat
+	InstancesKey = "crush:instances"
+	// InstanceKeyPrefix is the prefix of the set of sessions owned by a WS instance
+	InstanceKeyPrefix = "crush:instance:"
+	// SessionOwnerKeyPrefix maps a session to the WS instance that runs its agent
+	SessionOwnerKeyPrefix = "crush:owner:session:"
+	// InstanceTTL is how long an instance is considered alive without a heartbeat.
+	// Its sessions can be taken over by other instances afterwards.
+	InstanceTTL = 30 * time.Second
+)
+
+// claimSessionScript gives a session to the claiming instance unless a live
+// instance owns it already, and returns the owner.
+var claimSessionScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+  local seen = redis.call('ZSCORE', KEYS[3], owner)
+  if seen and tonumber(seen) >= tonumber(ARGV[3]) then
+    return owner
+  end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('SADD', KEYS[2], ARGV[4])
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+return ARGV[1]
+`)
+
+// releaseSessionScript removes the owner of a session if it is the releasing instance.
+var releaseSessionScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  redis.call('DEL', KEYS[1])
+end
+redis.call('SREM', KEYS[2], ARGV[2])
+return 1
+`)
+
+// refreshSessionsScript extends the ownership of the sessions of an
+// instance in one call, and forgets the sessions other instances took over.
+// KEYS[1] is the set of the sessions of the instance, the owner keys of the
+// sessions in ARGV[3:] follow.
+var refreshSessionsScript = redis.NewScript(`
+local kept = 0
+for i = 2, #KEYS do
+  if redis.call('GET', KEYS[i]) == ARGV[1] then
+    redis.call('PEXPIRE', KEYS[i], ARGV[2])
+    kept = kept + 1
+  else
+    redis.call('SREM', KEYS[1], ARGV[i + 1])
+  end
+end
+return kept
+`)
+
+// OwnershipService tracks which WS instance owns each session, so that
+// several WS instances can run behind a load balancer. The owner of a session
+// runs its agent; the other instances forward the cancel, permission and
+// prompt messages of their clients to it.
+type OwnershipService struct {
+	client     *Client
+	instanceID string
+}
+
+// NewOwnershipService creates an ownership service for a WS instance.
+func NewOwnershipService(client *Client, instanceID string) *OwnershipService {
+	return &OwnershipService{client: client, instanceID: instanceID}
+}
+
+// InstanceID returns the ID of the instance the service claims sessions for.
+func (s *OwnershipService) InstanceID() string {
+	return s.instanceID
+}
+
+// ownershipSlot groups the ownership keys in one hash slot of a cluster, as
+// the ownership scripts use the keys of sessions and instances together.
+const ownershipSlot = "ownership"
+
+func (s *OwnershipService) ownerKey(sessionID string) string {
+	return s.client.slotKey(ownershipSlot, SessionOwnerKeyPrefix+sessionID)
+}
+
+func (s *OwnershipService) sessionsKey(instanceID string) string {
+	return s.client.slotKey(ownershipSlot, InstanceKeyPrefix+instanceID+":sessions")
+}
+
+func (s *OwnershipService) instancesKey() string {
+	return s.client.slotKey(ownershipSlot, InstancesKey)
+}
+
+// liveSince is the oldest heartbeat of a live instance.
+func liveSince() int64 {
+	return time.Now().Add(-InstanceTTL).UnixMilli()
+}
+
+// Heartbeat marks the instance as alive and extends the ownership of its
+// sessions. The instances release the sessions they are done with, so that
+// only the sessions with a running turn or clients are refreshed.
+func (s *OwnershipService) Heartbeat(ctx context.Context) error {
+	instancesKey := s.instancesKey()
+	pipe := s.client.rdb.Pipeline()
+	pipe.ZAdd(ctx, instancesKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: s.instanceID})
+	pipe.ZRemRangeByScore(ctx, instancesKey, "-inf", "("+strconv.FormatInt(liveSince(), 10))
+	pipe.PExpire(ctx, s.sessionsKey(s.instanceID), InstanceTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+
+	sessionIDs, err := s.InstanceSessions(ctx, s.instanceID)
+	if err != nil {
+		return err
+	}
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(sessionIDs)+1)
+	args := make([]any, 0, len(sessionIDs)+2)
+	keys = append(keys, s.sessionsKey(s.instanceID))
+	args = append(args, s.instanceID, InstanceTTL.Milliseconds())
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, s.ownerKey(sessionID))
+		args = append(args, sessionID)
+	}
+	if err := refreshSessionsScript.Run(ctx, s.client.rdb, keys, args...).Err(); err != nil {
+		return fmt.Errorf("failed to refresh session ownership: %w", err)
+	}
+	return nil
+}
+
+// Claim makes the instance the owner of a session unless another live
+// instance owns it, and returns the owner.
+func (s *OwnershipService) Claim(ctx context.Context, sessionID string) (string, error) {
+	keys := []string{s.ownerKey(sessionID), s.sessionsKey(s.instanceID), s.instancesKey()}
+	owner, err := claimSessionScript.Run(ctx, s.client.rdb, keys,
+		s.instanceID, InstanceTTL.Milliseconds(), liveSince(), sessionID).Text()
+	if err != nil {
+		return "", fmt.Errorf("failed to claim session: %w", err)
+	}
+	return owner, nil
+}
+
+// Owner returns the live instance owning a session, empty when it has none.
+func (s *OwnershipService) Owner(ctx context.Context, sessionID string) (string, error) {
+	owner, err := s.client.rdb.Get(ctx, s.ownerKey(sessionID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get session owner: %w", err)
+	}
+	if owner == s.instanceID {
+		return owner, nil
+	}
+	seen, err := s.client.rdb.ZScore(ctx, s.instancesKey(), owner).Result()
+	if err == redis.Nil || (err == nil && int64(seen) < liveSince()) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check session owner: %w", err)
+	}
+	return owner, nil
+}
+
+// Release gives up the ownership of a session.
+func (s *OwnershipService) Release(ctx context.Context, sessionID string) error {
+	keys := []string{s.ownerKey(sessionID), s.sessionsKey(s.instanceID)}
+	if err := releaseSessionScript.Run(ctx, s.client.rdb, keys, s.instanceID, sessionID).Err(); err != nil {
+		return fmt.Errorf("failed to release session: %w", err)
+	}
+	return nil
+}
+
+// ReleaseAll gives up the sessions of the instance and removes it from the
+// live instances, on shutdown.
+func (s *OwnershipService) ReleaseAll(ctx context.Context) error {
+	sessionIDs, err := s.InstanceSessions(ctx, s.instanceID)
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		if err := s.Release(ctx, sessionID); err != nil {
+			return err
+		}
+	}
+	pipe := s.client.rdb.Pipeline()
+	pipe.ZRem(ctx, s.instancesKey(), s.instanceID)
+	pipe.Del(ctx, s.sessionsKey(s.instanceID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to remove instance: %w", err)
+	}
+	return nil
+}
+
+// InstanceSessions returns the sessions owned by an instance.
+func (s *OwnershipService) InstanceSessions(ctx context.Context, instanceID string) ([]string, error) {
+	sessionIDs, err := s.client.rdb.SMembers(ctx, s.sessionsKey(instanceID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instance sessions: %w", err)
+	}
+	return sessionIDs, nil
+}
+
+// LiveInstances returns the IDs of the live WS instances.
+func (s *OwnershipService) LiveInstances(ctx context.Context) ([]string, error) {
+	instances, err := s.client.rdb.ZRangeByScore(ctx, s.instancesKey(), &redis.ZRangeBy{
+		Min: strconv.FormatInt(liveSince(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	return instances, nil
+}
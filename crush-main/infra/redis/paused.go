@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// PausedPromptsKeyPrefix holds the prompts queued while a project is
+	// paused, in order, until the project resumes
+	PausedPromptsKeyPrefix = "crush:paused:project:"
+	// PausedProjectsKey is the set of the projects with queued prompts
+	PausedProjectsKey = "crush:paused:projects"
+)
+
+func (s *StreamService) pausedPromptsKey(projectID string) string {
+	return s.client.key(PausedPromptsKeyPrefix + projectID)
+}
+
+// HoldPausedPrompt queues a prompt behind the others of a paused project and
+// returns how many are queued.
+func (s *StreamService) HoldPausedPrompt(ctx context.Context, projectID string, prompt []byte) (int, error) {
+	n, err := s.client.rdb.RPush(ctx, s.pausedPromptsKey(projectID), prompt).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue paused prompt: %w", err)
+	}
+	if err := s.client.rdb.SAdd(ctx, s.client.key(PausedProjectsKey), projectID).Err(); err != nil {
+		return 0, fmt.Errorf("failed to record paused project: %w", err)
+	}
+	return int(n), nil
+}
+
+// TakePausedPrompts removes and returns the prompts queued for a project.
+// When several instances take them at once, only one gets them. The project
+// is forgotten in the same transaction, so that the prompts are not lost when
+// it fails.
+func (s *StreamService) TakePausedPrompts(ctx context.Context, projectID string) ([][]byte, error) {
+	key := s.pausedPromptsKey(projectID)
+	pipe := s.client.rdb.TxPipeline()
+	values := pipe.LRange(ctx, key, 0, -1)
+	pipe.Del(ctx, key)
+	pipe.SRem(ctx, s.client.key(PausedProjectsKey), projectID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to take paused prompts: %w", err)
+	}
+	prompts := make([][]byte, 0, len(values.Val()))
+	for _, value := range values.Val() {
+		prompts = append(prompts, []byte(value))
+	}
+	return prompts, nil
+}
+
+// PausedProjects returns the projects with queued prompts.
+func (s *StreamService) PausedProjects(ctx context.Context) ([]string, error) {
+	projectIDs, err := s.client.rdb.SMembers(ctx, s.client.key(PausedProjectsKey)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paused projects: %w", err)
+	}
+	return projectIDs, nil
+}
@@ -0,0 +1,47 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PermissionParamsKeyPrefix holds the full parameters of the permission
+// requests sent redacted to clients, per session and tool call
+const PermissionParamsKeyPrefix = "crush:permission:params:"
+
+// PermissionParamsTTL is how long the full parameters of a permission request
+// can be fetched, past the permission timeout so that they outlive the request.
+const PermissionParamsTTL = time.Hour
+
+func (s *StreamService) permissionParamsKey(sessionID, toolCallID string) string {
+	return s.client.key(PermissionParamsKeyPrefix + sessionID + ":" + toolCallID)
+}
+
+// SetPermissionParams stores the full parameters of a permission request.
+func (s *StreamService) SetPermissionParams(ctx context.Context, sessionID, toolCallID string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal permission params: %w", err)
+	}
+	if err := s.client.rdb.Set(ctx, s.permissionParamsKey(sessionID, toolCallID), data, PermissionParamsTTL).Err(); err != nil {
+		return fmt.Errorf("failed to set permission params: %w", err)
+	}
+	return nil
+}
+
+// GetPermissionParams returns the full parameters of a permission request as
+// JSON, nil when they are unknown or expired.
+func (s *StreamService) GetPermissionParams(ctx context.Context, sessionID, toolCallID string) (json.RawMessage, error) {
+	data, err := s.client.rdb.Get(ctx, s.permissionParamsKey(sessionID, toolCallID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permission params: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PlanKeyPrefix holds the plan runs requested through the HTTP API, per
+// session and run ID
+const PlanKeyPrefix = "crush:plan:session:"
+
+// PlanRunTTL is how long the result of a plan run can be fetched.
+const PlanRunTTL = time.Hour
+
+// Plan run statuses.
+const (
+	PlanStatusPending = "pending"
+	PlanStatusRunning = "running"
+	PlanStatusDone    = "done"
+	PlanStatusFailed  = "failed"
+)
+
+// PlanRun is a prompt run in plan mode and, once done, the plan the agent
+// answered with.
+type PlanRun struct {
+	ID          string `json:"id"`
+	SessionID   string `json:"session_id"`
+	Status      string `json:"status"`
+	Plan        string `json:"plan,omitempty"`
+	Error       string `json:"error,omitempty"`
+	RequestedAt int64  `json:"requested_at"`
+	FinishedAt  int64  `json:"finished_at,omitempty"`
+}
+
+func (s *StreamService) planKey(sessionID, id string) string {
+	return s.client.key(PlanKeyPrefix + sessionID + ":" + id)
+}
+
+// SetPlanRun stores the state of a plan run.
+func (s *StreamService) SetPlanRun(ctx context.Context, run PlanRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan run: %w", err)
+	}
+	if err := s.client.rdb.Set(ctx, s.planKey(run.SessionID, run.ID), string(data), PlanRunTTL).Err(); err != nil {
+		return fmt.Errorf("failed to set plan run: %w", err)
+	}
+	return nil
+}
+
+// GetPlanRun returns a plan run of a session, nil when it is unknown or expired.
+func (s *StreamService) GetPlanRun(ctx context.Context, sessionID, id string) (*PlanRun, error) {
+	data, err := s.client.rdb.Get(ctx, s.planKey(sessionID, id)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan run: %w", err)
+	}
+	var run PlanRun
+	if err := json.Unmarshal([]byte(data), &run); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal plan run: %w", err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// PresenceKeyPrefix tracks the editor presence of the connections
+	// following a session, by connection ID
+	PresenceKeyPrefix = "crush:presence:session:"
+	// PresenceTTL is how long a presence entry lives without a heartbeat.
+	// Clients resend their presence at least this often while connected.
+	PresenceTTL = 60 * time.Second
+)
+
+// PresencePosition is a zero-based position in a file.
+type PresencePosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// PresenceRange is a selection in a file.
+type PresenceRange struct {
+	Start PresencePosition `json:"start"`
+	End   PresencePosition `json:"end"`
+}
+
+// Presence is where a collaborator currently is in the editor.
+type Presence struct {
+	UserID     string            `json:"user_id"`
+	Username   string            `json:"username"`
+	Path       string            `json:"path,omitempty"`
+	Cursor     *PresencePosition `json:"cursor,omitempty"`
+	Selections []PresenceRange   `json:"selections,omitempty"`
+	UpdatedAt  int64             `json:"updated_at"`
+	// Connections is how many connections of the user follow the session,
+	// the position is the one of the last updated
+	Connections int `json:"connections,omitempty"`
+}
+
+// presenceKey returns the Redis key for a session's presence hash.
+func (s *StreamService) presenceKey(sessionID string) string {
+	return s.client.key(PresenceKeyPrefix + sessionID)
+}
+
+// JoinPresence stores the presence of a connection that started following a
+// session. first reports whether the user had no other live connection
+// following it, on any instance.
+func (s *StreamService) JoinPresence(ctx context.Context, sessionID, connID string, presence Presence) (first bool, err error) {
+	entries, err := s.livePresence(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	first = userConnections(entries, presence.UserID, connID) == 0
+	return first, s.SetPresence(ctx, sessionID, connID, presence)
+}
+
+// SetPresence stores the presence of a connection in a session and refreshes
+// its TTL.
+func (s *StreamService) SetPresence(ctx context.Context, sessionID, connID string, presence Presence) error {
+	presence.UpdatedAt = time.Now().UnixMilli()
+	presence.Connections = 0
+	data, err := json.Marshal(presence)
+	if err != nil {
+		return fmt.Errorf("failed to marshal presence: %w", err)
+	}
+
+	key := s.presenceKey(sessionID)
+	pipe := s.client.rdb.TxPipeline()
+	pipe.HSet(ctx, key, connID, string(data))
+	pipe.Expire(ctx, key, PresenceTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set presence: %w", err)
+	}
+	return nil
+}
+
+// RemovePresence removes the presence of a connection from a session. last
+// reports whether the user has no other live connection following it, on any
+// instance.
+func (s *StreamService) RemovePresence(ctx context.Context, sessionID, connID, userID string) (last bool, err error) {
+	if err := s.client.rdb.HDel(ctx, s.presenceKey(sessionID), connID).Err(); err != nil {
+		return false, fmt.Errorf("failed to remove presence: %w", err)
+	}
+	entries, err := s.livePresence(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	return userConnections(entries, userID, connID) == 0, nil
+}
+
+// GetSessionPresence returns the collaborators present in a session, one per
+// user, sorted by username. Entries without a heartbeat within PresenceTTL
+// are dropped.
+func (s *StreamService) GetSessionPresence(ctx context.Context, sessionID string) ([]Presence, error) {
+	entries, err := s.livePresence(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return mergePresence(entries), nil
+}
+
+// livePresence returns the presence entries of a session by connection ID,
+// and drops the ones without a heartbeat within PresenceTTL.
+func (s *StreamService) livePresence(ctx context.Context, sessionID string) (map[string]Presence, error) {
+	key := s.presenceKey(sessionID)
+	result, err := s.client.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session presence: %w", err)
+	}
+
+	entries, stale := parsePresence(result, time.Now().Add(-PresenceTTL))
+	if len(stale) > 0 {
+		if err := s.client.rdb.HDel(ctx, key, stale...).Err(); err != nil {
+			slog.Warn("Failed to drop stale presence entries", "session_id", sessionID, "error", err)
+		}
+	}
+	return entries, nil
+}
+
+// parsePresence decodes the presence hash of a session, returning the entries
+// updated after cutoff by connection ID, and the fields of the others.
+func parsePresence(hash map[string]string, cutoff time.Time) (map[string]Presence, []string) {
+	entries := make(map[string]Presence, len(hash))
+	var stale []string
+	for connID, data := range hash {
+		var presence Presence
+		if err := json.Unmarshal([]byte(data), &presence); err != nil || presence.UpdatedAt < cutoff.UnixMilli() {
+			stale = append(stale, connID)
+			continue
+		}
+		entries[connID] = presence
+	}
+	return entries, stale
+}
+
+// userConnections counts the entries of a user, other than the one of connID.
+func userConnections(entries map[string]Presence, userID, connID string) int {
+	count := 0
+	for id, presence := range entries {
+		if id != connID && presence.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// mergePresence returns one presence per user, with the position of their
+// last updated connection, sorted by username.
+func mergePresence(entries map[string]Presence) []Presence {
+	byUser := make(map[string]Presence)
+	for _, presence := range entries {
+		merged, ok := byUser[presence.UserID]
+		connections := merged.Connections + 1
+		if !ok || presence.UpdatedAt > merged.UpdatedAt {
+			merged = presence
+		}
+		merged.Connections = connections
+		byUser[presence.UserID] = merged
+	}
+
+	presences := make([]Presence, 0, len(byUser))
+	for _, presence := range byUser {
+		presences = append(presences, presence)
+	}
+	sort.Slice(presences, func(i, j int) bool {
+		if presences[i].Username != presences[j].Username {
+			return presences[i].Username < presences[j].Username
+		}
+		return presences[i].UserID < presences[j].UserID
+	})
+	return presences
+}
+
+const (
+	// TypingKeyPrefix tracks the users typing a prompt per session
+	TypingKeyPrefix = "crush:typing:session:"
+	// TypingTTL is how long a user shows as typing without a new signal.
+	// Clients resend user_typing at least this often while the user types.
+	TypingTTL = 5 * time.Second
+)
+
+// typingKey returns the Redis key for a session's typing hash.
+func (s *StreamService) typingKey(sessionID string) string {
+	return s.client.key(TypingKeyPrefix + sessionID)
+}
+
+// SetTyping marks a user as typing a prompt in a session, or as no longer
+// typing.
+func (s *StreamService) SetTyping(ctx context.Context, sessionID, userID string, typing bool) error {
+	key := s.typingKey(sessionID)
+	if !typing {
+		if err := s.client.rdb.HDel(ctx, key, userID).Err(); err != nil {
+			return fmt.Errorf("failed to clear typing: %w", err)
+		}
+		return nil
+	}
+
+	pipe := s.client.rdb.TxPipeline()
+	pipe.HSet(ctx, key, userID, time.Now().UnixMilli())
+	pipe.Expire(ctx, key, TypingTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set typing: %w", err)
+	}
+	return nil
+}
+
+// GetTyping returns the IDs of the users typing in a session, sorted.
+// Signals older than TypingTTL are ignored.
+func (s *StreamService) GetTyping(ctx context.Context, sessionID string) ([]string, error) {
+	result, err := s.client.rdb.HGetAll(ctx, s.typingKey(sessionID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get typing users: %w", err)
+	}
+
+	cutoff := time.Now().Add(-TypingTTL).UnixMilli()
+	userIDs := make([]string, 0, len(result))
+	for userID, at := range result {
+		if ms, err := strconv.ParseInt(at, 10, 64); err == nil && ms >= cutoff {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func presenceEntry(t *testing.T, p Presence) string {
+	t.Helper()
+	data, err := json.Marshal(p)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestPresenceByConnection(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	hash := map[string]string{
+		"tab1":    presenceEntry(t, Presence{UserID: "u1", Username: "ada", Path: "a.go", UpdatedAt: now.Add(-time.Second).UnixMilli()}),
+		"tab2":    presenceEntry(t, Presence{UserID: "u1", Username: "ada", Path: "b.go", UpdatedAt: now.UnixMilli()}),
+		"other":   presenceEntry(t, Presence{UserID: "u2", Username: "bob", Path: "c.go", UpdatedAt: now.UnixMilli()}),
+		"crashed": presenceEntry(t, Presence{UserID: "u2", Username: "bob", UpdatedAt: now.Add(-2 * PresenceTTL).UnixMilli()}),
+		"garbage": "{",
+	}
+
+	entries, stale := parsePresence(hash, now.Add(-PresenceTTL))
+	require.Len(t, entries, 3)
+	require.ElementsMatch(t, []string{"crashed", "garbage"}, stale)
+
+	t.Run("a user stays while another connection follows", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, 1, userConnections(entries, "u1", "tab1"), "closing one tab")
+		require.Equal(t, 2, userConnections(entries, "u1", "new-tab"), "joining from a third tab")
+		require.Zero(t, userConnections(entries, "u2", "other"), "the stale connection does not count")
+		require.Zero(t, userConnections(entries, "u3", "tab"), "a new user")
+	})
+
+	t.Run("one entry per user", func(t *testing.T) {
+		t.Parallel()
+		merged := mergePresence(entries)
+		require.Len(t, merged, 2)
+		require.Equal(t, "ada", merged[0].Username)
+		require.Equal(t, 2, merged[0].Connections)
+		require.Equal(t, "b.go", merged[0].Path, "the last updated connection")
+		require.Equal(t, "bob", merged[1].Username)
+		require.Equal(t, 1, merged[1].Connections)
+	})
+}
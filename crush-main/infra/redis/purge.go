@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sessionKeys returns the fixed keys holding state of a session.
+func (s *StreamService) sessionKeys(sessionID string) []string {
+	return []string{
+		s.streamKey(sessionID),
+		s.connectionKey(sessionID),
+		s.lastReadKey(sessionID),
+		s.activeGenerationKey(sessionID),
+		s.sessionRunningStatusKey(sessionID),
+		s.sessionToolAllowlistKey(sessionID),
+		s.presenceKey(sessionID),
+		s.typingKey(sessionID),
+		s.sequenceKey(sessionID),
+		s.queueKey(sessionID),
+		s.client.turnKeysKey(sessionID),
+	}
+}
+
+// sessionKeyPatterns match the per tool call, per plan run, per prompt
+// idempotency and generation cache keys of a session. The tool cache is
+// shared by the sessions of a workspace and expires on its own.
+func (s *StreamService) sessionKeyPatterns(sessionID string) []string {
+	return []string{
+		s.client.key(PendingPermissionKeyPrefix + sessionID + ":*"),
+		s.client.key(PermissionParamsKeyPrefix + sessionID + ":*"),
+		s.client.key(ToolCallKeyPrefix + sessionID + ":*"),
+		s.client.key(PlanKeyPrefix + sessionID + ":*"),
+		s.client.key(IdempotencyKeyPrefix + PromptIdempotencyScope(sessionID) + ":*"),
+		s.client.key(GenerationCacheKeyPrefix + sessionID + ":*"),
+	}
+}
+
+// findSessionKeys returns the existing keys of a session.
+func (s *StreamService) findSessionKeys(ctx context.Context, sessionID string) ([]string, error) {
+	var keys []string
+	for _, key := range s.sessionKeys(sessionID) {
+		n, err := s.client.rdb.Exists(ctx, key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check session key: %w", err)
+		}
+		if n > 0 {
+			keys = append(keys, key)
+		}
+	}
+	for _, pattern := range s.sessionKeyPatterns(sessionID) {
+		matches, err := s.client.scanKeys(ctx, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session keys: %w", err)
+		}
+		keys = append(keys, matches...)
+	}
+	return keys, nil
+}
+
+// PurgeSessionKeys deletes every key holding state of a session and returns
+// how many were deleted.
+func (s *StreamService) PurgeSessionKeys(ctx context.Context, sessionID string) (int, error) {
+	keys, err := s.findSessionKeys(ctx, sessionID)
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	return s.deleteKeys(ctx, keys)
+}
+
+// deleteKeys deletes keys and returns how many existed.
+func (s *StreamService) deleteKeys(ctx context.Context, keys []string) (int, error) {
+	// One DEL per key, the keys of a session span hash slots in a cluster
+	pipe := s.client.rdb.Pipeline()
+	dels := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		dels[i] = pipe.Del(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to delete session keys: %w", err)
+	}
+	deleted := 0
+	for _, del := range dels {
+		deleted += int(del.Val())
+	}
+	return deleted, nil
+}
+
+// CountSessionKeys returns how many keys still hold state of a session.
+func (s *StreamService) CountSessionKeys(ctx context.Context, sessionID string) (int, error) {
+	keys, err := s.findSessionKeys(ctx, sessionID)
+	return len(keys), err
+}
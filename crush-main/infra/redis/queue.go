@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// QueueKeyPrefix mirrors the prompts queued for a session by the WS instance
+// running it, for the HTTP API
+const QueueKeyPrefix = "crush:queue:session:"
+
+// QueuedPrompt is a prompt waiting for the running turn of its session.
+type QueuedPrompt struct {
+	ID          string `json:"id"`
+	Agent       string `json:"agent,omitempty"`
+	Prompt      string `json:"prompt"`
+	Attachments int    `json:"attachments"`
+	QueuedAt    int64  `json:"queued_at"`
+}
+
+func (s *StreamService) queueKey(sessionID string) string {
+	return s.client.key(QueueKeyPrefix + sessionID)
+}
+
+// SetSessionQueue stores the prompts queued for a session, removing the
+// entry when the queue is empty. It expires with the running status.
+func (s *StreamService) SetSessionQueue(ctx context.Context, sessionID string, prompts []QueuedPrompt) error {
+	key := s.queueKey(sessionID)
+	if len(prompts) == 0 {
+		if err := s.client.rdb.Del(ctx, key).Err(); err != nil {
+			return fmt.Errorf("failed to clear session queue: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(prompts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session queue: %w", err)
+	}
+	if err := s.client.rdb.Set(ctx, key, string(data), SessionRunningStatusTTL).Err(); err != nil {
+		return fmt.Errorf("failed to set session queue: %w", err)
+	}
+	return nil
+}
+
+// GetSessionQueue returns the prompts queued for a session.
+func (s *StreamService) GetSessionQueue(ctx context.Context, sessionID string) ([]QueuedPrompt, error) {
+	data, err := s.client.rdb.Get(ctx, s.queueKey(sessionID)).Result()
+	if err == redis.Nil {
+		return []QueuedPrompt{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session queue: %w", err)
+	}
+	var prompts []QueuedPrompt
+	if err := json.Unmarshal([]byte(data), &prompts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session queue: %w", err)
+	}
+	return prompts, nil
+}
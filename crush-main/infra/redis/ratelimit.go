@@ -0,0 +1,63 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitKeyPrefix is the prefix of the token buckets of the rate limits
+const RateLimitKeyPrefix = "crush:ratelimit:"
+
+// takeTokenScript refills a token bucket for the time elapsed since its last
+// update, by the Redis clock shared by the instances, and takes a token from
+// it. It returns 1 and 0 when a token was taken, 0 and the milliseconds until
+// one is available otherwise.
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1]) / 1000
+local burst = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or burst
+local updated = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+return {allowed, wait}
+`)
+
+// RateLimitStore keeps the token buckets of the rate limits in Redis, so that
+// the instances share them. It implements ratelimit.Store.
+type RateLimitStore struct {
+	client *Client
+}
+
+// NewRateLimitStore creates a rate limit store backed by the Redis client.
+func NewRateLimitStore(client *Client) *RateLimitStore {
+	return &RateLimitStore{client: client}
+}
+
+// Take takes a token from the bucket of key, refilled with rate tokens per
+// second up to burst tokens.
+func (s *RateLimitStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	keys := []string{s.client.key(RateLimitKeyPrefix + key)}
+	res, err := takeTokenScript.Run(ctx, s.client.rdb, keys, strconv.FormatFloat(rate, 'f', -1, 64), burst).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit script result: %v", res)
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -26,6 +27,8 @@ const (
 	PendingPermissionKeyPrefix = "crush:permission:pending:"
 	// SessionToolAllowlistKeyPrefix tracks session-level tool allowlist
 	SessionToolAllowlistKeyPrefix = "crush:allowlist:session:"
+	// SequenceKeyPrefix holds the last event sequence number of a session
+	SequenceKeyPrefix = "crush:seq:session:"
 )
 
 // SessionRunningStatus represents the running status of a session
@@ -52,6 +55,8 @@ type StreamMessage struct {
 	Type      string          `json:"type"` // "message", "session_update", "permission_request", etc.
 	Payload   json.RawMessage `json:"payload"`
 	Timestamp int64           `json:"timestamp"`
+	// Seq numbers the events of a session from 1, without gaps.
+	Seq int64 `json:"seq,omitempty"`
 }
 
 // StreamService provides Redis stream operations for message buffering.
@@ -75,29 +80,59 @@ func GetGlobalStreamService() *StreamService {
 
 // streamKey returns the Redis key for a session's message stream.
 func (s *StreamService) streamKey(sessionID string) string {
-	return StreamKeyPrefix + sessionID
+	return s.client.slotKey(sessionID, StreamKeyPrefix+sessionID)
 }
 
 // connectionKey returns the Redis key for tracking session connections.
 func (s *StreamService) connectionKey(sessionID string) string {
-	return ConnectionKeyPrefix + sessionID
+	return s.client.key(ConnectionKeyPrefix + sessionID)
 }
 
 // lastReadKey returns the Redis key for tracking last read message ID.
 func (s *StreamService) lastReadKey(sessionID string) string {
-	return LastReadKeyPrefix + sessionID
+	return s.client.key(LastReadKeyPrefix + sessionID)
 }
 
 // activeGenerationKey returns the Redis key for tracking active generation.
 func (s *StreamService) activeGenerationKey(sessionID string) string {
-	return ActiveGenerationKeyPrefix + sessionID
-}
+	return s.client.key(ActiveGenerationKeyPrefix + sessionID)
+}
+
+// sequenceKey returns the Redis key for the event sequence of a session. It
+// shares the hash slot of the stream, both are updated by one script.
+func (s *StreamService) sequenceKey(sessionID string) string {
+	return s.client.slotKey(sessionID, SequenceKeyPrefix+sessionID)
+}
+
+// publishSequencedScript numbers an event and adds it to the stream in one
+// step, so stream order and sequence order always agree.
+var publishSequencedScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[2])
+if tonumber(ARGV[2]) > 0 then
+  redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[2], '*', 'data', ARGV[1], 'seq', seq)
+else
+  redis.call('XADD', KEYS[1], '*', 'data', ARGV[1], 'seq', seq)
+end
+if tonumber(ARGV[3]) > 0 then
+  redis.call('EXPIRE', KEYS[1], ARGV[3])
+  redis.call('EXPIRE', KEYS[2], ARGV[3])
+end
+return seq
+`)
 
 // PublishMessage publishes a message to the session's stream.
 func (s *StreamService) PublishMessage(ctx context.Context, sessionID string, msgType string, payload interface{}) error {
+	_, err := s.PublishSequenced(ctx, sessionID, msgType, payload)
+	return err
+}
+
+// PublishSequenced publishes a message to the session's stream and returns its
+// sequence number. Clients use the numbers to notice missed events and ask
+// for the missing range with ReadSequenceRange.
+func (s *StreamService) PublishSequenced(ctx context.Context, sessionID string, msgType string, payload interface{}) (int64, error) {
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return 0, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	msg := StreamMessage{
@@ -109,35 +144,25 @@ func (s *StreamService) PublishMessage(ctx context.Context, sessionID string, ms
 
 	msgJSON, err := json.Marshal(msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal stream message: %w", err)
-	}
-
-	// Add to stream with max length limit
-	streamKey := s.streamKey(sessionID)
-	args := &redis.XAddArgs{
-		Stream: streamKey,
-		MaxLen: s.client.streamMaxLen,
-		Approx: true,
-		Values: map[string]interface{}{
-			"data": string(msgJSON),
-		},
+		return 0, fmt.Errorf("failed to marshal stream message: %w", err)
 	}
 
-	result, err := s.client.rdb.XAdd(ctx, args).Result()
+	// Add to stream with max length limit and TTL, numbering the message
+	seq, err := publishSequencedScript.Run(ctx, s.client.rdb,
+		[]string{s.streamKey(sessionID), s.sequenceKey(sessionID)},
+		string(msgJSON), s.client.streamMaxLen, int64(s.client.streamTTL.Seconds()),
+	).Int64()
 	if err != nil {
-		return fmt.Errorf("failed to add message to stream: %w", err)
+		return 0, fmt.Errorf("failed to add message to stream: %w", err)
 	}
 
-	// Set TTL on the stream
-	s.client.rdb.Expire(ctx, streamKey, s.client.streamTTL)
-
 	slog.Debug("Published message to stream",
 		"session_id", sessionID,
 		"type", msgType,
-		"stream_id", result,
+		"seq", seq,
 	)
 
-	return nil
+	return seq, nil
 }
 
 // ReadMessages reads messages from the session's stream starting from the given ID.
@@ -178,6 +203,7 @@ func (s *StreamService) ReadMessages(ctx context.Context, sessionID string, star
 			continue
 		}
 		msg.ID = entry.ID
+		msg.Seq = entrySeq(entry)
 		messages = append(messages, msg)
 
 		if count > 0 && int64(len(messages)) >= count {
@@ -229,12 +255,49 @@ func (s *StreamService) ReadNewMessages(ctx context.Context, sessionID string, l
 			continue
 		}
 		msg.ID = entry.ID
+		msg.Seq = entrySeq(entry)
 		messages = append(messages, msg)
 	}
 
 	return messages, newLastID, nil
 }
 
+// ReadSequenceRange reads the messages of a session numbered from fromSeq to
+// toSeq, inclusive. Messages trimmed from the stream are returned in missing.
+func (s *StreamService) ReadSequenceRange(ctx context.Context, sessionID string, fromSeq, toSeq int64) ([]StreamMessage, []int64, error) {
+	messages, _, err := s.ReadMessages(ctx, sessionID, "0", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var found []StreamMessage
+	seen := make(map[int64]bool)
+	for _, msg := range messages {
+		if msg.Seq >= fromSeq && msg.Seq <= toSeq {
+			found = append(found, msg)
+			seen[msg.Seq] = true
+		}
+	}
+	var missing []int64
+	for seq := fromSeq; seq <= toSeq; seq++ {
+		if !seen[seq] {
+			missing = append(missing, seq)
+		}
+	}
+	return found, missing, nil
+}
+
+// entrySeq returns the sequence number of a stream entry, 0 for entries
+// published before sequence numbers existed.
+func entrySeq(entry redis.XMessage) int64 {
+	v, ok := entry.Values["seq"].(string)
+	if !ok {
+		return 0
+	}
+	seq, _ := strconv.ParseInt(v, 10, 64)
+	return seq
+}
+
 // SetConnectionStatus sets the connection status for a session.
 func (s *StreamService) SetConnectionStatus(ctx context.Context, sessionID string, connected bool) error {
 	key := s.connectionKey(sessionID)
@@ -323,7 +386,7 @@ func (s *StreamService) IsGenerationActive(ctx context.Context, sessionID string
 
 // sessionRunningStatusKey returns the Redis key for session running status.
 func (s *StreamService) sessionRunningStatusKey(sessionID string) string {
-	return SessionRunningStatusKeyPrefix + sessionID
+	return s.client.key(SessionRunningStatusKeyPrefix + sessionID)
 }
 
 // SetSessionRunningStatus sets the running status for a session with 30-minute TTL.
@@ -393,9 +456,22 @@ func (s *StreamService) GetStreamLength(ctx context.Context, sessionID string) (
 	return length, nil
 }
 
+// GetLastStreamID returns the ID of the last message in a session's stream,
+// "0" when it is empty. Readers following the stream start after it.
+func (s *StreamService) GetLastStreamID(ctx context.Context, sessionID string) (string, error) {
+	result, err := s.client.rdb.XRevRangeN(ctx, s.streamKey(sessionID), "+", "-", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to get last stream ID: %w", err)
+	}
+	if len(result) == 0 {
+		return "0", nil
+	}
+	return result[0].ID, nil
+}
+
 // pendingPermissionKey returns the Redis key for a pending permission request.
 func (s *StreamService) pendingPermissionKey(sessionID, toolCallID string) string {
-	return PendingPermissionKeyPrefix + sessionID + ":" + toolCallID
+	return s.client.key(PendingPermissionKeyPrefix + sessionID + ":" + toolCallID)
 }
 
 // PendingPermission represents a pending permission request stored in Redis.
@@ -408,8 +484,13 @@ type PendingPermission struct {
 	Action      string `json:"action"`
 	Params      any    `json:"params"`
 	Path        string `json:"path"`
-	Status      string `json:"status"` // "pending", "granted", "denied"
+	Status      string `json:"status"`           // "pending", "granted", "denied"
+	Reason      string `json:"reason,omitempty"` // Optional note the user attached to the decision
 	CreatedAt   int64  `json:"created_at"`
+
+	// ParamsRedacted is set when Params were truncated or masked, the full
+	// parameters are kept with SetPermissionParams
+	ParamsRedacted bool `json:"params_redacted,omitempty"`
 }
 
 // SetPendingPermission stores a pending permission request in Redis.
@@ -438,8 +519,9 @@ func (s *StreamService) SetPendingPermission(ctx context.Context, perm PendingPe
 	return nil
 }
 
-// UpdatePermissionStatus updates the status of a permission request.
-func (s *StreamService) UpdatePermissionStatus(ctx context.Context, sessionID, toolCallID, status string) error {
+// UpdatePermissionStatus updates the status of a permission request and the
+// optional reason given with the decision.
+func (s *StreamService) UpdatePermissionStatus(ctx context.Context, sessionID, toolCallID, status, reason string) error {
 	key := s.pendingPermissionKey(sessionID, toolCallID)
 
 	// Get current permission
@@ -459,6 +541,9 @@ func (s *StreamService) UpdatePermissionStatus(ctx context.Context, sessionID, t
 	}
 
 	perm.Status = status
+	if reason != "" {
+		perm.Reason = reason
+	}
 
 	newData, err := json.Marshal(perm)
 	if err != nil {
@@ -476,6 +561,14 @@ func (s *StreamService) UpdatePermissionStatus(ctx context.Context, sessionID, t
 		return fmt.Errorf("failed to update permission status: %w", err)
 	}
 
+	// A decided request is deleted once the turn finished, a pending one
+	// may still be granted after it
+	if status != "pending" {
+		if err := s.client.trackTurnKeys(ctx, sessionID, key); err != nil {
+			return err
+		}
+	}
+
 	slog.Debug("Updated permission status",
 		"session_id", sessionID,
 		"tool_call_id", toolCallID,
@@ -507,9 +600,9 @@ func (s *StreamService) GetPendingPermission(ctx context.Context, sessionID, too
 
 // GetAllPendingPermissions retrieves all pending permission requests for a session.
 func (s *StreamService) GetAllPendingPermissions(ctx context.Context, sessionID string) ([]PendingPermission, error) {
-	pattern := PendingPermissionKeyPrefix + sessionID + ":*"
+	pattern := s.client.key(PendingPermissionKeyPrefix + sessionID + ":*")
 
-	keys, err := s.client.rdb.Keys(ctx, pattern).Result()
+	keys, err := s.client.scanKeys(ctx, pattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get permission keys: %w", err)
 	}
@@ -548,7 +641,7 @@ func (s *StreamService) DeletePendingPermission(ctx context.Context, sessionID,
 
 // sessionToolAllowlistKey returns the Redis key for session tool allowlist.
 func (s *StreamService) sessionToolAllowlistKey(sessionID string) string {
-	return SessionToolAllowlistKeyPrefix + sessionID
+	return s.client.key(SessionToolAllowlistKeyPrefix + sessionID)
 }
 
 // ToolAllowlistEntry represents an allowed tool in the session allowlist.
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// ToolCacheKeyPrefix stores the results of the read-only tools run in a
+	// workspace and the version of its content they were computed on, shared
+	// by the sessions of the project
+	ToolCacheKeyPrefix = "crush:toolcache:"
+	// ToolCacheVersionTTL outlives the cached results, a version expires
+	// once no result can refer to it anymore
+	ToolCacheVersionTTL = 24 * time.Hour
+)
+
+// ToolResultCache shares the results of the read-only tools between the
+// turns, sessions and instances working in a workspace. It implements
+// tools.ResultCache.
+type ToolResultCache struct {
+	client *Client
+}
+
+// NewToolResultCache creates a tool result cache backed by the Redis client.
+func NewToolResultCache(client *Client) *ToolResultCache {
+	return &ToolResultCache{client: client}
+}
+
+// workspaceID names a workspace in the keys, its path may hold any character.
+func workspaceID(workspace string) string {
+	sum := sha256.Sum256([]byte(workspace))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (c *ToolResultCache) versionKey(workspace string) string {
+	return c.client.key(ToolCacheKeyPrefix + workspaceID(workspace) + ":version")
+}
+
+func (c *ToolResultCache) resultKey(workspace, key string) string {
+	return c.client.key(ToolCacheKeyPrefix + workspaceID(workspace) + ":result:" + key)
+}
+
+// Version returns the version of the content of a workspace. A workspace
+// without one gets a new version, never one it had before.
+func (c *ToolResultCache) Version(ctx context.Context, workspace string) (string, error) {
+	version, err := c.client.rdb.Get(ctx, c.versionKey(workspace)).Result()
+	if err == nil {
+		return version, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("failed to get tool cache version: %w", err)
+	}
+	version = strconv.FormatInt(time.Now().UnixNano(), 10)
+	set, err := c.client.rdb.SetNX(ctx, c.versionKey(workspace), version, ToolCacheVersionTTL).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to set tool cache version: %w", err)
+	}
+	if set {
+		return version, nil
+	}
+	// Another call set it first
+	version, err = c.client.rdb.Get(ctx, c.versionKey(workspace)).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tool cache version: %w", err)
+	}
+	return version, nil
+}
+
+// Invalidate moves a workspace to a new version, the results cached for the
+// previous one are not served anymore to any session and expire.
+func (c *ToolResultCache) Invalidate(ctx context.Context, workspace string) error {
+	version := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := c.client.rdb.Set(ctx, c.versionKey(workspace), version, ToolCacheVersionTTL).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate tool cache: %w", err)
+	}
+	return nil
+}
+
+// Get returns the cached result, or nil if the key is missing.
+func (c *ToolResultCache) Get(ctx context.Context, workspace, key string) ([]byte, error) {
+	value, err := c.client.rdb.Get(ctx, c.resultKey(workspace, key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool cache entry: %w", err)
+	}
+	return value, nil
+}
+
+// Set stores a result for the given TTL.
+func (c *ToolResultCache) Set(ctx context.Context, workspace, key string, value []byte, ttl time.Duration) error {
+	if err := c.client.rdb.Set(ctx, c.resultKey(workspace, key), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set tool cache entry: %w", err)
+	}
+	return nil
+}
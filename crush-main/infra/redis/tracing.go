@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracingHook traces the commands and pipelines run by a client, each in a
+// span named after its command. Keys and values are left out of the spans.
+type tracingHook struct{}
+
+func (tracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (tracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := tracing.Start(ctx, "redis "+cmd.Name(),
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation.name", cmd.Name()),
+		)
+		err := next(ctx, cmd)
+		tracing.End(span, redisSpanError(err))
+		return err
+	}
+}
+
+func (tracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		ctx, span := tracing.Start(ctx, "redis pipeline",
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation.name", strings.Join(names, " ")),
+			attribute.Int("db.operation.batch.size", len(cmds)),
+		)
+		err := next(ctx, cmds)
+		tracing.End(span, redisSpanError(err))
+		return err
+	}
+}
+
+// redisSpanError drops the missing keys, they are not failures.
+func redisSpanError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -14,6 +18,8 @@ import (
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	// streamClient 用于流式执行，不设总超时，由 ctx 和命令超时控制
+	streamClient *http.Client
 }
 
 // NewClient 创建沙箱客户端
@@ -23,6 +29,7 @@ func NewClient(baseURL string) *Client {
 		httpClient: &http.Client{
 			Timeout: 5 * time.Minute, // 5分钟超时，适合长时间运行的命令
 		},
+		streamClient: &http.Client{},
 	}
 }
 
@@ -40,6 +47,8 @@ type ExecuteResponse struct {
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
 	ExitCode int    `json:"exit_code"`
+	// TimedOut 表示命令因超时被终止 (仅 Exec)
+	TimedOut bool   `json:"timed_out,omitempty"`
 	Error    string `json:"error,omitempty"`
 }
 
@@ -139,11 +148,147 @@ func (c *Client) Execute(ctx context.Context, req ExecuteRequest) (*ExecuteRespo
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
 
+// ExecuteStreamChunk 流式执行的一行输出 (NDJSON)
+type ExecuteStreamChunk struct {
+	Stream   string `json:"stream,omitempty"` // "stdout" 或 "stderr"
+	Data     string `json:"data,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var (
+	// ErrSandbox 沙箱在响应中报告的错误
+	ErrSandbox = errors.New("sandbox error")
+	// ErrUnavailable 无法连接沙箱服务
+	ErrUnavailable = errors.New("sandbox unavailable")
+)
+
+// errStreamUnsupported 表示沙箱没有对应的流式接口
+var errStreamUnsupported = errors.New("sandbox does not support this streaming endpoint")
+
+// ExecuteStream 在沙箱中执行命令，输出片段产生时即回调 onOutput。
+// 返回的响应包含完整输出；沙箱不支持流式接口时回退到 Execute。
+func (c *Client) ExecuteStream(ctx context.Context, req ExecuteRequest, onOutput func(stream, data string)) (*ExecuteResponse, error) {
+	resp, err := c.doStream(ctx, "/execute/stream", req, onOutput)
+	if errors.Is(err, errStreamUnsupported) {
+		// 旧版沙箱没有流式接口
+		return c.Execute(ctx, req)
+	}
+	return resp, err
+}
+
+// ExecRequest 在会话的项目容器中执行命令的请求
+type ExecRequest struct {
+	SessionID  string            `json:"session_id"`
+	Command    string            `json:"command"`
+	Env        map[string]string `json:"env,omitempty"`
+	WorkingDir string            `json:"working_dir,omitempty"`
+	// Timeout 超时时间(秒)，0 表示不限制；超时后命令被终止，响应的 TimedOut 为 true
+	Timeout int `json:"timeout,omitempty"`
+	// PTY 为命令分配伪终端，此时 stderr 合并到 stdout
+	PTY bool `json:"pty,omitempty"`
+}
+
+// Exec 在会话的项目容器中执行 bash 命令，输出片段产生时即回调 onOutput。
+// 沙箱没有 /exec 接口时回退到 ExecuteStream，此时 Env、Timeout 和 PTY 不生效。
+func (c *Client) Exec(ctx context.Context, req ExecRequest, onOutput func(stream, data string)) (*ExecuteResponse, error) {
+	resp, err := c.doStream(ctx, "/exec", req, onOutput)
+	if errors.Is(err, errStreamUnsupported) {
+		slog.WarnContext(ctx, "Sandbox has no exec endpoint, falling back to execute/stream", "session_id", req.SessionID)
+		return c.ExecuteStream(ctx, ExecuteRequest{
+			SessionID:  req.SessionID,
+			Command:    req.Command,
+			Language:   "bash",
+			WorkingDir: req.WorkingDir,
+		}, onOutput)
+	}
+	return resp, err
+}
+
+// doStream 发送请求并读取 NDJSON 格式的输出流
+func (c *Client) doStream(ctx context.Context, path string, reqBody any, onOutput func(stream, data string)) (*ExecuteResponse, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	slog.DebugContext(ctx, "Sandbox request", "method", "POST", "path", path)
+	httpResp, err := c.streamClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w: %w", ErrUnavailable, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode == http.StatusNotFound || httpResp.StatusCode == http.StatusMethodNotAllowed {
+		respData, _ := io.ReadAll(httpResp.Body)
+		// 容器不存在时沙箱同样返回 404，但带有 JSON 错误
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respData, &errResp) == nil && errResp.Error != "" {
+			return nil, &StatusError{StatusCode: httpResp.StatusCode, Body: errResp.Error}
+		}
+		return nil, errStreamUnsupported
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		respData, _ := io.ReadAll(httpResp.Body)
+		return nil, &StatusError{StatusCode: httpResp.StatusCode, Body: string(respData)}
+	}
+
+	var stdout, stderr strings.Builder
+	resp := &ExecuteResponse{Status: "ok"}
+	exited := false
+	decoder := json.NewDecoder(httpResp.Body)
+	for {
+		var chunk ExecuteStreamChunk
+		if err := decoder.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read output stream: %w", err)
+		}
+		switch {
+		case chunk.Error != "":
+			resp.Error = chunk.Error
+		case chunk.TimedOut:
+			resp.TimedOut = true
+		case chunk.ExitCode != nil:
+			resp.ExitCode = *chunk.ExitCode
+			exited = true
+		case chunk.Stream == "stderr":
+			stderr.WriteString(chunk.Data)
+			if onOutput != nil {
+				onOutput(chunk.Stream, chunk.Data)
+			}
+		case chunk.Data != "":
+			stdout.WriteString(chunk.Data)
+			if onOutput != nil {
+				onOutput("stdout", chunk.Data)
+			}
+		}
+	}
+	resp.Stdout = stdout.String()
+	resp.Stderr = stderr.String()
+
+	if resp.Error != "" {
+		return resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
+	}
+	if !exited {
+		return resp, fmt.Errorf("sandbox output stream ended without an exit code")
+	}
+	return resp, nil
+}
+
 // ReadFile 读取沙箱中的文件
 func (c *Client) ReadFile(ctx context.Context, req FileReadRequest) (*FileReadResponse, error) {
 	var resp FileReadResponse
@@ -152,7 +297,7 @@ func (c *Client) ReadFile(ctx context.Context, req FileReadRequest) (*FileReadRe
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -165,7 +310,7 @@ func (c *Client) WriteFile(ctx context.Context, req FileWriteRequest) (*FileWrit
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -178,7 +323,7 @@ func (c *Client) ListFiles(ctx context.Context, req FileListRequest) (*FileListR
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -191,7 +336,7 @@ func (c *Client) Grep(ctx context.Context, req GrepRequest) (*GrepResponse, erro
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -204,7 +349,7 @@ func (c *Client) Glob(ctx context.Context, req GlobRequest) (*GlobResponse, erro
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -217,7 +362,7 @@ func (c *Client) EditFile(ctx context.Context, req FileEditRequest) (*FileEditRe
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -263,57 +408,215 @@ func (c *Client) GetFileTree(ctx context.Context, req FileTreeRequest) (*FileTre
 		url = fmt.Sprintf("%s&path=%s", url, req.Path)
 	}
 
-	fmt.Printf("📤 Sandbox: GET %s\n", url)
+	slog.DebugContext(ctx, "Sandbox request", "method", "GET", "url", url)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		fmt.Printf("❌ Sandbox: 创建请求失败: %v\n", err)
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpResp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		fmt.Printf("❌ Sandbox: 发送请求失败: %v\n", err)
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w: %w", ErrUnavailable, err)
 	}
 	defer httpResp.Body.Close()
 
 	respData, err := io.ReadAll(httpResp.Body)
 	if err != nil {
-		fmt.Printf("❌ Sandbox: 读取响应失败: %v\n", err)
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	fmt.Printf("📥 Sandbox: 状态码 %d, 响应大小 %d 字节\n", httpResp.StatusCode, len(respData))
+	slog.DebugContext(ctx, "Sandbox response", "status", httpResp.StatusCode, "size", len(respData))
 
 	if httpResp.StatusCode != http.StatusOK {
-		fmt.Printf("❌ Sandbox: 错误状态码 %d: %s\n", httpResp.StatusCode, string(respData))
-		return nil, fmt.Errorf("sandbox returned status %d: %s", httpResp.StatusCode, string(respData))
+		return nil, &StatusError{StatusCode: httpResp.StatusCode, Body: string(respData)}
 	}
 
 	var resp FileTreeResponse
 	if err := json.Unmarshal(respData, &resp); err != nil {
-		fmt.Printf("❌ Sandbox: 解析响应失败: %v\n", err)
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 
-	fmt.Printf("✅ Sandbox: 请求成功\n")
 	return &resp, nil
 }
 
 // doRequest 通用HTTP请求方法
+// FileEntriesRequest 懒加载列出项目目录请求
+type FileEntriesRequest struct {
+	ProjectID   string `json:"project_id"`
+	Path        string `json:"path,omitempty"`          // 相对项目根目录的路径，默认根目录
+	Depth       int    `json:"depth,omitempty"`         // 展开的目录层数，默认 1
+	MaxEntries  int    `json:"max_entries,omitempty"`   // 返回的目录项上限
+	MaxFileSize int64  `json:"max_file_size,omitempty"` // 超过此大小的文件标记为 large
+}
+
+// FileEntry 目录项（不含文件内容）
+type FileEntry struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"` // 相对项目根目录，以 / 开头
+	Type     string `json:"type"` // "file", "folder" 或 "symlink"
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"` // 修改时间 (Unix 毫秒)
+	// Large 文件超过大小限制，无法读取内容
+	Large bool `json:"large,omitempty"`
+	// Expanded 目录已展开，Children 为其全部子项；未展开的目录需再次请求
+	Expanded bool        `json:"expanded,omitempty"`
+	Children []FileEntry `json:"children,omitempty"`
+}
+
+// FileEntriesResponse 懒加载列出项目目录响应
+type FileEntriesResponse struct {
+	Status    string      `json:"status"`
+	Path      string      `json:"path"`
+	Entries   []FileEntry `json:"entries"`
+	Truncated bool        `json:"truncated"` // 目录项达到上限被截断
+	Error     string      `json:"error,omitempty"`
+}
+
+// ListEntries 懒加载列出项目目录，遵循 .gitignore
+func (c *Client) ListEntries(ctx context.Context, req FileEntriesRequest) (*FileEntriesResponse, error) {
+	var resp FileEntriesResponse
+	err := c.doRequest(ctx, "POST", "/file/entries", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
+	}
+	return &resp, nil
+}
+
+// FileContentRequest 读取项目文件内容请求
+type FileContentRequest struct {
+	ProjectID string `json:"project_id"`
+	Path      string `json:"path"`               // 相对项目根目录的路径
+	MaxSize   int64  `json:"max_size,omitempty"` // 超过此大小返回 413
+}
+
+// FileContentResponse 读取项目文件内容响应
+type FileContentResponse struct {
+	Status  string `json:"status"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Content []byte `json:"content"` // base64 编码传输
+	Error   string `json:"error,omitempty"`
+}
+
+// ReadContent 读取项目中的文件内容
+func (c *Client) ReadContent(ctx context.Context, req FileContentRequest) (*FileContentResponse, error) {
+	var resp FileContentResponse
+	err := c.doRequest(ctx, "POST", "/file/content", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
+	}
+	return &resp, nil
+}
+
+// FileSnapshotRequest 获取项目工作目录快照请求
+type FileSnapshotRequest struct {
+	ProjectID  string `json:"project_id"`
+	MaxEntries int    `json:"max_entries,omitempty"` // 返回的文件数上限
+}
+
+// FileStat 快照中文件的修改时间和大小
+type FileStat struct {
+	Modified int64 `json:"modified"` // 修改时间 (Unix 毫秒)
+	Size     int64 `json:"size"`
+}
+
+// FileSnapshotResponse 项目工作目录快照响应，键为相对项目根目录的路径
+type FileSnapshotResponse struct {
+	Status    string              `json:"status"`
+	Files     map[string]FileStat `json:"files"`
+	Truncated bool                `json:"truncated"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// Snapshot 获取项目工作目录快照（不含内容），用于检测文件变化
+func (c *Client) Snapshot(ctx context.Context, req FileSnapshotRequest) (*FileSnapshotResponse, error) {
+	var resp FileSnapshotResponse
+	err := c.doRequest(ctx, "POST", "/file/snapshot", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
+	}
+	return &resp, nil
+}
+
+// WorkspaceArchiveRequest 打包项目工作目录请求
+type WorkspaceArchiveRequest struct {
+	ProjectID string `json:"project_id"`
+	MaxSize   int64  `json:"max_size,omitempty"` // 归档大小上限（字节），超过时返回 413
+}
+
+// ArchiveWorkspace 将项目工作目录打包为 tar.gz，不含 node_modules 等依赖目录
+func (c *Client) ArchiveWorkspace(ctx context.Context, req WorkspaceArchiveRequest) ([]byte, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return c.doRaw(ctx, "/workspace/archive", "application/json", jsonData)
+}
+
+// RestoreWorkspace 清空项目工作目录并解压 ArchiveWorkspace 生成的归档
+func (c *Client) RestoreWorkspace(ctx context.Context, projectID string, archive []byte) error {
+	_, err := c.doRaw(ctx, "/workspace/restore?project_id="+url.QueryEscape(projectID), "application/gzip", archive)
+	return err
+}
+
+// doRaw 发送原始请求体并返回原始响应体，用于传输归档
+func (c *Client) doRaw(ctx context.Context, path, contentType string, body []byte) ([]byte, error) {
+	slog.DebugContext(ctx, "Sandbox request", "method", "POST", "path", path, "size", len(body))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	slog.DebugContext(ctx, "Sandbox response", "method", "POST", "path", path, "status", resp.StatusCode, "size", len(respData))
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(respData)}
+	}
+	return respData, nil
+}
+
+// StatusError 沙箱返回的非 200 响应
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sandbox returned status %d: %s", e.StatusCode, e.Body)
+}
+
 func (c *Client) doRequest(ctx context.Context, method, path string, reqBody, respBody interface{}) error {
 	var body io.Reader
-	var jsonData []byte
 	if reqBody != nil {
-		var err error
-		jsonData, err = json.Marshal(reqBody)
+		jsonData, err := json.Marshal(reqBody)
 		if err != nil {
-			fmt.Printf("❌ Sandbox: Marshal 请求失败: %v (path: %s)\n", err, path)
 			return fmt.Errorf("failed to marshal request: %w", err)
 		}
 		body = bytes.NewBuffer(jsonData)
@@ -321,15 +624,10 @@ func (c *Client) doRequest(ctx context.Context, method, path string, reqBody, re
 
 	url := c.baseURL + path
 
-	// 打印请求信息
-	fmt.Printf("📤 Sandbox: %s %s\n", method, url)
-	if reqBody != nil && len(jsonData) < 500 {
-		fmt.Printf("   请求体: %s\n", string(jsonData))
-	}
+	slog.DebugContext(ctx, "Sandbox request", "method", method, "path", path)
 
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		fmt.Printf("❌ Sandbox: 创建请求失败: %v\n", err)
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
@@ -339,36 +637,27 @@ func (c *Client) doRequest(ctx context.Context, method, path string, reqBody, re
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		fmt.Printf("❌ Sandbox: 发送请求失败: %v\n", err)
-		return fmt.Errorf("failed to send request: %w", err)
+		return fmt.Errorf("failed to send request: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	respData, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("❌ Sandbox: 读取响应失败: %v\n", err)
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// 打印响应信息
-	fmt.Printf("📥 Sandbox: 状态码 %d, 响应大小 %d 字节\n", resp.StatusCode, len(respData))
-	if len(respData) < 500 {
-		fmt.Printf("   响应体: %s\n", string(respData))
-	}
+	slog.DebugContext(ctx, "Sandbox response", "method", method, "path", path, "status", resp.StatusCode, "size", len(respData))
 
 	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("❌ Sandbox: 错误状态码 %d: %s\n", resp.StatusCode, string(respData))
-		return fmt.Errorf("sandbox returned status %d: %s", resp.StatusCode, string(respData))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(respData)}
 	}
 
 	if respBody != nil {
 		if err := json.Unmarshal(respData, respBody); err != nil {
-			fmt.Printf("❌ Sandbox: 解析响应失败: %v\n", err)
 			return fmt.Errorf("failed to unmarshal response: %w", err)
 		}
 	}
 
-	fmt.Printf("✅ Sandbox: 请求成功\n")
 	return nil
 }
 
@@ -377,6 +666,25 @@ type CreateProjectRequest struct {
 	ProjectName     string `json:"project_name"`
 	BackendLanguage string `json:"backend_language,omitempty"` // "", "go", "java", "python"
 	NeedDatabase    bool   `json:"need_database"`
+	// Limits 容器资源限制，为空时不限制
+	Limits *ResourceLimits `json:"limits,omitempty"`
+	// Scaffold 工作目录的初始代码和初始化脚本，为空时创建空项目
+	Scaffold *Scaffold `json:"scaffold,omitempty"`
+}
+
+// Scaffold 新项目工作目录的初始化方式：先克隆初始仓库，再依次执行脚本，
+// 任一步骤失败时创建失败
+type Scaffold struct {
+	StarterRepo string   `json:"starter_repo,omitempty"` // 克隆到工作目录的 git 仓库
+	StarterRef  string   `json:"starter_ref,omitempty"`  // 仓库的分支或标签，为空时使用默认分支
+	Scripts     []string `json:"scripts,omitempty"`      // 在工作目录中执行的 bash 命令
+}
+
+// ResourceLimits 项目容器的资源限制，0 表示不限制该项资源
+type ResourceLimits struct {
+	CPUs     float64 `json:"cpus,omitempty"`      // 可用 CPU 数，如 1.5
+	MemoryMB int64   `json:"memory_mb,omitempty"` // 内存上限 (MB)
+	DiskMB   int64   `json:"disk_mb,omitempty"`   // 工作目录磁盘上限 (MB)
 }
 
 // CreateProjectResponse 创建项目响应
@@ -400,7 +708,7 @@ func (c *Client) CreateProject(ctx context.Context, req CreateProjectRequest) (*
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -425,7 +733,65 @@ func (c *Client) DeleteProject(ctx context.Context, req DeleteProjectRequest) (*
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
+	}
+	return &resp, nil
+}
+
+// Container 沙箱中的项目容器
+type Container struct {
+	ContainerID   string `json:"container_id"`   // 容器ID (12位短ID)
+	ContainerName string `json:"container_name"` // 容器名称
+	Image         string `json:"image"`
+	Status        string `json:"status"`     // running, exited, ...
+	CreatedAt     int64  `json:"created_at"` // 创建时间 (Unix 毫秒)
+}
+
+// ListProjectsResponse 列出项目容器响应
+type ListProjectsResponse struct {
+	Status     string      `json:"status"`
+	Containers []Container `json:"containers"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// ListProjects 列出沙箱中的所有项目容器
+func (c *Client) ListProjects(ctx context.Context) (*ListProjectsResponse, error) {
+	var resp ListProjectsResponse
+	err := c.doRequest(ctx, "GET", "/projects/list", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
+	}
+	return &resp, nil
+}
+
+// ContainerStatsRequest 查询容器资源使用请求
+type ContainerStatsRequest struct {
+	ContainerID string `json:"container_id"`
+}
+
+// ContainerStatsResponse 容器实时资源使用，limit 为 0 表示该项资源不限制
+type ContainerStatsResponse struct {
+	Status        string  `json:"status"`
+	CPUPercent    float64 `json:"cpu_percent"` // 占用的 CPU 百分比，以单核为 100%
+	MemoryUsageMB int64   `json:"memory_usage_mb"`
+	MemoryLimitMB int64   `json:"memory_limit_mb"`
+	DiskUsageMB   int64   `json:"disk_usage_mb"`
+	DiskLimitMB   int64   `json:"disk_limit_mb"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// ContainerStats 获取项目容器的实时资源使用
+func (c *Client) ContainerStats(ctx context.Context, req ContainerStatsRequest) (*ContainerStatsResponse, error) {
+	var resp ContainerStatsResponse
+	err := c.doRequest(ctx, "POST", "/projects/stats", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -454,7 +820,7 @@ func (c *Client) ConfigureDomain(ctx context.Context, req ConfigureDomainRequest
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
@@ -551,7 +917,7 @@ func (c *Client) GetLSPDiagnostics(ctx context.Context, req LSPDiagnosticsReques
 		return nil, err
 	}
 	if resp.Error != "" {
-		return &resp, fmt.Errorf("sandbox error: %s", resp.Error)
+		return &resp, fmt.Errorf("%w: %s", ErrSandbox, resp.Error)
 	}
 	return &resp, nil
 }
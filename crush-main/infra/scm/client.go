@@ -0,0 +1,77 @@
+// Package scm posts agent results back to source control hosting services.
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider identifies the SCM API flavour.
+type Provider string
+
+const (
+	ProviderGitHub Provider = "github"
+	ProviderGitLab Provider = "gitlab"
+)
+
+// maxCommentLength keeps comments below the GitHub limit of 65536 characters.
+const maxCommentLength = 60000
+
+// Client posts pull request comments.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates an SCM client.
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// PostComment posts body as a comment to commentURL, the GitHub issue
+// comments endpoint or the GitLab merge request notes endpoint.
+func (c *Client) PostComment(ctx context.Context, provider Provider, commentURL, token, body string) error {
+	if len(body) > maxCommentLength {
+		body = strings.ToValidUTF8(body[:maxCommentLength], "") + "\n\n…(truncated)"
+	}
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return fmt.Errorf("failed to marshal comment: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, commentURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch provider {
+	case ProviderGitHub:
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+token)
+	case ProviderGitLab:
+		req.Header.Set("PRIVATE-TOKEN", token)
+	default:
+		return fmt.Errorf("unsupported scm provider %q", provider)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s API error: status %d: %s", provider, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// PutObject stores data under the given object name.
+func (m *MinIOClient) PutObject(ctx context.Context, objectName string, data []byte, contentType string) error {
+	_, err := m.client.PutObject(ctx, m.bucketName, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+// GetObject opens an object for reading. The caller closes the reader.
+func (m *MinIOClient) GetObject(ctx context.Context, objectName string) (io.ReadCloser, int64, error) {
+	obj, err := m.client.GetObject(ctx, m.bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get object: %w", err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, 0, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return obj, info.Size, nil
+}
+
+// RemoveObject deletes an object. Missing objects are not an error.
+func (m *MinIOClient) RemoveObject(ctx context.Context, objectName string) error {
+	if err := m.client.RemoveObject(ctx, m.bucketName, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove object: %w", err)
+	}
+	return nil
+}
+
+// ComposeObject concatenates the source objects, in order, into a new object.
+// Every source but the last must be at least 5 MiB.
+func (m *MinIOClient) ComposeObject(ctx context.Context, objectName string, sources []string, contentType string) error {
+	srcs := make([]minio.CopySrcOptions, 0, len(sources))
+	for _, source := range sources {
+		srcs = append(srcs, minio.CopySrcOptions{Bucket: m.bucketName, Object: source})
+	}
+	_, err := m.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket:          m.bucketName,
+		Object:          objectName,
+		ReplaceMetadata: true,
+		ContentType:     contentType,
+	}, srcs...)
+	if err != nil {
+		return fmt.Errorf("failed to compose object: %w", err)
+	}
+	return nil
+}
+
+// ObjectExists reports whether an object is stored.
+func (m *MinIOClient) ObjectExists(ctx context.Context, objectName string) (bool, error) {
+	_, err := m.client.StatObject(ctx, m.bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return true, nil
+}
+
+// ObjectName returns the object name of a URL of this storage, or false for
+// URLs pointing elsewhere.
+func (m *MinIOClient) ObjectName(objectURL string) (string, bool) {
+	if !m.IsMinIOURL(objectURL) {
+		return "", false
+	}
+	name, err := m.extractObjectName(objectURL)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// Ping checks that the bucket of the client is reachable.
+func (m *MinIOClient) Ping(ctx context.Context) error {
+	exists, err := m.client.BucketExists(ctx, m.bucketName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", m.bucketName)
+	}
+	return nil
+}
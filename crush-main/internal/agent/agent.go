@@ -11,12 +11,14 @@ import (
 	"cmp"
 	"context"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -29,6 +31,8 @@ import (
 	"charm.land/fantasy/providers/openai"
 	"charm.land/fantasy/providers/openrouter"
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/rolling1314/rolling-crush/domain/audit"
+	"github.com/rolling1314/rolling-crush/domain/budget"
 	"github.com/rolling1314/rolling-crush/domain/message"
 	"github.com/rolling1314/rolling-crush/domain/permission"
 	"github.com/rolling1314/rolling-crush/domain/session"
@@ -37,9 +41,14 @@ import (
 	"github.com/rolling1314/rolling-crush/infra/redis"
 	"github.com/rolling1314/rolling-crush/infra/storage"
 	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+	"github.com/rolling1314/rolling-crush/internal/diagnostics"
 	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+	"github.com/rolling1314/rolling-crush/internal/pkg/log"
 	"github.com/rolling1314/rolling-crush/internal/pkg/stringext"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
 	"github.com/rolling1314/rolling-crush/pkg/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //go:embed templates/title.md
@@ -59,20 +68,69 @@ type SessionAgentCall struct {
 	TopK             *int64
 	FrequencyPenalty *float64
 	PresencePenalty  *float64
+	// ExtraTools are given to the model for this call only, after the agent tools.
+	ExtraTools []fantasy.AgentTool
+	// WorkingDir overrides the project working directory for this call; it
+	// must already be validated against the project workspace.
+	WorkingDir string
+	// Fallbacks are the models tried in order when the large model fails.
+	Fallbacks []FallbackModel
+	// Failover configures the retries of the models on transient provider
+	// errors, nil selects DefaultFailoverPolicy.
+	Failover *FailoverPolicy
+	// AutoFixIterations bounds the follow-up prompts giving the agent the new
+	// LSP errors of the files it edited, 0 disables auto-fix.
+	AutoFixIterations int
+	// PlanMode restricts the model to read-only tools and asks it for a plan
+	// of the changes it would make, the workspace is left untouched.
+	PlanMode bool
+	// ResumeToolCall is the ID of a tool call suspended on a timed out
+	// permission request and granted since. It runs before the prompt.
+	ResumeToolCall string
+	// Capabilities limit the tools given to the model, nil gives all of them.
+	Capabilities *config.ModelCapabilities
+	// BusyPolicy decides what the call does when the session runs another
+	// one, empty queues it.
+	BusyPolicy config.BusyPolicy
+
+	// autoFix follows the errors introduced by the prompt, nil until the
+	// prompt starts
+	autoFix *autoFixState
+
+	// queueID and queuedAt identify the call while it waits in the queue of its session
+	queueID  string
+	queuedAt int64
 }
 
 type SessionAgent interface {
 	Run(context.Context, SessionAgentCall) (*fantasy.AgentResult, error)
 	SetModels(large Model, small Model)
+	// SetTaskModels sets the models used for titles and summaries. An empty
+	// Model falls back to the small model.
+	SetTaskModels(title Model, summary Model)
 	SetTools(tools []fantasy.AgentTool)
-	Cancel(sessionID string)
-	CancelAll()
+	// Cancel cancels the running turn of a session for reason, which is
+	// recorded on the finish of the assistant message.
+	Cancel(sessionID string, reason message.CancelReason)
+	// CancelWithMode cancels the running turn of a session, soft
+	// cancellation lets the current tool finish first.
+	CancelWithMode(sessionID string, mode CancelMode, reason message.CancelReason)
+	CancelAll(reason message.CancelReason)
 	IsSessionBusy(sessionID string) bool
 	IsBusy() bool
 	QueuedPrompts(sessionID string) int
 	ClearQueue(sessionID string)
+	// ListQueue returns the prompts waiting for the running turn of a session.
+	ListQueue(sessionID string) []QueuedPrompt
+	// RemoveQueued drops a queued prompt before it runs.
+	RemoveQueued(sessionID, promptID string) error
+	// ReorderQueue moves the listed prompts to the front of the queue, in order.
+	ReorderQueue(sessionID string, promptIDs []string) error
 	Summarize(context.Context, string, fantasy.ProviderOptions) error
 	Model() Model
+	// LastTimeline returns the timeline of the last turn run in the session
+	// and forgets it.
+	LastTimeline(sessionID string) (TurnTimeline, bool)
 }
 
 type Model struct {
@@ -84,6 +142,8 @@ type Model struct {
 type sessionAgent struct {
 	largeModel           Model
 	smallModel           Model
+	titleModel           Model
+	summaryModel         Model
 	systemPromptPrefix   string
 	systemPrompt         string
 	tools                []fantasy.AgentTool
@@ -94,9 +154,24 @@ type sessionAgent struct {
 	disableAutoSummarize bool
 	isYolo               bool
 	dbQuerier            postgres.Querier // For querying project info
+	moderator            *OutputModerator
+	stallTimeout         time.Duration
+	budgets              budget.Service
+	compactor            *toolResultCompactor
+	loopGuard            *loopGuard
+	audit                audit.Service
+	permissions          permission.Service
+	diagnostics          diagnostics.Source
+	generations          GenerationCache
 
 	messageQueue   *csync.Map[string, []SessionAgentCall]
-	activeRequests *csync.Map[string, context.CancelFunc]
+	queueMu        sync.Mutex // serializes the updates of messageQueue
+	activeRequests *csync.Map[string, context.CancelCauseFunc]
+	timelines      *csync.Map[string, TurnTimeline]
+	turns          *csync.Map[string, *turnControl]
+	// runs are closed when the outermost run of a session returns, the
+	// queued calls run nested in it
+	runs *csync.Map[string, chan struct{}]
 }
 
 type SessionAgentOptions struct {
@@ -112,6 +187,31 @@ type SessionAgentOptions struct {
 	RedisCmd             *redis.CommandService
 	Tools                []fantasy.AgentTool
 	DBQuerier            postgres.Querier
+	// Moderator scans the assistant text sent to users, nil disables moderation.
+	Moderator *OutputModerator
+	// StallTimeout cancels a turn whose provider stream sends no event for
+	// that long, zero disables the watchdog.
+	StallTimeout time.Duration
+	// Budgets refuses and stops turns once a spending budget is used up, nil
+	// disables the budgets.
+	Budgets budget.Service
+	// ToolResultCompaction configures the eliding of old tool results, nil
+	// selects the defaults.
+	ToolResultCompaction *config.ToolResultCompaction
+	// LoopGuard configures the detection of repeated tool calls, nil selects
+	// the defaults.
+	LoopGuard *config.LoopGuard
+	// Audit records the tool calls run by the agent, nil disables the audit log.
+	Audit audit.Service
+	// Permissions provides how the permissions of the audited tool calls were
+	// decided.
+	Permissions permission.Service
+	// Diagnostics reports the LSP errors checked by auto-fix, nil disables
+	// auto-fix.
+	Diagnostics diagnostics.Source
+	// GenerationCache serves the titles and summaries generated again for the
+	// same content, nil disables the cache.
+	GenerationCache GenerationCache
 }
 
 func NewSessionAgent(
@@ -130,12 +230,24 @@ func NewSessionAgent(
 		tools:                opts.Tools,
 		isYolo:               opts.IsYolo,
 		dbQuerier:            opts.DBQuerier,
+		moderator:            opts.Moderator,
+		stallTimeout:         opts.StallTimeout,
+		budgets:              opts.Budgets,
+		compactor:            newToolResultCompactor(opts.ToolResultCompaction),
+		loopGuard:            newLoopGuard(opts.LoopGuard),
+		audit:                opts.Audit,
+		permissions:          opts.Permissions,
+		diagnostics:          opts.Diagnostics,
+		generations:          opts.GenerationCache,
 		messageQueue:         csync.NewMap[string, []SessionAgentCall](),
-		activeRequests:       csync.NewMap[string, context.CancelFunc](),
+		activeRequests:       csync.NewMap[string, context.CancelCauseFunc](),
+		timelines:            csync.NewMap[string, TurnTimeline](),
+		turns:                csync.NewMap[string, *turnControl](),
+		runs:                 csync.NewMap[string, chan struct{}](),
 	}
 }
 
-func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy.AgentResult, error) {
+func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (_ *fantasy.AgentResult, err error) {
 	//f, err := os.OpenFile("/Users/apple/Downloads/crush-main/logs/all_content.txt",
 	//	os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	//
@@ -152,27 +264,78 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 	if call.SessionID == "" {
 		return nil, ErrSessionMissing
 	}
+	ctx = log.WithSessionID(ctx, call.SessionID)
 
-	// Queue the message if busy
+	// A busy session queues the call, refuses it or cancels the running turn
+	// for it
 	if a.IsSessionBusy(call.SessionID) {
-		existing, ok := a.messageQueue.Get(call.SessionID)
-		if !ok {
-			existing = []SessionAgentCall{}
+		switch call.BusyPolicy {
+		case config.BusyPolicyReject:
+			return nil, ErrSessionBusy
+		case config.BusyPolicyInterrupt:
+			if err := a.interrupt(ctx, call.SessionID); err != nil {
+				return nil, err
+			}
+		default:
+			a.enqueue(call)
+			return nil, nil
 		}
-		existing = append(existing, call)
-		a.messageQueue.Set(call.SessionID, existing)
-		return nil, nil
+	}
+	if _, ok := a.runs.Get(call.SessionID); !ok {
+		done := make(chan struct{})
+		a.runs.Set(call.SessionID, done)
+		defer func() {
+			a.runs.Del(call.SessionID)
+			close(done)
+		}()
 	}
 
+	// The steps are children of the run, their provider calls and tools of them
+	ctx, runSpan := tracing.Start(ctx, "agent.run", tracing.SessionIDKey.String(call.SessionID), attribute.Bool("plan_mode", call.PlanMode))
+	var stepSpan trace.Span
+	endStep := func(err error) {
+		if stepSpan != nil {
+			tracing.End(stepSpan, err)
+			stepSpan = nil
+		}
+	}
+	defer func() {
+		endStep(err)
+		tracing.End(runSpan, err)
+	}()
+
 	if len(a.tools) > 0 {
 		// Add Anthropic caching to the last tool.
 		a.tools[len(a.tools)-1].SetProviderOptions(a.getCacheControlOptions())
 	}
+	// Extra tools come after the cached agent tools so the cached prefix is stable
+	agentTools := tools.WithTracing(append(slices.Clone(a.tools), call.ExtraTools...))
+	systemPrompt := a.systemPrompt
+	if call.PlanMode {
+		agentTools = readOnlyTools(agentTools)
+		systemPrompt = withPlanMode(systemPrompt)
+	}
+	agentTools = withCapabilities(agentTools, call.Capabilities)
+
+	// The large model is retried on transient errors and fails over to the
+	// fallbacks, the retries of fantasy are disabled
+	chain := append([]FallbackModel{{
+		Model:            a.largeModel,
+		MaxOutputTokens:  call.MaxOutputTokens,
+		ProviderOptions:  call.ProviderOptions,
+		Temperature:      call.Temperature,
+		TopP:             call.TopP,
+		TopK:             call.TopK,
+		FrequencyPenalty: call.FrequencyPenalty,
+		PresencePenalty:  call.PresencePenalty,
+	}}, call.Fallbacks...)
+	failover := newFailoverModel(chain, *cmp.Or(call.Failover, &DefaultFailoverPolicy))
+	noRetries := 0
 
 	agent := fantasy.NewAgent(
-		a.largeModel.Model,
-		fantasy.WithSystemPrompt(a.systemPrompt),
-		fantasy.WithTools(a.tools...),
+		failover,
+		fantasy.WithSystemPrompt(systemPrompt),
+		fantasy.WithTools(agentTools...),
 	)
 	//if _, err := f.WriteString(a.systemPrompt + "\n"); err != nil {
 	//	panic(err)
@@ -182,6 +345,8 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
+	// The counters before the prompt, the title generation may change the session
+	checkpoint := currentSession
 
 	msgs, err := a.getSessionMessages(ctx, currentSession)
 
@@ -199,11 +364,26 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 		})
 	}
 
+	// Record the timing breakdown of the turn, saved once the turn is over.
+	// The database writes use a fresh context as the turn may be cancelled.
+	timeline := newTimelineRecorder(call.SessionID)
+	saveTimeline := sync.OnceFunc(func() {
+		a.saveTimeline(context.Background(), timeline)
+	})
+	defer saveTimeline()
+
 	// Add the user message to the session.
-	_, err = a.createUserMessage(ctx, call)
+	userMsg, err := a.createUserMessage(ctx, call)
 	if err != nil {
 		return nil, err
 	}
+	timeline.addMessage(userMsg.ID)
+	a.checkpoint(ctx, checkpoint, userMsg.ID)
+
+	// Refuse the turn once a budget of the session is used up
+	if err := a.enforceBudget(ctx, call.SessionID); err != nil {
+		return nil, a.refuseOverBudget(ctx, call.SessionID, err)
+	}
 
 	// Add the session to the context.
 	ctx = context.WithValue(ctx, tools.SessionIDContextKey, call.SessionID)
@@ -223,13 +403,42 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 			}
 		}
 	}
+	if call.WorkingDir != "" {
+		ctx = context.WithValue(ctx, tools.WorkingDirContextKey, call.WorkingDir)
+	}
+
+	// The errors the edits introduce are told apart from the ones already there
+	a.startAutoFix(ctx, &call)
 
-	genCtx, cancel := context.WithCancel(ctx)
-	a.activeRequests.Set(call.SessionID, cancel)
+	genCtx, cancelCause := context.WithCancelCause(ctx)
+	cancel := func() { cancelCause(nil) }
+	a.activeRequests.Set(call.SessionID, cancelCause)
 
 	defer cancel()
 	defer a.activeRequests.Del(call.SessionID)
 
+	// Soft cancellation stops the turn between tools, tools see the signal to
+	// stop waiting on the user
+	turn := newTurnControl()
+	a.turns.Set(call.SessionID, turn)
+	defer a.turns.Del(call.SessionID)
+
+	// Cancel the turn when the provider stream hangs without failing
+	watchdog := newStallWatchdog(a.stallTimeout)
+	stopWatchdog := watchdog.watch(genCtx, turn, func(silent time.Duration) {
+		slog.Warn("Provider stream stalled, cancelling the turn", "session_id", call.SessionID, "silent", silent.Truncate(time.Second))
+		cancelCause(ErrStreamStalled)
+	})
+	defer stopWatchdog()
+	genCtx = context.WithValue(genCtx, tools.StopSignalContextKey, (<-chan struct{})(turn.stop))
+
+	// A suspended tool call granted since runs first, the turn goes on from its result
+	if call.ResumeToolCall != "" {
+		if err := a.resumeToolCall(genCtx, call.SessionID, call.ResumeToolCall, agentTools, msgs); err != nil {
+			slog.Warn("Failed to resume tool call", "session_id", call.SessionID, "tool_call_id", call.ResumeToolCall, "error", err)
+		}
+	}
+
 	history, files := a.preparePrompt(msgs, call.Attachments...)
 
 	//historyData, err := json.MarshalIndent(history, "", "  ")
@@ -249,6 +458,35 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 
 	var currentAssistant *message.Message
 	var shouldSummarize bool
+	// loopTool and loopRepeats are set when the turn is stopped because a tool
+	// call kept repeating.
+	var loopTool string
+	var loopRepeats int
+	// budgetErr is set when the turn is stopped because a budget was used up.
+	var budgetErr error
+	// moderation holds back the text of the current step until it is checked.
+	var moderation *moderationStream
+	releaseText := func(text string) {
+		if text == "" {
+			return
+		}
+		currentAssistant.AppendContent(text)
+		// Publish incremental delta instead of full message
+		a.publishDelta(currentAssistant, message.NewTextDelta(currentAssistant.ID, call.SessionID, text))
+	}
+	flushModeration := func() error {
+		text, err := moderation.flush()
+		releaseText(text)
+		a.recordModeration(call.SessionID, currentAssistant.ID, moderation.takeHits())
+		return err
+	}
+	failover.onRetry = func(_ error, delay time.Duration) {
+		watchdog.expectSilence(delay)
+	}
+	failover.onSwitch = func(from, to Model, err error) {
+		watchdog.touch()
+		publishModelSwitch(call.SessionID, currentAssistant, from, to, err)
+	}
 	result, err := agent.Stream(genCtx, fantasy.AgentStreamCall{
 		Prompt:           call.Prompt,
 		Files:            files,
@@ -260,22 +498,46 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 		PresencePenalty:  call.PresencePenalty,
 		TopK:             call.TopK,
 		FrequencyPenalty: call.FrequencyPenalty,
+		MaxRetries:       &noRetries,
 		// Before each step create a new assistant message.
 		PrepareStep: func(callContext context.Context, options fantasy.PrepareStepFunctionOptions) (_ context.Context, prepared fantasy.PrepareStepResult, err error) {
 			prepared.Messages = options.Messages
+			turn.inTools.Store(false)
+			watchdog.touch()
+			if turn.stopRequested() {
+				return callContext, prepared, errSoftCancelled
+			}
+			endStep(nil)
+			timeline.prepareStarted()
+			var prepare StepPrepare
+			callContext, stepSpan = tracing.Start(trace.ContextWithSpan(callContext, runSpan), "agent.step",
+				tracing.SessionIDKey.String(call.SessionID),
+				attribute.Int("step", options.StepNumber),
+			)
 			// Reset all cached items.
 			for i := range prepared.Messages {
 				prepared.Messages[i].ProviderOptions = nil
 			}
 
-			queuedCalls, _ := a.messageQueue.Get(call.SessionID)
-			a.messageQueue.Del(call.SessionID)
-			for _, queued := range queuedCalls {
+			for _, queued := range a.takeQueue(call.SessionID) {
+				prepare.QueuedPrompts++
 				userMessage, createErr := a.createUserMessage(callContext, queued)
 				if createErr != nil {
 					return callContext, prepared, createErr
 				}
 				prepared.Messages = append(prepared.Messages, userMessage.ToAIMessage()...)
+				timeline.addMessage(userMessage.ID)
+				a.checkpoint(callContext, currentSession, userMessage.ID)
+			}
+
+			// Elide old tool results first, the summary only comes once that is not enough
+			if a.compactor.active(int64(a.largeModel.CatwalkCfg.ContextWindow), currentSession.PromptTokens+currentSession.CompletionTokens) {
+				var compacted int
+				prepared.Messages, compacted = a.compactor.compact(prepared.Messages)
+				prepare.CompactedResults = compacted
+				if compacted > 0 {
+					slog.Debug("Compacted old tool results", "session_id", call.SessionID, "results", compacted)
+				}
 			}
 
 			lastSystemRoleInx := 0
@@ -298,33 +560,48 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 				prepared.Messages = append([]fantasy.Message{fantasy.NewSystemMessage(promptPrefix)}, prepared.Messages...)
 			}
 
+			// Nudge the model out of a tool call loop before it has to be stopped.
+			if tc, repeats, ok := a.loopGuard.nudge(options.Steps); ok {
+				slog.Warn("Repeated tool call detected, nudging the model", "session_id", call.SessionID, "tool", tc.ToolName, "repeats", repeats)
+				prepared.Messages = append(prepared.Messages, fantasy.NewUserMessage(fmt.Sprintf(loopGuardNudge, tc.ToolName, repeats)))
+				prepare.LoopNudge = true
+			}
+			prepare.Messages = len(prepared.Messages)
+
 			var assistantMsg message.Message
+			createStart := time.Now()
 			assistantMsg, err = a.messages.Create(callContext, call.SessionID, message.CreateMessageParams{
 				Role:     message.Assistant,
 				Parts:    []message.ContentPart{},
-				Model:    a.largeModel.ModelCfg.Model,
-				Provider: a.largeModel.ModelCfg.Provider,
+				Model:    failover.active().ModelCfg.Model,
+				Provider: failover.active().ModelCfg.Provider,
 			})
 			if err != nil {
 				return callContext, prepared, err
 			}
+			timeline.stepStarted(assistantMsg.ID, time.Since(createStart))
+			timeline.stepPrepared(prepare, assistantMsg.Provider, assistantMsg.Model)
+			stepSpan.SetAttributes(tracing.MessageIDKey.String(assistantMsg.ID))
 			callContext = context.WithValue(callContext, tools.MessageIDContextKey, assistantMsg.ID)
 			currentAssistant = &assistantMsg
+			moderation = a.moderator.stream()
 			return callContext, prepared, err
 		},
+		OnChunk: func(fantasy.StreamPart) error {
+			watchdog.touch()
+			return nil
+		},
 		OnReasoningStart: func(id string, reasoning fantasy.ReasoningContent) error {
+			timeline.firstToken()
 			currentAssistant.AppendReasoningContent(reasoning.Text)
 			// Publish incremental delta instead of full message
-			a.messages.PublishDelta(message.NewReasoningDelta(currentAssistant.ID, call.SessionID, reasoning.Text))
+			a.publishDelta(currentAssistant, message.NewReasoningDelta(currentAssistant.ID, call.SessionID, reasoning.Text))
 			return nil
 		},
 		OnReasoningDelta: func(id string, text string) error {
-			// DEBUG: 打印推理/思考流式输出
-			fmt.Printf("[REASONING] %s", text)
-
 			currentAssistant.AppendReasoningContent(text)
 			// Publish incremental delta instead of full message
-			a.messages.PublishDelta(message.NewReasoningDelta(currentAssistant.ID, call.SessionID, text))
+			a.publishDelta(currentAssistant, message.NewReasoningDelta(currentAssistant.ID, call.SessionID, text))
 			return nil
 		},
 		OnReasoningEnd: func(id string, reasoning fantasy.ReasoningContent) error {
@@ -350,6 +627,7 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 			return nil
 		},
 		OnTextDelta: func(id string, text string) error {
+			timeline.firstToken()
 			// Strip leading newline from initial text content. This is is
 			// particularly important in non-interactive mode where leading
 			// newlines are very visible.
@@ -357,17 +635,20 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 				text = strings.TrimPrefix(text, "\n")
 			}
 
-			// DEBUG: 打印流式文本输出
-			fmt.Printf("[STREAM TEXT] %s", text)
-
-			currentAssistant.AppendContent(text)
-			// Publish incremental delta instead of full message
-			a.messages.PublishDelta(message.NewTextDelta(currentAssistant.ID, call.SessionID, text))
+			text, modErr := moderation.write(text)
+			releaseText(text)
+			if modErr != nil {
+				a.recordModeration(call.SessionID, currentAssistant.ID, moderation.takeHits())
+				return modErr
+			}
 			return nil
 		},
+		OnTextEnd: func(id string) error {
+			return flushModeration()
+		},
 		OnToolInputStart: func(id string, toolName string) error {
-			// DEBUG: 打印工具调用开始
-			fmt.Printf("\n[TOOL START] id=%s, name=%s\n", id, toolName)
+			timeline.firstToken()
+			slog.DebugContext(genCtx, "Tool input started", "tool_call_id", id, "tool", toolName)
 
 			toolCall := message.ToolCall{
 				ID:               id,
@@ -409,15 +690,19 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 			}
 
 			// Publish tool call delta to notify frontend about new tool call
-			a.messages.PublishDelta(message.NewToolCallDelta(currentAssistant.ID, call.SessionID, id, toolName))
+			a.publishDelta(currentAssistant, message.NewToolCallDelta(currentAssistant.ID, call.SessionID, id, toolName))
 			return nil
 		},
-		OnRetry: func(err *fantasy.ProviderError, delay time.Duration) {
-			// TODO: implement
+		OnStreamFinish: func(fantasy.Usage, fantasy.FinishReason, fantasy.ProviderMetadata) error {
+			if err := flushModeration(); err != nil {
+				return err
+			}
+			timeline.streamFinished()
+			turn.inTools.Store(len(currentAssistant.ToolCalls()) > 0)
+			return nil
 		},
 		OnToolCall: func(tc fantasy.ToolCallContent) error {
-			// DEBUG: 打印工具调用完成 (含参数)
-			fmt.Printf("\n[TOOL CALL] id=%s, name=%s, input=%s\n", tc.ToolCallID, tc.ToolName, tc.Input)
+			slog.DebugContext(genCtx, "Tool called", "tool_call_id", tc.ToolCallID, "tool", tc.ToolName, "input", tc.Input)
 
 			toolCall := message.ToolCall{
 				ID:               tc.ToolCallID,
@@ -457,7 +742,7 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 			}
 
 			// Publish tool call input delta - this is the complete input for the tool call
-			a.messages.PublishDelta(message.NewToolCallInputDelta(currentAssistant.ID, call.SessionID, tc.ToolCallID, tc.Input))
+			a.publishDelta(currentAssistant, message.NewToolCallInputDelta(currentAssistant.ID, call.SessionID, tc.ToolCallID, tc.Input))
 			return nil
 		},
 		OnToolResult: func(result fantasy.ToolResultContent) error {
@@ -478,9 +763,11 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 			case fantasy.ToolResultContentTypeMedia:
 				// TODO: handle this message type
 			}
+			duration := timeline.toolFinished(result.ToolCallID, result.ToolName, isError)
+			a.auditToolCall(genCtx, currentAssistant, result, resultContent, isError, duration)
+			persistStart := time.Now()
 
-			// DEBUG: 打印工具调用结果
-			fmt.Printf("\n[TOOL RESULT] id=%s, name=%s, isError=%v, content=%s\n", result.ToolCallID, result.ToolName, isError, resultContent)
+			slog.DebugContext(genCtx, "Tool finished", "tool_call_id", result.ToolCallID, "tool", result.ToolName, "is_error", isError, "content_len", len(resultContent))
 
 			// Update tool call state to completed/error
 			if a.toolCalls != nil {
@@ -526,18 +813,37 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 				IsError:    isError,
 				Metadata:   result.ClientMetadata,
 			}
-			_, createMsgErr := a.messages.Create(genCtx, currentAssistant.SessionID, message.CreateMessageParams{
+			toolMsg, createMsgErr := a.messages.Create(genCtx, currentAssistant.SessionID, message.CreateMessageParams{
 				Role: message.Tool,
 				Parts: []message.ContentPart{
 					toolResult,
 				},
 			})
+			timeline.persisted(time.Since(persistStart))
 			if createMsgErr != nil {
 				return createMsgErr
 			}
+			timeline.addMessage(toolMsg.ID)
+			if turn.stopRequested() {
+				// The tool finished and its result is stored, skip the others
+				return errSoftCancelled
+			}
 			return nil
 		},
-		OnStepFinish: func(stepResult fantasy.StepResult) error {
+		OnStepFinish: func(stepResult fantasy.StepResult) (err error) {
+			turn.inTools.Store(false)
+			persistStart := time.Now()
+			defer func() {
+				timeline.persisted(time.Since(persistStart))
+				if stepSpan != nil {
+					stepSpan.SetAttributes(
+						attribute.String("finish_reason", string(stepResult.FinishReason)),
+						attribute.Int64("usage.input_tokens", stepResult.Usage.InputTokens),
+						attribute.Int64("usage.output_tokens", stepResult.Usage.OutputTokens),
+					)
+				}
+				endStep(err)
+			}()
 			finishReason := message.FinishReasonUnknown
 			switch stepResult.FinishReason {
 			case fantasy.FinishReasonLength:
@@ -548,7 +854,8 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 				finishReason = message.FinishReasonToolUse
 			}
 			currentAssistant.AddFinish(finishReason, "", "")
-			a.updateSessionUsage(a.largeModel, &currentSession, stepResult.Usage, a.openrouterCost(stepResult.ProviderMetadata))
+			cost := a.updateSessionUsage(genCtx, failover.active(), currentAssistant.ID, &currentSession, stepResult.Usage, a.openrouterCost(stepResult.ProviderMetadata))
+			timeline.stepFinished(string(finishReason), stepResult.Usage, cost)
 			sessionLock.Lock()
 			// Fetch fresh session from DB to preserve todos that may have been updated by tools
 			freshSession, fetchErr := a.sessions.Get(genCtx, currentSession.ID)
@@ -571,7 +878,11 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 			}
 			// Publish finish delta to notify frontend streaming is complete for this message
 			a.messages.PublishDelta(message.NewFinishDelta(currentAssistant.ID, call.SessionID, string(finishReason)))
-			return a.messages.Update(genCtx, *currentAssistant)
+			if updateErr := a.messages.Update(genCtx, *currentAssistant); updateErr != nil {
+				return updateErr
+			}
+			// Persist the writes buffered during this step (tool calls, tool results, the assistant message)
+			return a.messages.Flush(genCtx)
 		},
 		StopWhen: []fantasy.StopCondition{
 			func(_ []fantasy.StepResult) bool {
@@ -590,6 +901,27 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 				}
 				return false
 			},
+			func(steps []fantasy.StepResult) bool {
+				tc, repeats, ok := a.loopGuard.stop(steps)
+				if !ok {
+					return false
+				}
+				slog.Warn("Tool call loop detected, stopping the turn", "session_id", call.SessionID, "tool", tc.ToolName, "repeats", repeats)
+				loopTool, loopRepeats = tc.ToolName, repeats
+				return true
+			},
+			func(_ []fantasy.StepResult) bool {
+				// The usage of the step is saved by now
+				if err := a.enforceBudget(genCtx, call.SessionID); err != nil {
+					slog.Warn("Budget exceeded, stopping the turn", "session_id", call.SessionID, "error", err)
+					budgetErr = err
+					return true
+				}
+				return false
+			},
+			func(_ []fantasy.StepResult) bool {
+				return turn.stopRequested()
+			},
 		},
 	})
 	//-----------------
@@ -612,14 +944,28 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 	a.eventPromptResponded(call.SessionID, time.Since(startTime).Truncate(time.Second))
 
 	if err != nil {
-		isCancelErr := errors.Is(err, context.Canceled)
+		if errors.Is(err, errSoftCancelled) {
+			defer a.cancelToolCalls(call.SessionID)
+		}
+		if errors.Is(context.Cause(genCtx), ErrStreamStalled) {
+			err = fmt.Errorf("%w: no response for %s", ErrStreamStalled, a.stallTimeout)
+		}
+		reason, isCancelErr := cancelReason(genCtx, err)
+		if errors.Is(err, errSoftCancelled) {
+			reason = cmp.Or(turn.reason, reason)
+		}
 		isPermissionErr := errors.Is(err, permission.ErrorPermissionDenied)
+		// A timed out permission request suspends its tool call until the user answers
+		var permissionTimeout *permission.TimeoutError
+		if errors.As(err, &permissionTimeout) {
+			a.suspendToolCall(ctx, call.Prompt, permissionTimeout)
+		}
 		if currentAssistant == nil {
 			// No assistant message was created yet, but we still need to show error to frontend
 			// Send error delta to show as toast notification (not stored in chat history)
 			if !isCancelErr && !isPermissionErr {
 				errMsg := formatErrorMessage(err.Error())
-				a.messages.PublishDelta(message.NewErrorDelta(call.SessionID, errMsg))
+				a.messages.PublishDelta(message.NewErrorDelta(call.SessionID, errMsg, ClassifyError(err)))
 			}
 			return result, err
 		}
@@ -633,8 +979,11 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 		}
 		for _, tc := range toolCalls {
 			if !tc.Finished {
+				// Keep the input streamed so far when it is whole
 				tc.Finished = true
-				tc.Input = "{}"
+				if !json.Valid([]byte(tc.Input)) {
+					tc.Input = "{}"
+				}
 				currentAssistant.AddToolCall(tc)
 				updateErr := a.messages.Update(ctx, *currentAssistant)
 				if updateErr != nil {
@@ -661,9 +1010,14 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 			}
 			content := "There was an error while executing the tool"
 			if isCancelErr {
-				content = "Tool execution canceled by user"
+				content = toolCanceledContent(reason)
 			} else if isPermissionErr {
 				content = "User denied permission"
+				if reason := permission.DenialReason(err); reason != "" {
+					content += ": " + reason
+				}
+			} else if permissionTimeout != nil && tc.ID == permissionTimeout.Request.ToolCallID {
+				content = permissionTimeoutContent
 			}
 			toolResult := message.ToolResult{
 				ToolCallID: tc.ID,
@@ -683,12 +1037,21 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 		}
 		var fantasyErr *fantasy.Error
 		var providerErr *fantasy.ProviderError
+		var haltErr *ModerationHaltError
 		const defaultTitle = "Provider Error"
 		var errorMessage string
 		if isCancelErr {
-			currentAssistant.AddFinish(message.FinishReasonCanceled, "User canceled request", "")
+			currentAssistant.AddCancelFinish(message.FinishReasonCanceled, reason, "")
 		} else if isPermissionErr {
-			currentAssistant.AddFinish(message.FinishReasonPermissionDenied, "User denied permission", "")
+			currentAssistant.AddFinish(message.FinishReasonPermissionDenied, "User denied permission", permission.DenialReason(err))
+		} else if permissionTimeout != nil {
+			currentAssistant.AddFinish(message.FinishReasonPermissionTimeout, "Permission request timed out", fmt.Sprintf("The %s tool call waits for the permission of the user", permissionTimeout.Request.ToolName))
+		} else if errors.As(err, &haltErr) {
+			currentAssistant.AddFinish(message.FinishReasonModerated, "Response halted", haltErr.Error())
+			errorMessage = haltErr.Error()
+		} else if errors.Is(err, ErrStreamStalled) {
+			currentAssistant.AddFinish(message.FinishReasonStalled, "Response stalled", err.Error())
+			errorMessage = err.Error()
 		} else if errors.As(err, &providerErr) {
 			currentAssistant.AddFinish(message.FinishReasonError, cmp.Or(stringext.Capitalize(providerErr.Title), defaultTitle), providerErr.Message)
 			errorMessage = providerErr.Message
@@ -703,11 +1066,19 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 		// Send error message to frontend as toast notification (not stored in history)
 		if errorMessage != "" {
 			userFriendlyMsg := formatErrorMessage(errorMessage)
-			a.messages.PublishDelta(message.NewErrorDelta(call.SessionID, userFriendlyMsg))
+			a.messages.PublishDelta(message.NewErrorDelta(call.SessionID, userFriendlyMsg, ClassifyError(err)))
 		}
 
 		// Publish finish delta to notify frontend streaming is complete
-		a.messages.PublishDelta(message.NewFinishDelta(currentAssistant.ID, call.SessionID, string(message.FinishReasonError)))
+		if isCancelErr {
+			a.messages.PublishDelta(message.NewCancelFinishDelta(currentAssistant.ID, call.SessionID, message.FinishReasonCanceled, reason))
+		} else {
+			finishReason := message.FinishReasonError
+			if r := currentAssistant.FinishReason(); r == message.FinishReasonStalled || r == message.FinishReasonPermissionTimeout {
+				finishReason = r
+			}
+			a.messages.PublishDelta(message.NewFinishDelta(currentAssistant.ID, call.SessionID, string(finishReason)))
+		}
 
 		// Note: we use the parent context here because the genCtx has been
 		// cancelled.
@@ -715,38 +1086,83 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 		if updateErr != nil {
 			return nil, updateErr
 		}
+		if flushErr := a.messages.Flush(ctx); flushErr != nil {
+			slog.Warn("Failed to flush message writes", "session_id", call.SessionID, "error", flushErr)
+		}
 		return nil, err
 	}
 	wg.Wait()
 
+	// The stop was requested once the tools of the last step were done
+	if turn.stopRequested() {
+		currentAssistant.AddCancelFinish(message.FinishReasonCanceled, turn.reason, "")
+		a.messages.PublishDelta(message.NewCancelFinishDelta(currentAssistant.ID, call.SessionID, message.FinishReasonCanceled, turn.reason))
+		if updateErr := a.messages.Update(ctx, *currentAssistant); updateErr != nil {
+			return nil, updateErr
+		}
+		if flushErr := a.messages.Flush(ctx); flushErr != nil {
+			return nil, flushErr
+		}
+		a.cancelToolCalls(call.SessionID)
+		return nil, errSoftCancelled
+	}
+
+	if loopTool != "" {
+		currentAssistant.AddFinish(message.FinishReasonLoopDetected, "Loop detected", fmt.Sprintf("Stopped after the %s tool was called %d times with identical input", loopTool, loopRepeats))
+		a.messages.PublishDelta(message.NewFinishDelta(currentAssistant.ID, call.SessionID, string(message.FinishReasonLoopDetected)))
+		if updateErr := a.messages.Update(ctx, *currentAssistant); updateErr != nil {
+			return nil, updateErr
+		}
+		if flushErr := a.messages.Flush(ctx); flushErr != nil {
+			return nil, flushErr
+		}
+	}
+
+	if budgetErr != nil {
+		currentAssistant.AddCancelFinish(message.FinishReasonBudgetExceeded, message.CancelReasonBudget, budgetErr.Error())
+		a.messages.PublishDelta(message.NewErrorDelta(call.SessionID, budgetErr.Error(), ClassifyError(budgetErr)))
+		a.messages.PublishDelta(message.NewCancelFinishDelta(currentAssistant.ID, call.SessionID, message.FinishReasonBudgetExceeded, message.CancelReasonBudget))
+		if updateErr := a.messages.Update(ctx, *currentAssistant); updateErr != nil {
+			return nil, updateErr
+		}
+		if flushErr := a.messages.Flush(ctx); flushErr != nil {
+			return nil, flushErr
+		}
+		// The queued prompts would be refused as well
+		a.ClearQueue(call.SessionID)
+		return result, budgetErr
+	}
+
+	var continued bool
 	if shouldSummarize {
 		a.activeRequests.Del(call.SessionID)
 		if summarizeErr := a.Summarize(genCtx, call.SessionID, call.ProviderOptions); summarizeErr != nil {
 			return nil, summarizeErr
 		}
 		// If the agent wasn't done...
-		if len(currentAssistant.ToolCalls()) > 0 {
-			existing, ok := a.messageQueue.Get(call.SessionID)
-			if !ok {
-				existing = []SessionAgentCall{}
-			}
+		if len(currentAssistant.ToolCalls()) > 0 && loopTool == "" {
 			call.Prompt = fmt.Sprintf("The previous session was interrupted because it got too long, the initial user request was: `%s`", call.Prompt)
-			existing = append(existing, call)
-			a.messageQueue.Set(call.SessionID, existing)
+			call.queueID = ""
+			a.enqueue(call)
+			continued = true
 		}
 	}
 
+	// Once the prompt is done, give the agent the errors its edits introduced
+	if !continued && loopTool == "" {
+		a.queueAutoFix(ctx, call)
+	}
+
 	// Release active request before processing queued messages.
 	a.activeRequests.Del(call.SessionID)
 	cancel()
 
-	queuedMessages, ok := a.messageQueue.Get(call.SessionID)
-	if !ok || len(queuedMessages) == 0 {
+	firstQueuedMessage, ok := a.dequeue(call.SessionID)
+	if !ok {
 		return result, err
 	}
 	// There are queued messages restart the loop.
-	firstQueuedMessage := queuedMessages[0]
-	a.messageQueue.Set(call.SessionID, queuedMessages[1:])
+	saveTimeline()
 	return a.Run(ctx, firstQueuedMessage)
 }
 
@@ -770,24 +1186,39 @@ func (a *sessionAgent) Summarize(ctx context.Context, sessionID string, opts fan
 
 	aiMsgs, _ := a.preparePrompt(msgs)
 
-	genCtx, cancel := context.WithCancel(ctx)
+	genCtx, cancel := context.WithCancelCause(ctx)
 	a.activeRequests.Set(sessionID, cancel)
 	defer a.activeRequests.Del(sessionID)
-	defer cancel()
+	defer cancel(nil)
 
-	agent := fantasy.NewAgent(a.largeModel.Model,
+	summaryModel := a.summaryLLM()
+	if summaryModel.ModelCfg.Provider != a.largeModel.ModelCfg.Provider || summaryModel.ModelCfg.Model != a.largeModel.ModelCfg.Model {
+		// The provider options were built for the large model
+		opts = nil
+	}
+	agent := fantasy.NewAgent(summaryModel.Model,
 		fantasy.WithSystemPrompt(string(summaryPrompt)),
 	)
 	summaryMessage, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{
 		Role:             message.Assistant,
-		Model:            a.largeModel.Model.Model(),
-		Provider:         a.largeModel.Model.Provider(),
+		Model:            summaryModel.Model.Model(),
+		Provider:         summaryModel.Model.Provider(),
 		IsSummaryMessage: true,
 	})
 	if err != nil {
 		return err
 	}
 
+	// A summary of the same messages may have been generated before a crash
+	// or a replay of the turn, it is not billed again
+	cacheKey, _ := generationCacheKey("summary", summaryModel, a.systemPromptPrefix, aiMsgs)
+	if cached, ok := a.cachedGeneration(ctx, sessionID, cacheKey); ok {
+		slog.Debug("Summary served from cache", "session_id", sessionID)
+		summaryMessage.AppendContent(cached.Text)
+		a.publishDelta(&summaryMessage, message.NewTextDelta(summaryMessage.ID, sessionID, cached.Text))
+		return a.finishSummary(genCtx, msgs, currentSession, summaryMessage, cached.OutputTokens)
+	}
+
 	resp, err := agent.Stream(genCtx, fantasy.AgentStreamCall{
 		Prompt:          "Provide a detailed summary of our conversation above.",
 		Messages:        aiMsgs,
@@ -802,7 +1233,7 @@ func (a *sessionAgent) Summarize(ctx context.Context, sessionID string, opts fan
 		OnReasoningDelta: func(id string, text string) error {
 			summaryMessage.AppendReasoningContent(text)
 			// Publish incremental delta instead of full message
-			a.messages.PublishDelta(message.NewReasoningDelta(summaryMessage.ID, sessionID, text))
+			a.publishDelta(&summaryMessage, message.NewReasoningDelta(summaryMessage.ID, sessionID, text))
 			return nil
 		},
 		OnReasoningEnd: func(id string, reasoning fantasy.ReasoningContent) error {
@@ -819,7 +1250,7 @@ func (a *sessionAgent) Summarize(ctx context.Context, sessionID string, opts fan
 		OnTextDelta: func(id, text string) error {
 			summaryMessage.AppendContent(text)
 			// Publish incremental delta instead of full message
-			a.messages.PublishDelta(message.NewTextDelta(summaryMessage.ID, sessionID, text))
+			a.publishDelta(&summaryMessage, message.NewTextDelta(summaryMessage.ID, sessionID, text))
 			return nil
 		},
 	})
@@ -833,14 +1264,6 @@ func (a *sessionAgent) Summarize(ctx context.Context, sessionID string, opts fan
 		return err
 	}
 
-	// Publish finish delta before updating to DB
-	a.messages.PublishDelta(message.NewFinishDelta(summaryMessage.ID, sessionID, string(message.FinishReasonEndTurn)))
-	summaryMessage.AddFinish(message.FinishReasonEndTurn, "", "")
-	err = a.messages.Update(genCtx, summaryMessage)
-	if err != nil {
-		return err
-	}
-
 	var openrouterCost *float64
 	for _, step := range resp.Steps {
 		stepCost := a.openrouterCost(step.ProviderMetadata)
@@ -853,20 +1276,43 @@ func (a *sessionAgent) Summarize(ctx context.Context, sessionID string, opts fan
 		}
 	}
 
-	a.updateSessionUsage(a.largeModel, &currentSession, resp.TotalUsage, openrouterCost)
+	a.updateSessionUsage(ctx, summaryModel, summaryMessage.ID, &currentSession, resp.TotalUsage, openrouterCost)
 
 	// Just in case, get just the last usage info.
 	usage := resp.Response.Usage
+	if err := a.finishSummary(genCtx, msgs, currentSession, summaryMessage, usage.OutputTokens); err != nil {
+		return err
+	}
+	a.cacheGeneration(ctx, sessionID, cacheKey, cachedGeneration{Text: summaryMessage.Content().Text, OutputTokens: usage.OutputTokens})
+	return nil
+}
+
+// finishSummary saves the summary message of the summarized msgs and makes
+// it the start of the history of the session.
+func (a *sessionAgent) finishSummary(ctx context.Context, msgs []message.Message, currentSession session.Session, summaryMessage message.Message, outputTokens int64) error {
+	// Keep the files, commands and open todos of the summarized messages
+	// machine-readable next to the prose summary
+	if appendix := buildSummaryAppendix(msgs, currentSession.Todos); !appendix.IsEmpty() {
+		summaryMessage.SetSummaryAppendix(appendix)
+	}
+
+	// Publish finish delta before updating to DB
+	a.messages.PublishDelta(message.NewFinishDelta(summaryMessage.ID, currentSession.ID, string(message.FinishReasonEndTurn)))
+	summaryMessage.AddFinish(message.FinishReasonEndTurn, "", "")
+	if err := a.messages.Update(ctx, summaryMessage); err != nil {
+		return err
+	}
+
 	// Fetch fresh session to preserve todos
-	freshSession, fetchErr := a.sessions.Get(genCtx, currentSession.ID)
+	freshSession, fetchErr := a.sessions.Get(ctx, currentSession.ID)
 	if fetchErr != nil {
 		return fetchErr
 	}
 	freshSession.SummaryMessageID = summaryMessage.ID
-	freshSession.CompletionTokens = usage.OutputTokens
+	freshSession.CompletionTokens = outputTokens
 	freshSession.PromptTokens = 0
 	freshSession.Cost = currentSession.Cost
-	_, err = a.sessions.Save(genCtx, freshSession)
+	_, err := a.sessions.Save(ctx, freshSession)
 	return err
 }
 
@@ -885,46 +1331,38 @@ func (a *sessionAgent) getCacheControlOptions() fantasy.ProviderOptions {
 }
 
 func (a *sessionAgent) createUserMessage(ctx context.Context, call SessionAgentCall) (message.Message, error) {
-	fmt.Println("\n=== Agent: 创建用户消息 ===")
-	fmt.Printf("接收到的附件数量: %d\n", len(call.Attachments))
-
 	var attachmentParts []message.ContentPart
-	for i, attachment := range call.Attachments {
-		fmt.Printf("[附件 %d/%d]\n", i+1, len(call.Attachments))
-		fmt.Printf("  - FilePath: %s\n", attachment.FilePath)
-		fmt.Printf("  - FileName: %s\n", attachment.FileName)
-		fmt.Printf("  - MimeType: %s\n", attachment.MimeType)
-		fmt.Printf("  - Content Size: %d bytes\n", len(attachment.Content))
+	for _, attachment := range call.Attachments {
+		slog.DebugContext(ctx, "Adding attachment to user message", "path", attachment.FilePath, "filename", attachment.FileName, "mime_type", attachment.MimeType, "size", len(attachment.Content))
 		attachmentParts = append(attachmentParts, message.BinaryContent{Path: attachment.FilePath, MIMEType: attachment.MimeType, Data: attachment.Content})
 	}
 
 	parts := []message.ContentPart{message.TextContent{Text: call.Prompt}}
 	parts = append(parts, attachmentParts...)
-	fmt.Printf("总共创建 %d 个内容部分 (1 文本 + %d 附件)\n", len(parts), len(attachmentParts))
 
 	msg, err := a.messages.Create(ctx, call.SessionID, message.CreateMessageParams{
 		Role:  message.User,
 		Parts: parts,
 	})
 	if err != nil {
-		fmt.Printf("❌ 创建消息失败: %v\n", err)
 		return message.Message{}, fmt.Errorf("failed to create user message: %w", err)
 	}
-	fmt.Printf("✅ 用户消息创建成功，消息ID: %s\n", msg.ID)
-	fmt.Println("=== Agent: 用户消息创建完成 ===\n")
 	return msg, nil
 }
 
-func (a *sessionAgent) preparePrompt(msgs []message.Message, attachments ...message.Attachment) ([]fantasy.Message, []fantasy.FilePart) {
-	fmt.Println("\n=== Agent: 准备 Prompt ===")
+// checkpoint records the token counters of sess at a user message, to restore
+// them when the conversation is regenerated from it.
+func (a *sessionAgent) checkpoint(ctx context.Context, sess session.Session, messageID string) {
+	if err := a.sessions.Checkpoint(ctx, sess, messageID); err != nil {
+		slog.Warn("Failed to record message checkpoint", "session_id", sess.ID, "message_id", messageID, "error", err)
+	}
+}
 
+func (a *sessionAgent) preparePrompt(msgs []message.Message, attachments ...message.Attachment) ([]fantasy.Message, []fantasy.FilePart) {
 	// Hydrate binary contents in historical messages (fetch image data from URLs)
-	fmt.Println("=== Agent: 水合历史消息中的图片数据 ===")
 	if err := message.HydrateMessages(msgs, createImageFetcher()); err != nil {
-		fmt.Printf("⚠️ 警告: 水合图片数据失败: %v\n", err)
 		slog.Warn("Failed to hydrate binary contents", "error", err)
 	}
-	fmt.Println("=== Agent: 图片数据水合完成 ===")
 
 	var history []fantasy.Message
 	for _, m := range msgs {
@@ -936,25 +1374,24 @@ func (a *sessionAgent) preparePrompt(msgs []message.Message, attachments ...mess
 		if m.Role == message.Assistant && len(m.ToolCalls()) == 0 && m.Content().Text == "" && m.ReasoningContent().String() == "" {
 			continue
 		}
-		history = append(history, m.ToAIMessage()...)
+		aiMsgs := m.ToAIMessage()
+		if appendix := m.SummaryAppendix(); appendix != nil && len(aiMsgs) > 0 {
+			// The references of the compacted history are re-injected verbatim
+			last := &aiMsgs[len(aiMsgs)-1]
+			last.Content = append(last.Content, fantasy.TextPart{Text: appendix.String()})
+		}
+		history = append(history, aiMsgs...)
 	}
-	fmt.Printf("历史消息数量: %d\n", len(history))
 
-	fmt.Printf("当前请求的附件数量: %d\n", len(attachments))
 	var files []fantasy.FilePart
-	for i, attachment := range attachments {
-		fmt.Printf("[附件 %d/%d] 转换为 FilePart\n", i+1, len(attachments))
-		fmt.Printf("  - Filename: %s\n", attachment.FileName)
-		fmt.Printf("  - MediaType: %s\n", attachment.MimeType)
-		fmt.Printf("  - Data Size: %d bytes\n", len(attachment.Content))
+	for _, attachment := range attachments {
 		files = append(files, fantasy.FilePart{
 			Filename:  attachment.FileName,
 			Data:      attachment.Content,
 			MediaType: attachment.MimeType,
 		})
 	}
-	fmt.Printf("✅ Prompt 准备完成：%d 条历史消息 + %d 个文件附件\n", len(history), len(files))
-	fmt.Println("=== Agent: Prompt 准备完成 ===\n")
+	slog.Debug("Prepared prompt", "history", len(history), "files", len(files))
 
 	return history, files
 }
@@ -966,12 +1403,11 @@ func createImageFetcher() message.ImageFetcher {
 		// Try MinIO client first if available
 		minioClient := storage.GetMinIOClient()
 		if minioClient != nil && minioClient.IsMinIOURL(url) {
-			fmt.Printf("[ImageFetcher] Fetching from MinIO: %s\n", url)
 			return minioClient.GetFile(context.Background(), url)
 		}
 
 		// Fetch from external URL
-		fmt.Printf("[ImageFetcher] Fetching from external URL: %s\n", url)
+		slog.Debug("Fetching image from external URL", "url", url)
 		return fetchImageFromURL(url)
 	}
 }
@@ -1024,19 +1460,36 @@ func (a *sessionAgent) getSessionMessages(ctx context.Context, session session.S
 }
 
 func (a *sessionAgent) generateTitle(ctx context.Context, session *session.Session, prompt string) {
-	fmt.Printf("[TITLE] 🏷️ 开始生成标题 | sessionID=%s\n", session.ID)
-	defer fmt.Printf("[TITLE] 🏷️ 标题生成完成 | sessionID=%s\n", session.ID)
+	slog.DebugContext(ctx, "Generating session title")
 
 	if prompt == "" {
 		return
 	}
 
+	titleModel := a.titleLLM()
 	var maxOutput int64 = 40
-	if a.smallModel.CatwalkCfg.CanReason {
-		maxOutput = a.smallModel.CatwalkCfg.DefaultMaxTokens
+	if titleModel.CatwalkCfg.CanReason {
+		maxOutput = titleModel.CatwalkCfg.DefaultMaxTokens
 	}
 
-	agent := fantasy.NewAgent(a.smallModel.Model,
+	// The same prompt gets the same title when the turn is replayed
+	cacheKey, _ := generationCacheKey("title", titleModel, a.systemPromptPrefix, prompt)
+	if cached, ok := a.cachedGeneration(ctx, session.ID, cacheKey); ok {
+		slog.Debug("Session title served from cache", "session_id", session.ID)
+		session.Title = cached.Text
+		freshSession, fetchErr := a.sessions.Get(ctx, session.ID)
+		if fetchErr != nil {
+			slog.Error("failed to get fresh session for title save", "error", fetchErr)
+			return
+		}
+		freshSession.Title = session.Title
+		if _, saveErr := a.sessions.Save(ctx, freshSession); saveErr != nil {
+			slog.Error("failed to save session title", "error", saveErr)
+		}
+		return
+	}
+
+	agent := fantasy.NewAgent(titleModel.Model,
 		fantasy.WithSystemPrompt(string(titlePrompt)+"\n /no_think"),
 		fantasy.WithMaxOutputTokens(maxOutput),
 	)
@@ -1072,6 +1525,7 @@ func (a *sessionAgent) generateTitle(ctx context.Context, session *session.Sessi
 	}
 
 	session.Title = title
+	a.cacheGeneration(ctx, session.ID, cacheKey, cachedGeneration{Text: title})
 
 	var openrouterCost *float64
 	for _, step := range resp.Steps {
@@ -1085,7 +1539,7 @@ func (a *sessionAgent) generateTitle(ctx context.Context, session *session.Sessi
 		}
 	}
 
-	a.updateSessionUsage(a.smallModel, session, resp.TotalUsage, openrouterCost)
+	a.updateSessionUsage(ctx, titleModel, "", session, resp.TotalUsage, openrouterCost)
 	// Fetch fresh session to preserve todos
 	freshSession, fetchErr := a.sessions.Get(ctx, session.ID)
 	if fetchErr != nil {
@@ -1116,7 +1570,10 @@ func (a *sessionAgent) openrouterCost(metadata fantasy.ProviderMetadata) *float6
 	return &opts.Usage.Cost
 }
 
-func (a *sessionAgent) updateSessionUsage(model Model, session *session.Session, usage fantasy.Usage, overrideCost *float64) {
+// updateSessionUsage adds the usage of a model request to the session and
+// records it for the analytics. messageID is the message the request wrote,
+// empty for titles. It returns the cost of the request.
+func (a *sessionAgent) updateSessionUsage(ctx context.Context, model Model, messageID string, session *session.Session, usage fantasy.Usage, overrideCost *float64) float64 {
 	modelConfig := model.CatwalkCfg
 	cost := modelConfig.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
 		modelConfig.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
@@ -1130,36 +1587,68 @@ func (a *sessionAgent) updateSessionUsage(model Model, session *session.Session,
 	a.eventTokensUsed(session.ID, model, usage, cost)
 
 	if overrideCost != nil {
-		session.Cost += *overrideCost
-	} else {
-		session.Cost += cost
+		cost = *overrideCost
 	}
+	session.Cost += cost
+	a.recordModelUsage(ctx, session.ID, messageID, model, usage, cost)
 
 	session.CompletionTokens = usage.OutputTokens + usage.CacheReadTokens
 	session.PromptTokens = usage.InputTokens + usage.CacheCreationTokens
+	return cost
 }
 
-func (a *sessionAgent) Cancel(sessionID string) {
+func (a *sessionAgent) Cancel(sessionID string, reason message.CancelReason) {
+	cause := &CancelError{Reason: reason}
 	// Cancel regular requests.
 	if cancel, ok := a.activeRequests.Take(sessionID); ok && cancel != nil {
-		slog.Info("Request cancellation initiated", "session_id", sessionID)
-		cancel()
+		slog.Info("Request cancellation initiated", "session_id", sessionID, "reason", reason)
+		cancel(cause)
 	}
 
 	// Also check for summarize requests.
 	if cancel, ok := a.activeRequests.Take(sessionID + "-summarize"); ok && cancel != nil {
-		slog.Info("Summarize cancellation initiated", "session_id", sessionID)
-		cancel()
+		slog.Info("Summarize cancellation initiated", "session_id", sessionID, "reason", reason)
+		cancel(cause)
 	}
 
 	if a.QueuedPrompts(sessionID) > 0 {
 		slog.Info("Clearing queued prompts", "session_id", sessionID)
-		a.messageQueue.Del(sessionID)
+		a.takeQueue(sessionID)
+	}
+
+	a.cancelToolCalls(sessionID)
+}
+
+// interruptTimeout bounds how long a prompt interrupting the running turn of
+// its session waits for it to stop.
+const interruptTimeout = 30 * time.Second
+
+// interrupt cancels the running turn of a session, dropping its queue, and
+// waits for it to stop.
+func (a *sessionAgent) interrupt(ctx context.Context, sessionID string) error {
+	done, _ := a.runs.Get(sessionID)
+	slog.Info("Interrupting the running turn for a new prompt", "session_id", sessionID)
+	a.Cancel(sessionID, message.CancelReasonReplaced)
+	if done == nil {
+		return nil
 	}
+	timer := time.NewTimer(interruptTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return ErrSessionBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
+// cancelToolCalls marks the pending tool calls of a session as cancelled.
+func (a *sessionAgent) cancelToolCalls(sessionID string) {
+	ctx := context.Background()
 	// Cancel all pending tool calls for this session
 	if a.toolCalls != nil {
-		ctx := context.Background()
 		if err := a.toolCalls.CancelSession(ctx, sessionID); err != nil {
 			slog.Warn("Failed to cancel session tool calls", "session_id", sessionID, "error", err)
 		}
@@ -1167,7 +1656,6 @@ func (a *sessionAgent) Cancel(sessionID string) {
 
 	// Clear Redis tool call states
 	if a.redisCmd != nil {
-		ctx := context.Background()
 		if err := a.redisCmd.ClearSessionToolCalls(ctx, sessionID); err != nil {
 			slog.Warn("Failed to clear Redis tool call states", "session_id", sessionID, "error", err)
 		}
@@ -1177,16 +1665,16 @@ func (a *sessionAgent) Cancel(sessionID string) {
 func (a *sessionAgent) ClearQueue(sessionID string) {
 	if a.QueuedPrompts(sessionID) > 0 {
 		slog.Info("Clearing queued prompts", "session_id", sessionID)
-		a.messageQueue.Del(sessionID)
+		a.takeQueue(sessionID)
 	}
 }
 
-func (a *sessionAgent) CancelAll() {
+func (a *sessionAgent) CancelAll(reason message.CancelReason) {
 	if !a.IsBusy() {
 		return
 	}
 	for key := range a.activeRequests.Seq2() {
-		a.Cancel(key) // key is sessionID
+		a.Cancel(key, reason) // key is sessionID
 	}
 
 	timeout := time.After(5 * time.Second)
@@ -1224,11 +1712,39 @@ func (a *sessionAgent) QueuedPrompts(sessionID string) int {
 	return len(l)
 }
 
+// publishDelta publishes a streaming delta of msg, numbered with the index of
+// the part it extends.
+func (a *sessionAgent) publishDelta(msg *message.Message, delta message.StreamDelta) {
+	delta.PartIndex = msg.DeltaPartIndex(delta)
+	a.messages.PublishDelta(delta)
+}
+
 func (a *sessionAgent) SetModels(large Model, small Model) {
 	a.largeModel = large
 	a.smallModel = small
 }
 
+func (a *sessionAgent) SetTaskModels(title Model, summary Model) {
+	a.titleModel = title
+	a.summaryModel = summary
+}
+
+// titleLLM returns the model used to generate session titles.
+func (a *sessionAgent) titleLLM() Model {
+	if a.titleModel.Model != nil {
+		return a.titleModel
+	}
+	return a.smallModel
+}
+
+// summaryLLM returns the model used to summarize sessions.
+func (a *sessionAgent) summaryLLM() Model {
+	if a.summaryModel.Model != nil {
+		return a.summaryModel
+	}
+	return a.smallModel
+}
+
 func (a *sessionAgent) SetTools(tools []fantasy.AgentTool) {
 	a.tools = tools
 }
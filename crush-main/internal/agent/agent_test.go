@@ -53,7 +53,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("simple test", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -72,7 +72,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("read a file", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 				res, err := agent.Run(t.Context(), SessionAgentCall{
 					Prompt:          "Read the go mod",
@@ -112,7 +112,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("update a file", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -164,7 +164,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("bash tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -208,7 +208,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("download tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -251,7 +251,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("fetch tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -290,7 +290,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("glob tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -330,7 +330,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("grep tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -370,7 +370,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("ls tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -411,7 +411,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("multiedit tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -455,7 +455,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("sourcegraph tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -494,7 +494,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("write tool", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
@@ -539,7 +539,7 @@ func TestCoderAgent(t *testing.T) {
 			t.Run("parallel tool calls", func(t *testing.T) {
 				agent, env := setupAgent(t, pair)
 
-				session, err := env.sessions.Create(t.Context(), "New Session")
+				session, err := env.sessions.Create(t.Context(), "", "New Session")
 				require.NoError(t, err)
 
 				res, err := agent.Run(t.Context(), SessionAgentCall{
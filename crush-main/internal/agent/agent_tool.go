@@ -5,8 +5,10 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"strings"
 
 	"charm.land/fantasy"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/rolling1314/rolling-crush/internal/agent/prompt"
 	"github.com/rolling1314/rolling-crush/internal/agent/tools"
@@ -17,13 +19,41 @@ import (
 var agentToolDescription []byte
 
 type AgentParams struct {
-	Prompt string `json:"prompt" description:"The task for the agent to perform"`
+	Prompt string   `json:"prompt,omitempty" description:"The task for the agent to perform"`
+	Tasks  []string `json:"tasks,omitempty" description:"Independent tasks run in parallel, each by its own agent. Use instead of prompt to dispatch several tasks at once"`
+}
+
+// AgentToolMetadata lists the child sessions of an agent tool call, so that
+// clients can open the session of each task.
+type AgentToolMetadata struct {
+	Tasks []AgentTaskMetadata `json:"tasks"`
+}
+
+// AgentTaskMetadata is a task dispatched by the agent tool.
+type AgentTaskMetadata struct {
+	SessionID string  `json:"session_id"`
+	Prompt    string  `json:"prompt"`
+	Cost      float64 `json:"cost"`
+	Error     string  `json:"error,omitempty"`
 }
 
 const (
 	AgentToolName = "agent"
+
+	// maxAgentTasks bounds the tasks of a single agent tool call.
+	maxAgentTasks = 10
+	// maxParallelAgentTasks bounds the tasks of a call running at once.
+	maxParallelAgentTasks = 4
 )
 
+// agentTaskResult is the outcome of a task run in its child session.
+type agentTaskResult struct {
+	sessionID string
+	text      string
+	cost      float64
+	err       error
+}
+
 func (c *coordinator) agentTool(ctx context.Context) (fantasy.AgentTool, error) {
 	agentCfg, ok := c.cfg.Agents[config.AgentTask]
 	if !ok {
@@ -42,8 +72,20 @@ func (c *coordinator) agentTool(ctx context.Context) (fantasy.AgentTool, error)
 		AgentToolName,
 		string(agentToolDescription),
 		func(ctx context.Context, params AgentParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
-			if params.Prompt == "" {
-				return fantasy.NewTextErrorResponse("prompt is required"), nil
+			tasks := params.Tasks
+			if params.Prompt != "" {
+				tasks = append([]string{params.Prompt}, tasks...)
+			}
+			if len(tasks) == 0 {
+				return fantasy.NewTextErrorResponse("prompt or tasks is required"), nil
+			}
+			if len(tasks) > maxAgentTasks {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("at most %d tasks can be dispatched at once", maxAgentTasks)), nil
+			}
+			for _, task := range tasks {
+				if strings.TrimSpace(task) == "" {
+					return fantasy.NewTextErrorResponse("tasks must not be empty"), nil
+				}
 			}
 
 			sessionID := tools.GetSessionFromContext(ctx)
@@ -56,50 +98,123 @@ func (c *coordinator) agentTool(ctx context.Context) (fantasy.AgentTool, error)
 				return fantasy.ToolResponse{}, errors.New("agent message id missing from context")
 			}
 
-			agentToolSessionID := c.sessions.CreateAgentToolSessionID(agentMessageID, call.ID)
-			session, err := c.sessions.CreateTaskSession(ctx, agentToolSessionID, sessionID, "New Agent Session")
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error creating session: %s", err)
-			}
-			model := agent.Model()
-			maxTokens := model.CatwalkCfg.DefaultMaxTokens
-			if model.ModelCfg.MaxTokens != 0 {
-				maxTokens = model.ModelCfg.MaxTokens
-			}
-
-			providerCfg, ok := c.cfg.Providers.Get(model.ModelCfg.Provider)
-			if !ok {
-				return fantasy.ToolResponse{}, errors.New("model provider not configured")
-			}
-			result, err := agent.Run(ctx, SessionAgentCall{
-				SessionID:        session.ID,
-				Prompt:           params.Prompt,
-				MaxOutputTokens:  maxTokens,
-				ProviderOptions:  getProviderOptions(model, providerCfg),
-				Temperature:      model.ModelCfg.Temperature,
-				TopP:             model.ModelCfg.TopP,
-				TopK:             model.ModelCfg.TopK,
-				FrequencyPenalty: model.ModelCfg.FrequencyPenalty,
-				PresencePenalty:  model.ModelCfg.PresencePenalty,
+			results := runAgentTasks(ctx, len(tasks), maxParallelAgentTasks, func(ctx context.Context, i int) agentTaskResult {
+				// The first task keeps the session ID of single task calls
+				toolCallID := call.ID
+				if i > 0 {
+					toolCallID = fmt.Sprintf("%s:%d", call.ID, i)
+				}
+				return c.runAgentTask(ctx, agent, sessionID, c.sessions.CreateAgentToolSessionID(agentMessageID, toolCallID), tasks[i])
 			})
-			if err != nil {
-				return fantasy.NewTextErrorResponse("error generating response"), nil
-			}
-			updatedSession, err := c.sessions.Get(ctx, session.ID)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error getting session: %s", err)
+
+			// The cost of the child sessions is attributed to the parent once
+			// all of them are done, the tasks do not race on its row
+			var cost float64
+			metadata := AgentToolMetadata{Tasks: make([]AgentTaskMetadata, len(results))}
+			for i, result := range results {
+				cost += result.cost
+				metadata.Tasks[i] = AgentTaskMetadata{SessionID: result.sessionID, Prompt: tasks[i], Cost: result.cost}
+				if result.err != nil {
+					metadata.Tasks[i].Error = result.err.Error()
+				}
 			}
-			parentSession, err := c.sessions.Get(ctx, sessionID)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error getting parent session: %s", err)
+			if cost > 0 {
+				parentSession, err := c.sessions.Get(ctx, sessionID)
+				if err != nil {
+					return fantasy.ToolResponse{}, fmt.Errorf("error getting parent session: %s", err)
+				}
+				parentSession.Cost += cost
+				if _, err := c.sessions.Save(ctx, parentSession); err != nil {
+					return fantasy.ToolResponse{}, fmt.Errorf("error saving parent session: %s", err)
+				}
 			}
 
-			parentSession.Cost += updatedSession.Cost
-
-			_, err = c.sessions.Save(ctx, parentSession)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error saving parent session: %s", err)
+			if len(results) == 1 {
+				if results[0].err != nil {
+					return fantasy.WithResponseMetadata(fantasy.NewTextErrorResponse("error generating response"), metadata), nil
+				}
+				return fantasy.WithResponseMetadata(fantasy.NewTextResponse(results[0].text), metadata), nil
 			}
-			return fantasy.NewTextResponse(result.Response.Content.Text()), nil
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(formatAgentTaskResults(tasks, results)), metadata), nil
 		}), nil
 }
+
+// runAgentTask runs a task with the task agent in a child session of the
+// parent session.
+func (c *coordinator) runAgentTask(ctx context.Context, agent SessionAgent, parentSessionID, childSessionID, task string) agentTaskResult {
+	result := agentTaskResult{sessionID: childSessionID}
+	session, err := c.sessions.CreateTaskSession(ctx, childSessionID, parentSessionID, "New Agent Session")
+	if err != nil {
+		result.err = fmt.Errorf("error creating session: %s", err)
+		return result
+	}
+	model := agent.Model()
+	maxTokens := model.CatwalkCfg.DefaultMaxTokens
+	if model.ModelCfg.MaxTokens != 0 {
+		maxTokens = model.ModelCfg.MaxTokens
+	}
+
+	providerCfg, ok := c.cfg.Providers.Get(model.ModelCfg.Provider)
+	if !ok {
+		result.err = errors.New("model provider not configured")
+		return result
+	}
+	response, runErr := agent.Run(ctx, SessionAgentCall{
+		SessionID:        session.ID,
+		Prompt:           task,
+		MaxOutputTokens:  maxTokens,
+		ProviderOptions:  getProviderOptions(model, providerCfg),
+		Temperature:      model.ModelCfg.Temperature,
+		TopP:             model.ModelCfg.TopP,
+		TopK:             model.ModelCfg.TopK,
+		FrequencyPenalty: model.ModelCfg.FrequencyPenalty,
+		PresencePenalty:  model.ModelCfg.PresencePenalty,
+	})
+	// A failed task may still have spent tokens
+	if updatedSession, err := c.sessions.Get(ctx, session.ID); err == nil {
+		result.cost = updatedSession.Cost
+	}
+	if runErr != nil {
+		result.err = runErr
+		return result
+	}
+	if response != nil {
+		result.text = response.Response.Content.Text()
+	}
+	return result
+}
+
+// runAgentTasks runs n tasks with at most limit of them at once and returns
+// their results in the order of the tasks.
+func runAgentTasks(ctx context.Context, n, limit int, run func(ctx context.Context, i int) agentTaskResult) []agentTaskResult {
+	results := make([]agentTaskResult, n)
+	var g errgroup.Group
+	g.SetLimit(limit)
+	for i := range n {
+		g.Go(func() error {
+			results[i] = run(ctx, i)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return results
+}
+
+// formatAgentTaskResults aggregates the answers of the tasks of a call, a
+// failed task reports its error in place of an answer.
+func formatAgentTaskResults(tasks []string, results []agentTaskResult) string {
+	var sb strings.Builder
+	for i, result := range results {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "<task index=\"%d\" session_id=\"%s\">\n<prompt>%s</prompt>\n", i+1, result.sessionID, tasks[i])
+		if result.err != nil {
+			fmt.Fprintf(&sb, "<error>%s</error>\n", result.err)
+		} else {
+			fmt.Fprintf(&sb, "<result>\n%s\n</result>\n", result.text)
+		}
+		sb.WriteString("</task>")
+	}
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAgentTasks(t *testing.T) {
+	t.Parallel()
+
+	var running, peak atomic.Int32
+	results := runAgentTasks(t.Context(), 6, 2, func(_ context.Context, i int) agentTaskResult {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return agentTaskResult{sessionID: string(rune('a' + i))}
+	})
+
+	require.LessOrEqual(t, peak.Load(), int32(2))
+	require.Len(t, results, 6)
+	for i, result := range results {
+		require.Equal(t, string(rune('a'+i)), result.sessionID, "results keep the order of the tasks")
+	}
+}
+
+func TestFormatAgentTaskResults(t *testing.T) {
+	t.Parallel()
+
+	got := formatAgentTaskResults([]string{"find A", "find B"}, []agentTaskResult{
+		{sessionID: "m$$c", text: "A is in a.go"},
+		{sessionID: "m$$c:1", err: errors.New("boom")},
+	})
+	require.Equal(t, `<task index="1" session_id="m$$c">
+<prompt>find A</prompt>
+<result>
+A is in a.go
+</result>
+</task>
+
+<task index="2" session_id="m$$c:1">
+<prompt>find B</prompt>
+<error>boom</error>
+</task>`, got)
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/audit"
+	"github.com/rolling1314/rolling-crush/domain/message"
+)
+
+// auditToolCall adds a finished tool call to the audit log. The input is only
+// kept as a hash, and a failed write does not stop the turn.
+func (a *sessionAgent) auditToolCall(ctx context.Context, assistant *message.Message, result fantasy.ToolResultContent, content string, isError bool, duration time.Duration) {
+	var decision string
+	if a.permissions != nil {
+		if d, ok := a.permissions.TakeDecision(result.ToolCallID); ok {
+			decision = string(d)
+		}
+	}
+	if a.audit == nil {
+		return
+	}
+
+	var input string
+	for _, tc := range assistant.ToolCalls() {
+		if tc.ID == result.ToolCallID {
+			input = tc.Input
+			break
+		}
+	}
+	entry := audit.Entry{
+		ToolCallID: result.ToolCallID,
+		SessionID:  assistant.SessionID,
+		MessageID:  assistant.ID,
+		ToolName:   result.ToolName,
+		ParamsHash: audit.HashParams(input),
+		Permission: decision,
+		DurationMs: duration.Milliseconds(),
+		ResultSize: int64(len(content)),
+		IsError:    isError,
+	}
+	if isError {
+		entry.Error = content
+	}
+	if err := a.audit.Record(context.WithoutCancel(ctx), entry); err != nil {
+		slog.Warn("Failed to record tool call audit entry", "session_id", assistant.SessionID, "tool_call_id", result.ToolCallID, "error", err)
+	}
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/internal/diagnostics"
+)
+
+// autoFixState follows a prompt through the follow-up prompts fixing the
+// errors its edits introduced.
+type autoFixState struct {
+	// since is when the prompt started in Unix milliseconds, the files edited
+	// since then are checked.
+	since int64
+	// baseline is the diagnostics before the prompt, their errors are not
+	// the agent's doing.
+	baseline  diagnostics.Summary
+	iteration int
+}
+
+// startAutoFix records the diagnostics before the first turn of a prompt when
+// auto-fix is enabled for the call. The follow-up prompts keep the state of
+// the prompt they fix.
+func (a *sessionAgent) startAutoFix(ctx context.Context, call *SessionAgentCall) {
+	if call.AutoFixIterations <= 0 || call.autoFix != nil || a.diagnostics == nil {
+		return
+	}
+	state := &autoFixState{since: time.Now().UnixMilli()}
+	baseline, err := diagnostics.Summarize(ctx, a.diagnostics, call.SessionID, nil)
+	if err != nil {
+		// Every error of the edited files counts as new then
+		slog.Warn("Failed to get diagnostics before the turn", "session_id", call.SessionID, "error", err)
+	}
+	state.baseline = baseline
+	call.autoFix = state
+}
+
+// queueAutoFix queues a follow-up prompt with the new errors of the files
+// edited since the prompt started, until the iterations of the call are used
+// up. It reports whether a prompt was queued.
+func (a *sessionAgent) queueAutoFix(ctx context.Context, call SessionAgentCall) bool {
+	state := call.autoFix
+	if state == nil || a.dbQuerier == nil {
+		return false
+	}
+	files, err := a.dbQuerier.ListLatestSessionFiles(ctx, call.SessionID)
+	if err != nil {
+		slog.Warn("Failed to list the edited files", "session_id", call.SessionID, "error", err)
+		return false
+	}
+	var edited []string
+	for _, f := range files {
+		if f.CreatedAt >= state.since {
+			edited = append(edited, f.Path)
+		}
+	}
+	if len(edited) == 0 {
+		return false
+	}
+
+	after, err := diagnostics.Summarize(ctx, a.diagnostics, call.SessionID, edited)
+	if err != nil {
+		slog.Warn("Failed to get diagnostics after the turn", "session_id", call.SessionID, "error", err)
+		return false
+	}
+	errs := diagnostics.NewErrors(state.baseline, after)
+	if len(errs) == 0 {
+		return false
+	}
+	if state.iteration >= call.AutoFixIterations {
+		slog.Info("Auto-fix gave up with errors left", "session_id", call.SessionID, "errors", len(errs), "iterations", state.iteration)
+		return false
+	}
+
+	next := call
+	next.Prompt = diagnostics.FixPrompt(errs)
+	next.Attachments = nil
+	next.queueID = ""
+	next.autoFix = &autoFixState{since: state.since, baseline: state.baseline, iteration: state.iteration + 1}
+	slog.Info("Queued auto-fix prompt", "session_id", call.SessionID, "errors", len(errs), "iteration", next.autoFix.iteration)
+	a.enqueue(next)
+	return true
+}
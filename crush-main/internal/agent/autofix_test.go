@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/diagnostics"
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// editedFiles lists fixed session files.
+type editedFiles struct {
+	postgres.Querier
+	files []postgres.File
+}
+
+func (e editedFiles) ListLatestSessionFiles(context.Context, string) ([]postgres.File, error) {
+	return e.files, nil
+}
+
+type fixedDiagnostics map[string][]sandbox.Diagnostic
+
+func (f fixedDiagnostics) GetLSPDiagnostics(context.Context, sandbox.LSPDiagnosticsRequest) (*sandbox.LSPDiagnosticsResponse, error) {
+	var resp sandbox.LSPDiagnosticsResponse
+	for path, diags := range f {
+		resp.ProjectDiagnostics = append(resp.ProjectDiagnostics, sandbox.FileDiagnostics{FilePath: path, Diagnostics: diags})
+	}
+	return &resp, nil
+}
+
+func TestQueueAutoFix(t *testing.T) {
+	oldErr := sandbox.Diagnostic{Severity: sandbox.SeverityError, Message: "old"}
+	newErr := sandbox.Diagnostic{Severity: sandbox.SeverityError, Message: "undefined: x"}
+	source := fixedDiagnostics{"/work/a.go": {oldErr}, "/work/b.go": {oldErr}}
+	a := &sessionAgent{
+		dbQuerier: editedFiles{files: []postgres.File{
+			{Path: "/work/a.go", CreatedAt: 100},
+			{Path: "/work/b.go", CreatedAt: 50},
+		}},
+		diagnostics:  source,
+		messageQueue: csync.NewMap[string, []SessionAgentCall](),
+	}
+
+	call := SessionAgentCall{SessionID: "s1", Prompt: "refactor", AutoFixIterations: 1}
+	a.startAutoFix(t.Context(), &call)
+	require.NotNil(t, call.autoFix)
+	call.autoFix.since = 100
+
+	// Errors already there and the ones of files edited before are left alone
+	source["/work/a.go"] = []sandbox.Diagnostic{oldErr}
+	source["/work/b.go"] = []sandbox.Diagnostic{oldErr, newErr}
+	assert.False(t, a.queueAutoFix(t.Context(), call))
+
+	source["/work/a.go"] = []sandbox.Diagnostic{oldErr, newErr}
+	require.True(t, a.queueAutoFix(t.Context(), call))
+	next, ok := a.dequeue("s1")
+	require.True(t, ok)
+	assert.Equal(t, diagnostics.FixPrompt([]diagnostics.Diagnostic{{Path: "/work/a.go", Line: 1, Column: 1, Severity: diagnostics.SeverityError, Message: "undefined: x"}}), next.Prompt)
+	assert.Equal(t, 1, next.autoFix.iteration)
+	assert.Equal(t, call.autoFix.baseline, next.autoFix.baseline, "the follow-up keeps the errors before the prompt")
+
+	// The iterations are used up
+	assert.False(t, a.queueAutoFix(t.Context(), next))
+
+	// Disabled calls are not followed
+	disabled := SessionAgentCall{SessionID: "s1", Prompt: "refactor"}
+	a.startAutoFix(t.Context(), &disabled)
+	assert.Nil(t, disabled.autoFix)
+	assert.False(t, a.queueAutoFix(t.Context(), disabled))
+}
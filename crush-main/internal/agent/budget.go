@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/domain/budget"
+	"github.com/rolling1314/rolling-crush/domain/message"
+)
+
+// enforceBudget returns the *budget.ExceededError of a session over budget.
+// Budgets that cannot be checked do not stop the agent.
+func (a *sessionAgent) enforceBudget(ctx context.Context, sessionID string) error {
+	if a.budgets == nil {
+		return nil
+	}
+	err := a.budgets.Enforce(ctx, sessionID)
+	if err != nil && !errors.Is(err, budget.ErrExceeded) {
+		slog.Warn("Failed to check budgets", "session_id", sessionID, "error", err)
+		return nil
+	}
+	return err
+}
+
+// refuseOverBudget answers the prompt of a session over budget with an
+// assistant message finished as budget_exceeded, and returns err.
+func (a *sessionAgent) refuseOverBudget(ctx context.Context, sessionID string, err error) error {
+	slog.Warn("Budget exceeded, refusing the turn", "session_id", sessionID, "error", err)
+	// The queued prompts would be refused as well
+	a.ClearQueue(sessionID)
+
+	assistant, createErr := a.messages.Create(ctx, sessionID, message.CreateMessageParams{
+		Role:     message.Assistant,
+		Parts:    []message.ContentPart{},
+		Model:    a.largeModel.ModelCfg.Model,
+		Provider: a.largeModel.ModelCfg.Provider,
+	})
+	if createErr != nil {
+		return createErr
+	}
+	assistant.AddFinish(message.FinishReasonBudgetExceeded, "Budget exceeded", err.Error())
+	a.messages.PublishDelta(message.NewErrorDelta(sessionID, err.Error(), ClassifyError(err)))
+	a.messages.PublishDelta(message.NewFinishDelta(assistant.ID, sessionID, string(message.FinishReasonBudgetExceeded)))
+	if updateErr := a.messages.Update(ctx, assistant); updateErr != nil {
+		return updateErr
+	}
+	if flushErr := a.messages.Flush(ctx); flushErr != nil {
+		return flushErr
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+)
+
+// CancelMode selects how a running turn is cancelled.
+type CancelMode string
+
+const (
+	// CancelSoft lets the running tool finish, then stops the turn and
+	// finalizes the assistant message. This is the default.
+	CancelSoft CancelMode = "soft"
+	// CancelHard cancels the context of the turn right away, even mid-tool.
+	CancelHard CancelMode = "hard"
+)
+
+// ParseCancelMode returns the mode named by s, CancelSoft by default.
+func ParseCancelMode(s string) CancelMode {
+	if CancelMode(s) == CancelHard {
+		return CancelHard
+	}
+	return CancelSoft
+}
+
+// errSoftCancelled stops a turn after a tool finished. It wraps
+// context.Canceled so the turn is finalized as cancelled.
+var errSoftCancelled = fmt.Errorf("turn stopped after the current tool: %w", context.Canceled)
+
+// CancelError is the cause of a turn cancelled through Cancel, it tells
+// why. It unwraps to context.Canceled.
+type CancelError struct {
+	Reason message.CancelReason
+}
+
+func (e *CancelError) Error() string {
+	return fmt.Sprintf("turn canceled: %s", e.Reason)
+}
+
+func (e *CancelError) Unwrap() error {
+	return context.Canceled
+}
+
+// cancelReason tells why the turn run with genCtx was cancelled, and
+// whether err is a cancellation at all. Turns cancelled without a reason
+// were cancelled by the user.
+func cancelReason(genCtx context.Context, err error) (message.CancelReason, bool) {
+	var cancelErr *CancelError
+	switch {
+	case errors.As(context.Cause(genCtx), &cancelErr):
+		return cancelErr.Reason, true
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(context.Cause(genCtx), context.DeadlineExceeded):
+		return message.CancelReasonTimeout, true
+	case errors.Is(err, context.Canceled):
+		return message.CancelReasonUser, true
+	}
+	return "", false
+}
+
+// turnControl lets a running turn be stopped between tools.
+type turnControl struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	// reason is why the stop was requested.
+	reason message.CancelReason
+	// inTools is set while the tools of a step run.
+	inTools atomic.Bool
+}
+
+func newTurnControl() *turnControl {
+	return &turnControl{stop: make(chan struct{})}
+}
+
+func (t *turnControl) requestStop(reason message.CancelReason) {
+	t.stopOnce.Do(func() {
+		t.reason = reason
+		close(t.stop)
+	})
+}
+
+func (t *turnControl) stopRequested() bool {
+	select {
+	case <-t.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// CancelWithMode cancels the running turn of a session.
+func (a *sessionAgent) CancelWithMode(sessionID string, mode CancelMode, reason message.CancelReason) {
+	if mode == CancelHard {
+		a.Cancel(sessionID, reason)
+		return
+	}
+
+	// Nothing runs in the sandbox while the model streams, so only a turn
+	// running tools waits for them
+	turn, ok := a.turns.Get(sessionID)
+	if !ok || !turn.inTools.Load() {
+		a.Cancel(sessionID, reason)
+		return
+	}
+	slog.Info("Soft cancellation initiated, stopping after the current tool", "session_id", sessionID, "reason", reason)
+	turn.requestStop(reason)
+	if a.QueuedPrompts(sessionID) > 0 {
+		slog.Info("Clearing queued prompts", "session_id", sessionID)
+		a.takeQueue(sessionID)
+	}
+}
+
+// toolCanceledContent is the result of a tool call cut short for reason.
+func toolCanceledContent(reason message.CancelReason) string {
+	switch reason {
+	case message.CancelReasonTimeout:
+		return "Tool execution canceled: the request timed out"
+	case message.CancelReasonBudget:
+		return "Tool execution canceled: the budget was exceeded"
+	case message.CancelReasonShutdown:
+		return "Tool execution canceled: the server is shutting down"
+	default:
+		return "Tool execution canceled by user"
+	}
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCancelMode(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, CancelHard, ParseCancelMode("hard"))
+	require.Equal(t, CancelSoft, ParseCancelMode("soft"))
+	require.Equal(t, CancelSoft, ParseCancelMode(""))
+	require.Equal(t, CancelSoft, ParseCancelMode("unknown"))
+}
+
+func TestTurnControl(t *testing.T) {
+	t.Parallel()
+
+	turn := newTurnControl()
+	require.False(t, turn.stopRequested())
+	turn.requestStop(message.CancelReasonShutdown)
+	turn.requestStop(message.CancelReasonUser)
+	require.True(t, turn.stopRequested())
+	require.Equal(t, message.CancelReasonShutdown, turn.reason)
+
+	// A soft cancelled turn is finalized like a user cancellation
+	require.True(t, errors.Is(errSoftCancelled, context.Canceled))
+	require.True(t, isCancelledErr(errSoftCancelled))
+}
+
+func TestCancelReason(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancelCause(t.Context())
+	cancel(&CancelError{Reason: message.CancelReasonBudget})
+	reason, ok := cancelReason(ctx, ctx.Err())
+	require.True(t, ok)
+	require.Equal(t, message.CancelReasonBudget, reason)
+
+	// Cancelled without a reason
+	ctx, cancel = context.WithCancelCause(t.Context())
+	cancel(nil)
+	reason, ok = cancelReason(ctx, ctx.Err())
+	require.True(t, ok)
+	require.Equal(t, message.CancelReasonUser, reason)
+
+	deadlineCtx, stop := context.WithTimeout(t.Context(), time.Nanosecond)
+	defer stop()
+	<-deadlineCtx.Done()
+	reason, ok = cancelReason(deadlineCtx, deadlineCtx.Err())
+	require.True(t, ok)
+	require.Equal(t, message.CancelReasonTimeout, reason)
+
+	// A stalled stream is not a cancellation
+	ctx, cancel = context.WithCancelCause(t.Context())
+	cancel(ErrStreamStalled)
+	_, ok = cancelReason(ctx, ErrStreamStalled)
+	require.False(t, ok)
+}
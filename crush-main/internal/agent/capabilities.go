@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"log/slog"
+	"slices"
+
+	"charm.land/fantasy"
+	"charm.land/fantasy/providers/anthropic"
+	"charm.land/fantasy/providers/azure"
+	"charm.land/fantasy/providers/openai"
+	"charm.land/fantasy/providers/openrouter"
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// coreTools are kept first, in order, when the tools are trimmed to the most
+// a model takes.
+var coreTools = []string{
+	tools.ViewToolName,
+	tools.EditToolName,
+	tools.WriteToolName,
+	tools.BashToolName,
+	tools.GrepToolName,
+	tools.GlobToolName,
+	tools.LSToolName,
+	tools.MultiEditToolName,
+	tools.TodosToolName,
+}
+
+// withCapabilities trims the tools of a turn to the most the model takes and
+// strips their schemas when its provider validates them strictly. The kept
+// tools stay in order so that the cached prompt prefix is stable.
+func withCapabilities(agentTools []fantasy.AgentTool, capabilities *config.ModelCapabilities) []fantasy.AgentTool {
+	if capabilities == nil {
+		return agentTools
+	}
+	if maxTools := capabilities.MaxTools; maxTools > 0 && len(agentTools) > maxTools {
+		agentTools = trimTools(agentTools, maxTools)
+	}
+	if capabilities.StrictJSONSchema {
+		agentTools = tools.WithStrictSchemas(agentTools)
+	}
+	return agentTools
+}
+
+// trimTools keeps the core tools, then the others in order, up to maxTools.
+func trimTools(agentTools []fantasy.AgentTool, maxTools int) []fantasy.AgentTool {
+	rank := func(tool fantasy.AgentTool) int {
+		if i := slices.Index(coreTools, tool.Info().Name); i >= 0 {
+			return i
+		}
+		return len(coreTools)
+	}
+	order := make([]int, len(agentTools))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return rank(agentTools[a]) - rank(agentTools[b])
+	})
+	keep := order[:maxTools]
+	slices.Sort(keep)
+
+	trimmed := make([]fantasy.AgentTool, 0, maxTools)
+	for _, i := range keep {
+		trimmed = append(trimmed, agentTools[i])
+	}
+	dropped := make([]string, 0, len(agentTools)-maxTools)
+	for _, i := range order[maxTools:] {
+		dropped = append(dropped, agentTools[i].Info().Name)
+	}
+	slog.Debug("Trimmed tools to the model capabilities", "max_tools", maxTools, "dropped", dropped)
+	return trimmed
+}
+
+// withParallelToolCalls sets the provider option allowing parallel tool calls
+// from the capabilities of the model, unless the options set it already.
+// OpenAI-compatible providers take it through their extra_body.
+func withParallelToolCalls(options map[string]any, providerType catwalk.Type, capabilities *config.ModelCapabilities) {
+	if capabilities == nil || capabilities.ParallelToolCalls == nil {
+		return
+	}
+	parallel := *capabilities.ParallelToolCalls
+	switch providerType {
+	case openai.Name, azure.Name, openrouter.Name:
+		if _, ok := options["parallel_tool_calls"]; !ok {
+			options["parallel_tool_calls"] = parallel
+		}
+	case anthropic.Name:
+		if _, ok := options["disable_parallel_tool_use"]; !ok {
+			options["disable_parallel_tool_use"] = !parallel
+		}
+	}
+}
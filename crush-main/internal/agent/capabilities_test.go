@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"testing"
+
+	"charm.land/fantasy"
+	"charm.land/fantasy/providers/anthropic"
+	"charm.land/fantasy/providers/openai"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCapabilities(t *testing.T) {
+	t.Parallel()
+
+	agentTools := []fantasy.AgentTool{
+		namedTool("agent"),
+		namedTool("bash"),
+		namedTool("download"),
+		namedTool("edit"),
+		namedTool("fetch"),
+		namedTool("mcp_custom"),
+		namedTool("view"),
+	}
+	names := func(agentTools []fantasy.AgentTool) []string {
+		var names []string
+		for _, tool := range agentTools {
+			names = append(names, tool.Info().Name)
+		}
+		return names
+	}
+
+	require.Len(t, withCapabilities(agentTools, nil), 7)
+	require.Len(t, withCapabilities(agentTools, &config.ModelCapabilities{MaxTools: 10}), 7)
+
+	// The core tools are kept first, then the others in order
+	trimmed := withCapabilities(agentTools, &config.ModelCapabilities{MaxTools: 4})
+	require.Equal(t, []string{"agent", "bash", "edit", "view"}, names(trimmed))
+	trimmed = withCapabilities(agentTools, &config.ModelCapabilities{MaxTools: 2})
+	require.Equal(t, []string{"edit", "view"}, names(trimmed))
+}
+
+func TestWithParallelToolCalls(t *testing.T) {
+	t.Parallel()
+
+	disabled := &config.ModelCapabilities{ParallelToolCalls: new(bool)}
+
+	options := map[string]any{}
+	withParallelToolCalls(options, openai.Name, disabled)
+	require.Equal(t, map[string]any{"parallel_tool_calls": false}, options)
+
+	options = map[string]any{}
+	withParallelToolCalls(options, anthropic.Name, disabled)
+	require.Equal(t, map[string]any{"disable_parallel_tool_use": true}, options)
+
+	// Options set explicitly win
+	options = map[string]any{"parallel_tool_calls": true}
+	withParallelToolCalls(options, openai.Name, disabled)
+	require.Equal(t, map[string]any{"parallel_tool_calls": true}, options)
+
+	options = map[string]any{}
+	withParallelToolCalls(options, openai.Name, &config.ModelCapabilities{MaxTools: 3})
+	require.Empty(t, options)
+}
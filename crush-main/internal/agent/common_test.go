@@ -25,6 +25,7 @@ import (
 	"github.com/rolling1314/rolling-crush/domain/message"
 	"github.com/rolling1314/rolling-crush/domain/permission"
 	"github.com/rolling1314/rolling-crush/domain/session"
+	"github.com/rolling1314/rolling-crush/domain/toolcall"
 	"github.com/stretchr/testify/require"
 
 	_ "github.com/joho/godotenv/autoload"
@@ -35,6 +36,7 @@ type fakeEnv struct {
 	workingDir  string
 	sessions    session.Service
 	messages    message.Service
+	toolCalls   toolcall.Service
 	permissions permission.Service
 	history     history.Service
 	lspClients  *csync.Map[string, *lsp.Client]
@@ -109,11 +111,14 @@ func testEnv(t *testing.T) fakeEnv {
 	require.NoError(t, err)
 
 	conn, err := postgres.Connect(t.Context(), t.TempDir())
-	require.NoError(t, err)
+	if err != nil {
+		t.Skipf("postgres is not available: %v", err)
+	}
 
 	q := postgres.New(conn)
 	sessions := session.NewService(q)
 	messages := message.NewService(q)
+	toolCalls := toolcall.NewService(q)
 
 	permissions := permission.NewPermissionService(workingDir, true, []string{})
 	history := history.NewService(q, conn)
@@ -128,6 +133,7 @@ func testEnv(t *testing.T) fakeEnv {
 		workingDir,
 		sessions,
 		messages,
+		toolCalls,
 		permissions,
 		history,
 		lspClients,
@@ -149,7 +155,17 @@ func testSessionAgent(env fakeEnv, large, small fantasy.LanguageModel, systemPro
 			DefaultMaxTokens: 10000,
 		},
 	}
-	agent := NewSessionAgent(SessionAgentOptions{largeModel, smallModel, "", systemPrompt, false, true, env.sessions, env.messages, tools})
+	agent := NewSessionAgent(SessionAgentOptions{
+		LargeModel:   largeModel,
+		SmallModel:   smallModel,
+		SystemPrompt: systemPrompt,
+		IsYolo:       true,
+		Sessions:     env.sessions,
+		Messages:     env.messages,
+		ToolCalls:    env.toolCalls,
+		Tools:        tools,
+		Permissions:  env.permissions,
+	})
 	return agent
 }
 
@@ -190,11 +206,11 @@ func coderAgent(r *vcr.Recorder, env fakeEnv, large, small fantasy.LanguageModel
 	}
 
 	allTools := []fantasy.AgentTool{
-		tools.NewBashTool(env.permissions, env.workingDir, cfg.Options.Attribution, modelName),
+		tools.NewBashTool(env.permissions, env.workingDir, cfg.Options.Attribution, modelName, nil),
 		tools.NewDownloadTool(env.permissions, env.workingDir, r.GetDefaultClient()),
 		tools.NewEditTool(env.lspClients, env.permissions, env.history, env.workingDir),
 		tools.NewMultiEditTool(env.lspClients, env.permissions, env.history, env.workingDir),
-		tools.NewFetchTool(env.permissions, env.workingDir, r.GetDefaultClient()),
+		tools.NewFetchTool(env.permissions, env.workingDir, r.GetDefaultClient(), nil),
 		tools.NewGlobTool(env.workingDir),
 		tools.NewGrepTool(env.workingDir),
 		tools.NewLsTool(env.permissions, env.workingDir, cfg.Tools.Ls),
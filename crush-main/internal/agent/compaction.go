@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// Defaults of the tool result compaction, see config.ToolResultCompaction.
+const (
+	defaultCompactionThreshold  = 0.5
+	defaultCompactionKeepRecent = 6
+	defaultCompactionMinLength  = 1500
+)
+
+// Bounds of the synopsis kept in place of a compacted tool result.
+const (
+	synopsisLines     = 5
+	synopsisLineWidth = 200
+	synopsisNote      = "[Output elided to save context"
+)
+
+// toolResultCompactor elides the output of old tool results once the context
+// window fills up. It is a cheaper first pass than summarizing: the
+// conversation and the tool calls stay as they are, only the bulky outputs
+// the model already acted upon are shortened.
+type toolResultCompactor struct {
+	threshold  float64
+	keepRecent int
+	minLength  int
+}
+
+// newToolResultCompactor returns the compactor configured by cfg, nil when
+// the compaction is disabled.
+func newToolResultCompactor(cfg *config.ToolResultCompaction) *toolResultCompactor {
+	c := &toolResultCompactor{
+		threshold:  defaultCompactionThreshold,
+		keepRecent: defaultCompactionKeepRecent,
+		minLength:  defaultCompactionMinLength,
+	}
+	if cfg == nil {
+		return c
+	}
+	if cfg.Disabled {
+		return nil
+	}
+	if cfg.Threshold > 0 && cfg.Threshold <= 1 {
+		c.threshold = cfg.Threshold
+	}
+	if cfg.KeepRecent > 0 {
+		c.keepRecent = cfg.KeepRecent
+	}
+	if cfg.MinLength > 0 {
+		c.minLength = cfg.MinLength
+	}
+	return c
+}
+
+// active reports whether the tokens in use fill the context window past the
+// threshold.
+func (c *toolResultCompactor) active(contextWindow, tokens int64) bool {
+	return c != nil && contextWindow > 0 && float64(tokens) >= c.threshold*float64(contextWindow)
+}
+
+// compact returns msgs with the long text results of all but the keepRecent
+// most recent tool calls replaced by a synopsis, and the number of results
+// compacted. Messages are copied before they are changed, msgs is left as is.
+func (c *toolResultCompactor) compact(msgs []fantasy.Message) ([]fantasy.Message, int) {
+	calls := make(map[string]fantasy.ToolCallPart)
+	results := 0
+	for _, msg := range msgs {
+		for _, part := range msg.Content {
+			if call, ok := fantasy.AsMessagePart[fantasy.ToolCallPart](part); ok {
+				calls[call.ToolCallID] = call
+			}
+			if _, ok := fantasy.AsMessagePart[fantasy.ToolResultPart](part); ok {
+				results++
+			}
+		}
+	}
+
+	// Results are counted from the end, the recent ones are kept
+	compactable := results - c.keepRecent
+	if compactable <= 0 {
+		return msgs, 0
+	}
+
+	out := slices.Clone(msgs)
+	compacted, seen := 0, 0
+	for i, msg := range out {
+		var content []fantasy.MessagePart
+		for j, part := range msg.Content {
+			result, ok := fantasy.AsMessagePart[fantasy.ToolResultPart](part)
+			if !ok {
+				continue
+			}
+			seen++
+			if seen > compactable {
+				break
+			}
+			text, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentText](result.Output)
+			if !ok || len(text.Text) < c.minLength || strings.Contains(text.Text, synopsisNote) {
+				continue
+			}
+			if content == nil {
+				content = slices.Clone(msg.Content)
+			}
+			result.Output = fantasy.ToolResultOutputContentText{Text: toolResultSynopsis(calls[result.ToolCallID].ToolName, text.Text)}
+			content[j] = result
+			compacted++
+		}
+		if content != nil {
+			out[i].Content = content
+		}
+	}
+	return out, compacted
+}
+
+// toolResultSynopsis keeps the first lines of a tool output and tells the
+// model the rest was elided.
+func toolResultSynopsis(toolName, output string) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	head := lines[:min(len(lines), synopsisLines)]
+	var b strings.Builder
+	for _, line := range head {
+		if len(line) > synopsisLineWidth {
+			line = line[:synopsisLineWidth] + "..."
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	tool := "the tool"
+	if toolName != "" {
+		tool = toolName
+	}
+	fmt.Fprintf(&b, "%s: %d lines, %d characters. Call %s again if you need the full output.]", synopsisNote, len(lines), len(output), tool)
+	return b.String()
+}
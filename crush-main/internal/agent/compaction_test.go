@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func toolExchange(id, output string) []fantasy.Message {
+	return []fantasy.Message{
+		{
+			Role:    fantasy.MessageRoleAssistant,
+			Content: []fantasy.MessagePart{fantasy.ToolCallPart{ToolCallID: id, ToolName: "view", Input: `{}`}},
+		},
+		{
+			Role: fantasy.MessageRoleTool,
+			Content: []fantasy.MessagePart{fantasy.ToolResultPart{
+				ToolCallID: id,
+				Output:     fantasy.ToolResultOutputContentText{Text: output},
+			}},
+		},
+	}
+}
+
+func resultText(t *testing.T, msg fantasy.Message) string {
+	t.Helper()
+	result, ok := fantasy.AsMessagePart[fantasy.ToolResultPart](msg.Content[0])
+	require.True(t, ok)
+	text, ok := fantasy.AsToolResultOutputType[fantasy.ToolResultOutputContentText](result.Output)
+	require.True(t, ok)
+	return text.Text
+}
+
+func TestNewToolResultCompactor(t *testing.T) {
+	require.Nil(t, newToolResultCompactor(&config.ToolResultCompaction{Disabled: true}))
+	require.Equal(t, &toolResultCompactor{threshold: 0.5, keepRecent: 6, minLength: 1500}, newToolResultCompactor(nil))
+	require.Equal(t, &toolResultCompactor{threshold: 0.7, keepRecent: 2, minLength: 1500}, newToolResultCompactor(&config.ToolResultCompaction{Threshold: 0.7, KeepRecent: 2}))
+
+	var disabled *toolResultCompactor
+	require.False(t, disabled.active(100_000, 90_000))
+	c := newToolResultCompactor(nil)
+	require.False(t, c.active(100_000, 40_000))
+	require.True(t, c.active(100_000, 50_000))
+	require.False(t, c.active(0, 50_000))
+}
+
+func TestToolResultCompactorCompact(t *testing.T) {
+	long := strings.Repeat("line of output\n", 200)
+	var msgs []fantasy.Message
+	msgs = append(msgs, fantasy.NewUserMessage("hello"))
+	msgs = append(msgs, toolExchange("old", long)...)
+	msgs = append(msgs, toolExchange("short", "ok")...)
+	msgs = append(msgs, toolExchange("recent", long)...)
+
+	c := &toolResultCompactor{threshold: 0.5, keepRecent: 1, minLength: 100}
+	out, compacted := c.compact(msgs)
+	require.Equal(t, 1, compacted)
+
+	synopsis := resultText(t, out[2])
+	require.True(t, strings.HasPrefix(synopsis, strings.Repeat("line of output\n", synopsisLines)))
+	require.Contains(t, synopsis, "200 lines")
+	require.Contains(t, synopsis, "Call view again")
+	require.Equal(t, "ok", resultText(t, out[4]))
+	require.Equal(t, long, resultText(t, out[6]), "recent results are kept")
+	require.Equal(t, long, resultText(t, msgs[2]), "the input is not changed")
+
+	// Compacting again leaves the synopsis as is
+	again, compacted := c.compact(out)
+	require.Equal(t, 0, compacted)
+	require.Equal(t, synopsis, resultText(t, again[2]))
+}
@@ -13,22 +13,33 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"charm.land/fantasy"
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/rolling1314/rolling-crush/domain/audit"
+	"github.com/rolling1314/rolling-crush/domain/budget"
 	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/rolling1314/rolling-crush/domain/job"
+	"github.com/rolling1314/rolling-crush/domain/memory"
 	"github.com/rolling1314/rolling-crush/domain/message"
 	"github.com/rolling1314/rolling-crush/domain/permission"
 	"github.com/rolling1314/rolling-crush/domain/session"
 	"github.com/rolling1314/rolling-crush/domain/toolcall"
 	"github.com/rolling1314/rolling-crush/infra/postgres"
 	"github.com/rolling1314/rolling-crush/infra/redis"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
 	agentprompt "github.com/rolling1314/rolling-crush/internal/agent/prompt"
+	"github.com/rolling1314/rolling-crush/internal/agent/synthetic"
 	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+	"github.com/rolling1314/rolling-crush/internal/codeindex"
 	"github.com/rolling1314/rolling-crush/internal/lsp"
 	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
 	"github.com/rolling1314/rolling-crush/internal/pkg/log"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
 	"github.com/rolling1314/rolling-crush/pkg/config"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 
 	"charm.land/fantasy/providers/anthropic"
@@ -43,18 +54,45 @@ import (
 )
 
 type Coordinator interface {
-	// INFO: (kujtim) this is not used yet we will use this when we have multiple agents
-	// SetMainAgent(string)
+	// Run runs a prompt with the coder agent.
 	Run(ctx context.Context, sessionID, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error)
-	Cancel(sessionID string)
-	CancelAll()
+	// RunAgent runs a prompt with a named agent, e.g. "reviewer". A session
+	// runs one agent at a time.
+	RunAgent(ctx context.Context, agentName, sessionID, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error)
+	// RegisterAgent builds an agent so prompts can be routed to it by name.
+	// Its tools are limited to the allowed tools and MCPs of its config.
+	RegisterAgent(ctx context.Context, name string, agent config.Agent) error
+	// Agents returns the names of the agents prompts can be routed to.
+	Agents() []string
+	// Cancel cancels the running turn of a session, the reason is recorded
+	// on the assistant message.
+	Cancel(sessionID string, reason message.CancelReason)
+	// CancelWithMode cancels the running turn of a session, soft
+	// cancellation lets the current tool finish first.
+	CancelWithMode(sessionID string, mode CancelMode, reason message.CancelReason)
+	CancelAll(reason message.CancelReason)
 	IsSessionBusy(sessionID string) bool
 	IsBusy() bool
 	QueuedPrompts(sessionID string) int
 	ClearQueue(sessionID string)
+	// ListQueue returns the prompts waiting for the running turn of a session.
+	ListQueue(sessionID string) []QueuedPrompt
+	// RemoveQueued drops a queued prompt before it runs.
+	RemoveQueued(sessionID, promptID string) error
+	// ReorderQueue moves the listed prompts to the front of the queue, in order.
+	ReorderQueue(sessionID string, promptIDs []string) error
 	Summarize(context.Context, string) error
 	Model() Model
 	UpdateModels(ctx context.Context) error
+	// UpdateSessionModels builds the models selected in the session config
+	// again, the prompts queued behind the running turn use them.
+	UpdateSessionModels(ctx context.Context, sessionID string) error
+	// LastTimeline returns the timeline of the last turn run in the session
+	// and forgets it.
+	LastTimeline(sessionID string) (TurnTimeline, bool)
+	// CodeIndex returns the index searched by the code_search tool, nil when
+	// code search is disabled.
+	CodeIndex() *codeindex.Indexer
 }
 
 type coordinator struct {
@@ -66,11 +104,17 @@ type coordinator struct {
 	permissions permission.Service
 	history     history.Service
 	lspClients  *csync.Map[string, *lsp.Client]
-	dbReader    config.DBReader  // For loading session-specific config from DB
-	dbQuerier   postgres.Querier // For querying session and project info
+	dbReader    config.DBReader    // For loading session-specific config from DB
+	dbQuerier   postgres.Querier   // For querying session and project info
+	jobs        job.Service        // Background jobs of the bash tool, nil without database
+	resultCache tools.ResultCache  // Results of the read-only tools, nil when disabled
+	codeIndex   *codeindex.Indexer // Index of the code_search tool, nil when disabled
+	memories    memory.Service     // Notes of the memory tool, nil without database
 
 	currentAgent SessionAgent
+	agentsMu     sync.RWMutex
 	agents       map[string]SessionAgent
+	agentConfigs map[string]config.Agent
 
 	readyWg errgroup.Group
 }
@@ -96,66 +140,142 @@ func NewCoordinator(
 	}
 
 	c := &coordinator{
-		cfg:         cfg,
-		sessions:    sessions,
-		messages:    messages,
-		toolCalls:   toolCalls,
-		redisCmd:    redisCmd,
-		permissions: permissions,
-		history:     history,
-		lspClients:  lspClients,
-		dbReader:    dbReader,
-		dbQuerier:   dbQuerier,
-		agents:      make(map[string]SessionAgent),
+		cfg:          cfg,
+		sessions:     sessions,
+		messages:     messages,
+		toolCalls:    toolCalls,
+		redisCmd:     redisCmd,
+		permissions:  permissions,
+		history:      history,
+		lspClients:   lspClients,
+		dbReader:     dbReader,
+		dbQuerier:    dbQuerier,
+		agents:       make(map[string]SessionAgent),
+		agentConfigs: make(map[string]config.Agent),
+	}
+
+	if dbQuerier != nil {
+		c.jobs = job.NewService(dbQuerier, nil)
+		c.memories = memory.NewService(dbQuerier)
+	}
+
+	// Tool results are cached until the files of the session change
+	if client := redis.GetClient(); client != nil && cfg.Tools.Cache.Enabled {
+		c.resultCache = redis.NewToolResultCache(client)
+		go c.invalidateResultCache(ctx)
+	}
+
+	// The workspaces are indexed for the code_search tool
+	if cfg.Tools.CodeSearch.Enabled && dbQuerier != nil {
+		search := cfg.Tools.CodeSearch
+		apiKey, err := cfg.Resolve(search.APIKey)
+		if err != nil {
+			slog.Warn("Failed to resolve the code search API key", "error", err)
+		}
+		c.codeIndex = codeindex.New(dbQuerier, sandbox.GetDefaultClient(), codeindex.NewOpenAIEmbedder(search.BaseURL, apiKey, search.Model))
 	}
 
 	agentCfg, ok := cfg.Agents[config.AgentCoder]
 	if !ok {
 		return nil, errors.New("coder agent not configured")
 	}
-
-	// TODO: make this dynamic when we support multiple agents
-	coderAgentPrompt, err := coderPrompt(agentprompt.WithWorkingDir(c.cfg.WorkingDir()))
-	if err != nil {
+	if err := c.RegisterAgent(ctx, config.AgentCoder, agentCfg); err != nil {
 		return nil, err
 	}
+	c.currentAgent = c.agents[config.AgentCoder]
 
-	agent, err := c.buildAgent(ctx, coderAgentPrompt, agentCfg)
-	if err != nil {
-		return nil, err
+	// The task agent only runs as the agent tool of the others
+	for name, agentCfg := range cfg.Agents {
+		if name == config.AgentCoder || name == config.AgentTask || agentCfg.Disabled {
+			continue
+		}
+		if err := c.RegisterAgent(ctx, name, agentCfg); err != nil {
+			return nil, fmt.Errorf("failed to build agent %q: %w", name, err)
+		}
 	}
-	c.currentAgent = agent
-	c.agents[config.AgentCoder] = agent
 	return c, nil
 }
 
+// RegisterAgent implements Coordinator.
+func (c *coordinator) RegisterAgent(ctx context.Context, name string, agentCfg config.Agent) error {
+	if name == "" {
+		return errors.New("agent name is required")
+	}
+	agentPrompt, err := coderPrompt(agentprompt.WithWorkingDir(c.cfg.WorkingDir()))
+	if err != nil {
+		return err
+	}
+	agent, err := c.buildAgent(ctx, agentPrompt, agentCfg)
+	if err != nil {
+		return err
+	}
+
+	c.agentsMu.Lock()
+	defer c.agentsMu.Unlock()
+	c.agents[name] = agent
+	c.agentConfigs[name] = agentCfg
+	slog.Info("Agent registered", "agent", name, "allowed_tools", len(agentCfg.AllowedTools))
+	return nil
+}
+
+// Agents implements Coordinator.
+func (c *coordinator) Agents() []string {
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	names := make([]string, 0, len(c.agents))
+	for name := range c.agents {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// sessionAgents returns the registered agents.
+func (c *coordinator) sessionAgents() map[string]SessionAgent {
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	return maps.Clone(c.agents)
+}
+
 // Run implements Coordinator.
 func (c *coordinator) Run(ctx context.Context, sessionID string, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error) {
-	fmt.Println("\n=== Coordinator.Run 方法调用 ===")
-	fmt.Printf("SessionID: %s\n", sessionID)
-	fmt.Printf("Prompt: %s\n", prompt)
-	fmt.Printf("接收到的附件数量: %d\n", len(attachments))
-	for i, att := range attachments {
-		fmt.Printf("  [附件 %d] FileName: %s, MimeType: %s, Size: %d bytes\n",
-			i+1, att.FileName, att.MimeType, len(att.Content))
-	}
-	fmt.Println("=== Coordinator.Run 开始处理 ===\n")
+	return c.RunAgent(ctx, config.AgentCoder, sessionID, prompt, attachments...)
+}
+
+// RunAgent implements Coordinator. An empty agent name runs the coder agent.
+func (c *coordinator) RunAgent(ctx context.Context, agentName, sessionID, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error) {
+	agentName = cmp.Or(agentName, config.AgentCoder)
+	ctx, span := tracing.Start(ctx, "coordinator.run", tracing.SessionIDKey.String(sessionID), attribute.String("agent", agentName))
+	result, err := c.runAgent(ctx, agentName, sessionID, prompt, attachments...)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (c *coordinator) runAgent(ctx context.Context, agentName, sessionID, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error) {
+	ctx = log.WithSessionID(ctx, sessionID)
+	slog.DebugContext(ctx, "Running agent", "agent", agentName, "prompt_len", len(prompt), "attachments", len(attachments))
 
 	if err := c.readyWg.Wait(); err != nil {
-		fmt.Println("readyWg.Wait failed:", err)
 		return nil, err
 	}
-	fmt.Println("readyWg.Wait passed")
 
-	// Check if currentAgent exists
-	if c.currentAgent == nil {
-		fmt.Println("ERROR: currentAgent is nil!")
-		return nil, errors.New("agent not initialized")
+	c.agentsMu.RLock()
+	agent, agentCfg := c.agents[agentName], c.agentConfigs[agentName]
+	c.agentsMu.RUnlock()
+	if agent == nil {
+		return nil, fmt.Errorf("agent %q not found", agentName)
+	}
+	// The messages of a session are written by one agent at a time
+	for name, other := range c.sessionAgents() {
+		if name != agentName && other.IsSessionBusy(sessionID) {
+			return nil, ErrSessionBusy
+		}
 	}
-	fmt.Println("currentAgent exists")
 
 	// Query workdir_path from session -> project for prompt
 	workingDirForPrompt := c.cfg.WorkingDir() // Default to config working dir
+	// The project conventions added after the coder prompt
+	var projectID, projectPrompt string
 	if c.dbQuerier != nil {
 		dbSession, err := c.dbQuerier.GetSessionByID(ctx, sessionID)
 		if err != nil {
@@ -164,53 +284,56 @@ func (c *coordinator) Run(ctx context.Context, sessionID string, prompt string,
 			project, err := c.dbQuerier.GetProjectByID(ctx, dbSession.ProjectID.String)
 			if err != nil {
 				slog.Warn("Failed to get project for workdir lookup", "project_id", dbSession.ProjectID.String, "error", err)
-			} else if project.WorkdirPath.Valid && project.WorkdirPath.String != "" {
-				workingDirForPrompt = project.WorkdirPath.String
-				slog.Info("Using project-specific working directory for prompt", "session_id", sessionID, "project_id", project.ID, "workdir", workingDirForPrompt)
+			} else {
+				projectID = project.ID
+				projectPrompt = project.SystemPrompt
+				// The permission timeout of the tools overrides the project's
+				if project.PermissionTimeout > 0 {
+					ctx = context.WithValue(ctx, tools.PermissionTimeoutContextKey, time.Duration(project.PermissionTimeout)*time.Second)
+				}
+				if project.WorkdirPath.Valid && project.WorkdirPath.String != "" {
+					workingDirForPrompt = project.WorkdirPath.String
+					slog.Info("Using project-specific working directory for prompt", "session_id", sessionID, "project_id", project.ID, "workdir", workingDirForPrompt)
+				}
 			}
 		}
 	}
+	// A working directory requested with the prompt, validated by the caller
+	promptWorkingDir := tools.GetWorkingDirFromContext(ctx)
+	if promptWorkingDir != "" {
+		workingDirForPrompt = promptWorkingDir
+	}
+
+	// Tools declared by the project workspace are loaded for every run so that
+	// edits to crush-tools.json apply to the next prompt
+	projectTools, err := tools.LoadProjectTools(ctx, c.permissions, sessionID, workingDirForPrompt)
+	if err != nil {
+		slog.Warn("Ignoring invalid project tools", "session_id", sessionID, "error", err)
+	} else if len(projectTools) > 0 {
+		slog.Info("Loaded project tools", "session_id", sessionID, "tool_count", len(projectTools))
+	}
 
 	// Load session-specific config from database if dbReader is available
-	sessionCfg := c.cfg
-	if c.dbReader != nil {
-		fmt.Println("dbReader available, loading session config")
-		var err error
-		sessionCfg, err = config.LoadWithSessionConfig(
-			ctx,
-			c.cfg.WorkingDir(),
-			c.cfg.Options.DataDirectory,
-			c.cfg.Options.Debug,
-			sessionID,
-			c.dbReader,
-		)
-		if err != nil {
-			fmt.Println("Failed to load session config:", err)
-			slog.Error("Failed to load session config, using base config", "session_id", sessionID, "error", err)
-			sessionCfg = c.cfg // Fallback to base config
-		} else {
-			fmt.Println("Session config loaded successfully")
-		}
-	} else {
-		fmt.Println("dbReader is nil, using base config")
+	sessionCfg, err := c.loadSessionConfig(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to load session config, using base config", "session_id", sessionID, "error", err)
+		sessionCfg = c.cfg // Fallback to base config
 	}
+	// A retry may run with another model, temperature or reasoning effort
+	sessionCfg = withModelOverride(sessionCfg, tools.GetModelOverrideFromContext(ctx))
 
-	fmt.Println("About to build agent models with session config")
 	// Build agent models using session config
 	large, small, err := c.buildAgentModelsWithConfig(ctx, sessionCfg)
-	fmt.Println(sessionCfg)
-	fmt.Println("hello")
 	if err != nil {
-		fmt.Println("buildAgentModelsWithConfig failed:", err)
 		// Fallback to current agent's models
 		slog.Error("Failed to build session models, using default", "session_id", sessionID, "error", err)
-		large = c.currentAgent.Model()
+		large = agent.Model()
 		// Try to build small model from base config
 		small, _, _ = c.buildAgentModelsWithConfig(ctx, c.cfg)
 	} else {
-		fmt.Println("Models built successfully, updating agent")
 		// Update current agent's models for this session
-		c.currentAgent.SetModels(large, small)
+		agent.SetModels(large, small)
+		agent.SetTaskModels(c.buildTaskModels(ctx, sessionCfg))
 	}
 
 	// Rebuild system prompt with project-specific working directory
@@ -223,8 +346,11 @@ func (c *coordinator) Run(ctx context.Context, sessionID string, prompt string,
 			slog.Error("Failed to build session system prompt", "error", err)
 		} else {
 			// Update agent's system prompt for this session
-			c.currentAgent.(*sessionAgent).systemPrompt = sessionSystemPrompt
-			fmt.Println("Updated system prompt with workdir:", workingDirForPrompt)
+			sessionSystemPrompt = withProjectPrompt(sessionSystemPrompt, projectPrompt)
+			sessionSystemPrompt = withPinnedContext(sessionSystemPrompt, sessionCfg.Options.PinnedContext)
+			sessionSystemPrompt = withProjectMemory(sessionSystemPrompt, c.relevantMemories(ctx, agentCfg, projectID, prompt))
+			agent.(*sessionAgent).systemPrompt = withInstructions(sessionSystemPrompt, agentCfg)
+			slog.DebugContext(ctx, "Updated system prompt with workdir", "workdir", workingDirForPrompt)
 		}
 	}
 
@@ -234,18 +360,10 @@ func (c *coordinator) Run(ctx context.Context, sessionID string, prompt string,
 		maxTokens = model.ModelCfg.MaxTokens
 	}
 
-	fmt.Printf("\n=== Coordinator: 检查模型图片支持 ===\n")
-	fmt.Printf("模型: %s\n", model.Model.Model())
-	fmt.Printf("支持图片: %v\n", model.CatwalkCfg.SupportsImages)
-	fmt.Printf("接收到的附件数量: %d\n", len(attachments))
-
 	if !model.CatwalkCfg.SupportsImages && attachments != nil {
-		fmt.Printf("⚠️  警告：模型不支持图片，移除 %d 个附件！\n", len(attachments))
+		slog.WarnContext(ctx, "Model does not support images, dropping attachments", "model", model.Model.Model(), "attachments", len(attachments))
 		attachments = nil
-	} else if len(attachments) > 0 {
-		fmt.Printf("✅ 模型支持图片，保留 %d 个附件\n", len(attachments))
 	}
-	fmt.Printf("=== Coordinator: 检查完成 ===\n\n")
 
 	providerCfg, ok := sessionCfg.Providers.Get(model.ModelCfg.Provider)
 	if !ok {
@@ -253,29 +371,77 @@ func (c *coordinator) Run(ctx context.Context, sessionID string, prompt string,
 	}
 
 	mergedOptions, temp, topP, topK, freqPenalty, presPenalty := mergeCallOptions(model, providerCfg)
-
-	fmt.Printf("\n=== Coordinator: 调用 currentAgent.Run ===\n")
-	fmt.Printf("最终传递给 Agent 的附件数量: %d\n", len(attachments))
-	for i, att := range attachments {
-		fmt.Printf("  [附件 %d] FileName: %s, MimeType: %s, Size: %d bytes\n",
-			i+1, att.FileName, att.MimeType, len(att.Content))
-	}
-	fmt.Println("=== Coordinator: 开始调用 Agent ===\n")
-
-	return c.currentAgent.Run(ctx, SessionAgentCall{
-		SessionID:        sessionID,
-		Prompt:           prompt,
-		Attachments:      attachments,
-		MaxOutputTokens:  maxTokens,
-		ProviderOptions:  mergedOptions,
-		Temperature:      temp,
-		TopP:             topP,
-		TopK:             topK,
-		FrequencyPenalty: freqPenalty,
-		PresencePenalty:  presPenalty,
+	fallbacks, failover := c.buildFallbacks(ctx, sessionCfg)
+	// A plan changes no file, there are no new errors to fix
+	planMode := tools.IsPlanModeFromContext(ctx)
+	autoFixIterations := sessionCfg.Options.AutoFix.Iterations()
+	if planMode {
+		autoFixIterations = 0
+	}
+
+	return agent.Run(ctx, SessionAgentCall{
+		SessionID:         sessionID,
+		Prompt:            prompt,
+		Attachments:       attachments,
+		MaxOutputTokens:   maxTokens,
+		ProviderOptions:   mergedOptions,
+		Temperature:       temp,
+		TopP:              topP,
+		TopK:              topK,
+		FrequencyPenalty:  freqPenalty,
+		PresencePenalty:   presPenalty,
+		ExtraTools:        projectTools,
+		WorkingDir:        promptWorkingDir,
+		Fallbacks:         fallbacks,
+		Failover:          failover,
+		AutoFixIterations: autoFixIterations,
+		PlanMode:          planMode,
+		ResumeToolCall:    tools.GetResumeToolCallFromContext(ctx),
+		Capabilities:      model.ModelCfg.Capabilities,
+		BusyPolicy:        cmp.Or(tools.GetBusyPolicyFromContext(ctx), sessionCfg.Options.BusyPolicy),
 	})
 }
 
+// buildFallbacks builds the fallback models of the failover options with the
+// call options of their providers, and the retry policy. Fallback models that
+// fail to build are skipped.
+func (c *coordinator) buildFallbacks(ctx context.Context, cfg *config.Config) ([]FallbackModel, *FailoverPolicy) {
+	opts := cfg.Options.Failover
+	if opts == nil {
+		return nil, nil
+	}
+	policy := DefaultFailoverPolicy
+	if opts.MaxRetries != nil {
+		policy.MaxRetries = max(0, *opts.MaxRetries)
+	}
+	if opts.InitialDelayMs > 0 {
+		policy.InitialDelay = time.Duration(opts.InitialDelayMs) * time.Millisecond
+	}
+
+	var fallbacks []FallbackModel
+	for _, modelCfg := range opts.Models {
+		model, err := c.buildSelectedModel(ctx, cfg, modelCfg, "fallback")
+		if err != nil {
+			slog.Warn("Skipping fallback model", "provider", modelCfg.Provider, "model", modelCfg.Model, "error", err)
+			continue
+		}
+		providerCfg, _ := cfg.Providers.Get(modelCfg.Provider)
+		maxTokens := cmp.Or(model.ModelCfg.MaxTokens, model.CatwalkCfg.DefaultMaxTokens)
+		providerOptions, temp, topP, topK, freqPenalty, presPenalty := mergeCallOptions(model, providerCfg)
+		fallbacks = append(fallbacks, FallbackModel{
+			Model:            model,
+			MaxOutputTokens:  maxTokens,
+			ProviderOptions:  providerOptions,
+			Temperature:      temp,
+			TopP:             topP,
+			TopK:             topK,
+			FrequencyPenalty: freqPenalty,
+			PresencePenalty:  presPenalty,
+		})
+	}
+	return fallbacks, &policy
+}
+
 func getProviderOptions(model Model, providerCfg config.ProviderConfig) fantasy.ProviderOptions {
 	options := fantasy.ProviderOptions{}
 
@@ -323,6 +489,7 @@ func getProviderOptions(model Model, providerCfg config.ProviderConfig) fantasy.
 		slog.Error("Could not create config for call", "err", err)
 		return options
 	}
+	withParallelToolCalls(mergedOptions, providerCfg.Type, model.ModelCfg.Capabilities)
 
 	switch providerCfg.Type {
 	case openai.Name, azure.Name:
@@ -382,7 +549,7 @@ func getProviderOptions(model Model, providerCfg config.ProviderConfig) fantasy.
 		if err == nil {
 			options[google.Name] = parsed
 		}
-	case openaicompat.Name:
+	case openaicompat.Name, config.ProviderTypeOllama:
 		_, hasReasoningEffort := mergedOptions["reasoning_effort"]
 		if !hasReasoningEffort && model.ModelCfg.ReasoningEffort != "" {
 			mergedOptions["reasoning_effort"] = model.ModelCfg.ReasoningEffort
@@ -430,13 +597,45 @@ func (c *coordinator) buildAgent(ctx context.Context, agentPrompt *agentprompt.P
 		systemPromptPrefix = largeProviderCfg.SystemPromptPrefix
 	}
 
+	var moderator *OutputModerator
+	var stallTimeout time.Duration
+	if appCfg := config.GetGlobalAppConfig(); appCfg != nil {
+		moderator, err = NewOutputModerator(appCfg.Moderation)
+		if err != nil {
+			return nil, fmt.Errorf("invalid moderation config: %w", err)
+		}
+		stallTimeout = time.Duration(appCfg.Agent.StallTimeout) * time.Second
+	}
+	var budgets budget.Service
+	if c.dbQuerier != nil {
+		var defaults budget.Defaults
+		if appCfg := config.GetGlobalAppConfig(); appCfg != nil {
+			defaults = budget.Defaults{
+				Session: budget.Limit(appCfg.Budgets.Session),
+				Project: budget.Limit(appCfg.Budgets.Project),
+				User:    budget.Limit(appCfg.Budgets.User),
+			}
+		}
+		budgets = budget.NewService(c.dbQuerier, defaults)
+	}
+	var toolAudit audit.Service
+	if c.dbQuerier != nil {
+		toolAudit = audit.NewService(c.dbQuerier)
+	}
+	var generations GenerationCache
+	if client := redis.GetClient(); client != nil {
+		generations = redis.NewGenerationCache(client)
+	}
+
 	// Create agent with system prompt (models may be empty initially)
 	result := NewSessionAgent(SessionAgentOptions{
 		LargeModel:           large,
 		SmallModel:           small,
 		SystemPromptPrefix:   systemPromptPrefix,
-		SystemPrompt:         systemPrompt,
+		SystemPrompt:         withInstructions(systemPrompt, agent),
 		DisableAutoSummarize: c.cfg.Options.DisableAutoSummarize,
+		ToolResultCompaction: c.cfg.Options.ToolResultCompaction,
+		LoopGuard:            c.cfg.Options.LoopGuard,
 		IsYolo:               c.permissions.SkipRequests(),
 		Sessions:             c.sessions,
 		Messages:             c.messages,
@@ -444,7 +643,15 @@ func (c *coordinator) buildAgent(ctx context.Context, agentPrompt *agentprompt.P
 		RedisCmd:             c.redisCmd,
 		Tools:                nil,
 		DBQuerier:            c.dbQuerier,
+		Moderator:            moderator,
+		StallTimeout:         stallTimeout,
+		Budgets:              budgets,
+		Audit:                toolAudit,
+		Permissions:          c.permissions,
+		Diagnostics:          sandbox.GetDefaultClient(),
+		GenerationCache:      generations,
 	})
+	result.SetTaskModels(c.buildTaskModels(ctx, c.cfg))
 
 	// Build tools asynchronously (tools don't depend on models)
 	c.readyWg.Go(func() error {
@@ -490,16 +697,29 @@ func (c *coordinator) buildTools(ctx context.Context, agent config.Agent, workin
 		}
 	}
 
+	// Fetched pages are shared through Redis when it is available
+	var fetchCache tools.FetchCache
+	if client := redis.GetClient(); client != nil {
+		fetchCache = redis.NewFetchCache(client)
+	}
+
 	allTools = append(allTools,
-		tools.NewBashTool(c.permissions, workingDir, c.cfg.Options.Attribution, modelName),
-		tools.NewJobOutputTool(),
-		tools.NewJobKillTool(),
+		tools.NewBashTool(c.permissions, workingDir, c.cfg.Options.Attribution, modelName, c.jobs),
+		tools.NewJobOutputTool(c.jobs),
+		tools.NewJobKillTool(c.jobs),
+		tools.NewGitStatusTool(c.permissions, workingDir),
+		tools.NewGitDiffTool(c.permissions, workingDir),
+		tools.NewGitCommitTool(c.permissions, workingDir, c.cfg.Options.Attribution, modelName),
+		tools.NewGitBranchTool(c.permissions, workingDir),
+		tools.NewGitCheckoutTool(c.permissions, workingDir),
 		tools.NewDownloadTool(c.permissions, workingDir, nil),
 		tools.NewEditTool(c.lspClients, c.permissions, c.history, workingDir),
 		tools.NewMultiEditTool(c.lspClients, c.permissions, c.history, workingDir),
-		tools.NewFetchTool(c.permissions, workingDir, nil),
+		tools.NewApplyPatchTool(c.permissions, c.history, workingDir),
+		tools.NewFetchTool(c.permissions, workingDir, nil, fetchCache),
 		tools.NewGlobTool(workingDir),
 		tools.NewGrepTool(workingDir),
+		tools.NewLintTool(c.permissions, workingDir),
 		tools.NewLsTool(c.permissions, workingDir, c.cfg.Tools.Ls),
 		tools.NewSourcegraphTool(nil),
 		tools.NewViewTool(c.lspClients, c.permissions, workingDir),
@@ -508,7 +728,19 @@ func (c *coordinator) buildTools(ctx context.Context, agent config.Agent, workin
 	)
 
 	if len(c.cfg.LSP) > 0 {
-		allTools = append(allTools, tools.NewDiagnosticsTool(c.lspClients), tools.NewReferencesTool(c.lspClients))
+		allTools = append(allTools,
+			tools.NewDiagnosticsTool(c.lspClients),
+			tools.NewReferencesTool(c.lspClients),
+			tools.NewRenameSymbolTool(c.lspClients, c.permissions, c.history, workingDir),
+		)
+	}
+
+	if c.codeIndex != nil {
+		allTools = append(allTools, tools.NewCodeSearchTool(c.codeIndex, c.sessionProject))
+	}
+
+	if c.memories != nil {
+		allTools = append(allTools, tools.NewMemoryTool(c.memories, c.sessionProject))
 	}
 
 	var filteredTools []fantasy.AgentTool
@@ -543,96 +775,181 @@ func (c *coordinator) buildTools(ctx context.Context, agent config.Agent, workin
 	slices.SortFunc(filteredTools, func(a, b fantasy.AgentTool) int {
 		return strings.Compare(a.Info().Name, b.Info().Name)
 	})
-	return filteredTools, nil
+	filteredTools = tools.WithResultCache(filteredTools, c.resultCache, time.Duration(c.cfg.Tools.Cache.TTL)*time.Second, workingDir)
+	return tools.WithLimits(filteredTools, c.cfg.Tools.Limits), nil
 }
 
-// TODO: when we support multiple agents we need to change this so that we pass in the agent specific model config
-func (c *coordinator) buildAgentModels(ctx context.Context) (Model, Model, error) {
-	return c.buildAgentModelsWithConfig(ctx, c.cfg)
+// invalidateResultCache drops the cached tool results of a workspace, for
+// all the sessions of its project, whenever the file history of one of them
+// records a change, e.g. an edit made outside of a tool.
+func (c *coordinator) invalidateResultCache(ctx context.Context) {
+	if c.history == nil {
+		return
+	}
+	for event := range c.history.Subscribe(ctx) {
+		workspace := c.sessionWorkspace(ctx, event.Payload.SessionID)
+		if err := c.resultCache.Invalidate(ctx, workspace); err != nil {
+			slog.Warn("Failed to invalidate tool result cache", "session_id", event.Payload.SessionID, "workspace", workspace, "error", err)
+		}
+	}
 }
 
-// buildAgentModelsWithConfig builds agent models using a specific config (for session-specific configs)
-func (c *coordinator) buildAgentModelsWithConfig(ctx context.Context, cfg *config.Config) (Model, Model, error) {
-	largeModelCfg, ok := cfg.Models[config.SelectedModelTypeLarge]
-	if !ok {
-		return Model{}, Model{}, errors.New("large model not selected")
+// withInstructions adds the instructions of an agent to its system prompt.
+func withInstructions(systemPrompt string, agent config.Agent) string {
+	if agent.Instructions == "" {
+		return systemPrompt
 	}
-	smallModelCfg, ok := cfg.Models[config.SelectedModelTypeSmall]
-	if !ok {
-		return Model{}, Model{}, errors.New("small model not selected")
+	return systemPrompt + "\n\n<agent_instructions>\n" + agent.Instructions + "\n</agent_instructions>"
+}
+
+// withProjectPrompt adds the system prompt of the project of a session after
+// the coder prompt.
+func withProjectPrompt(systemPrompt, projectPrompt string) string {
+	if strings.TrimSpace(projectPrompt) == "" {
+		return systemPrompt
 	}
+	return systemPrompt + "\n\n<project_instructions>\n" + projectPrompt + "\n</project_instructions>"
+}
 
-	largeProviderCfg, ok := cfg.Providers.Get(largeModelCfg.Provider)
-	if !ok {
-		return Model{}, Model{}, errors.New("large model provider not configured")
+// withPinnedContext adds the pinned context of a session to its system prompt.
+func withPinnedContext(systemPrompt, pinnedContext string) string {
+	if pinnedContext == "" {
+		return systemPrompt
 	}
+	return systemPrompt + "\n\n<pinned_context>\n" + pinnedContext + "\n</pinned_context>"
+}
 
-	largeProvider, err := c.buildProviderWithConfig(largeProviderCfg, largeModelCfg, cfg)
+// relevantMemories returns the notes of the project memory most relevant to
+// a prompt, for agents with the memory tool.
+func (c *coordinator) relevantMemories(ctx context.Context, agent config.Agent, projectID, prompt string) []memory.Memory {
+	limit := c.cfg.Tools.Memory.Entries()
+	if c.memories == nil || projectID == "" || limit == 0 || !slices.Contains(agent.AllowedTools, tools.MemoryToolName) {
+		return nil
+	}
+	memories, err := c.memories.Relevant(ctx, projectID, prompt, limit)
 	if err != nil {
-		return Model{}, Model{}, err
+		slog.Warn("Failed to load the project memory", "project_id", projectID, "error", err)
+		return nil
 	}
+	return memories
+}
 
-	smallProviderCfg, ok := cfg.Providers.Get(smallModelCfg.Provider)
-	if !ok {
-		return Model{}, Model{}, errors.New("small model provider not configured")
+// withProjectMemory adds notes of the project memory to the system prompt of
+// a session.
+func withProjectMemory(systemPrompt string, memories []memory.Memory) string {
+	if len(memories) == 0 {
+		return systemPrompt
+	}
+	var b strings.Builder
+	b.WriteString(systemPrompt)
+	b.WriteString("\n\n<project_memory>\nNotes saved with the memory tool in earlier sessions of this project, most relevant first:\n")
+	for _, m := range memories {
+		b.WriteString("- " + m.Content + "\n")
+	}
+	b.WriteString("</project_memory>")
+	return b.String()
+}
+
+// withModelOverride returns a copy of a session config with the override of a
+// turn applied to its large model, the config may be shared with other turns.
+func withModelOverride(cfg *config.Config, override *config.ModelOverride) *config.Config {
+	if override == nil {
+		return cfg
+	}
+	overridden := *cfg
+	overridden.Models = maps.Clone(cfg.Models)
+	if overridden.Models == nil {
+		overridden.Models = make(map[config.SelectedModelType]config.SelectedModel)
 	}
+	overridden.Models[config.SelectedModelTypeLarge] = override.Apply(cfg.Models[config.SelectedModelTypeLarge])
+	return &overridden
+}
+
+// TODO: pass in the agent specific model config once agents can use different models
+func (c *coordinator) buildAgentModels(ctx context.Context) (Model, Model, error) {
+	return c.buildAgentModelsWithConfig(ctx, c.cfg)
+}
 
-	smallProvider, err := c.buildProviderWithConfig(smallProviderCfg, smallModelCfg, cfg)
+// buildAgentModelsWithConfig builds agent models using a specific config (for session-specific configs)
+func (c *coordinator) buildAgentModelsWithConfig(ctx context.Context, cfg *config.Config) (Model, Model, error) {
+	large, err := c.buildModel(ctx, cfg, config.SelectedModelTypeLarge)
 	if err != nil {
 		return Model{}, Model{}, err
 	}
+	small, err := c.buildModel(ctx, cfg, config.SelectedModelTypeSmall)
+	if err != nil {
+		return Model{}, Model{}, err
+	}
+	return large, small, nil
+}
 
-	var largeCatwalkModel *catwalk.Model
-	var smallCatwalkModel *catwalk.Model
-
-	for _, m := range largeProviderCfg.Models {
-		if m.ID == largeModelCfg.Model {
-			largeCatwalkModel = &m
+// buildTaskModels builds the optional title and summary models of cfg. A
+// model that is not configured, or fails to build, is left empty so the agent
+// falls back to the small model.
+func (c *coordinator) buildTaskModels(ctx context.Context, cfg *config.Config) (title Model, summary Model) {
+	for modelType, model := range map[config.SelectedModelType]*Model{
+		config.SelectedModelTypeTitle:   &title,
+		config.SelectedModelTypeSummary: &summary,
+	} {
+		if _, ok := cfg.Models[modelType]; !ok {
+			continue
 		}
-	}
-	for _, m := range smallProviderCfg.Models {
-		if m.ID == smallModelCfg.Model {
-			smallCatwalkModel = &m
+		built, err := c.buildModel(ctx, cfg, modelType)
+		if err != nil {
+			slog.Warn("Failed to build model, using fallback", "type", modelType, "error", err)
+			continue
 		}
+		*model = built
 	}
+	return title, summary
+}
 
-	if largeCatwalkModel == nil {
-		return Model{}, Model{}, errors.New("large model not found in provider config")
+// buildModel builds the model selected for the given model type.
+func (c *coordinator) buildModel(ctx context.Context, cfg *config.Config, modelType config.SelectedModelType) (Model, error) {
+	modelCfg, ok := cfg.Models[modelType]
+	if !ok {
+		return Model{}, fmt.Errorf("%s model not selected", modelType)
 	}
+	return c.buildSelectedModel(ctx, cfg, modelCfg, string(modelType))
+}
 
-	if smallCatwalkModel == nil {
-		return Model{}, Model{}, errors.New("small model not found in provider config")
+// buildSelectedModel builds a model of the config, kind names it in errors.
+func (c *coordinator) buildSelectedModel(ctx context.Context, cfg *config.Config, modelCfg config.SelectedModel, kind string) (Model, error) {
+	providerCfg, ok := cfg.Providers.Get(modelCfg.Provider)
+	if !ok {
+		return Model{}, fmt.Errorf("%s model provider not configured", kind)
 	}
 
-	largeModelID := largeModelCfg.Model
-	smallModelID := smallModelCfg.Model
-
-	if largeModelCfg.Provider == openrouter.Name && isExactoSupported(largeModelID) {
-		largeModelID += ":exacto"
+	provider, err := c.buildProviderWithConfig(providerCfg, modelCfg, cfg)
+	if err != nil {
+		return Model{}, err
 	}
 
-	if smallModelCfg.Provider == openrouter.Name && isExactoSupported(smallModelID) {
-		smallModelID += ":exacto"
+	var catwalkModel *catwalk.Model
+	for _, m := range providerCfg.Models {
+		if m.ID == modelCfg.Model {
+			catwalkModel = &m
+		}
+	}
+	if catwalkModel == nil {
+		return Model{}, fmt.Errorf("%s model not found in provider config", kind)
 	}
 
-	largeModel, err := largeProvider.LanguageModel(ctx, largeModelID)
-	if err != nil {
-		return Model{}, Model{}, err
+	modelID := modelCfg.Model
+	if modelCfg.Provider == openrouter.Name && isExactoSupported(modelID) {
+		modelID += ":exacto"
 	}
-	smallModel, err := smallProvider.LanguageModel(ctx, smallModelID)
+
+	model, err := provider.LanguageModel(ctx, modelID)
 	if err != nil {
-		return Model{}, Model{}, err
+		return Model{}, err
 	}
 
 	return Model{
-			Model:      largeModel,
-			CatwalkCfg: *largeCatwalkModel,
-			ModelCfg:   largeModelCfg,
-		}, Model{
-			Model:      smallModel,
-			CatwalkCfg: *smallCatwalkModel,
-			ModelCfg:   smallModelCfg,
-		}, nil
+		Model:      model,
+		CatwalkCfg: *catwalkModel,
+		ModelCfg:   modelCfg,
+	}, nil
 }
 
 func (c *coordinator) buildAnthropicProvider(baseURL, apiKey string, headers map[string]string) (fantasy.Provider, error) {
@@ -846,6 +1163,15 @@ func (c *coordinator) buildProviderWithConfig(providerCfg config.ProviderConfig,
 		return c.buildGoogleVertexProvider(headers, providerCfg.ExtraParams)
 	case openaicompat.Name:
 		return c.buildOpenaiCompatProvider(baseURL, apiKey, headers, providerCfg.ExtraBody)
+	case config.ProviderTypeOllama:
+		// Ollama and LM Studio serve the OpenAI API and ignore the key
+		return c.buildOpenaiCompatProvider(cmp.Or(baseURL, config.DefaultOllamaBaseURL), config.OllamaAPIKey(apiKey), headers, providerCfg.ExtraBody)
+	case synthetic.Name:
+		opts, err := synthetic.ParseOptions(providerCfg.ProviderOptions)
+		if err != nil {
+			return nil, err
+		}
+		return synthetic.New(opts), nil
 	default:
 		return nil, fmt.Errorf("provider type not supported: %q", providerCfg.Type)
 	}
@@ -862,24 +1188,86 @@ func isExactoSupported(modelID string) bool {
 	return slices.Contains(supportedModels, modelID)
 }
 
-func (c *coordinator) Cancel(sessionID string) {
-	c.currentAgent.Cancel(sessionID)
+func (c *coordinator) Cancel(sessionID string, reason message.CancelReason) {
+	for _, agent := range c.sessionAgents() {
+		agent.Cancel(sessionID, reason)
+	}
 }
 
-func (c *coordinator) CancelAll() {
-	c.currentAgent.CancelAll()
+func (c *coordinator) CancelWithMode(sessionID string, mode CancelMode, reason message.CancelReason) {
+	for _, agent := range c.sessionAgents() {
+		agent.CancelWithMode(sessionID, mode, reason)
+	}
+}
+
+func (c *coordinator) CancelAll(reason message.CancelReason) {
+	for _, agent := range c.sessionAgents() {
+		agent.CancelAll(reason)
+	}
 }
 
 func (c *coordinator) ClearQueue(sessionID string) {
-	c.currentAgent.ClearQueue(sessionID)
+	for _, agent := range c.sessionAgents() {
+		agent.ClearQueue(sessionID)
+	}
 }
 
 func (c *coordinator) IsBusy() bool {
-	return c.currentAgent.IsBusy()
+	for _, agent := range c.sessionAgents() {
+		if agent.IsBusy() {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *coordinator) IsSessionBusy(sessionID string) bool {
-	return c.currentAgent.IsSessionBusy(sessionID)
+	for _, agent := range c.sessionAgents() {
+		if agent.IsSessionBusy(sessionID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *coordinator) LastTimeline(sessionID string) (TurnTimeline, bool) {
+	for _, agent := range c.sessionAgents() {
+		if timeline, ok := agent.LastTimeline(sessionID); ok {
+			return timeline, true
+		}
+	}
+	return TurnTimeline{}, false
+}
+
+// CodeIndex implements Coordinator.
+func (c *coordinator) CodeIndex() *codeindex.Indexer {
+	return c.codeIndex
+}
+
+// sessionProject returns the project of a session.
+func (c *coordinator) sessionProject(ctx context.Context, sessionID string) (string, error) {
+	sess, err := c.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	return sess.ProjectID, nil
+}
+
+// sessionWorkspace returns the working directory of the project of a
+// session, the one of the config when it has none.
+func (c *coordinator) sessionWorkspace(ctx context.Context, sessionID string) string {
+	if c.dbQuerier == nil {
+		return c.cfg.WorkingDir()
+	}
+	dbSession, err := c.dbQuerier.GetSessionByID(ctx, sessionID)
+	if err != nil || !dbSession.ProjectID.Valid || dbSession.ProjectID.String == "" {
+		return c.cfg.WorkingDir()
+	}
+	project, err := c.dbQuerier.GetProjectByID(ctx, dbSession.ProjectID.String)
+	if err != nil || !project.WorkdirPath.Valid || project.WorkdirPath.String == "" {
+		return c.cfg.WorkingDir()
+	}
+	return project.WorkdirPath.String
 }
 
 func (c *coordinator) Model() Model {
@@ -892,23 +1280,100 @@ func (c *coordinator) UpdateModels(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	c.currentAgent.SetModels(large, small)
 
-	agentCfg, ok := c.cfg.Agents[config.AgentCoder]
-	if !ok {
-		return errors.New("coder agent not configured")
+	c.agentsMu.RLock()
+	defer c.agentsMu.RUnlock()
+	for name, agent := range c.agents {
+		agent.SetModels(large, small)
+		agent.SetTaskModels(c.buildTaskModels(ctx, c.cfg))
+
+		tools, err := c.buildTools(ctx, c.agentConfigs[name], c.cfg.WorkingDir())
+		if err != nil {
+			return err
+		}
+		agent.SetTools(tools)
 	}
+	return nil
+}
+
+// loadSessionConfig merges the session config from the database into the base
+// config, the base config is used as is without database.
+func (c *coordinator) loadSessionConfig(ctx context.Context, sessionID string) (*config.Config, error) {
+	if c.dbReader == nil {
+		return c.cfg, nil
+	}
+	return config.LoadWithSessionConfig(
+		ctx,
+		c.cfg.WorkingDir(),
+		c.cfg.Options.DataDirectory,
+		c.cfg.Options.Debug,
+		sessionID,
+		c.dbReader,
+	)
+}
 
-	tools, err := c.buildTools(ctx, agentCfg, c.cfg.WorkingDir())
+// UpdateSessionModels implements Coordinator.
+func (c *coordinator) UpdateSessionModels(ctx context.Context, sessionID string) error {
+	sessionCfg, err := c.loadSessionConfig(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	large, small, err := c.buildAgentModelsWithConfig(ctx, sessionCfg)
 	if err != nil {
 		return err
 	}
-	c.currentAgent.SetTools(tools)
+	// The next prompts build the models in RunAgent, only the running turn's
+	// agent needs them for its queue
+	title, summary := c.buildTaskModels(ctx, sessionCfg)
+	for _, agent := range c.sessionAgents() {
+		if agent.IsSessionBusy(sessionID) {
+			agent.SetModels(large, small)
+			agent.SetTaskModels(title, summary)
+		}
+	}
 	return nil
 }
 
 func (c *coordinator) QueuedPrompts(sessionID string) int {
-	return c.currentAgent.QueuedPrompts(sessionID)
+	queued := 0
+	for _, agent := range c.sessionAgents() {
+		queued += agent.QueuedPrompts(sessionID)
+	}
+	return queued
+}
+
+func (c *coordinator) ListQueue(sessionID string) []QueuedPrompt {
+	agents := c.sessionAgents()
+	var prompts []QueuedPrompt
+	for _, name := range slices.Sorted(maps.Keys(agents)) {
+		for _, prompt := range agents[name].ListQueue(sessionID) {
+			prompt.Agent = name
+			prompts = append(prompts, prompt)
+		}
+	}
+	return prompts
+}
+
+func (c *coordinator) RemoveQueued(sessionID, promptID string) error {
+	for _, agent := range c.sessionAgents() {
+		if err := agent.RemoveQueued(sessionID, promptID); !errors.Is(err, ErrQueuedPromptNotFound) {
+			return err
+		}
+	}
+	return ErrQueuedPromptNotFound
+}
+
+func (c *coordinator) ReorderQueue(sessionID string, promptIDs []string) error {
+	if len(promptIDs) == 0 {
+		return nil
+	}
+	// A session queues its prompts in the agent running its turn
+	for _, agent := range c.sessionAgents() {
+		if slices.ContainsFunc(agent.ListQueue(sessionID), func(p QueuedPrompt) bool { return p.ID == promptIDs[0] }) {
+			return agent.ReorderQueue(sessionID, promptIDs)
+		}
+	}
+	return ErrQueuedPromptNotFound
 }
 
 func (c *coordinator) Summarize(ctx context.Context, sessionID string) error {
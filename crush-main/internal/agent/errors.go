@@ -3,6 +3,8 @@ package agent
 import (
 	"context"
 	"errors"
+
+	"github.com/rolling1314/rolling-crush/internal/apierr"
 )
 
 var (
@@ -15,3 +17,24 @@ var (
 func isCancelledErr(err error) bool {
 	return errors.Is(err, context.Canceled) || errors.Is(err, ErrRequestCancelled)
 }
+
+// ClassifyError returns the API error of a failed prompt or run, see package
+// apierr.
+func ClassifyError(err error) apierr.Error {
+	var haltErr *ModerationHaltError
+	switch {
+	case errors.Is(err, ErrSessionBusy):
+		return apierr.New(apierr.CodeSessionBusy, "")
+	case errors.Is(err, ErrEmptyPrompt), errors.Is(err, ErrSessionMissing), errors.Is(err, ErrQueuedPromptNotFound):
+		return apierr.New(apierr.CodeInvalidRequest, "")
+	case errors.Is(err, ErrPoolFull), errors.Is(err, ErrTaskPreempted):
+		return apierr.New(apierr.CodeCapacityExceeded, "")
+	case errors.Is(err, ErrPoolShutdown):
+		return apierr.New(apierr.CodeUnavailable, "")
+	case errors.Is(err, ErrStreamStalled):
+		return apierr.New(apierr.CodeProviderStalled, "")
+	case errors.As(err, &haltErr):
+		return apierr.New(apierr.CodeModerationHalted, haltErr.Policy)
+	}
+	return apierr.Classify(err)
+}
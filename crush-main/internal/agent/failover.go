@@ -0,0 +1,311 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/internal/pubsub"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// FailoverPolicy configures the retries of the models of a failover chain on
+// transient provider errors, e.g. rate limits and overloaded servers.
+type FailoverPolicy struct {
+	// MaxRetries is the number of retries of each model before failing over.
+	MaxRetries int
+	// InitialDelay is the delay before the first retry, doubled for each
+	// following one unless the provider asks for another one.
+	InitialDelay time.Duration
+}
+
+// DefaultFailoverPolicy retries like fantasy does by default.
+var DefaultFailoverPolicy = FailoverPolicy{MaxRetries: 2, InitialDelay: 2 * time.Second}
+
+// maxRetryDelay bounds the delays asked by the providers.
+const maxRetryDelay = time.Minute
+
+// FallbackModel is a model tried when the models before it in the failover
+// chain fail, with the call options of its provider.
+type FallbackModel struct {
+	Model            Model
+	MaxOutputTokens  int64
+	ProviderOptions  fantasy.ProviderOptions
+	Temperature      *float64
+	TopP             *float64
+	TopK             *int64
+	FrequencyPenalty *float64
+	PresencePenalty  *float64
+}
+
+// apply replaces the options of a call with those of the model.
+func (f FallbackModel) apply(call fantasy.Call) fantasy.Call {
+	call.MaxOutputTokens = &f.MaxOutputTokens
+	call.ProviderOptions = f.ProviderOptions
+	call.Temperature = f.Temperature
+	call.TopP = f.TopP
+	call.TopK = f.TopK
+	call.FrequencyPenalty = f.FrequencyPenalty
+	call.PresencePenalty = f.PresencePenalty
+	return call
+}
+
+// ModelSwitch is published when a turn fails over to the next model of its
+// chain, so that clients show which model actually answered.
+type ModelSwitch struct {
+	SessionID    string
+	MessageID    string
+	FromProvider string
+	FromModel    string
+	ToProvider   string
+	ToModel      string
+	Reason       string
+}
+
+var modelSwitchBroker = pubsub.NewBroker[ModelSwitch]()
+
+// SubscribeModelSwitches returns a channel for the model switches of the turns.
+func SubscribeModelSwitches(ctx context.Context) <-chan pubsub.Event[ModelSwitch] {
+	return modelSwitchBroker.Subscribe(ctx)
+}
+
+// publishModelSwitch tells the clients of a session that its turn fails over
+// to another model, from the step of the given assistant message.
+func publishModelSwitch(sessionID string, msg *message.Message, from, to Model, err error) {
+	var messageID string
+	if msg != nil {
+		messageID = msg.ID
+	}
+	modelSwitchBroker.Publish(pubsub.UpdatedEvent, ModelSwitch{
+		SessionID:    sessionID,
+		MessageID:    messageID,
+		FromProvider: from.ModelCfg.Provider,
+		FromModel:    from.ModelCfg.Model,
+		ToProvider:   to.ModelCfg.Provider,
+		ToModel:      to.ModelCfg.Model,
+		Reason:       err.Error(),
+	})
+}
+
+// failoverModel is the language model of a turn. It streams from the current
+// model of its chain, retries it with backoff on transient errors and fails
+// over to the next one once the retries are exhausted or on other errors.
+// The turn then sticks to that model, the previous ones are likely still
+// failing.
+type failoverModel struct {
+	chain   []FallbackModel
+	policy  FailoverPolicy
+	current int
+	// onRetry is called before waiting to retry the current model.
+	onRetry func(err error, delay time.Duration)
+	// onSwitch is called when the turn fails over to another model.
+	onSwitch func(from, to Model, err error)
+}
+
+// newFailoverModel returns the model streaming from the models of chain, in
+// order. The first one is the large model of the agent.
+func newFailoverModel(chain []FallbackModel, policy FailoverPolicy) *failoverModel {
+	return &failoverModel{chain: chain, policy: policy}
+}
+
+// active returns the model the turn currently streams from.
+func (m *failoverModel) active() Model {
+	return m.chain[m.current].Model
+}
+
+func (m *failoverModel) Provider() string {
+	return m.active().Model.Provider()
+}
+
+func (m *failoverModel) Model() string {
+	return m.active().Model.Model()
+}
+
+func (m *failoverModel) Generate(ctx context.Context, call fantasy.Call) (*fantasy.Response, error) {
+	return m.active().Model.Generate(ctx, m.chain[m.current].apply(call))
+}
+
+func (m *failoverModel) GenerateObject(ctx context.Context, call fantasy.ObjectCall) (*fantasy.ObjectResponse, error) {
+	return m.active().Model.GenerateObject(ctx, call)
+}
+
+func (m *failoverModel) StreamObject(ctx context.Context, call fantasy.ObjectCall) (fantasy.ObjectStreamResponse, error) {
+	return m.active().Model.StreamObject(ctx, call)
+}
+
+func (m *failoverModel) Stream(ctx context.Context, call fantasy.Call) (fantasy.StreamResponse, error) {
+	for {
+		stream, err := m.streamWithRetries(ctx, m.chain[m.current], call)
+		if err == nil {
+			return stream, nil
+		}
+		if ctx.Err() != nil || isCancelledErr(err) || m.current == len(m.chain)-1 {
+			return nil, err
+		}
+		from := m.active()
+		m.current++
+		to := m.active()
+		slog.Warn("Model failed, failing over",
+			"from_provider", from.ModelCfg.Provider, "from_model", from.ModelCfg.Model,
+			"to_provider", to.ModelCfg.Provider, "to_model", to.ModelCfg.Model, "error", err)
+		if m.onSwitch != nil {
+			m.onSwitch(from, to, err)
+		}
+	}
+}
+
+// streamWithRetries opens a stream of a model, retrying on transient errors.
+func (m *failoverModel) streamWithRetries(ctx context.Context, target FallbackModel, call fantasy.Call) (fantasy.StreamResponse, error) {
+	call = target.apply(call)
+	delay := m.policy.InitialDelay
+	for attempt := 0; ; attempt++ {
+		stream, err := openStream(ctx, target.Model.Model, call)
+		if err == nil {
+			return stream, nil
+		}
+		if attempt >= m.policy.MaxRetries || ctx.Err() != nil || !isRetryableError(err) {
+			return nil, err
+		}
+		wait := retryDelay(err, delay)
+		slog.Warn("Model request failed, retrying", "provider", target.Model.ModelCfg.Provider, "model", target.Model.ModelCfg.Model, "attempt", attempt+1, "delay", wait, "error", err)
+		if m.onRetry != nil {
+			m.onRetry(err, wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// openStream starts a stream and waits for its first part. The providers
+// report most failures, e.g. rate limits, as the first part of the stream
+// rather than as an error, those are returned as errors so that the request
+// can be retried before anything reached the turn. Warnings sent before the
+// first part are replayed. Each request is traced until its stream ends.
+func openStream(ctx context.Context, model fantasy.LanguageModel, call fantasy.Call) (_ fantasy.StreamResponse, err error) {
+	ctx, span := tracing.Start(ctx, "provider.stream",
+		attribute.String("provider", model.Provider()),
+		attribute.String("model", model.Model()),
+	)
+	defer func() {
+		if err != nil {
+			tracing.End(span, err)
+		}
+	}()
+	stream, err := model.Stream(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+	next, stop := iter.Pull(stream)
+	var head []fantasy.StreamPart
+	for {
+		part, ok := next()
+		if !ok {
+			break
+		}
+		if part.Type == fantasy.StreamPartTypeError {
+			stop()
+			if part.Error == nil {
+				return nil, errors.New("provider stream failed")
+			}
+			return nil, part.Error
+		}
+		head = append(head, part)
+		if part.Type != fantasy.StreamPartTypeWarnings {
+			break
+		}
+	}
+	span.AddEvent("first part")
+	return func(yield func(fantasy.StreamPart) bool) {
+		var streamErr error
+		defer func() {
+			stop()
+			tracing.End(span, streamErr)
+		}()
+		for _, part := range head {
+			if !yield(part) {
+				return
+			}
+		}
+		for {
+			part, ok := next()
+			if !ok {
+				return
+			}
+			switch part.Type {
+			case fantasy.StreamPartTypeError:
+				streamErr = part.Error
+			case fantasy.StreamPartTypeFinish:
+				span.SetAttributes(
+					attribute.String("finish_reason", string(part.FinishReason)),
+					attribute.Int64("usage.input_tokens", part.Usage.InputTokens),
+					attribute.Int64("usage.output_tokens", part.Usage.OutputTokens),
+				)
+			}
+			if !yield(part) {
+				return
+			}
+		}
+	}, nil
+}
+
+// isRetryableError reports whether a request may succeed when sent again:
+// timeouts, rate limits, server errors, overloaded providers and network
+// failures.
+func isRetryableError(err error) bool {
+	var providerErr *fantasy.ProviderError
+	if errors.As(err, &providerErr) {
+		switch providerErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests,
+			http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout, 529: // Anthropic overloaded_error
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryDelay returns the delay asked by the provider in its Retry-After
+// headers, or the backoff delay.
+func retryDelay(err error, backoff time.Duration) time.Duration {
+	var providerErr *fantasy.ProviderError
+	if !errors.As(err, &providerErr) {
+		return backoff
+	}
+	var delay time.Duration
+	for name, value := range providerErr.ResponseHeaders {
+		switch strings.ToLower(name) {
+		case "retry-after-ms":
+			if ms, err := strconv.ParseFloat(value, 64); err == nil {
+				delay = time.Duration(ms * float64(time.Millisecond))
+			}
+		case "retry-after":
+			if delay != 0 {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				delay = time.Duration(seconds * float64(time.Second))
+			} else if at, err := http.ParseTime(value); err == nil {
+				delay = time.Until(at)
+			}
+		}
+	}
+	if delay <= 0 {
+		return backoff
+	}
+	return min(delay, maxRetryDelay)
+}
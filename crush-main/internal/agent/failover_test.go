@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedModel fails its first streams with the scripted errors, as the
+// providers do in the first part of the stream, then answers.
+type scriptedModel struct {
+	fantasy.LanguageModel
+	errs  []error
+	calls []fantasy.Call
+}
+
+func (m *scriptedModel) Provider() string { return "scripted" }
+func (m *scriptedModel) Model() string    { return "scripted" }
+
+func (m *scriptedModel) Stream(_ context.Context, call fantasy.Call) (fantasy.StreamResponse, error) {
+	m.calls = append(m.calls, call)
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return func(yield func(fantasy.StreamPart) bool) {
+			yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeError, Error: err})
+		}, nil
+	}
+	return func(yield func(fantasy.StreamPart) bool) {
+		if !yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeTextDelta, Delta: "hello"}) {
+			return
+		}
+		yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeFinish, FinishReason: fantasy.FinishReasonStop})
+	}, nil
+}
+
+func fallbackFor(model *scriptedModel, name string, maxTokens int64) FallbackModel {
+	return FallbackModel{
+		Model: Model{
+			Model:    model,
+			ModelCfg: config.SelectedModel{Provider: name, Model: name},
+		},
+		MaxOutputTokens: maxTokens,
+	}
+}
+
+func drain(t *testing.T, stream fantasy.StreamResponse) []fantasy.StreamPart {
+	t.Helper()
+	var parts []fantasy.StreamPart
+	for part := range stream {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+func TestFailoverModel_RetriesTransientErrors(t *testing.T) {
+	primary := &scriptedModel{errs: []error{
+		&fantasy.ProviderError{StatusCode: http.StatusTooManyRequests, ResponseHeaders: map[string]string{"Retry-After-Ms": "1"}},
+		&fantasy.ProviderError{StatusCode: 529},
+	}}
+	m := newFailoverModel([]FallbackModel{fallbackFor(primary, "primary", 100)}, FailoverPolicy{MaxRetries: 2, InitialDelay: time.Millisecond})
+	var delays []time.Duration
+	m.onRetry = func(_ error, delay time.Duration) { delays = append(delays, delay) }
+
+	stream, err := m.Stream(t.Context(), fantasy.Call{})
+	require.NoError(t, err)
+	parts := drain(t, stream)
+	require.Len(t, parts, 2)
+	assert.Equal(t, "hello", parts[0].Delta)
+	assert.Len(t, primary.calls, 3)
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, delays)
+}
+
+func TestFailoverModel_SwitchesModels(t *testing.T) {
+	primary := &scriptedModel{errs: []error{
+		&fantasy.ProviderError{StatusCode: http.StatusServiceUnavailable},
+		&fantasy.ProviderError{StatusCode: http.StatusServiceUnavailable},
+	}}
+	secondary := &scriptedModel{errs: []error{&fantasy.ProviderError{StatusCode: http.StatusUnauthorized}}}
+	tertiary := &scriptedModel{}
+	m := newFailoverModel([]FallbackModel{
+		fallbackFor(primary, "primary", 100),
+		fallbackFor(secondary, "secondary", 200),
+		fallbackFor(tertiary, "tertiary", 300),
+	}, FailoverPolicy{MaxRetries: 1, InitialDelay: time.Millisecond})
+	var switches []string
+	m.onSwitch = func(from, to Model, _ error) {
+		switches = append(switches, from.ModelCfg.Model+">"+to.ModelCfg.Model)
+	}
+
+	stream, err := m.Stream(t.Context(), fantasy.Call{})
+	require.NoError(t, err)
+	drain(t, stream)
+	assert.Len(t, primary.calls, 2, "the primary model is retried")
+	assert.Len(t, secondary.calls, 1, "errors that are not transient fail over at once")
+	require.Len(t, tertiary.calls, 1)
+	assert.Equal(t, int64(300), *tertiary.calls[0].MaxOutputTokens, "the options of the fallback are used")
+	assert.Equal(t, []string{"primary>secondary", "secondary>tertiary"}, switches)
+	assert.Equal(t, "tertiary", m.active().ModelCfg.Model)
+
+	// The turn sticks to the model it failed over to
+	stream, err = m.Stream(t.Context(), fantasy.Call{})
+	require.NoError(t, err)
+	drain(t, stream)
+	assert.Len(t, primary.calls, 2)
+	assert.Len(t, tertiary.calls, 2)
+}
+
+func TestFailoverModel_ReturnsLastError(t *testing.T) {
+	primary := &scriptedModel{errs: []error{errors.New("bad request")}}
+	m := newFailoverModel([]FallbackModel{fallbackFor(primary, "primary", 100)}, DefaultFailoverPolicy)
+
+	_, err := m.Stream(t.Context(), fantasy.Call{})
+	require.EqualError(t, err, "bad request")
+	assert.Len(t, primary.calls, 1, "errors that are not transient are not retried")
+}
+
+func TestRetryDelay(t *testing.T) {
+	backoff := 2 * time.Second
+	assert.Equal(t, backoff, retryDelay(errors.New("failed"), backoff))
+	assert.Equal(t, 3*time.Second, retryDelay(&fantasy.ProviderError{ResponseHeaders: map[string]string{"Retry-After": "3"}}, backoff))
+	assert.Equal(t, 250*time.Millisecond, retryDelay(&fantasy.ProviderError{ResponseHeaders: map[string]string{"retry-after-ms": "250", "retry-after": "1"}}, backoff))
+	assert.Equal(t, maxRetryDelay, retryDelay(&fantasy.ProviderError{ResponseHeaders: map[string]string{"Retry-After": "3600"}}, backoff))
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// GenerationCacheTTL is how long a title or a summary is kept, long enough
+// for the replays of a turn after a crash or a reconnect.
+const GenerationCacheTTL = 24 * time.Hour
+
+// GenerationCache stores the titles and summaries generated for a session,
+// keyed on the hash of the content they were generated from, so that
+// generating them again for the same content is not billed twice. Get
+// returns a nil value on a miss.
+type GenerationCache interface {
+	Get(ctx context.Context, sessionID, key string) ([]byte, error)
+	Set(ctx context.Context, sessionID, key string, value []byte, ttl time.Duration) error
+}
+
+// cachedGeneration is a cached title or summary.
+type cachedGeneration struct {
+	Text         string `json:"text"`
+	OutputTokens int64  `json:"output_tokens,omitempty"`
+}
+
+// generationCacheKey hashes what a generation depends on: its kind, the
+// model and the content sent to it. Content that cannot be marshalled is
+// not cached.
+func generationCacheKey(kind string, model Model, content ...any) (string, bool) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(kind + "\n" + model.Model.Provider() + "\n" + model.Model.Model() + "\n" + string(data)))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// cachedGeneration returns the generation cached under key, if any.
+func (a *sessionAgent) cachedGeneration(ctx context.Context, sessionID, key string) (cachedGeneration, bool) {
+	if a.generations == nil || key == "" {
+		return cachedGeneration{}, false
+	}
+	value, err := a.generations.Get(ctx, sessionID, key)
+	if err != nil {
+		slog.Warn("Failed to read generation cache", "session_id", sessionID, "error", err)
+		return cachedGeneration{}, false
+	}
+	var generation cachedGeneration
+	if value == nil || json.Unmarshal(value, &generation) != nil || generation.Text == "" {
+		return cachedGeneration{}, false
+	}
+	return generation, true
+}
+
+// cacheGeneration stores a generation under key.
+func (a *sessionAgent) cacheGeneration(ctx context.Context, sessionID, key string, generation cachedGeneration) {
+	if a.generations == nil || key == "" || generation.Text == "" {
+		return
+	}
+	data, err := json.Marshal(generation)
+	if err != nil {
+		return
+	}
+	if err := a.generations.Set(context.WithoutCancel(ctx), sessionID, key, data, GenerationCacheTTL); err != nil {
+		slog.Warn("Failed to write generation cache", "session_id", sessionID, "error", err)
+	}
+}
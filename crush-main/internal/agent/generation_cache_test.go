@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/stretchr/testify/require"
+)
+
+// namedModel only tells its provider and model.
+type namedModel struct {
+	fantasy.LanguageModel
+	provider, model string
+}
+
+func (m namedModel) Provider() string { return m.provider }
+func (m namedModel) Model() string    { return m.model }
+
+type memoryGenerationCache map[string][]byte
+
+func (c memoryGenerationCache) Get(_ context.Context, sessionID, key string) ([]byte, error) {
+	return c[sessionID+"/"+key], nil
+}
+
+func (c memoryGenerationCache) Set(_ context.Context, sessionID, key string, value []byte, _ time.Duration) error {
+	c[sessionID+"/"+key] = value
+	return nil
+}
+
+func TestGenerationCacheKey(t *testing.T) {
+	small := Model{Model: namedModel{provider: "openai", model: "gpt-4o-mini"}}
+	large := Model{Model: namedModel{provider: "openai", model: "gpt-4o"}}
+
+	key, ok := generationCacheKey("title", small, "", "fix the tests")
+	require.True(t, ok)
+	same, _ := generationCacheKey("title", small, "", "fix the tests")
+	require.Equal(t, key, same)
+
+	for _, other := range []func() (string, bool){
+		func() (string, bool) { return generationCacheKey("summary", small, "", "fix the tests") },
+		func() (string, bool) { return generationCacheKey("title", large, "", "fix the tests") },
+		func() (string, bool) { return generationCacheKey("title", small, "", "fix the build") },
+	} {
+		otherKey, _ := other()
+		require.NotEqual(t, key, otherKey)
+	}
+}
+
+func TestCachedGeneration(t *testing.T) {
+	ctx := t.Context()
+	a := &sessionAgent{}
+	a.cacheGeneration(ctx, "s1", "k", cachedGeneration{Text: "Fix the tests"})
+	_, ok := a.cachedGeneration(ctx, "s1", "k")
+	require.False(t, ok, "no cache configured")
+
+	a.generations = memoryGenerationCache{}
+	_, ok = a.cachedGeneration(ctx, "s1", "k")
+	require.False(t, ok)
+
+	a.cacheGeneration(ctx, "s1", "k", cachedGeneration{Text: "Fix the tests", OutputTokens: 4})
+	cached, ok := a.cachedGeneration(ctx, "s1", "k")
+	require.True(t, ok)
+	require.Equal(t, cachedGeneration{Text: "Fix the tests", OutputTokens: 4}, cached)
+
+	_, ok = a.cachedGeneration(ctx, "s2", "k")
+	require.False(t, ok, "entries are per session")
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// Defaults of the loop guard, see config.LoopGuard.
+const (
+	// defaultLoopGuardWindow is how many of the most recent tool calls are inspected.
+	defaultLoopGuardWindow = 10
+	// defaultLoopGuardNudgeAt is the number of identical calls after which the
+	// model is reminded that it is repeating itself.
+	defaultLoopGuardNudgeAt = 3
+	// defaultLoopGuardStopAt is the number of identical calls after which the
+	// turn is stopped with a loop_detected finish.
+	defaultLoopGuardStopAt = 5
+)
+
+const loopGuardNudge = `<system-reminder>
+You have called the %s tool with identical input %d times in your recent tool calls. Repeating the same call will not give a different result.
+Stop and reconsider: use what the previous results told you, try a different approach or different input, or explain to the user what is blocking you.
+</system-reminder>`
+
+// loopGuard detects the tool calls a turn keeps repeating with identical
+// input.
+type loopGuard struct {
+	window  int
+	nudgeAt int
+	stopAt  int
+}
+
+// newLoopGuard returns the loop guard configured by cfg, nil when it is
+// disabled.
+func newLoopGuard(cfg *config.LoopGuard) *loopGuard {
+	g := &loopGuard{
+		window:  defaultLoopGuardWindow,
+		nudgeAt: defaultLoopGuardNudgeAt,
+		stopAt:  defaultLoopGuardStopAt,
+	}
+	if cfg == nil {
+		return g
+	}
+	if cfg.Disabled {
+		return nil
+	}
+	if cfg.Window > 0 {
+		g.window = cfg.Window
+	}
+	if cfg.NudgeAt > 0 {
+		g.nudgeAt = cfg.NudgeAt
+	}
+	if cfg.StopAt > 0 {
+		g.stopAt = cfg.StopAt
+	}
+	// The repeats are counted in the window, a smaller one never stops the turn
+	g.window = max(g.window, g.stopAt)
+	return g
+}
+
+// nudge returns the repeated tool call and its count when the model should be
+// reminded that it repeats itself.
+func (g *loopGuard) nudge(steps []fantasy.StepResult) (fantasy.ToolCallContent, int, bool) {
+	if g == nil {
+		return fantasy.ToolCallContent{}, 0, false
+	}
+	tc, repeats := repeatedToolCall(steps, g.window)
+	return tc, repeats, repeats >= g.nudgeAt
+}
+
+// stop returns the repeated tool call and its count when the turn should be
+// stopped.
+func (g *loopGuard) stop(steps []fantasy.StepResult) (fantasy.ToolCallContent, int, bool) {
+	if g == nil {
+		return fantasy.ToolCallContent{}, 0, false
+	}
+	tc, repeats := repeatedToolCall(steps, g.window)
+	return tc, repeats, repeats >= g.stopAt
+}
+
+// toolCallSignature identifies a tool call by its name and normalized input.
+func toolCallSignature(name, input string) string {
+	// Normalize JSON so whitespace and key order do not hide a repeat.
+	var v any
+	if err := json.Unmarshal([]byte(input), &v); err == nil {
+		if normalized, err := json.Marshal(v); err == nil {
+			input = string(normalized)
+		}
+	}
+	sum := sha256.Sum256([]byte(name + "\x00" + input))
+	return hex.EncodeToString(sum[:])
+}
+
+// repeatedToolCall returns the most recent tool call and how many times the
+// same call appears among the last window tool calls of the turn.
+func repeatedToolCall(steps []fantasy.StepResult, window int) (fantasy.ToolCallContent, int) {
+	var calls []fantasy.ToolCallContent
+	for _, step := range steps {
+		calls = append(calls, step.Content.ToolCalls()...)
+	}
+	if len(calls) == 0 {
+		return fantasy.ToolCallContent{}, 0
+	}
+	if len(calls) > window {
+		calls = calls[len(calls)-window:]
+	}
+
+	last := calls[len(calls)-1]
+	lastSignature := toolCallSignature(last.ToolName, last.Input)
+	count := 0
+	for _, tc := range calls {
+		if toolCallSignature(tc.ToolName, tc.Input) == lastSignature {
+			count++
+		}
+	}
+	return last, count
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+// toolCallSteps returns one step per tool call, each given as name and input.
+func toolCallSteps(calls ...[2]string) []fantasy.StepResult {
+	steps := make([]fantasy.StepResult, len(calls))
+	for i, call := range calls {
+		steps[i].Content = fantasy.ResponseContent{fantasy.ToolCallContent{ToolName: call[0], Input: call[1]}}
+	}
+	return steps
+}
+
+func TestRepeatedToolCall(t *testing.T) {
+	t.Parallel()
+
+	view := [2]string{"view", `{"file_path":"a.go"}`}
+	for name, tc := range map[string]struct {
+		steps   []fantasy.StepResult
+		window  int
+		tool    string
+		repeats int
+	}{
+		"no tool calls":   {nil, 10, "", 0},
+		"single call":     {toolCallSteps(view), 10, "view", 1},
+		"identical calls": {toolCallSteps(view, view, view), 10, "view", 3},
+		"reordered keys and whitespace": {toolCallSteps(
+			[2]string{"edit", `{"a":1,"b":2}`},
+			[2]string{"edit", `{ "b": 2, "a": 1 }`},
+		), 10, "edit", 2},
+		"different input":           {toolCallSteps(view, [2]string{"view", `{"file_path":"b.go"}`}), 10, "view", 1},
+		"different tool":            {toolCallSteps(view, [2]string{"ls", `{"file_path":"a.go"}`}), 10, "ls", 1},
+		"only the last call counts": {toolCallSteps(view, view, [2]string{"ls", `{}`}), 10, "ls", 1},
+		"calls out of the window":   {toolCallSteps(view, view, view, [2]string{"ls", `{}`}, view), 3, "view", 2},
+		"interleaved calls":         {toolCallSteps(view, [2]string{"ls", `{}`}, view, [2]string{"ls", `{}`}, view), 10, "view", 3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			call, repeats := repeatedToolCall(tc.steps, tc.window)
+			require.Equal(t, tc.tool, call.ToolName)
+			require.Equal(t, tc.repeats, repeats)
+		})
+	}
+}
+
+func TestLoopGuard(t *testing.T) {
+	t.Parallel()
+
+	view := [2]string{"view", `{"file_path":"a.go"}`}
+	repeat := func(n int) []fantasy.StepResult {
+		calls := make([][2]string, n)
+		for i := range calls {
+			calls[i] = view
+		}
+		return toolCallSteps(calls...)
+	}
+	for name, tc := range map[string]struct {
+		cfg     *config.LoopGuard
+		repeats int
+		nudge   bool
+		stop    bool
+	}{
+		"defaults below the nudge": {nil, 2, false, false},
+		"defaults nudge":           {nil, 3, true, false},
+		"defaults stop":            {nil, 5, true, true},
+		"zero values are defaults": {&config.LoopGuard{}, 5, true, true},
+		"disabled":                 {&config.LoopGuard{Disabled: true}, 20, false, false},
+		"lower thresholds":         {&config.LoopGuard{NudgeAt: 2, StopAt: 3}, 3, true, true},
+		"higher stop":              {&config.LoopGuard{StopAt: 8}, 7, true, false},
+		"higher stop reached":      {&config.LoopGuard{StopAt: 8}, 8, true, true},
+		"window below the stop":    {&config.LoopGuard{Window: 2, StopAt: 4}, 4, true, true},
+		"nudge at the stop":        {&config.LoopGuard{NudgeAt: 6, StopAt: 6}, 5, false, false},
+		"wider window":             {&config.LoopGuard{Window: 20, StopAt: 12}, 11, true, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := newLoopGuard(tc.cfg)
+			steps := repeat(tc.repeats)
+			_, _, nudge := g.nudge(steps)
+			require.Equal(t, tc.nudge, nudge)
+			_, repeats, stop := g.stop(steps)
+			require.Equal(t, tc.stop, stop)
+			if stop {
+				require.Equal(t, tc.repeats, repeats)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithModelOverride(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Models: map[config.SelectedModelType]config.SelectedModel{
+		config.SelectedModelTypeLarge: {Provider: "openai", Model: "gpt-4o"},
+		config.SelectedModelTypeSmall: {Provider: "openai", Model: "gpt-4o-mini"},
+	}}
+	require.Same(t, cfg, withModelOverride(cfg, nil))
+
+	temperature := 0.5
+	overridden := withModelOverride(cfg, &config.ModelOverride{Model: "o3", Temperature: &temperature})
+	require.Equal(t, "o3", overridden.Models[config.SelectedModelTypeLarge].Model)
+	require.Equal(t, 0.5, *overridden.Models[config.SelectedModelTypeLarge].Temperature)
+	require.Equal(t, "gpt-4o-mini", overridden.Models[config.SelectedModelTypeSmall].Model)
+	require.Equal(t, "gpt-4o", cfg.Models[config.SelectedModelTypeLarge].Model, "the shared config is not changed")
+}
@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// Moderation actions taken when a policy matches assistant text.
+const (
+	ModerationRedact = "redact"
+	ModerationHalt   = "halt"
+	ModerationFlag   = "flag"
+)
+
+// moderationHoldBack is how much streamed text is held back before it is
+// sent, so a match split across deltas is seen whole. Longer matches can
+// leak their start.
+const moderationHoldBack = 128
+
+// builtinModerationPatterns are the patterns of the built-in policies.
+var builtinModerationPatterns = map[string][]string{
+	"pii": {
+		// Emails, mainland China mobiles and North American phone numbers
+		`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+		`\b1[3-9]\d{9}\b`,
+		`\(?\b\d{3}\)?[-.\s]\d{3}[-.\s]\d{4}\b`,
+		// Resident IDs, SSNs and card numbers
+		`\b\d{17}[\dXx]\b`,
+		`\b\d{3}-\d{2}-\d{4}\b`,
+		`\b(?:4\d{3}|5[1-5]\d{2}|3[47]\d{2}|6(?:011|5\d{2}))[ -]?\d{4}[ -]?\d{4}[ -]?\d{1,4}\b`,
+	},
+	"credentials": {
+		// AWS, OpenAI/Anthropic, GitHub, Slack and Google keys and tokens
+		`\bAKIA[0-9A-Z]{16}\b`,
+		`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}`,
+		`\bgh[pousr]_[A-Za-z0-9]{36,}`,
+		`\bxox[abposr]-[A-Za-z0-9-]{10,}`,
+		`\bAIza[0-9A-Za-z_-]{35}`,
+		// PEM private keys and JWTs
+		`-----BEGIN [A-Z ]*PRIVATE KEY-----`,
+		`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`,
+	},
+}
+
+// ModerationHaltError stops a turn whose text matched a halting policy.
+type ModerationHaltError struct {
+	Policy string
+}
+
+func (e *ModerationHaltError) Error() string {
+	return fmt.Sprintf("the response was stopped by the %s moderation policy", e.Policy)
+}
+
+type moderationRule struct {
+	policy string
+	action string
+	re     *regexp.Regexp
+}
+
+// OutputModerator scans assistant text streamed to users against the
+// configured moderation policies.
+type OutputModerator struct {
+	rules []moderationRule
+}
+
+// NewOutputModerator compiles the moderation policies, it returns nil when
+// moderation is disabled.
+func NewOutputModerator(cfg config.ModerationConfig) (*OutputModerator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	m := &OutputModerator{}
+	for _, policy := range cfg.Policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("moderation policy without a name")
+		}
+		action := cmp.Or(policy.Action, ModerationFlag)
+		switch action {
+		case ModerationRedact, ModerationHalt, ModerationFlag:
+		default:
+			return nil, fmt.Errorf("moderation policy %s: unknown action %q", policy.Name, policy.Action)
+		}
+		patterns := slices.Concat(builtinModerationPatterns[policy.Name], policy.Patterns)
+		if len(patterns) == 0 {
+			return nil, fmt.Errorf("moderation policy %s has no patterns", policy.Name)
+		}
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("moderation policy %s: invalid pattern %q: %w", policy.Name, pattern, err)
+			}
+			m.rules = append(m.rules, moderationRule{policy: policy.Name, action: action, re: re})
+		}
+	}
+	if len(m.rules) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// moderationHit counts the matches of a policy.
+type moderationHit struct {
+	Policy  string `json:"policy"`
+	Action  string `json:"action"`
+	Matches int    `json:"matches"`
+}
+
+// moderationStream moderates one stream of text. Its methods pass text
+// through when moderation is disabled.
+type moderationStream struct {
+	rules   []moderationRule
+	pending string
+	hits    []moderationHit
+}
+
+func (m *OutputModerator) stream() *moderationStream {
+	if m == nil {
+		return nil
+	}
+	return &moderationStream{rules: m.rules}
+}
+
+// write adds streamed text and returns the text that is safe to send.
+func (s *moderationStream) write(text string) (string, error) {
+	if s == nil {
+		return text, nil
+	}
+	s.pending += text
+	return s.scan(false)
+}
+
+// flush returns the text held back once the stream ends.
+func (s *moderationStream) flush() (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	return s.scan(true)
+}
+
+// scan acts on the matches in the pending text, in order, and releases the
+// text before the held back tail. A match reaching into the tail waits for
+// more text, it may still grow.
+func (s *moderationStream) scan(final bool) (string, error) {
+	limit := len(s.pending)
+	if !final {
+		limit = max(len(s.pending)-moderationHoldBack, 0)
+	}
+
+	var out string
+	for {
+		rule, loc := s.firstMatch()
+		if loc == nil || (!final && loc[1] > limit) {
+			cut := limit
+			if loc != nil {
+				cut = min(cut, loc[0])
+			}
+			for cut > 0 && cut < len(s.pending) && !utf8.RuneStart(s.pending[cut]) {
+				cut--
+			}
+			out += s.pending[:cut]
+			s.pending = s.pending[cut:]
+			return out, nil
+		}
+
+		s.addHit(rule)
+		switch rule.action {
+		case ModerationHalt:
+			out += s.pending[:loc[0]]
+			s.pending = ""
+			return out, &ModerationHaltError{Policy: rule.policy}
+		case ModerationRedact:
+			out += s.pending[:loc[0]] + "[REDACTED:" + rule.policy + "]"
+		default:
+			out += s.pending[:loc[1]]
+		}
+		s.pending = s.pending[loc[1]:]
+		limit -= loc[1]
+	}
+}
+
+// firstMatch returns the earliest, then longest, match in the pending text.
+func (s *moderationStream) firstMatch() (moderationRule, []int) {
+	var best moderationRule
+	var bestLoc []int
+	for _, rule := range s.rules {
+		loc := rule.re.FindStringIndex(s.pending)
+		if loc == nil || loc[0] == loc[1] {
+			continue
+		}
+		if bestLoc == nil || loc[0] < bestLoc[0] || (loc[0] == bestLoc[0] && loc[1] > bestLoc[1]) {
+			best, bestLoc = rule, loc
+		}
+	}
+	return best, bestLoc
+}
+
+func (s *moderationStream) addHit(rule moderationRule) {
+	for i, hit := range s.hits {
+		if hit.Policy == rule.policy && hit.Action == rule.action {
+			s.hits[i].Matches++
+			return
+		}
+	}
+	s.hits = append(s.hits, moderationHit{Policy: rule.policy, Action: rule.action, Matches: 1})
+}
+
+// takeHits returns the matches since the last call.
+func (s *moderationStream) takeHits() []moderationHit {
+	if s == nil {
+		return nil
+	}
+	hits := s.hits
+	s.hits = nil
+	return hits
+}
+
+// recordModeration writes the moderation hits of a message to the audit log.
+func (a *sessionAgent) recordModeration(sessionID, messageID string, hits []moderationHit) {
+	for _, hit := range hits {
+		slog.Warn("Assistant text moderated",
+			"session_id", sessionID,
+			"message_id", messageID,
+			"policy", hit.Policy,
+			"action", hit.Action,
+			"matches", hit.Matches,
+		)
+		if a.dbQuerier == nil {
+			continue
+		}
+		detail, err := json.Marshal(hit)
+		if err != nil {
+			continue
+		}
+		if err := a.dbQuerier.CreateAuditEvent(context.Background(), postgres.CreateAuditEventParams{
+			ID:        uuid.New().String(),
+			SessionID: sql.NullString{String: sessionID, Valid: true},
+			MessageID: sql.NullString{String: messageID, Valid: messageID != ""},
+			Category:  "moderation",
+			Action:    hit.Action,
+			Detail:    string(detail),
+		}); err != nil {
+			slog.Warn("Failed to record moderation event", "session_id", sessionID, "error", err)
+		}
+	}
+}
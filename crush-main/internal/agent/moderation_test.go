@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestModerator(t *testing.T, policies ...config.ModerationPolicy) *OutputModerator {
+	t.Helper()
+	m, err := NewOutputModerator(config.ModerationConfig{Enabled: true, Policies: policies})
+	require.NoError(t, err)
+	return m
+}
+
+// streamAll writes the chunks to a stream and returns everything released.
+func streamAll(s *moderationStream, chunks ...string) (string, error) {
+	var out strings.Builder
+	for _, chunk := range chunks {
+		text, err := s.write(chunk)
+		out.WriteString(text)
+		if err != nil {
+			return out.String(), err
+		}
+	}
+	text, err := s.flush()
+	out.WriteString(text)
+	return out.String(), err
+}
+
+func TestNewOutputModerator(t *testing.T) {
+	m, err := NewOutputModerator(config.ModerationConfig{Policies: []config.ModerationPolicy{{Name: "pii"}}})
+	require.NoError(t, err)
+	require.Nil(t, m, "disabled moderation")
+
+	_, err = NewOutputModerator(config.ModerationConfig{Enabled: true, Policies: []config.ModerationPolicy{{Name: "prohibited"}}})
+	require.ErrorContains(t, err, "has no patterns")
+
+	_, err = NewOutputModerator(config.ModerationConfig{Enabled: true, Policies: []config.ModerationPolicy{{Name: "pii", Action: "block"}}})
+	require.ErrorContains(t, err, "unknown action")
+
+	_, err = NewOutputModerator(config.ModerationConfig{Enabled: true, Policies: []config.ModerationPolicy{{Name: "x", Patterns: []string{"("}}}})
+	require.ErrorContains(t, err, "invalid pattern")
+}
+
+func TestModerationRedactsAcrossDeltas(t *testing.T) {
+	m := newTestModerator(t, config.ModerationPolicy{Name: "credentials", Action: ModerationRedact})
+	s := m.stream()
+
+	key := "sk-proj-abcdefghijklmnopqrstuvwxyz0123456789"
+	// The key is split over deltas, none of them matches alone
+	first, err := s.write("Use the key sk-pr")
+	require.NoError(t, err)
+	require.NotContains(t, first, "sk-pr")
+
+	out, err := streamAll(s, key[5:20], key[20:], " to call the API.")
+	require.NoError(t, err)
+	require.Equal(t, "Use the key [REDACTED:credentials] to call the API.", first+out)
+	require.Equal(t, []moderationHit{{Policy: "credentials", Action: ModerationRedact, Matches: 1}}, s.takeHits())
+	require.Empty(t, s.takeHits())
+}
+
+func TestModerationReleasesTextBeyondHoldBack(t *testing.T) {
+	m := newTestModerator(t, config.ModerationPolicy{Name: "pii", Action: ModerationRedact})
+	s := m.stream()
+
+	long := strings.Repeat("a", 3*moderationHoldBack)
+	out, err := s.write(long)
+	require.NoError(t, err)
+	require.Len(t, out, 2*moderationHoldBack)
+
+	rest, err := s.flush()
+	require.NoError(t, err)
+	require.Equal(t, long, out+rest)
+}
+
+func TestModerationFlagKeepsText(t *testing.T) {
+	m := newTestModerator(t, config.ModerationPolicy{Name: "pii"})
+	s := m.stream()
+
+	text := "Contact me at jane@example.com or jane@example.org."
+	out, err := streamAll(s, text)
+	require.NoError(t, err)
+	require.Equal(t, text, out)
+	require.Equal(t, []moderationHit{{Policy: "pii", Action: ModerationFlag, Matches: 2}}, s.takeHits())
+}
+
+func TestModerationHaltStopsBeforeMatch(t *testing.T) {
+	m := newTestModerator(t,
+		config.ModerationPolicy{Name: "pii", Action: ModerationRedact},
+		config.ModerationPolicy{Name: "prohibited", Action: ModerationHalt, Patterns: []string{`(?i)\bforbidden\b`}},
+	)
+	s := m.stream()
+
+	out, err := streamAll(s, "Mail a@b.io about the ", "FORBIDDEN", " plan and more")
+	var haltErr *ModerationHaltError
+	require.True(t, errors.As(err, &haltErr))
+	require.Equal(t, "prohibited", haltErr.Policy)
+	require.Equal(t, "Mail [REDACTED:pii] about the ", out)
+	require.Equal(t, []moderationHit{
+		{Policy: "pii", Action: ModerationRedact, Matches: 1},
+		{Policy: "prohibited", Action: ModerationHalt, Matches: 1},
+	}, s.takeHits())
+}
+
+func TestModerationDisabledPassesThrough(t *testing.T) {
+	var m *OutputModerator
+	s := m.stream()
+	out, err := streamAll(s, "sk-proj-abcdefghijklmnopqrstuvwxyz")
+	require.NoError(t, err)
+	require.Equal(t, "sk-proj-abcdefghijklmnopqrstuvwxyz", out)
+	require.Nil(t, s.takeHits())
+}
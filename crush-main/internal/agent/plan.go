@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"slices"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+)
+
+// planModeTools are the tools given to the model in plan mode, none of them
+// changes the workspace.
+var planModeTools = []string{
+	tools.ViewToolName,
+	tools.GrepToolName,
+	tools.GlobToolName,
+	tools.CodeSearchToolName,
+	tools.LSToolName,
+	tools.FetchToolName,
+	tools.DiagnosticsToolName,
+}
+
+const planModeInstructions = `<plan_mode>
+You are in plan mode: the user wants to review what you intend to change before anything is changed.
+Only read-only tools are available. Do not try to edit files, run commands or otherwise change the workspace.
+Explore the code as needed, then answer with a plan: the files you would change or create, what you would change in each and why, the commands you would run, and any open questions or risks.
+</plan_mode>`
+
+// readOnlyTools returns the tools of a turn available in plan mode.
+func readOnlyTools(agentTools []fantasy.AgentTool) []fantasy.AgentTool {
+	return slices.DeleteFunc(agentTools, func(tool fantasy.AgentTool) bool {
+		return !slices.Contains(planModeTools, tool.Info().Name)
+	})
+}
+
+// withPlanMode adds the plan mode instructions after the system prompt.
+func withPlanMode(systemPrompt string) string {
+	return systemPrompt + "\n\n" + planModeInstructions
+}
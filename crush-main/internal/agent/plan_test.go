@@ -0,0 +1,34 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/stretchr/testify/require"
+)
+
+func namedTool(name string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(name, "", func(context.Context, struct{}, fantasy.ToolCall) (fantasy.ToolResponse, error) {
+		return fantasy.ToolResponse{}, nil
+	})
+}
+
+func TestReadOnlyTools(t *testing.T) {
+	t.Parallel()
+
+	agentTools := []fantasy.AgentTool{
+		namedTool("bash"),
+		namedTool("view"),
+		namedTool("edit"),
+		namedTool("grep"),
+		namedTool("write"),
+		namedTool("lsp_diagnostics"),
+		namedTool("mcp_custom"),
+	}
+	var names []string
+	for _, tool := range readOnlyTools(agentTools) {
+		names = append(names, tool.Info().Name)
+	}
+	require.Equal(t, []string{"view", "grep", "lsp_diagnostics"}, names)
+}
@@ -17,13 +17,80 @@ var (
 	ErrPoolFull = errors.New("agent worker pool is full, please try again later")
 	// ErrPoolShutdown is returned when submitting to a shutdown pool
 	ErrPoolShutdown = errors.New("agent worker pool is shutting down")
+	// ErrTaskPreempted is returned when a background task is cancelled to make room for interactive work
+	// and cannot be requeued
+	ErrTaskPreempted = errors.New("agent task preempted by interactive work")
 )
 
+// defaultTaskDuration estimates how long a task runs until the pool has
+// completed some, to estimate queue waits.
+const defaultTaskDuration = 30 * time.Second
+
+// CapacityError is returned by Submit when the queue of the task is full. It
+// tells clients how loaded the pool is and when to retry, and matches
+// ErrPoolFull with errors.Is.
+type CapacityError struct {
+	Priority      TaskPriority
+	QueueDepth    int
+	QueueSize     int
+	ActiveWorkers int64
+	MaxWorkers    int
+	// EstimatedWait is how long a task submitted now would wait for a worker.
+	EstimatedWait time.Duration
+	// RetryAfter is how long until a queue slot is expected to free up.
+	RetryAfter time.Duration
+}
+
+func (e *CapacityError) Error() string {
+	return ErrPoolFull.Error()
+}
+
+func (e *CapacityError) Unwrap() error {
+	return ErrPoolFull
+}
+
+// TaskPriority is the scheduling class of an agent task.
+type TaskPriority int
+
+const (
+	// PriorityInteractive is used for prompts sent by a user who is waiting for the answer.
+	// It is the zero value so existing callers keep their behavior.
+	PriorityInteractive TaskPriority = iota
+	// PriorityBackground is used for scheduled jobs, batch runs and autonomous turns.
+	// Background tasks run on a capped number of workers and may be preempted, the
+	// preempted tasks run again before the other background tasks.
+	PriorityBackground
+)
+
+// String returns the lane name used in logs and callbacks.
+func (p TaskPriority) String() string {
+	switch p {
+	case PriorityBackground:
+		return "background"
+	default:
+		return "interactive"
+	}
+}
+
 // AgentTask represents a task to be executed by the worker pool
 type AgentTask struct {
 	SessionID   string
 	Prompt      string
 	Attachments []message.Attachment
+	// Agent is the name of the agent running the prompt; defaults to the coder
+	Agent string
+	// Priority selects the queue lane; defaults to PriorityInteractive
+	Priority TaskPriority
+	// WorkingDir overrides the project working directory for the task
+	WorkingDir string
+	// PlanMode runs the task with read-only tools, the agent answers with a plan
+	PlanMode bool
+	// ResumeToolCall is a suspended tool call the user granted, run before the prompt
+	ResumeToolCall string
+	// BusyPolicy overrides the busy policy of the session for the task
+	BusyPolicy config.BusyPolicy
+	// ModelOverride changes the large model of the session for the task
+	ModelOverride *config.ModelOverride
 	// ResultChan receives the result or error when task completes
 	ResultChan chan AgentTaskResult
 	// CreatedAt is when the task was created
@@ -37,11 +104,14 @@ type AgentTaskResult struct {
 
 // PoolStats holds statistics about the worker pool
 type PoolStats struct {
-	ActiveWorkers  int64
-	QueuedTasks    int
-	TotalTasks     int64
-	CompletedTasks int64
-	FailedTasks    int64
+	ActiveWorkers           int64
+	ActiveBackgroundWorkers int64
+	QueuedTasks             int
+	QueuedBackgroundTasks   int
+	TotalTasks              int64
+	CompletedTasks          int64
+	FailedTasks             int64
+	PreemptedTasks          int64
 }
 
 // AgentWorkerPool manages a pool of workers for executing agent tasks
@@ -54,13 +124,17 @@ type AgentWorkerPool interface {
 	Stats() PoolStats
 	// IsShutdown returns true if the pool is shutting down or shut down
 	IsShutdown() bool
+	// EstimateWait returns how long a task of the given priority is expected
+	// to wait for a worker with ahead tasks queued before it.
+	EstimateWait(priority TaskPriority, ahead int) time.Duration
 }
 
 // TaskExecutor is the function type for executing agent tasks
 type TaskExecutor func(ctx context.Context, task AgentTask) error
 
 // TaskLifecycleCallback is called when task starts or completes
-// For OnComplete: err is the error from task execution (nil if success), reason is "completed", "error", "timeout", "cancelled", "shutdown"
+// For OnComplete: err is the error from task execution (nil if success), reason is "completed", "error", "timeout", "cancelled", "preempted", "requeued", "shutdown"
+// A "requeued" task was preempted and starts again later, its result is sent once it runs to the end
 type TaskLifecycleCallback func(sessionID string, err error, reason string)
 
 // agentWorkerPool implements AgentWorkerPool
@@ -72,17 +146,30 @@ type agentWorkerPool struct {
 	onTaskStart    TaskLifecycleCallback // Called when worker starts executing a task
 	onTaskComplete TaskLifecycleCallback // Called when worker finishes executing a task
 
-	// Task queue - buffered channel
-	taskQueue chan AgentTask
+	// Task queues - one buffered channel per priority lane
+	taskQueue       chan AgentTask
+	backgroundQueue chan AgentTask
+	// Preempted background tasks, dispatched before the background lane
+	requeuedQueue chan AgentTask
 
 	// Semaphore for worker count control
 	workerSem chan struct{}
+	// Semaphore capping how many workers background tasks may occupy
+	backgroundSem chan struct{}
+
+	// Running background tasks that can be preempted, keyed by worker ID
+	backgroundMu      sync.Mutex
+	backgroundRunning map[int64]*backgroundRun
 
 	// Statistics
-	activeWorkers  atomic.Int64
-	totalTasks     atomic.Int64
-	completedTasks atomic.Int64
-	failedTasks    atomic.Int64
+	activeWorkers           atomic.Int64
+	activeBackgroundWorkers atomic.Int64
+	totalTasks              atomic.Int64
+	completedTasks          atomic.Int64
+	failedTasks             atomic.Int64
+	preemptedTasks          atomic.Int64
+	// avgTaskDuration is the moving average of task durations in nanoseconds
+	avgTaskDuration atomic.Int64
 
 	// Shutdown control
 	shutdownOnce sync.Once
@@ -96,6 +183,14 @@ type agentWorkerPool struct {
 	workerIDCounter atomic.Int64
 }
 
+// backgroundRun tracks a running background task so it can be preempted
+type backgroundRun struct {
+	sessionID string
+	startedAt time.Time
+	cancel    context.CancelCauseFunc
+	preempted bool
+}
+
 // NewAgentWorkerPool creates a new agent worker pool
 // onTaskStart is called when a worker starts executing a task (can be nil)
 // onTaskComplete is called when a worker finishes executing a task (can be nil)
@@ -106,15 +201,25 @@ func NewAgentWorkerPool(cfg *config.AgentConfig, executor TaskExecutor, onTaskSt
 	if cfg.TaskQueueSize <= 0 {
 		cfg.TaskQueueSize = 1000 // default
 	}
+	if cfg.MaxBackgroundWorkers <= 0 || cfg.MaxBackgroundWorkers > cfg.MaxWorkers {
+		cfg.MaxBackgroundWorkers = max(cfg.MaxWorkers/2, 1) // default: half of the workers
+	}
+	if cfg.BackgroundQueueSize <= 0 {
+		cfg.BackgroundQueueSize = cfg.TaskQueueSize // default
+	}
 
 	pool := &agentWorkerPool{
-		cfg:            cfg,
-		executor:       executor,
-		onTaskStart:    onTaskStart,
-		onTaskComplete: onTaskComplete,
-		taskQueue:      make(chan AgentTask, cfg.TaskQueueSize),
-		workerSem:      make(chan struct{}, cfg.MaxWorkers),
-		shutdownCh:     make(chan struct{}),
+		cfg:               cfg,
+		executor:          executor,
+		onTaskStart:       onTaskStart,
+		onTaskComplete:    onTaskComplete,
+		taskQueue:         make(chan AgentTask, cfg.TaskQueueSize),
+		backgroundQueue:   make(chan AgentTask, cfg.BackgroundQueueSize),
+		requeuedQueue:     make(chan AgentTask, cfg.MaxBackgroundWorkers),
+		workerSem:         make(chan struct{}, cfg.MaxWorkers),
+		backgroundSem:     make(chan struct{}, cfg.MaxBackgroundWorkers),
+		backgroundRunning: make(map[int64]*backgroundRun),
+		shutdownCh:        make(chan struct{}),
 	}
 
 	// Start the dispatcher goroutine
@@ -123,6 +228,8 @@ func NewAgentWorkerPool(cfg *config.AgentConfig, executor TaskExecutor, onTaskSt
 	slog.Info("[GOROUTINE] Agent worker pool initialized",
 		"max_workers", cfg.MaxWorkers,
 		"queue_size", cfg.TaskQueueSize,
+		"max_background_workers", cfg.MaxBackgroundWorkers,
+		"background_queue_size", cfg.BackgroundQueueSize,
 		"permission_timeout_sec", cfg.PermissionTimeout,
 		"task_timeout_sec", cfg.TaskTimeout,
 	)
@@ -131,6 +238,7 @@ func NewAgentWorkerPool(cfg *config.AgentConfig, executor TaskExecutor, onTaskSt
 }
 
 // Submit submits a task to the pool
+// The task is placed on the lane matching task.Priority.
 func (p *agentWorkerPool) Submit(ctx context.Context, task AgentTask) error {
 	if p.isShutdown.Load() {
 		return ErrPoolShutdown
@@ -139,63 +247,275 @@ func (p *agentWorkerPool) Submit(ctx context.Context, task AgentTask) error {
 	task.CreatedAt = time.Now()
 	p.totalTasks.Add(1)
 
+	queue := p.taskQueue
+	queueSize := p.cfg.TaskQueueSize
+	if task.Priority == PriorityBackground {
+		queue = p.backgroundQueue
+		queueSize = p.cfg.BackgroundQueueSize
+	}
+
 	// Try to submit without blocking
 	select {
-	case p.taskQueue <- task:
+	case queue <- task:
 		slog.Info("[GOROUTINE] Task submitted to queue",
 			"session_id", task.SessionID,
-			"queue_size", len(p.taskQueue),
+			"priority", task.Priority,
+			"queue_size", len(queue),
 			"active_workers", p.activeWorkers.Load(),
 		)
 		return nil
 	default:
 		// Queue is full
 		p.failedTasks.Add(1)
+		capacityErr := p.capacityError(task.Priority, len(queue), queueSize)
 		slog.Warn("[GOROUTINE] Task rejected - queue full",
 			"session_id", task.SessionID,
-			"queue_size", len(p.taskQueue),
-			"max_queue_size", p.cfg.TaskQueueSize,
+			"priority", task.Priority,
+			"queue_size", len(queue),
+			"max_queue_size", queueSize,
+			"estimated_wait_ms", capacityErr.EstimatedWait.Milliseconds(),
 		)
-		return ErrPoolFull
+		return capacityErr
+	}
+}
+
+// capacityError describes the load of the pool when a task is rejected.
+func (p *agentWorkerPool) capacityError(priority TaskPriority, depth, size int) *CapacityError {
+	workers := p.cfg.MaxWorkers
+	if priority == PriorityBackground {
+		workers = p.cfg.MaxBackgroundWorkers
+	}
+	return &CapacityError{
+		Priority:      priority,
+		QueueDepth:    depth,
+		QueueSize:     size,
+		ActiveWorkers: p.activeWorkers.Load(),
+		MaxWorkers:    workers,
+		EstimatedWait: p.EstimateWait(priority, depth),
+		// A queue slot frees up whenever one of the workers finishes a task
+		RetryAfter: max(p.taskDuration()/time.Duration(workers), time.Second).Round(time.Second),
+	}
+}
+
+// EstimateWait returns how long a task is expected to wait for a worker with
+// ahead tasks queued before it, from the average duration of the tasks.
+func (p *agentWorkerPool) EstimateWait(priority TaskPriority, ahead int) time.Duration {
+	workers := p.cfg.MaxWorkers
+	if priority == PriorityBackground {
+		// Background tasks also wait for the interactive and requeued ones
+		workers = p.cfg.MaxBackgroundWorkers
+		ahead += len(p.taskQueue) + len(p.requeuedQueue)
+	}
+	if ahead == 0 && p.activeWorkers.Load() < int64(p.cfg.MaxWorkers) {
+		return 0
+	}
+	return p.taskDuration() * time.Duration(ahead+1) / time.Duration(workers)
+}
+
+// taskDuration returns the average duration of the tasks.
+func (p *agentWorkerPool) taskDuration() time.Duration {
+	if avg := p.avgTaskDuration.Load(); avg > 0 {
+		return time.Duration(avg)
+	}
+	return defaultTaskDuration
+}
+
+// recordTaskDuration adds a task duration to the moving average.
+func (p *agentWorkerPool) recordTaskDuration(d time.Duration) {
+	for {
+		old := p.avgTaskDuration.Load()
+		avg := int64(d)
+		if old > 0 {
+			avg = old + (int64(d)-old)/5
+		}
+		if p.avgTaskDuration.CompareAndSwap(old, avg) {
+			return
+		}
 	}
 }
 
-// dispatcher runs in a goroutine and dispatches tasks to workers
+// dispatcher runs in a goroutine and dispatches tasks to workers.
+// Interactive tasks are always taken before background tasks, and the
+// preempted background tasks before the other ones.
 func (p *agentWorkerPool) dispatcher() {
 	slog.Info("[GOROUTINE] Worker pool dispatcher started")
 
 	for {
+		// Drain the interactive lane first
 		select {
 		case <-p.shutdownCh:
 			slog.Info("[GOROUTINE] Worker pool dispatcher shutting down")
 			return
 		case task := <-p.taskQueue:
-			// Acquire worker slot (blocks if all workers are busy)
-			select {
-			case <-p.shutdownCh:
-				// Return task result with shutdown error
-				if task.ResultChan != nil {
-					task.ResultChan <- AgentTaskResult{Error: ErrPoolShutdown}
-				}
+			if !p.dispatchInteractive(task) {
+				return
+			}
+			continue
+		default:
+		}
+
+		// Then the preempted background tasks
+		select {
+		case task := <-p.requeuedQueue:
+			if !p.dispatchBackground(task) {
 				return
-			case p.workerSem <- struct{}{}:
-				// Got a worker slot, start worker goroutine
-				p.wg.Add(1)
-				workerID := p.workerIDCounter.Add(1)
-				go p.worker(workerID, task)
 			}
+			continue
+		default:
 		}
+
+		select {
+		case <-p.shutdownCh:
+			slog.Info("[GOROUTINE] Worker pool dispatcher shutting down")
+			return
+		case task := <-p.taskQueue:
+			if !p.dispatchInteractive(task) {
+				return
+			}
+		case task := <-p.requeuedQueue:
+			if !p.dispatchBackground(task) {
+				return
+			}
+		case task := <-p.backgroundQueue:
+			if !p.dispatchBackground(task) {
+				return
+			}
+		}
+	}
+}
+
+// dispatchInteractive acquires a worker slot for an interactive task and starts it.
+// If all workers are busy, one running background task is preempted to free a slot.
+// Returns false if the pool shut down while waiting.
+func (p *agentWorkerPool) dispatchInteractive(task AgentTask) bool {
+	select {
+	case p.workerSem <- struct{}{}:
+	default:
+		p.preemptBackground()
+		// Acquire worker slot (blocks until a worker finishes)
+		select {
+		case <-p.shutdownCh:
+			p.rejectOnShutdown(task)
+			return false
+		case p.workerSem <- struct{}{}:
+		}
+	}
+
+	p.startWorker(task)
+	return true
+}
+
+// dispatchBackground acquires a background slot and a worker slot for a background task and starts it.
+// Interactive tasks arriving while it waits are dispatched first.
+// Returns false if the pool shut down while waiting.
+func (p *agentWorkerPool) dispatchBackground(task AgentTask) bool {
+	for {
+		select {
+		case <-p.shutdownCh:
+			p.rejectOnShutdown(task)
+			return false
+		case interactive := <-p.taskQueue:
+			if !p.dispatchInteractive(interactive) {
+				p.rejectOnShutdown(task)
+				return false
+			}
+			continue
+		case p.backgroundSem <- struct{}{}:
+		}
+
+		select {
+		case <-p.shutdownCh:
+			<-p.backgroundSem
+			p.rejectOnShutdown(task)
+			return false
+		case interactive := <-p.taskQueue:
+			// Give the background slot back while the interactive task is placed
+			<-p.backgroundSem
+			if !p.dispatchInteractive(interactive) {
+				p.rejectOnShutdown(task)
+				return false
+			}
+			continue
+		case p.workerSem <- struct{}{}:
+		}
+
+		p.startWorker(task)
+		return true
 	}
 }
 
+// preemptBackground cancels the most recently started background task that
+// has not already been preempted, so that its worker slot can be reused. The
+// worker of the task requeues it.
+func (p *agentWorkerPool) preemptBackground() {
+	p.backgroundMu.Lock()
+	defer p.backgroundMu.Unlock()
+
+	var victimID int64
+	var victim *backgroundRun
+	for id, run := range p.backgroundRunning {
+		if run.preempted {
+			continue
+		}
+		if victim == nil || run.startedAt.After(victim.startedAt) {
+			victimID, victim = id, run
+		}
+	}
+	if victim == nil {
+		return
+	}
+
+	victim.preempted = true
+	victim.cancel(ErrTaskPreempted)
+	slog.Warn("[GOROUTINE] Preempting background task for interactive work",
+		"worker_id", victimID,
+		"session_id", victim.sessionID,
+		"running_ms", time.Since(victim.startedAt).Milliseconds(),
+	)
+}
+
+// requeue puts a preempted background task back ahead of the background lane.
+// It returns false when the pool is shutting down or too many preempted tasks
+// are waiting.
+func (p *agentWorkerPool) requeue(task AgentTask) bool {
+	if p.isShutdown.Load() {
+		return false
+	}
+	select {
+	case p.requeuedQueue <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// rejectOnShutdown returns a shutdown error to a task that never started
+func (p *agentWorkerPool) rejectOnShutdown(task AgentTask) {
+	if task.ResultChan != nil {
+		task.ResultChan <- AgentTaskResult{Error: ErrPoolShutdown}
+	}
+}
+
+// startWorker starts a worker goroutine for a task whose slots are already held
+func (p *agentWorkerPool) startWorker(task AgentTask) {
+	p.wg.Add(1)
+	workerID := p.workerIDCounter.Add(1)
+	go p.worker(workerID, task)
+}
+
 // worker executes a single task
 func (p *agentWorkerPool) worker(workerID int64, task AgentTask) {
 	startTime := time.Now()
 	p.activeWorkers.Add(1)
+	background := task.Priority == PriorityBackground
+	if background {
+		p.activeBackgroundWorkers.Add(1)
+	}
 
 	slog.Info("[GOROUTINE] 🚀 Agent worker started",
 		"worker_id", workerID,
 		"session_id", task.SessionID,
+		"priority", task.Priority,
 		"queue_wait_ms", startTime.Sub(task.CreatedAt).Milliseconds(),
 		"active_workers", p.activeWorkers.Load(),
 	)
@@ -206,7 +526,19 @@ func (p *agentWorkerPool) worker(workerID int64, task AgentTask) {
 	}
 
 	// Create context with task timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(p.cfg.TaskTimeout)*time.Second)
+	timeoutCtx, cancelTimeout := context.WithTimeout(context.Background(), time.Duration(p.cfg.TaskTimeout)*time.Second)
+	ctx, cancel := context.WithCancelCause(timeoutCtx)
+
+	// Register background tasks so interactive demand can preempt them
+	if background {
+		p.backgroundMu.Lock()
+		p.backgroundRunning[workerID] = &backgroundRun{
+			sessionID: task.SessionID,
+			startedAt: startTime,
+			cancel:    cancel,
+		}
+		p.backgroundMu.Unlock()
+	}
 
 	// Execute the task
 	var err error
@@ -220,30 +552,48 @@ func (p *agentWorkerPool) worker(workerID int64, task AgentTask) {
 	default:
 		err = p.executor(ctx, task)
 		if err != nil {
-			if errors.Is(err, context.DeadlineExceeded) {
+			if errors.Is(context.Cause(ctx), ErrTaskPreempted) {
+				err = ErrTaskPreempted
+				reason = "preempted"
+				p.preemptedTasks.Add(1)
+				if p.requeue(task) {
+					reason = "requeued"
+				}
+			} else if errors.Is(err, context.DeadlineExceeded) {
 				reason = "timeout"
 			} else if errors.Is(err, context.Canceled) {
 				reason = "cancelled"
 			} else {
 				reason = "error"
 			}
-			p.failedTasks.Add(1)
+			if reason != "requeued" {
+				p.failedTasks.Add(1)
+			}
 		} else {
 			reason = "completed"
 			p.completedTasks.Add(1)
 		}
+		if reason == "completed" || reason == "error" {
+			p.recordTaskDuration(time.Since(startTime))
+		}
 	}
 
 	// Cancel context
-	cancel()
+	if background {
+		p.backgroundMu.Lock()
+		delete(p.backgroundRunning, workerID)
+		p.backgroundMu.Unlock()
+	}
+	cancel(nil)
+	cancelTimeout()
 
 	// Call onTaskComplete callback - this is where session status should be set to final status
 	if p.onTaskComplete != nil {
 		p.onTaskComplete(task.SessionID, err, reason)
 	}
 
-	// Send result back
-	if task.ResultChan != nil {
+	// Send result back, a requeued task sends it when it runs again
+	if task.ResultChan != nil && reason != "requeued" {
 		select {
 		case task.ResultChan <- AgentTaskResult{Error: err}:
 		default:
@@ -265,6 +615,10 @@ func (p *agentWorkerPool) worker(workerID int64, task AgentTask) {
 
 	// Release worker slot and update stats
 	<-p.workerSem
+	if background {
+		<-p.backgroundSem
+		p.activeBackgroundWorkers.Add(-1)
+	}
 	p.activeWorkers.Add(-1)
 	p.wg.Done()
 
@@ -310,11 +664,14 @@ func (p *agentWorkerPool) Shutdown(ctx context.Context) error {
 // Stats returns current pool statistics
 func (p *agentWorkerPool) Stats() PoolStats {
 	return PoolStats{
-		ActiveWorkers:  p.activeWorkers.Load(),
-		QueuedTasks:    len(p.taskQueue),
-		TotalTasks:     p.totalTasks.Load(),
-		CompletedTasks: p.completedTasks.Load(),
-		FailedTasks:    p.failedTasks.Load(),
+		ActiveWorkers:           p.activeWorkers.Load(),
+		ActiveBackgroundWorkers: p.activeBackgroundWorkers.Load(),
+		QueuedTasks:             len(p.taskQueue) + len(p.backgroundQueue) + len(p.requeuedQueue),
+		QueuedBackgroundTasks:   len(p.backgroundQueue) + len(p.requeuedQueue),
+		TotalTasks:              p.totalTasks.Load(),
+		CompletedTasks:          p.completedTasks.Load(),
+		FailedTasks:             p.failedTasks.Load(),
+		PreemptedTasks:          p.preemptedTasks.Load(),
 	}
 }
 
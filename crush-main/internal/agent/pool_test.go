@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPool_CapacityError(t *testing.T) {
+	release := make(chan struct{})
+	executor := func(ctx context.Context, task AgentTask) error {
+		<-release
+		return nil
+	}
+	pool := NewAgentWorkerPool(&config.AgentConfig{MaxWorkers: 1, TaskQueueSize: 1, TaskTimeout: 60}, executor, nil, nil)
+	t.Cleanup(func() {
+		close(release)
+		_ = pool.Shutdown(context.Background())
+	})
+
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "running"}))
+	require.Eventually(t, func() bool { return pool.Stats().ActiveWorkers == 1 }, time.Second, time.Millisecond)
+	// The dispatcher holds the next task while it waits for a worker
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "dispatching"}))
+	require.Eventually(t, func() bool { return pool.Stats().QueuedTasks == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "queued"}))
+
+	err := pool.Submit(context.Background(), AgentTask{SessionID: "rejected"})
+	assert.ErrorIs(t, err, ErrPoolFull)
+	var capacityErr *CapacityError
+	require.True(t, errors.As(err, &capacityErr))
+	assert.Equal(t, 1, capacityErr.QueueDepth)
+	assert.Equal(t, 1, capacityErr.QueueSize)
+	assert.Equal(t, 1, capacityErr.MaxWorkers)
+	assert.Equal(t, 2*defaultTaskDuration, capacityErr.EstimatedWait)
+	assert.Equal(t, defaultTaskDuration, capacityErr.RetryAfter)
+}
+
+// blockingExecutor runs each task until its session is released or its
+// context is cancelled, and reports the sessions it starts.
+func blockingExecutor(started chan<- string, release map[string]chan struct{}) TaskExecutor {
+	return func(ctx context.Context, task AgentTask) error {
+		started <- task.SessionID
+		select {
+		case <-release[task.SessionID]:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestWorkerPool_InteractivePreemptsBackground(t *testing.T) {
+	started := make(chan string, 10)
+	release := map[string]chan struct{}{"bg1": make(chan struct{}), "bg2": make(chan struct{}), "fg": make(chan struct{})}
+	reasons := make(chan string, 10)
+	onComplete := func(sessionID string, _ error, reason string) { reasons <- sessionID + ":" + reason }
+	pool := NewAgentWorkerPool(&config.AgentConfig{MaxWorkers: 2, MaxBackgroundWorkers: 2, TaskTimeout: 60}, blockingExecutor(started, release), nil, onComplete)
+	t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+
+	bg1 := make(chan AgentTaskResult, 1)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg1", Priority: PriorityBackground, ResultChan: bg1}))
+	require.Equal(t, "bg1", <-started)
+	// Started last, bg2 is the one preempted
+	bg2 := make(chan AgentTaskResult, 1)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg2", Priority: PriorityBackground, ResultChan: bg2}))
+	require.Equal(t, "bg2", <-started)
+
+	fg := make(chan AgentTaskResult, 1)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "fg", ResultChan: fg}))
+	require.Equal(t, "bg2:requeued", <-reasons)
+	require.Equal(t, "fg", <-started)
+	assert.Empty(t, bg2, "a requeued task has no result yet")
+
+	close(release["fg"])
+	require.NoError(t, (<-fg).Error)
+	require.Equal(t, "bg2", <-started, "the preempted task runs again")
+	close(release["bg1"])
+	require.NoError(t, (<-bg1).Error, "only one background task makes room")
+	close(release["bg2"])
+	require.NoError(t, (<-bg2).Error)
+
+	stats := pool.Stats()
+	assert.EqualValues(t, 1, stats.PreemptedTasks)
+	assert.EqualValues(t, 3, stats.CompletedTasks)
+	assert.Zero(t, stats.FailedTasks)
+}
+
+func TestWorkerPool_BackgroundTaskWaitsForInteractive(t *testing.T) {
+	started := make(chan string, 10)
+	release := map[string]chan struct{}{"bg1": make(chan struct{}), "bg2": make(chan struct{}), "fg": make(chan struct{})}
+	pool := NewAgentWorkerPool(&config.AgentConfig{MaxWorkers: 2, MaxBackgroundWorkers: 1, TaskTimeout: 60}, blockingExecutor(started, release), nil, nil)
+	t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg1", Priority: PriorityBackground}))
+	require.Equal(t, "bg1", <-started)
+	// bg2 waits for the background slot of bg1 in the dispatcher
+	bg2 := make(chan AgentTaskResult, 1)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg2", Priority: PriorityBackground, ResultChan: bg2}))
+	require.Eventually(t, func() bool { return pool.Stats().QueuedBackgroundTasks == 0 }, time.Second, time.Millisecond)
+
+	fg := make(chan AgentTaskResult, 1)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "fg", ResultChan: fg}))
+	require.Equal(t, "fg", <-started, "the interactive task passes the waiting background task")
+	close(release["fg"])
+	require.NoError(t, (<-fg).Error)
+	assert.Empty(t, started, "bg2 still waits for the background slot")
+
+	close(release["bg1"])
+	require.Equal(t, "bg2", <-started)
+	close(release["bg2"])
+	require.NoError(t, (<-bg2).Error)
+	assert.Zero(t, pool.Stats().PreemptedTasks, "a free worker needs no preemption")
+}
+
+func TestWorkerPool_WaitingBackgroundTaskGivesWayToInteractive(t *testing.T) {
+	started := make(chan string, 10)
+	release := map[string]chan struct{}{"fg1": make(chan struct{}), "fg2": make(chan struct{}), "bg1": make(chan struct{}), "bg2": make(chan struct{})}
+	pool := NewAgentWorkerPool(&config.AgentConfig{MaxWorkers: 2, MaxBackgroundWorkers: 2, TaskTimeout: 60}, blockingExecutor(started, release), nil, nil)
+	t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "fg1"}))
+	require.Equal(t, "fg1", <-started)
+	bg1 := make(chan AgentTaskResult, 1)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg1", Priority: PriorityBackground, ResultChan: bg1}))
+	require.Equal(t, "bg1", <-started)
+	// bg2 holds a background slot and waits for a worker
+	bg2 := make(chan AgentTaskResult, 1)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg2", Priority: PriorityBackground, ResultChan: bg2}))
+	require.Eventually(t, func() bool { return pool.Stats().QueuedBackgroundTasks == 0 }, time.Second, time.Millisecond)
+
+	fg2 := make(chan AgentTaskResult, 1)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "fg2", ResultChan: fg2}))
+	require.Equal(t, "fg2", <-started, "the worker of bg1 goes to the interactive task")
+	assert.Empty(t, started)
+
+	close(release["fg1"])
+	require.Equal(t, "bg2", <-started, "bg2 keeps its place and runs on the next free worker")
+	close(release["fg2"])
+	require.NoError(t, (<-fg2).Error)
+	require.Equal(t, "bg1", <-started, "the preempted task runs again")
+	close(release["bg1"])
+	close(release["bg2"])
+	require.NoError(t, (<-bg1).Error)
+	require.NoError(t, (<-bg2).Error)
+}
+
+func TestWorkerPool_PreemptedTaskRunsBeforeQueuedBackgroundTasks(t *testing.T) {
+	started := make(chan string, 10)
+	release := map[string]chan struct{}{"fg1": make(chan struct{}), "fg2": make(chan struct{}), "bg1": make(chan struct{}), "bg2": make(chan struct{}), "bg3": make(chan struct{})}
+	pool := NewAgentWorkerPool(&config.AgentConfig{MaxWorkers: 2, MaxBackgroundWorkers: 1, TaskTimeout: 60}, blockingExecutor(started, release), nil, nil)
+	t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg1", Priority: PriorityBackground}))
+	require.Equal(t, "bg1", <-started)
+	// bg2 waits for the background slot of bg1 in the dispatcher, bg3 in the lane
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg2", Priority: PriorityBackground}))
+	require.Eventually(t, func() bool { return pool.Stats().QueuedBackgroundTasks == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "bg3", Priority: PriorityBackground}))
+
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "fg1"}))
+	require.Equal(t, "fg1", <-started)
+	require.NoError(t, pool.Submit(context.Background(), AgentTask{SessionID: "fg2"}))
+	require.Equal(t, "fg2", <-started, "bg1 is preempted")
+	require.Eventually(t, func() bool { return pool.Stats().QueuedBackgroundTasks == 2 }, time.Second, time.Millisecond)
+
+	close(release["fg1"])
+	require.Equal(t, "bg2", <-started)
+	close(release["bg2"])
+	require.Equal(t, "bg1", <-started, "the preempted task runs before bg3")
+	close(release["bg1"])
+	require.Equal(t, "bg3", <-started)
+	close(release["bg3"])
+	close(release["fg2"])
+	assert.EqualValues(t, 1, pool.Stats().PreemptedTasks)
+}
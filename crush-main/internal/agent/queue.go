@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/internal/pubsub"
+)
+
+// ErrQueuedPromptNotFound is returned when a queued prompt to remove or
+// reorder is not (or no longer) waiting in the queue of its session.
+var ErrQueuedPromptNotFound = errors.New("queued prompt not found")
+
+// QueuedPrompt is a prompt waiting for the running turn of its session.
+type QueuedPrompt struct {
+	ID          string `json:"id"`
+	SessionID   string `json:"session_id"`
+	Agent       string `json:"agent,omitempty"`
+	Prompt      string `json:"prompt"`
+	Attachments int    `json:"attachments"`
+	QueuedAt    int64  `json:"queued_at"`
+}
+
+// QueueUpdate is published when the prompts queued for a session change.
+type QueueUpdate struct {
+	SessionID string
+}
+
+var queueBroker = pubsub.NewBroker[QueueUpdate]()
+
+// SubscribeQueueUpdates returns a channel for the changes of the prompt queues.
+func SubscribeQueueUpdates(ctx context.Context) <-chan pubsub.Event[QueueUpdate] {
+	return queueBroker.Subscribe(ctx)
+}
+
+func publishQueueUpdate(sessionID string) {
+	queueBroker.Publish(pubsub.UpdatedEvent, QueueUpdate{SessionID: sessionID})
+}
+
+// enqueue adds a call to the queue of its session.
+func (a *sessionAgent) enqueue(call SessionAgentCall) {
+	if call.queueID == "" {
+		call.queueID = uuid.NewString()
+		call.queuedAt = time.Now().UnixMilli()
+	}
+	a.queueMu.Lock()
+	existing, _ := a.messageQueue.Get(call.SessionID)
+	a.messageQueue.Set(call.SessionID, append(existing, call))
+	a.queueMu.Unlock()
+	publishQueueUpdate(call.SessionID)
+}
+
+// dequeue takes the first call of the queue of a session.
+func (a *sessionAgent) dequeue(sessionID string) (SessionAgentCall, bool) {
+	a.queueMu.Lock()
+	queued, _ := a.messageQueue.Get(sessionID)
+	if len(queued) == 0 {
+		a.queueMu.Unlock()
+		return SessionAgentCall{}, false
+	}
+	if len(queued) == 1 {
+		a.messageQueue.Del(sessionID)
+	} else {
+		a.messageQueue.Set(sessionID, queued[1:])
+	}
+	a.queueMu.Unlock()
+	publishQueueUpdate(sessionID)
+	return queued[0], true
+}
+
+// takeQueue empties the queue of a session and returns its calls.
+func (a *sessionAgent) takeQueue(sessionID string) []SessionAgentCall {
+	a.queueMu.Lock()
+	queued, _ := a.messageQueue.Take(sessionID)
+	a.queueMu.Unlock()
+	if len(queued) > 0 {
+		publishQueueUpdate(sessionID)
+	}
+	return queued
+}
+
+func (a *sessionAgent) ListQueue(sessionID string) []QueuedPrompt {
+	queued, _ := a.messageQueue.Get(sessionID)
+	prompts := make([]QueuedPrompt, len(queued))
+	for i, call := range queued {
+		prompts[i] = QueuedPrompt{
+			ID:          call.queueID,
+			SessionID:   call.SessionID,
+			Prompt:      call.Prompt,
+			Attachments: len(call.Attachments),
+			QueuedAt:    call.queuedAt,
+		}
+	}
+	return prompts
+}
+
+func (a *sessionAgent) RemoveQueued(sessionID, promptID string) error {
+	a.queueMu.Lock()
+	queued, _ := a.messageQueue.Get(sessionID)
+	i := slices.IndexFunc(queued, func(call SessionAgentCall) bool { return call.queueID == promptID })
+	if i < 0 {
+		a.queueMu.Unlock()
+		return ErrQueuedPromptNotFound
+	}
+	queued = slices.Delete(slices.Clone(queued), i, i+1)
+	if len(queued) == 0 {
+		a.messageQueue.Del(sessionID)
+	} else {
+		a.messageQueue.Set(sessionID, queued)
+	}
+	a.queueMu.Unlock()
+	publishQueueUpdate(sessionID)
+	return nil
+}
+
+func (a *sessionAgent) ReorderQueue(sessionID string, promptIDs []string) error {
+	a.queueMu.Lock()
+	queued, _ := a.messageQueue.Get(sessionID)
+	reordered, err := reorderCalls(queued, promptIDs)
+	if err != nil {
+		a.queueMu.Unlock()
+		return err
+	}
+	a.messageQueue.Set(sessionID, reordered)
+	a.queueMu.Unlock()
+	publishQueueUpdate(sessionID)
+	return nil
+}
+
+// reorderCalls moves the calls listed in promptIDs to the front of the queue,
+// in that order. The other calls keep their order after them.
+func reorderCalls(queued []SessionAgentCall, promptIDs []string) ([]SessionAgentCall, error) {
+	reordered := make([]SessionAgentCall, 0, len(queued))
+	for _, id := range promptIDs {
+		i := slices.IndexFunc(queued, func(call SessionAgentCall) bool { return call.queueID == id })
+		if i < 0 || slices.ContainsFunc(reordered, func(call SessionAgentCall) bool { return call.queueID == id }) {
+			return nil, ErrQueuedPromptNotFound
+		}
+		reordered = append(reordered, queued[i])
+	}
+	for _, call := range queued {
+		if !slices.Contains(promptIDs, call.queueID) {
+			reordered = append(reordered, call)
+		}
+	}
+	return reordered, nil
+}
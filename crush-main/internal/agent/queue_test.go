@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorderCalls(t *testing.T) {
+	t.Parallel()
+
+	queued := []SessionAgentCall{{queueID: "a"}, {queueID: "b"}, {queueID: "c"}}
+	ids := func(calls []SessionAgentCall) []string {
+		var out []string
+		for _, call := range calls {
+			out = append(out, call.queueID)
+		}
+		return out
+	}
+
+	reordered, err := reorderCalls(queued, []string{"c", "a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "a", "b"}, ids(reordered))
+
+	// Unlisted prompts keep their order after the listed ones
+	reordered, err = reorderCalls(queued, []string{"c"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "a", "b"}, ids(reordered))
+
+	_, err = reorderCalls(queued, []string{"x"})
+	require.ErrorIs(t, err, ErrQueuedPromptNotFound)
+	_, err = reorderCalls(queued, []string{"a", "a"})
+	require.ErrorIs(t, err, ErrQueuedPromptNotFound)
+}
+
+func TestBusyPolicy(t *testing.T) {
+	t.Parallel()
+
+	a := &sessionAgent{
+		activeRequests: csync.NewMap[string, context.CancelCauseFunc](),
+		messageQueue:   csync.NewMap[string, []SessionAgentCall](),
+		runs:           csync.NewMap[string, chan struct{}](),
+	}
+	var cause error
+	done := make(chan struct{})
+	a.activeRequests.Set("s1", func(err error) {
+		cause = err
+		// The running turn stops a bit later
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			a.runs.Del("s1")
+			close(done)
+		}()
+	})
+	a.runs.Set("s1", done)
+
+	result, err := a.Run(t.Context(), SessionAgentCall{SessionID: "s1", Prompt: "next"})
+	require.NoError(t, err)
+	require.Nil(t, result)
+	require.Equal(t, 1, a.QueuedPrompts("s1"))
+
+	_, err = a.Run(t.Context(), SessionAgentCall{SessionID: "s1", Prompt: "next", BusyPolicy: config.BusyPolicyReject})
+	require.ErrorIs(t, err, ErrSessionBusy)
+	require.Equal(t, 1, a.QueuedPrompts("s1"))
+
+	// Interrupting cancels the running turn and its queue, and waits for it
+	require.NoError(t, a.interrupt(t.Context(), "s1"))
+	var cancelErr *CancelError
+	require.ErrorAs(t, cause, &cancelErr)
+	require.Equal(t, message.CancelReasonReplaced, cancelErr.Reason)
+	require.Zero(t, a.QueuedPrompts("s1"))
+	require.False(t, a.IsSessionBusy("s1"))
+	select {
+	case <-done:
+	default:
+		t.Fatal("interrupt returned before the turn stopped")
+	}
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/domain/toolcall"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+)
+
+// permissionTimeoutContent is the result of a tool call suspended on its
+// permission request, replaced by its real result once the user grants it.
+const permissionTimeoutContent = "The permission request timed out. The tool call is suspended and runs once the user grants it."
+
+// ResumedToolCallPrompt is the prompt of the turn resuming a suspended tool
+// call, which has run with its result in place of the timeout result.
+func ResumedToolCallPrompt(toolName string) string {
+	return fmt.Sprintf("The user granted the permission of the suspended %s tool call after it timed out. It has run and its result is in the history, continue the task from there.", toolName)
+}
+
+// suspendToolCall keeps a tool call whose permission request timed out, with
+// the prompt of the turn, so that it runs once the user answers.
+func (a *sessionAgent) suspendToolCall(ctx context.Context, prompt string, timeout *permission.TimeoutError) {
+	req := timeout.Request
+	if a.permissions != nil {
+		// The call is decided again when it resumes
+		a.permissions.TakeDecision(req.ToolCallID)
+	}
+	if a.toolCalls == nil {
+		return
+	}
+	if err := a.toolCalls.AwaitPermission(ctx, req.ToolCallID, prompt, req.Action, req.Path); err != nil {
+		slog.Warn("Failed to suspend tool call awaiting permission", "session_id", req.SessionID, "tool_call_id", req.ToolCallID, "error", err)
+		return
+	}
+	slog.Info("Tool call suspended awaiting permission", "session_id", req.SessionID, "tool_call_id", req.ToolCallID, "tool_name", req.ToolName)
+}
+
+// resumeToolCall runs a suspended tool call the user granted since, as it was
+// called, before the turn goes on. Its result replaces the timeout result in
+// msgs and in the stored history. The permission of the call must have been
+// granted with GrantToolCall.
+func (a *sessionAgent) resumeToolCall(ctx context.Context, sessionID, toolCallID string, agentTools []fantasy.AgentTool, msgs []message.Message) error {
+	if a.toolCalls == nil {
+		return errors.New("tool calls are not stored")
+	}
+	tc, err := a.toolCalls.Get(ctx, toolCallID)
+	if err != nil {
+		return fmt.Errorf("failed to get the suspended tool call: %w", err)
+	}
+	if tc.SessionID != sessionID || tc.Status != toolcall.StatusAwaitingPermission {
+		return fmt.Errorf("tool call %s is not awaiting permission", toolCallID)
+	}
+	if err := a.toolCalls.GrantPermission(ctx, toolCallID); err != nil {
+		return fmt.Errorf("failed to resume the tool call: %w", err)
+	}
+
+	result := message.ToolResult{ToolCallID: tc.ID, Name: tc.Name}
+	start := time.Now()
+	if i := slices.IndexFunc(agentTools, func(t fantasy.AgentTool) bool { return t.Info().Name == tc.Name }); i < 0 {
+		result.Content, result.IsError = fmt.Sprintf("The %s tool is no longer available, the call did not run.", tc.Name), true
+	} else {
+		toolCtx := context.WithValue(ctx, tools.MessageIDContextKey, tc.MessageID)
+		resp, err := agentTools[i].Run(toolCtx, fantasy.ToolCall{ID: tc.ID, Name: tc.Name, Input: tc.Input})
+		switch {
+		case errors.Is(err, permission.ErrorPermissionDenied):
+			result.Content, result.IsError = "User denied permission", true
+		case err != nil:
+			result.Content, result.IsError = "There was an error while executing the tool: "+err.Error(), true
+		default:
+			result.Content, result.IsError, result.Metadata = resp.Content, resp.IsError, resp.Metadata
+		}
+	}
+	slog.InfoContext(ctx, "Resumed tool call", "tool_call_id", tc.ID, "tool", tc.Name, "is_error", result.IsError)
+
+	var errorMsg string
+	if result.IsError {
+		errorMsg = result.Content
+	}
+	if err := a.toolCalls.Complete(ctx, tc.ID, result.Content, result.IsError, errorMsg); err != nil {
+		slog.Warn("Failed to complete resumed tool call", "tool_call_id", tc.ID, "error", err)
+	}
+	for i := range msgs {
+		if msgs[i].ID == tc.MessageID {
+			a.auditToolCall(ctx, &msgs[i], fantasy.ToolResultContent{ToolCallID: tc.ID, ToolName: tc.Name}, result.Content, result.IsError, time.Since(start))
+		}
+		if msgs[i].Role != message.Tool || !replaceToolResult(&msgs[i], result) {
+			continue
+		}
+		if err := a.messages.Update(ctx, msgs[i]); err != nil {
+			return fmt.Errorf("failed to store the resumed tool result: %w", err)
+		}
+	}
+	return nil
+}
+
+// replaceToolResult replaces the result of the same tool call in msg, if any.
+func replaceToolResult(msg *message.Message, result message.ToolResult) bool {
+	for i, part := range msg.Parts {
+		if tr, ok := part.(message.ToolResult); ok && tr.ToolCallID == result.ToolCallID {
+			msg.Parts[i] = result
+			return true
+		}
+	}
+	return false
+}
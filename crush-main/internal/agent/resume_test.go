@@ -0,0 +1,22 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceToolResult(t *testing.T) {
+	t.Parallel()
+
+	msg := message.Message{Role: message.Tool, Parts: []message.ContentPart{
+		message.ToolResult{ToolCallID: "call-1", Name: "bash", Content: permissionTimeoutContent, IsError: true},
+		message.ToolResult{ToolCallID: "call-2", Name: "view", Content: "package main"},
+	}}
+	resumed := message.ToolResult{ToolCallID: "call-1", Name: "bash", Content: "ok"}
+
+	require.True(t, replaceToolResult(&msg, resumed))
+	require.Equal(t, []message.ToolResult{resumed, {ToolCallID: "call-2", Name: "view", Content: "package main"}}, msg.ToolResults())
+	require.False(t, replaceToolResult(&msg, message.ToolResult{ToolCallID: "call-3"}), "other tool calls are left alone")
+}
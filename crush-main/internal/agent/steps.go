@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// StepPrepare is how the prompt of a step was prepared.
+type StepPrepare struct {
+	DurationMs int64 `json:"duration_ms"`
+	// Messages is the number of messages sent to the model.
+	Messages int `json:"messages"`
+	// QueuedPrompts is the number of queued prompts added to the step.
+	QueuedPrompts int `json:"queued_prompts"`
+	// CompactedResults is the number of old tool results elided.
+	CompactedResults int `json:"compacted_results"`
+	// LoopNudge is set when the model was nudged out of a tool call loop.
+	LoopNudge bool `json:"loop_nudge"`
+}
+
+// stepDetails is what the timeline of a step leaves out: its preparation,
+// model, finish reason and usage.
+type stepDetails struct {
+	prepare      StepPrepare
+	provider     string
+	model        string
+	finishReason string
+	usage        fantasy.Usage
+	cost         float64
+}
+
+// prepareStarted marks the start of the preparation of the next step.
+func (r *timelineRecorder) prepareStarted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prepareStart = r.now()
+}
+
+// stepPrepared records how the prompt of the current step was prepared and
+// the model it is sent to. The preparation ends when the step starts.
+func (r *timelineRecorder) stepPrepared(prepare StepPrepare, provider, model string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.details) == 0 {
+		return
+	}
+	if !r.prepareStart.IsZero() && !r.streamStart.IsZero() {
+		prepare.DurationMs = r.streamStart.Sub(r.prepareStart).Milliseconds()
+	}
+	details := &r.details[len(r.details)-1]
+	details.prepare = prepare
+	details.provider = provider
+	details.model = model
+}
+
+// stepFinished records how the current step finished and the tokens it used.
+func (r *timelineRecorder) stepFinished(finishReason string, usage fantasy.Usage, cost float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.details) == 0 {
+		return
+	}
+	details := &r.details[len(r.details)-1]
+	details.finishReason = finishReason
+	details.usage = usage
+	details.cost = cost
+}
+
+// steps returns the rows of the steps of a finished timeline.
+func (r *timelineRecorder) steps(timeline TurnTimeline) []postgres.CreateTurnStepParams {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows := make([]postgres.CreateTurnStepParams, 0, len(timeline.Steps))
+	for i, step := range timeline.Steps {
+		var details stepDetails
+		if i < len(r.details) {
+			details = r.details[i]
+		}
+		toolCalls := []byte("[]")
+		if len(step.Tools) > 0 {
+			if data, err := json.Marshal(step.Tools); err == nil {
+				toolCalls = data
+			}
+		}
+		rows = append(rows, postgres.CreateTurnStepParams{
+			MessageID:           step.MessageID,
+			TimelineID:          timeline.ID,
+			SessionID:           timeline.SessionID,
+			StepIndex:           int32(step.Index),
+			StartedAt:           timeline.StartedAt + step.StartMs,
+			PrepareMs:           details.prepare.DurationMs,
+			MessageCount:        int32(details.prepare.Messages),
+			QueuedPrompts:       int32(details.prepare.QueuedPrompts),
+			CompactedResults:    int32(details.prepare.CompactedResults),
+			LoopNudge:           details.prepare.LoopNudge,
+			Provider:            details.provider,
+			Model:               details.model,
+			FirstTokenMs:        step.FirstTokenMs,
+			ModelMs:             step.ModelMs,
+			FinishReason:        details.finishReason,
+			ToolCalls:           string(toolCalls),
+			InputTokens:         details.usage.InputTokens,
+			OutputTokens:        details.usage.OutputTokens,
+			CacheCreationTokens: details.usage.CacheCreationTokens,
+			CacheReadTokens:     details.usage.CacheReadTokens,
+			Cost:                details.cost,
+		})
+	}
+	return rows
+}
+
+// saveSteps stores the steps of a saved timeline, one per assistant message.
+func (a *sessionAgent) saveSteps(ctx context.Context, r *timelineRecorder, timeline TurnTimeline) {
+	for _, step := range r.steps(timeline) {
+		if err := a.dbQuerier.CreateTurnStep(ctx, step); err != nil {
+			slog.Warn("Failed to save turn step", "message_id", step.MessageID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/domain/session"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+)
+
+// Bounds of the lists of a summary appendix, the most recent entries are kept.
+const (
+	maxAppendixFiles    = 50
+	maxAppendixCommands = 30
+)
+
+// buildSummaryAppendix collects the files and commands of the successful
+// tool calls of the summarized messages and the open todos of the session.
+// The appendix of an earlier summary among the messages is carried over, so
+// references survive repeated compactions.
+func buildSummaryAppendix(msgs []message.Message, todos []session.Todo) message.SummaryAppendix {
+	failed := make(map[string]bool)
+	for _, msg := range msgs {
+		for _, result := range msg.ToolResults() {
+			if result.IsError {
+				failed[result.ToolCallID] = true
+			}
+		}
+	}
+
+	var appendix message.SummaryAppendix
+	for _, msg := range msgs {
+		if previous := msg.SummaryAppendix(); previous != nil {
+			appendix.FilesTouched = appendUnique(appendix.FilesTouched, previous.FilesTouched...)
+			appendix.FilesRead = appendUnique(appendix.FilesRead, previous.FilesRead...)
+			appendix.Commands = appendUnique(appendix.Commands, previous.Commands...)
+		}
+		for _, call := range msg.ToolCalls() {
+			if failed[call.ID] {
+				continue
+			}
+			var input struct {
+				FilePath string `json:"file_path"`
+				Command  string `json:"command"`
+			}
+			if err := json.Unmarshal([]byte(call.Input), &input); err != nil {
+				continue
+			}
+			switch call.Name {
+			case tools.EditToolName, tools.MultiEditToolName, tools.WriteToolName:
+				if input.FilePath != "" {
+					appendix.FilesTouched = appendUnique(appendix.FilesTouched, input.FilePath)
+				}
+			case tools.ViewToolName:
+				if input.FilePath != "" {
+					appendix.FilesRead = appendUnique(appendix.FilesRead, input.FilePath)
+				}
+			case tools.BashToolName:
+				if input.Command != "" {
+					appendix.Commands = appendUnique(appendix.Commands, input.Command)
+				}
+			}
+		}
+	}
+
+	// Files that were edited are listed once, as touched
+	appendix.FilesRead = slices.DeleteFunc(appendix.FilesRead, func(file string) bool {
+		return slices.Contains(appendix.FilesTouched, file)
+	})
+	appendix.FilesTouched = lastN(appendix.FilesTouched, maxAppendixFiles)
+	appendix.FilesRead = lastN(appendix.FilesRead, maxAppendixFiles)
+	appendix.Commands = lastN(appendix.Commands, maxAppendixCommands)
+
+	for _, todo := range todos {
+		if todo.Status != session.TodoStatusCompleted {
+			appendix.OpenTodos = append(appendix.OpenTodos, todo.Content)
+		}
+	}
+	return appendix
+}
+
+// appendUnique appends the values missing from list, moving repeated ones to
+// the end so that the most recently used entries come last.
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		list = slices.DeleteFunc(list, func(v string) bool { return v == value })
+		list = append(list, value)
+	}
+	return list
+}
+
+func lastN(list []string, n int) []string {
+	if len(list) > n {
+		return list[len(list)-n:]
+	}
+	return list
+}
@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/domain/message"
+	"github.com/rolling1314/rolling-crush/domain/session"
+	"github.com/rolling1314/rolling-crush/internal/agent/tools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSummaryAppendix(t *testing.T) {
+	previous := message.Message{Role: message.Assistant}
+	previous.SetSummaryAppendix(message.SummaryAppendix{
+		FilesTouched: []string{"/work/old.go"},
+		Commands:     []string{"go test ./..."},
+		OpenTodos:    []string{"stale todo"},
+	})
+
+	assistant := message.Message{Role: message.Assistant}
+	assistant.AddToolCall(message.ToolCall{ID: "1", Name: tools.ViewToolName, Input: `{"file_path":"/work/main.go"}`})
+	assistant.AddToolCall(message.ToolCall{ID: "2", Name: tools.EditToolName, Input: `{"file_path":"/work/main.go"}`})
+	assistant.AddToolCall(message.ToolCall{ID: "3", Name: tools.BashToolName, Input: `{"command":"go build ./..."}`})
+	assistant.AddToolCall(message.ToolCall{ID: "4", Name: tools.WriteToolName, Input: `{"file_path":"/work/failed.go"}`})
+	assistant.AddToolCall(message.ToolCall{ID: "5", Name: tools.BashToolName, Input: `{"command":"go test ./..."}`})
+	results := message.Message{Role: message.Tool}
+	results.AddToolResult(message.ToolResult{ToolCallID: "4", IsError: true})
+
+	appendix := buildSummaryAppendix([]message.Message{previous, assistant, results}, []session.Todo{
+		{Content: "write tests", Status: session.TodoStatusInProgress},
+		{Content: "fix build", Status: session.TodoStatusCompleted},
+	})
+
+	assert.Equal(t, []string{"/work/old.go", "/work/main.go"}, appendix.FilesTouched)
+	assert.Empty(t, appendix.FilesRead, "edited files are only listed as touched")
+	assert.Equal(t, []string{"go build ./...", "go test ./..."}, appendix.Commands)
+	assert.Equal(t, []string{"write tests"}, appendix.OpenTodos)
+}
+
+func TestBuildSummaryAppendix_Empty(t *testing.T) {
+	user := message.Message{Role: message.User}
+	user.Parts = append(user.Parts, message.TextContent{Text: "hello"})
+	assert.True(t, buildSummaryAppendix([]message.Message{user}, nil).IsEmpty())
+}
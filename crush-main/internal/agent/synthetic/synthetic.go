@@ -0,0 +1,293 @@
+// Package synthetic provides a fake language model provider that streams
+// generated tokens at a configurable rate without calling any API. It is used
+// to load test the agent stack (worker pool, Redis and Postgres) with
+// realistic streaming and tool-call patterns.
+package synthetic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/google/uuid"
+)
+
+// Name is the provider type of the synthetic provider.
+const Name = "synthetic"
+
+// ErrSimulated is returned for the calls failed on purpose by ErrorRate.
+var ErrSimulated = errors.New("synthetic provider: simulated error")
+
+// Options shapes the generated responses.
+type Options struct {
+	// TokensPerSecond is the streaming rate of output tokens.
+	TokensPerSecond float64
+	// OutputTokens is the length of the final text answer.
+	OutputTokens int
+	// FirstTokenLatency is the delay before the first streamed part.
+	FirstTokenLatency time.Duration
+	// ToolCallsPerTurn is the number of tool-calling steps before the final answer.
+	ToolCallsPerTurn int
+	// ToolPattern lists the tools called, in turn, by the tool-calling steps.
+	ToolPattern []string
+	// ToolInput is the JSON input sent with every tool call.
+	ToolInput string
+	// ErrorRate is the probability (0-1) that a call fails.
+	ErrorRate float64
+}
+
+// DefaultOptions returns the options used for unset provider options.
+func DefaultOptions() Options {
+	return Options{
+		TokensPerSecond:   50,
+		OutputTokens:      200,
+		FirstTokenLatency: 300 * time.Millisecond,
+		ToolPattern:       []string{"ls"},
+		ToolInput:         `{"path":"."}`,
+	}
+}
+
+// ParseOptions reads the options from the provider_options of a provider config:
+// tokens_per_second, output_tokens, first_token_latency_ms, tool_calls_per_turn,
+// tool_pattern (comma separated), tool_input and error_rate.
+func ParseOptions(values map[string]any) (Options, error) {
+	opts := DefaultOptions()
+	for key, value := range values {
+		var err error
+		switch key {
+		case "tokens_per_second":
+			opts.TokensPerSecond, err = toFloat(value)
+		case "output_tokens":
+			opts.OutputTokens, err = toInt(value)
+		case "first_token_latency_ms":
+			var ms int
+			ms, err = toInt(value)
+			opts.FirstTokenLatency = time.Duration(ms) * time.Millisecond
+		case "tool_calls_per_turn":
+			opts.ToolCallsPerTurn, err = toInt(value)
+		case "tool_pattern":
+			opts.ToolPattern = strings.Split(fmt.Sprint(value), ",")
+		case "tool_input":
+			opts.ToolInput = fmt.Sprint(value)
+		case "error_rate":
+			opts.ErrorRate, err = toFloat(value)
+		}
+		if err != nil {
+			return Options{}, fmt.Errorf("synthetic provider option %s: %w", key, err)
+		}
+	}
+	if opts.TokensPerSecond <= 0 {
+		return Options{}, errors.New("synthetic provider option tokens_per_second must be positive")
+	}
+	return opts, nil
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case string:
+		var f float64
+		_, err := fmt.Sscan(v, &f)
+		return f, err
+	}
+	return 0, fmt.Errorf("not a number: %v", value)
+}
+
+func toInt(value any) (int, error) {
+	f, err := toFloat(value)
+	return int(f), err
+}
+
+type provider struct {
+	opts Options
+}
+
+// New creates a synthetic provider.
+func New(opts Options) fantasy.Provider {
+	return &provider{opts: opts}
+}
+
+func (p *provider) Name() string {
+	return Name
+}
+
+func (p *provider) LanguageModel(_ context.Context, modelID string) (fantasy.LanguageModel, error) {
+	return &languageModel{modelID: modelID, opts: p.opts}, nil
+}
+
+type languageModel struct {
+	modelID string
+	opts    Options
+}
+
+func (m *languageModel) Provider() string {
+	return Name
+}
+
+func (m *languageModel) Model() string {
+	return m.modelID
+}
+
+// turn is what the model answers to a call.
+type turn struct {
+	toolName string // empty for the final text answer
+	text     string
+	usage    fantasy.Usage
+}
+
+// nextTurn decides between a tool call and the final answer by counting the
+// tool-calling steps since the last user message.
+func (m *languageModel) nextTurn(call fantasy.Call) turn {
+	var inputChars int
+	for _, msg := range call.Prompt {
+		for _, part := range msg.Content {
+			switch p := part.(type) {
+			case fantasy.TextPart:
+				inputChars += len(p.Text)
+			case fantasy.ToolResultPart:
+				inputChars += 64
+			}
+		}
+	}
+
+	steps := 0
+	for i := len(call.Prompt) - 1; i >= 0 && call.Prompt[i].Role != fantasy.MessageRoleUser; i-- {
+		if call.Prompt[i].Role == fantasy.MessageRoleAssistant {
+			steps++
+		}
+	}
+
+	t := turn{usage: fantasy.Usage{InputTokens: int64(inputChars/4) + 1}}
+	if steps < m.opts.ToolCallsPerTurn && len(m.opts.ToolPattern) > 0 {
+		t.toolName = strings.TrimSpace(m.opts.ToolPattern[steps%len(m.opts.ToolPattern)])
+		t.usage.OutputTokens = int64(len(m.opts.ToolInput)/4) + 1
+	} else {
+		t.text = syntheticText(m.opts.OutputTokens)
+		t.usage.OutputTokens = int64(m.opts.OutputTokens)
+	}
+	t.usage.TotalTokens = t.usage.InputTokens + t.usage.OutputTokens
+	return t
+}
+
+func (m *languageModel) fail() bool {
+	return m.opts.ErrorRate > 0 && rand.Float64() < m.opts.ErrorRate
+}
+
+func (m *languageModel) Generate(ctx context.Context, call fantasy.Call) (*fantasy.Response, error) {
+	if m.fail() {
+		return nil, ErrSimulated
+	}
+	t := m.nextTurn(call)
+	delay := m.opts.FirstTokenLatency + time.Duration(float64(t.usage.OutputTokens)/m.opts.TokensPerSecond*float64(time.Second))
+	if err := sleep(ctx, delay); err != nil {
+		return nil, err
+	}
+
+	resp := &fantasy.Response{Usage: t.usage}
+	if t.toolName != "" {
+		resp.Content = fantasy.ResponseContent{fantasy.ToolCallContent{
+			ToolCallID: uuid.NewString(),
+			ToolName:   t.toolName,
+			Input:      m.opts.ToolInput,
+		}}
+		resp.FinishReason = fantasy.FinishReasonToolCalls
+	} else {
+		resp.Content = fantasy.ResponseContent{fantasy.TextContent{Text: t.text}}
+		resp.FinishReason = fantasy.FinishReasonStop
+	}
+	return resp, nil
+}
+
+func (m *languageModel) Stream(ctx context.Context, call fantasy.Call) (fantasy.StreamResponse, error) {
+	if m.fail() {
+		return nil, ErrSimulated
+	}
+	t := m.nextTurn(call)
+	interval := time.Duration(float64(time.Second) / m.opts.TokensPerSecond)
+
+	return func(yield func(fantasy.StreamPart) bool) {
+		if err := sleep(ctx, m.opts.FirstTokenLatency); err != nil {
+			yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeError, Error: err})
+			return
+		}
+
+		finish := fantasy.FinishReasonStop
+		if t.toolName != "" {
+			id := uuid.NewString()
+			parts := []fantasy.StreamPart{
+				{Type: fantasy.StreamPartTypeToolInputStart, ID: id, ToolCallName: t.toolName},
+				{Type: fantasy.StreamPartTypeToolInputDelta, ID: id, Delta: m.opts.ToolInput},
+				{Type: fantasy.StreamPartTypeToolInputEnd, ID: id},
+				{Type: fantasy.StreamPartTypeToolCall, ID: id, ToolCallName: t.toolName, ToolCallInput: m.opts.ToolInput},
+			}
+			for _, part := range parts {
+				if !yield(part) {
+					return
+				}
+			}
+			finish = fantasy.FinishReasonToolCalls
+		} else {
+			if !yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeTextStart, ID: "0"}) {
+				return
+			}
+			for _, word := range strings.SplitAfter(t.text, " ") {
+				if err := sleep(ctx, interval); err != nil {
+					yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeError, Error: err})
+					return
+				}
+				if !yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeTextDelta, ID: "0", Delta: word}) {
+					return
+				}
+			}
+			if !yield(fantasy.StreamPart{Type: fantasy.StreamPartTypeTextEnd, ID: "0"}) {
+				return
+			}
+		}
+
+		yield(fantasy.StreamPart{
+			Type:         fantasy.StreamPartTypeFinish,
+			Usage:        t.usage,
+			FinishReason: finish,
+		})
+	}, nil
+}
+
+func (m *languageModel) GenerateObject(context.Context, fantasy.ObjectCall) (*fantasy.ObjectResponse, error) {
+	return nil, errors.New("synthetic provider does not support object generation")
+}
+
+func (m *languageModel) StreamObject(context.Context, fantasy.ObjectCall) (fantasy.ObjectStreamResponse, error) {
+	return nil, errors.New("synthetic provider does not support object generation")
+}
+
+// syntheticWords are cycled to build answers, one word per token.
+var syntheticWords = strings.Fields("the agent reviewed the change and found that the handler validates input before writing to the store so the request path looks correct")
+
+func syntheticText(tokens int) string {
+	words := make([]string, max(tokens, 1))
+	for i := range words {
+		words[i] = syntheticWords[i%len(syntheticWords)]
+	}
+	return strings.Join(words, " ")
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
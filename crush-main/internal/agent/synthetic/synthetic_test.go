@@ -0,0 +1,88 @@
+package synthetic
+
+import (
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(map[string]any{
+		"tokens_per_second":      200.0,
+		"output_tokens":          "20",
+		"first_token_latency_ms": 5,
+		"tool_calls_per_turn":    2.0,
+		"tool_pattern":           "glob,view",
+		"error_rate":             0.1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200.0, opts.TokensPerSecond)
+	assert.Equal(t, 20, opts.OutputTokens)
+	assert.Equal(t, 5*time.Millisecond, opts.FirstTokenLatency)
+	assert.Equal(t, 2, opts.ToolCallsPerTurn)
+	assert.Equal(t, []string{"glob", "view"}, opts.ToolPattern)
+	assert.Equal(t, DefaultOptions().ToolInput, opts.ToolInput)
+
+	_, err = ParseOptions(map[string]any{"tokens_per_second": 0})
+	assert.Error(t, err)
+	_, err = ParseOptions(map[string]any{"output_tokens": []string{"x"}})
+	assert.Error(t, err)
+}
+
+func TestStreamToolPattern(t *testing.T) {
+	model, err := New(Options{
+		TokensPerSecond:  10000,
+		OutputTokens:     5,
+		ToolCallsPerTurn: 2,
+		ToolPattern:      []string{"glob", "view"},
+		ToolInput:        `{}`,
+	}).LanguageModel(t.Context(), "synthetic-model")
+	require.NoError(t, err)
+
+	user := fantasy.NewUserMessage("hello")
+	assistant := fantasy.Message{Role: fantasy.MessageRoleAssistant}
+	tool := fantasy.Message{Role: fantasy.MessageRoleTool}
+
+	collect := func(prompt fantasy.Prompt) (toolName, text string, finish fantasy.StreamPart) {
+		stream, err := model.Stream(t.Context(), fantasy.Call{Prompt: prompt})
+		require.NoError(t, err)
+		for part := range stream {
+			switch part.Type {
+			case fantasy.StreamPartTypeToolCall:
+				toolName = part.ToolCallName
+			case fantasy.StreamPartTypeTextDelta:
+				text += part.Delta
+			case fantasy.StreamPartTypeFinish:
+				finish = part
+			}
+		}
+		return toolName, text, finish
+	}
+
+	toolName, _, finish := collect(fantasy.Prompt{user})
+	assert.Equal(t, "glob", toolName)
+	assert.Equal(t, fantasy.FinishReasonToolCalls, finish.FinishReason)
+
+	toolName, _, _ = collect(fantasy.Prompt{user, assistant, tool})
+	assert.Equal(t, "view", toolName)
+
+	toolName, text, finish := collect(fantasy.Prompt{user, assistant, tool, assistant, tool})
+	assert.Empty(t, toolName)
+	assert.Len(t, text, len(syntheticText(5)))
+	assert.Equal(t, fantasy.FinishReasonStop, finish.FinishReason)
+	assert.Equal(t, int64(5), finish.Usage.OutputTokens)
+
+	// A new user message starts a new turn
+	toolName, _, _ = collect(fantasy.Prompt{user, assistant, tool, assistant, tool, assistant, user})
+	assert.Equal(t, "glob", toolName)
+}
+
+func TestSimulatedErrors(t *testing.T) {
+	model, err := New(Options{TokensPerSecond: 1, ErrorRate: 1}).LanguageModel(t.Context(), "m")
+	require.NoError(t, err)
+	_, err = model.Stream(t.Context(), fantasy.Call{})
+	assert.ErrorIs(t, err, ErrSimulated)
+}
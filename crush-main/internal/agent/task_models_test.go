@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskModelsFallBackToSmall(t *testing.T) {
+	large := Model{Model: namedModel{provider: "openai", model: "gpt-4o"}}
+	small := Model{Model: namedModel{provider: "openai", model: "gpt-4o-mini"}}
+	a := &sessionAgent{largeModel: large, smallModel: small}
+	require.Equal(t, small, a.titleLLM())
+	require.Equal(t, small, a.summaryLLM())
+
+	title := Model{Model: namedModel{provider: "openai", model: "gpt-4.1-nano"}}
+	summary := Model{Model: namedModel{provider: "openai", model: "gpt-4.1"}}
+	a.SetTaskModels(title, summary)
+	require.Equal(t, title, a.titleLLM())
+	require.Equal(t, summary, a.summaryLLM())
+}
+
+func TestBuildTaskModelsUsesSessionConfig(t *testing.T) {
+	provider := config.ProviderConfig{
+		ID:     "openai",
+		Type:   catwalk.TypeOpenAI,
+		APIKey: "test",
+		Models: []catwalk.Model{{ID: "gpt-4o-mini"}, {ID: "gpt-4.1-nano"}},
+	}
+	base := &config.Config{
+		Models: map[config.SelectedModelType]config.SelectedModel{
+			config.SelectedModelTypeSmall: {Provider: "openai", Model: "gpt-4o-mini"},
+		},
+		Providers: csync.NewMapFrom(map[string]config.ProviderConfig{"openai": provider}),
+		Options:   &config.Options{},
+	}
+	c := &coordinator{cfg: base}
+
+	title, summary := c.buildTaskModels(t.Context(), base)
+	require.Nil(t, title.Model, "the base config has no title model")
+	require.Nil(t, summary.Model)
+
+	session := *base
+	session.Models = map[config.SelectedModelType]config.SelectedModel{
+		config.SelectedModelTypeSmall: {Provider: "openai", Model: "gpt-4o-mini"},
+		config.SelectedModelTypeTitle: {Provider: "openai", Model: "gpt-4.1-nano"},
+	}
+	title, summary = c.buildTaskModels(t.Context(), &session)
+	require.NotNil(t, title.Model)
+	require.Equal(t, "gpt-4.1-nano", title.Model.Model())
+	require.Nil(t, summary.Model)
+}
@@ -0,0 +1,284 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// TurnTimeline is the timing breakdown of an agent turn.
+type TurnTimeline struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	StartedAt int64  `json:"started_at"` // Unix milliseconds
+	TotalMs   int64  `json:"total_ms"`
+	// ModelMs is the time spent streaming model responses.
+	ModelMs int64 `json:"model_ms"`
+	// ToolMs is the time spent running tools.
+	ToolMs int64 `json:"tool_ms"`
+	// DBMs is the time spent persisting messages, tool results and usage
+	// outside of the model stream.
+	DBMs  int64          `json:"db_ms"`
+	Steps []TimelineStep `json:"steps"`
+}
+
+// TimelineStep is one model call of a turn and the tools it ran. Offsets are
+// milliseconds since the start of the turn.
+type TimelineStep struct {
+	Index     int    `json:"index"`
+	MessageID string `json:"message_id"`
+	StartMs   int64  `json:"start_ms"`
+	// FirstTokenMs is the latency of the model until the first streamed part.
+	FirstTokenMs int64          `json:"first_token_ms"`
+	ModelMs      int64          `json:"model_ms"`
+	DBMs         int64          `json:"db_ms"`
+	Tools        []TimelineTool `json:"tools,omitempty"`
+}
+
+// TimelineTool is a tool run of a step.
+type TimelineTool struct {
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name"`
+	StartMs    int64  `json:"start_ms"`
+	DurationMs int64  `json:"duration_ms"`
+	IsError    bool   `json:"is_error,omitempty"`
+}
+
+// TimelineSummary is the short form of a turn timeline sent with
+// generation_complete.
+type TimelineSummary struct {
+	TimelineID string `json:"timeline_id"`
+	TotalMs    int64  `json:"total_ms"`
+	ModelMs    int64  `json:"model_ms"`
+	ToolMs     int64  `json:"tool_ms"`
+	DBMs       int64  `json:"db_ms"`
+	Steps      int    `json:"steps"`
+	ToolCalls  int    `json:"tool_calls"`
+	// SlowestTool is the name of the longest tool run, if any.
+	SlowestTool   string `json:"slowest_tool,omitempty"`
+	SlowestToolMs int64  `json:"slowest_tool_ms,omitempty"`
+}
+
+// Summary returns the totals of the timeline.
+func (t *TurnTimeline) Summary() TimelineSummary {
+	summary := TimelineSummary{
+		TimelineID: t.ID,
+		TotalMs:    t.TotalMs,
+		ModelMs:    t.ModelMs,
+		ToolMs:     t.ToolMs,
+		DBMs:       t.DBMs,
+		Steps:      len(t.Steps),
+	}
+	for _, step := range t.Steps {
+		summary.ToolCalls += len(step.Tools)
+		for _, tool := range step.Tools {
+			if tool.DurationMs > summary.SlowestToolMs {
+				summary.SlowestTool = tool.Name
+				summary.SlowestToolMs = tool.DurationMs
+			}
+		}
+	}
+	return summary
+}
+
+// timelineRecorder records the timeline of a turn from the stream callbacks.
+type timelineRecorder struct {
+	mu         sync.Mutex
+	start      time.Time
+	timeline   TurnTimeline
+	messageIDs []string
+	// streamStart is when the model call of the current step started.
+	streamStart time.Time
+	// toolStart is when the next tool of the current step starts running.
+	toolStart time.Time
+	// prepareStart is when the preparation of the next step started.
+	prepareStart time.Time
+	// details of the steps, in the order of timeline.Steps
+	details []stepDetails
+	now     func() time.Time
+}
+
+func newTimelineRecorder(sessionID string) *timelineRecorder {
+	r := &timelineRecorder{now: time.Now}
+	r.start = r.now()
+	r.timeline = TurnTimeline{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		StartedAt: r.start.UnixMilli(),
+		Steps:     []TimelineStep{},
+	}
+	return r
+}
+
+func (r *timelineRecorder) offset(t time.Time) int64 {
+	return t.Sub(r.start).Milliseconds()
+}
+
+func (r *timelineRecorder) current() *TimelineStep {
+	if len(r.timeline.Steps) == 0 {
+		return nil
+	}
+	return &r.timeline.Steps[len(r.timeline.Steps)-1]
+}
+
+// addMessage links a message written during the turn to the timeline.
+func (r *timelineRecorder) addMessage(messageID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messageIDs = append(r.messageIDs, messageID)
+}
+
+// stepStarted opens a step for the assistant message of a model call.
+func (r *timelineRecorder) stepStarted(messageID string, dbTime time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	r.timeline.Steps = append(r.timeline.Steps, TimelineStep{
+		Index:     len(r.timeline.Steps),
+		MessageID: messageID,
+		StartMs:   r.offset(now.Add(-dbTime)),
+		DBMs:      dbTime.Milliseconds(),
+	})
+	r.details = append(r.details, stepDetails{})
+	r.messageIDs = append(r.messageIDs, messageID)
+	r.streamStart = now
+}
+
+// firstToken records the first streamed part of the current step.
+func (r *timelineRecorder) firstToken() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	step := r.current()
+	if step == nil || step.FirstTokenMs != 0 || r.streamStart.IsZero() {
+		return
+	}
+	step.FirstTokenMs = max(r.now().Sub(r.streamStart).Milliseconds(), 1)
+}
+
+// streamFinished closes the model call of the current step.
+func (r *timelineRecorder) streamFinished() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	step := r.current()
+	if step == nil || r.streamStart.IsZero() {
+		return
+	}
+	now := r.now()
+	step.ModelMs = now.Sub(r.streamStart).Milliseconds()
+	r.streamStart = time.Time{}
+	r.toolStart = now
+}
+
+// toolFinished records a tool run, which started when the stream or the
+// previous tool of the step finished, and returns its duration.
+func (r *timelineRecorder) toolFinished(toolCallID, name string, isError bool) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	step := r.current()
+	if step == nil {
+		return 0
+	}
+	now := r.now()
+	start := r.toolStart
+	if start.IsZero() {
+		start = now
+	}
+	step.Tools = append(step.Tools, TimelineTool{
+		ToolCallID: toolCallID,
+		Name:       name,
+		StartMs:    r.offset(start),
+		DurationMs: now.Sub(start).Milliseconds(),
+		IsError:    isError,
+	})
+	return now.Sub(start)
+}
+
+// persisted records time spent writing to the database after the stream. The
+// next tool of the step starts once the write is done.
+func (r *timelineRecorder) persisted(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if step := r.current(); step != nil {
+		step.DBMs += d.Milliseconds()
+	}
+	r.toolStart = r.now()
+}
+
+// finish computes the totals of the timeline.
+func (r *timelineRecorder) finish() TurnTimeline {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.timeline
+	t.TotalMs = r.now().Sub(r.start).Milliseconds()
+	t.ModelMs, t.ToolMs, t.DBMs = 0, 0, 0
+	for _, step := range t.Steps {
+		t.ModelMs += step.ModelMs
+		t.DBMs += step.DBMs
+		for _, tool := range step.Tools {
+			t.ToolMs += tool.DurationMs
+		}
+	}
+	return t
+}
+
+// saveTimeline stores the timeline of a turn and keeps its summary for the
+// caller of Run.
+func (a *sessionAgent) saveTimeline(ctx context.Context, r *timelineRecorder) {
+	timeline := r.finish()
+	a.timelines.Set(timeline.SessionID, timeline)
+	slog.Info("Turn timeline",
+		"session_id", timeline.SessionID,
+		"total_ms", timeline.TotalMs,
+		"model_ms", timeline.ModelMs,
+		"tool_ms", timeline.ToolMs,
+		"db_ms", timeline.DBMs,
+		"steps", len(timeline.Steps),
+	)
+	if a.dbQuerier == nil {
+		return
+	}
+
+	steps, err := json.Marshal(timeline.Steps)
+	if err != nil {
+		slog.Warn("Failed to encode turn timeline", "session_id", timeline.SessionID, "error", err)
+		return
+	}
+	summary := timeline.Summary()
+	if err := a.dbQuerier.CreateTurnTimeline(ctx, postgres.CreateTurnTimelineParams{
+		ID:            timeline.ID,
+		SessionID:     timeline.SessionID,
+		StartedAt:     timeline.StartedAt,
+		TotalMs:       timeline.TotalMs,
+		ModelMs:       timeline.ModelMs,
+		ToolMs:        timeline.ToolMs,
+		DbMs:          timeline.DBMs,
+		StepCount:     int32(summary.Steps),
+		ToolCallCount: int32(summary.ToolCalls),
+		Steps:         string(steps),
+	}); err != nil {
+		slog.Warn("Failed to save turn timeline", "session_id", timeline.SessionID, "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	messageIDs := r.messageIDs
+	r.mu.Unlock()
+	for _, messageID := range messageIDs {
+		if err := a.dbQuerier.AddTurnTimelineMessage(ctx, postgres.AddTurnTimelineMessageParams{
+			MessageID:  messageID,
+			TimelineID: timeline.ID,
+		}); err != nil {
+			slog.Warn("Failed to link message to turn timeline", "message_id", messageID, "error", err)
+		}
+	}
+	a.saveSteps(ctx, r, timeline)
+}
+
+func (a *sessionAgent) LastTimeline(sessionID string) (TurnTimeline, bool) {
+	return a.timelines.Take(sessionID)
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimelineRecorder(t *testing.T) {
+	t.Parallel()
+
+	clock := time.UnixMilli(1_000_000)
+	advance := func(ms int64) { clock = clock.Add(time.Duration(ms) * time.Millisecond) }
+
+	r := &timelineRecorder{now: func() time.Time { return clock }}
+	r.start = clock
+	r.timeline = TurnTimeline{ID: "t1", SessionID: "s1", StartedAt: clock.UnixMilli(), Steps: []TimelineStep{}}
+	r.addMessage("user")
+
+	// Step 0: the assistant message takes 5ms to create, the model answers
+	// after 200ms, streams for 1s and runs two tools
+	advance(10)
+	r.stepStarted("assistant-0", 5*time.Millisecond)
+	advance(200)
+	r.firstToken()
+	advance(800)
+	r.firstToken()
+	r.streamFinished()
+	advance(3000)
+	r.toolFinished("call-1", "bash", false)
+	advance(20)
+	r.persisted(20 * time.Millisecond)
+	advance(500)
+	r.toolFinished("call-2", "view", true)
+	r.persisted(0)
+	advance(30)
+	r.persisted(30 * time.Millisecond)
+
+	// Step 1: a final answer without tools
+	r.stepStarted("assistant-1", 0)
+	advance(100)
+	r.firstToken()
+	advance(100)
+	r.streamFinished()
+
+	timeline := r.finish()
+	require.Equal(t, int64(4760), timeline.TotalMs)
+	require.Equal(t, int64(1200), timeline.ModelMs)
+	require.Equal(t, int64(3500), timeline.ToolMs)
+	require.Equal(t, int64(55), timeline.DBMs)
+	require.Len(t, timeline.Steps, 2)
+
+	step := timeline.Steps[0]
+	require.Equal(t, "assistant-0", step.MessageID)
+	require.Equal(t, int64(5), step.StartMs)
+	require.Equal(t, int64(200), step.FirstTokenMs)
+	require.Equal(t, []TimelineTool{
+		{ToolCallID: "call-1", Name: "bash", StartMs: 1010, DurationMs: 3000},
+		{ToolCallID: "call-2", Name: "view", StartMs: 4030, DurationMs: 500, IsError: true},
+	}, step.Tools)
+	require.Equal(t, int64(100), timeline.Steps[1].FirstTokenMs)
+	require.Equal(t, []string{"user", "assistant-0", "assistant-1"}, r.messageIDs)
+
+	summary := timeline.Summary()
+	require.Equal(t, 2, summary.Steps)
+	require.Equal(t, 2, summary.ToolCalls)
+	require.Equal(t, "bash", summary.SlowestTool)
+	require.Equal(t, int64(3000), summary.SlowestToolMs)
+}
+
+func TestTimelineRecorderSteps(t *testing.T) {
+	t.Parallel()
+
+	clock := time.UnixMilli(1_000_000)
+	advance := func(ms int64) { clock = clock.Add(time.Duration(ms) * time.Millisecond) }
+
+	r := &timelineRecorder{now: func() time.Time { return clock }}
+	r.start = clock
+	r.timeline = TurnTimeline{ID: "t1", SessionID: "s1", StartedAt: clock.UnixMilli(), Steps: []TimelineStep{}}
+
+	// Step 0 is prepared in 40ms, runs a tool and finishes
+	r.prepareStarted()
+	advance(40)
+	r.stepStarted("assistant-0", 0)
+	r.stepPrepared(StepPrepare{Messages: 3, QueuedPrompts: 1}, "anthropic", "claude")
+	advance(100)
+	r.firstToken()
+	r.streamFinished()
+	advance(50)
+	r.toolFinished("call-1", "bash", false)
+	r.stepFinished("tool_use", fantasy.Usage{InputTokens: 100, OutputTokens: 20}, 0.5)
+
+	// Step 1 is cancelled before it finishes
+	r.prepareStarted()
+	advance(10)
+	r.stepStarted("assistant-1", 0)
+	r.stepPrepared(StepPrepare{Messages: 5, CompactedResults: 2}, "anthropic", "claude")
+
+	steps := r.steps(r.finish())
+	require.Len(t, steps, 2)
+
+	step := steps[0]
+	require.Equal(t, "assistant-0", step.MessageID)
+	require.Equal(t, "t1", step.TimelineID)
+	require.Equal(t, "s1", step.SessionID)
+	require.Equal(t, int64(1_000_040), step.StartedAt)
+	require.Equal(t, int64(40), step.PrepareMs)
+	require.Equal(t, int32(3), step.MessageCount)
+	require.Equal(t, int32(1), step.QueuedPrompts)
+	require.Equal(t, "claude", step.Model)
+	require.Equal(t, int64(100), step.FirstTokenMs)
+	require.Equal(t, "tool_use", step.FinishReason)
+	require.JSONEq(t, `[{"tool_call_id":"call-1","name":"bash","start_ms":140,"duration_ms":50}]`, step.ToolCalls)
+	require.Equal(t, int64(100), step.InputTokens)
+	require.Equal(t, 0.5, step.Cost)
+
+	step = steps[1]
+	require.Equal(t, int32(1), step.StepIndex)
+	require.Equal(t, int64(10), step.PrepareMs)
+	require.Equal(t, int32(2), step.CompactedResults)
+	require.Empty(t, step.FinishReason)
+	require.Equal(t, "[]", step.ToolCalls)
+}
@@ -0,0 +1,275 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/pkg/diff"
+	"github.com/rolling1314/rolling-crush/internal/pkg/filepathext"
+	"github.com/rolling1314/rolling-crush/internal/pkg/fsext"
+)
+
+type ApplyPatchParams struct {
+	Patch string `json:"patch" description:"The unified diff to apply, with --- and +++ file headers and @@ hunks"`
+}
+
+type ApplyPatchFile struct {
+	FilePath   string `json:"file_path"`
+	OldContent string `json:"old_content,omitempty"`
+	NewContent string `json:"new_content,omitempty"`
+	Additions  int    `json:"additions"`
+	Removals   int    `json:"removals"`
+}
+
+type ApplyPatchResponseMetadata struct {
+	Files     []ApplyPatchFile `json:"files"`
+	Additions int              `json:"additions"`
+	Removals  int              `json:"removals"`
+}
+
+const ApplyPatchToolName = "apply_patch"
+
+//go:embed apply_patch.md
+var applyPatchDescription []byte
+
+// patchTarget is a file patch located in the current content of its file.
+type patchTarget struct {
+	path       string
+	oldContent string
+	isCrlf     bool
+	hunks      []resolvedHunk
+	create     bool
+}
+
+func NewApplyPatchTool(permissions permission.Service, files history.Service, workingDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		ApplyPatchToolName,
+		string(applyPatchDescription),
+		func(ctx context.Context, params ApplyPatchParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if strings.TrimSpace(params.Patch) == "" {
+				return fantasy.NewTextErrorResponse("patch is required"), nil
+			}
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session ID is required for applying a patch")
+			}
+
+			patch, _ := fsext.ToUnixLineEndings(params.Patch)
+			patches, err := parsePatch(patch)
+			if err != nil {
+				return fantasy.NewTextErrorResponse("invalid patch: " + err.Error()), nil
+			}
+
+			edit := editContext{ctx, permissions, files, cmp.Or(GetWorkingDirFromContext(ctx), workingDir)}
+
+			// Every hunk is located before anything is written, so that a
+			// patch that does not apply leaves all files untouched
+			targets := make([]patchTarget, 0, len(patches))
+			for _, p := range patches {
+				target, errResp := resolvePatchTarget(edit, sessionID, p)
+				if errResp != nil {
+					return *errResp, nil
+				}
+				targets = append(targets, target)
+			}
+
+			var (
+				metadata ApplyPatchResponseMetadata
+				text     strings.Builder
+			)
+			for _, target := range targets {
+				file, note, err := applyPatchTarget(edit, sessionID, target, call)
+				if err != nil {
+					return fantasy.ToolResponse{}, err
+				}
+				if note != "" && file.FilePath == "" {
+					// Nothing was approved for this file
+					fmt.Fprintf(&text, "%s: %s\n", target.path, note)
+					continue
+				}
+				metadata.Files = append(metadata.Files, file)
+				metadata.Additions += file.Additions
+				metadata.Removals += file.Removals
+				if target.create {
+					fmt.Fprintf(&text, "File created: %s%s\n", target.path, note)
+				} else {
+					fmt.Fprintf(&text, "Patch applied to file: %s%s\n", target.path, note)
+				}
+			}
+
+			response := fmt.Sprintf("<result>\n%s</result>\n", text.String())
+			for _, file := range metadata.Files {
+				response += notifyLSPsAndGetSandboxDiagnostics(ctx, sessionID, file.FilePath)
+			}
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(response), metadata), nil
+		})
+}
+
+// resolvePatchTarget reads the file of a patch from the sandbox and locates
+// its hunks. Problems the model can fix are returned as an error response.
+func resolvePatchTarget(edit editContext, sessionID string, p filePatch) (patchTarget, *fantasy.ToolResponse) {
+	fail := func(format string, args ...any) (patchTarget, *fantasy.ToolResponse) {
+		resp := fantasy.NewTextErrorResponse(fmt.Sprintf(format, args...))
+		return patchTarget{}, &resp
+	}
+	if p.deletes() {
+		return fail("deleting files is not supported by apply_patch, use bash 'rm' to delete %s", p.OldPath)
+	}
+	if !p.creates() && p.OldPath != p.NewPath {
+		return fail("renaming files is not supported by apply_patch, use bash 'mv' to rename %s to %s first", p.OldPath, p.NewPath)
+	}
+
+	target := patchTarget{
+		path:   filepathext.SmartJoin(edit.workingDir, p.NewPath),
+		create: p.creates(),
+	}
+	resp, err := sandbox.GetDefaultClient().ReadFile(edit.ctx, sandbox.FileReadRequest{
+		SessionID: sessionID,
+		FilePath:  target.path,
+	})
+	switch {
+	case target.create && err == nil:
+		return fail("file already exists: %s", target.path)
+	case !target.create && err != nil:
+		return fail("file not found: %s", target.path)
+	case !target.create:
+		target.oldContent, target.isCrlf = fsext.ToUnixLineEndings(resp.Content)
+	}
+
+	for _, h := range p.Hunks {
+		if target.create && len(h.Old) > 0 {
+			return fail("the patch creating %s must only add lines", target.path)
+		}
+	}
+	target.hunks, err = resolveHunks(target.oldContent, p.Hunks)
+	if err != nil {
+		return fail("%s: %s", target.path, err)
+	}
+	return target, nil
+}
+
+// applyPatchTarget asks for permission to apply the hunks of a file, writes
+// the approved ones to the sandbox and stores a history version per hunk. A
+// note is returned for a partial or empty approval, with an empty file when
+// nothing was written.
+func applyPatchTarget(edit editContext, sessionID string, target patchTarget, call fantasy.ToolCall) (ApplyPatchFile, string, error) {
+	all := func(int) bool { return true }
+	newContent := applyResolvedHunks(target.oldContent, target.hunks, all)
+	hunks := permissionHunks(target.hunks)
+
+	action, description := "edit", fmt.Sprintf("Apply patch to %s", target.path)
+	if target.create {
+		action, description = "write", fmt.Sprintf("Create file %s", target.path)
+	}
+	granted, approved, err := RequestEditPermissionWithTimeout(
+		edit.ctx,
+		edit.permissions,
+		permission.CreatePermissionRequest{
+			SessionID:   sessionID,
+			Path:        fsext.PathOrPrefix(target.path, edit.workingDir),
+			ToolCallID:  call.ID,
+			ToolName:    ApplyPatchToolName,
+			Action:      action,
+			Description: description,
+			Params: EditPermissionsParams{
+				FilePath:   target.path,
+				OldContent: target.oldContent,
+				NewContent: newContent,
+				Hunks:      hunks,
+			},
+		},
+	)
+	if err != nil {
+		return ApplyPatchFile{}, "", err
+	}
+	if !granted {
+		return ApplyPatchFile{}, "", permission.ErrorPermissionDenied
+	}
+
+	// Approved indices are those of the patch hunks, a nil list approves all
+	selected, note := all, ""
+	if approved != nil {
+		approved = slices.Compact(slices.Sorted(slices.Values(approved)))
+		if len(approved) == 0 {
+			return ApplyPatchFile{}, fmt.Sprintf("the user approved none of the %d hunks, the file was not modified", len(hunks)), nil
+		}
+		if len(approved) < len(hunks) {
+			selected = func(i int) bool { return slices.Contains(approved, i) }
+			newContent = applyResolvedHunks(target.oldContent, target.hunks, selected)
+			note = rejectedHunksNote(hunks, approved)
+		}
+	}
+
+	written := newContent
+	if target.isCrlf {
+		written, _ = fsext.ToWindowsLineEndings(written)
+	}
+	_, err = sandbox.GetDefaultClient().WriteFile(edit.ctx, sandbox.FileWriteRequest{
+		SessionID: sessionID,
+		FilePath:  target.path,
+		Content:   written,
+	})
+	if err != nil {
+		return ApplyPatchFile{}, "", fmt.Errorf("failed to write file to sandbox: %w", err)
+	}
+
+	recordPatchHistory(edit, sessionID, target, selected)
+	recordFileWrite(target.path)
+	recordFileRead(target.path)
+
+	_, additions, removals := diff.GenerateDiff(
+		target.oldContent,
+		newContent,
+		strings.TrimPrefix(target.path, edit.workingDir),
+	)
+	return ApplyPatchFile{
+		FilePath:   target.path,
+		OldContent: target.oldContent,
+		NewContent: newContent,
+		Additions:  additions,
+		Removals:   removals,
+	}, note, nil
+}
+
+// recordPatchHistory stores a file history version after each applied hunk,
+// so that the hunks of a patch can be reverted one by one.
+func recordPatchHistory(edit editContext, sessionID string, target patchTarget, selected func(i int) bool) {
+	file, err := edit.files.GetByPathAndSession(edit.ctx, target.path, sessionID)
+	if err != nil {
+		_, err = edit.files.Create(edit.ctx, sessionID, target.path, target.oldContent)
+		if err != nil {
+			// Log error but don't fail the operation
+			slog.Error("Error creating file history", "error", err)
+		}
+	} else if file.Content != target.oldContent {
+		// User Manually changed the content store an intermediate version
+		_, err = edit.files.CreateVersion(edit.ctx, sessionID, target.path, target.oldContent)
+		if err != nil {
+			slog.Debug("Error creating file history version", "error", err)
+		}
+	}
+
+	var applied []int
+	for i := range target.hunks {
+		if !selected(i) {
+			continue
+		}
+		applied = append(applied, i)
+		content := applyResolvedHunks(target.oldContent, target.hunks, func(j int) bool {
+			return slices.Contains(applied, j)
+		})
+		_, err = edit.files.CreateVersion(edit.ctx, sessionID, target.path, content)
+		if err != nil {
+			slog.Error("Error creating file history version", "error", err, "hunk", i)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/diff"
+)
+
+const devNull = "/dev/null"
+
+// filePatch is the part of a unified diff that changes one file.
+type filePatch struct {
+	OldPath string
+	NewPath string
+	Hunks   []patchHunk
+}
+
+func (p filePatch) creates() bool { return p.OldPath == devNull }
+func (p filePatch) deletes() bool { return p.NewPath == devNull }
+
+// patchHunk is a hunk as written in the patch. Lines are stored without their
+// trailing newline.
+type patchHunk struct {
+	// OldStart is the 1-based line of the hunk in the original file, 0 when
+	// the header had no line numbers.
+	OldStart int
+	Old      []string
+	New      []string
+	// OldNoEOL and NewNoEOL are set by "\ No newline at end of file".
+	OldNoEOL bool
+	NewNoEOL bool
+	Body     string
+}
+
+// resolvedHunk is a hunk located in the content it applies to.
+type resolvedHunk struct {
+	patchHunk
+	Start int // 0-based index of the first replaced line
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parsePatch parses a unified diff, as produced by diff -u or git diff, into
+// the patches of each file. Hunk headers without line numbers ("@@ @@") are
+// accepted and located by their content.
+func parsePatch(patch string) ([]filePatch, error) {
+	lines := strings.Split(strings.TrimRight(patch, "\n"), "\n")
+	var patches []filePatch
+	for i := 0; i < len(lines); {
+		if !strings.HasPrefix(lines[i], "--- ") {
+			i++
+			continue
+		}
+		if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			return nil, fmt.Errorf("line %d: expected a +++ header after the --- header", i+2)
+		}
+		p := filePatch{
+			OldPath: patchPath(lines[i], "a/"),
+			NewPath: patchPath(lines[i+1], "b/"),
+		}
+		if p.OldPath == devNull && p.NewPath == devNull {
+			return nil, fmt.Errorf("line %d: both sides of the patch are /dev/null", i+1)
+		}
+		i += 2
+
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@") {
+			h, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			p.Hunks = append(p.Hunks, h)
+			i = next
+		}
+		if len(p.Hunks) == 0 {
+			return nil, fmt.Errorf("patch of %s has no hunks", p.displayPath())
+		}
+		patches = append(patches, p)
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers (--- and +++ lines) found, the patch must be a unified diff")
+	}
+	return patches, nil
+}
+
+// parseHunk parses the hunk whose header is at lines[i] and returns the
+// index of the line after it. With line counts in the header the body is
+// read by count, otherwise up to the next hunk or file header.
+func parseHunk(lines []string, i int) (patchHunk, int, error) {
+	header := lines[i]
+	var h patchHunk
+	oldCount, newCount := -1, -1
+	if m := hunkHeaderRe.FindStringSubmatch(header); m != nil {
+		h.OldStart, _ = strconv.Atoi(m[1])
+		oldCount, newCount = 1, 1
+		if m[2] != "" {
+			oldCount, _ = strconv.Atoi(m[2])
+		}
+		if m[4] != "" {
+			newCount, _ = strconv.Atoi(m[4])
+		}
+	} else if strings.Trim(strings.SplitN(header, "@@", 3)[1], " ") != "" {
+		return h, 0, fmt.Errorf("line %d: malformed hunk header %q", i+1, header)
+	}
+	i++
+
+	var body strings.Builder
+	counted := oldCount >= 0
+	lastOld, lastNew := false, false
+	for i < len(lines) {
+		line := lines[i]
+		if counted && len(h.Old) >= oldCount && len(h.New) >= newCount && !strings.HasPrefix(line, `\`) {
+			break
+		}
+		if !counted && (strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "diff ") ||
+			(strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "))) {
+			break
+		}
+
+		switch {
+		case line == "" || line[0] == ' ':
+			// Editors and models often strip the space of empty context lines
+			text := strings.TrimPrefix(line, " ")
+			h.Old = append(h.Old, text)
+			h.New = append(h.New, text)
+			lastOld, lastNew = true, true
+			line = " " + text
+		case line[0] == '-':
+			h.Old = append(h.Old, line[1:])
+			lastOld, lastNew = true, false
+		case line[0] == '+':
+			h.New = append(h.New, line[1:])
+			lastOld, lastNew = false, true
+		case line[0] == '\\':
+			h.OldNoEOL = h.OldNoEOL || lastOld
+			h.NewNoEOL = h.NewNoEOL || lastNew
+		default:
+			return h, 0, fmt.Errorf("line %d: unexpected line in hunk, lines must start with ' ', '-' or '+': %q", i+1, line)
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+		i++
+	}
+	if counted && (len(h.Old) != oldCount || len(h.New) != newCount) {
+		return h, 0, fmt.Errorf("hunk %q expects %d old and %d new lines but has %d and %d", header, oldCount, newCount, len(h.Old), len(h.New))
+	}
+	if len(h.Old) == 0 && len(h.New) == 0 {
+		return h, 0, fmt.Errorf("line %d: empty hunk", i)
+	}
+	h.Body = body.String()
+	return h, i, nil
+}
+
+// patchPath returns the path of a --- or +++ header, without the git a/ or
+// b/ prefix and the timestamp diff -u appends after a tab.
+func patchPath(header, gitPrefix string) string {
+	path := header[4:]
+	path, _, _ = strings.Cut(path, "\t")
+	path = strings.TrimSpace(path)
+	if path == devNull {
+		return path
+	}
+	return strings.TrimPrefix(path, gitPrefix)
+}
+
+func (p filePatch) displayPath() string {
+	if p.NewPath != devNull {
+		return p.NewPath
+	}
+	return p.OldPath
+}
+
+// resolveHunks locates the hunks of a patch in content. A hunk is matched
+// nearest to the line of its header, shifted by the drift of the previous
+// hunks, first exactly then ignoring trailing and finally surrounding
+// whitespace.
+func resolveHunks(content string, hunks []patchHunk) ([]resolvedHunk, error) {
+	lines := splitLines(content)
+	resolved := make([]resolvedHunk, 0, len(hunks))
+	cursor, drift := 0, 0
+	for i, h := range hunks {
+		expected := cursor
+		if h.OldStart > 0 {
+			expected = h.OldStart - 1 + drift
+			if len(h.Old) == 0 {
+				// "@@ -n,0" inserts after line n
+				expected = h.OldStart + drift
+			}
+		}
+		start := -1
+		if len(h.Old) == 0 {
+			start = min(max(expected, cursor), len(lines))
+		} else {
+			for _, norm := range []func(string) string{
+				func(s string) string { return s },
+				func(s string) string { return strings.TrimRight(s, " \t") },
+				strings.TrimSpace,
+			} {
+				if start = findBlock(lines, h.Old, cursor, expected, norm); start >= 0 {
+					break
+				}
+			}
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("hunk %d (%s) does not match the file content, read the file again and regenerate the patch", i, strings.SplitN(h.Body, "\n", 2)[0])
+		}
+		if h.OldStart > 0 {
+			drift = start - (h.OldStart - 1)
+			if len(h.Old) == 0 {
+				drift = start - h.OldStart
+			}
+		}
+		resolved = append(resolved, resolvedHunk{patchHunk: h, Start: start})
+		cursor = start + len(h.Old)
+	}
+	return resolved, nil
+}
+
+// findBlock returns the index of block in lines at or after from that is
+// nearest to expected, or -1.
+func findBlock(lines, block []string, from, expected int, norm func(string) string) int {
+	best := -1
+	for start := from; start+len(block) <= len(lines); start++ {
+		if !blockMatches(lines[start:start+len(block)], block, norm) {
+			continue
+		}
+		if best < 0 || abs(start-expected) < abs(best-expected) {
+			best = start
+		}
+		if start >= expected {
+			break
+		}
+	}
+	return best
+}
+
+func blockMatches(lines, block []string, norm func(string) string) bool {
+	for i, l := range block {
+		if norm(strings.TrimSuffix(lines[i], "\n")) != norm(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyResolvedHunks returns content with the selected hunks applied. When a
+// hunk replaces the end of the file, the final newline follows the patch if
+// it says so and the original content otherwise.
+func applyResolvedHunks(content string, hunks []resolvedHunk, selected func(i int) bool) string {
+	lines := splitLines(content)
+	origNoEOL := content != "" && !strings.HasSuffix(content, "\n")
+
+	var out strings.Builder
+	cursor := 0
+	for i, h := range hunks {
+		if !selected(i) {
+			continue
+		}
+		for _, l := range lines[cursor:h.Start] {
+			out.WriteString(l)
+		}
+		cursor = h.Start + len(h.Old)
+		atEOF := cursor == len(lines)
+		for j, l := range h.New {
+			out.WriteString(l)
+			last := j == len(h.New)-1
+			if !last || !atEOF || !(h.NewNoEOL || (origNoEOL && !h.OldNoEOL)) {
+				out.WriteString("\n")
+			}
+		}
+	}
+	for _, l := range lines[cursor:] {
+		out.WriteString(l)
+	}
+	return out.String()
+}
+
+// permissionHunks describes the resolved hunks for the permission request,
+// so that approved indices are the indices of the patch hunks.
+func permissionHunks(hunks []resolvedHunk) []diff.Hunk {
+	out := make([]diff.Hunk, len(hunks))
+	offset := 0
+	for i, h := range hunks {
+		out[i] = diff.Hunk{
+			Index:    i,
+			OldStart: h.Start + 1,
+			OldLines: len(h.Old),
+			NewStart: h.Start + 1 + offset,
+			NewLines: len(h.New),
+			Diff:     h.Body,
+		}
+		offset += len(h.New) - len(h.Old)
+	}
+	return out
+}
+
+// splitLines splits content into lines that keep their newline.
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func applyAll(t *testing.T, content, patch string) string {
+	t.Helper()
+	patches, err := parsePatch(patch)
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+	hunks, err := resolveHunks(content, patches[0].Hunks)
+	require.NoError(t, err)
+	return applyResolvedHunks(content, hunks, func(int) bool { return true })
+}
+
+func TestParsePatch(t *testing.T) {
+	patches, err := parsePatch(`diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@ package main
+ a
+-b
++B
+ c
+--- /dev/null	2024-01-01 00:00:00
++++ docs/new.md
+@@ -0,0 +1,2 @@
++# New
++file
+\ No newline at end of file
+`)
+	require.NoError(t, err)
+	require.Len(t, patches, 2)
+
+	require.Equal(t, "main.go", patches[0].OldPath)
+	require.Equal(t, "main.go", patches[0].NewPath)
+	require.Len(t, patches[0].Hunks, 1)
+	require.Equal(t, 1, patches[0].Hunks[0].OldStart)
+	require.Equal(t, []string{"a", "b", "c"}, patches[0].Hunks[0].Old)
+	require.Equal(t, []string{"a", "B", "c"}, patches[0].Hunks[0].New)
+
+	require.True(t, patches[1].creates())
+	require.Equal(t, "docs/new.md", patches[1].NewPath)
+	require.Equal(t, []string{"# New", "file"}, patches[1].Hunks[0].New)
+	require.True(t, patches[1].Hunks[0].NewNoEOL)
+	require.Equal(t, "# New\nfile", applyResolvedHunks("", []resolvedHunk{{patchHunk: patches[1].Hunks[0]}}, func(int) bool { return true }))
+}
+
+func TestParsePatchErrors(t *testing.T) {
+	for name, patch := range map[string]string{
+		"no headers":     "@@ -1 +1 @@\n-a\n+b\n",
+		"no hunks":       "--- a/x\n+++ b/x\n",
+		"bad count":      "--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n-a\n+b\n",
+		"bad line":       "--- a/x\n+++ b/x\n@@ -1 +1 @@\n*a\n",
+		"missing +++":    "--- a/x\n@@ -1 +1 @@\n-a\n+b\n",
+		"malformed head": "--- a/x\n+++ b/x\n@@ one @@\n-a\n+b\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parsePatch(patch)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestApplyPatchOffsetAndWhitespace(t *testing.T) {
+	content := "header\nextra\nfunc a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2   \n}\n"
+	// Line numbers are off by one and the second hunk lost a trailing space
+	patch := `--- a/f.go
++++ b/f.go
+@@ -2,3 +2,3 @@
+ func a() {
+-	return 1
++	return 10
+ }
+@@ -6,3 +6,4 @@
+ func b() {
+-	return 2
++	x := 2
++	return x
+ }
+`
+	require.Equal(t, "header\nextra\nfunc a() {\n\treturn 10\n}\n\nfunc b() {\n\tx := 2\n\treturn x\n}\n", applyAll(t, content, patch))
+}
+
+func TestApplyPatchWithoutLineNumbers(t *testing.T) {
+	content := "one\ntwo\nthree\n"
+	patch := "--- a/f\n+++ b/f\n@@ @@\n two\n-three\n+3\n"
+	require.Equal(t, "one\ntwo\n3\n", applyAll(t, content, patch))
+}
+
+func TestApplyPatchKeepsMissingFinalNewline(t *testing.T) {
+	content := "one\ntwo"
+	patch := "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n one\n-two\n+2\n"
+	require.Equal(t, "one\n2", applyAll(t, content, patch))
+}
+
+func TestApplyPatchNoMatch(t *testing.T) {
+	patches, err := parsePatch("--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n one\n-zwei\n+2\n")
+	require.NoError(t, err)
+	_, err = resolveHunks("one\ntwo\n", patches[0].Hunks)
+	require.Error(t, err)
+}
+
+func TestApplyPatchSelectedHunks(t *testing.T) {
+	content := "a\nb\nc\nd\ne\nf\ng\nh\ni\n"
+	patches, err := parsePatch("--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -8,2 +8,3 @@\n h\n-i\n+I\n+j\n")
+	require.NoError(t, err)
+	hunks, err := resolveHunks(content, patches[0].Hunks)
+	require.NoError(t, err)
+
+	require.Equal(t, "a\nb\nc\nd\ne\nf\ng\nh\nI\nj\n", applyResolvedHunks(content, hunks, func(i int) bool { return i == 1 }))
+
+	perm := permissionHunks(hunks)
+	require.Len(t, perm, 2)
+	require.Equal(t, 8, perm[1].OldStart)
+	require.Equal(t, 2, perm[1].OldLines)
+	require.Equal(t, 3, perm[1].NewLines)
+	require.Equal(t, " h\n-i\n+I\n+j\n", perm[1].Diff)
+}
@@ -7,6 +7,7 @@ import (
 	_ "embed"
 	"fmt"
 	"html/template"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -15,6 +16,7 @@ import (
 
 	"charm.land/fantasy"
 	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/rolling1314/rolling-crush/domain/job"
 	"github.com/rolling1314/rolling-crush/domain/permission"
 	"github.com/rolling1314/rolling-crush/infra/sandbox"
 	"github.com/rolling1314/rolling-crush/internal/shell"
@@ -25,6 +27,7 @@ type BashParams struct {
 	Command         string `json:"command" description:"The command to execute"`
 	WorkingDir      string `json:"working_dir,omitempty" description:"The working directory to execute the command in (defaults to current directory)"`
 	RunInBackground bool   `json:"run_in_background,omitempty" description:"Set to true (boolean) to run this command in the background. Use job_output to read the output later."`
+	Timeout         int    `json:"timeout,omitempty" description:"Optional timeout in seconds (default 120, max 600)"`
 }
 
 type BashPermissionsParams struct {
@@ -32,6 +35,7 @@ type BashPermissionsParams struct {
 	Command         string `json:"command"`
 	WorkingDir      string `json:"working_dir"`
 	RunInBackground bool   `json:"run_in_background"`
+	Timeout         int    `json:"timeout,omitempty"`
 }
 
 type BashResponseMetadata struct {
@@ -42,16 +46,42 @@ type BashResponseMetadata struct {
 	WorkingDirectory string `json:"working_directory"`
 	Background       bool   `json:"background,omitempty"`
 	ShellID          string `json:"shell_id,omitempty"`
+	TimedOut         bool   `json:"timed_out,omitempty"`
 }
 
 const (
 	BashToolName = "bash"
 
 	AutoBackgroundThreshold = 1 * time.Minute // Commands taking longer automatically become background jobs
+	DefaultBashTimeout      = 2 * time.Minute
+	MaxBashTimeout          = 10 * time.Minute
 	MaxOutputLength         = 30000
 	BashNoOutput            = "no output"
 )
 
+// bashEnv keeps the commands of the model from waiting on a pager or
+// writing terminal escape sequences.
+var bashEnv = map[string]string{
+	"TERM":      "dumb",
+	"PAGER":     "cat",
+	"GIT_PAGER": "cat",
+}
+
+// commandEnv returns the environment of a command: the variables of the
+// context, those of the session overriding the project ones, with bashEnv on
+// top.
+func commandEnv(ctx context.Context) map[string]string {
+	env, sessionEnv := GetEnvFromContext(ctx), GetSessionEnvFromContext(ctx)
+	if len(env) == 0 && len(sessionEnv) == 0 {
+		return bashEnv
+	}
+	merged := make(map[string]string, len(env)+len(sessionEnv)+len(bashEnv))
+	maps.Copy(merged, env)
+	maps.Copy(merged, sessionEnv)
+	maps.Copy(merged, bashEnv)
+	return merged
+}
+
 //go:embed bash.tpl
 var bashDescriptionTmpl []byte
 
@@ -63,6 +93,8 @@ var bashDescriptionTpl = template.Must(
 type bashDescriptionData struct {
 	BannedCommands  string
 	MaxOutputLength int
+	DefaultTimeout  int
+	MaxTimeout      int
 	Attribution     config.Attribution
 	ModelName       string
 }
@@ -146,6 +178,8 @@ func bashDescription(attribution *config.Attribution, modelName string) string {
 	if err := bashDescriptionTpl.Execute(&out, bashDescriptionData{
 		BannedCommands:  bannedCommandsStr,
 		MaxOutputLength: MaxOutputLength,
+		DefaultTimeout:  int(DefaultBashTimeout.Seconds()),
+		MaxTimeout:      int(MaxBashTimeout.Seconds()),
 		Attribution:     *attribution,
 		ModelName:       modelName,
 	}); err != nil {
@@ -187,7 +221,9 @@ func blockFuncs() []shell.BlockFunc {
 	}
 }
 
-func NewBashTool(permissions permission.Service, workingDir string, attribution *config.Attribution, modelName string) fantasy.AgentTool {
+// NewBashTool creates the bash tool. Without jobs, commands requested in the
+// background run in the foreground.
+func NewBashTool(permissions permission.Service, workingDir string, attribution *config.Attribution, modelName string, jobs job.Service) fantasy.AgentTool {
 	return fantasy.NewAgentTool(
 		BashToolName,
 		string(bashDescription(attribution, modelName)),
@@ -244,16 +280,39 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 				}
 			}
 
+			// Background jobs run detached in the sandbox container and outlive the WS server
+			if params.RunInBackground && jobs != nil {
+				startTime := time.Now()
+				bgJob, err := jobs.Start(ctx, sessionID, execWorkingDir, params.Command, params.Description)
+				if err != nil {
+					return fantasy.NewTextErrorResponse(err.Error()), nil
+				}
+				metadata := BashResponseMetadata{
+					StartTime:        startTime.UnixMilli(),
+					EndTime:          time.Now().UnixMilli(),
+					Description:      params.Description,
+					WorkingDirectory: execWorkingDir,
+					Background:       true,
+					ShellID:          bgJob.ID,
+				}
+				response := fmt.Sprintf("Background shell started with ID: %s\n\nUse job_output tool to view output or job_kill to terminate.", bgJob.ID)
+				return fantasy.WithResponseMetadata(fantasy.NewTextResponse(response), metadata), nil
+			}
+
 			// ============== 路由到沙箱服务 ==============
 			startTime := time.Now()
 			sandboxClient := sandbox.GetDefaultClient()
 
-			resp, err := sandboxClient.Execute(ctx, sandbox.ExecuteRequest{
+			// Output is streamed to the clients as the command runs
+			output := newToolOutputStream(sessionID, call.ID, BashToolName)
+			timeout := bashTimeout(params.Timeout)
+			resp, err := sandboxClient.Exec(ctx, sandbox.ExecRequest{
 				SessionID:  sessionID,
 				Command:    params.Command,
-				Language:   "bash",
+				Env:        commandEnv(ctx),
 				WorkingDir: execWorkingDir,
-			})
+				Timeout:    int(timeout.Seconds()),
+			}, output.write)
 
 			if err != nil {
 				return fantasy.ToolResponse{}, fmt.Errorf("sandbox execution error: %w", err)
@@ -267,7 +326,12 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 				stdout += resp.Stderr
 			}
 
-			if resp.ExitCode != 0 {
+			if resp.TimedOut {
+				if stdout != "" {
+					stdout += "\n"
+				}
+				stdout += fmt.Sprintf("Command timed out after %s and was terminated. Use a longer timeout or run_in_background for long-running commands", timeout)
+			} else if resp.ExitCode != 0 {
 				if stdout != "" {
 					stdout += "\n"
 				}
@@ -281,6 +345,7 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 				Description:      params.Description,
 				WorkingDirectory: execWorkingDir,
 				Background:       params.RunInBackground,
+				TimedOut:         resp.TimedOut,
 			}
 
 			if stdout == "" {
@@ -470,6 +535,15 @@ func formatOutput(stdout, stderr string, execErr error) string {
 	return stdout
 }
 
+// bashTimeout returns the timeout of a command from the timeout parameter in
+// seconds, the default when unset and at most MaxBashTimeout.
+func bashTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return DefaultBashTimeout
+	}
+	return min(time.Duration(seconds)*time.Second, MaxBashTimeout)
+}
+
 func truncateOutput(content string) string {
 	if len(content) <= MaxOutputLength {
 		return content
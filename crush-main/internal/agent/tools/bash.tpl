@@ -10,13 +10,14 @@ Common shell builtins and core utils available on Windows.
 1. Directory Verification: If creating directories/files, use LS tool to verify parent exists
 2. Security Check: Banned commands ({{ .BannedCommands }}) return error - explain to user. Safe read-only commands execute without prompts
 3. Command Execution: Execute with proper quoting, capture output
-4. Auto-Background: Commands exceeding 1 minute automatically move to background and return shell ID
+4. Timeout: Commands are terminated after timeout seconds (default {{ .DefaultTimeout }}, max {{ .MaxTimeout }}) - use run_in_background for longer tasks
 5. Output Processing: Truncate if exceeds {{ .MaxOutputLength }} characters
 6. Return Result: Include errors, metadata with <cwd></cwd> tags
 </execution_steps>
 
 <usage_notes>
-- Command required, working_dir optional (defaults to current directory)
+- Command required, working_dir and timeout optional (defaults to current directory and {{ .DefaultTimeout }} seconds)
+- Commands run in the project container without a terminal: interactive prompts and pagers are not available
 - IMPORTANT: Use Grep/Glob/Agent tools instead of 'find'/'grep'. Use View/LS tools instead of 'cat'/'head'/'tail'/'ls'
 - Chain with ';' or '&&', avoid newlines except in quoted strings
 - Each command runs in independent shell (no state persistence between calls)
@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/internal/codeindex"
+)
+
+const CodeSearchToolName = "code_search"
+
+const (
+	defaultCodeSearchResults = 10
+	maxCodeSearchResults     = 30
+)
+
+//go:embed code_search.md
+var codeSearchDescription []byte
+
+type CodeSearchParams struct {
+	Query string `json:"query" description:"What the code you are looking for does, in natural language"`
+	Path  string `json:"path,omitempty" description:"Directory to search in, relative to the workspace root. Defaults to the whole workspace."`
+	Limit int    `json:"limit,omitempty" description:"Number of results to return (default: 10, max: 30)"`
+}
+
+type CodeSearchResponseMetadata struct {
+	NumberOfResults int  `json:"number_of_results"`
+	Indexing        bool `json:"indexing"`
+}
+
+// ProjectResolver returns the project of a session.
+type ProjectResolver func(ctx context.Context, sessionID string) (string, error)
+
+// NewCodeSearchTool returns the code_search tool, searching the index of the
+// project of the session.
+func NewCodeSearchTool(index *codeindex.Indexer, projectOf ProjectResolver) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		CodeSearchToolName,
+		string(codeSearchDescription),
+		func(ctx context.Context, params CodeSearchParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if strings.TrimSpace(params.Query) == "" {
+				return fantasy.NewTextErrorResponse("query is required"), nil
+			}
+			if params.Limit <= 0 {
+				params.Limit = defaultCodeSearchResults
+			}
+			params.Limit = min(params.Limit, maxCodeSearchResults)
+
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session ID is required for searching code")
+			}
+			projectID, err := projectOf(ctx, sessionID)
+			if err != nil || projectID == "" {
+				return fantasy.NewTextErrorResponse("code search needs a session with a project"), nil
+			}
+
+			results, err := index.Search(ctx, projectID, params.Query, params.Path, params.Limit)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("Error searching code: %v", err)), nil
+			}
+			indexing := index.Syncing(projectID)
+
+			var output strings.Builder
+			if len(results) == 0 {
+				output.WriteString("No indexed code found")
+				if indexing {
+					output.WriteString(", the workspace is still being indexed. Use Grep or Glob meanwhile.")
+				}
+			} else {
+				for i, r := range results {
+					if i > 0 {
+						output.WriteString("\n\n")
+					}
+					fmt.Fprintf(&output, "%s:%d-%d (score %.2f)\n%s", r.Path, r.StartLine, r.EndLine, r.Score, r.Content)
+				}
+				if indexing {
+					output.WriteString("\n\n(The workspace is still being indexed, some files may be missing.)")
+				}
+			}
+
+			return fantasy.WithResponseMetadata(
+				fantasy.NewTextResponse(output.String()),
+				CodeSearchResponseMetadata{
+					NumberOfResults: len(results),
+					Indexing:        indexing,
+				},
+			), nil
+		})
+}
@@ -6,6 +6,7 @@ import (
 	_ "embed"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 
 	"charm.land/fantasy"
@@ -31,6 +32,8 @@ type EditPermissionsParams struct {
 	FilePath   string `json:"file_path"`
 	OldContent string `json:"old_content,omitempty"`
 	NewContent string `json:"new_content,omitempty"`
+	// Hunks lets the approver accept only part of the change
+	Hunks []diff.Hunk `json:"hunks,omitempty"`
 }
 
 type EditResponseMetadata struct {
@@ -281,11 +284,12 @@ func deleteContent(edit editContext, filePath, oldString string, replaceAll bool
 		strings.TrimPrefix(filePath, edit.workingDir),
 	)
 
-	if isCrlf {
-		newContent, _ = fsext.ToWindowsLineEndings(newContent)
+	hunks, err := diff.Hunks(oldContent, newContent)
+	if err != nil {
+		return fantasy.ToolResponse{}, fmt.Errorf("failed to split diff into hunks: %w", err)
 	}
 
-	granted, err := RequestPermissionWithTimeoutSimple(
+	granted, approvedHunks, err := RequestEditPermissionWithTimeout(
 		edit.ctx,
 		edit.permissions,
 		permission.CreatePermissionRequest{
@@ -299,6 +303,7 @@ func deleteContent(edit editContext, filePath, oldString string, replaceAll bool
 				FilePath:   filePath,
 				OldContent: oldContent,
 				NewContent: newContent,
+				Hunks:      hunks,
 			},
 		},
 	)
@@ -309,6 +314,22 @@ func deleteContent(edit editContext, filePath, oldString string, replaceAll bool
 		return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
 	}
 
+	newContent, partialNote, err := applyApprovedHunks(oldContent, newContent, hunks, approvedHunks)
+	if err != nil {
+		return fantasy.NewTextErrorResponse(err.Error()), nil
+	}
+	if partialNote != "" {
+		_, additions, removals = diff.GenerateDiff(
+			oldContent,
+			newContent,
+			strings.TrimPrefix(filePath, edit.workingDir),
+		)
+	}
+
+	if isCrlf {
+		newContent, _ = fsext.ToWindowsLineEndings(newContent)
+	}
+
 	// 写回文件
 	_, err = sandboxClient.WriteFile(edit.ctx, sandbox.FileWriteRequest{
 		SessionID: sessionID,
@@ -345,7 +366,7 @@ func deleteContent(edit editContext, filePath, oldString string, replaceAll bool
 	recordFileRead(filePath)
 
 	return fantasy.WithResponseMetadata(
-		fantasy.NewTextResponse("Content deleted from file: "+filePath),
+		fantasy.NewTextResponse("Content deleted from file: "+filePath+partialNote),
 		EditResponseMetadata{
 			OldContent: oldContent,
 			NewContent: newContent,
@@ -409,11 +430,12 @@ func replaceContent(edit editContext, filePath, oldString, newString string, rep
 		strings.TrimPrefix(filePath, edit.workingDir),
 	)
 
-	if isCrlf {
-		newContent, _ = fsext.ToWindowsLineEndings(newContent)
+	hunks, err := diff.Hunks(oldContent, newContent)
+	if err != nil {
+		return fantasy.ToolResponse{}, fmt.Errorf("failed to split diff into hunks: %w", err)
 	}
 
-	granted, err := RequestPermissionWithTimeoutSimple(
+	granted, approvedHunks, err := RequestEditPermissionWithTimeout(
 		edit.ctx,
 		edit.permissions,
 		permission.CreatePermissionRequest{
@@ -427,6 +449,7 @@ func replaceContent(edit editContext, filePath, oldString, newString string, rep
 				FilePath:   filePath,
 				OldContent: oldContent,
 				NewContent: newContent,
+				Hunks:      hunks,
 			},
 		},
 	)
@@ -437,6 +460,22 @@ func replaceContent(edit editContext, filePath, oldString, newString string, rep
 		return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
 	}
 
+	newContent, partialNote, err := applyApprovedHunks(oldContent, newContent, hunks, approvedHunks)
+	if err != nil {
+		return fantasy.NewTextErrorResponse(err.Error()), nil
+	}
+	if partialNote != "" {
+		_, additions, removals = diff.GenerateDiff(
+			oldContent,
+			newContent,
+			strings.TrimPrefix(filePath, edit.workingDir),
+		)
+	}
+
+	if isCrlf {
+		newContent, _ = fsext.ToWindowsLineEndings(newContent)
+	}
+
 	// 写回文件
 	_, err = sandboxClient.WriteFile(edit.ctx, sandbox.FileWriteRequest{
 		SessionID: sessionID,
@@ -473,7 +512,7 @@ func replaceContent(edit editContext, filePath, oldString, newString string, rep
 	recordFileRead(filePath)
 
 	return fantasy.WithResponseMetadata(
-		fantasy.NewTextResponse("Content replaced in file: "+filePath),
+		fantasy.NewTextResponse("Content replaced in file: "+filePath+partialNote),
 		EditResponseMetadata{
 			OldContent: oldContent,
 			NewContent: newContent,
@@ -481,3 +520,47 @@ func replaceContent(edit editContext, filePath, oldString, newString string, rep
 			Removals:   removals,
 		}), nil
 }
+
+// applyApprovedHunks narrows an edit to the hunks the user approved. It returns
+// the content to write and, for a partial approval, a note telling the model
+// which hunks were left out. A nil approved list means the whole edit landed.
+func applyApprovedHunks(oldContent, newContent string, hunks []diff.Hunk, approved []int) (string, string, error) {
+	if approved == nil {
+		return newContent, "", nil
+	}
+	approved = slices.Compact(slices.Sorted(slices.Values(approved)))
+	for _, i := range approved {
+		if i < 0 || i >= len(hunks) {
+			return "", "", fmt.Errorf("approved hunk %d is out of range, the edit has %d hunks, the file was not modified", i, len(hunks))
+		}
+	}
+	// The approved hunks are distinct and in range, all of them were approved
+	// when there are as many
+	if len(approved) == len(hunks) {
+		return newContent, "", nil
+	}
+	if len(approved) == 0 {
+		return "", "", fmt.Errorf("the user approved none of the %d hunks, the file was not modified", len(hunks))
+	}
+
+	content, err := diff.ApplyHunks(oldContent, newContent, approved)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to apply the approved hunks: %w", err)
+	}
+	return content, rejectedHunksNote(hunks, approved), nil
+}
+
+// rejectedHunksNote tells the model which hunks of a partially approved edit
+// were left out. approved must be sorted.
+func rejectedHunksNote(hunks []diff.Hunk, approved []int) string {
+	var note strings.Builder
+	fmt.Fprintf(&note, "\n\nThe user approved only %d of %d hunks. Only the approved hunks were applied; the following hunks were rejected and are NOT in the file:\n", len(approved), len(hunks))
+	for _, h := range hunks {
+		if slices.Contains(approved, h.Index) {
+			continue
+		}
+		fmt.Fprintf(&note, "<rejected_hunk index=\"%d\">\n@@ -%d,%d +%d,%d @@\n%s</rejected_hunk>\n", h.Index, h.OldStart, h.OldLines, h.NewStart, h.NewLines, h.Diff)
+	}
+	note.WriteString("Read the file again before making further edits to it.")
+	return note.String()
+}
@@ -0,0 +1,43 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/diff"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyApprovedHunks(t *testing.T) {
+	oldContent := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	newContent := "A\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nL\n"
+	hunks, err := diff.Hunks(oldContent, newContent)
+	require.NoError(t, err)
+	require.Len(t, hunks, 2)
+
+	for name, tc := range map[string]struct {
+		approved []int
+		content  string
+		partial  bool
+		wantErr  bool
+	}{
+		"not reviewed":       {approved: nil, content: newContent},
+		"all":                {approved: []int{1, 0}, content: newContent},
+		"all with duplicate": {approved: []int{0, 1, 1}, content: newContent},
+		"first":              {approved: []int{0}, content: "A\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n", partial: true},
+		"second":             {approved: []int{1, 1}, content: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nL\n", partial: true},
+		"none":               {approved: []int{}, wantErr: true},
+		"out of range":       {approved: []int{0, 7}, wantErr: true},
+		"negative":           {approved: []int{-1, 0, 1}, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			content, note, err := applyApprovedHunks(oldContent, newContent, hunks, tc.approved)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.content, content)
+			require.Equal(t, tc.partial, note != "")
+		})
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"cmp"
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -22,7 +22,9 @@ const FetchToolName = "fetch"
 //go:embed fetch.md
 var fetchDescription []byte
 
-func NewFetchTool(permissions permission.Service, workingDir string, client *http.Client) fantasy.AgentTool {
+// NewFetchTool creates the fetch tool. The cache is optional and shares
+// fetched pages between sessions.
+func NewFetchTool(permissions permission.Service, workingDir string, client *http.Client, cache FetchCache) fantasy.AgentTool {
 	if client == nil {
 		client = &http.Client{
 			Timeout: 30 * time.Second,
@@ -41,6 +43,7 @@ func NewFetchTool(permissions permission.Service, workingDir string, client *htt
 			if params.URL == "" {
 				return fantasy.NewTextErrorResponse("URL parameter is required"), nil
 			}
+			params.URL = expandSessionEnv(ctx, params.URL)
 
 			format := strings.ToLower(params.Format)
 			if format != "text" && format != "markdown" && format != "html" {
@@ -91,36 +94,31 @@ func NewFetchTool(permissions permission.Service, workingDir string, client *htt
 				defer cancel()
 			}
 
-			req, err := http.NewRequestWithContext(requestCtx, "GET", params.URL, nil)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("failed to create request: %w", err)
-			}
-
-			req.Header.Set("User-Agent", "crush/1.0")
-
-			resp, err := client.Do(req)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("failed to fetch URL: %w", err)
-			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode != http.StatusOK {
-				return fantasy.NewTextErrorResponse(fmt.Sprintf("Request failed with status code: %d", resp.StatusCode)), nil
+			page, err := fetchPage(requestCtx, client, cache, params.URL)
+			var statusErr *fetchError
+			if errors.As(err, &statusErr) {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("Request failed with status code: %d", statusErr.StatusCode)), nil
 			}
-
-			maxSize := int64(5 * 1024 * 1024) // 5MB
-			body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
 			if err != nil {
-				return fantasy.NewTextErrorResponse("Failed to read response body: " + err.Error()), nil
+				return fantasy.ToolResponse{}, err
 			}
 
-			content := string(body)
+			content := page.Body
 
 			isValidUt8 := utf8.ValidString(content)
 			if !isValidUt8 {
 				return fantasy.NewTextErrorResponse("Response content is not valid UTF-8"), nil
 			}
-			contentType := resp.Header.Get("Content-Type")
+			contentType := page.ContentType
+
+			// Keep only the main content of articles unless the whole page is asked for
+			if format != "html" && !params.Raw && strings.Contains(contentType, "text/html") {
+				readable, err := extractReadableHTML(content)
+				if err != nil {
+					return fantasy.NewTextErrorResponse("Failed to extract content from HTML: " + err.Error()), nil
+				}
+				content = readable
+			}
 
 			switch format {
 			case "text":
@@ -165,6 +163,8 @@ func NewFetchTool(permissions permission.Service, workingDir string, client *htt
 			if contentSize > MaxReadSize {
 				content = content[:MaxReadSize]
 				content += fmt.Sprintf("\n\n[Content truncated to %d bytes]", MaxReadSize)
+			} else if page.Truncated {
+				content += fmt.Sprintf("\n\n[Response truncated to %d bytes]", MaxFetchBodySize)
 			}
 
 			return fantasy.NewTextResponse(content), nil
@@ -0,0 +1,167 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxFetchBodySize is the largest response body read by the fetch tool.
+	MaxFetchBodySize = 5 * 1024 * 1024
+	// MaxFetchCacheEntrySize is the largest response body kept in the fetch cache.
+	MaxFetchCacheEntrySize = 1024 * 1024
+	// FetchCacheTTL is how long fetched pages are kept for revalidation.
+	FetchCacheTTL = 24 * time.Hour
+)
+
+// FetchCache stores fetched pages so that sessions share them. Get returns a
+// nil value on a miss.
+type FetchCache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// fetchedPage is a response body as cached by the fetch tool.
+type fetchedPage struct {
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+	// Truncated reports that the body was cut at MaxFetchBodySize.
+	Truncated bool `json:"truncated,omitempty"`
+	// Cached reports that the body was served from the cache.
+	Cached bool `json:"-"`
+}
+
+// fetchError is a non-OK HTTP status returned by fetchPage.
+type fetchError struct {
+	StatusCode int
+}
+
+func (e *fetchError) Error() string {
+	return fmt.Sprintf("request failed with status code: %d", e.StatusCode)
+}
+
+// fetchCacheKeys returns the key holding the last ETag seen for a URL and the
+// key of the page stored for that URL and ETag.
+func fetchCacheKeys(url, etag string) (etagKey, pageKey string) {
+	urlSum := sha256.Sum256([]byte(url))
+	pageSum := sha256.Sum256([]byte(url + "\n" + etag))
+	return "etag:" + hex.EncodeToString(urlSum[:]), "page:" + hex.EncodeToString(pageSum[:])
+}
+
+// fetchPage GETs a URL. With a cache, the request is conditional on the last
+// ETag seen for the URL and a 304 response is served from the cache; pages
+// with an ETag are stored under their URL and ETag.
+func fetchPage(ctx context.Context, client *http.Client, cache FetchCache, url string) (fetchedPage, error) {
+	var etag string
+	if cache != nil {
+		etagKey, _ := fetchCacheKeys(url, "")
+		value, err := cache.Get(ctx, etagKey)
+		if err != nil {
+			slog.Warn("Failed to read fetch cache", "url", url, "error", err)
+		}
+		etag = string(value)
+	}
+
+	page, status, respETag, err := doFetch(ctx, client, url, etag)
+	if err != nil {
+		return fetchedPage{}, err
+	}
+
+	if status == http.StatusNotModified {
+		_, pageKey := fetchCacheKeys(url, etag)
+		if cached, ok := loadCachedPage(ctx, cache, pageKey); ok {
+			return cached, nil
+		}
+		// The page expired before its ETag, fetch it again unconditionally
+		page, status, respETag, err = doFetch(ctx, client, url, "")
+		if err != nil {
+			return fetchedPage{}, err
+		}
+	}
+	if status != http.StatusOK {
+		return fetchedPage{}, &fetchError{StatusCode: status}
+	}
+
+	if cache != nil && respETag != "" && !page.Truncated && len(page.Body) <= MaxFetchCacheEntrySize {
+		storeCachedPage(ctx, cache, url, respETag, page)
+	}
+	return page, nil
+}
+
+// doFetch performs the request and reads at most MaxFetchBodySize bytes.
+func doFetch(ctx context.Context, client *http.Client, url, etag string) (fetchedPage, int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fetchedPage{}, 0, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "crush/1.0")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fetchedPage{}, 0, "", fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fetchedPage{}, resp.StatusCode, "", nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxFetchBodySize+1))
+	if err != nil {
+		return fetchedPage{}, 0, "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	page := fetchedPage{ContentType: resp.Header.Get("Content-Type")}
+	if len(body) > MaxFetchBodySize {
+		body = body[:MaxFetchBodySize]
+		page.Truncated = true
+	}
+	page.Body = string(body)
+	return page, resp.StatusCode, resp.Header.Get("ETag"), nil
+}
+
+func loadCachedPage(ctx context.Context, cache FetchCache, key string) (fetchedPage, bool) {
+	if cache == nil {
+		return fetchedPage{}, false
+	}
+	value, err := cache.Get(ctx, key)
+	if err != nil {
+		slog.Warn("Failed to read fetch cache", "error", err)
+		return fetchedPage{}, false
+	}
+	if value == nil {
+		return fetchedPage{}, false
+	}
+	var page fetchedPage
+	if err := json.Unmarshal(value, &page); err != nil {
+		return fetchedPage{}, false
+	}
+	page.Cached = true
+	return page, true
+}
+
+func storeCachedPage(ctx context.Context, cache FetchCache, url, etag string, page fetchedPage) {
+	data, err := json.Marshal(page)
+	if err != nil {
+		return
+	}
+	etagKey, pageKey := fetchCacheKeys(url, etag)
+	if err := cache.Set(ctx, pageKey, data, FetchCacheTTL); err != nil {
+		slog.Warn("Failed to write fetch cache", "url", url, "error", err)
+		return
+	}
+	if err := cache.Set(ctx, etagKey, []byte(etag), FetchCacheTTL); err != nil {
+		slog.Warn("Failed to write fetch cache", "url", url, "error", err)
+	}
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memoryFetchCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (c *memoryFetchCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key], nil
+}
+
+func (c *memoryFetchCache) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = value
+	return nil
+}
+
+func TestFetchPageRevalidatesWithETag(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<p>hello</p>"))
+	}))
+	defer server.Close()
+
+	cache := &memoryFetchCache{entries: make(map[string][]byte)}
+
+	page, err := fetchPage(t.Context(), server.Client(), cache, server.URL)
+	require.NoError(t, err)
+	require.False(t, page.Cached)
+	require.Equal(t, "<p>hello</p>", page.Body)
+
+	page, err = fetchPage(t.Context(), server.Client(), cache, server.URL)
+	require.NoError(t, err)
+	require.True(t, page.Cached)
+	require.Equal(t, "<p>hello</p>", page.Body)
+	require.Equal(t, "text/html", page.ContentType)
+	require.Equal(t, 2, requests)
+	require.Equal(t, 1, notModified)
+
+	// A lost page entry falls back to an unconditional request
+	_, pageKey := fetchCacheKeys(server.URL, `"v1"`)
+	delete(cache.entries, pageKey)
+	page, err = fetchPage(t.Context(), server.Client(), cache, server.URL)
+	require.NoError(t, err)
+	require.False(t, page.Cached)
+	require.Equal(t, 4, requests)
+}
+
+func TestFetchPageLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"big"`)
+		_, _ = w.Write([]byte(strings.Repeat("a", MaxFetchBodySize+10)))
+	}))
+	defer server.Close()
+
+	cache := &memoryFetchCache{entries: make(map[string][]byte)}
+
+	page, err := fetchPage(t.Context(), server.Client(), cache, server.URL)
+	require.NoError(t, err)
+	require.True(t, page.Truncated)
+	require.Len(t, page.Body, MaxFetchBodySize)
+	require.Empty(t, cache.entries, "oversized pages are not cached")
+
+	_, err = fetchPage(t.Context(), server.Client(), cache, server.URL+"/missing")
+	var statusErr *fetchError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+}
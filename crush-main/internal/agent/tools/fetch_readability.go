@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// boilerplateSelectors are removed before looking for the main content.
+const boilerplateSelectors = "script, style, noscript, template, iframe, svg, canvas, form, button, " +
+	"nav, header, footer, aside, dialog, " +
+	"[role=navigation], [role=banner], [role=contentinfo], [role=complementary], [role=dialog], " +
+	"[aria-hidden=true], [hidden]"
+
+// unlikelyContent matches class and id names of navigation, ads and other
+// page chrome. likelyContent rescues elements that also look like content.
+var (
+	unlikelyContent = regexp.MustCompile(`(?i)(^|[-_\s])(ad|ads|advert|banner|breadcrumbs?|comments?|cookie|consent|footer|header|menu|modal|nav|navbar|newsletter|outbrain|pagination|popup|promo|related|share|sharing|sidebar|social|sponsor(ed)?|subscribe|taboola|toolbar|widget)([-_\s]|$)`)
+	likelyContent   = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text`)
+)
+
+// mainContentSelectors are tried in order before falling back to scoring.
+var mainContentSelectors = []string{"article", "main", "[role=main]", "[itemprop=articleBody]"}
+
+// extractReadableHTML strips navigation, ads and other boilerplate from an
+// HTML page and returns the HTML of its main content, preceded by the page
+// title as a heading.
+func extractReadableHTML(page string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		return "", err
+	}
+
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+
+	body := doc.Find("body")
+	body.Find(boilerplateSelectors).Remove()
+	body.Find("*").Each(func(_ int, s *goquery.Selection) {
+		names := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikelyContent.MatchString(names) && !likelyContent.MatchString(names) {
+			s.Remove()
+		}
+	})
+
+	content := mainContent(body)
+	inner, err := content.Html()
+	if err != nil {
+		return "", err
+	}
+
+	if title != "" && content.Find("h1").Length() == 0 {
+		inner = "<h1>" + html.EscapeString(title) + "</h1>\n" + inner
+	}
+	return inner, nil
+}
+
+// mainContent returns the element holding the main content: the largest
+// semantic article container when there is one, otherwise the block with the
+// most paragraph text that is not links.
+func mainContent(body *goquery.Selection) *goquery.Selection {
+	for _, selector := range mainContentSelectors {
+		var best *goquery.Selection
+		bestLen := 0
+		body.Find(selector).Each(func(_ int, s *goquery.Selection) {
+			if n := len(strings.TrimSpace(s.Text())); n > bestLen {
+				best, bestLen = s, n
+			}
+		})
+		if best != nil && bestLen > 0 {
+			return best
+		}
+	}
+
+	best := body
+	bestScore := 0.0
+	body.Find("div, section, td").Each(func(_ int, s *goquery.Selection) {
+		if score := contentScore(s); score > bestScore {
+			best, bestScore = s, score
+		}
+	})
+	return best
+}
+
+// contentScore rates an element by the text of its direct paragraphs,
+// penalized by the share of that text inside links.
+func contentScore(s *goquery.Selection) float64 {
+	var textLen, linkLen int
+	s.ChildrenFiltered("p, pre, blockquote, ul, ol").Each(func(_ int, p *goquery.Selection) {
+		textLen += len(strings.TrimSpace(p.Text()))
+		linkLen += len(strings.TrimSpace(p.Find("a").Text()))
+	})
+	if textLen == 0 {
+		return 0
+	}
+	linkDensity := float64(linkLen) / float64(textLen)
+	return float64(textLen) * (1 - linkDensity)
+}
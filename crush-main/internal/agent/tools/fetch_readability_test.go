@@ -0,0 +1,38 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractReadableHTML(t *testing.T) {
+	t.Run("article", func(t *testing.T) {
+		page := `<html><head><title>Release notes</title><script>track()</script></head><body>
+<nav><a href="/">Home</a><a href="/docs">Docs</a></nav>
+<div class="ad-banner">Buy now</div>
+<article><h2>Version 2</h2><p>The parser is faster.</p><div class="share-buttons">Share</div></article>
+<footer>Copyright</footer>
+</body></html>`
+		out, err := extractReadableHTML(page)
+		require.NoError(t, err)
+		require.Contains(t, out, "<h1>Release notes</h1>")
+		require.Contains(t, out, "The parser is faster.")
+		require.NotContains(t, out, "Home")
+		require.NotContains(t, out, "Buy now")
+		require.NotContains(t, out, "Share")
+		require.NotContains(t, out, "Copyright")
+		require.NotContains(t, out, "track()")
+	})
+
+	t.Run("scored block", func(t *testing.T) {
+		page := `<html><body>
+<div id="links"><p><a href="/a">A long list of links to other pages of the site</a></p></div>
+<div class="post-body"><p>First paragraph of the story with enough words.</p><p>Second paragraph.</p></div>
+</body></html>`
+		out, err := extractReadableHTML(page)
+		require.NoError(t, err)
+		require.Contains(t, out, "First paragraph")
+		require.NotContains(t, out, "other pages")
+	})
+}
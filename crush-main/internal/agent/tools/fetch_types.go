@@ -31,6 +31,7 @@ type FetchParams struct {
 	URL     string `json:"url" description:"The URL to fetch content from"`
 	Format  string `json:"format" description:"The format to return the content in (text, markdown, or html)"`
 	Timeout int    `json:"timeout,omitempty" description:"Optional timeout in seconds (max 120)"`
+	Raw     bool   `json:"raw,omitempty" description:"Return the whole page instead of its main content (text and markdown formats only)"`
 }
 
 // FetchPermissionsParams defines the permission parameters for the simple fetch tool.
@@ -38,4 +39,5 @@ type FetchPermissionsParams struct {
 	URL     string `json:"url"`
 	Format  string `json:"format"`
 	Timeout int    `json:"timeout,omitempty"`
+	Raw     bool   `json:"raw,omitempty"`
 }
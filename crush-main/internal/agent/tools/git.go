@@ -0,0 +1,319 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+const (
+	GitStatusToolName   = "git_status"
+	GitDiffToolName     = "git_diff"
+	GitCommitToolName   = "git_commit"
+	GitBranchToolName   = "git_branch"
+	GitCheckoutToolName = "git_checkout"
+)
+
+var (
+	//go:embed git_status.md
+	gitStatusDescription []byte
+	//go:embed git_diff.md
+	gitDiffDescription []byte
+	//go:embed git_commit.md
+	gitCommitDescription []byte
+	//go:embed git_branch.md
+	gitBranchDescription []byte
+	//go:embed git_checkout.md
+	gitCheckoutDescription []byte
+)
+
+type GitStatusParams struct{}
+
+type GitDiffParams struct {
+	Staged bool   `json:"staged,omitempty" description:"Show the staged changes instead of the unstaged ones"`
+	Ref    string `json:"ref,omitempty" description:"Compare the working tree (or the index with staged) to this commit, branch or tag"`
+	Path   string `json:"path,omitempty" description:"Limit the diff to this file or directory"`
+}
+
+type GitCommitParams struct {
+	Message string   `json:"message" description:"The commit message"`
+	Files   []string `json:"files,omitempty" description:"Files to stage before committing"`
+	All     bool     `json:"all,omitempty" description:"Stage every change of the working tree, including new files, before committing"`
+}
+
+type GitBranchParams struct {
+	Name       string `json:"name,omitempty" description:"Name of the branch to create (default: list the branches)"`
+	StartPoint string `json:"start_point,omitempty" description:"Commit, branch or tag the new branch starts from (default: HEAD)"`
+}
+
+type GitCheckoutParams struct {
+	Ref    string `json:"ref" description:"The branch, tag or commit to check out"`
+	Create bool   `json:"create,omitempty" description:"Create the branch ref from HEAD before checking it out"`
+}
+
+type GitPermissionsParams struct {
+	Command string `json:"command"`
+	// Message is the full commit message, attribution included
+	Message string `json:"message,omitempty"`
+}
+
+type GitResponseMetadata struct {
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Command   string `json:"command"`
+	Output    string `json:"output"`
+	ExitCode  int    `json:"exit_code"`
+}
+
+// gitCommand is a git invocation prepared by a tool of the git family.
+type gitCommand struct {
+	action      string
+	description string
+	script      string
+	message     string
+}
+
+// newGitTool creates a tool of the git family. prepare validates the call and
+// returns the command to run, or an error shown to the model.
+func newGitTool[P any](permissions permission.Service, workingDir, name string, description []byte, prepare func(P) (gitCommand, error)) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		name,
+		string(description),
+		func(ctx context.Context, params P, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, errors.New("session ID is required for running git")
+			}
+			execWorkingDir := cmp.Or(GetWorkingDirFromContext(ctx), workingDir)
+
+			cmd, err := prepare(params)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+
+			granted, err := RequestPermissionWithTimeoutSimple(
+				ctx,
+				permissions,
+				permission.CreatePermissionRequest{
+					SessionID:   sessionID,
+					ToolCallID:  call.ID,
+					Path:        execWorkingDir,
+					ToolName:    name,
+					Action:      cmd.action,
+					Description: cmd.description,
+					Params:      GitPermissionsParams{Command: cmd.script, Message: cmd.message},
+				},
+			)
+			if err != nil {
+				return fantasy.ToolResponse{}, err
+			}
+			if !granted {
+				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+			}
+
+			startTime := time.Now()
+			resp, err := sandbox.GetDefaultClient().Execute(ctx, sandbox.ExecuteRequest{
+				SessionID:  sessionID,
+				Command:    cmd.script,
+				Language:   "bash",
+				WorkingDir: execWorkingDir,
+			})
+			if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("sandbox execution error: %w", err)
+			}
+
+			output := resp.Stdout
+			if resp.Stderr != "" {
+				if output != "" {
+					output += "\n"
+				}
+				output += resp.Stderr
+			}
+			if resp.ExitCode != 0 {
+				if output != "" {
+					output += "\n"
+				}
+				output += fmt.Sprintf("Exit code %d", resp.ExitCode)
+			}
+			output = truncateOutput(strings.TrimRight(output, "\n"))
+
+			metadata := GitResponseMetadata{
+				StartTime: startTime.UnixMilli(),
+				EndTime:   time.Now().UnixMilli(),
+				Command:   cmd.script,
+				Output:    output,
+				ExitCode:  resp.ExitCode,
+			}
+			if output == "" {
+				output = BashNoOutput
+			}
+			if resp.ExitCode != 0 {
+				return fantasy.WithResponseMetadata(fantasy.NewTextErrorResponse(output), metadata), nil
+			}
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(output), metadata), nil
+		})
+}
+
+func NewGitStatusTool(permissions permission.Service, workingDir string) fantasy.AgentTool {
+	return newGitTool(permissions, workingDir, GitStatusToolName, gitStatusDescription, func(GitStatusParams) (gitCommand, error) {
+		return gitCommand{
+			action:      "status",
+			description: "Show the git status of the project",
+			script:      gitScript("status", "--short", "--branch"),
+		}, nil
+	})
+}
+
+func NewGitDiffTool(permissions permission.Service, workingDir string) fantasy.AgentTool {
+	return newGitTool(permissions, workingDir, GitDiffToolName, gitDiffDescription, func(params GitDiffParams) (gitCommand, error) {
+		args := []string{"diff"}
+		if params.Staged {
+			args = append(args, "--cached")
+		}
+		if params.Ref != "" {
+			if err := validateGitRef(params.Ref); err != nil {
+				return gitCommand{}, err
+			}
+			args = append(args, params.Ref)
+		}
+		if params.Path != "" {
+			args = append(args, "--", params.Path)
+		}
+		return gitCommand{
+			action:      "diff",
+			description: "Show the git diff of " + cmp.Or(params.Path, "the project"),
+			script:      gitScript(args...),
+		}, nil
+	})
+}
+
+// NewGitCommitTool creates the git_commit tool. The attribution trailers are
+// appended to the commit message as the bash tool instructs the model to.
+func NewGitCommitTool(permissions permission.Service, workingDir string, attribution *config.Attribution, modelName string) fantasy.AgentTool {
+	return newGitTool(permissions, workingDir, GitCommitToolName, gitCommitDescription, func(params GitCommitParams) (gitCommand, error) {
+		if strings.TrimSpace(params.Message) == "" {
+			return gitCommand{}, errors.New("message is required")
+		}
+		if params.All && len(params.Files) > 0 {
+			return gitCommand{}, errors.New("set either files or all, not both")
+		}
+
+		var script []string
+		switch {
+		case params.All:
+			script = append(script, gitScript("add", "--all"))
+		case len(params.Files) > 0:
+			script = append(script, gitScript(append([]string{"add", "--"}, params.Files...)...))
+		}
+		message := commitMessage(params.Message, attribution, modelName)
+		script = append(script, gitScript("commit", "--message", message), gitScript("log", "-1", "--stat", "--format=%H%n%s"))
+
+		subject, _, _ := strings.Cut(strings.TrimSpace(params.Message), "\n")
+		return gitCommand{
+			action:      "commit",
+			description: "Commit: " + subject,
+			script:      strings.Join(script, " && "),
+			message:     message,
+		}, nil
+	})
+}
+
+func NewGitBranchTool(permissions permission.Service, workingDir string) fantasy.AgentTool {
+	return newGitTool(permissions, workingDir, GitBranchToolName, gitBranchDescription, func(params GitBranchParams) (gitCommand, error) {
+		if params.Name == "" {
+			if params.StartPoint != "" {
+				return gitCommand{}, errors.New("start_point requires name")
+			}
+			return gitCommand{
+				action:      "branch",
+				description: "List the git branches",
+				script:      gitScript("branch", "--list", "--verbose"),
+			}, nil
+		}
+
+		args := []string{"branch", params.Name}
+		for _, ref := range []string{params.Name, params.StartPoint} {
+			if ref == "" {
+				continue
+			}
+			if err := validateGitRef(ref); err != nil {
+				return gitCommand{}, err
+			}
+		}
+		if params.StartPoint != "" {
+			args = append(args, params.StartPoint)
+		}
+		return gitCommand{
+			action:      "branch",
+			description: fmt.Sprintf("Create the git branch %s", params.Name),
+			script:      gitScript(args...),
+		}, nil
+	})
+}
+
+func NewGitCheckoutTool(permissions permission.Service, workingDir string) fantasy.AgentTool {
+	return newGitTool(permissions, workingDir, GitCheckoutToolName, gitCheckoutDescription, func(params GitCheckoutParams) (gitCommand, error) {
+		if params.Ref == "" {
+			return gitCommand{}, errors.New("ref is required")
+		}
+		if err := validateGitRef(params.Ref); err != nil {
+			return gitCommand{}, err
+		}
+		args := []string{"checkout", params.Ref, "--"}
+		description := fmt.Sprintf("Check out %s", params.Ref)
+		if params.Create {
+			args = []string{"checkout", "-b", params.Ref}
+			description = fmt.Sprintf("Create and check out the branch %s", params.Ref)
+		}
+		return gitCommand{
+			action:      "checkout",
+			description: description,
+			script:      gitScript(args...),
+		}, nil
+	})
+}
+
+// gitScript returns the shell command running git with args, without pager
+// or colors.
+func gitScript(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return "git --no-pager -c color.ui=never " + strings.Join(quoted, " ")
+}
+
+// validateGitRef rejects refs git would parse as options.
+func validateGitRef(ref string) error {
+	if strings.HasPrefix(ref, "-") || strings.ContainsAny(ref, " \t\n") {
+		return fmt.Errorf("invalid git ref %q", ref)
+	}
+	return nil
+}
+
+// commitMessage appends the lines of the configured attribution to message.
+func commitMessage(message string, attribution *config.Attribution, modelName string) string {
+	message = strings.TrimSpace(message)
+	if attribution == nil {
+		return message
+	}
+	if attribution.GeneratedWith {
+		message += "\n\n💘 Generated with Crush"
+	}
+	switch attribution.TrailerStyle {
+	case config.TrailerStyleAssistedBy:
+		message += fmt.Sprintf("\n\nAssisted-by: %s via Crush <crush@charm.land>", modelName)
+	case config.TrailerStyleCoAuthoredBy:
+		message += "\n\nCo-Authored-By: Crush <crush@charm.land>"
+	}
+	return message
+}
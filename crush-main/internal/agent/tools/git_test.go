@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitMessage(t *testing.T) {
+	require.Equal(t, "Fix the parser", commitMessage("  Fix the parser\n", nil, "model"))
+	require.Equal(t, "Fix the parser", commitMessage("Fix the parser", &config.Attribution{TrailerStyle: config.TrailerStyleNone}, "model"))
+	require.Equal(t,
+		"Fix the parser\n\n💘 Generated with Crush\n\nAssisted-by: gpt-5 via Crush <crush@charm.land>",
+		commitMessage("Fix the parser", &config.Attribution{TrailerStyle: config.TrailerStyleAssistedBy, GeneratedWith: true}, "gpt-5"),
+	)
+	require.Equal(t,
+		"Fix the parser\n\nCo-Authored-By: Crush <crush@charm.land>",
+		commitMessage("Fix the parser", &config.Attribution{TrailerStyle: config.TrailerStyleCoAuthoredBy}, "gpt-5"),
+	)
+}
+
+func TestGitScript(t *testing.T) {
+	require.Equal(t, `git --no-pager -c color.ui=never 'commit' '--message' 'it'\''s done'`, gitScript("commit", "--message", "it's done"))
+}
+
+func TestValidateGitRef(t *testing.T) {
+	require.NoError(t, validateGitRef("feature/parser"))
+	require.NoError(t, validateGitRef("HEAD~2"))
+	require.Error(t, validateGitRef("--output=/etc/passwd"))
+	require.Error(t, validateGitRef("main other"))
+}
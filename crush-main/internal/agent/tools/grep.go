@@ -97,11 +97,62 @@ type GrepResponseMetadata struct {
 const (
 	GrepToolName        = "grep"
 	maxGrepContentWidth = 500
+	maxGrepMatches      = 100
 )
 
 //go:embed grep.md
 var grepDescription []byte
 
+// truncateGrepOutput keeps at most maxMatches whole result lines of grep
+// output, clipping overly long lines at a word boundary. When matches are
+// dropped, an index of the files whose matches were omitted is appended so the
+// model knows where to narrow the search. It returns the output, the total
+// number of matches and whether the output was truncated.
+func truncateGrepOutput(output string, maxMatches int) (string, int, bool) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return "", 0, false
+	}
+
+	kept := lines[:min(len(lines), maxMatches)]
+	for i, line := range kept {
+		kept[i] = clipLine(line, maxGrepContentWidth)
+	}
+	result := strings.Join(kept, "\n")
+	if len(lines) <= maxMatches {
+		return result, len(lines), false
+	}
+
+	// Index omitted matches by file, in order of first appearance
+	var files []string
+	counts := make(map[string]int)
+	for _, line := range lines[maxMatches:] {
+		file, _, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		if counts[file] == 0 {
+			files = append(files, file)
+		}
+		counts[file]++
+	}
+
+	var sb strings.Builder
+	sb.WriteString(result)
+	fmt.Fprintf(&sb, "\n\n(Results are truncated: showing %d of %d matches. Consider using a more specific path or pattern.)", maxMatches, len(lines))
+	if len(files) > 0 {
+		sb.WriteString("\nOmitted matches by file:")
+		for i, file := range files {
+			if i == maxOmittedSymbols {
+				fmt.Fprintf(&sb, "\n  ... and %d more files", len(files)-maxOmittedSymbols)
+				break
+			}
+			fmt.Fprintf(&sb, "\n  - %s (%d)", file, counts[file])
+		}
+	}
+	return sb.String(), len(lines), true
+}
+
 // escapeRegexPattern escapes special regex characters so they're treated as literal characters
 func escapeRegexPattern(pattern string) string {
 	specialChars := []string{"\\", ".", "+", "*", "?", "(", ")", "[", "]", "{", "}", "^", "$", "|"}
@@ -148,19 +199,16 @@ func NewGrepTool(workingDir string) fantasy.AgentTool {
 				return fantasy.NewTextErrorResponse(fmt.Sprintf("Error searching files from sandbox: %v", err)), nil
 			}
 			
-			output := resp.Stdout
+			output, matchCount, truncated := truncateGrepOutput(resp.Stdout, maxGrepMatches)
 			if output == "" {
 				output = "No matches found"
 			}
 			
-			// 简单统计匹配数
-			matchCount := strings.Count(output, "\n")
-			
 			return fantasy.WithResponseMetadata(
 				fantasy.NewTextResponse(output),
 				GrepResponseMetadata{
 					NumberOfMatches: matchCount,
-					Truncated:       false,
+					Truncated:       truncated,
 				},
 			), nil
 			
@@ -3,10 +3,11 @@ package tools
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 
 	"charm.land/fantasy"
-	"github.com/rolling1314/rolling-crush/internal/shell"
+	"github.com/rolling1314/rolling-crush/domain/job"
 )
 
 const (
@@ -26,7 +27,7 @@ type JobKillResponseMetadata struct {
 	Description string `json:"description"`
 }
 
-func NewJobKillTool() fantasy.AgentTool {
+func NewJobKillTool(jobs job.Service) fantasy.AgentTool {
 	return fantasy.NewAgentTool(
 		JobKillToolName,
 		string(jobKillDescription),
@@ -34,22 +35,29 @@ func NewJobKillTool() fantasy.AgentTool {
 			if params.ShellID == "" {
 				return fantasy.NewTextErrorResponse("missing shell_id"), nil
 			}
+			if jobs == nil {
+				return fantasy.NewTextErrorResponse("background jobs are not available"), nil
+			}
 
-			bgManager := shell.GetBackgroundShellManager()
-
-			bgShell, ok := bgManager.Get(params.ShellID)
-			if !ok {
+			bgJob, err := jobs.Get(ctx, params.ShellID)
+			if errors.Is(err, job.ErrNotFound) || (err == nil && bgJob.SessionID != GetSessionFromContext(ctx)) {
 				return fantasy.NewTextErrorResponse(fmt.Sprintf("background shell not found: %s", params.ShellID)), nil
 			}
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
 
 			metadata := JobKillResponseMetadata{
 				ShellID:     params.ShellID,
-				Command:     bgShell.Command,
-				Description: bgShell.Description,
+				Command:     bgJob.Command,
+				Description: bgJob.Description,
 			}
 
-			err := bgManager.Kill(params.ShellID)
-			if err != nil {
+			if bgJob.Done() {
+				result := fmt.Sprintf("Background shell %s is already %s", params.ShellID, bgJob.Status)
+				return fantasy.WithResponseMetadata(fantasy.NewTextResponse(result), metadata), nil
+			}
+			if _, err := jobs.Kill(ctx, params.ShellID); err != nil {
 				return fantasy.NewTextErrorResponse(err.Error()), nil
 			}
 
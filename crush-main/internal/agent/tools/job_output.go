@@ -3,11 +3,12 @@ package tools
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"strings"
 
 	"charm.land/fantasy"
-	"github.com/rolling1314/rolling-crush/internal/shell"
+	"github.com/rolling1314/rolling-crush/domain/job"
 )
 
 const (
@@ -29,7 +30,7 @@ type JobOutputResponseMetadata struct {
 	WorkingDirectory string `json:"working_directory"`
 }
 
-func NewJobOutputTool() fantasy.AgentTool {
+func NewJobOutputTool(jobs job.Service) fantasy.AgentTool {
 	return fantasy.NewAgentTool(
 		JobOutputToolName,
 		string(jobOutputDescription),
@@ -37,49 +38,43 @@ func NewJobOutputTool() fantasy.AgentTool {
 			if params.ShellID == "" {
 				return fantasy.NewTextErrorResponse("missing shell_id"), nil
 			}
+			if jobs == nil {
+				return fantasy.NewTextErrorResponse("background jobs are not available"), nil
+			}
 
-			bgManager := shell.GetBackgroundShellManager()
-			bgShell, ok := bgManager.Get(params.ShellID)
-			if !ok {
+			bgJob, output, err := jobs.Output(ctx, params.ShellID)
+			if errors.Is(err, job.ErrNotFound) || (err == nil && bgJob.SessionID != GetSessionFromContext(ctx)) {
 				return fantasy.NewTextErrorResponse(fmt.Sprintf("background shell not found: %s", params.ShellID)), nil
 			}
-
-			stdout, stderr, done, err := bgShell.GetOutput()
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
 
 			var outputParts []string
-			if stdout != "" {
-				outputParts = append(outputParts, stdout)
+			if output != "" {
+				outputParts = append(outputParts, strings.TrimRight(output, "\n"))
 			}
-			if stderr != "" {
-				outputParts = append(outputParts, stderr)
-			}
-
-			status := "running"
-			if done {
-				status = "completed"
-				if err != nil {
-					exitCode := shell.ExitCode(err)
-					if exitCode != 0 {
-						outputParts = append(outputParts, fmt.Sprintf("Exit code %d", exitCode))
-					}
+			switch bgJob.Status {
+			case job.StatusCompleted:
+				if bgJob.ExitCode != nil && *bgJob.ExitCode != 0 {
+					outputParts = append(outputParts, fmt.Sprintf("Exit code %d", *bgJob.ExitCode))
 				}
+			case job.StatusLost:
+				outputParts = append(outputParts, "The process is gone without an exit code, e.g. because the sandbox container was restarted")
 			}
 
-			output := strings.Join(outputParts, "\n")
+			result := strings.Join(outputParts, "\n")
+			if result == "" {
+				result = BashNoOutput
+			}
 
 			metadata := JobOutputResponseMetadata{
 				ShellID:          params.ShellID,
-				Command:          bgShell.Command,
-				Description:      bgShell.Description,
-				Done:             done,
-				WorkingDirectory: bgShell.WorkingDir,
-			}
-
-			if output == "" {
-				output = BashNoOutput
+				Command:          bgJob.Command,
+				Description:      bgJob.Description,
+				Done:             bgJob.Done(),
+				WorkingDirectory: bgJob.WorkingDir,
 			}
-
-			result := fmt.Sprintf("Status: %s\n\n%s", status, output)
-			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(result), metadata), nil
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(fmt.Sprintf("Status: %s\n\n%s", bgJob.Status, result)), metadata), nil
 		})
 }
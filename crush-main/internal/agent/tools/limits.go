@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// ToolTimeoutMetadata is the metadata of the result of a tool call stopped
+// by the timeout of its tool.
+type ToolTimeoutMetadata struct {
+	TimedOut       bool `json:"timed_out"`
+	TimeoutSeconds int  `json:"timeout_seconds"`
+}
+
+// WithLimits wraps the tools that have limits configured by name, the other
+// tools are returned as they are.
+func WithLimits(tools []fantasy.AgentTool, limits map[string]config.ToolLimit) []fantasy.AgentTool {
+	if len(limits) == 0 {
+		return tools
+	}
+	limited := make([]fantasy.AgentTool, len(tools))
+	for i, tool := range tools {
+		limited[i] = withLimit(tool, limits[tool.Info().Name])
+	}
+	return limited
+}
+
+func withLimit(tool fantasy.AgentTool, limit config.ToolLimit) fantasy.AgentTool {
+	if limit.Timeout <= 0 && limit.MaxConcurrent <= 0 && limit.PermissionTimeout <= 0 {
+		return tool
+	}
+	return &limitedTool{
+		AgentTool:         tool,
+		timeout:           time.Duration(limit.Timeout) * time.Second,
+		permissionTimeout: time.Duration(limit.PermissionTimeout) * time.Second,
+		slots:             newSessionSlots(limit.MaxConcurrent),
+	}
+}
+
+// limitedTool runs a tool with an execution timeout and a bound on its calls
+// running at once in a session. A call over the bound waits for a slot.
+type limitedTool struct {
+	fantasy.AgentTool
+	timeout           time.Duration // 0 lets calls run until they are done
+	permissionTimeout time.Duration // 0 keeps the permission timeout of the project
+	slots             *sessionSlots // nil leaves calls unbounded
+}
+
+func (t *limitedTool) Run(ctx context.Context, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	if t.permissionTimeout > 0 {
+		ctx = context.WithValue(ctx, PermissionTimeoutContextKey, t.permissionTimeout)
+	}
+	sessionID := GetSessionFromContext(ctx)
+	if err := t.slots.acquire(ctx, sessionID); err != nil {
+		return fantasy.ToolResponse{}, err
+	}
+	if t.timeout <= 0 {
+		defer t.slots.release(sessionID)
+		return t.AgentTool.Run(ctx, call)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	type result struct {
+		resp fantasy.ToolResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// The slot is held until the call returns, even after it timed out
+		defer t.slots.release(sessionID)
+		defer cancel()
+		resp, err := t.AgentTool.Run(runCtx, call)
+		done <- result{resp, err}
+	}()
+
+	select {
+	case r := <-done:
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return t.timeoutResponse(), nil
+		}
+		return r.resp, r.err
+	case <-runCtx.Done():
+		if ctx.Err() != nil {
+			return fantasy.ToolResponse{}, ctx.Err()
+		}
+		// The tool ignored the cancellation, the step goes on without it
+		return t.timeoutResponse(), nil
+	}
+}
+
+func (t *limitedTool) timeoutResponse() fantasy.ToolResponse {
+	seconds := int(t.timeout.Seconds())
+	return fantasy.WithResponseMetadata(
+		fantasy.NewTextErrorResponse(fmt.Sprintf("The %s tool timed out after %d seconds and was stopped. Try a smaller or faster operation.", t.Info().Name, seconds)),
+		ToolTimeoutMetadata{TimedOut: true, TimeoutSeconds: seconds},
+	)
+}
+
+// sessionSlots bounds the calls running at once in each session.
+type sessionSlots struct {
+	mu    sync.Mutex
+	limit int
+	used  map[string]int
+	freed chan struct{} // closed when a slot frees up
+}
+
+// newSessionSlots returns nil, which never blocks, when limit is not positive.
+func newSessionSlots(limit int) *sessionSlots {
+	if limit <= 0 {
+		return nil
+	}
+	return &sessionSlots{limit: limit, used: make(map[string]int), freed: make(chan struct{})}
+}
+
+// acquire takes a slot of the session, waiting until one frees up or ctx is
+// done.
+func (s *sessionSlots) acquire(ctx context.Context, sessionID string) error {
+	if s == nil {
+		return nil
+	}
+	for {
+		s.mu.Lock()
+		if s.used[sessionID] < s.limit {
+			s.used[sessionID]++
+			s.mu.Unlock()
+			return nil
+		}
+		freed := s.freed
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-freed:
+		}
+	}
+}
+
+func (s *sessionSlots) release(sessionID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used[sessionID]--; s.used[sessionID] <= 0 {
+		delete(s.used, sessionID)
+	}
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+type emptyParams struct{}
+
+func TestWithLimits(t *testing.T) {
+	t.Parallel()
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		unblock := make(chan struct{})
+		t.Cleanup(func() { close(unblock) })
+		stuck := fantasy.NewAgentTool("stuck", "ignores the cancellation", func(context.Context, emptyParams, fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			<-unblock
+			return fantasy.NewTextResponse("late"), nil
+		})
+		other := fantasy.NewAgentTool("other", "no limits", func(context.Context, emptyParams, fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			return fantasy.NewTextResponse("ok"), nil
+		})
+		limited := WithLimits([]fantasy.AgentTool{stuck, other}, map[string]config.ToolLimit{"stuck": {Timeout: 1}})
+		require.Same(t, other, limited[1], "tools without limits are not wrapped")
+
+		resp, err := limited[0].Run(t.Context(), fantasy.ToolCall{ID: "1", Name: "stuck", Input: "{}"})
+		require.NoError(t, err)
+		require.True(t, resp.IsError)
+		require.Contains(t, resp.Content, "timed out after 1 seconds")
+		require.JSONEq(t, `{"timed_out":true,"timeout_seconds":1}`, resp.Metadata)
+	})
+
+	t.Run("max concurrent per session", func(t *testing.T) {
+		t.Parallel()
+		var running, peak atomic.Int32
+		release := make(chan struct{})
+		bash := fantasy.NewAgentTool("bash", "blocks", func(context.Context, emptyParams, fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			<-release
+			running.Add(-1)
+			return fantasy.NewTextResponse("done"), nil
+		})
+		tool := WithLimits([]fantasy.AgentTool{bash}, map[string]config.ToolLimit{"bash": {MaxConcurrent: 2}})[0]
+
+		ctx := context.WithValue(t.Context(), SessionIDContextKey, "s1")
+		var wg sync.WaitGroup
+		for range 3 {
+			wg.Go(func() {
+				_, err := tool.Run(ctx, fantasy.ToolCall{Name: "bash", Input: "{}"})
+				require.NoError(t, err)
+			})
+		}
+		// Another session is not held up by s1
+		other := context.WithValue(t.Context(), SessionIDContextKey, "s2")
+		wg.Go(func() {
+			_, err := tool.Run(other, fantasy.ToolCall{Name: "bash", Input: "{}"})
+			require.NoError(t, err)
+		})
+
+		require.Eventually(t, func() bool { return running.Load() == 3 }, time.Second, 10*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		require.EqualValues(t, 3, running.Load(), "the third call of s1 waits for a slot")
+		close(release)
+		wg.Wait()
+		require.EqualValues(t, 3, peak.Load())
+	})
+
+	t.Run("permission timeout", func(t *testing.T) {
+		t.Parallel()
+		var got time.Duration
+		edit := fantasy.NewAgentTool("edit", "reads its permission timeout", func(ctx context.Context, _ emptyParams, _ fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			got = PermissionTimeout(ctx)
+			return fantasy.NewTextResponse("ok"), nil
+		})
+		// The project setting carried by the context is overridden by the tool's
+		ctx := context.WithValue(t.Context(), PermissionTimeoutContextKey, time.Minute)
+		tool := WithLimits([]fantasy.AgentTool{edit}, map[string]config.ToolLimit{"edit": {PermissionTimeout: 900}})[0]
+		_, err := tool.Run(ctx, fantasy.ToolCall{Name: "edit", Input: "{}"})
+		require.NoError(t, err)
+		require.Equal(t, 15*time.Minute, got)
+
+		tool = WithLimits([]fantasy.AgentTool{edit}, map[string]config.ToolLimit{"bash": {PermissionTimeout: 900}})[0]
+		_, err = tool.Run(ctx, fantasy.ToolCall{Name: "edit", Input: "{}"})
+		require.NoError(t, err)
+		require.Equal(t, time.Minute, got)
+	})
+}
@@ -0,0 +1,473 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/pubsub"
+)
+
+const LintToolName = "lint"
+
+// maxLintFindingsShown bounds the findings written in the tool result. All of
+// them are kept in the metadata and sent to the client.
+const maxLintFindingsShown = 50
+
+//go:embed lint.md
+var lintDescription []byte
+
+type LintParams struct {
+	Linter string `json:"linter,omitempty" description:"Only run this linter: eslint, golangci-lint or ruff (default: every linter configured in the project)"`
+	Path   string `json:"path,omitempty" description:"File or directory to lint, relative to the project root (default: the whole project)"`
+}
+
+type LintPermissionsParams struct {
+	Linters []string `json:"linters"`
+	Path    string   `json:"path,omitempty"`
+}
+
+// LintFinding is a finding of a linter, normalized across linters.
+type LintFinding struct {
+	Linter   string `json:"linter"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity"` // error, warning or info
+	Message  string `json:"message"`
+}
+
+// LintRun is the result of running one linter.
+type LintRun struct {
+	Linter   string `json:"linter"`
+	ExitCode int    `json:"exit_code"`
+	Findings int    `json:"findings"`
+	// Error is set when the linter could not run or its output was not understood.
+	Error string `json:"error,omitempty"`
+}
+
+type LintResponseMetadata struct {
+	Runs     []LintRun     `json:"runs"`
+	Findings []LintFinding `json:"findings"`
+}
+
+// LintEvent carries the findings of a lint run to the clients of a session.
+type LintEvent struct {
+	SessionID  string        `json:"session_id"`
+	ToolCallID string        `json:"tool_call_id"`
+	Runs       []LintRun     `json:"runs"`
+	Findings   []LintFinding `json:"findings"`
+}
+
+var lintBroker = pubsub.NewBroker[LintEvent]()
+
+// SubscribeLintEvents returns a channel for the findings of lint runs.
+func SubscribeLintEvents(ctx context.Context) <-chan pubsub.Event[LintEvent] {
+	return lintBroker.Subscribe(ctx)
+}
+
+// linter describes how to detect, run and parse a linter.
+type linter struct {
+	name string
+	// detect is a shell condition, true when the project configures the linter.
+	detect string
+	// command returns the command linting target and printing JSON findings.
+	command func(target string) string
+	parse   func(stdout, workingDir string) ([]LintFinding, error)
+}
+
+var linters = []linter{
+	{
+		name:   "eslint",
+		detect: fileExistsCondition("eslint.config.js", "eslint.config.mjs", "eslint.config.cjs", "eslint.config.ts", ".eslintrc", ".eslintrc.js", ".eslintrc.cjs", ".eslintrc.json", ".eslintrc.yml", ".eslintrc.yaml"),
+		command: func(target string) string {
+			return "npx --no-install eslint --format json " + shellQuote(cmp.Or(target, "."))
+		},
+		parse: parseESLintOutput,
+	},
+	{
+		name:   "golangci-lint",
+		detect: fileExistsCondition(".golangci.yml", ".golangci.yaml", ".golangci.toml", ".golangci.json"),
+		command: func(target string) string {
+			pattern := "./..."
+			if target != "" {
+				pattern = shellQuote(target)
+			}
+			// v1 takes --out-format, v2 replaced it with --output.json.path
+			return fmt.Sprintf("if golangci-lint run --help 2>/dev/null | grep -q -- --out-format; then golangci-lint run --out-format json %[1]s; else golangci-lint run --output.json.path stdout --show-stats=false %[1]s; fi", pattern)
+		},
+		parse: parseGolangCIOutput,
+	},
+	{
+		name:   "ruff",
+		detect: fileExistsCondition("ruff.toml", ".ruff.toml") + " || grep -qs '^\\[tool\\.ruff' pyproject.toml",
+		command: func(target string) string {
+			return "ruff check --output-format json --exit-zero " + shellQuote(cmp.Or(target, "."))
+		},
+		parse: parseRuffOutput,
+	},
+}
+
+func fileExistsCondition(names ...string) string {
+	conds := make([]string, len(names))
+	for i, name := range names {
+		conds[i] = "[ -e " + shellQuote(name) + " ]"
+	}
+	return strings.Join(conds, " || ")
+}
+
+func linterNames() []string {
+	names := make([]string, len(linters))
+	for i, l := range linters {
+		names[i] = l.name
+	}
+	return names
+}
+
+func findLinter(name string) (linter, bool) {
+	for _, l := range linters {
+		if l.name == name {
+			return l, true
+		}
+	}
+	return linter{}, false
+}
+
+// detectLintersScript prints the name of each linter configured in the
+// working directory, one per line.
+func detectLintersScript() string {
+	var script strings.Builder
+	for _, l := range linters {
+		fmt.Fprintf(&script, "if %s; then echo %s; fi\n", l.detect, l.name)
+	}
+	return script.String()
+}
+
+func parseDetectedLinters(stdout string) []string {
+	var names []string
+	for line := range strings.SplitSeq(stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if _, ok := findLinter(line); ok && !slices.Contains(names, line) {
+			names = append(names, line)
+		}
+	}
+	return names
+}
+
+func NewLintTool(permissions permission.Service, workingDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		LintToolName,
+		string(lintDescription),
+		func(ctx context.Context, params LintParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, errors.New("session ID is required for running linters")
+			}
+			execWorkingDir := cmp.Or(GetWorkingDirFromContext(ctx), workingDir)
+
+			target := strings.TrimSpace(params.Path)
+			if path.IsAbs(target) {
+				rel, ok := strings.CutPrefix(target, strings.TrimSuffix(execWorkingDir, "/")+"/")
+				if !ok {
+					return fantasy.NewTextErrorResponse("path must be inside the project"), nil
+				}
+				target = rel
+			}
+			if target != "" && (target == ".." || strings.HasPrefix(path.Clean(target), "../")) {
+				return fantasy.NewTextErrorResponse("path must be inside the project"), nil
+			}
+
+			client := sandbox.GetDefaultClient()
+			var selected []string
+			if params.Linter != "" {
+				if _, ok := findLinter(params.Linter); !ok {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("unknown linter %q, expected one of: %s", params.Linter, strings.Join(linterNames(), ", "))), nil
+				}
+				selected = []string{params.Linter}
+			} else {
+				resp, err := client.Execute(ctx, sandbox.ExecuteRequest{
+					SessionID:  sessionID,
+					Command:    detectLintersScript(),
+					Language:   "bash",
+					WorkingDir: execWorkingDir,
+				})
+				if err != nil {
+					return fantasy.ToolResponse{}, fmt.Errorf("failed to detect linters: %w", err)
+				}
+				selected = parseDetectedLinters(resp.Stdout)
+				if len(selected) == 0 {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("no linter configuration found in the project (supported: %s)", strings.Join(linterNames(), ", "))), nil
+				}
+			}
+
+			granted, err := RequestPermissionWithTimeoutSimple(
+				ctx,
+				permissions,
+				permission.CreatePermissionRequest{
+					SessionID:   sessionID,
+					ToolCallID:  call.ID,
+					Path:        execWorkingDir,
+					ToolName:    LintToolName,
+					Action:      "execute",
+					Description: fmt.Sprintf("Run %s on %s", strings.Join(selected, ", "), cmp.Or(target, "the project")),
+					Params:      LintPermissionsParams{Linters: selected, Path: target},
+				},
+			)
+			if err != nil {
+				return fantasy.ToolResponse{}, err
+			}
+			if !granted {
+				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+			}
+
+			metadata := LintResponseMetadata{Runs: []LintRun{}, Findings: []LintFinding{}}
+			for _, name := range selected {
+				l, _ := findLinter(name)
+				run := LintRun{Linter: name}
+				resp, err := client.Execute(ctx, sandbox.ExecuteRequest{
+					SessionID:  sessionID,
+					Command:    l.command(target),
+					Language:   "bash",
+					WorkingDir: execWorkingDir,
+				})
+				if err != nil {
+					if ctx.Err() != nil {
+						return fantasy.ToolResponse{}, ctx.Err()
+					}
+					run.Error = err.Error()
+					metadata.Runs = append(metadata.Runs, run)
+					continue
+				}
+				run.ExitCode = resp.ExitCode
+				findings, err := l.parse(resp.Stdout, execWorkingDir)
+				if err != nil {
+					run.Error = lintRunError(err, resp.Stderr)
+				}
+				run.Findings = len(findings)
+				metadata.Runs = append(metadata.Runs, run)
+				metadata.Findings = append(metadata.Findings, findings...)
+			}
+			sortLintFindings(metadata.Findings)
+
+			lintBroker.Publish(pubsub.CreatedEvent, LintEvent{
+				SessionID:  sessionID,
+				ToolCallID: call.ID,
+				Runs:       metadata.Runs,
+				Findings:   metadata.Findings,
+			})
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(formatLintResult(metadata)), metadata), nil
+		})
+}
+
+// lintRunError explains output that could not be parsed, usually because the
+// linter is not installed or failed before linting.
+func lintRunError(err error, stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return err.Error()
+	}
+	if len(stderr) > 500 {
+		stderr = stderr[:500] + "..."
+	}
+	return fmt.Sprintf("%s: %s", err, stderr)
+}
+
+var lintSeverityOrder = map[string]int{"error": 0, "warning": 1, "info": 2}
+
+func sortLintFindings(findings []LintFinding) {
+	slices.SortStableFunc(findings, func(a, b LintFinding) int {
+		return cmp.Or(
+			cmp.Compare(lintSeverityOrder[a.Severity], lintSeverityOrder[b.Severity]),
+			cmp.Compare(a.File, b.File),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Column, b.Column),
+		)
+	})
+}
+
+func formatLintResult(metadata LintResponseMetadata) string {
+	var output strings.Builder
+	for _, run := range metadata.Runs {
+		if run.Error != "" {
+			fmt.Fprintf(&output, "%s failed: %s\n", run.Linter, run.Error)
+		}
+	}
+
+	if len(metadata.Findings) == 0 {
+		output.WriteString("No lint findings.\n")
+		return output.String()
+	}
+
+	output.WriteString("<lint_findings>\n")
+	for i, f := range metadata.Findings {
+		if i == maxLintFindingsShown {
+			fmt.Fprintf(&output, "... and %d more findings\n", len(metadata.Findings)-maxLintFindingsShown)
+			break
+		}
+		rule := f.Linter
+		if f.Rule != "" {
+			rule += "/" + f.Rule
+		}
+		location := fmt.Sprintf("%s:%d", f.File, f.Line)
+		if f.Column > 0 {
+			location += fmt.Sprintf(":%d", f.Column)
+		}
+		fmt.Fprintf(&output, "%s: %s [%s] %s\n", f.Severity, location, rule, f.Message)
+	}
+	output.WriteString("</lint_findings>\n")
+
+	counts := make(map[string]int)
+	for _, f := range metadata.Findings {
+		counts[f.Severity]++
+	}
+	fmt.Fprintf(&output, "\n<lint_summary>\n%d errors, %d warnings, %d infos\n</lint_summary>\n", counts["error"], counts["warning"], counts["info"])
+	return output.String()
+}
+
+// relativeLintPath returns file relative to the working directory when it is inside it.
+func relativeLintPath(file, workingDir string) string {
+	if rel, ok := strings.CutPrefix(file, strings.TrimSuffix(workingDir, "/")+"/"); ok {
+		return rel
+	}
+	return file
+}
+
+// lintJSON returns the JSON document of a linter output, skipping anything
+// printed before it.
+func lintJSON(stdout string) (string, error) {
+	start := strings.IndexAny(stdout, "[{")
+	if start < 0 {
+		return "", errors.New("no JSON output")
+	}
+	return stdout[start:], nil
+}
+
+func parseESLintOutput(stdout, workingDir string) ([]LintFinding, error) {
+	data, err := lintJSON(stdout)
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		FilePath string `json:"filePath"`
+		Messages []struct {
+			RuleID   string `json:"ruleId"`
+			Severity int    `json:"severity"`
+			Message  string `json:"message"`
+			Line     int    `json:"line"`
+			Column   int    `json:"column"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(data), &results); err != nil {
+		return nil, fmt.Errorf("invalid eslint output: %w", err)
+	}
+
+	findings := []LintFinding{}
+	for _, r := range results {
+		for _, m := range r.Messages {
+			severity := "warning"
+			if m.Severity == 2 {
+				severity = "error"
+			}
+			findings = append(findings, LintFinding{
+				Linter:   "eslint",
+				File:     relativeLintPath(r.FilePath, workingDir),
+				Line:     m.Line,
+				Column:   m.Column,
+				Rule:     m.RuleID,
+				Severity: severity,
+				Message:  m.Message,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func parseGolangCIOutput(stdout, workingDir string) ([]LintFinding, error) {
+	data, err := lintJSON(stdout)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Issues []struct {
+			FromLinter string `json:"FromLinter"`
+			Text       string `json:"Text"`
+			Severity   string `json:"Severity"`
+			Pos        struct {
+				Filename string `json:"Filename"`
+				Line     int    `json:"Line"`
+				Column   int    `json:"Column"`
+			} `json:"Pos"`
+		} `json:"Issues"`
+	}
+	// v2 prints the text report after the JSON document
+	if err := json.NewDecoder(strings.NewReader(data)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid golangci-lint output: %w", err)
+	}
+
+	findings := []LintFinding{}
+	for _, issue := range result.Issues {
+		severity := strings.ToLower(issue.Severity)
+		if _, ok := lintSeverityOrder[severity]; !ok {
+			// golangci-lint fails the run on every issue unless told otherwise
+			severity = "error"
+		}
+		findings = append(findings, LintFinding{
+			Linter:   "golangci-lint",
+			File:     relativeLintPath(issue.Pos.Filename, workingDir),
+			Line:     issue.Pos.Line,
+			Column:   issue.Pos.Column,
+			Rule:     issue.FromLinter,
+			Severity: severity,
+			Message:  issue.Text,
+		})
+	}
+	return findings, nil
+}
+
+func parseRuffOutput(stdout, workingDir string) ([]LintFinding, error) {
+	data, err := lintJSON(stdout)
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		Code     *string `json:"code"`
+		Message  string  `json:"message"`
+		Filename string  `json:"filename"`
+		Location struct {
+			Row    int `json:"row"`
+			Column int `json:"column"`
+		} `json:"location"`
+	}
+	if err := json.Unmarshal([]byte(data), &results); err != nil {
+		return nil, fmt.Errorf("invalid ruff output: %w", err)
+	}
+
+	findings := []LintFinding{}
+	for _, r := range results {
+		// Ruff has no severities, only syntax errors come without a rule code
+		severity, rule := "error", ""
+		if r.Code != nil {
+			severity, rule = "warning", *r.Code
+		}
+		findings = append(findings, LintFinding{
+			Linter:   "ruff",
+			File:     relativeLintPath(r.Filename, workingDir),
+			Line:     r.Location.Row,
+			Column:   r.Location.Column,
+			Rule:     rule,
+			Severity: severity,
+			Message:  r.Message,
+		})
+	}
+	return findings, nil
+}
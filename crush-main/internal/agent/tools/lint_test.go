@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseESLintOutput(t *testing.T) {
+	stdout := `[{"filePath":"/workspace/app/src/index.js","messages":[
+		{"ruleId":"no-unused-vars","severity":1,"message":"'x' is assigned a value but never used.","line":3,"column":7},
+		{"ruleId":null,"severity":2,"message":"Parsing error: Unexpected token","line":9,"column":1}
+	]}]`
+
+	findings, err := parseESLintOutput(stdout, "/workspace/app")
+	require.NoError(t, err)
+	require.Equal(t, []LintFinding{
+		{Linter: "eslint", File: "src/index.js", Line: 3, Column: 7, Rule: "no-unused-vars", Severity: "warning", Message: "'x' is assigned a value but never used."},
+		{Linter: "eslint", File: "src/index.js", Line: 9, Column: 1, Severity: "error", Message: "Parsing error: Unexpected token"},
+	}, findings)
+}
+
+func TestParseGolangCIOutput(t *testing.T) {
+	// v2 prints its text report after the JSON document
+	stdout := `{"Issues":[{"FromLinter":"errcheck","Text":"Error return value is not checked","Severity":"","Pos":{"Filename":"main.go","Line":12,"Column":10}}]}
+0 issues.`
+
+	findings, err := parseGolangCIOutput(stdout, "/workspace/app")
+	require.NoError(t, err)
+	require.Equal(t, []LintFinding{
+		{Linter: "golangci-lint", File: "main.go", Line: 12, Column: 10, Rule: "errcheck", Severity: "error", Message: "Error return value is not checked"},
+	}, findings)
+}
+
+func TestParseRuffOutput(t *testing.T) {
+	stdout := `[
+		{"code":"F401","message":"'os' imported but unused","filename":"/workspace/app/pkg/util.py","location":{"row":1,"column":8}},
+		{"code":null,"message":"SyntaxError: Expected ':'","filename":"/workspace/app/main.py","location":{"row":4,"column":12}}
+	]`
+
+	findings, err := parseRuffOutput(stdout, "/workspace/app/")
+	require.NoError(t, err)
+	require.Equal(t, []LintFinding{
+		{Linter: "ruff", File: "pkg/util.py", Line: 1, Column: 8, Rule: "F401", Severity: "warning", Message: "'os' imported but unused"},
+		{Linter: "ruff", File: "main.py", Line: 4, Column: 12, Severity: "error", Message: "SyntaxError: Expected ':'"},
+	}, findings)
+}
+
+func TestParseLintOutputWithoutJSON(t *testing.T) {
+	_, err := parseESLintOutput("npm ERR! could not determine executable to run\n", "/workspace")
+	require.Error(t, err)
+}
+
+func TestParseDetectedLinters(t *testing.T) {
+	require.Equal(t, []string{"golangci-lint", "ruff"}, parseDetectedLinters("golangci-lint\nnoise\nruff\nruff\n"))
+	require.Empty(t, parseDetectedLinters(""))
+
+	script := detectLintersScript()
+	for _, name := range linterNames() {
+		require.Contains(t, script, "then echo "+name+"; fi")
+	}
+}
+
+func TestFormatLintResult(t *testing.T) {
+	findings := []LintFinding{
+		{Linter: "ruff", File: "b.py", Line: 2, Rule: "F401", Severity: "warning", Message: "unused import"},
+		{Linter: "eslint", File: "a.js", Line: 5, Column: 3, Severity: "error", Message: "parse error"},
+	}
+	sortLintFindings(findings)
+	require.Equal(t, "error", findings[0].Severity)
+
+	out := formatLintResult(LintResponseMetadata{
+		Runs:     []LintRun{{Linter: "eslint", Findings: 1}, {Linter: "golangci-lint", Error: "no JSON output"}, {Linter: "ruff", Findings: 1}},
+		Findings: findings,
+	})
+	require.Contains(t, out, "golangci-lint failed: no JSON output")
+	require.Contains(t, out, "error: a.js:5:3 [eslint] parse error")
+	require.Contains(t, out, "warning: b.py:2 [ruff/F401] unused import")
+	require.Contains(t, out, "1 errors, 1 warnings, 0 infos")
+	require.Less(t, strings.Index(out, "a.js"), strings.Index(out, "b.py"))
+
+	require.Contains(t, formatLintResult(LintResponseMetadata{}), "No lint findings.")
+}
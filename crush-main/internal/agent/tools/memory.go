@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/memory"
+)
+
+const MemoryToolName = "memory"
+
+// Actions of the memory tool.
+const (
+	MemoryActionAppend = "append"
+	MemoryActionSearch = "search"
+	MemoryActionList   = "list"
+)
+
+//go:embed memory.md
+var memoryDescription []byte
+
+type MemoryParams struct {
+	Action  string `json:"action" description:"The action to perform: append, search or list"`
+	Content string `json:"content,omitempty" description:"The note to save, for append"`
+	Query   string `json:"query,omitempty" description:"What to look for in the notes, for search"`
+	Limit   int    `json:"limit,omitempty" description:"Number of notes to return for search and list (default: 20, max: 100)"`
+}
+
+type MemoryResponseMetadata struct {
+	Action   string `json:"action"`
+	MemoryID string `json:"memory_id,omitempty"`
+	Count    int    `json:"count"`
+}
+
+// NewMemoryTool returns the memory tool, reading and writing the notes of the
+// project of the session.
+func NewMemoryTool(memories memory.Service, projectOf ProjectResolver) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		MemoryToolName,
+		string(memoryDescription),
+		func(ctx context.Context, params MemoryParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session ID is required for the project memory")
+			}
+			projectID, err := projectOf(ctx, sessionID)
+			if err != nil || projectID == "" {
+				return fantasy.NewTextErrorResponse("the project memory needs a session with a project"), nil
+			}
+
+			switch params.Action {
+			case MemoryActionAppend:
+				m, err := memories.Append(ctx, projectID, params.Content, sessionID, "")
+				if errors.Is(err, memory.ErrInvalidContent) || errors.Is(err, memory.ErrFull) {
+					return fantasy.NewTextErrorResponse(err.Error()), nil
+				}
+				if err != nil {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("Error saving memory: %v", err)), nil
+				}
+				return fantasy.WithResponseMetadata(
+					fantasy.NewTextResponse("Saved to the project memory."),
+					MemoryResponseMetadata{Action: params.Action, MemoryID: m.ID, Count: 1},
+				), nil
+			case MemoryActionSearch, MemoryActionList:
+				var found []memory.Memory
+				if params.Action == MemoryActionSearch {
+					if strings.TrimSpace(params.Query) == "" {
+						return fantasy.NewTextErrorResponse("query is required for search"), nil
+					}
+					found, err = memories.Search(ctx, projectID, params.Query, params.Limit)
+				} else {
+					found, err = memories.List(ctx, projectID, params.Limit, 0)
+				}
+				if err != nil {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("Error reading memory: %v", err)), nil
+				}
+				return fantasy.WithResponseMetadata(
+					fantasy.NewTextResponse(formatMemories(found)),
+					MemoryResponseMetadata{Action: params.Action, Count: len(found)},
+				), nil
+			}
+			return fantasy.NewTextErrorResponse(fmt.Sprintf("unknown action %q, use append, search or list", params.Action)), nil
+		})
+}
+
+// formatMemories lists notes with the day they were written.
+func formatMemories(memories []memory.Memory) string {
+	if len(memories) == 0 {
+		return "No notes found in the project memory"
+	}
+	var output strings.Builder
+	for i, m := range memories {
+		if i > 0 {
+			output.WriteString("\n")
+		}
+		fmt.Fprintf(&output, "- [%s] %s", time.UnixMilli(m.CreatedAt).UTC().Format(time.DateOnly), m.Content)
+	}
+	return output.String()
+}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMemories struct {
+	memory.Service
+	appended []memory.Memory
+}
+
+func (f *fakeMemories) Append(_ context.Context, projectID, content, sessionID, userID string) (memory.Memory, error) {
+	if content == "" {
+		return memory.Memory{}, memory.ErrInvalidContent
+	}
+	m := memory.Memory{ID: "m1", ProjectID: projectID, Content: content, SessionID: sessionID}
+	f.appended = append(f.appended, m)
+	return m, nil
+}
+
+func (f *fakeMemories) Search(_ context.Context, projectID, query string, limit int) ([]memory.Memory, error) {
+	return f.appended, nil
+}
+
+func TestMemoryTool(t *testing.T) {
+	memories := &fakeMemories{}
+	tool := NewMemoryTool(memories, func(context.Context, string) (string, error) { return "p1", nil })
+	ctx := context.WithValue(t.Context(), SessionIDContextKey, "s1")
+
+	resp, err := tool.Run(ctx, fantasy.ToolCall{Name: MemoryToolName, Input: `{"action":"append","content":"Run make test-unit"}`})
+	require.NoError(t, err)
+	require.False(t, resp.IsError)
+	require.Equal(t, []memory.Memory{{ID: "m1", ProjectID: "p1", Content: "Run make test-unit", SessionID: "s1"}}, memories.appended)
+
+	resp, err = tool.Run(ctx, fantasy.ToolCall{Name: MemoryToolName, Input: `{"action":"search","query":"tests"}`})
+	require.NoError(t, err)
+	require.Contains(t, resp.Content, "Run make test-unit")
+
+	resp, err = tool.Run(ctx, fantasy.ToolCall{Name: MemoryToolName, Input: `{"action":"append"}`})
+	require.NoError(t, err)
+	require.True(t, resp.IsError)
+
+	resp, err = tool.Run(ctx, fantasy.ToolCall{Name: MemoryToolName, Input: `{"action":"forget"}`})
+	require.NoError(t, err)
+	require.True(t, resp.IsError)
+}
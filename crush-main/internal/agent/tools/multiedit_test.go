@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
 	"github.com/rolling1314/rolling-crush/domain/history"
@@ -24,8 +25,24 @@ func (m *mockPermissionService) Request(req permission.CreatePermissionRequest)
 
 func (m *mockPermissionService) Grant(req permission.PermissionRequest) {}
 
+func (m *mockPermissionService) GrantForSession(req permission.PermissionRequest) {}
+
 func (m *mockPermissionService) Deny(req permission.PermissionRequest) {}
 
+func (m *mockPermissionService) RequestWithTimeout(ctx context.Context, opts permission.CreatePermissionRequest, timeout time.Duration, originalPrompt string, onTimeout permission.PermissionTimeoutCallback) (bool, error) {
+	return true, nil
+}
+
+func (m *mockPermissionService) RequestHunksWithTimeout(ctx context.Context, opts permission.CreatePermissionRequest, timeout time.Duration, originalPrompt string, onTimeout permission.PermissionTimeoutCallback) (bool, []int, error) {
+	return true, nil, nil
+}
+
+func (m *mockPermissionService) GrantToolCall(toolCallID string) {}
+
+func (m *mockPermissionService) TakeDecision(toolCallID string) (permission.Decision, bool) {
+	return "", false
+}
+
 func (m *mockPermissionService) GrantPersistent(req permission.PermissionRequest) {}
 
 func (m *mockPermissionService) AutoApproveSession(sessionID string) {}
@@ -40,6 +57,20 @@ func (m *mockPermissionService) SubscribeNotifications(ctx context.Context) <-ch
 	return make(<-chan pubsub.Event[permission.PermissionNotification])
 }
 
+func (m *mockPermissionService) SubscribeBlocking(ctx context.Context) <-chan pubsub.Event[permission.PermissionBlocking] {
+	return make(<-chan pubsub.Event[permission.PermissionBlocking])
+}
+
+func (m *mockPermissionService) SetBlockingThreshold(threshold time.Duration) {}
+
+func (m *mockPermissionService) SetAllowlistChecker(checker permission.AllowlistChecker) {}
+
+func (m *mockPermissionService) SetPolicyChecker(checker permission.PolicyChecker) {}
+
+func (m *mockPermissionService) SetBasePolicy(rules []permission.PolicyRule) error {
+	return nil
+}
+
 type mockHistoryService struct {
 	*pubsub.Broker[history.File]
 }
@@ -21,32 +21,47 @@ func GetPermissionTimeout() time.Duration {
 	return DefaultPermissionTimeout
 }
 
+// PermissionTimeout returns how long the permission requests of a tool call
+// wait for the user: the tool or project setting carried by ctx, else the
+// server setting.
+func PermissionTimeout(ctx context.Context) time.Duration {
+	if timeout := GetPermissionTimeoutFromContext(ctx); timeout > 0 {
+		return timeout
+	}
+	return GetPermissionTimeout()
+}
+
+// logPermissionTimeout logs a timed out request, the agent suspends its tool
+// call until the user answers.
+func logPermissionTimeout(timeout time.Duration) permission.PermissionTimeoutCallback {
+	return func(req permission.PermissionRequest, _ string) {
+		slog.Warn("[PERMISSION] Permission request timed out, tool call suspended",
+			"tool_name", req.ToolName,
+			"tool_call_id", req.ToolCallID,
+			"session_id", req.SessionID,
+			"timeout", timeout,
+		)
+	}
+}
+
 // RequestPermissionWithTimeout wraps the permission request with timeout support.
 // It returns (granted, error) where error is:
 // - nil if granted
 // - permission.ErrorPermissionDenied if denied
-// - permission.ErrorPermissionTimeout if timeout
-// - ctx.Err() if context cancelled
+// - a *permission.TimeoutError, matching permission.ErrorPermissionTimeout, if timeout
+// - ctx.Err() if context cancelled or the turn soft cancelled
 func RequestPermissionWithTimeout(
 	ctx context.Context,
 	permissions permission.Service,
 	opts permission.CreatePermissionRequest,
 	originalPrompt string,
 ) (bool, error) {
-	timeout := GetPermissionTimeout()
+	timeout := PermissionTimeout(ctx)
 
-	// Callback for when permission times out - log the event
-	// The actual DB persistence is handled by the coordinator/app layer
-	onTimeout := func(req permission.PermissionRequest, prompt string) {
-		slog.Warn("[PERMISSION] Permission request timed out, tool call suspended",
-			"tool_name", req.ToolName,
-			"tool_call_id", req.ToolCallID,
-			"session_id", req.SessionID,
-			"timeout", timeout,
-		)
-	}
-
-	return permissions.RequestWithTimeout(ctx, opts, timeout, originalPrompt, onTimeout)
+	// A soft cancelled turn stops waiting for the user, nothing has run yet
+	ctx, cancel := withStopSignal(ctx)
+	defer cancel()
+	return permissions.RequestWithTimeout(ctx, opts, timeout, originalPrompt, logPermissionTimeout(timeout))
 }
 
 // RequestPermissionWithTimeoutSimple is a simplified version that doesn't track original prompt.
@@ -58,3 +73,17 @@ func RequestPermissionWithTimeoutSimple(
 ) (bool, error) {
 	return RequestPermissionWithTimeout(ctx, permissions, opts, "")
 }
+
+// RequestEditPermissionWithTimeout requests permission for an edit whose params
+// carry diff hunks. Besides the grant it returns the hunks the user approved;
+// nil means the whole edit was approved.
+func RequestEditPermissionWithTimeout(
+	ctx context.Context,
+	permissions permission.Service,
+	opts permission.CreatePermissionRequest,
+) (bool, []int, error) {
+	timeout := PermissionTimeout(ctx)
+	ctx, cancel := withStopSignal(ctx)
+	defer cancel()
+	return permissions.RequestHunksWithTimeout(ctx, opts, timeout, "", logPermissionTimeout(timeout))
+}
@@ -0,0 +1,285 @@
+package tools
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+)
+
+const (
+	// ProjectToolsFile is the file of a workspace declaring its project tools.
+	ProjectToolsFile = "crush-tools.json"
+	// ProjectToolPrefix prefixes the names of project tools given to the model.
+	ProjectToolPrefix = "project_"
+	// MaxProjectTools bounds the tools a project can declare.
+	MaxProjectTools = 32
+)
+
+var projectToolNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,47}$`)
+
+// ProjectToolDefinition is a tool declared in crush-tools.json. Command is a
+// text/template rendered with the call parameters, each shell-quoted, and run
+// in the sandbox from the workspace root.
+type ProjectToolDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Command     string         `json:"command"`
+	Schema      map[string]any `json:"schema,omitempty"`
+}
+
+type projectToolsFile struct {
+	Tools []ProjectToolDefinition `json:"tools"`
+}
+
+type ProjectToolPermissionsParams struct {
+	Command string `json:"command"`
+	Input   string `json:"input"`
+}
+
+type ProjectToolResponseMetadata struct {
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Command   string `json:"command"`
+	Output    string `json:"output"`
+	ExitCode  int    `json:"exit_code"`
+}
+
+// ParseProjectTools parses and validates the content of crush-tools.json.
+func ParseProjectTools(data []byte) ([]ProjectToolDefinition, error) {
+	var file projectToolsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ProjectToolsFile, err)
+	}
+	if len(file.Tools) > MaxProjectTools {
+		return nil, fmt.Errorf("%s declares %d tools, at most %d are allowed", ProjectToolsFile, len(file.Tools), MaxProjectTools)
+	}
+
+	seen := make(map[string]bool)
+	for _, def := range file.Tools {
+		if !projectToolNameRe.MatchString(def.Name) {
+			return nil, fmt.Errorf("invalid project tool name %q: use lowercase letters, digits and underscores", def.Name)
+		}
+		if seen[def.Name] {
+			return nil, fmt.Errorf("duplicate project tool %q", def.Name)
+		}
+		seen[def.Name] = true
+
+		if strings.TrimSpace(def.Description) == "" {
+			return nil, fmt.Errorf("project tool %q has no description", def.Name)
+		}
+		if strings.TrimSpace(def.Command) == "" {
+			return nil, fmt.Errorf("project tool %q has no command", def.Name)
+		}
+		if _, err := template.New(def.Name).Parse(def.Command); err != nil {
+			return nil, fmt.Errorf("project tool %q has an invalid command template: %w", def.Name, err)
+		}
+		if def.Schema != nil {
+			if t, ok := def.Schema["type"]; ok && t != "object" {
+				return nil, fmt.Errorf("project tool %q schema must be an object", def.Name)
+			}
+		}
+	}
+	return file.Tools, nil
+}
+
+// LoadProjectTools reads crush-tools.json from the workspace of a session in
+// the sandbox. A workspace without the file has no project tools.
+func LoadProjectTools(ctx context.Context, permissions permission.Service, sessionID, workingDir string) ([]fantasy.AgentTool, error) {
+	resp, err := sandbox.GetDefaultClient().ReadFile(ctx, sandbox.FileReadRequest{
+		SessionID: sessionID,
+		FilePath:  path.Join(workingDir, ProjectToolsFile),
+	})
+	if err != nil {
+		slog.Debug("No project tools loaded", "session_id", sessionID, "error", err)
+		return nil, nil
+	}
+
+	defs, err := ParseProjectTools([]byte(resp.Content))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]fantasy.AgentTool, len(defs))
+	for i, def := range defs {
+		result[i] = NewProjectTool(permissions, workingDir, def)
+	}
+	return result, nil
+}
+
+// ProjectTool runs a tool declared by the project in the sandbox.
+type ProjectTool struct {
+	def             ProjectToolDefinition
+	command         *template.Template
+	permissions     permission.Service
+	workingDir      string
+	providerOptions fantasy.ProviderOptions
+}
+
+// NewProjectTool creates a tool from a definition validated by ParseProjectTools.
+func NewProjectTool(permissions permission.Service, workingDir string, def ProjectToolDefinition) *ProjectTool {
+	return &ProjectTool{
+		def:         def,
+		command:     template.Must(template.New(def.Name).Option("missingkey=zero").Parse(def.Command)),
+		permissions: permissions,
+		workingDir:  workingDir,
+	}
+}
+
+func (p *ProjectTool) SetProviderOptions(opts fantasy.ProviderOptions) {
+	p.providerOptions = opts
+}
+
+func (p *ProjectTool) ProviderOptions() fantasy.ProviderOptions {
+	return p.providerOptions
+}
+
+func (p *ProjectTool) Name() string {
+	return ProjectToolPrefix + p.def.Name
+}
+
+func (p *ProjectTool) Info() fantasy.ToolInfo {
+	parameters := make(map[string]any)
+	required := make([]string, 0)
+	if props, ok := p.def.Schema["properties"].(map[string]any); ok {
+		parameters = props
+	}
+	if req, ok := p.def.Schema["required"].([]any); ok {
+		for _, v := range req {
+			if s, ok := v.(string); ok {
+				required = append(required, s)
+			}
+		}
+	}
+
+	return fantasy.ToolInfo{
+		Name:        p.Name(),
+		Description: p.def.Description,
+		Parameters:  parameters,
+		Required:    required,
+	}
+}
+
+// RenderCommand renders the command of the tool for the JSON input of a call.
+func (p *ProjectTool) RenderCommand(input string) (string, error) {
+	params := make(map[string]any)
+	if strings.TrimSpace(input) != "" {
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			return "", fmt.Errorf("invalid parameters: %w", err)
+		}
+	}
+	for _, name := range p.Info().Required {
+		if _, ok := params[name]; !ok {
+			return "", fmt.Errorf("missing required parameter %q", name)
+		}
+	}
+
+	quoted := make(map[string]string, len(params))
+	for name, value := range params {
+		s, ok := value.(string)
+		if !ok {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return "", err
+			}
+			s = string(data)
+		}
+		quoted[name] = shellQuote(s)
+	}
+
+	var buf bytes.Buffer
+	if err := p.command.Execute(&buf, quoted); err != nil {
+		return "", fmt.Errorf("failed to render command: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func (p *ProjectTool) Run(ctx context.Context, params fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	sessionID := GetSessionFromContext(ctx)
+	if sessionID == "" {
+		return fantasy.ToolResponse{}, errors.New("session ID is required for executing a project tool")
+	}
+	execWorkingDir := cmp.Or(GetWorkingDirFromContext(ctx), p.workingDir)
+
+	command, err := p.RenderCommand(params.Input)
+	if err != nil {
+		return fantasy.NewTextErrorResponse(err.Error()), nil
+	}
+
+	granted, err := RequestPermissionWithTimeoutSimple(
+		ctx,
+		p.permissions,
+		permission.CreatePermissionRequest{
+			SessionID:   sessionID,
+			ToolCallID:  params.ID,
+			Path:        execWorkingDir,
+			ToolName:    p.Name(),
+			Action:      "execute",
+			Description: fmt.Sprintf("Execute project tool %s: %s", p.def.Name, command),
+			Params: ProjectToolPermissionsParams{
+				Command: command,
+				Input:   params.Input,
+			},
+		},
+	)
+	if err != nil {
+		return fantasy.ToolResponse{}, err
+	}
+	if !granted {
+		return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+	}
+
+	startTime := time.Now()
+	resp, err := sandbox.GetDefaultClient().Execute(ctx, sandbox.ExecuteRequest{
+		SessionID:  sessionID,
+		Command:    command,
+		Language:   "bash",
+		WorkingDir: execWorkingDir,
+	})
+	if err != nil {
+		return fantasy.ToolResponse{}, fmt.Errorf("sandbox execution error: %w", err)
+	}
+
+	output := resp.Stdout
+	if resp.Stderr != "" {
+		if output != "" {
+			output += "\n"
+		}
+		output += resp.Stderr
+	}
+	if resp.ExitCode != 0 {
+		if output != "" {
+			output += "\n"
+		}
+		output += fmt.Sprintf("Exit code %d", resp.ExitCode)
+	}
+	output = truncateOutput(output)
+
+	metadata := ProjectToolResponseMetadata{
+		StartTime: startTime.UnixMilli(),
+		EndTime:   time.Now().UnixMilli(),
+		Command:   command,
+		Output:    output,
+		ExitCode:  resp.ExitCode,
+	}
+	if output == "" {
+		return fantasy.WithResponseMetadata(fantasy.NewTextResponse(BashNoOutput), metadata), nil
+	}
+	return fantasy.WithResponseMetadata(fantasy.NewTextResponse(output), metadata), nil
+}
+
+// shellQuote quotes a value as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testProjectTools = `{
+  "tools": [
+    {
+      "name": "run_tests",
+      "description": "Run the tests of a package",
+      "command": "go test {{.package}} {{.flags}}",
+      "schema": {
+        "type": "object",
+        "properties": {
+          "package": {"type": "string"},
+          "flags": {"type": "string"}
+        },
+        "required": ["package"]
+      }
+    },
+    {
+      "name": "lint",
+      "description": "Run the linters",
+      "command": "task lint"
+    }
+  ]
+}`
+
+func TestParseProjectTools(t *testing.T) {
+	t.Parallel()
+
+	defs, err := ParseProjectTools([]byte(testProjectTools))
+	require.NoError(t, err)
+	require.Len(t, defs, 2)
+
+	tool := NewProjectTool(nil, "/workspace", defs[0])
+	info := tool.Info()
+	require.Equal(t, "project_run_tests", info.Name)
+	require.Equal(t, "Run the tests of a package", info.Description)
+	require.Contains(t, info.Parameters, "package")
+	require.Equal(t, []string{"package"}, info.Required)
+
+	lint := NewProjectTool(nil, "/workspace", defs[1])
+	require.Empty(t, lint.Info().Parameters)
+}
+
+func TestParseProjectToolsInvalid(t *testing.T) {
+	t.Parallel()
+
+	for name, content := range map[string]string{
+		"json":        `{"tools": [`,
+		"name":        `{"tools": [{"name": "Run Tests", "description": "d", "command": "c"}]}`,
+		"duplicate":   `{"tools": [{"name": "a", "description": "d", "command": "c"}, {"name": "a", "description": "d", "command": "c"}]}`,
+		"description": `{"tools": [{"name": "a", "command": "c"}]}`,
+		"command":     `{"tools": [{"name": "a", "description": "d"}]}`,
+		"template":    `{"tools": [{"name": "a", "description": "d", "command": "echo {{.x"}]}`,
+		"schema":      `{"tools": [{"name": "a", "description": "d", "command": "c", "schema": {"type": "array"}}]}`,
+	} {
+		_, err := ParseProjectTools([]byte(content))
+		require.Error(t, err, name)
+	}
+}
+
+func TestProjectToolRenderCommand(t *testing.T) {
+	t.Parallel()
+
+	defs, err := ParseProjectTools([]byte(testProjectTools))
+	require.NoError(t, err)
+	tool := NewProjectTool(nil, "/workspace", defs[0])
+
+	command, err := tool.RenderCommand(`{"package": "./pkg/..."}`)
+	require.NoError(t, err)
+	require.Equal(t, `go test './pkg/...'`, command)
+
+	command, err = tool.RenderCommand(`{"package": "x; rm -rf /", "flags": "it's"}`)
+	require.NoError(t, err)
+	require.Equal(t, `go test 'x; rm -rf /' 'it'\''s'`, command)
+
+	_, err = tool.RenderCommand(`{}`)
+	require.Error(t, err)
+}
@@ -97,14 +97,7 @@ func find(ctx context.Context, lspClients *csync.Map[string, *lsp.Client], symbo
 		return nil, fmt.Errorf("failed to get absolute path: %s", err)
 	}
 
-	var client *lsp.Client
-	for c := range lspClients.Seq() {
-		if c.HandlesFile(absPath) {
-			client = c
-			break
-		}
-	}
-
+	client := clientForFile(lspClients, absPath)
 	if client == nil {
 		slog.Warn("No LSP clients to handle", "path", match.path)
 		return nil, nil
@@ -119,6 +112,16 @@ func find(ctx context.Context, lspClients *csync.Map[string, *lsp.Client], symbo
 	)
 }
 
+// clientForFile returns the first LSP client handling a file, nil if none does.
+func clientForFile(lspClients *csync.Map[string, *lsp.Client], absPath string) *lsp.Client {
+	for c := range lspClients.Seq() {
+		if c.HandlesFile(absPath) {
+			return c
+		}
+	}
+	return nil
+}
+
 // getSymbolOffset returns the character offset to the actual symbol name
 // in a qualified symbol (e.g., "Bar" in "foo.Bar" or "method" in "Class::method").
 func getSymbolOffset(symbol string) int {
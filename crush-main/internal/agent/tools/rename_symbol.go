@@ -0,0 +1,295 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/charmbracelet/x/powernap/pkg/lsp/protocol"
+	"github.com/rolling1314/rolling-crush/domain/history"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/lsp"
+	"github.com/rolling1314/rolling-crush/internal/lsp/util"
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+	"github.com/rolling1314/rolling-crush/internal/pkg/diff"
+	"github.com/rolling1314/rolling-crush/internal/pkg/filepathext"
+	"github.com/rolling1314/rolling-crush/internal/pkg/fsext"
+)
+
+type RenameSymbolParams struct {
+	Symbol  string `json:"symbol" description:"The symbol to rename (e.g., function name, variable name, type name, or a qualified name like pkg.Func)"`
+	NewName string `json:"new_name" description:"The new name of the symbol, without any qualifier"`
+	Path    string `json:"path,omitempty" description:"The file or directory where the symbol is used, preferably the file declaring it. Defaults to the current working directory."`
+}
+
+// RenameSymbolFile is a file changed by a rename.
+type RenameSymbolFile struct {
+	FilePath   string `json:"file_path"`
+	OldContent string `json:"old_content,omitempty"`
+	NewContent string `json:"new_content,omitempty"`
+}
+
+type RenameSymbolPermissionsParams struct {
+	Symbol  string             `json:"symbol"`
+	NewName string             `json:"new_name"`
+	Files   []RenameSymbolFile `json:"files"`
+}
+
+// RenameSymbolFileStat counts the changed lines of a file.
+type RenameSymbolFileStat struct {
+	FilePath  string `json:"file_path"`
+	Additions int    `json:"additions"`
+	Removals  int    `json:"removals"`
+}
+
+type RenameSymbolResponseMetadata struct {
+	Files []RenameSymbolFileStat `json:"files"`
+}
+
+const (
+	RenameSymbolToolName = "rename_symbol"
+	// maxRenameFiles bounds the files a rename changes.
+	maxRenameFiles = 200
+)
+
+//go:embed rename_symbol.md
+var renameSymbolDescription []byte
+
+var identifierPattern = regexp.MustCompile(`^[\p{L}_$][\p{L}\p{N}_$]*$`)
+
+func NewRenameSymbolTool(lspClients *csync.Map[string, *lsp.Client], permissions permission.Service, files history.Service, workingDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		RenameSymbolToolName,
+		string(renameSymbolDescription),
+		func(ctx context.Context, params RenameSymbolParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if params.Symbol == "" {
+				return fantasy.NewTextErrorResponse("symbol is required"), nil
+			}
+			if !identifierPattern.MatchString(params.NewName) {
+				return fantasy.NewTextErrorResponse("new_name must be a plain identifier"), nil
+			}
+			oldName := params.Symbol[getSymbolOffset(params.Symbol):]
+			if oldName == params.NewName {
+				return fantasy.NewTextErrorResponse("new_name is the current name of the symbol"), nil
+			}
+			if lspClients.Len() == 0 {
+				return fantasy.NewTextErrorResponse("no LSP clients available"), nil
+			}
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session ID is required for renaming a symbol")
+			}
+			effectiveWorkingDir := cmp.Or(GetWorkingDirFromContext(ctx), workingDir)
+			searchPath := filepathext.SmartJoin(effectiveWorkingDir, cmp.Or(params.Path, "."))
+
+			edit, err := renameEdit(ctx, lspClients, params.Symbol, params.NewName, searchPath)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			if edit == nil {
+				return fantasy.NewTextResponse(fmt.Sprintf("Symbol '%s' not found", params.Symbol)), nil
+			}
+			fileEdits, err := util.TextEditsByFile(*edit)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("failed to read the rename edits: %s", err)), nil
+			}
+			if len(fileEdits) == 0 {
+				return fantasy.NewTextResponse(fmt.Sprintf("No references found for symbol '%s'", params.Symbol)), nil
+			}
+			if len(fileEdits) > maxRenameFiles {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("the rename changes %d files, more than the %d allowed", len(fileEdits), maxRenameFiles)), nil
+			}
+
+			// The edits are computed by the language servers, the files are
+			// read and written through the sandbox
+			sandboxClient := sandbox.GetDefaultClient()
+			var changed []RenameSymbolFile
+			for _, path := range slices.Sorted(maps.Keys(fileEdits)) {
+				resp, err := sandboxClient.ReadFile(ctx, sandbox.FileReadRequest{
+					SessionID: sessionID,
+					FilePath:  path,
+				})
+				if err != nil {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("failed to read file: %s", path)), nil
+				}
+				if err := checkRenameEdits(resp.Content, fileEdits[path], oldName); err != nil {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("%s: %s, run the rename again", path, err)), nil
+				}
+				newContent, err := util.ApplyTextEdits(resp.Content, fileEdits[path])
+				if err != nil {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("%s: %s", path, err)), nil
+				}
+				changed = append(changed, RenameSymbolFile{FilePath: path, OldContent: resp.Content, NewContent: newContent})
+			}
+
+			granted, err := RequestPermissionWithTimeoutSimple(
+				ctx,
+				permissions,
+				permission.CreatePermissionRequest{
+					SessionID:   sessionID,
+					Path:        fsext.PathOrPrefix(searchPath, effectiveWorkingDir),
+					ToolCallID:  call.ID,
+					ToolName:    RenameSymbolToolName,
+					Action:      "write",
+					Description: fmt.Sprintf("Rename %s to %s in %d file(s)", params.Symbol, params.NewName, len(changed)),
+					Params: RenameSymbolPermissionsParams{
+						Symbol:  params.Symbol,
+						NewName: params.NewName,
+						Files:   changed,
+					},
+				},
+			)
+			if err != nil {
+				return fantasy.ToolResponse{}, err
+			}
+			if !granted {
+				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+			}
+
+			var output strings.Builder
+			var metadata RenameSymbolResponseMetadata
+			for i, file := range changed {
+				_, err := sandboxClient.WriteFile(ctx, sandbox.FileWriteRequest{
+					SessionID: sessionID,
+					FilePath:  file.FilePath,
+					Content:   file.NewContent,
+				})
+				if err != nil {
+					if i == 0 {
+						return fantasy.ToolResponse{}, fmt.Errorf("failed to write file to sandbox: %w", err)
+					}
+					// The rename is half done, tell the model what was written
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("failed to write %s: %s\nThe rename was only applied to:\n%s", file.FilePath, err, renamedPaths(changed[:i]))), nil
+				}
+				recordRenameVersions(ctx, files, sessionID, file)
+				recordFileWrite(file.FilePath)
+				recordFileRead(file.FilePath)
+				notifyRenamedFile(ctx, lspClients, file.FilePath)
+
+				fileDiff, additions, removals := diff.GenerateDiff(
+					file.OldContent,
+					file.NewContent,
+					strings.TrimPrefix(file.FilePath, effectiveWorkingDir),
+				)
+				metadata.Files = append(metadata.Files, RenameSymbolFileStat{
+					FilePath:  file.FilePath,
+					Additions: additions,
+					Removals:  removals,
+				})
+				output.WriteString(fileDiff)
+				output.WriteString("\n")
+			}
+
+			text := fmt.Sprintf("Renamed %s to %s in %d file(s):\n\n%s", params.Symbol, params.NewName, len(changed), output.String())
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(text), metadata), nil
+		})
+}
+
+// renameEdit returns the edits of the rename of the first occurrence of the
+// symbol under searchPath that a language server knows, nil if there is none.
+func renameEdit(ctx context.Context, lspClients *csync.Map[string, *lsp.Client], symbol, newName, searchPath string) (*protocol.WorkspaceEdit, error) {
+	matches, _, err := searchFiles(ctx, regexp.QuoteMeta(symbol), searchPath, "", 100)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for symbol: %s", err)
+	}
+	var lastErr error
+	for _, match := range matches {
+		absPath, err := filepath.Abs(match.path)
+		if err != nil {
+			continue
+		}
+		client := clientForFile(lspClients, absPath)
+		if client == nil {
+			continue
+		}
+		edit, err := client.Rename(ctx, absPath, match.lineNum, match.charNum+getSymbolOffset(symbol), newName)
+		if err != nil {
+			if !strings.Contains(err.Error(), "no identifier found") {
+				slog.Error("Failed to rename symbol", "error", err, "symbol", symbol, "path", match.path, "line", match.lineNum, "char", match.charNum)
+				lastErr = err
+			}
+			// grep probably matched a comment or a string value
+			continue
+		}
+		if len(edit.Changes) > 0 || len(edit.DocumentChanges) > 0 {
+			return edit, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to rename symbol: %s", lastErr)
+	}
+	return nil, nil
+}
+
+// checkRenameEdits makes sure that the edits replace the old name in the
+// content, which may have changed since the language server read the file.
+func checkRenameEdits(content string, edits []protocol.TextEdit, oldName string) error {
+	lines := strings.Split(content, "\n")
+	for _, edit := range edits {
+		r := edit.Range
+		if r.Start.Line != r.End.Line || int(r.Start.Line) >= len(lines) {
+			return fmt.Errorf("unexpected edit at line %d", r.Start.Line+1)
+		}
+		line := lines[r.Start.Line]
+		start, end := int(r.Start.Character), int(r.End.Character)
+		if start > end || end > len(line) || line[start:end] != oldName || !wordBounded(line, start, end) {
+			return fmt.Errorf("the file changed at line %d", r.Start.Line+1)
+		}
+	}
+	return nil
+}
+
+// wordBounded reports whether the identifier at line[start:end] is not a
+// part of a longer one.
+func wordBounded(line string, start, end int) bool {
+	if start > 0 && identifierPattern.MatchString(line[start-1:end]) {
+		return false
+	}
+	return end == len(line) || !identifierPattern.MatchString(line[start:end+1])
+}
+
+// recordRenameVersions records the versions of a renamed file in the history
+// of the session.
+func recordRenameVersions(ctx context.Context, files history.Service, sessionID string, file RenameSymbolFile) {
+	existing, err := files.GetByPathAndSession(ctx, file.FilePath, sessionID)
+	if err != nil {
+		if _, err := files.Create(ctx, sessionID, file.FilePath, file.OldContent); err != nil {
+			slog.Error("Error creating file history", "error", err)
+		}
+	} else if existing.Content != file.OldContent {
+		// The file changed since its last version, store an intermediate one
+		if _, err := files.CreateVersion(ctx, sessionID, file.FilePath, file.OldContent); err != nil {
+			slog.Error("Error creating file history version", "error", err)
+		}
+	}
+	if _, err := files.CreateVersion(ctx, sessionID, file.FilePath, file.NewContent); err != nil {
+		slog.Error("Error creating file history version", "error", err)
+	}
+}
+
+// notifyRenamedFile tells the language servers that have a renamed file open
+// about its new content, so that a next rename sees it.
+func notifyRenamedFile(ctx context.Context, lspClients *csync.Map[string, *lsp.Client], path string) {
+	for client := range lspClients.Seq() {
+		if client.HandlesFile(path) && client.IsFileOpen(path) {
+			_ = client.NotifyChange(ctx, path)
+		}
+	}
+}
+
+func renamedPaths(files []RenameSymbolFile) string {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = "- " + file.FilePath
+	}
+	return strings.Join(paths, "\n")
+}
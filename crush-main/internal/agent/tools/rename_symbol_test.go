@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/x/powernap/pkg/lsp/protocol"
+	"github.com/rolling1314/rolling-crush/internal/lsp/util"
+	"github.com/stretchr/testify/require"
+)
+
+func renameAt(line, start, end uint32, newName string) protocol.TextEdit {
+	return protocol.TextEdit{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: line, Character: start},
+			End:   protocol.Position{Line: line, Character: end},
+		},
+		NewText: newName,
+	}
+}
+
+func TestRenameEdits(t *testing.T) {
+	t.Parallel()
+
+	content := "func Load() {}\n\nfunc main() {\n\tLoad(); Load()\n}\n"
+	edits := []protocol.TextEdit{
+		renameAt(0, 5, 9, "Read"),
+		renameAt(3, 1, 5, "Read"),
+		renameAt(3, 9, 13, "Read"),
+	}
+
+	require.NoError(t, checkRenameEdits(content, edits, "Load"))
+	renamed, err := util.ApplyTextEdits(content, edits)
+	require.NoError(t, err)
+	require.Equal(t, "func Read() {}\n\nfunc main() {\n\tRead(); Read()\n}\n", renamed)
+
+	// CRLF line endings are kept
+	renamed, err = util.ApplyTextEdits("var a = 1\r\nb := a\r\n", []protocol.TextEdit{renameAt(0, 4, 5, "x"), renameAt(1, 5, 6, "x")})
+	require.NoError(t, err)
+	require.Equal(t, "var x = 1\r\nb := x\r\n", renamed)
+
+	// Edits made on another content are refused
+	require.Error(t, checkRenameEdits("func Loader() {}\n", edits[:1], "Load"))
+	require.Error(t, checkRenameEdits("func Load() {}\n", edits[1:2], "Load"))
+	require.Error(t, checkRenameEdits("ab\n", []protocol.TextEdit{renameAt(0, 2, 1, "x")}, "ab"))
+}
@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"time"
+
+	"charm.land/fantasy"
+)
+
+const (
+	// DefaultResultCacheTTL is how long a cached tool result is kept when
+	// no TTL is configured.
+	DefaultResultCacheTTL = 10 * time.Minute
+	// MaxResultCacheEntrySize is the largest tool result kept in the cache.
+	MaxResultCacheEntrySize = 256 * 1024
+)
+
+// cachedToolNames are the tools whose results are cached: they only read
+// the workspace and their result only depends on their input and its
+// content. The fetch tool is cached by the ETag of the pages instead, see
+// FetchCache.
+var cachedToolNames = []string{
+	GrepToolName,
+	GlobToolName,
+	ViewToolName,
+}
+
+// readOnlyToolNames are the tools that never change the workspace. Any
+// other tool invalidates the cached results of the workspace once it ran.
+var readOnlyToolNames = []string{
+	GrepToolName,
+	GlobToolName,
+	ViewToolName,
+	LSToolName,
+	FetchToolName,
+	WebFetchToolName,
+	SourcegraphToolName,
+	DiagnosticsToolName,
+	ReferencesToolName,
+	GitStatusToolName,
+	GitDiffToolName,
+	JobOutputToolName,
+	TodosToolName,
+}
+
+// ResultCache stores the results of the cached tools per workspace, the
+// working directory shared by the sessions of a project. Results are keyed
+// on the version of the content of the workspace, so that Invalidate drops
+// them all at once for every session. Get returns a nil value on a miss.
+type ResultCache interface {
+	// Version returns the current version of the content of a workspace.
+	Version(ctx context.Context, workspace string) (string, error)
+	// Invalidate moves a workspace to a new version.
+	Invalidate(ctx context.Context, workspace string) error
+	Get(ctx context.Context, workspace, key string) ([]byte, error)
+	Set(ctx context.Context, workspace, key string, value []byte, ttl time.Duration) error
+}
+
+// WithResultCache serves repeated calls of the cached tools from the cache
+// until the workspace changes. The tools that may change the workspace
+// invalidate its cache once they ran. The workspace of a call is its
+// working directory, workingDir when the context has none. Without a cache
+// the tools are returned as they are.
+func WithResultCache(tools []fantasy.AgentTool, cache ResultCache, ttl time.Duration, workingDir string) []fantasy.AgentTool {
+	if cache == nil {
+		return tools
+	}
+	wrapped := make([]fantasy.AgentTool, len(tools))
+	for i, tool := range tools {
+		name := tool.Info().Name
+		switch {
+		case slices.Contains(cachedToolNames, name):
+			wrapped[i] = &cachedTool{AgentTool: tool, cache: cache, ttl: cmp.Or(ttl, DefaultResultCacheTTL), workingDir: workingDir}
+		case slices.Contains(readOnlyToolNames, name):
+			wrapped[i] = tool
+		default:
+			wrapped[i] = &invalidatingTool{AgentTool: tool, cache: cache, workingDir: workingDir}
+		}
+	}
+	return wrapped
+}
+
+// cachedTool serves the results of a read-only tool from the cache.
+type cachedTool struct {
+	fantasy.AgentTool
+	cache      ResultCache
+	ttl        time.Duration
+	workingDir string
+}
+
+func (t *cachedTool) Run(ctx context.Context, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	workspace := cmp.Or(GetWorkingDirFromContext(ctx), t.workingDir)
+	if workspace == "" {
+		return t.AgentTool.Run(ctx, call)
+	}
+	version, err := t.cache.Version(ctx, workspace)
+	if err != nil {
+		slog.Warn("Failed to read tool result cache version", "workspace", workspace, "error", err)
+		return t.AgentTool.Run(ctx, call)
+	}
+	key, ok := resultCacheKey(t.Info().Name, workspace, call.Input, version)
+	if !ok {
+		return t.AgentTool.Run(ctx, call)
+	}
+
+	if value, err := t.cache.Get(ctx, workspace, key); err != nil {
+		slog.Warn("Failed to read tool result cache", "workspace", workspace, "tool", t.Info().Name, "error", err)
+	} else if value != nil {
+		var resp fantasy.ToolResponse
+		if err := json.Unmarshal(value, &resp); err == nil {
+			slog.Debug("Tool result served from cache", "workspace", workspace, "tool", t.Info().Name)
+			t.replay(resp)
+			return resp, nil
+		}
+	}
+
+	resp, err := t.AgentTool.Run(ctx, call)
+	if err != nil || resp.IsError || len(resp.Content) > MaxResultCacheEntrySize {
+		return resp, err
+	}
+	data, marshalErr := json.Marshal(resp)
+	if marshalErr != nil {
+		return resp, nil
+	}
+	if setErr := t.cache.Set(ctx, workspace, key, data, t.ttl); setErr != nil {
+		slog.Warn("Failed to write tool result cache", "workspace", workspace, "tool", t.Info().Name, "error", setErr)
+	}
+	return resp, nil
+}
+
+// replay repeats the side effects of a call served from the cache: a file
+// viewed again counts as read before it is edited.
+func (t *cachedTool) replay(resp fantasy.ToolResponse) {
+	if t.Info().Name != ViewToolName {
+		return
+	}
+	var metadata ViewResponseMetadata
+	if err := json.Unmarshal([]byte(resp.Metadata), &metadata); err == nil && metadata.FilePath != "" {
+		recordFileRead(metadata.FilePath)
+	}
+}
+
+// invalidatingTool invalidates the cached results of the workspace once a
+// tool that may change it ran.
+type invalidatingTool struct {
+	fantasy.AgentTool
+	cache      ResultCache
+	workingDir string
+}
+
+func (t *invalidatingTool) Run(ctx context.Context, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	resp, err := t.AgentTool.Run(ctx, call)
+	if workspace := cmp.Or(GetWorkingDirFromContext(ctx), t.workingDir); workspace != "" {
+		// The call may have changed files even when it failed or was cancelled
+		if invalidateErr := t.cache.Invalidate(context.WithoutCancel(ctx), workspace); invalidateErr != nil {
+			slog.Warn("Failed to invalidate tool result cache", "workspace", workspace, "tool", t.Info().Name, "error", invalidateErr)
+		}
+	}
+	return resp, err
+}
+
+// resultCacheKey hashes a tool call with its input normalized, so that the
+// order of the parameters and the ones set to their zero value do not
+// matter. Inputs that are not a JSON object are not cached.
+func resultCacheKey(toolName, workspace, input, version string) (string, bool) {
+	var params map[string]any
+	if err := json.Unmarshal([]byte(cmp.Or(input, "{}")), &params); err != nil {
+		return "", false
+	}
+	for name, value := range params {
+		switch value {
+		case nil, "", false, float64(0):
+			delete(params, name)
+		}
+	}
+	// Maps are marshalled with their keys sorted
+	normalized, err := json.Marshal(params)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(toolName + "\n" + workspace + "\n" + version + "\n" + string(normalized)))
+	return hex.EncodeToString(sum[:]), true
+}
@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryResultCache keeps the results in memory, versions are counters.
+type memoryResultCache struct {
+	mu       sync.Mutex
+	versions map[string]int
+	values   map[string][]byte
+}
+
+func newMemoryResultCache() *memoryResultCache {
+	return &memoryResultCache{versions: make(map[string]int), values: make(map[string][]byte)}
+}
+
+func (c *memoryResultCache) Version(_ context.Context, workspace string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strconv.Itoa(c.versions[workspace]), nil
+}
+
+func (c *memoryResultCache) Invalidate(_ context.Context, workspace string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions[workspace]++
+	return nil
+}
+
+func (c *memoryResultCache) Get(_ context.Context, workspace, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[workspace+":"+key], nil
+}
+
+func (c *memoryResultCache) Set(_ context.Context, workspace, key string, value []byte, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[workspace+":"+key] = value
+	return nil
+}
+
+type grepTestParams struct {
+	Pattern string `json:"pattern"`
+	Path    string `json:"path,omitempty"`
+}
+
+func TestWithResultCache(t *testing.T) {
+	t.Parallel()
+
+	var runs int
+	grep := fantasy.NewAgentTool(GrepToolName, "counts its runs", func(_ context.Context, params grepTestParams, _ fantasy.ToolCall) (fantasy.ToolResponse, error) {
+		runs++
+		if params.Pattern == "" {
+			return fantasy.NewTextErrorResponse("pattern is required"), nil
+		}
+		return fantasy.NewTextResponse("run " + strconv.Itoa(runs)), nil
+	})
+	ls := fantasy.NewAgentTool(LSToolName, "read-only", func(context.Context, emptyParams, fantasy.ToolCall) (fantasy.ToolResponse, error) {
+		return fantasy.NewTextResponse("ok"), nil
+	})
+	edit := fantasy.NewAgentTool(EditToolName, "changes files", func(context.Context, emptyParams, fantasy.ToolCall) (fantasy.ToolResponse, error) {
+		return fantasy.NewTextResponse("edited"), nil
+	})
+
+	cache := newMemoryResultCache()
+	wrapped := WithResultCache([]fantasy.AgentTool{grep, ls, edit}, cache, 0, "/work/project")
+	require.Same(t, ls, wrapped[1], "read-only tools that are not cached are not wrapped")
+
+	ctx := context.WithValue(t.Context(), SessionIDContextKey, "s1")
+	run := func(tool fantasy.AgentTool, input string) fantasy.ToolResponse {
+		resp, err := tool.Run(ctx, fantasy.ToolCall{ID: "1", Name: tool.Info().Name, Input: input})
+		require.NoError(t, err)
+		return resp
+	}
+
+	require.Equal(t, "run 1", run(wrapped[0], `{"pattern":"foo","path":""}`).Content)
+	require.Equal(t, "run 1", run(wrapped[0], `{"pattern": "foo"}`).Content, "the normalized input hits the cache")
+	require.Equal(t, "run 2", run(wrapped[0], `{"pattern":"bar"}`).Content)
+
+	// Errors are not cached
+	require.True(t, run(wrapped[0], `{}`).IsError)
+	require.True(t, run(wrapped[0], `{}`).IsError)
+	require.Equal(t, 4, runs)
+
+	run(wrapped[2], `{}`)
+	require.Equal(t, "run 5", run(wrapped[0], `{"pattern":"foo"}`).Content, "an edit invalidates the cache")
+
+	// The sessions of the same workspace share their results
+	other := context.WithValue(t.Context(), SessionIDContextKey, "s2")
+	resp, err := wrapped[0].Run(other, fantasy.ToolCall{ID: "2", Name: GrepToolName, Input: `{"pattern":"foo"}`})
+	require.NoError(t, err)
+	require.Equal(t, "run 5", resp.Content)
+
+	// An edit of another session invalidates them for all
+	_, err = wrapped[2].Run(other, fantasy.ToolCall{ID: "3", Name: EditToolName, Input: `{}`})
+	require.NoError(t, err)
+	require.Equal(t, "run 6", run(wrapped[0], `{"pattern":"foo"}`).Content)
+
+	// Other workspaces have their own results
+	elsewhere := context.WithValue(other, WorkingDirContextKey, "/work/other")
+	resp, err = wrapped[0].Run(elsewhere, fantasy.ToolCall{ID: "4", Name: GrepToolName, Input: `{"pattern":"foo"}`})
+	require.NoError(t, err)
+	require.Equal(t, "run 7", resp.Content)
+}
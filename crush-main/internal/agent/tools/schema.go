@@ -0,0 +1,62 @@
+package tools
+
+import "charm.land/fantasy"
+
+// basicSchemaKeywords are the JSON schema keywords kept in the tool schemas
+// sent to providers that validate them strictly.
+var basicSchemaKeywords = []string{"type", "description", "properties", "items", "required", "enum"}
+
+// WithStrictSchemas strips the parameter schemas of the tools down to the
+// basic keywords, dropping formats, patterns, bounds, defaults and the like.
+func WithStrictSchemas(tools []fantasy.AgentTool) []fantasy.AgentTool {
+	strict := make([]fantasy.AgentTool, len(tools))
+	for i, tool := range tools {
+		strict[i] = &strictSchemaTool{AgentTool: tool}
+	}
+	return strict
+}
+
+// strictSchemaTool is a tool whose info has a basic parameter schema.
+type strictSchemaTool struct {
+	fantasy.AgentTool
+}
+
+func (t *strictSchemaTool) Info() fantasy.ToolInfo {
+	info := t.AgentTool.Info()
+	params := make(map[string]any, len(info.Parameters))
+	for name, schema := range info.Parameters {
+		params[name] = basicSchema(schema)
+	}
+	info.Parameters = params
+	return info
+}
+
+// basicSchema returns a copy of a schema with only the basic keywords, in the
+// nested schemas too. Values that are not schemas are returned as they are.
+func basicSchema(schema any) any {
+	fields, ok := schema.(map[string]any)
+	if !ok {
+		return schema
+	}
+	basic := make(map[string]any, len(basicSchemaKeywords))
+	for _, keyword := range basicSchemaKeywords {
+		value, ok := fields[keyword]
+		if !ok {
+			continue
+		}
+		switch keyword {
+		case "properties":
+			if properties, ok := value.(map[string]any); ok {
+				nested := make(map[string]any, len(properties))
+				for name, property := range properties {
+					nested[name] = basicSchema(property)
+				}
+				value = nested
+			}
+		case "items":
+			value = basicSchema(value)
+		}
+		basic[keyword] = value
+	}
+	return basic
+}
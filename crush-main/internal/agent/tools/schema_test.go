@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaTestParams struct {
+	Path  string   `json:"path" description:"The file to read"`
+	Lines []string `json:"lines,omitempty" description:"The lines to keep"`
+}
+
+func TestWithStrictSchemas(t *testing.T) {
+	t.Parallel()
+
+	view := fantasy.NewAgentTool(ViewToolName, "reads a file", func(context.Context, schemaTestParams, fantasy.ToolCall) (fantasy.ToolResponse, error) {
+		return fantasy.NewTextResponse("ok"), nil
+	})
+	strict := WithStrictSchemas([]fantasy.AgentTool{view})[0]
+
+	info := strict.Info()
+	require.Equal(t, ViewToolName, info.Name)
+	require.Equal(t, view.Info().Required, info.Required)
+	require.Equal(t, map[string]any{"type": "string", "description": "The file to read"}, info.Parameters["path"])
+
+	resp, err := strict.Run(t.Context(), fantasy.ToolCall{ID: "1", Name: ViewToolName, Input: `{"path":"a.go"}`})
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp.Content)
+}
+
+func TestBasicSchema(t *testing.T) {
+	t.Parallel()
+
+	schema := map[string]any{
+		"type":        "object",
+		"description": "options",
+		"default":     map[string]any{},
+		"properties": map[string]any{
+			"count": map[string]any{"type": "integer", "minimum": 1, "maximum": 10},
+			"mode":  map[string]any{"type": "string", "enum": []any{"a", "b"}, "pattern": "^[ab]$"},
+			"paths": map[string]any{"type": "array", "items": map[string]any{"type": "string", "format": "uri"}},
+		},
+		"required":             []string{"count"},
+		"additionalProperties": false,
+	}
+	require.Equal(t, map[string]any{
+		"type":        "object",
+		"description": "options",
+		"properties": map[string]any{
+			"count": map[string]any{"type": "integer"},
+			"mode":  map[string]any{"type": "string", "enum": []any{"a", "b"}},
+			"paths": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+		"required": []string{"count"},
+	}, basicSchema(schema))
+	require.Contains(t, schema, "additionalProperties", "the schema is copied")
+}
@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rolling1314/rolling-crush/internal/pubsub"
+)
+
+// maxToolOutputChunk bounds the content of one output delta, larger writes are
+// split.
+const maxToolOutputChunk = 4096
+
+// ToolOutputDelta carries a chunk of the output of a running tool call, e.g.
+// the live terminal output of a build. Seq numbers the chunks of a tool call
+// from 1 so that clients can order them and detect gaps.
+type ToolOutputDelta struct {
+	SessionID  string `json:"session_id"`
+	ToolCallID string `json:"tool_call_id"`
+	ToolName   string `json:"tool_name"`
+	// Stream is "stdout" or "stderr".
+	Stream    string `json:"stream"`
+	Content   string `json:"content"`
+	Seq       int64  `json:"seq"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+var toolOutputBroker = pubsub.NewBroker[ToolOutputDelta]()
+
+// SubscribeToolOutput returns a channel for the output deltas of tool calls.
+func SubscribeToolOutput(ctx context.Context) <-chan pubsub.Event[ToolOutputDelta] {
+	return toolOutputBroker.Subscribe(ctx)
+}
+
+// toolOutputStream publishes the output of one tool call as numbered deltas.
+type toolOutputStream struct {
+	sessionID  string
+	toolCallID string
+	toolName   string
+
+	mu  sync.Mutex
+	seq int64
+}
+
+func newToolOutputStream(sessionID, toolCallID, toolName string) *toolOutputStream {
+	return &toolOutputStream{sessionID: sessionID, toolCallID: toolCallID, toolName: toolName}
+}
+
+// write publishes data of a stream, split into chunks of at most
+// maxToolOutputChunk bytes without breaking UTF-8 sequences.
+func (s *toolOutputStream) write(stream, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for data != "" {
+		n := min(len(data), maxToolOutputChunk)
+		for n < len(data) && n > 0 && !utf8.RuneStart(data[n]) {
+			n--
+		}
+		if n == 0 {
+			n = min(len(data), maxToolOutputChunk)
+		}
+		s.seq++
+		toolOutputBroker.Publish(pubsub.CreatedEvent, ToolOutputDelta{
+			SessionID:  s.sessionID,
+			ToolCallID: s.toolCallID,
+			ToolName:   s.toolName,
+			Stream:     stream,
+			Content:    data[:n],
+			Seq:        s.seq,
+			Timestamp:  time.Now().UnixMilli(),
+		})
+		data = data[n:]
+	}
+}
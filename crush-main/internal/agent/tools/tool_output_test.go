@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolOutputStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	events := SubscribeToolOutput(ctx)
+
+	stream := newToolOutputStream("s1", "call-1", BashToolName)
+	stream.write("stdout", "building\n")
+	// A multi-byte rune straddles the chunk boundary
+	long := strings.Repeat("a", maxToolOutputChunk-1) + "é" + "tail"
+	stream.write("stderr", long)
+
+	var got []ToolOutputDelta
+	for len(got) < 3 {
+		select {
+		case event := <-events:
+			if event.Payload.ToolCallID == "call-1" {
+				got = append(got, event.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of 3 deltas", len(got))
+		}
+	}
+
+	require.Equal(t, "building\n", got[0].Content)
+	require.Equal(t, "stdout", got[0].Stream)
+	require.Equal(t, strings.Repeat("a", maxToolOutputChunk-1), got[1].Content)
+	require.Equal(t, "étail", got[2].Content)
+	require.Equal(t, "stderr", got[2].Stream)
+	for i, delta := range got {
+		require.Equal(t, int64(i+1), delta.Seq)
+		require.Equal(t, "s1", delta.SessionID)
+	}
+}
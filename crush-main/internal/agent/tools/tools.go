@@ -2,18 +2,56 @@ package tools
 
 import (
 	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/pkg/config"
 )
 
 type (
-	sessionIDContextKey  string
-	messageIDContextKey  string
-	workingDirContextKey string
+	sessionIDContextKey         string
+	messageIDContextKey         string
+	workingDirContextKey        string
+	planModeContextKey          string
+	stopSignalContextKey        string
+	permissionTimeoutContextKey string
+	resumeToolCallContextKey    string
+	busyPolicyContextKey        string
+	envContextKey               string
+	sessionEnvContextKey        string
+	modelOverrideContextKey     string
 )
 
 const (
 	SessionIDContextKey  sessionIDContextKey  = "session_id"
 	MessageIDContextKey  messageIDContextKey  = "message_id"
 	WorkingDirContextKey workingDirContextKey = "working_dir"
+	// PlanModeContextKey holds true when the prompt runs in plan mode, with
+	// read-only tools only.
+	PlanModeContextKey planModeContextKey = "plan_mode"
+	// StopSignalContextKey holds a <-chan struct{} closed when the turn is
+	// soft cancelled. Tools finish their work but stop waiting on the user.
+	StopSignalContextKey stopSignalContextKey = "stop_signal"
+	// PermissionTimeoutContextKey holds the time.Duration permission requests
+	// wait for the user, set from the project and tool settings.
+	PermissionTimeoutContextKey permissionTimeoutContextKey = "permission_timeout"
+	// ResumeToolCallContextKey holds the ID of a tool call suspended on a
+	// timed out permission request, run before the prompt once granted.
+	ResumeToolCallContextKey resumeToolCallContextKey = "resume_tool_call"
+	// BusyPolicyContextKey holds the config.BusyPolicy a prompt asked for,
+	// overriding the one of its session.
+	BusyPolicyContextKey busyPolicyContextKey = "busy_policy"
+	// EnvContextKey holds the map[string]string environment variables set
+	// for the commands run in the sandbox, the secrets of the project.
+	EnvContextKey envContextKey = "env"
+	// SessionEnvContextKey holds the map[string]string environment variables
+	// the user set for the session, see config.SessionEnv. They override
+	// the ones of EnvContextKey and are also expanded in fetched URLs.
+	SessionEnvContextKey sessionEnvContextKey = "session_env"
+	// ModelOverrideContextKey holds the *config.ModelOverride of a turn, e.g.
+	// a retry with another model, applied to the large model of the session.
+	ModelOverrideContextKey modelOverrideContextKey = "model_override"
 )
 
 func GetSessionFromContext(ctx context.Context) string {
@@ -51,3 +89,92 @@ func GetWorkingDirFromContext(ctx context.Context) string {
 	}
 	return wd
 }
+
+// IsPlanModeFromContext reports whether the prompt runs in plan mode.
+func IsPlanModeFromContext(ctx context.Context) bool {
+	planMode, _ := ctx.Value(PlanModeContextKey).(bool)
+	return planMode
+}
+
+// GetStopSignalFromContext returns the soft cancellation signal of the turn,
+// nil when the turn cannot be soft cancelled.
+func GetStopSignalFromContext(ctx context.Context) <-chan struct{} {
+	stop, _ := ctx.Value(StopSignalContextKey).(<-chan struct{})
+	return stop
+}
+
+// GetPermissionTimeoutFromContext returns how long permission requests wait
+// for the user, 0 when the context does not set it.
+func GetPermissionTimeoutFromContext(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(PermissionTimeoutContextKey).(time.Duration)
+	return timeout
+}
+
+// GetResumeToolCallFromContext returns the ID of the suspended tool call the
+// prompt resumes, if any.
+func GetResumeToolCallFromContext(ctx context.Context) string {
+	toolCallID, _ := ctx.Value(ResumeToolCallContextKey).(string)
+	return toolCallID
+}
+
+// GetBusyPolicyFromContext returns the busy policy the prompt asked for, empty
+// when it follows the one of its session.
+func GetBusyPolicyFromContext(ctx context.Context) config.BusyPolicy {
+	policy, _ := ctx.Value(BusyPolicyContextKey).(config.BusyPolicy)
+	return policy
+}
+
+// GetModelOverrideFromContext returns the model override of the turn, nil
+// when it runs with the models of its session.
+func GetModelOverrideFromContext(ctx context.Context) *config.ModelOverride {
+	override, _ := ctx.Value(ModelOverrideContextKey).(*config.ModelOverride)
+	return override
+}
+
+// GetEnvFromContext returns the environment variables of the sandbox
+// commands, nil when the context does not set any.
+func GetEnvFromContext(ctx context.Context) map[string]string {
+	env, _ := ctx.Value(EnvContextKey).(map[string]string)
+	return env
+}
+
+// GetSessionEnvFromContext returns the environment variables the user set for
+// the session, nil when the context does not set any.
+func GetSessionEnvFromContext(ctx context.Context) map[string]string {
+	env, _ := ctx.Value(SessionEnvContextKey).(map[string]string)
+	return env
+}
+
+// expandSessionEnv replaces the $NAME and ${NAME} references to the session
+// environment variables in s, e.g. in a fetched URL. References to other
+// variables are kept as $NAME.
+func expandSessionEnv(ctx context.Context, s string) string {
+	env := GetSessionEnvFromContext(ctx)
+	if len(env) == 0 || !strings.Contains(s, "$") {
+		return s
+	}
+	return os.Expand(s, func(name string) string {
+		if value, ok := env[name]; ok {
+			return value
+		}
+		return "$" + name
+	})
+}
+
+// withStopSignal returns a context cancelled when the turn is soft cancelled,
+// for waits that have not changed anything yet.
+func withStopSignal(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := GetStopSignalFromContext(ctx)
+	if stop == nil {
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithStopSignal(t *testing.T) {
+	t.Parallel()
+
+	t.Run("without signal", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := withStopSignal(t.Context())
+		defer cancel()
+		require.NoError(t, ctx.Err())
+	})
+
+	t.Run("signal cancels the context", func(t *testing.T) {
+		t.Parallel()
+		stop := make(chan struct{})
+		parent := context.WithValue(t.Context(), StopSignalContextKey, (<-chan struct{})(stop))
+		require.NotNil(t, GetStopSignalFromContext(parent))
+
+		ctx, cancel := withStopSignal(parent)
+		defer cancel()
+		require.NoError(t, ctx.Err())
+
+		close(stop)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("context not cancelled by the stop signal")
+		}
+		require.NoError(t, parent.Err())
+	})
+}
+
+func TestSessionEnv(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.WithValue(t.Context(), EnvContextKey, map[string]string{"DATABASE_URL": "project", "TOKEN": "secret"})
+	ctx = context.WithValue(ctx, SessionEnvContextKey, map[string]string{"DATABASE_URL": "session", "API_BASE_URL": "http://localhost:8080", "TERM": "xterm"})
+
+	env := commandEnv(ctx)
+	require.Equal(t, "session", env["DATABASE_URL"], "session variables override project ones")
+	require.Equal(t, "secret", env["TOKEN"])
+	require.Equal(t, "dumb", env["TERM"], "bash variables stay on top")
+
+	require.Equal(t, "http://localhost:8080/health?q=$OTHER", expandSessionEnv(ctx, "${API_BASE_URL}/health?q=$OTHER"))
+	require.Equal(t, "http://example.com/$TOKEN", expandSessionEnv(ctx, "http://example.com/$TOKEN"), "project secrets are not expanded")
+	require.Equal(t, "$API_BASE_URL", expandSessionEnv(t.Context(), "$API_BASE_URL"))
+}
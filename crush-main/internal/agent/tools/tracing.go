@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"context"
+	"errors"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WithTracing runs each call of the tools in a span. The tools are returned
+// as they are when tracing is disabled.
+func WithTracing(tools []fantasy.AgentTool) []fantasy.AgentTool {
+	if !tracing.Enabled() {
+		return tools
+	}
+	traced := make([]fantasy.AgentTool, len(tools))
+	for i, tool := range tools {
+		traced[i] = &tracedTool{AgentTool: tool}
+	}
+	return traced
+}
+
+type tracedTool struct {
+	fantasy.AgentTool
+}
+
+func (t *tracedTool) Run(ctx context.Context, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	ctx, span := tracing.Start(ctx, "tool "+t.Info().Name,
+		attribute.String("tool.name", t.Info().Name),
+		tracing.SessionIDKey.String(GetSessionFromContext(ctx)),
+		tracing.MessageIDKey.String(GetMessageFromContext(ctx)),
+		tracing.ToolCallIDKey.String(call.ID),
+	)
+	resp, err := t.AgentTool.Run(ctx, call)
+	span.SetAttributes(attribute.Bool("tool.is_error", resp.IsError), attribute.Int("tool.response_size", len(resp.Content)))
+	spanErr := err
+	if spanErr == nil && resp.IsError {
+		spanErr = errors.New(resp.Content)
+	}
+	tracing.End(span, spanErr)
+	return resp, err
+}
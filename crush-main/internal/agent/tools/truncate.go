@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+const (
+	// maxSyntaxLexSize is the largest content we tokenize to find boundaries;
+	// larger content falls back to plain line truncation.
+	maxSyntaxLexSize = 1024 * 1024
+	// maxOmittedSymbols caps the index of omitted declarations in a truncation note.
+	maxOmittedSymbols = 50
+)
+
+// truncatedSymbol is a declaration that was cut from a truncated tool result.
+type truncatedSymbol struct {
+	Name string
+	Kind string
+	Line int // 1-based line number in the file
+}
+
+// lineSyntax holds per-line information derived from the lexer tokens.
+type lineSyntax struct {
+	depth   int  // bracket nesting depth at the start of the line
+	comment bool // the line only contains a comment
+}
+
+// syntaxAwareCut picks how many of lines to keep, at most limit, so that the
+// cut lands on a syntactic boundary instead of in the middle of a function or
+// block. It also returns the top-level declarations found in the omitted part.
+// firstLine is the 1-based file line number of lines[0].
+//
+// Go, Python and Java files are parsed with tree-sitter, see treeSitterCut.
+// The other file types, and all of them in builds without cgo, use the chroma
+// lexer for the file type: brackets inside strings and comments are ignored,
+// and a top-level boundary is a line at nesting depth zero that starts in the
+// first column. Doc comments directly above a declaration stay with the
+// declaration. When no boundary is found in the second half of the window, a
+// blank line is used, and as a last resort the cut falls on the line limit.
+func syntaxAwareCut(filePath string, lines []string, limit, firstLine int) (int, []truncatedSymbol) {
+	if limit >= len(lines) {
+		return len(lines), nil
+	}
+	if limit <= 0 {
+		return 0, nil
+	}
+
+	content := strings.Join(lines, "\n")
+	if len(content) > maxSyntaxLexSize {
+		return limit, nil
+	}
+	if keep, omitted, ok := treeSitterCut(filePath, lines, limit, firstLine); ok {
+		return keep, omitted
+	}
+
+	lexer := lexers.Match(filePath)
+	if lexer == nil {
+		lexer = lexers.Analyse(content)
+	}
+	if lexer == nil {
+		return limit, nil
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, content)
+	if err != nil {
+		return limit, nil
+	}
+
+	syntax := make([]lineSyntax, len(lines))
+	var symbols []truncatedSymbol
+	line, depth := 0, 0
+	lineHasCode, lineHasComment := false, false
+	var pendingKind string
+
+	finishLine := func() {
+		if line < len(syntax) {
+			syntax[line].comment = lineHasComment && !lineHasCode
+		}
+		line++
+		if line < len(syntax) {
+			syntax[line].depth = depth
+		}
+		lineHasCode, lineHasComment = false, false
+	}
+
+	for _, token := range iterator.Tokens() {
+		value := token.Value
+		for {
+			chunk, rest, hasNewline := strings.Cut(value, "\n")
+			if strings.TrimSpace(chunk) != "" {
+				switch {
+				case token.Type.InCategory(chroma.Comment):
+					lineHasComment = true
+				default:
+					lineHasCode = true
+				}
+			}
+
+			switch {
+			case token.Type.InCategory(chroma.Comment), token.Type.InCategory(chroma.LiteralString):
+				// Brackets inside comments and strings do not affect nesting
+			case token.Type == chroma.Punctuation || token.Type == chroma.Operator || token.Type == chroma.Text:
+				for _, r := range chunk {
+					switch r {
+					case '{', '(', '[':
+						depth++
+					case '}', ')', ']':
+						depth = max(depth-1, 0)
+					}
+				}
+			case token.Type.InCategory(chroma.Keyword):
+				if kind := declarationKind(chunk); kind != "" {
+					pendingKind = kind
+				}
+			case token.Type == chroma.NameFunction || token.Type == chroma.NameClass:
+				if depth <= 1 && strings.TrimSpace(chunk) != "" {
+					kind := pendingKind
+					if kind == "" {
+						kind = "function"
+						if token.Type == chroma.NameClass {
+							kind = "class"
+						}
+					}
+					symbols = append(symbols, truncatedSymbol{
+						Name: strings.TrimSpace(chunk),
+						Kind: kind,
+						Line: line,
+					})
+				}
+				pendingKind = ""
+			}
+
+			if !hasNewline {
+				break
+			}
+			finishLine()
+			value = rest
+		}
+	}
+
+	keep := 0
+	for i := limit; i >= limit/2 && i > 0; i-- {
+		if isTopLevelBoundary(lines, syntax, i) {
+			keep = i
+			break
+		}
+	}
+	if keep == 0 {
+		for i := limit; i >= limit*3/4 && i > 0; i-- {
+			if strings.TrimSpace(lines[i-1]) == "" {
+				keep = i
+				break
+			}
+		}
+	}
+	if keep == 0 {
+		keep = limit
+	}
+
+	// Keep doc comments with the declaration that follows them
+	for keep > limit/2 && keep > 1 && syntax[keep-1].comment && syntax[keep-1].depth == 0 {
+		keep--
+	}
+
+	var omitted []truncatedSymbol
+	for _, sym := range symbols {
+		if sym.Line >= keep {
+			sym.Line += firstLine
+			omitted = append(omitted, sym)
+		}
+	}
+	return keep, omitted
+}
+
+// isTopLevelBoundary reports whether a cut right before lines[i] keeps every
+// top-level block intact.
+func isTopLevelBoundary(lines []string, syntax []lineSyntax, i int) bool {
+	if i >= len(lines) || syntax[i].depth != 0 {
+		return false
+	}
+	next := lines[i]
+	if strings.TrimSpace(next) == "" {
+		// A blank line at depth zero separates top-level blocks
+		return true
+	}
+	return next[0] != ' ' && next[0] != '\t' && next[0] != '}' && next[0] != ')' && next[0] != ']'
+}
+
+// declarationKind maps a declaration keyword to the symbol kind it introduces.
+func declarationKind(keyword string) string {
+	switch strings.TrimSpace(keyword) {
+	case "func", "function", "def", "fn", "fun", "sub":
+		return "function"
+	case "class":
+		return "class"
+	case "type", "struct", "interface", "enum", "trait", "impl":
+		return strings.TrimSpace(keyword)
+	default:
+		return ""
+	}
+}
+
+// formatOmittedSymbols renders the index of declarations cut from a truncated result.
+func formatOmittedSymbols(symbols []truncatedSymbol) string {
+	if len(symbols) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nOmitted symbols:\n")
+	for i, sym := range symbols {
+		if i == maxOmittedSymbols {
+			fmt.Fprintf(&sb, "  ... and %d more\n", len(symbols)-maxOmittedSymbols)
+			break
+		}
+		fmt.Fprintf(&sb, "  - %s %s (line %d)\n", sym.Kind, sym.Name, sym.Line)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// limitLinesBySize returns how many of lines fit in maxBytes, counting newlines.
+// At least one line is always kept.
+func limitLinesBySize(lines []string, maxBytes int) int {
+	size := 0
+	for i, line := range lines {
+		size += len(line) + 1
+		if size > maxBytes {
+			return max(i, 1)
+		}
+	}
+	return len(lines)
+}
+
+// clipLine shortens a line to at most width bytes, preferring to cut at a word
+// or punctuation boundary over the middle of an identifier.
+func clipLine(line string, width int) string {
+	if len(line) <= width {
+		return line
+	}
+	cut := width
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	for i := cut; i > width*3/4; i-- {
+		if strings.ContainsRune(" \t,;(){}[]", rune(line[i])) {
+			cut = i
+			break
+		}
+	}
+	return line[:cut] + "..."
+}
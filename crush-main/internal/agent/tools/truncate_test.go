@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const truncateGoSource = `package demo
+
+import "fmt"
+
+// First does the first thing.
+func First() {
+	fmt.Println("{")
+	if true {
+		fmt.Println("nested")
+	}
+}
+
+// Second does the second thing.
+func Second() {
+	fmt.Println("second")
+}
+
+type Third struct {
+	Name string
+}
+
+func (t Third) Hello() string {
+	return "hello " + t.Name
+}
+`
+
+func TestSyntaxAwareCut(t *testing.T) {
+	t.Parallel()
+
+	lines := strings.Split(truncateGoSource, "\n")
+
+	t.Run("cuts before the enclosing function", func(t *testing.T) {
+		t.Parallel()
+		// A limit of 9 lands inside First; the cut moves back to before its doc comment.
+		keep, omitted := syntaxAwareCut("demo.go", lines, 9, 1)
+		require.Equal(t, 4, keep)
+		require.Equal(t, "", lines[keep-1])
+
+		var names []string
+		for _, sym := range omitted {
+			names = append(names, sym.Name)
+		}
+		require.Contains(t, names, "First")
+		require.Contains(t, names, "Second")
+		require.Contains(t, names, "Hello")
+		require.Equal(t, 6, omitted[0].Line)
+	})
+
+	t.Run("keeps doc comment with declaration", func(t *testing.T) {
+		t.Parallel()
+		// A limit of 15 lands inside Second, whose doc comment starts at line 13.
+		keep, omitted := syntaxAwareCut("demo.go", lines, 15, 1)
+		require.Equal(t, 12, keep)
+		require.Equal(t, "Second", omitted[0].Name)
+	})
+
+	t.Run("no truncation needed", func(t *testing.T) {
+		t.Parallel()
+		keep, omitted := syntaxAwareCut("demo.go", lines, len(lines)+10, 1)
+		require.Equal(t, len(lines), keep)
+		require.Empty(t, omitted)
+	})
+
+	t.Run("unknown file type falls back to line limit", func(t *testing.T) {
+		t.Parallel()
+		plain := []string{"a", "b", "c", "d", "e"}
+		keep, omitted := syntaxAwareCut("notes.unknownext", plain, 3, 1)
+		require.Equal(t, 3, keep)
+		require.Empty(t, omitted)
+	})
+}
+
+func TestClipLine(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "short", clipLine("short", 10))
+	require.Equal(t, "alpha beta...", clipLine("alpha beta gamma", 12))
+	require.Equal(t, "中...", clipLine("中文字", 4))
+}
+
+func TestTruncateGrepOutput(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	for range 5 {
+		sb.WriteString("a.go:match\n")
+	}
+	sb.WriteString("b.go:match\nb.go:match\nc.go:match\n")
+
+	output, count, truncated := truncateGrepOutput(sb.String(), 5)
+	require.True(t, truncated)
+	require.Equal(t, 8, count)
+	require.Contains(t, output, "showing 5 of 8 matches")
+	require.Contains(t, output, "- b.go (2)")
+	require.Contains(t, output, "- c.go (1)")
+
+	output, count, truncated = truncateGrepOutput("a.go:one\n", 5)
+	require.False(t, truncated)
+	require.Equal(t, 1, count)
+	require.Equal(t, "a.go:one", output)
+
+	output, count, truncated = truncateGrepOutput("", 5)
+	require.False(t, truncated)
+	require.Equal(t, 0, count)
+	require.Empty(t, output)
+}
@@ -0,0 +1,165 @@
+//go:build cgo
+
+package tools
+
+import (
+	"path/filepath"
+	"strings"
+
+	sitter "github.com/tree-sitter/go-tree-sitter"
+	sittergo "github.com/tree-sitter/tree-sitter-go/bindings/go"
+	sitterjava "github.com/tree-sitter/tree-sitter-java/bindings/go"
+	sitterpython "github.com/tree-sitter/tree-sitter-python/bindings/go"
+)
+
+// treeSitterLanguage returns the tree-sitter grammar for the file type, or nil
+// when there is none.
+func treeSitterLanguage(filePath string) *sitter.Language {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".go":
+		return sitter.NewLanguage(sittergo.Language())
+	case ".py", ".pyi":
+		return sitter.NewLanguage(sitterpython.Language())
+	case ".java":
+		return sitter.NewLanguage(sitterjava.Language())
+	default:
+		return nil
+	}
+}
+
+// treeSitterCut is syntaxAwareCut for the file types with a tree-sitter
+// grammar. The cut falls before a top-level declaration and its doc comment;
+// when none starts in the second half of the window, it falls between the
+// members or statements of the node the limit lands in, and as a last resort
+// on the line limit. ok is false when the file type has no grammar.
+func treeSitterCut(filePath string, lines []string, limit, firstLine int) (keep int, omitted []truncatedSymbol, ok bool) {
+	lang := treeSitterLanguage(filePath)
+	if lang == nil {
+		return 0, nil, false
+	}
+	parser := sitter.NewParser()
+	defer parser.Close()
+	if err := parser.SetLanguage(lang); err != nil {
+		return 0, nil, false
+	}
+	source := []byte(strings.Join(lines, "\n"))
+	tree := parser.Parse(source, nil)
+	if tree == nil {
+		return 0, nil, false
+	}
+	defer tree.Close()
+
+	root := tree.RootNode()
+	keep = syntaxBoundary(root, uint(limit))
+	if keep == 0 {
+		keep = limit
+	}
+	for _, sym := range declarationSymbols(root, source, 0) {
+		if sym.Line >= keep {
+			sym.Line += firstLine
+			omitted = append(omitted, sym)
+		}
+	}
+	return keep, omitted, true
+}
+
+// syntaxBoundary returns the last line, between limit/2 and limit, before
+// which a child of node starts, with the comments right above it, or after
+// which one ends. When there is none, it looks in the child the limit lands
+// in. It returns 0 when no boundary is found.
+func syntaxBoundary(node *sitter.Node, limit uint) int {
+	children := namedChildren(node)
+	best := uint(0)
+	for i, child := range children {
+		if isSyntaxComment(child) {
+			continue
+		}
+		end := child.EndPosition().Row + 1
+		if (i+1 == len(children) || children[i+1].StartPosition().Row >= end) && end <= limit && end >= limit/2 && end > best {
+			best = end
+		}
+		start := child.StartPosition().Row
+		if i > 0 && children[i-1].EndPosition().Row >= start {
+			// Shares its first line with the previous node
+			continue
+		}
+		for j := i - 1; j >= 0 && isSyntaxComment(children[j]) && children[j].EndPosition().Row+1 == start; j-- {
+			start = children[j].StartPosition().Row
+			if j > 0 && children[j-1].EndPosition().Row >= start {
+				break
+			}
+		}
+		if start <= limit && start >= limit/2 && start > best {
+			best = start
+		}
+	}
+	if best > 0 {
+		return int(best)
+	}
+	for i := range children {
+		if children[i].StartPosition().Row < limit && children[i].EndPosition().Row >= limit {
+			return syntaxBoundary(&children[i], limit)
+		}
+	}
+	return 0
+}
+
+// declarationSymbols returns the declarations among the children of node and
+// the members of the classes among them. The lines are 0-based.
+func declarationSymbols(node *sitter.Node, source []byte, depth int) []truncatedSymbol {
+	var symbols []truncatedSymbol
+	for _, child := range namedChildren(node) {
+		decl := child
+		if decl.Kind() == "decorated_definition" {
+			if def := decl.ChildByFieldName("definition"); def != nil {
+				decl = *def
+			}
+		}
+		line := int(child.StartPosition().Row)
+		switch decl.Kind() {
+		case "function_declaration", "function_definition":
+			symbols = appendSymbol(symbols, &decl, source, "function", line)
+		case "method_declaration", "constructor_declaration":
+			symbols = appendSymbol(symbols, &decl, source, "method", line)
+		case "type_declaration":
+			for _, spec := range namedChildren(&decl) {
+				kind := "type"
+				if typ := spec.ChildByFieldName("type"); typ != nil {
+					switch typ.Kind() {
+					case "struct_type":
+						kind = "struct"
+					case "interface_type":
+						kind = "interface"
+					}
+				}
+				symbols = appendSymbol(symbols, &spec, source, kind, int(spec.StartPosition().Row))
+			}
+		case "class_definition", "class_declaration", "interface_declaration", "enum_declaration", "record_declaration":
+			kind := strings.TrimSuffix(strings.TrimSuffix(decl.Kind(), "_definition"), "_declaration")
+			symbols = appendSymbol(symbols, &decl, source, kind, line)
+			if body := decl.ChildByFieldName("body"); body != nil && depth == 0 {
+				symbols = append(symbols, declarationSymbols(body, source, depth+1)...)
+			}
+		}
+	}
+	return symbols
+}
+
+// appendSymbol appends the declaration node to symbols when it has a name.
+func appendSymbol(symbols []truncatedSymbol, node *sitter.Node, source []byte, kind string, line int) []truncatedSymbol {
+	name := node.ChildByFieldName("name")
+	if name == nil {
+		return symbols
+	}
+	return append(symbols, truncatedSymbol{Name: name.Utf8Text(source), Kind: kind, Line: line})
+}
+
+func namedChildren(node *sitter.Node) []sitter.Node {
+	cursor := node.Walk()
+	defer cursor.Close()
+	return node.NamedChildren(cursor)
+}
+
+func isSyntaxComment(node sitter.Node) bool {
+	return strings.HasSuffix(node.Kind(), "comment")
+}
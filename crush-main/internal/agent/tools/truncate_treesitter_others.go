@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package tools
+
+// treeSitterCut needs cgo for the tree-sitter parsers. Without it the cut is
+// always found with the chroma lexers.
+func treeSitterCut(string, []string, int, int) (int, []truncatedSymbol, bool) {
+	return 0, nil, false
+}
@@ -0,0 +1,110 @@
+//go:build cgo
+
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const truncatePythonSource = `import os
+
+
+@dataclass
+class Store:
+    """Keeps the items."""
+
+    def __init__(self):
+        self.items = {
+            "a": 1,
+
+            "b": 2,
+        }
+
+    def get(self, key):
+        return self.items[key]
+
+
+def main():
+    print(Store().get("a"))
+`
+
+const truncateJavaSource = `package demo;
+
+/** Greets people. */
+public class Greeter {
+    private final String name;
+
+    // Builds a greeter.
+    public Greeter(String name) {
+        this.name = name;
+    }
+
+    public String greet() {
+        return "hello " + name;
+    }
+}
+
+interface Named {
+    String name();
+}
+`
+
+func symbolNames(symbols []truncatedSymbol) []string {
+	var names []string
+	for _, sym := range symbols {
+		names = append(names, sym.Kind+" "+sym.Name)
+	}
+	return names
+}
+
+func TestTreeSitterCut(t *testing.T) {
+	t.Parallel()
+
+	t.Run("cuts before the decorated class", func(t *testing.T) {
+		t.Parallel()
+		lines := strings.Split(truncatePythonSource, "\n")
+		// A limit of 5 lands on the class line, the decorator stays with it
+		keep, omitted := syntaxAwareCut("store.py", lines, 5, 1)
+		require.Equal(t, 3, keep)
+		require.Equal(t, []string{"class Store", "function __init__", "function get", "function main"}, symbolNames(omitted))
+		require.Equal(t, 4, omitted[0].Line)
+	})
+
+	t.Run("cuts between the methods of a class", func(t *testing.T) {
+		t.Parallel()
+		lines := strings.Split(truncatePythonSource, "\n")
+		// A limit of 15 lands inside get, the blank line in the dict is not a boundary
+		keep, omitted := syntaxAwareCut("store.py", lines, 15, 1)
+		require.Equal(t, 14, keep)
+		require.Equal(t, "    def get(self, key):", lines[keep])
+		require.Equal(t, []string{"function get", "function main"}, symbolNames(omitted))
+	})
+
+	t.Run("keeps comments with the member", func(t *testing.T) {
+		t.Parallel()
+		lines := strings.Split(truncateJavaSource, "\n")
+		// A limit of 9 lands inside the constructor, whose comment starts at line 7
+		keep, omitted := syntaxAwareCut("Greeter.java", lines, 9, 10)
+		require.Equal(t, 6, keep)
+		require.Equal(t, []string{"method Greeter", "method greet", "interface Named", "method name"}, symbolNames(omitted))
+		require.Equal(t, 17, omitted[0].Line)
+	})
+
+	t.Run("cuts after the last complete declaration", func(t *testing.T) {
+		t.Parallel()
+		lines := strings.Split(truncatePythonSource, "\n")
+		// A limit of 17 lands on the blank lines after the class
+		keep, omitted := syntaxAwareCut("store.py", lines, 17, 1)
+		require.Equal(t, 16, keep)
+		require.Equal(t, []string{"function main"}, symbolNames(omitted))
+	})
+
+	t.Run("other file types use the lexer", func(t *testing.T) {
+		t.Parallel()
+		_, _, ok := treeSitterCut("main.rs", []string{"fn main() {", "}"}, 1, 1)
+		require.False(t, ok)
+	})
+}
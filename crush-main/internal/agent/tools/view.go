@@ -99,12 +99,19 @@ func NewViewTool(lspClients *csync.Map[string, *lsp.Client], permissions permiss
 				return fantasy.NewTextErrorResponse("Offset is beyond file end"), nil
 			}
 
-			endLine := params.Offset + params.Limit
-			if endLine > totalLines {
-				endLine = totalLines
+			// Truncate at a syntactic boundary when the file does not fit in the limits
+			remaining := lines[params.Offset:]
+			keep := limitLinesBySize(remaining[:min(params.Limit, len(remaining))], MaxReadSize)
+			var omitted []truncatedSymbol
+			if keep < len(remaining) {
+				keep, omitted = syntaxAwareCut(filePath, remaining, keep, params.Offset+1)
 			}
+			endLine := params.Offset + keep
 
-			lines = lines[params.Offset:endLine]
+			lines = remaining[:keep]
+			for i, line := range lines {
+				lines[i] = clipLine(line, MaxLineLength)
+			}
 			content = strings.Join(lines, "\n")
 
 			// Check if valid UTF-8
@@ -120,6 +127,7 @@ func NewViewTool(lspClients *csync.Map[string, *lsp.Client], permissions permiss
 			// Add a note if the content was truncated
 			if totalLines > endLine {
 				output += fmt.Sprintf("\n\n(File has more lines. Use 'offset' parameter to read beyond line %d)", endLine)
+				output += formatOmittedSymbols(omitted)
 			}
 			output += "\n</file>\n"
 			// 使用沙箱诊断服务（而不是本地 LSP）
@@ -36,6 +36,7 @@ func NewWebFetchTool(workingDir string, client *http.Client) fantasy.AgentTool {
 			if params.URL == "" {
 				return fantasy.NewTextErrorResponse("url is required"), nil
 			}
+			params.URL = expandSessionEnv(ctx, params.URL)
 
 			content, err := FetchURLAndConvert(ctx, client, params.URL)
 			if err != nil {
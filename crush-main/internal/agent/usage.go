@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+
+	"charm.land/fantasy"
+	"github.com/google/uuid"
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+)
+
+// recordModelUsage records the tokens and cost of a model request for the
+// analytics rollups. A failed write does not stop the turn.
+func (a *sessionAgent) recordModelUsage(ctx context.Context, sessionID, messageID string, model Model, usage fantasy.Usage, cost float64) {
+	if a.dbQuerier == nil {
+		return
+	}
+	err := a.dbQuerier.CreateModelUsage(context.WithoutCancel(ctx), postgres.CreateModelUsageParams{
+		ID:                  uuid.NewString(),
+		SessionID:           sessionID,
+		MessageID:           messageID,
+		Provider:            model.ModelCfg.Provider,
+		Model:               model.ModelCfg.Model,
+		InputTokens:         usage.InputTokens,
+		OutputTokens:        usage.OutputTokens,
+		CacheCreationTokens: usage.CacheCreationTokens,
+		CacheReadTokens:     usage.CacheReadTokens,
+		Cost:                cost,
+	})
+	if err != nil {
+		slog.Warn("Failed to record model usage", "session_id", sessionID, "model", model.ModelCfg.Model, "error", err)
+	}
+}
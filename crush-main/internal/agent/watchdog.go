@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStreamStalled is the cause of a turn cancelled because the provider
+// stream stopped sending events without failing.
+var ErrStreamStalled = errors.New("the provider stopped responding")
+
+// stallWatchdog cancels a turn whose provider stream has not sent any event
+// for longer than its timeout. Time spent running tools does not count, the
+// tools and permission requests have their own timeouts.
+type stallWatchdog struct {
+	timeout time.Duration
+	// last is the time of the last stream event, in Unix nanoseconds.
+	last atomic.Int64
+	now  func() time.Time
+}
+
+func newStallWatchdog(timeout time.Duration) *stallWatchdog {
+	w := &stallWatchdog{timeout: timeout, now: time.Now}
+	w.touch()
+	return w
+}
+
+// touch records a stream event.
+func (w *stallWatchdog) touch() {
+	w.last.Store(w.now().UnixNano())
+}
+
+// expectSilence records that the stream is silent on purpose for d, e.g.
+// while waiting to retry a failed request.
+func (w *stallWatchdog) expectSilence(d time.Duration) {
+	w.last.Store(w.now().Add(d).UnixNano())
+}
+
+// stalled reports whether the stream has been silent for longer than the
+// timeout, returning how long it has been silent.
+func (w *stallWatchdog) stalled() (time.Duration, bool) {
+	silent := w.now().Sub(time.Unix(0, w.last.Load()))
+	return silent, silent >= w.timeout
+}
+
+// watch checks the stream until ctx is done, calling onStall once when it
+// stalls while no tools run. It returns a function stopping the watch.
+func (w *stallWatchdog) watch(ctx context.Context, turn *turnControl, onStall func(silent time.Duration)) (stop func()) {
+	if w.timeout <= 0 {
+		return func() {}
+	}
+	ctx, stop = context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(max(min(w.timeout/4, 15*time.Second), time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if turn.inTools.Load() {
+				w.touch()
+				continue
+			}
+			if silent, ok := w.stalled(); ok {
+				onStall(silent)
+				return
+			}
+		}
+	}()
+	return stop
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStallWatchdog_Stalled(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := newStallWatchdog(time.Minute)
+	w.now = func() time.Time { return now }
+	w.touch()
+
+	now = now.Add(59 * time.Second)
+	_, stalled := w.stalled()
+	assert.False(t, stalled)
+
+	now = now.Add(time.Second)
+	silent, stalled := w.stalled()
+	assert.True(t, stalled)
+	assert.Equal(t, time.Minute, silent)
+
+	w.touch()
+	_, stalled = w.stalled()
+	assert.False(t, stalled, "an event resets the watchdog")
+}
+
+func TestStallWatchdog_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	turn := newTurnControl()
+	stalled := make(chan time.Duration, 1)
+	w := newStallWatchdog(40 * time.Millisecond)
+	defer w.watch(ctx, turn, func(silent time.Duration) { stalled <- silent })()
+
+	select {
+	case silent := <-stalled:
+		assert.GreaterOrEqual(t, silent, 40*time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatal("watchdog did not detect the stall")
+	}
+}
+
+func TestStallWatchdog_PausedWhileToolsRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	turn := newTurnControl()
+	turn.inTools.Store(true)
+	stalled := make(chan time.Duration, 1)
+	w := newStallWatchdog(20 * time.Millisecond)
+	defer w.watch(ctx, turn, func(silent time.Duration) { stalled <- silent })()
+
+	select {
+	case <-stalled:
+		t.Fatal("watchdog fired while tools were running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	turn.inTools.Store(false)
+	select {
+	case <-stalled:
+	case <-time.After(time.Second):
+		require.Fail(t, "watchdog did not detect the stall after the tools")
+	}
+}
+
+func TestStallWatchdog_Disabled(t *testing.T) {
+	w := newStallWatchdog(0)
+	stop := w.watch(context.Background(), newTurnControl(), func(time.Duration) { t.Fatal("disabled watchdog fired") })
+	stop()
+}
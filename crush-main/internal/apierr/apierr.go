@@ -0,0 +1,242 @@
+// Package apierr is the machine-readable error model of the HTTP and
+// WebSocket APIs. Each error has a stable code, the category it belongs to and
+// whether sending the same request again may succeed; the message itself is
+// for humans and may change or be localized.
+package apierr
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/budget"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+)
+
+// Category groups the codes by what failed.
+type Category string
+
+const (
+	CategoryValidation Category = "validation"
+	CategoryAuth       Category = "auth"
+	CategoryNotFound   Category = "not_found"
+	CategoryConflict   Category = "conflict"
+	CategoryRateLimit  Category = "rate_limit"
+	CategoryCapacity   Category = "capacity"
+	CategoryBudget     Category = "budget"
+	CategoryProvider   Category = "provider"
+	CategoryPermission Category = "permission"
+	CategorySandbox    Category = "sandbox"
+	CategoryInternal   Category = "internal"
+)
+
+// Code identifies an error, clients branch on it rather than on the message.
+type Code string
+
+const (
+	CodeInvalidRequest   Code = "invalid_request"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeConflict         Code = "conflict"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	CodeRateLimited      Code = "rate_limited"
+	CodeUnavailable      Code = "unavailable"
+	CodeCapacityExceeded Code = "capacity_exceeded"
+	CodeSessionBusy      Code = "session_busy"
+	CodeProjectPaused    Code = "project_paused"
+	CodeBudgetExceeded   Code = "budget_exceeded"
+	CodeTimeout          Code = "timeout"
+	CodeInternal         Code = "internal"
+
+	CodeProviderAuth           Code = "provider_auth"
+	CodeProviderRateLimited    Code = "provider_rate_limited"
+	CodeProviderOverloaded     Code = "provider_overloaded"
+	CodeProviderInvalidRequest Code = "provider_invalid_request"
+	CodeProviderStalled        Code = "provider_stalled"
+	CodeProviderError          Code = "provider_error"
+	CodeModerationHalted       Code = "moderation_halted"
+
+	CodePermissionDenied  Code = "permission_denied"
+	CodePermissionTimeout Code = "permission_timeout"
+
+	CodeSandboxUnavailable Code = "sandbox_unavailable"
+	CodeSandboxError       Code = "sandbox_error"
+)
+
+type codeInfo struct {
+	category  Category
+	retryable bool
+	status    int
+}
+
+var codes = map[Code]codeInfo{
+	CodeInvalidRequest:   {CategoryValidation, false, http.StatusBadRequest},
+	CodeUnauthorized:     {CategoryAuth, false, http.StatusUnauthorized},
+	CodeForbidden:        {CategoryAuth, false, http.StatusForbidden},
+	CodeNotFound:         {CategoryNotFound, false, http.StatusNotFound},
+	CodeConflict:         {CategoryConflict, false, http.StatusConflict},
+	CodePayloadTooLarge:  {CategoryValidation, false, http.StatusRequestEntityTooLarge},
+	CodeRateLimited:      {CategoryRateLimit, true, http.StatusTooManyRequests},
+	CodeUnavailable:      {CategoryCapacity, true, http.StatusServiceUnavailable},
+	CodeCapacityExceeded: {CategoryCapacity, true, http.StatusServiceUnavailable},
+	CodeSessionBusy:      {CategoryConflict, true, http.StatusConflict},
+	CodeProjectPaused:    {CategoryConflict, true, http.StatusConflict},
+	CodeBudgetExceeded:   {CategoryBudget, false, http.StatusPaymentRequired},
+	CodeTimeout:          {CategoryInternal, true, http.StatusGatewayTimeout},
+	CodeInternal:         {CategoryInternal, false, http.StatusInternalServerError},
+
+	CodeProviderAuth:           {CategoryProvider, false, http.StatusBadGateway},
+	CodeProviderRateLimited:    {CategoryProvider, true, http.StatusBadGateway},
+	CodeProviderOverloaded:     {CategoryProvider, true, http.StatusBadGateway},
+	CodeProviderInvalidRequest: {CategoryProvider, false, http.StatusBadGateway},
+	CodeProviderStalled:        {CategoryProvider, true, http.StatusGatewayTimeout},
+	CodeProviderError:          {CategoryProvider, false, http.StatusBadGateway},
+	CodeModerationHalted:       {CategoryProvider, false, http.StatusUnprocessableEntity},
+
+	CodePermissionDenied:  {CategoryPermission, false, http.StatusForbidden},
+	CodePermissionTimeout: {CategoryPermission, true, http.StatusRequestTimeout},
+
+	CodeSandboxUnavailable: {CategorySandbox, true, http.StatusServiceUnavailable},
+	CodeSandboxError:       {CategorySandbox, false, http.StatusBadGateway},
+}
+
+// Error classifies an error of the API. It is sent next to the message of
+// the error, in the "error" field of the HTTP and WebSocket errors.
+type Error struct {
+	Code      Code     `json:"error_code"`
+	Category  Category `json:"category"`
+	Retryable bool     `json:"retryable"`
+	// Detail is additional context, e.g. the message of the provider
+	Detail string `json:"detail,omitempty"`
+}
+
+// New returns the error of a code, unknown codes are internal errors.
+func New(code Code, detail string) Error {
+	info, ok := codes[code]
+	if !ok {
+		code, info = CodeInternal, codes[CodeInternal]
+	}
+	return Error{Code: code, Category: info.category, Retryable: info.retryable, Detail: detail}
+}
+
+// Status returns the HTTP status of a code.
+func (c Code) Status() int {
+	if info, ok := codes[c]; ok {
+		return info.status
+	}
+	return http.StatusInternalServerError
+}
+
+// FromStatus returns the code of an HTTP status, for the responses that do
+// not set one.
+func FromStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusMethodNotAllowed:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound, http.StatusGone:
+		return CodeNotFound
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusPaymentRequired:
+		return CodeBudgetExceeded
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return CodeTimeout
+	case http.StatusBadGateway:
+		return CodeSandboxError
+	}
+	if status >= 400 && status < 500 {
+		return CodeInvalidRequest
+	}
+	return CodeInternal
+}
+
+// codedError is an error given a code by WithCode.
+type codedError struct {
+	code Code
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// WithCode gives a code to an error that Classify would not recognize, e.g.
+// a validation failure. The message of the error is unchanged.
+func WithCode(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+// Classify returns the error of the codes set by WithCode and of the
+// provider, permission, budget, sandbox and network failures, other errors
+// are internal.
+func Classify(err error) Error {
+	var coded *codedError
+	var providerErr *fantasy.ProviderError
+	var fantasyErr *fantasy.Error
+	var statusErr *sandbox.StatusError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return New(CodeInternal, "")
+	case errors.As(err, &coded):
+		return New(coded.code, "")
+	case errors.As(err, &providerErr):
+		return New(providerCode(providerErr.StatusCode), providerErr.Message)
+	case errors.As(err, &fantasyErr):
+		return New(CodeProviderError, fantasyErr.Message)
+	case errors.Is(err, permission.ErrorPermissionDenied):
+		return New(CodePermissionDenied, permission.DenialReason(err))
+	case errors.Is(err, permission.ErrorPermissionTimeout):
+		return New(CodePermissionTimeout, "")
+	case errors.Is(err, budget.ErrExceeded):
+		return New(CodeBudgetExceeded, "")
+	case errors.Is(err, sandbox.ErrUnavailable):
+		return New(CodeSandboxUnavailable, "")
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode == http.StatusNotFound {
+			return New(CodeNotFound, statusErr.Body)
+		}
+		return New(CodeSandboxError, statusErr.Body)
+	case errors.Is(err, sandbox.ErrSandbox):
+		return New(CodeSandboxError, "")
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(CodeTimeout, "")
+	case errors.As(err, &netErr):
+		return New(CodeUnavailable, "")
+	}
+	return New(CodeInternal, "")
+}
+
+// providerCode maps the HTTP status of a provider response.
+func providerCode(status int) Code {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return CodeProviderAuth
+	case http.StatusTooManyRequests:
+		return CodeProviderRateLimited
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, 529: // Anthropic overloaded_error
+		return CodeProviderOverloaded
+	case http.StatusRequestTimeout:
+		return CodeProviderStalled
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return CodeProviderInvalidRequest
+	}
+	return CodeProviderError
+}
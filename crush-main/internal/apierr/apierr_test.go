@@ -0,0 +1,72 @@
+package apierr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/rolling1314/rolling-crush/domain/budget"
+	"github.com/rolling1314/rolling-crush/domain/permission"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err  error
+		want Error
+	}{
+		"provider rate limit": {
+			err:  fmt.Errorf("stream: %w", &fantasy.ProviderError{StatusCode: http.StatusTooManyRequests, Message: "slow down"}),
+			want: Error{Code: CodeProviderRateLimited, Category: CategoryProvider, Retryable: true, Detail: "slow down"},
+		},
+		"provider auth": {
+			err:  &fantasy.ProviderError{StatusCode: http.StatusUnauthorized, Message: "invalid x-api-key"},
+			want: Error{Code: CodeProviderAuth, Category: CategoryProvider, Detail: "invalid x-api-key"},
+		},
+		"permission denied": {
+			err:  &permission.DeniedError{Reason: "not on main"},
+			want: Error{Code: CodePermissionDenied, Category: CategoryPermission, Detail: "not on main"},
+		},
+		"budget": {
+			err:  &budget.ExceededError{},
+			want: Error{Code: CodeBudgetExceeded, Category: CategoryBudget},
+		},
+		"sandbox down": {
+			err:  fmt.Errorf("failed to send request: %w: %w", sandbox.ErrUnavailable, errors.New("connection refused")),
+			want: Error{Code: CodeSandboxUnavailable, Category: CategorySandbox, Retryable: true},
+		},
+		"sandbox error": {
+			err:  fmt.Errorf("%w: container not running", sandbox.ErrSandbox),
+			want: Error{Code: CodeSandboxError, Category: CategorySandbox},
+		},
+		"timeout": {
+			err:  fmt.Errorf("exec: %w", context.DeadlineExceeded),
+			want: Error{Code: CodeTimeout, Category: CategoryInternal, Retryable: true},
+		},
+		"with code": {
+			err:  fmt.Errorf("regenerate: %w", WithCode(CodeInvalidRequest, errors.New("message_id is required"))),
+			want: Error{Code: CodeInvalidRequest, Category: CategoryValidation},
+		},
+		"other": {
+			err:  errors.New("boom"),
+			want: Error{Code: CodeInternal, Category: CategoryInternal},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Classify(tc.err))
+		})
+	}
+}
+
+func TestFromStatus(t *testing.T) {
+	assert.Equal(t, CodeInvalidRequest, FromStatus(http.StatusBadRequest))
+	assert.Equal(t, CodeRateLimited, FromStatus(http.StatusTooManyRequests))
+	assert.Equal(t, CodeInvalidRequest, FromStatus(http.StatusTeapot))
+	assert.Equal(t, CodeInternal, FromStatus(http.StatusInternalServerError))
+	assert.Equal(t, http.StatusConflict, CodeSessionBusy.Status())
+	assert.Equal(t, CodeInternal, New("unknown", "").Code)
+}
@@ -103,6 +103,9 @@ func InitSharedServices(ctx context.Context, cfg *config.Config) (*SharedService
 		DBConn:      conn,
 		Config:      cfg,
 	}
+	if err := services.Permissions.SetBasePolicy(PolicyRules(cfg)); err != nil {
+		return nil, fmt.Errorf("invalid permission rules: %w", err)
+	}
 
 	// Initialize Redis client and services
 	if err := storeredis.InitGlobalClient(); err != nil {
@@ -140,6 +143,25 @@ func (s *SharedServices) Close() error {
 	return nil
 }
 
+// PolicyRules returns the permission policy rules of the configuration.
+func PolicyRules(cfg *config.Config) []permission.PolicyRule {
+	if cfg.Permissions == nil {
+		return nil
+	}
+	rules := make([]permission.PolicyRule, 0, len(cfg.Permissions.Rules))
+	for _, rule := range cfg.Permissions.Rules {
+		rules = append(rules, permission.PolicyRule{
+			Effect:  permission.PolicyEffect(rule.Effect),
+			Tool:    rule.Tool,
+			Action:  rule.Action,
+			Pattern: rule.Pattern,
+			Regex:   rule.Regex,
+			Source:  "config",
+		})
+	}
+	return rules
+}
+
 // GetCwd returns the current working directory or the provided cwd
 func GetCwd(cwd string) (string, error) {
 	if cwd != "" {
@@ -0,0 +1,110 @@
+package codeindex
+
+import (
+	"bytes"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	// chunkLines is the number of lines of a chunk.
+	chunkLines = 60
+	// chunkOverlap is the number of lines a chunk shares with the previous
+	// one, so that code cut at a boundary is still found whole.
+	chunkOverlap = 10
+	// maxChunkBytes bounds the content of a chunk, files with very long
+	// lines such as minified code are cut short.
+	maxChunkBytes = 4000
+	// maxFileSize bounds the size of the indexed files.
+	maxFileSize = 256 * 1024
+)
+
+// skippedDirs are the directories whose files are not indexed: dependencies,
+// build outputs and caches.
+var skippedDirs = []string{
+	"node_modules",
+	"vendor",
+	"dist",
+	"build",
+	"target",
+	"__pycache__",
+}
+
+// skippedExts are the extensions of the files that are not source code.
+var skippedExts = []string{
+	".png", ".jpg", ".jpeg", ".gif", ".ico", ".webp", ".bmp", ".svg",
+	".pdf", ".zip", ".gz", ".tgz", ".tar", ".jar", ".war", ".7z",
+	".exe", ".dll", ".so", ".dylib", ".a", ".o", ".class", ".pyc", ".wasm",
+	".woff", ".woff2", ".ttf", ".otf", ".eot",
+	".mp3", ".mp4", ".mov", ".avi", ".wav",
+	".lock", ".sum", ".map", ".min.js", ".min.css",
+}
+
+// Chunk is a range of lines of a file.
+type Chunk struct {
+	Path string
+	// StartLine and EndLine are the 1-based lines of the chunk, inclusive.
+	StartLine int
+	EndLine   int
+	Content   string
+}
+
+// Indexable reports whether a file of a workspace is indexed: a source file
+// of a reasonable size outside of hidden and dependency directories.
+func Indexable(filePath string, size int64) bool {
+	if size <= 0 || size > maxFileSize {
+		return false
+	}
+	dirs := strings.Split(path.Dir(filePath), "/")
+	for _, dir := range dirs {
+		if (strings.HasPrefix(dir, ".") && dir != ".") || slices.Contains(skippedDirs, dir) {
+			return false
+		}
+	}
+	name := strings.ToLower(path.Base(filePath))
+	if strings.HasSuffix(name, "-lock.json") {
+		return false
+	}
+	for _, ext := range skippedExts {
+		if strings.HasSuffix(name, ext) {
+			return false
+		}
+	}
+	return true
+}
+
+// Split cuts the content of a file into overlapping chunks of lines. Binary
+// content, which has NUL bytes, has no chunks.
+func Split(filePath string, content []byte) []Chunk {
+	if len(bytes.TrimSpace(content)) == 0 || bytes.IndexByte(content, 0) >= 0 {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	var chunks []Chunk
+	for start := 0; start < len(lines); start += chunkLines - chunkOverlap {
+		end := min(start+chunkLines, len(lines))
+		text := strings.Join(lines[start:end], "\n")
+		if len(text) > maxChunkBytes {
+			text = strings.ToValidUTF8(text[:maxChunkBytes], "")
+		}
+		if strings.TrimSpace(text) != "" {
+			chunks = append(chunks, Chunk{
+				Path:      filePath,
+				StartLine: start + 1,
+				EndLine:   end,
+				Content:   text,
+			})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+// embeddingText is the text embedded for a chunk, its path gives the model
+// the context of the code.
+func embeddingText(c Chunk) string {
+	return c.Path + "\n" + c.Content
+}
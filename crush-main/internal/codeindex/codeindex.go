@@ -0,0 +1,301 @@
+// Package codeindex keeps an embeddings index of the files of project
+// workspaces, so that the agent can search code by meaning and not only by
+// pattern. Files are cut into chunks of lines whose vectors are stored in
+// Postgres; the index is searched in memory, one project at a time.
+package codeindex
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/filewatch"
+)
+
+const (
+	// maxFiles bounds the files indexed per project, the first ones by path.
+	maxFiles = 5000
+	// syncTimeout bounds a sync started by Refresh.
+	syncTimeout = 10 * time.Minute
+	// searchWait bounds how long a search waits for a running sync.
+	searchWait = 30 * time.Second
+)
+
+// Files reads the files of project workspaces. This is typically implemented
+// by the sandbox client.
+type Files interface {
+	ReadContent(ctx context.Context, req sandbox.FileContentRequest) (*sandbox.FileContentResponse, error)
+}
+
+// Result is a chunk matching a search.
+type Result struct {
+	Path      string  `json:"path"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Content   string  `json:"content"`
+	Score     float64 `json:"score"`
+}
+
+// SyncStats counts the files a sync changed in the index.
+type SyncStats struct {
+	Indexed int
+	Removed int
+	Failed  int
+}
+
+// Indexer indexes the workspaces of projects and searches them.
+type Indexer struct {
+	q        postgres.Querier
+	files    Files
+	embedder Embedder
+
+	mu sync.Mutex
+	// syncs are the running syncs by project ID
+	syncs map[string]*projectSync
+	// empty are the files without chunks by project ID, which have no rows
+	// to tell that they were indexed
+	empty map[string]map[string]filewatch.Stat
+}
+
+// projectSync is a running sync of a project. The snapshot taken while it
+// runs is synced right after it.
+type projectSync struct {
+	done chan struct{}
+	next filewatch.Snapshot
+}
+
+// New returns an indexer storing the chunks of the files read from files,
+// embedded by embedder.
+func New(q postgres.Querier, files Files, embedder Embedder) *Indexer {
+	return &Indexer{
+		q:        q,
+		files:    files,
+		embedder: embedder,
+		syncs:    make(map[string]*projectSync),
+		empty:    make(map[string]map[string]filewatch.Stat),
+	}
+}
+
+// Refresh syncs the index of a project with a snapshot of its workspace in
+// the background. Snapshots taken while a sync runs are coalesced, only the
+// latest is synced next.
+func (ix *Indexer) Refresh(projectID string, snapshot filewatch.Snapshot) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if running, ok := ix.syncs[projectID]; ok {
+		running.next = snapshot
+		return
+	}
+	running := &projectSync{done: make(chan struct{})}
+	ix.syncs[projectID] = running
+
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+			stats, err := ix.Sync(ctx, projectID, snapshot)
+			cancel()
+			if err != nil {
+				slog.Warn("Failed to sync code index", "project_id", projectID, "error", err)
+			} else if stats.Indexed > 0 || stats.Removed > 0 || stats.Failed > 0 {
+				slog.Info("Code index synced", "project_id", projectID, "indexed", stats.Indexed, "removed", stats.Removed, "failed", stats.Failed)
+			}
+
+			ix.mu.Lock()
+			if running.next == nil {
+				delete(ix.syncs, projectID)
+				ix.mu.Unlock()
+				close(running.done)
+				return
+			}
+			snapshot, running.next = running.next, nil
+			ix.mu.Unlock()
+		}
+	}()
+}
+
+// Sync indexes the files of a snapshot of a project workspace that changed
+// since they were indexed, and drops the files that are gone.
+func (ix *Indexer) Sync(ctx context.Context, projectID string, snapshot filewatch.Snapshot) (SyncStats, error) {
+	var stats SyncStats
+	rows, err := ix.q.ListCodeIndexFiles(ctx, projectID)
+	if err != nil {
+		return stats, fmt.Errorf("failed to list indexed files: %w", err)
+	}
+	indexed := make(map[string]postgres.ListCodeIndexFilesRow, len(rows))
+	for _, row := range rows {
+		indexed[row.Path] = row
+	}
+
+	var paths []string
+	for path, stat := range snapshot {
+		if Indexable(path, stat.Size) {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	paths = paths[:min(len(paths), maxFiles)]
+
+	for path := range indexed {
+		if _, ok := slices.BinarySearch(paths, path); ok {
+			continue
+		}
+		if err := ix.q.DeleteCodeChunksByPath(ctx, postgres.DeleteCodeChunksByPathParams{ProjectID: projectID, Path: path}); err != nil {
+			return stats, fmt.Errorf("failed to drop %s from the index: %w", path, err)
+		}
+		stats.Removed++
+	}
+
+	for _, path := range paths {
+		stat := snapshot[path]
+		if row, ok := indexed[path]; ok && row.FileModified == stat.Modified && row.FileSize == stat.Size && row.Model == ix.embedder.Model() {
+			continue
+		}
+		if ix.isEmpty(projectID, path, stat) {
+			continue
+		}
+		if err := ix.indexFile(ctx, projectID, path, stat); err != nil {
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+			slog.Warn("Failed to index file", "project_id", projectID, "path", path, "error", err)
+			stats.Failed++
+			continue
+		}
+		stats.Indexed++
+	}
+	return stats, nil
+}
+
+// indexFile replaces the chunks of a file with those of its current content.
+func (ix *Indexer) indexFile(ctx context.Context, projectID, path string, stat filewatch.Stat) error {
+	resp, err := ix.files.ReadContent(ctx, sandbox.FileContentRequest{ProjectID: projectID, Path: path, MaxSize: maxFileSize})
+	if err != nil {
+		return err
+	}
+	chunks := Split(path, resp.Content)
+	ix.setEmpty(projectID, path, stat, len(chunks) == 0)
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = embeddingText(c)
+	}
+	var vectors [][]float32
+	if len(texts) > 0 {
+		if vectors, err = ix.embedder.Embed(ctx, texts); err != nil {
+			return err
+		}
+	}
+
+	if err := ix.q.DeleteCodeChunksByPath(ctx, postgres.DeleteCodeChunksByPathParams{ProjectID: projectID, Path: path}); err != nil {
+		return err
+	}
+	for i, c := range chunks {
+		if err := ix.q.CreateCodeChunk(ctx, postgres.CreateCodeChunkParams{
+			ProjectID:    projectID,
+			Path:         path,
+			ChunkIndex:   int32(i),
+			StartLine:    int32(c.StartLine),
+			EndLine:      int32(c.EndLine),
+			Content:      c.Content,
+			Embedding:    encodeVector(vectors[i]),
+			Model:        ix.embedder.Model(),
+			FileModified: stat.Modified,
+			FileSize:     stat.Size,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search returns the chunks of a project closest in meaning to a query, best
+// first. A prefix limits the search to the files under a path. A running
+// sync of the project is waited for a while, the index as it is then is
+// searched.
+func (ix *Indexer) Search(ctx context.Context, projectID, query, prefix string, limit int) ([]Result, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, searchWait)
+	ix.wait(waitCtx, projectID)
+	cancel()
+
+	vectors, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ix.q.ListCodeChunksByProject(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexed chunks: %w", err)
+	}
+	prefix = strings.Trim(prefix, "/")
+
+	var results []Result
+	for _, row := range rows {
+		if row.Model != ix.embedder.Model() {
+			continue
+		}
+		if prefix != "" && row.Path != prefix && !strings.HasPrefix(row.Path, prefix+"/") {
+			continue
+		}
+		results = append(results, Result{
+			Path:      row.Path,
+			StartLine: int(row.StartLine),
+			EndLine:   int(row.EndLine),
+			Content:   row.Content,
+			Score:     cosine(vectors[0], decodeVector(row.Embedding)),
+		})
+	}
+	slices.SortStableFunc(results, func(a, b Result) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return results[:min(len(results), limit)], nil
+}
+
+// Syncing reports whether the index of a project is being synced.
+func (ix *Indexer) Syncing(projectID string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	_, ok := ix.syncs[projectID]
+	return ok
+}
+
+// isEmpty reports whether a file had no chunks when it was last indexed.
+func (ix *Indexer) isEmpty(projectID, path string, stat filewatch.Stat) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	indexed, ok := ix.empty[projectID][path]
+	return ok && indexed == stat
+}
+
+// setEmpty records whether a file has no chunks, binary files for instance,
+// so that it is not read again until it changes.
+func (ix *Indexer) setEmpty(projectID, path string, stat filewatch.Stat, empty bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !empty {
+		delete(ix.empty[projectID], path)
+		return
+	}
+	if ix.empty[projectID] == nil {
+		ix.empty[projectID] = make(map[string]filewatch.Stat)
+	}
+	ix.empty[projectID][path] = stat
+}
+
+// wait waits for the running sync of a project until ctx is done.
+func (ix *Indexer) wait(ctx context.Context, projectID string) {
+	ix.mu.Lock()
+	running, ok := ix.syncs[projectID]
+	ix.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case <-running.done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,203 @@
+package codeindex
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/rolling1314/rolling-crush/internal/filewatch"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore keeps the chunks in memory.
+type fakeStore struct {
+	postgres.Querier
+	chunks []postgres.CodeChunk
+}
+
+func (f *fakeStore) CreateCodeChunk(_ context.Context, arg postgres.CreateCodeChunkParams) error {
+	f.chunks = append(f.chunks, postgres.CodeChunk{
+		ProjectID:    arg.ProjectID,
+		Path:         arg.Path,
+		ChunkIndex:   arg.ChunkIndex,
+		StartLine:    arg.StartLine,
+		EndLine:      arg.EndLine,
+		Content:      arg.Content,
+		Embedding:    arg.Embedding,
+		Model:        arg.Model,
+		FileModified: arg.FileModified,
+		FileSize:     arg.FileSize,
+	})
+	return nil
+}
+
+func (f *fakeStore) DeleteCodeChunksByPath(_ context.Context, arg postgres.DeleteCodeChunksByPathParams) error {
+	f.chunks = slices.DeleteFunc(f.chunks, func(c postgres.CodeChunk) bool {
+		return c.ProjectID == arg.ProjectID && c.Path == arg.Path
+	})
+	return nil
+}
+
+func (f *fakeStore) ListCodeChunksByProject(_ context.Context, projectID string) ([]postgres.CodeChunk, error) {
+	var chunks []postgres.CodeChunk
+	for _, c := range f.chunks {
+		if c.ProjectID == projectID {
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks, nil
+}
+
+func (f *fakeStore) ListCodeIndexFiles(_ context.Context, projectID string) ([]postgres.ListCodeIndexFilesRow, error) {
+	var rows []postgres.ListCodeIndexFilesRow
+	for _, c := range f.chunks {
+		if c.ProjectID == projectID && c.ChunkIndex == 0 {
+			rows = append(rows, postgres.ListCodeIndexFilesRow{Path: c.Path, FileModified: c.FileModified, FileSize: c.FileSize, Model: c.Model})
+		}
+	}
+	return rows, nil
+}
+
+// fakeFiles serves file contents and counts the reads.
+type fakeFiles struct {
+	content map[string]string
+	reads   int
+}
+
+func (f *fakeFiles) ReadContent(_ context.Context, req sandbox.FileContentRequest) (*sandbox.FileContentResponse, error) {
+	f.reads++
+	content, ok := f.content[req.Path]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &sandbox.FileContentResponse{Path: req.Path, Size: int64(len(content)), Content: []byte(content)}, nil
+}
+
+// wordEmbedder embeds texts as bags of hashed words, so that texts sharing
+// words are close.
+type wordEmbedder struct{}
+
+func (e *wordEmbedder) Model() string { return "words" }
+
+func (e *wordEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, 64)
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+		}) {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			v[h.Sum32()%64]++
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+func snapshotOf(files map[string]string, modified int64) filewatch.Snapshot {
+	snapshot := make(filewatch.Snapshot, len(files))
+	for path, content := range files {
+		snapshot[path] = filewatch.Stat{Modified: modified, Size: int64(len(content))}
+	}
+	return snapshot
+}
+
+func TestIndexer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	files := &fakeFiles{content: map[string]string{
+		"auth/login.go":           "package auth\n\nfunc Login(user, password string) error {\n\treturn checkPassword(user, password)\n}\n",
+		"billing/invoice.go":      "package billing\n\nfunc SendInvoice(customer string, amount int) error {\n\treturn mail(customer, amount)\n}\n",
+		"node_modules/x/index.js": "module.exports = {}\n",
+		"logo.bin":                "\x00\x01\x02",
+	}}
+	store := &fakeStore{}
+	embedder := &wordEmbedder{}
+	ix := New(store, files, embedder)
+
+	stats, err := ix.Sync(ctx, "p1", snapshotOf(files.content, 1))
+	require.NoError(t, err)
+	require.Equal(t, SyncStats{Indexed: 3}, stats)
+	require.Len(t, store.chunks, 2)
+
+	results, err := ix.Search(ctx, "p1", "login password check", "", 5)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "auth/login.go", results[0].Path)
+	require.Equal(t, 1, results[0].StartLine)
+	require.Greater(t, results[0].Score, results[1].Score)
+
+	results, err = ix.Search(ctx, "p1", "login password check", "billing", 5)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "billing/invoice.go", results[0].Path)
+
+	// Unchanged files, the binary one included, are not read again
+	reads := files.reads
+	stats, err = ix.Sync(ctx, "p1", snapshotOf(files.content, 1))
+	require.NoError(t, err)
+	require.Equal(t, SyncStats{}, stats)
+	require.Equal(t, reads, files.reads)
+
+	// Changed files are indexed again and deleted ones dropped
+	delete(files.content, "billing/invoice.go")
+	files.content["auth/login.go"] += "\nfunc Logout() {}\n"
+	stats, err = ix.Sync(ctx, "p1", snapshotOf(files.content, 2))
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Removed)
+	require.GreaterOrEqual(t, stats.Indexed, 1)
+	for _, c := range store.chunks {
+		require.Equal(t, "auth/login.go", c.Path)
+		require.Contains(t, c.Content, "Logout")
+	}
+}
+
+func TestIndexable(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, Indexable("cmd/main.go", 100))
+	require.True(t, Indexable("README.md", 100))
+	require.False(t, Indexable("cmd/main.go", 0))
+	require.False(t, Indexable("cmd/main.go", maxFileSize+1))
+	require.False(t, Indexable(".git/config", 100))
+	require.False(t, Indexable("web/node_modules/react/index.js", 100))
+	require.False(t, Indexable("assets/logo.png", 100))
+	require.False(t, Indexable("web/package-lock.json", 100))
+	require.False(t, Indexable("go.sum", 100))
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	lines := make([]string, 130)
+	for i := range lines {
+		lines[i] = "line"
+	}
+	chunks := Split("a.go", []byte(strings.Join(lines, "\n")+"\n"))
+	require.Len(t, chunks, 3)
+	require.Equal(t, 1, chunks[0].StartLine)
+	require.Equal(t, 60, chunks[0].EndLine)
+	require.Equal(t, 51, chunks[1].StartLine)
+	require.Equal(t, 110, chunks[1].EndLine)
+	require.Equal(t, 101, chunks[2].StartLine)
+	require.Equal(t, 130, chunks[2].EndLine)
+
+	require.Empty(t, Split("a.bin", []byte("a\x00b")))
+	require.Empty(t, Split("a.go", []byte("\n\n")))
+}
+
+func TestVector(t *testing.T) {
+	t.Parallel()
+
+	v := []float32{0.5, -1, 3.25}
+	require.Equal(t, v, decodeVector(encodeVector(v)))
+	require.InDelta(t, 1, cosine(v, v), 1e-9)
+	require.Zero(t, cosine(v, []float32{1}))
+}
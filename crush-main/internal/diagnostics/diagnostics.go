@@ -0,0 +1,201 @@
+// Package diagnostics summarizes the LSP diagnostics the sandbox reports for
+// the files of a session, and finds the errors introduced by edits.
+package diagnostics
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+)
+
+// Source reports the LSP diagnostics of a session, the sandbox client.
+type Source interface {
+	GetLSPDiagnostics(ctx context.Context, req sandbox.LSPDiagnosticsRequest) (*sandbox.LSPDiagnosticsResponse, error)
+}
+
+// Severities of the diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+	SeverityHint    = "hint"
+)
+
+// Diagnostic is an LSP diagnostic of a file, lines and columns start at 1.
+type Diagnostic struct {
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Source   string `json:"source,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message"`
+}
+
+// File is the diagnostics of a file, errors first.
+type File struct {
+	Path        string       `json:"path"`
+	Errors      int          `json:"errors"`
+	Warnings    int          `json:"warnings"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Summary is the diagnostics of a set of files, sorted by path.
+type Summary struct {
+	Files    []File `json:"files"`
+	Errors   int    `json:"errors"`
+	Warnings int    `json:"warnings"`
+}
+
+// Summarize fetches the current diagnostics of a session and keeps the ones of
+// paths, every reported file when paths is nil. Files without diagnostics are
+// left out.
+func Summarize(ctx context.Context, src Source, sessionID string, paths []string) (Summary, error) {
+	if paths != nil && len(paths) == 0 {
+		return Summary{Files: []File{}}, nil
+	}
+	resp, err := src.GetLSPDiagnostics(ctx, sandbox.LSPDiagnosticsRequest{SessionID: sessionID})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var wanted map[string]bool
+	if paths != nil {
+		wanted = make(map[string]bool, len(paths))
+		for _, p := range paths {
+			wanted[filepath.Clean(p)] = true
+		}
+	}
+	files := make(map[string]*File)
+	for _, fd := range slices.Concat(resp.FileDiagnostics, resp.ProjectDiagnostics) {
+		path := filepath.Clean(fd.FilePath)
+		if wanted != nil && !wanted[path] {
+			continue
+		}
+		for _, d := range fd.Diagnostics {
+			f, ok := files[path]
+			if !ok {
+				f = &File{Path: path}
+				files[path] = f
+			}
+			diag := fromSandbox(path, d)
+			if slices.Contains(f.Diagnostics, diag) {
+				// The same file may be both the current and a project file
+				continue
+			}
+			f.Diagnostics = append(f.Diagnostics, diag)
+		}
+	}
+
+	summary := Summary{Files: make([]File, 0, len(files))}
+	for _, f := range files {
+		slices.SortFunc(f.Diagnostics, compare)
+		for _, d := range f.Diagnostics {
+			switch d.Severity {
+			case SeverityError:
+				f.Errors++
+			case SeverityWarning:
+				f.Warnings++
+			}
+		}
+		summary.Errors += f.Errors
+		summary.Warnings += f.Warnings
+		summary.Files = append(summary.Files, *f)
+	}
+	slices.SortFunc(summary.Files, func(a, b File) int { return strings.Compare(a.Path, b.Path) })
+	return summary, nil
+}
+
+func fromSandbox(path string, d sandbox.Diagnostic) Diagnostic {
+	severity := SeverityInfo
+	switch d.Severity {
+	case sandbox.SeverityError:
+		severity = SeverityError
+	case sandbox.SeverityWarning:
+		severity = SeverityWarning
+	case sandbox.SeverityHint:
+		severity = SeverityHint
+	}
+	var code string
+	if d.Code != nil {
+		code = fmt.Sprint(d.Code)
+	}
+	return Diagnostic{
+		Path:     path,
+		Line:     d.Range.Start.Line + 1,
+		Column:   d.Range.Start.Character + 1,
+		Severity: severity,
+		Source:   d.Source,
+		Code:     code,
+		Message:  d.Message,
+	}
+}
+
+var severityRank = map[string]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2, SeverityHint: 3}
+
+func compare(a, b Diagnostic) int {
+	return cmp.Or(
+		cmp.Compare(severityRank[a.Severity], severityRank[b.Severity]),
+		cmp.Compare(a.Line, b.Line),
+		cmp.Compare(a.Column, b.Column),
+		strings.Compare(a.Message, b.Message),
+	)
+}
+
+// key identifies an error across edits, which move it to other lines.
+func (d Diagnostic) key() string {
+	return strings.Join([]string{d.Path, d.Source, d.Code, d.Message}, "\x00")
+}
+
+// NewErrors returns the errors of after that are not in before. An error
+// reported n times before only matches its first n occurrences after.
+func NewErrors(before, after Summary) []Diagnostic {
+	known := make(map[string]int)
+	for _, f := range before.Files {
+		for _, d := range f.Diagnostics {
+			if d.Severity == SeverityError {
+				known[d.key()]++
+			}
+		}
+	}
+	var errs []Diagnostic
+	for _, f := range after.Files {
+		for _, d := range f.Diagnostics {
+			if d.Severity != SeverityError {
+				continue
+			}
+			if known[d.key()] > 0 {
+				known[d.key()]--
+				continue
+			}
+			errs = append(errs, d)
+		}
+	}
+	return errs
+}
+
+// maxPromptErrors bounds the errors listed in a fix prompt.
+const maxPromptErrors = 20
+
+// FixPrompt asks the agent to fix errors introduced by its edits.
+func FixPrompt(errs []Diagnostic) string {
+	var b strings.Builder
+	b.WriteString("Your last changes introduced the following errors reported by the language server. Fix them, without changing unrelated code:\n\n")
+	for i, d := range errs {
+		if i == maxPromptErrors {
+			fmt.Fprintf(&b, "... and %d more errors\n", len(errs)-maxPromptErrors)
+			break
+		}
+		fmt.Fprintf(&b, "- %s:%d:%d", d.Path, d.Line, d.Column)
+		if d.Source != "" || d.Code != "" {
+			fmt.Fprintf(&b, " [%s]", strings.TrimSpace(d.Source+" "+d.Code))
+		}
+		fmt.Fprintf(&b, " %s\n", d.Message)
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package diagnostics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/infra/sandbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	resp *sandbox.LSPDiagnosticsResponse
+}
+
+func (f fakeSource) GetLSPDiagnostics(context.Context, sandbox.LSPDiagnosticsRequest) (*sandbox.LSPDiagnosticsResponse, error) {
+	return f.resp, nil
+}
+
+func diag(line int, severity sandbox.DiagnosticSeverity, message string) sandbox.Diagnostic {
+	return sandbox.Diagnostic{
+		Range:    sandbox.Range{Start: sandbox.Position{Line: line}},
+		Severity: severity,
+		Source:   "compiler",
+		Message:  message,
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	src := fakeSource{resp: &sandbox.LSPDiagnosticsResponse{
+		FileDiagnostics: []sandbox.FileDiagnostics{
+			{FilePath: "/work/b.go", Diagnostics: []sandbox.Diagnostic{diag(3, sandbox.SeverityError, "undefined: x")}},
+		},
+		ProjectDiagnostics: []sandbox.FileDiagnostics{
+			{FilePath: "/work/b.go", Diagnostics: []sandbox.Diagnostic{
+				diag(1, sandbox.SeverityWarning, "unused"),
+				diag(3, sandbox.SeverityError, "undefined: x"),
+			}},
+			{FilePath: "/work/./a.go", Diagnostics: []sandbox.Diagnostic{diag(0, sandbox.SeverityHint, "simplify")}},
+			{FilePath: "/work/c.go", Diagnostics: []sandbox.Diagnostic{diag(0, sandbox.SeverityError, "syntax error")}},
+		},
+	}}
+
+	summary, err := Summarize(t.Context(), src, "s1", []string{"/work/a.go", "/work/b.go"})
+	require.NoError(t, err)
+	require.Len(t, summary.Files, 2)
+	assert.Equal(t, "/work/a.go", summary.Files[0].Path)
+	b := summary.Files[1]
+	assert.Equal(t, 1, b.Errors, "the current file is not counted twice")
+	assert.Equal(t, 1, b.Warnings)
+	assert.Equal(t, Diagnostic{Path: "/work/b.go", Line: 4, Column: 1, Severity: SeverityError, Source: "compiler", Message: "undefined: x"}, b.Diagnostics[0], "errors come first")
+	assert.Equal(t, 1, summary.Errors)
+
+	all, err := Summarize(t.Context(), src, "s1", nil)
+	require.NoError(t, err)
+	assert.Len(t, all.Files, 3)
+	assert.Equal(t, 2, all.Errors)
+
+	none, err := Summarize(t.Context(), src, "s1", []string{})
+	require.NoError(t, err)
+	assert.Empty(t, none.Files)
+}
+
+func TestNewErrors(t *testing.T) {
+	errAt := func(line int, message string) Diagnostic {
+		return Diagnostic{Path: "/work/a.go", Line: line, Severity: SeverityError, Message: message}
+	}
+	before := Summary{Files: []File{{Path: "/work/a.go", Diagnostics: []Diagnostic{errAt(1, "old")}}}}
+	after := Summary{Files: []File{{Path: "/work/a.go", Diagnostics: []Diagnostic{
+		errAt(5, "old"),
+		errAt(6, "old"),
+		errAt(7, "new"),
+		{Path: "/work/a.go", Line: 8, Severity: SeverityWarning, Message: "warning"},
+	}}}}
+
+	errs := NewErrors(before, after)
+	assert.Equal(t, []Diagnostic{errAt(6, "old"), errAt(7, "new")}, errs, "moved errors are known, repeated ones are new")
+	assert.Contains(t, FixPrompt(errs), "- /work/a.go:7:0 new\n")
+}
@@ -57,3 +57,10 @@ func TokensUsed(props ...any) {
 		props...,
 	)
 }
+
+func FeedbackGiven(props ...any) {
+	send(
+		"feedback given",
+		props...,
+	)
+}
@@ -0,0 +1,190 @@
+// Package filewatch reports the files created, modified and deleted in the
+// working directory of a project sandbox. The sandbox has no change
+// notifications, so snapshots of the file metadata are taken periodically and
+// compared.
+package filewatch
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeType is the kind of a file change. The values are the event types
+// sent to clients.
+type ChangeType string
+
+const (
+	Created  ChangeType = "file_created"
+	Modified ChangeType = "file_modified"
+	Deleted  ChangeType = "file_deleted"
+)
+
+// Stat is the metadata of a file in a snapshot.
+type Stat struct {
+	Modified int64 // Unix milliseconds
+	Size     int64
+}
+
+// Snapshot maps the paths of the files of a project to their metadata.
+type Snapshot map[string]Stat
+
+// Change is a change of a file between two snapshots.
+type Change struct {
+	Type     ChangeType `json:"type"`
+	Path     string     `json:"path"`
+	Size     int64      `json:"size,omitempty"`
+	Modified int64      `json:"modified,omitempty"`
+}
+
+// Diff returns the changes from prev to next, sorted by path.
+func Diff(prev, next Snapshot) []Change {
+	var changes []Change
+	for path, stat := range next {
+		old, ok := prev[path]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Type: Created, Path: path, Size: stat.Size, Modified: stat.Modified})
+		case old != stat:
+			changes = append(changes, Change{Type: Modified, Path: path, Size: stat.Size, Modified: stat.Modified})
+		}
+	}
+	for path := range prev {
+		if _, ok := next[path]; !ok {
+			changes = append(changes, Change{Type: Deleted, Path: path})
+		}
+	}
+	slices.SortFunc(changes, func(a, b Change) int { return strings.Compare(a.Path, b.Path) })
+	return changes
+}
+
+// Source takes a snapshot of the working directory of a project.
+type Source func(ctx context.Context, projectID string) (Snapshot, error)
+
+// Publisher receives the changes seen in the project of a watching session.
+type Publisher func(sessionID string, changes []Change)
+
+// Watcher polls the projects of the sessions watching them. The first
+// snapshot of a project is the baseline, the changes are reported from the
+// second one on. Sessions of the same project share its snapshots.
+type Watcher struct {
+	source   Source
+	publish  Publisher
+	interval time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]string   // session ID -> project ID
+	snapshots map[string]Snapshot // project ID -> last snapshot
+	// polling serializes the polls so that changes are reported once
+	polling sync.Mutex
+}
+
+// New returns a watcher taking snapshots from source every interval.
+func New(source Source, publish Publisher, interval time.Duration) *Watcher {
+	return &Watcher{
+		source:    source,
+		publish:   publish,
+		interval:  interval,
+		sessions:  make(map[string]string),
+		snapshots: make(map[string]Snapshot),
+	}
+}
+
+// Watch starts reporting the changes of a project to a session. The baseline
+// snapshot is taken right away so that the first changes are not missed.
+func (w *Watcher) Watch(ctx context.Context, sessionID, projectID string) {
+	w.mu.Lock()
+	w.sessions[sessionID] = projectID
+	_, known := w.snapshots[projectID]
+	w.mu.Unlock()
+	if !known {
+		w.poll(ctx, projectID)
+	}
+}
+
+// Unwatch reports the changes of the project of a session one last time, to
+// catch the edits made since the last poll, and stops watching it.
+func (w *Watcher) Unwatch(ctx context.Context, sessionID string) {
+	w.mu.Lock()
+	projectID, ok := w.sessions[sessionID]
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+	w.poll(ctx, projectID)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.sessions, sessionID)
+	for _, p := range w.sessions {
+		if p == projectID {
+			return
+		}
+	}
+	delete(w.snapshots, projectID)
+}
+
+// Run polls the watched projects until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			projects := make(map[string]struct{})
+			for _, p := range w.sessions {
+				projects[p] = struct{}{}
+			}
+			w.mu.Unlock()
+			for projectID := range projects {
+				w.poll(ctx, projectID)
+			}
+		}
+	}
+}
+
+// poll takes a snapshot of a project and publishes its changes to the
+// sessions watching it.
+func (w *Watcher) poll(ctx context.Context, projectID string) {
+	w.polling.Lock()
+	defer w.polling.Unlock()
+
+	next, err := w.source(ctx, projectID)
+	if err != nil {
+		slog.Warn("Failed to take file snapshot", "project_id", projectID, "error", err)
+		return
+	}
+
+	w.mu.Lock()
+	var sessions []string
+	for s, p := range w.sessions {
+		if p == projectID {
+			sessions = append(sessions, s)
+		}
+	}
+	// The project may no longer be watched since the snapshot was requested
+	if len(sessions) == 0 {
+		w.mu.Unlock()
+		return
+	}
+	prev, known := w.snapshots[projectID]
+	w.snapshots[projectID] = next
+	w.mu.Unlock()
+
+	if !known {
+		return
+	}
+	changes := Diff(prev, next)
+	if len(changes) == 0 {
+		return
+	}
+	for _, sessionID := range sessions {
+		w.publish(sessionID, changes)
+	}
+}
@@ -0,0 +1,64 @@
+package filewatch
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	prev := Snapshot{
+		"/main.go":   {Modified: 1, Size: 10},
+		"/README.md": {Modified: 1, Size: 5},
+		"/old.txt":   {Modified: 1, Size: 1},
+	}
+	next := Snapshot{
+		"/main.go":   {Modified: 2, Size: 12},
+		"/README.md": {Modified: 1, Size: 5},
+		"/new.txt":   {Modified: 3, Size: 4},
+	}
+	require.Equal(t, []Change{
+		{Type: Modified, Path: "/main.go", Size: 12, Modified: 2},
+		{Type: Created, Path: "/new.txt", Size: 4, Modified: 3},
+		{Type: Deleted, Path: "/old.txt"},
+	}, Diff(prev, next))
+	require.Empty(t, Diff(next, next))
+}
+
+func TestWatcher(t *testing.T) {
+	var mu sync.Mutex
+	current := Snapshot{"/a.go": {Modified: 1, Size: 1}}
+	source := func(context.Context, string) (Snapshot, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return maps.Clone(current), nil
+	}
+	published := make(map[string][]Change)
+	publish := func(sessionID string, changes []Change) {
+		published[sessionID] = append(published[sessionID], changes...)
+	}
+
+	ctx := context.Background()
+	w := New(source, publish, time.Hour)
+	w.Watch(ctx, "s1", "p1")
+	w.Watch(ctx, "s2", "p1")
+
+	mu.Lock()
+	current["/b.go"] = Stat{Modified: 2, Size: 3}
+	mu.Unlock()
+
+	// The last poll of a session reports the edits to every session of the project
+	w.Unwatch(ctx, "s1")
+	want := []Change{{Type: Created, Path: "/b.go", Size: 3, Modified: 2}}
+	require.Equal(t, want, published["s1"])
+	require.Equal(t, want, published["s2"])
+	require.Contains(t, w.snapshots, "p1")
+
+	w.Unwatch(ctx, "s2")
+	require.Empty(t, w.snapshots)
+	require.Empty(t, w.sessions)
+}
@@ -455,6 +455,28 @@ func (c *Client) FindReferences(ctx context.Context, filepath string, line, char
 	return c.client.FindReferences(ctx, filepath, line-1, character-1, includeDeclaration)
 }
 
+// Rename returns the edits renaming the symbol at the given position, in
+// every file of the workspace. The powernap client has no rename request, so
+// the edits replace the references of the symbol, its declaration included;
+// the server only reports real references of that symbol, which is what
+// textDocument/rename would edit too.
+func (c *Client) Rename(ctx context.Context, filepath string, line, character int, newName string) (*protocol.WorkspaceEdit, error) {
+	locations, err := c.FindReferences(ctx, filepath, line, character, true)
+	if err != nil {
+		return nil, err
+	}
+	edit := &protocol.WorkspaceEdit{Changes: make(map[protocol.DocumentURI][]protocol.TextEdit)}
+	seen := make(map[protocol.Location]bool, len(locations))
+	for _, loc := range locations {
+		if seen[loc] {
+			continue
+		}
+		seen[loc] = true
+		edit.Changes[loc.URI] = append(edit.Changes[loc.URI], protocol.TextEdit{Range: loc.Range, NewText: newName})
+	}
+	return edit, nil
+}
+
 // HasRootMarkers checks if any of the specified root marker patterns exist in the given directory.
 // Uses glob patterns to match files, allowing for more flexible matching.
 func HasRootMarkers(dir string, rootMarkers []string) bool {
@@ -0,0 +1,115 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aymanbagabas/go-udiff"
+)
+
+// Hunk is one hunk of the unified diff between two contents. Hunks are
+// numbered from zero in file order so an approver can pick a subset of them.
+type Hunk struct {
+	Index    int    `json:"index"`
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Diff     string `json:"diff"` // Hunk body, each line prefixed with ' ', '-' or '+'
+}
+
+// Hunks splits the diff between two contents into hunks.
+func Hunks(beforeContent, afterContent string) ([]Hunk, error) {
+	u, err := unifiedHunks(beforeContent, afterContent)
+	if err != nil {
+		return nil, err
+	}
+	hunks := make([]Hunk, 0, len(u.Hunks))
+	offset := 0
+	for i, h := range u.Hunks {
+		hunk := Hunk{Index: i, OldStart: h.FromLine}
+		var body strings.Builder
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case udiff.Equal:
+				hunk.OldLines++
+				hunk.NewLines++
+				body.WriteString(" ")
+			case udiff.Delete:
+				hunk.OldLines++
+				body.WriteString("-")
+			case udiff.Insert:
+				hunk.NewLines++
+				body.WriteString("+")
+			}
+			body.WriteString(l.Content)
+			if !strings.HasSuffix(l.Content, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		hunk.NewStart = h.FromLine + offset
+		offset += hunk.NewLines - hunk.OldLines
+		hunk.Diff = body.String()
+		hunks = append(hunks, hunk)
+	}
+	return hunks, nil
+}
+
+// ApplyHunks returns beforeContent with only the approved hunks of the diff
+// to afterContent applied. Hunk indices are the ones returned by Hunks.
+func ApplyHunks(beforeContent, afterContent string, approved []int) (string, error) {
+	u, err := unifiedHunks(beforeContent, afterContent)
+	if err != nil {
+		return "", err
+	}
+	selected := make(map[int]bool, len(approved))
+	for _, i := range approved {
+		if i < 0 || i >= len(u.Hunks) {
+			return "", fmt.Errorf("hunk %d out of range, the diff has %d hunks", i, len(u.Hunks))
+		}
+		selected[i] = true
+	}
+
+	lines := strings.SplitAfter(beforeContent, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var out strings.Builder
+	cursor := 0
+	for i, h := range u.Hunks {
+		start := h.FromLine - 1
+		if start < cursor || start > len(lines) {
+			return "", fmt.Errorf("hunk %d does not match the original content", i)
+		}
+		for _, l := range lines[cursor:start] {
+			out.WriteString(l)
+		}
+		cursor = start
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case udiff.Equal:
+				out.WriteString(lines[cursor])
+				cursor++
+			case udiff.Delete:
+				if !selected[i] {
+					out.WriteString(lines[cursor])
+				}
+				cursor++
+			case udiff.Insert:
+				if selected[i] {
+					out.WriteString(l.Content)
+				}
+			}
+		}
+	}
+	for _, l := range lines[cursor:] {
+		out.WriteString(l)
+	}
+	return out.String(), nil
+}
+
+func unifiedHunks(beforeContent, afterContent string) (udiff.UnifiedDiff, error) {
+	edits := udiff.Strings(beforeContent, afterContent)
+	return udiff.ToUnifiedDiff("", "", beforeContent, edits, udiff.DefaultContextLines)
+}
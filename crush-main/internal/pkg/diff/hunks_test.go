@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func numberedLines(n int, edit func(i int) string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if edit != nil {
+			if line := edit(i); line != "" {
+				b.WriteString(line)
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestHunks(t *testing.T) {
+	before := numberedLines(30, nil)
+	after := numberedLines(30, func(i int) string {
+		switch i {
+		case 3:
+			return "line 3 changed\nline 3b added\n"
+		case 25:
+			return "line 25 changed\n"
+		}
+		return ""
+	})
+
+	hunks, err := Hunks(before, after)
+	require.NoError(t, err)
+	require.Len(t, hunks, 2)
+	require.Equal(t, 0, hunks[0].Index)
+	require.Contains(t, hunks[0].Diff, "+line 3 changed\n")
+	require.Contains(t, hunks[0].Diff, "+line 3b added\n")
+	require.Equal(t, hunks[1].OldStart+1, hunks[1].NewStart, "second hunk is shifted by the first")
+	require.Contains(t, hunks[1].Diff, "+line 25 changed\n")
+}
+
+func TestApplyHunks(t *testing.T) {
+	before := numberedLines(30, nil)
+	after := numberedLines(30, func(i int) string {
+		switch i {
+		case 3:
+			return "line 3 changed\n"
+		case 25:
+			return ""
+		case 26:
+			return "line 26 changed\n"
+		}
+		return ""
+	})
+
+	t.Run("all hunks", func(t *testing.T) {
+		got, err := ApplyHunks(before, after, []int{0, 1})
+		require.NoError(t, err)
+		require.Equal(t, after, got)
+	})
+
+	t.Run("no hunks", func(t *testing.T) {
+		got, err := ApplyHunks(before, after, nil)
+		require.NoError(t, err)
+		require.Equal(t, before, got)
+	})
+
+	t.Run("some hunks", func(t *testing.T) {
+		got, err := ApplyHunks(before, after, []int{1})
+		require.NoError(t, err)
+		require.Contains(t, got, "line 3\n")
+		require.Contains(t, got, "line 26 changed\n")
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		_, err := ApplyHunks(before, after, []int{2})
+		require.Error(t, err)
+	})
+
+	t.Run("missing trailing newline", func(t *testing.T) {
+		got, err := ApplyHunks("a\nb", "a\nc", []int{0})
+		require.NoError(t, err)
+		require.Equal(t, "a\nc", got)
+	})
+}
@@ -0,0 +1,38 @@
+package log
+
+import "context"
+
+type contextKey int
+
+const (
+	sessionIDKey contextKey = iota
+	requestIDKey
+)
+
+// WithSessionID returns a context whose log records carry the session ID.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// WithRequestID returns a context whose log records carry the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// SessionID returns the session ID of a context, empty when it has none.
+func SessionID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(sessionIDKey).(string)
+	return id
+}
+
+// RequestID returns the request ID of a context, empty when it has none.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
@@ -0,0 +1,303 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/mask"
+)
+
+// modulePath is trimmed from package paths to name the module of a record.
+const modulePath = "github.com/rolling1314/rolling-crush/"
+
+// Levels are the minimum levels of the modules. A module is the package a
+// record is logged from, e.g. "internal/agent", or the "module" attribute of
+// the logger. Module levels apply to sub-packages too.
+type Levels struct {
+	Default slog.Level
+	Modules map[string]slog.Level
+}
+
+// ParseLevels parses a level spec such as "info,internal/agent=debug,infra=warn",
+// a default level followed by module levels, all optional.
+func ParseLevels(spec string) (Levels, error) {
+	levels := Levels{Default: slog.LevelInfo, Modules: make(map[string]slog.Level)}
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		module, name, ok := strings.Cut(part, "=")
+		if !ok {
+			name = module
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+			return Levels{}, fmt.Errorf("invalid log level %q: %w", part, err)
+		}
+		if ok {
+			levels.Modules[strings.Trim(strings.TrimSpace(module), "/")] = level
+		} else {
+			levels.Default = level
+		}
+	}
+	return levels, nil
+}
+
+// level returns the level of a module, from its longest configured prefix.
+func (l Levels) level(module string) slog.Level {
+	level, matched := l.Default, -1
+	for prefix, moduleLevel := range l.Modules {
+		if len(prefix) > matched && (module == prefix || strings.HasPrefix(module, prefix+"/")) {
+			level, matched = moduleLevel, len(prefix)
+		}
+	}
+	return level
+}
+
+// min returns the lowest level any module logs at.
+func (l Levels) min() slog.Level {
+	level := l.Default
+	for _, moduleLevel := range l.Modules {
+		level = min(level, moduleLevel)
+	}
+	return level
+}
+
+var levels atomic.Pointer[Levels]
+
+func init() {
+	levels.Store(&Levels{Default: slog.LevelInfo})
+}
+
+// SetLevels replaces the module levels of the logger set up by Setup.
+func SetLevels(l Levels) {
+	levels.Store(&l)
+}
+
+// output writes logs to the log file and, in stdout mode, to stdout as well.
+type output struct {
+	file   io.Writer
+	stdout atomic.Bool
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if o.stdout.Load() {
+		os.Stdout.Write(p)
+	}
+	return o.file.Write(p)
+}
+
+// handler filters records by the level of their module, adds the correlation
+// IDs of the context, masks the values of the secrets store and keeps the
+// records in the ring buffer.
+type handler struct {
+	inner slog.Handler
+	// module is set by a "module" attribute, the package of the caller
+	// is used otherwise
+	module string
+	attrs  []slog.Attr
+	groups []string
+}
+
+func newHandler(inner slog.Handler) *handler {
+	return &handler{inner: inner}
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	// The module is only known from the record, see Handle
+	return level >= levels.Load().min()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	module := h.module
+	if module == "" {
+		module = moduleOf(r.PC)
+	}
+	if r.Level < levels.Load().level(module) {
+		return nil
+	}
+	if mask.Enabled() {
+		r = maskRecord(r)
+	}
+
+	e := h.entry(module, r)
+	if h.module == "" {
+		r.AddAttrs(slog.String("module", module))
+	}
+	if id := SessionID(ctx); id != "" && e.SessionID == "" {
+		e.SessionID = id
+		r.AddAttrs(slog.String("session_id", id))
+	}
+	if id := RequestID(ctx); id != "" && e.RequestID == "" {
+		e.RequestID = id
+		r.AddAttrs(slog.String("request_id", id))
+	}
+
+	ring.add(e)
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if mask.Enabled() {
+		attrs = maskAttrs(attrs)
+	}
+	clone := *h
+	clone.inner = h.inner.WithAttrs(attrs)
+	clone.attrs = append(slices.Clip(h.attrs), h.qualify(attrs)...)
+	if len(h.groups) == 0 {
+		for _, attr := range attrs {
+			if attr.Key == "module" {
+				clone.module = attr.Value.String()
+			}
+		}
+	}
+	return &clone
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.inner = h.inner.WithGroup(name)
+	clone.groups = append(slices.Clip(h.groups), name)
+	return &clone
+}
+
+// qualify prefixes the keys of attributes with the open groups.
+func (h *handler) qualify(attrs []slog.Attr) []slog.Attr {
+	if len(h.groups) == 0 {
+		return attrs
+	}
+	prefix := strings.Join(h.groups, ".") + "."
+	qualified := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		qualified[i] = slog.Attr{Key: prefix + attr.Key, Value: attr.Value}
+	}
+	return qualified
+}
+
+func (h *handler) entry(module string, r slog.Record) Entry {
+	e := Entry{
+		Time:    r.Time,
+		Level:   r.Level.String(),
+		Module:  module,
+		Message: r.Message,
+		Attrs:   make(map[string]any, len(h.attrs)+r.NumAttrs()),
+	}
+	for _, attr := range h.attrs {
+		e.Attrs[attr.Key] = attrValue(attr.Value)
+	}
+	var recordAttrs []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		recordAttrs = append(recordAttrs, a)
+		return true
+	})
+	for _, attr := range h.qualify(recordAttrs) {
+		e.Attrs[attr.Key] = attrValue(attr.Value)
+	}
+	// Correlation IDs logged explicitly are kept as such
+	e.SessionID, _ = e.Attrs["session_id"].(string)
+	e.RequestID, _ = e.Attrs["request_id"].(string)
+	delete(e.Attrs, "module")
+	delete(e.Attrs, "session_id")
+	delete(e.Attrs, "request_id")
+	return e
+}
+
+// maskRecord returns a copy of r with the secret values of its message and
+// attributes masked.
+func maskRecord(r slog.Record) slog.Record {
+	masked := slog.NewRecord(r.Time, r.Level, mask.String(r.Message), r.PC)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	masked.AddAttrs(maskAttrs(attrs)...)
+	return masked
+}
+
+func maskAttrs(attrs []slog.Attr) []slog.Attr {
+	masked := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		masked[i] = slog.Attr{Key: attr.Key, Value: maskValue(attr.Value)}
+	}
+	return masked
+}
+
+// maskValue masks strings, errors and stringers, nested in groups too.
+func maskValue(v slog.Value) slog.Value {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.StringValue(mask.String(v.String()))
+	case slog.KindGroup:
+		return slog.GroupValue(maskAttrs(v.Group())...)
+	case slog.KindAny:
+		switch value := v.Any().(type) {
+		case error:
+			return slog.StringValue(mask.String(value.Error()))
+		case fmt.Stringer:
+			return slog.StringValue(mask.String(value.String()))
+		}
+	}
+	return v
+}
+
+// attrValue converts an attribute value to something that encodes to JSON.
+func attrValue(v slog.Value) any {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		group := make(map[string]any)
+		for _, attr := range v.Group() {
+			group[attr.Key] = attrValue(attr.Value)
+		}
+		return group
+	case slog.KindAny:
+		switch value := v.Any().(type) {
+		case error:
+			return value.Error()
+		case fmt.Stringer:
+			return value.String()
+		}
+	}
+	return v.Any()
+}
+
+var modules sync.Map // program counter -> module
+
+// moduleOf returns the module a program counter is in, the path of its
+// package within this repository.
+func moduleOf(pc uintptr) string {
+	if pc == 0 {
+		return ""
+	}
+	if module, ok := modules.Load(pc); ok {
+		return module.(string)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	module := packagePath(frame.Function)
+	modules.Store(pc, module)
+	return module
+}
+
+// packagePath returns the package of a qualified function name such as
+// "github.com/org/repo/pkg.(*T).Method", relative to this repository.
+func packagePath(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		function = function[:slash+1+dot]
+	}
+	return strings.TrimPrefix(function, modulePath)
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/mask"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("warn, internal/agent=debug,infra/=error")
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelWarn, levels.Default)
+	require.Equal(t, slog.LevelDebug, levels.level("internal/agent"))
+	require.Equal(t, slog.LevelDebug, levels.level("internal/agent/tools"))
+	require.Equal(t, slog.LevelWarn, levels.level("internal/agentic"))
+	require.Equal(t, slog.LevelError, levels.level("infra/sandbox"))
+	require.Equal(t, slog.LevelDebug, levels.min())
+
+	levels, err = ParseLevels("")
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelInfo, levels.Default)
+
+	_, err = ParseLevels("internal/agent=loud")
+	require.Error(t, err)
+}
+
+func TestPackagePath(t *testing.T) {
+	require.Equal(t, "internal/agent", packagePath("github.com/rolling1314/rolling-crush/internal/agent.(*sessionAgent).Run"))
+	require.Equal(t, "internal/pkg/log", packagePath("github.com/rolling1314/rolling-crush/internal/pkg/log.TestPackagePath.func1"))
+	require.Equal(t, "main", packagePath("main.main"))
+}
+
+func newTestLogger(t *testing.T, spec string) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	previous := levels.Load()
+	t.Cleanup(func() {
+		levels.Store(previous)
+		ring.resize(defaultRingSize)
+	})
+	l, err := ParseLevels(spec)
+	require.NoError(t, err)
+	SetLevels(l)
+	ring.resize(10)
+
+	var buf bytes.Buffer
+	return slog.New(newHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))), &buf
+}
+
+func TestHandlerModuleLevels(t *testing.T) {
+	logger, buf := newTestLogger(t, "info,internal/pkg/log=debug,quiet=error")
+
+	logger.Debug("from this package")
+	logger.With("module", "quiet").Warn("from a quiet module")
+	logger.With("module", "quiet/sub").Error("from a quiet sub-module")
+
+	var records []map[string]any
+	for line := range bytes.Lines(buf.Bytes()) {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(line, &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+	require.Equal(t, "internal/pkg/log", records[0]["module"])
+	require.Equal(t, "quiet/sub", records[1]["module"])
+}
+
+func TestHandlerCorrelationIDs(t *testing.T) {
+	logger, buf := newTestLogger(t, "info")
+
+	ctx := WithRequestID(WithSessionID(context.Background(), "session-1"), "request-1")
+	logger.InfoContext(ctx, "prompt queued", "queue", 2)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "session-1", record["session_id"])
+	require.Equal(t, "request-1", record["request_id"])
+
+	entries := Recent(Filter{SessionID: "session-1"})
+	require.Len(t, entries, 1)
+	require.Equal(t, "prompt queued", entries[0].Message)
+	require.Equal(t, "request-1", entries[0].RequestID)
+	require.Equal(t, map[string]any{"queue": int64(2)}, entries[0].Attrs)
+}
+
+func TestHandlerMasksSecrets(t *testing.T) {
+	logger, buf := newTestLogger(t, "info")
+	mask.Add("log-secret-1234")
+
+	logger.With("key", "log-secret-1234").Info("using log-secret-1234",
+		"err", errors.New("rejected key log-secret-1234"),
+		slog.Group("provider", "api_key", "log-secret-1234"))
+
+	require.NotContains(t, buf.String(), "log-secret-1234")
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "using "+mask.Placeholder, record["msg"])
+	require.Equal(t, "rejected key "+mask.Placeholder, record["err"])
+}
+
+func TestRecent(t *testing.T) {
+	logger, _ := newTestLogger(t, "debug")
+
+	for i := range 12 {
+		logger.Debug("debug", "i", i)
+		if i%4 == 0 {
+			logger.With("module", "infra/sandbox").Warn("warn", "i", i)
+		}
+	}
+
+	// The buffer keeps the last 10 records
+	entries := Recent(Filter{})
+	require.Len(t, entries, 10)
+	require.Equal(t, int64(11), entries[9].Attrs["i"])
+
+	entries = Recent(Filter{Level: slog.LevelWarn})
+	require.Len(t, entries, 2)
+	require.Equal(t, int64(4), entries[0].Attrs["i"])
+	require.Equal(t, int64(8), entries[1].Attrs["i"])
+
+	entries = Recent(Filter{Module: "infra", Limit: 1})
+	require.Len(t, entries, 1)
+	require.Equal(t, int64(8), entries[0].Attrs["i"])
+
+	entries = Recent(Filter{Limit: 2})
+	require.Len(t, entries, 2)
+	require.Equal(t, int64(10), entries[0].Attrs["i"])
+	require.Equal(t, int64(11), entries[1].Attrs["i"])
+}
@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"runtime/debug"
@@ -16,6 +17,7 @@ import (
 var (
 	initOnce    sync.Once
 	initialized atomic.Bool
+	out         = &output{file: io.Discard}
 )
 
 func Setup(logFile string, debug bool) {
@@ -33,12 +35,15 @@ func Setup(logFile string, debug bool) {
 			level = slog.LevelDebug
 		}
 
-		logger := slog.NewJSONHandler(logRotator, &slog.HandlerOptions{
-			Level:     level,
+		// Levels are filtered per module by the handler
+		out.file = logRotator
+		logger := slog.NewJSONHandler(out, &slog.HandlerOptions{
+			Level:     slog.LevelDebug,
 			AddSource: true,
 		})
 
-		slog.SetDefault(slog.New(logger))
+		SetLevels(Levels{Default: level})
+		slog.SetDefault(slog.New(newHandler(logger)))
 		initialized.Store(true)
 	})
 }
@@ -47,6 +52,18 @@ func Initialized() bool {
 	return initialized.Load()
 }
 
+// SetStdout makes the logger set up by Setup write to stdout as well as to
+// the log file, for services run in containers.
+func SetStdout(enabled bool) {
+	out.stdout.Store(enabled)
+}
+
+// SetRingSize changes how many recent records are kept for Recent, dropping
+// the records kept so far.
+func SetRingSize(size int) {
+	ring.resize(size)
+}
+
 func RecoverPanic(name string, cleanup func()) {
 	if r := recover(); r != nil {
 		event.Error(r, "panic", true, "name", name)
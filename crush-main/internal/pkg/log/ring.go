@@ -0,0 +1,137 @@
+package log
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRingSize is how many recent records are kept for debugging.
+const defaultRingSize = 2000
+
+// Entry is a log record kept in the ring buffer.
+type Entry struct {
+	Time      time.Time      `json:"time"`
+	Level     string         `json:"level"`
+	Module    string         `json:"module"`
+	Message   string         `json:"message"`
+	SessionID string         `json:"session_id,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	Attrs     map[string]any `json:"attrs,omitempty"`
+}
+
+// Filter selects recent log records.
+type Filter struct {
+	Limit     int
+	Level     slog.Leveler // All levels when nil
+	Module    string       // Module or parent module, e.g. "internal/agent"
+	SessionID string
+	RequestID string
+}
+
+// ParseFilter reads a filter from the limit, level, module, session_id and
+// request_id query parameters of the debug endpoints.
+func ParseFilter(query url.Values) (Filter, error) {
+	f := Filter{
+		Module:    query.Get("module"),
+		SessionID: query.Get("session_id"),
+		RequestID: query.Get("request_id"),
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return Filter{}, fmt.Errorf("limit must be a positive integer")
+		}
+		f.Limit = limit
+	}
+	if v := query.Get("level"); v != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return Filter{}, fmt.Errorf("invalid level %q", v)
+		}
+		f.Level = level
+	}
+	return f, nil
+}
+
+func (f Filter) match(e Entry) bool {
+	var level slog.Level
+	if f.Level != nil && level.UnmarshalText([]byte(e.Level)) == nil && level < f.Level.Level() {
+		return false
+	}
+	if f.Module != "" && e.Module != f.Module && !strings.HasPrefix(e.Module, f.Module+"/") {
+		return false
+	}
+	return (f.SessionID == "" || e.SessionID == f.SessionID) &&
+		(f.RequestID == "" || e.RequestID == f.RequestID)
+}
+
+// ringBuffer keeps the most recent log records.
+type ringBuffer struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+var ring = newRingBuffer(defaultRingSize)
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{entries: make([]Entry, size)}
+}
+
+func (b *ringBuffer) add(e Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) == 0 {
+		return
+	}
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+func (b *ringBuffer) resize(size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = make([]Entry, max(size, 0))
+	b.next = 0
+	b.full = false
+}
+
+// recent returns the last matching entries, oldest first.
+func (b *ringBuffer) recent(f Filter) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var matched []Entry
+	n := b.next
+	if b.full {
+		n = len(b.entries)
+	}
+	for i := range n {
+		e := b.entries[(b.next-1-i+len(b.entries))%len(b.entries)]
+		if !f.match(e) {
+			continue
+		}
+		matched = append(matched, e)
+		if f.Limit > 0 && len(matched) == f.Limit {
+			break
+		}
+	}
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched
+}
+
+// Recent returns the most recent log records of this process matching the
+// filter, oldest first.
+func Recent(f Filter) []Entry {
+	return ring.recent(f)
+}
@@ -0,0 +1,74 @@
+// Package mask hides known secret values, such as those of the secrets store,
+// in the logs and in the parameters of permission requests.
+package mask
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Placeholder replaces the masked values.
+const Placeholder = "[REDACTED]"
+
+// minLength keeps short values visible, masking them would hide common words.
+const minLength = 6
+
+var (
+	mu       sync.Mutex
+	values   = make(map[string]struct{})
+	replacer atomic.Pointer[strings.Replacer]
+)
+
+// Add registers secret values to mask from now on.
+func Add(secrets ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	added := false
+	for _, secret := range secrets {
+		if _, ok := values[secret]; ok || len(secret) < minLength {
+			continue
+		}
+		values[secret] = struct{}{}
+		added = true
+	}
+	if !added {
+		return
+	}
+
+	// The longest values first, so that a value containing another one is
+	// masked whole
+	sorted := slices.SortedFunc(maps.Keys(values), func(a, b string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, secret := range sorted {
+		pairs = append(pairs, secret, Placeholder)
+	}
+	replacer.Store(strings.NewReplacer(pairs...))
+}
+
+// Enabled reports whether any value is masked.
+func Enabled() bool {
+	return replacer.Load() != nil
+}
+
+// String returns s with the registered values masked.
+func String(s string) string {
+	r := replacer.Load()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// reset forgets the registered values, for tests.
+func reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	clear(values)
+	replacer.Store(nil)
+}
@@ -0,0 +1,21 @@
+package mask
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestString(t *testing.T) {
+	t.Cleanup(reset)
+
+	require.False(t, Enabled())
+	require.Equal(t, "key sk-123456", String("key sk-123456"))
+
+	Add("sk-123456", "short", "sk-123456-extended")
+	require.True(t, Enabled())
+	require.Equal(t, "key [REDACTED]", String("key sk-123456"))
+	require.Equal(t, "key [REDACTED] and [REDACTED]", String("key sk-123456-extended and sk-123456"))
+	// Values too short to be masked safely are ignored
+	require.Equal(t, "a short one", String("a short one"))
+}
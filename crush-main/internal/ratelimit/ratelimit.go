@@ -0,0 +1,149 @@
+// Package ratelimit limits the requests of users and sessions with token
+// buckets. The buckets live in a Store shared by the instances, typically
+// Redis, and in memory when there is none or it fails.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst
+// tokens. A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the limit applies.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0
+}
+
+// capacity returns the size of the bucket, at least one token.
+func (l Limit) capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return max(1, int(math.Ceil(l.Rate)))
+}
+
+// Store takes tokens from buckets. Take returns whether a token was taken
+// from the bucket of key and, when it was not, how long until one is.
+type Store interface {
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error)
+}
+
+// Limiter checks requests against the buckets of their keys, e.g. user or
+// session IDs. A nil Limiter allows everything.
+type Limiter struct {
+	store    Store
+	fallback *Memory
+	prefix   string
+	limit    Limit
+}
+
+// New returns a limiter applying limit to the keys under prefix. The buckets
+// are kept in store, or in memory when store is nil or fails. It returns nil
+// when limit is disabled.
+func New(store Store, prefix string, limit Limit) *Limiter {
+	if !limit.Enabled() {
+		return nil
+	}
+	return &Limiter{
+		store:    store,
+		fallback: NewMemory(),
+		prefix:   prefix,
+		limit:    limit,
+	}
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty it
+// returns false and how long to wait before retrying.
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	key = l.prefix + key
+	burst := l.limit.capacity()
+	if l.store != nil {
+		ok, retryAfter, err := l.store.Take(ctx, key, l.limit.Rate, burst)
+		if err == nil {
+			return ok, retryAfter
+		}
+		slog.Warn("Failed to take rate limit token, limiting in memory", "key", key, "error", err)
+	}
+	ok, retryAfter, _ := l.fallback.Take(ctx, key, l.limit.Rate, burst)
+	return ok, retryAfter
+}
+
+// maxMemoryBuckets is the number of buckets above which Memory forgets the
+// full ones.
+const maxMemoryBuckets = 10000
+
+// Memory is a Store keeping the buckets of this instance only.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rate    float64
+	burst   int
+}
+
+// refill adds the tokens earned since the last update.
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = min(float64(b.burst), b.tokens+elapsed*b.rate)
+	b.updated = now
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Take implements Store.
+func (m *Memory) Take(_ context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	b, ok := m.buckets[key]
+	if !ok {
+		if len(m.buckets) >= maxMemoryBuckets {
+			m.prune(now)
+		}
+		b = &bucket{tokens: float64(burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.rate, b.burst = rate, burst
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// prune forgets the buckets that are full again, they behave like new ones.
+func (m *Memory) prune(now time.Time) {
+	for key, b := range m.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.burst) {
+			delete(m.buckets, key)
+		}
+	}
+}
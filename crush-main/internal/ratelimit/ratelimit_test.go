@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTake(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for range 3 {
+		ok, _, err := m.Take(ctx, "user", 1, 3)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	ok, retryAfter, err := m.Take(ctx, "user", 1, 3)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, time.Second, retryAfter)
+
+	// Other keys have their own bucket
+	ok, _, _ = m.Take(ctx, "other", 1, 3)
+	require.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, retryAfter, _ = m.Take(ctx, "user", 1, 3)
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _, _ = m.Take(ctx, "user", 1, 3)
+	require.True(t, ok)
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, float64, int) (bool, time.Duration, error) {
+	return false, 0, errors.New("unavailable")
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	disabled := New(nil, "user:", Limit{})
+	require.Nil(t, disabled)
+	ok, _ := disabled.Allow(ctx, "u1")
+	require.True(t, ok)
+
+	// The memory fallback limits when the store fails
+	l := New(failingStore{}, "user:", Limit{Rate: 0.5})
+	ok, _ = l.Allow(ctx, "u1")
+	require.True(t, ok)
+	ok, retryAfter := l.Allow(ctx, "u1")
+	require.False(t, ok)
+	require.Greater(t, retryAfter, time.Duration(0))
+}
@@ -10,7 +10,9 @@ import (
 	"path/filepath"
 
 	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/rolling1314/rolling-crush/domain/secret"
 	"github.com/rolling1314/rolling-crush/infra/postgres"
+	"github.com/rolling1314/rolling-crush/internal/tracing"
 )
 
 // InitOptions contains options for initialization.
@@ -18,7 +20,9 @@ type InitOptions struct {
 	WorkingDir string
 	DataDir    string
 	Debug      bool
-	Yolo       bool // Skip permission requests
+	Yolo       bool   // Skip permission requests
+	Replica    bool   // Connect the read replica, if one is configured
+	Service    string // Service name of the trace spans, e.g. "crush-ws"
 }
 
 // InitResult contains the result of initialization.
@@ -27,6 +31,10 @@ type InitResult struct {
 	AppCfg   *config.AppConfig
 	DB       *sql.DB
 	Queries  *postgres.Queries
+	// ReplicaDB is the read replica, nil when none is configured or reachable
+	ReplicaDB *sql.DB
+	// Secrets is the encrypted secrets store, nil without a master key
+	Secrets secret.Service
 }
 
 // Initialize performs common initialization for both services.
@@ -59,6 +67,9 @@ func Initialize(ctx context.Context, opts InitOptions) (*InitResult, error) {
 			"sandbox_url", appCfg.Sandbox.BaseURL,
 			"storage_type", appCfg.Storage.Type,
 		)
+
+		// Keep secrets from external secrets managers fresh so rotations are picked up
+		config.StartSecretRotation(ctx, nil)
 	}
 
 	// Initialize crush config
@@ -66,6 +77,15 @@ func Initialize(ctx context.Context, opts InitOptions) (*InitResult, error) {
 	if err != nil {
 		return nil, err
 	}
+	if appCfg != nil {
+		if err := ConfigureLogging(appCfg.Logging, cfg.Options.Debug); err != nil {
+			return nil, err
+		}
+		// Set up before the connections are made, so that their operations are traced
+		if err := tracing.Setup(ctx, appCfg.Tracing, opts.Service); err != nil {
+			slog.Warn("Failed to set up tracing", "error", err)
+		}
+	}
 
 	// Set permission options
 	if cfg.Permissions == nil {
@@ -84,14 +104,51 @@ func Initialize(ctx context.Context, opts InitOptions) (*InitResult, error) {
 		return nil, err
 	}
 
+	// The replica only offloads reads, without it they stay on the primary
+	var replica *sql.DB
+	if opts.Replica {
+		replica, err = postgres.ConnectReplica(ctx)
+		if err != nil {
+			slog.Warn("Failed to connect to replica database, reading from the primary", "error", err)
+		}
+	}
+
+	queries := postgres.New(postgres.WithTracing(conn))
+	secrets, err := initSecrets(ctx, appCfg, queries)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	return &InitResult{
-		Config:  cfg,
-		AppCfg:  appCfg,
-		DB:      conn,
-		Queries: postgres.New(conn),
+		Config:    cfg,
+		AppCfg:    appCfg,
+		DB:        conn,
+		Queries:   queries,
+		ReplicaDB: replica,
+		Secrets:   secrets,
 	}, nil
 }
 
+// initSecrets opens the secrets store when a master key is configured. Its
+// secrets are resolved as "secret://NAME" config values, e.g. the API keys of
+// the providers, which are resolved again when the providers are built.
+func initSecrets(ctx context.Context, appCfg *config.AppConfig, q postgres.Querier) (secret.Service, error) {
+	if appCfg == nil || appCfg.Secrets.MasterKey == "" {
+		return nil, nil
+	}
+	secrets, err := secret.NewService(q, appCfg.Secrets.MasterKey)
+	if err != nil {
+		return nil, err
+	}
+	config.RegisterSecretProvider(secrets)
+	// Mask the stored values in the logs from the start
+	if err := secrets.LoadMask(ctx); err != nil {
+		slog.Error("Failed to load the stored secrets, is the master key right?", "error", err)
+	}
+	return secrets, nil
+}
+
 // ResolveCwd resolves the working directory.
 func ResolveCwd(cwd string) (string, error) {
 	if cwd != "" {
@@ -0,0 +1,37 @@
+package shared
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/log"
+	"github.com/rolling1314/rolling-crush/pkg/config"
+)
+
+// ConfigureLogging applies the logging settings of the app config to the
+// logger set up by config.Init. Without a level the logger keeps the level
+// of the debug flag.
+func ConfigureLogging(cfg config.LoggingConfig, debug bool) error {
+	spec := cfg.Level
+	if spec == "" && debug {
+		spec = "debug"
+	}
+	levels, err := log.ParseLevels(spec)
+	if err != nil {
+		return err
+	}
+	for module, name := range cfg.Modules {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return fmt.Errorf("invalid log level %q for module %s: %w", name, module, err)
+		}
+		levels.Modules[module] = level
+	}
+
+	log.SetLevels(levels)
+	log.SetStdout(cfg.Stdout)
+	if cfg.RingSize > 0 {
+		log.SetRingSize(cfg.RingSize)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Package tracing traces agent runs with OpenTelemetry: the runs, their
+// steps, provider calls and tool executions, down to the Redis and Postgres
+// operations they make. Spans are exported over OTLP/HTTP once Setup ran,
+// until then they are no-ops.
+package tracing
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/rolling1314/rolling-crush"
+
+var (
+	tracer   = otel.Tracer(instrumentationName)
+	enabled  atomic.Bool
+	provider atomic.Pointer[sdktrace.TracerProvider]
+)
+
+// Attribute keys shared by the spans.
+const (
+	SessionIDKey  = attribute.Key("session_id")
+	MessageIDKey  = attribute.Key("message_id")
+	ToolCallIDKey = attribute.Key("tool_call_id")
+)
+
+// Setup exports the spans of the service as configured. It does nothing
+// when tracing is disabled.
+func Setup(ctx context.Context, cfg config.TracingConfig, serviceName string) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cmp.Or(cfg.ServiceName, serviceName)),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create trace resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	provider.Store(tp)
+	enabled.Store(true)
+	return nil
+}
+
+// Shutdown flushes the spans not exported yet.
+func Shutdown(ctx context.Context) error {
+	tp := provider.Load()
+	if tp == nil {
+		return nil
+	}
+	return tp.Shutdown(ctx)
+}
+
+// Enabled reports whether spans are exported, instrumentation that costs
+// more than a no-op span is skipped otherwise.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Start starts a span as a child of the span of ctx, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends a span, marking it failed with err. Cancellations are not
+// failures.
+func End(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/pkg/config"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetupDisabled(t *testing.T) {
+	require.NoError(t, Setup(t.Context(), config.TracingConfig{}, "crush-test"))
+	require.False(t, Enabled())
+	require.NoError(t, Shutdown(t.Context()))
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	spanTracer := tp.Tracer("test")
+
+	_, failed := spanTracer.Start(t.Context(), "failed")
+	End(failed, errors.New("boom"))
+	_, cancelled := spanTracer.Start(t.Context(), "cancelled")
+	End(cancelled, context.Canceled)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, "boom", spans[0].Status().Description)
+	require.Equal(t, codes.Unset, spans[1].Status().Code, "cancellations are not failures")
+}
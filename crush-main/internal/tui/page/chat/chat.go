@@ -719,7 +719,7 @@ func (p *chatPage) cancel() tea.Cmd {
 	if p.isCanceling {
 		p.isCanceling = false
 		if p.app.AgentCoordinator != nil {
-			p.app.AgentCoordinator.Cancel(p.session.ID)
+			p.app.AgentCoordinator.Cancel(p.session.ID, message.CancelReasonUser)
 		}
 		return nil
 	}
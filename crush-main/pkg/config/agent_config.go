@@ -60,6 +60,10 @@ type SelectedModelType string
 const (
 	SelectedModelTypeLarge SelectedModelType = "large"
 	SelectedModelTypeSmall SelectedModelType = "small"
+	// SelectedModelTypeTitle generates session titles, falling back to the small model.
+	SelectedModelTypeTitle SelectedModelType = "title"
+	// SelectedModelTypeSummary summarizes long sessions, falling back to the small model.
+	SelectedModelTypeSummary SelectedModelType = "summary"
 )
 
 const (
@@ -91,6 +95,52 @@ type SelectedModel struct {
 
 	// Override provider specific options.
 	ProviderOptions map[string]any `json:"provider_options,omitempty" jsonschema:"description=Additional provider-specific options for the model"`
+
+	// What the model can take from the tools, for providers that choke on
+	// large tool lists or schemas.
+	Capabilities *ModelCapabilities `json:"capabilities,omitempty" jsonschema:"description=Limits on the tools sent to the model"`
+}
+
+// ReasoningEfforts are the reasoning effort levels of SelectedModel.
+var ReasoningEfforts = []string{"low", "medium", "high"}
+
+// ModelOverride changes the large model of a session for a single turn, e.g.
+// a retry with another model or temperature. Empty fields keep the settings
+// of the session.
+type ModelOverride struct {
+	Provider        string   `json:"provider,omitempty"`
+	Model           string   `json:"model,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"`
+}
+
+// Apply returns the model selected with the override. Another model starts
+// from its defaults, like one selected for the session.
+func (o ModelOverride) Apply(m SelectedModel) SelectedModel {
+	if o.Model != "" && (o.Model != m.Model || cmp.Or(o.Provider, m.Provider) != m.Provider) {
+		m = SelectedModel{Provider: cmp.Or(o.Provider, m.Provider), Model: o.Model}
+	}
+	if o.Temperature != nil {
+		temperature := *o.Temperature
+		m.Temperature = &temperature
+	}
+	if o.ReasoningEffort != "" {
+		m.ReasoningEffort = o.ReasoningEffort
+	}
+	return m
+}
+
+// ModelCapabilities are the limits of a model on the tools it is given. The
+// tool list is trimmed and adjusted to them before the model is called.
+type ModelCapabilities struct {
+	// The most tools sent to the model, the core tools are kept first.
+	MaxTools int `json:"max_tools,omitempty" jsonschema:"description=Maximum number of tools sent to the model (0 for no limit),minimum=0,example=32"`
+	// Whether the model may call several tools at once, nil leaves the
+	// provider default.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty" jsonschema:"description=Whether the model may call several tools in one step (unset leaves the provider default)"`
+	// Set when the provider validates tool schemas strictly and rejects the
+	// keywords outside of the basic subset, they are stripped.
+	StrictJSONSchema bool `json:"strict_json_schema,omitempty" jsonschema:"description=Strip the tool schemas down to type, description, properties, items, required and enum,default=false"`
 }
 
 type ProviderConfig struct {
@@ -101,7 +151,7 @@ type ProviderConfig struct {
 	// The provider's API endpoint.
 	BaseURL string `json:"base_url,omitempty" jsonschema:"description=Base URL for the provider's API,format=uri,example=https://api.openai.com/v1"`
 	// The provider type, e.g. "openai", "anthropic", etc. if empty it defaults to openai.
-	Type catwalk.Type `json:"type,omitempty" jsonschema:"description=Provider type that determines the API format,enum=openai,enum=openai-compat,enum=anthropic,enum=gemini,enum=azure,enum=vertexai,default=openai"`
+	Type catwalk.Type `json:"type,omitempty" jsonschema:"description=Provider type that determines the API format,enum=openai,enum=openai-compat,enum=anthropic,enum=gemini,enum=azure,enum=vertexai,enum=synthetic,enum=ollama,default=openai"`
 	// The provider's API key.
 	APIKey string `json:"api_key,omitempty" jsonschema:"description=API key for authentication with the provider,example=$OPENAI_API_KEY"`
 	// OAuthToken for providers that use OAuth2 authentication.
@@ -126,6 +176,11 @@ type ProviderConfig struct {
 	Models []catwalk.Model `json:"models,omitempty" jsonschema:"description=List of models available from this provider"`
 }
 
+// ProviderTypeSynthetic is a fake provider that streams generated tokens
+// without calling any API, used for load testing. It is configured through
+// provider_options and needs neither base_url nor api_key.
+const ProviderTypeSynthetic catwalk.Type = "synthetic"
+
 func (pc *ProviderConfig) SetupClaudeCode() {
 	pc.APIKey = fmt.Sprintf("Bearer %s", pc.OAuthToken.AccessToken)
 	pc.SystemPromptPrefix = "You are Claude Code, Anthropic's official CLI for Claude."
@@ -195,7 +250,22 @@ func (c Completions) Limits() (depth, items int) {
 
 type Permissions struct {
 	AllowedTools []string `json:"allowed_tools,omitempty" jsonschema:"description=List of tools that don't require permission prompts,example=bash,example=view"` // Tools that don't require permission prompts
-	SkipRequests bool     `json:"-"`                                                                                                                              // Automatically accept all permissions (YOLO mode)
+	// Rules is the permission policy evaluated for every project before the
+	// allowed tools, together with the rules of the project policy.
+	Rules        []PermissionRule `json:"rules,omitempty" jsonschema:"description=Policy rules deciding tool permission requests before the allowed tools"`
+	SkipRequests bool             `json:"-"` // Automatically accept all permissions (YOLO mode)
+}
+
+// PermissionRule is a permission policy rule, see permission.PolicyRule.
+type PermissionRule struct {
+	Effect string `json:"effect" jsonschema:"enum=allow,enum=deny,enum=ask"`
+	// Tool is a tool name and may contain wildcards.
+	Tool   string `json:"tool" jsonschema:"example=bash,example=mcp_github_*"`
+	Action string `json:"action,omitempty" jsonschema:"description=Action of the tool the rule applies to,example=execute"`
+	// Pattern is a command prefix, a host or a path glob, Regex a regular
+	// expression matching the same subjects.
+	Pattern string `json:"pattern,omitempty" jsonschema:"example=npm run test *,example=src/**"`
+	Regex   string `json:"regex,omitempty" jsonschema:"example=^go (build|test)( |$)"`
 }
 
 type TrailerStyle string
@@ -233,6 +303,95 @@ type Options struct {
 	Attribution               *Attribution `json:"attribution,omitempty" jsonschema:"description=Attribution settings for generated content"`
 	DisableMetrics            bool         `json:"disable_metrics,omitempty" jsonschema:"description=Disable sending metrics,default=false"`
 	InitializeAs              string       `json:"initialize_as,omitempty" jsonschema:"description=Name of the context file to create/update during project initialization,default=AGENTS.md,example=AGENTS.md,example=CRUSH.md,example=CLAUDE.md,example=docs/LLMs.md"`
+	PinnedContext             string       `json:"pinned_context,omitempty" jsonschema:"description=Context added to the system prompt of every turn of a session"`
+	// ToolResultCompaction elides old tool results before the conversation
+	// has to be summarized.
+	ToolResultCompaction *ToolResultCompaction `json:"tool_result_compaction,omitempty" jsonschema:"description=Compaction of old tool results as the context window fills up"`
+	// LoopGuard nudges and then stops the agent when it keeps repeating the
+	// same tool call.
+	LoopGuard *LoopGuard `json:"loop_guard,omitempty" jsonschema:"description=Detection of tool calls repeated with identical input"`
+	// Failover retries the large model on transient provider errors and falls
+	// back to other models when it keeps failing.
+	Failover *Failover `json:"failover,omitempty" jsonschema:"description=Retries of the large model and fallback models used when it fails"`
+	// AutoFix gives the agent the errors its edits introduced as follow-up
+	// prompts, usually set per session.
+	AutoFix *AutoFix `json:"auto_fix,omitempty" jsonschema:"description=Follow-up prompts fixing the LSP errors introduced by the edits of the agent"`
+	// BusyPolicy decides what happens to a prompt sent while the session
+	// runs another one, usually set per session.
+	BusyPolicy BusyPolicy `json:"busy_policy,omitempty" jsonschema:"description=What a prompt sent while the session is busy does,enum=queue,enum=reject,enum=interrupt,default=queue"`
+}
+
+// ToolResultCompaction replaces the output of old tool results with a short
+// synopsis once the context window is filled past Threshold. Zero values
+// select the defaults.
+type ToolResultCompaction struct {
+	Disabled   bool    `json:"disabled,omitempty" jsonschema:"description=Disable the compaction of old tool results,default=false"`
+	Threshold  float64 `json:"threshold,omitempty" jsonschema:"description=Fraction of the context window in use from which old tool results are compacted,default=0.5,minimum=0,maximum=1"`
+	KeepRecent int     `json:"keep_recent,omitempty" jsonschema:"description=Number of most recent tool results always kept in full,default=6"`
+	MinLength  int     `json:"min_length,omitempty" jsonschema:"description=Tool results shorter than this many characters are kept in full,default=1500"`
+}
+
+// LoopGuard counts the tool calls repeated with identical input among the
+// Window most recent ones of a turn. The model is reminded that it repeats
+// itself from NudgeAt repeats, and the turn is stopped with a loop_detected
+// finish at StopAt. Zero values select the defaults.
+type LoopGuard struct {
+	Disabled bool `json:"disabled,omitempty" jsonschema:"description=Disable the detection of repeated tool calls,default=false"`
+	Window   int  `json:"window,omitempty" jsonschema:"description=Number of most recent tool calls of the turn inspected,default=10,minimum=0"`
+	NudgeAt  int  `json:"nudge_at,omitempty" jsonschema:"description=Number of identical tool calls from which the model is told it repeats itself,default=3,minimum=0"`
+	StopAt   int  `json:"stop_at,omitempty" jsonschema:"description=Number of identical tool calls at which the turn is stopped,default=5,minimum=0"`
+}
+
+// Failover configures the retries of the large model on retryable provider
+// errors, such as rate limits and overloaded servers, and the models tried in
+// order once they are exhausted. Zero values select the defaults.
+type Failover struct {
+	Models         []SelectedModel `json:"models,omitempty" jsonschema:"description=Fallback models tried in order when the large model fails"`
+	MaxRetries     *int            `json:"max_retries,omitempty" jsonschema:"description=Retries of each model on retryable provider errors before failing over,default=2,minimum=0"`
+	InitialDelayMs int             `json:"initial_delay_ms,omitempty" jsonschema:"description=Delay before the first retry in milliseconds, doubled for each following retry,default=2000,minimum=0"`
+}
+
+// BusyPolicy decides what happens to a prompt sent while its session runs
+// another one.
+type BusyPolicy string
+
+const (
+	// BusyPolicyQueue runs the prompt once the running one is done.
+	BusyPolicyQueue BusyPolicy = "queue"
+	// BusyPolicyReject refuses the prompt with a busy error.
+	BusyPolicyReject BusyPolicy = "reject"
+	// BusyPolicyInterrupt cancels the running prompt and runs the new one
+	// in its place.
+	BusyPolicyInterrupt BusyPolicy = "interrupt"
+)
+
+// Valid reports whether p is a known policy, the empty one queues.
+func (p BusyPolicy) Valid() bool {
+	switch p {
+	case "", BusyPolicyQueue, BusyPolicyReject, BusyPolicyInterrupt:
+		return true
+	}
+	return false
+}
+
+// DefaultAutoFixIterations bounds the auto-fix prompts of a prompt when
+// AutoFix.MaxIterations is 0.
+const DefaultAutoFixIterations = 3
+
+// AutoFix configures the follow-up prompts sent to the agent, once its turn
+// is over, with the new LSP errors of the files it edited.
+type AutoFix struct {
+	Enabled       bool `json:"enabled,omitempty" jsonschema:"description=Send the new errors of the edited files as follow-up prompts,default=false"`
+	MaxIterations int  `json:"max_iterations,omitempty" jsonschema:"description=Follow-up prompts sent for a prompt at most,default=3,minimum=0"`
+}
+
+// Iterations returns the follow-up prompts allowed for a prompt, 0 when
+// auto-fix is disabled.
+func (a *AutoFix) Iterations() int {
+	if a == nil || !a.Enabled {
+		return 0
+	}
+	return cmp.Or(a.MaxIterations, DefaultAutoFixIterations)
 }
 
 type MCPs map[string]MCPConfig
@@ -286,7 +445,7 @@ func (m MCPConfig) ResolvedEnv() []string {
 }
 
 func (m MCPConfig) ResolvedHeaders() map[string]string {
-	resolver := NewShellVariableResolver(env.New())
+	resolver := NewSecretVariableResolver(NewShellVariableResolver(env.New()))
 	for e, v := range m.Headers {
 		var err error
 		m.Headers[e], err = resolver.ResolveValue(v)
@@ -319,10 +478,68 @@ type Agent struct {
 
 	// Overrides the context paths for this agent
 	ContextPaths []string `json:"context_paths,omitempty"`
+
+	// Instructions are added to the system prompt of the agent, e.g. to
+	// describe the role of a reviewer agent
+	Instructions string `json:"instructions,omitempty"`
 }
 
 type Tools struct {
 	Ls ToolLs `json:"ls,omitzero"`
+	// Limits of the tools by tool name, e.g. "bash".
+	Limits map[string]ToolLimit `json:"limits,omitempty" jsonschema:"description=Execution limits of the tools by tool name"`
+	// Cache of the results of the read-only tools, it needs Redis.
+	Cache ToolCache `json:"cache,omitzero" jsonschema:"description=Caching of the results of the grep, glob and view tools"`
+	// CodeSearch is the embeddings index of the code_search tool, it needs
+	// Postgres.
+	CodeSearch ToolCodeSearch `json:"code_search,omitzero" jsonschema:"description=Semantic code search over an embeddings index of the project workspace"`
+	// Memory is the project memory of the memory tool, it needs Postgres.
+	Memory ToolMemory `json:"memory,omitzero" jsonschema:"description=Durable notes of a project written and searched with the memory tool"`
+}
+
+// DefaultMemoryPromptEntries is the number of notes of the project memory
+// added to the system prompt when none is configured.
+const DefaultMemoryPromptEntries = 10
+
+// ToolMemory configures the project memory of the memory tool.
+type ToolMemory struct {
+	PromptEntries int `json:"prompt_entries,omitempty" jsonschema:"description=Notes of the project memory most relevant to the prompt added to the system prompt, -1 adds none,minimum=-1,default=10,example=5"`
+}
+
+// Entries returns the number of notes added to the system prompt.
+func (t ToolMemory) Entries() int {
+	switch {
+	case t.PromptEntries < 0:
+		return 0
+	case t.PromptEntries == 0:
+		return DefaultMemoryPromptEntries
+	}
+	return t.PromptEntries
+}
+
+// ToolCodeSearch configures the embeddings of the code_search tool, from an
+// OpenAI-compatible /embeddings endpoint such as OpenAI's or a local Ollama.
+type ToolCodeSearch struct {
+	Enabled bool   `json:"enabled,omitempty" jsonschema:"description=Index the project workspaces and give the agent the code_search tool,default=false"`
+	BaseURL string `json:"base_url,omitempty" jsonschema:"description=Base URL of the OpenAI-compatible embeddings API,default=https://api.openai.com/v1,example=http://localhost:11434/v1"`
+	APIKey  string `json:"api_key,omitempty" jsonschema:"description=API key of the embeddings API,example=$OPENAI_API_KEY"`
+	Model   string `json:"model,omitempty" jsonschema:"description=Embedding model,default=text-embedding-3-small,example=nomic-embed-text"`
+}
+
+// ToolCache caches the results of the grep, glob and view tools of a session
+// until a tool or the user changes its workspace.
+type ToolCache struct {
+	Enabled bool `json:"enabled,omitempty" jsonschema:"description=Serve repeated grep, glob and view calls from a cache shared through Redis,default=false"`
+	TTL     int  `json:"ttl,omitempty" jsonschema:"description=Seconds a cached result is kept,minimum=0,default=600,example=600"`
+}
+
+// ToolLimit bounds the calls of a tool, zero values leave them unbounded.
+type ToolLimit struct {
+	Timeout       int `json:"timeout,omitempty" jsonschema:"description=Seconds a call may run before it is stopped with a timeout result,minimum=0,example=600"`
+	MaxConcurrent int `json:"max_concurrent,omitempty" jsonschema:"description=Calls of the tool running at once in a session,minimum=0,example=2"`
+	// PermissionTimeout overrides the permission timeout of the project and
+	// the server for the tool, 0 keeps them.
+	PermissionTimeout int `json:"permission_timeout,omitempty" jsonschema:"description=Seconds a permission request of the tool waits for the user before the call is suspended,minimum=0,example=900"`
 }
 
 type ToolLs struct {
@@ -356,6 +573,9 @@ type Config struct {
 
 	Tools Tools `json:"tools,omitzero" jsonschema:"description=Tool configurations"`
 
+	// CustomAgents are additional named agents prompts can be routed to
+	CustomAgents map[string]Agent `json:"agents,omitempty" jsonschema:"description=Additional named agents prompts can be routed to,example={\"reviewer\":{\"description\":\"Reviews the changes\",\"allowed_tools\":[\"view\",\"grep\",\"bash\"],\"instructions\":\"Review the changes and report issues.\"}}"`
+
 	Agents map[string]Agent `json:"-"`
 
 	// Internal
@@ -631,20 +851,30 @@ func allToolNames() []string {
 		"bash",
 		"job_output",
 		"job_kill",
+		"git_status",
+		"git_diff",
+		"git_commit",
+		"git_branch",
+		"git_checkout",
 		"download",
 		"edit",
 		"multiedit",
+		"apply_patch",
 		"lsp_diagnostics",
 		"lsp_references",
+		"rename_symbol",
 		"fetch",
 		"agentic_fetch",
 		"glob",
 		"grep",
+		"lint",
 		"ls",
 		"sourcegraph",
+		"code_search",
 		"view",
 		"write",
 		"todos",
+		"memory",
 	}
 }
 
@@ -657,7 +887,7 @@ func resolveAllowedTools(allTools []string, disabledTools []string) []string {
 }
 
 func resolveReadOnlyTools(tools []string) []string {
-	readOnlyTools := []string{"glob", "grep", "ls", "sourcegraph", "view"}
+	readOnlyTools := []string{"glob", "grep", "ls", "sourcegraph", "code_search", "view"}
 	// filter to only include tools that are in allowedtools (include mode)
 	return filterSlice(tools, readOnlyTools, true)
 }
@@ -698,6 +928,26 @@ func (c *Config) SetupAgents() {
 			AllowedMCP: map[string][]string{},
 		},
 	}
+
+	for id, agent := range c.CustomAgents {
+		if _, builtin := agents[id]; builtin {
+			slog.Warn("Ignoring custom agent with the name of a built-in agent", "agent", id)
+			continue
+		}
+		agent.ID = id
+		agent.Name = cmp.Or(agent.Name, id)
+		agent.Model = cmp.Or(agent.Model, SelectedModelTypeLarge)
+		if agent.ContextPaths == nil {
+			agent.ContextPaths = c.Options.ContextPaths
+		}
+		if agent.AllowedTools == nil {
+			agent.AllowedTools = allowedTools
+		} else {
+			// Disabled tools stay disabled for every agent
+			agent.AllowedTools = filterSlice(allowedTools, agent.AllowedTools, true)
+		}
+		agents[id] = agent
+	}
 	c.Agents = agents
 }
 
@@ -733,6 +983,12 @@ func (c *ProviderConfig) TestConnection(resolver VariableResolver) error {
 		}
 		headers["x-api-key"] = apiKey
 		headers["anthropic-version"] = "2023-06-01"
+	case ProviderTypeOllama:
+		baseURL, _ := resolver.ResolveValue(c.BaseURL)
+		if baseURL == "" {
+			baseURL = DefaultOllamaBaseURL
+		}
+		testURL = strings.TrimSuffix(baseURL, "/") + "/models"
 	case catwalk.TypeGoogle:
 		baseURL, _ := resolver.ResolveValue(c.BaseURL)
 		if baseURL == "" {
@@ -772,7 +1028,7 @@ func (c *ProviderConfig) TestConnection(resolver VariableResolver) error {
 }
 
 func resolveEnvs(envs map[string]string) []string {
-	resolver := NewShellVariableResolver(env.New())
+	resolver := NewSecretVariableResolver(NewShellVariableResolver(env.New()))
 	for e, v := range envs {
 		var err error
 		envs[e], err = resolver.ResolveValue(v)
@@ -2,9 +2,12 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 
 	"gopkg.in/yaml.v3"
@@ -22,14 +25,155 @@ type AppConfig struct {
 	Email      EmailConfig      `yaml:"email"`
 	Cloudflare CloudflareConfig `yaml:"cloudflare"`
 	Agent      AgentConfig      `yaml:"agent"`
+	Secrets    SecretsConfig    `yaml:"secrets"`
+	Moderation ModerationConfig `yaml:"moderation"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Budgets    BudgetsConfig    `yaml:"budgets"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit"`
+	Analytics  AnalyticsConfig  `yaml:"analytics"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Retention  RetentionConfig  `yaml:"retention"`
+
+	PermissionParams PermissionParamsConfig `yaml:"permission_params"`
+}
+
+// PermissionParamsConfig holds the redaction of the parameters of permission
+// requests, e.g. the old and new contents of an edited file, before they are
+// sent to clients and kept in Redis. The full parameters are fetched on demand
+// through the HTTP API.
+type PermissionParamsConfig struct {
+	MaxBytes       int      `yaml:"max_bytes"`       // Bytes kept of each string parameter, 0 keeps them whole
+	MaskSecrets    bool     `yaml:"mask_secrets"`    // Mask API keys, tokens, private keys and secret assignments
+	SecretPatterns []string `yaml:"secret_patterns"` // Extra regular expressions of secrets to mask, only their first group when they have one
+}
+
+// TracingConfig holds the OpenTelemetry tracing of the agent runs, exported
+// over OTLP/HTTP. The standard OTEL_EXPORTER_OTLP_* variables apply too.
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Endpoint    string  `yaml:"endpoint"`     // Collector host and port, e.g. "localhost:4318" (default: OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318)
+	Insecure    bool    `yaml:"insecure"`     // Export over HTTP instead of HTTPS
+	SampleRatio float64 `yaml:"sample_ratio"` // Ratio of the traces kept, from 0 to 1 (default: 1)
+	ServiceName string  `yaml:"service_name"` // Service name of the spans (default: crush-http or crush-ws)
+}
+
+// RetentionConfig holds the retention of the sessions. Sessions inactive for
+// longer than the retention of their project are soft-deleted, hidden from
+// the users, then purged with their messages, Redis keys and attachments once
+// the grace period is over.
+type RetentionConfig struct {
+	SessionDays int `yaml:"session_days"` // Days of inactivity before a session is soft-deleted, 0 keeps them; projects can override it
+	GraceDays   int `yaml:"grace_days"`   // Days a soft-deleted session is kept before it is purged (default: 7)
+	Interval    int `yaml:"interval"`     // Seconds between runs of the janitor, 0 disables it (default: 3600)
+	BatchSize   int `yaml:"batch_size"`   // Sessions soft-deleted and purged per run (default: 500)
+}
+
+// AnalyticsConfig holds the settings of the usage analytics.
+type AnalyticsConfig struct {
+	RollupInterval int `yaml:"rollup_interval"` // Seconds between daily rollups of the usage, 0 disables (default: 600)
+}
+
+// RateLimitConfig holds the token bucket limits of the requests, shared by the
+// instances through Redis. Requests over a limit are rejected instead of
+// queued, a zero rate disables the limit.
+type RateLimitConfig struct {
+	HTTP    RateLimitRule `yaml:"http"`    // API requests per user, per client IP before login
+	User    RateLimitRule `yaml:"user"`    // Prompts sent over WebSocket per user
+	Session RateLimitRule `yaml:"session"` // Prompts sent over WebSocket per session
+}
+
+// RateLimitRule is a token bucket refilled with Rate tokens per second.
+type RateLimitRule struct {
+	Rate  float64 `yaml:"rate"`  // Requests allowed per second on average
+	Burst int     `yaml:"burst"` // Requests allowed at once (default: rate rounded up, at least 1)
+}
+
+// BudgetsConfig holds the default spending limits of the agent. Limits set
+// through the API for a session, project or user override them.
+type BudgetsConfig struct {
+	Session BudgetLimitConfig `yaml:"session"`
+	Project BudgetLimitConfig `yaml:"project"`
+	User    BudgetLimitConfig `yaml:"user"`
+}
+
+// BudgetLimitConfig bounds the cost and tokens of a scope, 0 means unlimited.
+type BudgetLimitConfig struct {
+	MaxCost   float64 `yaml:"max_cost"`   // Total cost in USD
+	MaxTokens int64   `yaml:"max_tokens"` // Total prompt and completion tokens
+}
+
+// LoggingConfig holds the structured logging settings.
+type LoggingConfig struct {
+	// Level is the default level, optionally followed by module levels,
+	// e.g. "info,internal/agent=debug" (default: info, debug in debug mode)
+	Level    string            `yaml:"level"`
+	Modules  map[string]string `yaml:"modules"`   // Levels of modules (package paths such as "infra/sandbox"), sub-packages included
+	Stdout   bool              `yaml:"stdout"`    // Also write logs to stdout
+	RingSize int               `yaml:"ring_size"` // Recent records kept for the debug endpoints (default: 2000)
+}
+
+// ModerationConfig holds the moderation of assistant text streamed to users.
+type ModerationConfig struct {
+	Enabled  bool               `yaml:"enabled"`
+	Policies []ModerationPolicy `yaml:"policies"`
+}
+
+// ModerationPolicy matches assistant text and acts on it. The built-in "pii"
+// and "credentials" policies come with patterns, other policies (e.g.
+// "prohibited") need their own.
+type ModerationPolicy struct {
+	Name     string   `yaml:"name"`
+	Action   string   `yaml:"action"`   // redact, halt or flag (default: flag)
+	Patterns []string `yaml:"patterns"` // Extra regular expressions matched against the text
+}
+
+// SecretsConfig holds external secrets manager settings.
+// Any secret-bearing config value can reference a secret instead of holding it,
+// e.g. "vault://secret/data/crush#db_password", "awssm://crush/prod#db_password"
+// or "gcpsm://db-password".
+type SecretsConfig struct {
+	RefreshInterval int                `yaml:"refresh_interval"` // Seconds between secret refreshes for rotation (default: 300, negative disables)
+	MasterKey       string             `yaml:"master_key"`       // Base64 AES-256 key of the built-in secrets store, referenced as "secret://NAME" (empty disables)
+	Vault           VaultSecretsConfig `yaml:"vault"`
+	AWS             AWSSecretsConfig   `yaml:"aws"`
+	GCP             GCPSecretsConfig   `yaml:"gcp"`
+}
+
+// VaultSecretsConfig holds HashiCorp Vault settings for vault:// references.
+type VaultSecretsConfig struct {
+	Address   string `yaml:"address"`   // Vault address, e.g. "https://vault.internal:8200" (empty disables)
+	Token     string `yaml:"token"`     // Vault token
+	Namespace string `yaml:"namespace"` // Vault Enterprise namespace (optional)
+}
+
+// AWSSecretsConfig holds AWS Secrets Manager settings for awssm:// references.
+// Credentials come from the default AWS credential chain.
+type AWSSecretsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Region  string `yaml:"region"` // AWS region (default: from the AWS environment)
+}
+
+// GCPSecretsConfig holds GCP Secret Manager settings for gcpsm:// references.
+// Credentials come from Application Default Credentials.
+type GCPSecretsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Project string `yaml:"project"` // Project used when a reference is a bare secret name
 }
 
 // AgentConfig holds Agent worker pool and timeout settings.
 type AgentConfig struct {
-	MaxWorkers        int `yaml:"max_workers"`        // Maximum number of concurrent agent workers (default: 100)
-	TaskQueueSize     int `yaml:"task_queue_size"`    // Task queue capacity (default: 1000)
-	PermissionTimeout int `yaml:"permission_timeout"` // Permission request timeout in seconds (default: 300 = 5 min)
-	TaskTimeout       int `yaml:"task_timeout"`       // Maximum task execution time in seconds (default: 1800 = 30 min)
+	MaxWorkers        int `yaml:"max_workers" json:"max_workers"`               // Maximum number of concurrent agent workers (default: 100)
+	TaskQueueSize     int `yaml:"task_queue_size" json:"task_queue_size"`       // Task queue capacity (default: 1000)
+	PermissionTimeout int `yaml:"permission_timeout" json:"permission_timeout"` // Permission request timeout in seconds (default: 300 = 5 min)
+	TaskTimeout       int `yaml:"task_timeout" json:"task_timeout"`             // Maximum task execution time in seconds (default: 1800 = 30 min)
+
+	PermissionBlockingAfter int `yaml:"permission_blocking_after" json:"permission_blocking_after"` // Seconds a permission request waits before it is escalated as blocking, 0 disables (default: 120)
+	StallTimeout            int `yaml:"stall_timeout" json:"stall_timeout"`                         // Seconds without stream events before a generation is cancelled as stalled, 0 disables (default: 300)
+
+	MaxBackgroundWorkers int `yaml:"max_background_workers" json:"max_background_workers"` // Maximum workers used by background tasks (default: max_workers / 2)
+	BackgroundQueueSize  int `yaml:"background_queue_size" json:"background_queue_size"`   // Background task queue capacity (default: task_queue_size)
+
+	OverflowQueueSize int `yaml:"overflow_queue_size" json:"overflow_queue_size"` // Prompts held with queue position updates once the task queue is full, 0 rejects them (default: 0)
 }
 
 // CloudflareConfig holds Cloudflare DNS settings.
@@ -52,15 +196,37 @@ type EmailConfig struct {
 
 // ServerConfig holds server settings.
 type ServerConfig struct {
-	HTTPPort string `yaml:"http_port"`
-	WSPort   string `yaml:"ws_port"`
-	Debug    bool   `yaml:"debug"`
+	HTTPPort  string `yaml:"http_port"`
+	WSPort    string `yaml:"ws_port"`
+	Debug     bool   `yaml:"debug"`
+	PublicURL string `yaml:"public_url"` // Web UI base URL used for links in notifications, e.g. "https://app.example.com"
+	// InstanceID identifies this WS server among the replicas sharing Redis.
+	// Defaults to the hostname with a random suffix.
+	InstanceID string `yaml:"instance_id"`
+	// Streaming deltas of a message are merged for this many ms before they
+	// are sent (default: 50, -1 sends every delta).
+	DeltaCoalesceInterval int `yaml:"delta_coalesce_interval"`
+	// Deltas of a message sent ahead of the last one a client acknowledged,
+	// the next ones are merged until it catches up (default: 64).
+	DeltaAckWindow int `yaml:"delta_ack_window"`
+	// Seconds a drain (SIGUSR1 or POST /admin/drain) waits for the running
+	// turns before the instance exits (default: 300).
+	DrainTimeout int `yaml:"drain_timeout"`
+	// Seconds between the pings of the WebSocket connections (default: 25,
+	// -1 disables the pings and the reaping of stale connections).
+	PingInterval int `yaml:"ping_interval"`
+	// Seconds a WebSocket connection may go without a pong or message before
+	// it is closed and its session marked disconnected (default: 60).
+	PongTimeout int `yaml:"pong_timeout"`
 }
 
 // AuthConfig holds authentication settings.
 type AuthConfig struct {
 	JWTSecret       string `yaml:"jwt_secret"`
 	TokenExpireHour int    `yaml:"token_expire_hour"`
+	// Admins are the user IDs or usernames of the operators of the instance,
+	// the only users allowed on the instance-wide admin endpoints.
+	Admins []string `yaml:"admins"`
 }
 
 // RedisConfig holds Redis connection settings.
@@ -72,8 +238,23 @@ type RedisConfig struct {
 	PoolSize     int    `yaml:"pool_size"`
 	StreamMaxLen int64  `yaml:"stream_max_len"` // Maximum length of each session's stream
 	StreamTTL    int    `yaml:"stream_ttl"`     // Stream expiration time in seconds
+	Namespace    string `yaml:"namespace"`      // Prefix of every key, e.g. "staging" when environments share a Redis
+	// Mode is standalone (default), sentinel or cluster
+	Mode string `yaml:"mode"`
+	// Addrs are the sentinels or the cluster seed nodes as host:port, host and
+	// port are used in standalone mode
+	Addrs            []string `yaml:"addrs"`
+	MasterName       string   `yaml:"master_name"`       // Name of the master monitored by the sentinels
+	SentinelPassword string   `yaml:"sentinel_password"` // Password of the sentinels, when they require one
 }
 
+// Redis deployment modes.
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
 // AutoModelConfig holds the default "Auto" model configuration.
 // When users select "Auto" model, this configuration is used.
 type AutoModelConfig struct {
@@ -85,28 +266,51 @@ type AutoModelConfig struct {
 
 // DatabaseConfig holds database connection settings.
 type DatabaseConfig struct {
-	Host         string `yaml:"host"`
-	Port         int    `yaml:"port"`
-	User         string `yaml:"user"`
-	Password     string `yaml:"password"`
-	Database     string `yaml:"database"`
-	SSLMode      string `yaml:"sslmode"`
-	MaxOpenConns int    `yaml:"max_open_conns"`
-	MaxIdleConns int    `yaml:"max_idle_conns"`
+	Host               string `yaml:"host"`
+	Port               int    `yaml:"port"`
+	User               string `yaml:"user"`
+	Password           string `yaml:"password"`
+	Database           string `yaml:"database"`
+	SSLMode            string `yaml:"sslmode"`
+	MaxOpenConns       int    `yaml:"max_open_conns"`
+	MaxIdleConns       int    `yaml:"max_idle_conns"`
+	WriteBatchInterval int    `yaml:"write_batch_interval"` // Flush interval in ms for batched message/tool call writes (default: 100, -1 disables batching)
+	ReplicaDSN         string `yaml:"replica_dsn"`          // Read-only DSN of a replica serving listings, analytics and exports, empty reads from the primary
 }
 
 // SandboxConfig holds sandbox service settings.
 type SandboxConfig struct {
-	BaseURL    string `yaml:"base_url"`
-	Timeout    int    `yaml:"timeout"`
-	ExternalIP string `yaml:"external_ip"` // External IP for project containers (used for iframe preview)
+	BaseURL    string `yaml:"base_url" json:"base_url"`
+	Timeout    int    `yaml:"timeout" json:"timeout"`
+	ExternalIP string `yaml:"external_ip" json:"external_ip"` // External IP for project containers (used for iframe preview)
+
+	ReconcileInterval int  `yaml:"reconcile_interval" json:"reconcile_interval"` // Seconds between matching sandbox containers against projects, 0 disables (default: 600)
+	OrphanAutoClean   bool `yaml:"orphan_auto_clean" json:"orphan_auto_clean"`   // Delete containers without a project once orphan_clean_after has passed (default: false)
+	OrphanCleanAfter  int  `yaml:"orphan_clean_after" json:"orphan_clean_after"` // Seconds a container stays orphaned before it is auto-cleaned (default: 86400 = 1 day)
+
+	FileWatchInterval int `yaml:"file_watch_interval" json:"file_watch_interval"` // Milliseconds between file snapshots of a project while an agent runs in it, 0 disables (default: 2000)
+
+	SnapshotBeforeRun bool `yaml:"snapshot_before_run" json:"snapshot_before_run"` // Archive the project workspace before each agent run, for rolling it back (default: false)
+	SnapshotMaxSize   int  `yaml:"snapshot_max_size" json:"snapshot_max_size"`     // Largest workspace archive in MB (default: 200)
+	SnapshotRetention int  `yaml:"snapshot_retention" json:"snapshot_retention"`   // Workspace snapshots kept per project, the oldest are deleted beyond it, 0 keeps all (default: 20)
+
+	CPULimit    float64 `yaml:"cpu_limit" json:"cpu_limit"`       // CPUs a project container may use when its project sets none, 0 means unlimited (default: 0)
+	MemoryLimit int     `yaml:"memory_limit" json:"memory_limit"` // Memory in MB a project container may use when its project sets none, 0 means unlimited (default: 0)
+	DiskLimit   int     `yaml:"disk_limit" json:"disk_limit"`     // Disk in MB a project workspace may use when its project sets none, 0 means unlimited (default: 0)
 }
 
 // StorageConfig holds object storage settings.
 type StorageConfig struct {
-	Type  string      `yaml:"type"` // "minio" or "oss"
-	MinIO MinIOConfig `yaml:"minio"`
-	OSS   OSSConfig   `yaml:"oss"`
+	Type    string        `yaml:"type"` // "minio" or "oss"
+	MinIO   MinIOConfig   `yaml:"minio"`
+	OSS     OSSConfig     `yaml:"oss"`
+	Uploads UploadsConfig `yaml:"uploads"`
+}
+
+// UploadsConfig holds the limits of resumable attachment uploads.
+type UploadsConfig struct {
+	MaxFileSizeMB int `yaml:"max_file_size_mb"` // Largest accepted file (default: 50)
+	UserQuotaMB   int `yaml:"user_quota_mb"`    // Total size of the uploads of a user (default: 1024)
 }
 
 // MinIOConfig holds MinIO-specific settings.
@@ -166,7 +370,24 @@ func LoadAppConfig(configPath string, env string) (*AppConfig, error) {
 	// Override with environment variables if they exist
 	overrideWithEnvApp(&config)
 
-	return &config, nil
+	if err := ValidateRedisNamespace(config.Redis.Namespace); err != nil {
+		return nil, err
+	}
+	if err := ValidateRedisMode(config.Redis); err != nil {
+		return nil, err
+	}
+
+	// Resolve secret references from external secrets managers
+	InitSecretProviders(config.Secrets)
+	resolved, err := resolveAppConfigSecrets(context.Background(), &config, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config secrets: %w", err)
+	}
+	secretRefreshMu.Lock()
+	rawAppConfig = &config
+	secretRefreshMu.Unlock()
+
+	return resolved, nil
 }
 
 // findConfigFile searches for config.yaml in common locations.
@@ -227,11 +448,70 @@ func overrideWithEnvApp(config *AppConfig) {
 	if v := os.Getenv("POSTGRES_SSLMODE"); v != "" {
 		config.Database.SSLMode = v
 	}
+	if v := os.Getenv("POSTGRES_WRITE_BATCH_INTERVAL"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Database.WriteBatchInterval)
+	}
+	if v := os.Getenv("POSTGRES_REPLICA_DSN"); v != "" {
+		config.Database.ReplicaDSN = v
+	}
+
+	// Server overrides
+	if v := os.Getenv("PUBLIC_URL"); v != "" {
+		config.Server.PublicURL = v
+	}
+	if v := os.Getenv("WS_INSTANCE_ID"); v != "" {
+		config.Server.InstanceID = v
+	}
+	if v := os.Getenv("WS_DELTA_COALESCE_INTERVAL"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Server.DeltaCoalesceInterval)
+	}
+	if v := os.Getenv("WS_DELTA_ACK_WINDOW"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Server.DeltaAckWindow)
+	}
+	if v := os.Getenv("WS_DRAIN_TIMEOUT"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Server.DrainTimeout)
+	}
+	if v := os.Getenv("WS_PING_INTERVAL"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Server.PingInterval)
+	}
+	if v := os.Getenv("WS_PONG_TIMEOUT"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Server.PongTimeout)
+	}
 
 	// Sandbox overrides
 	if v := os.Getenv("SANDBOX_BASE_URL"); v != "" {
 		config.Sandbox.BaseURL = v
 	}
+	if v := os.Getenv("SANDBOX_RECONCILE_INTERVAL"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Sandbox.ReconcileInterval)
+	}
+	if v := os.Getenv("SANDBOX_ORPHAN_AUTO_CLEAN"); v != "" {
+		config.Sandbox.OrphanAutoClean = v == "true" || v == "1"
+	}
+	if v := os.Getenv("SANDBOX_ORPHAN_CLEAN_AFTER"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Sandbox.OrphanCleanAfter)
+	}
+	if v := os.Getenv("SANDBOX_FILE_WATCH_INTERVAL"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Sandbox.FileWatchInterval)
+	}
+	if v := os.Getenv("SANDBOX_SNAPSHOT_BEFORE_RUN"); v != "" {
+		config.Sandbox.SnapshotBeforeRun = v == "true" || v == "1"
+	}
+	if v := os.Getenv("SANDBOX_SNAPSHOT_MAX_SIZE"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Sandbox.SnapshotMaxSize)
+	}
+	if v := os.Getenv("SANDBOX_SNAPSHOT_RETENTION"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Sandbox.SnapshotRetention)
+	}
+	if v := os.Getenv("SANDBOX_CPU_LIMIT"); v != "" {
+		fmt.Sscanf(v, "%g", &config.Sandbox.CPULimit)
+	}
+	if v := os.Getenv("SANDBOX_MEMORY_LIMIT"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Sandbox.MemoryLimit)
+	}
+	if v := os.Getenv("SANDBOX_DISK_LIMIT"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Sandbox.DiskLimit)
+	}
 
 	// Storage overrides (MinIO)
 	if v := os.Getenv("MINIO_ENDPOINT"); v != "" {
@@ -277,6 +557,21 @@ func overrideWithEnvApp(config *AppConfig) {
 	if v := os.Getenv("REDIS_DB"); v != "" {
 		fmt.Sscanf(v, "%d", &config.Redis.DB)
 	}
+	if v := os.Getenv("REDIS_NAMESPACE"); v != "" {
+		config.Redis.Namespace = v
+	}
+	if v := os.Getenv("REDIS_MODE"); v != "" {
+		config.Redis.Mode = v
+	}
+	if v := os.Getenv("REDIS_ADDRS"); v != "" {
+		config.Redis.Addrs = strings.Split(v, ",")
+	}
+	if v := os.Getenv("REDIS_MASTER_NAME"); v != "" {
+		config.Redis.MasterName = v
+	}
+	if v := os.Getenv("REDIS_SENTINEL_PASSWORD"); v != "" {
+		config.Redis.SentinelPassword = v
+	}
 
 	// Cloudflare overrides
 	if v := os.Getenv("CLOUDFLARE_API_TOKEN"); v != "" {
@@ -299,6 +594,83 @@ func overrideWithEnvApp(config *AppConfig) {
 	if v := os.Getenv("AGENT_TASK_TIMEOUT"); v != "" {
 		fmt.Sscanf(v, "%d", &config.Agent.TaskTimeout)
 	}
+	if v := os.Getenv("AGENT_PERMISSION_BLOCKING_AFTER"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Agent.PermissionBlockingAfter)
+	}
+	if v := os.Getenv("AGENT_STALL_TIMEOUT"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Agent.StallTimeout)
+	}
+	if v := os.Getenv("AGENT_MAX_BACKGROUND_WORKERS"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Agent.MaxBackgroundWorkers)
+	}
+	if v := os.Getenv("AGENT_BACKGROUND_QUEUE_SIZE"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Agent.BackgroundQueueSize)
+	}
+	if v := os.Getenv("AGENT_OVERFLOW_QUEUE_SIZE"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Agent.OverflowQueueSize)
+	}
+
+	// Permission request parameter overrides
+	if v := os.Getenv("PERMISSION_PARAMS_MAX_BYTES"); v != "" {
+		fmt.Sscanf(v, "%d", &config.PermissionParams.MaxBytes)
+	}
+	if v := os.Getenv("PERMISSION_PARAMS_MASK_SECRETS"); v != "" {
+		config.PermissionParams.MaskSecrets = v == "true" || v == "1"
+	}
+
+	// Analytics overrides
+	if v := os.Getenv("ANALYTICS_ROLLUP_INTERVAL"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Analytics.RollupInterval)
+	}
+
+	// Retention overrides
+	if v := os.Getenv("RETENTION_SESSION_DAYS"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Retention.SessionDays)
+	}
+	if v := os.Getenv("RETENTION_GRACE_DAYS"); v != "" {
+		fmt.Sscanf(v, "%d", &config.Retention.GraceDays)
+	}
+
+	// Tracing overrides
+	if v := os.Getenv("TRACING_ENABLED"); v != "" {
+		config.Tracing.Enabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv("TRACING_ENDPOINT"); v != "" {
+		config.Tracing.Endpoint = v
+	}
+	if v := os.Getenv("TRACING_SAMPLE_RATIO"); v != "" {
+		fmt.Sscanf(v, "%g", &config.Tracing.SampleRatio)
+	}
+
+	// Logging overrides
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		config.Logging.Level = v
+	}
+	if v := os.Getenv("LOG_STDOUT"); v != "" {
+		config.Logging.Stdout = v == "true" || v == "1"
+	}
+
+	// Secrets manager overrides
+	if v := os.Getenv("SECRETS_MASTER_KEY"); v != "" {
+		config.Secrets.MasterKey = v
+	}
+	if v := os.Getenv("VAULT_ADDR"); v != "" {
+		config.Secrets.Vault.Address = v
+	}
+	if v := os.Getenv("VAULT_TOKEN"); v != "" {
+		config.Secrets.Vault.Token = v
+	}
+	if v := os.Getenv("VAULT_NAMESPACE"); v != "" {
+		config.Secrets.Vault.Namespace = v
+	}
+	if v := os.Getenv("SECRETS_AWS_REGION"); v != "" {
+		config.Secrets.AWS.Enabled = true
+		config.Secrets.AWS.Region = v
+	}
+	if v := os.Getenv("SECRETS_GCP_PROJECT"); v != "" {
+		config.Secrets.GCP.Enabled = true
+		config.Secrets.GCP.Project = v
+	}
 }
 
 // GetGlobalAppConfig returns the global application configuration instance.
@@ -330,23 +702,29 @@ func SetGlobalAppConfig(config *AppConfig) {
 func getDefaultAppConfig() *AppConfig {
 	return &AppConfig{
 		Server: ServerConfig{
-			HTTPPort: "8001",
-			WSPort:   "8002",
-			Debug:    false,
+			HTTPPort:              "8001",
+			WSPort:                "8002",
+			Debug:                 false,
+			DeltaCoalesceInterval: 50,
+			DeltaAckWindow:        64,
+			DrainTimeout:          300,
+			PingInterval:          25,
+			PongTimeout:           60,
 		},
 		Auth: AuthConfig{
 			JWTSecret:       "crush-dev-jwt-secret-change-in-production-2024",
 			TokenExpireHour: 24,
 		},
 		Database: DatabaseConfig{
-			Host:         "localhost",
-			Port:         5432,
-			User:         "crush",
-			Password:     "123456",
-			Database:     "crush",
-			SSLMode:      "disable",
-			MaxOpenConns: 25,
-			MaxIdleConns: 5,
+			Host:               "localhost",
+			Port:               5432,
+			User:               "crush",
+			Password:           "123456",
+			Database:           "crush",
+			SSLMode:            "disable",
+			MaxOpenConns:       25,
+			MaxIdleConns:       5,
+			WriteBatchInterval: 100, // flush batched writes every 100ms
 		},
 		Redis: RedisConfig{
 			Host:         "localhost",
@@ -361,6 +739,12 @@ func getDefaultAppConfig() *AppConfig {
 			BaseURL:    "http://localhost:8888",
 			Timeout:    300,
 			ExternalIP: "localhost",
+
+			ReconcileInterval: 600,   // 10 minutes
+			OrphanCleanAfter:  86400, // 1 day
+			FileWatchInterval: 2000,  // 2 seconds
+			SnapshotMaxSize:   200,   // MB
+			SnapshotRetention: 20,
 		},
 		Storage: StorageConfig{
 			Type: "minio",
@@ -391,6 +775,27 @@ func getDefaultAppConfig() *AppConfig {
 			TaskQueueSize:     1000, // 1000 tasks in queue
 			PermissionTimeout: 300,  // 5 minutes
 			TaskTimeout:       1800, // 30 minutes
+
+			PermissionBlockingAfter: 120, // 2 minutes
+			StallTimeout:            300, // 5 minutes
+
+			MaxBackgroundWorkers: 50,   // half of the workers
+			BackgroundQueueSize:  1000, // 1000 background tasks in queue
+		},
+		Analytics: AnalyticsConfig{
+			RollupInterval: 600, // 10 minutes
+		},
+		Retention: RetentionConfig{
+			GraceDays: 7,
+			Interval:  3600, // 1 hour
+			BatchSize: 500,
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+		PermissionParams: PermissionParamsConfig{
+			MaxBytes:    16384, // 16 KiB per parameter
+			MaskSecrets: true,
 		},
 	}
 }
@@ -402,3 +807,40 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+var redisNamespacePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// ValidateRedisNamespace checks the Redis key namespace, which may be empty to
+// keep the keys unprefixed. Deployments sharing a Redis must use different ones.
+func ValidateRedisNamespace(namespace string) error {
+	if namespace != "" && !redisNamespacePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid redis namespace %q: use up to 64 letters, digits, '_', '.' or '-'", namespace)
+	}
+	return nil
+}
+
+// ValidateRedisMode checks the settings of the Redis deployment mode.
+func ValidateRedisMode(cfg RedisConfig) error {
+	switch cfg.Mode {
+	case "", RedisModeStandalone:
+		return nil
+	case RedisModeSentinel:
+		if cfg.MasterName == "" {
+			return fmt.Errorf("redis sentinel mode requires master_name")
+		}
+		if len(cfg.Addrs) == 0 {
+			return fmt.Errorf("redis sentinel mode requires the sentinel addrs")
+		}
+		return nil
+	case RedisModeCluster:
+		if len(cfg.Addrs) == 0 {
+			return fmt.Errorf("redis cluster mode requires the seed node addrs")
+		}
+		if cfg.DB != 0 {
+			return fmt.Errorf("redis cluster mode only supports db 0")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid redis mode %q: use standalone, sentinel or cluster", cfg.Mode)
+	}
+}
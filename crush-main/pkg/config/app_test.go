@@ -0,0 +1,36 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRedisNamespace(t *testing.T) {
+	for _, ns := range []string{"", "staging", "prod-eu.1", "team_a"} {
+		require.NoError(t, ValidateRedisNamespace(ns), ns)
+	}
+	for _, ns := range []string{"staging:", "-prod", "with space", "crush:*"} {
+		require.Error(t, ValidateRedisNamespace(ns), ns)
+	}
+}
+
+func TestValidateRedisMode(t *testing.T) {
+	for _, cfg := range []RedisConfig{
+		{},
+		{Mode: RedisModeStandalone, DB: 2},
+		{Mode: RedisModeSentinel, MasterName: "mymaster", Addrs: []string{"s1:26379"}},
+		{Mode: RedisModeCluster, Addrs: []string{"n1:6379", "n2:6379"}},
+	} {
+		require.NoError(t, ValidateRedisMode(cfg), cfg.Mode)
+	}
+	for _, cfg := range []RedisConfig{
+		{Mode: "replica"},
+		{Mode: RedisModeSentinel, Addrs: []string{"s1:26379"}},
+		{Mode: RedisModeSentinel, MasterName: "mymaster"},
+		{Mode: RedisModeCluster},
+		{Mode: RedisModeCluster, Addrs: []string{"n1:6379"}, DB: 1},
+	} {
+		require.Error(t, ValidateRedisMode(cfg), cfg.Mode)
+	}
+}
@@ -0,0 +1,488 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// BundleVersion is the version of the config bundle format.
+	BundleVersion = 1
+	// RedactedValue replaces secrets in exported configuration. Importing it
+	// keeps the secret already configured in the target deployment.
+	RedactedValue = "[REDACTED]"
+)
+
+// ConfigBundle is the part of the configuration promoted between deployments,
+// e.g. from staging to production. Sections left out of a bundle are not
+// changed on import. Providers and models are merged by key, the other
+// sections are replaced as a whole.
+type ConfigBundle struct {
+	Version     int                                 `json:"version"`
+	Providers   map[string]ProviderConfig           `json:"providers,omitempty"`
+	Models      map[SelectedModelType]SelectedModel `json:"models,omitempty"`
+	Permissions *Permissions                        `json:"permissions,omitempty"`
+	Agent       *AgentConfig                        `json:"agent,omitempty"`
+	Sandbox     *SandboxConfig                      `json:"sandbox,omitempty"`
+}
+
+// ConfigExport is the effective configuration of a deployment with its
+// secrets redacted.
+type ConfigExport struct {
+	// App is the application config as found in config.yaml.
+	App    map[string]any `json:"app"`
+	Bundle ConfigBundle   `json:"bundle"`
+}
+
+// ConfigChange is a value changed by importing a bundle. Secrets are redacted.
+type ConfigChange struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // add, update or remove
+	Old    any    `json:"old,omitempty"`
+	New    any    `json:"new,omitempty"`
+}
+
+// ExportConfig returns the effective configuration of c and appCfg with
+// secrets redacted. Secret references and environment variables are kept as
+// they resolve to the secret in each deployment.
+func ExportConfig(c *Config, appCfg *AppConfig) (ConfigExport, error) {
+	app, err := sanitizedAppConfig(appCfg)
+	if err != nil {
+		return ConfigExport{}, err
+	}
+	return ConfigExport{App: app, Bundle: sanitizeBundle(c.bundle(appCfg))}, nil
+}
+
+// exportedAppConfig returns the app config to export: the loaded config with
+// its secret references when there is one, the effective config otherwise.
+func exportedAppConfig(effective *AppConfig) AppConfig {
+	secretRefreshMu.RLock()
+	raw := rawAppConfig
+	secretRefreshMu.RUnlock()
+	if raw == nil {
+		return *effective
+	}
+	cfg := *raw
+	// Sections changed at runtime by an import are only in the effective config
+	cfg.Agent = effective.Agent
+	cfg.Sandbox = effective.Sandbox
+	return cfg
+}
+
+func sanitizedAppConfig(appCfg *AppConfig) (map[string]any, error) {
+	cfg := exportedAppConfig(appCfg)
+	for _, field := range appConfigSecretFields(&cfg) {
+		*field = redactSecret(*field)
+	}
+	cfg.Secrets.Vault.Token = redactSecret(cfg.Secrets.Vault.Token)
+
+	// Round trip through YAML so the keys match config.yaml
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode app config: %w", err)
+	}
+	var app map[string]any
+	if err := yaml.Unmarshal(data, &app); err != nil {
+		return nil, fmt.Errorf("failed to decode app config: %w", err)
+	}
+	return app, nil
+}
+
+// bundle returns the bundled sections of the current configuration.
+func (c *Config) bundle(appCfg *AppConfig) ConfigBundle {
+	b := ConfigBundle{
+		Version:   BundleVersion,
+		Providers: make(map[string]ProviderConfig),
+		Models:    make(map[SelectedModelType]SelectedModel),
+	}
+	if c.Providers != nil {
+		for id, p := range c.Providers.Seq2() {
+			b.Providers[id] = p
+		}
+	}
+	for t, m := range c.Models {
+		b.Models[t] = m
+	}
+	permissions := Permissions{}
+	if c.Permissions != nil {
+		permissions.AllowedTools = slices.Clone(c.Permissions.AllowedTools)
+		permissions.Rules = slices.Clone(c.Permissions.Rules)
+	}
+	b.Permissions = &permissions
+	if appCfg != nil {
+		agent, sandbox := appCfg.Agent, appCfg.Sandbox
+		b.Agent, b.Sandbox = &agent, &sandbox
+	}
+	return b
+}
+
+// sanitizeBundle returns a copy of b with the secrets of its providers redacted.
+func sanitizeBundle(b ConfigBundle) ConfigBundle {
+	providers := make(map[string]ProviderConfig, len(b.Providers))
+	for id, p := range b.Providers {
+		p.APIKey = redactSecret(p.APIKey)
+		p.OAuthToken = nil
+		if len(p.ExtraHeaders) > 0 {
+			headers := make(map[string]string, len(p.ExtraHeaders))
+			for name, value := range p.ExtraHeaders {
+				if isSecretHeader(name) {
+					value = redactSecret(value)
+				}
+				headers[name] = value
+			}
+			p.ExtraHeaders = headers
+		}
+		providers[id] = p
+	}
+	b.Providers = providers
+	return b
+}
+
+// redactSecret redacts a secret value unless it references the secret.
+func redactSecret(value string) string {
+	if value == "" || IsSecretRef(value) || strings.HasPrefix(value, "$") {
+		return value
+	}
+	return RedactedValue
+}
+
+func isSecretHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"authorization", "key", "token", "secret", "cookie"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrepareBundle validates b against the configuration of c and returns the
+// bundle to apply, with redacted secrets replaced by the ones already
+// configured.
+func (c *Config) PrepareBundle(b ConfigBundle) (ConfigBundle, error) {
+	if b.Version != BundleVersion {
+		return b, fmt.Errorf("unsupported bundle version %d, expected %d", b.Version, BundleVersion)
+	}
+
+	var errs []string
+	providers := make(map[string]ProviderConfig, len(b.Providers))
+	for id, p := range b.Providers {
+		current, exists := ProviderConfig{}, false
+		if c.Providers != nil {
+			current, exists = c.Providers.Get(id)
+		}
+		p, err := c.prepareProvider(id, p, current, exists)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		providers[id] = p
+	}
+	b.Providers = providers
+
+	for t, m := range b.Models {
+		if !slices.Contains(bundleModelTypes, t) {
+			errs = append(errs, fmt.Sprintf("models: unknown model type %q", t))
+			continue
+		}
+		if m.Model == "" || m.Provider == "" {
+			errs = append(errs, fmt.Sprintf("models.%s: model and provider are required", t))
+			continue
+		}
+		if _, ok := b.Providers[m.Provider]; ok {
+			continue
+		}
+		if c.Providers != nil {
+			if _, ok := c.Providers.Get(m.Provider); ok {
+				continue
+			}
+		}
+		errs = append(errs, fmt.Sprintf("models.%s: provider %q is not configured", t, m.Provider))
+	}
+
+	if b.Permissions != nil {
+		for _, tool := range b.Permissions.AllowedTools {
+			if strings.TrimSpace(tool) == "" {
+				errs = append(errs, "permissions.allowed_tools: tool names cannot be empty")
+				break
+			}
+		}
+		for i, rule := range b.Permissions.Rules {
+			if rule.Effect != "allow" && rule.Effect != "deny" && rule.Effect != "ask" {
+				errs = append(errs, fmt.Sprintf("permissions.rules[%d]: invalid effect %q", i, rule.Effect))
+			}
+			if rule.Tool == "" {
+				errs = append(errs, fmt.Sprintf("permissions.rules[%d]: tool is required", i))
+			}
+		}
+	}
+
+	if a := b.Agent; a != nil {
+		if a.MaxWorkers < 0 || a.TaskQueueSize < 0 || a.PermissionTimeout < 0 || a.TaskTimeout < 0 ||
+			a.PermissionBlockingAfter < 0 || a.StallTimeout < 0 || a.MaxBackgroundWorkers < 0 || a.BackgroundQueueSize < 0 || a.OverflowQueueSize < 0 {
+			errs = append(errs, "agent: values cannot be negative")
+		}
+	}
+
+	if sb := b.Sandbox; sb != nil {
+		if sb.BaseURL != "" {
+			if err := validateHTTPURL(sb.BaseURL); err != nil {
+				errs = append(errs, fmt.Sprintf("sandbox.base_url: %s", err))
+			}
+		}
+		if sb.Timeout < 0 {
+			errs = append(errs, "sandbox.timeout: cannot be negative")
+		}
+		if sb.ReconcileInterval < 0 || sb.OrphanCleanAfter < 0 {
+			errs = append(errs, "sandbox: reconcile values cannot be negative")
+		}
+		if sb.CPULimit < 0 || sb.MemoryLimit < 0 || sb.DiskLimit < 0 {
+			errs = append(errs, "sandbox: resource limits cannot be negative")
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return b, fmt.Errorf("invalid config bundle: %s", strings.Join(errs, "; "))
+	}
+	return b, nil
+}
+
+var bundleModelTypes = []SelectedModelType{
+	SelectedModelTypeLarge,
+	SelectedModelTypeSmall,
+	SelectedModelTypeTitle,
+	SelectedModelTypeSummary,
+}
+
+func (c *Config) prepareProvider(id string, p, current ProviderConfig, exists bool) (ProviderConfig, error) {
+	if id == "" {
+		return p, fmt.Errorf("providers: provider id cannot be empty")
+	}
+	if p.ID == "" {
+		p.ID = id
+	} else if p.ID != id {
+		return p, fmt.Errorf("providers.%s: id %q does not match its key", id, p.ID)
+	}
+	if p.Name == "" {
+		p.Name = id
+	}
+	if p.Type == "" {
+		p.Type = catwalk.TypeOpenAICompat
+	}
+	if !slices.Contains(catwalk.KnownProviderTypes(), p.Type) && p.Type != ProviderTypeSynthetic && p.Type != ProviderTypeOllama {
+		return p, fmt.Errorf("providers.%s: unsupported provider type %q", id, p.Type)
+	}
+	if p.BaseURL != "" && !strings.HasPrefix(p.BaseURL, "$") {
+		if err := validateHTTPURL(p.BaseURL); err != nil {
+			return p, fmt.Errorf("providers.%s.base_url: %s", id, err)
+		}
+	}
+
+	switch {
+	case p.APIKey == RedactedValue:
+		if !exists {
+			return p, fmt.Errorf("providers.%s.api_key: redacted, but the provider is not configured here", id)
+		}
+		p.APIKey = current.APIKey
+		p.OAuthToken = current.OAuthToken
+	case p.APIKey != "" && c.resolver != nil:
+		if _, err := c.resolver.ResolveValue(p.APIKey); err != nil {
+			return p, fmt.Errorf("providers.%s.api_key: %s", id, err)
+		}
+	}
+
+	for name, value := range p.ExtraHeaders {
+		if value != RedactedValue {
+			continue
+		}
+		currentValue, ok := current.ExtraHeaders[name]
+		if !ok {
+			return p, fmt.Errorf("providers.%s.extra_headers.%s: redacted, but not configured here", id, name)
+		}
+		p.ExtraHeaders[name] = currentValue
+	}
+	if p.ExtraHeaders == nil {
+		p.ExtraHeaders = make(map[string]string)
+	}
+	if p.ExtraParams == nil {
+		p.ExtraParams = make(map[string]string)
+	}
+	return p, nil
+}
+
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", raw)
+	}
+	return nil
+}
+
+// DiffBundle returns the changes importing a bundle prepared by PrepareBundle
+// makes to the configuration of c and appCfg.
+func (c *Config) DiffBundle(appCfg *AppConfig, b ConfigBundle) ([]ConfigChange, error) {
+	current := c.bundle(appCfg)
+
+	// Only compare what the bundle sets
+	before := ConfigBundle{Providers: map[string]ProviderConfig{}, Models: map[SelectedModelType]SelectedModel{}}
+	for id := range b.Providers {
+		if p, ok := current.Providers[id]; ok {
+			before.Providers[id] = p
+		}
+	}
+	for t := range b.Models {
+		if m, ok := current.Models[t]; ok {
+			before.Models[t] = m
+		}
+	}
+	if b.Permissions != nil {
+		before.Permissions = current.Permissions
+	}
+	if b.Agent != nil {
+		before.Agent = current.Agent
+	}
+	if b.Sandbox != nil {
+		before.Sandbox = current.Sandbox
+	}
+	b.Version = 0
+
+	oldValues, err := flattenJSON(before)
+	if err != nil {
+		return nil, err
+	}
+	newValues, err := flattenJSON(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ConfigChange
+	for path, newValue := range newValues {
+		oldValue, ok := oldValues[path]
+		switch {
+		case !ok:
+			changes = append(changes, ConfigChange{Path: path, Action: "add", New: newValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			changes = append(changes, ConfigChange{Path: path, Action: "update", Old: oldValue, New: newValue})
+		}
+	}
+	for path, oldValue := range oldValues {
+		if _, ok := newValues[path]; !ok {
+			changes = append(changes, ConfigChange{Path: path, Action: "remove", Old: oldValue})
+		}
+	}
+	for i, change := range changes {
+		if isSecretPath(change.Path) {
+			changes[i].Old = redactChangeValue(change.Old)
+			changes[i].New = redactChangeValue(change.New)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// flattenJSON flattens the JSON encoding of v into dotted paths to its leaf
+// values. Arrays are leaves.
+func flattenJSON(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	values := make(map[string]any)
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			if prefix != "" {
+				values[prefix] = v
+			}
+			return
+		}
+		for key, child := range obj {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			walk(path, child)
+		}
+	}
+	walk("", root)
+	return values, nil
+}
+
+func isSecretPath(path string) bool {
+	parts := strings.Split(path, ".")
+	if len(parts) < 3 || parts[0] != "providers" {
+		return false
+	}
+	switch {
+	case parts[2] == "api_key" || parts[2] == "oauth":
+		return true
+	case parts[2] == "extra_headers" && len(parts) > 3:
+		return isSecretHeader(parts[3])
+	}
+	return false
+}
+
+func redactChangeValue(v any) any {
+	if s, ok := v.(string); ok {
+		return redactSecret(s)
+	}
+	if v == nil {
+		return nil
+	}
+	return RedactedValue
+}
+
+// ApplyBundle applies a bundle prepared by PrepareBundle to the running
+// configuration. The config files of the deployment are left unchanged.
+func (c *Config) ApplyBundle(b ConfigBundle) {
+	if c.Providers != nil {
+		for id, p := range b.Providers {
+			c.Providers.Set(id, p)
+		}
+	}
+	if len(b.Models) > 0 && c.Models == nil {
+		c.Models = make(map[SelectedModelType]SelectedModel)
+	}
+	for t, m := range b.Models {
+		c.Models[t] = m
+	}
+	if b.Permissions != nil {
+		permissions := Permissions{
+			AllowedTools: slices.Clone(b.Permissions.AllowedTools),
+			Rules:        slices.Clone(b.Permissions.Rules),
+		}
+		if c.Permissions != nil {
+			permissions.SkipRequests = c.Permissions.SkipRequests
+		}
+		c.Permissions = &permissions
+	}
+
+	if b.Agent == nil && b.Sandbox == nil {
+		return
+	}
+	appCfg := *GetGlobalAppConfig()
+	if b.Agent != nil {
+		appCfg.Agent = *b.Agent
+	}
+	if b.Sandbox != nil {
+		appCfg.Sandbox = *b.Sandbox
+	}
+	SetGlobalAppConfig(&appCfg)
+}
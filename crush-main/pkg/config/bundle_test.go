@@ -0,0 +1,156 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+	"github.com/rolling1314/rolling-crush/internal/pkg/env"
+	"github.com/stretchr/testify/require"
+)
+
+func newBundleTestConfig() *Config {
+	return &Config{
+		Models: map[SelectedModelType]SelectedModel{
+			SelectedModelTypeLarge: {Provider: "openai", Model: "gpt-4o"},
+		},
+		Providers: csync.NewMapFrom(map[string]ProviderConfig{
+			"openai": {
+				ID:           "openai",
+				Name:         "OpenAI",
+				BaseURL:      "https://api.openai.com/v1",
+				Type:         catwalk.TypeOpenAI,
+				APIKey:       "sk-live-secret",
+				ExtraHeaders: map[string]string{"X-Api-Key": "header-secret", "X-Team": "core"},
+			},
+			"local": {
+				ID:      "local",
+				BaseURL: "http://localhost:11434/v1",
+				Type:    catwalk.TypeOpenAICompat,
+				APIKey:  "$LOCAL_API_KEY",
+			},
+		}),
+		Permissions: &Permissions{AllowedTools: []string{"view"}},
+		resolver:    NewEnvironmentVariableResolver(env.NewFromMap(map[string]string{"LOCAL_API_KEY": "local-key"})),
+	}
+}
+
+func TestExportConfigRedactsSecrets(t *testing.T) {
+	c := newBundleTestConfig()
+	appCfg := &AppConfig{
+		Auth:     AuthConfig{JWTSecret: "jwt-secret"},
+		Database: DatabaseConfig{Host: "db", Password: "vault://secret/data/crush#db_password"},
+		Agent:    AgentConfig{MaxWorkers: 10},
+	}
+
+	export, err := ExportConfig(c, appCfg)
+	require.NoError(t, err)
+
+	require.Equal(t, RedactedValue, export.App["auth"].(map[string]any)["jwt_secret"])
+	require.Equal(t, "db", export.App["database"].(map[string]any)["host"])
+
+	openai := export.Bundle.Providers["openai"]
+	require.Equal(t, RedactedValue, openai.APIKey)
+	require.Equal(t, RedactedValue, openai.ExtraHeaders["X-Api-Key"])
+	require.Equal(t, "core", openai.ExtraHeaders["X-Team"])
+	require.Equal(t, "$LOCAL_API_KEY", export.Bundle.Providers["local"].APIKey)
+	require.Equal(t, 10, export.Bundle.Agent.MaxWorkers)
+
+	// The running config keeps its secrets
+	current, _ := c.Providers.Get("openai")
+	require.Equal(t, "sk-live-secret", current.APIKey)
+	require.Equal(t, "header-secret", current.ExtraHeaders["X-Api-Key"])
+}
+
+func TestPrepareBundle(t *testing.T) {
+	c := newBundleTestConfig()
+
+	t.Run("redacted secrets keep the configured ones", func(t *testing.T) {
+		prepared, err := c.PrepareBundle(ConfigBundle{
+			Version: BundleVersion,
+			Providers: map[string]ProviderConfig{
+				"openai": {
+					BaseURL:      "https://api.openai.com/v1",
+					Type:         catwalk.TypeOpenAI,
+					APIKey:       RedactedValue,
+					ExtraHeaders: map[string]string{"X-Api-Key": RedactedValue},
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "openai", prepared.Providers["openai"].ID)
+		require.Equal(t, "sk-live-secret", prepared.Providers["openai"].APIKey)
+		require.Equal(t, "header-secret", prepared.Providers["openai"].ExtraHeaders["X-Api-Key"])
+	})
+
+	t.Run("invalid bundle lists every error", func(t *testing.T) {
+		_, err := c.PrepareBundle(ConfigBundle{
+			Version: BundleVersion,
+			Providers: map[string]ProviderConfig{
+				"new":   {BaseURL: "https://example.com", APIKey: RedactedValue},
+				"weird": {BaseURL: "https://example.com", Type: "nope"},
+			},
+			Models: map[SelectedModelType]SelectedModel{
+				SelectedModelTypeSmall: {Provider: "missing", Model: "m"},
+			},
+			Sandbox: &SandboxConfig{BaseURL: "localhost:8888", MemoryLimit: -1},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "providers.new.api_key")
+		require.Contains(t, err.Error(), `unsupported provider type "nope"`)
+		require.Contains(t, err.Error(), `provider "missing" is not configured`)
+		require.Contains(t, err.Error(), "sandbox.base_url")
+		require.Contains(t, err.Error(), "sandbox: resource limits cannot be negative")
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		_, err := c.PrepareBundle(ConfigBundle{Version: 2})
+		require.ErrorContains(t, err, "unsupported bundle version")
+	})
+}
+
+func TestDiffAndApplyBundle(t *testing.T) {
+	previous := GetGlobalAppConfig()
+	t.Cleanup(func() { SetGlobalAppConfig(previous) })
+
+	c := newBundleTestConfig()
+	appCfg := &AppConfig{Agent: AgentConfig{MaxWorkers: 10, TaskTimeout: 1800}}
+
+	prepared, err := c.PrepareBundle(ConfigBundle{
+		Version: BundleVersion,
+		Providers: map[string]ProviderConfig{
+			"openai": {
+				BaseURL: "https://proxy.example.com/v1",
+				Type:    catwalk.TypeOpenAI,
+				APIKey:  "sk-new-secret",
+			},
+		},
+		Models: map[SelectedModelType]SelectedModel{
+			SelectedModelTypeSmall: {Provider: "local", Model: "llama"},
+		},
+		Agent: &AgentConfig{MaxWorkers: 20, TaskTimeout: 1800},
+	})
+	require.NoError(t, err)
+
+	changes, err := c.DiffBundle(appCfg, prepared)
+	require.NoError(t, err)
+
+	byPath := make(map[string]ConfigChange)
+	for _, change := range changes {
+		byPath[change.Path] = change
+	}
+	require.Equal(t, ConfigChange{Path: "agent.max_workers", Action: "update", Old: float64(10), New: float64(20)}, byPath["agent.max_workers"])
+	require.Equal(t, "https://proxy.example.com/v1", byPath["providers.openai.base_url"].New)
+	require.Equal(t, ConfigChange{Path: "providers.openai.api_key", Action: "update", Old: RedactedValue, New: RedactedValue}, byPath["providers.openai.api_key"])
+	require.Equal(t, "remove", byPath["providers.openai.extra_headers.X-Team"].Action)
+	require.Equal(t, "add", byPath["models.small.model"].Action)
+	require.NotContains(t, byPath, "agent.task_timeout")
+	require.NotContains(t, byPath, "providers.local.base_url")
+
+	c.ApplyBundle(prepared)
+	openai, _ := c.Providers.Get("openai")
+	require.Equal(t, "sk-new-secret", openai.APIKey)
+	require.Equal(t, "llama", c.Models[SelectedModelTypeSmall].Model)
+	require.Equal(t, "gpt-4o", c.Models[SelectedModelTypeLarge].Model)
+	require.Equal(t, 20, GetGlobalAppConfig().Agent.MaxWorkers)
+}
@@ -86,7 +86,7 @@ func Load(workingDir, dataDir string, debug bool) (*Config, error) {
 
 	env := env.New()
 	// Configure providers
-	valueResolver := NewShellVariableResolver(env)
+	valueResolver := NewSecretVariableResolver(NewShellVariableResolver(env))
 	cfg.resolver = valueResolver
 	if err := cfg.configureProviders(env, valueResolver, cfg.knownProviders); err != nil {
 		return nil, fmt.Errorf("failed to configure providers: %w", err)
@@ -177,9 +177,20 @@ func LoadWithSessionConfig(ctx context.Context, workingDir, dataDir string, debu
 		}
 	}
 
+	// Merge pinned context
+	if sessionConfig.Options != nil && sessionConfig.Options.PinnedContext != "" {
+		cfg.Options.PinnedContext = sessionConfig.Options.PinnedContext
+	}
+	if sessionConfig.Options != nil && sessionConfig.Options.AutoFix != nil {
+		cfg.Options.AutoFix = sessionConfig.Options.AutoFix
+	}
+	if sessionConfig.Options != nil && sessionConfig.Options.BusyPolicy != "" {
+		cfg.Options.BusyPolicy = sessionConfig.Options.BusyPolicy
+	}
+
 	// Re-configure with merged config
 	env := env.New()
-	valueResolver := NewShellVariableResolver(env)
+	valueResolver := NewSecretVariableResolver(NewShellVariableResolver(env))
 	cfg.resolver = valueResolver
 	if err := cfg.configureProviders(env, valueResolver, cfg.knownProviders); err != nil {
 		slog.Error("Failed to re-configure providers after session merge", "error", err)
@@ -380,7 +391,7 @@ func (c *Config) configureProviders(env env.Env, resolver VariableResolver, know
 		if providerConfig.Type == "" {
 			providerConfig.Type = catwalk.TypeOpenAICompat
 		}
-		if !slices.Contains(catwalk.KnownProviderTypes(), providerConfig.Type) {
+		if !slices.Contains(catwalk.KnownProviderTypes(), providerConfig.Type) && providerConfig.Type != ProviderTypeSynthetic && providerConfig.Type != ProviderTypeOllama {
 			slog.Warn("Skipping custom provider due to unsupported provider type", "provider", id)
 			c.Providers.Del(id)
 			continue
@@ -391,6 +402,33 @@ func (c *Config) configureProviders(env env.Env, resolver VariableResolver, know
 			c.Providers.Del(id)
 			continue
 		}
+		// Ollama providers default to a local server and discover its models
+		if providerConfig.Type == ProviderTypeOllama {
+			baseURL, err := resolver.ResolveValue(providerConfig.BaseURL)
+			if err != nil {
+				slog.Warn("Skipping custom provider due to invalid API endpoint", "provider", id, "error", err)
+				c.Providers.Del(id)
+				continue
+			}
+			providerConfig, err = withOllamaModels(context.Background(), providerConfig, baseURL)
+			if err != nil || len(providerConfig.Models) == 0 {
+				slog.Warn("Skipping custom provider because no models were found", "provider", id, "error", err)
+				c.Providers.Del(id)
+				continue
+			}
+			c.Providers.Set(id, providerConfig)
+			continue
+		}
+		// Synthetic providers run in process, without endpoint or key
+		if providerConfig.Type == ProviderTypeSynthetic {
+			if len(providerConfig.Models) == 0 {
+				slog.Warn("Skipping custom provider because the provider has no models", "provider", id)
+				c.Providers.Del(id)
+				continue
+			}
+			c.Providers.Set(id, providerConfig)
+			continue
+		}
 		if providerConfig.APIKey == "" {
 			slog.Warn("Provider is missing API key, this might be OK for local providers", "provider", id)
 		}
@@ -697,6 +735,25 @@ func (c *Config) configureSelectedModels(knownProviders []catwalk.Provider) erro
 	}
 	c.Models[SelectedModelTypeLarge] = large
 	c.Models[SelectedModelTypeSmall] = small
+
+	// Title and summary models are optional; when unset or unknown the agent
+	// falls back to the small model
+	for _, modelType := range []SelectedModelType{SelectedModelTypeTitle, SelectedModelTypeSummary} {
+		selected, ok := c.Models[modelType]
+		if !ok {
+			continue
+		}
+		model := c.GetModel(selected.Provider, selected.Model)
+		if model == nil {
+			slog.Warn("Configured model not found, using fallback", "type", modelType, "provider", selected.Provider, "model", selected.Model)
+			delete(c.Models, modelType)
+			continue
+		}
+		if selected.MaxTokens <= 0 {
+			selected.MaxTokens = model.DefaultMaxTokens
+			c.Models[modelType] = selected
+		}
+	}
 	return nil
 }
 
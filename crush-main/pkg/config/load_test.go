@@ -469,7 +469,7 @@ func TestConfig_setupAgentsWithNoDisabledTools(t *testing.T) {
 
 	taskAgent, ok := cfg.Agents[AgentTask]
 	require.True(t, ok)
-	assert.Equal(t, []string{"glob", "grep", "ls", "sourcegraph", "view"}, taskAgent.AllowedTools)
+	assert.Equal(t, []string{"glob", "grep", "ls", "sourcegraph", "code_search", "view"}, taskAgent.AllowedTools)
 }
 
 func TestConfig_setupAgentsWithDisabledTools(t *testing.T) {
@@ -487,11 +487,36 @@ func TestConfig_setupAgentsWithDisabledTools(t *testing.T) {
 	coderAgent, ok := cfg.Agents[AgentCoder]
 	require.True(t, ok)
 
-	assert.Equal(t, []string{"agent", "bash", "job_output", "job_kill", "multiedit", "lsp_diagnostics", "lsp_references", "fetch", "agentic_fetch", "glob", "ls", "sourcegraph", "view", "write"}, coderAgent.AllowedTools)
+	assert.Equal(t, []string{"agent", "bash", "job_output", "job_kill", "git_status", "git_diff", "git_commit", "git_branch", "git_checkout", "multiedit", "apply_patch", "lsp_diagnostics", "lsp_references", "rename_symbol", "fetch", "agentic_fetch", "glob", "lint", "ls", "sourcegraph", "code_search", "view", "write", "todos", "memory"}, coderAgent.AllowedTools)
 
 	taskAgent, ok := cfg.Agents[AgentTask]
 	require.True(t, ok)
-	assert.Equal(t, []string{"glob", "ls", "sourcegraph", "view"}, taskAgent.AllowedTools)
+	assert.Equal(t, []string{"glob", "ls", "sourcegraph", "code_search", "view"}, taskAgent.AllowedTools)
+}
+
+func TestConfig_setupCustomAgents(t *testing.T) {
+	cfg := &Config{
+		Options: &Options{
+			DisabledTools: []string{"bash"},
+		},
+		CustomAgents: map[string]Agent{
+			"reviewer": {
+				AllowedTools: []string{"view", "grep", "bash"},
+				Instructions: "Review the changes.",
+			},
+			AgentCoder: {Description: "shadowing the coder"},
+		},
+	}
+
+	cfg.SetupAgents()
+	reviewer, ok := cfg.Agents["reviewer"]
+	require.True(t, ok)
+	assert.Equal(t, "reviewer", reviewer.ID)
+	assert.Equal(t, "reviewer", reviewer.Name)
+	assert.Equal(t, SelectedModelTypeLarge, reviewer.Model)
+	assert.Equal(t, []string{"grep", "view"}, reviewer.AllowedTools)
+	assert.Equal(t, "Review the changes.", reviewer.Instructions)
+	assert.Equal(t, "An agent that helps with executing coding tasks.", cfg.Agents[AgentCoder].Description)
 }
 
 func TestConfig_setupAgentsWithEveryReadOnlyToolDisabled(t *testing.T) {
@@ -502,6 +527,7 @@ func TestConfig_setupAgentsWithEveryReadOnlyToolDisabled(t *testing.T) {
 				"grep",
 				"ls",
 				"sourcegraph",
+				"code_search",
 				"view",
 			},
 		},
@@ -510,7 +536,7 @@ func TestConfig_setupAgentsWithEveryReadOnlyToolDisabled(t *testing.T) {
 	cfg.SetupAgents()
 	coderAgent, ok := cfg.Agents[AgentCoder]
 	require.True(t, ok)
-	assert.Equal(t, []string{"agent", "bash", "job_output", "job_kill", "download", "edit", "multiedit", "lsp_diagnostics", "lsp_references", "fetch", "agentic_fetch", "write"}, coderAgent.AllowedTools)
+	assert.Equal(t, []string{"agent", "bash", "job_output", "job_kill", "git_status", "git_diff", "git_commit", "git_branch", "git_checkout", "download", "edit", "multiedit", "apply_patch", "lsp_diagnostics", "lsp_references", "rename_symbol", "fetch", "agentic_fetch", "lint", "write", "todos", "memory"}, coderAgent.AllowedTools)
 
 	taskAgent, ok := cfg.Agents[AgentTask]
 	require.True(t, ok)
@@ -1144,6 +1170,58 @@ func TestConfig_configureSelectedModels(t *testing.T) {
 		require.Equal(t, "openai", small.Provider)
 		require.Equal(t, int64(500), small.MaxTokens)
 	})
+	t.Run("should keep known title and summary models and drop unknown ones", func(t *testing.T) {
+		knownProviders := []catwalk.Provider{
+			{
+				ID:                  "openai",
+				APIKey:              "abc",
+				DefaultLargeModelID: "large-model",
+				DefaultSmallModelID: "small-model",
+				Models: []catwalk.Model{
+					{
+						ID:               "large-model",
+						DefaultMaxTokens: 1000,
+					},
+					{
+						ID:               "small-model",
+						DefaultMaxTokens: 500,
+					},
+					{
+						ID:               "tiny-model",
+						DefaultMaxTokens: 100,
+					},
+				},
+			},
+		}
+
+		cfg := &Config{
+			Models: map[SelectedModelType]SelectedModel{
+				"title": {
+					Model:    "tiny-model",
+					Provider: "openai",
+				},
+				"summary": {
+					Model:    "missing-model",
+					Provider: "openai",
+				},
+			},
+		}
+		cfg.setDefaults("/tmp", "")
+		env := env.NewFromMap(map[string]string{})
+		resolver := NewEnvironmentVariableResolver(env)
+		err := cfg.configureProviders(env, resolver, knownProviders)
+		require.NoError(t, err)
+
+		err = cfg.configureSelectedModels(knownProviders)
+		require.NoError(t, err)
+		title, ok := cfg.Models[SelectedModelTypeTitle]
+		require.True(t, ok)
+		require.Equal(t, "tiny-model", title.Model)
+		require.Equal(t, int64(100), title.MaxTokens)
+		_, ok = cfg.Models[SelectedModelTypeSummary]
+		require.False(t, ok)
+		require.Equal(t, "small-model", cfg.Models[SelectedModelTypeSmall].Model)
+	})
 	t.Run("should be possible to use multiple providers", func(t *testing.T) {
 		knownProviders := []catwalk.Provider{
 			{
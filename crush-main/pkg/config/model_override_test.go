@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelOverrideApply(t *testing.T) {
+	t.Parallel()
+
+	temperature := 0.2
+	selected := SelectedModel{Provider: "openai", Model: "gpt-4o", MaxTokens: 4096, ReasoningEffort: "low", Temperature: &temperature}
+
+	require.Equal(t, selected, ModelOverride{}.Apply(selected))
+
+	hot := 0.9
+	tuned := ModelOverride{Temperature: &hot, ReasoningEffort: "high"}.Apply(selected)
+	require.Equal(t, 0.9, *tuned.Temperature)
+	require.Equal(t, "high", tuned.ReasoningEffort)
+	require.Equal(t, int64(4096), tuned.MaxTokens)
+	require.Equal(t, 0.2, *selected.Temperature, "the session model is not changed")
+
+	other := ModelOverride{Provider: "anthropic", Model: "claude-sonnet-4"}.Apply(selected)
+	require.Equal(t, SelectedModel{Provider: "anthropic", Model: "claude-sonnet-4"}, other)
+
+	same := ModelOverride{Model: "gpt-4o", ReasoningEffort: "medium"}.Apply(selected)
+	require.Equal(t, int64(4096), same.MaxTokens, "the same model keeps its settings")
+	require.Equal(t, "medium", same.ReasoningEffort)
+}
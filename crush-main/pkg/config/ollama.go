@@ -0,0 +1,227 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+)
+
+// ProviderTypeOllama is a self-hosted Ollama or LM Studio server, reached
+// through its OpenAI-compatible API. It needs no api_key, and its models are
+// discovered from the server when none are configured.
+const ProviderTypeOllama catwalk.Type = "ollama"
+
+const (
+	// DefaultOllamaBaseURL is the OpenAI-compatible endpoint of a local Ollama.
+	DefaultOllamaBaseURL = "http://localhost:11434/v1"
+	// ollamaAPIKey is sent as the api key, which the servers ignore but the
+	// OpenAI clients require.
+	ollamaAPIKey = "ollama"
+	// ollamaContextWindow is the context window of the models whose server
+	// does not report one.
+	ollamaContextWindow = 8192
+	// ollamaMaxTokens caps the default output tokens of the local models.
+	ollamaMaxTokens = 4096
+	// ollamaDiscoveryTimeout bounds the model discovery, so that a server
+	// that is down does not hold up the startup.
+	ollamaDiscoveryTimeout = 5 * time.Second
+)
+
+// OllamaAPIKey returns the api key sent to an Ollama provider: the configured
+// one, or a placeholder.
+func OllamaAPIKey(apiKey string) string {
+	if apiKey == "" {
+		return ollamaAPIKey
+	}
+	return apiKey
+}
+
+// ollamaRoot returns the root of an Ollama server from its OpenAI-compatible
+// base URL, where its native API is served.
+func ollamaRoot(baseURL string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+}
+
+// ollamaTags is the response of the Ollama /api/tags endpoint.
+type ollamaTags struct {
+	Models []struct {
+		Name  string `json:"name"`
+		Model string `json:"model"`
+	} `json:"models"`
+}
+
+// ollamaShow is the part of the response of the Ollama /api/show endpoint
+// read for a model.
+type ollamaShow struct {
+	Capabilities []string       `json:"capabilities"`
+	ModelInfo    map[string]any `json:"model_info"`
+}
+
+// openAIModels is the response of the OpenAI-compatible /models endpoint,
+// which LM Studio serves in place of /api/tags.
+type openAIModels struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// DiscoverOllamaModels lists the models of an Ollama server, with their
+// context window and capabilities. Servers without the Ollama API, such as
+// LM Studio, are listed through their OpenAI-compatible /models endpoint with
+// the default context window.
+func DiscoverOllamaModels(ctx context.Context, baseURL string, headers map[string]string) ([]catwalk.Model, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaDiscoveryTimeout)
+	defer cancel()
+
+	root := ollamaRoot(baseURL)
+	var tags ollamaTags
+	if err := ollamaGet(ctx, root+"/api/tags", headers, &tags); err != nil {
+		var listed openAIModels
+		if err := ollamaGet(ctx, strings.TrimSuffix(baseURL, "/")+"/models", headers, &listed); err != nil {
+			return nil, fmt.Errorf("failed to list models of %s: %w", baseURL, err)
+		}
+		models := make([]catwalk.Model, 0, len(listed.Data))
+		for _, m := range listed.Data {
+			models = append(models, ollamaModel(m.ID, ollamaShow{}))
+		}
+		return models, nil
+	}
+
+	models := make([]catwalk.Model, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		id := m.Model
+		if id == "" {
+			id = m.Name
+		}
+		var show ollamaShow
+		if err := ollamaPost(ctx, root+"/api/show", headers, map[string]string{"model": id}, &show); err != nil {
+			// The model is still usable, with the defaults
+			show = ollamaShow{}
+		}
+		models = append(models, ollamaModel(id, show))
+	}
+	return models, nil
+}
+
+// ollamaModel returns the catwalk model of a local model. Local models are
+// free, and their output is capped to leave room for the prompt.
+func ollamaModel(id string, show ollamaShow) catwalk.Model {
+	contextWindow := ollamaContextLength(show.ModelInfo)
+	if contextWindow <= 0 {
+		contextWindow = ollamaContextWindow
+	}
+	return catwalk.Model{
+		ID:               id,
+		Name:             id,
+		ContextWindow:    contextWindow,
+		DefaultMaxTokens: min(ollamaMaxTokens, contextWindow/4),
+		CanReason:        slices.Contains(show.Capabilities, "thinking"),
+		SupportsImages:   slices.Contains(show.Capabilities, "vision"),
+	}
+}
+
+// ollamaContextLength returns the context length in the model info of a
+// model, which is keyed by its architecture, e.g. "llama.context_length".
+func ollamaContextLength(info map[string]any) int64 {
+	if arch, ok := info["general.architecture"].(string); ok {
+		if n, ok := info[arch+".context_length"].(float64); ok {
+			return int64(n)
+		}
+	}
+	for key, value := range info {
+		if n, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			return int64(n)
+		}
+	}
+	return 0
+}
+
+// withOllamaModels fills in the base URL of an Ollama provider, and its
+// models from the server when none are configured. The context window of the
+// configured models defaults to the one the server reports.
+func withOllamaModels(ctx context.Context, p ProviderConfig, baseURL string) (ProviderConfig, error) {
+	if p.BaseURL == "" {
+		p.BaseURL = DefaultOllamaBaseURL
+		baseURL = DefaultOllamaBaseURL
+	}
+	needsDiscovery := len(p.Models) == 0
+	for _, m := range p.Models {
+		if m.ContextWindow == 0 {
+			needsDiscovery = true
+		}
+	}
+	if !needsDiscovery {
+		return p, nil
+	}
+
+	// The configured models fall back to the defaults when the server is down
+	discovered, err := DiscoverOllamaModels(ctx, baseURL, p.ExtraHeaders)
+	if len(p.Models) == 0 {
+		p.Models = discovered
+		return p, err
+	}
+	models := make([]catwalk.Model, len(p.Models))
+	for i, m := range p.Models {
+		if m.ContextWindow == 0 {
+			found := ollamaModel(m.ID, ollamaShow{})
+			for _, d := range discovered {
+				if d.ID == m.ID {
+					found = d
+				}
+			}
+			m.ContextWindow = found.ContextWindow
+			if m.DefaultMaxTokens == 0 {
+				m.DefaultMaxTokens = found.DefaultMaxTokens
+			}
+		}
+		if m.Name == "" {
+			m.Name = m.ID
+		}
+		models[i] = m
+	}
+	p.Models = models
+	return p, nil
+}
+
+func ollamaGet(ctx context.Context, url string, headers map[string]string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return ollamaDo(req, headers, v)
+}
+
+func ollamaPost(ctx context.Context, url string, headers map[string]string, body, v any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return ollamaDo(req, headers, v)
+}
+
+func ollamaDo(req *http.Request, headers map[string]string, v any) error {
+	for k, value := range headers {
+		req.Header.Set(k, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", req.URL.Path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/stretchr/testify/require"
+)
+
+func newOllamaServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models":[{"name":"qwen3:8b","model":"qwen3:8b"},{"name":"llava:7b","model":"llava:7b"}]}`))
+	})
+	mux.HandleFunc("POST /api/show", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		switch req.Model {
+		case "qwen3:8b":
+			w.Write([]byte(`{"capabilities":["completion","tools","thinking"],"model_info":{"general.architecture":"qwen3","qwen3.context_length":40960}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDiscoverOllamaModels(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ollama", func(t *testing.T) {
+		t.Parallel()
+		srv := newOllamaServer(t)
+
+		models, err := DiscoverOllamaModels(context.Background(), srv.URL+"/v1", nil)
+		require.NoError(t, err)
+		require.Len(t, models, 2)
+
+		require.Equal(t, "qwen3:8b", models[0].ID)
+		require.Equal(t, int64(40960), models[0].ContextWindow)
+		require.Equal(t, int64(4096), models[0].DefaultMaxTokens)
+		require.True(t, models[0].CanReason)
+		require.False(t, models[0].SupportsImages)
+
+		// Models the server cannot describe get the defaults
+		require.Equal(t, "llava:7b", models[1].ID)
+		require.Equal(t, int64(8192), models[1].ContextWindow)
+		require.Equal(t, int64(2048), models[1].DefaultMaxTokens)
+	})
+
+	t.Run("openai compatible", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/models" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"data":[{"id":"qwen2.5-coder-7b-instruct"}]}`))
+		}))
+		t.Cleanup(srv.Close)
+
+		models, err := DiscoverOllamaModels(context.Background(), srv.URL+"/v1", nil)
+		require.NoError(t, err)
+		require.Len(t, models, 1)
+		require.Equal(t, "qwen2.5-coder-7b-instruct", models[0].ID)
+		require.Equal(t, int64(8192), models[0].ContextWindow)
+	})
+
+	t.Run("server down", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+
+		_, err := DiscoverOllamaModels(context.Background(), srv.URL+"/v1", nil)
+		require.Error(t, err)
+	})
+}
+
+func TestWithOllamaModels(t *testing.T) {
+	t.Parallel()
+	srv := newOllamaServer(t)
+
+	p := ProviderConfig{
+		ID:      "local",
+		Type:    ProviderTypeOllama,
+		BaseURL: srv.URL + "/v1",
+		Models: []catwalk.Model{
+			{ID: "qwen3:8b"},
+			{ID: "custom", ContextWindow: 32000, DefaultMaxTokens: 1000},
+		},
+	}
+	p, err := withOllamaModels(context.Background(), p, p.BaseURL)
+	require.NoError(t, err)
+	require.Len(t, p.Models, 2)
+	require.Equal(t, int64(40960), p.Models[0].ContextWindow)
+	require.Equal(t, "qwen3:8b", p.Models[0].Name)
+	require.Equal(t, int64(32000), p.Models[1].ContextWindow)
+	require.Equal(t, int64(1000), p.Models[1].DefaultMaxTokens)
+}
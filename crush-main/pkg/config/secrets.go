@@ -0,0 +1,284 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/csync"
+)
+
+// defaultSecretRefreshInterval is how long a resolved secret is cached before
+// it is fetched again, which is also how quickly rotations are picked up.
+const defaultSecretRefreshInterval = 5 * time.Minute
+
+// SecretProvider fetches secret values from an external secrets manager.
+type SecretProvider interface {
+	// Scheme is the reference prefix handled by the provider, e.g. "vault" for vault://path#key.
+	Scheme() string
+	// GetSecret returns the raw secret for a reference without the scheme and key,
+	// e.g. "secret/data/crush" for vault://secret/data/crush#api_key.
+	GetSecret(ctx context.Context, path string) (string, error)
+}
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+var (
+	secretProviders = csync.NewMap[string, SecretProvider]()
+	secretCache     = csync.NewMap[string, cachedSecret]()
+
+	secretRefreshMu       sync.RWMutex
+	secretRefreshInterval = defaultSecretRefreshInterval
+
+	// rawAppConfig is the last loaded app config before secret references were resolved.
+	// It is kept so that rotated secrets can be re-resolved from the original references.
+	rawAppConfig *AppConfig
+)
+
+// RegisterSecretProvider registers a provider for its scheme, replacing any existing one.
+func RegisterSecretProvider(p SecretProvider) {
+	secretProviders.Set(p.Scheme(), p)
+}
+
+// InitSecretProviders registers the secret providers enabled in the app config.
+func InitSecretProviders(cfg SecretsConfig) {
+	secretRefreshMu.Lock()
+	switch {
+	case cfg.RefreshInterval > 0:
+		secretRefreshInterval = time.Duration(cfg.RefreshInterval) * time.Second
+	case cfg.RefreshInterval < 0:
+		secretRefreshInterval = 0
+	default:
+		secretRefreshInterval = defaultSecretRefreshInterval
+	}
+	secretRefreshMu.Unlock()
+
+	if cfg.Vault.Address != "" {
+		RegisterSecretProvider(NewVaultSecretProvider(cfg.Vault))
+	}
+	if cfg.AWS.Enabled {
+		RegisterSecretProvider(NewAWSSecretProvider(cfg.AWS))
+	}
+	if cfg.GCP.Enabled {
+		RegisterSecretProvider(NewGCPSecretProvider(cfg.GCP))
+	}
+}
+
+// parseSecretRef splits a reference like vault://secret/data/crush#api_key
+// into its scheme, path and optional JSON key.
+func parseSecretRef(value string) (scheme, path, key string, ok bool) {
+	scheme, rest, found := strings.Cut(value, "://")
+	if !found || scheme == "" || rest == "" {
+		return "", "", "", false
+	}
+	if _, registered := secretProviders.Get(scheme); !registered {
+		return "", "", "", false
+	}
+	path, key, _ = strings.Cut(rest, "#")
+	return scheme, path, key, true
+}
+
+// IsSecretRef reports whether value references a registered secret provider.
+func IsSecretRef(value string) bool {
+	_, _, _, ok := parseSecretRef(value)
+	return ok
+}
+
+// ResolveSecret resolves a secret reference such as vault://secret/data/crush#api_key.
+// Values that are not secret references are returned unchanged.
+// Results are cached for the configured refresh interval.
+func ResolveSecret(ctx context.Context, value string) (string, error) {
+	return resolveSecret(ctx, value, false)
+}
+
+// resolveSecret resolves a secret reference, bypassing the cache when refresh is set.
+func resolveSecret(ctx context.Context, value string, refresh bool) (string, error) {
+	scheme, path, key, ok := parseSecretRef(value)
+	if !ok {
+		return value, nil
+	}
+
+	secretRefreshMu.RLock()
+	ttl := secretRefreshInterval
+	secretRefreshMu.RUnlock()
+
+	if cached, found := secretCache.Get(value); found && !refresh && (ttl == 0 || time.Since(cached.fetchedAt) < ttl) {
+		return cached.value, nil
+	}
+
+	provider, _ := secretProviders.Get(scheme)
+	raw, err := provider.GetSecret(ctx, path)
+	if err != nil {
+		// Keep serving the last known value if the secrets manager is temporarily unavailable
+		if cached, found := secretCache.Get(value); found {
+			slog.Warn("Failed to refresh secret, using cached value", "scheme", scheme, "path", path, "error", err)
+			return cached.value, nil
+		}
+		return "", fmt.Errorf("failed to fetch secret %s://%s: %w", scheme, path, err)
+	}
+
+	resolved := raw
+	if key != "" {
+		resolved, err = secretJSONField(raw, key)
+		if err != nil {
+			return "", fmt.Errorf("failed to read key %q of secret %s://%s: %w", key, scheme, path, err)
+		}
+	}
+
+	secretCache.Set(value, cachedSecret{value: resolved, fetchedAt: time.Now()})
+	return resolved, nil
+}
+
+// secretJSONField extracts a top-level string field from a JSON secret payload.
+func secretJSONField(raw, key string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	v, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("key not found")
+	}
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+}
+
+type secretVariableResolver struct {
+	next VariableResolver
+}
+
+// NewSecretVariableResolver wraps a resolver so that secret references are
+// fetched from the registered secrets managers and everything else is
+// delegated to next.
+func NewSecretVariableResolver(next VariableResolver) VariableResolver {
+	return &secretVariableResolver{next: next}
+}
+
+// ResolveValue resolves secret references, falling back to the wrapped resolver.
+func (r *secretVariableResolver) ResolveValue(value string) (string, error) {
+	if IsSecretRef(value) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return ResolveSecret(ctx, value)
+	}
+	return r.next.ResolveValue(value)
+}
+
+// appConfigSecretFields returns the app config fields that may hold secret references.
+func appConfigSecretFields(cfg *AppConfig) map[string]*string {
+	return map[string]*string{
+		"auth.jwt_secret":               &cfg.Auth.JWTSecret,
+		"database.password":             &cfg.Database.Password,
+		"redis.password":                &cfg.Redis.Password,
+		"auto_model.api_key":            &cfg.AutoModel.APIKey,
+		"email.password":                &cfg.Email.Password,
+		"cloudflare.api_token":          &cfg.Cloudflare.APIToken,
+		"storage.minio.access_key":      &cfg.Storage.MinIO.AccessKey,
+		"storage.minio.secret_key":      &cfg.Storage.MinIO.SecretKey,
+		"storage.oss.access_key_id":     &cfg.Storage.OSS.AccessKeyID,
+		"storage.oss.access_key_secret": &cfg.Storage.OSS.AccessKeySecret,
+		"secrets.master_key":            &cfg.Secrets.MasterKey,
+	}
+}
+
+// liveSecretFields are the secret fields whose rotated value is used without a
+// restart: the database and Redis clients read the passwords when they open a
+// connection, and the auto model key when a session is created. The other
+// fields are read once at startup.
+var liveSecretFields = map[string]bool{
+	"database.password":  true,
+	"redis.password":     true,
+	"auto_model.api_key": true,
+}
+
+// resolveAppConfigSecrets returns a copy of raw with all secret references resolved.
+// When refresh is set the secrets are fetched again instead of served from the cache.
+func resolveAppConfigSecrets(ctx context.Context, raw *AppConfig, refresh bool) (*AppConfig, error) {
+	resolved := *raw
+	for name, field := range appConfigSecretFields(&resolved) {
+		if !IsSecretRef(*field) {
+			continue
+		}
+		v, err := resolveSecret(ctx, *field, refresh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+		}
+		*field = v
+	}
+	return &resolved, nil
+}
+
+// StartSecretRotation periodically re-resolves the secret references of the
+// last loaded app config and swaps the global app config when a value changed.
+// Only the liveSecretFields take effect, the open connections keep the
+// credentials they were opened with; a warning lists the changed fields that
+// need a restart. onRotate is called with the new config and the names of the
+// changed fields (can be nil).
+func StartSecretRotation(ctx context.Context, onRotate func(cfg *AppConfig, changed []string)) {
+	secretRefreshMu.RLock()
+	interval := secretRefreshInterval
+	raw := rawAppConfig
+	secretRefreshMu.RUnlock()
+
+	if interval == 0 || raw == nil || secretProviders.Len() == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current := GetGlobalAppConfig()
+			next, err := resolveAppConfigSecrets(ctx, raw, true)
+			if err != nil {
+				slog.Warn("Failed to refresh app config secrets", "error", err)
+				continue
+			}
+
+			var changed []string
+			currentFields := appConfigSecretFields(current)
+			for name, field := range appConfigSecretFields(next) {
+				if *field != *currentFields[name] {
+					changed = append(changed, name)
+				}
+			}
+			if len(changed) == 0 {
+				continue
+			}
+
+			slices.Sort(changed)
+			SetGlobalAppConfig(next)
+			slog.Info("App config secrets rotated", "fields", changed)
+			if restart := slices.DeleteFunc(slices.Clone(changed), func(name string) bool {
+				return liveSecretFields[name]
+			}); len(restart) > 0 {
+				slog.Warn("Rotated secrets take effect after a restart", "fields", restart)
+			}
+			if onRotate != nil {
+				onRotate(next, changed)
+			}
+		}
+	}()
+}
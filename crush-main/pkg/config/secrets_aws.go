@@ -0,0 +1,97 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// awsSecretProvider resolves awssm://<secret-id>[#key] references using the
+// AWS Secrets Manager GetSecretValue API.
+type awsSecretProvider struct {
+	cfg    AWSSecretsConfig
+	client *http.Client
+}
+
+// NewAWSSecretProvider creates an AWS Secrets Manager secret provider.
+func NewAWSSecretProvider(cfg AWSSecretsConfig) SecretProvider {
+	return &awsSecretProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *awsSecretProvider) Scheme() string {
+	return "awssm"
+}
+
+func (p *awsSecretProvider) GetSecret(ctx context.Context, secretID string) (string, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if p.cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(p.cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if awsCfg.Region == "" {
+		return "", fmt.Errorf("AWS region not configured")
+	}
+	creds, err := awsCfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	payload, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", awsCfg.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create AWS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	hash := sha256.Sum256(payload)
+	signer := v4.NewSigner()
+	if err := signer.SignHTTP(ctx, aws.Credentials(creds), req, hex.EncodeToString(hash[:]), "secretsmanager", awsCfg.Region, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to sign AWS request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("AWS Secrets Manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read AWS response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("AWS Secrets Manager returned %s: %s", resp.Status, string(body))
+	}
+
+	var result struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse AWS response: %w", err)
+	}
+	if result.SecretString == "" {
+		return "", fmt.Errorf("secret %s has no string value", secretID)
+	}
+	return result.SecretString, nil
+}
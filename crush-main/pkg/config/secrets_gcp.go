@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/auth/credentials"
+)
+
+// gcpSecretProvider resolves gcpsm://<secret>[#key] references using the GCP
+// Secret Manager REST API. The secret may be a bare name (latest version in the
+// configured project) or a full resource name such as
+// projects/p/secrets/s/versions/3.
+type gcpSecretProvider struct {
+	cfg    GCPSecretsConfig
+	client *http.Client
+}
+
+// NewGCPSecretProvider creates a GCP Secret Manager secret provider.
+func NewGCPSecretProvider(cfg GCPSecretsConfig) SecretProvider {
+	return &gcpSecretProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *gcpSecretProvider) Scheme() string {
+	return "gcpsm"
+}
+
+func (p *gcpSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	resource := name
+	if !strings.HasPrefix(resource, "projects/") {
+		if p.cfg.Project == "" {
+			return "", fmt.Errorf("GCP project not configured for secret %s", name)
+		}
+		resource = fmt.Sprintf("projects/%s/secrets/%s", p.cfg.Project, name)
+	}
+	if !strings.Contains(resource, "/versions/") {
+		resource += "/versions/latest"
+	}
+
+	creds, err := credentials.DetectDefault(&credentials.DetectOptions{
+		Scopes: []string{"https://www.googleapis.com/auth/cloud-platform"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to detect GCP credentials: %w", err)
+	}
+	token, err := creds.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get GCP token: %w", err)
+	}
+
+	url := "https://secretmanager.googleapis.com/v1/" + resource + ":access"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Value)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("GCP Secret Manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read GCP response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GCP Secret Manager returned %s: %s", resp.Status, string(body))
+	}
+
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse GCP response: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode GCP secret payload: %w", err)
+	}
+	return string(data), nil
+}
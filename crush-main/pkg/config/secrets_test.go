@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rolling1314/rolling-crush/internal/pkg/env"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSecretProvider struct {
+	scheme  string
+	secrets map[string]string
+	calls   int
+	err     error
+}
+
+func (p *fakeSecretProvider) Scheme() string {
+	return p.scheme
+}
+
+func (p *fakeSecretProvider) GetSecret(_ context.Context, path string) (string, error) {
+	p.calls++
+	if p.err != nil {
+		return "", p.err
+	}
+	v, ok := p.secrets[path]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func TestSecretVariableResolver(t *testing.T) {
+	provider := &fakeSecretProvider{
+		scheme: "fakesm",
+		secrets: map[string]string{
+			"plain": "s3cret",
+			"json":  `{"api_key":"abc","port":5432}`,
+		},
+	}
+	RegisterSecretProvider(provider)
+	t.Cleanup(func() { secretProviders.Del("fakesm") })
+
+	resolver := NewSecretVariableResolver(NewEnvironmentVariableResolver(env.NewFromMap(map[string]string{
+		"OPENAI_API_KEY": "from-env",
+	})))
+
+	t.Run("raw secret", func(t *testing.T) {
+		v, err := resolver.ResolveValue("fakesm://plain")
+		require.NoError(t, err)
+		require.Equal(t, "s3cret", v)
+	})
+
+	t.Run("json key", func(t *testing.T) {
+		v, err := resolver.ResolveValue("fakesm://json#api_key")
+		require.NoError(t, err)
+		require.Equal(t, "abc", v)
+
+		v, err = resolver.ResolveValue("fakesm://json#port")
+		require.NoError(t, err)
+		require.Equal(t, "5432", v)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := resolver.ResolveValue("fakesm://json#missing")
+		require.Error(t, err)
+	})
+
+	t.Run("falls back to wrapped resolver", func(t *testing.T) {
+		v, err := resolver.ResolveValue("$OPENAI_API_KEY")
+		require.NoError(t, err)
+		require.Equal(t, "from-env", v)
+
+		v, err = resolver.ResolveValue("https://example.com")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com", v)
+	})
+
+	t.Run("cached value served when provider fails", func(t *testing.T) {
+		provider.err = errors.New("unavailable")
+		t.Cleanup(func() { provider.err = nil })
+
+		v, err := resolveSecret(t.Context(), "fakesm://plain", true)
+		require.NoError(t, err)
+		require.Equal(t, "s3cret", v)
+	})
+}
+
+func TestResolveAppConfigSecrets(t *testing.T) {
+	provider := &fakeSecretProvider{
+		scheme:  "fakeapp",
+		secrets: map[string]string{"db": "db-pass", "cf": "cf-token"},
+	}
+	RegisterSecretProvider(provider)
+	t.Cleanup(func() { secretProviders.Del("fakeapp") })
+
+	raw := &AppConfig{}
+	raw.Database.Password = "fakeapp://db"
+	raw.Cloudflare.APIToken = "fakeapp://cf"
+	raw.Redis.Password = "literal"
+
+	resolved, err := resolveAppConfigSecrets(t.Context(), raw, false)
+	require.NoError(t, err)
+	require.Equal(t, "db-pass", resolved.Database.Password)
+	require.Equal(t, "cf-token", resolved.Cloudflare.APIToken)
+	require.Equal(t, "literal", resolved.Redis.Password)
+	require.Equal(t, "fakeapp://db", raw.Database.Password)
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "test-token", r.Header.Get("X-Vault-Token"))
+		switch r.URL.Path {
+		case "/v1/secret/data/crush":
+			_, _ = w.Write([]byte(`{"data":{"data":{"api_key":"kv2"},"metadata":{"version":1}}}`))
+		case "/v1/kv/crush":
+			_, _ = w.Write([]byte(`{"data":{"api_key":"kv1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewVaultSecretProvider(VaultSecretsConfig{Address: server.URL, Token: "test-token"})
+
+	v, err := provider.GetSecret(t.Context(), "secret/data/crush")
+	require.NoError(t, err)
+	field, err := secretJSONField(v, "api_key")
+	require.NoError(t, err)
+	require.Equal(t, "kv2", field)
+
+	v, err = provider.GetSecret(t.Context(), "kv/crush")
+	require.NoError(t, err)
+	field, err = secretJSONField(v, "api_key")
+	require.NoError(t, err)
+	require.Equal(t, "kv1", field)
+
+	_, err = provider.GetSecret(t.Context(), "missing")
+	require.Error(t, err)
+}
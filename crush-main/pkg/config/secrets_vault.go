@@ -0,0 +1,77 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// vaultSecretProvider resolves vault://<path>[#key] references using the Vault HTTP API.
+// Both KV v1 and KV v2 mounts are supported; for KV v2 the path includes "data/",
+// e.g. vault://secret/data/crush#db_password.
+type vaultSecretProvider struct {
+	cfg    VaultSecretsConfig
+	client *http.Client
+}
+
+// NewVaultSecretProvider creates a HashiCorp Vault secret provider.
+func NewVaultSecretProvider(cfg VaultSecretsConfig) SecretProvider {
+	return &vaultSecretProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *vaultSecretProvider) Scheme() string {
+	return "vault"
+}
+
+func (p *vaultSecretProvider) GetSecret(ctx context.Context, path string) (string, error) {
+	url := strings.TrimRight(p.cfg.Address, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.cfg.Token)
+	if p.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.cfg.Namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var result struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	// KV v2 nests the secret fields under data.data
+	if nested, ok := result.Data["data"]; ok {
+		if _, hasMetadata := result.Data["metadata"]; hasMetadata {
+			return string(nested), nil
+		}
+	}
+
+	fields, err := json.Marshal(result.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(fields), nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+const (
+	// MaxSessionEnvVars bounds the environment variables of a session.
+	MaxSessionEnvVars = 64
+	// MaxSessionEnvValue bounds the size of a session environment variable.
+	MaxSessionEnvValue = 4096
+)
+
+// sessionEnvName matches environment variable names.
+var sessionEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+// SessionEnv are the environment variables a user sets for a session, saved
+// in its config as options.env. They are set for the commands the tools run
+// and expanded in the URLs of the fetch tools, e.g. API_BASE_URL while
+// debugging a service.
+type SessionEnv map[string]string
+
+// Validate checks the names and sizes of the variables.
+func (e SessionEnv) Validate() error {
+	if len(e) > MaxSessionEnvVars {
+		return fmt.Errorf("at most %d environment variables can be set", MaxSessionEnvVars)
+	}
+	var errs []error
+	for name, value := range e {
+		if !sessionEnvName.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid environment variable name %q", name))
+		}
+		if len(value) > MaxSessionEnvValue {
+			errs = append(errs, fmt.Errorf("environment variable %s exceeds %d bytes", name, MaxSessionEnvValue))
+		}
+	}
+	return errors.Join(errs...)
+}
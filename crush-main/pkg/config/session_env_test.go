@@ -0,0 +1,24 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionEnvValidate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, SessionEnv{"API_BASE_URL": "http://localhost:8080", "_DEBUG": ""}.Validate())
+	require.NoError(t, SessionEnv(nil).Validate())
+	require.Error(t, SessionEnv{"1ST": "x"}.Validate())
+	require.Error(t, SessionEnv{"MY VAR": "x"}.Validate())
+	require.Error(t, SessionEnv{"LARGE": strings.Repeat("x", MaxSessionEnvValue+1)}.Validate())
+
+	many := SessionEnv{}
+	for i := range MaxSessionEnvVars + 1 {
+		many["VAR_"+strings.Repeat("X", i)] = "x"
+	}
+	require.Error(t, many.Validate())
+}
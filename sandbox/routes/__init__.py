@@ -8,6 +8,7 @@ from routes.execute import execute_bp
 from routes.file_ops import file_ops_bp
 from routes.project import project_bp
 from routes.lsp import lsp_bp
+from routes.workspace import workspace_bp
 
 
 def register_routes(app: Flask):
@@ -16,4 +17,5 @@ def register_routes(app: Flask):
     app.register_blueprint(execute_bp)
     app.register_blueprint(file_ops_bp)
     app.register_blueprint(project_bp)
-    app.register_blueprint(lsp_bp)
\ No newline at end of file
+    app.register_blueprint(lsp_bp)
+    app.register_blueprint(workspace_bp)
\ No newline at end of file
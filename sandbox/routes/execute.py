@@ -3,8 +3,9 @@
 """
 
 import docker
+import json
 import traceback
-from flask import Blueprint, request, jsonify, current_app
+from flask import Blueprint, Response, request, jsonify, current_app, stream_with_context
 
 execute_bp = Blueprint('execute', __name__)
 
@@ -63,6 +64,113 @@ def execute_code():
         return jsonify({"error": f"内部错误: {str(e)}"}), 500
 
 
+@execute_bp.route('/execute/stream', methods=['POST'])
+def execute_code_stream():
+    """流式执行代码 - 对应 bash 工具的实时输出
+
+    响应为 NDJSON，每行一个输出片段 {"stream": "stdout"|"stderr", "data": str}，
+    最后一行为 {"exit_code": int}，执行出错时为 {"error": str}
+    """
+    try:
+        session_manager = current_app.config.get('session_manager')
+        data = request.json
+        session_id = data.get('session_id')
+        command = data.get('command')
+        language = data.get('language', 'bash')
+
+        print(f"\n📨 [/execute/stream] 收到请求", flush=True)
+        print(f"   会话ID: {session_id}", flush=True)
+        print(f"   命令: {command}", flush=True)
+
+        if not session_id or not command:
+            return jsonify({"error": "session_id and command are required"}), 400
+
+        sandbox = session_manager.get_or_create(session_id)
+    except ValueError as e:
+        print(f"❌ [/execute/stream] 业务错误: {str(e)}", flush=True)
+        return jsonify({"error": str(e)}), 400
+    except docker.errors.NotFound as e:
+        print(f"❌ [/execute/stream] 容器不存在: {str(e)}", flush=True)
+        return jsonify({"error": f"容器不存在: {str(e)}"}), 404
+    except RuntimeError as e:
+        print(f"❌ [/execute/stream] 运行时错误: {str(e)}", flush=True)
+        return jsonify({"error": str(e)}), 503
+
+    def generate():
+        try:
+            for stream, value in sandbox.run_code_stream(command, language):
+                if stream == "exit_code":
+                    print(f"✅ [/execute/stream] 执行完成, 退出码: {value}", flush=True)
+                    yield json.dumps({"exit_code": value}) + "\n"
+                else:
+                    yield json.dumps({"stream": stream, "data": value}) + "\n"
+        except Exception as e:
+            print(f"❌ [/execute/stream] 执行异常: {str(e)}", flush=True)
+            traceback.print_exc()
+            yield json.dumps({"error": str(e)}) + "\n"
+
+    return Response(stream_with_context(generate()), mimetype='application/x-ndjson')
+
+
+@execute_bp.route('/exec', methods=['POST'])
+def exec_command():
+    """在会话的项目容器中执行命令 - 对应 bash 工具
+
+    请求: {"session_id", "command", "env": {}, "working_dir", "timeout": 秒, "pty": bool}
+    响应为 NDJSON，格式同 /execute/stream；超时时在退出码之前有 {"timed_out": true}
+    """
+    try:
+        session_manager = current_app.config.get('session_manager')
+        data = request.json
+        session_id = data.get('session_id')
+        command = data.get('command')
+        env = data.get('env') or {}
+        working_dir = data.get('working_dir')
+        timeout = data.get('timeout') or 0
+        pty = bool(data.get('pty'))
+
+        print(f"\n📨 [/exec] 收到请求", flush=True)
+        print(f"   会话ID: {session_id}", flush=True)
+        print(f"   命令: {command}", flush=True)
+        print(f"   工作目录: {working_dir}, 超时: {timeout}, PTY: {pty}", flush=True)
+
+        if not session_id or not command:
+            return jsonify({"error": "session_id and command are required"}), 400
+        if not isinstance(env, dict) or not all(isinstance(k, str) and isinstance(v, str) for k, v in env.items()):
+            return jsonify({"error": "env must be an object of strings"}), 400
+        if not isinstance(timeout, int) or timeout < 0:
+            return jsonify({"error": "timeout must be a non-negative number of seconds"}), 400
+
+        sandbox = session_manager.get_or_create(session_id)
+    except ValueError as e:
+        print(f"❌ [/exec] 业务错误: {str(e)}", flush=True)
+        return jsonify({"error": str(e)}), 400
+    except docker.errors.NotFound as e:
+        print(f"❌ [/exec] 容器不存在: {str(e)}", flush=True)
+        return jsonify({"error": f"容器不存在: {str(e)}"}), 404
+    except RuntimeError as e:
+        print(f"❌ [/exec] 运行时错误: {str(e)}", flush=True)
+        return jsonify({"error": str(e)}), 503
+
+    def generate():
+        try:
+            for stream, value in sandbox.exec_stream(command, env=env, workdir=working_dir, timeout=timeout, tty=pty):
+                if stream == "exit_code":
+                    print(f"✅ [/exec] 执行完成, 退出码: {value}", flush=True)
+                    yield json.dumps({"exit_code": value}) + "\n"
+                elif stream == "timed_out":
+                    print(f"⏱️ [/exec] 执行超时 ({timeout}s)", flush=True)
+                    yield json.dumps({"timed_out": True}) + "\n"
+                else:
+                    yield json.dumps({"stream": stream, "data": value}) + "\n"
+        except Exception as e:
+            print(f"❌ [/exec] 执行异常: {str(e)}", flush=True)
+            traceback.print_exc()
+            yield json.dumps({"error": str(e)}) + "\n"
+
+    return Response(stream_with_context(generate()), mimetype='application/x-ndjson')
+
+
 @execute_bp.route('/diagnostic', methods=['POST'])
 def get_diagnostics():
     """获取诊断信息 - 对应 diagnostics 工具"""
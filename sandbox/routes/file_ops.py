@@ -459,3 +459,280 @@ else:
         import traceback
         traceback.print_exc()
         return jsonify({"error": str(e)}), 500
+
+
+# 懒加载文件列表脚本：只列出目录项（不含文件内容），遵循 .gitignore
+# 参数以 JSON 传入，避免路径拼接进脚本
+ENTRIES_SCRIPT = r'''
+import json, os, subprocess, sys
+
+args = json.loads(sys.argv[1])
+root = os.path.realpath(args["root"])
+depth = args["depth"]
+max_entries = args["max_entries"]
+max_file_size = args["max_file_size"]
+
+# 不在 git 仓库中时使用的默认忽略规则
+DEFAULT_IGNORED = {"node_modules", "__pycache__", ".pytest_cache", ".DS_Store", ".idea", ".vscode", ".venv", "venv"}
+
+def resolve(path):
+    target = os.path.realpath(os.path.join(root, path.lstrip("/")))
+    if target != root and not target.startswith(root + os.sep):
+        return None
+    return target
+
+def git_ignored(paths):
+    """返回被 .gitignore 忽略的路径集合，不是 git 仓库时返回 None"""
+    if not paths:
+        return set()
+    try:
+        proc = subprocess.run(
+            ["git", "-C", root, "check-ignore", "--stdin", "-z"],
+            input="\0".join(paths).encode(), capture_output=True,
+        )
+    except FileNotFoundError:
+        return None
+    # 0: 有匹配, 1: 无匹配, 其他: 不是仓库等错误
+    if proc.returncode not in (0, 1):
+        return None
+    return set(p for p in proc.stdout.decode().split("\0") if p)
+
+count = [0]
+truncated = [False]
+
+def list_dir(path, level):
+    try:
+        names = sorted(os.listdir(path))
+    except OSError:
+        return []
+    names = [n for n in names if n != ".git"]
+    full = [os.path.join(path, n) for n in names]
+    ignored = git_ignored(full)
+    entries = []
+    for name, child in zip(names, full):
+        if ignored is None:
+            if name in DEFAULT_IGNORED:
+                continue
+        elif child in ignored:
+            continue
+        if count[0] >= max_entries:
+            truncated[0] = True
+            break
+        count[0] += 1
+        try:
+            st = os.lstat(child)
+        except OSError:
+            continue
+        rel = "/" + os.path.relpath(child, root).replace(os.sep, "/")
+        entry = {"name": name, "path": rel, "size": st.st_size, "modified": int(st.st_mtime * 1000)}
+        if os.path.islink(child):
+            entry["type"] = "symlink"
+        elif os.path.isdir(child):
+            entry["type"] = "folder"
+            entry["size"] = 0
+            if level < depth:
+                entry["expanded"] = True
+                entry["children"] = list_dir(child, level + 1)
+        else:
+            entry["type"] = "file"
+            if st.st_size > max_file_size:
+                entry["large"] = True
+        entries.append(entry)
+    return entries
+
+target = resolve(args["path"])
+if target is None:
+    print(json.dumps({"error": "path is outside of the project", "code": 400}))
+elif not os.path.isdir(target):
+    print(json.dumps({"error": "directory does not exist: " + args["path"], "code": 404}))
+else:
+    entries = list_dir(target, 1)
+    print(json.dumps({"entries": entries, "truncated": truncated[0]}, ensure_ascii=False))
+'''
+
+# 读取单个文件内容的脚本，内容以 base64 返回，超过大小限制时不读取
+CONTENT_SCRIPT = r'''
+import base64, json, os, sys
+
+args = json.loads(sys.argv[1])
+root = os.path.realpath(args["root"])
+target = os.path.realpath(os.path.join(root, args["path"].lstrip("/")))
+if target != root and not target.startswith(root + os.sep):
+    print(json.dumps({"error": "path is outside of the project", "code": 400}))
+elif not os.path.isfile(target):
+    print(json.dumps({"error": "file does not exist: " + args["path"], "code": 404}))
+else:
+    size = os.path.getsize(target)
+    if size > args["max_size"]:
+        print(json.dumps({"error": "file is too large", "code": 413, "size": size}))
+    else:
+        with open(target, "rb") as f:
+            data = f.read()
+        print(json.dumps({"size": size, "content": base64.b64encode(data).decode()}))
+'''
+
+
+def run_json_script(sandbox, script, args):
+    """在容器内运行脚本并解析其 JSON 输出，返回 (结果, HTTP 状态码)"""
+    result = sandbox.container.exec_run(
+        ["python", "-c", script, json.dumps(args)],
+        workdir=sandbox.workdir,
+        demux=True,
+    )
+    stdout = result.output[0].decode("utf-8") if result.output[0] else ""
+    stderr = result.output[1].decode("utf-8") if result.output[1] else ""
+    if result.exit_code != 0:
+        return {"error": f"script failed: {stderr}"}, 500
+    data = json.loads(stdout)
+    if "error" in data:
+        return data, data.pop("code", 500)
+    return data, 200
+
+
+@file_ops_bp.route('/file/entries', methods=['POST'])
+def list_entries():
+    """懒加载列出目录 - 对应前端文件浏览器
+
+    只返回目录项和元数据（不含文件内容），depth 层以内的目录会展开，
+    被 .gitignore 忽略的文件不会返回。
+    """
+    try:
+        session_manager = current_app.config.get('session_manager')
+        data = request.json
+        project_id = data.get('project_id')
+        args = {
+            "path": data.get('path') or '/',
+            "depth": max(1, int(data.get('depth') or 1)),
+            "max_entries": int(data.get('max_entries') or 2000),
+            "max_file_size": int(data.get('max_file_size') or 1024 * 1024),
+        }
+
+        print(f"\n📨 [/file/entries] 收到请求", flush=True)
+        print(f"   项目ID: {project_id}", flush=True)
+        print(f"   路径: {args['path']}, 深度: {args['depth']}", flush=True)
+
+        sandbox = get_sandbox_from_project(session_manager, project_id)
+        args["root"] = sandbox.workdir
+        result, status = run_json_script(sandbox, ENTRIES_SCRIPT, args)
+        if status != 200:
+            print(f"❌ [/file/entries] 失败: {result.get('error')}", flush=True)
+            return jsonify(result), status
+
+        print(f"✅ [/file/entries] 列出成功, 截断: {result['truncated']}", flush=True)
+        return jsonify({"status": "ok", "path": args["path"], **result})
+    except ValueError as e:
+        print(f"❌ [/file/entries] 参数错误: {str(e)}")
+        return jsonify({"error": str(e)}), 400
+    except Exception as e:
+        print(f"❌ [/file/entries] 异常: {str(e)}")
+        return jsonify({"error": str(e)}), 500
+
+
+@file_ops_bp.route('/file/content', methods=['POST'])
+def read_content():
+    """读取项目中单个文件的内容（base64），超过 max_size 时返回 413"""
+    try:
+        session_manager = current_app.config.get('session_manager')
+        data = request.json
+        project_id = data.get('project_id')
+        path = data.get('path')
+        if not path:
+            return jsonify({"error": "path is required"}), 400
+        args = {"path": path, "max_size": int(data.get('max_size') or 1024 * 1024)}
+
+        print(f"\n📨 [/file/content] 收到请求", flush=True)
+        print(f"   项目ID: {project_id}", flush=True)
+        print(f"   路径: {path}", flush=True)
+
+        sandbox = get_sandbox_from_project(session_manager, project_id)
+        args["root"] = sandbox.workdir
+        result, status = run_json_script(sandbox, CONTENT_SCRIPT, args)
+        if status != 200:
+            print(f"❌ [/file/content] 失败: {result.get('error')}", flush=True)
+            return jsonify(result), status
+
+        print(f"✅ [/file/content] 读取成功, 大小: {result['size']} 字节", flush=True)
+        return jsonify({"status": "ok", "path": path, **result})
+    except ValueError as e:
+        print(f"❌ [/file/content] 参数错误: {str(e)}")
+        return jsonify({"error": str(e)}), 400
+    except Exception as e:
+        print(f"❌ [/file/content] 异常: {str(e)}")
+        return jsonify({"error": str(e)}), 500
+
+
+# 工作目录快照脚本：返回所有文件的修改时间和大小，用于检测文件变化
+# git 仓库中使用 git ls-files 遵循 .gitignore，否则使用默认忽略规则
+SNAPSHOT_SCRIPT = r'''
+import json, os, subprocess, sys
+
+args = json.loads(sys.argv[1])
+root = os.path.realpath(args["root"])
+max_entries = args["max_entries"]
+
+DEFAULT_IGNORED = {".git", "node_modules", "__pycache__", ".pytest_cache", ".DS_Store", ".idea", ".vscode", ".venv", "venv"}
+
+def git_files():
+    try:
+        proc = subprocess.run(
+            ["git", "-C", root, "ls-files", "-co", "--exclude-standard", "-z"],
+            capture_output=True,
+        )
+    except FileNotFoundError:
+        return None
+    if proc.returncode != 0:
+        return None
+    return [p for p in proc.stdout.decode().split("\0") if p]
+
+def walk_files():
+    for dirpath, dirnames, filenames in os.walk(root):
+        dirnames[:] = sorted(d for d in dirnames if d not in DEFAULT_IGNORED)
+        for name in sorted(filenames):
+            if name not in DEFAULT_IGNORED:
+                yield os.path.relpath(os.path.join(dirpath, name), root)
+
+paths = git_files()
+if paths is None:
+    paths = walk_files()
+
+files = {}
+truncated = False
+for rel in paths:
+    if len(files) >= max_entries:
+        truncated = True
+        break
+    try:
+        st = os.lstat(os.path.join(root, rel))
+    except OSError:
+        continue
+    files["/" + rel.replace(os.sep, "/")] = {"modified": int(st.st_mtime * 1000), "size": st.st_size}
+print(json.dumps({"files": files, "truncated": truncated}, ensure_ascii=False))
+'''
+
+
+@file_ops_bp.route('/file/snapshot', methods=['POST'])
+def snapshot_files():
+    """获取项目工作目录快照 - 对应文件变化监听
+
+    返回每个文件的修改时间（毫秒）和大小，不含内容
+    """
+    try:
+        session_manager = current_app.config.get('session_manager')
+        data = request.json
+        project_id = data.get('project_id')
+        args = {"max_entries": int(data.get('max_entries') or 20000)}
+
+        sandbox = get_sandbox_from_project(session_manager, project_id)
+        args["root"] = sandbox.workdir
+        result, status = run_json_script(sandbox, SNAPSHOT_SCRIPT, args)
+        if status != 200:
+            print(f"❌ [/file/snapshot] 失败: {result.get('error')}", flush=True)
+            return jsonify(result), status
+
+        return jsonify({"status": "ok", **result})
+    except ValueError as e:
+        print(f"❌ [/file/snapshot] 参数错误: {str(e)}")
+        return jsonify({"error": str(e)}), 400
+    except Exception as e:
+        print(f"❌ [/file/snapshot] 异常: {str(e)}")
+        return jsonify({"error": str(e)}), 500
@@ -0,0 +1,67 @@
+"""
+工作目录快照路由
+"""
+
+from flask import Blueprint, request, jsonify, current_app, Response
+
+from routes.file_ops import get_sandbox_from_project
+
+workspace_bp = Blueprint('workspace', __name__)
+
+# 快照中不包含的目录，恢复时保留原样（可由依赖重新生成）
+ARCHIVE_EXCLUDE = ["node_modules", "__pycache__", ".venv", "venv"]
+
+
+@workspace_bp.route('/workspace/archive', methods=['POST'])
+def archive_workspace():
+    """将项目工作目录打包为 tar.gz 返回，超过 max_size 时返回 413"""
+    try:
+        session_manager = current_app.config.get('session_manager')
+        data = request.json
+        project_id = data.get('project_id')
+        max_size = int(data.get('max_size') or 0)
+
+        print(f"\n📨 [/workspace/archive] 收到请求", flush=True)
+        print(f"   项目ID: {project_id}", flush=True)
+
+        sandbox = get_sandbox_from_project(session_manager, project_id)
+        archive = sandbox.archive_workdir(ARCHIVE_EXCLUDE)
+        if max_size and len(archive) > max_size:
+            print(f"❌ [/workspace/archive] 归档过大: {len(archive)} 字节", flush=True)
+            return jsonify({"error": "workspace archive is too large", "size": len(archive)}), 413
+
+        print(f"✅ [/workspace/archive] 打包成功, 大小: {len(archive)} 字节", flush=True)
+        return Response(archive, mimetype='application/gzip')
+    except ValueError as e:
+        print(f"❌ [/workspace/archive] 参数错误: {str(e)}")
+        return jsonify({"error": str(e)}), 400
+    except Exception as e:
+        print(f"❌ [/workspace/archive] 异常: {str(e)}")
+        return jsonify({"error": str(e)}), 500
+
+
+@workspace_bp.route('/workspace/restore', methods=['POST'])
+def restore_workspace():
+    """用请求体中的 tar.gz 归档替换项目工作目录，project_id 通过查询参数传递"""
+    try:
+        session_manager = current_app.config.get('session_manager')
+        project_id = request.args.get('project_id')
+        archive = request.get_data()
+        if not archive:
+            return jsonify({"error": "archive is required"}), 400
+
+        print(f"\n📨 [/workspace/restore] 收到请求", flush=True)
+        print(f"   项目ID: {project_id}", flush=True)
+        print(f"   归档大小: {len(archive)} 字节", flush=True)
+
+        sandbox = get_sandbox_from_project(session_manager, project_id)
+        sandbox.restore_workdir(archive, ARCHIVE_EXCLUDE)
+
+        print(f"✅ [/workspace/restore] 恢复成功", flush=True)
+        return jsonify({"status": "ok"})
+    except ValueError as e:
+        print(f"❌ [/workspace/restore] 参数错误: {str(e)}")
+        return jsonify({"error": str(e)}), 400
+    except Exception as e:
+        print(f"❌ [/workspace/restore] 异常: {str(e)}")
+        return jsonify({"error": str(e)}), 500
@@ -215,6 +215,84 @@ class Sandbox:
                 "exit_code": -1
             }
     
+    def run_code_stream(self, code: str, language: str = "bash"):
+        """
+        在沙箱中执行代码，边执行边返回输出
+
+        Args:
+            code: 要执行的代码
+            language: 编程语言 (目前支持 python, bash, sh)
+
+        Yields:
+            ("stdout" | "stderr", str) 输出片段，最后是 ("exit_code", int)
+        """
+        if not self.container:
+            raise RuntimeError("沙箱未启动，请先调用 start() 或使用 with 语句")
+
+        if language == "python":
+            cmd = ["python", "-c", code]
+        elif language == "bash":
+            cmd = ["bash", "-c", code]
+        elif language == "sh":
+            cmd = ["sh", "-c", code]
+        else:
+            raise ValueError(f"不支持的语言: {language}")
+
+        # 使用底层 API，流式读取输出后才能查询退出码
+        exec_id = self.client.api.exec_create(self.container.id, cmd, workdir=self.workdir)["Id"]
+        for stdout, stderr in self.client.api.exec_start(exec_id, stream=True, demux=True):
+            if stdout:
+                yield "stdout", stdout.decode("utf-8", errors="replace")
+            if stderr:
+                yield "stderr", stderr.decode("utf-8", errors="replace")
+        yield "exit_code", self.client.api.exec_inspect(exec_id)["ExitCode"]
+
+    def exec_stream(self, command: str, env: dict = None, workdir: str = None,
+                    timeout: int = 0, tty: bool = False):
+        """
+        在沙箱中执行 bash 命令，边执行边返回输出
+
+        Args:
+            command: bash 命令
+            env: 额外的环境变量
+            workdir: 工作目录，默认为沙箱工作目录
+            timeout: 超时时间(秒)，0 表示不限制；超时后命令被终止
+            tty: 是否分配伪终端，分配时 stderr 合并到 stdout
+
+        Yields:
+            ("stdout" | "stderr", str) 输出片段，最后是 ("exit_code", int)，
+            超时时在退出码之前有 ("timed_out", True)
+        """
+        if not self.container:
+            raise RuntimeError("沙箱未启动，请先调用 start() 或使用 with 语句")
+
+        cmd = ["bash", "-c", command]
+        if timeout and timeout > 0:
+            # 容器内没有 timeout 命令时不限制时间
+            cmd = [
+                "sh", "-c",
+                'if command -v timeout >/dev/null 2>&1; then exec timeout -k 5 "$0" bash -c "$1"; else exec bash -c "$1"; fi',
+                str(int(timeout)), command,
+            ]
+
+        exec_id = self.client.api.exec_create(
+            self.container.id,
+            cmd,
+            workdir=workdir or self.workdir,
+            environment=env or None,
+            tty=tty,
+        )["Id"]
+        for stdout, stderr in self.client.api.exec_start(exec_id, stream=True, demux=True, tty=tty):
+            if stdout:
+                yield "stdout", stdout.decode("utf-8", errors="replace")
+            if stderr:
+                yield "stderr", stderr.decode("utf-8", errors="replace")
+        exit_code = self.client.api.exec_inspect(exec_id)["ExitCode"]
+        # timeout 以 124 退出，-k 强制终止时为 137
+        if timeout and timeout > 0 and exit_code in (124, 137):
+            yield "timed_out", True
+        yield "exit_code", exit_code
+
     def write_file(self, path: str, content: str):
         """
         在沙箱中写入文件
@@ -299,3 +377,49 @@ class Sandbox:
             
         files = result.output.decode("utf-8").strip().split("\n")
         return [f for f in files if f]
+
+    def archive_workdir(self, exclude: list = None) -> bytes:
+        """
+        将工作目录打包为 tar.gz
+
+        Args:
+            exclude: 不打包的目录或文件名（如 node_modules）
+
+        Returns:
+            tar.gz 归档内容，成员路径相对工作目录
+        """
+        if not self.container:
+            raise RuntimeError("沙箱未启动")
+
+        cmd = ["tar", "czf", "-", "-C", self.workdir]
+        for name in exclude or []:
+            cmd.append(f"--exclude=./{name}")
+        cmd.append(".")
+        result = self.container.exec_run(cmd, demux=True)
+        stdout, stderr = result.output
+        if result.exit_code != 0:
+            raise RuntimeError(f"打包工作目录失败: {(stderr or b'').decode(errors='replace')}")
+        return stdout or b""
+
+    def restore_workdir(self, archive: bytes, keep: list = None):
+        """
+        清空工作目录并解压 tar.gz 归档
+
+        Args:
+            archive: archive_workdir 生成的 tar.gz 归档
+            keep: 清空时保留的目录或文件名（打包时排除的内容）
+        """
+        if not self.container:
+            raise RuntimeError("沙箱未启动")
+
+        cmd = ["find", self.workdir, "-mindepth", "1", "-maxdepth", "1"]
+        for name in keep or []:
+            cmd += ["!", "-name", name]
+        cmd += ["-exec", "rm", "-rf", "{}", "+"]
+        result = self.container.exec_run(cmd)
+        if result.exit_code != 0:
+            raise RuntimeError(f"清空工作目录失败: {result.output.decode(errors='replace')}")
+
+        # Docker 接受 gzip 压缩的 tar 归档
+        if not self.container.put_archive(self.workdir, archive):
+            raise RuntimeError("解压归档失败")